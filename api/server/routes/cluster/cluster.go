@@ -0,0 +1,428 @@
+// Package cluster provides the /cluster API routes (worker registration and job leasing)
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+)
+
+// DefaultLease is the job lease duration when the worker doesn't request one
+const DefaultLease = 10 * time.Minute
+
+// swagger:response
+type successResponse struct {
+	Success bool `json:"success,omitempty"`
+}
+
+// swagger:response
+type workerResponse *model.Worker
+
+// swagger:response
+type workersResponse []*model.Worker
+
+// swagger:response
+type jobResponse *model.Job
+
+// swagger:response
+type jobsResponse []*model.Job
+
+// swagger:parameters postClusterWorker
+type workerParams struct {
+	// in:body
+	Body struct {
+		ID   string `json:"id" binding:"required"`
+		Host string `json:"host,omitempty"`
+		// comma separated job kinds (scan, rescan, extract) the worker runs (empty is all)
+		Kinds string `json:"kinds,omitempty"`
+	}
+}
+
+// swagger:parameters postClusterJob
+type jobParams struct {
+	// in:body
+	Body struct {
+		Kind model.JobKind `json:"kind" binding:"required"`
+		// path to the IPSW (scan/rescan jobs)
+		Path    string `json:"path,omitempty"`
+		PemDB   string `json:"pem_db,omitempty"`
+		SigsDir string `json:"sig_dir,omitempty"`
+		// what to extract: kernel, dsc, dmg, pattern or sptm (extract jobs)
+		Extract string `json:"extract,omitempty"`
+		// the extract config (same as the /extract routes' body)
+		Config      map[string]any `json:"config,omitempty"`
+		MaxAttempts int            `json:"max_attempts,omitempty"`
+	}
+}
+
+// swagger:parameters postClusterLease
+type leaseParams struct {
+	// in:body
+	Body struct {
+		Worker string `json:"worker" binding:"required"`
+		// comma separated job kinds to lease (empty is any)
+		Kinds string `json:"kinds,omitempty"`
+		// lease duration (i.e. 10m)
+		TTL string `json:"ttl,omitempty"`
+	}
+}
+
+// swagger:parameters putClusterJobComplete
+type completeParams struct {
+	// in:body
+	Body struct {
+		Worker string `json:"worker" binding:"required"`
+		Result string `json:"result,omitempty"`
+		// the job failed with this error
+		Error string `json:"error,omitempty"`
+	}
+}
+
+func parseTTL(ttl string) (time.Duration, error) {
+	if ttl == "" {
+		return DefaultLease, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl '%s': %v", ttl, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("ttl must be positive")
+	}
+	return d, nil
+}
+
+func abort(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+	case errors.Is(err, db.ErrLeaseLost):
+		c.AbortWithStatusJSON(http.StatusConflict, types.NewGenericError(err))
+	default:
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+	}
+}
+
+// AddRoutes adds the cluster routes to the router
+func AddRoutes(rg *gin.RouterGroup, cluster db.Cluster) {
+	// swagger:route POST /cluster/workers Cluster postClusterWorker
+	//
+	// Register Worker
+	//
+	// Register (or update) a worker.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: workerResponse
+	//       400: genericError
+	//       500: genericError
+	rg.POST("/cluster/workers", func(c *gin.Context) {
+		var params workerParams
+		if err := c.ShouldBindJSON(&params.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		if _, err := db.ParseJobKinds(params.Body.Kinds); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		w := &model.Worker{ID: params.Body.ID, Host: params.Body.Host, Kinds: params.Body.Kinds}
+		if err := cluster.RegisterWorker(w); err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, workerResponse(w))
+	})
+	// swagger:route GET /cluster/workers Cluster getClusterWorkers
+	//
+	// Workers
+	//
+	// Get the registered workers.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: workersResponse
+	//       500: genericError
+	rg.GET("/cluster/workers", func(c *gin.Context) {
+		workers, err := cluster.GetWorkers()
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, workersResponse(workers))
+	})
+	// swagger:route PUT /cluster/workers/{id}/heartbeat Cluster putClusterWorkerHeartbeat
+	//
+	// Heartbeat
+	//
+	// Update a worker's last seen time.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: id
+	//         in: path
+	//         description: worker ID
+	//         required: true
+	//         type: string
+	//
+	//     Responses:
+	//       200: successResponse
+	//       404: genericError
+	//       500: genericError
+	rg.PUT("/cluster/workers/:id/heartbeat", func(c *gin.Context) {
+		if err := cluster.Heartbeat(c.Param("id")); err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, successResponse{Success: true})
+	})
+	// swagger:route POST /cluster/jobs Cluster postClusterJob
+	//
+	// Queue Job
+	//
+	// Queue a scan, rescan or extract job for the workers.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       201: jobResponse
+	//       400: genericError
+	//       500: genericError
+	rg.POST("/cluster/jobs", func(c *gin.Context) {
+		var params jobParams
+		if err := c.ShouldBindJSON(&params.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		body := params.Body
+		job := &model.Job{Kind: body.Kind, MaxAttempts: body.MaxAttempts}
+		switch body.Kind {
+		case model.JobScan, model.JobRescan:
+			if body.Path == "" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing path to IPSW"})
+				return
+			}
+			job.Path = filepath.Clean(body.Path)
+			if body.PemDB != "" {
+				job.PemDB = filepath.Clean(body.PemDB)
+			}
+			if body.SigsDir != "" {
+				job.SigsDir = filepath.Clean(body.SigsDir)
+			}
+		case model.JobExtract:
+			if !slices.Contains(model.ExtractTypes, body.Extract) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{
+					Error: fmt.Sprintf("invalid extract type '%s' (must be one of: %s)", body.Extract, strings.Join(model.ExtractTypes, ", ")),
+				})
+				return
+			}
+			conf, err := json.Marshal(body.Config)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+				return
+			}
+			job.Extract, job.Config = body.Extract, string(conf)
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{
+				Error: fmt.Sprintf("invalid job kind '%s' (must be %s, %s or %s)", body.Kind, model.JobScan, model.JobRescan, model.JobExtract),
+			})
+			return
+		}
+		if err := cluster.CreateJob(job); err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, jobResponse(job))
+	})
+	// swagger:route GET /cluster/jobs Cluster getClusterJobs
+	//
+	// Jobs
+	//
+	// Get the jobs (optionally filtered by status).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: status
+	//         in: query
+	//         description: job status (pending, leased, done or failed)
+	//         required: false
+	//         type: string
+	//
+	//     Responses:
+	//       200: jobsResponse
+	//       500: genericError
+	rg.GET("/cluster/jobs", func(c *gin.Context) {
+		jobs, err := cluster.GetJobs(model.JobStatus(c.Query("status")))
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, jobsResponse(jobs))
+	})
+	// swagger:route GET /cluster/jobs/{id} Cluster getClusterJob
+	//
+	// Job
+	//
+	// Get a job.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: id
+	//         in: path
+	//         description: job ID
+	//         required: true
+	//         type: integer
+	//
+	//     Responses:
+	//       200: jobResponse
+	//       404: genericError
+	//       500: genericError
+	rg.GET("/cluster/jobs/:id", func(c *gin.Context) {
+		job, err := cluster.GetJob(cast.ToUint(c.Param("id")))
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, jobResponse(job))
+	})
+	// swagger:route POST /cluster/lease Cluster postClusterLease
+	//
+	// Lease Job
+	//
+	// Lease the oldest pending (or expired) job to a worker.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: jobResponse
+	//       204: description: no jobs to lease
+	//       400: genericError
+	//       500: genericError
+	rg.POST("/cluster/lease", func(c *gin.Context) {
+		var params leaseParams
+		if err := c.ShouldBindJSON(&params.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		kinds, err := db.ParseJobKinds(params.Body.Kinds)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		ttl, err := parseTTL(params.Body.TTL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		job, err := cluster.LeaseJob(params.Body.Worker, kinds, ttl)
+		if err != nil {
+			if errors.Is(err, model.ErrNotFound) {
+				c.Status(http.StatusNoContent)
+				return
+			}
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, jobResponse(job))
+	})
+	// swagger:route PUT /cluster/jobs/{id}/renew Cluster putClusterJobRenew
+	//
+	// Renew Lease
+	//
+	// Extend a worker's lease on a job.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: id
+	//         in: path
+	//         description: job ID
+	//         required: true
+	//         type: integer
+	//       + name: worker
+	//         in: query
+	//         description: worker ID
+	//         required: true
+	//         type: string
+	//       + name: ttl
+	//         in: query
+	//         description: lease duration (i.e. 10m)
+	//         required: false
+	//         type: string
+	//
+	//     Responses:
+	//       200: successResponse
+	//       409: genericError
+	//       500: genericError
+	rg.PUT("/cluster/jobs/:id/renew", func(c *gin.Context) {
+		worker, ok := c.GetQuery("worker")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing worker query parameter"})
+			return
+		}
+		ttl, err := parseTTL(c.Query("ttl"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		if err := cluster.RenewLease(cast.ToUint(c.Param("id")), worker, ttl); err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, successResponse{Success: true})
+	})
+	// swagger:route PUT /cluster/jobs/{id}/complete Cluster putClusterJobComplete
+	//
+	// Complete Job
+	//
+	// Mark a worker's job done (or failed if an error is given).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: successResponse
+	//       409: genericError
+	//       500: genericError
+	rg.PUT("/cluster/jobs/:id/complete", func(c *gin.Context) {
+		var params completeParams
+		if err := c.ShouldBindJSON(&params.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		var jobErr error
+		if params.Body.Error != "" {
+			jobErr = errors.New(params.Body.Error)
+		}
+		if err := cluster.CompleteJob(cast.ToUint(c.Param("id")), params.Body.Worker, params.Body.Result, jobErr); err != nil {
+			abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, successResponse{Success: true})
+	})
+}
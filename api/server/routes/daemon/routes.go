@@ -7,11 +7,12 @@ import (
 
 	"github.com/blacktop/ipsw/api"
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
 	"github.com/gin-gonic/gin"
 )
 
 // AddRoutes adds the download routes to the router
-func AddRoutes(rg *gin.RouterGroup) {
+func AddRoutes(rg *gin.RouterGroup, fc *cache.Files) {
 	// swagger:route HEAD /_ping Daemon headDaemonPing
 	//
 	// Ping
@@ -53,6 +54,29 @@ func AddRoutes(rg *gin.RouterGroup) {
 			BuilderVersion: types.BuildVersion,
 		}})
 	})
+	// swagger:route GET /cache Daemon getDaemonCache
+	//
+	// Cache
+	//
+	// This will return the daemon's open file cache (dyld_shared_caches and kernelcaches) statistics.
+	//
+	//     Responses:
+	//       200: cacheResponse
+	rg.GET("/cache", func(c *gin.Context) {
+		c.JSON(http.StatusOK, cacheResponse{fc.Stats()})
+	})
+	// swagger:route DELETE /cache Daemon deleteDaemonCache
+	//
+	// Purge Cache
+	//
+	// This will close all the daemon's cached open files.
+	//
+	//     Responses:
+	//       200: cacheResponse
+	rg.DELETE("/cache", func(c *gin.Context) {
+		fc.Purge()
+		c.JSON(http.StatusOK, cacheResponse{fc.Stats()})
+	})
 }
 
 // swagger:response versionResponse
@@ -61,6 +85,12 @@ type versionResponse struct {
 	types.Version
 }
 
+// swagger:response cacheResponse
+type cacheResponse struct {
+	// swagger:allOf
+	cache.FileStats
+}
+
 func pingHandler(c *gin.Context) {
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
@@ -6,6 +6,7 @@ import (
 	"sort"
 
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/xcode"
 	"github.com/gin-gonic/gin"
 )
@@ -35,7 +36,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 
 		devices, err := xcode.GetDevices()
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 
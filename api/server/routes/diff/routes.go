@@ -6,9 +6,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/apex/log"
 	"github.com/aymanbagabas/go-udiff"
 	"github.com/blacktop/ipsw/api/types"
+	idiff "github.com/blacktop/ipsw/internal/diff"
+	"github.com/blacktop/ipsw/internal/webhook"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,6 +28,38 @@ type diffResponse struct {
 	Diff string `json:"diff"`
 }
 
+// swagger:parameters postDiffIPSW
+type diffIpswParams struct {
+	// in:body
+	Body struct {
+		Previous string `json:"prev" binding:"required"`
+		Current  string `json:"curr" binding:"required"`
+		// report title (defaults to the IPSW file names)
+		Title string `json:"title,omitempty"`
+		// report output folder
+		Output string `json:"output" binding:"required"`
+		// html, markdown, json or idiff (defaults to html)
+		Format string `json:"format,omitempty"`
+		// KDKs to diff (previous and current)
+		KDKs     []string `json:"kdks,omitempty"`
+		LaunchD  bool     `json:"launchd,omitempty"`
+		Firmware bool     `json:"fw,omitempty"`
+		Features bool     `json:"feat,omitempty"`
+		CStrings bool     `json:"strs,omitempty"`
+		PemDB    string   `json:"pem_db,omitempty"`
+		// disassemble (up to) this many changed functions per updated kext/dylib
+		Functions int `json:"funcs,omitempty"`
+		// symbol server URL the html report links to
+		Server string `json:"server,omitempty"`
+	}
+}
+
+// swagger:response diffIpswResponse
+type diffIpswResponse struct {
+	Title  string `json:"title"`
+	Output string `json:"output"`
+}
+
 // AddRoutes adds the diff routes to the router
 func AddRoutes(rg *gin.RouterGroup) {
 	dr := rg.Group("/diff")
@@ -39,17 +76,17 @@ func AddRoutes(rg *gin.RouterGroup) {
 	dr.POST("/files", func(c *gin.Context) {
 		var params diffFilesParams
 		if err := c.ShouldBindJSON(&params); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 			return
 		}
 		a, err := os.ReadFile(filepath.Clean(params.Previous))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		b, err := os.ReadFile(filepath.Clean(params.Current))
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.IndentedJSON(http.StatusOK, diffResponse{Diff: udiff.Unified(params.Previous, params.Current, fmt.Sprintln(a), fmt.Sprintln(b))})
@@ -66,9 +103,98 @@ func AddRoutes(rg *gin.RouterGroup) {
 	dr.POST("/blobs", func(c *gin.Context) {
 		var params diffFilesParams
 		if err := c.ShouldBindJSON(&params); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 			return
 		}
 		c.IndentedJSON(http.StatusOK, diffResponse{Diff: udiff.Unified("", "", fmt.Sprintln(params.Previous), fmt.Sprintln(params.Current))})
 	})
+	// swagger:route POST /diff/ipsw Diff postDiffIPSW
+	//
+	// IPSW
+	//
+	// This will diff two IPSWs in the background and write the report to the output folder
+	// (firing the diff.ready or diff.failed webhook when it is done).
+	//
+	//     Responses:
+	//       202: diffIpswResponse
+	//       400: genericError
+	dr.POST("/ipsw", func(c *gin.Context) {
+		var params diffIpswParams
+		if err := c.ShouldBindJSON(&params.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		p := params.Body
+		if len(p.KDKs) != 0 && len(p.KDKs) != 2 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "kdks must be the previous and current KDK"})
+			return
+		}
+		for _, ipsw := range []string{p.Previous, p.Current} {
+			if _, err := os.Stat(filepath.Clean(ipsw)); err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+				return
+			}
+		}
+		if p.Format == "" {
+			p.Format = "html"
+		}
+		switch p.Format {
+		case "html", "markdown", "json", "idiff":
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: fmt.Sprintf("invalid format '%s' (must be html, markdown, json or idiff)", p.Format)})
+			return
+		}
+		if p.Title == "" {
+			p.Title = fmt.Sprintf("%s .vs %s",
+				strings.TrimSuffix(filepath.Base(p.Previous), filepath.Ext(p.Previous)),
+				strings.TrimSuffix(filepath.Base(p.Current), filepath.Ext(p.Current)))
+		}
+		go func() {
+			data := map[string]string{
+				"title":  p.Title,
+				"prev":   p.Previous,
+				"curr":   p.Current,
+				"output": p.Output,
+				"format": p.Format,
+			}
+			if err := diffIPSWs(p.Title, p.Previous, p.Current, p.Output, p.Format, &idiff.Config{
+				KDKs:      p.KDKs,
+				LaunchD:   p.LaunchD,
+				Firmware:  p.Firmware,
+				Features:  p.Features,
+				CStrings:  p.CStrings,
+				PemDB:     p.PemDB,
+				Functions: p.Functions,
+				Server:    p.Server,
+			}); err != nil {
+				log.WithField("title", p.Title).Errorf("failed to diff IPSWs: %v", err)
+				data["error"] = err.Error()
+				webhook.Fire(webhook.EventDiffFailed, "Diff "+p.Title+" failed", data)
+				return
+			}
+			webhook.Fire(webhook.EventDiffReady, "Diff "+p.Title+" is ready", data)
+		}()
+		c.IndentedJSON(http.StatusAccepted, diffIpswResponse{Title: p.Title, Output: p.Output})
+	})
+}
+
+func diffIPSWs(title, prev, curr, output, format string, conf *idiff.Config) error {
+	conf.Title = title
+	conf.IpswOld = filepath.Clean(prev)
+	conf.IpswNew = filepath.Clean(curr)
+	conf.Output = filepath.Clean(output)
+	d := idiff.New(conf)
+	if err := d.Diff(); err != nil {
+		return err
+	}
+	switch format {
+	case "markdown":
+		return d.Markdown()
+	case "json":
+		return d.ToJSON()
+	case "idiff":
+		return d.Save()
+	default:
+		return d.HTML()
+	}
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/blacktop/ipsw/api/types"
 	"github.com/blacktop/ipsw/internal/commands/download/ipsw"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,7 +29,7 @@ type latestIpswIosVersionResponse struct {
 func latestVersion(c *gin.Context) {
 	version, err := ipsw.GetLatestIosVersion("", true)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 	c.IndentedJSON(http.StatusOK, latestIpswIosVersionResponse{Version: version})
@@ -42,7 +43,7 @@ type latestIpswIosBuildResponse struct {
 func latestBuild(c *gin.Context) {
 	build, err := ipsw.GetLatestIosBuild()
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 	c.IndentedJSON(http.StatusOK, latestIpswIosBuildResponse{Build: build})
@@ -3,19 +3,30 @@ package dsc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
 	cmd "github.com/blacktop/ipsw/internal/commands/dsc"
+	"github.com/blacktop/ipsw/internal/commands/mount"
+	"github.com/blacktop/ipsw/internal/db"
 	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/model"
 	"github.com/blacktop/ipsw/internal/swift"
+	"github.com/blacktop/ipsw/internal/syms"
 	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/objc"
+	pswift "github.com/blacktop/ipsw/pkg/swift"
 	"github.com/gin-gonic/gin"
 )
 
@@ -38,27 +49,29 @@ type dscAddrToOffResponse struct {
 	cmd.Offset
 }
 
-func dscAddrToOff(c *gin.Context) {
-	var params dscAddrToOffParams
-	if err := c.ShouldBindJSON(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
-		return
-	}
+func dscAddrToOff(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscAddrToOffParams
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
 
-	f, err := dyld.Open(filepath.Clean(params.Path))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+		f, release, err := cache.Acquire(fc, filepath.Clean(params.Path), dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	off, err := cmd.ConvertAddressToOffset(f, params.Addr)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		off, err := cmd.ConvertAddressToOffset(f, params.Addr)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.IndentedJSON(http.StatusOK, dscAddrToOffResponse{*off})
+		c.IndentedJSON(http.StatusOK, dscAddrToOffResponse{*off})
+	}
 }
 
 // swagger:parameters postDscAddrToSym
@@ -79,41 +92,43 @@ type dscAddrToSymResponse struct {
 	Body []cmd.SymbolLookup `json:"body"`
 }
 
-func dscAddrToSym(c *gin.Context) {
-	var params dscAddrsToSymsParams
-	if err := c.ShouldBindJSON(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
-		return
-	}
-
-	f, err := dyld.Open(filepath.Clean(params.Path))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
-
-	w := c.Writer
-	enc := json.NewEncoder(w)
-	header := w.Header()
-	header.Set("Transfer-Encoding", "chunked")
-	header.Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+func dscAddrToSym(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscAddrsToSymsParams
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
 
-	var syms []cmd.SymbolLookup
-	for _, addr := range params.Addrs {
-		sym, err := cmd.LookupSymbol(f, addr)
+		f, release, err := cache.Acquire(fc, filepath.Clean(params.Path), dyld.Open)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
-		sym.Demanged = demangle.Do(sym.Symbol, false, false)
-		sym.Demanged = swift.DemangleBlob(sym.Demanged)
-		enc.Encode(sym)
-		w.(http.Flusher).Flush()
-	}
+		defer release()
+
+		w := c.Writer
+		enc := json.NewEncoder(w)
+		header := w.Header()
+		header.Set("Transfer-Encoding", "chunked")
+		header.Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		var syms []cmd.SymbolLookup
+		for _, addr := range params.Addrs {
+			sym, err := cmd.LookupSymbol(f, addr)
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			sym.Demanged = demangle.Do(sym.Symbol, false, false)
+			sym.Demanged = swift.DemangleBlob(sym.Demanged)
+			enc.Encode(sym)
+			w.(http.Flusher).Flush()
+		}
 
-	c.IndentedJSON(http.StatusOK, syms)
+		c.IndentedJSON(http.StatusOK, syms)
+	}
 }
 
 // swagger:response
@@ -124,26 +139,28 @@ type dscImportsResponse struct {
 	ImportedBy *cmd.ImportedBy `json:"imported_by,omitempty"`
 }
 
-func dscImports(c *gin.Context) {
-	dscPath := c.Query("path")
-	if dscPath == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required 'path' query parameter"})
-		return
-	}
-	f, err := dyld.Open(dscPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+func dscImports(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		if dscPath == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required 'path' query parameter"})
+			return
+		}
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	imps, err := cmd.GetDylibsThatImport(f, c.Query("dylib"))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		imps, err := cmd.GetDylibsThatImport(f, c.Query("dylib"))
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.IndentedJSON(http.StatusOK, dscImportsResponse{Path: dscPath, ImportedBy: imps})
+		c.IndentedJSON(http.StatusOK, dscImportsResponse{Path: dscPath, ImportedBy: imps})
+	}
 }
 
 // swagger:response
@@ -152,26 +169,28 @@ type dscInfoResponse struct {
 	Info *cmd.Info `json:"info,omitempty"`
 }
 
-func dscInfo(c *gin.Context) {
-	dscPath := c.Query("path")
-	if dscPath == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required 'path' query parameter"})
-		return
-	}
-	f, err := dyld.Open(dscPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+func dscInfo(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		if dscPath == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required 'path' query parameter"})
+			return
+		}
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	info, err := cmd.GetInfo(f)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		info, err := cmd.GetInfo(f)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.IndentedJSON(http.StatusOK, dscInfoResponse{Path: dscPath, Info: info})
+		c.IndentedJSON(http.StatusOK, dscInfoResponse{Path: dscPath, Info: info})
+	}
 }
 
 // swagger:response
@@ -180,28 +199,130 @@ type dscMachoResponse struct {
 	Macho *macho.File `json:"macho,omitempty"`
 }
 
-func dscMacho(c *gin.Context) {
-	dscPath := c.Query("path")
-	f, err := dyld.Open(dscPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+func dscMacho(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	image, err := f.Image(c.Query("dylib"))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
+		image, err := f.Image(c.Query("dylib"))
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		m, err := image.GetMacho()
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, dscMachoResponse{Path: dscPath, Macho: m})
 	}
+}
 
-	m, err := image.GetMacho()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
+// swagger:response
+type dscObjcResponse struct {
+	Path string      `json:"path,omitempty"`
+	ObjC *objc.Image `json:"objc,omitempty"`
+}
+
+func dscObjC(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		if dscPath == "" || c.Query("dylib") == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required 'path' and 'dylib' query parameters"})
+			return
+		}
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		image, err := f.Image(c.Query("dylib"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+			return
+		}
+		m, err := image.GetMacho()
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		img, err := objc.ParseImage(m)
+		if err != nil {
+			if errors.Is(err, objc.ErrNoObjC) {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+				return
+			}
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		img.Name = image.Name
+
+		if c.Query("header") == "true" {
+			c.String(http.StatusOK, img.Header())
+			return
+		}
+		c.IndentedJSON(http.StatusOK, dscObjcResponse{Path: dscPath, ObjC: img})
 	}
+}
 
-	c.IndentedJSON(http.StatusOK, dscMachoResponse{Path: dscPath, Macho: m})
+// swagger:response
+type dscSwiftResponse struct {
+	Path  string        `json:"path,omitempty"`
+	Swift *pswift.Image `json:"swift,omitempty"`
+}
+
+func dscSwift(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		if dscPath == "" || c.Query("dylib") == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing required 'path' and 'dylib' query parameters"})
+			return
+		}
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		image, err := f.Image(c.Query("dylib"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+			return
+		}
+		m, err := image.GetMacho()
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		img, err := pswift.ParseImage(m)
+		if err != nil {
+			if errors.Is(err, pswift.ErrNoSwift) {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+				return
+			}
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		img.Name = image.Name
+
+		if c.Query("interface") == "true" {
+			c.String(http.StatusOK, img.Interface())
+			return
+		}
+		c.IndentedJSON(http.StatusOK, dscSwiftResponse{Path: dscPath, Swift: img})
+	}
 }
 
 // swagger:parameters postDscOffToAddr
@@ -224,27 +345,29 @@ type dscOffToAddrResponse struct {
 	cmd.Address
 }
 
-func dscOffToAddr(c *gin.Context) {
-	var params dscOffToAddrParams
-	if err := c.ShouldBindJSON(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
-		return
-	}
+func dscOffToAddr(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscOffToAddrParams
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
 
-	f, err := dyld.Open(filepath.Clean(params.Path))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+		f, release, err := cache.Acquire(fc, filepath.Clean(params.Path), dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	addr, err := cmd.ConvertOffsetToAddress(f, params.Offset)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		addr, err := cmd.ConvertOffsetToAddress(f, params.Offset)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.IndentedJSON(http.StatusOK, dscOffToAddrResponse{*addr})
+		c.IndentedJSON(http.StatusOK, dscOffToAddrResponse{*addr})
+	}
 }
 
 // swagger:parameters getDscSlideInfo
@@ -265,64 +388,66 @@ type dscSlideInfoResponse struct {
 	Rebases []dyld.Rebase                   `json:"rebases,omitempty"`
 }
 
-func dscSlideInfo(c *gin.Context) {
-	var params dscSlideInfoParams
-	if err := c.ShouldBindJSON(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
-		return
-	}
+func dscSlideInfo(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscSlideInfoParams
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
 
-	var auth bool
-	if strings.EqualFold(params.Type, "auth") {
-		auth = true
-	}
+		var auth bool
+		if strings.EqualFold(params.Type, "auth") {
+			auth = true
+		}
 
-	f, err := dyld.Open(filepath.Clean(params.Path))
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
-
-	w := c.Writer
-	enc := json.NewEncoder(w)
-	header := w.Header()
-	header.Set("Transfer-Encoding", "chunked")
-	header.Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	for uuid := range f.Mappings {
-		if f.Headers[uuid].SlideInfoOffsetUnused > 0 {
-			mapping := &dyld.CacheMappingWithSlideInfo{CacheMappingAndSlideInfo: dyld.CacheMappingAndSlideInfo{
-				Address:         f.Mappings[uuid][1].Address,
-				Size:            f.Mappings[uuid][1].Size,
-				FileOffset:      f.Mappings[uuid][1].FileOffset,
-				SlideInfoOffset: f.Headers[uuid].SlideInfoOffsetUnused,
-				SlideInfoSize:   f.Headers[uuid].SlideInfoSizeUnused,
-			}, Name: "__DATA"}
-			if mapping.SlideInfoSize > 0 {
-				rebases, err := f.GetRebaseInfoForPages(uuid, mapping, 0, 0)
-				if err != nil {
-					c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-					return
-				}
-				enc.Encode(dscSlideInfoResponse{Mapping: mapping, Rebases: rebases})
-				w.(http.Flusher).Flush()
-			}
-		} else {
-			for _, mapping := range f.MappingsWithSlideInfo[uuid] {
-				if auth && !mapping.Flags.IsAuthData() {
-					continue
-				}
+		f, release, err := cache.Acquire(fc, filepath.Clean(params.Path), dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		w := c.Writer
+		enc := json.NewEncoder(w)
+		header := w.Header()
+		header.Set("Transfer-Encoding", "chunked")
+		header.Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		for uuid := range f.Mappings {
+			if f.Headers[uuid].SlideInfoOffsetUnused > 0 {
+				mapping := &dyld.CacheMappingWithSlideInfo{CacheMappingAndSlideInfo: dyld.CacheMappingAndSlideInfo{
+					Address:         f.Mappings[uuid][1].Address,
+					Size:            f.Mappings[uuid][1].Size,
+					FileOffset:      f.Mappings[uuid][1].FileOffset,
+					SlideInfoOffset: f.Headers[uuid].SlideInfoOffsetUnused,
+					SlideInfoSize:   f.Headers[uuid].SlideInfoSizeUnused,
+				}, Name: "__DATA"}
 				if mapping.SlideInfoSize > 0 {
 					rebases, err := f.GetRebaseInfoForPages(uuid, mapping, 0, 0)
 					if err != nil {
-						c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+						c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 						return
 					}
 					enc.Encode(dscSlideInfoResponse{Mapping: mapping, Rebases: rebases})
 					w.(http.Flusher).Flush()
 				}
+			} else {
+				for _, mapping := range f.MappingsWithSlideInfo[uuid] {
+					if auth && !mapping.Flags.IsAuthData() {
+						continue
+					}
+					if mapping.SlideInfoSize > 0 {
+						rebases, err := f.GetRebaseInfoForPages(uuid, mapping, 0, 0)
+						if err != nil {
+							c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+							return
+						}
+						enc.Encode(dscSlideInfoResponse{Mapping: mapping, Rebases: rebases})
+						w.(http.Flusher).Flush()
+					}
+				}
 			}
 		}
 	}
@@ -356,7 +481,7 @@ func dscSplit(c *gin.Context) {
 
 	var params dscSplitParams
 	if err := c.ShouldBindJSON(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 		return
 	}
 
@@ -384,7 +509,7 @@ func dscSplit(c *gin.Context) {
 		}
 		return nil
 	}); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 		return
 	}
 	if err := filepath.Walk(filepath.Join(params.Output, "usr"), func(path string, info os.FileInfo, err error) error {
@@ -396,36 +521,124 @@ func dscSplit(c *gin.Context) {
 		}
 		return nil
 	}); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 		return
 	}
 
 	c.IndentedJSON(http.StatusOK, dscSplitResponse{Path: params.Path, Dylibs: dylibs})
 }
 
+// swagger:parameters postDscExtract
+type dscExtractParams struct {
+	// path to dyld_shared_cache
+	// in: body
+	// required: true
+	Path string `json:"path" binding:"required"`
+	// the dylibs to extract (all dylibs if empty)
+	// in: body
+	Dylibs []string `json:"dylibs"`
+	// the folder to output the extracted dylibs
+	// in: body
+	Output string `json:"output"`
+	// apply the DSC slide info to the extracted dylibs
+	// in: body
+	Slide bool `json:"slide"`
+	// rewrite the optimized stubs to load their targets from the GOT
+	// in: body
+	Stubs bool `json:"stubs"`
+	// add ObjC metadata to the extracted dylibs symtab
+	// in: body
+	ObjC bool `json:"objc"`
+	// overwrite existing extracted dylibs
+	// in: body
+	Force bool `json:"force"`
+}
+
+// swagger:response
+type dscExtractResponse struct {
+	Path   string   `json:"path,omitempty"`
+	Dylibs []string `json:"dylibs,omitempty"`
+}
+
+func dscExtract(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscExtractParams
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+
+		if len(params.Output) == 0 {
+			params.Output = filepath.Dir(filepath.Clean(params.Path))
+		}
+
+		f, release, err := cache.Acquire(fc, filepath.Clean(params.Path), dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		images := f.Images
+		if len(params.Dylibs) > 0 {
+			images = nil
+			for _, dylib := range params.Dylibs {
+				img, err := f.Image(dylib)
+				if err != nil {
+					c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+					return
+				}
+				images = append(images, img)
+			}
+		}
+
+		conf := &dyld.ExtractConfig{
+			Slide:    params.Slide,
+			Stubs:    params.Stubs,
+			ObjC:     params.ObjC,
+			FullPath: len(params.Dylibs) == 0,
+			Force:    params.Force,
+		}
+
+		var dylibs []string
+		for _, img := range images {
+			fname, err := f.ExtractDylib(img, filepath.Clean(params.Output), conf)
+			if err != nil && !errors.Is(err, fs.ErrExist) {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			dylibs = append(dylibs, fname)
+		}
+
+		c.IndentedJSON(http.StatusOK, dscExtractResponse{Path: params.Path, Dylibs: dylibs})
+	}
+}
+
 // swagger:response
 type dscStringsResponse struct {
 	Path    string       `json:"path,omitempty"`
 	Strings []cmd.String `json:"strings,omitempty"`
 }
 
-func dscStrings(c *gin.Context) {
-	dscPath := c.Query("path")
-	f, err := dyld.Open(dscPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+func dscStrings(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	pattern := c.Query("pattern")
-	strs, err := cmd.GetStrings(f, pattern)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		pattern := c.Query("pattern")
+		strs, err := cmd.GetStrings(f, pattern)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.IndentedJSON(http.StatusOK, dscStringsResponse{Path: dscPath, Strings: strs})
+		c.IndentedJSON(http.StatusOK, dscStringsResponse{Path: dscPath, Strings: strs})
+	}
 }
 
 // swagger:parameters getDscSymbols
@@ -447,27 +660,29 @@ type dscSymbolsResponse struct {
 	Symbols []cmd.Symbol `json:"symbols,omitempty"`
 }
 
-func dscSymbols(c *gin.Context) {
-	var params dscSymbolsRequest
-	if err := c.ShouldBindJSON(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
-		return
-	}
+func dscSymbols(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscSymbolsRequest
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
 
-	f, err := dyld.Open(params.Path)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer f.Close()
+		f, release, err := cache.Acquire(fc, params.Path, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	syms, err := cmd.GetSymbols(f, params.Lookups)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		syms, err := cmd.GetSymbols(f, params.Lookups)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.IndentedJSON(http.StatusOK, dscSymbolsResponse{Path: params.Path, Symbols: syms})
+		c.IndentedJSON(http.StatusOK, dscSymbolsResponse{Path: params.Path, Symbols: syms})
+	}
 }
 
 // swagger:response
@@ -476,20 +691,160 @@ type dscWebkitResponse struct {
 	Webkit string `json:"webkit,omitempty"`
 }
 
-func dscWebkit(c *gin.Context) {
-	dscPath := c.Query("path")
-	f, err := dyld.Open(dscPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
+func dscWebkit(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dscPath := c.Query("path")
+		f, release, err := cache.Acquire(fc, dscPath, dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		version, err := cmd.GetWebkitVersion(f)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, dscWebkitResponse{Path: dscPath, Webkit: version})
 	}
-	defer f.Close()
+}
 
-	version, err := cmd.GetWebkitVersion(f)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
+type dscImageDataParams struct {
+	Path string `form:"path" json:"path"`
+}
+
+// ipswDSCs are the opened dyld_shared_caches of a scanned IPSW (and its mounted DMG)
+type ipswDSCs struct {
+	mnt   *mount.Context
+	files []*dyld.File
+}
+
+func openIPSWDSCs(pemDB string) func(string) (*ipswDSCs, error) {
+	return func(ipswPath string) (*ipswDSCs, error) {
+		mnt, files, err := cmd.OpenFromIPSW(ipswPath, pemDB, false, true)
+		if err != nil {
+			return nil, err
+		}
+		return &ipswDSCs{mnt: mnt, files: files}, nil
+	}
+}
+
+// Close closes the dyld_shared_caches and unmounts the DMG (if it wasn't already mounted)
+func (d *ipswDSCs) Close() error {
+	var errs []error
+	for _, f := range d.files {
+		errs = append(errs, f.Close())
 	}
+	if !d.mnt.AlreadyMounted {
+		errs = append(errs, d.mnt.Unmount())
+	}
+	return errors.Join(errs...)
+}
 
-	c.IndentedJSON(http.StatusOK, dscWebkitResponse{Path: dscPath, Webkit: version})
+// dscImageData streams the bytes of a segment (or section, if the route has a section param) of the DSC image
+// with the given UUID (with Range request support)
+//
+// Without a path the image is found in the dyld_shared_caches of the mounted IPSW (on the ipswd host) that the UUID was scanned from.
+func dscImageData(fc *cache.Files, db db.Database, pemDB string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params dscImageDataParams
+		if err := c.BindQuery(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+
+		findImage := func(f *dyld.File) *dyld.CacheImage {
+			for _, img := range f.Images {
+				if strings.EqualFold(img.UUID.String(), c.Param("uuid")) {
+					return img
+				}
+			}
+			return nil
+		}
+
+		var f *dyld.File
+		var image *dyld.CacheImage
+		if params.Path != "" {
+			var release func()
+			var err error
+			f, release, err = cache.Acquire(fc, filepath.Clean(params.Path), dyld.Open)
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			defer release()
+			if image = findImage(f); image == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no image with UUID %s in %s", c.Param("uuid"), params.Path)})
+				return
+			}
+		} else {
+			if db == nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing path query parameter (there is no database to look up the UUID in)"})
+				return
+			}
+			loc, err := syms.Locate(c.Param("uuid"), db, model.SourceDSC)
+			if err != nil {
+				if errors.Is(err, model.ErrNotFound) {
+					c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no scanned dyld_shared_cache image with UUID %s", c.Param("uuid"))})
+					return
+				}
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			dscs, release, err := cache.Acquire(fc, loc.IpswPath, openIPSWDSCs(pemDB))
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			defer release()
+			for _, dsc := range dscs.files {
+				if image = findImage(dsc); image != nil {
+					f = dsc
+					break
+				}
+			}
+			if image == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no image with UUID %s in the dyld_shared_caches of %s", c.Param("uuid"), loc.IpswPath)})
+				return
+			}
+		}
+
+		m, err := image.GetPartialMacho()
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		var addr, size uint64
+		if sectName := c.Param("section"); sectName != "" {
+			sec := m.Section(c.Param("segment"), sectName)
+			if sec == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("%s has no %s.%s section", image.Name, c.Param("segment"), sectName)})
+				return
+			}
+			if sec.Flags.IsZerofill() {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: fmt.Sprintf("%s.%s is a zero fill section", sec.Seg, sec.Name)})
+				return
+			}
+			addr, size = sec.Addr, sec.Size
+		} else {
+			seg := m.Segment(c.Param("segment"))
+			if seg == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("%s has no %s segment", image.Name, c.Param("segment"))})
+				return
+			}
+			addr, size = seg.Addr, seg.Filesz
+		}
+
+		r, err := f.NewSectionReaderAtAddress(addr, size)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("X-Ipsw-Address", fmt.Sprintf("%#x", addr))
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, r)
+	}
 }
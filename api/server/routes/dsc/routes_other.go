@@ -3,11 +3,13 @@
 package dsc
 
 import (
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/db"
 	"github.com/gin-gonic/gin"
 )
 
 // AddRoutes adds the download routes to the router
-func AddRoutes(rg *gin.RouterGroup) {
+func AddRoutes(rg *gin.RouterGroup, fc *cache.Files, db db.Database, pemDB string) {
 	dr := rg.Group("/dsc")
 
 	// dr.GET("/a2f", handler)     // TODO: implement this
@@ -24,7 +26,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscAddrToOffResponse
 	//       500: genericError
-	dr.POST("/a2o", dscAddrToOff)
+	dr.POST("/a2o", dscAddrToOff(fc))
 	// swagger:route POST /dsc/a2s DSC postDscAddrToSym
 	//
 	// a2s
@@ -37,11 +39,24 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscAddrToSymResponse
 	//       500: genericError
-	dr.POST("/a2s", dscAddrToSym)
+	dr.POST("/a2s", dscAddrToSym(fc))
 
 	// dr.GET("/disass", handler)  // TODO: implement this
 	// dr.GET("/dump", handler)    // TODO: implement this
-	// dr.GET("/extract", handler) // TODO: implement this
+	// swagger:route POST /dsc/extract DSC postDscExtract
+	//
+	// Extract
+	//
+	// Extract dylibs from the DSC (optionally applying its slide info and rewriting their stubs so they can be loaded standalone).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: dscExtractResponse
+	//       404: genericError
+	//       500: genericError
+	dr.POST("/extract", dscExtract(fc))
 	// dr.GET("/ida", handler)     // TODO: implement this
 	// dr.GET("/image", handler)   // TODO: implement this
 
@@ -68,7 +83,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscImportsResponse
 	//       500: genericError
-	dr.GET("/imports", dscImports)
+	dr.GET("/imports", dscImports(fc))
 	// swagger:route GET /dsc/info DSC getDscInfo
 	//
 	// Info
@@ -87,7 +102,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscInfoResponse
 	//       500: genericError
-	dr.GET("/info", dscInfo)
+	dr.GET("/info", dscInfo(fc))
 	// swagger:route GET /dsc/macho DSC getDscMacho
 	//
 	// MachO
@@ -111,7 +126,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscMachoResponse
 	//       500: genericError
-	dr.GET("/macho", dscMacho)
+	dr.GET("/macho", dscMacho(fc))
 
 	// swagger:route POST /dsc/o2a DSC postDscOffToAddr
 	//
@@ -125,9 +140,40 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscOffToAddrResponse
 	//       500: genericError
-	dr.POST("/o2a", dscOffToAddr)
+	dr.POST("/o2a", dscOffToAddr(fc))
 
-	// dr.GET("/objc", handler)    // TODO: implement this
+	// swagger:route GET /dsc/objc DSC getDscObjc
+	//
+	// ObjC
+	//
+	// Get the ObjC classes, protocols and categories (with their ivar offsets and method addresses) of a dylib in the DSC.
+	//
+	//     Produces:
+	//     - application/json
+	//     - text/plain
+	//
+	//     Parameters:
+	//       + name: path
+	//         in: query
+	//         description: path to dyld_shared_cache
+	//         required: true
+	//         type: string
+	//       + name: dylib
+	//         in: query
+	//         description: dylib to dump
+	//         required: true
+	//         type: string
+	//       + name: header
+	//         in: query
+	//         description: return the header-style declarations as text instead of JSON
+	//         required: false
+	//         type: boolean
+	//     Responses:
+	//       200: dscObjcResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	dr.GET("/objc", dscObjC(fc))
 	// dr.GET("/patches", handler) // TODO: implement this
 	// dr.GET("/search", handler)  // TODO: implement this
 
@@ -143,7 +189,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscSlideInfoResponse
 	//       500: genericError
-	dr.POST("/slide", dscSlideInfo)
+	dr.POST("/slide", dscSlideInfo(fc))
 
 	// swagger:route GET /dsc/str DSC getDscStrings
 	//
@@ -168,9 +214,41 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscStringsResponse
 	//       500: genericError
-	dr.GET("/str", dscStrings)
+	dr.GET("/str", dscStrings(fc))
 	// dr.GET("/stubs", handler) // TODO: implement this
-	// dr.GET("/swift", handler) // TODO: implement this
+
+	// swagger:route GET /dsc/swift DSC getDscSwift
+	//
+	// Swift
+	//
+	// Get the Swift types (with their demangled field types), protocols and protocol conformances of a dylib in the DSC.
+	//
+	//     Produces:
+	//     - application/json
+	//     - text/plain
+	//
+	//     Parameters:
+	//       + name: path
+	//         in: query
+	//         description: path to dyld_shared_cache
+	//         required: true
+	//         type: string
+	//       + name: dylib
+	//         in: query
+	//         description: dylib to dump
+	//         required: true
+	//         type: string
+	//       + name: interface
+	//         in: query
+	//         description: return the interface-style declarations as text instead of JSON
+	//         required: false
+	//         type: boolean
+	//     Responses:
+	//       200: dscSwiftResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	dr.GET("/swift", dscSwift(fc))
 
 	// swagger:route POST /dsc/symaddr DSC getDscSymbols
 	//
@@ -184,7 +262,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscSymbolsResponse
 	//       500: genericError
-	dr.POST("/symaddr", dscSymbols)
+	dr.POST("/symaddr", dscSymbols(fc))
 	// dr.GET("/tbd", handler)    // TODO: implement this
 
 	// swagger:route GET /dsc/webkit DSC getDscWebkit
@@ -205,6 +283,80 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: dscWebkitResponse
 	//       500: genericError
-	dr.GET("/webkit", dscWebkit) // TODO: implement this
+	dr.GET("/webkit", dscWebkit(fc)) // TODO: implement this
 	// dr.GET("/xref", handler)   // TODO: implement this
+
+	// swagger:route GET /dsc/{uuid}/segment/{segment} DSC getDscSegment
+	//
+	// Segment
+	//
+	// Stream the bytes of a segment of the DSC image with the given UUID.
+	//
+	// Supports <code>Range</code> requests and the segment's virtual address is returned in the <code>X-Ipsw-Address</code> header.
+	//
+	//     Produces:
+	//     - application/octet-stream
+	//
+	//     Parameters:
+	//       + name: uuid
+	//         in: path
+	//         description: image UUID
+	//         required: true
+	//         type: string
+	//       + name: segment
+	//         in: path
+	//         description: segment name
+	//         required: true
+	//         type: string
+	//       + name: path
+	//         in: query
+	//         description: path to dyld_shared_cache (defaults to the dyld_shared_cache of the scanned IPSW the image was found in)
+	//         required: false
+	//         type: string
+	//     Responses:
+	//       200: body:[]byte
+	//       206: body:[]byte
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	dr.GET("/:uuid/segment/:segment", dscImageData(fc, db, pemDB))
+	// swagger:route GET /dsc/{uuid}/section/{segment}/{section} DSC getDscSection
+	//
+	// Section
+	//
+	// Stream the bytes of a section of the DSC image with the given UUID.
+	//
+	// Supports <code>Range</code> requests and the section's virtual address is returned in the <code>X-Ipsw-Address</code> header.
+	//
+	//     Produces:
+	//     - application/octet-stream
+	//
+	//     Parameters:
+	//       + name: uuid
+	//         in: path
+	//         description: image UUID
+	//         required: true
+	//         type: string
+	//       + name: segment
+	//         in: path
+	//         description: segment name
+	//         required: true
+	//         type: string
+	//       + name: section
+	//         in: path
+	//         description: section name
+	//         required: true
+	//         type: string
+	//       + name: path
+	//         in: query
+	//         description: path to dyld_shared_cache (defaults to the dyld_shared_cache of the scanned IPSW the image was found in)
+	//         required: false
+	//         type: string
+	//     Responses:
+	//       200: body:[]byte
+	//       206: body:[]byte
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	dr.GET("/:uuid/section/:segment/:section", dscImageData(fc, db, pemDB))
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/blacktop/ipsw/api/types"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/usb"
 	"github.com/blacktop/ipsw/pkg/usb/amfi"
 	"github.com/blacktop/ipsw/pkg/usb/heartbeat"
@@ -31,7 +32,7 @@ func idevInfo(c *gin.Context) {
 
 	devices, err := conn.ListDevices()
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 
@@ -45,13 +46,13 @@ func idevInfo(c *gin.Context) {
 	for _, device := range devices {
 		cli, err := lockdownd.NewClient(device.SerialNumber)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 
 		values, err := cli.GetValues()
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 
@@ -68,7 +69,7 @@ func idevAmfiDev(c *gin.Context) {
 
 	ok, err := utils.IsDeveloperModeEnabled(udid)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 
@@ -78,17 +79,17 @@ func idevAmfiDev(c *gin.Context) {
 	} else {
 		cli, err := amfi.NewClient(udid)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		defer cli.Close()
 
 		if err := cli.EnableDeveloperMode(); err != nil {
 			if errors.Is(err, amfi.ErrPasscodeSet) {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: fmt.Errorf("cannot enabled Developer Mode when a pass-code is set: %w", err).Error()})
+				c.AbortWithStatusJSON(http.StatusInternalServerError, types.NewGenericError(fmt.Errorf("cannot enabled Developer Mode when a pass-code is set: %w", err)))
 				return
 			} else {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 				return
 			}
 		}
@@ -122,21 +123,21 @@ func idevAmfiDev(c *gin.Context) {
 
 		select {
 		case err := <-errs:
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		case <-awake:
 			cli, err := amfi.NewClient(udid)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 				return
 			}
 			defer cli.Close()
 			if err := cli.EnableDeveloperModePostRestart(); err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 				return
 			}
 		case <-time.After(time.Minute):
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: fmt.Errorf("device did not restart in time (1 minute)").Error()})
+			c.AbortWithStatusJSON(http.StatusInternalServerError, types.NewGenericError(fmt.Errorf("device did not restart in time (1 minute)")))
 			return
 		}
 	}
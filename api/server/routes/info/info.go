@@ -7,6 +7,7 @@ import (
 
 	"github.com/blacktop/ipsw/api/types"
 	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/gin-gonic/gin"
 )
@@ -22,7 +23,7 @@ func getInfo(c *gin.Context) {
 
 	i, err := info.Parse(path)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 
@@ -43,13 +44,13 @@ func getRemoteInfo(c *gin.Context) {
 		Insecure: insecure,
 	})
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 
 	i, err := info.ParseZipFiles(zr.File)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 		return
 	}
 
@@ -19,6 +19,7 @@ import (
 	"github.com/blacktop/ipsw/internal/commands/extract"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/aea"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/gin-gonic/gin"
 )
@@ -60,12 +61,12 @@ func getFsFiles(pemDB string) gin.HandlerFunc {
 
 		i, err := info.Parse(ipswPath)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		dmgPath, err := i.GetFileSystemOsDmg()
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		if _, err := os.Stat(dmgPath); os.IsNotExist(err) {
@@ -138,7 +139,7 @@ func getFsFiles(pemDB string) gin.HandlerFunc {
 			})
 			return nil
 		}); err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 
@@ -172,7 +173,7 @@ func getFsEntitlements(pemDB string) gin.HandlerFunc {
 
 		ents, err := ent.GetDatabase(&ent.Config{IPSW: ipswPath, PemDB: pemDbPath})
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 
@@ -216,7 +217,7 @@ func getFsLaunchdConfig(pemDB string) gin.HandlerFunc {
 
 		ldconf, err := extract.LaunchdConfig(ipswPath, pemDbPath)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 
@@ -5,33 +5,37 @@ import (
 
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/gin-gonic/gin"
 )
 
 // swagger:response kernelKextsResponse
 type kernelKextsResponse struct {
-	Path  string                 `json:"path"`
-	Kexts []kernelcache.CFBundle `json:"kexts"`
+	Path  string             `json:"path"`
+	Kexts []kernelcache.Kext `json:"kexts"`
 }
 
-func listKexts(c *gin.Context) {
-	kernelPath := c.Query("path")
+func listKexts(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kernelPath := c.Query("path")
 
-	m, err := macho.Open(kernelPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer m.Close()
+		m, release, err := cache.Acquire(fc, kernelPath, macho.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
 
-	bundles, err := kernelcache.GetKexts(m)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
+		kexts, err := kernelcache.GetKextsMatchingContext(c.Request.Context(), m, c.Query("filter"))
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	c.JSON(http.StatusOK, kernelKextsResponse{Path: kernelPath, Kexts: bundles})
+		c.JSON(http.StatusOK, kernelKextsResponse{Path: kernelPath, Kexts: kexts})
+	}
 }
 
 // swagger:response kernelSyscallsResponse
@@ -40,23 +44,60 @@ type kernelSyscallsResponse struct {
 	Syscalls []kernelcache.Sysent `json:"syscalls"`
 }
 
-func getSyscalls(c *gin.Context) {
-	kernelPath := c.Query("path")
+func getSyscalls(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kernelPath := c.Query("path")
 
-	m, err := macho.Open(kernelPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer m.Close()
+		m, release, err := cache.Acquire(fc, kernelPath, macho.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		syscalls, err := kernelcache.GetSyscallTable(m)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	syscalls, err := kernelcache.GetSyscallTable(m)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
+		c.JSON(http.StatusOK, kernelSyscallsResponse{Path: kernelPath, Syscalls: syscalls})
 	}
+}
+
+// swagger:response kernelSymbolSetsResponse
+type kernelSymbolSetsResponse struct {
+	Path       string                    `json:"path"`
+	SymbolSets []kernelcache.SymbolSet   `json:"symbolsets"`
+	Kexts      []kernelcache.KextLinkage `json:"kexts,omitempty"`
+}
 
-	c.JSON(http.StatusOK, kernelSyscallsResponse{Path: kernelPath, Syscalls: syscalls})
+func getSymbolSets(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kernelPath := c.Query("path")
+
+		m, release, err := cache.Acquire(fc, kernelPath, macho.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		sets, err := kernelcache.GetSymbolSets(m)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		resp := kernelSymbolSetsResponse{Path: kernelPath, SymbolSets: sets}
+		if c.Query("kexts") == "true" {
+			if resp.Kexts, err = kernelcache.GetKextLinkage(m); err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
 }
 
 // swagger:response kernelVersionResponse
@@ -65,21 +106,50 @@ type kernelVersionResponse struct {
 	Version *kernelcache.Version `json:"version"`
 }
 
-func getVersion(c *gin.Context) {
-	kernelPath := c.Query("path")
+func getVersion(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kernelPath := c.Query("path")
 
-	m, err := macho.Open(kernelPath)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
-	}
-	defer m.Close()
+		m, release, err := cache.Acquire(fc, kernelPath, macho.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		v, err := kernelcache.GetVersion(m)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
 
-	v, err := kernelcache.GetVersion(m)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
-		return
+		c.JSON(http.StatusOK, gin.H{"path": kernelPath, "version": v})
 	}
+}
+
+// swagger:response kernelSandboxOpsResponse
+type kernelSandboxOpsResponse struct {
+	Path       string                         `json:"path"`
+	Operations []kernelcache.SandboxOperation `json:"operations"`
+}
 
-	c.JSON(http.StatusOK, gin.H{"path": kernelPath, "version": v})
+func getSandboxOps(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kernelPath := c.Query("path")
+
+		m, release, err := cache.Acquire(fc, kernelPath, macho.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+
+		ops, err := kernelcache.GetSandboxOptsContext(c.Request.Context(), m)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, kernelSandboxOpsResponse{Path: kernelPath, Operations: ops})
+	}
 }
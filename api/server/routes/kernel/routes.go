@@ -2,11 +2,12 @@
 package kernel
 
 import (
+	"github.com/blacktop/ipsw/internal/cache"
 	"github.com/gin-gonic/gin"
 )
 
 // AddRoutes adds the download routes to the router
-func AddRoutes(rg *gin.RouterGroup) {
+func AddRoutes(rg *gin.RouterGroup, fc *cache.Files) {
 	kg := rg.Group("/kernel")
 	// kg.GET("/ctfdump", handler) // TODO: implement this
 	// kg.GET("/dec", handler)     // TODO: implement this
@@ -28,12 +29,60 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//         description: path to kernelcache
 	//         required: true
 	//         type: string
+	//       + name: filter
+	//         in: query
+	//         description: "kext filter expression (i.e. 'com.apple.iokit.* has-personality version>=100 min-os>=14')"
+	//         required: false
+	//         type: string
 	//     Responses:
 	//       200: kernelKextsResponse
+	//       400: genericError
+	//       500: genericError
+	kg.GET("/kexts", listKexts(fc))
+	// swagger:route GET /kernel/sandbox/ops Kernel getKernelSandboxOps
+	//
+	// Sandbox Operations
+	//
+	// Get the sandbox operations (index, name and category) of the kernelcache's Sandbox.kext.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: path
+	//         in: query
+	//         description: path to kernelcache
+	//         required: true
+	//         type: string
+	//     Responses:
+	//       200: kernelSandboxOpsResponse
+	//       404: genericError
+	//       500: genericError
+	kg.GET("/sandbox/ops", getSandboxOps(fc))
+	// swagger:route GET /kernel/symbolsets Kernel getKernelSymbolSets
+	//
+	// Symbol Sets
+	//
+	// Get the KPI symbol sets of a macOS kernel collection (and optionally the KPI symbols each KEXT imports).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: path
+	//         in: query
+	//         description: path to kernelcache
+	//         required: true
+	//         type: string
+	//       + name: kexts
+	//         in: query
+	//         description: include each KEXT's KPI linkage
+	//         required: false
+	//         type: boolean
+	//     Responses:
+	//       200: kernelSymbolSetsResponse
 	//       500: genericError
-	kg.GET("/kexts", listKexts)
-	// kg.GET("/sbopts", handler)     // TODO: implement this
-	// kg.GET("/symbolsets", handler) // TODO: implement this
+	kg.GET("/symbolsets", getSymbolSets(fc))
 
 	// swagger:route GET /kernel/syscall Kernel getKernelSyscalls
 	//
@@ -53,7 +102,7 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: kernelSyscallsResponse
 	//       500: genericError
-	kg.GET("/syscall", getSyscalls)
+	kg.GET("/syscall", getSyscalls(fc))
 	// swagger:route GET /kernel/version Kernel getKernelVersion
 	//
 	// Version
@@ -72,5 +121,5 @@ func AddRoutes(rg *gin.RouterGroup) {
 	//     Responses:
 	//       200: kernelVersionResponse
 	//       500: genericError
-	kg.GET("/version", getVersion)
+	kg.GET("/version", getVersion(fc))
 }
@@ -1,11 +1,25 @@
 package macho
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/commands/mount"
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/blacktop/ipsw/internal/syms"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/objc"
 	"github.com/gin-gonic/gin"
 )
 
@@ -27,7 +41,7 @@ func machoInfo(c *gin.Context) {
 	var params Info
 
 	if err := c.BindQuery(&params); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 		return
 	}
 
@@ -36,12 +50,12 @@ func machoInfo(c *gin.Context) {
 		if err == macho.ErrNotFat { // not a fat binary
 			m, err = macho.Open(params.Path)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 				return
 			}
 			defer m.Close()
 		} else {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 	} else { // fat binary
@@ -58,3 +72,226 @@ func machoInfo(c *gin.Context) {
 	}
 	c.IndentedJSON(http.StatusOK, machoInfoResponse{Path: params.Path, Arch: params.Arch, Info: m})
 }
+
+// Data is the struct for the macho segment/section data route parameters
+type Data struct {
+	Path string `form:"path" json:"path"`
+}
+
+// ipswFS are the mounted DMGs (file system, SystemOS, AppOS and ExclaveOS) of a scanned IPSW
+type ipswFS []*mount.Context
+
+// mountIPSW mounts every DMG in the IPSW that its file system MachOs are scanned from
+func mountIPSW(pemDB string) func(string) (ipswFS, error) {
+	return func(ipswPath string) (ipswFS, error) {
+		var mnts ipswFS
+		for _, typ := range []string{"fs", "sys", "app", "exc"} {
+			ctx, err := mount.DmgInIPSW(ipswPath, typ, pemDB)
+			if err != nil {
+				if typ == "fs" {
+					return nil, err
+				}
+				continue // not every IPSW has cryptexes (or an ExclaveOS)
+			}
+			if slices.ContainsFunc(mnts, func(m *mount.Context) bool { return m.MountPoint == ctx.MountPoint }) {
+				continue // older IPSWs have no SystemOS cryptex and mount the file system instead
+			}
+			mnts = append(mnts, ctx)
+		}
+		return mnts, nil
+	}
+}
+
+// Close unmounts the DMGs (that weren't already mounted)
+func (mnts ipswFS) Close() error {
+	var errs []error
+	for _, m := range mnts {
+		if !m.AlreadyMounted {
+			errs = append(errs, m.Unmount())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// machoData streams the bytes of a segment (or section, if the route has a section param) of the MachO (or slice
+// of a universal MachO) with the given UUID (with Range request support)
+//
+// Without a path the MachO is found in the mounted IPSW (on the ipswd host) that the UUID was scanned from.
+func machoData(fc *cache.Files, db db.Database, pemDB string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params Data
+		if err := c.BindQuery(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+
+		machoPath := filepath.Clean(params.Path)
+		if params.Path == "" {
+			if db == nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing path query parameter (there is no database to look up the UUID in)"})
+				return
+			}
+			loc, err := syms.Locate(c.Param("uuid"), db, model.SourceFileSystem, model.SourceDriverKit)
+			if err != nil {
+				if errors.Is(err, model.ErrNotFound) {
+					c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no scanned file system MachO with UUID %s", c.Param("uuid"))})
+					return
+				}
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			mnts, release, err := cache.Acquire(fc, loc.IpswPath, mountIPSW(pemDB))
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			defer release()
+			machoPath = ""
+			for _, m := range mnts {
+				if _, err := os.Stat(filepath.Join(m.MountPoint, loc.Path)); err == nil {
+					machoPath = filepath.Join(m.MountPoint, loc.Path)
+					break
+				}
+			}
+			if machoPath == "" {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("%s is not in any of the mounted DMGs of %s", loc.Path, loc.IpswPath)})
+				return
+			}
+		}
+
+		f, err := os.Open(machoPath)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer f.Close()
+
+		hasUUID := func(m *macho.File) bool {
+			id := m.UUID()
+			return id != nil && strings.EqualFold(id.UUID.String(), c.Param("uuid"))
+		}
+
+		var m *macho.File
+		var base int64 // the offset of the slice in a universal MachO
+		fat, err := macho.NewFatFile(f)
+		if err != nil {
+			if err != macho.ErrNotFat {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			if m, err = macho.NewFile(f); err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			if !hasUUID(m) {
+				m = nil
+			}
+		} else {
+			for _, farch := range fat.Arches {
+				if hasUUID(farch.File) {
+					m = farch.File
+					base = int64(farch.Offset)
+					break
+				}
+			}
+		}
+		if m == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("%s has no MachO with UUID %s", machoPath, c.Param("uuid"))})
+			return
+		}
+
+		var addr, off, size uint64
+		if sectName := c.Param("section"); sectName != "" {
+			sec := m.Section(c.Param("segment"), sectName)
+			if sec == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no %s.%s section", c.Param("segment"), sectName)})
+				return
+			}
+			if sec.Flags.IsZerofill() {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: fmt.Sprintf("%s.%s is a zero fill section", sec.Seg, sec.Name)})
+				return
+			}
+			addr, off, size = sec.Addr, uint64(sec.Offset), sec.Size
+		} else {
+			seg := m.Segment(c.Param("segment"))
+			if seg == nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no %s segment", c.Param("segment"))})
+				return
+			}
+			addr, off, size = seg.Addr, seg.Offset, seg.Filesz
+		}
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("X-Ipsw-Address", fmt.Sprintf("%#x", addr))
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, io.NewSectionReader(f, base+int64(off), int64(size)))
+	}
+}
+
+// ObjC is the struct for the macho objc route parameters
+type ObjC struct {
+	Path   string `form:"path" json:"path" binding:"required"`
+	Arch   string `form:"arch" json:"arch"`
+	Header bool   `form:"header" json:"header"`
+}
+
+// swagger:response
+type machoObjcResponse struct {
+	Path string      `json:"path"`
+	Arch string      `json:"arch,omitempty"`
+	ObjC *objc.Image `json:"objc"`
+}
+
+func machoObjC(c *gin.Context) {
+	var params ObjC
+	if err := c.BindQuery(&params); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+		return
+	}
+
+	var m *macho.File
+	fat, err := macho.OpenFat(params.Path)
+	if err != nil {
+		if err != macho.ErrNotFat {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		if m, err = macho.Open(params.Path); err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer m.Close()
+	} else {
+		defer fat.Close()
+		if params.Arch == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "'arch' query parameter is required for universal binaries"})
+			return
+		}
+		for _, farch := range fat.Arches {
+			if strings.EqualFold(farch.SubCPU.String(farch.CPU), params.Arch) {
+				m = farch.File
+				break
+			}
+		}
+		if m == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("%s has no '%s' slice", params.Path, params.Arch)})
+			return
+		}
+	}
+
+	img, err := objc.ParseImage(m)
+	if err != nil {
+		if errors.Is(err, objc.ErrNoObjC) {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+			return
+		}
+		c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+		return
+	}
+	img.Name = filepath.Base(params.Path)
+
+	if params.Header {
+		c.String(http.StatusOK, img.Header())
+		return
+	}
+	c.IndentedJSON(http.StatusOK, machoObjcResponse{Path: params.Path, Arch: params.Arch, ObjC: img})
+}
@@ -1,11 +1,13 @@
 package macho
 
 import (
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/db"
 	"github.com/gin-gonic/gin"
 )
 
 // AddRoutes adds the download routes to the router
-func AddRoutes(rg *gin.RouterGroup) {
+func AddRoutes(rg *gin.RouterGroup, fc *cache.Files, db db.Database, pemDB string) {
 	m := rg.Group("/macho")
 	// m.GET("/a2o", handler)    // TODO: implement this
 	// m.GET("/a2s", handler)    // TODO: implement this
@@ -41,7 +43,115 @@ func AddRoutes(rg *gin.RouterGroup) {
 
 	// m.GET("/lipo", handler)   // TODO: implement this
 	// m.GET("/o2a", handler)    // TODO: implement this
+
+	// swagger:route GET /macho/objc MachO getMachoObjc
+	//
+	// ObjC
+	//
+	// Get the ObjC classes, protocols and categories (with their ivar offsets and method addresses) of a MachO.
+	//
+	//     Produces:
+	//     - application/json
+	//     - text/plain
+	//
+	//     Parameters:
+	//       + name: path
+	//         in: query
+	//         description: path to MachO
+	//         required: true
+	//         type: string
+	//       + name: arch
+	//         in: query
+	//         description: architecture to use in universal MachO
+	//         required: false
+	//         type: string
+	//       + name: header
+	//         in: query
+	//         description: return the header-style declarations as text instead of JSON
+	//         required: false
+	//         type: boolean
+	//     Responses:
+	//       200: machoObjcResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	m.GET("/objc", machoObjC)
+
 	// m.GET("/patch", handler)  // TODO: implement this
 	// m.GET("/search", handler) // TODO: implement this
 	// m.GET("/sign", handler)   // TODO: implement this
+
+	// swagger:route GET /macho/{uuid}/segment/{segment} MachO getMachoSegment
+	//
+	// Segment
+	//
+	// Stream the bytes of a segment of the MachO with the given UUID.
+	//
+	// Supports <code>Range</code> requests and the segment's virtual address is returned in the <code>X-Ipsw-Address</code> header.
+	//
+	//     Produces:
+	//     - application/octet-stream
+	//
+	//     Parameters:
+	//       + name: uuid
+	//         in: path
+	//         description: MachO UUID (selects the slice of a universal MachO)
+	//         required: true
+	//         type: string
+	//       + name: segment
+	//         in: path
+	//         description: segment name
+	//         required: true
+	//         type: string
+	//       + name: path
+	//         in: query
+	//         description: path to MachO (defaults to the MachO with the UUID in the scanned IPSW it was found in)
+	//         required: false
+	//         type: string
+	//     Responses:
+	//       200: body:[]byte
+	//       206: body:[]byte
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	m.GET("/:uuid/segment/:segment", machoData(fc, db, pemDB))
+	// swagger:route GET /macho/{uuid}/section/{segment}/{section} MachO getMachoSection
+	//
+	// Section
+	//
+	// Stream the bytes of a section of the MachO with the given UUID.
+	//
+	// Supports <code>Range</code> requests and the section's virtual address is returned in the <code>X-Ipsw-Address</code> header.
+	//
+	//     Produces:
+	//     - application/octet-stream
+	//
+	//     Parameters:
+	//       + name: uuid
+	//         in: path
+	//         description: MachO UUID (selects the slice of a universal MachO)
+	//         required: true
+	//         type: string
+	//       + name: segment
+	//         in: path
+	//         description: segment name
+	//         required: true
+	//         type: string
+	//       + name: section
+	//         in: path
+	//         description: section name
+	//         required: true
+	//         type: string
+	//       + name: path
+	//         in: query
+	//         description: path to MachO (defaults to the MachO with the UUID in the scanned IPSW it was found in)
+	//         required: false
+	//         type: string
+	//     Responses:
+	//       200: body:[]byte
+	//       206: body:[]byte
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	m.GET("/:uuid/section/:segment/:section", machoData(fc, db, pemDB))
 }
@@ -14,28 +14,33 @@ import (
 	"github.com/blacktop/ipsw/api/server/routes/kernel"
 	"github.com/blacktop/ipsw/api/server/routes/macho"
 	"github.com/blacktop/ipsw/api/server/routes/mount"
+	"github.com/blacktop/ipsw/api/server/routes/symbolicate"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/db"
 	"github.com/gin-gonic/gin"
 )
 
 // Add adds the command routes to the router
-func Add(rg *gin.RouterGroup, pemDB string) {
-	daemon.AddRoutes(rg)
+//
+// NOTE: db is nil when ipswd has no database (the routes then need explicit file paths)
+func Add(rg *gin.RouterGroup, pemDB string, fc *cache.Files, db db.Database) {
+	daemon.AddRoutes(rg, fc)
 	devicelist.AddRoutes(rg)
 	diff.AddRoutes(rg)
 	download.AddRoutes(rg)
 	// dtree.AddRoutes(rg) // TODO: add dtree routes
-	dsc.AddRoutes(rg)
+	dsc.AddRoutes(rg, fc, db, pemDB)
 	extract.AddRoutes(rg, pemDB)
 	idev.AddRoutes(rg)
 	// img4.AddRoutes(rg) // TODO: add img4 routes
 	info.AddRoutes(rg)
 	ipsw.AddRoutes(rg, pemDB)
-	kernel.AddRoutes(rg)
-	macho.AddRoutes(rg)
+	kernel.AddRoutes(rg, fc)
+	macho.AddRoutes(rg, fc, db, pemDB)
 	// mdevs.AddRoutes(rg) // TODO: add mdevs routes
 	mount.AddRoutes(rg, pemDB)
 	// ota.AddRoutes(rg) // TODO: add ota routes
 	// pongo.AddRoutes(rg) // TODO: add pongo routes
 	// sepfw.AddRoutes(rg) // TODO: add sepfw routes
-	// symbolicate.AddRoutes(rg) // TODO: add symbolicate routes
+	symbolicate.AddRoutes(rg, fc)
 }
@@ -0,0 +1,27 @@
+// Package symbolicate provides the /symbolicate routes
+package symbolicate
+
+import (
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/gin-gonic/gin"
+)
+
+// AddRoutes adds the symbolicate routes to the router
+func AddRoutes(rg *gin.RouterGroup, fc *cache.Files) {
+	sr := rg.Group("/symbolicate")
+
+	// swagger:route POST /symbolicate/resolve Symbolicate postSymbolicateResolve
+	//
+	// Resolve
+	//
+	// Resolve addresses to the kernelcache kext, dyld_shared_cache dylib or MachO (and symbol) they belong to.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: symbolicateResolveResponse
+	//       400: genericError
+	//       500: genericError
+	sr.POST("/resolve", resolve(fc))
+}
@@ -1 +1,119 @@
 package symbolicate
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/pkg/addrspace"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/gin-gonic/gin"
+)
+
+// swagger:parameters postSymbolicateResolve
+type resolveParams struct {
+	// path to kernelcache
+	// in:body
+	Kernelcache string `json:"kernelcache,omitempty"`
+	// kernelcache (KASLR) slide
+	// in:body
+	KernelSlide uint64 `json:"kernel_slide,omitempty"`
+	// path to dyld_shared_cache
+	// in:body
+	SharedCache string `json:"dsc,omitempty"`
+	// dyld_shared_cache slide
+	// in:body
+	SharedCacheSlide uint64 `json:"dsc_slide,omitempty"`
+	// paths to MachOs (and the slide they were loaded at)
+	// in:body
+	MachOs map[string]uint64 `json:"machos,omitempty"`
+	// addresses to resolve
+	// in:body
+	// required: true
+	Addrs []uint64 `json:"addrs" binding:"required"`
+}
+
+// swagger:response symbolicateResolveResponse
+type resolveResponse struct {
+	// in:body
+	Locations []addrspace.Location `json:"locations"`
+}
+
+func resolve(fc *cache.Files) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var params resolveParams
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		if params.Kernelcache == "" && params.SharedCache == "" && len(params.MachOs) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(
+				errcode.New(errcode.InvalidArgument, "must supply at least one of 'kernelcache', 'dsc' or 'machos'")))
+			return
+		}
+
+		as := addrspace.New()
+		if params.Kernelcache != "" {
+			kpath, err := kernelcache.DecompressedPath(filepath.Clean(params.Kernelcache))
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			m, release, err := cache.Acquire(fc, kpath, macho.Open)
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			defer release()
+			if err := as.AddKernelcache(params.Kernelcache, m, params.KernelSlide); err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+		}
+		if params.SharedCache != "" {
+			f, release, err := cache.Acquire(fc, filepath.Clean(params.SharedCache), dyld.Open)
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			defer release()
+			if err := as.AddSharedCache(params.SharedCache, f, params.SharedCacheSlide); err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+		}
+		for path, slide := range params.MachOs {
+			m, release, err := cache.Acquire(fc, filepath.Clean(path), macho.Open)
+			if err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			defer release()
+			if err := as.AddMachO(path, m, slide); err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+		}
+
+		locs := make([]addrspace.Location, 0, len(params.Addrs))
+		for _, addr := range params.Addrs {
+			loc, err := as.Resolve(addr)
+			if err != nil {
+				if errors.Is(err, errcode.New(errcode.NotFound, "")) {
+					locs = append(locs, addrspace.Location{Address: addr}) // not in any of the artifacts
+					continue
+				}
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			locs = append(locs, *loc)
+		}
+
+		c.IndentedJSON(http.StatusOK, resolveResponse{Locations: locs})
+	}
+}
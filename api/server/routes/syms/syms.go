@@ -3,13 +3,22 @@ package syms
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
 	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/demangle"
 	"github.com/blacktop/ipsw/internal/model"
+	"github.com/blacktop/ipsw/internal/swift"
 	"github.com/blacktop/ipsw/internal/syms"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
 	"gorm.io/gorm"
@@ -40,6 +49,21 @@ type symResponse *model.Symbol
 // swagger:response
 type symsResponse []*model.Symbol
 
+// swagger:response
+type symSearchResponse []*model.SearchResult
+
+// swagger:response
+type symStabilityResponse *syms.StabilityReport
+
+// swagger:response
+type symDscSearchResponse struct {
+	UUID    string             `json:"uuid,omitempty"`
+	Path    string             `json:"path,omitempty"`
+	Matches []dyld.SymbolMatch `json:"matches,omitempty"`
+	// the images that failed to be searched
+	Errors []string `json:"errors,omitempty"`
+}
+
 type IpswParams struct {
 	Version string `form:"version" json:"version" binding:"required"`
 	Build   string `form:"build" json:"build" binding:"required"`
@@ -47,7 +71,10 @@ type IpswParams struct {
 }
 
 // AddRoutes adds the syms routes to the router
-func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
+func AddRoutes(rg *gin.RouterGroup, db db.Database, tags db.Tags, fc *cache.Files, pemDB, sigsDir string) {
+	if tags != nil {
+		addTagRoutes(rg, tags)
+	}
 	// swagger:route POST /syms/scan Syms postScan
 	//
 	// Scan
@@ -101,12 +128,12 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 				signaturesDir = filepath.Clean(sigsDir)
 			}
 		}
-		if err := syms.Scan(ipswPath, pemDbPath, signaturesDir, db); err != nil {
+		if err := syms.ScanContext(c.Request.Context(), ipswPath, pemDbPath, signaturesDir, db); err != nil {
 			if errors.Is(err, gorm.ErrDuplicatedKey) {
-				c.AbortWithStatusJSON(http.StatusConflict, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusConflict, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.JSON(http.StatusOK, successResponse{Success: true})
@@ -163,8 +190,8 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 				signaturesDir = filepath.Clean(sigsDir)
 			}
 		}
-		if err := syms.Rescan(ipswPath, pemDbPath, signaturesDir, db); err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+		if err := syms.RescanContext(c.Request.Context(), ipswPath, pemDbPath, signaturesDir, db); err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.JSON(http.StatusCreated, createdResponse{Created: true})
@@ -201,20 +228,155 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 	rg.GET("/syms/ipsw", func(c *gin.Context) {
 		var params IpswParams
 		if err := c.BindQuery(&params); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
 			return
 		}
 		ipsw, err := syms.GetIPSW(params.Version, params.Build, params.Device, db)
 		if err != nil {
 			if errors.Is(err, model.ErrNotFound) {
-				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.JSON(http.StatusOK, symIpswResponse(ipsw))
 	})
+	// swagger:route GET /syms/search Syms getSearch
+	//
+	// Search
+	//
+	// Search every scanned build for a symbol, string, entitlement or IOKit class (supports '*' wildcards).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: symbol
+	//         in: query
+	//         description: symbol name
+	//         required: false
+	//         type: string
+	//       + name: string
+	//         in: query
+	//         description: string literal
+	//         required: false
+	//         type: string
+	//       + name: entitlement
+	//         in: query
+	//         description: entitlement key
+	//         required: false
+	//         type: string
+	//       + name: iokit
+	//         in: query
+	//         description: IOKit class name (from DriverKit extension personalities)
+	//         required: false
+	//         type: string
+	//       + name: tag
+	//         in: query
+	//         description: only return results tagged KEY or KEY=VALUE
+	//         required: false
+	//         type: string
+	//
+	//     Responses:
+	//       200: symSearchResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	rg.GET("/syms/search", func(c *gin.Context) {
+		var kind model.SearchKind
+		var value string
+		for _, k := range []model.SearchKind{model.SearchSymbol, model.SearchString, model.SearchEntitlement, model.SearchIOKit} {
+			if v, ok := c.GetQuery(string(k)); ok {
+				if kind != "" {
+					c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "only one of symbol, string, entitlement or iokit query parameters is allowed"})
+					return
+				}
+				kind, value = k, v
+			}
+		}
+		if kind == "" || value == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing symbol, string, entitlement or iokit query parameter"})
+			return
+		}
+		results, err := syms.Search(kind, value, db)
+		if err != nil {
+			if errors.Is(err, model.ErrNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+				return
+			}
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		if tags != nil {
+			if err := tags.Annotate(kind, value, results); err != nil {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+		}
+		if tag := c.Query("tag"); tag != "" {
+			if tags == nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "tags require a sqlite or postgres database"})
+				return
+			}
+			tagKey, tagValue, _ := strings.Cut(tag, "=")
+			results = slices.DeleteFunc(results, func(r *model.SearchResult) bool { return !r.HasTag(tagKey, tagValue) })
+			if len(results) == 0 {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("no results tagged %s", tag)})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, symSearchResponse(results))
+	})
+	// swagger:route GET /syms/stability Syms getStability
+	//
+	// Stability
+	//
+	// Check how the symbols (or ObjC classes) you hook changed across the scanned builds (removals, renames, size and offset changes).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: symbol
+	//         in: query
+	//         description: symbol name (repeat for each symbol, prefix ObjC classes with 'class:')
+	//         required: true
+	//         type: array
+	//         items:
+	//           type: string
+	//         collectionFormat: multi
+	//       + name: min_version
+	//         in: query
+	//         description: only include builds with a version >= min_version
+	//         required: false
+	//         type: string
+	//       + name: max_version
+	//         in: query
+	//         description: only include builds with a version <= max_version
+	//         required: false
+	//         type: string
+	//
+	//     Responses:
+	//       200: symStabilityResponse
+	//       400: genericError
+	//       500: genericError
+	rg.GET("/syms/stability", func(c *gin.Context) {
+		symbols := c.QueryArray("symbol")
+		if len(symbols) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing symbol query parameter"})
+			return
+		}
+		report, err := syms.Stability(symbols, &syms.StabilityConfig{
+			MinVersion: c.Query("min_version"),
+			MaxVersion: c.Query("max_version"),
+		}, db)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		c.JSON(http.StatusOK, symStabilityResponse(report))
+	})
 	// swagger:route GET /syms/macho/{uuid} Syms getMachO
 	//
 	// MachO
@@ -239,10 +401,10 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 		m, err := syms.GetMachO(uuid, db)
 		if err != nil {
 			if errors.Is(err, model.ErrNotFound) {
-				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.JSON(http.StatusOK, symMachoResponse(m))
@@ -259,7 +421,7 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 	//     Parameters:
 	//       + name: uuid
 	//         in: path
-	//         description: dsc UUID
+	//         description: dsc UUID (of the main cache or any of its subcaches)
 	//         required: true
 	//         type: string
 	//
@@ -271,14 +433,88 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 		dsc, err := syms.GetDSC(uuid, db)
 		if err != nil {
 			if errors.Is(err, model.ErrNotFound) {
-				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.JSON(http.StatusOK, symDscResponse(dsc))
 	})
+	// swagger:route GET /syms/dsc/{uuid}/search Syms getDSCSearch
+	//
+	// DSC Search
+	//
+	// Search the exported symbols, local symbols and ObjC selectors of every image in a dyld_shared_cache with a regex.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: uuid
+	//         in: path
+	//         description: dsc UUID (of the main cache or any of its subcaches)
+	//         required: true
+	//         type: string
+	//       + name: path
+	//         in: query
+	//         description: path to the dyld_shared_cache with the given UUID
+	//         required: true
+	//         type: string
+	//       + name: re
+	//         in: query
+	//         description: symbol name regex
+	//         required: true
+	//         type: string
+	//
+	//     Responses:
+	//       200: symDscSearchResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	rg.GET("/syms/dsc/:uuid/search", func(c *gin.Context) {
+		uuid := c.Param("uuid")
+		dscPath := c.Query("path")
+		if dscPath == "" || c.Query("re") == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing path or re query parameter"})
+			return
+		}
+		re, err := regexp.Compile(c.Query("re"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: fmt.Sprintf("invalid regex: %v", err)})
+			return
+		}
+		f, release, err := cache.Acquire(fc, filepath.Clean(dscPath), dyld.Open)
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		defer release()
+		var found bool
+		for u := range f.Headers {
+			if strings.EqualFold(u.String(), uuid) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: fmt.Sprintf("%s is not the dyld_shared_cache (or a subcache) with UUID %s", dscPath, uuid)})
+			return
+		}
+		matches, err := dyld.SearchSymbolsContext(c.Request.Context(), f, re, 0)
+		resp := symDscSearchResponse{UUID: uuid, Path: dscPath, Matches: matches}
+		if err != nil {
+			var imgErrs dyld.ImageErrors
+			if !errors.As(err, &imgErrs) {
+				c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+				return
+			}
+			for _, ie := range imgErrs {
+				resp.Errors = append(resp.Errors, ie.Error())
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	})
 	// swagger:route GET /syms/dsc/{uuid}/{addr} Syms getDylib
 	//
 	// Dylib
@@ -291,7 +527,7 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 	//     Parameters:
 	//       + name: uuid
 	//         in: path
-	//         description: dsc UUID
+	//         description: dsc UUID (of the main cache or any of its subcaches)
 	//         required: true
 	//         type: string
 	//       + name: addr
@@ -309,10 +545,10 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 		dylib, err := syms.GetDSCImage(uuid, cast.ToUint64(addr), db)
 		if err != nil {
 			if errors.Is(err, model.ErrNotFound) {
-				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
 		c.JSON(http.StatusOK, symMachoResponse(dylib))
@@ -337,6 +573,11 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 	//         description: symbol address
 	//         required: true
 	//         type: integer
+	//       + name: demangle
+	//         in: query
+	//         description: add the demangled Swift/C++ symbol names
+	//         required: false
+	//         type: boolean
 	//
 	//     Responses:
 	//       200: symResponse
@@ -347,12 +588,15 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 		sym, err := syms.GetForAddr(uuid, cast.ToUint64(addr), db)
 		if err != nil {
 			if errors.Is(err, model.ErrNotFound) {
-				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
+		if c.Query("demangle") == "true" {
+			demangleSymbols(sym)
+		}
 		c.JSON(http.StatusOK, symResponse(sym))
 	})
 	// swagger:route GET /syms/{uuid} Syms getSymbols
@@ -370,6 +614,11 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 	//         description: file UUID
 	//         required: true
 	//         type: string
+	//       + name: demangle
+	//         in: query
+	//         description: add the demangled Swift/C++ symbol names
+	//         required: false
+	//         type: boolean
 	//
 	//     Responses:
 	//       200: symsResponse
@@ -379,12 +628,32 @@ func AddRoutes(rg *gin.RouterGroup, db db.Database, pemDB, sigsDir string) {
 		syms, err := syms.Get(uuid, db)
 		if err != nil {
 			if errors.Is(err, model.ErrNotFound) {
-				c.AbortWithStatusJSON(http.StatusNotFound, types.GenericError{Error: err.Error()})
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusInternalServerError, types.GenericError{Error: err.Error()})
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
 			return
 		}
+		if c.Query("demangle") == "true" {
+			demangleSymbols(syms...)
+		}
 		c.JSON(http.StatusOK, symsResponse(syms))
 	})
 }
+
+// demangleSymbols sets the demangled names of the Swift and C++ symbols
+func demangleSymbols(syms ...*model.Symbol) {
+	for _, sym := range syms {
+		name := sym.GetName()
+		switch {
+		case swift.IsMangled(name):
+			if out, err := swift.Demangle(name); err == nil && out != name {
+				sym.Demangled = out
+			}
+		case strings.HasPrefix(name, "__Z") || strings.HasPrefix(name, "_Z"):
+			if out := demangle.Do(name, false, false); out != name {
+				sym.Demangled = out
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package syms
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/gin-gonic/gin"
+)
+
+// swagger:response
+type tagResponse *model.Tag
+
+// swagger:response
+type tagsResponse []*model.Tag
+
+// swagger:parameters putSymsTag
+type tagParams struct {
+	// in:body
+	Body struct {
+		// ipsw, macho or symbol
+		Kind model.TagKind `json:"kind" binding:"required"`
+		// IPSW ID, MachO UUID or symbol name
+		Target string `json:"target" binding:"required"`
+		Key    string `json:"key" binding:"required"`
+		Value  string `json:"value,omitempty"`
+		Note   string `json:"note,omitempty"`
+	}
+}
+
+func addTagRoutes(rg *gin.RouterGroup, tags db.Tags) {
+	// swagger:route PUT /syms/tags Syms putSymsTag
+	//
+	// Tag
+	//
+	// Tag (or update the tag of) a scanned IPSW, MachO or symbol.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: tagResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	rg.PUT("/syms/tags", func(c *gin.Context) {
+		var params tagParams
+		if err := c.ShouldBindJSON(&params.Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.NewGenericError(err))
+			return
+		}
+		tag := &model.Tag{
+			Kind:   params.Body.Kind,
+			Target: params.Body.Target,
+			Key:    params.Body.Key,
+			Value:  params.Body.Value,
+			Note:   params.Body.Note,
+		}
+		if err := tags.SetTag(tag); err != nil {
+			if errors.Is(err, model.ErrNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+				return
+			}
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		c.JSON(http.StatusOK, tagResponse(tag))
+	})
+	// swagger:route GET /syms/tags Syms getSymsTags
+	//
+	// Tags
+	//
+	// Get the tags of a scanned artifact (kind and target) or every artifact tagged with a key (and value).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: kind
+	//         in: query
+	//         description: ipsw, macho or symbol
+	//         required: false
+	//         type: string
+	//       + name: target
+	//         in: query
+	//         description: IPSW ID, MachO UUID or symbol name
+	//         required: false
+	//         type: string
+	//       + name: key
+	//         in: query
+	//         description: tag key
+	//         required: false
+	//         type: string
+	//       + name: value
+	//         in: query
+	//         description: tag value
+	//         required: false
+	//         type: string
+	//
+	//     Responses:
+	//       200: tagsResponse
+	//       400: genericError
+	//       500: genericError
+	rg.GET("/syms/tags", func(c *gin.Context) {
+		var found []*model.Tag
+		var err error
+		if target := c.Query("target"); target != "" {
+			found, err = tags.GetTags(model.TagKind(c.Query("kind")), target)
+		} else if key := c.Query("key"); key != "" {
+			found, err = tags.FindTags(key, c.Query("value"))
+		} else {
+			c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: "missing kind and target (or key) query parameters"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		c.JSON(http.StatusOK, tagsResponse(found))
+	})
+	// swagger:route DELETE /syms/tags Syms deleteSymsTag
+	//
+	// Untag
+	//
+	// Remove the tag of a scanned artifact.
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Parameters:
+	//       + name: kind
+	//         in: query
+	//         description: ipsw, macho or symbol
+	//         required: true
+	//         type: string
+	//       + name: target
+	//         in: query
+	//         description: IPSW ID, MachO UUID or symbol name
+	//         required: true
+	//         type: string
+	//       + name: key
+	//         in: query
+	//         description: tag key
+	//         required: true
+	//         type: string
+	//
+	//     Responses:
+	//       200: successResponse
+	//       404: genericError
+	//       500: genericError
+	rg.DELETE("/syms/tags", func(c *gin.Context) {
+		if err := tags.DeleteTag(model.TagKind(c.Query("kind")), c.Query("target"), c.Query("key")); err != nil {
+			if errors.Is(err, model.ErrNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, types.NewGenericError(err))
+				return
+			}
+			c.AbortWithStatusJSON(errcode.HTTPStatus(err), types.NewGenericError(err))
+			return
+		}
+		c.JSON(http.StatusOK, successResponse{Success: true})
+	})
+}
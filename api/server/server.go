@@ -35,8 +35,10 @@ import (
 	"github.com/blacktop/ipsw/api"
 	"github.com/blacktop/ipsw/api/server/routes"
 	"github.com/blacktop/ipsw/api/server/routes/aea"
+	clusterRoutes "github.com/blacktop/ipsw/api/server/routes/cluster"
 	"github.com/blacktop/ipsw/api/server/routes/syms"
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/cache"
 	"github.com/blacktop/ipsw/internal/db"
 	"github.com/gin-gonic/gin"
 )
@@ -50,12 +52,16 @@ type Config struct {
 	LogFile string
 	PemDB   string
 	SigsDir string
+	// max number of dyld_shared_caches/kernelcaches to keep open (and parsed) between requests; 0 disables it
+	CacheSize int
+	CacheTTL  time.Duration
 }
 
 // Server is the main server struct
 type Server struct {
 	router *gin.Engine
 	server *http.Server
+	files  *cache.Files
 	conf   *Config
 }
 
@@ -63,12 +69,13 @@ type Server struct {
 func NewServer(conf *Config) *Server {
 	return &Server{
 		router: gin.Default(),
+		files:  cache.NewFiles(conf.CacheSize, conf.CacheTTL),
 		conf:   conf,
 	}
 }
 
 // Start starts the server
-func (s *Server) Start(db db.Database) error {
+func (s *Server) Start(db db.Database, cluster db.Cluster, tags db.Tags) error {
 	if s.conf.Debug {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -94,10 +101,14 @@ func (s *Server) Start(db db.Database) error {
 
 	rg := s.router.Group("/v" + api.DefaultVersion)
 
-	routes.Add(rg, s.conf.PemDB)
+	routes.Add(rg, s.conf.PemDB, s.files, db)
 
 	if db != nil {
-		syms.AddRoutes(rg, db, s.conf.PemDB, s.conf.SigsDir)
+		syms.AddRoutes(rg, db, tags, s.files, s.conf.PemDB, s.conf.SigsDir)
+	}
+
+	if cluster != nil {
+		clusterRoutes.AddRoutes(rg, cluster)
 	}
 
 	if s.conf.PemDB != "" {
@@ -147,6 +158,8 @@ func (s *Server) Stop() error {
 		return fmt.Errorf("server forced to shutdown: %v", err)
 	}
 
+	s.files.Close()
+
 	log.Info("Server Exiting")
 
 	return nil
@@ -1,5 +1,7 @@
 package types
 
+import "github.com/blacktop/ipsw/pkg/errcode"
+
 var (
 	BuildVersion string
 	BuildTime    string
@@ -14,5 +16,11 @@ type Version struct {
 
 // swagger:response genericError
 type GenericError struct {
-	Error string `json:"error"`
+	Error string       `json:"error"`
+	Code  errcode.Code `json:"code,omitempty"`
+}
+
+// NewGenericError returns the API error object for an error (including its errcode category)
+func NewGenericError(err error) GenericError {
+	return GenericError{Error: err.Error(), Code: errcode.Of(err)}
 }
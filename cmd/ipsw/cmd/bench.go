@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/bench"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	var names []string
+	for _, w := range bench.Workloads {
+		names = append(names, w.Name)
+	}
+
+	benchCmd.Flags().StringP("kernel", "k", "", "Kernelcache to benchmark against")
+	benchCmd.Flags().StringP("dsc", "d", "", "dyld_shared_cache to benchmark against")
+	benchCmd.Flags().StringSliceP("workload", "w", []string{}, fmt.Sprintf("Workloads to run (%s)", strings.Join(names, ", ")))
+	benchCmd.Flags().IntP("iterations", "n", 3, "Number of times to run each workload")
+	benchCmd.Flags().StringP("profile", "p", "", "Folder to write CPU/heap pprof profiles to")
+	benchCmd.Flags().Bool("json", false, "Output as JSON")
+	benchCmd.MarkFlagDirname("profile")
+	benchCmd.RegisterFlagCompletionFunc("workload", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return names, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	viper.BindPFlag("bench.kernel", benchCmd.Flags().Lookup("kernel"))
+	viper.BindPFlag("bench.dsc", benchCmd.Flags().Lookup("dsc"))
+	viper.BindPFlag("bench.workload", benchCmd.Flags().Lookup("workload"))
+	viper.BindPFlag("bench.iterations", benchCmd.Flags().Lookup("iterations"))
+	viper.BindPFlag("bench.profile", benchCmd.Flags().Lookup("profile"))
+	viper.BindPFlag("bench.json", benchCmd.Flags().Lookup("json"))
+}
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Benchmark representative workloads (with pprof capture)",
+	Example: heredoc.Doc(`
+		# Benchmark all workloads against a kernelcache and dyld_shared_cache
+		❯ ipsw bench --kernel kernelcache.release.iPhone15,2 --dsc dyld_shared_cache_arm64e
+		# Benchmark the kernel xref build 5 times and capture CPU/heap profiles
+		❯ ipsw bench -k kernelcache -w kernel-xrefs -n 5 --profile /tmp/pprof
+		❯ go tool pprof -http=: /tmp/pprof/kernel-xrefs.cpu.pprof`),
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		conf := &bench.Config{
+			Kernel:     viper.GetString("bench.kernel"),
+			DSC:        viper.GetString("bench.dsc"),
+			Workloads:  viper.GetStringSlice("bench.workload"),
+			Iterations: viper.GetInt("bench.iterations"),
+			ProfileDir: viper.GetString("bench.profile"),
+		}
+		if conf.Kernel == "" && conf.DSC == "" {
+			return fmt.Errorf("must supply --kernel and/or --dsc")
+		}
+
+		results, err := bench.Run(cmd.Context(), conf)
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool("bench.json") {
+			dat, err := json.Marshal(results)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WORKLOAD\tINPUT\tITEMS\tMIN\tMEAN\tMAX\tALLOC/OP\tALLOCS/OP")
+		for _, res := range results {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%d\n",
+				color.New(color.Bold).Sprint(res.Workload),
+				res.Input,
+				res.Items,
+				res.Min.Round(time.Millisecond),
+				res.Mean.Round(time.Millisecond),
+				res.Max.Round(time.Millisecond),
+				humanize.Bytes(res.AllocBytes),
+				res.Allocs,
+			)
+		}
+		w.Flush()
+
+		if conf.ProfileDir != "" {
+			log.Infof("Wrote pprof profiles to %s", conf.ProfileDir)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/offline"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorBundleField = color.New(color.Bold, color.FgHiBlue).SprintFunc()
+var colorBundleMissing = color.New(color.FgHiRed).SprintFunc()
+
+func init() {
+	rootCmd.AddCommand(bundleDataCmd)
+}
+
+// bundleDataCmd represents the bundle-data command
+var bundleDataCmd = &cobra.Command{
+	Use:   "bundle-data",
+	Short: "Package (or import) the network data needed to run air-gapped with --offline",
+	Long: heredoc.Doc(`
+		Package everything ipsw needs from the network (device DB, firmware/AEA keys,
+		symbolicator signatures and the macOS installer catalog) into a versioned data
+		bundle on a connected machine and import it on an air-gapped analysis machine.
+
+		Commands run with --offline then read the imported bundle and never touch the network.`),
+	Example: heredoc.Doc(`
+		# Show the data bundle imported on this machine
+		❯ ipsw bundle-data
+		# Create a bundle on a connected machine
+		❯ ipsw bundle-data create --signatures symbolicator/kernel --pem-db fcs-keys.json
+		# Import it on the air-gapped machine
+		❯ ipsw bundle-data import ipsw_data_20241014.tar.gz
+		❯ ipsw symbolicate --offline panic-full-2024-10-14.ips`),
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		dir, err := offline.Dir()
+		if err != nil {
+			return err
+		}
+		m, err := offline.Installed(dir)
+		if err != nil {
+			return err
+		}
+		printBundleManifest(dir, m)
+		return nil
+	},
+}
+
+func printBundleManifest(dir string, m *offline.Manifest) {
+	fmt.Printf("%s %s (format %d)\n", colorBundleField("Data Bundle:"), m.Version, m.Format)
+	fmt.Printf("%s     %s\n", colorBundleField("Location:"), dir)
+	fmt.Printf("%s      %s\n", colorBundleField("Created:"), m.Created.Local().Format("2006-01-02 15:04:05"))
+	if len(m.Tool) > 0 {
+		fmt.Printf("%s %s\n", colorBundleField("Created With:"), m.Tool)
+	}
+	for _, name := range []string{offline.DeviceDB, offline.IpswMeDevices, offline.FirmwareKeys, offline.FcsKeys, offline.Signatures, offline.MacOSCatalog} {
+		var files int
+		var size int64
+		for _, e := range m.Entries {
+			if e.Name == name || strings.HasPrefix(e.Name, name+"/") {
+				files++
+				size += e.Size
+			}
+		}
+		if files == 0 {
+			fmt.Printf("  - %-22s %s\n", name, colorBundleMissing("missing"))
+			continue
+		}
+		if files > 1 {
+			fmt.Printf("  - %-22s %s (%d files)\n", name, humanize.Bytes(uint64(size)), files)
+		} else {
+			fmt.Printf("  - %-22s %s\n", name, humanize.Bytes(uint64(size)))
+		}
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/offline"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/blacktop/ipsw/pkg/signature"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	bundleDataCmd.AddCommand(bundleDataCreateCmd)
+
+	bundleDataCreateCmd.Flags().StringP("output", "o", "", "Output data bundle (default is ipsw_data_<VERSION>.tar.gz)")
+	bundleDataCreateCmd.Flags().String("version", "", "Data bundle version (default is today's date)")
+	bundleDataCreateCmd.Flags().String("device-db", "", "Device DB JSON to bundle (`ipsw updatedb` output, default is the built-in DB)")
+	bundleDataCreateCmd.Flags().String("keys", "", "Firmware keys DB JSON to bundle (`ipsw key-list-gen` output)")
+	bundleDataCreateCmd.Flags().Bool("scrape-keys", false, "Scrape the latest firmware keys from theapplewiki.com (slow)")
+	bundleDataCreateCmd.Flags().String("pem-db", "", "AEA pem DB JSON to bundle")
+	bundleDataCreateCmd.Flags().StringP("signatures", "s", "", "Symbolicator signatures folder to bundle")
+	bundleDataCreateCmd.Flags().Bool("no-catalog", false, "Do NOT bundle the macOS installer catalog")
+	bundleDataCreateCmd.MarkFlagsMutuallyExclusive("keys", "scrape-keys")
+	bundleDataCreateCmd.MarkFlagDirname("signatures")
+	viper.BindPFlag("bundle-data.create.output", bundleDataCreateCmd.Flags().Lookup("output"))
+	viper.BindPFlag("bundle-data.create.version", bundleDataCreateCmd.Flags().Lookup("version"))
+	viper.BindPFlag("bundle-data.create.device-db", bundleDataCreateCmd.Flags().Lookup("device-db"))
+	viper.BindPFlag("bundle-data.create.keys", bundleDataCreateCmd.Flags().Lookup("keys"))
+	viper.BindPFlag("bundle-data.create.scrape-keys", bundleDataCreateCmd.Flags().Lookup("scrape-keys"))
+	viper.BindPFlag("bundle-data.create.pem-db", bundleDataCreateCmd.Flags().Lookup("pem-db"))
+	viper.BindPFlag("bundle-data.create.signatures", bundleDataCreateCmd.Flags().Lookup("signatures"))
+	viper.BindPFlag("bundle-data.create.no-catalog", bundleDataCreateCmd.Flags().Lookup("no-catalog"))
+}
+
+func writeBundleJSON(dir, name string, v any) error {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", name, err)
+	}
+	out := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(out, dat, 0o644)
+}
+
+// copyBundleJSON validates the JSON file src and copies it into the bundle as name
+func copyBundleJSON(dir, name, src string) error {
+	dat, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(dat) {
+		return fmt.Errorf("%s is not valid JSON", src)
+	}
+	out := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(out, dat, 0o644)
+}
+
+// copyBundleSignatures copies the signature JSON files of src (skipping the rest of a symbolicator checkout)
+func copyBundleSignatures(dir, src string) (int, error) {
+	sigs, err := signature.Parse(src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse signatures: %v", err)
+	}
+	if len(sigs) == 0 {
+		return 0, fmt.Errorf("no signatures found in %s", src)
+	}
+	return len(sigs), filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(dir, offline.Signatures, rel)
+		if err := os.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+			return err
+		}
+		return utils.Copy(path, out)
+	})
+}
+
+// bundleDataCreateCmd represents the bundle-data create command
+var bundleDataCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a data bundle for air-gapped machines",
+	Example: heredoc.Doc(`
+		# Bundle the device DB, ipsw.me device list and macOS installer catalog
+		❯ ipsw bundle-data create
+		# Also bundle fresh firmware keys, AEA keys and the kernel signatures
+		❯ ipsw bundle-data create --scrape-keys --pem-db fcs-keys.json --signatures symbolicator/kernel -o data.tar.gz`),
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		if offline.Enabled() {
+			return fmt.Errorf("cannot create a data bundle with --offline: %w", offline.ErrOffline)
+		}
+
+		version := viper.GetString("bundle-data.create.version")
+		if version == "" {
+			version = time.Now().UTC().Format("20060102")
+		}
+		output := viper.GetString("bundle-data.create.output")
+		if output == "" {
+			output = fmt.Sprintf("ipsw_data_%s.tar.gz", version)
+		}
+
+		staging, err := os.MkdirTemp("", "ipsw_bundle_data")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(staging)
+
+		/* device DB */
+		if dbPath := viper.GetString("bundle-data.create.device-db"); dbPath != "" {
+			if err := copyBundleJSON(staging, offline.DeviceDB, dbPath); err != nil {
+				return fmt.Errorf("failed to bundle device DB: %v", err)
+			}
+		} else {
+			db, err := info.GetIpswDB()
+			if err != nil {
+				return fmt.Errorf("failed to get device DB: %v", err)
+			}
+			if err := writeBundleJSON(staging, offline.DeviceDB, db); err != nil {
+				return err
+			}
+		}
+		log.WithField("data", offline.DeviceDB).Info("Bundled")
+
+		log.Info("Fetching ipsw.me device list")
+		if devices, err := download.GetAllDevices(); err != nil {
+			log.WithError(err).Warn("Skipping ipsw.me device list")
+		} else {
+			if err := writeBundleJSON(staging, offline.IpswMeDevices, devices); err != nil {
+				return err
+			}
+			log.WithField("data", offline.IpswMeDevices).Info("Bundled")
+		}
+
+		/* keys */
+		if keysPath := viper.GetString("bundle-data.create.keys"); keysPath != "" {
+			if err := copyBundleJSON(staging, offline.FirmwareKeys, keysPath); err != nil {
+				return fmt.Errorf("failed to bundle firmware keys: %v", err)
+			}
+			log.WithField("data", offline.FirmwareKeys).Info("Bundled")
+		} else if viper.GetBool("bundle-data.create.scrape-keys") {
+			log.Info("Scraping firmware keys (this will take a while)")
+			keys, err := download.ScrapeKeys("")
+			if err != nil {
+				return fmt.Errorf("failed to scrape firmware keys: %v", err)
+			}
+			if err := writeBundleJSON(staging, offline.FirmwareKeys, keys); err != nil {
+				return err
+			}
+			log.WithField("data", offline.FirmwareKeys).Info("Bundled")
+		}
+		if pemDB := viper.GetString("bundle-data.create.pem-db"); pemDB != "" {
+			if err := copyBundleJSON(staging, offline.FcsKeys, pemDB); err != nil {
+				return fmt.Errorf("failed to bundle AEA pem DB: %v", err)
+			}
+			log.WithField("data", offline.FcsKeys).Info("Bundled")
+		}
+
+		/* signatures */
+		if sigsDir := viper.GetString("bundle-data.create.signatures"); sigsDir != "" {
+			count, err := copyBundleSignatures(staging, filepath.Clean(sigsDir))
+			if err != nil {
+				return fmt.Errorf("failed to bundle signatures: %v", err)
+			}
+			log.WithField("data", offline.Signatures).Infof("Bundled %d signatures", count)
+		}
+
+		/* catalogs */
+		if !viper.GetBool("bundle-data.create.no-catalog") {
+			log.Info("Fetching macOS installer catalog")
+			if prods, err := download.GetProductInfo(); err != nil {
+				log.WithError(err).Warn("Skipping macOS installer catalog")
+			} else {
+				if err := writeBundleJSON(staging, offline.MacOSCatalog, prods); err != nil {
+					return err
+				}
+				log.WithField("data", offline.MacOSCatalog).Info("Bundled")
+			}
+		}
+
+		f, err := os.Create(filepath.Clean(output))
+		if err != nil {
+			return fmt.Errorf("failed to create data bundle: %v", err)
+		}
+		defer f.Close()
+		m, err := offline.Pack(staging, f, version, strings.TrimSpace("ipsw "+AppVersion))
+		if err != nil {
+			os.Remove(f.Name())
+			return fmt.Errorf("failed to create data bundle: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"version": m.Version,
+			"files":   len(m.Entries),
+		}).Infof("Created %s", output)
+		return nil
+	},
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/offline"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	bundleDataCmd.AddCommand(bundleDataImportCmd)
+}
+
+// bundleDataImportCmd represents the bundle-data import command
+var bundleDataImportCmd = &cobra.Command{
+	Use:   "import <BUNDLE>",
+	Short: "Import a data bundle for use with --offline",
+	Example: heredoc.Doc(`
+		# Import a data bundle (replacing the previously imported one)
+		❯ ipsw bundle-data import ipsw_data_20241014.tar.gz
+		# Import it into a custom location
+		❯ ipsw bundle-data import ipsw_data_20241014.tar.gz --offline-data /opt/ipsw/data`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		dir, err := offline.Dir()
+		if err != nil {
+			return err
+		}
+		m, err := offline.Import(filepath.Clean(args[0]), dir)
+		if err != nil {
+			return fmt.Errorf("failed to import data bundle: %w", err)
+		}
+		log.Infof("Imported data bundle %s", m.Version)
+		printBundleManifest(dir, m)
+		return nil
+	},
+}
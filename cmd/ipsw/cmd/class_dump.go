@@ -22,10 +22,12 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -35,7 +37,9 @@ import (
 	"github.com/blacktop/go-macho"
 	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
 	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/objc"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -77,7 +81,12 @@ func init() {
 	classDumpCmd.Flags().Bool("refs", false, "Dump ObjC references too")
 	classDumpCmd.Flags().Bool("re", false, "RE verbosity (with addresses)")
 	classDumpCmd.Flags().String("arch", "", "Which architecture to use for fat/universal MachO")
-	classDumpCmd.MarkFlagsMutuallyExclusive("headers", "xcfw", "spm")
+	classDumpCmd.Flags().BoolP("json", "j", false, "Output the classes, protocols and categories as JSON")
+	classDumpCmd.Flags().StringP("format", "f", mcmd.FormatIpsw, fmt.Sprintf("Output format (%s)", strings.Join(mcmd.ObjcFormats, ", ")))
+	classDumpCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return mcmd.ObjcFormats, cobra.ShellCompDirectiveNoFileComp
+	})
+	classDumpCmd.MarkFlagsMutuallyExclusive("headers", "xcfw", "spm", "json")
 
 	viper.BindPFlag("class-dump.all", classDumpCmd.Flags().Lookup("all"))
 	viper.BindPFlag("class-dump.deps", classDumpCmd.Flags().Lookup("deps"))
@@ -94,6 +103,8 @@ func init() {
 	viper.BindPFlag("class-dump.refs", classDumpCmd.Flags().Lookup("refs"))
 	viper.BindPFlag("class-dump.re", classDumpCmd.Flags().Lookup("re"))
 	viper.BindPFlag("class-dump.arch", classDumpCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("class-dump.json", classDumpCmd.Flags().Lookup("json"))
+	viper.BindPFlag("class-dump.format", classDumpCmd.Flags().Lookup("format"))
 }
 
 // classDumpCmd represents the classDump command
@@ -129,8 +140,15 @@ var classDumpCmd = &cobra.Command{
 			return fmt.Errorf("cannot dump --headers and use --xcfw or --spm flags")
 		} else if viper.GetBool("class-dump.re") && !Verbose {
 			return fmt.Errorf("cannot use --re without --verbose")
+		} else if viper.GetBool("class-dump.json") &&
+			(viper.GetString("class-dump.class") != "" ||
+				viper.GetString("class-dump.proto") != "" ||
+				viper.GetString("class-dump.cat") != "") {
+			return fmt.Errorf("cannot use --json with --class, --protocol or --category flags")
 		} else if len(viper.GetString("class-dump.output")) > 0 && (!viper.GetBool("class-dump.headers") && !viper.GetBool("class-dump.xcfw") && !viper.GetBool("class-dump.spm")) {
 			return fmt.Errorf("cannot set --output without setting --headers, --xcfw or --spm")
+		} else if !slices.Contains(mcmd.ObjcFormats, viper.GetString("class-dump.format")) {
+			return fmt.Errorf("invalid --format '%s' (must be one of: %s)", viper.GetString("class-dump.format"), strings.Join(mcmd.ObjcFormats, ", "))
 		}
 		doDump := false
 		if !viper.IsSet("class-dump.class") &&
@@ -161,6 +179,7 @@ var classDumpCmd = &cobra.Command{
 			Headers:  viper.GetBool("class-dump.headers"),
 			ObjcRefs: viper.GetBool("class-dump.refs"),
 			Deps:     viper.GetBool("class-dump.deps"),
+			Format:   viper.GetString("class-dump.format"),
 			// Generic:     viper.GetBool("class-dump.generic"),
 			IpswVersion: fmt.Sprintf("Version: %s, BuildCommit: %s", strings.TrimSpace(AppVersion), strings.TrimSpace(AppBuildCommit)),
 			Color:       viper.GetBool("color") && !viper.GetBool("no-color"),
@@ -216,6 +235,20 @@ var classDumpCmd = &cobra.Command{
 
 			conf.Name = filepath.Base(machoPath)
 
+			if viper.GetBool("class-dump.json") {
+				img, err := objc.ParseImage(m)
+				if err != nil {
+					return err
+				}
+				img.Name = conf.Name
+				dat, err := json.MarshalIndent(img, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(dat))
+				return nil
+			}
+
 			o, err = mcmd.NewObjC(m, nil, &conf)
 			if err != nil {
 				return err
@@ -269,6 +302,10 @@ var classDumpCmd = &cobra.Command{
 
 			if viper.GetBool("class-dump.all") {
 				images = f.Images
+				if viper.GetBool("stable") { // cache order changes across builds
+					images = slices.Clone(images)
+					stable.SortBy(images, func(img *dyld.CacheImage) string { return img.Name })
+				}
 			} else {
 				img, err := f.Image(args[1])
 				if err != nil {
@@ -277,6 +314,7 @@ var classDumpCmd = &cobra.Command{
 				images = append(images, img)
 			}
 
+			var objcImages []*objc.Image
 			for _, img := range images {
 				m, err = img.GetMacho()
 				if err != nil {
@@ -285,6 +323,22 @@ var classDumpCmd = &cobra.Command{
 
 				conf.Name = filepath.Base(img.Name)
 
+				if viper.GetBool("class-dump.json") {
+					oimg, err := objc.ParseImage(m)
+					if err != nil {
+						if errors.Is(err, objc.ErrNoObjC) {
+							if !viper.GetBool("class-dump.all") {
+								log.Warn("no ObjC data found in dylib")
+							}
+							continue
+						}
+						return fmt.Errorf("failed to parse ObjC from dylib '%s': %v", filepath.Base(img.Name), err)
+					}
+					oimg.Name = img.Name
+					objcImages = append(objcImages, oimg)
+					continue
+				}
+
 				o, err = mcmd.NewObjC(m, f, &conf)
 				if err != nil {
 					if errors.Is(err, mcmd.ErrNoObjc) {
@@ -339,6 +393,21 @@ var classDumpCmd = &cobra.Command{
 					}
 				}
 			}
+
+			if viper.GetBool("class-dump.json") {
+				var dat []byte
+				if viper.GetBool("class-dump.all") {
+					dat, err = json.MarshalIndent(objcImages, "", "  ")
+				} else if len(objcImages) > 0 {
+					dat, err = json.MarshalIndent(objcImages[0], "", "  ")
+				}
+				if err != nil {
+					return err
+				}
+				if len(dat) > 0 {
+					fmt.Println(string(dat))
+				}
+			}
 		}
 
 		return nil
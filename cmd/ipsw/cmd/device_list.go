@@ -22,18 +22,96 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"encoding/json"
 	"os"
-	"sort"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
-	"github.com/blacktop/ipsw/pkg/xcode"
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/releases"
+	"github.com/blacktop/ipsw/pkg/devicedb"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func init() {
 	rootCmd.AddCommand(deviceListCmd)
+
+	deviceListCmd.Flags().String("type", "", "Only list devices of this type (ios, macos, watchos, tvos, visionos, audioos)")
+	deviceListCmd.Flags().String("chip", "", "Only list devices with this chip or platform (e.g. A16 Bionic or t8120)")
+	deviceListCmd.Flags().String("name", "", "Only list devices whose name contains this")
+	deviceListCmd.Flags().String("os", "", "Only list devices that support this OS version (e.g. 17.0 or 'iOS 17.0', requires a releases snapshot)")
+	deviceListCmd.Flags().Bool("all", false, "Include prototypes, simulators and unidentified devices")
+	deviceListCmd.Flags().Bool("json", false, "Output as JSON")
+	deviceListCmd.RegisterFlagCompletionFunc("type", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"ios", "macos", "watchos", "tvos", "visionos", "audioos"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	viper.BindPFlag("device-list.type", deviceListCmd.Flags().Lookup("type"))
+	viper.BindPFlag("device-list.chip", deviceListCmd.Flags().Lookup("chip"))
+	viper.BindPFlag("device-list.name", deviceListCmd.Flags().Lookup("name"))
+	viper.BindPFlag("device-list.os", deviceListCmd.Flags().Lookup("os"))
+	viper.BindPFlag("device-list.all", deviceListCmd.Flags().Lookup("all"))
+	viper.BindPFlag("device-list.json", deviceListCmd.Flags().Lookup("json"))
+}
+
+// loadDeviceDB loads the device database with the OS ranges of the latest archived releases snapshot (if any)
+func loadDeviceDB() (*devicedb.DB, error) {
+	db, err := devicedb.Load()
+	if err != nil {
+		return nil, err
+	}
+	var archive string
+	if len(viper.ConfigFileUsed()) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return db, nil
+		}
+		archive = filepath.Join(home, ".config", "ipsw", "releases")
+	} else {
+		archive = filepath.Join(filepath.Dir(viper.ConfigFileUsed()), "releases")
+	}
+	if snaps, err := releases.Snapshots(archive); err == nil && len(snaps) > 0 {
+		snap, err := releases.Load(snaps[len(snaps)-1])
+		if err != nil {
+			log.WithError(err).Warn("failed to load releases snapshot (OS ranges will be missing)")
+			return db, nil
+		}
+		for _, b := range snap.Builds {
+			if ver, _, _ := strings.Cut(b.Version, " "); ver != "" { // i.e. '18.0 beta 2'
+				devs := make([]string, 0, len(b.Devices))
+				for dev := range b.Devices {
+					devs = append(devs, dev)
+				}
+				db.AddRelease(b.OS, ver, devs...)
+			}
+		}
+	}
+	return db, nil
+}
+
+// validateDeviceIdentifier checks a --device flag against the device DB (unknown but well formed identifiers are only
+// warned about as they may be newer than the DB)
+func validateDeviceIdentifier(device string) error {
+	if device == "" {
+		return nil
+	}
+	db, err := devicedb.Load()
+	if err != nil {
+		log.WithError(err).Debug("failed to load device DB (skipping --device validation)")
+		return nil
+	}
+	if err := db.Validate(device); errcode.Of(err) == errcode.NotFound {
+		log.Warn(err.Error())
+	} else if err != nil {
+		return err
+	}
+	return nil
 }
 
 // deviceListCmd represents the deviceList command
@@ -41,45 +119,77 @@ var deviceListCmd = &cobra.Command{
 	Use:     "device-list",
 	Aliases: []string{"devs"},
 	Short:   "List all iOS devices",
-	Args:    cobra.NoArgs,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	Example: heredoc.Doc(`
+		# List all the known devices
+		❯ ipsw device-list
 
-		// gen, _ := cmd.Flags().GetBool("gen")
-		// if gen {
-		// 	devices, err := xcode.ReadDeviceTraitsDB()
-		// 	if err != nil {
-		// 		return err
-		// 	}
+		# List the M2 iPads as JSON
+		❯ ipsw device-list --type ios --chip M2 --json
 
-		// 	err = xcode.WriteToJSON(devices)
-		// 	if err != nil {
-		// 		return err
-		// 	}
+		# List the devices that got iOS 17.0 (needs an 'ipsw releases --update' snapshot)
+		❯ ipsw device-list --os 'iOS 17.0'`),
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 
-		// 	return nil
-		// }
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
 
-		devices, err := xcode.GetDevices()
+		db, err := loadDeviceDB()
 		if err != nil {
 			return err
 		}
 
-		sort.Sort(xcode.ByProductType{Devices: devices})
+		devices := db.Query(&devicedb.Query{
+			Name: viper.GetString("device-list.name"),
+			Chip: viper.GetString("device-list.chip"),
+			Type: viper.GetString("device-list.type"),
+			OS:   viper.GetString("device-list.os"),
+			All:  viper.GetBool("device-list.all"),
+		})
+
+		if viper.GetBool("device-list.json") {
+			dat, err := json.Marshal(devices)
+			if err != nil {
+				return err
+			}
+			os.Stdout.Write(dat)
+			return nil
+		}
 
 		data := [][]string{}
 		for _, device := range devices {
+			var platforms, arches []string
+			for _, b := range device.Boards {
+				if b.Platform != "" && !slices.Contains(platforms, b.Platform) {
+					platforms = append(platforms, b.Platform)
+				}
+				if b.Arch != "" && !slices.Contains(arches, b.Arch) {
+					arches = append(arches, b.Arch)
+				}
+			}
+			var oses []string
+			for name, r := range device.OS {
+				oses = append(oses, name+" "+r.String())
+			}
+			slices.Sort(oses)
 			data = append(data, []string{
-				device.ProductType,
-				device.Target,
-				strings.Replace(device.ProductDescription, "generation", "gen", 1),
-				device.Platform,
-				device.DeviceTrait.PreferredArchitecture,
-				strconv.Itoa(device.DeviceTrait.DevicePerformanceMemoryClass),
+				device.Identifier,
+				strings.Join(device.Models(), " "),
+				strings.Replace(device.Name, "generation", "gen", 1),
+				strings.Join(device.Chips(), " "),
+				strings.Join(platforms, " "),
+				strings.Join(arches, " "),
+				strconv.FormatUint(device.MemClass, 10),
+				strings.Join(oses, ", "),
 			})
 		}
 
 		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"Product", "Model", "Description", "CPU", "Arch", "MemClass"})
+		table.SetHeader([]string{"Product", "Model", "Description", "Chip", "CPU", "Arch", "MemClass", "OS"})
 		table.SetAutoWrapText(false)
 		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
 		table.SetCenterSeparator("|")
@@ -0,0 +1,131 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/dext"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(dextCmd)
+
+	dextCmd.Flags().StringP("class", "c", "", "Only show extensions that implement or match on this IOKit class")
+	dextCmd.Flags().BoolP("ent", "e", false, "Show the extensions' entitlements")
+	dextCmd.Flags().Bool("json", false, "Output as JSON")
+	dextCmd.Flags().String("pem-db", "", "AEA pem DB JSON file")
+	viper.BindPFlag("dext.class", dextCmd.Flags().Lookup("class"))
+	viper.BindPFlag("dext.ent", dextCmd.Flags().Lookup("ent"))
+	viper.BindPFlag("dext.json", dextCmd.Flags().Lookup("json"))
+	viper.BindPFlag("dext.pem-db", dextCmd.Flags().Lookup("pem-db"))
+}
+
+// dextCmd represents the dext command
+var dextCmd = &cobra.Command{
+	Use:     "dext <IPSW|FOLDER>",
+	Aliases: []string{"driverkit"},
+	Short:   "List the DriverKit and system extensions of a build (with their IOKit personalities and entitlements)",
+	Example: heredoc.Doc(`
+		# List the DriverKit drivers of an IPSW
+		❯ ipsw dext iPad16,3_18.0_22A3354_Restore.ipsw
+		# Find the drivers that match on USB host interfaces (and show their entitlements)
+		❯ ipsw dext /Volumes/SkyF22A5282m.D8xOS --class IOUSBHostInterface --ent`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		input := filepath.Clean(args[0])
+		info, err := os.Stat(input)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %v", input, err)
+		}
+		log.Infof("Scanning %s for DriverKit and system extensions", input)
+		var exts []*dext.Extension
+		if info.IsDir() {
+			exts, err = dext.Scan(input)
+		} else {
+			exts, err = dext.ScanIPSW(input, viper.GetString("dext.pem-db"))
+		}
+		if err != nil {
+			return err
+		}
+
+		if class := viper.GetString("dext.class"); class != "" {
+			exts = slices.DeleteFunc(exts, func(e *dext.Extension) bool { return !slices.Contains(e.Classes(), class) })
+		}
+		if !viper.GetBool("dext.ent") {
+			for _, ext := range exts {
+				ext.Entitlements = nil
+			}
+		}
+
+		if viper.GetBool("dext.json") {
+			dat, err := json.MarshalIndent(exts, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+		if len(exts) == 0 {
+			log.Warn("No extensions found")
+			return nil
+		}
+		for _, ext := range exts {
+			fmt.Printf("%s %s (%s)\n", colorBin(ext.BundleID), ext.Version, ext.Kind)
+			fmt.Printf("  %s\n", ext.Path)
+			for _, p := range ext.Personalities {
+				fmt.Printf("    %s\n", p)
+			}
+			if len(ext.Entitlements) > 0 {
+				keys := make([]string, 0, len(ext.Entitlements))
+				for k := range ext.Entitlements {
+					keys = append(keys, k)
+				}
+				slices.Sort(keys)
+				fmt.Printf("  %s\n", colorKey("Entitlements:"))
+				for _, k := range keys {
+					fmt.Printf("    %s: %s\n", colorKey(k), colorValue(strings.TrimSpace(fmt.Sprint(ext.Entitlements[k]))))
+				}
+			}
+		}
+
+		return nil
+	},
+}
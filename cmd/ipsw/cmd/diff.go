@@ -46,6 +46,11 @@ func init() {
 	diffCmd.Flags().Bool("fw", false, "Diff other firmwares")
 	diffCmd.Flags().Bool("feat", false, "Diff feature flags")
 	diffCmd.Flags().Bool("strs", false, "Diff MachO cstrings")
+	diffCmd.Flags().Bool("loc", false, "Diff localized .strings, .stringsdict and .loctable strings")
+	diffCmd.Flags().Bool("xprotect", false, "Diff XProtect and MRT malware signatures (macOS)")
+	diffCmd.Flags().Bool("jetsam", false, "Diff jetsam priority bands, memory limits and task roles")
+	diffCmd.Flags().Int("funcs", 0, "Disassemble up to N changed functions per updated kext/dylib (for --html)")
+	diffCmd.Flags().String("server", "", "Symbol server URL to link the --html report's functions to")
 	diffCmd.Flags().StringSlice("allow-list", []string{}, "Filter MachO sections to diff (e.g. __TEXT.__text)")
 	diffCmd.Flags().StringSlice("block-list", []string{}, "Remove MachO sections to diff (e.g. __TEXT.__info_plist)")
 	diffCmd.Flags().StringP("output", "o", "", "Folder to save diff output")
@@ -61,6 +66,11 @@ func init() {
 	viper.BindPFlag("diff.fw", diffCmd.Flags().Lookup("fw"))
 	viper.BindPFlag("diff.feat", diffCmd.Flags().Lookup("feat"))
 	viper.BindPFlag("diff.strs", diffCmd.Flags().Lookup("strs"))
+	viper.BindPFlag("diff.loc", diffCmd.Flags().Lookup("loc"))
+	viper.BindPFlag("diff.xprotect", diffCmd.Flags().Lookup("xprotect"))
+	viper.BindPFlag("diff.jetsam", diffCmd.Flags().Lookup("jetsam"))
+	viper.BindPFlag("diff.funcs", diffCmd.Flags().Lookup("funcs"))
+	viper.BindPFlag("diff.server", diffCmd.Flags().Lookup("server"))
 	viper.BindPFlag("diff.allow-list", diffCmd.Flags().Lookup("allow-list"))
 	viper.BindPFlag("diff.block-list", diffCmd.Flags().Lookup("block-list"))
 	viper.BindPFlag("diff.output", diffCmd.Flags().Lookup("output"))
@@ -77,6 +87,8 @@ var diffCmd = &cobra.Command{
 		❯ ipsw diff <old.ipsw> <new.ipsw> --output <output/folder> --markdown 
 			--kdk /Library/Developer/KDKs/KDK_15.0_24A5264n.kdk/System/Library/Kernels/kernel.release.t6031 
 			--kdk /Library/Developer/KDKs/KDK_15.0_24A5279h.kdk/System/Library/Kernels/kernel.release.t6031
+		# Create a shareable HTML report (with the disassembly of up to 25 changed functions per kext/dylib)
+		❯ ipsw diff <old.ipsw> <new.ipsw> --output <output/folder> --html --funcs 25 --server http://localhost:3993
 		# Use a previously saved .idiff file
 		❯ ipsw diff --in <path/to/.idiff> --output <output/folder> --markdown`),
 	Args:          cobra.MaximumNArgs(2),
@@ -123,9 +135,14 @@ var diffCmd = &cobra.Command{
 				Firmware:  viper.GetBool("diff.fw"),
 				Features:  viper.GetBool("diff.feat"),
 				CStrings:  viper.GetBool("diff.strs"),
+				Localized: viper.GetBool("diff.loc"),
+				XProtect:  viper.GetBool("diff.xprotect"),
+				Jetsam:    viper.GetBool("diff.jetsam"),
 				AllowList: viper.GetStringSlice("diff.allow-list"),
 				BlockList: viper.GetStringSlice("diff.block-list"),
 				Output:    viper.GetString("diff.output"),
+				Functions: viper.GetInt("diff.funcs"),
+				Server:    viper.GetString("diff.server"),
 			})
 			if err := d.Diff(); err != nil {
 				return err
@@ -143,7 +160,7 @@ var diffCmd = &cobra.Command{
 					return fmt.Errorf("failed to create JSON diff: %s", err)
 				}
 			case viper.GetBool("diff.html"):
-				if err := d.ToHTML(); err != nil {
+				if err := d.HTML(); err != nil {
 					return fmt.Errorf("failed to save HTML diff: %s", err)
 				}
 			default:
@@ -26,7 +26,11 @@ import (
 	"path"
 	"strings"
 
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/complete"
 	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/devicedb"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -39,6 +43,8 @@ type downloadFlags struct {
 	ResumeAll    bool
 	RestartAll   bool
 	RemoveCommas bool
+	Verify       bool
+	Strict       bool
 
 	WhiteList []string
 	BlackList []string
@@ -59,6 +65,8 @@ func init() {
 	DownloadCmd.PersistentFlags().BoolVar(&dFlg.ResumeAll, "resume-all", false, "always resume resumable IPSWs")
 	DownloadCmd.PersistentFlags().BoolVar(&dFlg.RestartAll, "restart-all", false, "always restart resumable IPSWs")
 	DownloadCmd.PersistentFlags().BoolVarP(&dFlg.RemoveCommas, "remove-commas", "_", false, "replace commas in IPSW filename with underscores")
+	DownloadCmd.PersistentFlags().BoolVar(&dFlg.Verify, "verify", false, "verify downloads against their published digests/chunklists and zip CRCs")
+	DownloadCmd.PersistentFlags().BoolVar(&dFlg.Strict, "strict", false, "fail downloads that do NOT verify (implies --verify)")
 	viper.BindPFlag("download.proxy", DownloadCmd.Flags().Lookup("proxy"))
 	viper.BindPFlag("download.insecure", DownloadCmd.Flags().Lookup("insecure"))
 	viper.BindPFlag("download.confirm", DownloadCmd.Flags().Lookup("confirm"))
@@ -66,6 +74,8 @@ func init() {
 	viper.BindPFlag("download.resume-all", DownloadCmd.Flags().Lookup("resume-all"))
 	viper.BindPFlag("download.restart-all", DownloadCmd.Flags().Lookup("restart-all"))
 	viper.BindPFlag("download.remove-commas", DownloadCmd.Flags().Lookup("remove-commas"))
+	viper.BindPFlag("download.verify", DownloadCmd.Flags().Lookup("verify"))
+	viper.BindPFlag("download.strict", DownloadCmd.Flags().Lookup("strict"))
 	// Filters
 	DownloadCmd.PersistentFlags().StringArrayVar(&dFlg.WhiteList, "white-list", []string{}, "iOS device white list")
 	DownloadCmd.PersistentFlags().StringArrayVar(&dFlg.BlackList, "black-list", []string{}, "iOS device black list")
@@ -73,6 +83,10 @@ func init() {
 	DownloadCmd.PersistentFlags().StringVarP(&dFlg.Model, "model", "m", "", "iOS Model (i.e. D321AP)")
 	DownloadCmd.PersistentFlags().StringVarP(&dFlg.Version, "version", "v", "", "iOS Version (i.e. 12.3.1)")
 	DownloadCmd.PersistentFlags().StringVarP(&dFlg.Build, "build", "b", "", "iOS BuildID (i.e. 16F203)")
+	DownloadCmd.RegisterFlagCompletionFunc("device", complete.Devices)
+	DownloadCmd.RegisterFlagCompletionFunc("white-list", complete.Devices)
+	DownloadCmd.RegisterFlagCompletionFunc("black-list", complete.Devices)
+	DownloadCmd.RegisterFlagCompletionFunc("model", complete.Models)
 	viper.BindPFlag("download.white-list", DownloadCmd.Flags().Lookup("white-list"))
 	viper.BindPFlag("download.black-list", DownloadCmd.Flags().Lookup("black-list"))
 	viper.BindPFlag("download.device", DownloadCmd.Flags().Lookup("device"))
@@ -81,6 +95,34 @@ func init() {
 	viper.BindPFlag("download.build", DownloadCmd.Flags().Lookup("build"))
 }
 
+// validateDevices checks the --device/--model flags against the device DB (unknown but well formed devices are only
+// warned about as they may be newer than the DB)
+func validateDevices(device, model string) error {
+	if device == "" && model == "" {
+		return nil
+	}
+	db, err := devicedb.Load()
+	if err != nil {
+		log.WithError(err).Debug("failed to load device DB (skipping --device/--model validation)")
+		return nil
+	}
+	var errs []error
+	if device != "" {
+		errs = append(errs, db.Validate(device))
+	}
+	if model != "" {
+		errs = append(errs, db.ValidateModel(model))
+	}
+	for _, err := range errs {
+		if errcode.Of(err) == errcode.NotFound {
+			log.Warn(err.Error())
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func filterIPSWs(cmd *cobra.Command, macos bool) ([]download.IPSW, error) {
 
 	var err error
@@ -208,11 +250,12 @@ var DownloadCmd = &cobra.Command{
 	Aliases: []string{"dl"},
 	Short:   "Download Apple Firmware files (and more)",
 	Args:    cobra.NoArgs,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		viper.BindPFlag("color", cmd.Flags().Lookup("color"))
 		viper.BindPFlag("no-color", cmd.Flags().Lookup("no-color"))
 		viper.BindPFlag("verbose", cmd.Flags().Lookup("verbose"))
 		viper.BindPFlag("diff-tool", cmd.Flags().Lookup("diff-tool"))
+		return validateDevices(dFlg.Device, dFlg.Model)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
@@ -136,6 +136,8 @@ var downloadAppledbCmd = &cobra.Command{
 		viper.BindPFlag("download.skip-all", cmd.Flags().Lookup("skip-all"))
 		viper.BindPFlag("download.resume-all", cmd.Flags().Lookup("resume-all"))
 		viper.BindPFlag("download.restart-all", cmd.Flags().Lookup("restart-all"))
+		viper.BindPFlag("download.verify", cmd.Flags().Lookup("verify"))
+		viper.BindPFlag("download.strict", cmd.Flags().Lookup("strict"))
 		viper.BindPFlag("download.remove-commas", cmd.Flags().Lookup("remove-commas"))
 		viper.BindPFlag("download.device", cmd.Flags().Lookup("device"))
 		viper.BindPFlag("download.version", cmd.Flags().Lookup("version"))
@@ -147,6 +149,8 @@ var downloadAppledbCmd = &cobra.Command{
 		skipAll := viper.GetBool("download.skip-all")
 		resumeAll := viper.GetBool("download.resume-all")
 		restartAll := viper.GetBool("download.restart-all")
+		verify := viper.GetBool("download.verify")
+		strict := viper.GetBool("download.strict")
 		removeCommas := viper.GetBool("download.remove-commas")
 		// filters
 		device := viper.GetString("download.device")
@@ -471,6 +475,8 @@ var downloadAppledbCmd = &cobra.Command{
 				}
 			} else { // NORMAL MODE
 				downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+				downloader.Verify = verify
+				downloader.Strict = strict
 				for idx, result := range results {
 					var url string
 					for _, link := range result.Links {
@@ -515,6 +521,14 @@ var downloadAppledbCmd = &cobra.Command{
 						downloader.URL = url
 						downloader.DestName = fname
 						downloader.Sha1 = result.Hashes.Sha1
+						downloader.Digests = nil
+						if len(result.Hashes.Sha2256) > 0 {
+							digest, err := download.NewDigest("sha2-256", result.Hashes.Sha2256)
+							if err != nil {
+								return err
+							}
+							downloader.Digests = append(downloader.Digests, digest)
+						}
 
 						err = downloader.Do()
 						if err != nil {
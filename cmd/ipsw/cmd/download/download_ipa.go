@@ -30,6 +30,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/download"
 	"github.com/fatih/color"
@@ -44,12 +45,16 @@ func init() {
 	ipaCmd.Flags().StringP("output", "o", "", "Folder to download files to")
 	ipaCmd.Flags().StringP("store-front", "s", "US", "The country code for the App Store to download from")
 	ipaCmd.Flags().StringP("vault-password", "k", "", "Password to unlock credential vault (only for file vaults)")
+	ipaCmd.Flags().Bool("history", false, "List the app's version history (external version IDs)")
+	ipaCmd.Flags().String("version-id", "", "Download a previous version of the app (external version ID from --history)")
 	ipaCmd.MarkFlagDirname("output")
 	viper.BindPFlag("download.ipa.sms", ipaCmd.Flags().Lookup("sms"))
 	viper.BindPFlag("download.ipa.search", ipaCmd.Flags().Lookup("search"))
 	viper.BindPFlag("download.ipa.output", ipaCmd.Flags().Lookup("output"))
 	viper.BindPFlag("download.ipa.store-front", ipaCmd.Flags().Lookup("store-front"))
 	viper.BindPFlag("download.ipa.vault-password", ipaCmd.Flags().Lookup("vault-password"))
+	viper.BindPFlag("download.ipa.history", ipaCmd.Flags().Lookup("history"))
+	viper.BindPFlag("download.ipa.version-id", ipaCmd.Flags().Lookup("version-id"))
 	ipaCmd.SetHelpFunc(func(c *cobra.Command, s []string) {
 		DownloadCmd.PersistentFlags().MarkHidden("white-list")
 		DownloadCmd.PersistentFlags().MarkHidden("black-list")
@@ -67,11 +72,21 @@ func init() {
 	DownloadCmd.AddCommand(ipaCmd)
 }
 
+var colorCurrent = color.New(color.Faint).SprintFunc()
+
 // ipaCmd represents the dev command
 var ipaCmd = &cobra.Command{
-	Use:           "ipa",
-	Aliases:       []string{"app"},
-	Short:         "Download App Packages from the iOS App Store",
+	Use:     "ipa",
+	Aliases: []string{"app"},
+	Short:   "Download App Packages from the iOS App Store",
+	Example: heredoc.Doc(`
+		# Download the latest version of an app
+		❯ ipsw download ipa --output /tmp com.zhiliaoapp.musically
+		# List the app's version history and download a previous version
+		❯ ipsw download ipa --history com.zhiliaoapp.musically
+		❯ ipsw download ipa --version-id 861195221 com.zhiliaoapp.musically
+		# Decrypt the downloaded app with a jailbroken device it is installed on
+		❯ ipsw ssh decrypt /tmp/com.zhiliaoapp.musically_835599320.v34.5.0.ipa`),
 	Args:          cobra.ExactArgs(1),
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -117,6 +132,29 @@ var ipaCmd = &cobra.Command{
 			return fmt.Errorf("failed to login to App Store: %v", err)
 		}
 
+		if viper.GetBool("download.ipa.search") && (viper.GetBool("download.ipa.history") || viper.GetString("download.ipa.version-id") != "") {
+			return fmt.Errorf("cannot use --search with --history or --version-id")
+		}
+
+		if viper.GetBool("download.ipa.history") {
+			hist, err := as.Versions(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get app version history: %v", err)
+			}
+			log.WithFields(log.Fields{
+				"version": hist.Version,
+				"id":      hist.Current,
+			}).Info(hist.BundleID)
+			for _, id := range hist.IDs {
+				if id == hist.Current {
+					fmt.Printf("%d %s\n", id, colorCurrent("(current)"))
+				} else {
+					fmt.Println(id)
+				}
+			}
+			return nil
+		}
+
 		if viper.GetBool("download.ipa.search") {
 			apps, err := as.Search(args[0], download.AppStoreSearchLimit)
 			if err != nil {
@@ -151,6 +189,7 @@ var ipaCmd = &cobra.Command{
 			return nil
 		}
 
-		return as.Download(args[0], output)
+		_, err = as.DownloadVersion(args[0], viper.GetString("download.ipa.version-id"), output)
+		return err
 	},
 }
@@ -109,6 +109,8 @@ var ipswCmd = &cobra.Command{
 		viper.BindPFlag("download.skip-all", cmd.Flags().Lookup("skip-all"))
 		viper.BindPFlag("download.resume-all", cmd.Flags().Lookup("resume-all"))
 		viper.BindPFlag("download.restart-all", cmd.Flags().Lookup("restart-all"))
+		viper.BindPFlag("download.verify", cmd.Flags().Lookup("verify"))
+		viper.BindPFlag("download.strict", cmd.Flags().Lookup("strict"))
 		viper.BindPFlag("download.remove-commas", cmd.Flags().Lookup("remove-commas"))
 		viper.BindPFlag("download.white-list", cmd.Flags().Lookup("white-list"))
 		viper.BindPFlag("download.black-list", cmd.Flags().Lookup("black-list"))
@@ -124,6 +126,8 @@ var ipswCmd = &cobra.Command{
 		skipAll := viper.GetBool("download.skip-all")
 		resumeAll := viper.GetBool("download.resume-all")
 		restartAll := viper.GetBool("download.restart-all")
+		verify := viper.GetBool("download.verify")
+		strict := viper.GetBool("download.strict")
 		removeCommas := viper.GetBool("download.remove-commas")
 		// filters
 		device := viper.GetString("download.device")
@@ -458,6 +462,8 @@ var ipswCmd = &cobra.Command{
 						downloader.URL = i.URL
 						downloader.Sha1 = i.SHA1
 						downloader.DestName = destName
+						downloader.Verify = verify
+						downloader.Strict = strict
 
 						if err := downloader.Do(); err != nil {
 							return fmt.Errorf("failed to download file: %v", err)
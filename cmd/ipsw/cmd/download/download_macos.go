@@ -78,6 +78,8 @@ var macosCmd = &cobra.Command{
 		viper.BindPFlag("download.skip-all", cmd.Flags().Lookup("skip-all"))
 		viper.BindPFlag("download.resume-all", cmd.Flags().Lookup("resume-all"))
 		viper.BindPFlag("download.restart-all", cmd.Flags().Lookup("restart-all"))
+		viper.BindPFlag("download.verify", cmd.Flags().Lookup("verify"))
+		viper.BindPFlag("download.strict", cmd.Flags().Lookup("strict"))
 		viper.BindPFlag("download.version", cmd.Flags().Lookup("version"))
 		viper.BindPFlag("download.build", cmd.Flags().Lookup("build"))
 
@@ -90,6 +92,8 @@ var macosCmd = &cobra.Command{
 		skipAll := viper.GetBool("download.skip-all")
 		resumeAll := viper.GetBool("download.resume-all")
 		restartAll := viper.GetBool("download.restart-all")
+		verify := viper.GetBool("download.verify")
+		strict := viper.GetBool("download.strict")
 		// filters
 		version := viper.GetString("download.version")
 		build := viper.GetString("download.build")
@@ -195,7 +199,7 @@ var macosCmd = &cobra.Command{
 
 		if cont {
 			for _, prod := range prods {
-				if err := prod.DownloadInstaller(workDir, proxy, insecure, skipAll, resumeAll, restartAll, ignoreSha1, assistantOnly); err != nil {
+				if err := prod.DownloadInstaller(workDir, proxy, insecure, skipAll, resumeAll, restartAll, ignoreSha1, verify, strict, assistantOnly); err != nil {
 					return err
 				}
 			}
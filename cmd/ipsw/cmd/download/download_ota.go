@@ -128,6 +128,8 @@ var otaDLCmd = &cobra.Command{
 		viper.BindPFlag("download.skip-all", cmd.Flags().Lookup("skip-all"))
 		viper.BindPFlag("download.resume-all", cmd.Flags().Lookup("resume-all"))
 		viper.BindPFlag("download.restart-all", cmd.Flags().Lookup("restart-all"))
+		viper.BindPFlag("download.verify", cmd.Flags().Lookup("verify"))
+		viper.BindPFlag("download.strict", cmd.Flags().Lookup("strict"))
 		viper.BindPFlag("download.remove-commas", cmd.Flags().Lookup("remove-commas"))
 		viper.BindPFlag("download.white-list", cmd.Flags().Lookup("white-list"))
 		viper.BindPFlag("download.black-list", cmd.Flags().Lookup("black-list"))
@@ -143,6 +145,8 @@ var otaDLCmd = &cobra.Command{
 		skipAll := viper.GetBool("download.skip-all")
 		resumeAll := viper.GetBool("download.resume-all")
 		restartAll := viper.GetBool("download.restart-all")
+		verify := viper.GetBool("download.verify")
+		strict := viper.GetBool("download.strict")
 		removeCommas := viper.GetBool("download.remove-commas")
 		// filters
 		device := viper.GetString("download.device")
@@ -415,6 +419,8 @@ var otaDLCmd = &cobra.Command{
 				}
 			} else {
 				downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+				downloader.Verify = verify
+				downloader.Strict = strict
 				for _, o := range otas {
 					folder := filepath.Join(destPath, fmt.Sprintf("%s%s_OTAs", o.ProductSystemName, strings.TrimPrefix(o.OSVersion, "9.9.")))
 					os.MkdirAll(folder, 0750)
@@ -462,6 +468,14 @@ var otaDLCmd = &cobra.Command{
 						// download file
 						downloader.URL = url
 						downloader.DestName = destName
+						downloader.Digests = nil
+						if len(o.Hash) > 0 { // the asset's _Measurement
+							algorithm := o.HashAlgorithm
+							if len(algorithm) == 0 {
+								algorithm = "SHA-1"
+							}
+							downloader.Digests = append(downloader.Digests, download.Digest{Algorithm: algorithm, Sum: o.Hash})
+						}
 						if err := downloader.Do(); err != nil {
 							return fmt.Errorf("failed to download file: %v", err)
 						}
@@ -0,0 +1,248 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dyld
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/dsc"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DyldCmd.AddCommand(AslrCmd)
+	AslrCmd.Flags().Uint64P("slide", "s", 0, "Known dyld_shared_cache slide (otherwise it is inferred from the addresses)")
+	AslrCmd.Flags().StringP("input", "i", "", "File with slid addresses (one per line)")
+	AslrCmd.Flags().Bool("json", false, "Output as JSON")
+	AslrCmd.MarkFlagFilename("input")
+	viper.BindPFlag("dyld.aslr.slide", AslrCmd.Flags().Lookup("slide"))
+	viper.BindPFlag("dyld.aslr.input", AslrCmd.Flags().Lookup("input"))
+	viper.BindPFlag("dyld.aslr.json", AslrCmd.Flags().Lookup("json"))
+}
+
+type canonicalAddr struct {
+	Slid       uint64 `json:"slid"`
+	Unslid     uint64 `json:"unslid"`
+	PageOffset uint64 `json:"page_offset"`
+	Image      string `json:"image,omitempty"`
+	// offset from the image's load address
+	ImageOffset uint64 `json:"image_offset,omitempty"`
+	Symbol      string `json:"symbol,omitempty"`
+}
+
+type aslrReport struct {
+	ASLR      *dyld.ASLR      `json:"aslr"`
+	Slides    *dyld.Slides    `json:"slides,omitempty"`
+	Slide     *uint64         `json:"slide,omitempty"`
+	Addresses []canonicalAddr `json:"addresses,omitempty"`
+}
+
+func readAddrs(args []string, input string) ([]uint64, error) {
+	if input != "" {
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				args = append(args, strings.Fields(line)[0])
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	var addrs []uint64
+	for _, arg := range args {
+		addr, err := utils.ConvertStrToInt(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address '%s': %v", arg, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// AslrCmd represents the aslr command
+var AslrCmd = &cobra.Command{
+	Use:   "aslr <DSC> [SLID_ADDR...]",
+	Short: "Explain shared region ASLR and canonicalize slid addresses",
+	Long: heredoc.Doc(`
+		Explain the shared region's layout, max slide and slide granularity (entropy) and convert
+		slid addresses (i.e. from a crash log, lldb or an info leak) into canonical unslid image
+		relative addresses so exploit write-ups are consistent across devices and boots.
+
+		If no --slide is given it is inferred from the addresses (the more addresses the fewer
+		candidate slides remain).`),
+	Example: heredoc.Doc(`
+		# Show the shared region ASLR parameters
+		❯ ipsw dyld aslr dyld_shared_cache_arm64e
+		# Infer the slide from leaked pointers and canonicalize them
+		❯ ipsw dyld aslr dyld_shared_cache_arm64e 0x1a4b6c7d0 0x1b3e5a120 0x1f00c8e40
+		# Canonicalize the addresses in a file with a known slide
+		❯ ipsw dyld aslr --slide 0x4a8c000 --input leaks.txt --json dyld_shared_cache_arm64e`),
+	Args: cobra.MinimumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		addrs, err := readAddrs(args[1:], viper.GetString("dyld.aslr.input"))
+		if err != nil {
+			return err
+		}
+
+		dscPath := filepath.Clean(args[0])
+
+		fileInfo, err := os.Lstat(dscPath)
+		if err != nil {
+			return fmt.Errorf("file %s does not exist", dscPath)
+		}
+
+		// Check if file is a symlink
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			symlinkPath, err := os.Readlink(dscPath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %v", dscPath, err)
+			}
+			// TODO: this seems like it would break
+			linkParent := filepath.Dir(dscPath)
+			linkRoot := filepath.Dir(linkParent)
+
+			dscPath = filepath.Join(linkRoot, symlinkPath)
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		report := aslrReport{ASLR: f.ASLR()}
+
+		if len(addrs) > 0 {
+			if cmd.Flags().Changed("slide") {
+				slide := viper.GetUint64("dyld.aslr.slide")
+				if err := f.CheckSlide(slide); err != nil {
+					return err
+				}
+				report.Slide = &slide
+			} else {
+				report.Slides, err = f.SlideCandidates(addrs)
+				if err != nil {
+					return err
+				}
+				if report.Slides.Unique() {
+					report.Slide = &report.Slides.Min
+				}
+			}
+			for _, addr := range addrs {
+				ca := canonicalAddr{
+					Slid:       addr,
+					PageOffset: addr & (report.ASLR.Granularity - 1),
+				}
+				if report.Slide != nil {
+					ca.Unslid = addr - *report.Slide
+					if img, err := f.GetImageContainingVMAddr(ca.Unslid); err == nil {
+						ca.Image = filepath.Base(img.Name)
+						ca.ImageOffset = ca.Unslid - img.LoadAddress
+					}
+					if sym, err := dsc.LookupSymbol(f, ca.Unslid); err == nil {
+						ca.Symbol = sym.Symbol
+					} else {
+						log.Debugf("failed to lookup symbol for %#x: %v", ca.Unslid, err)
+					}
+				}
+				report.Addresses = append(report.Addresses, ca)
+			}
+		}
+
+		if viper.GetBool("dyld.aslr.json") {
+			dat, err := json.Marshal(report)
+			if err != nil {
+				return fmt.Errorf("failed to marshal ASLR report as JSON: %v", err)
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		fmt.Println(report.ASLR)
+
+		if len(addrs) == 0 {
+			return nil
+		}
+
+		if report.Slide == nil {
+			log.WithFields(log.Fields{
+				"candidates": report.Slides.Count,
+				"min":        fmt.Sprintf("%#x", report.Slides.Min),
+				"max":        fmt.Sprintf("%#x", report.Slides.Max),
+			}).Warn("Slide is ambiguous (supply more addresses or --slide)")
+			for _, s := range report.Slides.Values {
+				fmt.Printf("  slide %#x\n", s)
+			}
+			fmt.Println("\nOnly the page offsets are canonical:")
+			for _, ca := range report.Addresses {
+				fmt.Printf("%s -> page offset %#x\n", colorAddr("%#x", ca.Slid), ca.PageOffset)
+			}
+			return nil
+		}
+
+		log.WithField("slide", fmt.Sprintf("%#x", *report.Slide)).Info("Slide")
+		for _, ca := range report.Addresses {
+			if ca.Image == "" {
+				fmt.Printf("%s -> %#x\n", colorAddr("%#x", ca.Slid), ca.Unslid)
+				continue
+			}
+			fmt.Printf("%s -> %#x %s+%#x", colorAddr("%#x", ca.Slid), ca.Unslid, colorImage(ca.Image), ca.ImageOffset)
+			if ca.Symbol != "" {
+				fmt.Printf(" (%s)", symNameColor(ca.Symbol))
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,224 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dyld
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/apex/log"
+	dscCmd "github.com/blacktop/ipsw/internal/commands/dsc"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DyldCmd.AddCommand(dyldCachesCmd)
+	dyldCachesCmd.Flags().StringArrayP("image", "i", []string{}, "Look up dylib in every cache (can be used multiple times)")
+	dyldCachesCmd.Flags().StringP("symbol", "s", "", "Regex search the symbols of every cache")
+	dyldCachesCmd.Flags().StringP("pattern", "p", "", "Regex search the strings of every cache (SLOW)")
+	dyldCachesCmd.Flags().IntP("workers", "w", 0, "Number of images to search in parallel (default is NumCPU)")
+	dyldCachesCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("dyld.caches.image", dyldCachesCmd.Flags().Lookup("image"))
+	viper.BindPFlag("dyld.caches.symbol", dyldCachesCmd.Flags().Lookup("symbol"))
+	viper.BindPFlag("dyld.caches.pattern", dyldCachesCmd.Flags().Lookup("pattern"))
+	viper.BindPFlag("dyld.caches.workers", dyldCachesCmd.Flags().Lookup("workers"))
+	viper.BindPFlag("dyld.caches.json", dyldCachesCmd.Flags().Lookup("json"))
+}
+
+// cacheResult is the output of a multi-cache run for a single cache
+type cacheResult struct {
+	Label     string             `json:"label"`
+	Cache     *dyld.Cache        `json:"cache"`
+	UUID      string             `json:"uuid,omitempty"`
+	Platform  string             `json:"platform,omitempty"`
+	OSVersion string             `json:"os_version,omitempty"`
+	NumImages int                `json:"num_images,omitempty"`
+	Images    []dscCmd.Dylib     `json:"images,omitempty"`
+	Symbols   []dyld.SymbolMatch `json:"symbols,omitempty"`
+	Strings   []dscCmd.String    `json:"strings,omitempty"`
+	Errors    []string           `json:"errors,omitempty"`
+}
+
+// dyldCachesCmd represents the caches command
+var dyldCachesCmd = &cobra.Command{
+	Use:   "caches <DSC|FOLDER>...",
+	Short: "Run analyses across every dyld_shared_cache of a build",
+	Long: `Run analyses across every dyld_shared_cache of a build (i.e. arm64e, x86_64 under Rosetta and DriverKit)
+in one run and label the results by cache.`,
+	Example: `  # List the caches in an extracted/mounted filesystem
+  ❯ ipsw dsc caches /tmp/mnt
+  # Look up a dylib in every cache
+  ❯ ipsw dsc caches /tmp/mnt --image libobjc.A.dylib
+  # Regex search the symbols of every cache as JSON
+  ❯ ipsw dsc caches /tmp/mnt --symbol '^_IOConnectCall' --json`,
+	Args: cobra.MinimumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
+	},
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		images := viper.GetStringSlice("dyld.caches.image")
+		workers := viper.GetInt("dyld.caches.workers")
+		asJSON := viper.GetBool("dyld.caches.json")
+
+		var symRE *regexp.Regexp
+		if pattern := viper.GetString("dyld.caches.symbol"); pattern != "" {
+			var err error
+			symRE, err = regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("failed to compile --symbol regex: %v", err)
+			}
+		}
+		strPattern := viper.GetString("dyld.caches.pattern")
+		if strPattern != "" {
+			if _, err := regexp.Compile(strPattern); err != nil {
+				return fmt.Errorf("failed to compile --pattern regex: %v", err)
+			}
+		}
+
+		caches, err := dyld.FindCaches(args...)
+		if err != nil {
+			return err
+		}
+		if len(caches) == 0 {
+			return fmt.Errorf("no dyld_shared_caches found in %v", args)
+		}
+
+		var results []*cacheResult
+		err = dyld.ForEachCache(cmd.Context(), caches, func(ctx context.Context, c *dyld.Cache, f *dyld.File) error {
+			res := &cacheResult{
+				Label:     c.Label(),
+				Cache:     c,
+				UUID:      f.UUID.String(),
+				Platform:  f.Headers[f.UUID].Platform.String(),
+				OSVersion: f.Headers[f.UUID].OsVersion.String(),
+				NumImages: len(f.Images),
+			}
+			results = append(results, res)
+			for _, name := range images {
+				img, err := f.Image(name)
+				if err != nil {
+					res.Errors = append(res.Errors, err.Error())
+					continue
+				}
+				dylib := dscCmd.Dylib{Index: int(img.Index) + 1, Name: img.Name, LoadAddress: img.Info.Address}
+				if m, err := img.GetPartialMacho(); err == nil {
+					if sv := m.SourceVersion(); sv != nil {
+						dylib.Version = sv.Version.String()
+					}
+					dylib.UUID = m.UUID().String()
+					m.Close()
+				}
+				res.Images = append(res.Images, dylib)
+			}
+			var imgErrs dyld.ImageErrors
+			if symRE != nil {
+				res.Symbols, err = dyld.SearchSymbolsContext(ctx, f, symRE, workers)
+				if err != nil && !errors.As(err, &imgErrs) {
+					return err
+				}
+			}
+			if strPattern != "" {
+				var strErrs dyld.ImageErrors
+				res.Strings, err = dscCmd.GetStringsRegexContext(ctx, f, strPattern, workers)
+				if err != nil && !errors.As(err, &strErrs) {
+					return err
+				}
+				imgErrs = append(imgErrs, strErrs...)
+			}
+			for _, ie := range imgErrs {
+				res.Errors = append(res.Errors, ie.Error())
+			}
+			if !asJSON {
+				printCacheResult(res)
+			}
+			return nil
+		})
+		var cacheErrs dyld.CacheErrors
+		if err != nil && !errors.As(err, &cacheErrs) {
+			return err
+		}
+		for _, ce := range cacheErrs {
+			if asJSON {
+				results = append(results, &cacheResult{Label: ce.Cache.Label(), Cache: ce.Cache, Errors: []string{ce.Err.Error()}})
+			} else {
+				log.WithField("cache", ce.Cache.Path).Errorf("failed to process %s cache: %v", ce.Cache.Label(), ce.Err)
+			}
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				return fmt.Errorf("failed to encode results: %v", err)
+			}
+		}
+
+		if len(cacheErrs) > 0 {
+			return cacheErrs
+		}
+		return nil
+	},
+}
+
+func printCacheResult(res *cacheResult) {
+	fmt.Printf("%s %s\n", colorField("["+res.Label+"]"), res.Cache.Path)
+	fmt.Printf("    %s=%s %s=%s %s=%s %s=%d\n",
+		colorField("uuid"), res.UUID,
+		colorField("platform"), res.Platform,
+		colorField("os"), res.OSVersion,
+		colorField("images"), res.NumImages)
+	for _, img := range res.Images {
+		fmt.Printf("    %s: %s\t%s=%s %s=%s\n", colorAddr("%#x", img.LoadAddress), colorImage(img.Name),
+			colorField("version"), img.Version,
+			colorField("uuid"), img.UUID)
+	}
+	for _, sym := range res.Symbols {
+		if sym.Image != "" {
+			fmt.Printf("    %s: %s\t%s=%s %s=%s\n", colorAddr("%#x", sym.Address), symNameColor(sym.Name),
+				colorField("kind"), sym.Kind,
+				colorField("image"), colorImage(sym.Image))
+		} else {
+			fmt.Printf("    %s: %s\t%s=%s\n", colorAddr("%#x", sym.Address), symNameColor(sym.Name), colorField("kind"), sym.Kind)
+		}
+	}
+	for _, str := range res.Strings {
+		fmt.Printf("    %s: %q\t%s=%s\n", colorAddr("%#x", str.Address), str.String, colorField("image"), colorImage(str.Image))
+	}
+	for _, e := range res.Errors {
+		log.WithField("cache", res.Label).Error(e)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dyld
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	cgcmd "github.com/blacktop/ipsw/internal/commands/callgraph"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DyldCmd.AddCommand(CallgraphCmd)
+	CallgraphCmd.Flags().StringArrayP("image", "i", []string{}, "Dylib image(s) to analyze")
+	CallgraphCmd.Flags().BoolP("all", "a", false, "Analyze all images (entire cache)")
+	CallgraphCmd.Flags().Bool("indirect", false, "Add indirect call hints (objc_msgSend selectors and function pointers)")
+	CallgraphCmd.Flags().StringP("format", "f", cgcmd.FormatDOT, fmt.Sprintf("Export format (%s) or fact database format (%s)", strings.Join(cgcmd.Formats, ", "), strings.Join(cgcmd.FactFormats, ", ")))
+	CallgraphCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return append(cgcmd.Formats, cgcmd.FactFormats...), cobra.ShellCompDirectiveDefault
+	})
+	CallgraphCmd.Flags().StringP("output", "o", "", "Output file (defaults to stdout) or facts directory (souffle)")
+	CallgraphCmd.Flags().StringP("root", "r", "", "Only export functions reachable from this symbol/address/image")
+	CallgraphCmd.Flags().IntP("depth", "d", 0, "Max call depth from --root (0 is unlimited)")
+	CallgraphCmd.Flags().String("from", "", "Reachability query source (symbol/address/image)")
+	CallgraphCmd.Flags().String("to", "", "Reachability query target (symbol/address/image)")
+	viper.BindPFlag("dyld.callgraph.image", CallgraphCmd.Flags().Lookup("image"))
+	viper.BindPFlag("dyld.callgraph.all", CallgraphCmd.Flags().Lookup("all"))
+	viper.BindPFlag("dyld.callgraph.indirect", CallgraphCmd.Flags().Lookup("indirect"))
+	viper.BindPFlag("dyld.callgraph.format", CallgraphCmd.Flags().Lookup("format"))
+	viper.BindPFlag("dyld.callgraph.output", CallgraphCmd.Flags().Lookup("output"))
+	viper.BindPFlag("dyld.callgraph.root", CallgraphCmd.Flags().Lookup("root"))
+	viper.BindPFlag("dyld.callgraph.depth", CallgraphCmd.Flags().Lookup("depth"))
+	viper.BindPFlag("dyld.callgraph.from", CallgraphCmd.Flags().Lookup("from"))
+	viper.BindPFlag("dyld.callgraph.to", CallgraphCmd.Flags().Lookup("to"))
+}
+
+// CallgraphCmd represents the callgraph command
+var CallgraphCmd = &cobra.Command{
+	Use:     "callgraph <DSC>",
+	Aliases: []string{"cg"},
+	Short:   "Build dyld_shared_cache image call graphs",
+	Example: heredoc.Doc(`
+		# Export libsystem_kernel's call graph as DOT
+		❯ ipsw dyld callgraph dyld_shared_cache_arm64e -i libsystem_kernel.dylib -o libsystem_kernel.dot
+		# Export the functions reachable from a symbol (3 calls deep) as GraphML
+		❯ ipsw dyld callgraph dyld_shared_cache_arm64e -i Foundation -i CoreFoundation --root _CFRunLoopRun -d 3 -f graphml
+		# Can one dylib reach a function in another?
+		❯ ipsw dyld callgraph dyld_shared_cache_arm64e -i libxpc.dylib -i libsystem_kernel.dylib --from libxpc.dylib --to ___sandbox_ms
+		# Export the entire cache's functions, calls, string refs and imports as a SQLite fact database
+		❯ ipsw dyld callgraph dyld_shared_cache_arm64e -a -f sqlite -o dsc.db
+		❯ sqlite3 dsc.db "SELECT DISTINCT f.name FROM calls c JOIN functions f ON f.addr = c.caller JOIN functions t ON t.addr = c.callee WHERE t.name = '_xpc_connection_send_message'"`),
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		imageNames := viper.GetStringSlice("dyld.callgraph.image")
+		allImages := viper.GetBool("dyld.callgraph.all")
+		conf := &cgcmd.Config{
+			Indirect: viper.GetBool("dyld.callgraph.indirect"),
+			Format:   viper.GetString("dyld.callgraph.format"),
+			Output:   viper.GetString("dyld.callgraph.output"),
+			Root:     viper.GetString("dyld.callgraph.root"),
+			Depth:    viper.GetInt("dyld.callgraph.depth"),
+			From:     viper.GetString("dyld.callgraph.from"),
+			To:       viper.GetString("dyld.callgraph.to"),
+		}
+		// validate flags
+		if len(imageNames) > 0 && allImages {
+			return fmt.Errorf("you can only use --image OR --all (not both)")
+		} else if len(imageNames) == 0 && !allImages {
+			return fmt.Errorf("you must supply an --image OR --all")
+		}
+		if (len(conf.From) > 0) != (len(conf.To) > 0) {
+			return fmt.Errorf("you must supply both --from AND --to for a reachability query")
+		}
+		if !slices.Contains(cgcmd.Formats, conf.Format) && !cgcmd.IsFactFormat(conf.Format) {
+			return fmt.Errorf("invalid --format '%s', must be one of: %s", conf.Format, strings.Join(append(cgcmd.Formats, cgcmd.FactFormats...), ", "))
+		}
+		if cgcmd.IsFactFormat(conf.Format) {
+			if len(conf.Output) == 0 {
+				return fmt.Errorf("--format %s requires an --output", conf.Format)
+			}
+			conf.Strings = true
+		}
+
+		dscPath := filepath.Clean(args[0])
+
+		fileInfo, err := os.Lstat(dscPath)
+		if err != nil {
+			return fmt.Errorf("file %s does not exist", dscPath)
+		}
+		// Check if file is a symlink
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			symlinkPath, err := os.Readlink(dscPath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %v", dscPath, err)
+			}
+			dscPath = filepath.Join(filepath.Dir(filepath.Dir(dscPath)), symlinkPath)
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if !f.IsArm64() {
+			return fmt.Errorf("can only build call graphs of arm64 caches (disassembly required)")
+		}
+
+		var images []*dyld.CacheImage
+		if allImages {
+			images = f.Images
+		} else {
+			for _, name := range imageNames {
+				img, err := f.Image(name)
+				if err != nil {
+					return fmt.Errorf("image not in %s: %v", dscPath, err)
+				}
+				images = append(images, img)
+			}
+		}
+
+		log.Info("Building call graph (use -V for more progress output)")
+		g := callgraph.New()
+		if err := cgcmd.AddImages(g, f, images, conf); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"functions": len(g.Nodes),
+			"calls":     len(g.Edges),
+		}).Debug("Call graph")
+
+		if len(conf.From) > 0 {
+			return cgcmd.Query(g, conf)
+		}
+
+		if cgcmd.IsFactFormat(conf.Format) {
+			return cgcmd.ImageFacts(g, images, conf)
+		}
+
+		return cgcmd.Export(g, conf)
+	},
+}
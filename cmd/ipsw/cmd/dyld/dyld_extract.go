@@ -22,16 +22,12 @@ THE SOFTWARE.
 package dyld
 
 import (
-	"encoding/binary"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
-	"github.com/blacktop/go-macho/pkg/fixupchains"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -41,56 +37,6 @@ import (
 	"github.com/vbauerster/mpb/v8/decor"
 )
 
-func rebaseMachO(dsc *dyld.File, machoPath string) error {
-	f, err := os.OpenFile(machoPath, os.O_RDWR, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to open exported MachO %s: %v", machoPath, err)
-	}
-	defer f.Close()
-
-	mm, err := macho.NewFile(f)
-	if err != nil {
-		return err
-	}
-
-	for _, seg := range mm.Segments() {
-		uuid, mapping, err := dsc.GetMappingForVMAddress(seg.Addr)
-		if err != nil {
-			return err
-		}
-
-		if mapping.SlideInfoOffset == 0 {
-			continue
-		}
-
-		startAddr := seg.Addr - mapping.Address
-		endAddr := ((seg.Addr + seg.Memsz) - mapping.Address) + uint64(dsc.SlideInfo.GetPageSize())
-
-		start := startAddr / uint64(dsc.SlideInfo.GetPageSize())
-		end := endAddr / uint64(dsc.SlideInfo.GetPageSize())
-
-		rebases, err := dsc.GetRebaseInfoForPages(uuid, mapping, start, end)
-		if err != nil {
-			return err
-		}
-
-		for _, rebase := range rebases {
-			off, err := mm.GetOffset(rebase.CacheVMAddress)
-			if err != nil {
-				continue
-			}
-			if _, err := f.Seek(int64(off), io.SeekStart); err != nil {
-				return fmt.Errorf("failed to seek in exported file to offset %#x from the start: %v", off, err)
-			}
-			if err := binary.Write(f, dsc.ByteOrder, rebase.Target); err != nil {
-				return fmt.Errorf("failed to write rebase address %#x: %v", rebase.Target, err)
-			}
-		}
-	}
-
-	return nil
-}
-
 func init() {
 	DyldCmd.AddCommand(dyldExtractCmd)
 	dyldExtractCmd.Flags().BoolP("all", "a", false, "Split ALL dylibs")
@@ -98,6 +44,7 @@ func init() {
 	dyldExtractCmd.Flags().Bool("slide", false, "Apply slide info to extracted dylib(s)")
 	dyldExtractCmd.Flags().Bool("objc", false, "Add ObjC metadata to extracted dylib(s) symtab")
 	dyldExtractCmd.Flags().Bool("stubs", false, "Add stub islands to extracted dylib(s) symtab")
+	dyldExtractCmd.Flags().Bool("rewrite-stubs", false, "Rewrite optimized stubs to load their targets from the GOT")
 	// dyldExtractCmd.Flags().Bool("imports", false, "Add imported dylibs sym into to extracted symtab (will make BIG symtabs)")
 	dyldExtractCmd.Flags().StringP("cache", "c", "", "Path to .a2s addr to sym cache file (speeds up analysis)")
 	dyldExtractCmd.Flags().StringP("output", "o", "", "Directory to extract the dylib(s)")
@@ -107,6 +54,7 @@ func init() {
 	viper.BindPFlag("dyld.extract.slide", dyldExtractCmd.Flags().Lookup("slide"))
 	viper.BindPFlag("dyld.extract.objc", dyldExtractCmd.Flags().Lookup("objc"))
 	viper.BindPFlag("dyld.extract.stubs", dyldExtractCmd.Flags().Lookup("stubs"))
+	viper.BindPFlag("dyld.extract.rewrite-stubs", dyldExtractCmd.Flags().Lookup("rewrite-stubs"))
 	// viper.BindPFlag("dyld.extract.imports", dyldExtractCmd.Flags().Lookup("imports"))
 	viper.BindPFlag("dyld.extract.cache", dyldExtractCmd.Flags().Lookup("cache"))
 	viper.BindPFlag("dyld.extract.output", dyldExtractCmd.Flags().Lookup("output"))
@@ -143,6 +91,7 @@ var dyldExtractCmd = &cobra.Command{
 		slide := viper.GetBool("dyld.extract.slide")
 		addObjc := viper.GetBool("dyld.extract.objc")
 		addStubs := viper.GetBool("dyld.extract.stubs")
+		rewriteStubs := viper.GetBool("dyld.extract.rewrite-stubs")
 		// addImports := viper.GetBool("dyld.extract.imports")
 		output := viper.GetString("dyld.extract.output")
 		cacheFile := viper.GetString("dyld.extract.cache")
@@ -228,153 +177,37 @@ var dyldExtractCmd = &cobra.Command{
 			}
 		}
 
+		conf := &dyld.ExtractConfig{
+			Slide:       slide,
+			Stubs:       rewriteStubs,
+			ObjC:        addObjc,
+			StubIslands: addStubs,
+			FullPath:    dumpALL,
+			Force:       forceExtract,
+		}
+
 		for _, image := range images {
-			m, err := image.GetMacho()
+			fname, err := f.ExtractDylib(image, folder, conf)
 			if err != nil {
-				return err
-			}
-
-			fname := filepath.Join(folder, filepath.Base(image.Name)) // default to NOT full dylib path
-			if dumpALL {
-				fname = filepath.Join(folder, image.Name)
-			}
-
-			if _, err := os.Stat(fname); os.IsNotExist(err) || forceExtract {
-				var dcf *fixupchains.DyldChainedFixups
-				if m.HasFixups() {
-					dcf, err = m.DyldChainedFixups()
-					if err != nil {
-						log.Errorf("failed to parse fixups from in memory MachO for %s: %v", filepath.Base(image.Name), err)
-					}
-				}
-
-				image.ParseLocalSymbols(false)
-
-				syms := image.GetLocalSymbolsAsMachoSymbols()
-
-				if addObjc && m.HasObjC() {
-					log.Info("Adding ObjC symbols")
-					if protos, err := m.GetObjCProtocols(); err == nil {
-						for _, proto := range protos {
-							syms = append(syms, macho.Symbol{
-								Name:  proto.Name,
-								Value: proto.Ptr,
-								Desc:  0xa00,
-							})
-							// fmt.Println(proto.Verbose())
-						}
-					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-						log.Error(err.Error())
-					}
-					if classes, err := m.GetObjCClasses(); err == nil {
-						for _, class := range classes {
-							syms = append(syms, macho.Symbol{
-								Name:  class.Name,
-								Value: class.ClassPtr,
-								Desc:  0xa00,
-							})
-							for _, cmeth := range class.ClassMethods {
-								syms = append(syms, macho.Symbol{
-									Name:  fmt.Sprintf("+[%s %s]", class.Name, cmeth.Name),
-									Value: cmeth.ImpVMAddr,
-									Desc:  0xa00,
-								})
-							}
-							for _, imeth := range class.InstanceMethods {
-								syms = append(syms, macho.Symbol{
-									Name:  fmt.Sprintf("-[%s %s]", class.Name, imeth.Name),
-									Value: imeth.ImpVMAddr,
-									Desc:  0xa00,
-								})
-							}
-							// fmt.Println(class.Verbose())
-						}
-					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-						log.Error(err.Error())
-					}
-					if cats, err := m.GetObjCCategories(); err == nil {
-						for _, cat := range cats {
-							syms = append(syms, macho.Symbol{
-								Name:  cat.Name,
-								Value: cat.VMAddr,
-								Desc:  0xa00,
-							})
-							for _, imeth := range cat.InstanceMethods {
-								syms = append(syms, macho.Symbol{
-									Name:  fmt.Sprintf("-[%s %s]", cat.Name, imeth.Name),
-									Value: imeth.ImpVMAddr,
-									Desc:  0xa00,
-								})
-							}
-							// fmt.Println(cat.Verbose())
-						}
-					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-						log.Error(err.Error())
-					}
-				}
-
-				if addStubs {
-					log.Info("Adding Stub Islands symbols")
-					stubIslands, err := f.GetStubIslands()
-					if err != nil {
-						return err
-					}
-					for addr, sym := range stubIslands {
-						syms = append(syms, macho.Symbol{
-							Name:  sym,
-							Value: addr,
-							Desc:  0xa00,
-						})
+				if errors.Is(err, fs.ErrExist) {
+					if dumpALL {
+						bar.Increment()
+					} else {
+						log.Warnf("Dylib already exists: %s", fname)
 					}
+					continue
 				}
-
-				// if addImports {
-				// 	log.Info("Adding Imported Dylib's symbols")
-				// 	for _, lib := range m.ImportedLibraries() {
-				// 		img, err := f.Image(lib)
-				// 		if err != nil {
-				// 			return err
-				// 		}
-				// 		img.ParseLocalSymbols(false)
-				// 		syms = append(syms, img.GetLocalSymbolsAsMachoSymbols()...)
-				// 		mm, err := img.GetMacho()
-				// 		if err != nil {
-				// 			return err
-				// 		}
-				// 		if mm.Symtab != nil {
-				// 			syms = append(syms, mm.Symtab.Syms...)
-				// 		}
-				// 	}
-				// }
-
-				if err := m.Export(fname, dcf, m.GetBaseAddress(), syms); err != nil {
-					var perr *fs.PathError
-					if errors.As(err, &perr) {
-						return fmt.Errorf("failed to extract dylib %s: %v (try again with the '--output' flag to write dylib to a writable folder)", image.Name, err)
-					}
-					return fmt.Errorf("failed to extract dylib %s: %v", image.Name, err)
-				}
-				if slide {
-					log.Info("Applying DSC slide-info")
-					if err := rebaseMachO(f, fname); err != nil {
-						return fmt.Errorf("failed to rebase dylib via cache slide info: %v", err)
-					}
-				}
-
-				if dumpALL {
-					bar.Increment()
-				} else {
-					log.Infof("Created %s", fname)
+				var perr *fs.PathError
+				if errors.As(err, &perr) {
+					return fmt.Errorf("%v (try again with the '--output' flag to write dylib to a writable folder)", err)
 				}
+				return err
+			}
+			if dumpALL {
+				bar.Increment()
 			} else {
-				if dumpALL {
-					bar.Increment()
-				} else {
-					log.Warnf("Dylib already exists: %s", fname)
-				}
+				log.Infof("Created %s", fname)
 			}
-
-			m.Close()
 		}
 
 		if dumpALL {
@@ -26,6 +26,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
@@ -33,7 +34,6 @@ import (
 	"unicode"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho/pkg/fixupchains"
 	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
 	"github.com/blacktop/ipsw/internal/demangle"
 	swift "github.com/blacktop/ipsw/internal/swift"
@@ -198,45 +198,20 @@ var MachoCmd = &cobra.Command{
 					if len(extractPath) > 0 {
 						folder = extractPath
 					}
-					fname := filepath.Join(folder, filepath.Base(image.Name)) // default to NOT full dylib path
-					if dumpALL {
-						fname = filepath.Join(folder, image.Name)
-					}
-
-					if _, err := os.Stat(fname); os.IsNotExist(err) || forceExtract {
-						var dcf *fixupchains.DyldChainedFixups
-						if m.HasFixups() {
-							dcf, err = m.DyldChainedFixups()
-							if err != nil {
-								return fmt.Errorf("failed to parse fixups from in memory MachO: %v", err)
-							}
-						}
-
-						image.ParseLocalSymbols(false)
-
-						// cc, err := m.GetObjCClasses()
-						// if err != nil {
-						// 	return err
-						// }
-						// for _, c := range cc {
-						// 	fmt.Println(c)
-						// }
-
-						err = m.Export(fname, dcf, m.GetBaseAddress(), image.GetLocalSymbolsAsMachoSymbols())
-						if err != nil {
-							return fmt.Errorf("failed to export entry MachO %s; %v", image.Name, err)
-						}
-
-						if err := rebaseMachO(f, fname); err != nil {
-							return fmt.Errorf("failed to rebase macho via cache slide info: %v", err)
-						}
-						if !dumpALL {
-							log.Infof("Created %s", fname)
+					fname, err := f.ExtractDylib(image, folder, &dyld.ExtractConfig{
+						Slide:    true,
+						FullPath: dumpALL,
+						Force:    forceExtract,
+					})
+					if err != nil {
+						if !errors.Is(err, fs.ErrExist) {
+							return err
 						}
-					} else {
 						if !dumpALL {
 							log.Warnf("dylib already exists: %s", fname)
 						}
+					} else if !dumpALL {
+						log.Infof("Created %s", fname)
 					}
 					continue
 				}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dyld
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DyldCmd.AddCommand(dyldMemmapCmd)
+	dyldMemmapCmd.Flags().StringP("format", "f", "", "Output format (json, unicorn)")
+	dyldMemmapCmd.Flags().StringP("output", "o", "", "File to write the map to")
+	dyldMemmapCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"json", "unicorn"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	viper.BindPFlag("dyld.memmap.format", dyldMemmapCmd.Flags().Lookup("format"))
+	viper.BindPFlag("dyld.memmap.output", dyldMemmapCmd.Flags().Lookup("output"))
+}
+
+// dyldMemmapCmd represents the memmap command
+var dyldMemmapCmd = &cobra.Command{
+	Use:     "memmap <DSC>",
+	Aliases: []string{"mm"},
+	Short:   "Export the shared region memory map for emulators",
+	Example: heredoc.Doc(`
+		# Print how dyld maps the cache (and its subcaches)
+		❯ ipsw dyld memmap dyld_shared_cache_arm64e
+		# Export the map as JSON
+		❯ ipsw dyld memmap dyld_shared_cache_arm64e --format json -o map.json
+		# Generate a python module that maps the cache into a unicorn emulator
+		❯ ipsw dyld memmap dyld_shared_cache_arm64e --format unicorn -o dsc_map.py`),
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		format := viper.GetString("dyld.memmap.format")
+		output := viper.GetString("dyld.memmap.output")
+
+		switch format {
+		case "", "json", "unicorn":
+		default:
+			return fmt.Errorf("invalid --format %s (must be json or unicorn)", format)
+		}
+
+		dscPath := filepath.Clean(args[0])
+
+		fileInfo, err := os.Lstat(dscPath)
+		if err != nil {
+			return fmt.Errorf("file %s does not exist", dscPath)
+		}
+
+		// Check if file is a symlink
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			symlinkPath, err := os.Readlink(dscPath)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read symlink %s", dscPath)
+			}
+			// TODO: this seems like it would break
+			linkParent := filepath.Dir(dscPath)
+			linkRoot := filepath.Dir(linkParent)
+
+			dscPath = filepath.Join(linkRoot, symlinkPath)
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		srm, err := f.GetSharedRegionMap()
+		if err != nil {
+			return fmt.Errorf("failed to get shared region map: %v", err)
+		}
+
+		var w io.Writer = os.Stdout
+		if len(output) > 0 {
+			of, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %v", output, err)
+			}
+			defer of.Close()
+			w = of
+		}
+
+		switch format {
+		case "json":
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(srm); err != nil {
+				return fmt.Errorf("failed to encode shared region map: %v", err)
+			}
+		case "unicorn":
+			if err := srm.WriteUnicorn(w); err != nil {
+				return fmt.Errorf("failed to write unicorn map: %v", err)
+			}
+		default:
+			fmt.Fprintf(w, "Shared Region: %#x-%#x (max slide %#x)\n\n", srm.Base, srm.Base+srm.Size, srm.MaxSlide)
+			tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			fmt.Fprintln(tw, "SEG\tADDR\tSIZE\tFILE\tOFFSET\tPROT\tSLIDE INFO\tFLAGS")
+			for _, m := range srm.Mappings {
+				var slide string
+				if m.SlideInfoSize > 0 {
+					slide = fmt.Sprintf("v%d %#x", m.SlideVersion, m.SlideInfoOffset)
+				}
+				fmt.Fprintf(tw, "%s\t%#x-%#x\t%#x\t%s\t%#x\t%s/%s\t%s\t%s\n",
+					m.Name, m.Address, m.Address+m.Size, m.Size, m.File, m.FileOffset, m.InitProt, m.MaxProt, slide, m.Flags)
+			}
+			tw.Flush()
+		}
+
+		if len(output) > 0 {
+			log.Infof("Created %s", output)
+		}
+
+		return nil
+	},
+}
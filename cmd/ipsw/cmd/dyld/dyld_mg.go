@@ -22,50 +22,27 @@ THE SOFTWARE.
 package dyld
 
 import (
-	"crypto/md5"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"slices"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/mobilegestalt"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var mgLookup map[string]MG
+var mgLookup mobilegestalt.DB
 
 var chars = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-")
 
-var skip = []string{
-	"AMFDRCreateWithOptions",
-	"AMFDRDecodeCertificate",
-	"AMFDRDecodeTrustObject",
-	"AmountRestoreAvailable",
-	"AppleBiometricServices",
-	"BBUpdaterExtremeCreate",
-	"BluetoothLE2Capability",
-	"CoverglassSerialNumber",
-	"DeviceSupportsSWProRes",
-	"FloatingLiveAppOverlay",
-	"IOAccessoryManagerType",
-	"IOPlatformExpertDevice",
-	"IOPlatformSerialNumber",
-	"RegionalBehaviorNoVOIP",
-	"RegionalBehaviorNoWiFi",
-	"SpeakerCalibrationMiGa",
-	"SpeakerCalibrationSpGa",
-	"SpeakerCalibrationSpTS",
-}
-
 func generateCombinations(prefix string, length int, c chan string) {
 	if length == 0 {
 		c <- prefix
@@ -76,11 +53,6 @@ func generateCombinations(prefix string, length int, c chan string) {
 	}
 }
 
-func obfuscateKey(key string) string {
-	md5Hash := md5.Sum([]byte("MGCopyAnswer" + key))
-	return base64.StdEncoding.EncodeToString(md5Hash[:])[:22]
-}
-
 func bruteForce(targets []string, length int) bool {
 	found := false
 	attempts := make(chan string)
@@ -89,13 +61,13 @@ func bruteForce(targets []string, length int) bool {
 		generateCombinations("", length, attempts)
 	}()
 	for attempt := range attempts {
-		if slices.Contains(targets, obfuscateKey(attempt)) {
+		if slices.Contains(targets, mobilegestalt.Obfuscate(attempt)) {
 			found = true
 			utils.Indent(log.WithFields(log.Fields{
-				"obfuscated": obfuscateKey(attempt),
+				"obfuscated": mobilegestalt.Obfuscate(attempt),
 				"key":        attempt,
 			}).Info, 2)("Brute Forced")
-			mgLookup[obfuscateKey(attempt)] = MG{
+			mgLookup[mobilegestalt.Obfuscate(attempt)] = mobilegestalt.Key{
 				Key: attempt,
 			}
 		}
@@ -103,11 +75,6 @@ func bruteForce(targets []string, length int) bool {
 	return found
 }
 
-type MG struct {
-	Key         string `json:"key"`
-	Description string `json:"desc"`
-}
-
 func init() {
 	DyldCmd.AddCommand(dyldMgCmd)
 
@@ -116,9 +83,13 @@ func init() {
 
 // dyldMgCmd represents the mg command
 var dyldMgCmd = &cobra.Command{
-	Use:   "mg <DSC> <MG_JSON>",
+	Use:   "mg <DSC> [MG_JSON]",
 	Short: "List MobileGestalt Keys",
-	Args:  cobra.ExactArgs(2),
+	Long: `List the obfuscated MobileGestalt keys of the DSC's libMobileGestalt.dylib.
+
+NEW (and --length brute forced) keys are added to the MG_JSON key DB file (after confirming) or,
+if no MG_JSON is given, the updated DB is printed to stdout.`,
+	Args: cobra.RangeArgs(1, 2),
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		if len(args) == 1 {
 			return []string{"json"}, cobra.ShellCompDirectiveFilterFileExt
@@ -172,12 +143,14 @@ var dyldMgCmd = &cobra.Command{
 			return err
 		}
 
-		mgData, err := os.ReadFile(filepath.Clean(args[1]))
-		if err != nil {
-			return err
+		var mgJSON string // the updated DB is printed to stdout unless an MG_JSON file to update is given
+		if len(args) > 1 {
+			mgJSON = filepath.Clean(args[1])
+			mgLookup, err = mobilegestalt.LoadDB(mgJSON)
+		} else {
+			mgLookup, err = mobilegestalt.GetDB()
 		}
-
-		if err := json.Unmarshal(mgData, &mgLookup); err != nil {
+		if err != nil {
 			return err
 		}
 
@@ -200,35 +173,19 @@ var dyldMgCmd = &cobra.Command{
 		// 	}
 		// }
 
-		count := 0
-		newMGs := 0
-
-		re := regexp.MustCompile(`^[a-zA-Z0-9+/]{22}$`)
-		if cfstrs, err := m.GetCFStrings(); err == nil {
-			for _, cfstr := range cfstrs {
-				if re.MatchString(cfstr.Name) {
-					if !slices.Contains(skip, cfstr.Name) {
-						if _, ok := mgLookup[cfstr.Name]; !ok {
-							log.Infof("Adding %s", cfstr.Name)
-							mgLookup[cfstr.Name] = MG{} // add empty MG entry for NEW obfuscated key
-							newMGs++
-						}
-						count++
-					}
-				}
-			}
+		added, err := mgLookup.Update(m)
+		if err != nil {
+			return err
 		}
+		for _, o := range added {
+			log.Infof("Adding %s", o)
+		}
+		newMGs := len(added)
 
-		log.Infof("Found %d obfuscated MG Keys (%d NEW)", count, newMGs)
+		log.Infof("Found %d NEW obfuscated MG Keys", newMGs)
 
-		total := 0
-		var mysteries []string
-		for o, mg := range mgLookup {
-			if mg.Key == "" {
-				mysteries = append(mysteries, o)
-			}
-			total++
-		}
+		total := len(mgLookup)
+		mysteries := mgLookup.Unknown()
 
 		utils.Indent(log.WithFields(log.Fields{
 			"total":    total,
@@ -236,6 +193,22 @@ var dyldMgCmd = &cobra.Command{
 			"complete": fmt.Sprintf("%.2f%%", 100*(float64(total-len(mysteries))/float64(total))),
 		}).Info, 2)("MobileGestalt DB")
 
+		found := false
+		if length > 0 {
+			log.WithField("length", length).Info("Brute forcing MG keys")
+			if found = bruteForce(mysteries, length); !found {
+				utils.Indent(log.Warn, 2)("No MG keys found")
+			}
+		}
+
+		if len(mgJSON) == 0 {
+			if newMGs > 0 || found {
+				log.Info("Printing the updated MG JSON (pass MG_JSON to update a file instead)")
+				return json.NewEncoder(os.Stdout).Encode(mgLookup)
+			}
+			return nil
+		}
+
 		if newMGs > 0 {
 			cont := false
 			prompt := &survey.Confirm{
@@ -244,38 +217,25 @@ var dyldMgCmd = &cobra.Command{
 			survey.AskOne(prompt, &cont)
 
 			if cont {
-				out, err := json.Marshal(mgLookup)
-				if err != nil {
-					return err
-				}
-				log.Infof("Updating MG JSON file %s with %d NEW obfuscated MG Keys", args[1], newMGs)
-				if err := os.WriteFile(filepath.Clean(args[1]), out, 0644); err != nil {
+				log.Infof("Updating MG JSON file %s with %d NEW obfuscated MG Keys", mgJSON, newMGs)
+				if err := mgLookup.Save(mgJSON); err != nil {
 					return err
 				}
 			}
 		}
 
-		if length > 0 {
-			log.WithField("length", length).Info("Brute forcing MG keys")
-			if bruteForce(mysteries, length) {
-				cont := false
-				prompt := &survey.Confirm{
-					Message: fmt.Sprintf("You are about to update the MG JSON with brute forced keys (you can test with 'ipsw idev diag mg --keys'). Continue?"),
-				}
-				survey.AskOne(prompt, &cont)
-
-				if cont {
-					out, err := json.Marshal(mgLookup)
-					if err != nil {
-						return err
-					}
-					log.Infof("Updating MG JSON file %s with NEW brute forced keys", args[1])
-					if err := os.WriteFile(filepath.Clean(args[1]), out, 0644); err != nil {
-						return err
-					}
+		if found {
+			cont := false
+			prompt := &survey.Confirm{
+				Message: fmt.Sprintf("You are about to update the MG JSON with brute forced keys (you can test with 'ipsw idev diag mg --keys'). Continue?"),
+			}
+			survey.AskOne(prompt, &cont)
+
+			if cont {
+				log.Infof("Updating MG JSON file %s with NEW brute forced keys", mgJSON)
+				if err := mgLookup.Save(mgJSON); err != nil {
+					return err
 				}
-			} else {
-				utils.Indent(log.Warn, 2)("No MG keys found")
 			}
 		}
 
@@ -27,6 +27,9 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/spill"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -42,6 +45,49 @@ func init() {
 	ObjcCmd.Flags().BoolP("imp-cache", "i", false, "Print the imp-caches")
 }
 
+// objcIndex returns the (cached) classes, selectors or protocols objc hash table index of the cache
+func objcIndex(f *dyld.File, kind string) (*spill.Map[dyld.ObjCHashObject], error) {
+	return cache.SpillMap(cache.Default(), f.UUID.String(), "objc_"+kind, func() (*spill.Map[dyld.ObjCHashObject], error) {
+		switch kind {
+		case "classes":
+			return f.GetAllObjCClasses(false)
+		case "selectors":
+			return f.GetAllObjCSelectors(false)
+		case "protocols":
+			return f.GetAllObjCProtocols(false)
+		default:
+			return nil, fmt.Errorf("invalid objc index kind: %s", kind)
+		}
+	})
+}
+
+// printObjCHash prints the objects of one of the cache's objc hash tables ordered by address (or by name for --stable)
+func printObjCHash(objs *spill.Map[dyld.ObjCHashObject]) error {
+	type entry struct {
+		addr uint64
+		obj  dyld.ObjCHashObject
+	}
+	entries := make([]entry, 0, objs.Len())
+	if err := objs.Range(func(addr uint64, obj dyld.ObjCHashObject) error {
+		entries = append(entries, entry{addr, obj})
+		return nil
+	}); err != nil {
+		return err
+	}
+	stable.SortBy(entries, func(e entry) uint64 { return e.addr })
+	if viper.GetBool("stable") {
+		stable.SortBy(entries, func(e entry) string { return e.obj.Name })
+	}
+	for _, e := range entries {
+		if len(e.obj.Dylib) > 0 {
+			fmt.Printf("%s: %s\t%s\n", colorAddr("%#09x", e.addr), e.obj.Name, colorImage(e.obj.Dylib))
+		} else {
+			fmt.Printf("%s: %s\n", colorAddr("%#09x", e.addr), e.obj.Name)
+		}
+	}
+	return nil
+}
+
 // ObjcCmd represents the objc command
 var ObjcCmd = &cobra.Command{
 	Use:   "objc <DSC>",
@@ -90,19 +136,37 @@ var ObjcCmd = &cobra.Command{
 		defer f.Close()
 
 		if printClasses {
-			if _, err := f.GetAllObjCClasses(true); err != nil {
+			classes, err := objcIndex(f, "classes")
+			if err != nil {
+				return err
+			}
+			err = printObjCHash(classes)
+			classes.Close()
+			if err != nil {
 				return err
 			}
 		}
 
 		if printSelectors {
-			if _, err := f.GetAllObjCSelectors(true); err != nil {
+			sels, err := objcIndex(f, "selectors")
+			if err != nil {
+				return err
+			}
+			err = printObjCHash(sels)
+			sels.Close()
+			if err != nil {
 				return err
 			}
 		}
 
 		if printProtocols {
-			if _, err := f.GetAllObjCProtocols(true); err != nil {
+			protos, err := objcIndex(f, "protocols")
+			if err != nil {
+				return err
+			}
+			err = printObjCHash(protos)
+			protos.Close()
+			if err != nil {
 				return err
 			}
 		}
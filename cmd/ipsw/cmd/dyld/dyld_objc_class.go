@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -41,10 +42,10 @@ func init() {
 
 // objcClassCmd represents the class command
 var objcClassCmd = &cobra.Command{
-	Use:     "class <DSC>",
+	Use:     "class <DSC> [CLASS]",
 	Aliases: []string{"c"},
 	Short:   "Get ObjC optimization class info",
-	Args:    cobra.ExactArgs(1),
+	Args:    cobra.RangeArgs(1, 2),
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
 	},
@@ -85,12 +86,16 @@ var objcClassCmd = &cobra.Command{
 		defer f.Close()
 
 		if len(args) > 1 {
-			ptrs, err := f.GetClassAddresses(args[1])
+			classes, err := f.LookupObjCClass(args[1])
 			if err != nil {
-				return fmt.Errorf("failed to get class addresses: %v", err)
+				return fmt.Errorf("failed to lookup class: %v", err)
 			}
-			for _, ptr := range ptrs {
-				fmt.Printf("%s: %s=%s\n", colorAddr("%#09x", ptr), colorClassField("class"), args[1])
+			for _, class := range classes {
+				fmt.Printf("%s: %s=%s", colorAddr("%#09x", class.Addr), colorClassField("class"), class.Name)
+				if len(class.Image) > 0 {
+					fmt.Printf("\t%s=%s", colorClassField("dylib"), filepath.Base(class.Image))
+				}
+				fmt.Println()
 			}
 		} else {
 			if len(imageName) > 0 {
@@ -106,13 +111,20 @@ var objcClassCmd = &cobra.Command{
 				if err != nil {
 					return fmt.Errorf("failed to get objc class references for image %s: %v", imageName, err)
 				}
-				for _, class := range classes {
-					fmt.Printf("%s: %s\n", colorAddr("%#09x", class.ClassPtr), class.Name)
+				ptrs := stable.Keys(classes)
+				if viper.GetBool("stable") {
+					stable.SortBy(ptrs, func(ptr uint64) string { return classes[ptr].Name })
+				}
+				for _, ptr := range ptrs {
+					fmt.Printf("%s: %s\n", colorAddr("%#09x", classes[ptr].ClassPtr), classes[ptr].Name)
 				}
 			} else {
-				if _, err := f.GetAllObjCClasses(true); err != nil {
+				classes, err := objcIndex(f, "classes")
+				if err != nil {
 					return fmt.Errorf("failed to get all objc classes: %s", err)
 				}
+				defer classes.Close()
+				return printObjCHash(classes)
 			}
 		}
 
@@ -30,6 +30,8 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types/objc"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -44,10 +46,10 @@ func init() {
 
 // objcProtoCmd represents the proto command
 var objcProtoCmd = &cobra.Command{
-	Use:     "proto <DSC>",
+	Use:     "proto <DSC> [PROTOCOL]",
 	Aliases: []string{"p"},
 	Short:   "Get ObjC optimization proto info",
-	Args:    cobra.ExactArgs(1),
+	Args:    cobra.RangeArgs(1, 2),
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
 	},
@@ -88,18 +90,32 @@ var objcProtoCmd = &cobra.Command{
 		defer f.Close()
 
 		if len(args) > 1 {
-			ptrs, err := f.GetProtocolAddresses(args[1])
+			protos, err := f.LookupObjCProtocol(args[1])
 			if err != nil {
-				return fmt.Errorf("failed to get protocol addresses: %v", err)
+				return fmt.Errorf("failed to lookup protocol: %v", err)
 			}
-			for _, ptr := range ptrs {
-				fmt.Printf("%s: %s=%s\n", colorAddr("%#09x", ptr), colorClassField("protocol"), args[1])
+			for _, proto := range protos {
+				ptr := proto.Addr
+				fmt.Printf("%s: %s=%s", colorAddr("%#09x", ptr), colorClassField("protocol"), proto.Name)
+				if len(proto.Image) > 0 {
+					fmt.Printf("\t%s=%s", colorClassField("dylib"), filepath.Base(proto.Image))
+				}
+				fmt.Println()
 				w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
-				classes, err := f.GetAllObjCClasses(false)
+				classes, err := objcIndex(f, "classes")
+				if err != nil {
+					return fmt.Errorf("failed to get objc classes: %v", err)
+				}
+				defer classes.Close()
+				addrs, err := classes.Keys()
 				if err != nil {
 					return fmt.Errorf("failed to get objc classes: %v", err)
 				}
-				for addr, class := range classes {
+				for _, addr := range addrs {
+					class, _, err := classes.Get(addr)
+					if err != nil {
+						return fmt.Errorf("failed to get objc class: %v", err)
+					}
 					protAddrs, err := f.GetObjCClassProtocolsAddrs(addr)
 					if err != nil {
 						return fmt.Errorf("failed to get objc class protocols: %v", err)
@@ -125,6 +141,9 @@ var objcProtoCmd = &cobra.Command{
 				}
 				w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 				if protos, err := m.GetObjCProtocols(); err == nil {
+					if viper.GetBool("stable") {
+						stable.SortBy(protos, func(p objc.Protocol) string { return p.Name })
+					}
 					for _, proto := range protos {
 						foundClass := false
 						if classes, err := m.GetObjCClasses(); err == nil {
@@ -149,9 +168,12 @@ var objcProtoCmd = &cobra.Command{
 					log.Error(err.Error())
 				}
 			} else {
-				if _, err := f.GetAllObjCProtocols(true); err != nil {
+				protos, err := objcIndex(f, "protocols")
+				if err != nil {
 					return fmt.Errorf("failed to get all objc protocols: %v", err)
 				}
+				defer protos.Close()
+				return printObjCHash(protos)
 			}
 		}
 
@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -41,10 +42,10 @@ func init() {
 
 // objcSelCmd represents the sel command
 var objcSelCmd = &cobra.Command{
-	Use:     "sel <DSC>",
+	Use:     "sel <DSC> [SEL]",
 	Aliases: []string{"s"},
 	Short:   "Get ObjC optimization selector info",
-	Args:    cobra.ExactArgs(1),
+	Args:    cobra.RangeArgs(1, 2),
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
 	},
@@ -85,12 +86,12 @@ var objcSelCmd = &cobra.Command{
 		defer f.Close()
 
 		if len(args) > 1 {
-			ptrs, err := f.GetSelectorAddresses(args[1])
+			sels, err := f.LookupObjCSelector(args[1])
 			if err != nil {
-				return fmt.Errorf("failed to get selector addresses: %v", err)
+				return fmt.Errorf("failed to lookup selector: %v", err)
 			}
-			for _, ptr := range ptrs {
-				fmt.Printf("%s: %s=%s\n", colorAddr("%#09x", ptr), colorClassField("sel"), args[1])
+			for _, sel := range sels {
+				fmt.Printf("%s: %s=%s\n", colorAddr("%#09x", sel.Addr), colorClassField("sel"), sel.Name)
 			}
 		} else {
 			if len(imageName) > 0 {
@@ -106,13 +107,20 @@ var objcSelCmd = &cobra.Command{
 				if err != nil {
 					return fmt.Errorf("failed to get objc selectors references for image %s: %v", imageName, err)
 				}
-				for _, sel := range sels {
-					fmt.Printf("%s: %s\n", colorAddr("%#09x", sel.VMAddr), sel.Name)
+				ptrs := stable.Keys(sels)
+				if viper.GetBool("stable") {
+					stable.SortBy(ptrs, func(ptr uint64) string { return sels[ptr].Name })
+				}
+				for _, ptr := range ptrs {
+					fmt.Printf("%s: %s\n", colorAddr("%#09x", sels[ptr].VMAddr), sels[ptr].Name)
 				}
 			} else {
-				if _, err := f.GetAllObjCSelectors(true); err != nil {
+				sels, err := objcIndex(f, "selectors")
+				if err != nil {
 					return fmt.Errorf("failed to get all objc selectors: %v", err)
 				}
+				defer sels.Close()
+				return printObjCHash(sels)
 			}
 		}
 
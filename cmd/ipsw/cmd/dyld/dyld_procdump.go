@@ -0,0 +1,233 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dyld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DyldCmd.AddCommand(ProcDumpCmd)
+	ProcDumpCmd.Flags().StringP("base", "b", "", "Address a raw memory dump was dumped from")
+	ProcDumpCmd.Flags().StringP("slide", "s", "", "dyld_shared_cache slide (default: calculated from the cache header in the dump)")
+	ProcDumpCmd.Flags().BoolP("pointers", "p", false, "Symbolicate pointers to dylib __TEXT found in non-cache regions")
+	ProcDumpCmd.Flags().StringP("region", "r", "", "Only scan region containing address for pointers")
+	ProcDumpCmd.Flags().BoolP("demangle", "d", false, "Demangle symbol names")
+	ProcDumpCmd.Flags().String("cache", "", "Path to .a2s addr to sym cache file (speeds up analysis)")
+	ProcDumpCmd.Flags().Bool("json", false, "Output as JSON")
+
+	viper.BindPFlag("dyld.procdump.base", ProcDumpCmd.Flags().Lookup("base"))
+	viper.BindPFlag("dyld.procdump.slide", ProcDumpCmd.Flags().Lookup("slide"))
+	viper.BindPFlag("dyld.procdump.pointers", ProcDumpCmd.Flags().Lookup("pointers"))
+	viper.BindPFlag("dyld.procdump.region", ProcDumpCmd.Flags().Lookup("region"))
+	viper.BindPFlag("dyld.procdump.demangle", ProcDumpCmd.Flags().Lookup("demangle"))
+	viper.BindPFlag("dyld.procdump.cache", ProcDumpCmd.Flags().Lookup("cache"))
+	viper.BindPFlag("dyld.procdump.json", ProcDumpCmd.Flags().Lookup("json"))
+}
+
+// ProcDumpCmd represents the procdump command
+var ProcDumpCmd = &cobra.Command{
+	Use:     "procdump <DSC> <DUMP>",
+	Aliases: []string{"pd"},
+	Short:   "Match a process memory dump to its dyld_shared_cache and symbolicate it",
+	Example: heredoc.Doc(`
+		# Match a MH_CORE process dump (lldb 'process save-core') to the DSC it was running
+		❯ ipsw dyld procdump dyld_shared_cache_arm64e MobileSafari.core
+		# Symbolicate the code pointers in a raw memory dump (lldb 'memory read --binary')
+		❯ ipsw dyld procdump dyld_shared_cache_arm64e stack.bin --base 0x16f5e0000 --slide 0x8f4c000 --pointers`),
+	Args: cobra.ExactArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		var base, slide, regionAddr uint64
+		var err error
+		if s := viper.GetString("dyld.procdump.base"); len(s) > 0 {
+			if base, err = utils.ConvertStrToInt(s); err != nil {
+				return fmt.Errorf("invalid --base: %v", err)
+			}
+		}
+		if s := viper.GetString("dyld.procdump.slide"); len(s) > 0 {
+			if slide, err = utils.ConvertStrToInt(s); err != nil {
+				return fmt.Errorf("invalid --slide: %v", err)
+			}
+		}
+		if s := viper.GetString("dyld.procdump.region"); len(s) > 0 {
+			if regionAddr, err = utils.ConvertStrToInt(s); err != nil {
+				return fmt.Errorf("invalid --region: %v", err)
+			}
+		}
+		doDemangle := viper.GetBool("dyld.procdump.demangle")
+		cacheFile := viper.GetString("dyld.procdump.cache")
+
+		dscPath := filepath.Clean(args[0])
+
+		fileInfo, err := os.Lstat(dscPath)
+		if err != nil {
+			return fmt.Errorf("file %s does not exist", dscPath)
+		}
+
+		// Check if file is a symlink
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			symlinkPath, err := os.Readlink(dscPath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s", dscPath)
+			}
+			// TODO: this seems like it would break
+			linkParent := filepath.Dir(dscPath)
+			linkRoot := filepath.Dir(linkParent)
+
+			dscPath = filepath.Join(linkRoot, symlinkPath)
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		pd, err := dyld.OpenProcessDump(filepath.Clean(args[1]), base)
+		if err != nil {
+			return fmt.Errorf("failed to open process dump: %v", err)
+		}
+		defer pd.Close()
+
+		da, err := f.MatchProcessDump(pd, slide)
+		if err != nil {
+			if errors.Is(err, dyld.ErrNoCacheInDump) {
+				return fmt.Errorf("%v: supply the cache slide with --slide (i.e. from the dumped process' 'image list')", err)
+			}
+			return err
+		}
+
+		var ptrs []dyld.DumpPointer
+		if viper.GetBool("dyld.procdump.pointers") {
+			if len(cacheFile) == 0 {
+				cacheFile = dscPath + ".a2s"
+			}
+			if err := f.OpenOrCreateA2SCache(cacheFile); err != nil {
+				return err
+			}
+			for _, r := range pd.Regions {
+				if regionAddr > 0 && !r.Contains(regionAddr) {
+					continue
+				}
+				if _, _, err := f.GetOffset(da.Unslide(r.Address)); regionAddr == 0 && err == nil {
+					continue // skip the cache's own mappings
+				}
+				log.WithField("region", fmt.Sprintf("%#x-%#x", r.Address, r.Address+r.Size)).Debug("Scanning for pointers")
+				rptrs, err := da.Pointers(r)
+				if err != nil {
+					return err
+				}
+				ptrs = append(ptrs, rptrs...)
+			}
+			if doDemangle {
+				for i := range ptrs {
+					ptrs[i].Symbol = demangle.Do(ptrs[i].Symbol, false, false)
+				}
+			}
+		}
+
+		if viper.GetBool("dyld.procdump.json") {
+			dat, err := json.Marshal(struct {
+				*dyld.DumpAnalysis
+				Pointers []dyld.DumpPointer `json:"pointers,omitempty"`
+			}{da, ptrs})
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		fmt.Printf("UUID:  %s\n", da.UUID)
+		fmt.Printf("Slide: %#x\n", da.Slide)
+		if len(da.Headers) > 0 {
+			fmt.Println("\nCache Headers:")
+			for _, hdr := range da.Headers {
+				fmt.Printf("  %#x: %s\n", hdr.Address, hdr.UUID)
+			}
+		}
+		if len(da.Regions) > 0 {
+			fmt.Println("\nCache Mappings:")
+			var names []string
+			for name := range da.Regions {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				var rs []string
+				for _, r := range da.Regions[name] {
+					rs = append(rs, fmt.Sprintf("%#x-%#x", r.Address, r.Address+r.Size))
+				}
+				fmt.Printf("  %-12s %s\n", name, strings.Join(rs, ", "))
+			}
+		}
+		if len(da.Images) > 0 {
+			fmt.Printf("\nImages (%d):\n", len(da.Images))
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			for _, img := range da.Images {
+				fmt.Fprintf(w, "  %#x-%#x\t%s\n", img.Address, img.Address+img.Size, img.Name)
+			}
+			w.Flush()
+		}
+		if len(ptrs) > 0 {
+			fmt.Printf("\nPointers (%d):\n", len(ptrs))
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			for _, ptr := range ptrs {
+				fmt.Fprintf(w, "  %#x:\t%#x\t%s\t%s\n", ptr.Address, ptr.Value, filepath.Base(ptr.Image), ptr.Symbol)
+			}
+			w.Flush()
+		}
+
+		return nil
+	},
+}
@@ -30,6 +30,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/complete"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -46,6 +47,7 @@ func init() {
 	viper.BindPFlag("dyld.search.load-command", dyldSearchCmd.Flags().Lookup("load-command"))
 	viper.BindPFlag("dyld.search.import", dyldSearchCmd.Flags().Lookup("import"))
 	viper.BindPFlag("dyld.search.section", dyldSearchCmd.Flags().Lookup("section"))
+	dyldSearchCmd.RegisterFlagCompletionFunc("uuid", complete.UUIDs)
 	viper.BindPFlag("dyld.search.uuid", dyldSearchCmd.Flags().Lookup("uuid"))
 }
 
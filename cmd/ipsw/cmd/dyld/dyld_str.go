@@ -41,7 +41,9 @@ import (
 func init() {
 	DyldCmd.AddCommand(StrSearchCmd)
 	StrSearchCmd.Flags().StringP("pattern", "p", "", "Regex match strings (SLOW)")
+	StrSearchCmd.Flags().IntP("workers", "j", 0, "Number of images to search in parallel with --pattern (default is NumCPU)")
 	viper.BindPFlag("dyld.str.pattern", StrSearchCmd.Flags().Lookup("pattern"))
+	viper.BindPFlag("dyld.str.workers", StrSearchCmd.Flags().Lookup("workers"))
 }
 
 // StrSearchCmd represents the str command
@@ -99,11 +101,12 @@ var StrSearchCmd = &cobra.Command{
 		defer f.Close()
 
 		var strs []dscCmd.String
+		var imgErrs dyld.ImageErrors
 
 		if pattern != "" {
 			log.Info("Searching for strings via REGEX pattern...")
-			strs, err = dscCmd.GetStringsRegex(f, pattern)
-			if err != nil {
+			strs, err = dscCmd.GetStringsRegexContext(cmd.Context(), f, pattern, viper.GetInt("dyld.str.workers"))
+			if err != nil && !errors.As(err, &imgErrs) {
 				return err
 			}
 		} else {
@@ -163,6 +166,13 @@ var StrSearchCmd = &cobra.Command{
 			fmt.Println(out.String())
 		}
 
+		if len(imgErrs) > 0 {
+			for _, ie := range imgErrs {
+				log.WithField("image", ie.Image).Errorf("failed to search image: %v", ie.Err)
+			}
+			return imgErrs
+		}
+
 		return nil
 	},
 }
@@ -0,0 +1,146 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dyld
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	cgcmd "github.com/blacktop/ipsw/internal/commands/callgraph"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	DyldCmd.AddCommand(StrIndexCmd)
+	StrIndexCmd.Flags().StringArrayP("image", "i", []string{}, "Dylib image(s) to index")
+	StrIndexCmd.Flags().BoolP("all", "a", false, "Index all images (entire cache)")
+	StrIndexCmd.Flags().StringP("search", "s", "", "Only index strings containing this substring")
+	StrIndexCmd.Flags().StringP("format", "f", "", fmt.Sprintf("Export format (%s)", strings.Join(cgcmd.StringFormats, ", ")))
+	StrIndexCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return cgcmd.StringFormats, cobra.ShellCompDirectiveDefault
+	})
+	StrIndexCmd.Flags().StringP("output", "o", "", "Output file (defaults to stdout)")
+	viper.BindPFlag("dyld.strindex.image", StrIndexCmd.Flags().Lookup("image"))
+	viper.BindPFlag("dyld.strindex.all", StrIndexCmd.Flags().Lookup("all"))
+	viper.BindPFlag("dyld.strindex.search", StrIndexCmd.Flags().Lookup("search"))
+	viper.BindPFlag("dyld.strindex.format", StrIndexCmd.Flags().Lookup("format"))
+	viper.BindPFlag("dyld.strindex.output", StrIndexCmd.Flags().Lookup("output"))
+}
+
+// StrIndexCmd represents the strindex command
+var StrIndexCmd = &cobra.Command{
+	Use:     "strindex <DSC>",
+	Aliases: []string{"si"},
+	Short:   "Index the C strings of dyld_shared_cache images and the functions that reference them",
+	Example: heredoc.Doc(`
+		# Which libxpc functions use a string?
+		❯ ipsw dyld strindex dyld_shared_cache_arm64e -i libxpc.dylib -s "API MISUSE"
+		# Index a dylib's strings as JSON
+		❯ ipsw dyld strindex dyld_shared_cache_arm64e -i Security -f json -o Security.strings.json
+		# Index the entire cache as SQLite
+		❯ ipsw dyld strindex dyld_shared_cache_arm64e -a -f sqlite -o dsc_strings.db
+		❯ sqlite3 dsc_strings.db "SELECT image, name FROM string_xrefs WHERE value LIKE '%entitlement%'"`),
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return getDSCs(toComplete), cobra.ShellCompDirectiveDefault
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		imageNames := viper.GetStringSlice("dyld.strindex.image")
+		allImages := viper.GetBool("dyld.strindex.all")
+		conf := &cgcmd.StringConfig{
+			Search: viper.GetString("dyld.strindex.search"),
+			Format: viper.GetString("dyld.strindex.format"),
+			Output: viper.GetString("dyld.strindex.output"),
+		}
+		// validate flags
+		if len(imageNames) > 0 && allImages {
+			return fmt.Errorf("you can only use --image OR --all (not both)")
+		} else if len(imageNames) == 0 && !allImages {
+			return fmt.Errorf("you must supply an --image OR --all")
+		}
+
+		dscPath := filepath.Clean(args[0])
+
+		fileInfo, err := os.Lstat(dscPath)
+		if err != nil {
+			return fmt.Errorf("file %s does not exist", dscPath)
+		}
+		// Check if file is a symlink
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			symlinkPath, err := os.Readlink(dscPath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %v", dscPath, err)
+			}
+			dscPath = filepath.Join(filepath.Dir(filepath.Dir(dscPath)), symlinkPath)
+		}
+
+		f, err := dyld.Open(dscPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if !f.IsArm64() {
+			return fmt.Errorf("can only index the strings of arm64 caches (disassembly required)")
+		}
+
+		var images []*dyld.CacheImage
+		if allImages {
+			images = f.Images
+		} else {
+			for _, name := range imageNames {
+				img, err := f.Image(name)
+				if err != nil {
+					return fmt.Errorf("image not in %s: %v", dscPath, err)
+				}
+				images = append(images, img)
+			}
+		}
+
+		log.Info("Indexing strings (use -V for more progress output)")
+		g := callgraph.New()
+		if err := cgcmd.AddImages(g, f, images, &cgcmd.Config{Strings: true}); err != nil {
+			return err
+		}
+
+		return cgcmd.ImageStrings(g, images, conf)
+	},
+}
@@ -27,9 +27,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/apex/log"
 	dscCmd "github.com/blacktop/ipsw/internal/commands/dsc"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/fatih/color"
@@ -205,8 +207,10 @@ var SymAddrCmd = &cobra.Command{
 				return fmt.Errorf("image not in %s: %v", dscPath, err)
 			}
 
+			dump := !viper.GetBool("stable") // --stable collects the symbols and prints them ordered by name
+
 			log.Warn("parsing private symbols for image...")
-			if err := i.ParseLocalSymbols(true); err != nil {
+			if err := i.ParseLocalSymbols(dump); err != nil {
 				if errors.Is(err, dyld.ErrNoLocals) {
 					utils.Indent(log.Warn, 2)(err.Error())
 				} else if err != nil {
@@ -215,10 +219,28 @@ var SymAddrCmd = &cobra.Command{
 			}
 
 			log.Warn("parsing public symbols for image...")
-			if err := i.ParsePublicSymbols(true); err != nil {
+			if err := i.ParsePublicSymbols(dump); err != nil {
 				log.Errorf("failed to parse public symbols for image %s: %v", i.Name, err)
 			}
 
+			if !dump {
+				m, err := i.GetPartialMacho()
+				if err != nil {
+					return err
+				}
+				for _, lsym := range i.LocalSymbols { // already sorted by name
+					lsym.Macho = m
+					fmt.Println(lsym.String(useColor))
+				}
+				syms := slices.Clone(i.PublicSymbols)
+				stable.SortBy(syms, func(s *dyld.Symbol) string { return s.Name })
+				for _, sym := range syms {
+					s := *sym
+					s.Image = i.Name
+					fmt.Println(s.String(useColor))
+				}
+			}
+
 			return nil
 		}
 		/******************
@@ -27,6 +27,8 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/spill"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/disass"
 	"github.com/blacktop/ipsw/pkg/dyld"
@@ -160,63 +162,86 @@ var XrefCmd = &cobra.Command{
 		log.Info("Searching for xrefs (use -V for more progess output)")
 
 		for _, img := range images {
-			xrefs := make(map[uint64]string)
-
-			if err := img.Analyze(); err != nil {
-				return fmt.Errorf("failed to analyze image: %s; %v", img.Name, err)
-			}
-
-			m, err := img.GetMacho()
-			if err != nil {
-				return err
-			}
-			defer m.Close()
-
-			if m.HasObjC() {
-				log.Debug("Parsing ObjC runtime structures...")
-				if err := f.ParseObjcForImage(img.Name); err != nil {
-					return fmt.Errorf("failed to parse objc data for image %s: %v", img.Name, err)
+			xrefs := spill.NewMap[string]() // spills to disk when --memory-budget is exceeded
+
+			// cached per image UUID and target address (results that spilled to disk are too big to cache)
+			cacheKind := fmt.Sprintf("xrefs_%x", unslidAddr)
+			cached := make(map[uint64]string)
+			if found, err := cache.Default().Load(img.UUID.String(), cacheKind, &cached); err == nil && found {
+				for addr, sym := range cached {
+					if err := xrefs.Set(addr, sym); err != nil {
+						return err
+					}
+				}
+			} else {
+				if err := img.Analyze(); err != nil {
+					return fmt.Errorf("failed to analyze image: %s; %v", img.Name, err)
 				}
-			}
 
-			for _, fn := range m.GetFunctions() {
-				uuid, soff, err := f.GetOffset(fn.StartAddr)
+				m, err := img.GetMacho()
 				if err != nil {
 					return err
 				}
+				defer m.Close()
 
-				data, err := f.ReadBytesForUUID(uuid, int64(soff), uint64(fn.EndAddr-fn.StartAddr))
-				if err != nil {
-					return err
+				if m.HasObjC() {
+					log.Debug("Parsing ObjC runtime structures...")
+					if err := f.ParseObjcForImage(img.Name); err != nil {
+						return fmt.Errorf("failed to parse objc data for image %s: %v", img.Name, err)
+					}
 				}
 
-				engine := dyld.NewDyldDisass(f, &disass.Config{
-					Data:         data,
-					StartAddress: fn.StartAddr,
-					Quite:        true,
-				})
+				for _, fn := range cache.Default().FunctionStarts(m) {
+					uuid, soff, err := f.GetOffset(fn.StartAddr)
+					if err != nil {
+						return err
+					}
+
+					data, err := f.ReadBytesForUUID(uuid, int64(soff), uint64(fn.EndAddr-fn.StartAddr))
+					if err != nil {
+						return err
+					}
 
-				if err := engine.Triage(); err != nil {
-					return fmt.Errorf("first pass triage failed: %v", err)
-				}
+					engine := dyld.NewDyldDisass(f, &disass.Config{
+						Data:         data,
+						StartAddress: fn.StartAddr,
+						Quite:        true,
+					})
 
-				if ok, loc := engine.Contains(unslidAddr); ok {
-					if sym, ok := f.AddressToSymbol[fn.StartAddr]; ok {
-						xrefs[loc] = fmt.Sprintf("%s + %d", sym, loc-fn.StartAddr)
-					} else {
-						xrefs[loc] = fmt.Sprintf("func_%x + %d", fn.StartAddr, loc-fn.StartAddr)
+					if err := engine.Triage(); err != nil {
+						return fmt.Errorf("first pass triage failed: %v", err)
+					}
+
+					if ok, loc := engine.Contains(unslidAddr); ok {
+						if sym, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+							err = xrefs.Set(loc, fmt.Sprintf("%s + %d", sym, loc-fn.StartAddr))
+						} else {
+							err = xrefs.Set(loc, fmt.Sprintf("func_%x + %d", fn.StartAddr, loc-fn.StartAddr))
+						}
+						if err != nil {
+							return err
+						}
+						// } else if triage.IsData(unslidAddr) {
+						// 	xrefs[fn.StartAddr] = fmt.Sprintf("data_%x", fn.StartAddr)
+						// } else {
+						// 	if detail, ok := triage.Details[unslidAddr]; ok {
+						// 		xrefs[fn.StartAddr] = detail.String()
+						// 	}
+						// }
+					}
+				}
+				if !xrefs.Spilled() {
+					xrefs.Range(func(addr uint64, sym string) error {
+						cached[addr] = sym
+						return nil
+					})
+					if err := cache.Default().Save(img.UUID.String(), cacheKind, cached); err != nil {
+						log.Debugf("failed to cache xrefs: %v", err)
 					}
-					// } else if triage.IsData(unslidAddr) {
-					// 	xrefs[fn.StartAddr] = fmt.Sprintf("data_%x", fn.StartAddr)
-					// } else {
-					// 	if detail, ok := triage.Details[unslidAddr]; ok {
-					// 		xrefs[fn.StartAddr] = detail.String()
-					// 	}
-					// }
 				}
 			}
 
-			if len(xrefs) == 0 {
+			if xrefs.Len() == 0 {
 				log.WithFields(log.Fields{
 					"dylib": img.Name,
 				}).Debug("No XREFS found")
@@ -225,20 +250,22 @@ var XrefCmd = &cobra.Command{
 					log.WithFields(log.Fields{
 						"sym":   symName,
 						"dylib": img.Name,
-						"xrefs": len(xrefs),
+						"xrefs": xrefs.Len(),
 					}).Info("XREFS")
 				} else {
 					log.WithFields(log.Fields{
 						"dylib": img.Name,
-						"xrefs": len(xrefs),
+						"xrefs": xrefs.Len(),
 					}).Info("XREFS")
 				}
-				if len(xrefs) > 0 {
-					for addr, sym := range xrefs {
-						fmt.Printf("%s: %s\n", colorAddr("%#x", addr), sym)
-					}
+				if err := xrefs.Range(func(addr uint64, sym string) error {
+					fmt.Printf("%s: %s\n", colorAddr("%#x", addr), sym)
+					return nil
+				}); err != nil {
+					return err
 				}
 			}
+			xrefs.Close()
 
 			img.Free() // free up memory
 		}
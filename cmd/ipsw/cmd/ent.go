@@ -107,6 +107,7 @@ var entCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		entDBs := make([]map[string]string, 0, 2)
+		lcDBs := make([]map[string]string, 0, 2) // launch constraints
 
 		if Verbose {
 			log.SetLevel(log.DebugLevel)
@@ -158,11 +159,12 @@ var entCmd = &cobra.Command{
 			}
 
 			for _, idx := range dbIndices {
-				entDB, err := ent.GetDatabase(&ent.Config{Database: dbs[idx]})
+				entDB, err := ent.OpenDatabase(&ent.Config{Database: dbs[idx]})
 				if err != nil {
 					return fmt.Errorf("failed to get entitlement database: %v", err)
 				}
-				entDBs = append(entDBs, entDB)
+				entDBs = append(entDBs, entDB.Entitlements)
+				lcDBs = append(lcDBs, entDB.Constraints)
 			}
 		} else { // create NEW entitlement databases
 			for _, ipswPath := range ipsws {
@@ -170,11 +172,12 @@ var entCmd = &cobra.Command{
 				if len(dbFolder) > 0 {
 					entDBPath = filepath.Join(dbFolder, filepath.Base(entDBPath))
 				}
-				entDB, err := ent.GetDatabase(&ent.Config{IPSW: ipswPath, Database: entDBPath})
+				entDB, err := ent.OpenDatabase(&ent.Config{IPSW: ipswPath, Database: entDBPath})
 				if err != nil {
 					return fmt.Errorf("failed to get entitlement database: %v", err)
 				}
-				entDBs = append(entDBs, entDB)
+				entDBs = append(entDBs, entDB.Entitlements)
+				lcDBs = append(lcDBs, entDB.Constraints)
 			}
 			for _, input := range inputs {
 				md5Hash := md5.Sum([]byte(input))
@@ -182,11 +185,12 @@ var entCmd = &cobra.Command{
 				if len(dbFolder) > 0 {
 					entDBPath = filepath.Join(dbFolder, filepath.Base(entDBPath))
 				}
-				entDB, err := ent.GetDatabase(&ent.Config{Folder: input, Database: entDBPath})
+				entDB, err := ent.OpenDatabase(&ent.Config{Folder: input, Database: entDBPath})
 				if err != nil {
 					return fmt.Errorf("failed to get entitlement database: %v", err)
 				}
-				entDBs = append(entDBs, entDB)
+				entDBs = append(entDBs, entDB.Entitlements)
+				lcDBs = append(lcDBs, entDB.Constraints)
 			}
 		}
 
@@ -247,6 +251,12 @@ var entCmd = &cobra.Command{
 					return fmt.Errorf("failed to diff entitlement databases: %v", err)
 				}
 				fmt.Println(out)
+				log.Info("Diffing launch constraints databases...")
+				out, err = ent.DiffDatabases(lcDBs[0], lcDBs[1], &ent.Config{Markdown: markdown, Color: viper.GetBool("color") && !viper.GetBool("no-color")})
+				if err != nil {
+					return fmt.Errorf("failed to diff launch constraints databases: %v", err)
+				}
+				fmt.Println(out)
 			}
 			return nil
 		} else if len(entitlementKey) > 0 { // FIND ALL FILES WITH ENTITLEMENT KEY
@@ -392,9 +402,10 @@ var entCmd = &cobra.Command{
 			}
 			w.Flush()
 		} else if len(searchFile) > 0 { // DUMP MACHO'S ENTITLEMENTS
-			for _, entDB := range entDBs {
+			for i, entDB := range entDBs {
 				for f, ent := range entDB {
 					if strings.Contains(strings.ToLower(f), strings.ToLower(searchFile)) {
+						lc := lcDBs[i][f]
 						if viper.GetBool("color") && !viper.GetBool("no-color") {
 							fmt.Print(color.New(color.Bold).Sprintf("\n%s\n\n", f))
 							if len(ent) > 0 {
@@ -402,6 +413,10 @@ var entCmd = &cobra.Command{
 							} else {
 								fmt.Printf("\n\t- no entitlements\n")
 							}
+							if len(lc) > 0 {
+								fmt.Print(color.New(color.Bold).Sprintf("\nLaunch Constraints\n\n"))
+								quick.Highlight(os.Stdout, lc, "xml", "terminal256", "nord")
+							}
 						} else {
 							log.Infof(f)
 							if len(ent) > 0 {
@@ -409,6 +424,9 @@ var entCmd = &cobra.Command{
 							} else {
 								fmt.Printf("\n\t- no entitlements\n")
 							}
+							if len(lc) > 0 {
+								fmt.Printf("\nLaunch Constraints\n\n%s\n", lc)
+							}
 						}
 					}
 				}
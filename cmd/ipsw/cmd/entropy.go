@@ -0,0 +1,174 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/commands/entropy"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorVerdict = map[string]func(a ...any) string{
+	entropy.Encrypted:  color.New(color.Bold, color.FgHiRed).SprintFunc(),
+	entropy.Packed:     color.New(color.Bold, color.FgHiMagenta).SprintFunc(),
+	entropy.Compressed: color.New(color.Bold, color.FgHiYellow).SprintFunc(),
+	entropy.Sparse:     color.New(color.Faint).SprintFunc(),
+}
+
+func init() {
+	rootCmd.AddCommand(entropyCmd)
+
+	entropyCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO (default: all)")
+	entropyCmd.Flags().IntP("block", "b", 0x10000, "Block size for non-MachO files (firmware blobs)")
+	entropyCmd.Flags().BoolP("flagged", "x", false, "Only show regions that look encrypted, compressed or packed")
+	entropyCmd.Flags().Bool("json", false, "Output as JSON")
+	viper.BindPFlag("entropy.arch", entropyCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("entropy.block", entropyCmd.Flags().Lookup("block"))
+	viper.BindPFlag("entropy.flagged", entropyCmd.Flags().Lookup("flagged"))
+	viper.BindPFlag("entropy.json", entropyCmd.Flags().Lookup("json"))
+}
+
+func entropyReports(path, arch string, block int) ([]*entropy.Report, error) {
+	if ok, _ := magic.IsMachO(path); !ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []*entropy.Report{entropy.Blob(data, path, block)}, nil
+	}
+	var reports []*entropy.Report
+	if fat, err := macho.OpenFat(path); err == nil {
+		defer fat.Close()
+		for _, a := range fat.Arches {
+			if arch != "" && !strings.EqualFold(arch, a.SubCPU.String(a.CPU)) {
+				continue
+			}
+			r, err := entropy.MachO(a.File, fmt.Sprintf("%s (%s)", path, a.SubCPU.String(a.CPU)))
+			if err != nil {
+				return nil, err
+			}
+			reports = append(reports, r)
+		}
+		if len(reports) == 0 {
+			return nil, fmt.Errorf("--arch '%s' not found in %s", arch, path)
+		}
+	} else if errors.Is(err, macho.ErrNotFat) {
+		m, err := macho.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer m.Close()
+		r, err := entropy.MachO(m, path)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	} else {
+		return nil, fmt.Errorf("failed to open MachO %s: %v", path, err)
+	}
+	return reports, nil
+}
+
+// entropyCmd represents the entropy command
+var entropyCmd = &cobra.Command{
+	Use:   "entropy <FILE>...",
+	Short: "Show per-section/per-block entropy and flag encrypted, compressed or packed regions",
+	Example: heredoc.Doc(`
+		# Check which sections of an app binary still need to be decrypted
+		❯ ipsw entropy Payload/App.app/App
+		# Scan a firmware blob in 4K blocks and only show the suspicious regions
+		❯ ipsw entropy --block 4096 --flagged sep-firmware.bin
+		# Output as JSON
+		❯ ipsw entropy --json Payload/App.app/Frameworks/*.framework/*`),
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		if viper.GetInt("entropy.block") <= 0 {
+			return fmt.Errorf("--block must be greater than 0")
+		}
+
+		var reports []*entropy.Report
+		for _, arg := range args {
+			path := filepath.Clean(arg)
+			if info, err := os.Stat(path); err != nil {
+				return fmt.Errorf("failed to stat %s: %v", path, err)
+			} else if info.IsDir() {
+				log.Warnf("skipping folder %s", path)
+				continue
+			}
+			rs, err := entropyReports(path, viper.GetString("entropy.arch"), viper.GetInt("entropy.block"))
+			if err != nil {
+				return err
+			}
+			if viper.GetBool("entropy.flagged") {
+				for _, r := range rs {
+					r.Regions = r.Flagged()
+				}
+			}
+			reports = append(reports, rs...)
+		}
+
+		if viper.GetBool("entropy.json") {
+			dat, err := json.MarshalIndent(reports, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		for _, r := range reports {
+			fmt.Printf("%s (entropy=%.3f)\n", colorBin(r.Name), r.Entropy)
+			if r.CryptSize > 0 {
+				fmt.Printf("  %s %#x-%#x (needs decryption)\n", colorVerdict[entropy.Encrypted]("FairPlay encrypted:"), r.CryptOff, r.CryptOff+r.CryptSize)
+			}
+			for _, s := range r.Regions {
+				line := s.String()
+				if cf, ok := colorVerdict[s.Verdict]; ok {
+					line = cf(line)
+				}
+				fmt.Printf("  %s\n", line)
+			}
+		}
+
+		return nil
+	},
+}
@@ -24,11 +24,15 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/commands/extract"
 	"github.com/blacktop/ipsw/internal/commands/mount"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/internal/compress"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -61,6 +65,7 @@ func init() {
 	extractCmd.Flags().StringArrayP("dyld-arch", "a", []string{}, "dyld_shared_cache architecture to extract")
 	extractCmd.Flags().Bool("driverkit", false, "Extract DriverKit dyld_shared_cache")
 	extractCmd.Flags().String("device", "", "Device to extract kernel for (e.g. iPhone10,6)")
+	extractCmd.RegisterFlagCompletionFunc("device", complete.Devices)
 	extractCmd.RegisterFlagCompletionFunc("dmg", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{
 			"app\tAppOS",
@@ -97,14 +102,12 @@ func init() {
 
 // extractCmd represents the extract command
 var extractCmd = &cobra.Command{
-	Use:           "extract <IPSW/OTA | URL>",
-	Aliases:       []string{"e", "ex"},
-	Short:         "Extract kernelcache, dyld_shared_cache or DeviceTree from IPSW/OTA",
-	Args:          cobra.MinimumNArgs(1),
-	SilenceErrors: true,
-	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"ipsw", "zip"}, cobra.ShellCompDirectiveFilterFileExt
-	},
+	Use:               "extract <IPSW/OTA | URL>",
+	Aliases:           []string{"e", "ex"},
+	Short:             "Extract kernelcache, dyld_shared_cache or DeviceTree from IPSW/OTA",
+	Args:              cobra.MinimumNArgs(1),
+	SilenceErrors:     true,
+	ValidArgsFunction: complete.Firmware("ipsw", "zip"),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if Verbose {
@@ -135,6 +138,8 @@ var extractCmd = &cobra.Command{
 			return fmt.Errorf("--driverkit can only be used with --dyld or -d")
 		} else if viper.GetString("extract.device") != "" && !viper.GetBool("extract.kernel") {
 			return fmt.Errorf("--device can only be used with --kernel or -k")
+		} else if err := validateDeviceIdentifier(viper.GetString("extract.device")); err != nil {
+			return err
 		} else if viper.GetBool("extract.sys-ver") && viper.GetBool("extract.remote") {
 			return fmt.Errorf("--sys-ver can NOT be used with a --remote IPSW/OTA")
 		}
@@ -161,6 +166,19 @@ var extractCmd = &cobra.Command{
 			config.URL = args[0]
 		} else {
 			config.IPSW = args[0]
+			// transparently decompress zstd/xz/etc re-packed firmwares
+			if format, err := compress.DetectFile(config.IPSW); err == nil && format != compress.None {
+				tmpDir, err := os.MkdirTemp("", "ipsw_extract")
+				if err != nil {
+					return fmt.Errorf("failed to create temp dir: %v", err)
+				}
+				defer os.RemoveAll(tmpDir)
+				log.Infof("Decompressing %s compressed %s", format, filepath.Base(config.IPSW))
+				config.IPSW, err = compress.DecompressFile(config.IPSW, tmpDir)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 		if typ, err := extract.FirmwareType(config); err == nil {
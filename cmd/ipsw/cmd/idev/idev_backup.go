@@ -30,12 +30,11 @@ func init() {
 }
 
 // BackupCmd represents the backup command
-var BackupCmd = &cobra.Command{ // FIXME: implement backup command
+var BackupCmd = &cobra.Command{
 	Use:     "backup",
 	Aliases: []string{"bk"},
 	Short:   "Backup commands",
 	Args:    cobra.NoArgs,
-	Hidden:  true,
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
@@ -23,35 +23,97 @@ package idev
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/usb/backup"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// backupCreateCmd represents the create command
-var backupCreateCmd = &cobra.Command{
-	Use:   "create",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("create called")
-	},
+func init() {
+	BackupCmd.AddCommand(idevBackupCreateCmd)
+
+	idevBackupCreateCmd.Flags().StringP("output", "o", "", "Folder to save backup(s)")
+	idevBackupCreateCmd.Flags().BoolP("full", "f", false, "Force a full backup")
+	idevBackupCreateCmd.Flags().BoolP("encrypt", "e", false, "Encrypt the backup (prompts for password)")
+	idevBackupCreateCmd.Flags().StringP("password", "p", "", "Backup encryption password")
+	idevBackupCreateCmd.MarkFlagDirname("output")
 }
 
-func init() {
-	BackupCmd.AddCommand(backupCreateCmd)
+// idevBackupCreateCmd represents the create command
+var idevBackupCreateCmd = &cobra.Command{
+	Use:           "create",
+	Short:         "Create an iTunes style backup",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
 
-	// Here you will define your flags and configuration settings.
+		udid, _ := cmd.Flags().GetString("udid")
+		output, _ := cmd.Flags().GetString("output")
+		full, _ := cmd.Flags().GetBool("full")
+		encrypt, _ := cmd.Flags().GetBool("encrypt")
+		password, _ := cmd.Flags().GetString("password")
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// createCmd.PersistentFlags().String("foo", "", "A help for foo")
+		if len(udid) == 0 {
+			dev, err := utils.PickDevice()
+			if err != nil {
+				return fmt.Errorf("failed to pick USB connected devices: %w", err)
+			}
+			udid = dev.UniqueDeviceID
+		}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// createCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+		if encrypt && len(password) == 0 {
+			if err := survey.AskOne(&survey.Password{Message: "Backup password:"}, &password); err != nil {
+				if err == terminal.InterruptErr {
+					log.Warn("Exiting...")
+					return nil
+				}
+				return err
+			}
+		}
+
+		if len(output) == 0 {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current working directory: %w", err)
+			}
+			output = cwd
+		}
+
+		cli, err := backup.NewClient(udid)
+		if err != nil {
+			return fmt.Errorf("failed to connect to backup service: %w", err)
+		}
+		defer cli.Close()
+
+		log.Infof("Creating backup: %s", filepath.Join(output, udid))
+		var last int
+		if err := cli.Backup(output, &backup.Options{
+			FullBackup: full,
+			Password:   password,
+			Progress: func(percent float64) {
+				if int(percent)/10 > last/10 {
+					log.Infof("Backup progress: %d%%", int(percent))
+				}
+				last = int(percent)
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to create backup: %w", err)
+		}
+		log.Info("Backup complete")
+
+		return nil
+	},
 }
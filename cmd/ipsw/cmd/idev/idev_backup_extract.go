@@ -23,35 +23,72 @@ package idev
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/usb/backup"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// backupExtractCmd represents the extract command
-var backupExtractCmd = &cobra.Command{
-	Use:   "extract",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("extract called")
-	},
+func init() {
+	BackupCmd.AddCommand(idevBackupExtractCmd)
+
+	idevBackupExtractCmd.Flags().StringP("password", "p", "", "Backup encryption password")
+	idevBackupExtractCmd.Flags().StringP("filter", "f", "", "Only extract files whose DOMAIN/PATH contains filter")
+	idevBackupExtractCmd.Flags().StringP("output", "o", "", "Folder to extract files to")
+	idevBackupExtractCmd.MarkFlagDirname("output")
 }
 
-func init() {
-	BackupCmd.AddCommand(backupExtractCmd)
+// idevBackupExtractCmd represents the extract command
+var idevBackupExtractCmd = &cobra.Command{
+	Use:           "extract <BACKUP>",
+	Short:         "Extract files from a backup",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
 
-	// Here you will define your flags and configuration settings.
+		password, _ := cmd.Flags().GetString("password")
+		filter, _ := cmd.Flags().GetString("filter")
+		output, _ := cmd.Flags().GetString("output")
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// extractCmd.PersistentFlags().String("foo", "", "A help for foo")
+		if len(output) == 0 {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current working directory: %w", err)
+			}
+			output = cwd
+		}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// extractCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+		bk, err := backup.Open(args[0], password)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer bk.Close()
+
+		files, err := bk.Files(filter)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			fname, err := bk.Extract(f, output)
+			if err != nil {
+				log.Errorf("failed to extract %s: %v", f.Path(), err)
+				continue
+			}
+			if !f.IsDir() {
+				log.Infof("Extracted %s", fname)
+			}
+		}
+
+		return nil
+	},
 }
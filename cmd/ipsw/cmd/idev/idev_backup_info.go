@@ -22,36 +22,88 @@ THE SOFTWARE.
 package idev
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/usb/backup"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// backupInfoCmd represents the info command
-var backupInfoCmd = &cobra.Command{
-	Use:   "info",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("info called")
-	},
-}
+var colorField = color.New(color.Faint, color.FgHiBlue).SprintFunc()
 
 func init() {
-	BackupCmd.AddCommand(backupInfoCmd)
+	BackupCmd.AddCommand(idevBackupInfoCmd)
+
+	idevBackupInfoCmd.Flags().StringP("password", "p", "", "Backup encryption password")
+	idevBackupInfoCmd.Flags().BoolP("json", "j", false, "Display info as JSON")
+}
+
+// idevBackupInfoCmd represents the info command
+var idevBackupInfoCmd = &cobra.Command{
+	Use:           "info <BACKUP>",
+	Short:         "Display backup info",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 
-	// Here you will define your flags and configuration settings.
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// infoCmd.PersistentFlags().String("foo", "", "A help for foo")
+		password, _ := cmd.Flags().GetString("password")
+		asJSON, _ := cmd.Flags().GetBool("json")
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// infoCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+		bk, err := backup.Open(args[0], password)
+		if errors.Is(err, backup.ErrPasswordRequired) { // the plists aren't encrypted
+			bk, err = backup.ReadMetadata(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer bk.Close()
+
+		if asJSON {
+			dat, err := json.Marshal(struct {
+				Info     *backup.Info     `json:"info,omitempty"`
+				Manifest *backup.Manifest `json:"manifest,omitempty"`
+				Status   *backup.Status   `json:"status,omitempty"`
+			}{
+				Info:     bk.Info,
+				Manifest: bk.Manifest,
+				Status:   bk.Status,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal backup info to JSON: %w", err)
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		if bk.Info != nil {
+			fmt.Printf("%s %s\n", colorField("Device Name:    "), bk.Info.DeviceName)
+			fmt.Printf("%s %s\n", colorField("Product Type:   "), bk.Info.ProductType)
+			fmt.Printf("%s %s (%s)\n", colorField("Product Version:"), bk.Info.ProductVersion, bk.Info.BuildVersion)
+			fmt.Printf("%s %s\n", colorField("Serial Number:  "), bk.Info.SerialNumber)
+			fmt.Printf("%s %s\n", colorField("UDID:           "), bk.Info.UniqueIdentifier)
+			fmt.Printf("%s %s\n", colorField("Last Backup:    "), bk.Info.LastBackupDate.Local().Format("02Jan2006 15:04:05"))
+		}
+		fmt.Printf("%s %s\n", colorField("Version:        "), bk.Manifest.Version)
+		fmt.Printf("%s %t\n", colorField("Encrypted:      "), bk.Manifest.IsEncrypted)
+		fmt.Printf("%s %t\n", colorField("Passcode Set:   "), bk.Manifest.WasPasscodeSet)
+		if bk.Status != nil {
+			fmt.Printf("%s %t\n", colorField("Full Backup:    "), bk.Status.IsFullBackup)
+			fmt.Printf("%s %s\n", colorField("State:          "), bk.Status.BackupState)
+		}
+		if len(bk.Manifest.Applications) > 0 {
+			fmt.Printf("%s %d\n", colorField("Applications:   "), len(bk.Manifest.Applications))
+		}
+
+		return nil
+	},
 }
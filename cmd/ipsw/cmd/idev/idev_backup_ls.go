@@ -22,36 +22,107 @@ THE SOFTWARE.
 package idev
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"text/tabwriter"
 
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/usb/backup"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// backupLsCmd represents the ls command
-var backupLsCmd = &cobra.Command{
-	Use:   "ls",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("ls called")
-	},
+func init() {
+	BackupCmd.AddCommand(idevBackupLsCmd)
+
+	idevBackupLsCmd.Flags().StringP("password", "p", "", "Backup encryption password")
+	idevBackupLsCmd.Flags().StringP("filter", "f", "", "Only list files whose DOMAIN/PATH contains filter")
+	idevBackupLsCmd.Flags().BoolP("domains", "d", false, "List backup domains")
+	idevBackupLsCmd.Flags().BoolP("json", "j", false, "Display files as JSON")
 }
 
-func init() {
-	BackupCmd.AddCommand(backupLsCmd)
+// idevBackupLsCmd represents the ls command
+var idevBackupLsCmd = &cobra.Command{
+	Use:           "ls <BACKUP>",
+	Short:         "List files in a backup",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
 
-	// Here you will define your flags and configuration settings.
+		password, _ := cmd.Flags().GetString("password")
+		filter, _ := cmd.Flags().GetString("filter")
+		domains, _ := cmd.Flags().GetBool("domains")
+		asJSON, _ := cmd.Flags().GetBool("json")
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// lsCmd.PersistentFlags().String("foo", "", "A help for foo")
+		bk, err := backup.Open(args[0], password)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer bk.Close()
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// lsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+		if domains {
+			doms, err := bk.Domains()
+			if err != nil {
+				return err
+			}
+			for _, dom := range doms {
+				fmt.Println(dom)
+			}
+			return nil
+		}
+
+		files, err := bk.Files(filter)
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			type fileJSON struct {
+				backup.File
+				Info *backup.FileInfo `json:"info,omitempty"`
+			}
+			var out []fileJSON
+			for _, f := range files {
+				fi, err := bk.FileInfo(f)
+				if err != nil {
+					log.Debugf("failed to parse file info for %s: %v", f.Path(), err)
+				}
+				out = append(out, fileJSON{File: f, Info: fi})
+			}
+			dat, err := json.Marshal(out)
+			if err != nil {
+				return fmt.Errorf("failed to marshal files to JSON: %w", err)
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		for _, f := range files {
+			switch {
+			case f.IsDir():
+				fmt.Fprintf(w, "%s\t%s\t%s\n", color.New(color.Faint).Sprint(f.ID), "-", color.New(color.FgHiBlue).Sprint(f.Path()+"/"))
+			case f.IsSymlink():
+				fmt.Fprintf(w, "%s\t%s\t%s\n", color.New(color.Faint).Sprint(f.ID), "-", color.New(color.FgHiCyan).Sprint(f.Path()))
+			default:
+				size := "?"
+				if fi, err := bk.FileInfo(f); err == nil {
+					size = humanize.Bytes(fi.Size)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", color.New(color.Faint).Sprint(f.ID), size, f.Path())
+			}
+		}
+		w.Flush()
+
+		return nil
+	},
 }
@@ -0,0 +1,219 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package idev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/usb/apps"
+	"github.com/blacktop/ipsw/pkg/usb/debugserver"
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+	"github.com/caarlos0/ctrlc"
+	"github.com/fatih/color"
+	semver "github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	IDevCmd.AddCommand(idevDebugCmd)
+
+	idevDebugCmd.Flags().IntP("port", "p", 0, "Local port for LLDB to connect to (default: random)")
+	idevDebugCmd.Flags().StringP("xcode", "x", "/Applications/Xcode.app", "Path to Xcode.app (used to mount the DDI)")
+	idevDebugCmd.Flags().StringP("app", "a", "", "Local copy of the .app bundle (enables 'process launch')")
+	idevDebugCmd.Flags().StringP("symbols", "s", "", "Folder containing the split DSC dylibs (default: Xcode iOS DeviceSupport)")
+	idevDebugCmd.Flags().IntP("pid", "i", 0, "Attach to running process PID")
+	idevDebugCmd.Flags().BoolP("wait", "w", false, "Attach when the app is next launched")
+	idevDebugCmd.Flags().Bool("no-mount", false, "Do NOT mount the DDI if it is missing")
+	idevDebugCmd.Flags().String("proxy", "", "HTTP/HTTPS proxy (used to personalize the DDI)")
+	idevDebugCmd.Flags().Bool("insecure", false, "do not verify ssl certs")
+	idevDebugCmd.MarkFlagDirname("app")
+	idevDebugCmd.MarkFlagDirname("symbols")
+
+	viper.BindPFlag("idev.debug.port", idevDebugCmd.Flags().Lookup("port"))
+	viper.BindPFlag("idev.debug.xcode", idevDebugCmd.Flags().Lookup("xcode"))
+	viper.BindPFlag("idev.debug.app", idevDebugCmd.Flags().Lookup("app"))
+	viper.BindPFlag("idev.debug.symbols", idevDebugCmd.Flags().Lookup("symbols"))
+	viper.BindPFlag("idev.debug.pid", idevDebugCmd.Flags().Lookup("pid"))
+	viper.BindPFlag("idev.debug.wait", idevDebugCmd.Flags().Lookup("wait"))
+	viper.BindPFlag("idev.debug.no-mount", idevDebugCmd.Flags().Lookup("no-mount"))
+	viper.BindPFlag("idev.debug.proxy", idevDebugCmd.Flags().Lookup("proxy"))
+	viper.BindPFlag("idev.debug.insecure", idevDebugCmd.Flags().Lookup("insecure"))
+}
+
+// idevDebugCmd represents the debug command
+var idevDebugCmd = &cobra.Command{
+	Use:   "debug <BUNDLE_ID>",
+	Short: "Start a debugserver session and print the LLDB commands to connect to it",
+	Example: heredoc.Doc(`
+		# Wait for app to launch and print LLDB commands to attach to it
+		❯ ipsw idev debug com.apple.mobilesafari --wait
+		# Use a local copy of the app so LLDB can launch it
+		❯ ipsw idev debug com.example.app --app build/Example.app --port 6666`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		udid, _ := cmd.Flags().GetString("udid")
+		bundleID := args[0]
+
+		var err error
+		var dev *lockdownd.DeviceValues
+		if len(udid) == 0 {
+			dev, err = utils.PickDevice()
+			if err != nil {
+				return fmt.Errorf("failed to pick USB connected devices: %w", err)
+			}
+		} else {
+			ldc, err := lockdownd.NewClient(udid)
+			if err != nil {
+				return fmt.Errorf("failed to connect to lockdownd: %w", err)
+			}
+			dev, err = ldc.GetValues()
+			if err != nil {
+				return fmt.Errorf("failed to get device values for %s: %w", udid, err)
+			}
+			ldc.Close()
+		}
+
+		if ok, err := utils.IsDeveloperModeEnabled(dev.UniqueDeviceID); !ok && err == nil {
+			return fmt.Errorf("you must enable Developer Mode in your device Settings app for %s", dev.DeviceName)
+		} else if err != nil {
+			return fmt.Errorf("failed to check if developer mode is enabled for device %s: %w", dev.UniqueDeviceID, err)
+		}
+
+		ver, err := semver.NewVersion(dev.ProductVersion)
+		if err != nil {
+			return fmt.Errorf("failed to convert version into semver object")
+		}
+
+		if err := utils.IsDeveloperImageMounted(dev.UniqueDeviceID); err != nil {
+			if viper.GetBool("idev.debug.no-mount") {
+				return fmt.Errorf("for device %s: %w", dev.UniqueDeviceID, err)
+			}
+			imageType := "Developer"
+			if ver.GreaterThanOrEqual(semver.Must(semver.NewVersion("17.0"))) {
+				imageType = "Personalized"
+			}
+			log.Infof("Mounting %s DDI", imageType)
+			if err := mountDeveloperImage(dev, &mountOpts{
+				Xcode:     viper.GetString("idev.debug.xcode"),
+				ImageType: imageType,
+				Proxy:     viper.GetString("idev.debug.proxy"),
+				Insecure:  viper.GetBool("idev.debug.insecure"),
+			}); err != nil {
+				return fmt.Errorf("failed to mount DDI: %w", err)
+			}
+		}
+
+		cli, err := apps.NewClient(dev.UniqueDeviceID)
+		if err != nil {
+			return fmt.Errorf("failed to connect to installation_proxy: %w", err)
+		}
+		exePath, err := cli.LookupExePath(bundleID)
+		cli.Close()
+		if err != nil {
+			return fmt.Errorf("failed to lookup app %s: %w", bundleID, err)
+		}
+		if len(exePath) == 0 {
+			return fmt.Errorf("app %s is not installed on %s", bundleID, dev.DeviceName)
+		}
+
+		// make sure the debugserver service can be started BEFORE handing out the commands
+		dc, err := debugserver.NewSecureClient(dev.UniqueDeviceID)
+		if err != nil {
+			if ver.GreaterThanOrEqual(semver.Must(semver.NewVersion("17.0"))) {
+				return fmt.Errorf("failed to start debugserver (iOS17+ requires a CoreDevice tunnel; try `xcrun devicectl device process launch --start-stopped --device %s %s` and attach with Xcode): %w",
+					dev.UniqueDeviceID, bundleID, err)
+			}
+			return fmt.Errorf("failed to start debugserver: %w", err)
+		}
+		dc.Close()
+
+		symbols := viper.GetString("idev.debug.symbols")
+		if len(symbols) == 0 {
+			var found bool
+			symbols, found = debugserver.DeviceSupportSymbols(dev.ProductType, dev.ProductVersion, dev.BuildVersion)
+			if !found {
+				log.Warnf("DSC symbols not found at '%s' (extract them with `ipsw dyld split` or by connecting the device to Xcode)", symbols)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		port, err := debugserver.Bridge(ctx, dev.UniqueDeviceID, viper.GetInt("idev.debug.port"), func(msg string, err error) {
+			if err != nil {
+				log.Error(err.Error())
+			} else {
+				log.Info(msg)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		lldb := debugserver.LLDBConfig{
+			Port:        port,
+			AppPath:     filepath.Dir(exePath),
+			Executable:  filepath.Base(exePath),
+			LocalApp:    viper.GetString("idev.debug.app"),
+			SymbolsPath: symbols,
+			WaitFor:     viper.GetBool("idev.debug.wait"),
+			PID:         viper.GetInt("idev.debug.pid"),
+		}
+
+		log.Infof("debugserver for %s listening on 127.0.0.1:%d", bundleID, port)
+		fmt.Println()
+		fmt.Println(colorField("Paste into LLDB:"))
+		for _, c := range lldb.Commands() {
+			fmt.Printf("    %s\n", c)
+		}
+		fmt.Println()
+		log.Warn("Press Ctrl+C to stop")
+
+		if err := ctrlc.Default.Run(ctx, func() error {
+			<-ctx.Done()
+			return nil
+		}); err != nil {
+			if errors.As(err, &ctrlc.ErrorCtrlC{}) {
+				log.Warn("Stopping debugserver bridge")
+			} else {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package idev
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/mobilegestalt"
+	"github.com/blacktop/ipsw/pkg/usb/diagnostics"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	IDevCmd.AddCommand(idevGestaltCmd)
+
+	idevGestaltCmd.Flags().StringP("db", "d", "", "MobileGestalt key DB JSON (defaults to the built-in DB)")
+	idevGestaltCmd.Flags().BoolP("json", "j", false, "Display answers as JSON")
+	idevGestaltCmd.MarkFlagFilename("db", "json")
+}
+
+// idevGestaltCmd represents the gestalt command
+var idevGestaltCmd = &cobra.Command{
+	Use:     "gestalt <KEY>...",
+	Aliases: []string{"mg"},
+	Short:   "Query MobileGestalt keys (plaintext or obfuscated)",
+	Example: heredoc.Doc(`
+		# Query MobileGestalt keys by name
+		❯ ipsw idev gestalt ProductType SupplementalBuildVersion
+		# Query an obfuscated key (answers are decoded via the MG key DB)
+		❯ ipsw idev gestalt h9jDsbgj7xIVeIQ8S3/X3Q`),
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		udid, _ := cmd.Flags().GetString("udid")
+		dbPath, _ := cmd.Flags().GetString("db")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		var db mobilegestalt.DB
+		var err error
+		if len(dbPath) > 0 {
+			db, err = mobilegestalt.LoadDB(dbPath)
+		} else {
+			db, err = mobilegestalt.GetDB()
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(udid) == 0 {
+			dev, err := utils.PickDevice()
+			if err != nil {
+				return fmt.Errorf("failed to pick USB connected devices: %w", err)
+			}
+			udid = dev.UniqueDeviceID
+		}
+
+		keys := make([]string, 0, len(args))
+		for _, arg := range args {
+			keys = append(keys, db.Encode(arg))
+		}
+
+		cli, err := diagnostics.NewClient(udid)
+		if err != nil {
+			return fmt.Errorf("failed to connect to diagnostics: %w", err)
+		}
+		defer cli.Close()
+
+		resp, err := cli.MobileGestalt(keys...)
+		if err != nil {
+			return fmt.Errorf("failed to query MobileGestalt: %w", err)
+		}
+
+		answers, ok := resp.Diagnostics["MobileGestalt"].(map[string]any)
+		if !ok {
+			return fmt.Errorf("failed to query MobileGestalt: %s", resp.Status)
+		}
+		if status, ok := answers["Status"]; ok && status != "Success" {
+			return fmt.Errorf("failed to query MobileGestalt: %v", status)
+		}
+		delete(answers, "Status")
+		answers = db.DecodeAnswers(answers)
+
+		if asJSON {
+			dat, err := json.Marshal(answers)
+			if err != nil {
+				return fmt.Errorf("failed to marshal MobileGestalt answers to JSON: %w", err)
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		names := make([]string, 0, len(answers))
+		for name := range answers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%v\n", color.New(color.Faint, color.FgHiBlue).Sprintf("%s:", name), answers[name])
+		}
+		w.Flush()
+
+		return nil
+	},
+}
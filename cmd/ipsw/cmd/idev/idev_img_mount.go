@@ -64,6 +64,225 @@ func init() {
 	viper.BindPFlag("idev.img.mount.insecure", idevImgMountCmd.Flags().Lookup("insecure"))
 }
 
+type mountOpts struct {
+	Xcode          string
+	DmgPath        string
+	TrustcachePath string
+	ManifestPath   string
+	SignaturePath  string
+	ImageType      string
+	Proxy          string
+	Insecure       bool
+}
+
+// mountDeveloperImage uploads and mounts the (personalized on iOS17+) Developer Disk Image
+func mountDeveloperImage(dev *lockdownd.DeviceValues, opts *mountOpts) error {
+	xcode := opts.Xcode
+	dmgPath := opts.DmgPath
+	trustcachePath := opts.TrustcachePath
+	manifestPath := opts.ManifestPath
+	signaturePath := opts.SignaturePath
+	imageType := opts.ImageType
+
+	ver, err := semver.NewVersion(dev.ProductVersion) // check
+	if err != nil {
+		return fmt.Errorf("failed to convert version into semver object")
+	}
+
+	if ver.LessThan(semver.Must(semver.NewVersion("17.0"))) {
+		cli, err := mount.NewClient(dev.UniqueDeviceID)
+		if err != nil {
+			return fmt.Errorf("failed to connect to mobile_image_mounter: %w", err)
+		}
+		defer cli.Close()
+
+		if _, err := cli.LookupImage(imageType); err == nil {
+			log.Warnf("image type %s already mounted", imageType)
+			return nil
+		}
+
+		var imgData []byte
+		var sigData []byte
+
+		if len(dmgPath) == 0 {
+			version, err := semver.NewVersion(dev.ProductVersion)
+			if err != nil {
+				log.Fatal("failed to convert version into semver object")
+			}
+			imgData, err = os.ReadFile(
+				filepath.Join(xcode,
+					fmt.Sprintf("/Contents/Developer/Platforms/iPhoneOS.platform/DeviceSupport/%d.%d/DeveloperDiskImage.dmg",
+						version.Segments()[0],
+						version.Segments()[1],
+					)))
+			if err != nil {
+				return fmt.Errorf("failed to read DeveloperDiskImage.dmg: %w", err)
+			}
+			sigData, err = os.ReadFile(
+				filepath.Join(xcode,
+					fmt.Sprintf("/Contents/Developer/Platforms/iPhoneOS.platform/DeviceSupport/%d.%d/DeveloperDiskImage.dmg.signature",
+						version.Segments()[0],
+						version.Segments()[1],
+					)))
+			if err != nil {
+				return fmt.Errorf("failed to read DeveloperDiskImage.dmg.signature: %w", err)
+			}
+		} else {
+			imgData, err = os.ReadFile(dmgPath)
+			if err != nil {
+				return fmt.Errorf("failed to read image '%s': %w", dmgPath, err)
+			}
+			sigData, err = os.ReadFile(signaturePath)
+			if err != nil {
+				return fmt.Errorf("failed to read signature '%s': %w", signaturePath, err)
+			}
+		}
+
+		log.Infof("Uploading %s image", imageType)
+		if err := cli.Upload(imageType, imgData, sigData); err != nil {
+			return fmt.Errorf("failed to upload image: %w", err)
+		}
+		log.Infof("Mounting %s image", imageType)
+		if err := cli.Mount(imageType, sigData, trustcachePath, manifestPath); err != nil {
+			return fmt.Errorf("failed to mount image: %w", err)
+		}
+	} else { // NEW iOS17 DDIs need to be personalized
+		var buildManifest *plist.BuildManifest
+
+		imageType = "Personalized"
+
+		if len(dmgPath) == 0 {
+			xcodeVersion, err := utils.GetXCodeVersion(xcode)
+			if err != nil {
+				return fmt.Errorf("failed to get Xcode version: %w", err)
+			}
+			xcver, err := semver.NewVersion(xcodeVersion) // check
+			if err != nil {
+				return fmt.Errorf("failed to convert version into semver object")
+			}
+			var ddiPath string
+			if xcver.LessThan(semver.Must(semver.NewVersion("16.0"))) {
+				ddiPath = filepath.Join(xcode, "/Contents/Resources/CoreDeviceDDIs/iOS_DDI.dmg")
+				if _, err := os.Stat(ddiPath); errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("failed to find iOS_DDI.dmg in '%s' (install NEW XCode.app or Xcode-beta.app)", ddiPath)
+				}
+			} else {
+				// NOTE: XCode 16+ now installs the DDI from Xcode.app/Contents/Resources/Packages/XcodeSystemResources.pkg
+				ddiPath = "/Library/Developer/DeveloperDiskImages/iOS_DDI.dmg"
+				if _, err := os.Stat(ddiPath); errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("failed to find iOS_DDI.dmg in '%s' (run `%s -runFirstLaunch` and try again)", ddiPath, filepath.Join(xcode, "Contents/Developer/usr/bin/xcodebuild"))
+				}
+			}
+			ddiDMG := filepath.Join(xcode, "/Contents/Resources/CoreDeviceDDIs/iOS_DDI.dmg")
+			if _, err := os.Stat(ddiDMG); errors.Is(err, os.ErrNotExist) {
+				ddiDMG = "/Library/Developer/DeveloperDiskImages/iOS_DDI.dmg"
+				if _, err := os.Stat(ddiDMG); errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("failed to find iOS_DDI.dmg in '%s' (install NEW XCode.app or Xcode-beta.app)", xcode)
+				}
+			}
+			utils.Indent(log.Info, 2)(fmt.Sprintf("Mounting %s", ddiDMG))
+			mountPoint, alreadyMounted, err := utils.MountDMG(ddiDMG)
+			if err != nil {
+				return fmt.Errorf("failed to mount iOS_DDI.dmg: %w", err)
+			}
+			if alreadyMounted {
+				utils.Indent(log.Info, 3)(fmt.Sprintf("%s already mounted", ddiDMG))
+			} else {
+				defer func() {
+					utils.Indent(log.Debug, 2)(fmt.Sprintf("Unmounting %s", ddiDMG))
+					if err := utils.Retry(3, 2*time.Second, func() error {
+						return utils.Unmount(mountPoint, false)
+					}); err != nil {
+						log.Errorf("failed to unmount %s at %s: %v", ddiDMG, mountPoint, err)
+					}
+				}()
+			}
+			manifestPath := filepath.Join(mountPoint, "Restore/BuildManifest.plist")
+			manifestData, err := os.ReadFile(manifestPath)
+			if err != nil {
+				return fmt.Errorf("failed to read BuildManifest.plist: %w", err)
+			}
+			buildManifest, err = plist.ParseBuildManifest(manifestData)
+			if err != nil {
+				return fmt.Errorf("failed to parse BuildManifest.plist: %w", err)
+			}
+			trustcachePath = filepath.Join(mountPoint, "Restore", buildManifest.BuildIdentities[0].Manifest["LoadableTrustCache"].Info["Path"].(string))
+			dmgPath = filepath.Join(mountPoint, "Restore", buildManifest.BuildIdentities[0].Manifest["PersonalizedDMG"].Info["Path"].(string))
+		}
+
+		if len(manifestPath) > 0 {
+			manifestData, err := os.ReadFile(manifestPath)
+			if err != nil {
+				return fmt.Errorf("failed to read BuildManifest.plist: %w", err)
+			}
+			buildManifest, err = plist.ParseBuildManifest(manifestData)
+			if err != nil {
+				return fmt.Errorf("failed to parse BuildManifest.plist: %w", err)
+			}
+		}
+
+		cli, err := mount.NewClient(dev.UniqueDeviceID)
+		if err != nil {
+			return fmt.Errorf("failed to connect to mobile_image_mounter: %w", err)
+		}
+		defer cli.Close()
+
+		if _, err := cli.LookupImage(imageType); err == nil {
+			log.Warnf("image type %s already mounted", imageType)
+			return nil
+		}
+
+		imgData, err := os.ReadFile(dmgPath)
+		if err != nil {
+			return fmt.Errorf("failed to read PersonalizedDMG: %w", err)
+		}
+
+		var sigData []byte
+		if len(signaturePath) > 0 {
+			sigData, err = os.ReadFile(signaturePath)
+			if err != nil {
+				return fmt.Errorf("failed to read signature '%s': %w", signaturePath, err)
+			}
+		} else {
+			digest := sha512.Sum384(imgData)
+			sigData, err = cli.PersonalizationManifest("DeveloperDiskImage", digest[:])
+			if err != nil {
+				log.Debugf("failed to get personalization manifest: %w", err)
+
+				nonce, err := cli.Nonce("DeveloperDiskImage")
+				if err != nil {
+					return fmt.Errorf("failed to get nonce: %w", err)
+				}
+
+				personalID, err := cli.PersonalizationIdentifiers("")
+				if err != nil {
+					log.Errorf("failed to get personalization identifiers: %v ('personalization' might not be supported on this device)", err)
+				}
+
+				personalID["ApNonce"] = nonce
+
+				sigData, err = tss.Personalize(&tss.PersonalConfig{
+					Proxy:         opts.Proxy,
+					Insecure:      opts.Insecure,
+					PersonlID:     personalID,
+					BuildManifest: buildManifest,
+				})
+			}
+		}
+
+		log.Infof("Uploading %s image", imageType)
+		if err := cli.Upload(imageType, imgData, sigData); err != nil {
+			return fmt.Errorf("failed to upload image: %w", err)
+		}
+		log.Infof("Mounting %s image", imageType)
+		if err := cli.Mount(imageType, sigData, trustcachePath, manifestPath); err != nil {
+			return fmt.Errorf("failed to mount image: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // idevImgMountCmd represents the mount command
 var idevImgMountCmd = &cobra.Command{
 	Use:           "mount",
@@ -117,202 +336,15 @@ var idevImgMountCmd = &cobra.Command{
 			ldc.Close()
 		}
 
-		ver, err := semver.NewVersion(dev.ProductVersion) // check
-		if err != nil {
-			return fmt.Errorf("failed to convert version into semver object")
-		}
-
-		if ver.LessThan(semver.Must(semver.NewVersion("17.0"))) {
-			cli, err := mount.NewClient(dev.UniqueDeviceID)
-			if err != nil {
-				return fmt.Errorf("failed to connect to mobile_image_mounter: %w", err)
-			}
-			defer cli.Close()
-
-			if _, err := cli.LookupImage(imageType); err == nil {
-				log.Warnf("image type %s already mounted", imageType)
-				return nil
-			}
-
-			var imgData []byte
-			var sigData []byte
-
-			if len(args) == 0 {
-				version, err := semver.NewVersion(dev.ProductVersion)
-				if err != nil {
-					log.Fatal("failed to convert version into semver object")
-				}
-				imgData, err = os.ReadFile(
-					filepath.Join(xcode,
-						fmt.Sprintf("/Contents/Developer/Platforms/iPhoneOS.platform/DeviceSupport/%d.%d/DeveloperDiskImage.dmg",
-							version.Segments()[0],
-							version.Segments()[1],
-						)))
-				if err != nil {
-					return fmt.Errorf("failed to read DeveloperDiskImage.dmg: %w", err)
-				}
-				sigData, err = os.ReadFile(
-					filepath.Join(xcode,
-						fmt.Sprintf("/Contents/Developer/Platforms/iPhoneOS.platform/DeviceSupport/%d.%d/DeveloperDiskImage.dmg.signature",
-							version.Segments()[0],
-							version.Segments()[1],
-						)))
-				if err != nil {
-					return fmt.Errorf("failed to read DeveloperDiskImage.dmg.signature: %w", err)
-				}
-			} else {
-				imgData, err = os.ReadFile(dmgPath)
-				if err != nil {
-					return fmt.Errorf("failed to read image '%s': %w", dmgPath, err)
-				}
-				sigData, err = os.ReadFile(signaturePath)
-				if err != nil {
-					return fmt.Errorf("failed to read signature '%s': %w", signaturePath, err)
-				}
-			}
-
-			log.Infof("Uploading %s image", imageType)
-			if err := cli.Upload(imageType, imgData, sigData); err != nil {
-				return fmt.Errorf("failed to upload image: %w", err)
-			}
-			log.Infof("Mounting %s image", imageType)
-			if err := cli.Mount(imageType, sigData, trustcachePath, manifestPath); err != nil {
-				return fmt.Errorf("failed to mount image: %w", err)
-			}
-		} else { // NEW iOS17 DDIs need to be personalized
-			var buildManifest *plist.BuildManifest
-
-			imageType = "Personalized"
-
-			if len(dmgPath) == 0 {
-				xcodeVersion, err := utils.GetXCodeVersion(xcode)
-				if err != nil {
-					return fmt.Errorf("failed to get Xcode version: %w", err)
-				}
-				xcver, err := semver.NewVersion(xcodeVersion) // check
-				if err != nil {
-					return fmt.Errorf("failed to convert version into semver object")
-				}
-				var ddiPath string
-				if xcver.LessThan(semver.Must(semver.NewVersion("16.0"))) {
-					ddiPath = filepath.Join(xcode, "/Contents/Resources/CoreDeviceDDIs/iOS_DDI.dmg")
-					if _, err := os.Stat(ddiPath); errors.Is(err, os.ErrNotExist) {
-						return fmt.Errorf("failed to find iOS_DDI.dmg in '%s' (install NEW XCode.app or Xcode-beta.app)", ddiPath)
-					}
-				} else {
-					// NOTE: XCode 16+ now installs the DDI from Xcode.app/Contents/Resources/Packages/XcodeSystemResources.pkg
-					ddiPath = "/Library/Developer/DeveloperDiskImages/iOS_DDI.dmg"
-					if _, err := os.Stat(ddiPath); errors.Is(err, os.ErrNotExist) {
-						return fmt.Errorf("failed to find iOS_DDI.dmg in '%s' (run `%s -runFirstLaunch` and try again)", ddiPath, filepath.Join(xcode, "Contents/Developer/usr/bin/xcodebuild"))
-					}
-				}
-				ddiDMG := filepath.Join(xcode, "/Contents/Resources/CoreDeviceDDIs/iOS_DDI.dmg")
-				if _, err := os.Stat(ddiDMG); errors.Is(err, os.ErrNotExist) {
-					ddiDMG = "/Library/Developer/DeveloperDiskImages/iOS_DDI.dmg"
-					if _, err := os.Stat(ddiDMG); errors.Is(err, os.ErrNotExist) {
-						return fmt.Errorf("failed to find iOS_DDI.dmg in '%s' (install NEW XCode.app or Xcode-beta.app)", xcode)
-					}
-				}
-				utils.Indent(log.Info, 2)(fmt.Sprintf("Mounting %s", ddiDMG))
-				mountPoint, alreadyMounted, err := utils.MountDMG(ddiDMG)
-				if err != nil {
-					return fmt.Errorf("failed to mount iOS_DDI.dmg: %w", err)
-				}
-				if alreadyMounted {
-					utils.Indent(log.Info, 3)(fmt.Sprintf("%s already mounted", ddiDMG))
-				} else {
-					defer func() {
-						utils.Indent(log.Debug, 2)(fmt.Sprintf("Unmounting %s", ddiDMG))
-						if err := utils.Retry(3, 2*time.Second, func() error {
-							return utils.Unmount(mountPoint, false)
-						}); err != nil {
-							log.Errorf("failed to unmount %s at %s: %v", ddiDMG, mountPoint, err)
-						}
-					}()
-				}
-				manifestPath := filepath.Join(mountPoint, "Restore/BuildManifest.plist")
-				manifestData, err := os.ReadFile(manifestPath)
-				if err != nil {
-					return fmt.Errorf("failed to read BuildManifest.plist: %w", err)
-				}
-				buildManifest, err = plist.ParseBuildManifest(manifestData)
-				if err != nil {
-					return fmt.Errorf("failed to parse BuildManifest.plist: %w", err)
-				}
-				trustcachePath = filepath.Join(mountPoint, "Restore", buildManifest.BuildIdentities[0].Manifest["LoadableTrustCache"].Info["Path"].(string))
-				dmgPath = filepath.Join(mountPoint, "Restore", buildManifest.BuildIdentities[0].Manifest["PersonalizedDMG"].Info["Path"].(string))
-			}
-
-			if len(manifestPath) > 0 {
-				manifestData, err := os.ReadFile(manifestPath)
-				if err != nil {
-					return fmt.Errorf("failed to read BuildManifest.plist: %w", err)
-				}
-				buildManifest, err = plist.ParseBuildManifest(manifestData)
-				if err != nil {
-					return fmt.Errorf("failed to parse BuildManifest.plist: %w", err)
-				}
-			}
-
-			cli, err := mount.NewClient(dev.UniqueDeviceID)
-			if err != nil {
-				return fmt.Errorf("failed to connect to mobile_image_mounter: %w", err)
-			}
-			defer cli.Close()
-
-			if _, err := cli.LookupImage(imageType); err == nil {
-				log.Warnf("image type %s already mounted", imageType)
-				return nil
-			}
-
-			imgData, err := os.ReadFile(dmgPath)
-			if err != nil {
-				return fmt.Errorf("failed to read PersonalizedDMG: %w", err)
-			}
-
-			var sigData []byte
-			if len(signaturePath) > 0 {
-				sigData, err = os.ReadFile(signaturePath)
-				if err != nil {
-					return fmt.Errorf("failed to read signature '%s': %w", signaturePath, err)
-				}
-			} else {
-				digest := sha512.Sum384(imgData)
-				sigData, err = cli.PersonalizationManifest("DeveloperDiskImage", digest[:])
-				if err != nil {
-					log.Debugf("failed to get personalization manifest: %w", err)
-
-					nonce, err := cli.Nonce("DeveloperDiskImage")
-					if err != nil {
-						return fmt.Errorf("failed to get nonce: %w", err)
-					}
-
-					personalID, err := cli.PersonalizationIdentifiers("")
-					if err != nil {
-						log.Errorf("failed to get personalization identifiers: %v ('personalization' might not be supported on this device)", err)
-					}
-
-					personalID["ApNonce"] = nonce
-
-					sigData, err = tss.Personalize(&tss.PersonalConfig{
-						Proxy:         viper.GetString("idev.img.mount.proxy"),
-						Insecure:      viper.GetBool("idev.img.mount.insecure"),
-						PersonlID:     personalID,
-						BuildManifest: buildManifest,
-					})
-				}
-			}
-
-			log.Infof("Uploading %s image", imageType)
-			if err := cli.Upload(imageType, imgData, sigData); err != nil {
-				return fmt.Errorf("failed to upload image: %w", err)
-			}
-			log.Infof("Mounting %s image", imageType)
-			if err := cli.Mount(imageType, sigData, trustcachePath, manifestPath); err != nil {
-				return fmt.Errorf("failed to mount image: %w", err)
-			}
-		}
-
-		return nil
+		return mountDeveloperImage(dev, &mountOpts{
+			Xcode:          xcode,
+			DmgPath:        dmgPath,
+			TrustcachePath: trustcachePath,
+			ManifestPath:   manifestPath,
+			SignaturePath:  signaturePath,
+			ImageType:      imageType,
+			Proxy:          viper.GetString("idev.img.mount.proxy"),
+			Insecure:       viper.GetBool("idev.img.mount.insecure"),
+		})
 	},
 }
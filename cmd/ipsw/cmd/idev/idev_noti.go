@@ -25,7 +25,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/usb/notification"
@@ -38,14 +40,21 @@ import (
 func init() {
 	IDevCmd.AddCommand(NotificationCmd)
 
-	NotificationCmd.Flags().StringP("notification", "n", "", "notification to observe")
+	NotificationCmd.Flags().StringSliceP("notification", "n", []string{}, "notification(s) to observe")
 	NotificationCmd.Flags().BoolP("all", "a", false, "observe all notifications")
+	NotificationCmd.Flags().BoolP("wait", "w", false, "wait for notification(s) to be posted and then exit")
+	NotificationCmd.Flags().DurationP("timeout", "t", 0, "timeout for --wait (e.g. 5m)")
 }
 
 // NotificationCmd represents the noti command
 var NotificationCmd = &cobra.Command{
-	Use:           "noti",
-	Short:         "Observe notifications",
+	Use:   "noti",
+	Short: "Observe notifications",
+	Example: heredoc.Doc(`
+		# Observe a notification
+		❯ ipsw idev noti -n com.apple.mobile.application_installed
+		# Block until an app is installed (or 5 minutes have passed)
+		❯ ipsw idev noti --wait -n com.apple.mobile.application_installed --timeout 5m`),
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -56,8 +65,16 @@ var NotificationCmd = &cobra.Command{
 		color.NoColor = viper.GetBool("no-color")
 
 		udid, _ := cmd.Flags().GetString("udid")
-		notificationName, _ := cmd.Flags().GetString("notification")
+		notificationNames, _ := cmd.Flags().GetStringSlice("notification")
 		all, _ := cmd.Flags().GetBool("all")
+		wait, _ := cmd.Flags().GetBool("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if wait && (all || len(notificationNames) == 0) {
+			return fmt.Errorf("--wait requires --notification(s) and cannot be used with --all")
+		} else if !all && len(notificationNames) == 0 {
+			return fmt.Errorf("must supply --notification(s) or --all")
+		}
 
 		if len(udid) == 0 {
 			dev, err := utils.PickDevice()
@@ -73,19 +90,38 @@ var NotificationCmd = &cobra.Command{
 		}
 		defer cli.Close()
 
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if wait {
+			if timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			log.Infof("Waiting for %s", strings.Join(notificationNames, ", "))
+			name, err := cli.WaitFor(ctx, notificationNames...)
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					return fmt.Errorf("timed out waiting for notification(s)")
+				}
+				return fmt.Errorf("failed to wait for notification(s): %w", err)
+			}
+			log.Info(name)
+			return nil
+		}
+
 		if all {
 			if err := cli.ObserveAllNotifications(); err != nil {
 				return fmt.Errorf("failed to observe all notification: %w", err)
 			}
 		} else {
-			if err := cli.ObserveNotification(notificationName); err != nil {
-				return fmt.Errorf("failed to observe notification: %w", err)
+			for _, notificationName := range notificationNames {
+				if err := cli.ObserveNotification(notificationName); err != nil {
+					return fmt.Errorf("failed to observe notification: %w", err)
+				}
 			}
 		}
 
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
 		if err := ctrlc.Default.Run(ctx, func() error {
 			if err := cli.Listen(ctx); err != nil {
 				return fmt.Errorf("failed to listen for notifications: %w", err)
@@ -22,6 +22,8 @@ THE SOFTWARE.
 package idev
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -31,6 +33,7 @@ import (
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
 	"github.com/blacktop/ipsw/pkg/usb/screenshot"
+	"github.com/caarlos0/ctrlc"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -40,34 +43,101 @@ func init() {
 	IDevCmd.AddCommand(ScreenCmd)
 
 	ScreenCmd.Flags().StringP("output", "o", "", "Folder to save screenshot(s)")
+	ScreenCmd.Flags().StringP("format", "f", "png", "Screenshot format (png, jpeg, heic)")
+	ScreenCmd.Flags().BoolP("record", "r", false, "Record the screen as a sequence of frames")
+	ScreenCmd.Flags().DurationP("interval", "i", time.Second, "Interval between recorded frames")
+	ScreenCmd.Flags().DurationP("duration", "d", 0, "Recording duration (default: until Ctrl+C)")
 	ScreenCmd.MarkFlagDirname("output")
+	ScreenCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"png", "jpeg", "heic"}, cobra.ShellCompDirectiveNoFileComp
+	})
 }
 
-func saveScreenshot(dev *lockdownd.DeviceValues, destPath string) error {
+type screenOpts struct {
+	Output   string
+	Format   screenshot.Format
+	Record   bool
+	Interval time.Duration
+	Duration time.Duration
+}
+
+func screenshotFolder(dev *lockdownd.DeviceValues, destPath string) (string, error) {
+	folder := filepath.Join(destPath, fmt.Sprintf("%s_%s_%s", dev.ProductType, dev.HardwareModel, dev.BuildVersion))
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return "", fmt.Errorf("failed to create screenshot directory %s: %w", folder, err)
+	}
+	return folder, nil
+}
+
+func saveScreenshot(dev *lockdownd.DeviceValues, opts *screenOpts) error {
 	cli, err := screenshot.NewClient(dev.UniqueDeviceID)
 	if err != nil {
 		return fmt.Errorf("failed to connect to iDevice with UUID %s: %w", dev.UniqueDeviceID, err)
 	}
 	defer cli.Close()
 
-	png, err := cli.Screenshot()
+	folder, err := screenshotFolder(dev, opts.Output)
 	if err != nil {
-		return fmt.Errorf("failed to get screenshot: %w", err)
+		return err
 	}
 
-	fname := fmt.Sprintf("screenshot_%s.png", time.Now().Format("02Jan2006_15:04:05MST"))
-	fname = filepath.Join(destPath, fmt.Sprintf("%s_%s_%s", dev.ProductType, dev.HardwareModel, dev.BuildVersion), fname)
-	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
-		return fmt.Errorf("failed to create screenshot directory %s: %w", filepath.Dir(fname), err)
+	if opts.Record {
+		return recordScreen(cli, folder, opts)
 	}
+
+	img, err := cli.ScreenshotAs(opts.Format)
+	if err != nil {
+		return fmt.Errorf("failed to get screenshot: %w", err)
+	}
+
+	fname := filepath.Join(folder, fmt.Sprintf("screenshot_%s%s", time.Now().Format("02Jan2006_15:04:05MST"), opts.Format.Ext()))
 	log.Infof("Creating screenshot: %s", fname)
-	return os.WriteFile(fname, png, 0660)
+	return os.WriteFile(fname, img, 0660)
+}
+
+func recordScreen(cli *screenshot.Client, folder string, opts *screenOpts) error {
+	folder = filepath.Join(folder, fmt.Sprintf("recording_%s", time.Now().Format("02Jan2006_15:04:05MST")))
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return fmt.Errorf("failed to create recording directory %s: %w", folder, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if opts.Duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	log.Infof("Recording screen to: %s (press Ctrl+C to stop)", folder)
+	if err := ctrlc.Default.Run(ctx, func() error {
+		return cli.Record(ctx, opts.Interval, func(frame int, data []byte) error {
+			img, err := screenshot.Convert(data, opts.Format)
+			if err != nil {
+				return err
+			}
+			fname := filepath.Join(folder, fmt.Sprintf("frame_%05d%s", frame, opts.Format.Ext()))
+			log.Debugf("Saving frame: %s", fname)
+			return os.WriteFile(fname, img, 0660)
+		})
+	}); err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded): // the --duration timer
+			log.Infof("Stopped recording after %s", opts.Duration)
+		case errors.As(err, &ctrlc.ErrorCtrlC{}), errors.Is(err, context.Canceled):
+			log.Warn("Stopped recording")
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
 // ScreenCmd represents the screen command
 var ScreenCmd = &cobra.Command{
 	Use:           "screen",
-	Short:         "Dump screenshot as a PNG",
+	Aliases:       []string{"screenshot"},
+	Short:         "Dump screenshot (or record the screen)",
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -79,6 +149,22 @@ var ScreenCmd = &cobra.Command{
 
 		udid, _ := cmd.Flags().GetString("udid")
 		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		record, _ := cmd.Flags().GetBool("record")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		duration, _ := cmd.Flags().GetDuration("duration")
+
+		imgFormat, err := screenshot.ParseFormat(format)
+		if err != nil {
+			return err
+		}
+		opts := &screenOpts{
+			Output:   output,
+			Format:   imgFormat,
+			Record:   record,
+			Interval: interval,
+			Duration: duration,
+		}
 
 		if len(udid) > 0 {
 			ldc, err := lockdownd.NewClient(udid)
@@ -101,7 +187,7 @@ var ScreenCmd = &cobra.Command{
 				return fmt.Errorf("for device %s: ensure Developer Mode is enabled on iOS16+ AND %w", dev.UniqueDeviceID, err)
 			}
 
-			return saveScreenshot(dev, output)
+			return saveScreenshot(dev, opts)
 		} else {
 			devs, err := utils.PickDevices()
 			if err != nil {
@@ -118,7 +204,7 @@ var ScreenCmd = &cobra.Command{
 					return fmt.Errorf("for device %s: ensure Developer Mode is enabled on iOS16+ AND %w", dev.UniqueDeviceID, err)
 				}
 
-				if err := saveScreenshot(dev, output); err != nil {
+				if err := saveScreenshot(dev, opts); err != nil {
 					return fmt.Errorf("failed to save screenshot: %w", err)
 				}
 			}
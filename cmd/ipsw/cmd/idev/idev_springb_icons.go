@@ -0,0 +1,137 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package idev
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/usb/springboard"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	SpringbCmd.AddCommand(idevSpringbIconsCmd)
+
+	idevSpringbIconsCmd.Flags().BoolP("json", "j", false, "Display icon state as JSON")
+	idevSpringbIconsCmd.Flags().StringP("wait", "w", "", "Wait for the icon of the given bundle ID to appear on the home screen")
+	idevSpringbIconsCmd.Flags().DurationP("timeout", "t", 0, "Timeout for --wait (e.g. 5m)")
+	idevSpringbIconsCmd.Flags().Duration("interval", time.Second, "Polling interval for --wait")
+}
+
+// idevSpringbIconsCmd represents the icons command
+var idevSpringbIconsCmd = &cobra.Command{
+	Use:   "icons",
+	Short: "List home screen icons",
+	Example: heredoc.Doc(`
+		# List all the app icons on the home screen
+		❯ ipsw idev springb icons
+		# Block until an app's icon appears on the home screen (i.e. the install finished)
+		❯ ipsw idev springb icons --wait com.example.app --timeout 5m`),
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		udid, _ := cmd.Flags().GetString("udid")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		waitFor, _ := cmd.Flags().GetString("wait")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		if len(udid) == 0 {
+			dev, err := utils.PickDevice()
+			if err != nil {
+				return fmt.Errorf("failed to pick USB connected devices: %w", err)
+			}
+			udid = dev.UniqueDeviceID
+		}
+
+		cli, err := springboard.NewClient(udid)
+		if err != nil {
+			return fmt.Errorf("failed to connect to springboard: %w", err)
+		}
+		defer cli.Close()
+
+		if len(waitFor) > 0 {
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			log.Infof("Waiting for %s", waitFor)
+			if err := cli.WaitForIcon(ctx, waitFor, interval); err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					return fmt.Errorf("timed out waiting for %s", waitFor)
+				}
+				return err
+			}
+			log.Infof("%s is on the home screen", waitFor)
+			return nil
+		}
+
+		if asJSON {
+			pages, err := cli.GetIconState()
+			if err != nil {
+				return fmt.Errorf("failed to get icon state: %w", err)
+			}
+			dat, err := json.Marshal(pages)
+			if err != nil {
+				return fmt.Errorf("failed to marshal icon state to JSON: %w", err)
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		icons, err := cli.ListIcons()
+		if err != nil {
+			return fmt.Errorf("failed to get icon state: %w", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		for _, icon := range icons {
+			id := icon.BundleIdentifier
+			if len(id) == 0 {
+				id = icon.DisplayIdentifier
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", color.New(color.Bold).Sprint(icon.DisplayName), id, color.New(color.Faint).Sprint(icon.BundleVersion))
+		}
+		w.Flush()
+
+		return nil
+	},
+}
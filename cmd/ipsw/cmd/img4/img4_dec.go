@@ -30,6 +30,7 @@ import (
 	"github.com/apex/log"
 	icmd "github.com/blacktop/ipsw/internal/commands/img4"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/img4"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -41,11 +42,14 @@ func init() {
 	img4DecCmd.Flags().String("iv-key", "", "AES iv+key")
 	img4DecCmd.Flags().StringP("iv", "i", "", "AES iv")
 	img4DecCmd.Flags().StringP("key", "k", "", "AES key")
+	img4DecCmd.Flags().StringP("key-db", "b", "", "Key database JSON (from 'ipsw download keys --output') to look up the KBAG's iv/key")
 	img4DecCmd.Flags().StringP("output", "o", "", "Output folder")
 	img4DecCmd.MarkFlagDirname("output")
+	img4DecCmd.MarkFlagFilename("key-db", "json")
 	viper.BindPFlag("img4.dec.iv-key", img4DecCmd.Flags().Lookup("iv-key"))
 	viper.BindPFlag("img4.dec.iv", img4DecCmd.Flags().Lookup("iv"))
 	viper.BindPFlag("img4.dec.key", img4DecCmd.Flags().Lookup("key"))
+	viper.BindPFlag("img4.dec.key-db", img4DecCmd.Flags().Lookup("key-db"))
 	viper.BindPFlag("img4.dec.output", img4DecCmd.Flags().Lookup("output"))
 }
 
@@ -66,12 +70,13 @@ var img4DecCmd = &cobra.Command{
 		ivkeyStr := viper.GetString("img4.dec.iv-key")
 		ivStr := viper.GetString("img4.dec.iv")
 		keyStr := viper.GetString("img4.dec.key")
+		keyDB := viper.GetString("img4.dec.key-db")
 		outputDir := viper.GetString("img4.dec.output")
 		// validate flags
 		if len(ivkeyStr) != 0 && (len(ivStr) != 0 || len(keyStr) != 0) {
 			return fmt.Errorf("cannot specify both --iv-key AND --iv/--key")
-		} else if len(ivkeyStr) == 0 && (len(ivStr) == 0 || len(keyStr) == 0) {
-			return fmt.Errorf("must specify either --iv-key OR --iv/--key")
+		} else if len(keyDB) != 0 && (len(ivkeyStr) != 0 || len(ivStr) != 0 || len(keyStr) != 0) {
+			return fmt.Errorf("cannot specify both --key-db AND --iv-key or --iv/--key")
 		}
 
 		infile := filepath.Clean(args[0])
@@ -84,7 +89,27 @@ var img4DecCmd = &cobra.Command{
 		var iv []byte
 		var key []byte
 
-		if len(ivkeyStr) != 0 {
+		if len(ivkeyStr) == 0 && (len(ivStr) == 0 || len(keyStr) == 0) {
+			im4p, err := img4.OpenIm4p(infile)
+			if err != nil {
+				return fmt.Errorf("failed to parse im4p: %v", err)
+			}
+			if !im4p.Encrypted() {
+				return fmt.Errorf("%s payload is not encrypted (use 'ipsw img4 extract' instead)", infile)
+			}
+			if len(keyDB) == 0 {
+				return fmt.Errorf("must specify either --iv-key OR --iv/--key OR --key-db: %w", im4p.CheckEncrypted(filepath.Base(infile)))
+			}
+			db, err := img4.OpenKeyDB(keyDB)
+			if err != nil {
+				return err
+			}
+			iv, key, err = db.Lookup(im4p, infile)
+			if err != nil {
+				return err
+			}
+			utils.Indent(log.Debug, 2)(fmt.Sprintf("Found key in %s", keyDB))
+		} else if len(ivkeyStr) != 0 {
 			ivkey, err := hex.DecodeString(ivkeyStr)
 			if err != nil {
 				return fmt.Errorf("failed to decode --iv-key: %v", err)
@@ -31,6 +31,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/complete"
 	"github.com/blacktop/ipsw/internal/download"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/dustin/go-humanize"
@@ -53,9 +54,7 @@ func init() {
 	viper.BindPFlag("info.json", infoCmd.Flags().Lookup("json"))
 
 	infoCmd.MarkZshCompPositionalArgumentFile(1, "*.ipsw", "*.zip")
-	infoCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"ipsw", "zip"}, cobra.ShellCompDirectiveFilterFileExt
-	}
+	infoCmd.ValidArgsFunction = complete.Firmware("ipsw", "zip")
 }
 
 // infoCmd represents the info command
@@ -0,0 +1,221 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/jetsam"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(jetsamCmd)
+
+	jetsamCmd.Flags().StringP("class", "c", "", "Only show this device class (i.e. D73)")
+	jetsamCmd.Flags().StringP("proc", "p", "", "Only show processes that contain this string")
+	jetsamCmd.Flags().BoolP("jobs", "j", false, "Show the launchd jobs' task roles (ProcessType)")
+	jetsamCmd.Flags().Bool("json", false, "Output as JSON")
+	jetsamCmd.Flags().StringP("output", "o", "", "Save the config (or diff) as JSON to this file")
+	jetsamCmd.Flags().String("pem-db", "", "AEA pem DB JSON file")
+	viper.BindPFlag("jetsam.class", jetsamCmd.Flags().Lookup("class"))
+	viper.BindPFlag("jetsam.proc", jetsamCmd.Flags().Lookup("proc"))
+	viper.BindPFlag("jetsam.jobs", jetsamCmd.Flags().Lookup("jobs"))
+	viper.BindPFlag("jetsam.json", jetsamCmd.Flags().Lookup("json"))
+	viper.BindPFlag("jetsam.output", jetsamCmd.Flags().Lookup("output"))
+	viper.BindPFlag("jetsam.pem-db", jetsamCmd.Flags().Lookup("pem-db"))
+}
+
+func saveJetsamJSON(v any) error {
+	dat, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if output := viper.GetString("jetsam.output"); output != "" {
+		log.Infof("Saving %s", output)
+		return os.WriteFile(output, dat, 0o660)
+	}
+	fmt.Println(string(dat))
+	return nil
+}
+
+// filterJetsam removes the device classes and processes that don't match the --class and --proc flags
+func filterJetsam(c *jetsam.Config) {
+	class, proc := viper.GetString("jetsam.class"), viper.GetString("jetsam.proc")
+	for dc, props := range c.Properties {
+		if class != "" && !strings.EqualFold(dc, class) {
+			delete(c.Properties, dc)
+			continue
+		}
+		if proc == "" {
+			continue
+		}
+		for _, cat := range props.Categories {
+			for name := range cat.Overrides {
+				if !strings.Contains(name, proc) {
+					delete(cat.Overrides, name)
+				}
+			}
+		}
+	}
+	if proc != "" {
+		for label := range c.Jobs {
+			if !strings.Contains(label, proc) {
+				delete(c.Jobs, label)
+			}
+		}
+	}
+}
+
+func jetsamProps(props map[string]any) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var out []string
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s=%s", k, colorValue(fmt.Sprint(props[k]))))
+	}
+	return strings.Join(out, " ")
+}
+
+func printJetsamChanges(title string, changes []jetsam.Change) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (%d)\n", title, len(changes))
+	for _, c := range changes {
+		var where []string
+		for _, s := range []string{c.DeviceClass, c.Category} {
+			if s != "" {
+				where = append(where, s)
+			}
+		}
+		if len(c.Property) == 0 {
+			fmt.Printf("  [%s] %s\n", strings.Join(where, "/"), colorBin(c.Process))
+		} else if len(where) == 0 {
+			fmt.Printf("  %s %s\n", colorBin(c.Process), c)
+		} else {
+			fmt.Printf("  [%s] %s %s\n", strings.Join(where, "/"), colorBin(c.Process), c)
+		}
+	}
+}
+
+// jetsamCmd represents the jetsam command
+var jetsamCmd = &cobra.Command{
+	Use:   "jetsam <IPSW|FOLDER> [<IPSW|FOLDER>]",
+	Short: "Parse (or diff) the jetsam priority bands, memory limits and task roles of a build",
+	Example: heredoc.Doc(`
+		# Show the jetsam properties of every device class in an IPSW
+		❯ ipsw jetsam iPhone17,1_18.0_22A3354_Restore.ipsw
+		# Show a process' limits (and task role) on a single device class of a mounted filesystem
+		❯ ipsw jetsam /Volumes/SkyF22A5282m.D8xOS --class D83 --proc com.apple.mediaserverd --jobs
+		# Diff the jetsam config of two builds
+		❯ ipsw jetsam <old.ipsw> <new.ipsw> --output jetsam_diff.json`),
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		asJSON := viper.GetBool("jetsam.json") || viper.GetString("jetsam.output") != ""
+
+		prev, err := jetsam.Parse(filepath.Clean(args[0]), viper.GetString("jetsam.pem-db"))
+		if err != nil {
+			return err
+		}
+		filterJetsam(prev)
+
+		if len(args) == 1 {
+			if !viper.GetBool("jetsam.jobs") {
+				prev.Jobs = nil
+			}
+			if asJSON {
+				return saveJetsamJSON(prev)
+			}
+			if len(prev.Properties) == 0 && len(prev.Jobs) == 0 {
+				log.Warn("No jetsam config found")
+				return nil
+			}
+			for _, class := range prev.DeviceClasses() {
+				props := prev.Properties[class]
+				fmt.Printf("%s (version %s)\n", colorBin(class), props.Version)
+				for _, name := range props.SortedCategories() {
+					cat := props.Categories[name]
+					fmt.Printf("  %s %s\n", colorKey(name), jetsamProps(cat.Defaults))
+					for _, proc := range cat.Processes() {
+						fmt.Printf("    %s %s\n", proc, jetsamProps(cat.Overrides[proc]))
+					}
+				}
+			}
+			if len(prev.Jobs) > 0 {
+				fmt.Printf("\n%s\n", colorKey("Task Roles"))
+				for _, label := range prev.Labels() {
+					job := prev.Jobs[label]
+					fmt.Println(strings.TrimRight(fmt.Sprintf("  %s %s %s", colorBin(label), colorValue(job.ProcessType), jetsamProps(job.Jetsam)), " "))
+				}
+			}
+			return nil
+		}
+
+		next, err := jetsam.Parse(filepath.Clean(args[1]), viper.GetString("jetsam.pem-db"))
+		if err != nil {
+			return err
+		}
+		filterJetsam(next)
+		d := jetsam.Compare(prev, next)
+
+		if asJSON {
+			return saveJetsamJSON(d)
+		}
+		if d.Empty() {
+			log.Info("No jetsam config changed")
+			return nil
+		}
+		for _, class := range d.NewDeviceClasses {
+			fmt.Printf("🆕 NEW device class %s\n", colorBin(class))
+		}
+		for _, class := range d.RemovedDeviceClasses {
+			fmt.Printf("❌ Removed device class %s\n", colorBin(class))
+		}
+		printJetsamChanges("🆕 NEW Processes", d.NewProcesses)
+		printJetsamChanges("❌ Removed Processes", d.RemovedProcesses)
+		printJetsamChanges("⬆️ Changed", d.Changed)
+		printJetsamChanges("Task Roles", d.Jobs)
+
+		return nil
+	},
+}
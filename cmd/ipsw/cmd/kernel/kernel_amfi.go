@@ -0,0 +1,140 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelAmfiCmd)
+	kernelAmfiCmd.Flags().BoolP("diff", "d", false, "Diff two kernel's AMFI trust caches and allowlists")
+	kernelAmfiCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelAmfiCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func getAMFI(kernelPath string) (*kernelcache.AMFI, error) {
+	m, err := kernelcache.Open(filepath.Clean(kernelPath))
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetAMFI(m)
+}
+
+// kernelAmfiCmd represents the amfi command
+var kernelAmfiCmd = &cobra.Command{
+	Use:   "amfi <kernelcache> [kernelcache]",
+	Short: "Dump AMFI's embedded trust caches and hardcoded allowlists",
+	Example: heredoc.Doc(`
+		# Dump the CDHashes and entitlements hardcoded in AppleMobileFileIntegrity
+		❯ ipsw kernel amfi kernelcache.release.iPhone15,2
+		# Diff them between two builds
+		❯ ipsw kernel amfi --diff kernelcache.release.iPhone15,2_22A kernelcache.release.iPhone15,2_22B`),
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		diff, _ := cmd.Flags().GetBool("diff")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		if diff {
+			if len(args) < 2 {
+				return fmt.Errorf("please provide two kernelcache files to diff")
+			}
+			amfi1, err := getAMFI(args[0])
+			if err != nil {
+				return err
+			}
+			amfi2, err := getAMFI(args[1])
+			if err != nil {
+				return err
+			}
+			out, err := utils.GitDiff(
+				strings.Join(amfi1.Lines(), "\n"),
+				strings.Join(amfi2.Lines(), "\n"),
+				&utils.GitDiffConfig{Color: viper.GetBool("color") && !viper.GetBool("no-color"), Tool: viper.GetString("diff-tool")})
+			if err != nil {
+				return err
+			}
+			if len(out) == 0 {
+				log.Info("No differences found")
+				return nil
+			}
+			log.Info("Differences found")
+			fmt.Println(out)
+			return nil
+		}
+
+		amfi, err := getAMFI(args[0])
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(amfi)
+		}
+
+		for _, tc := range amfi.TrustCaches {
+			log.WithFields(log.Fields{
+				"addr":    fmt.Sprintf("%#x", tc.Addr),
+				"section": tc.Section,
+				"version": tc.Version,
+				"uuid":    tc.UUID,
+				"entries": len(tc.Entries),
+			}).Info("Trust Cache")
+			for _, e := range tc.Entries {
+				fmt.Printf("%s %s\n", e.CDHash, color.New(color.Faint).Sprintf("type=%d flags=%d category=%d", e.HashType, e.Flags, e.ConstraintCategory))
+			}
+		}
+		for _, al := range amfi.Allowlists {
+			log.WithFields(log.Fields{
+				"addr":    fmt.Sprintf("%#x", al.Addr),
+				"section": al.Section,
+				"entries": len(al.Entries),
+			}).Infof("Allowlist (%s)", al.Kind)
+			for _, e := range al.Entries {
+				fmt.Println(e)
+			}
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorAdded = color.New(color.FgGreen).SprintFunc()
+var colorRemoved = color.New(color.FgRed).SprintFunc()
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelBootArgsCmd)
+	kernelBootArgsCmd.Flags().Bool("iboot", false, "Input is a decrypted iBoot (parse its environment variables)")
+	kernelBootArgsCmd.Flags().String("diff", "", "Diff the boot-args against another kernelcache (or iBoot)")
+	kernelBootArgsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelBootArgsCmd.MarkFlagFilename("diff")
+	viper.BindPFlag("kernel.bootargs.iboot", kernelBootArgsCmd.Flags().Lookup("iboot"))
+	viper.BindPFlag("kernel.bootargs.diff", kernelBootArgsCmd.Flags().Lookup("diff"))
+	viper.BindPFlag("kernel.bootargs.json", kernelBootArgsCmd.Flags().Lookup("json"))
+	kernelBootArgsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func getBootArgs(path string, iboot bool) ([]kernelcache.BootArg, error) {
+	if iboot {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read iBoot: %w", err)
+		}
+		return kernelcache.GetIBootBootArgs(data)
+	}
+	m, err := kernelcache.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetBootArgs(m)
+}
+
+// kernelBootArgsCmd represents the bootargs command
+var kernelBootArgsCmd = &cobra.Command{
+	Use:     "bootargs <kernelcache>",
+	Aliases: []string{"ba"},
+	Short:   "List the boot-args the kernelcache (or iBoot) parses",
+	Example: heredoc.Doc(`
+		# List the boot-args and the functions that parse them
+		❯ ipsw kernel bootargs kernelcache.release.iPhone15,2
+		# List the environment variables a decrypted iBoot parses
+		❯ ipsw kernel bootargs --iboot iBoot.d73.RELEASE.bin
+		# Show the boot-args that were added/removed between builds
+		❯ ipsw kernel bootargs kernelcache.release.iPhone15,2 --diff 21A329/kernelcache.release.iPhone15,2`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		iboot := viper.GetBool("kernel.bootargs.iboot")
+
+		bootArgs, err := getBootArgs(filepath.Clean(args[0]), iboot)
+		if err != nil {
+			return err
+		}
+
+		if other := viper.GetString("kernel.bootargs.diff"); len(other) > 0 {
+			prev, err := getBootArgs(filepath.Clean(other), iboot)
+			if err != nil {
+				return err
+			}
+			diff := kernelcache.DiffBootArgs(prev, bootArgs)
+			if viper.GetBool("kernel.bootargs.json") {
+				dat, err := json.MarshalIndent(diff, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(dat))
+				return nil
+			}
+			if len(diff.New) == 0 && len(diff.Removed) == 0 {
+				log.Info("No boot-arg changes")
+				return nil
+			}
+			for _, name := range diff.New {
+				fmt.Println(colorAdded("+ " + name))
+			}
+			for _, name := range diff.Removed {
+				fmt.Println(colorRemoved("- " + name))
+			}
+			return nil
+		}
+
+		if viper.GetBool("kernel.bootargs.json") {
+			dat, err := json.MarshalIndent(bootArgs, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		for _, ba := range bootArgs {
+			caller := ba.CallerName
+			if len(caller) == 0 && ba.Caller > 0 {
+				caller = fmt.Sprintf("func_%x", ba.Caller)
+			}
+			if len(ba.Entry) > 0 {
+				caller = ba.Entry + " " + caller
+			}
+			fmt.Printf("%-32s %s\t%s %s\n", ba.Name, colorHash(fmt.Sprintf("%#x", ba.Call)), ba.Parser, caller)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelBootDataCmd)
+	kernelBootDataCmd.Flags().String("diff", "", "Diff the tunables against another kernelcache")
+	kernelBootDataCmd.Flags().String("boot-args", "", "Parse a boot_args structure dumped from memory instead")
+	kernelBootDataCmd.Flags().BoolP("startup", "s", false, "Also list the STARTUP() entries")
+	kernelBootDataCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelBootDataCmd.MarkFlagFilename("diff")
+	kernelBootDataCmd.MarkFlagFilename("boot-args")
+	viper.BindPFlag("kernel.bootdata.diff", kernelBootDataCmd.Flags().Lookup("diff"))
+	viper.BindPFlag("kernel.bootdata.boot-args", kernelBootDataCmd.Flags().Lookup("boot-args"))
+	viper.BindPFlag("kernel.bootdata.startup", kernelBootDataCmd.Flags().Lookup("startup"))
+	viper.BindPFlag("kernel.bootdata.json", kernelBootDataCmd.Flags().Lookup("json"))
+	kernelBootDataCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func getBootData(path string) (*kernelcache.BootData, error) {
+	m, err := kernelcache.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetBootData(m)
+}
+
+// printBootData prints the __BOOTDATA sections and tunables (sorted by name so the output is diffable)
+func printBootData(bd *kernelcache.BootData, startup bool) {
+	fmt.Println("__BOOTDATA")
+	fmt.Println("==========")
+	for _, sec := range bd.Sections {
+		fmt.Printf("%s: %-20s %s\n", colorHash(fmt.Sprintf("%#x", sec.Addr)), sec.Name, colorHash(fmt.Sprintf("size=%#x", sec.Size)))
+	}
+	fmt.Printf("\nTunables (%d)\n", len(bd.Tunables))
+	fmt.Println("========")
+	for _, t := range bd.Tunables {
+		var dt string
+		if len(t.DTPath) > 0 {
+			dt = colorHash(" dt=" + t.DTPath)
+		}
+		fmt.Printf("%-40s %s%s\n", t.Name, t.Default, dt)
+	}
+	if startup {
+		fmt.Printf("\nStartup (%d)\n", len(bd.Startup))
+		fmt.Println("=======")
+		for _, e := range bd.Startup {
+			name := e.FuncName
+			if len(name) == 0 {
+				name = fmt.Sprintf("func_%x", e.Func)
+			}
+			fmt.Printf("subsystem=%-3d rank=%-10d %s %s\n", e.Subsystem, e.Rank, colorHash(fmt.Sprintf("%#x", e.Func)), name)
+		}
+	}
+}
+
+// kernelBootDataCmd represents the bootdata command
+var kernelBootDataCmd = &cobra.Command{
+	Use:     "bootdata <kernelcache>",
+	Aliases: []string{"bd"},
+	Short:   "Dump the kernel's __BOOTDATA and early-boot tunables",
+	Example: heredoc.Doc(`
+		# List the TUNABLE() boot-args and their compiled-in defaults
+		❯ ipsw kernel bootdata kernelcache.release.iPhone15,2
+		# Show the tunables that were added/removed/changed between builds
+		❯ ipsw kernel bootdata kernelcache.release.iPhone15,2 --diff 21A329/kernelcache.release.iPhone15,2
+		# Parse a boot_args structure dumped over KDP
+		❯ ipsw kernel bootdata --boot-args boot_args.bin`),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(viper.GetString("kernel.bootdata.boot-args")) > 0 {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		asJSON := viper.GetBool("kernel.bootdata.json")
+
+		if dump := viper.GetString("kernel.bootdata.boot-args"); len(dump) > 0 {
+			f, err := os.Open(filepath.Clean(dump))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			ba, err := kernelcache.ParseBootArgs(f)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printJSON(ba)
+			}
+			fmt.Printf("Revision:        %d (version %d)\n", ba.Revision, ba.Version)
+			fmt.Printf("VirtBase:        %#x\n", ba.VirtBase)
+			fmt.Printf("PhysBase:        %#x\n", ba.PhysBase)
+			fmt.Printf("MemSize:         %#x (actual %#x)\n", ba.MemSize, ba.MemSizeActual)
+			fmt.Printf("TopOfKernelData: %#x\n", ba.TopOfKernelData)
+			fmt.Printf("Video:           %dx%d depth=%d row_bytes=%d base=%#x\n", ba.Video.Width, ba.Video.Height, ba.Video.Depth, ba.Video.RowBytes, ba.Video.BaseAddr)
+			fmt.Printf("MachineType:     %d\n", ba.MachineType)
+			fmt.Printf("DeviceTree:      %#x (%d bytes)\n", ba.DeviceTree, ba.DeviceTreeLength)
+			fmt.Printf("BootFlags:       %#x\n", ba.BootFlags)
+			fmt.Printf("CommandLine:     %s\n", ba.CommandLine)
+			return nil
+		}
+
+		bd, err := getBootData(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+
+		if other := viper.GetString("kernel.bootdata.diff"); len(other) > 0 {
+			prev, err := getBootData(filepath.Clean(other))
+			if err != nil {
+				return err
+			}
+			diff := kernelcache.DiffBootData(prev, bd)
+			if asJSON {
+				return printJSON(diff)
+			}
+			if len(diff.New) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 {
+				log.Info("No tunable changes")
+				return nil
+			}
+			for _, t := range diff.New {
+				fmt.Println(colorAdded("+ " + t.String()))
+			}
+			for _, t := range diff.Removed {
+				fmt.Println(colorRemoved("- " + t.String()))
+			}
+			for _, c := range diff.Changed {
+				fmt.Printf("~ %s: %s → %s\n", c[1].Name, colorRemoved(c[0].Default), colorAdded(c[1].Default))
+			}
+			return nil
+		}
+
+		if asJSON {
+			return printJSON(bd)
+		}
+		printBootData(bd, viper.GetBool("kernel.bootdata.startup"))
+		return nil
+	},
+}
@@ -83,6 +83,10 @@ var ctfdumpCmd = &cobra.Command{
 		if _, err := os.Stat(machoPath); os.IsNotExist(err) {
 			return fmt.Errorf("file %s does not exist", machoPath)
 		}
+		machoPath, err := kernelcache.DecompressedPath(machoPath)
+		if err != nil {
+			return err
+		}
 
 		// first check for fat file
 		fat, err := macho.OpenFat(machoPath)
@@ -152,6 +156,10 @@ var ctfdumpCmd = &cobra.Command{
 			if _, err := os.Stat(machoPath2); os.IsNotExist(err) {
 				return fmt.Errorf("file %s does not exist", machoPath2)
 			}
+			machoPath2, err := kernelcache.DecompressedPath(machoPath2)
+			if err != nil {
+				return err
+			}
 
 			// first check for fat file
 			fat2, err := macho.OpenFat(machoPath2)
@@ -252,18 +260,18 @@ var ctfdumpCmd = &cobra.Command{
 				if prettyJSON {
 					b, err = json.MarshalIndent(c, "", "    ")
 					if err != nil {
-						return fmt.Errorf("failed to marshal function as JSON: %v", err)
+						return fmt.Errorf("failed to marshal function as JSON: %w", err)
 					}
 				} else {
 					b, err = json.Marshal(c)
 					if err != nil {
-						return fmt.Errorf("failed to marshal function as JSON: %v", err)
+						return fmt.Errorf("failed to marshal function as JSON: %w", err)
 					}
 				}
 
 				kver, err := kernelcache.GetVersion(m)
 				if err != nil {
-					return fmt.Errorf("failed to get kernel version: %v", err)
+					return fmt.Errorf("failed to get kernel version: %w", err)
 				}
 
 				cwd, _ := os.Getwd()
@@ -0,0 +1,187 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/blacktop/ipsw/pkg/devicetree"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorProtected = color.New(color.FgGreen).SprintFunc()
+var colorPartial = color.New(color.FgYellow).SprintFunc()
+var colorWritable = color.New(color.Bold, color.FgRed).SprintFunc()
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelCtrrCmd)
+	kernelCtrrCmd.Flags().BoolP("kexts", "k", false, "Include the segments of each KEXT (MH_FILESET kernelcaches)")
+	kernelCtrrCmd.Flags().StringP("dtree", "d", "", "DeviceTree to read the CTRR/KTRR lock registers from")
+	kernelCtrrCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelCtrrCmd.MarkFlagFilename("dtree")
+	viper.BindPFlag("kernel.ctrr.kexts", kernelCtrrCmd.Flags().Lookup("kexts"))
+	viper.BindPFlag("kernel.ctrr.dtree", kernelCtrrCmd.Flags().Lookup("dtree"))
+	viper.BindPFlag("kernel.ctrr.json", kernelCtrrCmd.Flags().Lookup("json"))
+	kernelCtrrCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func parseDeviceTree(path string) (*devicetree.DeviceTree, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DeviceTree: %w", err)
+	}
+	if ok, _ := magic.IsIm4p(path); ok {
+		return devicetree.ParseImg4Data(content)
+	}
+	return devicetree.ParseData(bytes.NewReader(content))
+}
+
+// kernelCtrrCmd represents the ctrr command
+var kernelCtrrCmd = &cobra.Command{
+	Use:     "ctrr <kernelcache>",
+	Aliases: []string{"kip", "ktrr"},
+	Short:   "Report the KTRR/CTRR protected regions of the kernelcache",
+	Example: heredoc.Doc(`
+		# Show the protected ranges and which segments fall inside them
+		❯ ipsw kernel ctrr kernelcache.release.iPhone15,2
+		# Include each KEXT's segments and the DeviceTree's lock registers
+		❯ ipsw kernel ctrr kernelcache.release.iPhone15,2 --kexts --dtree DeviceTree.d73ap.im4p`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		regions, err := kernelcache.GetProtectedRegions(m)
+		if err != nil {
+			return err
+		}
+		if !viper.GetBool("kernel.ctrr.kexts") {
+			var segs []kernelcache.SegmentProtection
+			for _, seg := range regions.Segments {
+				if seg.Entry == "" {
+					segs = append(segs, seg)
+				}
+			}
+			regions.Segments = segs
+		}
+
+		var lockRegs map[string]devicetree.Properties
+		if dtPath := viper.GetString("kernel.ctrr.dtree"); len(dtPath) > 0 {
+			dtree, err := parseDeviceTree(filepath.Clean(dtPath))
+			if err != nil {
+				return err
+			}
+			if lockRegs, err = dtree.GetLockRegs(); err != nil {
+				return fmt.Errorf("failed to get CTRR/KTRR lock registers: %w", err)
+			}
+		}
+
+		if viper.GetBool("kernel.ctrr.json") {
+			dat, err := json.MarshalIndent(struct {
+				*kernelcache.ProtectedRegions
+				LockRegs map[string]devicetree.Properties `json:"lock_regs,omitempty"`
+			}{regions, lockRegs}, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		fmt.Println("Protected Ranges")
+		fmt.Println("================")
+		for _, r := range regions.Ranges {
+			fmt.Printf("%-5s %#016x-%#016x (%#x)\n", r.Name, r.Start, r.End, r.End-r.Start)
+		}
+		fmt.Println()
+		fmt.Println("Segments")
+		fmt.Println("========")
+		for _, seg := range regions.Segments {
+			name := seg.Name
+			if len(seg.Entry) > 0 {
+				name = seg.Entry + "." + seg.Name
+			}
+			var status string
+			switch {
+			case seg.Writable():
+				status = colorWritable("writable in " + strings.Join(append(seg.Protected, seg.Partial...), ","))
+			case len(seg.Partial) > 0:
+				status = colorPartial("partially in " + strings.Join(seg.Partial, ","))
+				if len(seg.Protected) > 0 {
+					status = colorProtected(strings.Join(seg.Protected, ",")) + " " + status
+				}
+			case len(seg.Protected) > 0:
+				status = colorProtected(strings.Join(seg.Protected, ","))
+			default:
+				status = colorHash("unprotected")
+			}
+			fmt.Printf("%s %#016x-%#016x %s\t%s\n", seg.Prot, seg.Start, seg.End, name, status)
+		}
+
+		if len(lockRegs) > 0 {
+			fmt.Println()
+			fmt.Println("Lock Registers")
+			fmt.Println("==============")
+			paths := make([]string, 0, len(lockRegs))
+			for path := range lockRegs {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				fmt.Println(path)
+				keys := make([]string, 0, len(lockRegs[path]))
+				for k := range lockRegs[path] {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Printf("  %s: %v\n", k, lockRegs[path][k])
+				}
+			}
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelEntitlementsCmd)
+	kernelEntitlementsCmd.Flags().String("diff", "", "Diff the entitlement usage against another kernelcache")
+	kernelEntitlementsCmd.Flags().StringP("kext", "k", "", "Only show the entitlements a kext checks")
+	kernelEntitlementsCmd.Flags().StringP("filter", "f", "", "Only show entitlements containing a substring")
+	kernelEntitlementsCmd.Flags().Bool("checked", false, "Only show the entitlements passed to an entitlement checking function")
+	kernelEntitlementsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelEntitlementsCmd.MarkFlagFilename("diff")
+	viper.BindPFlag("kernel.entitlements.diff", kernelEntitlementsCmd.Flags().Lookup("diff"))
+	viper.BindPFlag("kernel.entitlements.kext", kernelEntitlementsCmd.Flags().Lookup("kext"))
+	viper.BindPFlag("kernel.entitlements.filter", kernelEntitlementsCmd.Flags().Lookup("filter"))
+	viper.BindPFlag("kernel.entitlements.checked", kernelEntitlementsCmd.Flags().Lookup("checked"))
+	viper.BindPFlag("kernel.entitlements.json", kernelEntitlementsCmd.Flags().Lookup("json"))
+	kernelEntitlementsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func getEntitlementUsage(path string) (kernelcache.EntitlementUsage, error) {
+	m, err := kernelcache.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetEntitlementUsage(m)
+}
+
+// filterEntitlementUsage keeps the checks of the kext (bundle ID or its suffix) and entitlements containing filter
+func filterEntitlementUsage(usage kernelcache.EntitlementUsage, kext, filter string, checked bool) kernelcache.EntitlementUsage {
+	out := make(kernelcache.EntitlementUsage)
+	for ent, checks := range usage {
+		if len(filter) > 0 && !strings.Contains(ent, filter) {
+			continue
+		}
+		for _, c := range checks {
+			if len(kext) > 0 && c.Kext != kext && !strings.HasSuffix(c.Kext, "."+kext) {
+				continue
+			}
+			if checked && len(c.Checker) == 0 {
+				continue
+			}
+			out[ent] = append(out[ent], c)
+		}
+	}
+	return out
+}
+
+// kernelEntitlementsCmd represents the entitlements command
+var kernelEntitlementsCmd = &cobra.Command{
+	Use:     "entitlements <kernelcache>",
+	Aliases: []string{"ents"},
+	Short:   "Map the entitlements the kernelcache checks to the kexts/functions that check them",
+	Long: heredoc.Doc(`
+		Find the entitlements the kernelcache checks: the strings passed to the entitlement checking
+		functions (IOTaskHasEntitlement, IOCurrentTaskHasEntitlement, IOUserClient::copyClientEntitlement
+		etc, or the functions called with known entitlements for stripped kernelcaches) and the
+		entitlement strings in each kext's __TEXT.__cstring.`),
+	Example: heredoc.Doc(`
+		# List every entitlement and the functions that check it
+		❯ ipsw kernel entitlements kernelcache.release.iPhone15,2
+		# Show the entitlements AMFI checks
+		❯ ipsw kernel ents --kext AppleMobileFileIntegrity --checked kernelcache.release.iPhone15,2
+		# Show the entitlements that were added/removed (or moved between kexts) since the previous build
+		❯ ipsw kernel ents kernelcache.release.iPhone15,2 --diff 21A329/kernelcache.release.iPhone15,2`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		kext := viper.GetString("kernel.entitlements.kext")
+		filter := viper.GetString("kernel.entitlements.filter")
+		checked := viper.GetBool("kernel.entitlements.checked")
+		asJSON := viper.GetBool("kernel.entitlements.json")
+
+		usage, err := getEntitlementUsage(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		usage = filterEntitlementUsage(usage, kext, filter, checked)
+
+		if other := viper.GetString("kernel.entitlements.diff"); len(other) > 0 {
+			prev, err := getEntitlementUsage(filepath.Clean(other))
+			if err != nil {
+				return err
+			}
+			diff := kernelcache.DiffEntitlementUsage(filterEntitlementUsage(prev, kext, filter, checked), usage)
+			if asJSON {
+				return printJSON(diff)
+			}
+			if len(diff.New) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 {
+				log.Info("No entitlement changes")
+				return nil
+			}
+			for _, ent := range diff.New {
+				fmt.Println(colorAdded("+ " + ent))
+			}
+			for _, ent := range diff.Removed {
+				fmt.Println(colorRemoved("- " + ent))
+			}
+			for _, c := range diff.Changed {
+				fmt.Printf("~ %s\n", c.Entitlement)
+				for _, k := range c.Added {
+					fmt.Println(colorAdded("    + " + k))
+				}
+				for _, k := range c.Removed {
+					fmt.Println(colorRemoved("    - " + k))
+				}
+			}
+			return nil
+		}
+
+		if asJSON {
+			return printJSON(usage)
+		}
+
+		if len(usage) == 0 {
+			log.Warn("No entitlements found")
+			return nil
+		}
+		for _, ent := range usage.Entitlements() {
+			fmt.Println(colorProp(ent))
+			for _, c := range usage[ent] {
+				fmt.Printf("    %s\n", c)
+			}
+		}
+
+		return nil
+	},
+}
@@ -24,13 +24,12 @@ package kernel
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
-	"github.com/blacktop/go-macho/pkg/fixupchains"
-	"github.com/blacktop/go-macho/types"
-	"github.com/blacktop/ipsw/internal/magic"
-	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -41,19 +40,28 @@ func init() {
 
 	kerExtractCmd.Flags().BoolP("all", "a", false, "Extract all KEXTs")
 	kerExtractCmd.Flags().String("output", "", "Directory to extract KEXTs to")
+	kerExtractCmd.Flags().StringSlice("kc", []string{}, "Kernel collection(s) the KC links against (i.e. the BootKernelExtensions.kc of a system/aux KC)")
+	kerExtractCmd.MarkFlagFilename("kc")
 
 	viper.BindPFlag("kernel.extract.all", kerExtractCmd.Flags().Lookup("all"))
 	viper.BindPFlag("kernel.extract.output", kerExtractCmd.Flags().Lookup("output"))
+	viper.BindPFlag("kernel.extract.kc", kerExtractCmd.Flags().Lookup("kc"))
 }
 
 // kerExtractCmd represents the kerExtract command
 var kerExtractCmd = &cobra.Command{
-	Use:           "extract <KERNELCACHE> <KEXT>",
-	Aliases:       []string{"e"},
-	Short:         "Extract KEXT(s) from kernelcache",
-	Args:          cobra.MinimumNArgs(1),
-	SilenceUsage:  true,
-	SilenceErrors: true,
+	Use:     "extract <KERNELCACHE> [KEXT...]",
+	Aliases: []string{"e"},
+	Short:   "Extract KEXT(s) from kernelcache",
+	Example: heredoc.Doc(`
+		# Extract a kext from an iOS kernelcache
+		❯ ipsw kernel extract kernelcache.release.iPhone15,2 com.apple.iokit.IOSurface
+		# Extract all the kexts of a macOS aux KC (resolving its pointers into the boot KC)
+		❯ ipsw kernel extract --all AuxiliaryKernelExtensions.kc --kc BootKernelExtensions.kc --output /tmp/kexts`),
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: complete.Kexts,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if viper.GetBool("verbose") {
@@ -70,58 +78,19 @@ var kerExtractCmd = &cobra.Command{
 
 		kernPath := filepath.Clean(args[0])
 
-		if ok, err := magic.IsMachoOrImg4(kernPath); !ok {
-			return fmt.Errorf(err.Error())
-		}
-
 		folder := filepath.Dir(kernPath)
 		if len(extractPath) > 0 {
 			folder = extractPath
 		}
 
-		m, err := macho.Open(kernPath)
-		if err != nil {
-			return fmt.Errorf("failed to open kernelcache: %v", err)
-		}
-
-		if m.FileTOC.FileHeader.Type != types.MH_FILESET {
-			return fmt.Errorf("kernelcache type is not MH_FILESET (KEXT-xtraction not supported yet)")
-		}
-
-		var dcf *fixupchains.DyldChainedFixups
-		if m.HasFixups() {
-			dcf, err = m.DyldChainedFixups()
-			if err != nil {
-				return fmt.Errorf("failed to parse fixups from in memory MachO: %v", err)
-			}
-		}
-
-		baseAddress := m.GetBaseAddress()
-
-		if dumpAll {
-			log.Info("Extracting all KEXTs...")
-			for _, fse := range m.FileSets() {
-				mfse, err := m.GetFileSetFileByName(fse.EntryID)
-				if err != nil {
-					return fmt.Errorf("failed to parse KEXT %s: %v", fse.EntryID, err)
-				}
-				if err := mfse.Export(filepath.Join(folder, fse.EntryID), dcf, baseAddress, nil); err != nil { // TODO: do I want to add any extra syms?
-					return fmt.Errorf("failed to export KEXT %s; %v", fse.EntryID, err)
-				}
-				utils.Indent(log.Info, 2)(fmt.Sprintf("Created %s", filepath.Join(folder, fse.EntryID)))
-			}
+		var filter []string
+		if !dumpAll {
+			filter = args[1:]
+			log.Infof("Extracting %s...", strings.Join(filter, ", "))
 		} else {
-			m, err = m.GetFileSetFileByName(args[1])
-			if err != nil {
-				return fmt.Errorf("failed to parse KEXT %s: %v", args[1], err)
-			}
-
-			if err := m.Export(filepath.Join(folder, args[1]), dcf, baseAddress, nil); err != nil { // TODO: do I want to add any extra syms?
-				return fmt.Errorf("failed to export KEXT %s; %v", args[1], err)
-			}
-			log.Infof("Created %s", filepath.Join(folder, args[1]))
+			log.Info("Extracting all KEXTs...")
 		}
 
-		return nil
+		return kernelcache.ExtractKexts(kernPath, folder, filter, viper.GetStringSlice("kernel.extract.kc")...)
 	},
 }
@@ -0,0 +1,148 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorHash = color.New(color.Faint).SprintFunc()
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelHashCmd)
+	kernelHashCmd.Flags().BoolP("kexts", "k", false, "Show the per-kext hashes")
+	kernelHashCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("kernel.hash.kexts", kernelHashCmd.Flags().Lookup("kexts"))
+	viper.BindPFlag("kernel.hash.json", kernelHashCmd.Flags().Lookup("json"))
+	kernelHashCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func kernelHashes(path string) (*kernelcache.Hashes, error) {
+	m, err := kernelcache.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetHashes(m)
+}
+
+// kernelHashCmd represents the hash command
+var kernelHashCmd = &cobra.Command{
+	Use:   "hash <kernelcache> [<kernelcache>]",
+	Short: "Stable segment/kext hashes (to check if two kernelcaches are functionally identical)",
+	Long: heredoc.Doc(`
+		Hash each segment (and fileset entry) of a kernelcache with its chained fixup pointers
+		normalized to their targets, so two kernelcaches hash the same when they are functionally
+		identical even if their fixup chains are encoded differently.`),
+	Example: heredoc.Doc(`
+		# Hash a kernelcache's segments and kexts
+		❯ ipsw kernel hash kernelcache.release.iPhone15,2 --kexts
+		# Is this leaked kernel identical to a known build?
+		❯ ipsw kernel hash leaked.kernelcache kernelcache.release.iPhone15,2`),
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		prev, err := kernelHashes(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", args[0], err)
+		}
+
+		if len(args) == 1 {
+			if viper.GetBool("kernel.hash.json") {
+				if !viper.GetBool("kernel.hash.kexts") {
+					prev.Kexts = nil
+				}
+				dat, err := json.MarshalIndent(prev, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(dat))
+				return nil
+			}
+			for _, seg := range prev.Segments {
+				fmt.Printf("%-16s %#016x-%#016x fixups=%-7d %s\n", seg.Name, seg.Addr, seg.Addr+seg.Size, seg.Fixups, colorHash(seg.SHA256))
+			}
+			if viper.GetBool("kernel.hash.kexts") {
+				fmt.Println()
+				for _, kext := range prev.Kexts {
+					fmt.Printf("%s %s\n", colorHash(kext.SHA256), kext.ID)
+				}
+			}
+			return nil
+		}
+
+		next, err := kernelHashes(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", args[1], err)
+		}
+		d := kernelcache.CompareHashes(prev, next)
+
+		if viper.GetBool("kernel.hash.json") {
+			dat, err := json.MarshalIndent(d, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+		if d.Identical() {
+			log.Info("Kernelcaches are functionally identical")
+			return nil
+		}
+		log.Warn("Kernelcaches differ")
+		for _, list := range []struct {
+			title string
+			names []string
+		}{
+			{"Segments", d.Segments},
+			{"Kexts", d.Kexts},
+			{"NEW Kexts", d.New},
+			{"Removed Kexts", d.Removed},
+		} {
+			if len(list.names) == 0 {
+				continue
+			}
+			fmt.Printf("\n%s (%d)\n", list.title, len(list.names))
+			for _, name := range list.names {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+
+		return nil
+	},
+}
@@ -32,7 +32,9 @@ import (
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/internal/commands/ida"
+	"github.com/blacktop/ipsw/internal/complete"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/caarlos0/ctrlc"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -91,6 +93,12 @@ var kernelIdaCmd = &cobra.Command{
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	Args:          cobra.MinimumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 1 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return complete.Kexts(cmd, args, toComplete)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		var fileType string
@@ -151,6 +159,11 @@ var kernelIdaCmd = &cobra.Command{
 			}
 		}
 
+		kcPath, err = kernelcache.DecompressedPath(kcPath)
+		if err != nil {
+			return err
+		}
+
 		m, err := macho.Open(kcPath)
 		if err != nil {
 			return fmt.Errorf("failed to open kernelcache %s: %w", kcPath, err)
@@ -255,7 +268,7 @@ var kernelIdaCmd = &cobra.Command{
 				log.Warn("Exiting...")
 				return cli.Stop()
 			}
-			return fmt.Errorf("failed to run IDA Pro: %v", err)
+			return fmt.Errorf("failed to run IDA Pro: %w", err)
 		}
 
 		if !viper.GetBool("kernel.ida.temp-db") {
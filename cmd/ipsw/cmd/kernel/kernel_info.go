@@ -32,10 +32,9 @@ import (
 	"text/tabwriter"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
-	"github.com/blacktop/ipsw/internal/magic"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -53,9 +52,11 @@ func init() {
 	kernelInfoCmd.Flags().BoolP("symbols", "n", false, "Print symbols")
 	kernelInfoCmd.Flags().BoolP("strings", "c", false, "Print cstrings")
 	kernelInfoCmd.Flags().StringP("filter", "f", "", "Filter symbols by name")
+	kernelInfoCmd.Flags().BoolP("bootdata", "b", false, "Print __BOOTDATA and early-boot tunables")
 	viper.BindPFlag("kernel.info.symbols", kernelInfoCmd.Flags().Lookup("symbols"))
 	viper.BindPFlag("kernel.info.strings", kernelInfoCmd.Flags().Lookup("strings"))
 	viper.BindPFlag("kernel.info.filter", kernelInfoCmd.Flags().Lookup("filter"))
+	viper.BindPFlag("kernel.info.bootdata", kernelInfoCmd.Flags().Lookup("bootdata"))
 }
 
 // kernelInfoCmd represents the info command
@@ -86,13 +87,17 @@ var kernelInfoCmd = &cobra.Command{
 
 		kernelPath := filepath.Clean(args[0])
 
-		if ok, err := magic.IsMachoOrImg4(kernelPath); !ok {
+		kern, err := kernelcache.Open(kernelPath)
+		if err != nil {
 			return err
 		}
 
-		kern, err := macho.Open(kernelPath)
-		if err != nil {
-			return err
+		if viper.GetBool("kernel.info.bootdata") {
+			bd, err := kernelcache.GetBootData(kern)
+			if err != nil {
+				return fmt.Errorf("failed to parse __BOOTDATA: %w", err)
+			}
+			printBootData(bd, false)
 		}
 
 		if kern.FileTOC.FileHeader.Type == types.MH_FILESET {
@@ -100,7 +105,7 @@ var kernelInfoCmd = &cobra.Command{
 			for _, fe := range kern.FileSets() {
 				entry, err := kern.GetFileSetFileByName(fe.EntryID)
 				if err != nil {
-					return fmt.Errorf("failed to parse file-set entry %s: %v", fe.EntryID, err)
+					return fmt.Errorf("failed to parse file-set entry %s: %w", fe.EntryID, err)
 				}
 				if viper.GetBool("kernel.info.symbols") {
 					w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
@@ -135,11 +140,11 @@ var kernelInfoCmd = &cobra.Command{
 						if sec.Flags.IsCstringLiterals() || sec.Seg == "__TEXT" && sec.Name == "__const" {
 							off, err := entry.GetOffset(sec.Addr)
 							if err != nil {
-								return fmt.Errorf("failed to get offset for %s.%s: %v", sec.Seg, sec.Name, err)
+								return fmt.Errorf("failed to get offset for %s.%s: %w", sec.Seg, sec.Name, err)
 							}
 							dat := make([]byte, sec.Size)
 							if _, err = entry.ReadAt(dat, int64(off)); err != nil {
-								return fmt.Errorf("failed to read cstring data in %s.%s: %v", sec.Seg, sec.Name, err)
+								return fmt.Errorf("failed to read cstring data in %s.%s: %w", sec.Seg, sec.Name, err)
 							}
 
 							csr := bytes.NewBuffer(dat)
@@ -154,7 +159,7 @@ var kernelInfoCmd = &cobra.Command{
 								}
 
 								if err != nil {
-									return fmt.Errorf("failed to read string: %v", err)
+									return fmt.Errorf("failed to read string: %w", err)
 								}
 
 								s = strings.Trim(s, "\x00")
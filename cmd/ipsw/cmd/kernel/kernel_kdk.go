@@ -0,0 +1,117 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelKdkCmd)
+	kernelKdkCmd.Flags().StringArrayP("kdk", "k", []string{}, "KDK folder(s) to search (defaults to the installed KDKs)")
+	kernelKdkCmd.Flags().BoolP("types", "t", false, "Also transfer the DWARF types from the KDK dSYMs (slow)")
+	kernelKdkCmd.Flags().BoolP("json", "j", false, "Output the matched symbols as JSON")
+	kernelKdkCmd.Flags().StringP("output", "o", "", "Folder to write the .symbols.json file to")
+	kernelKdkCmd.MarkFlagDirname("kdk")
+	kernelKdkCmd.MarkFlagDirname("output")
+	viper.BindPFlag("kernel.kdk.kdk", kernelKdkCmd.Flags().Lookup("kdk"))
+	viper.BindPFlag("kernel.kdk.types", kernelKdkCmd.Flags().Lookup("types"))
+	viper.BindPFlag("kernel.kdk.json", kernelKdkCmd.Flags().Lookup("json"))
+	viper.BindPFlag("kernel.kdk.output", kernelKdkCmd.Flags().Lookup("output"))
+	kernelKdkCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelKdkCmd represents the kdk command
+var kernelKdkCmd = &cobra.Command{
+	Use:   "kdk <kernelcache>",
+	Short: "Apply the symbols of a matching KDK to a kernelcache",
+	Example: heredoc.Doc(`
+		# Find the installed KDK that matches the kernelcache and write its symbols to kernelcache.symbols.json
+		❯ ipsw kernel kdk kernelcache.release.Mac14,7
+		# Use a specific KDK and also transfer the DWARF types
+		❯ ipsw kernel kdk --kdk /Library/Developer/KDKs/KDK_14.0_23A344.kdk --types --json kernelcache.release.Mac14,7`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		output := viper.GetString("kernel.kdk.output")
+		if len(output) == 0 {
+			output = filepath.Dir(filepath.Clean(args[0]))
+		}
+
+		m, err := openKernelcache(args[0])
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		ks, err := kernelcache.ApplyKDK(m, &kernelcache.KDKConfig{
+			KDKs:  viper.GetStringSlice("kernel.kdk.kdk"),
+			Types: viper.GetBool("kernel.kdk.types"),
+		})
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool("kernel.kdk.json") {
+			return printJSON(ks)
+		}
+
+		log.WithField("kdk", ks.KDK).Info("Matched KDK")
+		for _, match := range ks.Matches {
+			name := match.Entry
+			if len(name) == 0 {
+				name = filepath.Base(match.Path)
+			}
+			utils.Indent(log.WithFields(log.Fields{"uuid": match.UUID, "symbols": match.Symbols}).Info, 2)(name)
+		}
+		for _, entry := range ks.Unmatched {
+			utils.Indent(log.Warn, 2)(fmt.Sprintf("%s is NOT in the KDK", entry))
+		}
+
+		// the same format as `ipsw kernel symbolicate --json` (so it works with --lookup)
+		dat, err := json.Marshal(ks.Map())
+		if err != nil {
+			return fmt.Errorf("failed to marshal symbol map: %w", err)
+		}
+		fname := filepath.Join(output, filepath.Base(args[0])+".symbols.json")
+		log.Infof("Writing %d symbols to %s", len(ks.Symbols), fname)
+		return os.WriteFile(fname, dat, 0o644)
+	},
+}
@@ -0,0 +1,168 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/kdp"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorField = color.New(color.Bold, color.FgHiBlue).SprintFunc()
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelKdpCmd)
+
+	kernelKdpCmd.Flags().StringSliceP("kernel", "k", []string{}, "Kernel/kernelcache(s) to search for symbols (in addition to installed KDKs)")
+	kernelKdpCmd.Flags().StringP("read", "r", "", "Read kernel memory at address (slid)")
+	kernelKdpCmd.Flags().Uint32P("size", "s", 0x100, "Number of bytes to read")
+	kernelKdpCmd.Flags().Bool("phys", false, "Read physical memory")
+	kernelKdpCmd.Flags().Bool("reboot", false, "Reboot the target")
+	kernelKdpCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("kernel.kdp.kernel", kernelKdpCmd.Flags().Lookup("kernel"))
+	viper.BindPFlag("kernel.kdp.read", kernelKdpCmd.Flags().Lookup("read"))
+	viper.BindPFlag("kernel.kdp.size", kernelKdpCmd.Flags().Lookup("size"))
+	viper.BindPFlag("kernel.kdp.phys", kernelKdpCmd.Flags().Lookup("phys"))
+	viper.BindPFlag("kernel.kdp.reboot", kernelKdpCmd.Flags().Lookup("reboot"))
+	viper.BindPFlag("kernel.kdp.json", kernelKdpCmd.Flags().Lookup("json"))
+}
+
+// kernelKdpCmd represents the kdp command
+var kernelKdpCmd = &cobra.Command{
+	Use:   "kdp <HOST>",
+	Short: "Connect to a KDP target and print the LLDB commands (with matching symbols) to debug it",
+	Example: heredoc.Doc(`
+		# Query a VM waiting for the debugger and find its KDK kernel
+		❯ ipsw kernel kdp 192.168.64.2
+		# Dump kernel memory
+		❯ ipsw kernel kdp 192.168.64.2 --read 0xfffffe0007004000 --size 0x40`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		cli, err := kdp.Dial(args[0])
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+
+		if err := cli.Connect("ipsw"); err != nil {
+			return fmt.Errorf("failed to connect to KDP target %s: %w", args[0], err)
+		}
+
+		if viper.GetBool("kernel.kdp.reboot") {
+			log.Warn("Rebooting target")
+			return cli.Reboot()
+		}
+
+		if addr := viper.GetString("kernel.kdp.read"); len(addr) > 0 {
+			a, err := strconv.ParseUint(addr, 0, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse --read address %s: %w", addr, err)
+			}
+			var data []byte
+			if viper.GetBool("kernel.kdp.phys") {
+				data, err = cli.ReadPhysMem(a, viper.GetUint32("kernel.kdp.size"))
+			} else {
+				data, err = cli.ReadMem(a, viper.GetUint32("kernel.kdp.size"))
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(utils.HexDump(data, a))
+			return nil
+		}
+
+		ver, err := cli.Version()
+		if err != nil {
+			return fmt.Errorf("failed to get KDP version: %w", err)
+		}
+		host, err := cli.HostInfo()
+		if err != nil {
+			return fmt.Errorf("failed to get KDP host info: %w", err)
+		}
+		kv, err := cli.KernelVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get kernel version: %w", err)
+		}
+
+		syms, err := kdp.FindSymbols(kv, viper.GetStringSlice("kernel.kdp.kernel")...)
+		if err != nil {
+			log.Warn(err.Error())
+		}
+
+		// LLDB needs the KDP session so we must let go of it
+		if err := cli.Disconnect(); err != nil {
+			log.Debugf("failed to disconnect: %v", err)
+		}
+
+		if viper.GetBool("kernel.kdp.json") {
+			dat, err := json.Marshal(&struct {
+				Version *kdp.VersionInfo   `json:"version"`
+				Host    *kdp.HostInfo      `json:"host"`
+				Kernel  *kdp.KernelVersion `json:"kernel"`
+				Symbols *kdp.Symbols       `json:"symbols,omitempty"`
+				LLDB    []string           `json:"lldb"`
+			}{
+				Version: ver,
+				Host:    host,
+				Kernel:  kv,
+				Symbols: syms,
+				LLDB:    syms.LLDBCommands(args[0]),
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		fmt.Printf("%s %d (features: %#x)\n", colorField("KDP Version:"), ver.Version, ver.Feature)
+		fmt.Printf("%s type=%#x subtype=%#x cpus=%#x\n", colorField("Host CPU:   "), host.CPUType, host.CPUSubtype, host.CPUMask)
+		fmt.Printf("%s %s\n", colorField("Kernel:     "), kv.Raw)
+		if syms != nil {
+			fmt.Printf("%s %s\n", colorField("Symbols:    "), syms.Path)
+			fmt.Printf("%s %#x\n", colorField("Slide:      "), syms.Slide)
+		}
+		fmt.Println()
+		fmt.Println(colorField("Paste into LLDB:"))
+		for _, c := range syms.LLDBCommands(args[0]) {
+			fmt.Printf("    %s\n", c)
+		}
+
+		return nil
+	},
+}
@@ -22,11 +22,18 @@ THE SOFTWARE.
 package kernel
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/spill"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
@@ -37,15 +44,65 @@ import (
 func init() {
 	KernelcacheCmd.AddCommand(kextsCmd)
 	kextsCmd.Flags().BoolP("diff", "d", false, "Diff two kernel's kexts")
+	kextsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kextsCmd.Flags().StringP("filter", "f", "", "Only list kexts matching a filter expression (i.e. 'com.apple.iokit.* has-personality min-os>=14')")
+	kextsCmd.Flags().StringP("graph", "g", "", "Output the kext dependency graph (dot, json or mermaid)")
+	kextsCmd.Flags().Bool("stream", false, "Memory map the kernelcache and stream its sections (implied by --memory-budget)")
+	kextsCmd.RegisterFlagCompletionFunc("graph", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"dot", "json", "mermaid"}, cobra.ShellCompDirectiveNoFileComp
+	})
 	kextsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
 }
 
+func getKexts(kernelPath, filter string, stream bool) ([]kernelcache.Kext, error) {
+	if stream {
+		f, err := kernelcache.OpenStream(filepath.Clean(kernelPath))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return kernelcache.GetKextsMatching(f.File, filter)
+	}
+	m, err := kernelcache.Open(filepath.Clean(kernelPath))
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetKextsMatching(m, filter)
+}
+
+// kextList returns the sorted kext listing lines (without addresses if diffable)
+func kextList(kernelPath, filter string, diffable, stream bool) ([]string, error) {
+	kexts, err := getKexts(kernelPath, filter, stream)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(kexts))
+	for _, kext := range kexts {
+		if diffable {
+			out = append(out, fmt.Sprintf("%s (%s)", kext.ID, kext.Version))
+		} else {
+			out = append(out, kext.String())
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
 // kextsCmd represents the kexts command
 var kextsCmd = &cobra.Command{
 	Use:     "kexts <kernelcache>",
 	Aliases: []string{"k"},
 	Short:   "List kernel extentions",
-	Args:    cobra.MinimumNArgs(1),
+	Long:    "List kernel extentions\n\nFilter expressions are " + kernelcache.KextFilterHelp,
+	Example: heredoc.Doc(`
+		# List the IOKit families with personalities
+		❯ ipsw kernel kexts kernelcache.release.iPhone15,2 --filter 'com.apple.iokit.* has-personality'
+		# List the security extensions that require macOS 14 or later
+		❯ ipsw kernel kexts kernelcache.release.Mac14,7 -f 'security-extension min-os>=14.0' --json
+		# List the kexts of a macOS kernel collection on a low-memory host
+		❯ ipsw kernel kexts --stream /System/Library/KernelCollections/BootKernelExtensions.kc`),
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if viper.GetBool("verbose") {
@@ -54,21 +111,60 @@ var kextsCmd = &cobra.Command{
 		color.NoColor = viper.GetBool("no-color")
 
 		diff, _ := cmd.Flags().GetBool("diff")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		graphFormat, _ := cmd.Flags().GetString("graph")
+		filter, _ := cmd.Flags().GetString("filter")
+		stream, _ := cmd.Flags().GetBool("stream")
+		stream = stream || spill.Budget() > 0
 
 		if _, err := os.Stat(args[0]); os.IsNotExist(err) {
 			return fmt.Errorf("file %s does not exist", args[0])
 		}
 
+		if len(graphFormat) > 0 {
+			if !slices.Contains([]string{"dot", "json", "mermaid"}, graphFormat) {
+				return fmt.Errorf("invalid --graph format %q (must be dot, json or mermaid)", graphFormat)
+			}
+			m, err := kernelcache.Open(filepath.Clean(args[0]))
+			if err != nil {
+				return err
+			}
+			defer m.Close()
+			graph, err := kernelcache.KextDependencyGraph(m)
+			if err != nil {
+				return err
+			}
+			for _, cycle := range graph.Cycles {
+				log.WithField("kexts", strings.Join(cycle, " → ")).Warn("Dependency cycle")
+			}
+			for _, dep := range graph.Mismatches() {
+				log.WithFields(log.Fields{
+					"kext":     dep.From,
+					"requires": fmt.Sprintf("%s (%s)", dep.To, dep.Required),
+					"provides": graph.Nodes[dep.To].Version,
+					"compat":   graph.Nodes[dep.To].CompatibleVersion,
+				}).Warn("Dependency version mismatch")
+			}
+			switch graphFormat {
+			case "json":
+				return graph.WriteJSON(os.Stdout)
+			case "mermaid":
+				return graph.WriteMermaid(os.Stdout)
+			default:
+				return graph.WriteDOT(os.Stdout)
+			}
+		}
+
 		if diff {
 			if len(args) < 2 {
 				return fmt.Errorf("please provide two kernelcache files to diff")
 			}
 
-			kout1, err := kernelcache.KextList(args[0], true)
+			kout1, err := kextList(args[0], filter, true, stream)
 			if err != nil {
 				return err
 			}
-			kout2, err := kernelcache.KextList(args[1], true)
+			kout2, err := kextList(args[1], filter, true, stream)
 			if err != nil {
 				return err
 			}
@@ -86,11 +182,27 @@ var kextsCmd = &cobra.Command{
 			}
 			log.Info("Differences found")
 			fmt.Println(out)
+		} else if asJSON {
+			kexts, err := getKexts(args[0], filter, stream)
+			if err != nil {
+				return err
+			}
+			dat, err := json.MarshalIndent(kexts, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
 		} else {
-			kout, err := kernelcache.KextList(args[0], false)
+			kout, err := kextList(args[0], filter, false, stream)
 			if err != nil {
 				return err
 			}
+			if viper.GetBool("stable") { // order by bundle ID (instead of address) so listings line up across builds
+				stable.SortBy(kout, func(k string) string {
+					_, id, _ := strings.Cut(k, ": ")
+					return id
+				})
+			}
 			log.WithField("count", len(kout)).Info("Kexts")
 			for _, k := range kout {
 				fmt.Println(k)
@@ -22,7 +22,6 @@ THE SOFTWARE.
 package kernel
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -78,7 +77,7 @@ var inspectCmd = &cobra.Command{
 		if outputDir == "" {
 			cwd, err := os.Getwd()
 			if err != nil {
-				return fmt.Errorf("failed to get current working directory: %v", err)
+				return fmt.Errorf("failed to get current working directory: %w", err)
 			}
 			outputDir = cwd
 		}
@@ -87,7 +86,7 @@ var inspectCmd = &cobra.Command{
 		if len(args) < 2 {
 			systemKernelCache, err := utils.GetKernelCollectionPath()
 			if err != nil {
-				return fmt.Errorf("could not find system kernelcache: %v (Please specify path to kernelcache)", err)
+				return fmt.Errorf("could not find system kernelcache: %w (Please specify path to kernelcache)", err)
 			}
 			kcpath = systemKernelCache
 		} else {
@@ -98,27 +97,17 @@ var inspectCmd = &cobra.Command{
 			return fmt.Errorf("file %s does not exist", kcpath)
 		}
 
-		var m *macho.File
+		kcpath, err = kernelcache.DecompressedPath(kcpath)
+		if err != nil {
+			return fmt.Errorf("failed to decompress kernelcache: %w", err)
+		}
 
-		if isImg4(kcpath) {
-			log.Info("Decompressing KernelManagement kernelcache")
-			data, err := kernelcache.DecompressKernelManagementData(kcpath)
-			if err != nil {
-				return fmt.Errorf("failed to decompress kernelcache (kernel management data): %v", err)
-			}
-			m, err = macho.NewFile(bytes.NewReader(data))
-			if err != nil {
-				return fmt.Errorf("failed to parse kernelcache (kernel management data): %v", err)
-			}
-			defer m.Close()
-		} else {
-			log.Info("Parsing KernelManagement kernelcache")
-			m, err = macho.Open(kcpath)
-			if err != nil {
-				return fmt.Errorf("failed to parse kernelcache MachO: %v", err)
-			}
-			defer m.Close()
+		log.Info("Parsing KernelManagement kernelcache")
+		m, err := macho.Open(kcpath)
+		if err != nil {
+			return fmt.Errorf("failed to parse kernelcache MachO: %w", err)
 		}
+		defer m.Close()
 
 		if m.FileTOC.FileHeader.Type != types.MH_FILESET {
 			return fmt.Errorf("kernelcache type is not MH_FILESET (kext collection)")
@@ -126,7 +115,7 @@ var inspectCmd = &cobra.Command{
 
 		out, err := kernelcache.InspectKM(m, filter, explicitOnly, asJSON)
 		if err != nil {
-			return fmt.Errorf("failed to inspect kernelcache: %v", err)
+			return fmt.Errorf("failed to inspect kernelcache: %w", err)
 		}
 		fmt.Println(out)
 
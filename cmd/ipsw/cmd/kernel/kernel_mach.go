@@ -29,7 +29,6 @@ import (
 	"text/tabwriter"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -62,7 +61,7 @@ var kernelMachCmd = &cobra.Command{
 			log.Warn("development kernelcache detected: 'MACH_ASSERT=1' so 'mach_trap_t' has an extra 'const char *mach_trap_name' field which will throw off the parsing of the mach_traps table")
 		}
 
-		m, err := macho.Open(machoPath)
+		m, err := kernelcache.Open(machoPath)
 		if err != nil {
 			return err
 		}
@@ -22,13 +22,14 @@ THE SOFTWARE.
 package kernel
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"text/tabwriter"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -37,12 +38,22 @@ import (
 
 func init() {
 	KernelcacheCmd.AddCommand(kernelMigCmd)
+	kernelMigCmd.Flags().BoolP("scan", "s", false, "Scan __DATA_CONST for MIG subsystems (includes KEXTs)")
+	kernelMigCmd.Flags().BoolP("json", "j", false, "Output as JSON (requires --scan)")
+	viper.BindPFlag("kernel.mig.scan", kernelMigCmd.Flags().Lookup("scan"))
+	viper.BindPFlag("kernel.mig.json", kernelMigCmd.Flags().Lookup("json"))
+	kernelMigCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
 }
 
 // kernelMigCmd represents the mig command
 var kernelMigCmd = &cobra.Command{
-	Use:           "mig <kernelcache>",
-	Short:         "Dump kernelcache mig subsystem",
+	Use:   "mig <kernelcache>",
+	Short: "Dump kernelcache mig subsystem",
+	Example: heredoc.Doc(`
+		# Dump the kernel's MIG subsystems (from its mig_e table)
+		❯ ipsw kernel mig kernelcache.release.iPhone15,2
+		# Scan the kernel and KEXTs for MIG subsystems and their handlers
+		❯ ipsw kernel mig kernelcache.release.iPhone15,2 --scan --json`),
 	Args:          cobra.ExactArgs(1),
 	SilenceUsage:  true,
 	SilenceErrors: true,
@@ -53,15 +64,38 @@ var kernelMigCmd = &cobra.Command{
 		}
 		color.NoColor = viper.GetBool("no-color")
 
-		m, err := macho.Open(filepath.Clean(args[0]))
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
 		if err != nil {
 			return err
 		}
 		defer m.Close()
 
+		if viper.GetBool("kernel.mig.scan") {
+			migs, err := kernelcache.FindMigSubsystems(m)
+			if err != nil {
+				return fmt.Errorf("failed to scan for mig subsystems: %w", err)
+			}
+			if viper.GetBool("kernel.mig.json") {
+				dat, err := json.MarshalIndent(migs, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(dat))
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			for _, mig := range migs {
+				fmt.Fprintf(w, "%s\n", mig)
+			}
+			w.Flush()
+			return nil
+		} else if viper.GetBool("kernel.mig.json") {
+			return fmt.Errorf("--json requires --scan")
+		}
+
 		migs, err := kernelcache.GetMigSubsystems(m)
 		if err != nil {
-			return fmt.Errorf("failed to get mig subsystems (only tested on macOS 15.0/iOS 18.0): %v", err)
+			return fmt.Errorf("failed to get mig subsystems (only tested on macOS 15.0/iOS 18.0): %w", err)
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
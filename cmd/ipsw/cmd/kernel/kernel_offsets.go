@@ -0,0 +1,142 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/blacktop/ipsw/pkg/signature"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelOffsetsCmd)
+	kernelOffsetsCmd.Flags().StringP("kext", "k", "", "Only the offsets of a kext (bundle ID or its suffix)")
+	kernelOffsetsCmd.Flags().StringP("accessors", "a", "", "JSON file of the field accessors to match (instead of the defaults)")
+	kernelOffsetsCmd.Flags().StringP("symbols", "s", "", "Symbols JSON of a stripped kernelcache (from 'ipsw kernel symbolicate --json')")
+	kernelOffsetsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelOffsetsCmd.Flags().StringP("output", "o", "", "Folder to write the offsets JSON to")
+	kernelOffsetsCmd.MarkFlagDirname("output")
+	kernelOffsetsCmd.RegisterFlagCompletionFunc("kext", complete.Kexts)
+	viper.BindPFlag("kernel.offsets.kext", kernelOffsetsCmd.Flags().Lookup("kext"))
+	viper.BindPFlag("kernel.offsets.accessors", kernelOffsetsCmd.Flags().Lookup("accessors"))
+	viper.BindPFlag("kernel.offsets.symbols", kernelOffsetsCmd.Flags().Lookup("symbols"))
+	viper.BindPFlag("kernel.offsets.json", kernelOffsetsCmd.Flags().Lookup("json"))
+	viper.BindPFlag("kernel.offsets.output", kernelOffsetsCmd.Flags().Lookup("output"))
+	kernelOffsetsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelOffsetsCmd represents the offsets command
+var kernelOffsetsCmd = &cobra.Command{
+	Use:   "offsets <kernelcache>",
+	Short: "Extract struct field offsets of IOSurface, IOGPU and AppleAVE from their accessors",
+	Example: heredoc.Doc(`
+		# Extract the default IOSurface/IOGPU/AppleAVE offsets
+		❯ ipsw kernel offsets kernelcache.release.iPhone15,2
+		# Use the symbols of a symbolicated (stripped) kernelcache and write the versioned offsets JSON
+		❯ ipsw kernel offsets kernelcache.release.iPhone15,2 --symbols kernelcache.release.iPhone15,2.symbols.json --output /tmp
+		# Only IOSurface, with your own accessors
+		❯ ipsw kernel offsets kernelcache.release.iPhone15,2 --kext IOSurface --accessors accessors.json --json`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		conf := &kernelcache.StructOffsetsConfig{Kext: viper.GetString("kernel.offsets.kext")}
+		if accessors := viper.GetString("kernel.offsets.accessors"); len(accessors) > 0 {
+			data, err := os.ReadFile(accessors)
+			if err != nil {
+				return fmt.Errorf("failed to read accessors: %w", err)
+			}
+			if err := json.Unmarshal(data, &conf.Accessors); err != nil {
+				return fmt.Errorf("failed to parse accessors %s: %w", accessors, err)
+			}
+		}
+		if symbols := viper.GetString("kernel.offsets.symbols"); len(symbols) > 0 {
+			smap := signature.NewSymbolMap()
+			if err := smap.LoadJSON(symbols); err != nil {
+				return fmt.Errorf("failed to load symbols: %w", err)
+			}
+			conf.Symbols = smap
+		}
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		offs, err := kernelcache.GetStructOffsets(m, conf)
+		if err != nil {
+			return err
+		}
+
+		if output := viper.GetString("kernel.offsets.output"); len(output) > 0 {
+			dat, err := json.MarshalIndent(offs, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(output, 0o750); err != nil {
+				return err
+			}
+			fname := filepath.Join(output, filepath.Base(args[0])+".offsets.json")
+			log.Infof("Creating %s", fname)
+			return os.WriteFile(fname, dat, 0o644)
+		}
+
+		if viper.GetBool("kernel.offsets.json") {
+			return json.NewEncoder(os.Stdout).Encode(offs)
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(offs.Structs)) {
+			fields := offs.Structs[name]
+			fmt.Println(color.New(color.Bold).Sprint(name))
+			for _, field := range slices.Sorted(maps.Keys(fields)) {
+				fo := fields[field]
+				fmt.Printf("  %-20s %#-6x %s size=%d %s\n", field, fo.Offset, fo.Access, fo.Size,
+					color.New(color.Faint).Sprintf("// %s (%s)", fo.Accessor, fo.Source))
+			}
+		}
+		if len(offs.Missing) > 0 {
+			log.Warnf("Accessors not found (or matched): %s", strings.Join(offs.Missing, ", "))
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelPacCmd)
+	kernelPacCmd.Flags().StringP("kext", "k", "", "Only the pointers of a kext (bundle ID or its suffix)")
+	kernelPacCmd.Flags().String("key", "", "Only the pointers signed with a key (IA, IB, DA or DB)")
+	kernelPacCmd.Flags().StringP("diversity", "d", "", "Only the pointers with a diversity (i.e. 0xc26d)")
+	kernelPacCmd.Flags().String("vtable", "", "Only the methods of the vtables whose name contains a substring")
+	kernelPacCmd.Flags().BoolP("summary", "s", false, "Summarize the pointers per kext")
+	kernelPacCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelPacCmd.RegisterFlagCompletionFunc("kext", complete.Kexts)
+	kernelPacCmd.RegisterFlagCompletionFunc("key", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return kernelcache.PACKeys, cobra.ShellCompDirectiveNoFileComp
+	})
+	viper.BindPFlag("kernel.pac.kext", kernelPacCmd.Flags().Lookup("kext"))
+	viper.BindPFlag("kernel.pac.key", kernelPacCmd.Flags().Lookup("key"))
+	viper.BindPFlag("kernel.pac.diversity", kernelPacCmd.Flags().Lookup("diversity"))
+	viper.BindPFlag("kernel.pac.vtable", kernelPacCmd.Flags().Lookup("vtable"))
+	viper.BindPFlag("kernel.pac.summary", kernelPacCmd.Flags().Lookup("summary"))
+	viper.BindPFlag("kernel.pac.json", kernelPacCmd.Flags().Lookup("json"))
+	kernelPacCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelPacCmd represents the pac command
+var kernelPacCmd = &cobra.Command{
+	Use:     "pac <kernelcache>",
+	Aliases: []string{"ptrauth"},
+	Short:   "Dump the PAC key and diversity of every authenticated pointer",
+	Example: heredoc.Doc(`
+		# Summarize the signed pointers of every kext
+		❯ ipsw kernel pac kernelcache.release.iPhone15,2 --summary
+		# List the pointers that share a diversity
+		❯ ipsw kernel pac kernelcache.release.iPhone15,2 --key DA --diversity 0xc26d
+		# Export the vtable methods of AMFI
+		❯ ipsw kernel pac kernelcache.release.iPhone15,2 --kext AppleMobileFileIntegrity --vtable vtable --json`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		q := &kernelcache.AuthPointerQuery{
+			Kext:   viper.GetString("kernel.pac.kext"),
+			Key:    viper.GetString("kernel.pac.key"),
+			VTable: viper.GetString("kernel.pac.vtable"),
+		}
+		if len(q.Key) > 0 && !slices.Contains(kernelcache.PACKeys, strings.ToUpper(q.Key)) {
+			return fmt.Errorf("invalid --key %s (must be one of: %s)", q.Key, strings.Join(kernelcache.PACKeys, ", "))
+		}
+		if div := viper.GetString("kernel.pac.diversity"); len(div) > 0 {
+			d, err := strconv.ParseUint(div, 0, 16)
+			if err != nil {
+				return fmt.Errorf("invalid --diversity %s: %w", div, err)
+			}
+			diversity := uint16(d)
+			q.Diversity = &diversity
+		}
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		aps, err := kernelcache.GetAuthPointers(m)
+		if err != nil {
+			return err
+		}
+		aps = kernelcache.QueryAuthPointers(aps, q)
+
+		if viper.GetBool("kernel.pac.summary") {
+			stats := kernelcache.AuthPointerSummary(aps)
+			if viper.GetBool("kernel.pac.json") {
+				return printJSON(stats)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEXT\tCOUNT\tIA\tIB\tDA\tDB\tADDR_DIV\tDIVERSITIES\tVTABLES")
+			for _, s := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", s.Kext, s.Count, s.Keys["IA"], s.Keys["IB"], s.Keys["DA"], s.Keys["DB"], s.AddrDiv, s.Diversities, s.VTables)
+			}
+			return w.Flush()
+		}
+
+		if viper.GetBool("kernel.pac.json") {
+			return printJSON(aps)
+		}
+		log.WithField("count", len(aps)).Info("Authenticated pointers")
+		for _, ap := range aps {
+			var vt string
+			if len(ap.VTable) > 0 {
+				vt = colorHash(fmt.Sprintf(" %s[%d]", ap.VTable, ap.Index))
+			}
+			fmt.Printf("%s: %-24s key=%s addr_div=%-5t diversity=%#04x → %#x %s%s\n",
+				colorHash(fmt.Sprintf("%#x", ap.Addr)), ap.Section, ap.Key, ap.AddrDiv, ap.Diversity, ap.Target, ap.Kext, vt)
+		}
+		return nil
+	},
+}
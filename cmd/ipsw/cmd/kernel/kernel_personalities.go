@@ -0,0 +1,118 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorKext = color.New(color.Bold, color.FgHiBlue).SprintFunc()
+var colorProp = color.New(color.Faint).SprintFunc()
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelPersonalitiesCmd)
+	kernelPersonalitiesCmd.Flags().StringP("class", "c", "", "Only personalities whose IOClass (or IOUserClass) matches a glob")
+	kernelPersonalitiesCmd.Flags().StringP("provider", "p", "", "Only personalities whose IOProviderClass matches a glob")
+	kernelPersonalitiesCmd.Flags().StringP("match", "m", "", "Only personalities with a matching property KEY[=VALUE] glob (i.e. IONameMatch=apple,spmi)")
+	kernelPersonalitiesCmd.Flags().BoolP("json", "j", false, "Output as (flattened) JSON")
+	viper.BindPFlag("kernel.personalities.class", kernelPersonalitiesCmd.Flags().Lookup("class"))
+	viper.BindPFlag("kernel.personalities.provider", kernelPersonalitiesCmd.Flags().Lookup("provider"))
+	viper.BindPFlag("kernel.personalities.match", kernelPersonalitiesCmd.Flags().Lookup("match"))
+	viper.BindPFlag("kernel.personalities.json", kernelPersonalitiesCmd.Flags().Lookup("json"))
+	kernelPersonalitiesCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelPersonalitiesCmd represents the kernel personalities command
+var kernelPersonalitiesCmd = &cobra.Command{
+	Use:     "personalities <kernelcache>",
+	Aliases: []string{"iokit", "p"},
+	Short:   "Query the IOKit personalities of the kexts",
+	Example: heredoc.Doc(`
+		# Which kext claims the SPMI controller?
+		❯ ipsw kernel personalities kernelcache.release.iPhone15,2 --match 'IONameMatch=apple,spmi*'
+		# List every driver that attaches to a USB host device
+		❯ ipsw kernel personalities kernelcache.release.iPhone15,2 --provider IOUSBHostDevice
+		# Export every personality
+		❯ ipsw kernel personalities kernelcache.release.iPhone15,2 --json > personalities.json`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		ps, err := kernelcache.GetPersonalities(m)
+		if err != nil {
+			return fmt.Errorf("failed to get IOKit personalities: %w", err)
+		}
+		ps, err = kernelcache.QueryPersonalities(ps, &kernelcache.PersonalityQuery{
+			IOClass:         viper.GetString("kernel.personalities.class"),
+			IOProviderClass: viper.GetString("kernel.personalities.provider"),
+			Match:           viper.GetString("kernel.personalities.match"),
+		})
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool("kernel.personalities.json") {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(ps)
+		}
+
+		log.WithField("count", len(ps)).Info("IOKit Personalities")
+		for _, p := range ps {
+			fmt.Printf("%s: %s", colorKext(p.Kext), p.Name)
+			for _, prop := range []struct{ key, val string }{
+				{"IOClass", p.IOClass},
+				{"IOProviderClass", p.IOProviderClass},
+				{"IOUserClass", p.IOUserClass},
+				{"IOMatchCategory", p.IOMatchCategory},
+			} {
+				if prop.val != "" {
+					fmt.Printf(" %s=%s", colorProp(prop.key), prop.val)
+				}
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
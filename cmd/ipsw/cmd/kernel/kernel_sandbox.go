@@ -0,0 +1,147 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelSandboxCmd)
+	kernelSandboxCmd.Flags().StringSliceP("profile", "p", []string{}, "Only show these profiles")
+	kernelSandboxCmd.Flags().BoolP("ops", "x", false, "List the sandbox operation names")
+	kernelSandboxCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelSandboxCmd.Flags().StringP("output", "o", "", "Folder to write the decompiled .sb profiles to")
+	kernelSandboxCmd.MarkFlagDirname("output")
+	viper.BindPFlag("kernel.sandbox.profile", kernelSandboxCmd.Flags().Lookup("profile"))
+	viper.BindPFlag("kernel.sandbox.ops", kernelSandboxCmd.Flags().Lookup("ops"))
+	viper.BindPFlag("kernel.sandbox.json", kernelSandboxCmd.Flags().Lookup("json"))
+	viper.BindPFlag("kernel.sandbox.output", kernelSandboxCmd.Flags().Lookup("output"))
+	kernelSandboxCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelSandboxCmd represents the sandbox command
+var kernelSandboxCmd = &cobra.Command{
+	Use:     "sandbox <kernelcache>",
+	Aliases: []string{"sb"},
+	Short:   "Decompile the kernelcache's builtin sandbox profiles",
+	Example: heredoc.Doc(`
+		# Decompile the builtin and platform sandbox profiles
+		❯ ipsw kernel sandbox kernelcache.release.iPhone15,2
+		# List the sandbox operations (and their categories)
+		❯ ipsw kernel sandbox kernelcache.release.iPhone15,2 --ops
+		# Only show the platform profile
+		❯ ipsw kernel sandbox kernelcache.release.iPhone15,2 --profile platform
+		# Write each profile to a .sb file
+		❯ ipsw kernel sandbox kernelcache.release.iPhone15,2 --output /tmp/SB`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		filter := viper.GetStringSlice("kernel.sandbox.profile")
+		output := viper.GetString("kernel.sandbox.output")
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		if viper.GetBool("kernel.sandbox.ops") {
+			ops, err := kernelcache.GetSandboxOpts(m)
+			if err != nil {
+				return err
+			}
+			if viper.GetBool("kernel.sandbox.json") {
+				dat, err := json.Marshal(ops)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(dat))
+				return nil
+			}
+			for _, op := range ops {
+				fmt.Printf("%3d: %-40s %s\n", op.Index, op.Name, color.New(color.Faint).Sprint(op.Category))
+			}
+			return nil
+		}
+
+		profiles, err := kernelcache.GetSandboxProfiles(m)
+		if err != nil {
+			return err
+		}
+		if len(filter) > 0 {
+			profiles = slices.DeleteFunc(profiles, func(p kernelcache.Profile) bool {
+				return !slices.Contains(filter, p.Name)
+			})
+			if len(profiles) == 0 {
+				return fmt.Errorf("no sandbox profiles found matching %v", filter)
+			}
+		}
+
+		if len(output) > 0 {
+			if err := os.MkdirAll(output, 0o750); err != nil {
+				return err
+			}
+			for _, p := range profiles {
+				fname := filepath.Join(output, p.Name+".sb")
+				log.Infof("Creating %s", fname)
+				if err := os.WriteFile(fname, []byte(p.String()), 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", fname, err)
+				}
+			}
+			return nil
+		}
+
+		if viper.GetBool("kernel.sandbox.json") {
+			dat, err := json.MarshalIndent(profiles, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		for _, p := range profiles {
+			fmt.Println(p)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kdp"
+	"github.com/caarlos0/ctrlc"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelSerialCmd)
+
+	kernelSerialCmd.Flags().IntP("baud", "b", kdp.DefaultBaudRate, "Baud rate")
+	kernelSerialCmd.Flags().StringP("output", "o", "", "Also log console to file")
+	kernelSerialCmd.Flags().StringSliceP("kernel", "k", []string{}, "Kernel/kernelcache(s) to search for symbols (in addition to installed KDKs)")
+	kernelSerialCmd.Flags().String("kdp", "", "KDP host to print LLDB commands for when the kernel waits for a debugger")
+	viper.BindPFlag("kernel.serial.baud", kernelSerialCmd.Flags().Lookup("baud"))
+	viper.BindPFlag("kernel.serial.output", kernelSerialCmd.Flags().Lookup("output"))
+	viper.BindPFlag("kernel.serial.kernel", kernelSerialCmd.Flags().Lookup("kernel"))
+	viper.BindPFlag("kernel.serial.kdp", kernelSerialCmd.Flags().Lookup("kdp"))
+}
+
+// kernelSerialCmd represents the serial command
+var kernelSerialCmd = &cobra.Command{
+	Use:   "serial <DEVICE|SOCKET>",
+	Short: "Read the kernel serial console (and find symbols when it panics)",
+	Example: heredoc.Doc(`
+		# Read the console of a device connected with a debug cable
+		❯ ipsw kernel serial /dev/cu.usbserial-XXXX
+		# Read the console of a debug cable's COM port on Windows
+		❯ ipsw kernel serial COM3
+		# Read the console of a VM and print LLDB commands when it waits for the debugger
+		❯ ipsw kernel serial /tmp/vm.serial --kdp 192.168.64.2`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		console, err := kdp.OpenSerial(args[0], viper.GetInt("kernel.serial.baud"))
+		if err != nil {
+			return err
+		}
+		defer console.Close()
+
+		var out *os.File
+		if output := viper.GetString("kernel.serial.output"); len(output) > 0 {
+			out, err = os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			defer out.Close()
+		}
+
+		var kv kdp.KernelVersion
+		var symsFound bool
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		log.Infof("Reading console %s (press Ctrl+C to stop)", args[0])
+		if err := ctrlc.Default.Run(ctx, func() error {
+			return kdp.ReadConsole(ctx, console, func(line string) {
+				fmt.Println(line)
+				if out != nil {
+					fmt.Fprintln(out, line)
+				}
+				if kdp.ParseConsoleLine(line, &kv) && !symsFound && len(kv.UUID) > 0 {
+					if syms, err := kdp.FindSymbols(&kv, viper.GetStringSlice("kernel.serial.kernel")...); err == nil {
+						symsFound = true
+						log.WithField("slide", fmt.Sprintf("%#x", syms.Slide)).Infof("Found symbols: %s", syms.Path)
+					} else {
+						log.Warn(err.Error())
+					}
+				}
+				if host := viper.GetString("kernel.serial.kdp"); len(host) > 0 && kdp.IsPanic(line) {
+					var syms *kdp.Symbols
+					if len(kv.UUID) > 0 {
+						syms, _ = kdp.FindSymbols(&kv, viper.GetStringSlice("kernel.serial.kernel")...)
+					}
+					fmt.Println(colorField("Paste into LLDB:"))
+					for _, c := range syms.LLDBCommands(host) {
+						fmt.Printf("    %s\n", c)
+					}
+				}
+			})
+		}); err != nil {
+			if errors.As(err, &ctrlc.ErrorCtrlC{}) {
+				log.Warn("Exiting...")
+				return nil
+			}
+			return err
+		}
+
+		return nil
+	},
+}
@@ -29,9 +29,13 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/offline"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/blacktop/ipsw/pkg/kernelcache/export"
 	"github.com/blacktop/ipsw/pkg/signature"
 	"github.com/fatih/color"
 	"github.com/invopop/jsonschema"
@@ -53,6 +57,14 @@ func init() {
 	kernelSymbolicateCmd.Flags().Uint64P("lookup", "l", 0, "Lookup a symbol by address")
 	kernelSymbolicateCmd.Flags().StringP("output", "o", "", "Folder to write files to")
 	kernelSymbolicateCmd.MarkFlagDirname("output")
+	kernelSymbolicateCmd.Flags().StringP("export", "e", "", "Export function starts, symbols and kext boundaries for: ghidra, ida or binja")
+	kernelSymbolicateCmd.RegisterFlagCompletionFunc("export", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{
+			"ghidra\tGhidra python script",
+			"ida\tIDA IDC script",
+			"binja\tBinary Ninja import JSON",
+		}, cobra.ShellCompDirectiveNoFileComp
+	})
 	viper.BindPFlag("kernel.symbolicate.flat", kernelSymbolicateCmd.Flags().Lookup("flat"))
 	viper.BindPFlag("kernel.symbolicate.json", kernelSymbolicateCmd.Flags().Lookup("json"))
 	viper.BindPFlag("kernel.symbolicate.quiet", kernelSymbolicateCmd.Flags().Lookup("quiet"))
@@ -61,13 +73,20 @@ func init() {
 	viper.BindPFlag("kernel.symbolicate.signatures", kernelSymbolicateCmd.Flags().Lookup("signatures"))
 	viper.BindPFlag("kernel.symbolicate.lookup", kernelSymbolicateCmd.Flags().Lookup("lookup"))
 	viper.BindPFlag("kernel.symbolicate.output", kernelSymbolicateCmd.Flags().Lookup("output"))
+	viper.BindPFlag("kernel.symbolicate.export", kernelSymbolicateCmd.Flags().Lookup("export"))
 }
 
 // kernelSymbolicateCmd represents the symbolicate command
 var kernelSymbolicateCmd = &cobra.Command{
-	Use:           "symbolicate",
-	Aliases:       []string{"sym"},
-	Short:         "Symbolicate kernelcache",
+	Use:     "symbolicate",
+	Aliases: []string{"sym"},
+	Short:   "Symbolicate kernelcache",
+	Example: heredoc.Doc(`
+		# Symbolicate a kernelcache
+		❯ ipsw kernel symbolicate --signatures /path/to/symbolicator/kernel kernelcache.release.iPhone15,2
+
+		# Export a Ghidra script that pre-annotates the kernelcache (run it from the Script Manager)
+		❯ ipsw kernel symbolicate -s /path/to/symbolicator/kernel --export ghidra kernelcache.release.iPhone15,2`),
 	Args:          cobra.MinimumNArgs(1),
 	SilenceUsage:  true,
 	SilenceErrors: true,
@@ -107,7 +126,7 @@ var kernelSymbolicateCmd = &cobra.Command{
 			log.Info("Looking up symbol")
 			smap := signature.NewSymbolMap()
 			if err := smap.LoadJSON(args[0]); err != nil {
-				return fmt.Errorf("failed to load symbol map: %v", err)
+				return fmt.Errorf("failed to load symbol map: %w", err)
 			}
 			addr := viper.GetUint64("kernel.symbolicate.lookup")
 			if sym, ok := smap[addr]; ok {
@@ -117,22 +136,35 @@ var kernelSymbolicateCmd = &cobra.Command{
 			return fmt.Errorf("symbol not found at address %#x", addr)
 		}
 
-		if !viper.IsSet("kernel.symbolicate.signatures") {
+		var format export.Format
+		if viper.IsSet("kernel.symbolicate.export") {
+			if format, err = export.ParseFormat(viper.GetString("kernel.symbolicate.export")); err != nil {
+				return err
+			}
+		}
+
+		sigsDir := offline.PathOr(viper.GetString("kernel.symbolicate.signatures"), offline.Signatures)
+		if sigsDir == "" {
 			return fmt.Errorf("you must provide a path to the --signatures folder")
 		}
 
 		log.Info("Parsing Signatures")
-		sigs, err := signature.Parse(viper.GetString("kernel.symbolicate.signatures"))
+		sigs, err := signature.Parse(sigsDir)
 		if err != nil {
-			return fmt.Errorf("failed to parse signatures: %v", err)
+			return fmt.Errorf("failed to parse signatures: %w", err)
 		}
 
 		smap := signature.NewSymbolMap()
 
 		// symbolicate kernelcache
+		kcPath, err := kernelcache.DecompressedPath(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+
 		log.WithField("kernelcache", filepath.Base(args[0])).Info("Symbolicating...")
-		if err := smap.Symbolicate(args[0], sigs, quiet); err != nil {
-			return fmt.Errorf("failed to symbolicate kernelcache: %v", err)
+		if err := smap.Symbolicate(kcPath, sigs, quiet); err != nil {
+			return fmt.Errorf("failed to symbolicate kernelcache: %w", err)
 		}
 
 		// test the accuracy of the symbolication on the source KDK material
@@ -142,7 +174,7 @@ var kernelSymbolicateCmd = &cobra.Command{
 			log.Warn("Testing symbol matches")
 			m, err := macho.Open(args[0] + ".dSYM/Contents/Resources/DWARF/" + filepath.Base(args[0]))
 			if err != nil {
-				return fmt.Errorf("failed to open kernelcache: %v", err)
+				return fmt.Errorf("failed to open kernelcache: %w", err)
 			}
 			defer m.Close()
 			for addr, sym := range smap {
@@ -186,12 +218,38 @@ var kernelSymbolicateCmd = &cobra.Command{
 			return nil
 		}
 
+		/* DISASSEMBLER EXPORT */
+
+		if format != "" {
+			m, err := macho.Open(kcPath)
+			if err != nil {
+				return fmt.Errorf("failed to open kernelcache: %w", err)
+			}
+			defer m.Close()
+			annots, err := export.Collect(m, smap)
+			if err != nil {
+				return fmt.Errorf("failed to collect kernelcache annotations: %w", err)
+			}
+			fname := filepath.Join(output, filepath.Base(args[0])+format.Ext())
+			log.WithFields(log.Fields{
+				"functions": len(annots.Functions),
+				"symbols":   len(annots.Symbols),
+				"kexts":     len(annots.Kexts),
+			}).Infof("Writing %s export to %s", format, fname)
+			f, err := os.Create(fname)
+			if err != nil {
+				return fmt.Errorf("failed to create export file: %w", err)
+			}
+			defer f.Close()
+			return annots.Write(f, format)
+		}
+
 		/* JSON OUTPUT */
 
 		if viper.GetBool("kernel.symbolicate.json") {
 			jdat, err := json.Marshal(smap)
 			if err != nil {
-				return fmt.Errorf("failed to marshal symbol map: %v", err)
+				return fmt.Errorf("failed to marshal symbol map: %w", err)
 			}
 			fname := filepath.Join(output, filepath.Base(args[0])+".symbols.json")
 			log.Infof("Writing symbols as JSON to %s", fname)
@@ -205,7 +263,7 @@ var kernelSymbolicateCmd = &cobra.Command{
 			log.Infof("Writing symbols to %s", fname)
 			f, err := os.Create(fname)
 			if err != nil {
-				return fmt.Errorf("failed to create symbols file: %v", err)
+				return fmt.Errorf("failed to create symbols file: %w", err)
 			}
 			defer f.Close()
 			for addr, sym := range smap {
@@ -22,15 +22,17 @@ THE SOFTWARE.
 package kernel
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
-	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
-	"github.com/blacktop/go-macho/types"
-	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/stable"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -39,23 +41,31 @@ import (
 
 func init() {
 	KernelcacheCmd.AddCommand(symbolsetsCmd)
-	kextsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+	symbolsetsCmd.Flags().BoolP("kexts", "k", false, "Show the KPI symbols each KEXT imports")
+	symbolsetsCmd.Flags().String("diff", "", "Diff the KPI symbol sets against another kernelcache")
+	symbolsetsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	symbolsetsCmd.MarkFlagFilename("diff")
+	viper.BindPFlag("kernel.symbolsets.kexts", symbolsetsCmd.Flags().Lookup("kexts"))
+	viper.BindPFlag("kernel.symbolsets.diff", symbolsetsCmd.Flags().Lookup("diff"))
+	viper.BindPFlag("kernel.symbolsets.json", symbolsetsCmd.Flags().Lookup("json"))
+	symbolsetsCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
 }
 
-type symbolsSets struct {
-	SymbolsSetsDictionary []cFBundle `plist:"SymbolsSets,omitempty"`
+func openKernelcache(path string) (*macho.File, error) {
+	m, err := kernelcache.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s appears to not be a valid MachO", path)
+	}
+	return m, nil
 }
 
-type cFBundle struct {
-	ID                string   `plist:"CFBundleIdentifier,omitempty"`
-	CompatibleVersion string   `plist:"OSBundleCompatibleVersion,omitempty"`
-	Version           string   `plist:"CFBundleVersion,omitempty"`
-	Symbols           []symbol `plist:"Symbols,omitempty"`
-}
-
-type symbol struct {
-	Name   string `plist:"SymbolName,omitempty"`
-	Prefix string `plist:"SymbolPrefix,omitempty"`
+func printJSON(v any) error {
+	dat, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(dat))
+	return nil
 }
 
 // symbolsetsCmd represents the symbolsets command
@@ -63,7 +73,16 @@ var symbolsetsCmd = &cobra.Command{
 	Use:     "symbolsets <kernelcache>",
 	Aliases: []string{"ss"},
 	Short:   "Dump kernel symbolsets",
-	Args:    cobra.MinimumNArgs(1),
+	Example: heredoc.Doc(`
+		# Dump the KPI symbol sets of a macOS kernel collection
+		❯ ipsw kernel symbolsets /System/Library/KernelCollections/BootKernelExtensions.kc
+		# Show which KPI symbols each KEXT imports
+		❯ ipsw kernel symbolsets BootKernelExtensions.kc --kexts
+		# Diff the KPI surface between macOS releases
+		❯ ipsw kernel symbolsets 24A335/BootKernelExtensions.kc --diff 23A344/BootKernelExtensions.kc`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if viper.GetBool("verbose") {
@@ -71,48 +90,101 @@ var symbolsetsCmd = &cobra.Command{
 		}
 		color.NoColor = viper.GetBool("no-color")
 
-		if _, err := os.Stat(args[0]); os.IsNotExist(err) {
-			return fmt.Errorf("file %s does not exist", args[0])
-		}
+		asJSON := viper.GetBool("kernel.symbolsets.json")
 
-		m, err := macho.Open(args[0])
+		m, err := openKernelcache(args[0])
 		if err != nil {
-			return errors.Wrapf(err, "%s appears to not be a valid MachO", args[0])
+			return err
 		}
+		defer m.Close()
 
-		if m.FileTOC.FileHeader.Type == types.MH_FILESET {
-			m, err = m.GetFileSetFileByName("com.apple.kernel")
+		if viper.GetBool("kernel.symbolsets.kexts") {
+			linkages, err := kernelcache.GetKextLinkage(m)
 			if err != nil {
-				return fmt.Errorf("failed to parse entry com.apple.kernel; %v", err)
+				return err
+			}
+			if asJSON {
+				return printJSON(linkages)
+			}
+			for _, kl := range linkages {
+				head := fmt.Sprintf("%s: (imports %d, exports %d)", kl.ID, len(kl.Imports), len(kl.Exports))
+				fmt.Printf("\n%s\n", head)
+				fmt.Println(strings.Repeat("-", len(head)))
+				kpis := make([]string, 0, len(kl.KPIs))
+				for kpi := range kl.KPIs {
+					kpis = append(kpis, kpi)
+				}
+				sort.Strings(kpis)
+				for _, kpi := range kpis {
+					fmt.Printf("%s\n", colorAdded(kpi))
+					for _, sym := range kl.KPIs[kpi] {
+						fmt.Printf("    %s\n", sym)
+					}
+				}
+				if len(kl.Other) > 0 {
+					fmt.Printf("%s\n", colorHash("other"))
+					for _, sym := range kl.Other {
+						fmt.Printf("    %s\n", sym)
+					}
+				}
 			}
-		}
-
-		symbolsets := m.Section("__LINKINFO", "__symbolsets")
-		if symbolsets == nil {
-			log.Error("kernelcache does NOT contain __LINKINFO.__symbolsets")
 			return nil
 		}
 
-		dat := make([]byte, symbolsets.Size)
-		m.ReadAt(dat, int64(symbolsets.Offset))
-
-		var blist symbolsSets
+		sets, err := kernelcache.GetSymbolSets(m)
+		if err != nil {
+			return err
+		}
 
-		dec := plist.NewDecoder(bytes.NewReader(dat))
+		if other := viper.GetString("kernel.symbolsets.diff"); len(other) > 0 {
+			om, err := openKernelcache(other)
+			if err != nil {
+				return err
+			}
+			defer om.Close()
+			prev, err := kernelcache.GetSymbolSets(om)
+			if err != nil {
+				return err
+			}
+			diffs := kernelcache.DiffSymbolSets(prev, sets)
+			if asJSON {
+				return printJSON(diffs)
+			}
+			if len(diffs) == 0 {
+				log.Info("No KPI symbol set changes")
+				return nil
+			}
+			for _, d := range diffs {
+				fmt.Printf("\n%s\n", d.ID)
+				fmt.Println(strings.Repeat("-", len(d.ID)))
+				for _, sym := range d.New {
+					fmt.Println(colorAdded("+ " + sym))
+				}
+				for _, sym := range d.Removed {
+					fmt.Println(colorRemoved("- " + sym))
+				}
+			}
+			return nil
+		}
 
-		err = dec.Decode(&blist)
-		if err != nil {
-			return errors.Wrapf(err, "failed to parse __symbolsets bplist data")
+		if viper.GetBool("stable") { // the symbol sets are in __symbolsets plist order (symbols are already sorted)
+			stable.SortBy(sets, func(sset kernelcache.SymbolSet) string { return sset.ID })
+		}
+		if asJSON {
+			return printJSON(sets)
 		}
 
 		fmt.Println("Symbol Sets")
 		fmt.Println("===========")
-		for _, sset := range blist.SymbolsSetsDictionary {
+		for _, sset := range sets {
 			head := fmt.Sprintf("%s: (%s)", sset.ID, sset.Version)
 			fmt.Printf("\n%s\n", head)
 			fmt.Println(strings.Repeat("-", len(head)))
+			for _, prefix := range sset.Prefixes {
+				fmt.Printf("%s*\n", prefix)
+			}
 			for _, sym := range sset.Symbols {
-				fmt.Printf("%s%s\n", sym.Prefix, sym.Name)
+				fmt.Println(sym)
 			}
 		}
 
@@ -28,7 +28,6 @@ import (
 	"text/tabwriter"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -70,7 +69,7 @@ var syscallCmd = &cobra.Command{
 
 		machoPath := filepath.Clean(args[0])
 
-		m, err := macho.Open(machoPath)
+		m, err := kernelcache.Open(machoPath)
 		if err != nil {
 			return err
 		}
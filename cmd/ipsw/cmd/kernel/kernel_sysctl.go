@@ -0,0 +1,114 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelSysctlCmd)
+	kernelSysctlCmd.Flags().StringP("filter", "f", "", "Only show sysctls whose name starts with this prefix")
+	kernelSysctlCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelSysctlCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// filterSysctls returns the top-most sysctls whose name starts with prefix (along with their children)
+func filterSysctls(sysctls []*kernelcache.Sysctl, prefix string) []*kernelcache.Sysctl {
+	var matched []*kernelcache.Sysctl
+	for _, s := range sysctls {
+		if strings.HasPrefix(s.Name, prefix) {
+			matched = append(matched, s)
+		} else if strings.HasPrefix(prefix, s.Name+".") {
+			matched = append(matched, filterSysctls(s.Children, prefix)...)
+		}
+	}
+	return matched
+}
+
+// kernelSysctlCmd represents the sysctl command
+var kernelSysctlCmd = &cobra.Command{
+	Use:     "sysctl <kernelcache>",
+	Aliases: []string{"sysctls"},
+	Short:   "List the sysctls declared by the kernel and its kexts",
+	Example: heredoc.Doc(`
+		# List every statically declared sysctl
+		❯ ipsw kernel sysctl kernelcache.release.iPhone15,2
+		# Only the kern.* sysctls as JSON
+		❯ ipsw kernel sysctl kernelcache.release.iPhone15,2 --filter kern. --json`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		filter, _ := cmd.Flags().GetString("filter")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		sysctls, err := kernelcache.GetSysctls(m)
+		if err != nil {
+			return err
+		}
+
+		if len(filter) > 0 {
+			sysctls = filterSysctls(sysctls, filter)
+		}
+
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(sysctls)
+		}
+
+		kernelcache.WalkSysctls(sysctls, func(s *kernelcache.Sysctl, _ int) {
+			line := s.String()
+			if s.Type == "node" {
+				line = color.New(color.Bold).Sprint(line)
+			}
+			if len(s.Description) > 0 {
+				line += color.New(color.Faint).Sprintf(" // %s", s.Description)
+			}
+			fmt.Println(line)
+		})
+
+		return nil
+	},
+}
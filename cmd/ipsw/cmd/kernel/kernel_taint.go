@@ -0,0 +1,129 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	cgcmd "github.com/blacktop/ipsw/internal/commands/callgraph"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelTaintCmd)
+	kernelTaintCmd.Flags().Bool("syscalls", false, "Track BSD syscall arguments")
+	kernelTaintCmd.Flags().Bool("mach-traps", false, "Track mach trap arguments")
+	kernelTaintCmd.Flags().Bool("mig", false, "Track MIG request messages")
+	kernelTaintCmd.Flags().Bool("external-methods", false, "Track IOUserClient::externalMethod arguments")
+	kernelTaintCmd.Flags().StringArrayP("entry", "e", []string{}, "Custom entry point as SYMBOL|ADDR[:REG,...] (i.e. _my_handler:x1,x2)")
+	kernelTaintCmd.Flags().StringArrayP("kext", "k", []string{}, "Only analyze these fileset entries (the kernel is always analyzed)")
+	kernelTaintCmd.Flags().IntP("depth", "d", callgraph.DefaultTaintDepth, "How many calls deep to follow tainted arguments")
+	kernelTaintCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("kernel.taint.syscalls", kernelTaintCmd.Flags().Lookup("syscalls"))
+	viper.BindPFlag("kernel.taint.mach-traps", kernelTaintCmd.Flags().Lookup("mach-traps"))
+	viper.BindPFlag("kernel.taint.mig", kernelTaintCmd.Flags().Lookup("mig"))
+	viper.BindPFlag("kernel.taint.external-methods", kernelTaintCmd.Flags().Lookup("external-methods"))
+	viper.BindPFlag("kernel.taint.entry", kernelTaintCmd.Flags().Lookup("entry"))
+	kernelTaintCmd.RegisterFlagCompletionFunc("kext", complete.Kexts)
+	viper.BindPFlag("kernel.taint.kext", kernelTaintCmd.Flags().Lookup("kext"))
+	viper.BindPFlag("kernel.taint.depth", kernelTaintCmd.Flags().Lookup("depth"))
+	viper.BindPFlag("kernel.taint.json", kernelTaintCmd.Flags().Lookup("json"))
+	kernelTaintCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+// kernelTaintCmd represents the taint command
+var kernelTaintCmd = &cobra.Command{
+	Use:   "taint <kernelcache>",
+	Short: "🚧 Flag user controlled inputs reaching memory/length operations",
+	Long: heredoc.Doc(`
+		Lightweight data-flow pass that tracks user controlled inputs (syscall args, mach trap args,
+		MIG messages and IOKit external method arguments) into memcpy/copyin/kalloc style
+		length/destination arguments and table indexes.
+
+		NOTE: this is a triage aid, findings are candidate spots for review NOT confirmed bugs.`),
+	Example: heredoc.Doc(`
+		# Track syscall and mach trap arguments
+		❯ ipsw kernel taint kernelcache.release.iPhone15,2 --syscalls --mach-traps
+		# Track a kext's external methods
+		❯ ipsw kernel taint kernelcache.release.iPhone15,2 --external-methods -k com.apple.driver.AppleH13CamIn
+		# Track a custom handler's second and third arguments
+		❯ ipsw kernel taint kernelcache.release.iPhone15,2 -e _my_handler:x1,x2 --json`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		kexts := viper.GetStringSlice("kernel.taint.kext")
+		conf := &cgcmd.TaintConfig{
+			Syscalls:        viper.GetBool("kernel.taint.syscalls"),
+			MachTraps:       viper.GetBool("kernel.taint.mach-traps"),
+			MIG:             viper.GetBool("kernel.taint.mig"),
+			ExternalMethods: viper.GetBool("kernel.taint.external-methods"),
+			Entries:         viper.GetStringSlice("kernel.taint.entry"),
+			Depth:           viper.GetInt("kernel.taint.depth"),
+			JSON:            viper.GetBool("kernel.taint.json"),
+		}
+		if !conf.Syscalls && !conf.MachTraps && !conf.MIG && !conf.ExternalMethods && len(conf.Entries) == 0 {
+			return fmt.Errorf("you must supply at least one of --syscalls, --mach-traps, --mig, --external-methods or --entry")
+		}
+
+		m, err := kernelcache.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+
+		var ms []*macho.File
+		if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+			for _, fe := range m.FileSets() {
+				if len(kexts) > 0 && fe.EntryID != "com.apple.kernel" && !slices.Contains(kexts, fe.EntryID) {
+					continue
+				}
+				mfe, err := m.GetFileSetFileByName(fe.EntryID)
+				if err != nil {
+					return fmt.Errorf("failed to parse entry %s: %w", fe.EntryID, err)
+				}
+				ms = append(ms, mfe)
+			}
+		} else {
+			ms = append(ms, m)
+		}
+
+		return cgcmd.Taint(m, ms, conf)
+	},
+}
@@ -27,7 +27,6 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -62,7 +61,7 @@ var kernelVersionCmd = &cobra.Command{
 
 		machoPath := filepath.Clean(args[0])
 
-		m, err := macho.Open(machoPath)
+		m, err := kernelcache.Open(machoPath)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelZonesCmd)
+	kernelZonesCmd.Flags().String("diff", "", "Diff the zones and kalloc_type views against another kernelcache")
+	kernelZonesCmd.Flags().StringP("filter", "f", "", "Only show the zones/kalloc_type views whose name contains a substring")
+	kernelZonesCmd.Flags().Bool("data-only", false, "Only show the kalloc_type views of data-only (pointer free) types")
+	kernelZonesCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	kernelZonesCmd.MarkFlagFilename("diff")
+	viper.BindPFlag("kernel.zones.diff", kernelZonesCmd.Flags().Lookup("diff"))
+	viper.BindPFlag("kernel.zones.filter", kernelZonesCmd.Flags().Lookup("filter"))
+	viper.BindPFlag("kernel.zones.data-only", kernelZonesCmd.Flags().Lookup("data-only"))
+	viper.BindPFlag("kernel.zones.json", kernelZonesCmd.Flags().Lookup("json"))
+	kernelZonesCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+}
+
+func getZoneInfo(path string) (*kernelcache.ZoneInfo, error) {
+	m, err := kernelcache.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return kernelcache.GetZoneInfo(m)
+}
+
+// filterZoneInfo keeps the zones and kalloc_type views that match the --filter and --data-only flags
+func filterZoneInfo(zi *kernelcache.ZoneInfo, filter string, dataOnly bool) {
+	if len(filter) > 0 {
+		var zones []kernelcache.Zone
+		for _, z := range zi.Zones {
+			if strings.Contains(z.Name, filter) {
+				zones = append(zones, z)
+			}
+		}
+		zi.Zones = zones
+	}
+	var kts []kernelcache.KallocType
+	for _, kt := range zi.KallocTypes {
+		if (len(filter) == 0 || strings.Contains(kt.Name, filter)) && (!dataOnly || kt.Flags&kernelcache.KTDataOnly != 0) {
+			kts = append(kts, kt)
+		}
+	}
+	zi.KallocTypes = kts
+}
+
+// kernelZonesCmd represents the zones command
+var kernelZonesCmd = &cobra.Command{
+	Use:     "zones <kernelcache>",
+	Aliases: []string{"z", "kalloc"},
+	Short:   "Dump the zone allocator's zones and kalloc_type views",
+	Example: heredoc.Doc(`
+		# List the zones and the kalloc_type views (type signatures) of every kext
+		❯ ipsw kernel zones kernelcache.release.iPhone15,2
+		# Find the allocation sites of a type
+		❯ ipsw kernel zones kernelcache.release.iPhone15,2 --filter ipc_port
+		# Show the kalloc_type changes between builds
+		❯ ipsw kernel zones kernelcache.release.iPhone15,2 --diff 21A329/kernelcache.release.iPhone15,2`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		filter := viper.GetString("kernel.zones.filter")
+		dataOnly := viper.GetBool("kernel.zones.data-only")
+
+		zi, err := getZoneInfo(filepath.Clean(args[0]))
+		if err != nil {
+			return err
+		}
+		filterZoneInfo(zi, filter, dataOnly)
+
+		if other := viper.GetString("kernel.zones.diff"); len(other) > 0 {
+			prev, err := getZoneInfo(filepath.Clean(other))
+			if err != nil {
+				return err
+			}
+			filterZoneInfo(prev, filter, dataOnly)
+			diff := kernelcache.DiffZoneInfo(prev, zi)
+			if viper.GetBool("kernel.zones.json") {
+				return printJSON(diff)
+			}
+			for _, z := range diff.NewZones {
+				fmt.Println(colorAdded("+ zone " + z.String()))
+			}
+			for _, z := range diff.RemovedZones {
+				fmt.Println(colorRemoved("- zone " + z.String()))
+			}
+			for _, c := range diff.ChangedZones {
+				fmt.Printf("~ zone %s → %s\n", colorRemoved(c[0].String()), colorAdded(c[1].String()))
+			}
+			for _, kt := range diff.NewKallocTypes {
+				fmt.Println(colorAdded(fmt.Sprintf("+ %s %s", kt.Kext, kt)))
+			}
+			for _, kt := range diff.RemovedKallocTypes {
+				fmt.Println(colorRemoved(fmt.Sprintf("- %s %s", kt.Kext, kt)))
+			}
+			for _, c := range diff.ChangedKallocTypes {
+				fmt.Printf("~ %s %s → %s\n", c[1].Kext, colorRemoved(c[0].String()), colorAdded(c[1].String()))
+			}
+			if len(diff.NewZones)+len(diff.RemovedZones)+len(diff.ChangedZones)+
+				len(diff.NewKallocTypes)+len(diff.RemovedKallocTypes)+len(diff.ChangedKallocTypes) == 0 {
+				log.Info("No zone or kalloc_type changes")
+			}
+			return nil
+		}
+
+		if viper.GetBool("kernel.zones.json") {
+			return printJSON(zi)
+		}
+
+		if len(zi.Zones) > 0 {
+			log.WithField("count", len(zi.Zones)).Info("Zones")
+			for _, z := range zi.Zones {
+				fmt.Printf("%-40s size=%-6d %s\n", z.Name, z.Size, colorHash(fmt.Sprintf("flags=%#x", z.Flags)))
+			}
+		}
+		log.WithField("count", len(zi.KallocTypes)).Info("kalloc_type views")
+		var kext string
+		for _, kt := range zi.KallocTypes {
+			if kt.Kext != kext {
+				kext = kt.Kext
+				fmt.Printf("\n[%s]\n", colorKext(kext))
+			}
+			fmt.Printf("%s: %s\n", colorHash(fmt.Sprintf("%#x", kt.Addr)), kt)
+		}
+		return nil
+	},
+}
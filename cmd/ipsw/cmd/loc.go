@@ -0,0 +1,200 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/localize"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorLang = color.New(color.Faint).SprintFunc()
+
+func init() {
+	rootCmd.AddCommand(locCmd)
+
+	locCmd.Flags().StringSliceP("lang", "l", []string{"en"}, "Languages to extract (use 'all' for every language)")
+	locCmd.Flags().StringP("search", "s", "", "Only show strings whose key or value match this regex")
+	locCmd.Flags().Bool("json", false, "Output as JSON")
+	locCmd.Flags().StringP("output", "o", "", "Save the strings (or diff) as JSON to this file")
+	locCmd.Flags().String("pem-db", "", "AEA pem DB JSON file")
+	viper.BindPFlag("loc.lang", locCmd.Flags().Lookup("lang"))
+	viper.BindPFlag("loc.search", locCmd.Flags().Lookup("search"))
+	viper.BindPFlag("loc.json", locCmd.Flags().Lookup("json"))
+	viper.BindPFlag("loc.output", locCmd.Flags().Lookup("output"))
+	viper.BindPFlag("loc.pem-db", locCmd.Flags().Lookup("pem-db"))
+}
+
+func locCatalog(input string, langs []string) (*localize.Catalog, error) {
+	cat := localize.NewCatalog(langs...)
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", input, err)
+	}
+	switch {
+	case info.IsDir():
+		log.Infof("Parsing localized strings in %s", input)
+		err = cat.AddFolder(input)
+	case localize.IsLocalizationFile(input):
+		var data []byte
+		if data, err = os.ReadFile(input); err == nil {
+			err = cat.Add(input, data)
+		}
+	default:
+		log.Infof("Parsing localized strings in %s", input)
+		err = cat.AddIPSW(input, viper.GetString("loc.pem-db"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+func printLocStrings(title string, strs []localize.String) {
+	if len(strs) == 0 {
+		return
+	}
+	if title != "" {
+		fmt.Printf("\n%s (%d)\n", title, len(strs))
+	}
+	table := ""
+	for _, s := range strs {
+		if s.Table != table {
+			table = s.Table
+			fmt.Printf("\n%s\n", colorBin(table))
+		}
+		val := strings.ReplaceAll(s.Value, "\n", `\n`)
+		if s.Old != "" {
+			val = fmt.Sprintf("%s -> %s", strings.ReplaceAll(s.Old, "\n", `\n`), val)
+		}
+		fmt.Printf("  %s %s = %s\n", colorLang(fmt.Sprintf("%-6s", s.Lang)), colorKey(s.Key), val)
+	}
+}
+
+func saveLocJSON(v any) error {
+	dat, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if output := viper.GetString("loc.output"); output != "" {
+		log.Infof("Saving %s", output)
+		return os.WriteFile(output, dat, 0o660)
+	}
+	fmt.Println(string(dat))
+	return nil
+}
+
+// locCmd represents the loc command
+var locCmd = &cobra.Command{
+	Use:     "loc <IPSW|FOLDER|FILE> [<IPSW|FOLDER>]",
+	Aliases: []string{"localize"},
+	Short:   "Extract (or diff) the localized .strings, .stringsdict and .loctable strings of a build",
+	Example: heredoc.Doc(`
+		# Dump the English strings of an IPSW
+		❯ ipsw loc iPhone16,1_18.0_22A3354_Restore.ipsw
+		# Search a mounted filesystem's strings (in every language)
+		❯ ipsw loc /Volumes/SkyF22A5282m.D8xOS --lang all --search 'Apple Intelligence'
+		# Diff the strings of two betas (to spot unannounced features)
+		❯ ipsw loc <old.ipsw> <new.ipsw> --output strings_diff.json`),
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		var langs []string
+		for _, lang := range viper.GetStringSlice("loc.lang") {
+			if strings.EqualFold(lang, "all") {
+				langs = nil
+				break
+			}
+			langs = append(langs, lang)
+		}
+		var re *regexp.Regexp
+		if pattern := viper.GetString("loc.search"); pattern != "" {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid --search regex: %v", err)
+			}
+		}
+		match := func(strs []localize.String) []localize.String {
+			if re == nil {
+				return strs
+			}
+			var out []localize.String
+			for _, s := range strs {
+				if re.MatchString(s.Key) || re.MatchString(s.Value) || re.MatchString(s.Old) {
+					out = append(out, s)
+				}
+			}
+			return out
+		}
+
+		prev, err := locCatalog(filepath.Clean(args[0]), langs)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			strs := prev.Search(re)
+			if viper.GetBool("loc.json") || viper.GetString("loc.output") != "" {
+				return saveLocJSON(strs)
+			}
+			printLocStrings("", strs)
+			return nil
+		}
+
+		next, err := locCatalog(filepath.Clean(args[1]), langs)
+		if err != nil {
+			return err
+		}
+		d := localize.Compare(prev, next)
+		d.New, d.Removed, d.Changed = match(d.New), match(d.Removed), match(d.Changed)
+
+		if viper.GetBool("loc.json") || viper.GetString("loc.output") != "" {
+			return saveLocJSON(d)
+		}
+		if d.Empty() {
+			log.Info("No localized strings changed")
+			return nil
+		}
+		printLocStrings("🆕 NEW", d.New)
+		printLocStrings("❌ Removed", d.Removed)
+		printLocStrings("⬆️ Updated", d.Changed)
+
+		return nil
+	},
+}
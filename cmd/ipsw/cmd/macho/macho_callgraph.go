@@ -0,0 +1,208 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	cgcmd "github.com/blacktop/ipsw/internal/commands/callgraph"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	MachoCmd.AddCommand(machoCallgraphCmd)
+	machoCallgraphCmd.Flags().String("arch", "", "Which architecture to use for fat/universal MachO")
+	machoCallgraphCmd.Flags().StringP("fileset-entry", "t", "", "Which fileset entry to analyze")
+	machoCallgraphCmd.Flags().BoolP("all-fileset-entries", "z", false, "Analyze all fileset entries (entire kernelcache)")
+	machoCallgraphCmd.Flags().Bool("indirect", false, "Add indirect call hints (objc_msgSend selectors and function pointers)")
+	machoCallgraphCmd.Flags().StringP("format", "f", cgcmd.FormatDOT, fmt.Sprintf("Export format (%s) or fact database format (%s)", strings.Join(cgcmd.Formats, ", "), strings.Join(cgcmd.FactFormats, ", ")))
+	machoCallgraphCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return append(cgcmd.Formats, cgcmd.FactFormats...), cobra.ShellCompDirectiveDefault
+	})
+	machoCallgraphCmd.Flags().StringP("output", "o", "", "Output file (defaults to stdout) or facts directory (souffle)")
+	machoCallgraphCmd.Flags().StringP("root", "r", "", "Only export functions reachable from this symbol/address/kext")
+	machoCallgraphCmd.Flags().IntP("depth", "d", 0, "Max call depth from --root (0 is unlimited)")
+	machoCallgraphCmd.Flags().String("from", "", "Reachability query source (symbol/address/kext)")
+	machoCallgraphCmd.Flags().String("to", "", "Reachability query target (symbol/address/kext)")
+	viper.BindPFlag("macho.callgraph.arch", machoCallgraphCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.callgraph.fileset-entry", machoCallgraphCmd.Flags().Lookup("fileset-entry"))
+	viper.BindPFlag("macho.callgraph.all-fileset-entries", machoCallgraphCmd.Flags().Lookup("all-fileset-entries"))
+	viper.BindPFlag("macho.callgraph.indirect", machoCallgraphCmd.Flags().Lookup("indirect"))
+	viper.BindPFlag("macho.callgraph.format", machoCallgraphCmd.Flags().Lookup("format"))
+	viper.BindPFlag("macho.callgraph.output", machoCallgraphCmd.Flags().Lookup("output"))
+	viper.BindPFlag("macho.callgraph.root", machoCallgraphCmd.Flags().Lookup("root"))
+	viper.BindPFlag("macho.callgraph.depth", machoCallgraphCmd.Flags().Lookup("depth"))
+	viper.BindPFlag("macho.callgraph.from", machoCallgraphCmd.Flags().Lookup("from"))
+	viper.BindPFlag("macho.callgraph.to", machoCallgraphCmd.Flags().Lookup("to"))
+
+	machoCallgraphCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// machoCallgraphCmd represents the callgraph command
+var machoCallgraphCmd = &cobra.Command{
+	Use:     "callgraph <MACHO>",
+	Aliases: []string{"cg"},
+	Short:   "Build ARM64 MachO/kext call graph",
+	Example: heredoc.Doc(`
+		# Export a MachO's call graph as DOT
+		❯ ipsw macho callgraph /usr/libexec/amfid --output amfid.dot
+		# Export a kext's call graph as GraphML (with objc/function pointer hints)
+		❯ ipsw macho callgraph kernelcache.release.iPhone15,2 -t com.apple.driver.AppleH13CamIn -f graphml --indirect -o camin.graphml
+		# Can a kext reach copyin? (entire kernelcache)
+		❯ ipsw macho callgraph kernelcache.release.iPhone15,2 -z --from AppleH13CamIn --to copyin
+		# Export the entire kernelcache as Soufflé facts (see schema.dl for the relations)
+		❯ ipsw macho callgraph kernelcache.release.iPhone15,2 -z -f souffle -o kernel_facts/
+		❯ souffle -F kernel_facts/ -D . my_query.dl`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		selectedArch := viper.GetString("macho.callgraph.arch")
+		filesetEntry := viper.GetString("macho.callgraph.fileset-entry")
+		allEntries := viper.GetBool("macho.callgraph.all-fileset-entries")
+		conf := &cgcmd.Config{
+			Indirect: viper.GetBool("macho.callgraph.indirect"),
+			Format:   viper.GetString("macho.callgraph.format"),
+			Output:   viper.GetString("macho.callgraph.output"),
+			Root:     viper.GetString("macho.callgraph.root"),
+			Depth:    viper.GetInt("macho.callgraph.depth"),
+			From:     viper.GetString("macho.callgraph.from"),
+			To:       viper.GetString("macho.callgraph.to"),
+		}
+		// validate flags
+		if len(filesetEntry) > 0 && allEntries {
+			return fmt.Errorf("you can only use --fileset-entry OR --all-fileset-entries (not both)")
+		}
+		if (len(conf.From) > 0) != (len(conf.To) > 0) {
+			return fmt.Errorf("you must supply both --from AND --to for a reachability query")
+		}
+		if !slices.Contains(cgcmd.Formats, conf.Format) && !cgcmd.IsFactFormat(conf.Format) {
+			return fmt.Errorf("invalid --format '%s', must be one of: %s", conf.Format, strings.Join(append(cgcmd.Formats, cgcmd.FactFormats...), ", "))
+		}
+		if cgcmd.IsFactFormat(conf.Format) {
+			if len(conf.Output) == 0 {
+				return fmt.Errorf("--format %s requires an --output", conf.Format)
+			}
+			conf.Strings = true
+		}
+
+		machoPath := filepath.Clean(args[0])
+
+		if ok, err := magic.IsMachO(machoPath); !ok {
+			return fmt.Errorf(err.Error())
+		}
+
+		var m *macho.File
+		fat, err := macho.OpenFat(machoPath)
+		if err != nil && err != macho.ErrNotFat {
+			return err
+		}
+		if err == macho.ErrNotFat {
+			m, err = macho.Open(machoPath)
+			if err != nil {
+				return err
+			}
+			defer m.Close()
+		} else {
+			defer fat.Close()
+			var arches []string
+			for _, arch := range fat.Arches {
+				name := strings.ToLower(arch.SubCPU.String(arch.CPU))
+				arches = append(arches, name)
+				if m == nil && strings.Contains(name, "arm64") && (len(selectedArch) == 0 || strings.Contains(name, strings.ToLower(selectedArch))) {
+					m = arch.File
+				}
+			}
+			if m == nil {
+				return fmt.Errorf("no arm64 architecture found matching --arch '%s' in: %s", selectedArch, strings.Join(arches, ", "))
+			}
+		}
+
+		if !strings.Contains(strings.ToLower(m.FileHeader.SubCPU.String(m.CPU)), "arm64") {
+			return fmt.Errorf("can only build call graphs of arm64 binaries")
+		}
+
+		var ms []*macho.File
+		var names []string
+		if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+			if len(filesetEntry) == 0 && !allEntries {
+				return fmt.Errorf("file is a MH_FILESET, you must supply a --fileset-entry OR --all-fileset-entries")
+			}
+			for _, fe := range m.FileSets() {
+				if allEntries || fe.EntryID == filesetEntry {
+					mfe, err := m.GetFileSetFileByName(fe.EntryID)
+					if err != nil {
+						return fmt.Errorf("failed to parse entry %s: %v", fe.EntryID, err)
+					}
+					ms = append(ms, mfe)
+					names = append(names, fe.EntryID)
+				}
+			}
+			if len(ms) == 0 {
+				return fmt.Errorf("fileset entry %s not found", filesetEntry)
+			}
+		} else {
+			if len(filesetEntry) > 0 || allEntries {
+				log.Error("MachO type is not MH_FILESET (cannot use --fileset-entry/--all-fileset-entries)")
+			}
+			ms = append(ms, m)
+			names = append(names, filepath.Base(machoPath))
+		}
+
+		log.Info("Building call graph (use -V for more progress output)")
+		g := callgraph.New()
+		if err := cgcmd.AddMachO(g, ms, names, conf); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"functions": len(g.Nodes),
+			"calls":     len(g.Edges),
+		}).Debug("Call graph")
+
+		if len(conf.From) > 0 {
+			return cgcmd.Query(g, conf)
+		}
+
+		if cgcmd.IsFactFormat(conf.Format) {
+			return cgcmd.MachOFacts(g, ms, names, conf)
+		}
+
+		return cgcmd.Export(g, conf)
+	},
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	MachoCmd.AddCommand(machoDyldInfoCmd)
+	machoDyldInfoCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoDyldInfoCmd.Flags().Bool("platform", false, "Print the platform and min OS/SDK versions")
+	machoDyldInfoCmd.Flags().Bool("exports", false, "Print the exported symbols")
+	machoDyldInfoCmd.Flags().Bool("fixups", false, "Print the rebases and binds")
+	machoDyldInfoCmd.Flags().Bool("objc", false, "Print the ObjC classes, categories and protocols")
+	viper.BindPFlag("macho.dyld-info.arch", machoDyldInfoCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.dyld-info.platform", machoDyldInfoCmd.Flags().Lookup("platform"))
+	viper.BindPFlag("macho.dyld-info.exports", machoDyldInfoCmd.Flags().Lookup("exports"))
+	viper.BindPFlag("macho.dyld-info.fixups", machoDyldInfoCmd.Flags().Lookup("fixups"))
+	viper.BindPFlag("macho.dyld-info.objc", machoDyldInfoCmd.Flags().Lookup("objc"))
+	machoDyldInfoCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// machoDyldInfoCmd represents the dyld-info command
+var machoDyldInfoCmd = &cobra.Command{
+	Use:     "dyld-info <MACHO>...",
+	Aliases: []string{"dyld_info"},
+	Short:   "Print the same report as Apple's dyld_info tool",
+	Long: heredoc.Doc(`
+		Print the platform, exports, fixups and ObjC metadata of MachOs in the same format as
+		Apple's dyld_info tool so reports generated on any host can be diffed against macOS ones.
+		All sections are printed when none are selected.`),
+	Example: heredoc.Doc(`
+		# Print the exports of a dylib extracted from a dyld_shared_cache
+		❯ ipsw macho dyld-info --exports libobjc.A.dylib
+		# Print every section of a universal binary's arm64e slice
+		❯ ipsw macho dyld-info --arch arm64e /usr/libexec/amfid`),
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		conf := &mcmd.DyldInfoConfig{
+			Platform: viper.GetBool("macho.dyld-info.platform"),
+			Exports:  viper.GetBool("macho.dyld-info.exports"),
+			Fixups:   viper.GetBool("macho.dyld-info.fixups"),
+			ObjC:     viper.GetBool("macho.dyld-info.objc"),
+		}
+		if !conf.Platform && !conf.Exports && !conf.Fixups && !conf.ObjC {
+			conf = &mcmd.DyldInfoConfig{Platform: true, Exports: true, Fixups: true, ObjC: true}
+		}
+
+		for _, arg := range args {
+			machoPath := filepath.Clean(arg)
+			m, err := openInitsMachO(machoPath, viper.GetString("macho.dyld-info.arch"))
+			if err != nil {
+				return err
+			}
+			err = mcmd.DyldInfo(os.Stdout, m, machoPath, conf)
+			m.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,224 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/blacktop/ipsw/pkg/plist"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	MachoCmd.AddCommand(machoEditCmd)
+	machoEditCmd.Flags().StringArray("add-rpath", []string{}, "Add an LC_RPATH")
+	machoEditCmd.Flags().StringArray("delete-rpath", []string{}, "Delete an LC_RPATH")
+	machoEditCmd.Flags().StringArray("rpath", []string{}, "Change an LC_RPATH (OLD=NEW)")
+	machoEditCmd.Flags().StringArray("change", []string{}, "Change a dependent dylib's install name (OLD=NEW)")
+	machoEditCmd.Flags().String("id", "", "Change the dylib's install name")
+	machoEditCmd.Flags().String("platform", "", "Set the build version platform (i.e. macos, ios, maccatalyst)")
+	machoEditCmd.Flags().String("minos", "", "Set the build version min OS version")
+	machoEditCmd.Flags().String("sdk", "", "Set the build version SDK version")
+	machoEditCmd.Flags().Bool("remove-signature", false, "Strip the code signature")
+	machoEditCmd.Flags().BoolP("overwrite", "f", false, "Overwrite file")
+	machoEditCmd.Flags().BoolP("re-sign", "s", false, "Adhoc sign file")
+	machoEditCmd.Flags().StringP("output", "o", "", "Output new file")
+	viper.BindPFlag("macho.edit.add-rpath", machoEditCmd.Flags().Lookup("add-rpath"))
+	viper.BindPFlag("macho.edit.delete-rpath", machoEditCmd.Flags().Lookup("delete-rpath"))
+	viper.BindPFlag("macho.edit.rpath", machoEditCmd.Flags().Lookup("rpath"))
+	viper.BindPFlag("macho.edit.change", machoEditCmd.Flags().Lookup("change"))
+	viper.BindPFlag("macho.edit.id", machoEditCmd.Flags().Lookup("id"))
+	viper.BindPFlag("macho.edit.platform", machoEditCmd.Flags().Lookup("platform"))
+	viper.BindPFlag("macho.edit.minos", machoEditCmd.Flags().Lookup("minos"))
+	viper.BindPFlag("macho.edit.sdk", machoEditCmd.Flags().Lookup("sdk"))
+	viper.BindPFlag("macho.edit.remove-signature", machoEditCmd.Flags().Lookup("remove-signature"))
+	viper.BindPFlag("macho.edit.overwrite", machoEditCmd.Flags().Lookup("overwrite"))
+	viper.BindPFlag("macho.edit.re-sign", machoEditCmd.Flags().Lookup("re-sign"))
+	viper.BindPFlag("macho.edit.output", machoEditCmd.Flags().Lookup("output"))
+}
+
+func parseOldNew(flag string, vals []string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, val := range vals {
+		old, new, ok := strings.Cut(val, "=")
+		if !ok || len(old) == 0 || len(new) == 0 {
+			return nil, fmt.Errorf("invalid --%s %s; must be OLD=NEW", flag, val)
+		}
+		pairs = append(pairs, [2]string{old, new})
+	}
+	return pairs, nil
+}
+
+// machoEditCmd represents the edit command
+var machoEditCmd = &cobra.Command{
+	Use:   "edit <MACHO>",
+	Short: "Edit a MachO's rpaths, install names, build version or code signature",
+	Long:  "Edit a MachO's load commands like install_name_tool and vtool (universal MachOs are edited slice by slice)",
+	Example: heredoc.Doc(`
+		# Add an LC_RPATH and change a dependent dylib's install name
+		❯ ipsw macho edit MACHO --add-rpath @executable_path/Frameworks --change /usr/lib/libfoo.dylib=@rpath/libfoo.dylib -o MACHO.new
+		# Change a dylib's install name (like install_name_tool -id)
+		❯ ipsw macho edit libfoo.dylib --id @rpath/libfoo.dylib -f
+		# Set the platform and min OS version (like vtool -set-build-version)
+		❯ ipsw macho edit MACHO --platform maccatalyst --minos 14.0 --sdk 17.0 -f -s
+		# Strip the code signature (like codesign --remove-signature)
+		❯ ipsw macho edit MACHO --remove-signature -o MACHO.unsigned`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		overwrite := viper.GetBool("macho.edit.overwrite")
+		reSign := viper.GetBool("macho.edit.re-sign")
+		output := viper.GetString("macho.edit.output")
+
+		conf := &mcmd.EditConfig{
+			AddRpaths:       viper.GetStringSlice("macho.edit.add-rpath"),
+			DeleteRpaths:    viper.GetStringSlice("macho.edit.delete-rpath"),
+			ID:              viper.GetString("macho.edit.id"),
+			Platform:        viper.GetString("macho.edit.platform"),
+			MinOS:           viper.GetString("macho.edit.minos"),
+			SDK:             viper.GetString("macho.edit.sdk"),
+			RemoveSignature: viper.GetBool("macho.edit.remove-signature"),
+		}
+		var err error
+		conf.Rpaths, err = parseOldNew("rpath", viper.GetStringSlice("macho.edit.rpath"))
+		if err != nil {
+			return err
+		}
+		conf.Changes, err = parseOldNew("change", viper.GetStringSlice("macho.edit.change"))
+		if err != nil {
+			return err
+		}
+		if len(conf.AddRpaths) == 0 && len(conf.DeleteRpaths) == 0 && len(conf.Rpaths) == 0 && len(conf.Changes) == 0 &&
+			len(conf.ID) == 0 && len(conf.Platform) == 0 && len(conf.MinOS) == 0 && len(conf.SDK) == 0 && !conf.RemoveSignature {
+			return fmt.Errorf("no edits supplied (see --help)")
+		}
+		if conf.RemoveSignature && reSign {
+			return fmt.Errorf("cannot use --remove-signature with --re-sign")
+		}
+
+		machoPath := filepath.Clean(args[0])
+
+		if info, err := os.Stat(machoPath); os.IsNotExist(err) {
+			return fmt.Errorf("file %s does not exist", machoPath)
+		} else if info.IsDir() {
+			machoPath, err = plist.GetBinaryInApp(machoPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if ok, err := magic.IsMachO(machoPath); !ok {
+			return fmt.Errorf(err.Error())
+		}
+
+		if len(output) == 0 { // modify in place
+			output = machoPath
+			if !confirm(output, overwrite) { // confirm overwrite
+				return nil
+			}
+		}
+
+		if fat, err := macho.OpenFat(machoPath); err == nil { // UNIVERSAL MACHO
+			defer fat.Close()
+			var slices []string
+			for _, arch := range fat.Arches {
+				if err := mcmd.Edit(arch.File, fmt.Sprintf("%s (%s slice)", machoPath, arch.File.CPU.String()), conf); err != nil {
+					return fmt.Errorf("failed to edit MachO file: %v", err)
+				}
+				tmp, err := os.CreateTemp("", "macho_"+arch.File.CPU.String())
+				if err != nil {
+					return fmt.Errorf("failed to create temp file: %v", err)
+				}
+				defer os.Remove(tmp.Name())
+				if err := mcmd.SaveEdit(arch.File, tmp.Name()); err != nil {
+					return fmt.Errorf("failed to save temp file: %v", err)
+				}
+				if err := tmp.Close(); err != nil {
+					return fmt.Errorf("failed to close temp file: %v", err)
+				}
+				slices = append(slices, tmp.Name())
+			}
+			if ff, err := macho.CreateFat(output, slices...); err != nil {
+				return fmt.Errorf("failed to create fat file: %v", err)
+			} else {
+				defer ff.Close()
+			}
+		} else {
+			if errors.Is(err, macho.ErrNotFat) {
+				m, err := macho.Open(machoPath)
+				if err != nil {
+					return fmt.Errorf("failed to open MachO file: %v", err)
+				}
+				defer m.Close()
+				if err := mcmd.Edit(m, machoPath, conf); err != nil {
+					return fmt.Errorf("failed to edit MachO file: %v", err)
+				}
+				if err := mcmd.SaveEdit(m, output); err != nil {
+					return fmt.Errorf("failed to save edited MachO file: %v", err)
+				}
+			} else {
+				return fmt.Errorf("failed to open MachO file: %v", err)
+			}
+		}
+
+		if conf.RemoveSignature {
+			log.Infof("Removed code signature from %s", output)
+			return nil
+		}
+
+		yes := false
+		if !reSign {
+			log.Warn("Code signature has been invalidated (MachO may need to be re-signed)")
+			prompt := &survey.Confirm{
+				Message: fmt.Sprintf("Adhoc codesign %s?", output),
+				Default: false,
+			}
+			survey.AskOne(prompt, &yes)
+		}
+		if reSign || yes {
+			log.Infof("Adhoc signing MachO file: %s", output)
+			return mcmd.AdhocSign(output, output)
+		}
+
+		return nil
+	},
+}
@@ -42,11 +42,14 @@ import (
 	"github.com/blacktop/go-macho"
 	cstypes "github.com/blacktop/go-macho/pkg/codesign/types"
 	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/pkg/trie"
 	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/ipsw/internal/certs"
+	ents "github.com/blacktop/ipsw/internal/codesign/entitlements"
 	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
 	"github.com/blacktop/ipsw/internal/demangle"
 	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/blacktop/ipsw/internal/stable"
 	swift "github.com/blacktop/ipsw/internal/swift"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/plist"
@@ -756,13 +759,17 @@ var machoInfoCmd = &cobra.Command{
 				fmt.Println("Entitlements")
 				fmt.Println("============")
 			}
-			if m.CodeSignature() != nil && len(m.CodeSignature().Entitlements) > 0 {
+			entPlist, err := ents.Plist(m.CodeSignature()) // falls back to the DER entitlements
+			if err != nil {
+				return fmt.Errorf("failed to parse entitlements: %v", err)
+			}
+			if len(entPlist) > 0 {
 				if color {
-					if err := quick.Highlight(os.Stdout, m.CodeSignature().Entitlements, "xml", "terminal256", "nord"); err != nil {
+					if err := quick.Highlight(os.Stdout, entPlist, "xml", "terminal256", "nord"); err != nil {
 						return err
 					}
 				} else {
-					fmt.Println(m.CodeSignature().Entitlements)
+					fmt.Println(entPlist)
 				}
 			} else {
 				fmt.Println("  - no entitlements")
@@ -851,7 +858,12 @@ var machoInfoCmd = &cobra.Command{
 				fmt.Printf("\n%s\n", label)
 				fmt.Println(strings.Repeat("-", len(label)))
 				undeflush := false
-				for _, sym := range m.Symtab.Syms {
+				syms := m.Symtab.Syms
+				if viper.GetBool("stable") {
+					syms = slices.Clone(syms)
+					stable.SortBy(syms, func(s macho.Symbol) string { return s.Name })
+				}
+				for _, sym := range syms {
 					if sym.Type.IsUndefinedSym() && !undeflush {
 						undeflush = true
 					}
@@ -902,6 +914,9 @@ var machoInfoCmd = &cobra.Command{
 				}
 			}
 			if exports, err := m.GetExports(); err == nil {
+				if viper.GetBool("stable") {
+					stable.SortBy(exports, func(e trie.TrieExport) string { return e.Name })
+				}
 				label = "DyldInfo [Exports]"
 				fmt.Printf("\n%s\n", label)
 				fmt.Println(strings.Repeat("-", len(label)))
@@ -917,6 +932,9 @@ var machoInfoCmd = &cobra.Command{
 				if err != nil {
 					return err
 				}
+				if viper.GetBool("stable") {
+					stable.SortBy(exports, func(e trie.TrieExport) string { return e.Name })
+				}
 				for _, export := range exports {
 					if doDemangle {
 						if strings.HasPrefix(export.Name, "_$s") || strings.HasPrefix(export.Name, "$s") { // TODO: better detect swift symbols
@@ -0,0 +1,188 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorInitKind = color.New(color.Bold, color.FgHiMagenta).SprintFunc()
+var colorInitAddr = color.New(color.Faint).SprintfFunc()
+var colorInitWarn = color.New(color.FgYellow).SprintFunc()
+
+func init() {
+	MachoCmd.AddCommand(machoInitsCmd)
+	machoInitsCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoInitsCmd.Flags().StringP("fileset-entry", "t", "", "Which fileset entry to analyze (defaults to all)")
+	machoInitsCmd.Flags().BoolP("json", "j", false, "Print as JSON")
+	viper.BindPFlag("macho.inits.arch", machoInitsCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.inits.fileset-entry", machoInitsCmd.Flags().Lookup("fileset-entry"))
+	viper.BindPFlag("macho.inits.json", machoInitsCmd.Flags().Lookup("json"))
+}
+
+func openInitsMachO(machoPath, selectedArch string) (*macho.File, error) {
+	if ok, err := magic.IsMachO(machoPath); !ok {
+		return nil, fmt.Errorf("%s: %v", machoPath, err)
+	}
+	fat, err := macho.OpenFat(machoPath)
+	if err != nil && err != macho.ErrNotFat {
+		return nil, err
+	}
+	if err == macho.ErrNotFat {
+		return macho.Open(machoPath)
+	}
+	var options []string
+	var shortOptions []string
+	for _, arch := range fat.Arches {
+		options = append(options, fmt.Sprintf("%s, %s", arch.CPU, arch.SubCPU.String(arch.CPU)))
+		shortOptions = append(shortOptions, strings.ToLower(arch.SubCPU.String(arch.CPU)))
+	}
+	if len(selectedArch) > 0 {
+		for i, opt := range shortOptions {
+			if strings.Contains(strings.ToLower(opt), strings.ToLower(selectedArch)) {
+				return fat.Arches[i].File, nil
+			}
+		}
+		return nil, fmt.Errorf("--arch '%s' not found in: %s", selectedArch, strings.Join(shortOptions, ", "))
+	}
+	choice := 0
+	prompt := &survey.Select{
+		Message: fmt.Sprintf("Detected a universal MachO file (%s), please select an architecture to analyze:", filepath.Base(machoPath)),
+		Options: options,
+	}
+	survey.AskOne(prompt, &choice)
+	return fat.Arches[choice].File, nil
+}
+
+// machoInitsCmd represents the inits command
+var machoInitsCmd = &cobra.Command{
+	Use:   "inits <MACHO>...",
+	Short: "List the constructors, static initializers and ObjC +load methods that run on image load",
+	Long: heredoc.Doc(`
+		List the functions each image runs when dyld loads it (ObjC +load methods, __mod_init_func/__init_offsets
+		constructors and C++ static initializers) and its terminators, in the order dyld runs them.
+		Code signing restrictions that would stop DYLD_INSERT_LIBRARIES based injection are also reported.`),
+	Example: heredoc.Doc(`
+		# List the initializers of an app's main executable and frameworks
+		❯ ipsw macho inits Payload/App.app/App Payload/App.app/Frameworks/*.framework/*[^.plist]
+		# List the initializers of a kernelcache's kexts
+		❯ ipsw macho inits --fileset-entry com.apple.iokit.IOSurface kernelcache.release.iPhone15,2
+		# As JSON
+		❯ ipsw macho inits --json /usr/libexec/amfid`),
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		selectedArch := viper.GetString("macho.inits.arch")
+		filesetEntry := viper.GetString("macho.inits.fileset-entry")
+
+		var images []*mcmd.Inits
+
+		for _, arg := range args {
+			machoPath := filepath.Clean(arg)
+
+			m, err := openInitsMachO(machoPath, selectedArch)
+			if err != nil {
+				return err
+			}
+
+			if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+				for _, fe := range m.FileSets() {
+					if len(filesetEntry) > 0 && fe.EntryID != filesetEntry {
+						continue
+					}
+					mfe, err := m.GetFileSetFileByName(fe.EntryID)
+					if err != nil {
+						return fmt.Errorf("failed to parse entry %s: %v", fe.EntryID, err)
+					}
+					inits, err := mcmd.GetInits(mfe, fe.EntryID)
+					if err != nil {
+						return fmt.Errorf("failed to get %s initializers: %v", fe.EntryID, err)
+					}
+					images = append(images, inits)
+				}
+			} else {
+				if len(filesetEntry) > 0 {
+					return fmt.Errorf("MachO type is not MH_FILESET (cannot use --fileset-entry)")
+				}
+				inits, err := mcmd.GetInits(m, machoPath)
+				if err != nil {
+					return fmt.Errorf("failed to get %s initializers: %v", machoPath, err)
+				}
+				images = append(images, inits)
+			}
+		}
+
+		if viper.GetBool("macho.inits.json") {
+			dat, err := json.Marshal(images)
+			if err != nil {
+				return fmt.Errorf("failed to marshal initializers as JSON: %v", err)
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		for _, img := range images {
+			if len(img.Initializers) == 0 && len(img.Restrictions) == 0 {
+				continue
+			}
+			fmt.Println(color.New(color.Bold).Sprint(img.Image))
+			for _, r := range img.Restrictions {
+				fmt.Printf("  %s %s\n", colorInitWarn("restricted:"), r)
+			}
+			for _, i := range img.Initializers {
+				sym := i.Symbol
+				if sym == "" {
+					sym = "?"
+				}
+				fmt.Printf("  %s %-12s %s", colorInitAddr("%#x:", i.Address), colorInitKind(i.Kind), sym)
+				if i.Section != "" {
+					fmt.Printf(" %s", colorInitAddr("(%s)", i.Section))
+				}
+				fmt.Println()
+			}
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,232 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/blacktop/ipsw/internal/search"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorMissing = color.New(color.FgHiRed).SprintFunc()
+
+func init() {
+	MachoCmd.AddCommand(machoMitigationsCmd)
+	machoMitigationsCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoMitigationsCmd.Flags().BoolP("scorecard", "s", false, "Only output the aggregated hardening scorecard")
+	machoMitigationsCmd.Flags().IntP("weakest", "w", 10, "Number of least hardened binaries to list in the scorecard")
+	machoMitigationsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	machoMitigationsCmd.Flags().String("pem-db", "", "AEA pem DB JSON file")
+	viper.BindPFlag("macho.mitigations.arch", machoMitigationsCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.mitigations.scorecard", machoMitigationsCmd.Flags().Lookup("scorecard"))
+	viper.BindPFlag("macho.mitigations.weakest", machoMitigationsCmd.Flags().Lookup("weakest"))
+	viper.BindPFlag("macho.mitigations.json", machoMitigationsCmd.Flags().Lookup("json"))
+	viper.BindPFlag("macho.mitigations.pem-db", machoMitigationsCmd.Flags().Lookup("pem-db"))
+	machoMitigationsCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+func printMitigations(mit *mcmd.Mitigations) {
+	flag := func(name string, ok bool) string {
+		if ok {
+			return name
+		}
+		return colorMissing("!" + name)
+	}
+	fields := []string{
+		flag("pie", mit.PIE),
+		flag("stack-protector", mit.StackProtector),
+	}
+	if strings.HasPrefix(mit.Arch, "arm64") {
+		fields = append(fields, flag("pac", mit.PAC))
+		if mit.PAC && mit.Functions > 0 {
+			fields = append(fields, fmt.Sprintf("pac-ret=%d/%d", mit.PACRet, mit.Functions))
+		}
+		if mit.PACInstructions > 0 {
+			fields = append(fields, fmt.Sprintf("pac-density=%.1f‰", mit.PACDensity))
+		}
+		if mit.BTI > 0 {
+			fields = append(fields, fmt.Sprintf("bti=%d", mit.BTI))
+		}
+	}
+	if mit.ObjC {
+		fields = append(fields, flag("arc", mit.ARC))
+	}
+	if len(mit.Fortify)+len(mit.Unfortified) > 0 {
+		fields = append(fields, flag("fortify", len(mit.Unfortified) == 0))
+	}
+	for _, f := range []struct {
+		name string
+		ok   bool
+	}{
+		{"hardened-runtime", mit.HardenedRuntime},
+		{"library-validation", mit.LibraryValidation},
+		{"restrict", mit.Restrict},
+	} {
+		if f.ok {
+			fields = append(fields, f.name)
+		}
+	}
+	fmt.Printf("%3d%% %s\t%s\n", mit.Score, colorImage(mit.Path), strings.Join(fields, " "))
+	if viper.GetBool("verbose") && len(mit.Unfortified) > 0 {
+		fmt.Printf("\tunfortified: %s\n", strings.Join(mit.Unfortified, ", "))
+	}
+}
+
+func printScorecard(sc *mcmd.Scorecard) {
+	fmt.Printf("%s %d (%d ObjC)\n", colorField("Binaries:"), sc.Binaries, sc.ObjC)
+	fmt.Printf("%s %.1f%%\n", colorField("Average Score:"), sc.AvgScore)
+	if sc.AvgPACRet > 0 {
+		fmt.Printf("%s %.1f%% of arm64e functions\n", colorField("Average PAC-ret:"), sc.AvgPACRet)
+	}
+	fmt.Println(colorField("Mitigations:"))
+	var names []string
+	for name := range sc.Features {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sc.Features[names[i]] != sc.Features[names[j]] {
+			return sc.Features[names[i]] > sc.Features[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		total := sc.Binaries
+		if name == "arc" {
+			total = sc.ObjC
+		}
+		fmt.Printf("    %-20s %6d/%-6d %5.1f%%\n", name, sc.Features[name], total, float64(sc.Features[name])*100/float64(max(total, 1)))
+	}
+	if len(sc.Weakest) > 0 {
+		fmt.Println(colorField("Weakest:"))
+		for _, mit := range sc.Weakest {
+			printMitigations(mit)
+		}
+	}
+}
+
+// machoMitigationsCmd represents the mitigations command
+var machoMitigationsCmd = &cobra.Command{
+	Use:     "mitigations <MACHO|FOLDER|IPSW>",
+	Aliases: []string{"mit", "hardening"},
+	Short:   "Report the hardening features MachOs are built with",
+	Long: heredoc.Doc(`
+		Report which exploit mitigations each MachO uses (PIE, stack protector, PAC and its
+		instruction density/return address signing coverage, BTI, ARC, _FORTIFY_SOURCE and the
+		code signature hardened runtime/library validation/restrict flags) and aggregate them
+		across a folder or IPSW into a hardening scorecard.`),
+	Example: heredoc.Doc(`
+		# Report the mitigations of a binary
+		❯ ipsw macho mitigations /usr/libexec/amfid
+		# Score every MachO in an IPSW
+		❯ ipsw macho mitigations --scorecard iPhone16,1_18.0_22A3354_Restore.ipsw
+		# Export the per-binary report of an extracted filesystem as JSON
+		❯ ipsw macho mitigations --json 22A3354/`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		scorecard := viper.GetBool("macho.mitigations.scorecard")
+		asJSON := viper.GetBool("macho.mitigations.json")
+
+		input := filepath.Clean(args[0])
+		info, err := os.Stat(input)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %v", input, err)
+		}
+
+		if !info.IsDir() && filepath.Ext(input) != ".ipsw" { // single MachO
+			m, err := openInitsMachO(input, viper.GetString("macho.mitigations.arch"))
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %v", input, err)
+			}
+			defer m.Close()
+			mit, err := mcmd.GetMitigations(m, input)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return json.NewEncoder(os.Stdout).Encode(mit)
+			}
+			printMitigations(mit)
+			return nil
+		}
+
+		var mits []*mcmd.Mitigations
+		handler := func(path string, m *macho.File) error {
+			mit, err := mcmd.GetMitigations(m, path)
+			if err != nil {
+				log.WithError(err).Warnf("failed to get mitigations of %s", path)
+				return nil
+			}
+			mits = append(mits, mit)
+			return nil
+		}
+		if info.IsDir() {
+			err = search.ForEachMacho(input, handler)
+		} else {
+			err = search.ForEachMachoInIPSW(input, viper.GetString("macho.mitigations.pem-db"), handler)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %v", input, err)
+		}
+		sort.Slice(mits, func(i, j int) bool { return mits[i].Path < mits[j].Path })
+
+		sc := mcmd.NewScorecard(mits, viper.GetInt("macho.mitigations.weakest"))
+		if asJSON {
+			if scorecard {
+				return json.NewEncoder(os.Stdout).Encode(sc)
+			}
+			return json.NewEncoder(os.Stdout).Encode(struct {
+				Binaries  []*mcmd.Mitigations `json:"binaries"`
+				Scorecard *mcmd.Scorecard     `json:"scorecard"`
+			}{mits, sc})
+		}
+		if !scorecard {
+			for _, mit := range mits {
+				printMitigations(mit)
+			}
+			fmt.Println()
+		}
+		printScorecard(sc)
+
+		return nil
+	},
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/pkg/codesign/types"
 	"github.com/blacktop/go-macho/types/objc"
+	"github.com/blacktop/ipsw/internal/complete"
 	"github.com/blacktop/ipsw/internal/search"
 	swift "github.com/blacktop/ipsw/internal/swift"
 	"github.com/blacktop/ipsw/internal/utils"
@@ -79,6 +80,7 @@ func init() {
 	viper.BindPFlag("macho.search.launch-const", machoSearchCmd.Flags().Lookup("launch-const"))
 	viper.BindPFlag("macho.search.import", machoSearchCmd.Flags().Lookup("import"))
 	viper.BindPFlag("macho.search.section", machoSearchCmd.Flags().Lookup("section"))
+	machoSearchCmd.RegisterFlagCompletionFunc("uuid", complete.UUIDs)
 	viper.BindPFlag("macho.search.uuid", machoSearchCmd.Flags().Lookup("uuid"))
 	viper.BindPFlag("macho.search.sym", machoSearchCmd.Flags().Lookup("sym"))
 	viper.BindPFlag("macho.search.protocol", machoSearchCmd.Flags().Lookup("protocol"))
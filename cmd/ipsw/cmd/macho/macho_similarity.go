@@ -0,0 +1,126 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	MachoCmd.AddCommand(machoSimilarityCmd)
+	machoSimilarityCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoSimilarityCmd.Flags().BoolP("funcs", "f", false, "Also compare the functions (position independent instruction hashes)")
+	machoSimilarityCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("macho.similarity.arch", machoSimilarityCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.similarity.funcs", machoSimilarityCmd.Flags().Lookup("funcs"))
+	viper.BindPFlag("macho.similarity.json", machoSimilarityCmd.Flags().Lookup("json"))
+	machoSimilarityCmd.MarkZshCompPositionalArgumentFile(1)
+	machoSimilarityCmd.MarkZshCompPositionalArgumentFile(2)
+}
+
+// machoSimilarityCmd represents the similarity command
+var machoSimilarityCmd = &cobra.Command{
+	Use:     "similarity <MACHO> <MACHO>",
+	Aliases: []string{"sim"},
+	Short:   "Score how similar two MachOs are with fuzzy hashes",
+	Long: heredoc.Doc(`
+		Compare the ssdeep and TLSH fuzzy hashes of two MachOs (the whole binary, __TEXT.__text and __TEXT.__cstring)
+		and optionally match their functions by position independent instruction hashes to confirm whether a
+		binary corresponds to a known build or was modified.`),
+	Example: heredoc.Doc(`
+		# Compare a binary with the one from a known build
+		❯ ipsw macho similarity leaked/amfid 22A3354/usr/libexec/amfid
+		# Include the function level comparison as JSON
+		❯ ipsw macho similarity --funcs --json leaked/amfid 22A3354/usr/libexec/amfid`),
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		selectedArch := viper.GetString("macho.similarity.arch")
+		asJSON := viper.GetBool("macho.similarity.json")
+
+		m1, err := openInitsMachO(filepath.Clean(args[0]), selectedArch)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", args[0], err)
+		}
+		defer m1.Close()
+		m2, err := openInitsMachO(filepath.Clean(args[1]), selectedArch)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", args[1], err)
+		}
+		defer m2.Close()
+
+		report, err := mcmd.Similarity(m1, m2, args[0], args[1], &mcmd.SimilarityConfig{
+			Functions: viper.GetBool("macho.similarity.funcs"),
+		})
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(report)
+		}
+
+		if report.Identical {
+			log.Info("MachOs are identical")
+		}
+		for _, r := range report.Regions {
+			fmt.Printf("%-18s ssdeep: %3d", r.Region, r.SSDeepScore)
+			if r.TLSHDistance >= 0 {
+				fmt.Printf("  tlsh: %4d", r.TLSHDistance)
+			}
+			fmt.Println()
+			if viper.GetBool("verbose") {
+				for _, hashes := range [][]string{r.SSDeep, r.TLSH} {
+					for _, h := range hashes {
+						fmt.Println(color.New(color.Faint).Sprintf("    %s", h))
+					}
+				}
+			}
+		}
+		if fs := report.Functions; fs != nil {
+			fmt.Printf("%-18s %.1f%% (%d identical of %d/%d)\n", "functions", fs.Score, fs.Identical, fs.Count[0], fs.Count[1])
+			for _, name := range fs.Modified {
+				fmt.Printf("    modified: %s\n", name)
+			}
+		}
+
+		return nil
+	},
+}
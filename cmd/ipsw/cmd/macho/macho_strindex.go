@@ -0,0 +1,169 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	cgcmd "github.com/blacktop/ipsw/internal/commands/callgraph"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	MachoCmd.AddCommand(machoStrIndexCmd)
+	machoStrIndexCmd.Flags().String("arch", "", "Which architecture to use for fat/universal MachO")
+	machoStrIndexCmd.Flags().StringP("fileset-entry", "t", "", "Which fileset entry to index")
+	machoStrIndexCmd.Flags().BoolP("all-fileset-entries", "z", false, "Index all fileset entries (entire kernelcache)")
+	machoStrIndexCmd.Flags().StringP("search", "s", "", "Only index strings containing this substring")
+	machoStrIndexCmd.Flags().StringP("format", "f", "", fmt.Sprintf("Export format (%s)", strings.Join(cgcmd.StringFormats, ", ")))
+	machoStrIndexCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return cgcmd.StringFormats, cobra.ShellCompDirectiveDefault
+	})
+	machoStrIndexCmd.Flags().StringP("output", "o", "", "Output file (defaults to stdout)")
+	viper.BindPFlag("macho.strindex.arch", machoStrIndexCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.strindex.fileset-entry", machoStrIndexCmd.Flags().Lookup("fileset-entry"))
+	viper.BindPFlag("macho.strindex.all-fileset-entries", machoStrIndexCmd.Flags().Lookup("all-fileset-entries"))
+	viper.BindPFlag("macho.strindex.search", machoStrIndexCmd.Flags().Lookup("search"))
+	viper.BindPFlag("macho.strindex.format", machoStrIndexCmd.Flags().Lookup("format"))
+	viper.BindPFlag("macho.strindex.output", machoStrIndexCmd.Flags().Lookup("output"))
+
+	machoStrIndexCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// machoStrIndexCmd represents the strindex command
+var machoStrIndexCmd = &cobra.Command{
+	Use:     "strindex <MACHO>",
+	Aliases: []string{"si"},
+	Short:   "Index the C strings of an ARM64 MachO/kext and the functions that reference them",
+	Example: heredoc.Doc(`
+		# Which functions use a string?
+		❯ ipsw macho strindex /usr/libexec/amfid -s "no entitlements"
+		# Index every kext's strings as JSON
+		❯ ipsw macho strindex kernelcache.release.iPhone15,2 -z -f json -o strings.json
+		# Find the function that logs a panic message (entire kernelcache)
+		❯ ipsw macho strindex kernelcache.release.iPhone15,2 -z -f sqlite -o strings.db
+		❯ sqlite3 strings.db "SELECT image, name FROM string_xrefs WHERE value LIKE '%zone bound checks%'"`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		selectedArch := viper.GetString("macho.strindex.arch")
+		filesetEntry := viper.GetString("macho.strindex.fileset-entry")
+		allEntries := viper.GetBool("macho.strindex.all-fileset-entries")
+		conf := &cgcmd.StringConfig{
+			Search: viper.GetString("macho.strindex.search"),
+			Format: viper.GetString("macho.strindex.format"),
+			Output: viper.GetString("macho.strindex.output"),
+		}
+		// validate flags
+		if len(filesetEntry) > 0 && allEntries {
+			return fmt.Errorf("you can only use --fileset-entry OR --all-fileset-entries (not both)")
+		}
+
+		machoPath := filepath.Clean(args[0])
+
+		if ok, err := magic.IsMachO(machoPath); !ok {
+			return fmt.Errorf(err.Error())
+		}
+
+		var m *macho.File
+		fat, err := macho.OpenFat(machoPath)
+		if err != nil && err != macho.ErrNotFat {
+			return err
+		}
+		if err == macho.ErrNotFat {
+			m, err = macho.Open(machoPath)
+			if err != nil {
+				return err
+			}
+			defer m.Close()
+		} else {
+			defer fat.Close()
+			var arches []string
+			for _, arch := range fat.Arches {
+				name := strings.ToLower(arch.SubCPU.String(arch.CPU))
+				arches = append(arches, name)
+				if m == nil && strings.Contains(name, "arm64") && (len(selectedArch) == 0 || strings.Contains(name, strings.ToLower(selectedArch))) {
+					m = arch.File
+				}
+			}
+			if m == nil {
+				return fmt.Errorf("no arm64 architecture found matching --arch '%s' in: %s", selectedArch, strings.Join(arches, ", "))
+			}
+		}
+
+		if !strings.Contains(strings.ToLower(m.FileHeader.SubCPU.String(m.CPU)), "arm64") {
+			return fmt.Errorf("can only index the strings of arm64 binaries")
+		}
+
+		var ms []*macho.File
+		var names []string
+		if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+			if len(filesetEntry) == 0 && !allEntries {
+				return fmt.Errorf("file is a MH_FILESET, you must supply a --fileset-entry OR --all-fileset-entries")
+			}
+			for _, fe := range m.FileSets() {
+				if allEntries || fe.EntryID == filesetEntry {
+					mfe, err := m.GetFileSetFileByName(fe.EntryID)
+					if err != nil {
+						return fmt.Errorf("failed to parse entry %s: %v", fe.EntryID, err)
+					}
+					ms = append(ms, mfe)
+					names = append(names, fe.EntryID)
+				}
+			}
+			if len(ms) == 0 {
+				return fmt.Errorf("fileset entry %s not found", filesetEntry)
+			}
+		} else {
+			if len(filesetEntry) > 0 || allEntries {
+				log.Error("MachO type is not MH_FILESET (cannot use --fileset-entry/--all-fileset-entries)")
+			}
+			ms = append(ms, m)
+			names = append(names, filepath.Base(machoPath))
+		}
+
+		log.Info("Indexing strings (use -V for more progress output)")
+		g := callgraph.New()
+		if err := cgcmd.AddMachO(g, ms, names, &cgcmd.Config{Strings: true}); err != nil {
+			return err
+		}
+
+		return cgcmd.MachOStrings(g, ms, names, conf)
+	},
+}
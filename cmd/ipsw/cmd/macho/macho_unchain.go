@@ -0,0 +1,147 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package macho
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/blacktop/ipsw/internal/magic"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	MachoCmd.AddCommand(machoUnchainCmd)
+	machoUnchainCmd.Flags().Bool("flat", false, "Only rebase the pointers (don't add classic rebase/bind opcodes)")
+	machoUnchainCmd.Flags().BoolP("overwrite", "f", false, "Overwrite file")
+	machoUnchainCmd.Flags().StringP("output", "o", "", "Output new file")
+	viper.BindPFlag("macho.unchain.flat", machoUnchainCmd.Flags().Lookup("flat"))
+	viper.BindPFlag("macho.unchain.overwrite", machoUnchainCmd.Flags().Lookup("overwrite"))
+	viper.BindPFlag("macho.unchain.output", machoUnchainCmd.Flags().Lookup("output"))
+	machoUnchainCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+func logUnchained(name string, stats *mcmd.UnchainStats) {
+	log.WithFields(log.Fields{
+		"rebases":    stats.Rebases,
+		"binds":      stats.Binds,
+		"weak_binds": stats.WeakBinds,
+	}).Infof("Rewrote %s chained fixups", name)
+}
+
+// machoUnchainCmd represents the unchain command
+var machoUnchainCmd = &cobra.Command{
+	Use:   "unchain <MACHO>",
+	Short: "Rewrite a MachO's chained fixups as classic dyld opcodes (or a flat pre-rebased image)",
+	Long: heredoc.Doc(`
+		Rewrite a MachO's chained fixups for tools that don't support them.
+
+		Every chained pointer is replaced with its unslid target and the LC_DYLD_CHAINED_FIXUPS is
+		replaced with an LC_DYLD_INFO_ONLY (rebase/bind opcodes) or, with --flat, simply removed.
+		arm64e auth pointers lose their PAC signing info and the code signature is invalidated.`),
+	Example: heredoc.Doc(`
+		# Convert to classic rebase/bind opcodes
+		❯ ipsw macho unchain /usr/libexec/amfid -o amfid.classic
+		# Pre-rebase the pointers in place
+		❯ ipsw macho unchain --flat -f /usr/libexec/amfid`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// flags
+		conf := &mcmd.UnchainConfig{Flat: viper.GetBool("macho.unchain.flat")}
+		overwrite := viper.GetBool("macho.unchain.overwrite")
+		output := viper.GetString("macho.unchain.output")
+
+		machoPath := filepath.Clean(args[0])
+
+		if ok, err := magic.IsMachO(machoPath); !ok {
+			return fmt.Errorf(err.Error())
+		}
+
+		if len(output) == 0 { // modify in place
+			output = machoPath
+			if !confirm(output, overwrite) { // confirm overwrite
+				return nil
+			}
+		}
+
+		fat, err := macho.OpenFat(machoPath)
+		if err != nil {
+			if !errors.Is(err, macho.ErrNotFat) {
+				return fmt.Errorf("failed to open MachO file: %v", err)
+			}
+			m, err := macho.Open(machoPath)
+			if err != nil {
+				return fmt.Errorf("failed to open MachO file: %v", err)
+			}
+			defer m.Close()
+			stats, err := mcmd.Unchain(m, machoPath, output, conf)
+			if err != nil {
+				return err
+			}
+			logUnchained(output, stats)
+			return nil
+		}
+		defer fat.Close()
+
+		var slices []string
+		for _, arch := range fat.Arches {
+			name := fmt.Sprintf("%s (%s slice)", machoPath, arch.File.CPU.String())
+			tmp, err := os.CreateTemp("", "macho_"+arch.File.CPU.String())
+			if err != nil {
+				return fmt.Errorf("failed to create temp file: %v", err)
+			}
+			tmp.Close()
+			defer os.Remove(tmp.Name())
+			if arch.File.HasDyldChainedFixups() {
+				stats, err := mcmd.Unchain(arch.File, name, tmp.Name(), conf)
+				if err != nil {
+					return err
+				}
+				logUnchained(name, stats)
+			} else if err := mcmd.SaveEdit(arch.File, tmp.Name()); err != nil { // copy the slice as is
+				return fmt.Errorf("failed to save temp file: %v", err)
+			}
+			slices = append(slices, tmp.Name())
+		}
+		ff, err := macho.CreateFat(output, slices...)
+		if err != nil {
+			return fmt.Errorf("failed to create fat file: %v", err)
+		}
+		return ff.Close()
+	},
+}
@@ -30,6 +30,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/commands/mount"
+	"github.com/blacktop/ipsw/internal/complete"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -52,7 +53,7 @@ var mountCmd = &cobra.Command{
 		if len(args) == 0 {
 			return mount.DmgTypes, cobra.ShellCompDirectiveNoFileComp
 		}
-		return []string{"ipsw"}, cobra.ShellCompDirectiveFilterFileExt
+		return complete.Firmware("ipsw")(cmd, args, toComplete)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 
@@ -0,0 +1,160 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ota
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/ota"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorNew = color.New(color.FgHiGreen).SprintFunc()
+var colorRemoved = color.New(color.FgHiRed).SprintFunc()
+var colorChanged = color.New(color.FgHiYellow).SprintFunc()
+
+func init() {
+	OtaCmd.AddCommand(otaDiffCmd)
+	otaDiffCmd.Flags().BoolP("files", "f", false, "Also diff the post.bom file system listings")
+	otaDiffCmd.Flags().StringP("pattern", "r", "", "Only show paths matching regex pattern")
+	otaDiffCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("ota.diff.files", otaDiffCmd.Flags().Lookup("files"))
+	viper.BindPFlag("ota.diff.pattern", otaDiffCmd.Flags().Lookup("pattern"))
+	viper.BindPFlag("ota.diff.json", otaDiffCmd.Flags().Lookup("json"))
+}
+
+func openOTA(path string) (*ota.AA, error) {
+	if key := viper.GetString("ota.key-val"); key != "" {
+		return ota.Open(filepath.Clean(path), key)
+	}
+	return ota.Open(filepath.Clean(path)) // use the key in the OTA's file name (if it has one)
+}
+
+func filterFileDiff(diff *ota.FileDiff, re *regexp.Regexp) {
+	if re == nil {
+		return
+	}
+	match := func(path string) bool { return !re.MatchString(path) }
+	diff.New = slices.DeleteFunc(diff.New, match)
+	diff.Removed = slices.DeleteFunc(diff.Removed, match)
+	diff.Changed = slices.DeleteFunc(diff.Changed, func(c ota.FileChange) bool { return match(c.Path) })
+}
+
+func printFileDiff(title string, diff ota.FileDiff) {
+	fmt.Printf("\n- [ %-16s ] %s\n\n", title, strings.Repeat("-", 50))
+	if diff.Empty() {
+		fmt.Println("  - No differences found")
+		return
+	}
+	for _, p := range diff.New {
+		fmt.Printf("  %s %s\n", colorNew("+"), p)
+	}
+	for _, p := range diff.Removed {
+		fmt.Printf("  %s %s\n", colorRemoved("-"), p)
+	}
+	for _, c := range diff.Changed {
+		fmt.Printf("  %s %s\t%s\n", colorChanged("~"), c.Path, colorSize(fmt.Sprintf("%s -> %s", humanize.Bytes(uint64(c.OldSize)), humanize.Bytes(uint64(c.NewSize)))))
+	}
+}
+
+// otaDiffCmd represents the diff command
+var otaDiffCmd = &cobra.Command{
+	Use:     "diff <OTA> <OTA>",
+	Aliases: []string{"d"},
+	Short:   "Diff two OTAs",
+	Long:    "Diff the components, patched binaries and file lists of two (delta) OTAs without needing the full IPSWs.",
+	Example: heredoc.Doc(`
+		# Diff two consecutive beta delta OTAs
+		❯ ipsw ota diff 18A5351d_to_18A5365e.zip 18A5365e_to_18A5373a.zip
+		# Only show changes to binaries in /usr/libexec (including the post.bom file listings)
+		❯ ipsw ota diff --files --pattern '^/usr/libexec/' OLD.zip NEW.zip
+		# Output as JSON
+		❯ ipsw ota diff --json OLD.aea NEW.aea`),
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		var re *regexp.Regexp
+		if pattern := viper.GetString("ota.diff.pattern"); pattern != "" {
+			var err error
+			re, err = regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("failed to compile regex pattern '%s': %v", pattern, err)
+			}
+		}
+
+		prev, err := openOTA(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open 'Old' OTA: %v", err)
+		}
+		defer prev.Close()
+
+		next, err := openOTA(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open 'New' OTA: %v", err)
+		}
+		defer next.Close()
+
+		diff, err := ota.DiffOTAs(prev, next)
+		if err != nil {
+			return fmt.Errorf("failed to diff OTAs: %v", err)
+		}
+		if !viper.GetBool("ota.diff.files") {
+			diff.Files = ota.FileDiff{}
+		}
+		filterFileDiff(&diff.Components, re)
+		filterFileDiff(&diff.Patched, re)
+		filterFileDiff(&diff.Files, re)
+
+		if viper.GetBool("ota.diff.json") {
+			return json.NewEncoder(os.Stdout).Encode(diff)
+		}
+
+		if diff.Old != "" || diff.New != "" {
+			fmt.Printf("%s .vs %s\n", colorName(diff.Old), colorName(diff.New))
+		}
+		printFileDiff("COMPONENTS", diff.Components)
+		printFileDiff("PATCHED BINARIES", diff.Patched)
+		if viper.GetBool("ota.diff.files") {
+			printFileDiff("FILES (post.bom)", diff.Files)
+		}
+
+		return nil
+	},
+}
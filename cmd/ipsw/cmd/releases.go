@@ -0,0 +1,232 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/releases"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorRelease = color.New(color.Bold).SprintFunc()
+
+func init() {
+	rootCmd.AddCommand(releasesCmd)
+
+	releasesCmd.Flags().BoolP("update", "u", false, "Snapshot the latest AppleDB catalog into the archive")
+	releasesCmd.Flags().StringP("snapshot", "s", "", "Archived snapshot to use (defaults to the latest)")
+	releasesCmd.Flags().String("archive", "", "Snapshot archive folder (defaults to ~/.config/ipsw/releases)")
+	releasesCmd.Flags().String("os", "iOS", "OS type (iOS, iPadOS, macOS, etc.)")
+	releasesCmd.Flags().StringP("version", "v", "", "Only show builds of this version (prefix)")
+	releasesCmd.Flags().BoolP("beta", "b", false, "Only show beta/RC seeds")
+	releasesCmd.Flags().StringP("device", "d", "", "Only show this device model or board (e.g. iPhone15,2 or D73AP)")
+	releasesCmd.RegisterFlagCompletionFunc("device", complete.Devices)
+	releasesCmd.Flags().BoolP("matrix", "m", false, "Show a device model x build availability matrix")
+	releasesCmd.Flags().BoolP("changes", "c", false, "Show the builds/devices added since the previous snapshot")
+	releasesCmd.Flags().Bool("json", false, "Output as JSON")
+	viper.BindPFlag("releases.update", releasesCmd.Flags().Lookup("update"))
+	viper.BindPFlag("releases.snapshot", releasesCmd.Flags().Lookup("snapshot"))
+	viper.BindPFlag("releases.archive", releasesCmd.Flags().Lookup("archive"))
+	viper.BindPFlag("releases.os", releasesCmd.Flags().Lookup("os"))
+	viper.BindPFlag("releases.version", releasesCmd.Flags().Lookup("version"))
+	viper.BindPFlag("releases.beta", releasesCmd.Flags().Lookup("beta"))
+	viper.BindPFlag("releases.device", releasesCmd.Flags().Lookup("device"))
+	viper.BindPFlag("releases.matrix", releasesCmd.Flags().Lookup("matrix"))
+	viper.BindPFlag("releases.changes", releasesCmd.Flags().Lookup("changes"))
+	viper.BindPFlag("releases.json", releasesCmd.Flags().Lookup("json"))
+}
+
+// releasesCmd represents the releases command
+var releasesCmd = &cobra.Command{
+	Use:   "releases",
+	Short: "Track which builds exist for which devices (offline)",
+	Example: heredoc.Doc(`
+		# Archive a snapshot of the latest AppleDB catalog
+		❯ ipsw releases --update
+		# Which devices got iOS 18.0 beta seeds (and as IPSWs or OTAs)?
+		❯ ipsw releases --version 18.0 --beta --matrix
+		# Which builds exist for a board?
+		❯ ipsw releases --device D73AP
+		# What was seeded since the previous snapshot?
+		❯ ipsw releases --update --changes --json`),
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		var configDir string
+		if len(viper.ConfigFileUsed()) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			configDir = filepath.Join(home, ".config", "ipsw")
+		} else {
+			configDir = filepath.Dir(viper.ConfigFileUsed())
+		}
+		archive := viper.GetString("releases.archive")
+		if archive == "" {
+			archive = filepath.Join(configDir, "releases")
+		}
+
+		if viper.GetBool("releases.update") {
+			if err := os.MkdirAll(configDir, 0770); err != nil {
+				return fmt.Errorf("failed to create config folder: %v", err)
+			}
+			log.Info("Snapshotting AppleDB catalog")
+			files, err := download.LocalAppleDBOsFiles(&download.ADBQuery{
+				OSes:      []string{viper.GetString("releases.os")},
+				ConfigDir: configDir,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to read AppleDB: %v", err)
+			}
+			fname, err := releases.FromAppleDB(files).Save(archive)
+			if err != nil {
+				return err
+			}
+			log.Infof("Archived snapshot %s", fname)
+		}
+
+		snaps, err := releases.Snapshots(archive)
+		if err != nil {
+			return err
+		}
+		path := viper.GetString("releases.snapshot")
+		if path == "" {
+			if len(snaps) == 0 {
+				return fmt.Errorf("no snapshots found in %s (run 'ipsw releases --update' first)", archive)
+			}
+			path = snaps[len(snaps)-1]
+		}
+		snap, err := releases.Load(path)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Using snapshot %s (created %s)", path, snap.Created.Format("2006-01-02 15:04:05"))
+
+		devs, err := info.GetIpswDB()
+		if err != nil {
+			return fmt.Errorf("failed to get device DB: %v", err)
+		}
+		query := &releases.Query{
+			OS:      viper.GetString("releases.os"),
+			Version: viper.GetString("releases.version"),
+			Beta:    viper.GetBool("releases.beta"),
+			Device:  viper.GetString("releases.device"),
+		}
+
+		if viper.GetBool("releases.changes") {
+			prev := &releases.Snapshot{}
+			for i, s := range snaps {
+				if s == path && i > 0 {
+					if prev, err = releases.Load(snaps[i-1]); err != nil {
+						return err
+					}
+				}
+			}
+			changes := releases.Diff(prev, &releases.Snapshot{Builds: snap.Query(query, devs)})
+			if viper.GetBool("releases.json") {
+				return json.NewEncoder(os.Stdout).Encode(changes)
+			}
+			if len(changes) == 0 {
+				log.Info("No new builds or devices since the previous snapshot")
+			}
+			for _, c := range changes {
+				if c.New {
+					fmt.Printf("🆕 %s %s\n", c.Build.OS, colorRelease(c.Build))
+				} else {
+					fmt.Printf("⬆️  %s %s\n", c.Build.OS, colorRelease(c.Build))
+				}
+				fmt.Printf("   %s\n", strings.Join(c.Devices, ", "))
+			}
+			return nil
+		}
+
+		builds := snap.Query(query, devs)
+
+		if viper.GetBool("releases.matrix") {
+			matrix := releases.NewMatrix(builds, devs)
+			if viper.GetBool("releases.json") {
+				return json.NewEncoder(os.Stdout).Encode(matrix)
+			}
+			header := []string{"Device", "Boards"}
+			for _, b := range matrix.Builds {
+				header = append(header, b.String())
+			}
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader(header)
+			table.SetAutoWrapText(false)
+			table.SetAutoFormatHeaders(false) // keep the build case
+			table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+			table.SetCenterSeparator("|")
+			for _, row := range matrix.Rows {
+				line := []string{row.Device, strings.Join(row.Boards, ", ")}
+				for _, b := range matrix.Builds {
+					types, ok := row.Builds[b.Build]
+					switch {
+					case !ok:
+						line = append(line, "")
+					case len(types) == 0:
+						line = append(line, "✓")
+					default:
+						line = append(line, strings.Join(types, ","))
+					}
+				}
+				table.Append(line)
+			}
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			table.Render()
+			return nil
+		}
+
+		if viper.GetBool("releases.json") {
+			return json.NewEncoder(os.Stdout).Encode(builds)
+		}
+		for _, b := range builds {
+			var released string
+			if !b.Released.IsZero() {
+				released = b.Released.Format("2006-01-02")
+			}
+			fmt.Printf("%-10s %s %s (%d devices)\n", released, b.OS, colorRelease(b), len(b.Devices))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/rescue"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(rescueCmd)
+
+	rescueCmd.Flags().StringP("pattern", "p", "", "Only recover zip entries matching regex")
+	rescueCmd.Flags().BoolP("list", "l", false, "Only list what can be recovered")
+	rescueCmd.Flags().Bool("no-carve", false, "Do NOT carve Image4/MachO payloads from the raw data")
+	rescueCmd.Flags().Bool("json", false, "Output as JSON")
+	rescueCmd.Flags().StringP("output", "o", "", "Folder to write recovered files to")
+	rescueCmd.MarkFlagDirname("output")
+
+	viper.BindPFlag("rescue.pattern", rescueCmd.Flags().Lookup("pattern"))
+	viper.BindPFlag("rescue.list", rescueCmd.Flags().Lookup("list"))
+	viper.BindPFlag("rescue.no-carve", rescueCmd.Flags().Lookup("no-carve"))
+	viper.BindPFlag("rescue.json", rescueCmd.Flags().Lookup("json"))
+	viper.BindPFlag("rescue.output", rescueCmd.Flags().Lookup("output"))
+}
+
+// rescueCmd represents the rescue command
+var rescueCmd = &cobra.Command{
+	Use:   "rescue <FILE>",
+	Short: "Recover files from a damaged/partial IPSW, zip or forensic image",
+	Example: heredoc.Doc(`
+		# Recover what you can from an interrupted IPSW download
+		❯ ipsw rescue iPhone15,2_17.0_21A329_Restore.ipsw.download --output /tmp/rescued
+		# List the recoverable kernelcaches (without writing them)
+		❯ ipsw rescue broken.ipsw --pattern kernelcache --no-carve --list`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		infile := filepath.Clean(args[0])
+
+		output := viper.GetString("rescue.output")
+		if len(output) == 0 {
+			output = infile + ".rescued"
+		}
+
+		conf := &rescue.Config{
+			Pattern: viper.GetString("rescue.pattern"),
+			List:    viper.GetBool("rescue.list"),
+			NoCarve: viper.GetBool("rescue.no-carve"),
+			Output:  output,
+		}
+
+		if !conf.List {
+			log.Infof("Rescuing files from %s", infile)
+		}
+
+		arts, err := rescue.Rescue(infile, conf)
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool("rescue.json") {
+			dat, err := json.Marshal(arts)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		if len(arts) == 0 {
+			return fmt.Errorf("no recoverable files found in %s", infile)
+		}
+
+		var intact int
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		for _, art := range arts {
+			var status string
+			switch art.Status {
+			case rescue.Intact:
+				intact++
+				status = color.New(color.FgGreen).Sprint(art.Status)
+			case rescue.Partial:
+				status = color.New(color.FgYellow).Sprint(art.Status)
+			default:
+				status = color.New(color.FgRed).Sprint(art.Status)
+			}
+			size := humanize.Bytes(uint64(art.Size))
+			if art.Uncompressed > 0 {
+				size = humanize.Bytes(uint64(art.Uncompressed))
+			}
+			line := fmt.Sprintf("%#x\t%s\t%s\t%s\t%s", art.Offset, art.Kind, status, size, art.Name)
+			if len(art.Error) > 0 {
+				line += fmt.Sprintf("\t(%s)", art.Error)
+			}
+			fmt.Fprintln(w, line)
+		}
+		w.Flush()
+
+		if !conf.List {
+			log.Infof("Recovered %d intact and %d damaged files to %s", intact, len(arts)-intact, output)
+		}
+
+		return nil
+	},
+}
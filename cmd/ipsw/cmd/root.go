@@ -22,6 +22,7 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -41,6 +42,16 @@ import (
 	"github.com/blacktop/ipsw/cmd/ipsw/cmd/ota"
 	"github.com/blacktop/ipsw/cmd/ipsw/cmd/sb"
 	"github.com/blacktop/ipsw/cmd/ipsw/cmd/ssh"
+	"github.com/blacktop/ipsw/cmd/ipsw/cmd/vdev"
+	"github.com/blacktop/ipsw/cmd/ipsw/cmd/vm"
+	analysis "github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/internal/complete"
+	"github.com/blacktop/ipsw/internal/offline"
+	"github.com/blacktop/ipsw/internal/spill"
+	"github.com/blacktop/ipsw/internal/stable"
+	"github.com/blacktop/ipsw/internal/telemetry"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -53,20 +64,75 @@ var (
 	AppVersion string
 	// AppBuildCommit stores the plugin's build commit
 	AppBuildCommit string
+
+	golden *stable.Recorder
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ipsw",
 	Short: "Download and Parse IPSWs (and SO much more)",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("telemetry") {
+			telemetry.Enable()
+		}
+		if err := spill.SetBudgetString(viper.GetString("memory-budget")); err != nil {
+			return err
+		}
+		spill.SetDir(viper.GetString("spill-dir"))
+		offline.SetDir(viper.GetString("offline-data"))
+		offline.SetEnabled(viper.GetBool("offline"))
+		if !viper.GetBool("no-analysis-cache") {
+			c, err := analysis.New(viper.GetString("analysis-cache-dir"), strings.TrimSpace(AppVersion+" "+AppBuildCommit))
+			if err != nil {
+				return err
+			}
+			analysis.SetDefault(c)
+			complete.Remember(args)
+		}
+		if path := viper.GetString("golden"); len(path) > 0 {
+			// golden output must be comparable across terminals and runs
+			viper.Set("stable", true)
+			viper.Set("color", false)
+			viper.Set("no-color", true)
+			var err error
+			golden, err = stable.Record(path, viper.GetBool("update-golden"), &utils.GitDiffConfig{Tool: viper.GetString("diff-tool")})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		if golden != nil {
+			defer func() { golden = nil }()
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return golden.Finish()
+		}
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		log.Error(err.Error())
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	if s := telemetry.Finish(cmd.CommandPath(), os.Args[1:], err); s != nil {
+		if err := s.Write(viper.GetString("telemetry")); err != nil {
+			log.Error(err.Error())
+		}
+	}
+	if err != nil {
+		if golden != nil {
+			golden.Stop()
+		}
+		if viper.GetBool("json-errors") {
+			json.NewEncoder(os.Stderr).Encode(errcode.ToJSON(err))
+		} else {
+			log.Error(err.Error())
+		}
+		os.Exit(errcode.ExitCode(err))
 	}
 }
 
@@ -74,6 +140,8 @@ func init() {
 	log.SetHandler(clihander.Default)
 
 	cobra.OnInitialize(initConfig)
+	// run the root's persistent hooks (golden-file mode) as well as the subcommand group's
+	cobra.EnableTraverseRunHooks = true
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -86,6 +154,18 @@ func init() {
 	rootCmd.PersistentFlags().Bool("no-color", false, "disable colorize output")
 	rootCmd.PersistentFlags().String("diff-tool", "", "git diff tool (for --diff commands)")
 	rootCmd.PersistentFlags().MarkHidden("diff-tool")
+	rootCmd.PersistentFlags().Bool("stable", false, "deterministically order listings for diff-based pipelines (kernel kexts/symbolsets, macho info symbols, class-dump, dyld symaddr --image and dyld objc)")
+	rootCmd.PersistentFlags().String("golden", "", "compare output to golden file (implies --stable and --no-color)")
+	rootCmd.PersistentFlags().Bool("update-golden", false, "write output to the --golden file instead of comparing")
+	rootCmd.PersistentFlags().Bool("json-errors", false, "print errors as JSON objects (exit codes are set per error category)")
+	rootCmd.PersistentFlags().String("memory-budget", "", "memory budget (e.g. 2GB) before dsc xref and the dsc objc indexes spill to disk (also implies kernel kexts --stream)")
+	rootCmd.PersistentFlags().String("spill-dir", "", "directory for spill files (default is the system temp dir)")
+	rootCmd.PersistentFlags().Bool("no-analysis-cache", false, "do NOT cache expensive analyses (function starts, xrefs, etc) per UUID")
+	rootCmd.PersistentFlags().String("analysis-cache-dir", "", "analysis cache directory (default is the user cache dir)")
+	rootCmd.PersistentFlags().String("telemetry", "", "write a JSON summary of phase timings, bytes processed and cache hit rates to stderr (or a file)")
+	rootCmd.PersistentFlags().Lookup("telemetry").NoOptDefVal = "-"
+	rootCmd.PersistentFlags().Bool("offline", false, "air-gapped mode: never use the network and read network data from the imported data bundle")
+	rootCmd.PersistentFlags().String("offline-data", "", "imported data bundle directory (default is $HOME/.config/ipsw/data)")
 	rootCmd.PersistentFlags().Bool("config-quiet", false, "silence config file loading message")
 	rootCmd.PersistentFlags().MarkHidden("config-quiet")
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
@@ -93,6 +173,17 @@ func init() {
 	viper.BindPFlag("no-color", rootCmd.PersistentFlags().Lookup("no-color"))
 	viper.BindPFlag("diff-tool", rootCmd.PersistentFlags().Lookup("diff-tool"))
 	viper.BindPFlag("config-quiet", rootCmd.PersistentFlags().Lookup("config-quiet"))
+	viper.BindPFlag("json-errors", rootCmd.PersistentFlags().Lookup("json-errors"))
+	viper.BindPFlag("stable", rootCmd.PersistentFlags().Lookup("stable"))
+	viper.BindPFlag("golden", rootCmd.PersistentFlags().Lookup("golden"))
+	viper.BindPFlag("update-golden", rootCmd.PersistentFlags().Lookup("update-golden"))
+	viper.BindPFlag("memory-budget", rootCmd.PersistentFlags().Lookup("memory-budget"))
+	viper.BindPFlag("spill-dir", rootCmd.PersistentFlags().Lookup("spill-dir"))
+	viper.BindPFlag("no-analysis-cache", rootCmd.PersistentFlags().Lookup("no-analysis-cache"))
+	viper.BindPFlag("analysis-cache-dir", rootCmd.PersistentFlags().Lookup("analysis-cache-dir"))
+	viper.BindPFlag("telemetry", rootCmd.PersistentFlags().Lookup("telemetry"))
+	viper.BindPFlag("offline", rootCmd.PersistentFlags().Lookup("offline"))
+	viper.BindPFlag("offline-data", rootCmd.PersistentFlags().Lookup("offline-data"))
 	viper.BindEnv("color", "CLICOLOR")
 	viper.BindEnv("no-color", "NO_COLOR")
 	// Add subcommand groups
@@ -108,8 +199,13 @@ func init() {
 	rootCmd.AddCommand(ota.OtaCmd)
 	rootCmd.AddCommand(sb.SbCmd)
 	rootCmd.AddCommand(ssh.SSHCmd)
+	rootCmd.AddCommand(vdev.VDevCmd)
+	rootCmd.AddCommand(vm.VMCmd)
 	// Settings
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return errcode.Errorf(errcode.InvalidArgument, "%w", err)
+	})
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,120 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	sbomcmd "github.com/blacktop/ipsw/internal/commands/sbom"
+	"github.com/blacktop/ipsw/pkg/sbom"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(sbomCmd)
+
+	sbomCmd.Flags().StringP("format", "f", sbom.FormatSPDX, fmt.Sprintf("SBOM format (%s)", strings.Join(sbom.Formats, ", ")))
+	sbomCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return sbom.Formats, cobra.ShellCompDirectiveDefault
+	})
+	sbomCmd.Flags().StringP("output", "o", "", "Output file (defaults to stdout)")
+	sbomCmd.PersistentFlags().Bool("no-fs", false, "Skip the file system MachOs")
+	sbomCmd.PersistentFlags().Bool("no-dsc", false, "Skip the dyld_shared_cache images")
+	sbomCmd.PersistentFlags().Bool("no-kernel", false, "Skip the kernelcache and kexts")
+	sbomCmd.PersistentFlags().String("pem-db", "", "AEA pem DB JSON file")
+	viper.BindPFlag("sbom.format", sbomCmd.Flags().Lookup("format"))
+	viper.BindPFlag("sbom.output", sbomCmd.Flags().Lookup("output"))
+	viper.BindPFlag("sbom.no-fs", sbomCmd.PersistentFlags().Lookup("no-fs"))
+	viper.BindPFlag("sbom.no-dsc", sbomCmd.PersistentFlags().Lookup("no-dsc"))
+	viper.BindPFlag("sbom.no-kernel", sbomCmd.PersistentFlags().Lookup("no-kernel"))
+	viper.BindPFlag("sbom.pem-db", sbomCmd.PersistentFlags().Lookup("pem-db"))
+}
+
+// sbomCmd represents the sbom command
+var sbomCmd = &cobra.Command{
+	Use:   "sbom <IPSW|FOLDER>",
+	Short: "Generate an SPDX/CycloneDX SBOM of the open source components in an IPSW",
+	Example: heredoc.Doc(`
+		# Generate an SPDX SBOM of an IPSW
+		❯ ipsw sbom iPhone15,2_17.4_21E219_Restore.ipsw -o 21E219.spdx.json
+		# Generate a CycloneDX SBOM of only the dyld_shared_cache
+		❯ ipsw sbom iPhone15,2_17.4_21E219_Restore.ipsw --no-fs --no-kernel -f cyclonedx
+		# Generate an SBOM of a folder of MachOs
+		❯ ipsw sbom /Volumes/Install/System/Library/Frameworks`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		format := viper.GetString("sbom.format")
+		output := viper.GetString("sbom.output")
+		// validate flags
+		if !slices.Contains(sbom.Formats, format) {
+			return fmt.Errorf("invalid --format '%s', must be one of: %s", format, strings.Join(sbom.Formats, ", "))
+		}
+		conf := &sbomcmd.Config{
+			PemDB:      viper.GetString("sbom.pem-db"),
+			FileSystem: !viper.GetBool("sbom.no-fs"),
+			DSC:        !viper.GetBool("sbom.no-dsc"),
+			Kernel:     !viper.GetBool("sbom.no-kernel"),
+		}
+		if !conf.FileSystem && !conf.DSC && !conf.Kernel {
+			return fmt.Errorf("nothing to fingerprint (you can't use --no-fs, --no-dsc AND --no-kernel)")
+		}
+
+		s, err := sbomcmd.Generate(filepath.Clean(args[0]), conf)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if len(output) > 0 {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %v", output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := s.Write(w, format, sbom.Tool{Name: "ipsw", Version: strings.TrimSpace(AppVersion)}); err != nil {
+			return fmt.Errorf("failed to write SBOM: %v", err)
+		}
+		if len(output) > 0 {
+			log.WithField("components", len(s.Components)).Infof("Created %s", output)
+		}
+		return nil
+	},
+}
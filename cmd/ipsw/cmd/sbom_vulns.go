@@ -0,0 +1,170 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	sbomcmd "github.com/blacktop/ipsw/internal/commands/sbom"
+	"github.com/blacktop/ipsw/pkg/sbom"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var colorVulnID = color.New(color.Bold, color.FgHiRed).SprintFunc()
+var colorVulnFixed = color.New(color.Bold, color.FgHiGreen).SprintFunc()
+var colorVulnComponent = color.New(color.Bold, color.FgHiBlue).SprintFunc()
+
+func init() {
+	sbomCmd.AddCommand(sbomVulnsCmd)
+
+	sbomVulnsCmd.Flags().StringArray("db", []string{}, "NVD JSON 2.0 feed or OSV entries (.json, .json.gz, .zip or folder)")
+	sbomVulnsCmd.Flags().Bool("json", false, "Output as JSON")
+	sbomVulnsCmd.MarkFlagRequired("db")
+	viper.BindPFlag("sbom.vulns.db", sbomVulnsCmd.Flags().Lookup("db"))
+	viper.BindPFlag("sbom.vulns.json", sbomVulnsCmd.Flags().Lookup("json"))
+}
+
+// sbomVulnsCmd represents the sbom vulns command
+var sbomVulnsCmd = &cobra.Command{
+	Use:   "vulns <IPSW|FOLDER|SBOM> [<IPSW|FOLDER|SBOM>]",
+	Short: "Match the SBOM components against an offline NVD/OSV database (or diff two builds)",
+	Example: heredoc.Doc(`
+		# Report the known CVEs affecting the OSS components of an IPSW
+		❯ ipsw sbom vulns iPhone15,2_17.4_21E219_Restore.ipsw --db nvdcve-2.0-2024.json.gz --db nvdcve-2.0-2023.json.gz
+		# Report the known CVEs of a previously generated SBOM using an OSV export
+		❯ ipsw sbom vulns 21E219.spdx.json --db OSS-Fuzz/all.zip
+		# Diff the vulnerability sets of two builds (what was fixed and what is new)
+		❯ ipsw sbom vulns 21E219.spdx.json 21F79.spdx.json --db nvd/`),
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		asJSON := viper.GetBool("sbom.vulns.json")
+		conf := &sbomcmd.Config{
+			PemDB:      viper.GetString("sbom.pem-db"),
+			FileSystem: !viper.GetBool("sbom.no-fs"),
+			DSC:        !viper.GetBool("sbom.no-dsc"),
+			Kernel:     !viper.GetBool("sbom.no-kernel"),
+		}
+
+		var sboms []*sbom.SBOM
+		for _, arg := range args {
+			s, err := sbomcmd.Load(filepath.Clean(arg), conf)
+			if err != nil {
+				return fmt.Errorf("failed to load SBOM for %s: %v", arg, err)
+			}
+			sboms = append(sboms, s)
+		}
+
+		db := sbom.NewVulnDB(sboms...)
+		for _, path := range viper.GetStringSlice("sbom.vulns.db") {
+			log.WithField("db", path).Info("Loading vulnerability database")
+			if err := db.Load(path); err != nil {
+				return fmt.Errorf("failed to load vulnerability database: %v", err)
+			}
+		}
+
+		if len(sboms) == 1 {
+			findings := db.Match(sboms[0])
+			if asJSON {
+				return json.NewEncoder(os.Stdout).Encode(findings)
+			}
+			if len(findings) == 0 {
+				log.Info("No known vulnerabilities found")
+				return nil
+			}
+			printFindings(findings, "")
+			return nil
+		}
+
+		added, fixed := sbom.DiffFindings(db.Match(sboms[0]), db.Match(sboms[1]))
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(map[string][]sbom.Finding{
+				"new":   added,
+				"fixed": fixed,
+			})
+		}
+		fmt.Printf("%s -> %s\n\n", sbomLabel(sboms[0]), sbomLabel(sboms[1]))
+		if len(fixed) > 0 {
+			fmt.Printf("%s (%d)\n\n", colorVulnFixed("FIXED"), len(fixed))
+			printFindings(fixed, "  ")
+		}
+		if len(added) > 0 {
+			fmt.Printf("%s (%d)\n\n", colorVulnID("NEW"), len(added))
+			printFindings(added, "  ")
+		}
+		if len(added) == 0 && len(fixed) == 0 {
+			log.Info("No vulnerability changes")
+		}
+		return nil
+	},
+}
+
+func sbomLabel(s *sbom.SBOM) string {
+	if len(s.Version) > 0 {
+		return s.Version
+	}
+	return s.Name
+}
+
+func printFindings(findings []sbom.Finding, indent string) {
+	var last string
+	for _, f := range findings {
+		if id := f.Component + "@" + f.Version; id != last {
+			if len(last) > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s%s\n", indent, colorVulnComponent(id))
+			last = id
+		}
+		line := fmt.Sprintf("%s  %s", indent, colorVulnID(f.ID))
+		if len(f.Severity) > 0 {
+			line += " " + f.Severity
+		}
+		if len(f.Fixed) > 0 {
+			line += fmt.Sprintf(" (fixed in %s)", colorVulnFixed(f.Fixed))
+		}
+		if len(f.Summary) > 0 {
+			summary := f.Summary
+			if len(summary) > 100 {
+				summary = strings.TrimSpace(summary[:100]) + "..."
+			}
+			line += "\n" + indent + "    " + summary
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,190 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/ipa"
+	"github.com/blacktop/ipsw/internal/ssh"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const remoteDecryptDir = "/tmp/ipsw_decrypt"
+
+func init() {
+	SSHCmd.AddCommand(sshDecryptCmd)
+
+	sshDecryptCmd.Flags().StringP("decryptor", "d", "flexdecrypt file {in} --output {out}", "Command to run on device to decrypt a MachO ({in} and {out} are replaced with the paths)")
+	sshDecryptCmd.Flags().StringP("output", "o", "", "Folder to save the decrypted .ipa to")
+	sshDecryptCmd.MarkFlagDirname("output")
+	viper.BindPFlag("ssh.decrypt.decryptor", sshDecryptCmd.Flags().Lookup("decryptor"))
+	viper.BindPFlag("ssh.decrypt.output", sshDecryptCmd.Flags().Lookup("output"))
+}
+
+// shellQuote single quotes a path for the device's shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sshDecryptCmd represents the decrypt command
+var sshDecryptCmd = &cobra.Command{
+	Use:     "decrypt <IPA>",
+	Aliases: []string{"dec"},
+	Short:   "Decrypt an App Store .ipa's MachOs with a jailbroken device",
+	Long: heredoc.Doc(`
+		Decrypt the FairPlay encrypted MachOs of an App Store .ipa (i.e. from 'ipsw download ipa')
+		using a decryptor on a jailbroken (or virtual) device the app is installed on.
+
+		The decrypted MachOs are pulled back and repacked into a '<IPA>.decrypted.ipa' that can
+		be analyzed with the rest of the MachO commands.`),
+	Example: heredoc.Doc(`
+		# Download the app, install it on the device and decrypt it
+		❯ ipsw download ipa --output /tmp com.zhiliaoapp.musically
+		❯ ipsw idev apps install /tmp/com.zhiliaoapp.musically_835599320.v34.5.0.ipa
+		❯ ipsw ssh decrypt /tmp/com.zhiliaoapp.musically_835599320.v34.5.0.ipa
+		❯ unzip -d /tmp/TikTok /tmp/com.zhiliaoapp.musically_835599320.v34.5.0.decrypted.ipa
+		❯ ipsw macho info --objc /tmp/TikTok/Payload/TikTok.app/TikTok
+		# Use a different decryptor on the device
+		❯ ipsw ssh decrypt --decryptor 'foulplay {in} {out}' App.ipa`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		// parent flags
+		viper.BindPFlag("ssh.host", cmd.Flags().Lookup("host"))
+		viper.BindPFlag("ssh.port", cmd.Flags().Lookup("port"))
+		viper.BindPFlag("ssh.user", cmd.Flags().Lookup("user"))
+		viper.BindPFlag("ssh.password", cmd.Flags().Lookup("password"))
+		viper.BindPFlag("ssh.key", cmd.Flags().Lookup("key"))
+		viper.BindPFlag("ssh.insecure", cmd.Flags().Lookup("insecure"))
+		// flags
+		decryptor := viper.GetString("ssh.decrypt.decryptor")
+		output := viper.GetString("ssh.decrypt.output")
+
+		ipaPath := filepath.Clean(args[0])
+
+		if !strings.Contains(decryptor, "{in}") || !strings.Contains(decryptor, "{out}") {
+			return fmt.Errorf("--decryptor must contain the {in} and {out} placeholders")
+		}
+
+		inf, err := ipa.Parse(ipaPath)
+		if err != nil {
+			return err
+		}
+		if len(inf.Encrypted) == 0 {
+			log.Infof("%s has no encrypted MachOs", ipaPath)
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"bundle":  inf.BundleID,
+			"version": inf.Version,
+		}).Infof("Found %d encrypted MachOs", len(inf.Encrypted))
+
+		log.Infof("Connecting to %s@%s:%s", viper.GetString("ssh.user"), viper.GetString("ssh.host"), viper.GetString("ssh.port"))
+		cli, err := ssh.NewSSH(&ssh.Config{
+			Host:     viper.GetString("ssh.host"),
+			Port:     viper.GetString("ssh.port"),
+			User:     viper.GetString("ssh.user"),
+			Pass:     viper.GetString("ssh.password"),
+			Key:      viper.GetString("ssh.key"),
+			Insecure: viper.GetBool("ssh.insecure"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create ssh client: %w", err)
+		}
+		defer cli.Close()
+
+		out, err := cli.RunCommandWithOutput(fmt.Sprintf("find /var/containers/Bundle/Application -maxdepth 2 -type d -name %s", shellQuote(path.Base(inf.Bundle))))
+		if err != nil {
+			return fmt.Errorf("failed to find installed app on device: %w", err)
+		}
+		appDir := strings.TrimSpace(strings.Split(strings.TrimSpace(out), "\n")[0])
+		if appDir == "" {
+			return fmt.Errorf("%s is not installed on the device (install it with 'ipsw idev apps install %s')", inf.BundleID, ipaPath)
+		}
+		utils.Indent(log.Info, 2)("Found installed app " + appDir)
+
+		tmpDir, err := os.MkdirTemp("", "ipsw_decrypt")
+		if err != nil {
+			return fmt.Errorf("failed to create temp folder: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if err := cli.RunCommand("mkdir -p " + remoteDecryptDir); err != nil {
+			return fmt.Errorf("failed to create %s on device: %w", remoteDecryptDir, err)
+		}
+		defer cli.RunCommand("rm -rf " + remoteDecryptDir)
+
+		decrypted := make(map[string]string)
+		for i, bin := range inf.Encrypted {
+			remoteIn := path.Join(appDir, bin.BundlePath)
+			remoteOut := fmt.Sprintf("%s/%d_%s", remoteDecryptDir, i, path.Base(bin.BundlePath))
+			localOut := filepath.Join(tmpDir, fmt.Sprintf("%d_%s", i, path.Base(bin.BundlePath)))
+
+			utils.Indent(log.Info, 2)("Decrypting " + bin.BundlePath)
+			dcmd := strings.NewReplacer("{in}", shellQuote(remoteIn), "{out}", shellQuote(remoteOut)).Replace(decryptor)
+			log.Debugf("Running '%s' on device", dcmd)
+			if err := cli.RunCommand(dcmd); err != nil {
+				return fmt.Errorf("failed to decrypt %s on device: %w", bin.BundlePath, err)
+			}
+			if err := cli.CopyFromDevice(shellQuote(remoteOut), localOut); err != nil {
+				return err
+			}
+			if enc, err := ipa.IsEncrypted(localOut); err != nil {
+				return err
+			} else if enc {
+				return fmt.Errorf("%s is still encrypted after running the decryptor (cryptid != 0)", bin.BundlePath)
+			}
+			decrypted[bin.Path] = localOut
+		}
+
+		if output == "" {
+			output = filepath.Dir(ipaPath)
+		}
+		if err := os.MkdirAll(output, 0o750); err != nil {
+			return fmt.Errorf("failed to create output folder: %w", err)
+		}
+		dst := filepath.Join(output, strings.TrimSuffix(filepath.Base(ipaPath), filepath.Ext(ipaPath))+".decrypted.ipa")
+		if err := ipa.Repack(ipaPath, dst, decrypted); err != nil {
+			return fmt.Errorf("failed to repack decrypted ipa: %w", err)
+		}
+		log.Infof("Created %s", dst)
+
+		return nil
+	},
+}
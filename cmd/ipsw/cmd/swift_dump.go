@@ -22,6 +22,8 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -36,6 +38,7 @@ import (
 	"github.com/blacktop/ipsw/internal/magic"
 	"github.com/blacktop/ipsw/internal/swift"
 	"github.com/blacktop/ipsw/pkg/dyld"
+	pswift "github.com/blacktop/ipsw/pkg/swift"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -61,6 +64,8 @@ func init() {
 	swiftDumpCmd.Flags().StringP("ass", "a", "", "Dump associated type (regex)")
 	// swiftDumpCmd.Flags().Bool("re", false, "RE verbosity (with addresses)")
 	swiftDumpCmd.Flags().String("arch", "", "Which architecture to use for fat/universal MachO")
+	swiftDumpCmd.Flags().BoolP("json", "j", false, "Output the types, protocols and conformances as JSON")
+	swiftDumpCmd.MarkFlagsMutuallyExclusive("interface", "json")
 
 	viper.BindPFlag("swift-dump.all", swiftDumpCmd.Flags().Lookup("all"))
 	viper.BindPFlag("swift-dump.deps", swiftDumpCmd.Flags().Lookup("deps"))
@@ -75,6 +80,7 @@ func init() {
 	viper.BindPFlag("swift-dump.ass", swiftDumpCmd.Flags().Lookup("ass"))
 	// viper.BindPFlag("swift-dump.re", swiftDumpCmd.Flags().Lookup("re"))
 	viper.BindPFlag("swift-dump.arch", swiftDumpCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("swift-dump.json", swiftDumpCmd.Flags().Lookup("json"))
 }
 
 // swiftDumpCmd represents the swiftDump command
@@ -107,6 +113,12 @@ var swiftDumpCmd = &cobra.Command{
 				viper.GetString("swift-dump.ext") != "") ||
 			viper.GetString("swift-dump.ass") != "" {
 			return fmt.Errorf("cannot dump --interface and use --type, --protocol, --ext or --ass flags")
+		} else if viper.GetBool("swift-dump.json") &&
+			(viper.GetString("swift-dump.type") != "" ||
+				viper.GetString("swift-dump.proto") != "" ||
+				viper.GetString("swift-dump.ext") != "" ||
+				viper.GetString("swift-dump.ass") != "") {
+			return fmt.Errorf("cannot use --json with --type, --protocol, --ext or --ass flags")
 		} else if len(viper.GetString("swift-dump.output")) > 0 && !viper.GetBool("swift-dump.interface") {
 			return fmt.Errorf("cannot set --output without setting --interface")
 		}
@@ -188,6 +200,20 @@ var swiftDumpCmd = &cobra.Command{
 
 			conf.Name = filepath.Base(machoPath)
 
+			if viper.GetBool("swift-dump.json") {
+				img, err := pswift.ParseImage(m)
+				if err != nil {
+					return err
+				}
+				img.Name = conf.Name
+				dat, err := json.MarshalIndent(img, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(dat))
+				return nil
+			}
+
 			s, err = mcmd.NewSwift(m, nil, &conf)
 			if err != nil {
 				return err
@@ -247,6 +273,7 @@ var swiftDumpCmd = &cobra.Command{
 				images = append(images, img)
 			}
 
+			var swiftImages []*pswift.Image
 			for _, image := range images {
 				m, err = image.GetMacho()
 				if err != nil {
@@ -275,6 +302,22 @@ var swiftDumpCmd = &cobra.Command{
 
 				conf.Name = filepath.Base(image.Name)
 
+				if viper.GetBool("swift-dump.json") {
+					simg, err := pswift.ParseImage(m)
+					if err != nil {
+						if errors.Is(err, pswift.ErrNoSwift) {
+							if !viper.GetBool("swift-dump.all") {
+								log.Warn("no Swift data found in dylib")
+							}
+							continue
+						}
+						return fmt.Errorf("failed to parse Swift from dylib '%s': %v", filepath.Base(image.Name), err)
+					}
+					simg.Name = image.Name
+					swiftImages = append(swiftImages, simg)
+					continue
+				}
+
 				s, err = mcmd.NewSwift(m, f, &conf)
 				if err != nil {
 					return err
@@ -316,6 +359,21 @@ var swiftDumpCmd = &cobra.Command{
 					}
 				}
 			}
+
+			if viper.GetBool("swift-dump.json") {
+				var dat []byte
+				if viper.GetBool("swift-dump.all") {
+					dat, err = json.MarshalIndent(swiftImages, "", "  ")
+				} else if len(swiftImages) > 0 {
+					dat, err = json.MarshalIndent(swiftImages[0], "", "  ")
+				}
+				if err != nil {
+					return err
+				}
+				if len(dat) > 0 {
+					fmt.Println(string(dat))
+				}
+			}
 		}
 
 		return nil
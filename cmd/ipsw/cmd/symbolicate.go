@@ -33,6 +33,7 @@ import (
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/offline"
 	"github.com/blacktop/ipsw/pkg/crashlog"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/blacktop/ipsw/pkg/info"
@@ -102,7 +103,7 @@ var symbolicateCmd = &cobra.Command{
 		demangleFlag := viper.GetBool("symbolicate.demangle")
 		asHex := viper.GetBool("symbolicate.hex")
 		pemDB := viper.GetString("symbolicate.pem-db")
-		signaturesDir := viper.GetString("symbolicate.signatures")
+		signaturesDir := offline.PathOr(viper.GetString("symbolicate.signatures"), offline.Signatures)
 		extrasDir := viper.GetString("symbolicate.extra")
 		/* validate flags */
 		if (Verbose || all) && len(proc) > 0 {
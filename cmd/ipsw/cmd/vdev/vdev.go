@@ -0,0 +1,71 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vdev
+
+import (
+	"fmt"
+
+	"github.com/blacktop/ipsw/pkg/vdev"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VDevCmd.PersistentFlags().StringP("backend", "b", "corellium", fmt.Sprintf("Virtual device backend %v", vdev.Backends()))
+	VDevCmd.PersistentFlags().String("host", "", "Backend API host (i.e. your Corellium enterprise domain)")
+	VDevCmd.PersistentFlags().StringP("token", "t", "", "Backend API token (or set IPSW_VDEV_TOKEN)")
+	VDevCmd.PersistentFlags().String("project", "", "Backend project ID")
+	VDevCmd.PersistentFlags().String("proxy", "", "HTTP/HTTPS proxy")
+	VDevCmd.PersistentFlags().Bool("insecure", false, "do not verify ssl certs")
+	viper.BindPFlag("vdev.backend", VDevCmd.PersistentFlags().Lookup("backend"))
+	viper.BindPFlag("vdev.host", VDevCmd.PersistentFlags().Lookup("host"))
+	viper.BindPFlag("vdev.token", VDevCmd.PersistentFlags().Lookup("token"))
+	viper.BindPFlag("vdev.project", VDevCmd.PersistentFlags().Lookup("project"))
+	viper.BindPFlag("vdev.proxy", VDevCmd.PersistentFlags().Lookup("proxy"))
+	viper.BindPFlag("vdev.insecure", VDevCmd.PersistentFlags().Lookup("insecure"))
+}
+
+// VDevCmd represents the vdev command
+var VDevCmd = &cobra.Command{
+	Use:   "vdev",
+	Short: "Interact with remote virtual devices (i.e. Corellium)",
+	Args:  cobra.NoArgs,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("color", cmd.Flags().Lookup("color"))
+		viper.BindPFlag("no-color", cmd.Flags().Lookup("no-color"))
+		viper.BindPFlag("verbose", cmd.Flags().Lookup("verbose"))
+		viper.BindPFlag("diff-tool", cmd.Flags().Lookup("diff-tool"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func newBackend() (vdev.Backend, error) {
+	return vdev.NewBackend(viper.GetString("vdev.backend"), &vdev.Config{
+		Host:     viper.GetString("vdev.host"),
+		Token:    viper.GetString("vdev.token"),
+		Project:  viper.GetString("vdev.project"),
+		Proxy:    viper.GetString("vdev.proxy"),
+		Insecure: viper.GetBool("vdev.insecure"),
+	})
+}
@@ -0,0 +1,161 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vdev
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VDevCmd.AddCommand(vdevPullCmd)
+	VDevCmd.AddCommand(vdevPushCmd)
+	VDevCmd.AddCommand(vdevRmCmd)
+	vdevPullCmd.Flags().StringP("output", "o", "", "Folder to save file to")
+	vdevPullCmd.MarkFlagDirname("output")
+	viper.BindPFlag("vdev.pull.output", vdevPullCmd.Flags().Lookup("output"))
+}
+
+// vdevPullCmd represents the pull command
+var vdevPullCmd = &cobra.Command{
+	Use:           "pull <ID> <PATH>",
+	Short:         "Download a file from a virtual device",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		backend, err := newBackend()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		dev, err := backend.Device(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		output := viper.GetString("vdev.pull.output")
+		if len(output) > 0 {
+			if err := os.MkdirAll(output, 0750); err != nil {
+				return fmt.Errorf("failed to create output folder %s: %w", output, err)
+			}
+		}
+		fname := filepath.Join(output, filepath.Base(args[1]))
+
+		f, err := os.Create(fname)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", fname, err)
+		}
+		defer f.Close()
+
+		log.Infof("Downloading %s to %s", args[1], fname)
+		if err := dev.Pull(ctx, args[1], f); err != nil {
+			os.Remove(fname)
+			return err
+		}
+
+		return nil
+	},
+}
+
+// vdevPushCmd represents the push command
+var vdevPushCmd = &cobra.Command{
+	Use:           "push <ID> <SRC> <DST>",
+	Short:         "Upload a file to a virtual device",
+	Args:          cobra.ExactArgs(3),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		backend, err := newBackend()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		dev, err := backend.Device(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", args[1], err)
+		}
+		defer f.Close()
+
+		log.Infof("Uploading %s to %s", args[1], args[2])
+		return dev.Push(ctx, f, args[2])
+	},
+}
+
+// vdevRmCmd represents the rm command
+var vdevRmCmd = &cobra.Command{
+	Use:           "rm <ID> <PATH>",
+	Short:         "Delete a file on a virtual device",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		backend, err := newBackend()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		dev, err := backend.Device(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Deleting %s", args[1])
+		return dev.Remove(ctx, args[1])
+	},
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vdev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VDevCmd.AddCommand(vdevLsCmd)
+	vdevLsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("vdev.ls.json", vdevLsCmd.Flags().Lookup("json"))
+}
+
+// vdevLsCmd represents the ls command
+var vdevLsCmd = &cobra.Command{
+	Use:           "ls",
+	Aliases:       []string{"list"},
+	Short:         "List virtual devices",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		backend, err := newBackend()
+		if err != nil {
+			return err
+		}
+
+		insts, err := backend.List(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool("vdev.ls.json") {
+			dat, err := json.Marshal(insts)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		for _, inst := range insts {
+			fmt.Println(inst)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vdev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VDevCmd.AddCommand(vdevPsCmd)
+	vdevPsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("vdev.ps.json", vdevPsCmd.Flags().Lookup("json"))
+}
+
+// vdevPsCmd represents the ps command
+var vdevPsCmd = &cobra.Command{
+	Use:           "ps <ID>",
+	Short:         "List virtual device processes",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		backend, err := newBackend()
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+
+		dev, err := backend.Device(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		procs, err := dev.Processes(ctx)
+		if err != nil {
+			return err
+		}
+		sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+
+		if viper.GetBool("vdev.ps.json") {
+			dat, err := json.Marshal(procs)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		fmt.Fprintln(w, "PID\tNAME\tTHREADS")
+		for _, p := range procs {
+			fmt.Fprintf(w, "%d\t%s\t%d\n", p.PID, p.Name, p.Threads)
+		}
+		w.Flush()
+
+		return nil
+	},
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vdev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/caarlos0/ctrlc"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VDevCmd.AddCommand(vdevSyslogCmd)
+	vdevSyslogCmd.Flags().BoolP("follow", "f", false, "Follow the log")
+	viper.BindPFlag("vdev.syslog.follow", vdevSyslogCmd.Flags().Lookup("follow"))
+}
+
+// vdevSyslogCmd represents the syslog command
+var vdevSyslogCmd = &cobra.Command{
+	Use:           "syslog <ID>",
+	Short:         "Dump virtual device console log",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		backend, err := newBackend()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dev, err := backend.Device(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := ctrlc.Default.Run(ctx, func() error {
+			return dev.Syslog(ctx, viper.GetBool("vdev.syslog.follow"), func(line string) {
+				fmt.Println(line)
+			})
+		}); err != nil {
+			if errors.As(err, &ctrlc.ErrorCtrlC{}) {
+				log.Warn("Exiting...")
+				return nil
+			}
+			return err
+		}
+
+		return nil
+	},
+}
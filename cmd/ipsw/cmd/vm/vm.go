@@ -19,39 +19,25 @@ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
 OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 THE SOFTWARE.
 */
-package idev
+package vm
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// backupEraseCmd represents the erase command
-var backupEraseCmd = &cobra.Command{
-	Use:   "erase",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+// VMCmd represents the vm command
+var VMCmd = &cobra.Command{
+	Use:   "vm",
+	Short: "Provision disposable macOS VMs for dynamic analysis (Apple Silicon only)",
+	Args:  cobra.NoArgs,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("color", cmd.Flags().Lookup("color"))
+		viper.BindPFlag("no-color", cmd.Flags().Lookup("no-color"))
+		viper.BindPFlag("verbose", cmd.Flags().Lookup("verbose"))
+		viper.BindPFlag("diff-tool", cmd.Flags().Lookup("diff-tool"))
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("erase called")
+		cmd.Help()
 	},
 }
-
-func init() {
-	BackupCmd.AddCommand(backupEraseCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// eraseCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// eraseCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/vm"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+func init() {
+	VMCmd.AddCommand(vmCreateCmd)
+
+	vmCreateCmd.Flags().StringP("name", "n", "", "VM name (default: restore image name)")
+	vmCreateCmd.Flags().UintP("cpus", "c", vm.DefaultCPUs, "Number of CPUs")
+	vmCreateCmd.Flags().StringP("memory", "m", "8GB", "Memory size")
+	vmCreateCmd.Flags().StringP("disk", "d", "64GB", "Disk size")
+	vmCreateCmd.Flags().Bool("no-sip", false, "Disable SIP (System Integrity Protection)")
+	vmCreateCmd.Flags().Bool("no-amfi", false, "Disable AMFI (amfi_get_out_of_my_way=1)")
+	vmCreateCmd.Flags().StringSlice("boot-args", []string{}, "Extra boot-args to set")
+	viper.BindPFlag("vm.create.name", vmCreateCmd.Flags().Lookup("name"))
+	viper.BindPFlag("vm.create.cpus", vmCreateCmd.Flags().Lookup("cpus"))
+	viper.BindPFlag("vm.create.memory", vmCreateCmd.Flags().Lookup("memory"))
+	viper.BindPFlag("vm.create.disk", vmCreateCmd.Flags().Lookup("disk"))
+	viper.BindPFlag("vm.create.no-sip", vmCreateCmd.Flags().Lookup("no-sip"))
+	viper.BindPFlag("vm.create.no-amfi", vmCreateCmd.Flags().Lookup("no-amfi"))
+	viper.BindPFlag("vm.create.boot-args", vmCreateCmd.Flags().Lookup("boot-args"))
+}
+
+// vmCreateCmd represents the create command
+var vmCreateCmd = &cobra.Command{
+	Use:   "create <IPSW>",
+	Short: "Create a macOS VM from a restore image",
+	Example: heredoc.Doc(`
+		# Download the latest macOS restore image and create a VM with SIP/AMFI disabled
+		❯ ipsw dl ipsw --macos --device Macmini9,1 --latest
+		❯ ipsw vm create UniversalMac_*_Restore.ipsw --name research --no-sip --no-amfi`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		ipswPath := filepath.Clean(args[0])
+
+		memory, err := humanize.ParseBytes(viper.GetString("vm.create.memory"))
+		if err != nil {
+			return fmt.Errorf("failed to parse --memory: %w", err)
+		}
+		disk, err := humanize.ParseBytes(viper.GetString("vm.create.disk"))
+		if err != nil {
+			return fmt.Errorf("failed to parse --disk: %w", err)
+		}
+
+		name := viper.GetString("vm.create.name")
+		if len(name) == 0 {
+			name = strings.TrimSuffix(filepath.Base(ipswPath), filepath.Ext(ipswPath))
+		}
+
+		cfg, err := vm.New(&vm.Config{
+			Name:        name,
+			CPUs:        viper.GetUint("vm.create.cpus"),
+			Memory:      memory,
+			DiskSize:    disk,
+			DisableSIP:  viper.GetBool("vm.create.no-sip"),
+			DisableAMFI: viper.GetBool("vm.create.no-amfi"),
+			BootArgs:    viper.GetStringSlice("vm.create.boot-args"),
+		})
+		if err != nil {
+			return err
+		}
+
+		log.WithField("bundle", cfg.Path()).Infof("Installing %s", ipswPath)
+
+		p := mpb.New(mpb.WithWidth(80))
+		bar := p.New(100,
+			mpb.BarStyle().Lbound("[").Filler("=").Tip(">").Padding("-").Rbound("|"),
+			mpb.PrependDecorators(
+				decor.Name("Installing", decor.WC{W: len("Installing") + 1, C: decor.DindentRight | decor.DextraSpace}),
+				decor.OnComplete(
+					decor.AverageETA(decor.ET_STYLE_GO, decor.WC{W: 4}), "✅ ",
+				),
+			),
+			mpb.AppendDecorators(
+				decor.Percentage(),
+				decor.Name(" ] "),
+			),
+		)
+		if err := cfg.Install(ipswPath, func(fraction float64) {
+			bar.SetCurrent(int64(fraction * 100))
+		}); err != nil {
+			bar.Abort(true)
+			p.Wait()
+			cfg.Remove()
+			return err
+		}
+		p.Wait()
+
+		log.Infof("Created VM %s", cfg)
+		if setup := cfg.GuestSetup(); len(setup) > 0 {
+			log.Warnf("To apply the SIP/AMFI options boot into recoveryOS with `ipsw vm run %s --recovery` and run in Terminal:", cfg.Name)
+			for _, c := range setup {
+				fmt.Printf("    %s\n", c)
+			}
+		}
+
+		return nil
+	},
+}
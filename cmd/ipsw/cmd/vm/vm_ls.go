@@ -0,0 +1,80 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/vm"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VMCmd.AddCommand(vmLsCmd)
+	vmLsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("vm.ls.json", vmLsCmd.Flags().Lookup("json"))
+}
+
+// vmLsCmd represents the ls command
+var vmLsCmd = &cobra.Command{
+	Use:           "ls",
+	Aliases:       []string{"list"},
+	Short:         "List macOS VMs",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		vms, err := vm.List()
+		if err != nil {
+			return err
+		}
+
+		if viper.GetBool("vm.ls.json") {
+			dat, err := json.Marshal(vms)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(dat))
+			return nil
+		}
+
+		if len(vms) == 0 {
+			log.Warn("No VMs found (create one with `ipsw vm create`)")
+			return nil
+		}
+		for _, v := range vms {
+			fmt.Println(v)
+		}
+
+		return nil
+	},
+}
@@ -19,39 +19,42 @@ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
 OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 THE SOFTWARE.
 */
-package idev
+package vm
 
 import (
 	"fmt"
 
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/vm"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// backupRestoreCmd represents the restore command
-var backupRestoreCmd = &cobra.Command{
-	Use:   "restore",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("restore called")
-	},
-}
-
 func init() {
-	BackupCmd.AddCommand(backupRestoreCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// restoreCmd.PersistentFlags().String("foo", "", "A help for foo")
+	VMCmd.AddCommand(vmRmCmd)
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// restoreCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// vmRmCmd represents the rm command
+var vmRmCmd = &cobra.Command{
+	Use:           "rm <NAME>",
+	Aliases:       []string{"remove"},
+	Short:         "Delete a macOS VM",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		cfg, err := vm.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load VM '%s': %w", args[0], err)
+		}
+		log.Infof("Deleting VM %s", cfg.Name)
+		return cfg.Remove()
+	},
 }
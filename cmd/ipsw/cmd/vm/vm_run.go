@@ -0,0 +1,106 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vm
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/vm"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	VMCmd.AddCommand(vmRunCmd)
+
+	vmRunCmd.Flags().BoolP("recovery", "r", false, "Boot into recoveryOS")
+	vmRunCmd.Flags().StringP("share", "s", "", "Host folder to share with the guest (i.e. binaries extracted from an IPSW)")
+	vmRunCmd.Flags().Bool("read-only", false, "Share the folder read-only")
+	vmRunCmd.Flags().BoolP("ephemeral", "e", false, "Boot a disposable clone of the VM (deleted on shutdown)")
+	vmRunCmd.MarkFlagDirname("share")
+	viper.BindPFlag("vm.run.recovery", vmRunCmd.Flags().Lookup("recovery"))
+	viper.BindPFlag("vm.run.share", vmRunCmd.Flags().Lookup("share"))
+	viper.BindPFlag("vm.run.read-only", vmRunCmd.Flags().Lookup("read-only"))
+	viper.BindPFlag("vm.run.ephemeral", vmRunCmd.Flags().Lookup("ephemeral"))
+}
+
+// vmRunCmd represents the run command
+var vmRunCmd = &cobra.Command{
+	Use:   "run <NAME>",
+	Short: "Boot a macOS VM",
+	Example: heredoc.Doc(`
+		# Analyze binaries extracted from an IPSW in a throw-away clone of the VM
+		❯ ipsw extract --files --pattern '.*/usr/libexec/.*d$' macOS.ipsw -o /tmp/bins
+		❯ ipsw vm run research --ephemeral --share /tmp/bins`),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		vms, _ := vm.List()
+		var names []string
+		for _, v := range vms {
+			names = append(names, v.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		cfg, err := vm.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to load VM '%s': %w", args[0], err)
+		}
+
+		opts := &vm.RunOptions{
+			Recovery:  viper.GetBool("vm.run.recovery"),
+			ReadOnly:  viper.GetBool("vm.run.read-only"),
+			Ephemeral: viper.GetBool("vm.run.ephemeral"),
+		}
+		if share := viper.GetString("vm.run.share"); len(share) > 0 {
+			opts.SharedDir, err = filepath.Abs(share)
+			if err != nil {
+				return err
+			}
+			log.Infof("Sharing %s (mounted in the guest at '%s')", opts.SharedDir, vm.SharedFolder())
+		}
+
+		if opts.Recovery {
+			if setup := cfg.GuestSetup(); len(setup) > 0 {
+				log.Info("Run in the recoveryOS Terminal (Utilities > Terminal):")
+				for _, c := range setup {
+					fmt.Printf("    %s\n", c)
+				}
+			}
+		}
+
+		log.Infof("Booting %s (press Ctrl+C to shutdown)", cfg.Name)
+		return cfg.Run(opts)
+	},
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2018-2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/xprotect"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(xprotectCmd)
+
+	xprotectCmd.Flags().BoolP("rules", "r", false, "List the Yara rules and signatures")
+	xprotectCmd.Flags().Bool("json", false, "Output as JSON")
+	xprotectCmd.Flags().StringP("output", "o", "", "Save the content (or diff) as JSON to this file")
+	xprotectCmd.Flags().String("pem-db", "", "AEA pem DB JSON file")
+	viper.BindPFlag("xprotect.rules", xprotectCmd.Flags().Lookup("rules"))
+	viper.BindPFlag("xprotect.json", xprotectCmd.Flags().Lookup("json"))
+	viper.BindPFlag("xprotect.output", xprotectCmd.Flags().Lookup("output"))
+	viper.BindPFlag("xprotect.pem-db", xprotectCmd.Flags().Lookup("pem-db"))
+}
+
+func saveXProtectJSON(v any) error {
+	dat, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if output := viper.GetString("xprotect.output"); output != "" {
+		log.Infof("Saving %s", output)
+		return os.WriteFile(output, dat, 0o660)
+	}
+	fmt.Println(string(dat))
+	return nil
+}
+
+func printXProtectNames(title string, changes xprotect.Changes) {
+	for _, list := range []struct {
+		title string
+		names []string
+	}{
+		{"🆕 NEW", changes.New},
+		{"❌ Removed", changes.Removed},
+		{"⬆️ Updated", changes.Updated},
+	} {
+		if len(list.names) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s %s (%d)\n", list.title, title, len(list.names))
+		for _, name := range list.names {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+}
+
+// xprotectCmd represents the xprotect command
+var xprotectCmd = &cobra.Command{
+	Use:     "xprotect <IPSW|FOLDER> [<IPSW|FOLDER>]",
+	Aliases: []string{"xp"},
+	Short:   "Parse (or diff) the XProtect and MRT malware signatures of a macOS build",
+	Example: heredoc.Doc(`
+		# Show the XProtect/MRT versions and remediators of a macOS IPSW
+		❯ ipsw xprotect UniversalMac_15.0_24A335_Restore.ipsw
+		# List the Yara rules of a mounted filesystem (or an extracted XProtect update)
+		❯ ipsw xprotect /Volumes/Sequoia24A335.arm64UniversalMac --rules
+		# Diff the rules of two builds
+		❯ ipsw xprotect <old.ipsw> <new.ipsw> --output xprotect_diff.json`),
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = viper.GetBool("no-color")
+
+		asJSON := viper.GetBool("xprotect.json") || viper.GetString("xprotect.output") != ""
+
+		prev, err := xprotect.Parse(filepath.Clean(args[0]), viper.GetString("xprotect.pem-db"))
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			if asJSON {
+				return saveXProtectJSON(prev)
+			}
+			if len(prev.Versions) == 0 {
+				log.Warn("No XProtect or MRT content found")
+				return nil
+			}
+			for _, component := range []string{xprotect.XProtectBundle, xprotect.XProtectMeta, xprotect.XProtectApp, xprotect.MRTApp} {
+				if version, ok := prev.Versions[component]; ok {
+					fmt.Printf("%-16s %s\n", colorKey(component), colorValue(version))
+				}
+			}
+			fmt.Printf("\nYara Rules: %d\nSignatures: %d\n", len(prev.Rules), len(prev.Signatures))
+			if len(prev.Remediators) > 0 {
+				fmt.Printf("\nRemediators (%d)\n", len(prev.Remediators))
+				for _, r := range prev.Remediators {
+					fmt.Printf("  %s\n", r)
+				}
+			}
+			if viper.GetBool("xprotect.rules") {
+				fmt.Printf("\nYara Rules (%d)\n", len(prev.Rules))
+				for _, r := range prev.Rules {
+					fmt.Printf("  %s %s\n", colorBin(r.Name), r.Meta["description"])
+				}
+				fmt.Printf("\nSignatures (%d)\n", len(prev.Signatures))
+				for _, s := range prev.Signatures {
+					fmt.Printf("  %s %s\n", colorBin(s.Description), s.ContentType)
+				}
+			}
+			return nil
+		}
+
+		next, err := xprotect.Parse(filepath.Clean(args[1]), viper.GetString("xprotect.pem-db"))
+		if err != nil {
+			return err
+		}
+		d := xprotect.Compare(prev, next)
+
+		if asJSON {
+			return saveXProtectJSON(d)
+		}
+		if d.Empty() {
+			log.Info("No XProtect or MRT content changed")
+			return nil
+		}
+		for _, v := range d.Versions {
+			fmt.Printf("%-16s %s -> %s\n", colorKey(v.Component), v.Old, colorValue(v.New))
+		}
+		printXProtectNames("Yara Rules", d.Rules)
+		printXProtectNames("Remediators", d.Remediators)
+		printXProtectNames("Signatures", d.Signatures)
+
+		return nil
+	},
+}
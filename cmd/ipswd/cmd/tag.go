@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/blacktop/ipsw/internal/config"
+	"github.com/blacktop/ipsw/internal/daemon"
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+}
+
+// openTags opens the tags of the configured symbol server database
+func openTags() (db.Database, db.Tags, error) {
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := daemon.OpenDB(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d == nil {
+		return nil, nil, fmt.Errorf("no database configured")
+	}
+	tags, err := db.NewTags(d)
+	if err != nil {
+		d.Close()
+		return nil, nil, err
+	}
+	return d, tags, nil
+}
+
+// completeTagArgs completes the <ipsw|macho|symbol> <TARGET> args with the scanned IPSWs and MachOs
+func completeTagArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		var kinds []string
+		for _, kind := range model.TagKinds {
+			kinds = append(kinds, string(kind))
+		}
+		return kinds, cobra.ShellCompDirectiveNoFileComp
+	case 1:
+	default:
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	conf, err := config.LoadConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	d, err := daemon.OpenDB(conf)
+	if err != nil || d == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer d.Close()
+	comps, err := db.NewCompletions(d)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	const limit = 100
+	var targets []string
+	switch model.TagKind(args[0]) {
+	case model.TagIPSW:
+		ipsws, err := comps.IPSWs(toComplete, limit)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		for _, ipsw := range ipsws {
+			targets = append(targets, ipsw.ID+"\t"+ipsw.Name)
+		}
+	case model.TagMachO:
+		machos, err := comps.MachOs(toComplete, limit)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		for _, m := range machos {
+			targets = append(targets, m.UUID+"\t"+m.GetPath()) // kexts are stored by bundle ID
+		}
+	}
+	return targets, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Tag scanned IPSWs, MachOs and symbols",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
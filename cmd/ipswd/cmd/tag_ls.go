@@ -0,0 +1,93 @@
+/*
+Copyright © 2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	tagCmd.AddCommand(tagLsCmd)
+
+	tagLsCmd.Flags().StringP("key", "k", "", "List every artifact tagged KEY (or KEY=VALUE)")
+	viper.BindPFlag("tag.ls.key", tagLsCmd.Flags().Lookup("key"))
+}
+
+// tagLsCmd represents the tag ls command
+var tagLsCmd = &cobra.Command{
+	Use:     "ls [<ipsw|macho|symbol> <TARGET>]",
+	Aliases: []string{"list"},
+	Short:   "List the tags of a scanned artifact (or the artifacts with a tag)",
+	Example: heredoc.Doc(`
+		# List a kext's tags
+		❯ ipswd tag ls macho 0A6E3B4C-2C1D-3E5F-9A8B-7C6D5E4F3A2B
+		# List every build that fixed CVE-2023-41991
+		❯ ipswd tag ls --key vuln-fixed-here=CVE-2023-41991`),
+	Args: cobra.MatchAll(cobra.RangeArgs(0, 2), func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			return fmt.Errorf("requires both the artifact kind and target")
+		}
+		return nil
+	}),
+	ValidArgsFunction: completeTagArgs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := viper.GetString("tag.ls.key")
+		if len(args) == 0 && key == "" {
+			return fmt.Errorf("must supply an artifact (kind and target) or --key")
+		} else if len(args) > 0 && key != "" {
+			return fmt.Errorf("cannot use --key with an artifact")
+		}
+
+		d, tags, err := openTags()
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+
+		var found []*model.Tag
+		if len(args) == 2 {
+			found, err = tags.GetTags(model.TagKind(args[0]), args[1])
+		} else {
+			k, v, _ := strings.Cut(key, "=")
+			found, err = tags.FindTags(k, v)
+		}
+		if err != nil {
+			return err
+		}
+		for _, tag := range found {
+			line := fmt.Sprintf("%-6s %s\t%s", tag.Kind, tag.Target, tag)
+			if tag.Note != "" {
+				line += "\t# " + tag.Note
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
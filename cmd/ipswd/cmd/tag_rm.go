@@ -0,0 +1,56 @@
+/*
+Copyright © 2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	tagCmd.AddCommand(tagRmCmd)
+}
+
+// tagRmCmd represents the tag rm command
+var tagRmCmd = &cobra.Command{
+	Use:               "rm <ipsw|macho|symbol> <TARGET> <KEY>",
+	Aliases:           []string{"remove"},
+	Short:             "Remove the tag of a scanned artifact",
+	Args:              cobra.ExactArgs(3),
+	ValidArgsFunction: completeTagArgs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, tags, err := openTags()
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+
+		if err := tags.DeleteTag(model.TagKind(args[0]), args[1], args[2]); err != nil {
+			return err
+		}
+		log.WithField(args[0], args[1]).Infof("Removed tag %s", args[2])
+		return nil
+	},
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2024 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	tagCmd.AddCommand(tagSetCmd)
+
+	tagSetCmd.Flags().StringP("note", "n", "", "Note to add to the tag")
+	viper.BindPFlag("tag.set.note", tagSetCmd.Flags().Lookup("note"))
+}
+
+// tagSetCmd represents the tag set command
+var tagSetCmd = &cobra.Command{
+	Use:   "set <ipsw|macho|symbol> <TARGET> <KEY[=VALUE]>",
+	Short: "Tag (or update the tag of) a scanned IPSW, MachO or symbol",
+	Example: heredoc.Doc(`
+		# Mark a kext as triaged
+		❯ ipswd tag set macho 0A6E3B4C-2C1D-3E5F-9A8B-7C6D5E4F3A2B triaged --note "no new attack surface"
+		# Record which build fixed a vuln
+		❯ ipswd tag set ipsw 9f8c1a... vuln-fixed-here=CVE-2023-41991
+		# Tag a symbol in every build
+		❯ ipswd tag set symbol _amfi_check_dyld_policy_self owner=alice`),
+	Args:              cobra.ExactArgs(3),
+	ValidArgsFunction: completeTagArgs,
+	SilenceUsage:      true,
+	SilenceErrors:     true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		d, tags, err := openTags()
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+
+		key, value, _ := strings.Cut(args[2], "=")
+		tag := &model.Tag{
+			Kind:   model.TagKind(args[0]),
+			Target: args[1],
+			Key:    key,
+			Value:  value,
+			Note:   viper.GetString("tag.set.note"),
+		}
+		if err := tags.SetTag(tag); err != nil {
+			return err
+		}
+		log.WithField(string(tag.Kind), tag.Target).Infof("Tagged %s", tag)
+		return nil
+	},
+}
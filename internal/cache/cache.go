@@ -0,0 +1,283 @@
+// Package cache is a persistent analysis cache keyed by MachO/dyld_shared_cache UUID so that repeated commands
+// on the same kernelcache or DSC can skip expensive recomputation (function starts, xrefs, objc indexes, etc).
+//
+// Entries are stored as <dir>/<UUID>/<kind>.gob and are invalidated whenever the tool version changes.
+//
+// It also provides Files, an in-memory LRU of opened files for long running processes like ipswd.
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/spill"
+	"github.com/blacktop/ipsw/internal/telemetry"
+)
+
+var (
+	uuidRE = regexp.MustCompile(`^[A-Fa-f0-9-]+$`)
+	kindRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// header is written before every cache entry
+type header struct {
+	Version string
+	Kind    string
+	Created time.Time
+}
+
+// Cache is a per-UUID on-disk analysis cache
+type Cache struct {
+	Dir     string
+	Version string // entries written by a different version are ignored (and removed)
+}
+
+var (
+	mu  sync.Mutex
+	def *Cache
+)
+
+// SetDefault configures the cache returned by Default (nil disables caching)
+func SetDefault(c *Cache) {
+	mu.Lock()
+	def = c
+	mu.Unlock()
+}
+
+// Default returns the process wide cache (which is nil, a no-op, if caching is disabled)
+func Default() *Cache {
+	mu.Lock()
+	defer mu.Unlock()
+	return def
+}
+
+// DefaultDir returns the default cache directory ($XDG_CACHE_HOME/ipsw/analysis or ~/Library/Caches/ipsw/analysis)
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %v", err)
+	}
+	return filepath.Join(dir, "ipsw", "analysis"), nil
+}
+
+// New returns a cache stored in dir for the given tool version (dev builds fall back to their VCS revision)
+func New(dir, version string) (*Cache, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultDir(); err != nil {
+			return nil, err
+		}
+	}
+	if version == "" {
+		version = buildVersion()
+	}
+	return &Cache{Dir: dir, Version: version}, nil
+}
+
+func buildVersion() string {
+	version := "dev"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				version += "-" + s.Value
+			}
+			if s.Key == "vcs.modified" && s.Value == "true" {
+				version += "-dirty"
+			}
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if fi, err := os.Stat(exe); err == nil {
+			version += fmt.Sprintf("-%x", fi.ModTime().UnixNano()) // every rebuild is a new version
+		}
+	}
+	return version
+}
+
+func (c *Cache) path(uuid, kind string) (string, error) {
+	if !uuidRE.MatchString(uuid) {
+		return "", fmt.Errorf("invalid cache UUID %q", uuid)
+	}
+	if !kindRE.MatchString(kind) {
+		return "", fmt.Errorf("invalid cache kind %q", kind)
+	}
+	return filepath.Join(c.Dir, uuid, kind+".gob"), nil
+}
+
+// Load decodes the cached entry for uuid/kind into v and reports whether it was found (and is current)
+func (c *Cache) Load(uuid, kind string, v any) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	path, err := c.path(uuid, kind)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open cache entry: %v", err)
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	var hdr header
+	if err := dec.Decode(&hdr); err != nil || hdr.Version != c.Version || hdr.Kind != kind {
+		log.WithFields(log.Fields{
+			"uuid": uuid,
+			"kind": kind,
+		}).Debug("Invalidating stale analysis cache entry")
+		f.Close()
+		os.Remove(path)
+		return false, nil
+	}
+	if err := dec.Decode(v); err != nil {
+		f.Close()
+		os.Remove(path)
+		return false, fmt.Errorf("failed to decode cache entry %s: %v", path, err)
+	}
+	log.WithFields(log.Fields{
+		"uuid": uuid,
+		"kind": kind,
+	}).Debug("Loaded analysis from cache")
+	return true, nil
+}
+
+// Save encodes v as the cached entry for uuid/kind
+func (c *Cache) Save(uuid, kind string, v any) error {
+	if c == nil {
+		return nil
+	}
+	path, err := c.path(uuid, kind)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	// write to a temp file first so concurrent readers never see a partial entry
+	f, err := os.CreateTemp(filepath.Dir(path), kind+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %v", err)
+	}
+	defer os.Remove(f.Name())
+	enc := gob.NewEncoder(f)
+	if err := enc.Encode(header{Version: c.Version, Kind: kind, Created: time.Now()}); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode cache header: %v", err)
+	}
+	if err := enc.Encode(v); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode cache entry: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// GetOrCompute loads the cached entry for uuid/kind into v or, on a miss, calls compute to fill in v and saves it
+//
+// NOTE: failing to read or write the cache is logged but never fails the analysis itself
+func (c *Cache) GetOrCompute(uuid, kind string, v any, compute func() error) error {
+	if found, err := c.Load(uuid, kind, v); err != nil {
+		log.Debugf("failed to load analysis cache: %v", err)
+	} else if found {
+		telemetry.CacheLookup(kind, true)
+		return nil
+	}
+	telemetry.CacheLookup(kind, false)
+	defer telemetry.Phase("analysis." + kind)()
+	if err := compute(); err != nil {
+		return err
+	}
+	if err := c.Save(uuid, kind, v); err != nil {
+		log.Debugf("failed to save analysis cache: %v", err)
+	}
+	return nil
+}
+
+// Remove deletes all the cached entries for uuid
+func (c *Cache) Remove(uuid string) error {
+	if c == nil {
+		return nil
+	}
+	if _, err := c.path(uuid, "x"); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(c.Dir, uuid))
+}
+
+// Purge deletes the entire cache
+func (c *Cache) Purge() error {
+	if c == nil {
+		return nil
+	}
+	return os.RemoveAll(c.Dir)
+}
+
+// FunctionStarts returns the (cached) LC_FUNCTION_STARTS functions of a MachO
+func (c *Cache) FunctionStarts(m *macho.File) []types.Function {
+	var fns []types.Function
+	uuid := m.UUID()
+	if uuid == nil {
+		return m.GetFunctions()
+	}
+	c.GetOrCompute(uuid.String(), "function_starts", &fns, func() error {
+		fns = m.GetFunctions()
+		return nil
+	})
+	return fns
+}
+
+// SpillMap loads the cached entry for uuid/kind into a spill.Map or, on a miss, calls compute and caches its result
+//
+// NOTE: results that spilled to disk are too big to cache and are always recomputed
+func SpillMap[V any](c *Cache, uuid, kind string, compute func() (*spill.Map[V], error)) (*spill.Map[V], error) {
+	cached := make(map[uint64]V)
+	if found, err := c.Load(uuid, kind, &cached); err != nil {
+		log.Debugf("failed to load analysis cache: %v", err)
+	} else if found {
+		telemetry.CacheLookup(kind, true)
+		m := spill.NewMap[V]()
+		for k, v := range cached {
+			if err := m.Set(k, v); err != nil {
+				m.Close()
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	telemetry.CacheLookup(kind, false)
+	defer telemetry.Phase("analysis." + kind)()
+	m, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	if c != nil && !m.Spilled() {
+		if err := m.Range(func(k uint64, v V) error {
+			cached[k] = v
+			return nil
+		}); err != nil {
+			m.Close()
+			return nil, err
+		}
+		if err := c.Save(uuid, kind, cached); err != nil {
+			log.Debugf("failed to save analysis cache: %v", err)
+		}
+	}
+	return m, nil
+}
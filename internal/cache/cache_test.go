@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/spill"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	uuid := "9B7C8C4C-4E8F-3B36-8B8C-0D3F1F6F2A11"
+
+	c, err := New(dir, "3.1.500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]string{0xfffffff007004000: "_panic"}
+	if err := c.Save(uuid, "xrefs_1234", want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[uint64]string
+	if found, err := c.Load(uuid, "xrefs_1234", &got); err != nil || !found || got[0xfffffff007004000] != "_panic" {
+		t.Fatalf("Load() = %v, %t, %v", got, found, err)
+	}
+
+	computed := false
+	if err := c.GetOrCompute(uuid, "xrefs_1234", &got, func() error { computed = true; return nil }); err != nil || computed {
+		t.Errorf("GetOrCompute() recomputed a cached entry (err=%v)", err)
+	}
+
+	// a new tool version invalidates old entries
+	c2, _ := New(dir, "3.1.501")
+	if found, _ := c2.Load(uuid, "xrefs_1234", &got); found {
+		t.Error("Load() returned an entry from a different version")
+	}
+	if found, _ := c.Load(uuid, "xrefs_1234", &got); found {
+		t.Error("stale entry was not removed")
+	}
+
+	if _, err := c.Load("../../etc", "passwd", &got); err == nil {
+		t.Error("expected error for invalid UUID")
+	}
+
+	var nilCache *Cache
+	if found, err := nilCache.Load(uuid, "xrefs_1234", &got); found || err != nil {
+		t.Error("nil cache should always miss")
+	}
+}
+
+type testFile struct {
+	path   string
+	closed bool
+}
+
+func (f *testFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"dyld_shared_cache_arm64e", "kernelcache.release.iPhone15,2"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	opens := 0
+	open := func(path string) (*testFile, error) {
+		opens++
+		return &testFile{path: path}, nil
+	}
+
+	fc := NewFiles(1, 0)
+	f1, release, err := Acquire(fc, paths[0], open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	f2, release, _ := Acquire(fc, paths[0], open)
+	release()
+	if f1 != f2 || opens != 1 {
+		t.Fatalf("expected a cache hit (opens=%d)", opens)
+	}
+
+	// concurrent users share the open file
+	f1, release1, _ := Acquire(fc, paths[0], open)
+	f2, release2, _ := Acquire(fc, paths[0], open)
+	if f1 != f2 || opens != 1 {
+		t.Fatalf("expected a shared cache hit (opens=%d)", opens)
+	}
+	release1()
+	release2()
+
+	// in use files are only closed once released
+	f1, release1, _ = Acquire(fc, paths[0], open)
+	_, release2, _ = Acquire(fc, paths[1], open)
+	release2()
+	if f1.closed {
+		t.Error("evicted file was closed while in use")
+	}
+	release1()
+	if !f1.closed {
+		t.Error("evicted file was not closed once released")
+	}
+	if stats := fc.Stats(); stats.Hits != 4 || stats.Misses != 2 || stats.Evictions != 1 || len(stats.Files) != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	var nilFiles *Files
+	f, release, _ := Acquire(nilFiles, paths[0], open)
+	release()
+	if !f.closed {
+		t.Error("nil cache should close the file on release")
+	}
+}
+
+// ttlFile is closed by the cache's TTL ticker goroutine
+type ttlFile struct{ closed atomic.Bool }
+
+func (f *ttlFile) Close() error {
+	f.closed.Store(true)
+	return nil
+}
+
+func TestFilesTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kernelcache.release.iPhone15,2")
+	if err := os.WriteFile(path, []byte("kernelcache"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	open := func(string) (*ttlFile, error) { return &ttlFile{}, nil }
+
+	fc := NewFiles(2, 10*time.Millisecond)
+	defer fc.Close()
+	f, release, err := Acquire(fc, path, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if f.closed.Load() || fc.Stats().Evictions != 0 {
+		t.Fatal("in use file expired")
+	}
+	release()
+
+	// idle files are closed by the ticker (without another Acquire)
+	for deadline := time.Now().Add(time.Second); !f.closed.Load(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("idle file was not closed after the TTL")
+		}
+	}
+	if stats := fc.Stats(); stats.Evictions != 1 || len(stats.Files) != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, "3.1.500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save("9B7C8C4C-4E8F-3B36-8B8C-0D3F1F6F2A11", "function_starts", []uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := c.Entries(); err != nil || len(entries) != 1 || entries[0].Kinds[0] != "function_starts" {
+		t.Errorf("Entries() = %v, %v", entries, err)
+	}
+
+	ipsw := filepath.Join(dir, "iPhone15,2_17.0_21A329_Restore.ipsw")
+	gone := filepath.Join(dir, "gone.ipsw")
+	for _, p := range []string{ipsw, gone} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Remember(gone, ipsw, ipsw); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(gone)
+	if recent, err := c.Recent(); err != nil || len(recent) != 1 || recent[0] != ipsw {
+		t.Errorf("Recent() = %v, %v", recent, err)
+	}
+}
+
+func TestSpillMap(t *testing.T) {
+	c, err := New(t.TempDir(), "3.1.500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uuid := "9B7C8C4C-4E8F-3B36-8B8C-0D3F1F6F2A11"
+
+	computed := 0
+	compute := func() (*spill.Map[string], error) {
+		computed++
+		m := spill.NewMap[string]()
+		return m, m.Set(0x1c0000000, "NSObject")
+	}
+	for range 2 {
+		m, err := SpillMap(c, uuid, "objc_classes", compute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name, ok, err := m.Get(0x1c0000000); err != nil || !ok || name != "NSObject" {
+			t.Errorf("Get() = %q, %t, %v", name, ok, err)
+		}
+		m.Close()
+	}
+	if computed != 1 {
+		t.Errorf("SpillMap() computed the index %d times, want 1", computed)
+	}
+}
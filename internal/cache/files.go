@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// Files is an LRU-bounded, in-memory cache of opened (and parsed) files like dyld_shared_caches and kernelcaches
+// so that a long running process (ipswd) only pays the open+parse cost once per hot build
+//
+// NOTE: a nil *Files is valid and simply opens (and closes) the file on every use
+type Files struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	lru   *list.List // of *fileEntry (front is most recently used)
+	items map[string]*list.Element
+	stats FileStats
+
+	stop     chan struct{} // stops the TTL ticker
+	stopOnce sync.Once
+}
+
+type fileEntry struct {
+	key     string
+	path    string
+	kind    string
+	modTime time.Time
+	fsize   int64
+	used    time.Time
+
+	refs    int  // guarded by Files.mu
+	evicted bool // guarded by Files.mu
+
+	once  sync.Once    // opens the file
+	mu    sync.RWMutex // held (shared) by every user of the file and (exclusively) to close it
+	value io.Closer
+	err   error
+}
+
+// FileStats are the open file cache statistics
+type FileStats struct {
+	Capacity  int         `json:"capacity"`
+	Hits      uint64      `json:"hits"`
+	Misses    uint64      `json:"misses"`
+	Evictions uint64      `json:"evictions"`
+	Files     []FileEntry `json:"files,omitempty"`
+}
+
+// FileEntry is an open file in the cache
+type FileEntry struct {
+	Path     string    `json:"path"`
+	Kind     string    `json:"kind"`
+	LastUsed time.Time `json:"last_used"`
+	InUse    int       `json:"in_use"`
+}
+
+// NewFiles returns an open file cache holding at most size files (that are closed after ttl of inactivity, if set)
+//
+// NOTE: Close the cache to stop its TTL ticker
+func NewFiles(size int, ttl time.Duration) *Files {
+	if size <= 0 {
+		return nil
+	}
+	fc := &Files{
+		size:  size,
+		ttl:   ttl,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+		stop:  make(chan struct{}),
+	}
+	if ttl > 0 {
+		go fc.expire()
+	}
+	return fc
+}
+
+// expire closes the files that have been idle for longer than the TTL (until the cache is closed)
+func (fc *Files) expire() {
+	ticker := time.NewTicker(fc.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fc.stop:
+			return
+		case now := <-ticker.C:
+			fc.mu.Lock()
+			for el := fc.lru.Back(); el != nil; {
+				prev := el.Prev()
+				if e := el.Value.(*fileEntry); e.refs == 0 && now.Sub(e.used) > fc.ttl {
+					fc.evict(el)
+				}
+				el = prev
+			}
+			fc.mu.Unlock()
+		}
+	}
+}
+
+// Acquire returns the cached open file at path (opening it on a miss) and a release func that MUST be called when done
+//
+// The file is shared with the other (concurrent) callers that acquired the same path so it MUST only be read;
+// it stays open until the last of them releases it (even if it is evicted in the meantime).
+// A file that changed on disk (size or modification time) since it was opened is reopened.
+func Acquire[T io.Closer](fc *Files, path string, open func(string) (T, error)) (T, func(), error) {
+	var zero T
+	if fc == nil {
+		v, err := open(path)
+		if err != nil {
+			return zero, nil, err
+		}
+		return v, func() { v.Close() }, nil
+	}
+
+	e, err := fc.get(path, fmt.Sprintf("%T", zero))
+	if err != nil {
+		return zero, nil, err
+	}
+	e.once.Do(func() { e.value, e.err = open(e.path) })
+	if e.err != nil {
+		fc.remove(e)
+		fc.release(e)
+		return zero, nil, e.err
+	}
+	e.mu.RLock()
+	v := e.value.(T)
+	var once sync.Once
+	return v, func() {
+		once.Do(func() {
+			e.mu.RUnlock()
+			fc.release(e)
+		})
+	}, nil
+}
+
+func (fc *Files) get(path, kind string) (*fileEntry, error) {
+	path, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	key := kind + ":" + path
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := fc.items[key]; ok {
+		e := el.Value.(*fileEntry)
+		if e.modTime.Equal(fi.ModTime()) && e.fsize == fi.Size() {
+			fc.stats.Hits++
+			fc.lru.MoveToFront(el)
+			e.refs++
+			e.used = now
+			return e, nil
+		}
+		log.WithField("path", path).Debug("Cached file changed on disk; reopening")
+		fc.evict(el)
+	}
+
+	fc.stats.Misses++
+	e := &fileEntry{
+		key:     key,
+		path:    path,
+		kind:    kind,
+		modTime: fi.ModTime(),
+		fsize:   fi.Size(),
+		used:    now,
+		refs:    1,
+	}
+	fc.items[key] = fc.lru.PushFront(e)
+	for el := fc.lru.Back(); fc.lru.Len() > fc.size && el != nil; {
+		prev := el.Prev()
+		if el.Value.(*fileEntry) != e {
+			fc.evict(el) // in use entries are closed once they are released
+		}
+		el = prev
+	}
+	return e, nil
+}
+
+// evict removes the entry from the cache (closing it if it isn't in use); fc.mu must be held
+func (fc *Files) evict(el *list.Element) {
+	e := el.Value.(*fileEntry)
+	fc.lru.Remove(el)
+	delete(fc.items, e.key)
+	e.evicted = true
+	fc.stats.Evictions++
+	if e.refs == 0 {
+		go e.close()
+	}
+}
+
+func (fc *Files) remove(e *fileEntry) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if el, ok := fc.items[e.key]; ok && el.Value.(*fileEntry) == e {
+		fc.lru.Remove(el)
+		delete(fc.items, e.key)
+		e.evicted = true
+	}
+}
+
+func (fc *Files) release(e *fileEntry) {
+	fc.mu.Lock()
+	e.refs--
+	closeIt := e.refs == 0 && e.evicted
+	fc.mu.Unlock()
+	if closeIt {
+		e.close()
+	}
+}
+
+func (e *fileEntry) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.value != nil {
+		if err := e.value.Close(); err != nil {
+			log.WithField("path", e.path).Debugf("failed to close cached file: %v", err)
+		}
+		e.value = nil
+	}
+}
+
+// Stats returns the open file cache statistics
+func (fc *Files) Stats() FileStats {
+	if fc == nil {
+		return FileStats{}
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	stats := fc.stats
+	stats.Capacity = fc.size
+	for el := fc.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*fileEntry)
+		stats.Files = append(stats.Files, FileEntry{Path: e.path, Kind: e.kind, LastUsed: e.used, InUse: e.refs})
+	}
+	return stats
+}
+
+// Close stops the TTL ticker and closes all the cached files (once they are released)
+func (fc *Files) Close() {
+	if fc == nil {
+		return
+	}
+	fc.stopOnce.Do(func() { close(fc.stop) })
+	fc.Purge()
+}
+
+// Purge closes (and removes) all the cached files
+func (fc *Files) Purge() {
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for el := fc.lru.Back(); el != nil; {
+		prev := el.Prev()
+		fc.evict(el)
+		el = prev
+	}
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	recentName = "recent.json"
+	maxRecent  = 50
+)
+
+// Entry is a UUID with cached analyses
+type Entry struct {
+	UUID     string
+	Kinds    []string // the cached analyses (i.e. function_starts)
+	Modified time.Time
+}
+
+// Entries returns the UUIDs with cached analyses (most recently updated first)
+func (c *Cache) Entries() ([]Entry, error) {
+	if c == nil {
+		return nil, nil
+	}
+	dirs, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []Entry
+	for _, d := range dirs {
+		if !d.IsDir() || !uuidRE.MatchString(d.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(c.Dir, d.Name()))
+		if err != nil {
+			continue
+		}
+		e := Entry{UUID: d.Name()}
+		for _, f := range files {
+			kind, ok := strings.CutSuffix(f.Name(), ".gob")
+			if !ok || f.IsDir() {
+				continue
+			}
+			e.Kinds = append(e.Kinds, kind)
+			if fi, err := f.Info(); err == nil && fi.ModTime().After(e.Modified) {
+				e.Modified = fi.ModTime()
+			}
+		}
+		if len(e.Kinds) > 0 {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Modified.After(entries[j].Modified) })
+	return entries, nil
+}
+
+// Remember records recently used firmware files (IPSWs, OTAs, etc) for shell completion
+func (c *Cache) Remember(paths ...string) error {
+	if c == nil || len(paths) == 0 {
+		return nil
+	}
+	recent, err := c.Recent()
+	if err != nil {
+		return err
+	}
+	var abs []string
+	for _, p := range paths {
+		if p, err := filepath.Abs(p); err == nil && !slices.Contains(abs, p) {
+			abs = append(abs, p)
+		}
+	}
+	for _, p := range recent {
+		if len(abs) >= maxRecent {
+			break
+		}
+		if !slices.Contains(abs, p) {
+			abs = append(abs, p)
+		}
+	}
+	dat, err := json.Marshal(abs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, recentName), dat, 0o644)
+}
+
+// Recent returns the recently used firmware files that still exist (most recent first)
+func (c *Cache) Recent() ([]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	dat, err := os.ReadFile(filepath.Join(c.Dir, recentName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths, recent []string
+	if err := json.Unmarshal(dat, &paths); err != nil {
+		return nil, nil // a corrupt list is simply forgotten
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			recent = append(recent, p)
+		}
+	}
+	return recent, nil
+}
@@ -0,0 +1,187 @@
+package entitlements
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-plist"
+)
+
+// the CoreEntitlements DER tags
+const (
+	tagEntitlements = 16 // [APPLICATION 16] { INTEGER version, dictionary }
+	tagDictionary   = 16 // [CONTEXT 16] SET OF SEQUENCE { UTF8String key, value }
+)
+
+type derKeyValue struct {
+	Key string `asn1:"utf8"`
+	Val asn1.RawValue
+}
+
+// DerDecode decodes CoreEntitlements DER encoded entitlements (or launch/library constraints, that use the same encoding)
+func DerDecode(data []byte) (map[string]any, error) {
+	var outer asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &outer); err != nil {
+		return nil, fmt.Errorf("failed to ASN.1 parse DER entitlements: %v", err)
+	}
+	if outer.Class != asn1.ClassApplication || outer.Tag != tagEntitlements || !outer.IsCompound {
+		return nil, fmt.Errorf("invalid DER entitlements: unexpected class %d tag %d", outer.Class, outer.Tag)
+	}
+	var version int64
+	rest, err := asn1.Unmarshal(outer.Bytes, &version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ASN.1 parse DER entitlements version: %v", err)
+	}
+	var dict asn1.RawValue
+	if _, err := asn1.Unmarshal(rest, &dict); err != nil {
+		return nil, fmt.Errorf("failed to ASN.1 parse DER entitlements dictionary: %v", err)
+	}
+	val, err := derValue(dict)
+	if err != nil {
+		return nil, err
+	}
+	ents, ok := val.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid DER entitlements: expected a dictionary but got %T", val)
+	}
+	return ents, nil
+}
+
+func derValue(v asn1.RawValue) (any, error) {
+	if v.Class == asn1.ClassContextSpecific && v.Tag == tagDictionary && v.IsCompound {
+		dict := make(map[string]any)
+		for data := v.Bytes; len(data) > 0; {
+			var kv derKeyValue
+			var err error
+			if data, err = asn1.Unmarshal(data, &kv); err != nil {
+				return nil, fmt.Errorf("failed to ASN.1 parse DER entitlements key/value: %v", err)
+			}
+			if dict[kv.Key], err = derValue(kv.Val); err != nil {
+				return nil, fmt.Errorf("failed to parse '%s': %v", kv.Key, err)
+			}
+		}
+		return dict, nil
+	}
+	if v.Class != asn1.ClassUniversal {
+		return nil, fmt.Errorf("unsupported DER value class %d tag %d", v.Class, v.Tag)
+	}
+	switch v.Tag {
+	case asn1.TagBoolean:
+		var b bool
+		if _, err := asn1.Unmarshal(v.FullBytes, &b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case asn1.TagInteger:
+		var i int64
+		if _, err := asn1.Unmarshal(v.FullBytes, &i); err != nil {
+			return nil, err
+		}
+		return i, nil
+	case asn1.TagUTF8String:
+		return string(v.Bytes), nil
+	case asn1.TagSequence: // array
+		arr := make([]any, 0)
+		for data := v.Bytes; len(data) > 0; {
+			var elem asn1.RawValue
+			var err error
+			if data, err = asn1.Unmarshal(data, &elem); err != nil {
+				return nil, fmt.Errorf("failed to ASN.1 parse DER entitlements array element: %v", err)
+			}
+			val, err := derValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("unsupported DER value tag %d", v.Tag)
+	}
+}
+
+// Parse returns the entitlements of a code signature (decoding the DER entitlements if it has no XML entitlements)
+func Parse(cs *macho.CodeSignature) (map[string]any, error) {
+	if cs == nil {
+		return nil, nil
+	}
+	if len(cs.Entitlements) > 0 {
+		ents := make(map[string]any)
+		if err := plist.NewDecoder(bytes.NewReader([]byte(cs.Entitlements))).Decode(&ents); err != nil {
+			return nil, fmt.Errorf("failed to decode entitlements plist: %v", err)
+		}
+		return ents, nil
+	}
+	if len(cs.EntitlementsDER) > 0 {
+		return DerDecode(cs.EntitlementsDER)
+	}
+	return nil, nil
+}
+
+// Plist returns the entitlements plist of a code signature (converting the DER entitlements if it has no XML entitlements)
+func Plist(cs *macho.CodeSignature) (string, error) {
+	if cs == nil {
+		return "", nil
+	}
+	if len(cs.Entitlements) > 0 {
+		return cs.Entitlements, nil
+	}
+	if len(cs.EntitlementsDER) == 0 {
+		return "", nil
+	}
+	ents, err := DerDecode(cs.EntitlementsDER)
+	if err != nil {
+		return "", err
+	}
+	return toPlist(ents)
+}
+
+// Constraints returns the decoded launch (self, parent and responsible process) and library constraints of a
+// code signature keyed by their kind
+func Constraints(cs *macho.CodeSignature) (map[string]any, error) {
+	if cs == nil {
+		return nil, nil
+	}
+	lcs := make(map[string]any)
+	for _, lc := range []struct {
+		kind string
+		data []byte
+	}{
+		{"launch-constraints-self", cs.LaunchConstraintsSelf},
+		{"launch-constraints-parent", cs.LaunchConstraintsParent},
+		{"launch-constraints-responsible", cs.LaunchConstraintsResponsible},
+		{"library-constraints", cs.LibraryConstraints},
+	} {
+		if len(lc.data) == 0 {
+			continue
+		}
+		c, err := DerDecode(lc.data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", lc.kind, err)
+		}
+		lcs[lc.kind] = c
+	}
+	if len(lcs) == 0 {
+		return nil, nil
+	}
+	return lcs, nil
+}
+
+// ConstraintsPlist returns the launch and library constraints of a code signature as a plist (see Constraints)
+func ConstraintsPlist(cs *macho.CodeSignature) (string, error) {
+	lcs, err := Constraints(cs)
+	if err != nil || lcs == nil {
+		return "", err
+	}
+	return toPlist(lcs)
+}
+
+func toPlist(v map[string]any) (string, error) {
+	dat, err := plist.MarshalIndent(v, plist.XMLFormat, "\t")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode plist: %v", err)
+	}
+	return string(dat), nil
+}
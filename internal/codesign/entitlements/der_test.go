@@ -0,0 +1,92 @@
+package entitlements
+
+import (
+	"encoding/asn1"
+	"reflect"
+	"testing"
+)
+
+func derRaw(t *testing.T, v any) asn1.RawValue {
+	t.Helper()
+	dat, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{FullBytes: dat}
+}
+
+func derDict(t *testing.T, kvs ...derKeyValue) asn1.RawValue {
+	t.Helper()
+	var dat []byte
+	for _, kv := range kvs {
+		b, err := asn1.Marshal(kv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat = append(dat, b...)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tagDictionary, IsCompound: true, Bytes: dat}
+}
+
+func derArray(t *testing.T, vals ...asn1.RawValue) asn1.RawValue {
+	t.Helper()
+	var dat []byte
+	for _, v := range vals {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat = append(dat, b...)
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: dat}
+}
+
+func derEntitlements(t *testing.T, dict asn1.RawValue) []byte {
+	t.Helper()
+	version := derRaw(t, 1).FullBytes
+	d, err := asn1.Marshal(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: tagEntitlements, IsCompound: true, Bytes: append(version, d...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dat
+}
+
+func TestDerDecode(t *testing.T) {
+	utf8 := func(s string) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagUTF8String, Bytes: []byte(s)}
+	}
+	data := derEntitlements(t, derDict(t,
+		derKeyValue{"platform-application", derRaw(t, true)},
+		derKeyValue{"com.apple.private.security.storage", derArray(t, utf8("Photos"), utf8("Mail"))},
+		derKeyValue{"application-identifier", utf8("com.apple.mobilesafari")},
+		derKeyValue{"reqs", derDict(t,
+			derKeyValue{"$query", derArray(t, derArray(t, derRaw(t, 1), utf8("com.apple.launchd")))},
+			derKeyValue{"team-identifier", derRaw(t, 0)},
+		)},
+	))
+
+	got, err := DerDecode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"platform-application":               true,
+		"com.apple.private.security.storage": []any{"Photos", "Mail"},
+		"application-identifier":             "com.apple.mobilesafari",
+		"reqs": map[string]any{
+			"$query":          []any{[]any{int64(1), "com.apple.launchd"}},
+			"team-identifier": int64(0),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DerDecode() = %#v, want %#v", got, want)
+	}
+
+	if _, err := DerDecode(derRaw(t, 1).FullBytes); err == nil {
+		t.Error("DerDecode() of a non-entitlements blob should fail")
+	}
+}
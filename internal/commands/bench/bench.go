@@ -0,0 +1,277 @@
+// Package bench runs representative ipsw workloads against user provided inputs so performance can be compared between releases.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/disass"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+)
+
+// Input is the kind of file a workload runs against
+type Input string
+
+const (
+	Kernel Input = "kernel"
+	DSC    Input = "dsc"
+)
+
+// Workload is a benchmarked operation; Run returns the number of items it processed
+type Workload struct {
+	Name        string
+	Description string
+	Input       Input
+	Run         func(ctx context.Context, path string) (int, error)
+}
+
+// Workloads are the available benchmark workloads
+var Workloads = []Workload{
+	{
+		Name:        "kexts",
+		Description: "parse the kernelcache and list its KEXTs",
+		Input:       Kernel,
+		Run:         kextList,
+	},
+	{
+		Name:        "kernel-xrefs",
+		Description: "triage every kernel function to build the xref tables",
+		Input:       Kernel,
+		Run:         kernelXrefs,
+	},
+	{
+		Name:        "dsc-syms",
+		Description: "open the dyld_shared_cache and scan every image's public and local symbols",
+		Input:       DSC,
+		Run:         dscSymbols,
+	},
+}
+
+// Config is the benchmark configuration
+type Config struct {
+	Kernel     string
+	DSC        string
+	Workloads  []string // default is all the workloads that have an input
+	Iterations int
+	ProfileDir string // write CPU and heap pprof profiles for each workload here
+}
+
+// Result is the outcome of a benchmarked workload
+type Result struct {
+	Workload   string        `json:"workload"`
+	Input      string        `json:"input"`
+	Iterations int           `json:"iterations"`
+	Items      int           `json:"items"`
+	Min        time.Duration `json:"min_ns"`
+	Mean       time.Duration `json:"mean_ns"`
+	Max        time.Duration `json:"max_ns"`
+	AllocBytes uint64        `json:"alloc_bytes_per_op"`
+	Allocs     uint64        `json:"allocs_per_op"`
+	CPUProfile string        `json:"cpu_profile,omitempty"`
+	MemProfile string        `json:"mem_profile,omitempty"`
+}
+
+// Run runs the configured workloads
+func Run(ctx context.Context, conf *Config) ([]Result, error) {
+	if conf.Iterations <= 0 {
+		conf.Iterations = 1
+	}
+	for _, name := range conf.Workloads {
+		if !slices.ContainsFunc(Workloads, func(w Workload) bool { return w.Name == name }) {
+			return nil, fmt.Errorf("unknown workload %q", name)
+		}
+	}
+	if conf.ProfileDir != "" {
+		if err := os.MkdirAll(conf.ProfileDir, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create profile directory: %v", err)
+		}
+	}
+
+	var results []Result
+	for _, w := range Workloads {
+		if len(conf.Workloads) > 0 && !slices.Contains(conf.Workloads, w.Name) {
+			continue
+		}
+		var input string
+		switch w.Input {
+		case Kernel:
+			input = conf.Kernel
+		case DSC:
+			input = conf.DSC
+		}
+		if input == "" {
+			if len(conf.Workloads) > 0 {
+				return nil, fmt.Errorf("workload %s requires a %s input", w.Name, w.Input)
+			}
+			log.Debugf("Skipping workload %s (no %s input)", w.Name, w.Input)
+			continue
+		}
+		log.WithFields(log.Fields{
+			"workload":   w.Name,
+			"input":      input,
+			"iterations": conf.Iterations,
+		}).Info("Running")
+		res, err := run(ctx, w, input, conf)
+		if err != nil {
+			return results, fmt.Errorf("workload %s failed: %w", w.Name, err)
+		}
+		results = append(results, *res)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no workloads to run (supply a kernelcache and/or dyld_shared_cache)")
+	}
+
+	return results, nil
+}
+
+func run(ctx context.Context, w Workload, input string, conf *Config) (*Result, error) {
+	res := &Result{
+		Workload:   w.Name,
+		Input:      filepath.Base(input),
+		Iterations: conf.Iterations,
+	}
+
+	if conf.ProfileDir != "" {
+		res.CPUProfile = filepath.Join(conf.ProfileDir, w.Name+".cpu.pprof")
+		f, err := os.Create(res.CPUProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile: %v", err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return nil, fmt.Errorf("failed to start CPU profile: %v", err)
+		}
+	}
+
+	var before, after runtime.MemStats
+	var total time.Duration
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := range conf.Iterations {
+		if err := ctx.Err(); err != nil {
+			pprof.StopCPUProfile()
+			return nil, err
+		}
+		start := time.Now()
+		items, err := w.Run(ctx, input)
+		elapsed := time.Since(start)
+		if err != nil {
+			pprof.StopCPUProfile()
+			return nil, err
+		}
+		log.WithFields(log.Fields{
+			"iteration": i + 1,
+			"items":     items,
+			"elapsed":   elapsed,
+		}).Debug(w.Name)
+		res.Items = items
+		total += elapsed
+		if i == 0 || elapsed < res.Min {
+			res.Min = elapsed
+		}
+		if elapsed > res.Max {
+			res.Max = elapsed
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	if conf.ProfileDir != "" {
+		pprof.StopCPUProfile()
+		res.MemProfile = filepath.Join(conf.ProfileDir, w.Name+".mem.pprof")
+		f, err := os.Create(res.MemProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create heap profile: %v", err)
+		}
+		defer f.Close()
+		if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+			return nil, fmt.Errorf("failed to write heap profile: %v", err)
+		}
+	}
+
+	n := uint64(conf.Iterations)
+	res.Mean = total / time.Duration(conf.Iterations)
+	res.AllocBytes = (after.TotalAlloc - before.TotalAlloc) / n
+	res.Allocs = (after.Mallocs - before.Mallocs) / n
+
+	return res, nil
+}
+
+func kextList(ctx context.Context, path string) (int, error) {
+	m, err := macho.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Close()
+	kexts, err := kernelcache.GetKextsContext(ctx, m)
+	if err != nil {
+		return 0, err
+	}
+	return len(kexts), nil
+}
+
+func kernelXrefs(ctx context.Context, path string) (int, error) {
+	m, err := macho.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Close()
+
+	kern := m
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		kern, err = m.GetFileSetFileByName("com.apple.kernel")
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse fileset entry com.apple.kernel: %v", err)
+		}
+	}
+
+	a2s := make(map[uint64]string)
+	var count int
+	for _, fn := range kern.GetFunctions() {
+		if count%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+		}
+		data, err := kern.GetFunctionData(fn)
+		if err != nil {
+			continue
+		}
+		engine := disass.NewMachoDisass(kern, &a2s, &disass.Config{
+			Data:         data,
+			StartAddress: fn.StartAddr,
+			Quite:        true,
+		})
+		if err := engine.Triage(); err != nil {
+			return count, fmt.Errorf("failed to triage function %#x: %v", fn.StartAddr, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func dscSymbols(ctx context.Context, path string) (int, error) {
+	f, err := dyld.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := f.ParsePublicSymbolsContext(ctx, false); err != nil {
+		return 0, err
+	}
+	if err := f.ParseLocalSymsContext(ctx, false); err != nil {
+		log.Debugf("failed to parse local symbols: %v", err) // not all caches have them
+	}
+	return len(f.AddressToSymbol), nil
+}
@@ -0,0 +1,57 @@
+package bench
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/fixture"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	kc := fixture.NewKernelcache()
+	kc.AddKext("com.apple.driver.FakeDriver", "1.0.0", "_fake_start")
+	kernel := filepath.Join(dir, "kernelcache")
+	if err := kc.WriteFile(kernel); err != nil {
+		t.Fatal(err)
+	}
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort", "_exit")
+	cache := filepath.Join(dir, "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(cache); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Run(context.Background(), &Config{
+		Kernel:     kernel,
+		DSC:        cache,
+		Iterations: 2,
+		ProfileDir: filepath.Join(dir, "pprof"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(Workloads) {
+		t.Fatalf("Run() returned %d results, want %d", len(results), len(Workloads))
+	}
+	for _, res := range results {
+		if res.Iterations != 2 || res.Min > res.Mean || res.Mean > res.Max {
+			t.Errorf("%s: unexpected timings %+v", res.Workload, res)
+		}
+		for _, prof := range []string{res.CPUProfile, res.MemProfile} {
+			if fi, err := os.Stat(prof); err != nil || fi.Size() == 0 {
+				t.Errorf("%s: missing profile %s", res.Workload, prof)
+			}
+		}
+	}
+	if results[0].Workload != "kexts" || results[0].Items != 1 {
+		t.Errorf("kexts = %+v", results[0])
+	}
+
+	if _, err := Run(context.Background(), &Config{DSC: cache, Workloads: []string{"kexts"}}); err == nil {
+		t.Error("expected error for workload without input")
+	}
+}
@@ -0,0 +1,352 @@
+// Package callgraph implements the `macho callgraph` and `dyld callgraph` commands
+package callgraph
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/disass"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/fatih/color"
+)
+
+// Export formats
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatJSON    = "json"
+)
+
+// Formats are the supported call graph export formats
+var Formats = []string{FormatDOT, FormatGraphML, FormatJSON}
+
+// Config is the call graph command config
+type Config struct {
+	Indirect bool   // add objc_msgSend and function pointer hint edges
+	Format   string // export format
+	Output   string // export file (defaults to stdout)
+	Root     string // only export the functions reachable from Root
+	Depth    int    // max call depth from Root
+	From     string // reachability query source (symbol, address or image/kext)
+	To       string // reachability query target
+	Strings  bool   // record the C strings referenced by each function (always on for the fact formats)
+}
+
+// cstrings is the address ranges of C string literal sections
+type cstrings [][2]uint64
+
+func (cs *cstrings) add(m *macho.File) {
+	for _, sec := range m.Sections {
+		if sec.Flags.IsCstringLiterals() {
+			*cs = append(*cs, [2]uint64{sec.Addr, sec.Addr + sec.Size})
+		}
+	}
+}
+
+func (cs cstrings) contains(addr uint64) bool {
+	for _, r := range cs {
+		if addr >= r[0] && addr < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+type function struct {
+	m  *macho.File
+	fn types.Function
+}
+
+// machoIndex is the symbols, stubs and functions of a set of MachOs (i.e. a kernelcache's fileset entries)
+type machoIndex struct {
+	a2s       map[uint64]string
+	stubs     map[uint64]uint64
+	funcs     map[uint64]function
+	selectors map[string][]uint64
+}
+
+func newMachoIndex(ms []*macho.File, objc bool) (*machoIndex, error) {
+	idx := &machoIndex{
+		a2s:       make(map[uint64]string),
+		stubs:     make(map[uint64]uint64),
+		funcs:     make(map[uint64]function),
+		selectors: make(map[string][]uint64),
+	}
+	for _, m := range ms {
+		if err := disass.NewMachoDisass(m, &idx.a2s, &disass.Config{Quite: true}).Analyze(); err != nil {
+			return nil, fmt.Errorf("failed to analyze MachO: %v", err)
+		}
+		if ss, err := disass.ParseStubsForMachO(m); err == nil {
+			for stub, target := range ss {
+				idx.stubs[stub] = target
+			}
+		}
+		for _, fn := range cache.Default().FunctionStarts(m) {
+			idx.funcs[fn.StartAddr] = function{m: m, fn: fn}
+		}
+		if objc && m.HasObjC() {
+			if classes, err := m.GetObjCClasses(); err == nil {
+				for _, class := range classes {
+					for _, meth := range append(class.InstanceMethods, class.ClassMethods...) {
+						idx.selectors[meth.Name] = append(idx.selectors[meth.Name], meth.ImpVMAddr)
+					}
+				}
+			}
+			if cats, err := m.GetObjCCategories(); err == nil {
+				for _, cat := range cats {
+					for _, meth := range append(cat.InstanceMethods, cat.ClassMethods...) {
+						idx.selectors[meth.Name] = append(idx.selectors[meth.Name], meth.ImpVMAddr)
+					}
+				}
+			}
+		}
+	}
+	return idx, nil
+}
+
+func (idx *machoIndex) symbol(addr uint64) (string, bool) {
+	sym, ok := idx.a2s[addr]
+	return sym, ok
+}
+
+func (idx *machoIndex) isFunction(addr uint64) bool {
+	_, ok := idx.funcs[addr]
+	return ok
+}
+
+// function returns the instructions of the function starting at addr
+func (idx *machoIndex) function(addr uint64) ([]byte, uint64, bool) {
+	f, ok := idx.funcs[addr]
+	if !ok {
+		return nil, 0, false
+	}
+	data, err := f.m.GetFunctionData(f.fn)
+	if err != nil {
+		log.Debugf("failed to get data for function %#x: %v", addr, err)
+		return nil, 0, false
+	}
+	return data, f.fn.EndAddr, true
+}
+
+// AddMachO adds the functions of the MachOs (i.e. a kernelcache's fileset entries) to the call graph
+func AddMachO(g *callgraph.Graph, ms []*macho.File, names []string, conf *Config) error {
+	// first collect the symbols/stubs of every MachO so calls between them resolve
+	idx, err := newMachoIndex(ms, conf.Indirect)
+	if err != nil {
+		return err
+	}
+	var strs cstrings
+	if conf.Strings {
+		for _, m := range ms {
+			strs.add(m)
+		}
+	}
+
+	for i, m := range ms {
+		scfg := &callgraph.Config{
+			Image:      names[i],
+			Indirect:   conf.Indirect,
+			Symbol:     idx.symbol,
+			Stubs:      idx.stubs,
+			IsFunction: idx.isFunction,
+			ReadPointer: func(addr uint64) (uint64, error) {
+				ptr, err := m.GetPointerAtAddress(addr)
+				if err != nil {
+					return 0, err
+				}
+				return m.SlidePointer(ptr), nil
+			},
+			CString:   m.GetCString,
+			Selectors: idx.selectors,
+		}
+		if conf.Strings {
+			scfg.IsCString = strs.contains
+		}
+		for _, fn := range cache.Default().FunctionStarts(m) {
+			data, err := m.GetFunctionData(fn)
+			if err != nil {
+				log.Debugf("failed to get data for function %#x: %v", fn.StartAddr, err)
+				continue
+			}
+			g.Scan(fn.StartAddr, fn.EndAddr, data, scfg)
+		}
+	}
+
+	return nil
+}
+
+// AddImages adds the functions of the dyld_shared_cache images to the call graph
+func AddImages(g *callgraph.Graph, f *dyld.File, images []*dyld.CacheImage, conf *Config) error {
+	starts := make(map[uint64]bool)
+	stubs := make(map[uint64]uint64)
+	selectors := make(map[string][]uint64)
+	var strs cstrings
+
+	fns := make(map[*dyld.CacheImage][]uint64) // image -> function starts/ends
+	for _, img := range images {
+		if err := img.Analyze(); err != nil {
+			return fmt.Errorf("failed to analyze image %s: %v", img.Name, err)
+		}
+		m, err := img.GetMacho()
+		if err != nil {
+			return fmt.Errorf("failed to get MachO for image %s: %v", img.Name, err)
+		}
+		for _, fn := range cache.Default().FunctionStarts(m) {
+			starts[fn.StartAddr] = true
+			fns[img] = append(fns[img], fn.StartAddr, fn.EndAddr)
+		}
+		if conf.Strings {
+			strs.add(m)
+		}
+		m.Close()
+		for stub, target := range img.Analysis.SymbolStubs {
+			stubs[stub] = target
+		}
+		if conf.Indirect {
+			for _, meth := range img.ObjC.Methods {
+				selectors[meth.Name] = append(selectors[meth.Name], meth.ImpVMAddr)
+			}
+		}
+	}
+
+	for _, img := range images {
+		scfg := &callgraph.Config{
+			Image:    img.Name,
+			Indirect: conf.Indirect,
+			Symbol: func(addr uint64) (string, bool) {
+				sym, ok := f.AddressToSymbol[addr]
+				return sym, ok
+			},
+			Stubs:      stubs,
+			IsFunction: func(addr uint64) bool { return starts[addr] },
+			ReadPointer: func(addr uint64) (uint64, error) {
+				ptr, err := f.ReadPointerAtAddress(addr)
+				if err != nil {
+					return 0, err
+				}
+				return f.SlideInfo.SlidePointer(ptr), nil
+			},
+			CString:   f.GetCString,
+			Selectors: selectors,
+		}
+		if conf.Strings {
+			scfg.IsCString = strs.contains
+		}
+		for i := 0; i+1 < len(fns[img]); i += 2 {
+			start, end := fns[img][i], fns[img][i+1]
+			uuid, off, err := f.GetOffset(start)
+			if err != nil {
+				return err
+			}
+			data, err := f.ReadBytesForUUID(uuid, int64(off), end-start)
+			if err != nil {
+				return err
+			}
+			g.Scan(start, end, data, scfg)
+		}
+	}
+
+	return nil
+}
+
+func find(g *callgraph.Graph, query string) ([]*callgraph.Node, error) {
+	nodes := g.Find(query)
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no functions found matching '%s'", query)
+	}
+	return nodes, nil
+}
+
+// Query answers the --from/--to reachability query ("can AppleH13CamIn reach copyin")
+func Query(g *callgraph.Graph, conf *Config) error {
+	from, err := find(g, conf.From)
+	if err != nil {
+		return err
+	}
+	to, err := find(g, conf.To)
+	if err != nil {
+		return err
+	}
+	path := g.Path(from, to)
+	if path == nil {
+		log.Warnf("%s can NOT reach %s", conf.From, conf.To)
+		return nil
+	}
+	log.Infof("%s can reach %s", conf.From, conf.To)
+	if len(path) == 0 {
+		return nil // from is to
+	}
+	fmt.Println(nodeString(g.Nodes[path[0].From]))
+	for _, e := range path {
+		fmt.Printf("  %s %s %s\n", color.New(color.Faint).Sprintf("%#x", e.Site), color.New(color.FgHiBlue).Sprint("→ "+string(e.Kind)), nodeString(g.Nodes[e.To]))
+	}
+	return nil
+}
+
+func nodeString(n *callgraph.Node) string {
+	name := color.New(color.Bold).Sprint(n.Name)
+	if len(n.Image) > 0 {
+		return fmt.Sprintf("%s (%s %#x)", name, n.Image, n.Addr)
+	}
+	return fmt.Sprintf("%s (%#x)", name, n.Addr)
+}
+
+// subgraph returns the part of the call graph reachable from --root (or the whole graph)
+func subgraph(g *callgraph.Graph, conf *Config) (*callgraph.Graph, error) {
+	if len(conf.Root) == 0 {
+		return g, nil
+	}
+	roots, err := find(g, conf.Root)
+	if err != nil {
+		return nil, err
+	}
+	return g.Subgraph(roots, conf.Depth), nil
+}
+
+// Export writes the call graph (or the part reachable from --root) in the requested format
+func Export(g *callgraph.Graph, conf *Config) error {
+	if !slices.Contains(Formats, conf.Format) {
+		return fmt.Errorf("invalid format '%s', must be one of: %s", conf.Format, strings.Join(Formats, ", "))
+	}
+	g, err := subgraph(g, conf)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if len(conf.Output) > 0 {
+		f, err := os.Create(conf.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", conf.Output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch conf.Format {
+	case FormatDOT:
+		err = g.WriteDOT(w)
+	case FormatGraphML:
+		err = g.WriteGraphML(w)
+	case FormatJSON:
+		err = g.WriteJSON(w)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write call graph: %v", err)
+	}
+	if len(conf.Output) > 0 {
+		log.WithFields(log.Fields{
+			"functions": len(g.Nodes),
+			"calls":     len(g.Edges),
+		}).Infof("Created %s", conf.Output)
+	}
+	return nil
+}
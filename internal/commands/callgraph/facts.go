@@ -0,0 +1,147 @@
+package callgraph
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/facts"
+)
+
+// Fact database formats
+const (
+	FormatSQLite  = "sqlite"
+	FormatSouffle = "souffle"
+)
+
+// FactFormats are the supported fact database formats
+var FactFormats = []string{FormatSQLite, FormatSouffle}
+
+// IsFactFormat returns true if format is a fact database format
+func IsFactFormat(format string) bool {
+	return slices.Contains(FactFormats, format)
+}
+
+func imageKind(m *macho.File) string {
+	switch m.Type {
+	case types.MH_KEXT_BUNDLE:
+		return "kext"
+	case types.MH_DYLIB:
+		return "dylib"
+	default:
+		return "macho"
+	}
+}
+
+func imageUUID(m *macho.File) string {
+	if uuid := m.UUID(); uuid != nil {
+		return uuid.String()
+	}
+	return ""
+}
+
+func imageFacts(db *facts.DB, m *macho.File, name string, sizes map[uint64]uint64) {
+	db.Images = append(db.Images, facts.Image{Image: name, UUID: imageUUID(m), Kind: imageKind(m)})
+	for _, fn := range cache.Default().FunctionStarts(m) {
+		sizes[fn.StartAddr] = fn.EndAddr - fn.StartAddr
+	}
+	syms, err := m.ImportedSymbols()
+	if err != nil {
+		log.Debugf("failed to get imported symbols for %s: %v", name, err)
+		return
+	}
+	libs := m.ImportedLibraries()
+	for _, sym := range syms {
+		var lib string
+		if ord := sym.Desc.GetLibraryOrdinal(); ord > types.SELF_LIBRARY_ORDINAL && int(ord) <= len(libs) {
+			lib = libs[ord-1]
+		}
+		db.Imports = append(db.Imports, facts.Import{Image: name, Symbol: sym.Name, Library: lib})
+	}
+}
+
+// graphFacts adds the call graph's functions, calls and string references to the fact database
+func graphFacts(db *facts.DB, g *callgraph.Graph, sizes map[uint64]uint64) {
+	image := func(addr uint64) string {
+		if n, ok := g.Nodes[addr]; ok {
+			return n.Image
+		}
+		return ""
+	}
+	for _, n := range g.Nodes {
+		db.Functions = append(db.Functions, facts.Function{Image: n.Image, Addr: n.Addr, Name: n.Name, Size: sizes[n.Addr]})
+	}
+	slices.SortFunc(db.Functions, func(a, b facts.Function) int { return cmp.Compare(a.Addr, b.Addr) })
+	for _, e := range g.Edges {
+		db.Calls = append(db.Calls, facts.Call{Image: image(e.From), Caller: e.From, Callee: e.To, Site: e.Site, Kind: string(e.Kind)})
+	}
+	for _, s := range g.Strings {
+		if _, ok := g.Nodes[s.Func]; ok { // the graph might be a --root subgraph
+			db.StringRefs = append(db.StringRefs, facts.StringRef{Image: image(s.Func), Func: s.Func, Site: s.Site, Addr: s.Addr, Value: s.Value})
+		}
+	}
+}
+
+// MachOFacts writes the fact database of the MachOs (i.e. a kernelcache's fileset entries) and their call graph
+func MachOFacts(g *callgraph.Graph, ms []*macho.File, names []string, conf *Config) error {
+	db := &facts.DB{}
+	sizes := make(map[uint64]uint64)
+	for i, m := range ms {
+		imageFacts(db, m, names[i], sizes)
+	}
+	return writeFacts(db, g, sizes, conf)
+}
+
+// ImageFacts writes the fact database of the dyld_shared_cache images and their call graph
+func ImageFacts(g *callgraph.Graph, images []*dyld.CacheImage, conf *Config) error {
+	db := &facts.DB{}
+	sizes := make(map[uint64]uint64)
+	for _, img := range images {
+		m, err := img.GetMacho()
+		if err != nil {
+			return fmt.Errorf("failed to get MachO for image %s: %v", img.Name, err)
+		}
+		imageFacts(db, m, img.Name, sizes)
+		m.Close()
+	}
+	return writeFacts(db, g, sizes, conf)
+}
+
+func writeFacts(db *facts.DB, g *callgraph.Graph, sizes map[uint64]uint64, conf *Config) error {
+	if len(conf.Output) == 0 {
+		return fmt.Errorf("the %s format requires an --output (database file or facts directory)", conf.Format)
+	}
+	g, err := subgraph(g, conf)
+	if err != nil {
+		return err
+	}
+	graphFacts(db, g, sizes)
+
+	switch conf.Format {
+	case FormatSQLite:
+		err = db.WriteSQLite(conf.Output)
+	case FormatSouffle:
+		err = db.WriteSouffle(conf.Output)
+	default:
+		return fmt.Errorf("invalid format '%s', must be one of: %s", conf.Format, strings.Join(FactFormats, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write fact database: %v", err)
+	}
+	log.WithFields(log.Fields{
+		"images":      len(db.Images),
+		"functions":   len(db.Functions),
+		"calls":       len(db.Calls),
+		"string_refs": len(db.StringRefs),
+		"imports":     len(db.Imports),
+	}).Infof("Created %s", filepath.Clean(conf.Output))
+	return nil
+}
@@ -0,0 +1,80 @@
+package callgraph
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/facts"
+)
+
+func TestGraphFacts(t *testing.T) {
+	g := callgraph.New()
+	g.AddNode(0x2000, "_bar", "com.apple.driver.AppleBar", false)
+	g.AddNode(0x1000, "_foo", "com.apple.driver.AppleFoo", false)
+	g.AddNode(0x9000, "_copyin", "", true)
+	g.AddEdge(callgraph.Edge{From: 0x1000, To: 0x2000, Site: 0x1004, Kind: callgraph.Call})
+	g.AddEdge(callgraph.Edge{From: 0x2000, To: 0x9000, Site: 0x2008, Kind: callgraph.Stub})
+	g.Strings = []callgraph.StringRef{
+		{Func: 0x1000, Site: 0x1008, Addr: 0x8000, Value: "foo"},
+		{Func: 0x2000, Site: 0x200c, Addr: 0x8010, Value: "bar"},
+	}
+	sizes := map[uint64]uint64{0x1000: 0x10, 0x2000: 0x20}
+
+	for _, tt := range []struct {
+		name      string
+		root      string
+		functions []facts.Function
+		calls     []facts.Call
+		strings   []facts.StringRef
+	}{
+		{
+			name: "graph",
+			functions: []facts.Function{
+				{Image: "com.apple.driver.AppleFoo", Addr: 0x1000, Name: "_foo", Size: 0x10},
+				{Image: "com.apple.driver.AppleBar", Addr: 0x2000, Name: "_bar", Size: 0x20},
+				{Addr: 0x9000, Name: "_copyin"},
+			},
+			calls: []facts.Call{
+				{Image: "com.apple.driver.AppleFoo", Caller: 0x1000, Callee: 0x2000, Site: 0x1004, Kind: "call"},
+				{Image: "com.apple.driver.AppleBar", Caller: 0x2000, Callee: 0x9000, Site: 0x2008, Kind: "stub"},
+			},
+			strings: []facts.StringRef{
+				{Image: "com.apple.driver.AppleFoo", Func: 0x1000, Site: 0x1008, Addr: 0x8000, Value: "foo"},
+				{Image: "com.apple.driver.AppleBar", Func: 0x2000, Site: 0x200c, Addr: 0x8010, Value: "bar"},
+			},
+		},
+		{
+			name: "root subgraph",
+			root: "_bar",
+			functions: []facts.Function{
+				{Image: "com.apple.driver.AppleBar", Addr: 0x2000, Name: "_bar", Size: 0x20},
+				{Addr: 0x9000, Name: "_copyin"},
+			},
+			calls: []facts.Call{
+				{Image: "com.apple.driver.AppleBar", Caller: 0x2000, Callee: 0x9000, Site: 0x2008, Kind: "stub"},
+			},
+			strings: []facts.StringRef{
+				{Image: "com.apple.driver.AppleBar", Func: 0x2000, Site: 0x200c, Addr: 0x8010, Value: "bar"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := subgraph(g, &Config{Root: tt.root, Depth: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := &facts.DB{}
+			graphFacts(db, sub, sizes)
+			if !slices.Equal(db.Functions, tt.functions) {
+				t.Errorf("graphFacts() functions = %+v, want %+v", db.Functions, tt.functions)
+			}
+			if !slices.Equal(db.Calls, tt.calls) {
+				t.Errorf("graphFacts() calls = %+v, want %+v", db.Calls, tt.calls)
+			}
+			if !slices.Equal(db.StringRefs, tt.strings) {
+				t.Errorf("graphFacts() string refs = %+v, want %+v", db.StringRefs, tt.strings)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package callgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/facts"
+	"github.com/fatih/color"
+)
+
+// StringFormats are the supported string index export formats (the default is a table on stdout)
+var StringFormats = []string{FormatJSON, FormatSQLite}
+
+// StringConfig is the string index command config
+type StringConfig struct {
+	Search string // only index the strings containing Search
+	Format string // export format
+	Output string // export file (defaults to stdout)
+}
+
+// MachOStrings writes the string index of the MachOs (i.e. a kernelcache's fileset entries)
+//
+// NOTE: the call graph must have been built with Config.Strings
+func MachOStrings(g *callgraph.Graph, ms []*macho.File, names []string, conf *StringConfig) error {
+	db := &facts.DB{}
+	sizes := make(map[uint64]uint64)
+	if conf.Format == FormatSQLite {
+		for i, m := range ms {
+			imageFacts(db, m, names[i], sizes)
+		}
+	}
+	return writeStrings(db, g, sizes, conf)
+}
+
+// ImageStrings writes the string index of the dyld_shared_cache images
+//
+// NOTE: the call graph must have been built with Config.Strings
+func ImageStrings(g *callgraph.Graph, images []*dyld.CacheImage, conf *StringConfig) error {
+	db := &facts.DB{}
+	sizes := make(map[uint64]uint64)
+	if conf.Format == FormatSQLite {
+		for _, img := range images {
+			m, err := img.GetMacho()
+			if err != nil {
+				return fmt.Errorf("failed to get MachO for image %s: %v", img.Name, err)
+			}
+			imageFacts(db, m, img.Name, sizes)
+			m.Close()
+		}
+	}
+	return writeStrings(db, g, sizes, conf)
+}
+
+func writeStrings(db *facts.DB, g *callgraph.Graph, sizes map[uint64]uint64, conf *StringConfig) error {
+	if len(conf.Format) > 0 && !slices.Contains(StringFormats, conf.Format) {
+		return fmt.Errorf("invalid format '%s', must be one of: %s", conf.Format, strings.Join(StringFormats, ", "))
+	}
+
+	if conf.Format == FormatSQLite {
+		if len(conf.Output) == 0 {
+			return fmt.Errorf("the %s format requires an --output database file", conf.Format)
+		}
+		graphFacts(db, g, sizes)
+		db.Calls, db.Imports = nil, nil
+		db.StringRefs = slices.DeleteFunc(db.StringRefs, func(s facts.StringRef) bool {
+			return !strings.Contains(s.Value, conf.Search)
+		})
+		if err := db.WriteSQLite(conf.Output); err != nil {
+			return fmt.Errorf("failed to write string index: %v", err)
+		}
+		log.WithFields(log.Fields{
+			"images":      len(db.Images),
+			"functions":   len(db.Functions),
+			"string_refs": len(db.StringRefs),
+		}).Infof("Created %s (query the string_xrefs view)", filepath.Clean(conf.Output))
+		return nil
+	}
+
+	strs := g.StringIndex(conf.Search)
+
+	var w io.Writer = os.Stdout
+	if len(conf.Output) > 0 {
+		f, err := os.Create(conf.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", conf.Output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if conf.Format == FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(strs); err != nil {
+			return fmt.Errorf("failed to write string index: %v", err)
+		}
+	} else {
+		for _, s := range strs {
+			fmt.Fprintf(w, "%s %s\n", color.New(color.Faint).Sprintf("%#x", s.Addr), color.New(color.FgHiGreen).Sprintf("%q", s.Value))
+			for _, x := range s.Xrefs {
+				name := x.Name
+				if len(s.Image) > 0 {
+					name = fmt.Sprintf("%s (%s)", name, s.Image)
+				}
+				fmt.Fprintf(w, "    %s %s\n", color.New(color.Faint).Sprintf("%#x", x.Site), color.New(color.Bold).Sprint(name))
+			}
+		}
+	}
+	if len(conf.Output) > 0 {
+		log.WithField("strings", len(strs)).Infof("Created %s", conf.Output)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package callgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/fatih/color"
+)
+
+// externalMethodRE matches IOUserClient::externalMethod overrides
+var externalMethodRE = regexp.MustCompile(`^__ZN\d+\w+?\d+externalMethodE`)
+
+// TaintConfig is the taint command config
+type TaintConfig struct {
+	Syscalls        bool     // seed the BSD syscall handlers' uap (x1)
+	MachTraps       bool     // seed the mach trap handlers' args (x0)
+	MIG             bool     // seed the MIG server routines' request message (x0)
+	ExternalMethods bool     // seed IOUserClient::externalMethod overrides' selector and arguments (x1, x2)
+	Entries         []string // custom entry points as SYMBOL|ADDR[:REG,REG...] (default regs are x0-x7)
+	Depth           int      // how many calls deep to follow tainted arguments
+	JSON            bool
+}
+
+func parseEntry(idx *machoIndex, spec string) (callgraph.Entry, error) {
+	entry := callgraph.Entry{Origin: "custom"}
+	name, regs, ok := strings.Cut(spec, ":")
+	if ok {
+		entry.Args = strings.Split(regs, ",")
+	} else {
+		entry.Args = []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7"}
+	}
+	if addr, err := utils.ConvertStrToInt(name); err == nil {
+		entry.Addr = addr
+		entry.Name, _ = idx.symbol(addr)
+		if len(entry.Name) == 0 {
+			entry.Name = fmt.Sprintf("sub_%x", addr)
+		}
+		return entry, nil
+	}
+	for addr, sym := range idx.a2s {
+		if (sym == name || sym == "_"+name) && idx.isFunction(addr) {
+			entry.Addr, entry.Name = addr, sym
+			return entry, nil
+		}
+	}
+	return entry, fmt.Errorf("entry point '%s' not found", name)
+}
+
+func (idx *machoIndex) entryName(addr uint64, fallback string) string {
+	if sym, ok := idx.symbol(addr); ok && !strings.HasPrefix(sym, "sub_") {
+		return sym
+	}
+	return fallback
+}
+
+// Taint runs the taint-lite data-flow pass from the kernel's syscall/MIG/IOKit entry points
+func Taint(kernel *macho.File, ms []*macho.File, conf *TaintConfig) error {
+	idx, err := newMachoIndex(ms, false)
+	if err != nil {
+		return err
+	}
+
+	var entries []callgraph.Entry
+	if conf.Syscalls {
+		syscalls, err := kernelcache.GetSyscallTable(kernel)
+		if err != nil {
+			return fmt.Errorf("failed to get syscall table: %v", err)
+		}
+		for _, sc := range syscalls {
+			if sc.Call == 0 || sc.NArg == 0 || sc.Old {
+				continue
+			}
+			entries = append(entries, callgraph.Entry{
+				Addr:   sc.Call,
+				Name:   idx.entryName(sc.Call, sc.Name),
+				Origin: fmt.Sprintf("syscall %d", sc.Number),
+				Args:   []string{"x1"}, // (proc_t p, struct args *uap, int32_t *retval)
+			})
+		}
+	}
+	if conf.MachTraps {
+		traps, err := kernelcache.GetMachTrapTable(kernel)
+		if err != nil {
+			return fmt.Errorf("failed to get mach trap table: %v", err)
+		}
+		for _, trap := range traps {
+			if trap.Function == 0 || trap.ArgCount == 0 {
+				continue
+			}
+			entries = append(entries, callgraph.Entry{
+				Addr:   trap.Function,
+				Name:   idx.entryName(trap.Function, trap.Name),
+				Origin: fmt.Sprintf("mach trap %d", trap.Number),
+				Args:   []string{"x0"}, // (struct xxx_args *args)
+			})
+		}
+	}
+	if conf.MIG {
+		subsystems, err := kernelcache.GetMigSubsystems(kernel)
+		if err != nil {
+			return fmt.Errorf("failed to get MIG subsystems: %v", err)
+		}
+		for _, sub := range subsystems {
+			for i, routine := range sub.Routines {
+				if routine.KStubRoutine == 0 {
+					continue
+				}
+				entries = append(entries, callgraph.Entry{
+					Addr:   routine.KStubRoutine,
+					Name:   idx.entryName(routine.KStubRoutine, sub.LookupRoutineName(i)),
+					Origin: fmt.Sprintf("mig %d", int(sub.Start)+i),
+					Args:   []string{"x0"}, // (mach_msg_header_t *InHeadP, mach_msg_header_t *OutHeadP)
+				})
+			}
+		}
+	}
+	if conf.ExternalMethods {
+		for addr, sym := range idx.a2s {
+			if idx.isFunction(addr) && externalMethodRE.MatchString(sym) {
+				entries = append(entries, callgraph.Entry{
+					Addr:   addr,
+					Name:   sym,
+					Origin: "external method",
+					Args:   []string{"x1", "x2"}, // (this, uint32_t selector, IOExternalMethodArguments *args, ...)
+				})
+			}
+		}
+	}
+	for _, spec := range conf.Entries {
+		entry, err := parseEntry(idx, spec)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no entry points found (use --syscalls, --mach-traps, --mig, --external-methods or --entry)")
+	}
+
+	log.WithField("entry_points", len(entries)).Info("Tracking user controlled inputs")
+	findings := callgraph.Taint(entries, &callgraph.TaintConfig{
+		Function: idx.function,
+		Symbol:   idx.symbol,
+		Stubs:    idx.stubs,
+		MaxDepth: conf.Depth,
+	})
+
+	if conf.JSON {
+		return json.NewEncoder(os.Stdout).Encode(findings)
+	}
+	if len(findings) == 0 {
+		log.Info("No candidate spots found")
+		return nil
+	}
+	var prev string
+	for _, f := range findings {
+		if f.Entry != prev {
+			fmt.Printf("%s %s\n", color.New(color.Bold).Sprint(f.Entry), color.New(color.Faint).Sprintf("(%s)", f.Origin))
+			prev = f.Entry
+		}
+		line := "  " + f.String()
+		if f.Checked {
+			fmt.Println(line)
+		} else {
+			fmt.Println(color.New(color.FgHiYellow).Sprint(line))
+		}
+	}
+	log.WithField("findings", len(findings)).Warn("Candidate spots to review (NOT confirmed bugs)")
+	return nil
+}
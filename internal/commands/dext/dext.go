@@ -0,0 +1,258 @@
+// Package dext finds the DriverKit driver extensions (.dext) and system extensions (.systemextension) of a build
+// and parses their IOKit personalities and entitlements
+package dext
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-plist"
+	ents "github.com/blacktop/ipsw/internal/codesign/entitlements"
+	"github.com/blacktop/ipsw/internal/search"
+)
+
+// Extension kinds
+const (
+	KindDriverKit       = "driverkit"       // DriverKit driver (.dext)
+	KindSystemExtension = "systemextension" // network, endpoint security, etc. system extension
+)
+
+var bundleExts = map[string]string{
+	".dext":            KindDriverKit,
+	".systemextension": KindSystemExtension,
+}
+
+// Bundle returns the (outermost) .dext or .systemextension bundle that contains the path (and its kind)
+func Bundle(name string) (bundle, kind string, ok bool) {
+	name = filepath.ToSlash(name)
+	parts := strings.Split(name, "/")
+	for i, part := range parts[:len(parts)-1] {
+		if kind, ok := bundleExts[path.Ext(part)]; ok {
+			return strings.Join(parts[:i+1], "/"), kind, true
+		}
+	}
+	return "", "", false
+}
+
+// IsBundleFile returns true if the file is the Info.plist or (possibly) the executable of a .dext or .systemextension bundle
+func IsBundleFile(name string) bool {
+	bundle, _, ok := Bundle(name)
+	if !ok {
+		return false
+	}
+	rel := strings.TrimPrefix(filepath.ToSlash(name), bundle+"/")
+	// dexts are flat bundles, system extensions have a Contents folder (like apps)
+	return !strings.Contains(rel, "/") || rel == "Contents/Info.plist" || path.Dir(rel) == "Contents/MacOS"
+}
+
+// Personality is an IOKit matching personality (from the bundle's IOKitPersonalities)
+type Personality struct {
+	Name             string `json:"name"`
+	IOClass          string `json:"io_class,omitempty"`
+	IOUserClass      string `json:"io_user_class,omitempty"` // the DriverKit (user space) class
+	IOProviderClass  string `json:"io_provider_class,omitempty"`
+	IOUserServerName string `json:"io_user_server_name,omitempty"`
+	IOMatchCategory  string `json:"io_match_category,omitempty"`
+}
+
+func (p Personality) String() string {
+	var props []string
+	for _, prop := range []struct{ key, val string }{
+		{"IOClass", p.IOClass},
+		{"IOUserClass", p.IOUserClass},
+		{"IOProviderClass", p.IOProviderClass},
+		{"IOUserServerName", p.IOUserServerName},
+		{"IOMatchCategory", p.IOMatchCategory},
+	} {
+		if prop.val != "" {
+			props = append(props, fmt.Sprintf("%s=%s", prop.key, prop.val))
+		}
+	}
+	return fmt.Sprintf("%s: %s", p.Name, strings.Join(props, " "))
+}
+
+// Extension is a DriverKit driver or system extension bundle
+type Extension struct {
+	Path          string         `json:"path"`
+	Kind          string         `json:"kind"`
+	BundleID      string         `json:"bundle_id,omitempty"`
+	Version       string         `json:"version,omitempty"`
+	Executable    string         `json:"executable,omitempty"` // path of the bundle's main executable
+	Personalities []Personality  `json:"personalities,omitempty"`
+	Entitlements  map[string]any `json:"entitlements,omitempty"`
+}
+
+// Classes returns the (sorted) IOKit class names the extension implements or matches on
+func (e *Extension) Classes() []string {
+	var classes []string
+	for _, p := range e.Personalities {
+		for _, class := range []string{p.IOClass, p.IOUserClass, p.IOProviderClass} {
+			if class != "" && !slices.Contains(classes, class) {
+				classes = append(classes, class)
+			}
+		}
+	}
+	slices.Sort(classes)
+	return classes
+}
+
+type infoPlist struct {
+	CFBundleIdentifier         string                    `plist:"CFBundleIdentifier,omitempty"`
+	CFBundleExecutable         string                    `plist:"CFBundleExecutable,omitempty"`
+	CFBundleShortVersionString string                    `plist:"CFBundleShortVersionString,omitempty"`
+	CFBundleVersion            string                    `plist:"CFBundleVersion,omitempty"`
+	IOKitPersonalities         map[string]map[string]any `plist:"IOKitPersonalities,omitempty"`
+}
+
+func str(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// parseInfo adds the bundle's Info.plist properties to the extension
+func (e *Extension) parseInfo(infoPath string, data []byte) error {
+	var info infoPlist
+	if _, err := plist.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", infoPath, err)
+	}
+	e.BundleID = info.CFBundleIdentifier
+	e.Version = info.CFBundleShortVersionString
+	if e.Version == "" {
+		e.Version = info.CFBundleVersion
+	}
+	if info.CFBundleExecutable != "" {
+		e.Executable = path.Join(path.Dir(infoPath), info.CFBundleExecutable)
+		if path.Base(path.Dir(infoPath)) == "Contents" {
+			e.Executable = path.Join(path.Dir(infoPath), "MacOS", info.CFBundleExecutable)
+		}
+	}
+	for name, props := range info.IOKitPersonalities {
+		e.Personalities = append(e.Personalities, Personality{
+			Name:             name,
+			IOClass:          str(props["IOClass"]),
+			IOUserClass:      str(props["IOUserClass"]),
+			IOProviderClass:  str(props["IOProviderClass"]),
+			IOUserServerName: str(props["IOUserServerName"]),
+			IOMatchCategory:  str(props["IOMatchCategory"]),
+		})
+	}
+	sort.Slice(e.Personalities, func(i, j int) bool { return e.Personalities[i].Name < e.Personalities[j].Name })
+	return nil
+}
+
+func entitlements(data []byte) (map[string]any, error) {
+	var m *macho.File
+	if fat, err := macho.NewFatFile(bytes.NewReader(data)); err == nil {
+		defer fat.Close()
+		m = fat.Arches[len(fat.Arches)-1].File
+	} else if errors.Is(err, macho.ErrNotFat) {
+		if m, err = macho.NewFile(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		defer m.Close()
+	} else {
+		return nil, err
+	}
+	e, err := ents.Parse(m.CodeSignature())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse entitlements: %v", err)
+	}
+	return e, nil
+}
+
+// scanner collects the bundle files and joins them into extensions
+type scanner struct {
+	exts map[string]*Extension
+	exes map[string][]byte // candidate executables (until the Info.plist names the real one)
+}
+
+func newScanner() *scanner {
+	return &scanner{
+		exts: make(map[string]*Extension),
+		exes: make(map[string][]byte),
+	}
+}
+
+func (s *scanner) add(name string, data []byte) {
+	bundle, kind, ok := Bundle(name)
+	if !ok {
+		return
+	}
+	if _, ok := s.exts[bundle]; !ok {
+		s.exts[bundle] = &Extension{Path: bundle, Kind: kind}
+	}
+	if path.Base(name) == "Info.plist" {
+		if err := s.exts[bundle].parseInfo(filepath.ToSlash(name), data); err != nil {
+			log.WithError(err).Debug("skipping bundle Info.plist")
+		}
+		return
+	}
+	s.exes[filepath.ToSlash(name)] = data
+}
+
+func (s *scanner) extensions() []*Extension {
+	var exts []*Extension
+	for _, ext := range s.exts {
+		if data, ok := s.exes[ext.Executable]; ok {
+			ents, err := entitlements(data)
+			if err != nil {
+				log.WithError(err).Debugf("failed to get %s entitlements", ext.Executable)
+			}
+			ext.Entitlements = ents
+		}
+		exts = append(exts, ext)
+	}
+	slices.SortFunc(exts, func(a, b *Extension) int { return strings.Compare(a.Path, b.Path) })
+	return exts
+}
+
+// Scan returns the extensions in the folder (i.e. a mounted or extracted filesystem)
+func Scan(root string) ([]*Extension, error) {
+	s := newScanner()
+	if err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.WithError(err).Debugf("failed to walk %s", p)
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !IsBundleFile(p) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		s.add("/"+filepath.ToSlash(rel), data)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s.extensions(), nil
+}
+
+// ScanIPSW returns the extensions in the IPSW's filesystem DMGs
+func ScanIPSW(ipswPath, pemDB string) ([]*Extension, error) {
+	s := newScanner()
+	if err := search.ForEachFileInIPSW(ipswPath, pemDB, IsBundleFile, func(name string, data []byte) error {
+		s.add(name, data)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s.extensions(), nil
+}
@@ -0,0 +1,90 @@
+package dext
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.apple.DriverKit-AppleUserECM</string>
+	<key>CFBundleExecutable</key>
+	<string>com.apple.DriverKit-AppleUserECM</string>
+	<key>CFBundleVersion</key>
+	<string>1.0</string>
+	<key>IOKitPersonalities</key>
+	<dict>
+		<key>AppleUserECM</key>
+		<dict>
+			<key>IOClass</key>
+			<string>IOUserService</string>
+			<key>IOUserClass</key>
+			<string>AppleUserECM</string>
+			<key>IOProviderClass</key>
+			<string>IOUSBHostInterface</string>
+			<key>IOUserServerName</key>
+			<string>com.apple.driverkit.AppleUserECM</string>
+		</dict>
+	</dict>
+</dict>
+</plist>`
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	bundle := filepath.Join(root, "System", "Library", "DriverExtensions", "com.apple.DriverKit-AppleUserECM.dext")
+	if err := os.MkdirAll(filepath.Join(bundle, "_CodeSignature"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"Info.plist":                       testInfoPlist,
+		"com.apple.DriverKit-AppleUserECM": "not a MachO",
+		"_CodeSignature/CodeResources":     "ignored",
+	} {
+		if err := os.WriteFile(filepath.Join(bundle, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exts, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 1 {
+		t.Fatalf("Scan() found %d extensions, expected 1", len(exts))
+	}
+	ext := exts[0]
+	if ext.Kind != KindDriverKit || ext.BundleID != "com.apple.DriverKit-AppleUserECM" || ext.Version != "1.0" {
+		t.Errorf("Scan() = %+v", ext)
+	}
+	if ext.Executable != "/System/Library/DriverExtensions/com.apple.DriverKit-AppleUserECM.dext/com.apple.DriverKit-AppleUserECM" {
+		t.Errorf("Executable = %s", ext.Executable)
+	}
+	if got := ext.Classes(); !slices.Equal(got, []string{"AppleUserECM", "IOUSBHostInterface", "IOUserService"}) {
+		t.Errorf("Classes() = %v", got)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	tests := []struct {
+		name   string
+		bundle string
+		kind   string
+	}{
+		{"/System/Library/DriverExtensions/Foo.dext/Foo", "/System/Library/DriverExtensions/Foo.dext", KindDriverKit},
+		{"/Applications/App.app/Contents/Library/SystemExtensions/com.foo.ext.systemextension/Contents/MacOS/ext", "/Applications/App.app/Contents/Library/SystemExtensions/com.foo.ext.systemextension", KindSystemExtension},
+		{"/usr/libexec/amfid", "", ""},
+	}
+	for _, tt := range tests {
+		if bundle, kind, _ := Bundle(tt.name); bundle != tt.bundle || kind != tt.kind {
+			t.Errorf("Bundle(%s) = %s, %s", tt.name, bundle, kind)
+		}
+	}
+	if IsBundleFile("/System/Library/DriverExtensions/Foo.dext/_CodeSignature/CodeResources") {
+		t.Error("IsBundleFile() should ignore the _CodeSignature folder")
+	}
+}
@@ -3,6 +3,7 @@ package dsc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -634,9 +635,15 @@ func GetStrings(f *dyld.File, in ...string) ([]String, error) {
 	return strs, nil
 }
 
+// GetStringsRegex returns all the strings in a dyld_shared_cache file that match a regex pattern
+//
+// NOTE: images are searched in parallel; images that fail are skipped and returned as a dyld.ImageErrors along with the other matches
 func GetStringsRegex(f *dyld.File, pattern string) ([]String, error) {
-	var strs []String
+	return GetStringsRegexContext(context.Background(), f, pattern, 0)
+}
 
+// GetStringsRegexContext is like GetStringsRegex but uses the given number of workers and stops once the context is done
+func GetStringsRegexContext(ctx context.Context, f *dyld.File, pattern string, workers int) ([]String, error) {
 	if len(pattern) == 0 {
 		return nil, fmt.Errorf("'pattern' cannot be empty")
 	}
@@ -646,84 +653,102 @@ func GetStringsRegex(f *dyld.File, pattern string) ([]String, error) {
 		return nil, fmt.Errorf("invalid regex: %w", err)
 	}
 
-	for _, i := range f.Images {
-		m, err := i.GetMacho()
+	results := make([][]String, len(f.Images)) // keep the matches in image order
+	err = f.ForEachImage(ctx, workers, func(ctx context.Context, idx int, i *dyld.CacheImage) error {
+		strs, err := getImageStringsRegex(f, i, strRE)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create MachO for image %s: %v", i.Name, err)
+			return err
 		}
+		results[idx] = strs
+		return nil
+	})
 
-		// cstrings
-		for _, sec := range m.Sections {
-			if sec.Flags.IsCstringLiterals() || sec.Seg == "__TEXT" && sec.Name == "__const" {
-				uuid, off, err := f.GetOffset(sec.Addr)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get offset for %s.%s: %v", sec.Seg, sec.Name, err)
-				}
-				dat, err := f.ReadBytesForUUID(uuid, int64(off), sec.Size)
-				if err != nil {
-					return nil, fmt.Errorf("failed to read cstrings in %s.%s: %v", sec.Seg, sec.Name, err)
-				}
+	var strs []String
+	for _, r := range results {
+		strs = append(strs, r...)
+	}
+	return strs, err
+}
 
-				csr := bytes.NewBuffer(dat)
+func getImageStringsRegex(f *dyld.File, i *dyld.CacheImage, strRE *regexp.Regexp) ([]String, error) {
+	var strs []String
 
-				for {
-					pos := sec.Addr + uint64(csr.Cap()-csr.Len())
+	m, err := i.GetMacho()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MachO for image %s: %v", i.Name, err)
+	}
 
-					s, err := csr.ReadString('\x00')
+	// cstrings
+	for _, sec := range m.Sections {
+		if sec.Flags.IsCstringLiterals() || sec.Seg == "__TEXT" && sec.Name == "__const" {
+			uuid, off, err := f.GetOffset(sec.Addr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get offset for %s.%s: %v", sec.Seg, sec.Name, err)
+			}
+			dat, err := f.ReadBytesForUUID(uuid, int64(off), sec.Size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read cstrings in %s.%s: %v", sec.Seg, sec.Name, err)
+			}
 
-					if err == io.EOF {
-						break
-					}
+			csr := bytes.NewBuffer(dat)
 
-					if err != nil {
-						return nil, fmt.Errorf("failed to read string: %v", err)
-					}
+			for {
+				pos := sec.Addr + uint64(csr.Cap()-csr.Len())
 
-					s = strings.Trim(s, "\x00")
+				s, err := csr.ReadString('\x00')
 
-					if len(s) > 0 {
-						if (sec.Seg == "__TEXT" && sec.Name == "__const") && !utils.IsASCII(s) {
-							continue // skip non-ascii strings when dumping __TEXT.__const
-						}
-						if strRE.MatchString(s) {
-							strs = append(strs, String{
-								Address: pos,
-								Image:   filepath.Base(i.Name),
-								String:  s,
-							})
-						}
-					}
+				if err == io.EOF {
+					break
 				}
-			}
-		}
 
-		// objc cfstrings
-		if cfstrs, err := m.GetCFStrings(); err == nil {
-			if len(cfstrs) > 0 {
-				for _, cfstr := range cfstrs {
-					if strRE.MatchString(cfstr.Name) {
+				if err != nil {
+					return nil, fmt.Errorf("failed to read string: %v", err)
+				}
+
+				s = strings.Trim(s, "\x00")
+
+				if len(s) > 0 {
+					if (sec.Seg == "__TEXT" && sec.Name == "__const") && !utils.IsASCII(s) {
+						continue // skip non-ascii strings when dumping __TEXT.__const
+					}
+					if strRE.MatchString(s) {
 						strs = append(strs, String{
-							Address: cfstr.Address,
+							Address: pos,
 							Image:   filepath.Base(i.Name),
-							String:  cfstr.Name,
+							String:  s,
 						})
 					}
 				}
 			}
 		}
+	}
 
-		// swift small string literals
-		if info, err := m.GetObjCImageInfo(); err == nil {
-			if info != nil && info.HasSwift() {
-				if ss, err := mcmd.FindSwiftStrings(m); err == nil {
-					for addr, s := range ss {
-						if strRE.MatchString(s) {
-							strs = append(strs, String{
-								Address: addr,
-								Image:   filepath.Base(i.Name),
-								String:  s,
-							})
-						}
+	// objc cfstrings
+	if cfstrs, err := m.GetCFStrings(); err == nil {
+		if len(cfstrs) > 0 {
+			for _, cfstr := range cfstrs {
+				if strRE.MatchString(cfstr.Name) {
+					strs = append(strs, String{
+						Address: cfstr.Address,
+						Image:   filepath.Base(i.Name),
+						String:  cfstr.Name,
+					})
+				}
+			}
+		}
+	}
+
+	// swift small string literals
+	if info, err := m.GetObjCImageInfo(); err == nil {
+		if info != nil && info.HasSwift() {
+			if ss, err := mcmd.FindSwiftStrings(m); err == nil {
+				for addr, s := range ss {
+					if strRE.MatchString(s) {
+						strs = append(strs, String{
+							Address: addr,
+							Image:   filepath.Base(i.Name),
+							String:  s,
+						})
 					}
 				}
 			}
@@ -781,21 +806,29 @@ func OpenFromIPSW(ipswPath, pemDB string, driverKit, all bool) (*mount.Context,
 
 	dscs, err := dyld.GetDscPathsInMount(ctx.MountPoint, driverKit, all)
 	if err != nil {
+		ctx.Unmount()
 		return nil, nil, fmt.Errorf("failed to get DSC paths in %s: %v", ctx.MountPoint, err)
 	}
 	if len(dscs) == 0 {
+		ctx.Unmount()
 		return nil, nil, fmt.Errorf("no DSCs found in IPSW mount %s", ctx.MountPoint)
 	}
 
 	var fs []*dyld.File
 	for _, dsc := range dscs {
-		if len(filepath.Ext(dsc)) == 0 {
-			f, err := dyld.Open(dsc)
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to open DSC: %v", err)
+		// NOTE: the subcaches (and .symbols, .map and .atlas files) are opened/skipped via their main cache
+		if len(filepath.Ext(dsc)) > 0 {
+			continue
+		}
+		f, err := dyld.Open(dsc)
+		if err != nil {
+			for _, f := range fs {
+				f.Close()
 			}
-			fs = append(fs, f)
+			ctx.Unmount()
+			return nil, nil, fmt.Errorf("failed to open DSC %s: %v", dsc, err)
 		}
+		fs = append(fs, f)
 	}
 
 	return ctx, fs, nil
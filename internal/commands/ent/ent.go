@@ -7,7 +7,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -17,6 +19,7 @@ import (
 	"github.com/alecthomas/chroma/v2/quick"
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/codesign/entitlements"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/aea"
 	"github.com/blacktop/ipsw/pkg/info"
@@ -42,9 +45,31 @@ type Config struct {
 	Port    int
 }
 
+// Database is an entitlement database
+type Database struct {
+	Entitlements map[string]string // the entitlements plist of each MachO (empty if it has none)
+	Constraints  map[string]string // the launch/library constraints plist of each MachO that has any
+}
+
+func newDatabase() *Database {
+	return &Database{
+		Entitlements: make(map[string]string),
+		Constraints:  make(map[string]string),
+	}
+}
+
 // GetDatabase returns the entitlement database for the given IPSW
 func GetDatabase(conf *Config) (map[string]string, error) {
-	entDB := make(map[string]string)
+	db, err := OpenDatabase(conf)
+	if err != nil {
+		return nil, err
+	}
+	return db.Entitlements, nil
+}
+
+// OpenDatabase returns the entitlement (and launch constraints) database for the given IPSW
+func OpenDatabase(conf *Config) (*Database, error) {
+	db := newDatabase()
 
 	// create or load entitlement database
 	if _, err := os.Stat(conf.Database); os.IsNotExist(err) {
@@ -60,9 +85,7 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 				if ents, err := scanEnts(conf.IPSW, appOS, "AppOS", conf.PemDB); err != nil {
 					return nil, fmt.Errorf("failed to scan files in AppOS %s: %v", appOS, err)
 				} else {
-					for k, v := range ents {
-						entDB[k] = v
-					}
+					db.merge(ents)
 				}
 			}
 			if systemOS, err := i.GetSystemOsDmg(); err == nil {
@@ -70,9 +93,7 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 				if ents, err := scanEnts(conf.IPSW, systemOS, "SystemOS", conf.PemDB); err != nil {
 					return nil, fmt.Errorf("failed to scan files in SystemOS %s: %v", systemOS, err)
 				} else {
-					for k, v := range ents {
-						entDB[k] = v
-					}
+					db.merge(ents)
 				}
 			}
 			if fsOS, err := i.GetFileSystemOsDmg(); err == nil {
@@ -80,9 +101,7 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 				if ents, err := scanEnts(conf.IPSW, fsOS, "filesystem", conf.PemDB); err != nil {
 					return nil, fmt.Errorf("failed to scan files in filesystem %s: %v", fsOS, err)
 				} else {
-					for k, v := range ents {
-						entDB[k] = v
-					}
+					db.merge(ents)
 				}
 			}
 			if excOS, err := i.GetExclaveOSDmg(); err == nil {
@@ -90,9 +109,7 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 				if ents, err := scanEnts(conf.IPSW, excOS, "ExclaveOS", conf.PemDB); err != nil {
 					return nil, fmt.Errorf("failed to scan files in ExclaveOS %s: %v", excOS, err)
 				} else {
-					for k, v := range ents {
-						entDB[k] = v
-					}
+					db.merge(ents)
 				}
 			}
 		}
@@ -113,26 +130,7 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 			}
 
 			for _, file := range files {
-				var m *macho.File
-				fat, err := macho.OpenFat(file)
-				if err == nil {
-					m = fat.Arches[len(fat.Arches)-1].File // grab last arch (probably arm64e)
-				} else {
-					if err == macho.ErrNotFat {
-						m, err = macho.Open(file)
-						if err != nil {
-							log.WithError(err).Warnf("failed to get entitlements for %s", file)
-							continue // bad macho file (skip)
-						}
-					} else {
-						continue // not a macho file (skip)
-					}
-				}
-				if m.CodeSignature() != nil && len(m.CodeSignature().Entitlements) > 0 {
-					entDB[strings.TrimPrefix(file, conf.Folder)] = m.CodeSignature().Entitlements
-				} else {
-					entDB[strings.TrimPrefix(file, conf.Folder)] = ""
-				}
+				db.add(strings.TrimPrefix(file, conf.Folder), file)
 			}
 		}
 
@@ -141,11 +139,13 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 
 			e := gob.NewEncoder(buff)
 
-			// Encoding the map
-			err := e.Encode(entDB)
-			if err != nil {
+			// Encoding the maps (the constraints come second so older databases without them still decode)
+			if err := e.Encode(db.Entitlements); err != nil {
 				return nil, fmt.Errorf("failed to encode entitlement db to binary: %v", err)
 			}
+			if err := e.Encode(db.Constraints); err != nil {
+				return nil, fmt.Errorf("failed to encode launch constraints db to binary: %v", err)
+			}
 
 			of, err := os.Create(conf.Database)
 			if err != nil {
@@ -176,12 +176,16 @@ func GetDatabase(conf *Config) (map[string]string, error) {
 		defer gzr.Close()
 
 		// Decoding the serialized data
-		if err := gob.NewDecoder(gzr).Decode(&entDB); err != nil {
+		dec := gob.NewDecoder(gzr)
+		if err := dec.Decode(&db.Entitlements); err != nil {
 			return nil, fmt.Errorf("failed to decode entitlement database; %v", err)
 		}
+		if err := dec.Decode(&db.Constraints); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to decode launch constraints database; %v", err)
+		}
 	}
 
-	return entDB, nil
+	return db, nil
 }
 
 // DiffDatabases compares two entitlement databases and returns a diff
@@ -259,7 +263,7 @@ func DiffDatabases(db1, db2 map[string]string, conf *Config) (string, error) {
 	return dat.String(), nil
 }
 
-func scanEnts(ipswPath, dmgPath, dmgType, pemDbPath string) (map[string]string, error) {
+func scanEnts(ipswPath, dmgPath, dmgType, pemDbPath string) (*Database, error) {
 	// check if filesystem DMG already exists (due to previous mount command)
 	if _, err := os.Stat(dmgPath); os.IsNotExist(err) {
 		dmgs, err := utils.Unzip(ipswPath, "", func(f *zip.File) bool {
@@ -321,30 +325,53 @@ func scanEnts(ipswPath, dmgPath, dmgType, pemDbPath string) (map[string]string,
 		return nil, fmt.Errorf("failed to walk files in dir %s: %v", mountPoint, err)
 	}
 
-	entDB := make(map[string]string)
-
+	db := newDatabase()
 	for _, file := range files {
-		var m *macho.File
-		fat, err := macho.OpenFat(file)
-		if err == nil {
-			m = fat.Arches[len(fat.Arches)-1].File // grab last arch (probably arm64e)
-		} else {
-			if err == macho.ErrNotFat {
-				m, err = macho.Open(file)
-				if err != nil {
-					log.WithError(err).Warnf("failed to get entitlements for %s", file)
-					continue // bad macho file (skip)
-				}
-			} else {
-				continue // not a macho file (skip)
+		db.add(strings.TrimPrefix(file, mountPoint), file)
+	}
+
+	return db, nil
+}
+
+// add adds the entitlements (and launch constraints) of the MachO file to the database
+func (db *Database) add(name, file string) {
+	var m *macho.File
+	fat, err := macho.OpenFat(file)
+	if err == nil {
+		defer fat.Close()
+		m = fat.Arches[len(fat.Arches)-1].File // grab last arch (probably arm64e)
+	} else {
+		if err == macho.ErrNotFat {
+			m, err = macho.Open(file)
+			if err != nil {
+				log.WithError(err).Warnf("failed to get entitlements for %s", file)
+				return // bad macho file (skip)
 			}
-		}
-		if m.CodeSignature() != nil && len(m.CodeSignature().Entitlements) > 0 {
-			entDB[strings.TrimPrefix(file, mountPoint)] = m.CodeSignature().Entitlements
+			defer m.Close()
 		} else {
-			entDB[strings.TrimPrefix(file, mountPoint)] = ""
+			return // not a macho file (skip)
 		}
 	}
+	// many binaries only have DER encoded entitlements
+	ent, err := entitlements.Plist(m.CodeSignature())
+	if err != nil {
+		log.WithError(err).Warnf("failed to parse entitlements for %s", file)
+	}
+	db.Entitlements[name] = ent
+	lcs, err := entitlements.ConstraintsPlist(m.CodeSignature())
+	if err != nil {
+		log.WithError(err).Warnf("failed to parse launch constraints for %s", file)
+	}
+	if len(lcs) > 0 {
+		db.Constraints[name] = lcs
+	}
+}
 
-	return entDB, nil
+func (db *Database) merge(other *Database) {
+	for k, v := range other.Entitlements {
+		db.Entitlements[k] = v
+	}
+	for k, v := range other.Constraints {
+		db.Constraints[k] = v
+	}
 }
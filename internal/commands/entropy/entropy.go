@@ -0,0 +1,275 @@
+// Package entropy calculates per-section/per-block byte statistics of MachOs and firmware blobs
+// and flags the regions that look encrypted, compressed or packed
+package entropy
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// Verdicts
+const (
+	Encrypted  = "encrypted"  // (FairPlay) encrypted or indistinguishable from random
+	Compressed = "compressed" // known compression container or high entropy with some structure
+	Packed     = "packed"     // code with data-like entropy (packed, obfuscated or encrypted)
+	Sparse     = "sparse"     // mostly zeros (padding)
+)
+
+const (
+	// Shannon entropy (bits per byte) thresholds
+	compressedEntropy = 7.5
+	// ARM64 code is usually between 5.5-6.5 bits per byte
+	packedCodeEntropy = 7.2
+	// chi-square of uniformly random data (255 degrees of freedom) is 255±23; anything above
+	// this (~6σ) is very unlikely to be random even if its entropy is high
+	randomChiSquare = 400
+	sparseZeroRatio = 0.9
+	// regions smaller than this don't have enough bytes for meaningful statistics
+	minStatsSize = 256
+)
+
+// known compression container signatures (at the start of a region)
+var signatures = []struct {
+	name  string
+	magic []byte
+}{
+	{"lzfse", []byte("bvx2")},
+	{"lzfse", []byte("bvx-")},
+	{"lzvn", []byte("bvxn")},
+	{"lzss", []byte("complzss")},
+	{"pbzx", []byte("pbzx")},
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zip", []byte{'P', 'K', 0x03, 0x04}},
+	{"zlib", []byte{0x78, 0x9c}},
+	{"zlib", []byte{0x78, 0xda}},
+	{"yaa", []byte("YAA1")},
+	{"aea", []byte("AEA1")},
+}
+
+// Stats are the byte statistics of a region (section, segment or block)
+type Stats struct {
+	Name      string  `json:"name"`
+	Offset    uint64  `json:"offset"`
+	Size      uint64  `json:"size"`
+	Entropy   float64 `json:"entropy"`    // Shannon entropy in bits per byte (0-8)
+	ChiSquare float64 `json:"chi_square"` // vs. a uniform byte distribution
+	Zeros     float64 `json:"zeros"`      // ratio of 0x00 bytes
+	Printable float64 `json:"printable"`  // ratio of printable ASCII bytes
+	Verdict   string  `json:"verdict,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+	code      bool
+}
+
+func (s Stats) String() string {
+	verdict := ""
+	if s.Verdict != "" {
+		verdict = fmt.Sprintf("  %s (%s)", strings.ToUpper(s.Verdict), s.Reason)
+	}
+	return fmt.Sprintf("%#09x-%#09x %-32s entropy=%.3f chi²=%-10.1f zeros=%5.1f%% ascii=%5.1f%%%s",
+		s.Offset, s.Offset+s.Size, s.Name, s.Entropy, s.ChiSquare, s.Zeros*100, s.Printable*100, verdict)
+}
+
+type histogram [256]uint64
+
+func (h *histogram) add(data []byte) {
+	for _, b := range data {
+		h[b]++
+	}
+}
+
+func (h *histogram) stats() Stats {
+	var s Stats
+	for _, count := range h {
+		s.Size += count
+	}
+	if s.Size == 0 {
+		return s
+	}
+	n := float64(s.Size)
+	expected := n / 256
+	var printable uint64
+	for i, count := range h {
+		if count > 0 {
+			p := float64(count) / n
+			s.Entropy -= p * math.Log2(p)
+		}
+		d := float64(count) - expected
+		s.ChiSquare += d * d / expected
+		if (i >= 0x20 && i < 0x7f) || i == '\n' || i == '\r' || i == '\t' {
+			printable += count
+		}
+	}
+	s.Zeros = float64(h[0]) / n
+	s.Printable = float64(printable) / n
+	return s
+}
+
+// Calculate returns the byte statistics of the data
+func Calculate(data []byte) Stats {
+	var h histogram
+	h.add(data)
+	return h.stats()
+}
+
+func signature(data []byte) string {
+	for _, sig := range signatures {
+		if bytes.HasPrefix(data, sig.magic) {
+			return sig.name
+		}
+	}
+	if idx := bytes.Index(data[:min(len(data), 16)], []byte("IM4P")); idx >= 0 {
+		return "im4p"
+	}
+	return ""
+}
+
+// classify sets the verdict of the region from its statistics (and the signature of its data)
+func (s *Stats) classify(data []byte) {
+	switch {
+	case s.Size < minStatsSize:
+		return
+	case s.Zeros >= sparseZeroRatio:
+		s.Verdict, s.Reason = Sparse, fmt.Sprintf("%.0f%% zeros", s.Zeros*100)
+	case signature(data) != "" && s.Entropy >= compressedEntropy-1:
+		s.Verdict, s.Reason = Compressed, signature(data)+" header"
+	case s.Entropy >= compressedEntropy && s.ChiSquare < randomChiSquare:
+		s.Verdict, s.Reason = Encrypted, "uniform byte distribution"
+	case s.code && s.Entropy >= packedCodeEntropy:
+		s.Verdict, s.Reason = Packed, "code entropy is too high"
+	case s.Entropy >= compressedEntropy:
+		s.Verdict, s.Reason = Compressed, "high entropy"
+	}
+}
+
+// Report are the region statistics of a file
+type Report struct {
+	Name    string  `json:"name"`
+	Size    uint64  `json:"size"`
+	Entropy float64 `json:"entropy"`
+	// FairPlay encrypted range (LC_ENCRYPTION_INFO cryptid != 0)
+	CryptOff  uint64  `json:"cryptoff,omitempty"`
+	CryptSize uint64  `json:"cryptsize,omitempty"`
+	Regions   []Stats `json:"regions"`
+}
+
+// Flagged returns the regions that look encrypted, compressed or packed
+func (r *Report) Flagged() []Stats {
+	var flagged []Stats
+	for _, s := range r.Regions {
+		switch s.Verdict {
+		case Encrypted, Compressed, Packed:
+			flagged = append(flagged, s)
+		}
+	}
+	return flagged
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (entropy=%.3f)\n", r.Name, r.Entropy)
+	if r.CryptSize > 0 {
+		fmt.Fprintf(&sb, "  FairPlay encrypted: %#x-%#x (needs decryption)\n", r.CryptOff, r.CryptOff+r.CryptSize)
+	}
+	for _, s := range r.Regions {
+		fmt.Fprintf(&sb, "  %s\n", s)
+	}
+	return sb.String()
+}
+
+func isCode(sec *types.Section) bool {
+	return sec.Flags.IsPureInstructions() || sec.Flags.IsSomeInstructions()
+}
+
+// MachO returns the per-section statistics of a MachO
+func MachO(m *macho.File, name string) (*Report, error) {
+	r := &Report{Name: name}
+	for _, l := range m.Loads {
+		switch enc := l.(type) {
+		case *macho.EncryptionInfo:
+			if enc.CryptID != 0 {
+				r.CryptOff, r.CryptSize = uint64(enc.Offset), uint64(enc.Size)
+			}
+		case *macho.EncryptionInfo64:
+			if enc.CryptID != 0 {
+				r.CryptOff, r.CryptSize = uint64(enc.Offset), uint64(enc.Size)
+			}
+		}
+	}
+
+	var all histogram
+	for _, sec := range m.Sections {
+		if sec.Size == 0 || sec.Offset == 0 || sec.Flags.IsZerofill() || sec.Flags.IsThreadLocalZerofill() {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+		}
+		s := Calculate(data)
+		s.Name = fmt.Sprintf("%s.%s", sec.Seg, sec.Name)
+		s.Offset = uint64(sec.Offset)
+		s.code = isCode(sec)
+		s.classify(data)
+		if r.CryptSize > 0 && s.Offset < r.CryptOff+r.CryptSize && r.CryptOff < s.Offset+s.Size {
+			s.Verdict, s.Reason = Encrypted, "in LC_ENCRYPTION_INFO range"
+		}
+		r.Regions = append(r.Regions, s)
+		r.Size += s.Size
+		all.add(data)
+	}
+	r.Entropy = all.stats().Entropy
+
+	return r, nil
+}
+
+// sameRegion returns true if the block continues the region (a compressed container header always starts a new one)
+func sameRegion(region, block Stats) bool {
+	if strings.HasSuffix(block.Reason, " header") {
+		return false
+	}
+	return region.Verdict == block.Verdict
+}
+
+// Blob returns the per-block statistics of a (firmware) blob
+// (adjacent blocks with the same verdict are merged into one region; NOTE: small blocks
+// don't have enough bytes to reliably tell compressed and encrypted data apart)
+func Blob(data []byte, name string, blockSize int) *Report {
+	r := &Report{
+		Name:    name,
+		Size:    uint64(len(data)),
+		Entropy: Calculate(data).Entropy,
+	}
+	if blockSize <= 0 {
+		blockSize = len(data)
+	}
+	var region histogram
+	for off := 0; off < len(data); off += blockSize {
+		block := data[off:min(off+blockSize, len(data))]
+		var h histogram
+		h.add(block)
+		s := h.stats()
+		s.Offset = uint64(off)
+		s.classify(block)
+		if n := len(r.Regions); n > 0 && sameRegion(r.Regions[n-1], s) {
+			// extend the previous region
+			prev := &r.Regions[n-1]
+			for i, count := range h {
+				region[i] += count
+			}
+			merged := region.stats()
+			merged.Name, merged.Offset, merged.Verdict, merged.Reason = prev.Name, prev.Offset, prev.Verdict, prev.Reason
+			*prev = merged
+			continue
+		}
+		region = h
+		s.Name = fmt.Sprintf("region %d", len(r.Regions))
+		r.Regions = append(r.Regions, s)
+	}
+	return r
+}
@@ -0,0 +1,31 @@
+package entropy
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBlob(t *testing.T) {
+	random := make([]byte, 0x20000)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 0x20000/44+1)[:0x20000]
+	data := append(append(make([]byte, 0x20000), random...), text...)
+
+	if s := Calculate(random); s.Entropy < 7.99 || s.ChiSquare > randomChiSquare {
+		t.Errorf("random stats = %+v", s)
+	}
+
+	r := Blob(data, "test", 0x8000)
+	if len(r.Regions) != 3 {
+		t.Fatalf("regions = %v", r.Regions)
+	}
+	for i, want := range []string{Sparse, Encrypted, ""} {
+		if got := r.Regions[i]; got.Verdict != want || got.Offset != uint64(i*0x20000) || got.Size != 0x20000 {
+			t.Errorf("region %d = %v; want %q", i, got, want)
+		}
+	}
+	if flagged := r.Flagged(); len(flagged) != 1 || flagged[0].Verdict != Encrypted {
+		t.Errorf("flagged = %v", flagged)
+	}
+}
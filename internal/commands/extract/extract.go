@@ -594,15 +594,16 @@ func FcsKeys(c *Config) ([]string, error) {
 		return nil, fmt.Errorf("fcs-keys are only found in AEA1 DMGs: found '%s'", filepath.Base(dmgPath))
 	}
 
-	out, err := utils.SearchPartialZip(zr.File, regexp.MustCompile(dmgPath+`$`), os.TempDir(), 0x1000, false, false)
+	tmpDIR, err := os.MkdirTemp("", "ipsw_extract_fcs_keys")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDIR)
+
+	out, err := utils.SearchPartialZip(zr.File, regexp.MustCompile(dmgPath+`$`), tmpDIR, 0x1000, false, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract fcs-keys from DMG: %v", err)
 	}
-	defer func() {
-		for _, f := range out {
-			os.Remove(f)
-		}
-	}()
 
 	for _, f := range out {
 		metadata, err := aea.Info(filepath.Clean(f))
@@ -748,7 +749,13 @@ func LaunchdConfig(path, pemDB string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to get filesystem DMG path: %v", err)
 	}
-	extracted, err := utils.ExtractFromDMG(ipswPath, fsDMG, os.TempDir(), pemDB, regexp.MustCompile(`.*/sbin/launchd$`))
+	tmpDIR, err := os.MkdirTemp("", "ipsw_extract_launchd")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDIR)
+
+	extracted, err := utils.ExtractFromDMG(ipswPath, fsDMG, tmpDIR, pemDB, regexp.MustCompile(`.*/sbin/launchd$`))
 	if err != nil {
 		return "", fmt.Errorf("failed to extract launchd from %s: %v", fsDMG, err)
 	}
@@ -758,7 +765,6 @@ func LaunchdConfig(path, pemDB string) (string, error) {
 	} else if len(extracted) > 1 {
 		return "", fmt.Errorf("failed to extract launchd from %s: too many files extracted", fsDMG)
 	}
-	defer os.Remove(filepath.Clean(extracted[0]))
 
 	var m *macho.File
 	fat, err := macho.OpenFat(filepath.Clean(extracted[0]))
@@ -796,7 +802,13 @@ func SystemVersion(path, pemDB string) (*plist.SystemVersion, error) {
 		return nil, fmt.Errorf("failed to get filesystem DMG path: %v", err)
 	}
 
-	extracted, err := utils.ExtractFromDMG(ipswPath, fsDMG, os.TempDir(), pemDB, regexp.MustCompile(`System/Library/CoreServices/SystemVersion.plist$`))
+	tmpDIR, err := os.MkdirTemp("", "ipsw_extract_system_version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDIR)
+
+	extracted, err := utils.ExtractFromDMG(ipswPath, fsDMG, tmpDIR, pemDB, regexp.MustCompile(`System/Library/CoreServices/SystemVersion.plist$`))
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract launchd from %s: %v", fsDMG, err)
 	}
@@ -806,7 +818,6 @@ func SystemVersion(path, pemDB string) (*plist.SystemVersion, error) {
 	} else if len(extracted) > 1 {
 		return nil, fmt.Errorf("failed to extract SystemVersion.plist from %s: too many files extracted", fsDMG)
 	}
-	defer os.Remove(filepath.Clean(extracted[0]))
 
 	dat, err := os.ReadFile(extracted[0])
 	if err != nil {
@@ -86,12 +86,26 @@ func ExtractPayload(in, out string, isImg4 bool) error {
 		if err != nil {
 			return fmt.Errorf("failed to parse IMG4: %s", err)
 		}
+		if im4p, err := img4.ParseIm4p(bytes.NewReader(i.IM4P.Raw)); err == nil {
+			if encErr := im4p.CheckEncrypted(filepath.Base(in)); encErr != nil {
+				if _, err := f.Seek(0, io.SeekStart); err == nil {
+					if i4, err := img4.Parse(f); err == nil { // add the personalized chip/board
+						encErr.(*img4.EncryptedError).Chip, _ = i4.Manifest.Properties["CHIP"].(int)
+						encErr.(*img4.EncryptedError).Board, _ = i4.Manifest.Properties["BORD"].(int)
+					}
+				}
+				return encErr
+			}
+		}
 		dat = i.IM4P.Data
 	} else {
 		i, err := img4.ParseIm4p(f)
 		if err != nil {
 			return fmt.Errorf("failed to parse IM4P: %s", err)
 		}
+		if err := i.CheckEncrypted(filepath.Base(in)); err != nil {
+			return err
+		}
 		dat = i.Data
 	}
 
@@ -0,0 +1,218 @@
+// Package ipa contains functions to find and replace the FairPlay encrypted MachOs in App Store .ipa files
+package ipa
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/magic"
+)
+
+// Binary is an encrypted MachO in an .ipa
+type Binary struct {
+	// path in the .ipa (i.e. Payload/App.app/Frameworks/Foo.framework/Foo)
+	Path string `json:"path"`
+	// path relative to the .app bundle (i.e. Frameworks/Foo.framework/Foo)
+	BundlePath string `json:"bundle_path"`
+	CryptID    uint32 `json:"cryptid"`
+	CryptOff   uint32 `json:"cryptoff"`
+	CryptSize  uint32 `json:"cryptsize"`
+}
+
+// Info is the main app bundle info and encrypted MachOs of an .ipa
+type Info struct {
+	Bundle     string   `json:"bundle"` // i.e. Payload/App.app
+	BundleID   string   `json:"bundle_id"`
+	Executable string   `json:"executable"`
+	Version    string   `json:"version"`
+	Encrypted  []Binary `json:"encrypted"`
+}
+
+type bundleInfo struct {
+	BundleID         string `plist:"CFBundleIdentifier,omitempty"`
+	BundleExecutable string `plist:"CFBundleExecutable,omitempty"`
+	ShortVersion     string `plist:"CFBundleShortVersionString,omitempty"`
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// encryptionInfo returns the (first encrypted) LC_ENCRYPTION_INFO of the MachO (or any of the fat MachO's slices)
+func encryptionInfo(r io.ReaderAt) (cryptid, off, size uint32, err error) {
+	var files []*macho.File
+	if fat, err := macho.NewFatFile(r); err == nil {
+		defer fat.Close()
+		for _, arch := range fat.Arches {
+			files = append(files, arch.File)
+		}
+	} else if errors.Is(err, macho.ErrNotFat) {
+		m, err := macho.NewFile(r)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		defer m.Close()
+		files = append(files, m)
+	} else {
+		return 0, 0, 0, err
+	}
+	for _, m := range files {
+		for _, l := range m.Loads {
+			switch enc := l.(type) {
+			case *macho.EncryptionInfo:
+				if enc.CryptID != 0 {
+					return uint32(enc.CryptID), enc.Offset, enc.Size, nil
+				}
+			case *macho.EncryptionInfo64:
+				if enc.CryptID != 0 {
+					return uint32(enc.CryptID), enc.Offset, enc.Size, nil
+				}
+			}
+		}
+	}
+	return 0, 0, 0, nil
+}
+
+// IsEncrypted returns true if the MachO file is still FairPlay encrypted (cryptid != 0)
+func IsEncrypted(machoPath string) (bool, error) {
+	f, err := os.Open(machoPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	cryptid, _, _, err := encryptionInfo(f)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse MachO %s: %v", machoPath, err)
+	}
+	return cryptid != 0, nil
+}
+
+// Parse returns the .ipa's main app bundle info and the encrypted MachOs in it
+func Parse(ipaPath string) (*Info, error) {
+	zr, err := zip.OpenReader(ipaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ipa %s: %v", ipaPath, err)
+	}
+	defer zr.Close()
+
+	var inf Info
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.HasPrefix(f.Name, "Payload/") {
+			continue
+		}
+		if parts := strings.Split(f.Name, "/"); len(parts) == 3 && strings.HasSuffix(parts[1], ".app") && parts[2] == "Info.plist" {
+			data, err := readZipFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+			}
+			var binfo bundleInfo
+			if _, err := plist.Unmarshal(data, &binfo); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", f.Name, err)
+			}
+			inf.Bundle = path.Dir(f.Name)
+			inf.BundleID = binfo.BundleID
+			inf.Executable = binfo.BundleExecutable
+			inf.Version = binfo.ShortVersion
+			continue
+		}
+		if f.UncompressedSize64 < 4096 { // too small to be an encrypted MachO
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", f.Name, err)
+		}
+		head := make([]byte, 4)
+		_, err = io.ReadFull(rc, head)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		if ok, _ := magic.IsMachOData(head); !ok {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+		}
+		cryptid, off, size, err := encryptionInfo(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse MachO %s: %v", f.Name, err)
+		}
+		if cryptid != 0 {
+			inf.Encrypted = append(inf.Encrypted, Binary{
+				Path:      f.Name,
+				CryptID:   cryptid,
+				CryptOff:  off,
+				CryptSize: size,
+			})
+		}
+	}
+
+	if inf.Bundle == "" {
+		return nil, fmt.Errorf("failed to find app bundle Info.plist in %s", ipaPath)
+	}
+	for i, bin := range inf.Encrypted {
+		if rel, ok := strings.CutPrefix(bin.Path, inf.Bundle+"/"); ok {
+			inf.Encrypted[i].BundlePath = rel
+		} else {
+			inf.Encrypted[i].BundlePath = strings.TrimPrefix(bin.Path, "Payload/")
+		}
+	}
+
+	return &inf, nil
+}
+
+// Repack copies the .ipa to output replacing its files with the local files (keyed by their path in the .ipa)
+func Repack(ipaPath, output string, files map[string]string) error {
+	zr, err := zip.OpenReader(ipaPath)
+	if err != nil {
+		return fmt.Errorf("failed to open ipa %s: %v", ipaPath, err)
+	}
+	defer zr.Close()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", output, err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range zr.File {
+		local, ok := files[f.Name]
+		if !ok {
+			if err := zw.Copy(f); err != nil {
+				return fmt.Errorf("failed to copy %s: %v", f.Name, err)
+			}
+			continue
+		}
+		data, err := os.ReadFile(local)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", local, err)
+		}
+		header := f.FileHeader
+		header.Method = zip.Deflate
+		w, err := zw.CreateHeader(&header)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", f.Name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write %s: %v", f.Name, err)
+		}
+	}
+
+	return zw.Close()
+}
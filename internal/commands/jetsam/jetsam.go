@@ -0,0 +1,436 @@
+// Package jetsam parses (and diffs) the jetsam priority bands and memory limits, and the launchd task roles,
+// that are shipped in a build
+package jetsam
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/search"
+)
+
+const propertiesPrefix = "com.apple.jetsamproperties."
+
+// IsConfigFile returns true if the file is a jetsam properties plist or a launchd job plist
+func IsConfigFile(name string) bool {
+	name = filepath.ToSlash(name)
+	if path.Ext(name) != ".plist" {
+		return false
+	}
+	if strings.HasPrefix(path.Base(name), propertiesPrefix) {
+		return true
+	}
+	switch path.Base(path.Dir(name)) {
+	case "LaunchDaemons", "LaunchAgents":
+		return true
+	}
+	return false
+}
+
+// DeviceClass returns the device class (i.e. the board config D73) of a jetsam properties plist
+func DeviceClass(name string) (string, bool) {
+	base := path.Base(filepath.ToSlash(name))
+	if !strings.HasPrefix(base, propertiesPrefix) || path.Ext(base) != ".plist" {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(base, propertiesPrefix), ".plist"), true
+}
+
+// Category is a class of processes (i.e. Daemon or Extension) in a jetsam properties plist
+type Category struct {
+	// the properties that apply to all of the category's processes
+	Defaults map[string]any `json:"defaults,omitempty"`
+	// process (or bundle ID) -> its properties (i.e. JetsamPriority, ActiveSoftMemoryLimit, etc.)
+	Overrides map[string]map[string]any `json:"overrides,omitempty"`
+}
+
+// Properties is the jetsam configuration of a device class
+type Properties struct {
+	DeviceClass string               `json:"device_class"`
+	Version     string               `json:"version,omitempty"`
+	Categories  map[string]*Category `json:"categories"`
+}
+
+// Processes returns the sorted process names of the category
+func (c *Category) Processes() []string {
+	procs := make([]string, 0, len(c.Overrides))
+	for proc := range c.Overrides {
+		procs = append(procs, proc)
+	}
+	slices.Sort(procs)
+	return procs
+}
+
+// SortedCategories returns the sorted category names
+func (p *Properties) SortedCategories() []string {
+	cats := make([]string, 0, len(p.Categories))
+	for cat := range p.Categories {
+		cats = append(cats, cat)
+	}
+	slices.Sort(cats)
+	return cats
+}
+
+// ParseProperties parses a com.apple.jetsamproperties.<CLASS>.plist
+func ParseProperties(name string, data []byte) (*Properties, error) {
+	class, ok := DeviceClass(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a jetsam properties plist", name)
+	}
+	var top map[string]any
+	if _, err := plist.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	props := &Properties{DeviceClass: class, Categories: make(map[string]*Category)}
+	for key, val := range top {
+		dict, ok := val.(map[string]any)
+		if !ok {
+			if key == "Version" {
+				props.Version = fmt.Sprint(val)
+			}
+			continue
+		}
+		cat := &Category{Defaults: make(map[string]any), Overrides: make(map[string]map[string]any)}
+		overrides, ok := dict["Override"].(map[string]any)
+		if !ok { // the category is keyed directly by process
+			overrides = dict
+		}
+		for proc, v := range overrides {
+			if p, ok := v.(map[string]any); ok {
+				cat.Overrides[proc] = p
+			}
+		}
+		for k, v := range dict { // i.e. the category's default priority band
+			if _, ok := v.(map[string]any); !ok {
+				cat.Defaults[k] = v
+			}
+		}
+		props.Categories[key] = cat
+	}
+	return props, nil
+}
+
+// Job is a launchd job's task role (ProcessType) and jetsam properties
+type Job struct {
+	Label       string         `json:"label"`
+	Path        string         `json:"path"`
+	ProcessType string         `json:"process_type,omitempty"` // i.e. Interactive, Adaptive, Background or Standard
+	Jetsam      map[string]any `json:"jetsam,omitempty"`       // the job's JetsamProperties
+}
+
+type launchdPlist struct {
+	Label            string         `plist:"Label,omitempty"`
+	ProcessType      string         `plist:"ProcessType,omitempty"`
+	JetsamProperties map[string]any `plist:"JetsamProperties,omitempty"`
+}
+
+// Config is the jetsam configuration of a build
+type Config struct {
+	// device class -> jetsam properties
+	Properties map[string]*Properties `json:"properties"`
+	// launchd job label -> job
+	Jobs map[string]*Job `json:"jobs,omitempty"`
+}
+
+// New creates an empty Config
+func New() *Config {
+	return &Config{
+		Properties: make(map[string]*Properties),
+		Jobs:       make(map[string]*Job),
+	}
+}
+
+// DeviceClasses returns the sorted device classes
+func (c *Config) DeviceClasses() []string {
+	classes := make([]string, 0, len(c.Properties))
+	for class := range c.Properties {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+	return classes
+}
+
+// Labels returns the sorted launchd job labels
+func (c *Config) Labels() []string {
+	labels := make([]string, 0, len(c.Jobs))
+	for label := range c.Jobs {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	return labels
+}
+
+// Add parses the config file and adds it to the config
+func (c *Config) Add(name string, data []byte) error {
+	name = filepath.ToSlash(name)
+	if _, ok := DeviceClass(name); ok {
+		props, err := ParseProperties(name, data)
+		if err != nil {
+			return err
+		}
+		c.Properties[props.DeviceClass] = props
+		return nil
+	}
+	var job launchdPlist
+	if _, err := plist.Unmarshal(data, &job); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	if len(job.ProcessType) == 0 && len(job.JetsamProperties) == 0 {
+		return nil
+	}
+	if len(job.Label) == 0 {
+		job.Label = strings.TrimSuffix(path.Base(name), ".plist")
+	}
+	c.Jobs[job.Label] = &Job{
+		Label:       job.Label,
+		Path:        name,
+		ProcessType: job.ProcessType,
+		Jetsam:      job.JetsamProperties,
+	}
+	return nil
+}
+
+// AddFolder adds the config in the folder (i.e. a mounted or extracted filesystem)
+func (c *Config) AddFolder(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.WithError(err).Debugf("failed to walk %s", p)
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !IsConfigFile(p) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if err := c.Add("/"+filepath.ToSlash(rel), data); err != nil {
+			log.WithError(err).Debug("skipping jetsam config file")
+		}
+		return nil
+	})
+}
+
+// AddIPSW adds the config in the IPSW's filesystem DMGs
+func (c *Config) AddIPSW(ipswPath, pemDB string) error {
+	return search.ForEachFileInIPSW(ipswPath, pemDB, IsConfigFile, func(name string, data []byte) error {
+		if err := c.Add(name, data); err != nil {
+			log.WithError(err).Debug("skipping jetsam config file")
+		}
+		return nil
+	})
+}
+
+// Parse returns the jetsam config of an IPSW or folder
+func Parse(input, pemDB string) (*Config, error) {
+	c := New()
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", input, err)
+	}
+	if info.IsDir() {
+		err = c.AddFolder(input)
+	} else {
+		err = c.AddIPSW(input, pemDB)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Change is a jetsam property (or launchd job task role) whose value changed between two builds
+//
+// NOTE: Old is empty if the property was added and New is empty if it was removed
+type Change struct {
+	DeviceClass string `json:"device_class,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Process     string `json:"process"`
+	Property    string `json:"property"`
+	Old         string `json:"old,omitempty"`
+	New         string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch {
+	case len(c.Old) == 0:
+		return fmt.Sprintf("%s: %s (new)", c.Property, c.New)
+	case len(c.New) == 0:
+		return fmt.Sprintf("%s: %s (removed)", c.Property, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Property, c.Old, c.New)
+	}
+}
+
+// Diff is the difference between the jetsam config of two builds
+type Diff struct {
+	NewDeviceClasses     []string `json:"new_device_classes,omitempty"`
+	RemovedDeviceClasses []string `json:"removed_device_classes,omitempty"`
+	NewProcesses         []Change `json:"new_processes,omitempty"`     // only Process (and DeviceClass/Category) are set
+	RemovedProcesses     []Change `json:"removed_processes,omitempty"` // only Process (and DeviceClass/Category) are set
+	Changed              []Change `json:"changed,omitempty"`
+	Jobs                 []Change `json:"jobs,omitempty"`
+}
+
+// Empty returns true if nothing changed
+func (d *Diff) Empty() bool {
+	return len(d.NewDeviceClasses) == 0 && len(d.RemovedDeviceClasses) == 0 && len(d.NewProcesses) == 0 &&
+		len(d.RemovedProcesses) == 0 && len(d.Changed) == 0 && len(d.Jobs) == 0
+}
+
+func compareProps(base Change, prev, next map[string]any) []Change {
+	var changes []Change
+	keys := make([]string, 0, len(prev)+len(next))
+	for k := range prev {
+		keys = append(keys, k)
+	}
+	for k := range next {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range slices.Compact(keys) {
+		var o, n string
+		if v, ok := prev[k]; ok {
+			o = fmt.Sprint(v)
+		}
+		if v, ok := next[k]; ok {
+			n = fmt.Sprint(v)
+		}
+		if o != n {
+			c := base
+			c.Property, c.Old, c.New = k, o, n
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Compare diffs the jetsam config of two builds
+func Compare(prev, next *Config) *Diff {
+	d := &Diff{}
+	for _, class := range next.DeviceClasses() {
+		if _, ok := prev.Properties[class]; !ok {
+			d.NewDeviceClasses = append(d.NewDeviceClasses, class)
+		}
+	}
+	for _, class := range prev.DeviceClasses() {
+		np, ok := next.Properties[class]
+		if !ok {
+			d.RemovedDeviceClasses = append(d.RemovedDeviceClasses, class)
+			continue
+		}
+		pp := prev.Properties[class]
+		cats := append(pp.SortedCategories(), np.SortedCategories()...)
+		slices.Sort(cats)
+		for _, cat := range slices.Compact(cats) {
+			pc, nc := pp.Categories[cat], np.Categories[cat]
+			if pc == nil {
+				pc = &Category{}
+			}
+			if nc == nil {
+				nc = &Category{}
+			}
+			base := Change{DeviceClass: class, Category: cat}
+			d.Changed = append(d.Changed, compareProps(Change{DeviceClass: class, Category: cat, Process: "*"}, pc.Defaults, nc.Defaults)...)
+			for _, proc := range nc.Processes() {
+				if _, ok := pc.Overrides[proc]; !ok {
+					c := base
+					c.Process = proc
+					d.NewProcesses = append(d.NewProcesses, c)
+				}
+			}
+			for _, proc := range pc.Processes() {
+				c := base
+				c.Process = proc
+				if _, ok := nc.Overrides[proc]; !ok {
+					d.RemovedProcesses = append(d.RemovedProcesses, c)
+					continue
+				}
+				d.Changed = append(d.Changed, compareProps(c, pc.Overrides[proc], nc.Overrides[proc])...)
+			}
+		}
+	}
+
+	labels := append(prev.Labels(), next.Labels()...)
+	slices.Sort(labels)
+	job := func(c *Config, label string) map[string]any {
+		props := make(map[string]any)
+		if j, ok := c.Jobs[label]; ok {
+			if len(j.ProcessType) > 0 {
+				props["ProcessType"] = j.ProcessType
+			}
+			for k, v := range j.Jetsam {
+				props["JetsamProperties."+k] = v
+			}
+		}
+		return props
+	}
+	for _, label := range slices.Compact(labels) {
+		d.Jobs = append(d.Jobs, compareProps(Change{Process: label}, job(prev, label), job(next, label))...)
+	}
+
+	return d
+}
+
+// Markdown returns the diff as Markdown
+func (d *Diff) Markdown() string {
+	var out strings.Builder
+	for _, list := range []struct {
+		title   string
+		classes []string
+	}{
+		{"🆕 NEW Device Classes", d.NewDeviceClasses},
+		{"❌ Removed Device Classes", d.RemovedDeviceClasses},
+	} {
+		if len(list.classes) > 0 {
+			fmt.Fprintf(&out, "#### %s (%d)\n\n", list.title, len(list.classes))
+			for _, class := range list.classes {
+				fmt.Fprintf(&out, "- `%s`\n", class)
+			}
+			out.WriteString("\n")
+		}
+	}
+	for _, list := range []struct {
+		title   string
+		changes []Change
+	}{
+		{"🆕 NEW Processes", d.NewProcesses},
+		{"❌ Removed Processes", d.RemovedProcesses},
+	} {
+		if len(list.changes) > 0 {
+			fmt.Fprintf(&out, "#### %s (%d)\n\n", list.title, len(list.changes))
+			for _, c := range list.changes {
+				fmt.Fprintf(&out, "- `%s` *(%s/%s)*\n", c.Process, c.DeviceClass, c.Category)
+			}
+			out.WriteString("\n")
+		}
+	}
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(&out, "#### ⬆️ Changed (%d)\n\n", len(d.Changed))
+		out.WriteString("| Device Class | Category | Process | Property | Old | New |\n| :-- | :-- | :-- | :-- | :-- | :-- |\n")
+		for _, c := range d.Changed {
+			fmt.Fprintf(&out, "| %s | %s | `%s` | %s | %s | %s |\n", c.DeviceClass, c.Category, c.Process, c.Property, c.Old, c.New)
+		}
+		out.WriteString("\n")
+	}
+	if len(d.Jobs) > 0 {
+		fmt.Fprintf(&out, "#### Task Roles (%d)\n\n", len(d.Jobs))
+		out.WriteString("| Job | Property | Old | New |\n| :-- | :-- | :-- | :-- |\n")
+		for _, c := range d.Jobs {
+			fmt.Fprintf(&out, "| `%s` | %s | %s | %s |\n", c.Process, c.Property, c.Old, c.New)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,124 @@
+package jetsam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProperties = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Version</key>
+	<integer>4</integer>
+	<key>Daemon</key>
+	<dict>
+		<key>JetsamPriority</key>
+		<integer>3</integer>
+		<key>Override</key>
+		<dict>
+			<key>com.apple.accessoryd</key>
+			<dict>
+				<key>ActiveSoftMemoryLimit</key>
+				<integer>%d</integer>
+				<key>JetsamPriority</key>
+				<integer>3</integer>
+			</dict>
+		</dict>
+	</dict>
+	<key>Extension</key>
+	<dict>
+		<key>Override</key>
+		<dict>
+			<key>com.apple.share</key>
+			<dict>
+				<key>JetsamMemoryLimit</key>
+				<integer>120</integer>
+			</dict>
+		</dict>
+	</dict>
+</dict>
+</plist>`
+
+const testJob = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.apple.accessoryd</string>
+	<key>ProcessType</key>
+	<string>%s</string>
+</dict>
+</plist>`
+
+func writeBuild(t *testing.T, limit int, processType string) string {
+	t.Helper()
+	root := t.TempDir()
+	daemons := filepath.Join(root, "System", "Library", "LaunchDaemons")
+	if err := os.MkdirAll(daemons, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"com.apple.jetsamproperties.D73.plist": fmt.Sprintf(testProperties, limit),
+		"com.apple.accessoryd.plist":           fmt.Sprintf(testJob, processType),
+		"com.apple.nothing.plist":              fmt.Sprintf(testJob, ""),
+	} {
+		if err := os.WriteFile(filepath.Join(daemons, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(writeBuild(t, 6, "Adaptive"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	props, ok := c.Properties["D73"]
+	if !ok || props.Version != "4" || len(props.Categories) != 2 {
+		t.Fatalf("Properties = %+v", c.Properties)
+	}
+	daemon := props.Categories["Daemon"]
+	if daemon.Defaults["JetsamPriority"] != uint64(3) {
+		t.Errorf("Daemon defaults = %v", daemon.Defaults)
+	}
+	if daemon.Overrides["com.apple.accessoryd"]["ActiveSoftMemoryLimit"] != uint64(6) {
+		t.Errorf("Daemon overrides = %v", daemon.Overrides)
+	}
+	if job, ok := c.Jobs["com.apple.accessoryd"]; !ok || job.ProcessType != "Adaptive" || len(c.Jobs) != 1 {
+		t.Errorf("Jobs = %v", c.Jobs)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	prev, err := Parse(writeBuild(t, 6, "Adaptive"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := Parse(writeBuild(t, 8, "Interactive"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Compare(prev, prev); !d.Empty() {
+		t.Errorf("Compare() of the same build = %+v", d)
+	}
+	d := Compare(prev, next)
+	if len(d.Changed) != 1 || d.Changed[0] != (Change{DeviceClass: "D73", Category: "Daemon", Process: "com.apple.accessoryd", Property: "ActiveSoftMemoryLimit", Old: "6", New: "8"}) {
+		t.Errorf("Changed = %+v", d.Changed)
+	}
+	if len(d.Jobs) != 1 || d.Jobs[0].Old != "Adaptive" || d.Jobs[0].New != "Interactive" {
+		t.Errorf("Jobs = %+v", d.Jobs)
+	}
+	if md := d.Markdown(); !strings.Contains(md, "| D73 | Daemon | `com.apple.accessoryd` | ActiveSoftMemoryLimit | 6 | 8 |") {
+		t.Errorf("Markdown() =\n%s", md)
+	}
+
+	delete(next.Properties["D73"].Categories["Extension"].Overrides, "com.apple.share")
+	if d := Compare(prev, next); len(d.RemovedProcesses) != 1 || d.RemovedProcesses[0].Process != "com.apple.share" {
+		t.Errorf("RemovedProcesses = %+v", d.RemovedProcesses)
+	}
+}
@@ -0,0 +1,368 @@
+// Package localize extracts and diffs the localized strings (.strings, .stringsdict and .loctable files) of a build
+package localize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/search"
+)
+
+const (
+	ExtStrings     = ".strings"
+	ExtStringsDict = ".stringsdict"
+	ExtLocTable    = ".loctable"
+	// loctable metadata key (not a language)
+	locProvenance = "LocProvenance"
+	// the development language (used when a string isn't localized)
+	baseLang = "Base"
+)
+
+// legacy .lproj folder names
+var legacyLangs = map[string]string{
+	"English":  "en",
+	"French":   "fr",
+	"German":   "de",
+	"Italian":  "it",
+	"Japanese": "ja",
+	"Spanish":  "es",
+	"Dutch":    "nl",
+}
+
+// stringsdict format metadata keys (that aren't user-facing strings)
+var stringsDictMeta = []string{
+	"NSStringFormatSpecTypeKey",
+	"NSStringFormatValueTypeKey",
+}
+
+// IsLocalizationFile returns true if the file is a .strings, .stringsdict or .loctable file
+func IsLocalizationFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ExtStrings, ExtStringsDict, ExtLocTable:
+		return true
+	}
+	return false
+}
+
+// Catalog are the localized strings of a build: table -> language -> key -> string
+//
+// The table is the file's path without its .lproj folder and extension (i.e. /System/Library/Frameworks/Foo.framework/Localizable)
+// so the .strings and .stringsdict of every language are parsed into the same table
+type Catalog struct {
+	Tables map[string]map[string]map[string]string `json:"tables"`
+	langs  []string
+}
+
+// NewCatalog creates a catalog that only keeps the languages supplied (or all languages if none are)
+func NewCatalog(langs ...string) *Catalog {
+	return &Catalog{
+		Tables: make(map[string]map[string]map[string]string),
+		langs:  langs,
+	}
+}
+
+func normalizeLang(lang string) string {
+	if l, ok := legacyLangs[lang]; ok {
+		return l
+	}
+	return lang
+}
+
+func (c *Catalog) wantLang(lang string) bool {
+	if len(c.langs) == 0 || lang == "" || lang == baseLang {
+		return true
+	}
+	for _, want := range c.langs {
+		// 'en' matches en, en_GB, en-AU, etc.
+		if strings.EqualFold(lang, want) || strings.HasPrefix(strings.ToLower(lang), strings.ToLower(want)+"_") || strings.HasPrefix(strings.ToLower(lang), strings.ToLower(want)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Table returns the table name and language of a localization file
+// (i.e. /App.app/en.lproj/Localizable.strings -> /App.app/Localizable, en)
+func Table(name string) (table, lang string) {
+	name = filepath.ToSlash(name)
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+	if parent := path.Base(dir); strings.HasSuffix(parent, ".lproj") {
+		lang = normalizeLang(strings.TrimSuffix(parent, ".lproj"))
+		dir = path.Dir(dir)
+	}
+	return path.Join(dir, strings.TrimSuffix(base, path.Ext(base))), lang
+}
+
+// decodeText converts UTF-16 (text) .strings files to UTF-8
+func decodeText(data []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	default:
+		return bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+	}
+	data = data[2:]
+	u16 := make([]uint16, len(data)/2)
+	for i := range u16 {
+		u16[i] = order.Uint16(data[i*2:])
+	}
+	return []byte(string(utf16.Decode(u16)))
+}
+
+// flatten adds the (nested) strings to dst; stringsdict plural/device variants are keyed as KEY[VARIABLE][RULE]
+func flatten(dst map[string]string, key string, val any) {
+	switch v := val.(type) {
+	case string:
+		dst[key] = v
+	case map[string]any:
+		for k, sub := range v {
+			switch {
+			case slices.Contains(stringsDictMeta, k):
+				continue
+			case k == "NSStringLocalizedFormatKey":
+				flatten(dst, key, sub)
+			default:
+				flatten(dst, fmt.Sprintf("%s[%s]", key, k), sub)
+			}
+		}
+	case []any:
+		for i, sub := range v {
+			flatten(dst, fmt.Sprintf("%s[%d]", key, i), sub)
+		}
+	default:
+		dst[key] = fmt.Sprint(v)
+	}
+}
+
+func (c *Catalog) add(table, lang string, strs map[string]any) {
+	if !c.wantLang(lang) {
+		return
+	}
+	if _, ok := c.Tables[table]; !ok {
+		c.Tables[table] = make(map[string]map[string]string)
+	}
+	dst, ok := c.Tables[table][lang]
+	if !ok {
+		dst = make(map[string]string)
+		c.Tables[table][lang] = dst
+	}
+	for key, val := range strs {
+		flatten(dst, key, val)
+	}
+}
+
+// Add parses the localization file and adds its strings to the catalog
+func (c *Catalog) Add(name string, data []byte) error {
+	var strs map[string]any
+	if _, err := plist.Unmarshal(decodeText(data), &strs); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	table, lang := Table(name)
+	switch filepath.Ext(name) {
+	case ExtLocTable: // all the languages in one file
+		for lang, tbl := range strs {
+			if lang == locProvenance {
+				continue
+			}
+			if t, ok := tbl.(map[string]any); ok {
+				c.add(table, normalizeLang(lang), t)
+			}
+		}
+	case ExtStrings, ExtStringsDict:
+		c.add(table, lang, strs)
+	default:
+		return fmt.Errorf("%s is not a .strings, .stringsdict or .loctable file", name)
+	}
+	return nil
+}
+
+// AddFolder adds all the localization files in the folder (i.e. a mounted or extracted filesystem)
+func (c *Catalog) AddFolder(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.WithError(err).Debugf("failed to walk %s", p)
+			return nil
+		}
+		if d.IsDir() || !IsLocalizationFile(p) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if err := c.Add("/"+filepath.ToSlash(rel), data); err != nil {
+			log.WithError(err).Debug("skipping localization file")
+		}
+		return nil
+	})
+}
+
+// AddIPSW adds all the localization files in the IPSW's filesystem DMGs
+func (c *Catalog) AddIPSW(ipswPath, pemDB string) error {
+	return search.ForEachFileInIPSW(ipswPath, pemDB, IsLocalizationFile, func(name string, data []byte) error {
+		if err := c.Add(name, data); err != nil {
+			log.WithError(err).Debug("skipping localization file")
+		}
+		return nil
+	})
+}
+
+// Count returns the number of strings in the catalog
+func (c *Catalog) Count() int {
+	n := 0
+	for _, langs := range c.Tables {
+		for _, strs := range langs {
+			n += len(strs)
+		}
+	}
+	return n
+}
+
+// String is a localized string
+type String struct {
+	Table string `json:"table"`
+	Lang  string `json:"lang"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// previous value (for changed strings)
+	Old string `json:"old,omitempty"`
+}
+
+func sortStrings(strs []String) {
+	slices.SortFunc(strs, func(a, b String) int {
+		if c := strings.Compare(a.Table, b.Table); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Lang, b.Lang); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+}
+
+// Search returns the strings whose key or value matches the regex
+func (c *Catalog) Search(re *regexp.Regexp) []String {
+	var out []String
+	for table, langs := range c.Tables {
+		for lang, strs := range langs {
+			for key, val := range strs {
+				if re == nil || re.MatchString(key) || re.MatchString(val) {
+					out = append(out, String{Table: table, Lang: lang, Key: key, Value: val})
+				}
+			}
+		}
+	}
+	sortStrings(out)
+	return out
+}
+
+// Diff are the localized strings that were added, removed or changed between two builds
+type Diff struct {
+	New     []String `json:"new,omitempty"`
+	Removed []String `json:"removed,omitempty"`
+	Changed []String `json:"changed,omitempty"`
+}
+
+// Compare diffs the strings of two catalogs
+func Compare(prev, next *Catalog) *Diff {
+	d := &Diff{}
+	for table, langs := range next.Tables {
+		for lang, strs := range langs {
+			old := prev.Tables[table][lang]
+			for key, val := range strs {
+				if oldVal, ok := old[key]; !ok {
+					d.New = append(d.New, String{Table: table, Lang: lang, Key: key, Value: val})
+				} else if oldVal != val {
+					d.Changed = append(d.Changed, String{Table: table, Lang: lang, Key: key, Value: val, Old: oldVal})
+				}
+			}
+		}
+	}
+	for table, langs := range prev.Tables {
+		for lang, strs := range langs {
+			for key, val := range strs {
+				if _, ok := next.Tables[table][lang][key]; !ok {
+					d.Removed = append(d.Removed, String{Table: table, Lang: lang, Key: key, Value: val})
+				}
+			}
+		}
+	}
+	sortStrings(d.New)
+	sortStrings(d.Removed)
+	sortStrings(d.Changed)
+	return d
+}
+
+// Empty returns true if no strings changed
+func (d *Diff) Empty() bool {
+	return len(d.New) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func mdEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func mdTable(out *strings.Builder, strs []String, changed bool) {
+	table := ""
+	for _, s := range strs {
+		if s.Table != table {
+			table = s.Table
+			fmt.Fprintf(out, "\n> `%s`\n\n", table)
+			if changed {
+				out.WriteString("| Lang | Key | Old | New |\n| :--- | :-- | :-- | :-- |\n")
+			} else {
+				out.WriteString("| Lang | Key | String |\n| :--- | :-- | :----- |\n")
+			}
+		}
+		if changed {
+			fmt.Fprintf(out, "| %s | `%s` | %s | %s |\n", s.Lang, mdEscape(s.Key), mdEscape(s.Old), mdEscape(s.Value))
+		} else {
+			fmt.Fprintf(out, "| %s | `%s` | %s |\n", s.Lang, mdEscape(s.Key), mdEscape(s.Value))
+		}
+	}
+	out.WriteString("\n")
+}
+
+// Markdown returns the diff as Markdown tables (grouped by table)
+func (d *Diff) Markdown() string {
+	var out strings.Builder
+	for _, sec := range []struct {
+		title   string
+		name    string
+		strs    []String
+		changed bool
+	}{
+		{"🆕 NEW", "NEW", d.New, false},
+		{"❌ Removed", "Removed", d.Removed, false},
+		{"⬆️ Updated", "Updated", d.Changed, true},
+	} {
+		if len(sec.strs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "#### %s (%d)\n\n", sec.title, len(sec.strs))
+		fmt.Fprintf(&out, "<details>\n  <summary><i>View %s</i></summary>\n", sec.name)
+		mdTable(&out, sec.strs, sec.changed)
+		out.WriteString("</details>\n\n")
+	}
+	return out.String()
+}
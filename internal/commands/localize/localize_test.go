@@ -0,0 +1,74 @@
+package localize
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/blacktop/go-plist"
+)
+
+func utf16le(s string) []byte {
+	out := []byte{0xff, 0xfe}
+	for _, r := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, r)
+	}
+	return out
+}
+
+func TestCompare(t *testing.T) {
+	stringsdict, err := plist.Marshal(map[string]any{
+		"%d photos": map[string]any{
+			"NSStringLocalizedFormatKey": "%#@photos@",
+			"photos": map[string]any{
+				"NSStringFormatSpecTypeKey":  "NSStringPluralRuleType",
+				"NSStringFormatValueTypeKey": "d",
+				"one":                        "%d photo",
+				"other":                      "%d photos",
+			},
+		},
+	}, plist.BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loctable, err := plist.Marshal(map[string]any{
+		"LocProvenance": map[string]any{"en": "x"},
+		"en":            map[string]any{"TITLE": "Settings"},
+		"fr":            map[string]any{"TITLE": "Réglages"},
+	}, plist.BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := NewCatalog("en")
+	if err := prev.Add("/App.app/English.lproj/Localizable.strings", utf16le("/* hi */\n\"HELLO\" = \"Hello\";\n\"BYE\" = \"Bye\";\n")); err != nil {
+		t.Fatal(err)
+	}
+	next := NewCatalog("en")
+	for name, data := range map[string][]byte{
+		"/App.app/en.lproj/Localizable.strings":     []byte("\"HELLO\" = \"Hello!\";\n\"NEW_FEATURE\" = \"Try the new thing\";\n"),
+		"/App.app/en.lproj/Localizable.stringsdict": stringsdict,
+		"/Settings.bundle/Root.loctable":            loctable,
+	} {
+		if err := next.Add(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next.Count() != 6 {
+		t.Fatalf("count = %d: %v", next.Count(), next.Tables)
+	}
+	if got := next.Tables["/App.app/Localizable"]["en"]["%d photos[photos][one]"]; got != "%d photo" {
+		t.Errorf("plural = %q", got)
+	}
+	if _, ok := next.Tables["/Settings.bundle/Root"]["fr"]; ok {
+		t.Errorf("fr strings should be filtered out")
+	}
+
+	d := Compare(prev, next)
+	if len(d.New) != 5 || d.New[0].Key != "%d photos" || len(d.Removed) != 1 || d.Removed[0].Key != "BYE" {
+		t.Errorf("new = %v, removed = %v", d.New, d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Old != "Hello" || d.Changed[0].Value != "Hello!" {
+		t.Errorf("changed = %v", d.Changed)
+	}
+}
@@ -0,0 +1,394 @@
+package macho
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/quick"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho/types/objc"
+	"github.com/blacktop/ipsw/internal/swift"
+	objctype "github.com/blacktop/ipsw/pkg/objc"
+)
+
+// ObjC output formats
+const (
+	FormatIpsw      = "ipsw"       // default ipsw output
+	FormatClassDump = "class-dump" // classic class-dump/class-dump-z compatible output
+)
+
+// ObjcFormats are the supported ObjC output formats
+var ObjcFormats = []string{FormatIpsw, FormatClassDump}
+
+const classDumpBanner = "//\n" +
+	"//     Generated by class-dump 3.5 (64 bit) compatible output of https://github.com/blacktop/ipsw (%s).\n" +
+	"//\n" +
+	"//     class-dump is Copyright (C) 1997-1998, 2000-2001, 2004-2015 by Steve Nygard.\n" +
+	"//\n\n"
+
+// cdStructuresHeader is the header class-dump puts the struct definitions in
+const cdStructuresHeader = "CDStructures.h"
+
+func (o *ObjC) classDump() bool {
+	return o.conf.Format == FormatClassDump
+}
+
+type cdProperty struct {
+	objc.Property
+	attrs    []string
+	getter   string
+	setter   string
+	ivar     string
+	dynamic  bool
+	optional bool
+}
+
+func parseProperty(prop objc.Property) *cdProperty {
+	p := &cdProperty{Property: prop}
+	for _, attr := range strings.Split(prop.EncodedAttributes, ",") {
+		if len(attr) == 0 {
+			continue
+		}
+		switch attr[0] {
+		case 'T': // type
+		case 'R':
+			p.attrs = append(p.attrs, "readonly")
+		case 'C':
+			p.attrs = append(p.attrs, "copy")
+		case '&':
+			p.attrs = append(p.attrs, "retain")
+		case 'W':
+			p.attrs = append(p.attrs, "weak")
+		case 'N':
+			p.attrs = append(p.attrs, "nonatomic")
+		case 'G':
+			p.getter = attr[1:]
+			p.attrs = append(p.attrs, "getter="+p.getter)
+		case 'S':
+			p.setter = attr[1:]
+			p.attrs = append(p.attrs, "setter="+p.setter)
+		case 'D':
+			p.dynamic = true
+		case 'V':
+			p.ivar = attr[1:]
+		case '?':
+			p.optional = true
+		case 'P': // garbage collection
+		}
+	}
+	if p.getter == "" {
+		p.getter = prop.Name
+	}
+	if p.setter == "" && len(prop.Name) > 0 {
+		p.setter = "set" + strings.ToUpper(prop.Name[:1]) + prop.Name[1:] + ":"
+	}
+	return p
+}
+
+// String returns the property declaration with its class-dump @synthesize/@dynamic comment
+func (p *cdProperty) String() string {
+	var sb strings.Builder
+	sb.WriteString("@property")
+	if len(p.attrs) > 0 {
+		fmt.Fprintf(&sb, "(%s)", strings.Join(p.attrs, ", "))
+	}
+	sb.WriteString(" " + cdType(p.Type()))
+	if !strings.HasSuffix(sb.String(), "*") {
+		sb.WriteString(" ")
+	}
+	sb.WriteString(p.Name + ";")
+	switch {
+	case p.dynamic:
+		fmt.Fprintf(&sb, " // @dynamic %s;", p.Name)
+	case p.ivar == p.Name:
+		fmt.Fprintf(&sb, " // @synthesize %s;", p.Name)
+	case p.ivar != "":
+		fmt.Fprintf(&sb, " // @synthesize %s=%s;", p.Name, p.ivar)
+	}
+	return sb.String()
+}
+
+// cdType collapses named struct/union definitions (which class-dump puts in CDStructures.h) and renames blocks
+func cdType(typ string) string {
+	typ = strings.TrimSpace(typ)
+	typ = strings.ReplaceAll(typ, "id /* block */", "CDUnknownBlockType")
+	var sb strings.Builder
+	for i := 0; i < len(typ); i++ {
+		if typ[i] == '{' {
+			prev := strings.Fields(strings.TrimSpace(sb.String()))
+			if n := len(prev); n >= 2 && (prev[n-2] == "struct" || prev[n-2] == "union") {
+				depth := 0
+				for ; i < len(typ); i++ {
+					if typ[i] == '{' {
+						depth++
+					} else if typ[i] == '}' {
+						if depth--; depth == 0 {
+							break
+						}
+					}
+				}
+				out := strings.TrimRight(sb.String(), " ")
+				sb.Reset()
+				sb.WriteString(out)
+				continue
+			}
+		}
+		sb.WriteByte(typ[i])
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// cdMethod returns a method declaration with class-dump's argN argument names
+func cdMethod(prefix string, m objc.Method) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s)", prefix, cdType(m.ReturnType()))
+	nargs := m.NumberOfArguments() - 2 // self and _cmd
+	parts := strings.Split(m.Name, ":")
+	if nargs <= 0 || len(parts) < 2 {
+		sb.WriteString(m.Name + ";")
+		return sb.String()
+	}
+	for i, part := range parts[:len(parts)-1] {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		typ := "id"
+		if i < nargs {
+			typ = cdType(m.ArgumentType(i + 3)) // [0] is the return type
+		}
+		fmt.Fprintf(&sb, "%s:(%s)arg%d", part, typ, i+1)
+	}
+	sb.WriteString(";")
+	return sb.String()
+}
+
+func (o *ObjC) cdMethod(prefix string, m objc.Method) string {
+	if o.conf.Addrs && m.ImpVMAddr != 0 {
+		return fmt.Sprintf("%s\t// IMP=%#x", cdMethod(prefix, m), m.ImpVMAddr)
+	}
+	return cdMethod(prefix, m)
+}
+
+// cdMethodsAndProperties writes the instance methods replacing the first accessor of each property with its declaration
+func (o *ObjC) cdMethodsAndProperties(sb *strings.Builder, methods []objc.Method, props []*cdProperty) {
+	accessors := make(map[string]*cdProperty)
+	for _, p := range props {
+		accessors[p.getter] = p
+		if !slices.Contains(p.attrs, "readonly") {
+			accessors[p.setter] = p
+		}
+	}
+	done := make(map[*cdProperty]bool)
+	for _, m := range methods {
+		if p, ok := accessors[m.Name]; ok {
+			if !done[p] {
+				sb.WriteString(p.String() + "\n")
+				done[p] = true
+			}
+			continue
+		}
+		sb.WriteString(o.cdMethod("-", m) + "\n")
+	}
+	var remaining []*cdProperty
+	for _, p := range props {
+		if !done[p] {
+			remaining = append(remaining, p)
+		}
+	}
+	if len(remaining) > 0 {
+		sb.WriteString("\n// Remaining properties\n")
+		for _, p := range remaining {
+			sb.WriteString(p.String() + "\n")
+		}
+	}
+}
+
+func protocolNames(protos []objc.Protocol) string {
+	if len(protos) == 0 {
+		return ""
+	}
+	var names []string
+	for _, p := range protos {
+		names = append(names, p.Name)
+	}
+	return " <" + strings.Join(names, ", ") + ">"
+}
+
+// classDumpClass returns the class in the classic class-dump format
+func (o *ObjC) classDumpClass(c *objc.Class) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "@interface %s", c.Name)
+	if len(c.SuperClass) > 0 && !c.ReadOnlyData.Flags.IsRoot() {
+		fmt.Fprintf(&sb, " : %s", c.SuperClass)
+	}
+	sb.WriteString(protocolNames(c.Protocols) + "\n")
+
+	if len(c.Ivars) > 0 {
+		sb.WriteString("{\n")
+		for _, ivar := range c.Ivars {
+			decl := strings.TrimSuffix(ivar.Verbose(), ";")
+			if typ, ok := strings.CutSuffix(decl, ivar.Name); ok {
+				decl = cdType(typ)
+				if !strings.HasSuffix(decl, "*") {
+					decl += " "
+				}
+				decl += ivar.Name
+			}
+			fmt.Fprintf(&sb, "    %s;\t// %d = %#x\n", decl, ivar.Offset, ivar.Offset)
+		}
+		sb.WriteString("}\n")
+	}
+	sb.WriteString("\n")
+
+	for _, m := range c.ClassMethods {
+		sb.WriteString(o.cdMethod("+", m) + "\n")
+	}
+	var props []*cdProperty
+	for _, prop := range c.Props {
+		props = append(props, parseProperty(prop))
+	}
+	o.cdMethodsAndProperties(&sb, c.InstanceMethods, props)
+
+	sb.WriteString("\n@end\n")
+	return swift.DemangleBlob(sb.String())
+}
+
+// classDumpProtocol returns the protocol in the classic class-dump format
+func (o *ObjC) classDumpProtocol(p *objc.Protocol) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "@protocol %s%s\n", p.Name, protocolNames(p.Prots))
+
+	var required, optional []*cdProperty
+	for _, prop := range p.InstanceProperties {
+		if cp := parseProperty(prop); cp.optional {
+			optional = append(optional, cp)
+		} else {
+			required = append(required, cp)
+		}
+	}
+	for _, m := range p.ClassMethods {
+		sb.WriteString(o.cdMethod("+", m) + "\n")
+	}
+	o.cdMethodsAndProperties(&sb, p.InstanceMethods, required)
+
+	if len(p.OptionalClassMethods) > 0 || len(p.OptionalInstanceMethods) > 0 || len(optional) > 0 {
+		sb.WriteString("\n@optional\n")
+		for _, m := range p.OptionalClassMethods {
+			sb.WriteString(o.cdMethod("+", m) + "\n")
+		}
+		o.cdMethodsAndProperties(&sb, p.OptionalInstanceMethods, optional)
+	}
+
+	sb.WriteString("@end\n")
+	return swift.DemangleBlob(sb.String())
+}
+
+// classDumpCategory returns the category in the classic class-dump format
+func (o *ObjC) classDumpCategory(c *objc.Category) string {
+	var sb strings.Builder
+
+	class := "?"
+	if c.Class != nil && c.Class.Name != "" {
+		class = c.Class.Name
+	}
+	fmt.Fprintf(&sb, "@interface %s (%s)%s\n", class, c.Name, protocolNames(c.Protocols))
+
+	for _, m := range c.ClassMethods {
+		sb.WriteString(o.cdMethod("+", m) + "\n")
+	}
+	var props []*cdProperty
+	for _, prop := range c.Properties {
+		props = append(props, parseProperty(prop))
+	}
+	o.cdMethodsAndProperties(&sb, c.InstanceMethods, props)
+
+	sb.WriteString("@end\n")
+	return swift.DemangleBlob(sb.String())
+}
+
+func (o *ObjC) printClassDump(out string) {
+	if o.conf.Color {
+		quick.Highlight(os.Stdout, out+"\n", "objc", "terminal256", o.conf.Theme)
+	} else {
+		fmt.Println(out)
+	}
+}
+
+// classDumpHeader returns a header laid out like `class-dump -H` output
+func classDumpHeader(hdr *headerInfo) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, classDumpBanner, hdr.IpswVersion)
+	if !hdr.IsUmbrella && len(hdr.Imports.Imports) == 0 && len(hdr.Imports.Locals) == 0 {
+		sb.WriteString("#import <Foundation/Foundation.h>\n\n")
+	}
+	for _, imp := range append(hdr.Imports.Imports, hdr.Imports.Locals...) {
+		fmt.Fprintf(&sb, "#import \"%s\"\n", imp)
+	}
+	if len(hdr.Imports.Imports) > 0 || len(hdr.Imports.Locals) > 0 {
+		sb.WriteString("\n")
+	}
+	if len(hdr.Imports.Classes) > 0 {
+		fmt.Fprintf(&sb, "@class %s;\n", strings.Join(hdr.Imports.Classes, ", "))
+	}
+	if len(hdr.Imports.Protos) > 0 {
+		fmt.Fprintf(&sb, "@protocol %s;\n", strings.Join(hdr.Imports.Protos, ", "))
+	}
+	if len(hdr.Imports.Classes) > 0 || len(hdr.Imports.Protos) > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(hdr.Object)
+	if !strings.HasSuffix(hdr.Object, "\n") {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// cdTypes parses the type encodings of the ivars, properties and methods (skipping any that fail to parse)
+func cdTypes(ivars []objc.Ivar, props []objc.Property, methods ...[]objc.Method) []*objctype.Type {
+	var types []*objctype.Type
+	parse := func(enc string) {
+		if typ, err := objctype.ParseType(enc); err == nil {
+			types = append(types, typ)
+		} else {
+			log.WithError(err).Debug("failed to parse type encoding")
+		}
+	}
+	for _, ivar := range ivars {
+		parse(ivar.Type)
+	}
+	for _, prop := range props {
+		for _, attr := range strings.Split(prop.EncodedAttributes, ",") {
+			if enc, ok := strings.CutPrefix(attr, "T"); ok {
+				parse(enc)
+				break
+			}
+		}
+	}
+	for _, ms := range methods {
+		for _, m := range ms {
+			sig, err := objctype.ParseMethodTypes(m.Types)
+			if err != nil {
+				log.WithError(err).Debugf("failed to parse %s type encoding", m.Name)
+				continue
+			}
+			types = append(types, sig.Return)
+			types = append(types, sig.Args...)
+		}
+	}
+	return types
+}
+
+// classDumpStructures returns the CDStructures.h definitions of the named structs (and unions) with their member offsets
+func classDumpStructures(ipswVersion string, types []*objctype.Type) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, classDumpBanner, ipswVersion)
+	sb.WriteString("#pragma mark Named Structures\n")
+	for _, def := range objctype.StructDefinitions(types...) {
+		sb.WriteString("\n" + def.Definition() + "\n")
+	}
+	return sb.String()
+}
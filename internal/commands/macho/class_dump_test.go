@@ -0,0 +1,125 @@
+package macho
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blacktop/go-macho/types/objc"
+)
+
+func TestClassDumpClass(t *testing.T) {
+	o := &ObjC{conf: &ObjcConfig{Format: FormatClassDump}}
+	class := &objc.Class{
+		Name:       "Foo",
+		SuperClass: "NSObject",
+		Protocols:  []objc.Protocol{{Name: "NSCopying"}},
+		Ivars: []objc.Ivar{
+			{Name: "_name", Type: `@"NSString"`, Offset: 8},
+			{Name: "_frame", Type: `{CGRect="origin"{CGPoint="x"d"y"d}"size"{CGSize="width"d"height"d}}`, Offset: 16},
+		},
+		Props: []objc.Property{
+			{Name: "name", EncodedAttributes: `T@"NSString",C,N,V_name`},
+			{Name: "frame", EncodedAttributes: `T{CGRect={CGPoint=dd}{CGSize=dd}},R,N,V_frame`},
+			{Name: "enabled", EncodedAttributes: `TB,N,GisEnabled,D`},
+		},
+		ClassMethods: []objc.Method{
+			{Name: "sharedInstance", Types: "@16@0:8"},
+		},
+		InstanceMethods: []objc.Method{
+			{Name: ".cxx_destruct", Types: "v16@0:8"},
+			{Name: "initWithName:frame:", Types: "@56@0:8@16{CGRect={CGPoint=dd}{CGSize=dd}}24"},
+			{Name: "name", Types: "@16@0:8"},
+			{Name: "setName:", Types: "v24@0:8@16"},
+			{Name: "frame", Types: "{CGRect={CGPoint=dd}{CGSize=dd}}16@0:8"},
+			{Name: "performWithBlock:", Types: "v24@0:8@?16"},
+		},
+	}
+
+	want := "@interface Foo : NSObject <NSCopying>\n" +
+		"{\n" +
+		"    NSString *_name;\t// 8 = 0x8\n" +
+		"    struct CGRect _frame;\t// 16 = 0x10\n" +
+		"}\n" +
+		"\n" +
+		"+ (id)sharedInstance;\n" +
+		"- (void).cxx_destruct;\n" +
+		"- (id)initWithName:(id)arg1 frame:(struct CGRect)arg2;\n" +
+		"@property(copy, nonatomic) NSString *name; // @synthesize name=_name;\n" +
+		"@property(readonly, nonatomic) struct CGRect frame; // @synthesize frame=_frame;\n" +
+		"- (void)performWithBlock:(CDUnknownBlockType)arg1;\n" +
+		"\n" +
+		"// Remaining properties\n" +
+		"@property(nonatomic, getter=isEnabled) _Bool enabled; // @dynamic enabled;\n" +
+		"\n" +
+		"@end\n"
+
+	if got := o.classDumpClass(class); got != want {
+		t.Errorf("classDumpClass() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestClassDumpProtocol(t *testing.T) {
+	o := &ObjC{conf: &ObjcConfig{Format: FormatClassDump}}
+	proto := &objc.Protocol{
+		Name:  "FooDelegate",
+		Prots: []objc.Protocol{{Name: "NSObject"}},
+		InstanceMethods: []objc.Method{
+			{Name: "fooDidFinish:", Types: "v24@0:8@16"},
+		},
+		OptionalInstanceMethods: []objc.Method{
+			{Name: "fooShouldStart:", Types: "B24@0:8@16"},
+		},
+		InstanceProperties: []objc.Property{
+			{Name: "count", EncodedAttributes: "Tq,R,N,?"},
+		},
+	}
+
+	want := "@protocol FooDelegate <NSObject>\n" +
+		"- (void)fooDidFinish:(id)arg1;\n" +
+		"\n" +
+		"@optional\n" +
+		"- (_Bool)fooShouldStart:(id)arg1;\n" +
+		"\n" +
+		"// Remaining properties\n" +
+		"@property(readonly, nonatomic) long long count;\n" +
+		"@end\n"
+
+	if got := o.classDumpProtocol(proto); got != want {
+		t.Errorf("classDumpProtocol() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestClassDumpStructures(t *testing.T) {
+	types := cdTypes(
+		[]objc.Ivar{{Name: "_frame", Type: `{CGRect="origin"{CGPoint="x"d"y"d}"size"{CGSize="width"d"height"d}}`}},
+		[]objc.Property{{Name: "frame", EncodedAttributes: `T{CGRect={CGPoint=dd}{CGSize=dd}},R,N,V_frame`}},
+		[]objc.Method{{Name: "setRange:", Types: "v32@0:8{_NSRange=QQ}16"}},
+	)
+
+	want := "#pragma mark Named Structures\n" +
+		"\n" +
+		"struct CGPoint {\n" +
+		"    double x;\t// 0 = 0x0\n" +
+		"    double y;\t// 8 = 0x8\n" +
+		"};\t// size 16 = 0x10\n" +
+		"\n" +
+		"struct CGRect {\n" +
+		"    struct CGPoint origin;\t// 0 = 0x0\n" +
+		"    struct CGSize size;\t// 16 = 0x10\n" +
+		"};\t// size 32 = 0x20\n" +
+		"\n" +
+		"struct CGSize {\n" +
+		"    double width;\t// 0 = 0x0\n" +
+		"    double height;\t// 8 = 0x8\n" +
+		"};\t// size 16 = 0x10\n" +
+		"\n" +
+		"struct _NSRange {\n" +
+		"    unsigned long long _field1;\t// 0 = 0x0\n" +
+		"    unsigned long long _field2;\t// 8 = 0x8\n" +
+		"};\t// size 16 = 0x10\n"
+
+	got := classDumpStructures("v1.0.0", types)
+	if _, body, _ := strings.Cut(got, "//\n\n"); body != want {
+		t.Errorf("classDumpStructures() =\n%s\nwant:\n%s", body, want)
+	}
+}
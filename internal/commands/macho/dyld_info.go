@@ -0,0 +1,325 @@
+package macho
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/pkg/trie"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/go-macho/types/objc"
+)
+
+// DyldInfoConfig selects the sections of an Apple `dyld_info` compatible report
+type DyldInfoConfig struct {
+	Platform bool
+	Exports  bool
+	Fixups   bool
+	ObjC     bool
+}
+
+// dyldPlatformNames are the platform names as printed by dyld (MachOFile::platformName)
+var dyldPlatformNames = map[types.Platform]string{
+	types.Platform_macOS:             "macOS",
+	types.Platform_iOS:               "iOS",
+	types.Platform_tvOS:              "tvOS",
+	types.Platform_watchOS:           "watchOS",
+	types.Platform_bridgeOS:          "bridgeOS",
+	types.Platform_macCatalyst:       "Mac Catalyst",
+	types.Platform_iOsSimulator:      "iOS Simulator",
+	types.Platform_tvOsSimulator:     "tvOS Simulator",
+	types.Platform_watchOsSimulator:  "watchOS Simulator",
+	types.Platform_Driverkit:         "driverKit",
+	types.Platform_visionOS:          "visionOS",
+	types.Platform_visionOsSimulator: "visionOS Simulator",
+	types.Platform_Firmware:          "firmware",
+	types.Platform_sepOS:             "sepOS",
+}
+
+// DyldInfo writes the same report Apple's `dyld_info` tool prints for a MachO (or dyld_shared_cache dylib)
+func DyldInfo(w io.Writer, m *macho.File, path string, conf *DyldInfoConfig) error {
+	fmt.Fprintf(w, "%s [%s]:\n", path, dyldArchName(m))
+	if conf.Platform {
+		writeDyldPlatform(w, m)
+	}
+	if conf.Exports {
+		if err := writeDyldExports(w, m); err != nil {
+			return err
+		}
+	}
+	if conf.Fixups {
+		if err := writeDyldFixups(w, m); err != nil {
+			return err
+		}
+	}
+	if conf.ObjC {
+		if err := writeDyldObjC(w, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dyldArchName(m *macho.File) string {
+	switch m.CPU {
+	case types.CPUArm64:
+		if (m.SubCPU & types.CpuSubtypeMask) == types.CPUSubtypeArm64E {
+			return "arm64e"
+		}
+		return "arm64"
+	case types.CPUArm6432:
+		return "arm64_32"
+	case types.CPUAmd64:
+		return "x86_64"
+	case types.CPUI386:
+		return "i386"
+	}
+	return strings.ToLower(m.CPU.String())
+}
+
+// dyldVersion formats a X.Y.Z nibble encoded version like dyld (the minor version is always printed)
+func dyldVersion(v types.Version) string {
+	if v&0xFF == 0 {
+		return fmt.Sprintf("%d.%d", v>>16, (v>>8)&0xFF)
+	}
+	return fmt.Sprintf("%d.%d.%d", v>>16, (v>>8)&0xFF, v&0xFF)
+}
+
+func writeDyldPlatform(w io.Writer, m *macho.File) {
+	fmt.Fprintln(w, "    -platform:")
+	fmt.Fprintln(w, "        platform     minOS      sdk")
+	line := func(p types.Platform, minOS, sdk types.Version) {
+		name, ok := dyldPlatformNames[p]
+		if !ok {
+			name = p.String()
+		}
+		fmt.Fprintf(w, " %15s     %-7s   %-7s\n", name, dyldVersion(minOS), dyldVersion(sdk))
+	}
+	for _, bv := range m.BuildVersions() {
+		line(bv.Platform, bv.Minos, bv.Sdk)
+	}
+	for _, l := range m.Loads {
+		switch v := l.(type) {
+		case *macho.VersionMinMacOSX:
+			line(types.Platform_macOS, v.Version, v.Sdk)
+		case *macho.VersionMiniPhoneOS:
+			line(types.Platform_iOS, v.Version, v.Sdk)
+		case *macho.VersionMinTvOS:
+			line(types.Platform_tvOS, v.Version, v.Sdk)
+		case *macho.VersionMinWatchOS:
+			line(types.Platform_watchOS, v.Version, v.Sdk)
+		}
+	}
+}
+
+func writeDyldExports(w io.Writer, m *macho.File) error {
+	fmt.Fprintln(w, "    -exports:")
+	fmt.Fprintln(w, "        offset      symbol")
+	var exports []trie.TrieExport
+	var err error
+	if m.DyldExportsTrie() != nil {
+		exports, err = m.DyldExports()
+	} else {
+		exports, err = m.GetExports()
+	}
+	if err != nil && !errors.Is(err, macho.ErrMachODyldInfoNotFound) {
+		return fmt.Errorf("failed to get exports: %v", err)
+	}
+	base := m.GetBaseAddress()
+	dylibs := m.ImportedLibraries()
+	for _, exp := range exports {
+		from := ""
+		if exp.Flags.ReExport() && exp.Other > 0 && exp.Other <= uint64(len(dylibs)) {
+			from = filepath.Base(dylibs[exp.Other-1])
+		}
+		fmt.Fprintln(w, dyldExportLine(exp, base, from))
+	}
+	return nil
+}
+
+// dyldExportLine formats an export trie entry like `dyld_info -exports`
+func dyldExportLine(exp trie.TrieExport, base uint64, from string) string {
+	var sb strings.Builder
+	offset := exp.Address - base
+	if exp.Flags.StubAndResolver() {
+		// go-macho reads the stub offset into Other and the resolver offset into Address
+		offset = exp.Other - base
+	}
+	if exp.Flags.ReExport() {
+		sb.WriteString("        [re-export] ")
+	} else {
+		fmt.Fprintf(&sb, "        0x%08X  ", offset)
+	}
+	sb.WriteString(exp.Name)
+	var attrs []string
+	if exp.Flags.WeakDefinition() {
+		attrs = append(attrs, "weak_def")
+	}
+	if exp.Flags.ThreadLocal() {
+		attrs = append(attrs, "per-thread")
+	}
+	if exp.Flags.Absolute() {
+		attrs = append(attrs, "absolute")
+	}
+	if exp.Flags.StubAndResolver() {
+		attrs = append(attrs, fmt.Sprintf("resolver=0x%08X", exp.Address-base))
+	}
+	if len(attrs) > 0 {
+		sb.WriteString(" [" + strings.Join(attrs, ", ") + "]")
+	}
+	if exp.Flags.ReExport() {
+		if exp.ReExport == "" || exp.ReExport == exp.Name {
+			fmt.Fprintf(&sb, " (from %s)", from)
+		} else {
+			fmt.Fprintf(&sb, " (%s from %s)", exp.ReExport, from)
+		}
+	}
+	return sb.String()
+}
+
+// dyldFixupLine formats a rebase or bind like `dyld_info -fixups`
+func dyldFixupLine(seg, sect string, addr uint64, auth, kind, target string) string {
+	return fmt.Sprintf("        %-12s    %-16s 0x%08X  %16s  %-6s  %s", seg, sect, addr, auth, kind, target)
+}
+
+// dyldBindTarget formats a bind target as <dylib>/<symbol>
+func dyldBindTarget(dylib, name string, addend int64, weak bool) string {
+	target := dylib + "/" + name
+	if addend != 0 {
+		target += fmt.Sprintf(" + 0x%X", addend)
+	}
+	if weak {
+		target += " [weak-import]"
+	}
+	return target
+}
+
+func dyldAuthInfo(fixup any) string {
+	if a, ok := fixup.(interface {
+		Key() uint64
+		AddrDiv() uint64
+		Diversity() uint64
+	}); ok {
+		addr := ""
+		if a.AddrDiv() == 1 {
+			addr = "addr "
+		}
+		return fmt.Sprintf("(%s %s0x%04X)", fixupchains.KeyName(a.Key()), addr, a.Diversity())
+	}
+	return ""
+}
+
+func writeDyldFixups(w io.Writer, m *macho.File) error {
+	fmt.Fprintln(w, "    -fixups:")
+	fmt.Fprintln(w, "        segment         section          address                 type   target")
+	sectName := func(addr uint64) string {
+		if sec := m.FindSectionForVMAddr(addr); sec != nil {
+			return sec.Name
+		}
+		return ""
+	}
+	if m.HasDyldChainedFixups() {
+		dcf, err := m.DyldChainedFixups()
+		if err != nil {
+			return fmt.Errorf("failed to parse chained fixups: %v", err)
+		}
+		base := m.GetBaseAddress()
+		segs := m.Segments()
+		for _, start := range dcf.Starts {
+			for _, fixup := range start.Fixups {
+				var seg *macho.Segment
+				for _, s := range segs {
+					if s.Filesz > 0 && fixup.Offset() >= s.Offset && fixup.Offset() < s.Offset+s.Filesz {
+						seg = s
+						break
+					}
+				}
+				if seg == nil {
+					return fmt.Errorf("fixup at %#x is not in a segment", fixup.Offset())
+				}
+				addr := seg.Addr + fixup.Offset() - seg.Offset
+				switch f := fixup.(type) {
+				case fixupchains.Rebase:
+					fmt.Fprintln(w, dyldFixupLine(seg.Name, sectName(addr), addr, dyldAuthInfo(f), "rebase",
+						fmt.Sprintf("0x%08X", rebaseTarget(start.PointerFormat, f, base))))
+				case fixupchains.Bind:
+					if f.Ordinal() >= uint64(len(dcf.Imports)) {
+						return fmt.Errorf("bind at %#x has an invalid import ordinal %d", addr, f.Ordinal())
+					}
+					imp := dcf.Imports[f.Ordinal()]
+					fmt.Fprintln(w, dyldFixupLine(seg.Name, sectName(addr), addr, dyldAuthInfo(f), "bind",
+						dyldBindTarget(m.LibraryOrdinalName(imp.LibOrdinal()), imp.Name, int64(imp.Addend())+bindAddend(f), imp.WeakImport())))
+				}
+			}
+		}
+		return nil
+	}
+	rebases, err := m.GetRebaseInfo()
+	if err != nil && !errors.Is(err, macho.ErrMachODyldInfoNotFound) {
+		return fmt.Errorf("failed to get rebase info: %v", err)
+	}
+	for _, r := range rebases {
+		fmt.Fprintln(w, dyldFixupLine(r.Segment, r.Section, r.Start+r.Offset, "", "rebase", fmt.Sprintf("0x%08X", r.Value)))
+	}
+	binds, err := m.GetBindInfo()
+	if err != nil && !errors.Is(err, macho.ErrMachODyldInfoNotFound) {
+		return fmt.Errorf("failed to get bind info: %v", err)
+	}
+	for _, b := range binds {
+		fmt.Fprintln(w, dyldFixupLine(b.Segment, b.Section, b.Start+b.SegOffset, "", "bind",
+			dyldBindTarget(b.Dylib, b.Name, b.Addend, b.Flags&types.BIND_SYMBOL_FLAGS_WEAK_IMPORT != 0)))
+	}
+	return nil
+}
+
+func writeDyldObjC(w io.Writer, m *macho.File) error {
+	fmt.Fprintln(w, "    -objc:")
+	if !m.HasObjC() {
+		return nil
+	}
+	methods := func(prefix string, meths []objc.Method) {
+		for _, meth := range meths {
+			fmt.Fprintf(w, "          0x%08X  %s%s\n", meth.ImpVMAddr, prefix, meth.Name)
+		}
+	}
+	classes, err := m.GetObjCClasses()
+	if err != nil && !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		return fmt.Errorf("failed to get objc classes: %v", err)
+	}
+	for _, c := range classes {
+		if c.SuperClass != "" {
+			fmt.Fprintf(w, "        @interface %s : %s\n", c.Name, c.SuperClass)
+		} else {
+			fmt.Fprintf(w, "        @interface %s\n", c.Name)
+		}
+		methods("+", c.ClassMethods)
+		methods("-", c.InstanceMethods)
+		fmt.Fprintln(w, "        @end")
+	}
+	cats, err := m.GetObjCCategories()
+	if err != nil && !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		return fmt.Errorf("failed to get objc categories: %v", err)
+	}
+	for _, c := range cats {
+		class := "?"
+		if c.Class != nil {
+			class = c.Class.Name
+		}
+		fmt.Fprintf(w, "        @interface %s(%s)\n", class, c.Name)
+		methods("+", c.ClassMethods)
+		methods("-", c.InstanceMethods)
+		fmt.Fprintln(w, "        @end")
+	}
+	protos, err := m.GetObjCProtocols()
+	if err != nil && !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		return fmt.Errorf("failed to get objc protocols: %v", err)
+	}
+	for _, p := range protos {
+		fmt.Fprintf(w, "        @protocol %s\n", p.Name)
+	}
+	return nil
+}
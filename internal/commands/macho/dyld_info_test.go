@@ -0,0 +1,41 @@
+package macho
+
+import (
+	"testing"
+
+	"github.com/blacktop/go-macho/pkg/trie"
+	"github.com/blacktop/go-macho/types"
+)
+
+func TestDyldVersion(t *testing.T) {
+	for v, want := range map[types.Version]string{
+		0x000e0000: "14.0",
+		0x000e0400: "14.4",
+		0x000a0f06: "10.15.6",
+	} {
+		if got := dyldVersion(v); got != want {
+			t.Errorf("dyldVersion(%#x) = %q, want %q", uint32(v), got, want)
+		}
+	}
+}
+
+func TestDyldExportLine(t *testing.T) {
+	const base = 0x180000000
+	for _, tt := range []struct {
+		exp  trie.TrieExport
+		from string
+		want string
+	}{
+		{trie.TrieExport{Name: "_objc_msgSend", Address: base + 0x6000}, "", "        0x00006000  _objc_msgSend"},
+		{trie.TrieExport{Name: "_foo", Address: base + 0x10, Flags: types.EXPORT_SYMBOL_FLAGS_WEAK_DEFINITION}, "", "        0x00000010  _foo [weak_def]"},
+		{trie.TrieExport{Name: "_bar", Flags: types.EXPORT_SYMBOL_FLAGS_REEXPORT, Other: 1}, "libsystem_c.dylib", "        [re-export] _bar (from libsystem_c.dylib)"},
+		{trie.TrieExport{Name: "_baz", ReExport: "_qux", Flags: types.EXPORT_SYMBOL_FLAGS_REEXPORT, Other: 1}, "libsystem_c.dylib", "        [re-export] _baz (_qux from libsystem_c.dylib)"},
+	} {
+		if got := dyldExportLine(tt.exp, base, tt.from); got != tt.want {
+			t.Errorf("dyldExportLine(%s) = %q, want %q", tt.exp.Name, got, tt.want)
+		}
+	}
+	if got, want := dyldBindTarget("libSystem.B.dylib", "_exit", 8, true), "libSystem.B.dylib/_exit + 0x8 [weak-import]"; got != want {
+		t.Errorf("dyldBindTarget() = %q, want %q", got, want)
+	}
+}
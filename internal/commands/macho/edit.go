@@ -0,0 +1,334 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// EditConfig are the load command edits to apply to a MachO (like install_name_tool and vtool)
+type EditConfig struct {
+	AddRpaths    []string
+	DeleteRpaths []string
+	Rpaths       [][2]string // OLD -> NEW rpaths
+	Changes      [][2]string // OLD -> NEW dependent dylib install names
+	ID           string      // dylib install name
+	// build version
+	Platform string
+	MinOS    string
+	SDK      string
+	// strip the LC_CODE_SIGNATURE (and its __LINKEDIT data)
+	RemoveSignature bool
+}
+
+func dylibCmd(l macho.Load) *macho.Dylib {
+	switch d := l.(type) {
+	case *macho.LoadDylib:
+		return &d.Dylib
+	case *macho.WeakDylib:
+		return &d.Dylib
+	case *macho.ReExportDylib:
+		return &d.Dylib
+	case *macho.LazyLoadDylib:
+		return &d.Dylib
+	case *macho.UpwardDylib:
+		return &d.Dylib
+	}
+	return nil
+}
+
+func setDylibName(m *macho.File, d *macho.Dylib, name string) {
+	prevLen := int32(d.Len)
+	d.Len = pointerAlign(uint32(binary.Size(types.DylibCmd{}) + len(name) + 1))
+	d.Name = name
+	m.ModifySizeCommands(prevLen, int32(d.Len))
+}
+
+func findRpath(m *macho.File, path string) *macho.Rpath {
+	for _, l := range m.Loads {
+		if rp, ok := l.(*macho.Rpath); ok && rp.Path == path {
+			return rp
+		}
+	}
+	return nil
+}
+
+func setRpath(m *macho.File, rp *macho.Rpath, path string) {
+	prevLen := int32(rp.Len)
+	rp.Len = pointerAlign(uint32(binary.Size(types.RpathCmd{}) + len(path) + 1))
+	rp.Path = path
+	m.ModifySizeCommands(prevLen, int32(rp.Len))
+}
+
+// versionMin returns the LC_VERSION_MIN_* load command (and the platform it implies)
+func versionMin(m *macho.File) (macho.Load, *macho.VersionMin, types.Platform) {
+	for _, l := range m.Loads {
+		switch v := l.(type) {
+		case *macho.VersionMinMacOSX:
+			return l, &v.VersionMin, types.Platform_macOS
+		case *macho.VersionMiniPhoneOS:
+			return l, &v.VersionMin, types.Platform_iOS
+		case *macho.VersionMinTvOS:
+			return l, &v.VersionMin, types.Platform_tvOS
+		case *macho.VersionMinWatchOS:
+			return l, &v.VersionMin, types.Platform_watchOS
+		}
+	}
+	return nil, nil, types.Platform_Unknown
+}
+
+func setBuildVersion(m *macho.File, name string, conf *EditConfig) error {
+	var (
+		platform types.Platform
+		minos    types.Version
+		sdk      types.Version
+		err      error
+		bv       *macho.BuildVersion
+		hasPlat  = len(conf.Platform) > 0
+		builds   = m.BuildVersions()
+	)
+	if hasPlat {
+		if platform, err = types.GetPlatformByName(conf.Platform); err != nil {
+			return fmt.Errorf("failed to parse platform name %s: %v", conf.Platform, err)
+		}
+	}
+	if len(conf.MinOS) > 0 {
+		if err := minos.Set(conf.MinOS); err != nil {
+			return fmt.Errorf("failed to parse min OS version: %v", err)
+		}
+	}
+	if len(conf.SDK) > 0 {
+		if err := sdk.Set(conf.SDK); err != nil {
+			return fmt.Errorf("failed to parse SDK version: %v", err)
+		}
+	}
+
+	switch {
+	case len(builds) == 1:
+		bv = builds[0]
+	case len(builds) > 1: // zippered (i.e. macOS + macCatalyst)
+		if !hasPlat {
+			return fmt.Errorf("%s has %d LC_BUILD_VERSION load commands; must supply the platform to modify", name, len(builds))
+		}
+		for _, b := range builds {
+			if b.Platform == platform {
+				bv = b
+			}
+		}
+		if bv == nil {
+			return fmt.Errorf("%s has no LC_BUILD_VERSION for platform %s", name, platform)
+		}
+	default:
+		oldLoad, oldMinVer, oldPlat := versionMin(m)
+		if oldLoad == nil && !hasPlat {
+			return fmt.Errorf("%s has no LC_BUILD_VERSION or LC_VERSION_MIN_* load command; must supply the platform to add one", name)
+		}
+		// replace the LC_VERSION_MIN_* with an LC_BUILD_VERSION (like vtool -set-build-version)
+		bv = &macho.BuildVersion{
+			BuildVersionCmd: types.BuildVersionCmd{
+				LoadCmd:  types.LC_BUILD_VERSION,
+				Len:      uint32(binary.Size(types.BuildVersionCmd{})),
+				Platform: oldPlat,
+			},
+		}
+		if oldMinVer != nil {
+			bv.Minos = oldMinVer.Version
+			bv.Sdk = oldMinVer.Sdk
+			if err := m.RemoveLoad(oldLoad); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", oldLoad.Command(), err)
+			}
+		}
+		m.AddLoad(bv)
+	}
+
+	if hasPlat {
+		bv.Platform = platform
+	}
+	if len(conf.MinOS) > 0 {
+		bv.Minos = minos
+	}
+	if len(conf.SDK) > 0 {
+		bv.Sdk = sdk
+	}
+	log.Debugf("Setting build version of %s to platform=%s minos=%s sdk=%s", name, bv.Platform, bv.Minos, bv.Sdk)
+	return nil
+}
+
+func removeSignature(m *macho.File, name string) error {
+	cs := m.CodeSignature()
+	if cs == nil {
+		log.Warnf("%s is not code signed", name)
+		return nil
+	}
+	linkedit := m.Segment("__LINKEDIT")
+	if linkedit == nil {
+		return fmt.Errorf("failed to find __LINKEDIT segment in %s", name)
+	}
+	if uint64(cs.Offset) < linkedit.Offset || uint64(cs.Offset) > linkedit.Offset+linkedit.Filesz {
+		return fmt.Errorf("code signature of %s is not in the __LINKEDIT segment", name)
+	}
+	if err := m.RemoveLoad(cs); err != nil {
+		return fmt.Errorf("failed to remove LC_CODE_SIGNATURE: %v", err)
+	}
+	// the signature is always the last thing in __LINKEDIT
+	linkedit.Filesz = uint64(cs.Offset) - linkedit.Offset
+	return nil
+}
+
+// loadCommandSpace returns the number of bytes available for the load commands (before the first section's data)
+func loadCommandSpace(m *macho.File) uint64 {
+	space := uint64(0)
+	for _, sec := range m.Sections {
+		if sec.Offset == 0 || sec.Size == 0 {
+			continue // zerofill
+		}
+		if space == 0 || uint64(sec.Offset) < space {
+			space = uint64(sec.Offset)
+		}
+	}
+	if space == 0 {
+		return 0
+	}
+	return space - uint64(m.HdrSize())
+}
+
+// Edit applies the load command edits to the MachO
+func Edit(m *macho.File, name string, conf *EditConfig) error {
+	if len(conf.ID) > 0 {
+		id := m.DylibID()
+		if m.Type != types.MH_DYLIB || id == nil {
+			return fmt.Errorf("%s is not a dylib; can only change the install name of a dylib", name)
+		}
+		log.Infof("Changing %s install name %s -> %s", name, id.Name, conf.ID)
+		setDylibName(m, &id.Dylib, conf.ID)
+	}
+
+	for _, change := range conf.Changes {
+		found := false
+		for _, l := range m.Loads {
+			if d := dylibCmd(l); d != nil && d.Name == change[0] {
+				log.Infof("Changing %s dependency %s -> %s", name, change[0], change[1])
+				setDylibName(m, d, change[1])
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s does not load %s", name, change[0])
+		}
+	}
+
+	for _, rpath := range conf.DeleteRpaths {
+		rp := findRpath(m, rpath)
+		if rp == nil {
+			return fmt.Errorf("%s has no LC_RPATH %s", name, rpath)
+		}
+		log.Infof("Deleting %s LC_RPATH %s", name, rpath)
+		if err := m.RemoveLoad(rp); err != nil {
+			return fmt.Errorf("failed to remove LC_RPATH %s: %v", rpath, err)
+		}
+	}
+	for _, rpath := range conf.Rpaths {
+		rp := findRpath(m, rpath[0])
+		if rp == nil {
+			return fmt.Errorf("%s has no LC_RPATH %s", name, rpath[0])
+		}
+		if findRpath(m, rpath[1]) != nil {
+			return fmt.Errorf("%s already has LC_RPATH %s", name, rpath[1])
+		}
+		log.Infof("Changing %s LC_RPATH %s -> %s", name, rpath[0], rpath[1])
+		setRpath(m, rp, rpath[1])
+	}
+	for _, rpath := range conf.AddRpaths {
+		if findRpath(m, rpath) != nil {
+			return fmt.Errorf("%s already has LC_RPATH %s", name, rpath)
+		}
+		log.Infof("Adding %s LC_RPATH %s", name, rpath)
+		m.AddLoad(&macho.Rpath{
+			RpathCmd: types.RpathCmd{
+				LoadCmd:    types.LC_RPATH,
+				Len:        pointerAlign(uint32(binary.Size(types.RpathCmd{}) + len(rpath) + 1)),
+				PathOffset: 0xC,
+			},
+			Path: rpath,
+		})
+	}
+
+	if len(conf.Platform) > 0 || len(conf.MinOS) > 0 || len(conf.SDK) > 0 {
+		log.Infof("Setting %s build version", name)
+		if err := setBuildVersion(m, name, conf); err != nil {
+			return err
+		}
+	}
+
+	if conf.RemoveSignature {
+		log.Infof("Removing %s code signature", name)
+		if err := removeSignature(m, name); err != nil {
+			return err
+		}
+	}
+
+	if space := loadCommandSpace(m); space > 0 && uint64(m.SizeCommands) > space {
+		return fmt.Errorf("not enough space in %s for the load commands (need %#x bytes, have %#x); relink it with a larger -headerpad", name, m.SizeCommands, space)
+	}
+
+	return nil
+}
+
+// SaveEdit writes the edited MachO to output
+//
+// Unlike (*macho.File).Save it keeps the original file layout (segment padding, etc.)
+// and only rewrites the header and load commands (and truncates a removed code signature)
+func SaveEdit(m *macho.File, output string) error {
+	var size uint64
+	for _, seg := range m.Segments() {
+		size = max(size, seg.Offset+seg.Filesz)
+	}
+	dat := make([]byte, size)
+	if _, err := m.ReadAt(dat, 0); err != nil {
+		return fmt.Errorf("failed to read MachO data: %v", err)
+	}
+	if err := putLoadCommands(m, dat); err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, dat, 0755); err != nil {
+		return fmt.Errorf("failed to write %s: %v", output, err)
+	}
+	return nil
+}
+
+// putLoadCommands overwrites the header and load commands at the start of the MachO's data with the (edited) ones
+func putLoadCommands(m *macho.File, dat []byte) error {
+	var buf bytes.Buffer
+	if err := m.FileHeader.Write(&buf, m.ByteOrder); err != nil {
+		return fmt.Errorf("failed to write file header: %v", err)
+	}
+	for _, l := range m.Loads {
+		if err := l.Write(&buf, m.ByteOrder); err != nil {
+			return fmt.Errorf("failed to write %s: %v", l.Command(), err)
+		}
+		if seg, ok := l.(*macho.Segment); ok {
+			for _, sec := range m.Sections[seg.Firstsect : seg.Firstsect+seg.Nsect] {
+				if err := sec.Write(&buf, m.ByteOrder); err != nil {
+					return fmt.Errorf("failed to write section %s.%s: %v", sec.Seg, sec.Name, err)
+				}
+			}
+		}
+	}
+	if uint32(buf.Len()) != m.HdrSize()+m.SizeCommands {
+		return fmt.Errorf("load commands are %#x bytes, but header sizeofcmds is %#x", uint32(buf.Len())-m.HdrSize(), m.SizeCommands)
+	}
+	if buf.Len() > len(dat) {
+		return fmt.Errorf("load commands are larger than the MachO")
+	}
+	// zero out the (now unused) end of the old load commands
+	if space := loadCommandSpace(m); space > 0 {
+		clear(dat[buf.Len():min(uint64(m.HdrSize())+space, uint64(len(dat)))])
+	}
+	copy(dat, buf.Bytes())
+	return nil
+}
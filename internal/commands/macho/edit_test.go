@@ -0,0 +1,114 @@
+package macho
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/fixture"
+)
+
+// writeDylib writes a signed fixture dylib whose __text starts at textAlign (the headerpad available for edits)
+func writeDylib(t *testing.T, textAlign uint32) string {
+	t.Helper()
+	f := fixture.NewMachO(types.MH_DYLIB)
+	f.InstallName = "/usr/lib/libfixture.dylib"
+	f.Signed = true
+	f.Segment("__TEXT").AddSection("__text", make([]byte, 16)).Align = textAlign
+	f.AddSymbol("_fixture", "__TEXT", "__text", 0)
+	path := filepath.Join(t.TempDir(), "libfixture.dylib")
+	if err := f.WriteFile(path, 0x180000000); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEdit(t *testing.T) {
+	path := writeDylib(t, 12)
+	m, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.CodeSignature() == nil {
+		t.Fatal("fixture dylib is not signed")
+	}
+
+	if err := Edit(m, "libfixture.dylib", &EditConfig{
+		ID:              "@rpath/libfixture.dylib",
+		AddRpaths:       []string{"@loader_path/Frameworks"},
+		Platform:        "macos",
+		MinOS:           "14.2",
+		SDK:             "14.4",
+		RemoveSignature: true,
+	}); err != nil {
+		t.Fatalf("Edit() = %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "libfixture.edited.dylib")
+	if err := SaveEdit(m, out); err != nil {
+		t.Fatalf("SaveEdit() = %v", err)
+	}
+
+	em, err := macho.Open(out)
+	if err != nil {
+		t.Fatalf("failed to reparse edited dylib: %v", err)
+	}
+	defer em.Close()
+	if id := em.DylibID(); id == nil || id.Name != "@rpath/libfixture.dylib" {
+		t.Errorf("DylibID() = %v, want @rpath/libfixture.dylib", id)
+	}
+	if findRpath(em, "@loader_path/Frameworks") == nil {
+		t.Errorf("edited dylib has no LC_RPATH @loader_path/Frameworks")
+	}
+	if bvs := em.BuildVersions(); len(bvs) != 1 || bvs[0].Platform != types.Platform_macOS || bvs[0].Minos.String() != "14.2" || bvs[0].Sdk.String() != "14.4" {
+		t.Errorf("BuildVersions() = %v, want macOS 14.2 (SDK 14.4)", bvs)
+	}
+	if em.CodeSignature() != nil {
+		t.Errorf("edited dylib is still signed")
+	}
+	if addr, err := em.FindSymbolAddress("_fixture"); err != nil || addr != em.Section("__TEXT", "__text").Addr {
+		t.Errorf("FindSymbolAddress(_fixture) = %#x, %v", addr, err)
+	}
+
+	// the signature is truncated from the end of the file and __LINKEDIT
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkedit := em.Segment("__LINKEDIT")
+	if uint64(fi.Size()) != linkedit.Offset+linkedit.Filesz || fi.Size() >= orig.Size() {
+		t.Errorf("edited dylib is %#x bytes (was %#x), want __LINKEDIT end %#x", fi.Size(), orig.Size(), linkedit.Offset+linkedit.Filesz)
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	path := writeDylib(t, 2) // __text right after the load commands
+	for _, tt := range []struct {
+		name string
+		conf *EditConfig
+		want string
+	}{
+		{"headerpad", &EditConfig{AddRpaths: []string{"@executable_path/../Frameworks/Some.framework/Versions/A/Frameworks"}}, "-headerpad"},
+		{"missing rpath", &EditConfig{DeleteRpaths: []string{"@loader_path"}}, "has no LC_RPATH"},
+		{"missing dylib", &EditConfig{Changes: [][2]string{{"/usr/lib/libz.dylib", "/usr/lib/libz.1.dylib"}}}, "does not load"},
+		{"platform", &EditConfig{Platform: "palmos"}, "failed to parse platform"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := macho.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			if err := Edit(m, "libfixture.dylib", tt.conf); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Edit() = %v, want %q error", err, tt.want)
+			}
+		})
+	}
+}
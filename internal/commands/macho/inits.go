@@ -0,0 +1,217 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	ctypes "github.com/blacktop/go-macho/pkg/codesign/types"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/go-macho/types/objc"
+)
+
+// Initializer kinds
+const (
+	InitConstructor = "constructor" // __attribute__((constructor)) functions
+	InitStatic      = "static"      // C++ static initializers
+	InitObjcLoad    = "+load"       // ObjC +load class and category methods
+	InitTerminator  = "terminator"  // __attribute__((destructor)) functions
+	cxxStaticPrefix = "__GLOBAL__sub_I_"
+)
+
+// Initializer is a function that runs when an image is loaded (or unloaded)
+type Initializer struct {
+	Kind    string `json:"kind"`
+	Address uint64 `json:"address"`
+	Symbol  string `json:"symbol,omitempty"`
+	Section string `json:"section,omitempty"`
+}
+
+func (i Initializer) String() string {
+	sym := i.Symbol
+	if sym == "" {
+		sym = "?"
+	}
+	return fmt.Sprintf("%#x: %-12s %s", i.Address, i.Kind, sym)
+}
+
+// Inits are an image's initializers and the code signing properties that affect dylib injection
+type Inits struct {
+	Image        string        `json:"image"`
+	Initializers []Initializer `json:"initializers"`
+	// restrictions that prevent (or limit) DYLD_INSERT_LIBRARIES injection
+	Restrictions []string `json:"restrictions,omitempty"`
+}
+
+func initSymbol(m *macho.File, addr uint64) string {
+	if syms, err := m.FindAddressSymbols(addr); err == nil {
+		for _, sym := range syms {
+			if sym.Name != "" && sym.Name != "<redacted>" {
+				return sym.Name
+			}
+		}
+	}
+	return ""
+}
+
+func kindForSymbol(sym, kind string) string {
+	if strings.HasPrefix(strings.TrimPrefix(sym, "_"), cxxStaticPrefix) || strings.HasPrefix(sym, "__GLOBAL__I_") {
+		return InitStatic
+	}
+	return kind
+}
+
+// initPointers returns the function pointers of the __mod_init_func/__mod_term_func style sections
+func initPointers(m *macho.File, sec *types.Section) ([]uint64, error) {
+	dat, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+	}
+	var ptrs []uint64
+	if m.Magic == types.Magic32 {
+		p32 := make([]uint32, len(dat)/4)
+		if err := binary.Read(bytes.NewReader(dat), m.ByteOrder, &p32); err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s pointers: %v", sec.Seg, sec.Name, err)
+		}
+		for _, p := range p32 {
+			ptrs = append(ptrs, uint64(p))
+		}
+		return ptrs, nil
+	}
+	ptrs = make([]uint64, len(dat)/8)
+	if err := binary.Read(bytes.NewReader(dat), m.ByteOrder, &ptrs); err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s pointers: %v", sec.Seg, sec.Name, err)
+	}
+	for i, p := range ptrs {
+		ptrs[i] = m.SlidePointer(p)
+	}
+	return ptrs, nil
+}
+
+// initOffsets returns the function addresses of a __TEXT.__init_offsets section (32-bit offsets from the image base)
+func initOffsets(m *macho.File, sec *types.Section) ([]uint64, error) {
+	dat, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+	}
+	offs := make([]uint32, len(dat)/4)
+	if err := binary.Read(bytes.NewReader(dat), m.ByteOrder, &offs); err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s offsets: %v", sec.Seg, sec.Name, err)
+	}
+	addrs := make([]uint64, 0, len(offs))
+	for _, off := range offs {
+		addrs = append(addrs, m.GetBaseAddress()+uint64(off))
+	}
+	return addrs, nil
+}
+
+func loadMethods(prefix string, methods []objc.Method) []Initializer {
+	var inits []Initializer
+	for _, meth := range methods {
+		if meth.Name == "load" {
+			inits = append(inits, Initializer{
+				Kind:    InitObjcLoad,
+				Address: meth.ImpVMAddr,
+				Symbol:  fmt.Sprintf("+[%s load]", prefix),
+			})
+		}
+	}
+	return inits
+}
+
+// injectionRestrictions returns the reasons dyld would ignore (or limit) DYLD_INSERT_LIBRARIES for the image
+func injectionRestrictions(m *macho.File) []string {
+	var restrictions []string
+	if m.Section("__RESTRICT", "__restrict") != nil {
+		restrictions = append(restrictions, "__RESTRICT.__restrict section")
+	}
+	if cs := m.CodeSignature(); cs != nil {
+		if len(cs.CodeDirectories) > 0 {
+			flags := cs.CodeDirectories[0].Header.Flags
+			if flags&ctypes.RESTRICT != 0 {
+				restrictions = append(restrictions, "restrict code signing flag")
+			}
+			if flags&ctypes.RUNTIME != 0 && !strings.Contains(cs.Entitlements, "com.apple.security.cs.allow-dyld-environment-variables") {
+				restrictions = append(restrictions, "hardened runtime (without com.apple.security.cs.allow-dyld-environment-variables)")
+			}
+			if flags&ctypes.REQUIRE_LV != 0 || (flags&ctypes.RUNTIME != 0 && !strings.Contains(cs.Entitlements, "com.apple.security.cs.disable-library-validation")) {
+				restrictions = append(restrictions, "library validation (injected dylibs must be signed by Apple or the same team)")
+			}
+		}
+	}
+	return restrictions
+}
+
+// GetInits returns the image's constructors, C++ static initializers, ObjC +load methods and terminators (in the order dyld runs them)
+func GetInits(m *macho.File, image string) (*Inits, error) {
+	inits := &Inits{
+		Image:        image,
+		Restrictions: injectionRestrictions(m),
+	}
+
+	// ObjC +load methods run before the image's initializers
+	if m.HasObjC() {
+		classes, err := m.GetObjCNonLazyClasses()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ObjC non-lazy classes: %v", err)
+		}
+		for _, class := range classes {
+			inits.Initializers = append(inits.Initializers, loadMethods(class.Name, class.ClassMethods)...)
+		}
+		cats, err := m.GetObjCNonLazyCategories()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ObjC non-lazy categories: %v", err)
+		}
+		for _, cat := range cats {
+			name := cat.Name
+			if cat.Class != nil {
+				name = fmt.Sprintf("%s(%s)", cat.Class.Name, cat.Name)
+			}
+			inits.Initializers = append(inits.Initializers, loadMethods(name, cat.ClassMethods)...)
+		}
+	}
+
+	var terms []Initializer
+	for _, sec := range m.Sections {
+		var (
+			addrs []uint64
+			err   error
+			kind  string
+		)
+		switch {
+		case sec.Flags.IsModInitFuncPointers():
+			addrs, err = initPointers(m, sec)
+			kind = InitConstructor
+		case sec.Flags.IsInitFuncOffsets():
+			addrs, err = initOffsets(m, sec)
+			kind = InitConstructor
+		case sec.Flags.IsModTermFuncPointers():
+			addrs, err = initPointers(m, sec)
+			kind = InitTerminator
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			sym := initSymbol(m, addr)
+			init := Initializer{
+				Kind:    kindForSymbol(sym, kind),
+				Address: addr,
+				Symbol:  sym,
+				Section: fmt.Sprintf("%s.%s", sec.Seg, sec.Name),
+			}
+			if kind == InitTerminator {
+				terms = append(terms, init)
+			} else {
+				inits.Initializers = append(inits.Initializers, init)
+			}
+		}
+	}
+	inits.Initializers = append(inits.Initializers, terms...)
+
+	return inits, nil
+}
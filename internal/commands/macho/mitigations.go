@@ -0,0 +1,249 @@
+package macho
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	ctypes "github.com/blacktop/go-macho/pkg/codesign/types"
+	"github.com/blacktop/go-macho/types"
+)
+
+// Mitigations are the hardening features a MachO was built with
+type Mitigations struct {
+	Path string `json:"path"`
+	Arch string `json:"arch"`
+
+	PIE            bool `json:"pie"`
+	StackProtector bool `json:"stack_protector"` // imports ___stack_chk_guard/___stack_chk_fail
+	// PAC is an arm64e binary (signed pointers); PACRet are the functions with a signed return address prologue
+	PAC             bool    `json:"pac"`
+	PACRet          int     `json:"pac_ret"`
+	Functions       int     `json:"functions"`
+	PACInstructions int     `json:"pac_instructions"` // pac*/aut*/*raa/*rab/ldra* instructions
+	PACDensity      float64 `json:"pac_density"`      // PAC instructions per 1000 instructions
+	BTI             int     `json:"bti"`              // BTI landing pads (forward edge CFI)
+	// ARC is an ObjC binary that uses the ARC runtime entry points (only set for ObjC binaries)
+	ObjC bool `json:"objc"`
+	ARC  bool `json:"arc"`
+	// Fortify are the _FORTIFY_SOURCE checked libc functions (i.e. ___memcpy_chk) and Unfortified the unchecked
+	// ones that a checked variant exists for
+	Fortify           []string `json:"fortify,omitempty"`
+	Unfortified       []string `json:"unfortified,omitempty"`
+	HardenedRuntime   bool     `json:"hardened_runtime"`
+	LibraryValidation bool     `json:"library_validation"`
+	Restrict          bool     `json:"restrict"`
+
+	Score int `json:"score"` // the percentage of the applicable mitigations that are used
+}
+
+// fortifiable are the libc functions that _FORTIFY_SOURCE replaces with ___<name>_chk
+var fortifiable = []string{
+	"memcpy", "memmove", "memset", "strcpy", "stpcpy", "strncpy", "stpncpy", "strcat", "strncat", "strlcpy",
+	"strlcat", "sprintf", "snprintf", "vsprintf", "vsnprintf",
+}
+
+// arcEntryPoints are the ObjC runtime functions that only ARC code calls
+var arcEntryPoints = []string{
+	"_objc_storeStrong", "_objc_retainAutoreleasedReturnValue", "_objc_autoreleaseReturnValue",
+	"_objc_claimAutoreleasedReturnValue", "_objc_retainAutoreleaseReturnValue", "_objc_unsafeClaimAutoreleasedReturnValue",
+	"_objc_retainAutorelease", "_objc_initWeak", "_objc_destroyWeak",
+}
+
+const (
+	insnPACIASP = 0xd503233f
+	insnPACIBSP = 0xd503237f
+)
+
+// isPACInstruction returns true for the arm64e pointer authentication instructions
+func isPACInstruction(insn uint32) bool {
+	switch {
+	case insn&0xffff0000 == 0xdac10000 && (insn>>10)&0x3f <= 0x11: // PAC*, AUT*, XPAC*
+		return true
+	case insn&0xfffffd1f == 0xd503211f: // PACIA1716/PACIB1716/AUTIA1716/AUTIB1716 (and XPACLRI)
+		return true
+	case insn&0xffffff1f == 0xd503231f: // PACIAZ/PACIASP/PACIBZ/PACIBSP/AUTIAZ/AUTIASP/AUTIBZ/AUTIBSP
+		return true
+	case insn&0xfffffbff == 0xd65f0bff: // RETAA/RETAB
+		return true
+	case insn&0xfedff800 == 0xd61f0800: // BRAA/BRAB/BLRAA/BLRAB/BRAAZ/BRABZ/BLRAAZ/BLRABZ
+		return true
+	case insn&0xff200400 == 0xf8200400: // LDRAA/LDRAB
+		return true
+	}
+	return false
+}
+
+// isBTI returns true for the BTI (branch target identification) landing pads
+func isBTI(insn uint32) bool {
+	return insn&0xffffff3f == 0xd503241f
+}
+
+// GetMitigations returns the hardening features a MachO was built with
+func GetMitigations(m *macho.File, path string) (*Mitigations, error) {
+	mit := &Mitigations{
+		Path: path,
+		Arch: m.CPU.String(),
+		PIE:  m.Flags.PIE(),
+		PAC:  m.CPU == types.CPUArm64 && (m.SubCPU&types.CpuSubtypeMask) == types.CPUSubtypeArm64E,
+		ObjC: m.HasObjC(),
+	}
+	if mit.PAC {
+		mit.Arch = "arm64e"
+	}
+
+	imports, err := m.ImportedSymbolNames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get imported symbols: %v", err)
+	}
+	for _, name := range imports {
+		switch {
+		case name == "___stack_chk_guard" || name == "___stack_chk_fail":
+			mit.StackProtector = true
+		case slices.Contains(arcEntryPoints, name):
+			mit.ARC = true
+		case strings.HasPrefix(name, "___") && strings.HasSuffix(name, "_chk") && slices.Contains(fortifiable, strings.TrimSuffix(strings.TrimPrefix(name, "___"), "_chk")):
+			mit.Fortify = append(mit.Fortify, strings.TrimPrefix(name, "_"))
+		case strings.HasPrefix(name, "_") && slices.Contains(fortifiable, name[1:]):
+			mit.Unfortified = append(mit.Unfortified, name[1:])
+		}
+	}
+	mit.ARC = mit.ARC && mit.ObjC
+	sort.Strings(mit.Fortify)
+	sort.Strings(mit.Unfortified)
+
+	if cs := m.CodeSignature(); cs != nil && len(cs.CodeDirectories) > 0 {
+		flags := cs.CodeDirectories[0].Header.Flags
+		mit.HardenedRuntime = flags&ctypes.RUNTIME != 0
+		mit.LibraryValidation = flags&ctypes.REQUIRE_LV != 0 || mit.HardenedRuntime
+		mit.Restrict = flags&ctypes.RESTRICT != 0
+	}
+	mit.Restrict = mit.Restrict || m.Section("__RESTRICT", "__restrict") != nil
+
+	if text := m.Section("__TEXT", "__text"); text != nil && text.Size > 0 {
+		code, err := text.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read __TEXT.__text data: %v", err)
+		}
+		if m.CPU == types.CPUArm64 {
+			for i := 0; i+4 <= len(code); i += 4 {
+				insn := binary.LittleEndian.Uint32(code[i:])
+				if isPACInstruction(insn) {
+					mit.PACInstructions++
+				} else if isBTI(insn) {
+					mit.BTI++
+				}
+			}
+			mit.PACDensity = float64(mit.PACInstructions) * 1000 / float64(len(code)/4)
+			for _, fn := range m.GetFunctions() {
+				mit.Functions++
+				// the prologue can be preceded by a BTI landing pad
+				for off := fn.StartAddr - text.Addr; off < fn.StartAddr-text.Addr+8 && off+4 <= uint64(len(code)); off += 4 {
+					if insn := binary.LittleEndian.Uint32(code[off:]); insn == insnPACIBSP || insn == insnPACIASP {
+						mit.PACRet++
+						break
+					}
+				}
+			}
+		}
+	}
+
+	mit.Score = mit.score()
+	return mit, nil
+}
+
+func (mit *Mitigations) score() int {
+	var have, applicable int
+	check := func(ok bool) {
+		applicable++
+		if ok {
+			have++
+		}
+	}
+	check(mit.PIE)
+	check(mit.StackProtector)
+	if strings.HasPrefix(mit.Arch, "arm64") {
+		check(mit.PAC)
+	}
+	if mit.ObjC {
+		check(mit.ARC)
+	}
+	if len(mit.Fortify)+len(mit.Unfortified) > 0 {
+		check(len(mit.Unfortified) == 0)
+	}
+	return have * 100 / applicable
+}
+
+// Features returns the names of the mitigations the MachO uses
+func (mit *Mitigations) Features() []string {
+	var features []string
+	for _, f := range []struct {
+		name string
+		ok   bool
+	}{
+		{"pie", mit.PIE},
+		{"stack-protector", mit.StackProtector},
+		{"pac", mit.PAC},
+		{"bti", mit.BTI > 0},
+		{"arc", mit.ARC},
+		{"fortify", len(mit.Fortify) > 0},
+		{"hardened-runtime", mit.HardenedRuntime},
+		{"library-validation", mit.LibraryValidation},
+		{"restrict", mit.Restrict},
+	} {
+		if f.ok {
+			features = append(features, f.name)
+		}
+	}
+	return features
+}
+
+// Scorecard aggregates the mitigations of every MachO in a build
+type Scorecard struct {
+	Binaries int `json:"binaries"`
+	// the number of binaries that use each mitigation (see Mitigations.Features)
+	Features map[string]int `json:"features"`
+	ObjC     int            `json:"objc"`
+	// AvgPACRet is the average percentage of the arm64e binaries' functions with a signed return address prologue
+	AvgPACRet float64 `json:"avg_pac_ret"`
+	AvgScore  float64 `json:"avg_score"`
+	// Weakest are the binaries with the lowest scores (least hardened first)
+	Weakest []*Mitigations `json:"weakest,omitempty"`
+}
+
+// NewScorecard aggregates the mitigations into a scorecard (keeping the weakest n binaries)
+func NewScorecard(mits []*Mitigations, weakest int) *Scorecard {
+	sc := &Scorecard{Binaries: len(mits), Features: make(map[string]int)}
+	var pacBins int
+	for _, mit := range mits {
+		for _, f := range mit.Features() {
+			sc.Features[f]++
+		}
+		if mit.ObjC {
+			sc.ObjC++
+		}
+		if mit.PAC && mit.Functions > 0 {
+			sc.AvgPACRet += float64(mit.PACRet) * 100 / float64(mit.Functions)
+			pacBins++
+		}
+		sc.AvgScore += float64(mit.Score)
+	}
+	if pacBins > 0 {
+		sc.AvgPACRet /= float64(pacBins)
+	}
+	if len(mits) > 0 {
+		sc.AvgScore /= float64(len(mits))
+	}
+	sorted := slices.Clone(mits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Score != sorted[j].Score {
+			return sorted[i].Score < sorted[j].Score
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	sc.Weakest = sorted[:min(weakest, len(sorted))]
+	return sc
+}
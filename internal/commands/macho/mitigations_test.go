@@ -0,0 +1,48 @@
+package macho
+
+import "testing"
+
+func TestIsPACInstruction(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		insn uint32
+		pac  bool
+	}{
+		{"pacibsp", 0xd503237f, true},
+		{"autibsp", 0xd50323ff, true},
+		{"retab", 0xd65f0fff, true},
+		{"blraa x8, x9", 0xd73f0909, true},
+		{"braaz x16", 0xd61f0a1f, true},
+		{"pacia x16, x17", 0xdac10230, true},
+		{"xpaci x0", 0xdac143e0, true},
+		{"ldraa x0, [x1]", 0xf8200420, true},
+		{"ret", 0xd65f03c0, false},
+		{"blr x8", 0xd63f0100, false},
+		{"nop", 0xd503201f, false},
+		{"bti c", 0xd503245f, false},
+	} {
+		if got := isPACInstruction(tt.insn); got != tt.pac {
+			t.Errorf("%s: isPACInstruction(%#x) = %v, want %v", tt.name, tt.insn, got, tt.pac)
+		}
+	}
+	if !isBTI(0xd503245f) || isBTI(0xd503201f) {
+		t.Error("isBTI failed to detect bti c")
+	}
+}
+
+func TestScorecard(t *testing.T) {
+	weak := &Mitigations{Path: "weak", Arch: "arm64", ObjC: true, Unfortified: []string{"strcpy"}}
+	weak.Score = weak.score()
+	strong := &Mitigations{Path: "strong", Arch: "arm64e", PIE: true, StackProtector: true, PAC: true, PACRet: 5, Functions: 10}
+	strong.Score = strong.score()
+	if weak.Score != 0 || strong.Score != 100 {
+		t.Fatalf("scores = %d/%d, want 0/100", weak.Score, strong.Score)
+	}
+	sc := NewScorecard([]*Mitigations{strong, weak}, 1)
+	if sc.Binaries != 2 || sc.ObjC != 1 || sc.Features["pac"] != 1 || sc.AvgScore != 50 || sc.AvgPACRet != 50 {
+		t.Errorf("unexpected scorecard %+v", sc)
+	}
+	if len(sc.Weakest) != 1 || sc.Weakest[0].Path != "weak" {
+		t.Errorf("weakest = %v, want [weak]", sc.Weakest)
+	}
+}
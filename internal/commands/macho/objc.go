@@ -18,8 +18,10 @@ import (
 	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/go-macho/types/objc"
 	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/stable"
 	"github.com/blacktop/ipsw/internal/swift"
 	"github.com/blacktop/ipsw/pkg/dyld"
+	objctype "github.com/blacktop/ipsw/pkg/objc"
 	"github.com/blacktop/ipsw/pkg/tbd"
 )
 
@@ -37,6 +39,7 @@ type ObjcConfig struct {
 	ObjcRefs bool
 	Deps     bool
 	Generic  bool
+	Format   string // output format (ipsw or class-dump)
 
 	IpswVersion string
 
@@ -94,6 +97,7 @@ type headerInfo struct {
 	BuildVersions []string
 	SourceVersion string
 	IsUmbrella    bool
+	ClassDump     bool // classic class-dump header (no include guards)
 	Name          string
 	Imports       Imports
 	Object        string
@@ -178,7 +182,9 @@ func (o *ObjC) DumpClass(pattern string) error {
 
 		for _, class := range classes {
 			if re.MatchString(class.Name) {
-				if o.conf.Color {
+				if o.classDump() {
+					o.printClassDump(o.classDumpClass(&class))
+				} else if o.conf.Color {
 					if o.conf.Addrs {
 						quick.Highlight(os.Stdout, swift.DemangleBlob(class.WithAddrs()), "objc", "terminal256", o.conf.Theme)
 					} else {
@@ -225,7 +231,9 @@ func (o *ObjC) DumpProtocol(pattern string) error {
 		for _, proto := range protos {
 			if re.MatchString(proto.Name) {
 				if _, ok := seen[proto.Ptr]; !ok { // prevent displaying duplicates
-					if o.conf.Color {
+					if o.classDump() {
+						o.printClassDump(o.classDumpProtocol(&proto))
+					} else if o.conf.Color {
 						if o.conf.Addrs {
 							quick.Highlight(os.Stdout, swift.DemangleBlob(proto.WithAddrs()), "objc", "terminal256", o.conf.Theme)
 						} else {
@@ -265,6 +273,7 @@ func (o *ObjC) DumpCategory(pattern string) error {
 			}
 			return err
 		}
+		resolveCategoryClasses(m, cats)
 
 		slices.SortStableFunc(cats, func(a, b objc.Category) int {
 			return cmp.Compare(a.Name, b.Name)
@@ -272,7 +281,9 @@ func (o *ObjC) DumpCategory(pattern string) error {
 
 		for _, cat := range cats {
 			if re.MatchString(cat.Name) {
-				if o.conf.Color {
+				if o.classDump() {
+					o.printClassDump(o.classDumpCategory(&cat))
+				} else if o.conf.Color {
 					if o.conf.Addrs {
 						quick.Highlight(os.Stdout, swift.DemangleBlob(cat.WithAddrs()), "objc", "terminal256", o.conf.Theme)
 					} else {
@@ -299,7 +310,7 @@ func (o *ObjC) Dump() error {
 		ms = append(ms, o.deps...)
 	}
 	for _, m := range ms {
-		if o.conf.Verbose {
+		if o.conf.Verbose && !o.classDump() {
 			if info, err := m.GetObjCImageInfo(); err == nil {
 				fmt.Println(info.Flags)
 			} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -315,7 +326,9 @@ func (o *ObjC) Dump() error {
 			seen := make(map[uint64]bool)
 			for _, proto := range protos {
 				if _, ok := seen[proto.Ptr]; !ok { // prevent displaying duplicates
-					if o.conf.Verbose {
+					if o.classDump() {
+						o.printClassDump(o.classDumpProtocol(&proto))
+					} else if o.conf.Verbose {
 						if o.conf.Color {
 							if o.conf.Addrs {
 								quick.Highlight(os.Stdout, swift.DemangleBlob(proto.WithAddrs()), "objc", "terminal256", o.conf.Theme)
@@ -349,7 +362,9 @@ func (o *ObjC) Dump() error {
 				return cmp.Compare(a.Name, b.Name)
 			})
 			for _, class := range classes {
-				if o.conf.Verbose {
+				if o.classDump() {
+					o.printClassDump(o.classDumpClass(&class))
+				} else if o.conf.Verbose {
 					if o.conf.Color {
 						if o.conf.Addrs {
 							quick.Highlight(os.Stdout, swift.DemangleBlob(class.WithAddrs()), "objc", "terminal256", o.conf.Theme)
@@ -377,11 +392,14 @@ func (o *ObjC) Dump() error {
 		}
 		/* ObjC Categories */
 		if cats, err := m.GetObjCCategories(); err == nil {
+			resolveCategoryClasses(m, cats)
 			slices.SortStableFunc(cats, func(a, b objc.Category) int {
 				return cmp.Compare(a.Name, b.Name)
 			})
 			for _, cat := range cats {
-				if o.conf.Verbose {
+				if o.classDump() {
+					o.printClassDump(o.classDumpCategory(&cat))
+				} else if o.conf.Verbose {
 					if o.conf.Color {
 						if o.conf.Addrs {
 							quick.Highlight(os.Stdout, swift.DemangleBlob(cat.WithAddrs()), "objc", "terminal256", o.conf.Theme)
@@ -410,7 +428,8 @@ func (o *ObjC) Dump() error {
 		if o.conf.ObjcRefs {
 			if protRefs, err := m.GetObjCProtoReferences(); err == nil {
 				fmt.Printf("\n@protocol refs\n")
-				for off, prot := range protRefs {
+				for _, off := range stable.Keys(protRefs) {
+					prot := protRefs[off]
 					fmt.Printf("0x%011x => 0x%011x: %s\n", off, prot.Ptr, prot.Name)
 				}
 			} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -418,7 +437,8 @@ func (o *ObjC) Dump() error {
 			}
 			if clsRefs, err := m.GetObjCClassReferences(); err == nil {
 				fmt.Printf("\n@class refs\n")
-				for off, cls := range clsRefs {
+				for _, off := range stable.Keys(clsRefs) {
+					cls := clsRefs[off]
 					fmt.Printf("0x%011x => 0x%011x: %s\n", off, cls.ClassPtr, cls.Name)
 				}
 			} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -426,7 +446,8 @@ func (o *ObjC) Dump() error {
 			}
 			if supRefs, err := m.GetObjCSuperReferences(); err == nil {
 				fmt.Printf("\n@super refs\n")
-				for off, sup := range supRefs {
+				for _, off := range stable.Keys(supRefs) {
+					sup := supRefs[off]
 					fmt.Printf("0x%011x => 0x%011x: %s\n", off, sup.ClassPtr, sup.Name)
 				}
 			} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -434,7 +455,8 @@ func (o *ObjC) Dump() error {
 			}
 			if selRefs, err := m.GetObjCSelectorReferences(); err == nil {
 				fmt.Printf("\n@selectors refs\n")
-				for off, sel := range selRefs {
+				for _, off := range stable.Keys(selRefs) {
+					sel := selRefs[off]
 					fmt.Printf("0x%011x => 0x%011x: %s\n", off, sel.VMAddr, sel.Name)
 				}
 			} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -443,7 +465,8 @@ func (o *ObjC) Dump() error {
 			if o.conf.Verbose {
 				if classes, err := m.GetObjCClassNames(); err == nil {
 					fmt.Printf("\n@objc_classname\n")
-					for vmaddr, className := range classes {
+					for _, vmaddr := range stable.Keys(classes) {
+						className := classes[vmaddr]
 						fmt.Printf("0x%011x: %s\n", vmaddr, className)
 					}
 				} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -451,7 +474,8 @@ func (o *ObjC) Dump() error {
 				}
 				if methods, err := m.GetObjCMethodNames(); err == nil {
 					fmt.Printf("\n@objc_methname\n")
-					for vmaddr, method := range methods {
+					for _, vmaddr := range stable.Keys(methods) {
+						method := methods[vmaddr]
 						fmt.Printf("0x%011x: %s\n", vmaddr, method)
 					}
 				} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
@@ -473,6 +497,14 @@ func (o *ObjC) Headers() error {
 
 	writeHeaders := func(m *macho.File) error {
 		var headers []string
+		var structs []*objctype.Type // the types of every class-dump header (for CDStructures.h)
+		addStructures := func(imp Imports, types []*objctype.Type) Imports {
+			if len(objctype.StructDefinitions(types...)) > 0 {
+				imp.Locals = append(slices.Clone(imp.Locals), cdStructuresHeader)
+				structs = append(structs, types...)
+			}
+			return imp
+		}
 
 		if !m.HasObjC() {
 			return nil
@@ -508,6 +540,21 @@ func (o *ObjC) Headers() error {
 			return cmp.Compare(a.Name, b.Name)
 		})
 		for _, class := range classes {
+			fname := filepath.Join(o.conf.Output, o.conf.Name, class.Name+".h")
+			if o.classDump() { // class-dump keeps the property ivars and accessors
+				if err := writeHeader(&headerInfo{
+					FileName:    fname,
+					IpswVersion: o.conf.IpswVersion,
+					ClassDump:   true,
+					Name:        class.Name,
+					Imports:     addStructures(imps[class.Name], cdTypes(class.Ivars, class.Props, class.ClassMethods, class.InstanceMethods)),
+					Object:      o.classDumpClass(&class),
+				}); err != nil {
+					return err
+				}
+				headers = append(headers, filepath.Base(fname))
+				continue
+			}
 			var props []string
 			var setters []string
 			for _, prop := range class.Props {
@@ -525,7 +572,6 @@ func (o *ObjC) Headers() error {
 			class.InstanceMethods = slices.DeleteFunc(class.InstanceMethods, func(m objc.Method) bool {
 				return slices.Contains(props, m.Name) || slices.Contains(setters, m.Name)
 			})
-			fname := filepath.Join(o.conf.Output, o.conf.Name, class.Name+".h")
 			if err := writeHeader(&headerInfo{
 				FileName:      fname,
 				IpswVersion:   o.conf.IpswVersion,
@@ -558,6 +604,23 @@ func (o *ObjC) Headers() error {
 				}
 			}
 			if _, ok := seen[proto.Ptr]; !ok { // prevent displaying duplicates
+				fname := filepath.Join(o.conf.Output, o.conf.Name, proto.Name+"-Protocol.h")
+				if o.classDump() {
+					if err := writeHeader(&headerInfo{
+						FileName:    fname,
+						IpswVersion: o.conf.IpswVersion,
+						ClassDump:   true,
+						Name:        proto.Name + "_Protocol",
+						Imports: addStructures(imps[proto.Name+"-Protocol"], cdTypes(nil, proto.InstanceProperties,
+							proto.ClassMethods, proto.InstanceMethods, proto.OptionalClassMethods, proto.OptionalInstanceMethods)),
+						Object: o.classDumpProtocol(&proto),
+					}); err != nil {
+						return err
+					}
+					headers = append(headers, filepath.Base(fname))
+					seen[proto.Ptr] = true
+					continue
+				}
 				var props []string
 				var setters []string
 				for _, prop := range proto.InstanceProperties {
@@ -573,7 +636,6 @@ func (o *ObjC) Headers() error {
 				proto.OptionalInstanceMethods = slices.DeleteFunc(proto.OptionalInstanceMethods, func(m objc.Method) bool {
 					return slices.Contains(props, m.Name) || slices.Contains(setters, m.Name)
 				})
-				fname := filepath.Join(o.conf.Output, o.conf.Name, proto.Name+"-Protocol.h")
 				if err := writeHeader(&headerInfo{
 					FileName:      fname,
 					IpswVersion:   o.conf.IpswVersion,
@@ -597,6 +659,7 @@ func (o *ObjC) Headers() error {
 				return err
 			}
 		}
+		resolveCategoryClasses(m, cats)
 		slices.SortStableFunc(cats, func(a, b objc.Category) int {
 			return cmp.Compare(a.Name, b.Name)
 		})
@@ -611,7 +674,7 @@ func (o *ObjC) Headers() error {
 			} else {
 				name = cat.Name
 			}
-			if err := writeHeader(&headerInfo{
+			hdr := &headerInfo{
 				FileName:      fname,
 				IpswVersion:   o.conf.IpswVersion,
 				BuildVersions: buildVersions,
@@ -619,12 +682,26 @@ func (o *ObjC) Headers() error {
 				Name:          name,
 				Imports:       imps[cat.Name],
 				Object:        swift.DemangleBlob(cat.Verbose()),
-			}); err != nil {
+			}
+			if o.classDump() {
+				hdr.ClassDump = true
+				hdr.Imports = addStructures(hdr.Imports, cdTypes(nil, cat.Properties, cat.ClassMethods, cat.InstanceMethods))
+				hdr.Object = o.classDumpCategory(&cat)
+			}
+			if err := writeHeader(hdr); err != nil {
 				return err
 			}
 			headers = append(headers, filepath.Base(fname))
 		}
 
+		/* generate class-dump's struct definitions header */
+		if len(structs) > 0 {
+			if err := writeFile(filepath.Join(o.conf.Output, o.conf.Name, cdStructuresHeader), classDumpStructures(o.conf.IpswVersion, structs)); err != nil {
+				return err
+			}
+			headers = append([]string{cdStructuresHeader}, headers...)
+		}
+
 		/* generate umbrella header */
 		if len(headers) > 0 {
 			var umbrella string
@@ -645,6 +722,7 @@ func (o *ObjC) Headers() error {
 				BuildVersions: buildVersions,
 				SourceVersion: sourceVersion,
 				IsUmbrella:    true,
+				ClassDump:     o.classDump(),
 				Name:          strings.ReplaceAll(umbrella, "-", "_"),
 				Object:        strings.Join(headers, "\n") + "\n",
 			}); err != nil {
@@ -877,6 +955,9 @@ func (o *ObjC) SwiftPackage() error {
 /* utils */
 
 func writeHeader(hdr *headerInfo) error {
+	if hdr.ClassDump {
+		return writeFile(hdr.FileName, classDumpHeader(hdr))
+	}
 	out := fmt.Sprintf(
 		"//\n"+
 			"//   Generated by https://github.com/blacktop/ipsw (%s)\n"+
@@ -920,18 +1001,22 @@ func writeHeader(hdr *headerInfo) error {
 	out += fmt.Sprintf("%s\n", hdr.Object)
 	out += fmt.Sprintf("#endif /* %s_h */\n", hdr.Name)
 
-	if err := os.MkdirAll(filepath.Dir(hdr.FileName), 0o750); err != nil {
+	return writeFile(hdr.FileName, out)
+}
+
+func writeFile(fname, out string) error {
+	if err := os.MkdirAll(filepath.Dir(fname), 0o750); err != nil {
 		return err
 	}
-	log.Infof("Creating %s", hdr.FileName)
-	if err := os.WriteFile(hdr.FileName, []byte(out), 0644); err != nil {
+	log.Infof("Creating %s", fname)
+	if err := os.WriteFile(fname, []byte(out), 0644); err != nil {
 		if pe, ok := err.(*os.PathError); ok {
 			if pe.Err == syscall.ENAMETOOLONG {
-				base := filepath.Base(strings.TrimSuffix(hdr.FileName, filepath.Ext(hdr.FileName)))
-				hdr.FileName = filepath.Join(filepath.Dir(hdr.FileName), base[:50]+".h")
-				log.Warnf("Filename too long; truncating to '%s'", hdr.FileName)
-				if err := os.WriteFile(hdr.FileName, []byte(out), 0644); err != nil {
-					return fmt.Errorf("failed to write header %s: %v", hdr.FileName, err)
+				base := filepath.Base(strings.TrimSuffix(fname, filepath.Ext(fname)))
+				fname = filepath.Join(filepath.Dir(fname), base[:50]+".h")
+				log.Warnf("Filename too long; truncating to '%s'", fname)
+				if err := os.WriteFile(fname, []byte(out), 0644); err != nil {
+					return fmt.Errorf("failed to write header %s: %v", fname, err)
 				}
 			}
 		}
@@ -940,6 +1025,23 @@ func writeHeader(hdr *headerInfo) error {
 	return nil
 }
 
+// resolveCategoryClasses fills in the class names of the categories whose class couldn't be parsed
+func resolveCategoryClasses(m *macho.File, cats []objc.Category) {
+	for i := range cats {
+		if cats[i].Class != nil && cats[i].Class.Name != "" {
+			continue
+		}
+		if name := objctype.CategoryClass(m, &cats[i]); name != "" {
+			class := objc.Class{}
+			if cats[i].Class != nil {
+				class = *cats[i].Class // don't modify the MachO's cached class
+			}
+			class.Name = name
+			cats[i].Class = &class
+		}
+	}
+}
+
 func (o *ObjC) processForwardDeclarations(m *macho.File) (map[string]Imports, error) {
 	var classNames []string
 	var protoNames []string
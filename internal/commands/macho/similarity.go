@@ -0,0 +1,231 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/fuzzyhash"
+)
+
+// SimilarityConfig is the config for Similarity
+type SimilarityConfig struct {
+	Functions bool // compare the functions (by their position independent instruction hashes)
+}
+
+// FuzzyScore is the fuzzy hash comparison of the same region of two MachOs
+type FuzzyScore struct {
+	Region string   `json:"region"`
+	SSDeep []string `json:"ssdeep,omitempty"`
+	// 0-100 (100 is identical)
+	SSDeepScore int      `json:"ssdeep_score"`
+	TLSH        []string `json:"tlsh,omitempty"`
+	// 0 is identical (anything under ~50 is very similar)
+	TLSHDistance int `json:"tlsh_distance"`
+}
+
+// FunctionSimilarity is the function level comparison of two MachOs
+type FunctionSimilarity struct {
+	Count     [2]int `json:"count"`
+	Identical int    `json:"identical"` // functions whose position independent instructions are the same
+	// named functions that are in both but whose instructions differ
+	Modified []string `json:"modified,omitempty"`
+	// 0-100 (the percentage of functions that are identical)
+	Score float64 `json:"score"`
+}
+
+// SimilarityReport is how similar two MachOs are
+type SimilarityReport struct {
+	Files     [2]string           `json:"files"`
+	UUIDs     [2]string           `json:"uuids,omitempty"`
+	Identical bool                `json:"identical"` // every region (and function hash) matches
+	Regions   []FuzzyScore        `json:"regions"`
+	Functions *FunctionSimilarity `json:"functions,omitempty"`
+}
+
+// similarityRegions returns the data of each region that gets fuzzy hashed
+func similarityRegions(m *macho.File) (map[string][]byte, error) {
+	regions := make(map[string][]byte)
+	var all []byte
+	for _, seg := range m.Segments() {
+		if seg.Filesz == 0 || seg.Name == "__LINKEDIT" { // the signature and fixups change with every build
+			continue
+		}
+		dat := make([]byte, seg.Filesz)
+		if _, err := m.ReadAt(dat, int64(seg.Offset)); err != nil {
+			return nil, fmt.Errorf("failed to read %s segment data: %v", seg.Name, err)
+		}
+		all = append(all, dat...)
+	}
+	regions["binary"] = all
+	for _, name := range []string{"__text", "__cstring"} {
+		if sec := m.Section("__TEXT", name); sec != nil && sec.Size > 0 {
+			dat, err := sec.Data()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read __TEXT.%s data: %v", name, err)
+			}
+			regions["__TEXT."+name] = dat
+		}
+	}
+	return regions, nil
+}
+
+func compareRegion(name string, d1, d2 []byte) FuzzyScore {
+	score := FuzzyScore{Region: name, TLSHDistance: -1}
+	s1, err1 := fuzzyhash.SSDeep(d1)
+	s2, err2 := fuzzyhash.SSDeep(d2)
+	if err1 == nil && err2 == nil {
+		score.SSDeep = []string{s1, s2}
+		score.SSDeepScore, _ = fuzzyhash.SSDeepCompare(s1, s2)
+	}
+	t1, err1 := fuzzyhash.TLSH(d1)
+	t2, err2 := fuzzyhash.TLSH(d2)
+	if err1 == nil && err2 == nil {
+		score.TLSH = []string{t1, t2}
+		score.TLSHDistance, _ = fuzzyhash.TLSHDiff(t1, t2)
+	} else {
+		log.Debugf("skipping %s TLSH: %v %v", name, err1, err2)
+	}
+	return score
+}
+
+// maskArm64 zeroes the PC relative immediates of an arm64 instruction so that a function hashes the same wherever it is linked
+func maskArm64(ins uint32) uint32 {
+	switch {
+	case ins&0x7c000000 == 0x14000000: // B, BL
+		return ins & 0xfc000000
+	case ins&0xff000010 == 0x54000000, // B.cond
+		ins&0x7e000000 == 0x34000000, // CBZ, CBNZ
+		ins&0x3b000000 == 0x18000000: // LDR (literal)
+		return ins & 0xff00001f
+	case ins&0x7e000000 == 0x36000000: // TBZ, TBNZ
+		return ins & 0xfff8001f
+	case ins&0x1f000000 == 0x10000000: // ADR, ADRP
+		return ins & 0x9f00001f
+	case ins&0xffc00000 == 0x91000000, // ADD (immediate)
+		ins&0x3b000000 == 0x39000000: // LDR/STR (unsigned immediate) i.e. the page offset of an ADRP
+		return ins & 0xffc003ff
+	default:
+		return ins
+	}
+}
+
+type functionFeature struct {
+	name string
+	hash uint64
+}
+
+func functionFeatures(m *macho.File) ([]functionFeature, error) {
+	names := make(map[uint64]string)
+	if m.Symtab != nil {
+		for _, sym := range m.Symtab.Syms {
+			if sym.Value != 0 && sym.Name != "" && sym.Name != "<redacted>" {
+				if _, ok := names[sym.Value]; !ok {
+					names[sym.Value] = sym.Name
+				}
+			}
+		}
+	}
+	arm64 := m.CPU == types.CPUArm64
+	var feats []functionFeature
+	for _, fn := range m.GetFunctions() {
+		dat, err := m.GetFunctionData(fn)
+		if err != nil {
+			log.Debugf("skipping function at %#x: %v", fn.StartAddr, err)
+			continue
+		}
+		h := fnv.New64a()
+		if arm64 {
+			buf := make([]byte, 4)
+			for off := 0; off+4 <= len(dat); off += 4 {
+				binary.LittleEndian.PutUint32(buf, maskArm64(binary.LittleEndian.Uint32(dat[off:])))
+				h.Write(buf)
+			}
+		} else {
+			h.Write(dat)
+		}
+		feats = append(feats, functionFeature{name: names[fn.StartAddr], hash: h.Sum64()})
+	}
+	return feats, nil
+}
+
+func compareFunctions(m1, m2 *macho.File) (*FunctionSimilarity, error) {
+	f1, err := functionFeatures(m1)
+	if err != nil {
+		return nil, err
+	}
+	f2, err := functionFeatures(m2)
+	if err != nil {
+		return nil, err
+	}
+	fs := &FunctionSimilarity{Count: [2]int{len(f1), len(f2)}}
+
+	hashes := make(map[uint64]int)
+	named := make(map[string]uint64)
+	for _, f := range f2 {
+		hashes[f.hash]++
+		if f.name != "" {
+			named[f.name] = f.hash
+		}
+	}
+	for _, f := range f1 {
+		if hashes[f.hash] > 0 {
+			hashes[f.hash]--
+			fs.Identical++
+		}
+		if h, ok := named[f.name]; ok && f.name != "" && h != f.hash {
+			fs.Modified = append(fs.Modified, f.name)
+		}
+	}
+	sort.Strings(fs.Modified)
+	if total := len(f1) + len(f2); total > 0 {
+		fs.Score = 200 * float64(fs.Identical) / float64(total)
+	}
+	return fs, nil
+}
+
+// Similarity scores how similar two MachOs are with fuzzy hashes (ssdeep and TLSH) of the whole binary and its
+// __TEXT sections and (optionally) by matching their functions' position independent instruction hashes
+func Similarity(m1, m2 *macho.File, name1, name2 string, conf *SimilarityConfig) (*SimilarityReport, error) {
+	report := &SimilarityReport{Files: [2]string{name1, name2}}
+	if u1, u2 := m1.UUID(), m2.UUID(); u1 != nil && u2 != nil {
+		report.UUIDs = [2]string{u1.String(), u2.String()}
+	}
+
+	r1, err := similarityRegions(m1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name1, err)
+	}
+	r2, err := similarityRegions(m2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name2, err)
+	}
+	report.Identical = true
+	for _, region := range []string{"binary", "__TEXT.__text", "__TEXT.__cstring"} {
+		d1, ok1 := r1[region]
+		d2, ok2 := r2[region]
+		if !ok1 || !ok2 {
+			continue
+		}
+		if !bytes.Equal(d1, d2) {
+			report.Identical = false
+		}
+		report.Regions = append(report.Regions, compareRegion(region, d1, d2))
+	}
+
+	if conf.Functions {
+		if report.Functions, err = compareFunctions(m1, m2); err != nil {
+			return nil, err
+		}
+		if report.Functions.Identical != report.Functions.Count[0] || report.Functions.Identical != report.Functions.Count[1] {
+			report.Identical = false
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,22 @@
+package macho
+
+import "testing"
+
+func TestMaskArm64(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b uint32
+		same bool
+	}{
+		{"bl", 0x94000001, 0x94012345, true},
+		{"adrp", 0x90000010, 0xb0ffff90, true}, // adrp x16 to different pages
+		{"adrp rd", 0x90000010, 0x90000011, false},
+		{"add page offset", 0x91004210, 0x913fe210, true},
+		{"cbz", 0xb4000060, 0xb40fffe0, true},
+		{"mov", 0xaa0103e0, 0xaa0203e0, false},
+	} {
+		if got := maskArm64(tt.a) == maskArm64(tt.b); got != tt.same {
+			t.Errorf("%s: maskArm64(%#x) == maskArm64(%#x) is %v, want %v", tt.name, tt.a, tt.b, got, tt.same)
+		}
+	}
+}
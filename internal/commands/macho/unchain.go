@@ -0,0 +1,285 @@
+package macho
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/pkg/trie"
+	"github.com/blacktop/go-macho/types"
+)
+
+// UnchainConfig is how to rewrite a MachO's chained fixups
+type UnchainConfig struct {
+	// Flat only rebases the pointers to their unslid addresses (a pre-rebased image without any rebase or bind
+	// info) instead of also replacing the LC_DYLD_CHAINED_FIXUPS with classic LC_DYLD_INFO_ONLY opcodes
+	Flat bool
+}
+
+// UnchainStats are the fixups a MachO's chains were rewritten into
+type UnchainStats struct {
+	Rebases   int
+	Binds     int
+	WeakBinds int
+}
+
+// classicFixup is a rebase or bind location as a segment index and offset (like the classic opcodes encode them)
+type classicFixup struct {
+	seg    int
+	offset uint64
+	// binds
+	name    string
+	ordinal int
+	weak    bool // weak import
+	addend  int64
+}
+
+// vmaddrFormats are the pointer formats whose (non-auth) rebase targets are vmaddrs instead of vm offsets
+var vmaddrFormats = map[fixupchains.DCPtrKind]bool{
+	fixupchains.DYLD_CHAINED_PTR_ARM64E:          true,
+	fixupchains.DYLD_CHAINED_PTR_64:              true,
+	fixupchains.DYLD_CHAINED_PTR_ARM64E_FIRMWARE: true,
+}
+
+// rebaseTarget returns the unslid address (with its top byte) of a rebase
+func rebaseTarget(format fixupchains.DCPtrKind, r fixupchains.Rebase, base uint64) uint64 {
+	switch r.(type) {
+	case fixupchains.DyldChainedPtrArm64eAuthRebase, fixupchains.DyldChainedPtrArm64eAuthRebase24:
+		return base + r.Target() // auth targets are always vm offsets (the PAC signing info is dropped)
+	}
+	target := r.Target()
+	if h, ok := r.(interface{ High8() uint64 }); ok {
+		target |= h.High8() << 56
+	}
+	if vmaddrFormats[format] {
+		return target
+	}
+	return base + target
+}
+
+func bindAddend(b fixupchains.Bind) int64 {
+	if sa, ok := b.(interface{ SignExtendedAddend() int64 }); ok {
+		return sa.SignExtendedAddend()
+	}
+	return int64(b.Addend())
+}
+
+// rebaseOpcodes encodes the (sorted) rebases as REBASE_OPCODE_* opcodes
+func rebaseOpcodes(rebases []classicFixup) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(types.REBASE_OPCODE_SET_TYPE_IMM | types.REBASE_TYPE_POINTER)
+	for i := 0; i < len(rebases); {
+		r := rebases[i]
+		// count the run of consecutive pointers
+		n := 1
+		for i+n < len(rebases) && rebases[i+n].seg == r.seg && rebases[i+n].offset == r.offset+uint64(n)*8 {
+			n++
+		}
+		buf.WriteByte(types.REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | byte(r.seg))
+		trie.EncodeUleb128(&buf, r.offset)
+		if n < 16 {
+			buf.WriteByte(types.REBASE_OPCODE_DO_REBASE_IMM_TIMES | byte(n))
+		} else {
+			buf.WriteByte(types.REBASE_OPCODE_DO_REBASE_ULEB_TIMES)
+			trie.EncodeUleb128(&buf, uint64(n))
+		}
+		i += n
+	}
+	buf.WriteByte(types.REBASE_OPCODE_DONE)
+	return buf.Bytes()
+}
+
+// bindOpcodes encodes the (sorted) binds as BIND_OPCODE_* opcodes (weak binds don't have a dylib ordinal)
+func bindOpcodes(binds []classicFixup, weak bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(types.BIND_OPCODE_SET_TYPE_IMM | types.BIND_TYPE_POINTER)
+	var prev *classicFixup
+	for i := range binds {
+		b := &binds[i]
+		if !weak && (prev == nil || prev.ordinal != b.ordinal) {
+			switch {
+			case b.ordinal <= 0:
+				buf.WriteByte(types.BIND_OPCODE_SET_DYLIB_SPECIAL_IMM | byte(b.ordinal)&types.BIND_IMMEDIATE_MASK)
+			case b.ordinal < 16:
+				buf.WriteByte(types.BIND_OPCODE_SET_DYLIB_ORDINAL_IMM | byte(b.ordinal))
+			default:
+				buf.WriteByte(types.BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB)
+				trie.EncodeUleb128(&buf, uint64(b.ordinal))
+			}
+		}
+		if prev == nil || prev.name != b.name || prev.weak != b.weak {
+			var flags byte
+			if b.weak {
+				flags = types.BIND_SYMBOL_FLAGS_WEAK_IMPORT
+			}
+			buf.WriteByte(types.BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM | flags)
+			buf.WriteString(b.name + "\x00")
+		}
+		if prev == nil || prev.addend != b.addend {
+			buf.WriteByte(types.BIND_OPCODE_SET_ADDEND_SLEB)
+			trie.EncodeSleb128(&buf, b.addend)
+		}
+		buf.WriteByte(types.BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | byte(b.seg))
+		trie.EncodeUleb128(&buf, b.offset)
+		buf.WriteByte(types.BIND_OPCODE_DO_BIND)
+		prev = b
+	}
+	buf.WriteByte(types.BIND_OPCODE_DONE)
+	return buf.Bytes()
+}
+
+// Unchain rewrites a chained fixups MachO into one that tools without chained fixup support can read and writes it to output
+//
+// Every chained pointer is replaced with its unslid target (binds are zeroed) and, unless conf.Flat is set, the
+// LC_DYLD_CHAINED_FIXUPS and LC_DYLD_EXPORTS_TRIE are replaced with an LC_DYLD_INFO_ONLY whose rebase and bind
+// opcodes are appended to __LINKEDIT
+//
+// NOTE: arm64e auth pointers lose their PAC signing info and the code signature is invalidated
+func Unchain(m *macho.File, name, output string, conf *UnchainConfig) (*UnchainStats, error) {
+	if !m.HasDyldChainedFixups() {
+		return nil, fmt.Errorf("%s does not use chained fixups", name)
+	}
+	dcf, err := m.DyldChainedFixups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s chained fixups: %v", name, err)
+	}
+
+	segs := m.Segments()
+	linkedit := m.Segment("__LINKEDIT")
+	if linkedit == nil {
+		return nil, fmt.Errorf("failed to find __LINKEDIT segment in %s", name)
+	}
+	var size uint64
+	for _, seg := range segs {
+		size = max(size, seg.Offset+seg.Filesz)
+	}
+	if linkedit.Offset+linkedit.Filesz != size {
+		return nil, fmt.Errorf("__LINKEDIT is not the last segment in %s", name)
+	}
+	dat := make([]byte, size)
+	if _, err := m.ReadAt(dat, 0); err != nil {
+		return nil, fmt.Errorf("failed to read MachO data: %v", err)
+	}
+
+	segIndex := func(off uint64) (int, uint64, bool) {
+		for i, seg := range segs {
+			if seg.Filesz > 0 && off >= seg.Offset && off+8 <= seg.Offset+seg.Filesz {
+				return i, off - seg.Offset, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	base := m.GetBaseAddress()
+	stats := &UnchainStats{}
+	var rebases, binds, weakBinds []classicFixup
+	for _, start := range dcf.Starts {
+		switch start.PointerFormat {
+		case fixupchains.DYLD_CHAINED_PTR_32, fixupchains.DYLD_CHAINED_PTR_32_CACHE, fixupchains.DYLD_CHAINED_PTR_32_FIRMWARE:
+			return nil, fmt.Errorf("%s uses 32-bit chained fixups (pointer format %d) which are not supported", name, start.PointerFormat)
+		}
+		for _, fixup := range start.Fixups {
+			seg, off, ok := segIndex(fixup.Offset())
+			if !ok {
+				return nil, fmt.Errorf("fixup at %#x is not in a segment of %s", fixup.Offset(), name)
+			}
+			switch f := fixup.(type) {
+			case fixupchains.Rebase:
+				m.ByteOrder.PutUint64(dat[fixup.Offset():], rebaseTarget(start.PointerFormat, f, base))
+				rebases = append(rebases, classicFixup{seg: seg, offset: off})
+			case fixupchains.Bind:
+				if f.Ordinal() >= uint64(len(dcf.Imports)) {
+					return nil, fmt.Errorf("bind at %#x has an invalid import ordinal %d", fixup.Offset(), f.Ordinal())
+				}
+				imp := dcf.Imports[f.Ordinal()]
+				m.ByteOrder.PutUint64(dat[fixup.Offset():], 0)
+				b := classicFixup{
+					seg:     seg,
+					offset:  off,
+					name:    imp.Name,
+					ordinal: imp.LibOrdinal(),
+					weak:    imp.WeakImport(),
+					addend:  int64(imp.Addend()) + bindAddend(f),
+				}
+				if b.ordinal == types.BIND_SPECIAL_DYLIB_WEAK_LOOKUP {
+					weakBinds = append(weakBinds, b)
+				} else {
+					binds = append(binds, b)
+				}
+			}
+		}
+	}
+	for _, fs := range [][]classicFixup{rebases, binds, weakBinds} {
+		sort.Slice(fs, func(i, j int) bool {
+			if fs[i].seg != fs[j].seg {
+				return fs[i].seg < fs[j].seg
+			}
+			return fs[i].offset < fs[j].offset
+		})
+	}
+	stats.Rebases, stats.Binds, stats.WeakBinds = len(rebases), len(binds), len(weakBinds)
+
+	for i, l := range m.Loads {
+		lc, ok := l.(*macho.DyldChainedFixups)
+		if !ok {
+			continue
+		}
+		if conf.Flat {
+			if err := m.RemoveLoad(lc); err != nil {
+				return nil, fmt.Errorf("failed to remove LC_DYLD_CHAINED_FIXUPS: %v", err)
+			}
+			break
+		}
+		// append the opcodes to __LINKEDIT
+		appendData := func(data []byte) (uint32, uint32) {
+			if len(data) == 0 {
+				return 0, 0
+			}
+			off := align(uint64(len(dat)), 8)
+			dat = append(dat, make([]byte, off-uint64(len(dat)))...)
+			dat = append(dat, data...)
+			return uint32(off), uint32(len(data))
+		}
+		info := &macho.DyldInfoOnly{DyldInfo: macho.DyldInfo{DyldInfoCmd: types.DyldInfoCmd{LoadCmd: types.LC_DYLD_INFO_ONLY}}}
+		info.Len = info.LoadSize()
+		info.RebaseOff, info.RebaseSize = appendData(rebaseOpcodes(rebases))
+		info.BindOff, info.BindSize = appendData(bindOpcodes(binds, false))
+		if len(weakBinds) > 0 {
+			info.WeakBindOff, info.WeakBindSize = appendData(bindOpcodes(weakBinds, true))
+		}
+		dat = append(dat, make([]byte, align(uint64(len(dat)), 8)-uint64(len(dat)))...)
+		linkedit.Filesz = uint64(len(dat)) - linkedit.Offset
+		linkedit.Memsz = align(linkedit.Filesz, 0x4000)
+		m.Loads[i] = info
+		m.ModifySizeCommands(int32(lc.LoadSize()), int32(info.Len))
+		if trie := m.DyldExportsTrie(); trie != nil {
+			info.ExportOff, info.ExportSize = trie.Offset, trie.Size
+			if err := m.RemoveLoad(trie); err != nil {
+				return nil, fmt.Errorf("failed to remove LC_DYLD_EXPORTS_TRIE: %v", err)
+			}
+		}
+		break
+	}
+
+	if space := loadCommandSpace(m); space > 0 && uint64(m.SizeCommands) > space {
+		return nil, fmt.Errorf("not enough space in %s for the load commands (need %#x bytes, have %#x); relink it with a larger -headerpad", name, m.SizeCommands, space)
+	}
+	if err := putLoadCommands(m, dat); err != nil {
+		return nil, err
+	}
+	if m.CodeSignature() != nil {
+		log.Warnf("%s code signature is now invalid (re-sign it with `ipsw macho sign`)", name)
+	}
+	if err := os.WriteFile(output, dat, 0755); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", output, err)
+	}
+	return stats, nil
+}
+
+func align(v, a uint64) uint64 {
+	return (v + a - 1) &^ (a - 1)
+}
@@ -0,0 +1,46 @@
+package macho
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRebaseOpcodes(t *testing.T) {
+	rebases := []classicFixup{
+		{seg: 2, offset: 0x10}, {seg: 2, offset: 0x18}, {seg: 2, offset: 0x20},
+		{seg: 2, offset: 0x100},
+		{seg: 3, offset: 0},
+	}
+	want := []byte{
+		0x11,             // REBASE_OPCODE_SET_TYPE_IMM(REBASE_TYPE_POINTER)
+		0x22, 0x10, 0x53, // __DATA+0x10 x3
+		0x22, 0x80, 0x02, 0x51, // __DATA+0x100
+		0x23, 0x00, 0x51, // seg 3
+		0x00,
+	}
+	if got := rebaseOpcodes(rebases); !bytes.Equal(got, want) {
+		t.Errorf("rebaseOpcodes() = % x, want % x", got, want)
+	}
+}
+
+func TestBindOpcodes(t *testing.T) {
+	binds := []classicFixup{
+		{seg: 2, offset: 0x8, name: "_foo", ordinal: 1},
+		{seg: 2, offset: 0x30, name: "_foo", ordinal: 1, addend: 8},
+		{seg: 3, offset: 0, name: "_bar", ordinal: -2, weak: true},
+	}
+	want := []byte{
+		0x51, // BIND_OPCODE_SET_TYPE_IMM(BIND_TYPE_POINTER)
+		0x11, 0x40, '_', 'f', 'o', 'o', 0, 0x60, 0x00, 0x72, 0x08, 0x90,
+		0x60, 0x08, 0x72, 0x30, 0x90, // same symbol with an addend
+		0x3e, 0x41, '_', 'b', 'a', 'r', 0, 0x60, 0x00, 0x73, 0x00, 0x90, // flat lookup weak import
+		0x00,
+	}
+	if got := bindOpcodes(binds, false); !bytes.Equal(got, want) {
+		t.Errorf("bindOpcodes() = % x, want % x", got, want)
+	}
+	// weak binds don't set the dylib ordinal
+	if got := bindOpcodes(binds[:1], true); !bytes.Equal(got, []byte{0x51, 0x40, '_', 'f', 'o', 'o', 0, 0x60, 0x00, 0x72, 0x08, 0x90, 0x00}) {
+		t.Errorf("bindOpcodes(weak) = % x", got)
+	}
+}
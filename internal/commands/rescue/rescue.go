@@ -0,0 +1,634 @@
+// Package rescue recovers files from damaged or partial IPSWs/zips and forensic images.
+package rescue
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	scanChunkSize = 0x400000 // 4MB
+	maxNameLen    = 4096
+	maxSizeOfCmds = 0x100000
+
+	zip64ExtraID = 0x0001
+	flagDataDesc = 0x8
+)
+
+var (
+	magicLocalFile  = []byte("PK\x03\x04")
+	magicCentralDir = []byte("PK\x01\x02")
+	magicIM4P       = []byte("\x16\x04IM4P")
+	magicIMG4       = []byte("\x16\x04IMG4")
+	magicMachO      = []byte{0xcf, 0xfa, 0xed, 0xfe}
+)
+
+// Kind is the type of a recovered artifact
+type Kind string
+
+const (
+	KindZip   Kind = "zip"
+	KindIMG4  Kind = "img4"
+	KindIM4P  Kind = "im4p"
+	KindMachO Kind = "macho"
+)
+
+// Status is the state of a recovered artifact
+type Status string
+
+const (
+	// Intact artifacts were fully recovered (and passed their CRC check)
+	Intact Status = "intact"
+	// Partial artifacts are truncated
+	Partial Status = "partial"
+	// Corrupt artifacts failed to decompress or their CRC check
+	Corrupt Status = "corrupt"
+)
+
+// Config is the rescue command configuration
+type Config struct {
+	// regex pattern to filter the zip entries to recover
+	Pattern string `json:"pattern,omitempty"`
+	// only list the recoverable artifacts (do NOT write them)
+	List bool `json:"list,omitempty"`
+	// do NOT carve Image4/MachO payloads from the raw data
+	NoCarve bool `json:"no_carve,omitempty"`
+	// output directory to write recovered files to
+	Output string `json:"output,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Artifact is a recovered file
+type Artifact struct {
+	Kind         Kind   `json:"kind"`
+	Name         string `json:"name"`
+	Offset       int64  `json:"offset"`
+	Size         int64  `json:"size"` // size in the input file
+	Uncompressed int64  `json:"uncompressed,omitempty"`
+	Status       Status `json:"status"`
+	Path         string `json:"path,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type zipEntry struct {
+	name   string
+	flags  uint16
+	method uint16
+	crc32  uint32
+	csize  uint64
+	usize  uint64
+	offset int64 // local file header offset
+}
+
+type extent struct {
+	start, end int64
+}
+
+type rescuer struct {
+	f    *os.File
+	size int64
+	conf *Config
+
+	covered []extent
+}
+
+func (r *rescuer) isCovered(off int64) bool {
+	for _, e := range r.covered {
+		if e.start <= off && off < e.end {
+			return true
+		}
+	}
+	return false
+}
+
+// Rescue scans a (damaged or partial) IPSW/zip or forensic image for recoverable zip entries and Image4/MachO payloads
+func Rescue(path string, conf *Config) ([]*Artifact, error) {
+	if len(conf.Pattern) > 0 {
+		var err error
+		conf.pattern, err = regexp.Compile(conf.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile pattern '%s': %v", conf.Pattern, err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rescuer{f: f, size: fi.Size(), conf: conf}
+
+	sigs, err := r.scan(magicLocalFile, magicCentralDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the central directory (if any survived) has the sizes of entries that used data descriptors
+	cdir := make(map[int64]*zipEntry)
+	for _, off := range sigs[string(magicCentralDir)] {
+		if ent, err := r.readCentralDir(off); err == nil {
+			cdir[ent.offset] = ent
+		}
+	}
+	log.Debugf("Found %d central directory entries", len(cdir))
+
+	var artifacts []*Artifact
+
+	for _, off := range sigs[string(magicLocalFile)] {
+		if r.isCovered(off) {
+			continue
+		}
+		ent, dataOff, err := r.readLocalFile(off)
+		if err != nil {
+			log.Debugf("skipping invalid local file header at %#x: %v", off, err)
+			continue
+		}
+		if cd, ok := cdir[off]; ok {
+			ent.crc32, ent.csize, ent.usize = cd.crc32, cd.csize, cd.usize
+			ent.flags &^= flagDataDesc
+		}
+		art := r.recoverZipEntry(ent, dataOff)
+		if art == nil {
+			continue
+		}
+		if art.Status == Intact {
+			r.covered = append(r.covered, extent{off, dataOff + art.Size})
+		}
+		artifacts = append(artifacts, art)
+	}
+
+	if !conf.NoCarve {
+		carved, err := r.carve()
+		if err != nil {
+			return artifacts, err
+		}
+		artifacts = append(artifacts, carved...)
+	}
+
+	return artifacts, nil
+}
+
+// scan returns the offsets of all the occurrences of the magics in the file
+func (r *rescuer) scan(magics ...[]byte) (map[string][]int64, error) {
+	found := make(map[string][]int64)
+	overlap := 0
+	for _, m := range magics {
+		overlap = max(overlap, len(m)-1)
+	}
+	buf := make([]byte, scanChunkSize+overlap)
+	for base := int64(0); base < r.size; base += scanChunkSize {
+		n, err := r.f.ReadAt(buf, base)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read at %#x: %v", base, err)
+		}
+		for _, m := range magics {
+			for idx := 0; ; {
+				i := bytes.Index(buf[idx:n], m)
+				if i < 0 {
+					break
+				}
+				if idx+i < scanChunkSize { // matches in the overlap are found in the next chunk
+					found[string(m)] = append(found[string(m)], base+int64(idx+i))
+				}
+				idx += i + 1
+			}
+		}
+	}
+	return found, nil
+}
+
+func validName(name []byte) bool {
+	return len(name) > 0 && len(name) < maxNameLen && utf8.Valid(name) && !bytes.ContainsRune(name, 0)
+}
+
+func parseZip64Extra(extra []byte, ent *zipEntry, needUsize, needCsize, needOffset bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		sz := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if sz > len(extra) {
+			return
+		}
+		if id == zip64ExtraID {
+			fld := extra[:sz]
+			if needUsize && len(fld) >= 8 {
+				ent.usize = binary.LittleEndian.Uint64(fld)
+				fld = fld[8:]
+			}
+			if needCsize && len(fld) >= 8 {
+				ent.csize = binary.LittleEndian.Uint64(fld)
+				fld = fld[8:]
+			}
+			if needOffset && len(fld) >= 8 {
+				ent.offset = int64(binary.LittleEndian.Uint64(fld))
+			}
+			return
+		}
+		extra = extra[sz:]
+	}
+}
+
+func (r *rescuer) readCentralDir(off int64) (*zipEntry, error) {
+	var hdr struct {
+		Sig        uint32
+		Made       uint16
+		Version    uint16
+		Flags      uint16
+		Method     uint16
+		ModTime    uint16
+		ModDate    uint16
+		CRC32      uint32
+		CSize      uint32
+		USize      uint32
+		NameLen    uint16
+		ExtraLen   uint16
+		CommentLen uint16
+		Disk       uint16
+		IntAttr    uint16
+		ExtAttr    uint32
+		Offset     uint32
+	}
+	if err := binary.Read(io.NewSectionReader(r.f, off, 46), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	name := make([]byte, hdr.NameLen)
+	extra := make([]byte, hdr.ExtraLen)
+	if _, err := r.f.ReadAt(name, off+46); err != nil {
+		return nil, err
+	}
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid name")
+	}
+	if _, err := r.f.ReadAt(extra, off+46+int64(hdr.NameLen)); err != nil {
+		return nil, err
+	}
+	ent := &zipEntry{
+		name:   string(name),
+		flags:  hdr.Flags,
+		method: hdr.Method,
+		crc32:  hdr.CRC32,
+		csize:  uint64(hdr.CSize),
+		usize:  uint64(hdr.USize),
+		offset: int64(hdr.Offset),
+	}
+	parseZip64Extra(extra, ent, hdr.USize == 0xffffffff, hdr.CSize == 0xffffffff, hdr.Offset == 0xffffffff)
+	return ent, nil
+}
+
+func (r *rescuer) readLocalFile(off int64) (*zipEntry, int64, error) {
+	var hdr struct {
+		Sig      uint32
+		Version  uint16
+		Flags    uint16
+		Method   uint16
+		ModTime  uint16
+		ModDate  uint16
+		CRC32    uint32
+		CSize    uint32
+		USize    uint32
+		NameLen  uint16
+		ExtraLen uint16
+	}
+	if err := binary.Read(io.NewSectionReader(r.f, off, 30), binary.LittleEndian, &hdr); err != nil {
+		return nil, 0, err
+	}
+	if hdr.Method != zipStore && hdr.Method != zipDeflate {
+		return nil, 0, fmt.Errorf("unsupported compression method %d", hdr.Method)
+	}
+	if hdr.Version > 63 {
+		return nil, 0, fmt.Errorf("invalid version %d", hdr.Version)
+	}
+	name := make([]byte, hdr.NameLen)
+	extra := make([]byte, hdr.ExtraLen)
+	if _, err := r.f.ReadAt(name, off+30); err != nil {
+		return nil, 0, err
+	}
+	if !validName(name) {
+		return nil, 0, fmt.Errorf("invalid name")
+	}
+	if _, err := r.f.ReadAt(extra, off+30+int64(hdr.NameLen)); err != nil {
+		return nil, 0, err
+	}
+	ent := &zipEntry{
+		name:   string(name),
+		flags:  hdr.Flags,
+		method: hdr.Method,
+		crc32:  hdr.CRC32,
+		csize:  uint64(hdr.CSize),
+		usize:  uint64(hdr.USize),
+		offset: off,
+	}
+	parseZip64Extra(extra, ent, hdr.USize == 0xffffffff, hdr.CSize == 0xffffffff, false)
+	return ent, off + 30 + int64(hdr.NameLen) + int64(hdr.ExtraLen), nil
+}
+
+const (
+	zipStore   = 0
+	zipDeflate = 8
+)
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(c, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *rescuer) output(name string) (io.WriteCloser, string, error) {
+	if r.conf.List {
+		return nopWriteCloser{io.Discard}, "", nil
+	}
+	if !filepath.IsLocal(name) {
+		return nil, "", fmt.Errorf("refusing to write entry with unsafe path '%s'", name)
+	}
+	fname := filepath.Join(r.conf.Output, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fname), 0o750); err != nil {
+		return nil, "", err
+	}
+	of, err := os.Create(fname)
+	if err != nil {
+		return nil, "", err
+	}
+	return of, fname, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (r *rescuer) recoverZipEntry(ent *zipEntry, dataOff int64) *Artifact {
+	if ent.name[len(ent.name)-1] == '/' { // directory
+		return nil
+	}
+	if r.conf.pattern != nil && !r.conf.pattern.MatchString(ent.name) {
+		return nil
+	}
+
+	art := &Artifact{
+		Kind:         KindZip,
+		Name:         ent.name,
+		Offset:       ent.offset,
+		Uncompressed: int64(ent.usize),
+	}
+
+	knownSize := ent.flags&flagDataDesc == 0
+	if !knownSize && ent.method == zipStore {
+		art.Status = Corrupt
+		art.Error = "stored entry with unknown size (no central directory entry)"
+		return art
+	}
+
+	avail := r.size - dataOff
+	var src io.Reader = io.NewSectionReader(r.f, dataOff, avail)
+	truncated := false
+	if knownSize {
+		if int64(ent.csize) > avail {
+			truncated = true
+		} else {
+			src = io.NewSectionReader(r.f, dataOff, int64(ent.csize))
+		}
+	}
+
+	cr := &countingReader{r: src}
+	var rd io.Reader = cr
+	if ent.method == zipDeflate {
+		fr := flate.NewReader(cr)
+		defer fr.Close()
+		rd = fr
+	}
+
+	out, fname, err := r.output(ent.name)
+	if err != nil {
+		art.Status = Corrupt
+		art.Error = err.Error()
+		return art
+	}
+	h := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(out, h), rd)
+	out.Close()
+	art.Path = fname
+	art.Size = cr.n
+	if !knownSize {
+		art.Uncompressed = n
+	}
+
+	switch {
+	case err != nil && (truncated || errors.Is(err, io.ErrUnexpectedEOF)):
+		art.Status = Partial
+		art.Error = fmt.Sprintf("truncated after %d bytes", n)
+	case err != nil:
+		art.Status = Corrupt
+		art.Error = err.Error()
+	case truncated:
+		art.Status = Partial
+		art.Error = fmt.Sprintf("truncated after %d bytes", n)
+	case knownSize && h.Sum32() != ent.crc32:
+		art.Status = Corrupt
+		art.Error = fmt.Sprintf("CRC mismatch: %08x != %08x", h.Sum32(), ent.crc32)
+	default:
+		art.Status = Intact
+	}
+
+	if art.Status != Intact && len(fname) > 0 {
+		os.Rename(fname, fname+".partial")
+		art.Path = fname + ".partial"
+	}
+
+	return art
+}
+
+// derLength returns the total length of the DER SEQUENCE starting at off
+func (r *rescuer) derLength(off int64) (int64, int64, bool) {
+	hdr := make([]byte, 6)
+	if _, err := r.f.ReadAt(hdr, off); err != nil {
+		return 0, 0, false
+	}
+	if hdr[0] != 0x30 {
+		return 0, 0, false
+	}
+	if hdr[1] < 0x80 {
+		return int64(hdr[1]) + 2, 2, true
+	}
+	nb := int(hdr[1] & 0x7f)
+	if nb == 0 || nb > 4 {
+		return 0, 0, false
+	}
+	var l int64
+	for _, b := range hdr[2 : 2+nb] {
+		l = l<<8 | int64(b)
+	}
+	return l + 2 + int64(nb), 2 + int64(nb), true
+}
+
+// findDER finds the start of the DER SEQUENCE whose first element is the IA5String tag found at tagOff
+func (r *rescuer) findDER(tagOff int64) (int64, int64, bool) {
+	for _, hlen := range []int64{2, 3, 4, 5, 6} {
+		start := tagOff - hlen
+		if start < 0 {
+			continue
+		}
+		if total, h, ok := r.derLength(start); ok && h == hlen {
+			return start, total, true
+		}
+	}
+	return 0, 0, false
+}
+
+// machoSize returns the size of the MachO at off (the end of its furthest segment)
+func (r *rescuer) machoSize(off int64) (int64, string, bool) {
+	var hdr types.FileHeader
+	if err := binary.Read(io.NewSectionReader(r.f, off, 32), binary.LittleEndian, &hdr); err != nil {
+		return 0, "", false
+	}
+	switch hdr.CPU {
+	case types.CPUArm64, types.CPUAmd64:
+	default:
+		return 0, "", false
+	}
+	if hdr.Type < types.MH_OBJECT || hdr.Type > types.MH_FILESET || hdr.NCommands == 0 || hdr.NCommands > 0x1000 || hdr.SizeCommands > maxSizeOfCmds {
+		return 0, "", false
+	}
+	m, err := macho.NewFile(io.NewSectionReader(r.f, off, r.size-off))
+	if err != nil {
+		return 0, "", false
+	}
+	defer m.Close()
+	var size int64
+	for _, seg := range m.Segments() {
+		size = max(size, int64(seg.Offset+seg.Filesz))
+	}
+	if cs := m.CodeSignature(); cs != nil {
+		size = max(size, int64(cs.Offset+cs.Size))
+	}
+	if size == 0 {
+		return 0, "", false
+	}
+	var name string
+	if id := m.DylibID(); id != nil {
+		name = filepath.Base(id.Name)
+	} else if m.Type == types.MH_FILESET {
+		name = "kernelcache"
+	}
+	return size, name, true
+}
+
+func (r *rescuer) carveTo(art *Artifact, ext string) {
+	name := fmt.Sprintf("carved/%#x.%s", art.Offset, ext)
+	if len(art.Name) > 0 {
+		name = fmt.Sprintf("carved/%#x_%s", art.Offset, art.Name)
+	}
+	end := art.Offset + art.Size
+	if end > r.size {
+		art.Status = Partial
+		art.Error = fmt.Sprintf("truncated: %d of %d bytes", r.size-art.Offset, art.Size)
+		end = r.size
+		name += ".partial"
+	} else {
+		art.Status = Intact
+	}
+	if len(art.Name) == 0 {
+		art.Name = filepath.Base(name)
+	}
+	out, fname, err := r.output(name)
+	if err != nil {
+		art.Status = Corrupt
+		art.Error = err.Error()
+		return
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, io.NewSectionReader(r.f, art.Offset, end-art.Offset)); err != nil {
+		art.Status = Corrupt
+		art.Error = err.Error()
+		return
+	}
+	art.Path = fname
+}
+
+// carve scans the raw data (outside of the intact zip entries) for Image4 and MachO payloads
+func (r *rescuer) carve() ([]*Artifact, error) {
+	sigs, err := r.scan(magicIMG4, magicIM4P, magicMachO)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		off  int64
+		kind Kind
+	}
+	var cands []candidate
+	for _, off := range sigs[string(magicIMG4)] {
+		cands = append(cands, candidate{off, KindIMG4})
+	}
+	for _, off := range sigs[string(magicIM4P)] {
+		cands = append(cands, candidate{off, KindIM4P})
+	}
+	for _, off := range sigs[string(magicMachO)] {
+		cands = append(cands, candidate{off, KindMachO})
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].off < cands[j].off })
+
+	var artifacts []*Artifact
+	for _, c := range cands {
+		if r.isCovered(c.off) {
+			continue
+		}
+		var art *Artifact
+		switch c.kind {
+		case KindIMG4, KindIM4P:
+			start, total, ok := r.findDER(c.off)
+			if !ok || r.isCovered(start) {
+				continue
+			}
+			art = &Artifact{Kind: c.kind, Offset: start, Size: total}
+			r.carveTo(art, string(c.kind))
+		case KindMachO:
+			if c.off%4 != 0 {
+				continue
+			}
+			size, name, ok := r.machoSize(c.off)
+			if !ok {
+				continue
+			}
+			art = &Artifact{Kind: KindMachO, Name: name, Offset: c.off, Size: size}
+			r.carveTo(art, "macho")
+		}
+		r.covered = append(r.covered, extent{art.Offset, art.Offset + art.Size})
+		artifacts = append(artifacts, art)
+	}
+
+	return artifacts, nil
+}
@@ -0,0 +1,56 @@
+package rescue
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRescueTruncatedZip(t *testing.T) {
+	payload := bytes.Repeat([]byte("kernelcache "), 4096)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"BuildManifest.plist", "kernelcache.release.iphone15"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(payload)
+	}
+	big, err := zw.Create("098-12345-001.dmg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	big.Write(bytes.Repeat([]byte{0xff, 0x00, 0x13, 0x37}, 1<<16))
+	zw.Close()
+
+	// simulate an interrupted download (no central directory, last entry truncated)
+	dir := t.TempDir()
+	ipsw := filepath.Join(dir, "partial.ipsw")
+	if err := os.WriteFile(ipsw, buf.Bytes()[:buf.Len()*3/4], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	arts, err := Rescue(ipsw, &Config{Output: filepath.Join(dir, "out"), NoCarve: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arts) != 3 {
+		t.Fatalf("got %d artifacts, want 3", len(arts))
+	}
+	for i, want := range []Status{Intact, Intact, Partial} {
+		if arts[i].Status != want {
+			t.Errorf("%s: status = %s, want %s (%s)", arts[i].Name, arts[i].Status, want, arts[i].Error)
+		}
+	}
+	dat, err := os.ReadFile(filepath.Join(dir, "out", "kernelcache.release.iphone15"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dat, payload) {
+		t.Errorf("recovered %d bytes, want %d", len(dat), len(payload))
+	}
+}
@@ -0,0 +1,202 @@
+// Package sbom implements the `ipsw sbom` command
+package sbom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/commands/dsc"
+	"github.com/blacktop/ipsw/internal/commands/extract"
+	"github.com/blacktop/ipsw/internal/search"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/blacktop/ipsw/pkg/sbom"
+)
+
+// Config is the sbom command config
+type Config struct {
+	PemDB      string
+	FileSystem bool // fingerprint the file system MachOs
+	DSC        bool // fingerprint the dyld_shared_cache images
+	Kernel     bool // fingerprint the kernelcache and its kexts
+}
+
+// NewBinary returns the symbols and C strings of a MachO to fingerprint
+func NewBinary(path string, m *macho.File) *sbom.Binary {
+	b := &sbom.Binary{Path: path, Symbols: make(map[string]bool)}
+	if m.Symtab != nil {
+		for _, sym := range m.Symtab.Syms {
+			if sym.Sect != 0 && sym.Type&types.N_TYPE == types.N_SECT {
+				b.Symbols[sym.Name] = true
+			}
+		}
+	}
+	var exports []string
+	if m.DyldExportsTrie() != nil {
+		if exps, err := m.DyldExports(); err == nil {
+			for _, exp := range exps {
+				exports = append(exports, exp.Name)
+			}
+		}
+	} else if exps, err := m.GetExports(); err == nil {
+		for _, exp := range exps {
+			exports = append(exports, exp.Name)
+		}
+	}
+	for _, name := range exports {
+		b.Symbols[name] = true
+	}
+	if cstrs, err := m.GetCStrings(); err == nil {
+		for _, sec := range cstrs {
+			for s := range sec {
+				b.Strings = append(b.Strings, s)
+			}
+		}
+	}
+	return b
+}
+
+// Generate fingerprints the open source components of an IPSW (or a folder of MachOs)
+func Generate(path string, conf *Config) (*sbom.SBOM, error) {
+	if fi, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		s := sbom.New(filepath.Base(path), "", nil)
+		if err := search.ForEachMacho(path, func(p string, m *macho.File) error {
+			if rel, err := filepath.Rel(path, p); err == nil {
+				p = "/" + rel
+			}
+			s.Add(NewBinary(p, m))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		s.Sort()
+		return s, nil
+	}
+
+	i, err := info.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse IPSW: %v", err)
+	}
+	s := sbom.New(filepath.Base(path), fmt.Sprintf("%s (%s)",
+		i.Plists.BuildManifest.ProductVersion,
+		i.Plists.BuildManifest.ProductBuildVersion,
+	), nil)
+
+	if conf.Kernel {
+		log.Info("Fingerprinting kernelcache")
+		if err := addKernels(s, path); err != nil {
+			return nil, err
+		}
+	}
+	if conf.DSC {
+		log.Info("Fingerprinting dyld_shared_cache")
+		if err := addDSCs(s, path, conf.PemDB); err != nil {
+			return nil, err
+		}
+	}
+	if conf.FileSystem {
+		if err := search.ForEachMachoInIPSW(path, conf.PemDB, func(p string, m *macho.File) error {
+			s.Add(NewBinary(p, m))
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to scan file system: %v", err)
+		}
+	}
+
+	s.Sort()
+	return s, nil
+}
+
+func addKernels(s *sbom.SBOM, ipswPath string) error {
+	out, err := extract.Kernelcache(&extract.Config{
+		IPSW:   ipswPath,
+		Output: os.TempDir(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extract kernelcache: %w", err)
+	}
+	defer func() {
+		for k := range out {
+			os.Remove(k)
+		}
+	}()
+	for k := range out {
+		m, err := macho.Open(k)
+		if err != nil {
+			return fmt.Errorf("failed to open kernelcache: %w", err)
+		}
+		s.Add(NewBinary(filepath.Base(k), m))
+		if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+			for _, fe := range m.FileSets() {
+				mfe, err := m.GetFileSetFileByName(fe.EntryID)
+				if err != nil {
+					m.Close()
+					return fmt.Errorf("failed to parse entry %s: %v", fe.EntryID, err)
+				}
+				s.Add(NewBinary(fe.EntryID, mfe))
+			}
+		}
+		m.Close()
+	}
+	return nil
+}
+
+func addDSCs(s *sbom.SBOM, ipswPath, pemDB string) error {
+	mctx, fs, err := dsc.OpenFromIPSW(ipswPath, pemDB, false, true)
+	if err != nil {
+		return fmt.Errorf("failed to open DSC from IPSW: %w", err)
+	}
+	defer func() {
+		for _, f := range fs {
+			f.Close()
+		}
+		mctx.Unmount()
+	}()
+	var mu sync.Mutex
+	for _, f := range fs {
+		if err := f.ForEachImage(context.Background(), 0, func(ctx context.Context, idx int, img *dyld.CacheImage) error {
+			m, err := img.GetMacho()
+			if err != nil {
+				return fmt.Errorf("failed to parse dyld_shared_cache image: %w", err)
+			}
+			defer m.Close()
+			b := NewBinary(img.Name, m)
+			mu.Lock()
+			s.Add(b)
+			mu.Unlock()
+			return nil
+		}); err != nil {
+			var imgErrs dyld.ImageErrors
+			if !errors.As(err, &imgErrs) {
+				return err
+			}
+			for _, ie := range imgErrs {
+				log.WithField("image", ie.Image).Warnf("failed to fingerprint dyld_shared_cache image: %v", ie.Err)
+			}
+		}
+	}
+	return nil
+}
+
+// Load reads a previously generated SPDX/CycloneDX SBOM JSON (or generates one from an IPSW or folder)
+func Load(path string, conf *Config) (*sbom.SBOM, error) {
+	if strings.HasSuffix(path, ".json") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return sbom.Read(f)
+	}
+	return Generate(path, conf)
+}
@@ -0,0 +1,408 @@
+// Package xprotect parses (and diffs) the XProtect and MRT malware detection/remediation content of macOS builds
+package xprotect
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/search"
+)
+
+// Components
+const (
+	XProtectBundle = "XProtect.bundle" // detection signatures (XProtect.plist and XProtect.yara)
+	XProtectMeta   = "XProtect.meta"   // plugin/extension blocklists
+	XProtectApp    = "XProtect.app"    // XProtect Remediator
+	MRTApp         = "MRT.app"         // Malware Removal Tool (legacy remediation)
+
+	remediatorPrefix = "XProtectRemediator"
+)
+
+// IsContentFile returns true if the file is part of the XProtect or MRT content
+func IsContentFile(name string) bool {
+	name = filepath.ToSlash(name)
+	switch {
+	case strings.Contains(name, XProtectBundle+"/Contents/"):
+		switch path.Base(name) {
+		case "Info.plist", "XProtect.plist", "XProtect.meta.plist", "XProtect.yara":
+			return true
+		}
+	case strings.HasSuffix(name, XProtectApp+"/Contents/Info.plist"), strings.HasSuffix(name, MRTApp+"/Contents/Info.plist"):
+		return true
+	case strings.Contains(name, XProtectApp+"/Contents/MacOS/"):
+		return strings.HasPrefix(path.Base(name), remediatorPrefix)
+	}
+	return false
+}
+
+// Signature is an XProtect.plist (legacy) detection signature
+type Signature struct {
+	Description string `json:"description"`
+	ContentType string `json:"content_type,omitempty"` // the LaunchServices type it applies to
+	Matches     int    `json:"matches"`
+	digest      string
+}
+
+// Content is the XProtect and MRT content of a build
+type Content struct {
+	// component -> version
+	Versions    map[string]string `json:"versions"`
+	Rules       []Rule            `json:"rules,omitempty"`
+	Signatures  []Signature       `json:"signatures,omitempty"`
+	Remediators []string          `json:"remediators,omitempty"`
+}
+
+// New creates an empty Content
+func New() *Content {
+	return &Content{Versions: make(map[string]string)}
+}
+
+type infoPlist struct {
+	CFBundleShortVersionString string `plist:"CFBundleShortVersionString,omitempty"`
+	CFBundleVersion            string `plist:"CFBundleVersion,omitempty"`
+}
+
+func bundleVersion(name string, data []byte) (string, error) {
+	var info infoPlist
+	if _, err := plist.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	if info.CFBundleShortVersionString != "" {
+		return info.CFBundleShortVersionString, nil
+	}
+	return info.CFBundleVersion, nil
+}
+
+func parseSignatures(name string, data []byte) ([]Signature, error) {
+	var entries []map[string]any
+	if _, err := plist.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	sigs := make([]Signature, 0, len(entries))
+	for _, entry := range entries {
+		sig := Signature{digest: fmt.Sprint(entry)}
+		if desc, ok := entry["Description"].(string); ok {
+			sig.Description = desc
+		}
+		if ls, ok := entry["LaunchServices"].(map[string]any); ok {
+			if typ, ok := ls["LSItemContentType"].(string); ok {
+				sig.ContentType = typ
+			}
+		}
+		if matches, ok := entry["Matches"].([]any); ok {
+			sig.Matches = len(matches)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// Add parses the content file and adds it to the content
+func (c *Content) Add(name string, data []byte) (err error) {
+	name = filepath.ToSlash(name)
+	switch base := path.Base(name); {
+	case base == "XProtect.yara":
+		c.Rules, err = ParseYara(data)
+	case base == "XProtect.plist":
+		c.Signatures, err = parseSignatures(name, data)
+	case base == "XProtect.meta.plist":
+		var meta struct {
+			Version any `plist:"Version,omitempty"`
+		}
+		if _, err := plist.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", name, err)
+		}
+		if meta.Version != nil {
+			c.Versions[XProtectMeta] = fmt.Sprint(meta.Version)
+		}
+	case base == "Info.plist":
+		for _, component := range []string{XProtectBundle, XProtectApp, MRTApp} {
+			if strings.Contains(name, component+"/Contents/") {
+				c.Versions[component], err = bundleVersion(name, data)
+			}
+		}
+	case strings.HasPrefix(base, remediatorPrefix):
+		if !slices.Contains(c.Remediators, base) {
+			c.Remediators = append(c.Remediators, base)
+			slices.Sort(c.Remediators)
+		}
+	default:
+		return fmt.Errorf("%s is not XProtect or MRT content", name)
+	}
+	return err
+}
+
+// AddFolder adds the content in the folder (i.e. a mounted filesystem or an XProtect update)
+func (c *Content) AddFolder(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.WithError(err).Debugf("failed to walk %s", p)
+			return nil
+		}
+		if d.IsDir() || !IsContentFile(p) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := c.Add(p, data); err != nil {
+			log.WithError(err).Debug("skipping XProtect content file")
+		}
+		return nil
+	})
+}
+
+// AddIPSW adds the content in the IPSW's filesystem DMGs
+func (c *Content) AddIPSW(ipswPath, pemDB string) error {
+	return search.ForEachFileInIPSW(ipswPath, pemDB, IsContentFile, func(name string, data []byte) error {
+		if err := c.Add(name, data); err != nil {
+			log.WithError(err).Debug("skipping XProtect content file")
+		}
+		return nil
+	})
+}
+
+// Parse returns the XProtect and MRT content of an IPSW or folder
+func Parse(input, pemDB string) (*Content, error) {
+	c := New()
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", input, err)
+	}
+	if info.IsDir() {
+		err = c.AddFolder(input)
+	} else {
+		err = c.AddIPSW(input, pemDB)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Version is a component whose version changed
+type Version struct {
+	Component string `json:"component"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+// Changes are the names of the added, removed and updated rules/signatures/remediators
+type Changes struct {
+	New     []string `json:"new,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Updated []string `json:"updated,omitempty"`
+}
+
+func (c Changes) empty() bool {
+	return len(c.New) == 0 && len(c.Removed) == 0 && len(c.Updated) == 0
+}
+
+func compare(prev, next map[string]string) Changes {
+	var c Changes
+	for name, val := range next {
+		if old, ok := prev[name]; !ok {
+			c.New = append(c.New, name)
+		} else if old != val {
+			c.Updated = append(c.Updated, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			c.Removed = append(c.Removed, name)
+		}
+	}
+	slices.Sort(c.New)
+	slices.Sort(c.Removed)
+	slices.Sort(c.Updated)
+	return c
+}
+
+// Diff is the difference between the XProtect and MRT content of two builds
+type Diff struct {
+	Versions    []Version `json:"versions,omitempty"`
+	Rules       Changes   `json:"rules"`
+	Signatures  Changes   `json:"signatures"`
+	Remediators Changes   `json:"remediators"`
+}
+
+// Compare diffs the content of two builds
+func Compare(prev, next *Content) *Diff {
+	d := &Diff{}
+	for _, component := range []string{XProtectBundle, XProtectMeta, XProtectApp, MRTApp} {
+		if o, n := prev.Versions[component], next.Versions[component]; o != n {
+			d.Versions = append(d.Versions, Version{Component: component, Old: o, New: n})
+		}
+	}
+	rules := func(c *Content) map[string]string {
+		m := make(map[string]string, len(c.Rules))
+		for _, r := range c.Rules {
+			m[r.Name] = r.Body
+		}
+		return m
+	}
+	d.Rules = compare(rules(prev), rules(next))
+	sigs := func(c *Content) map[string]string {
+		m := make(map[string]string, len(c.Signatures))
+		for _, s := range c.Signatures {
+			m[s.Description] += s.digest // descriptions aren't always unique
+		}
+		return m
+	}
+	d.Signatures = compare(sigs(prev), sigs(next))
+	remediators := func(c *Content) map[string]string {
+		m := make(map[string]string, len(c.Remediators))
+		for _, r := range c.Remediators {
+			m[r] = ""
+		}
+		return m
+	}
+	d.Remediators = compare(remediators(prev), remediators(next))
+	return d
+}
+
+// Empty returns true if nothing changed
+func (d *Diff) Empty() bool {
+	return len(d.Versions) == 0 && d.Rules.empty() && d.Signatures.empty() && d.Remediators.empty()
+}
+
+// Markdown returns the diff as Markdown
+func (d *Diff) Markdown() string {
+	var out strings.Builder
+	if len(d.Versions) > 0 {
+		out.WriteString("| Component | Old | New |\n| :-------- | :-- | :-- |\n")
+		for _, v := range d.Versions {
+			fmt.Fprintf(&out, "| %s | %s | %s |\n", v.Component, v.Old, v.New)
+		}
+		out.WriteString("\n")
+	}
+	for _, sec := range []struct {
+		title   string
+		changes Changes
+	}{
+		{"Yara Rules", d.Rules},
+		{"Remediators", d.Remediators},
+		{"Signatures", d.Signatures},
+	} {
+		for _, list := range []struct {
+			title string
+			names []string
+		}{
+			{"🆕 NEW", sec.changes.New},
+			{"❌ Removed", sec.changes.Removed},
+			{"⬆️ Updated", sec.changes.Updated},
+		} {
+			if len(list.names) == 0 {
+				continue
+			}
+			fmt.Fprintf(&out, "#### %s %s (%d)\n\n", list.title, sec.title, len(list.names))
+			for _, name := range list.names {
+				fmt.Fprintf(&out, "- `%s`\n", name)
+			}
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
+
+// Rule is a Yara rule
+type Rule struct {
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags,omitempty"`
+	Private bool              `json:"private,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	// the rule's body (with normalized whitespace)
+	Body string `json:"-"`
+}
+
+var (
+	ruleRE = regexp.MustCompile(`(?m)^[ \t]*((?:(?:private|global)[ \t]+)*)rule[ \t]+(\w+)[ \t]*(?::([\w \t]+))?\s*\{`)
+	metaRE = regexp.MustCompile(`(?m)^\s*(\w+)\s*=\s*("(?:[^"\\]|\\.)*"|\S+)`)
+)
+
+// ruleEnd returns the index of the brace that closes the rule's body (skipping strings, regexes and comments)
+func ruleEnd(data []byte, start int) int {
+	depth := 0
+	for i := start; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			for i++; i < len(data) && data[i] != '"' && data[i] != '\n'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+		case '/':
+			switch {
+			case i+1 < len(data) && data[i+1] == '/':
+				for ; i < len(data) && data[i] != '\n'; i++ {
+				}
+			case i+1 < len(data) && data[i+1] == '*':
+				if end := bytes.Index(data[i+2:], []byte("*/")); end >= 0 {
+					i += end + 3
+				} else {
+					i = len(data)
+				}
+			}
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ParseYara returns the rules of a Yara rules file
+func ParseYara(data []byte) ([]Rule, error) {
+	var rules []Rule
+	pos := 0
+	for {
+		loc := ruleRE.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		for i := range loc {
+			if loc[i] >= 0 {
+				loc[i] += pos
+			}
+		}
+		r := Rule{
+			Name:    string(data[loc[4]:loc[5]]),
+			Private: loc[2] >= 0 && bytes.Contains(data[loc[2]:loc[3]], []byte("private")),
+		}
+		if loc[6] >= 0 {
+			r.Tags = strings.Fields(string(data[loc[6]:loc[7]]))
+		}
+		open := loc[1] - 1
+		end := ruleEnd(data, open)
+		if end < 0 {
+			return nil, fmt.Errorf("failed to find the end of yara rule %s", r.Name)
+		}
+		body := data[open+1 : end]
+		r.Body = strings.Join(strings.Fields(string(body)), " ")
+		if _, meta, ok := bytes.Cut(body, []byte("meta:")); ok {
+			for _, section := range []string{"strings:", "condition:"} {
+				meta, _, _ = bytes.Cut(meta, []byte(section))
+			}
+			r.Meta = make(map[string]string)
+			for _, m := range metaRE.FindAllSubmatch(meta, -1) {
+				r.Meta[string(m[1])] = strings.Trim(string(m[2]), `"`)
+			}
+		}
+		rules = append(rules, r)
+		pos = end + 1
+	}
+	return rules, nil
+}
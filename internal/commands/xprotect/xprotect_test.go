@@ -0,0 +1,78 @@
+package xprotect
+
+import (
+	"slices"
+	"testing"
+)
+
+const testYara = `
+import "hash"
+
+private rule Macho
+{
+    meta:
+        description = "private rule to match Mach-O binaries"
+    condition:
+        uint32(0) == 0xfeedface or uint32(0) == 0xfeedfacf
+}
+
+rule XProtect_MACOS_ADLOAD_A : adware macos
+{
+    meta:
+        description = "MACOS.ADLOAD.A"
+        uuid = "A7E3C2B4-3F5E-4C2A-9D1C-0E9F6B1D2C3A" // "}" in a comment
+    strings:
+        $a = { 5F 5F 4D 41 43 4F 53 }
+        $b = "dl.{cdn}.com"
+    condition:
+        Macho and all of them
+}
+`
+
+func TestParseYara(t *testing.T) {
+	rules, err := ParseYara([]byte(testYara))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("ParseYara() returned %d rules, expected 2", len(rules))
+	}
+	if !rules[0].Private || rules[0].Name != "Macho" {
+		t.Errorf("rules[0] = %+v", rules[0])
+	}
+	r := rules[1]
+	if r.Name != "XProtect_MACOS_ADLOAD_A" || !slices.Equal(r.Tags, []string{"adware", "macos"}) || r.Meta["description"] != "MACOS.ADLOAD.A" {
+		t.Errorf("rules[1] = %+v", r)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	rules, err := ParseYara([]byte(testYara))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := New()
+	prev.Versions[XProtectBundle] = "2192"
+	prev.Rules = rules[:1]
+	prev.Remediators = []string{"XProtectRemediatorAdload", "XProtectRemediatorPirrit"}
+
+	next := New()
+	next.Versions[XProtectBundle] = "2193"
+	next.Rules = slices.Clone(rules)
+	next.Rules[0].Body += " or uint32(0) == 0xcafebabe"
+	next.Remediators = []string{"XProtectRemediatorAdload", "XProtectRemediatorRankStank"}
+
+	d := Compare(prev, next)
+	if len(d.Versions) != 1 || d.Versions[0].Old != "2192" || d.Versions[0].New != "2193" {
+		t.Errorf("Versions = %+v", d.Versions)
+	}
+	if !slices.Equal(d.Rules.New, []string{"XProtect_MACOS_ADLOAD_A"}) || !slices.Equal(d.Rules.Updated, []string{"Macho"}) {
+		t.Errorf("Rules = %+v", d.Rules)
+	}
+	if !slices.Equal(d.Remediators.New, []string{"XProtectRemediatorRankStank"}) || !slices.Equal(d.Remediators.Removed, []string{"XProtectRemediatorPirrit"}) {
+		t.Errorf("Remediators = %+v", d.Remediators)
+	}
+	if d.Empty() {
+		t.Error("Empty() = true")
+	}
+}
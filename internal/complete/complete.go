@@ -0,0 +1,161 @@
+// Package complete provides dynamic shell completions from ipsw's local state: the UUIDs with cached analyses,
+// recently used firmware files, the device database and the kexts of a kernelcache.
+//
+// The completion functions never fail the shell; when the state can't be read they fall back to the shell's
+// default (file) completion or to no suggestions.
+package complete
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/cache"
+	"github.com/blacktop/ipsw/pkg/devicedb"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Func is a cobra ValidArgsFunction/flag completion function
+type Func func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+func hasPrefix(s, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
+
+// analysisCache returns the analysis cache (even if caching is disabled for this run so its UUIDs can be listed)
+func analysisCache() *cache.Cache {
+	if c := cache.Default(); c != nil {
+		return c
+	}
+	c, err := cache.New(viper.GetString("analysis-cache-dir"), "")
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// UUIDs completes the UUIDs of the MachOs/dyld_shared_caches with cached analyses (most recently analyzed first)
+func UUIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	entries, err := analysisCache().Entries()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var comps []string
+	for _, e := range entries {
+		if hasPrefix(e.UUID, toComplete) {
+			comps = append(comps, e.UUID+"\tcached "+strings.Join(e.Kinds, ", "))
+		}
+	}
+	return comps, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+// Firmware completes firmware file arguments with the recently used files (see Remember), falling back to file
+// completion of the extensions (i.e. "ipsw", "zip") once a relative path is being typed
+func Firmware(exts ...string) Func {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		recent, _ := analysisCache().Recent()
+		var comps []string
+		for _, path := range recent {
+			if strings.HasPrefix(path, toComplete) && (len(exts) == 0 || hasExt(path, exts)) {
+				comps = append(comps, path)
+			}
+		}
+		if len(comps) > 0 {
+			return comps, cobra.ShellCompDirectiveKeepOrder
+		}
+		if len(exts) > 0 {
+			return exts, cobra.ShellCompDirectiveFilterFileExt
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+}
+
+func hasExt(path string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.EqualFold(filepath.Ext(path), "."+ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirmwareExts are the extensions of the firmware files Remember records
+var FirmwareExts = []string{"ipsw", "zip", "aea", "dmg"}
+
+// Remember records the firmware files in args as recently used (it is a no-op if the analysis cache is disabled)
+func Remember(args []string) {
+	var paths []string
+	for _, arg := range args {
+		if hasExt(arg, FirmwareExts) {
+			if fi, err := os.Stat(arg); err == nil && !fi.IsDir() {
+				paths = append(paths, arg)
+			}
+		}
+	}
+	cache.Default().Remember(paths...)
+}
+
+// Devices completes device identifiers (i.e. iPhone15,2)
+func Devices(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	db, err := devicedb.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return db.Complete(toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// Models completes device board models (i.e. D73AP)
+func Models(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	db, err := devicedb.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return db.CompleteModel(toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// Kexts completes the bundle IDs of the kexts in the kernelcache given as the first argument (the first argument
+// itself is completed as a file)
+func Kexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	ids, err := KextIDs(args[0])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var comps []string
+	for _, id := range ids {
+		if hasPrefix(id, toComplete) && !slices.Contains(args[1:], id) {
+			comps = append(comps, id)
+		}
+	}
+	return comps, cobra.ShellCompDirectiveNoFileComp
+}
+
+// KextIDs returns the bundle IDs of the kexts (fileset entries) in a kernelcache
+func KextIDs(path string) ([]string, error) {
+	m, err := kernelcache.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	var ids []string
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		for _, fe := range m.FileSets() {
+			ids = append(ids, fe.EntryID)
+		}
+		return ids, nil
+	}
+	kexts, err := kernelcache.GetKexts(m)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range kexts {
+		ids = append(ids, k.ID)
+	}
+	return ids, nil
+}
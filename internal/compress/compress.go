@@ -0,0 +1,236 @@
+// Package compress provides streaming (de)compression for the codecs found in firmware assets and third-party re-packs
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Format is a compression format
+type Format string
+
+const (
+	None  Format = ""
+	Gzip  Format = "gzip"
+	Bzip2 Format = "bzip2"
+	Zstd  Format = "zstd"
+	Xz    Format = "xz"
+	Lzma  Format = "lzma"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// ErrUnsupported is returned when a format can't be (de)compressed
+var ErrUnsupported = errcode.New(errcode.Unsupported, "unsupported compression format")
+
+// Formats returns the supported compression formats
+func Formats() []Format {
+	return []Format{Gzip, Bzip2, Zstd, Xz, Lzma}
+}
+
+// Ext returns the file extension for the format
+func (f Format) Ext() string {
+	switch f {
+	case Gzip:
+		return ".gz"
+	case Bzip2:
+		return ".bz2"
+	case Zstd:
+		return ".zst"
+	case Xz:
+		return ".xz"
+	case Lzma:
+		return ".lzma"
+	default:
+		return ""
+	}
+}
+
+// FromExt returns the format for a file's extension
+func FromExt(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".tgz":
+		return Gzip
+	case ".bz2", ".tbz":
+		return Bzip2
+	case ".zst", ".zstd", ".tzst":
+		return Zstd
+	case ".xz", ".txz":
+		return Xz
+	case ".lzma":
+		return Lzma
+	default:
+		return None
+	}
+}
+
+// Detect returns the compression format of data from its header
+func Detect(hdr []byte) Format {
+	switch {
+	case bytes.HasPrefix(hdr, magicGzip):
+		return Gzip
+	case bytes.HasPrefix(hdr, magicZstd):
+		return Zstd
+	case bytes.HasPrefix(hdr, magicXz):
+		return Xz
+	case bytes.HasPrefix(hdr, magicBzip2) && len(hdr) > 3 && hdr[3] >= '1' && hdr[3] <= '9':
+		return Bzip2
+	case isLzma(hdr):
+		return Lzma
+	default:
+		return None
+	}
+}
+
+// isLzma checks for a legacy .lzma ("LZMA alone") header: properties byte + power of 2 dictionary size
+func isLzma(hdr []byte) bool {
+	if len(hdr) < 13 || hdr[0] >= 9*5*5 {
+		return false
+	}
+	dictSize := uint32(hdr[1]) | uint32(hdr[2])<<8 | uint32(hdr[3])<<16 | uint32(hdr[4])<<24
+	if dictSize < 1<<12 || dictSize&(dictSize-1) != 0 {
+		return false
+	}
+	// uncompressed size is either unknown (-1) or sane
+	return hdr[12] == 0x00 || bytes.Equal(hdr[5:13], bytes.Repeat([]byte{0xff}, 8))
+}
+
+// DetectFile returns the compression format of a file
+func DetectFile(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return None, err
+	}
+	defer f.Close()
+	hdr := make([]byte, 16)
+	n, err := io.ReadFull(f, hdr)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return None, fmt.Errorf("failed to read header of %s: %v", path, err)
+	}
+	return Detect(hdr[:n]), nil
+}
+
+// NewFormatReader returns a decompressing reader for the format
+func NewFormatReader(r io.Reader, f Format) (io.ReadCloser, error) {
+	switch f {
+	case None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case Xz:
+		return xz.NewReader(r)
+	case Lzma:
+		lr, err := lzma.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(lr), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, f)
+	}
+}
+
+// NewReader returns a reader that transparently decompresses r (if it is compressed)
+func NewReader(r io.Reader) (io.ReadCloser, Format, error) {
+	br := bufio.NewReader(r)
+	hdr, err := br.Peek(16)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, None, err
+	}
+	format := Detect(hdr)
+	rc, err := NewFormatReader(br, format)
+	if err != nil {
+		return nil, format, fmt.Errorf("failed to create %s reader: %v", format, err)
+	}
+	return rc, format, nil
+}
+
+// NewWriter returns a compressing writer for the format
+func NewWriter(w io.Writer, f Format) (io.WriteCloser, error) {
+	switch f {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	case Xz:
+		return xz.NewWriter(w)
+	case Lzma:
+		return lzma.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("%w: %s (writing)", ErrUnsupported, f)
+	}
+}
+
+// DecompressFile decompresses src into the output folder (removing the compression extension) and returns the output path
+//
+// If src is NOT compressed it is returned as-is.
+func DecompressFile(src, output string) (string, error) {
+	format, err := DetectFile(src)
+	if err != nil {
+		return "", err
+	}
+	if format == None {
+		return src, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	rc, err := NewFormatReader(bufio.NewReader(in), format)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s reader: %v", format, err)
+	}
+	defer rc.Close()
+
+	name := filepath.Base(src)
+	if FromExt(name) == format {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	} else {
+		name += ".decompressed"
+	}
+	if err := os.MkdirAll(output, 0o750); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(output, name)
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, rc); err != nil {
+		os.Remove(dst)
+		return "", fmt.Errorf("failed to %s decompress %s: %v", format, src, err)
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,73 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("dyld_shared_cache_arm64e "), 1024)
+
+	for _, format := range []Format{Gzip, Zstd, Xz, Lzma} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := Detect(buf.Bytes()); got != format {
+				t.Fatalf("Detect() = %q, want %q", got, format)
+			}
+
+			rc, detected, err := NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if detected != format {
+				t.Errorf("NewReader() format = %q, want %q", detected, format)
+			}
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("decompressed %d bytes, want %d", len(got), len(data))
+			}
+
+			dir := t.TempDir()
+			src := filepath.Join(dir, "test.bin"+format.Ext())
+			if err := os.WriteFile(src, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			dst, err := DecompressFile(src, filepath.Join(dir, "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Base(dst) != "test.bin" {
+				t.Errorf("DecompressFile() = %s", dst)
+			}
+		})
+	}
+}
+
+func TestDetectPlain(t *testing.T) {
+	for _, hdr := range [][]byte{
+		{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0x00, 0x00, 0x01, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}, // MachO
+		[]byte("PK\x03\x04\x14\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00\x00"),                             // zip
+	} {
+		if got := Detect(hdr); got != None {
+			t.Errorf("Detect(%x) = %q, want none", hdr, got)
+		}
+	}
+}
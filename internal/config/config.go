@@ -6,7 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/blacktop/ipsw/internal/webhook"
 	env "github.com/caarlos0/env/v8"
 	"github.com/spf13/viper"
 )
@@ -19,6 +21,9 @@ type daemon struct {
 	LogFile string `json:"logfile" env:"DAEMON_LOGFILE"`
 	PemDB   string `json:"pem_db" mapstructure:"pem-db" env:"DAEMON_PEM_DB"`
 	SigsDir string `json:"sigs_dir" mapstructure:"sigs-dir" env:"DAEMON_SIGS_DIR"`
+	// number of dyld_shared_caches/kernelcaches kept open between API requests (-1 disables the cache)
+	CacheSize int           `json:"cache_size" mapstructure:"cache-size" env:"DAEMON_CACHE_SIZE" envDefault:"4"`
+	CacheTTL  time.Duration `json:"cache_ttl" mapstructure:"cache-ttl" env:"DAEMON_CACHE_TTL" envDefault:"30m"`
 }
 
 type database struct {
@@ -33,10 +38,28 @@ type database struct {
 	BatchSize int    `json:"batchsize" env:"DB_BATCHSIZE" envDefault:"1000"`
 }
 
+type cluster struct {
+	// coordinator (serves the job queue API) or worker (also leases and runs jobs); empty is standalone
+	Role     string        `json:"role" env:"CLUSTER_ROLE"`
+	WorkerID string        `json:"worker_id" mapstructure:"worker-id" env:"CLUSTER_WORKER_ID"`
+	Kinds    []string      `json:"kinds" env:"CLUSTER_KINDS"`
+	Lease    time.Duration `json:"lease" env:"CLUSTER_LEASE" envDefault:"10m"`
+	Poll     time.Duration `json:"poll" env:"CLUSTER_POLL" envDefault:"5s"`
+}
+
+type watch struct {
+	// device identifiers (i.e. iPhone15,2) to watch for new builds (fires the feed.new_build webhooks)
+	Devices  []string      `json:"devices" env:"WATCH_DEVICES" envSeparator:" "`
+	Interval time.Duration `json:"interval" env:"WATCH_INTERVAL" envDefault:"1h"`
+}
+
 // Config is the configuration struct
 type Config struct {
-	Daemon   daemon   `json:"daemon"`
-	Database database `json:"database"`
+	Daemon   daemon          `json:"daemon"`
+	Database database        `json:"database"`
+	Cluster  cluster         `json:"cluster"`
+	Webhooks []*webhook.Hook `json:"webhooks"`
+	Watch    watch           `json:"watch"`
 }
 
 func (c *Config) verify() error {
@@ -65,6 +88,39 @@ func (c *Config) verify() error {
 	if c.Database.BatchSize == 0 {
 		c.Database.BatchSize = 1000
 	}
+	if c.Daemon.CacheSize == 0 {
+		c.Daemon.CacheSize = 4
+	}
+	if c.Daemon.CacheTTL == 0 {
+		c.Daemon.CacheTTL = 30 * time.Minute
+	}
+	// verify cluster
+	switch c.Cluster.Role {
+	case "":
+	case "coordinator", "worker":
+		if c.Database.Driver != "sqlite" && c.Database.Driver != "postgres" {
+			return fmt.Errorf("config: cluster mode requires a shared sqlite or postgres database")
+		}
+	default:
+		return fmt.Errorf("config: invalid cluster role '%s' (must be coordinator or worker)", c.Cluster.Role)
+	}
+	if c.Cluster.Role == "worker" && c.Cluster.WorkerID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("config: failed to get hostname for cluster worker-id: %v", err)
+		}
+		c.Cluster.WorkerID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if c.Cluster.Lease == 0 {
+		c.Cluster.Lease = 10 * time.Minute
+	}
+	if c.Cluster.Poll == 0 {
+		c.Cluster.Poll = 5 * time.Second
+	}
+	// verify watch
+	if c.Watch.Interval == 0 {
+		c.Watch.Interval = time.Hour
+	}
 
 	return nil
 }
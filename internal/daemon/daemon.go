@@ -2,12 +2,15 @@
 package daemon
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/api/server"
 	"github.com/blacktop/ipsw/internal/config"
 	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/webhook"
 	"github.com/gin-gonic/gin"
 )
 
@@ -20,9 +23,11 @@ type Daemon interface {
 }
 
 type daemon struct {
-	server *server.Server
-	db     db.Database
-	conf   *config.Config
+	server  *server.Server
+	db      db.Database
+	cluster db.Cluster
+	tags    db.Tags
+	conf    *config.Config
 }
 
 // NewDaemon creates a new daemon.
@@ -31,39 +36,46 @@ func NewDaemon() Daemon {
 }
 
 func (d *daemon) setupDB() (err error) {
-	switch d.conf.Database.Driver {
+	d.db, err = OpenDB(d.conf)
+	return err
+}
+
+// OpenDB connects to the configured database (it returns nil if no database is configured).
+func OpenDB(conf *config.Config) (d db.Database, err error) {
+	switch conf.Database.Driver {
 	case "sqlite":
-		d.db, err = db.NewSqlite(d.conf.Database.Path, d.conf.Database.BatchSize)
+		d, err = db.NewSqlite(conf.Database.Path, conf.Database.BatchSize)
 		if err != nil {
-			return fmt.Errorf("failed to create sqlite database: %w", err)
+			return nil, fmt.Errorf("failed to create sqlite database: %w", err)
 		}
-		return d.db.Connect()
 	case "postgres":
-		d.db, err = db.NewPostgres(
-			d.conf.Database.Host,
-			d.conf.Database.Port,
-			d.conf.Database.User,
-			d.conf.Database.Password,
-			d.conf.Database.Name,
-			d.conf.Database.BatchSize,
+		d, err = db.NewPostgres(
+			conf.Database.Host,
+			conf.Database.Port,
+			conf.Database.User,
+			conf.Database.Password,
+			conf.Database.Name,
+			conf.Database.BatchSize,
 		)
 		if err != nil {
-			return fmt.Errorf("failed to create postgres database: %w", err)
+			return nil, fmt.Errorf("failed to create postgres database: %w", err)
 		}
-		return d.db.Connect()
 	case "memory":
-		d.db, err = db.NewInMemory(d.conf.Database.Path)
+		d, err = db.NewInMemory(conf.Database.Path)
 		if err != nil {
-			return fmt.Errorf("failed to create in-memory database: %w", err)
+			return nil, fmt.Errorf("failed to create in-memory database: %w", err)
 		}
-		return d.db.Connect()
 	default:
-		if d.conf.Database.Driver != "" {
-			return fmt.Errorf("unsupported database driver: '%s'", d.conf.Database.Driver)
+		if conf.Database.Driver != "" {
+			return nil, fmt.Errorf("unsupported database driver: '%s'", conf.Database.Driver)
 		}
+		log.Debug("daemon start: no database")
+		return nil, nil
 	}
-	log.Debug("daemon start: no database")
-	return nil
+	if err := d.Connect(); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
 func (d *daemon) Start() (err error) {
@@ -84,11 +96,87 @@ func (d *daemon) Start() (err error) {
 		LogFile: d.conf.Daemon.LogFile,
 		PemDB:   d.conf.Daemon.PemDB,
 		SigsDir: d.conf.Daemon.SigsDir,
+		// open file cache
+		CacheSize: d.conf.Daemon.CacheSize,
+		CacheTTL:  d.conf.Daemon.CacheTTL,
 	})
 	if err := d.setupDB(); err != nil {
 		return err
 	}
-	return d.server.Start(d.db)
+	if err := d.setupCluster(); err != nil {
+		return err
+	}
+	d.setupTags()
+	if err := d.setupWebhooks(); err != nil {
+		return err
+	}
+	if d.conf.Cluster.Role == "worker" {
+		kinds, err := db.ParseJobKinds(strings.Join(d.conf.Cluster.Kinds, ","))
+		if err != nil {
+			return fmt.Errorf("config: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go (&worker{
+			id:      d.conf.Cluster.WorkerID,
+			kinds:   kinds,
+			lease:   d.conf.Cluster.Lease,
+			poll:    d.conf.Cluster.Poll,
+			pemDB:   d.conf.Daemon.PemDB,
+			sigsDir: d.conf.Daemon.SigsDir,
+			cluster: d.cluster,
+			db:      d.db,
+		}).run(ctx)
+	}
+	if len(d.conf.Watch.Devices) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go (&watcher{
+			devices:  d.conf.Watch.Devices,
+			interval: d.conf.Watch.Interval,
+		}).run(ctx)
+	}
+	return d.server.Start(d.db, d.cluster, d.tags)
+}
+
+func (d *daemon) setupCluster() (err error) {
+	if d.conf.Cluster.Role == "" {
+		return nil
+	}
+	if d.db == nil {
+		return fmt.Errorf("cluster mode requires a database")
+	}
+	d.cluster, err = db.NewCluster(d.db)
+	if err != nil {
+		return err
+	}
+	log.WithField("role", d.conf.Cluster.Role).Info("Cluster mode")
+	return nil
+}
+
+func (d *daemon) setupWebhooks() error {
+	if len(d.conf.Webhooks) == 0 {
+		return nil
+	}
+	hooks, err := webhook.NewDispatcher(d.conf.Webhooks)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	webhook.SetDefault(hooks)
+	log.WithField("count", len(d.conf.Webhooks)).Info("Webhooks enabled")
+	return nil
+}
+
+func (d *daemon) setupTags() {
+	if d.db == nil {
+		return
+	}
+	tags, err := db.NewTags(d.db)
+	if err != nil {
+		log.WithError(err).Debug("daemon start: tags disabled")
+		return
+	}
+	d.tags = tags
 }
 
 func (d *daemon) Stop() error {
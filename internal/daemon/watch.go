@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/webhook"
+)
+
+// watcher polls ipsw.me for new builds of the watched devices
+type watcher struct {
+	devices  []string
+	interval time.Duration
+
+	seen   map[string]bool // device/build
+	seeded map[string]bool // the device's existing builds have been seen (so they aren't "new")
+}
+
+func (w *watcher) run(ctx context.Context) {
+	w.seen = make(map[string]bool)
+	w.seeded = make(map[string]bool)
+	w.poll()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+func (w *watcher) poll() {
+	for _, device := range w.devices {
+		ipsws, err := download.GetDeviceIPSWs(device)
+		if err != nil {
+			log.WithField("device", device).Errorf("watch: failed to get IPSWs: %v", err)
+			continue
+		}
+		for _, i := range ipsws {
+			key := device + "/" + i.BuildID
+			if w.seen[key] {
+				continue
+			}
+			w.seen[key] = true
+			if !w.seeded[device] {
+				continue
+			}
+			log.WithFields(log.Fields{"device": device, "version": i.Version, "build": i.BuildID}).Info("Found new build")
+			webhook.Fire(webhook.EventNewBuild, fmt.Sprintf("New %s build %s (%s)", device, i.Version, i.BuildID), map[string]string{
+				"device":  device,
+				"version": i.Version,
+				"build":   i.BuildID,
+				"url":     i.URL,
+				"signed":  fmt.Sprintf("%t", i.Signed),
+			})
+		}
+		w.seeded[device] = true
+	}
+}
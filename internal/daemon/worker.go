@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/commands/extract"
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/blacktop/ipsw/internal/syms"
+)
+
+// worker leases jobs from the cluster's shared database and runs them
+type worker struct {
+	id      string
+	kinds   []model.JobKind
+	lease   time.Duration
+	poll    time.Duration
+	pemDB   string
+	sigsDir string
+
+	cluster db.Cluster
+	db      db.Database
+}
+
+func (w *worker) register() error {
+	host, _ := os.Hostname()
+	var kinds []string
+	for _, k := range w.kinds {
+		kinds = append(kinds, string(k))
+	}
+	return w.cluster.RegisterWorker(&model.Worker{ID: w.id, Host: host, Kinds: strings.Join(kinds, ",")})
+}
+
+// run leases and runs jobs until ctx is canceled
+func (w *worker) run(ctx context.Context) {
+	if err := w.register(); err != nil {
+		log.Errorf("cluster worker %s: failed to register: %v", w.id, err)
+		return
+	}
+	log.WithField("id", w.id).Info("Cluster worker registered")
+	ticker := time.NewTicker(w.poll)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil { // drain the queue before waiting
+			job, err := w.cluster.LeaseJob(w.id, w.kinds, w.lease)
+			if errors.Is(err, model.ErrNotFound) {
+				break
+			} else if err != nil {
+				log.Errorf("cluster worker %s: failed to lease job: %v", w.id, err)
+				break
+			}
+			w.runJob(ctx, job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.cluster.Heartbeat(w.id); errors.Is(err, model.ErrNotFound) {
+				err = w.register() // the worker was pruned from the DB
+				if err != nil {
+					log.Errorf("cluster worker %s: failed to re-register: %v", w.id, err)
+				}
+			} else if err != nil {
+				log.Errorf("cluster worker %s: failed to heartbeat: %v", w.id, err)
+			}
+		}
+	}
+}
+
+func (w *worker) runJob(ctx context.Context, job *model.Job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// keep the lease alive while the job runs (and stop working on it if another worker took it over)
+	go func() {
+		ticker := time.NewTicker(w.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.cluster.RenewLease(job.ID, w.id, w.lease); err != nil {
+					log.Errorf("cluster worker %s: failed to renew lease on job %d: %v", w.id, job.ID, err)
+					if errors.Is(err, db.ErrLeaseLost) {
+						cancel()
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	l := log.WithFields(log.Fields{"job": job.ID, "kind": job.Kind, "attempt": job.Attempts})
+	l.Info("Running job")
+	result, err := w.do(ctx, job)
+	if ctx.Err() != nil && err == nil {
+		err = ctx.Err()
+	}
+	if cerr := w.cluster.CompleteJob(job.ID, w.id, result, err); cerr != nil {
+		l.Errorf("failed to complete job: %v", cerr)
+		return
+	}
+	if err != nil {
+		l.WithError(err).Error("Job failed")
+	} else {
+		l.Info("Job done")
+	}
+}
+
+func (w *worker) do(ctx context.Context, job *model.Job) (string, error) {
+	pemDB, sigsDir := job.PemDB, job.SigsDir
+	if pemDB == "" {
+		pemDB = w.pemDB
+	}
+	if sigsDir == "" {
+		sigsDir = w.sigsDir
+	}
+	switch job.Kind {
+	case model.JobScan:
+		return "", syms.ScanContext(ctx, filepath.Clean(job.Path), pemDB, sigsDir, w.db)
+	case model.JobRescan:
+		return "", syms.RescanContext(ctx, filepath.Clean(job.Path), pemDB, sigsDir, w.db)
+	case model.JobExtract:
+		var conf extract.Config
+		if err := json.Unmarshal([]byte(job.Config), &conf); err != nil {
+			return "", fmt.Errorf("invalid extract config: %v", err)
+		}
+		if conf.PemDB == "" {
+			conf.PemDB = pemDB
+		}
+		var artifacts any
+		var err error
+		switch job.Extract {
+		case "kernel":
+			artifacts, err = extract.Kernelcache(&conf)
+		case "dsc":
+			artifacts, err = extract.DSC(&conf)
+		case "dmg":
+			artifacts, err = extract.DMG(&conf)
+		case "pattern":
+			artifacts, err = extract.Search(&conf)
+		case "sptm":
+			artifacts, err = extract.SPTM(&conf)
+		default:
+			return "", fmt.Errorf("invalid extract type '%s' (must be one of: %s)", job.Extract, strings.Join(model.ExtractTypes, ", "))
+		}
+		if err != nil {
+			return "", err
+		}
+		out, err := json.Marshal(map[string]any{"artifacts": artifacts})
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal artifacts: %v", err)
+		}
+		return string(out), nil
+	default:
+		return "", fmt.Errorf("unsupported job kind '%s'", job.Kind)
+	}
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLeaseLost is returned when a worker's job lease expired and the job was leased by another worker.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// DefaultMaxAttempts is how many times a job is leased before it is marked failed
+const DefaultMaxAttempts = 3
+
+const leaseRetries = 5
+
+// Cluster is the job queue shared by the ipswd instances (coordinator and workers) using the same database.
+type Cluster interface {
+	// RegisterWorker creates or updates the worker.
+	RegisterWorker(worker *model.Worker) error
+
+	// Heartbeat updates the worker's last seen time.
+	// It returns ErrNotFound if the worker is not registered.
+	Heartbeat(id string) error
+
+	// GetWorkers returns every registered worker.
+	GetWorkers() ([]*model.Worker, error)
+
+	// CreateJob queues a new job.
+	CreateJob(job *model.Job) error
+
+	// GetJob returns the job for the given ID.
+	// It returns ErrNotFound if the job does not exist.
+	GetJob(id uint) (*model.Job, error)
+
+	// GetJobs returns the jobs with the given status (or every job if status is empty).
+	GetJobs(status model.JobStatus) ([]*model.Job, error)
+
+	// LeaseJob leases the oldest pending (or expired) job of the given kinds (or any kind) to the worker.
+	// It returns ErrNotFound if there is no job to lease.
+	LeaseJob(worker string, kinds []model.JobKind, ttl time.Duration) (*model.Job, error)
+
+	// RenewLease extends the worker's lease on the job.
+	// It returns ErrLeaseLost if the worker no longer holds the lease.
+	RenewLease(id uint, worker string, ttl time.Duration) error
+
+	// CompleteJob marks the worker's job done (or failed if jobErr is not nil).
+	// It returns ErrLeaseLost if the worker no longer holds the lease.
+	CompleteJob(id uint, worker string, result string, jobErr error) error
+}
+
+// NewCluster returns the job queue of a database that can be shared by multiple ipswd instances.
+func NewCluster(d Database) (Cluster, error) {
+	var gdb *gorm.DB
+	switch d := d.(type) {
+	case *Sqlite:
+		gdb = d.db
+	case *Postgres:
+		gdb = d.db
+	default:
+		return nil, fmt.Errorf("cluster mode requires a sqlite or postgres database (not %T)", d)
+	}
+	if gdb == nil {
+		return nil, fmt.Errorf("cluster: database is not connected")
+	}
+	if err := gdb.AutoMigrate(&model.Job{}, &model.Worker{}); err != nil {
+		return nil, fmt.Errorf("cluster: failed to migrate database: %w", err)
+	}
+	return &cluster{db: gdb}, nil
+}
+
+type cluster struct {
+	db *gorm.DB
+}
+
+func (c *cluster) RegisterWorker(worker *model.Worker) error {
+	worker.LastSeen = time.Now()
+	return c.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"host", "kinds", "last_seen"}),
+	}).Create(worker).Error
+}
+
+func (c *cluster) Heartbeat(id string) error {
+	res := c.db.Model(&model.Worker{}).Where("id = ?", id).Update("last_seen", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (c *cluster) GetWorkers() ([]*model.Worker, error) {
+	var workers []*model.Worker
+	if err := c.db.Order("id").Find(&workers).Error; err != nil {
+		return nil, err
+	}
+	return workers, nil
+}
+
+func (c *cluster) CreateJob(job *model.Job) error {
+	job.ID = 0
+	job.Status = model.JobPending
+	job.Worker, job.Attempts, job.Lease = "", 0, 0
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	return c.db.Create(job).Error
+}
+
+func (c *cluster) GetJob(id uint) (*model.Job, error) {
+	var job model.Job
+	if err := c.db.First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, model.ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *cluster) GetJobs(status model.JobStatus) ([]*model.Job, error) {
+	var jobs []*model.Job
+	q := c.db.Order("id")
+	if len(status) > 0 {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// LeaseJob uses optimistic locking (the job's lease counter) so it works the same on sqlite and postgres:
+// a worker only wins the job if nobody else leased it between the SELECT and the UPDATE.
+func (c *cluster) LeaseJob(worker string, kinds []model.JobKind, ttl time.Duration) (*model.Job, error) {
+	for range leaseRetries {
+		now := time.Now()
+		var job model.Job
+		q := c.db.Where("status = ? OR (status = ? AND lease_expires < ?)", model.JobPending, model.JobLeased, now)
+		if len(kinds) > 0 {
+			q = q.Where("kind IN ?", kinds)
+		}
+		if err := q.Order("id").First(&job).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, model.ErrNotFound
+			}
+			return nil, err
+		}
+		updates := map[string]any{
+			"status":        model.JobLeased,
+			"worker":        worker,
+			"lease_expires": now.Add(ttl),
+			"lease":         job.Lease + 1,
+			"attempts":      job.Attempts + 1,
+		}
+		if job.MaxAttempts > 0 && job.Attempts >= job.MaxAttempts { // the previous worker(s) died holding it
+			updates = map[string]any{
+				"status": model.JobFailed,
+				"lease":  job.Lease + 1,
+				"error":  fmt.Sprintf("lease expired %d times (last worker %s)", job.Attempts, job.Worker),
+			}
+		}
+		res := c.db.Model(&model.Job{}).Where("id = ? AND lease = ?", job.ID, job.Lease).Updates(updates)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 || updates["status"] == model.JobFailed {
+			continue // another worker got there first (or the job was given up on)
+		}
+		return c.GetJob(job.ID)
+	}
+	return nil, model.ErrNotFound
+}
+
+func (c *cluster) RenewLease(id uint, worker string, ttl time.Duration) error {
+	res := c.db.Model(&model.Job{}).
+		Where("id = ? AND worker = ? AND status = ?", id, worker, model.JobLeased).
+		Update("lease_expires", time.Now().Add(ttl))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (c *cluster) CompleteJob(id uint, worker string, result string, jobErr error) error {
+	updates := map[string]any{"status": model.JobDone, "result": result, "error": ""}
+	if jobErr != nil {
+		updates["status"] = model.JobFailed
+		updates["error"] = jobErr.Error()
+	}
+	res := c.db.Model(&model.Job{}).Where("id = ? AND worker = ? AND status = ?", id, worker, model.JobLeased).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ParseJobKinds parses a comma separated list of job kinds
+func ParseJobKinds(kinds string) ([]model.JobKind, error) {
+	var out []model.JobKind
+	for _, k := range strings.Split(kinds, ",") {
+		switch kind := model.JobKind(strings.TrimSpace(k)); kind {
+		case "":
+		case model.JobScan, model.JobRescan, model.JobExtract:
+			out = append(out, kind)
+		default:
+			return nil, fmt.Errorf("invalid job kind '%s' (must be %s, %s or %s)", kind, model.JobScan, model.JobRescan, model.JobExtract)
+		}
+	}
+	return out, nil
+}
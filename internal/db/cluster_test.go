@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/model"
+)
+
+func TestClusterLease(t *testing.T) {
+	d, err := NewSqlite(filepath.Join(t.TempDir(), "cluster.db"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	c, err := NewCluster(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"w1", "w2"} {
+		if err := c.RegisterWorker(&model.Worker{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.RegisterWorker(&model.Worker{ID: "w1", Host: "lab1"}); err != nil {
+		t.Fatalf("re-register: %v", err)
+	}
+	if workers, err := c.GetWorkers(); err != nil || len(workers) != 2 || workers[0].Host != "lab1" {
+		t.Fatalf("GetWorkers() = %v, %v", workers, err)
+	}
+
+	scan := &model.Job{Kind: model.JobScan, Path: "a.ipsw", MaxAttempts: 2}
+	extract := &model.Job{Kind: model.JobExtract, Extract: "kernel", Config: `{"ipsw":"b.ipsw"}`}
+	for _, job := range []*model.Job{scan, extract} {
+		if err := c.CreateJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// w1 only does extract jobs
+	job, err := c.LeaseJob("w1", []model.JobKind{model.JobExtract}, time.Minute)
+	if err != nil || job.ID != extract.ID || job.Worker != "w1" || job.Attempts != 1 {
+		t.Fatalf("LeaseJob(w1) = %+v, %v", job, err)
+	}
+	// w2 gets the scan (not w1's extract)
+	job, err = c.LeaseJob("w2", nil, -time.Second) // already expired
+	if err != nil || job.ID != scan.ID {
+		t.Fatalf("LeaseJob(w2) = %+v, %v", job, err)
+	}
+	// w2 "died" so w1 takes over the scan
+	job, err = c.LeaseJob("w1", nil, time.Minute)
+	if err != nil || job.ID != scan.ID || job.Attempts != 2 {
+		t.Fatalf("LeaseJob(w1) expired = %+v, %v", job, err)
+	}
+	if err := c.CompleteJob(scan.ID, "w2", "", nil); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("CompleteJob(w2) = %v, want ErrLeaseLost", err)
+	}
+	if _, err := c.LeaseJob("w2", nil, time.Minute); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("LeaseJob(w2) empty = %v, want ErrNotFound", err)
+	}
+	if err := c.CompleteJob(scan.ID, "w1", "", errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CompleteJob(extract.ID, "w1", `{"artifacts":[]}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := c.GetJobs(model.JobFailed); err != nil || len(jobs) != 1 || jobs[0].Error != "boom" {
+		t.Fatalf("GetJobs(failed) = %v, %v", jobs, err)
+	}
+	if jobs, err := c.GetJobs(model.JobDone); err != nil || len(jobs) != 1 || jobs[0].ID != extract.ID {
+		t.Fatalf("GetJobs(done) = %v, %v", jobs, err)
+	}
+}
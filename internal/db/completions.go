@@ -0,0 +1,56 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/blacktop/ipsw/internal/model"
+	"gorm.io/gorm"
+)
+
+// Completions suggest the scanned IPSWs, MachOs and kexts for shell completion.
+type Completions interface {
+	// IPSWs returns the most recently scanned IPSWs whose ID, name or build starts with the prefix.
+	IPSWs(prefix string, limit int) ([]*model.Ipsw, error)
+
+	// MachOs returns the scanned MachOs (with their paths) whose UUID starts with the prefix.
+	MachOs(prefix string, limit int) ([]*model.Macho, error)
+}
+
+// NewCompletions returns the completions of a sqlite or postgres database.
+func NewCompletions(d Database) (Completions, error) {
+	var gdb *gorm.DB
+	switch d := d.(type) {
+	case *Sqlite:
+		gdb = d.db
+	case *Postgres:
+		gdb = d.db
+	default:
+		return nil, fmt.Errorf("completions require a sqlite or postgres database (not %T)", d)
+	}
+	if gdb == nil {
+		return nil, fmt.Errorf("completions: database is not connected")
+	}
+	return &completions{db: gdb}, nil
+}
+
+type completions struct {
+	db *gorm.DB
+}
+
+func (c *completions) IPSWs(prefix string, limit int) ([]*model.Ipsw, error) {
+	var ipsws []*model.Ipsw
+	if err := c.db.Where("id LIKE ? OR name LIKE ? OR build_id LIKE ?", prefix+"%", prefix+"%", prefix+"%").
+		Order("created_at DESC").Limit(limit).Find(&ipsws).Error; err != nil {
+		return nil, err
+	}
+	return ipsws, nil
+}
+
+func (c *completions) MachOs(prefix string, limit int) ([]*model.Macho, error) {
+	var machos []*model.Macho
+	if err := c.db.Preload("Path").Where("uuid LIKE ?", prefix+"%").
+		Order("uuid").Limit(limit).Find(&machos).Error; err != nil {
+		return nil, err
+	}
+	return machos, nil
+}
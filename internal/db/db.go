@@ -41,6 +41,10 @@ type Database interface {
 	// GetSymbols returns all symbols for the given UUID.
 	GetSymbols(uuid string) ([]*model.Symbol, error)
 
+	// Search returns every build whose kernelcache, DSC or file system contains the symbol, string, entitlement, IOKit class or MachO UUID.
+	// The value may contain '*' wildcards and it returns ErrNotFound if nothing matches.
+	Search(kind model.SearchKind, value string) ([]*model.SearchResult, error)
+
 	// Save updates the IPSW.
 	// It overwrites any previous value for that IPSW.
 	Save(value any) error
@@ -4,7 +4,9 @@ import (
 	"encoding/gob"
 	"fmt"
 	"os"
+	"path"
 	"slices"
+	"strings"
 
 	"github.com/blacktop/ipsw/internal/model"
 	"github.com/pkg/errors"
@@ -89,10 +91,11 @@ func (m *Memory) GetIPSW(version, build, device string) (*model.Ipsw, error) {
 	return nil, model.ErrNotFound
 }
 
+// GetDSC returns the dyld_shared_cache for the given UUID (of the main cache or any of its subcaches).
 func (m *Memory) GetDSC(uuid string) (*model.DyldSharedCache, error) {
 	for _, ipsw := range m.IPSWs {
 		for _, dyld := range ipsw.DSCs {
-			if dyld.UUID == uuid {
+			if hasDSCUUID(dyld, uuid) {
 				return dyld, nil
 			}
 		}
@@ -103,7 +106,7 @@ func (m *Memory) GetDSC(uuid string) (*model.DyldSharedCache, error) {
 func (m *Memory) GetDSCImage(uuid string, addr uint64) (*model.Macho, error) {
 	for _, ipsw := range m.IPSWs {
 		for _, dyld := range ipsw.DSCs {
-			if dyld.UUID == uuid {
+			if hasDSCUUID(dyld, uuid) {
 				for _, img := range dyld.Images {
 					if addr >= img.TextStart && addr < img.TextEnd {
 						return img, nil
@@ -115,6 +118,18 @@ func (m *Memory) GetDSCImage(uuid string, addr uint64) (*model.Macho, error) {
 	return nil, model.ErrNotFound
 }
 
+func hasDSCUUID(dsc *model.DyldSharedCache, uuid string) bool {
+	if dsc.UUID == uuid {
+		return true
+	}
+	for _, sc := range dsc.SubCaches {
+		if sc.UUID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Memory) GetMachO(uuid string) (*model.Macho, error) {
 	for _, ipsw := range m.IPSWs {
 		for _, dyld := range ipsw.DSCs {
@@ -193,7 +208,7 @@ func (m *Memory) GetSymbols(uuid string) ([]*model.Symbol, error) {
 		}
 		for _, fs := range ipsw.Kernels {
 			for _, kext := range fs.Kexts {
-				if fs.UUID == uuid {
+				if kext.UUID == uuid {
 					return kext.Symbols, nil
 				}
 			}
@@ -202,6 +217,79 @@ func (m *Memory) GetSymbols(uuid string) ([]*model.Symbol, error) {
 	return nil, model.ErrNotFound
 }
 
+// Search returns every build that contains the symbol, string, entitlement, IOKit class or MachO UUID.
+func (m *Memory) Search(kind model.SearchKind, value string) ([]*model.SearchResult, error) {
+	if value == "" {
+		return nil, errors.New("search value cannot be empty")
+	}
+	switch kind {
+	case model.SearchSymbol, model.SearchString, model.SearchEntitlement, model.SearchIOKit, model.SearchUUID:
+	default:
+		return nil, fmt.Errorf("invalid search kind: %s", kind)
+	}
+	match := func(s string) bool { return s == value }
+	if strings.ContainsAny(value, "*?") {
+		pattern := value
+		match = func(s string) bool {
+			ok, _ := path.Match(pattern, s)
+			return ok
+		}
+	}
+	contains := func(mm *model.Macho) bool {
+		switch kind {
+		case model.SearchSymbol:
+			return slices.ContainsFunc(mm.Symbols, func(s *model.Symbol) bool { return match(s.GetName()) })
+		case model.SearchString:
+			return slices.ContainsFunc(mm.Strings, func(s *model.String) bool { return match(s.Value) })
+		case model.SearchEntitlement:
+			return slices.ContainsFunc(mm.Entitlements, func(e *model.Entitlement) bool { return match(e.Key) })
+		case model.SearchIOKit:
+			return slices.ContainsFunc(mm.IOKitClasses, func(c *model.IOKitClass) bool { return match(c.Name) })
+		case model.SearchUUID:
+			return match(mm.UUID)
+		}
+		return false
+	}
+
+	var results []*model.SearchResult
+	add := func(ipsw *model.Ipsw, src model.Source, mm *model.Macho) {
+		if contains(mm) {
+			results = append(results, &model.SearchResult{
+				IpswID:   ipsw.ID,
+				IpswPath: ipsw.Path,
+				Name:     ipsw.Name,
+				Version:  ipsw.Version,
+				BuildID:  ipsw.BuildID,
+				Source:   src,
+				Path:     mm.GetPath(),
+				UUID:     mm.UUID,
+			})
+		}
+	}
+	for _, ipsw := range m.IPSWs {
+		for _, kernel := range ipsw.Kernels {
+			for _, kext := range kernel.Kexts {
+				add(ipsw, model.SourceKernel, kext)
+			}
+		}
+		for _, dsc := range ipsw.DSCs {
+			for _, img := range dsc.Images {
+				add(ipsw, model.SourceDSC, img)
+			}
+		}
+		for _, fs := range ipsw.FileSystem {
+			add(ipsw, model.FileSystemSource(fs.GetPath()), fs)
+		}
+	}
+	if len(results) == 0 {
+		return nil, model.ErrNotFound
+	}
+	slices.SortFunc(results, func(a, b *model.SearchResult) int {
+		return strings.Compare(a.Version+a.BuildID+string(a.Source)+a.Path, b.Version+b.BuildID+string(b.Source)+b.Path)
+	})
+	return results, nil
+}
+
 // Set sets the value for the given key.
 // It overwrites any previous value for that key.
 func (m *Memory) Save(value any) error {
@@ -58,10 +58,14 @@ func (p *Postgres) Connect() (err error) {
 		&model.Device{},
 		&model.Kernelcache{},
 		&model.DyldSharedCache{},
+		&model.SubCache{},
 		&model.Macho{},
 		&model.Path{},
 		&model.Symbol{},
 		&model.Name{},
+		&model.String{},
+		&model.Entitlement{},
+		&model.IOKitClass{},
 	)
 }
 
@@ -111,7 +115,7 @@ func (p *Postgres) GetIPSW(version, build, device string) (*model.Ipsw, error) {
 
 func (p *Postgres) GetDSC(uuid string) (*model.DyldSharedCache, error) {
 	var dsc model.DyldSharedCache
-	if err := p.db.Where("uuid = ?", uuid).First(&dsc).Error; err != nil {
+	if err := p.db.Preload("SubCaches").Where("uuid = ?", mainDSCUUID(p.db, uuid)).First(&dsc).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, model.ErrNotFound
 		}
@@ -125,7 +129,7 @@ func (p *Postgres) GetDSCImage(uuid string, address uint64) (*model.Macho, error
 	if err := p.db.Joins("JOIN dsc_images ON dsc_images.macho_uuid = machos.uuid").
 		Joins("JOIN dyld_shared_caches ON dyld_shared_caches.uuid = dsc_images.dyld_shared_cache_uuid").
 		Joins("Path").
-		Where("dyld_shared_caches.uuid = ? AND machos.text_start <= ? AND ? < machos.text_end", uuid, address, address).
+		Where("dyld_shared_caches.uuid = ? AND machos.text_start <= ? AND ? < machos.text_end", mainDSCUUID(p.db, uuid), address, address).
 		First(&macho).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, model.ErrNotFound
@@ -177,6 +181,11 @@ func (p *Postgres) GetSymbols(uuid string) ([]*model.Symbol, error) {
 	return syms, nil
 }
 
+// Search returns every build that contains the symbol, string, entitlement, IOKit class or MachO UUID.
+func (p *Postgres) Search(kind model.SearchKind, value string) ([]*model.SearchResult, error) {
+	return search(p.db, kind, value)
+}
+
 // Save sets the value for the given key.
 // It overwrites any previous value for that key.
 func (p *Postgres) Save(value any) error {
@@ -189,11 +198,15 @@ func (p *Postgres) Save(value any) error {
 			// 	return err
 			// }
 			// Process Paths
-			if err := p.processPaths(tx, ipsw); err != nil {
+			if err := processPaths(tx, p.BatchSize, ipsw); err != nil {
 				return err
 			}
 			// Process Names
-			if err := p.processNames(tx, ipsw); err != nil {
+			if err := processNames(tx, p.BatchSize, ipsw); err != nil {
+				return err
+			}
+			// Process Strings and Entitlements
+			if err := processIndexes(tx, p.BatchSize, ipsw); err != nil {
 				return err
 			}
 			// Save the main IPSW entry
@@ -207,7 +220,17 @@ func (p *Postgres) Save(value any) error {
 	return fmt.Errorf("invalid value type: %T", value)
 }
 
-func (p *Postgres) processPaths(tx *gorm.DB, ipsw *model.Ipsw) error {
+// mainDSCUUID returns the UUID of the dyld_shared_cache that owns the given subcache UUID (or the UUID itself)
+func mainDSCUUID(tx *gorm.DB, uuid string) string {
+	var sc model.SubCache
+	if err := tx.Where("uuid = ?", uuid).Limit(1).Find(&sc).Error; err == nil && len(sc.DyldSharedCacheUUID) > 0 {
+		return sc.DyldSharedCacheUUID
+	}
+	return uuid
+}
+
+// processPaths de-duplicates the IPSW's paths against the existing rows
+func processPaths(tx *gorm.DB, batchSize int, ipsw *model.Ipsw) error {
 	uniquePaths := make(map[string]struct{})
 
 	// Collect unique paths
@@ -229,14 +252,18 @@ func (p *Postgres) processPaths(tx *gorm.DB, ipsw *model.Ipsw) error {
 		return nil
 	}
 
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
 	// Process paths in batches
 	paths := make([]string, 0, len(uniquePaths))
 	for path := range uniquePaths {
 		paths = append(paths, path)
 	}
 
-	for i := 0; i < len(paths); i += p.BatchSize {
-		end := i + p.BatchSize
+	for i := 0; i < len(paths); i += batchSize {
+		end := i + batchSize
 		if end > len(paths) {
 			end = len(paths)
 		}
@@ -253,8 +280,8 @@ func (p *Postgres) processPaths(tx *gorm.DB, ipsw *model.Ipsw) error {
 
 	// Fetch all created/existing Paths in batches
 	var allPaths []model.Path
-	for i := 0; i < len(paths); i += p.BatchSize {
-		end := i + p.BatchSize
+	for i := 0; i < len(paths); i += batchSize {
+		end := i + batchSize
 		if end > len(paths) {
 			end = len(paths)
 		}
@@ -291,7 +318,8 @@ func (p *Postgres) processPaths(tx *gorm.DB, ipsw *model.Ipsw) error {
 	return nil
 }
 
-func (p *Postgres) processNames(tx *gorm.DB, ipsw *model.Ipsw) error {
+// processNames de-duplicates the IPSW's symbol names against the existing rows
+func processNames(tx *gorm.DB, batchSize int, ipsw *model.Ipsw) error {
 	uniqueNames := make(map[string]struct{})
 
 	// Collect unique names
@@ -319,14 +347,18 @@ func (p *Postgres) processNames(tx *gorm.DB, ipsw *model.Ipsw) error {
 		return nil
 	}
 
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
 	// Process names in batches
 	names := make([]string, 0, len(uniqueNames))
 	for name := range uniqueNames {
 		names = append(names, name)
 	}
 
-	for i := 0; i < len(names); i += p.BatchSize {
-		end := i + p.BatchSize
+	for i := 0; i < len(names); i += batchSize {
+		end := i + batchSize
 		if end > len(names) {
 			end = len(names)
 		}
@@ -343,8 +375,8 @@ func (p *Postgres) processNames(tx *gorm.DB, ipsw *model.Ipsw) error {
 
 	// Fetch all created/existing Names in batches
 	var allNames []model.Name
-	for i := 0; i < len(names); i += p.BatchSize {
-		end := i + p.BatchSize
+	for i := 0; i < len(names); i += batchSize {
+		end := i + batchSize
 		if end > len(names) {
 			end = len(names)
 		}
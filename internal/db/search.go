@@ -0,0 +1,212 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultBatchSize = 1000
+
+// likeEscaper escapes the LIKE wildcards (and the escape character itself) before the glob wildcards are mapped
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// globToLike converts a glob ('*' and '?') into a LIKE pattern using '\' as the escape character
+func globToLike(glob string) string {
+	return strings.NewReplacer("*", "%", "?", "_").Replace(likeEscaper.Replace(glob))
+}
+
+// matchSQL returns the sub-query of MachO UUIDs that contain the value (the inverted index lookup)
+func matchSQL(kind model.SearchKind, value string) (string, string, error) {
+	op, arg := "= ?", value
+	if strings.ContainsAny(value, "*?") { // glob
+		op, arg = `LIKE ? ESCAPE '\'`, globToLike(value)
+	}
+	switch kind {
+	case model.SearchSymbol:
+		return `SELECT macho_syms.macho_uuid FROM macho_syms
+			JOIN symbols ON symbols.id = macho_syms.symbol_id
+			JOIN names ON names.id = symbols.name_id
+			WHERE names.name ` + op, arg, nil
+	case model.SearchString:
+		return `SELECT macho_strs.macho_uuid FROM macho_strs
+			JOIN strings ON strings.id = macho_strs.string_id
+			WHERE strings.value ` + op, arg, nil
+	case model.SearchEntitlement:
+		return `SELECT macho_ents.macho_uuid FROM macho_ents
+			JOIN entitlements ON entitlements.id = macho_ents.entitlement_id
+			WHERE entitlements.key ` + op, arg, nil
+	case model.SearchIOKit:
+		return `SELECT macho_iokit_classes.macho_uuid FROM macho_iokit_classes
+			JOIN io_kit_classes ON io_kit_classes.id = macho_iokit_classes.io_kit_class_id
+			WHERE io_kit_classes.name ` + op, arg, nil
+	case model.SearchUUID:
+		return `SELECT machos.uuid FROM machos WHERE machos.uuid ` + op, arg, nil
+	default:
+		return "", "", fmt.Errorf("invalid search kind: %s", kind)
+	}
+}
+
+// search finds every (IPSW, MachO) pair that contain the value (shared by the SQL databases)
+func search(db *gorm.DB, kind model.SearchKind, value string) ([]*model.SearchResult, error) {
+	if value == "" {
+		return nil, fmt.Errorf("search value cannot be empty")
+	}
+	match, arg, err := matchSQL(kind, value)
+	if err != nil {
+		return nil, err
+	}
+	q := `SELECT ipsws.id AS ipsw_id, ipsws.path AS ipsw_path, ipsws.name, ipsws.version, ipsws.build_id, 'kernel' AS source, paths.path AS path, machos.uuid
+		FROM machos
+		JOIN paths ON paths.id = machos.path_id
+		JOIN kernelcache_kexts ON kernelcache_kexts.macho_uuid = machos.uuid
+		JOIN ipsw_kernels ON ipsw_kernels.kernelcache_uuid = kernelcache_kexts.kernelcache_uuid
+		JOIN ipsws ON ipsws.id = ipsw_kernels.ipsw_id
+		WHERE machos.uuid IN (` + match + `)
+	UNION
+	SELECT ipsws.id AS ipsw_id, ipsws.path AS ipsw_path, ipsws.name, ipsws.version, ipsws.build_id, 'dsc' AS source, paths.path AS path, machos.uuid
+		FROM machos
+		JOIN paths ON paths.id = machos.path_id
+		JOIN dsc_images ON dsc_images.macho_uuid = machos.uuid
+		JOIN ipsw_dscs ON ipsw_dscs.dyld_shared_cache_uuid = dsc_images.dyld_shared_cache_uuid
+		JOIN ipsws ON ipsws.id = ipsw_dscs.ipsw_id
+		WHERE machos.uuid IN (` + match + `)
+	UNION
+	SELECT ipsws.id AS ipsw_id, ipsws.path AS ipsw_path, ipsws.name, ipsws.version, ipsws.build_id,
+		CASE WHEN paths.path LIKE '%.dext/%' OR paths.path LIKE '%.systemextension/%' THEN 'dext' ELSE 'fs' END AS source, paths.path AS path, machos.uuid
+		FROM machos
+		JOIN paths ON paths.id = machos.path_id
+		JOIN ipsw_files ON ipsw_files.macho_uuid = machos.uuid
+		JOIN ipsws ON ipsws.id = ipsw_files.ipsw_id
+		WHERE machos.uuid IN (` + match + `)
+	ORDER BY version, build_id, source, path`
+
+	var results []*model.SearchResult
+	if err := db.Raw(q, arg, arg, arg).Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to search for %s %s: %w", kind, value, err)
+	}
+	if len(results) == 0 {
+		return nil, model.ErrNotFound
+	}
+	return results, nil
+}
+
+// allMachos returns every MachO in the IPSW (kexts, DSC images and file system)
+func allMachos(ipsw *model.Ipsw) []*model.Macho {
+	var ms []*model.Macho
+	for _, kernel := range ipsw.Kernels {
+		ms = append(ms, kernel.Kexts...)
+	}
+	for _, dsc := range ipsw.DSCs {
+		ms = append(ms, dsc.Images...)
+	}
+	return append(ms, ipsw.FileSystem...)
+}
+
+// processIndexes de-duplicates the IPSW's indexed strings, entitlements and IOKit classes against the existing rows
+func processIndexes(tx *gorm.DB, batchSize int, ipsw *model.Ipsw) error {
+	ms := allMachos(ipsw)
+
+	var values []string
+	for _, m := range ms {
+		for _, s := range m.Strings {
+			values = append(values, s.Value)
+		}
+	}
+	ids, err := intern(tx, batchSize, "value", values, func(v string) model.String { return model.String{Value: v} },
+		func(s model.String) (string, uint) { return s.Value, s.ID })
+	if err != nil {
+		return fmt.Errorf("failed to create strings: %w", err)
+	}
+	for _, m := range ms {
+		for _, s := range m.Strings {
+			s.ID = ids[s.Value]
+		}
+	}
+
+	var keys []string
+	for _, m := range ms {
+		for _, e := range m.Entitlements {
+			keys = append(keys, e.Key)
+		}
+	}
+	ids, err = intern(tx, batchSize, "key", keys, func(k string) model.Entitlement { return model.Entitlement{Key: k} },
+		func(e model.Entitlement) (string, uint) { return e.Key, e.ID })
+	if err != nil {
+		return fmt.Errorf("failed to create entitlements: %w", err)
+	}
+	for _, m := range ms {
+		for _, e := range m.Entitlements {
+			e.ID = ids[e.Key]
+		}
+	}
+
+	var classes []string
+	for _, m := range ms {
+		for _, c := range m.IOKitClasses {
+			classes = append(classes, c.Name)
+		}
+	}
+	ids, err = intern(tx, batchSize, "name", classes, func(n string) model.IOKitClass { return model.IOKitClass{Name: n} },
+		func(c model.IOKitClass) (string, uint) { return c.Name, c.ID })
+	if err != nil {
+		return fmt.Errorf("failed to create IOKit classes: %w", err)
+	}
+	for _, m := range ms {
+		for _, c := range m.IOKitClasses {
+			c.ID = ids[c.Name]
+		}
+	}
+
+	return nil
+}
+
+// intern creates the rows for any new values and returns the IDs of all of them
+func intern[T any](tx *gorm.DB, batchSize int, column string, values []string, create func(string) T, get func(T) (string, uint)) (map[string]uint, error) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	seen := make(map[string]struct{}, len(values))
+	var unique []string
+	for _, v := range values {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+
+	ids := make(map[string]uint, len(unique))
+	for i := 0; i < len(unique); i += batchSize {
+		batch := unique[i:min(i+batchSize, len(unique))]
+		rows := make([]T, 0, len(batch))
+		for _, v := range batch {
+			rows = append(rows, create(v))
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: column}},
+			DoNothing: true,
+		}).Create(&rows).Error; err != nil {
+			return nil, err
+		}
+		var existing []T
+		if err := tx.Where(clause.IN{Column: clause.Column{Name: column}, Values: toAny(batch)}).Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range existing {
+			v, id := get(row)
+			ids[v] = id
+		}
+	}
+	return ids, nil
+}
+
+func toAny(values []string) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/model"
+)
+
+func testIPSW(id, version, build string) *model.Ipsw {
+	name := "iPhone15,2_" + version + "_" + build + "_Restore.ipsw"
+	return &model.Ipsw{
+		ID:      id,
+		Name:    name,
+		Path:    "/ipsws/" + name,
+		Version: version,
+		BuildID: build,
+		Kernels: []*model.Kernelcache{{
+			UUID: id + "-kernel",
+			Kexts: []*model.Macho{{
+				UUID:    id + "-kext",
+				Path:    model.Path{Path: "com.apple.driver.AppleMobileFileIntegrity"},
+				Symbols: []*model.Symbol{{Name: model.Name{Name: "_amfi_check_dyld_policy_self"}, Start: 0x1000, End: 0x1100}},
+				Strings: []*model.String{{Value: "AMFI: code signature validation failed."}},
+			}},
+		}},
+		FileSystem: []*model.Macho{{
+			UUID:         id + "-fs",
+			Path:         model.Path{Path: "/usr/libexec/amfid"},
+			Entitlements: []*model.Entitlement{{Key: "com.apple.private.amfi.can-check-trust-cache"}},
+		}, {
+			UUID:         id + "-dext",
+			Path:         model.Path{Path: "/System/Library/DriverExtensions/com.apple.DriverKit-AppleUserECM.dext/com.apple.DriverKit-AppleUserECM"},
+			IOKitClasses: []*model.IOKitClass{{Name: "AppleUserECM"}, {Name: "IOUSBHostInterface"}},
+		}},
+	}
+}
+
+func TestSqliteSearch(t *testing.T) {
+	d, err := NewSqlite(filepath.Join(t.TempDir(), "syms.db"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, ipsw := range []*model.Ipsw{testIPSW("a", "17.0", "21A329"), testIPSW("b", "17.1", "21B74")} {
+		if err := d.Create(&model.Ipsw{ID: ipsw.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Save(ipsw); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		kind   model.SearchKind
+		value  string
+		source model.Source
+	}{
+		{model.SearchSymbol, "_amfi_check_dyld_policy_self", model.SourceKernel},
+		{model.SearchString, "AMFI: code signature*", model.SourceKernel},
+		{model.SearchEntitlement, "com.apple.private.amfi.can-check-trust-cache", model.SourceFileSystem},
+		{model.SearchIOKit, "IOUSBHost*", model.SourceDriverKit},
+		{model.SearchSymbol, "_amfi_check?dyld_*", model.SourceKernel},
+	}
+	for _, tt := range tests {
+		results, err := d.Search(tt.kind, tt.value)
+		if err != nil {
+			t.Fatalf("Search(%s, %q) error = %v", tt.kind, tt.value, err)
+		}
+		if len(results) != 2 || results[0].BuildID != "21A329" || results[1].BuildID != "21B74" || results[0].Source != tt.source {
+			t.Errorf("Search(%s, %q) = %+v %+v", tt.kind, tt.value, results[0], results[len(results)-1])
+		}
+	}
+
+	// a UUID search locates the MachO (and the IPSW it was scanned from)
+	if results, err := d.Search(model.SearchUUID, "a-fs"); err != nil || len(results) != 1 ||
+		results[0].IpswPath != "/ipsws/iPhone15,2_17.0_21A329_Restore.ipsw" || results[0].Path != "/usr/libexec/amfid" || results[0].Source != model.SourceFileSystem {
+		t.Errorf("Search(uuid, a-fs) = %+v, %v", results, err)
+	}
+
+	if _, err := d.Search(model.SearchSymbol, "_does_not_exist"); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	// '_' and '%' in a glob are literals (NOT LIKE wildcards)
+	for _, value := range []string{"AMFI:_code*", "AMFI%signature*"} {
+		if _, err := d.Search(model.SearchString, value); !errors.Is(err, model.ErrNotFound) {
+			t.Errorf("Search(%q) expected ErrNotFound, got %v", value, err)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	d, err := NewSqlite(filepath.Join(t.TempDir(), "syms.db"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, ipsw := range []*model.Ipsw{testIPSW("a", "17.0", "21A329"), testIPSW("b", "17.1", "21B74")} {
+		if err := d.Create(&model.Ipsw{ID: ipsw.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Save(ipsw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tags, err := NewTags(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []*model.Tag{
+		{Kind: model.TagIPSW, Target: "b", Key: "vuln-fixed-here", Value: "CVE-2023-41991"},
+		{Kind: model.TagMachO, Target: "a-kext", Key: "triaged"},
+		{Kind: model.TagSymbol, Target: "_amfi_check_dyld_policy_self", Key: "owner", Value: "alice"},
+		{Kind: model.TagSymbol, Target: "_amfi_check_dyld_policy_self", Key: "owner", Value: "bob", Note: "reassigned"},
+	} {
+		if err := tags.SetTag(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tags.SetTag(&model.Tag{Kind: model.TagMachO, Target: "missing", Key: "triaged"}); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("expected ErrNotFound tagging a missing MachO, got %v", err)
+	}
+	if got, err := tags.GetTags(model.TagSymbol, "_amfi_check_dyld_policy_self"); err != nil || len(got) != 1 || got[0].Value != "bob" {
+		t.Errorf("GetTags() = %v, %v (expected the tag to be updated)", got, err)
+	}
+
+	results, err := d.Search(model.SearchSymbol, "_amfi_check_dyld_policy_self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Annotate(model.SearchSymbol, "_amfi_check_dyld_policy_self", results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results[0].Tags) != 2 || len(results[1].Tags) != 2 { // a: macho+symbol, b: ipsw+symbol
+		t.Errorf("unexpected tags %v %v", results[0].Tags, results[1].Tags)
+	}
+	if results[0].HasTag("vuln-fixed-here", "") || !results[1].HasTag("vuln-fixed-here", "CVE-2023-41991") {
+		t.Errorf("only %s should be tagged vuln-fixed-here", results[1].BuildID)
+	}
+
+	if err := tags.DeleteTag(model.TagMachO, "a-kext", "triaged"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := tags.FindTags("triaged", ""); err != nil || len(found) != 0 {
+		t.Errorf("FindTags() = %v, %v after delete", found, err)
+	}
+}
+
+func TestSqliteCompletions(t *testing.T) {
+	d, err := NewSqlite(filepath.Join(t.TempDir(), "syms.db"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, ipsw := range []*model.Ipsw{testIPSW("a", "17.0", "21A329"), testIPSW("b", "17.1", "21B74")} {
+		if err := d.Create(&model.Ipsw{ID: ipsw.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Save(ipsw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comps, err := NewCompletions(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ipsws, err := comps.IPSWs("21B", 10); err != nil || len(ipsws) != 1 || ipsws[0].ID != "b" {
+		t.Errorf("IPSWs() = %v, %v", ipsws, err)
+	}
+	if machos, err := comps.MachOs("a-", 10); err != nil || len(machos) != 3 || machos[0].GetPath() == "" {
+		t.Errorf("MachOs() = %v, %v", machos, err)
+	}
+}
+
+func TestSqliteDSCSubCache(t *testing.T) {
+	d, err := NewSqlite(filepath.Join(t.TempDir(), "syms.db"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	ipsw := &model.Ipsw{ID: "a", DSCs: []*model.DyldSharedCache{{
+		UUID:      "a-dsc",
+		SubCaches: []*model.SubCache{{UUID: "a-dsc-01", Suffix: ".01"}, {UUID: "a-dsc-symbols", Suffix: ".symbols"}},
+		Images: []*model.Macho{{
+			UUID:      "a-foundation",
+			Path:      model.Path{Path: "/System/Library/Frameworks/Foundation.framework/Foundation"},
+			TextStart: 0x180000000,
+			TextEnd:   0x180100000,
+		}},
+	}}}
+	if err := d.Create(&model.Ipsw{ID: ipsw.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Save(ipsw); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uuid := range []string{"a-dsc", "a-dsc-01", "a-dsc-symbols"} {
+		dsc, err := d.GetDSC(uuid)
+		if err != nil {
+			t.Fatalf("GetDSC(%s) error = %v", uuid, err)
+		}
+		if dsc.UUID != "a-dsc" || len(dsc.SubCaches) != 2 {
+			t.Errorf("GetDSC(%s) = %+v", uuid, dsc)
+		}
+		img, err := d.GetDSCImage(uuid, 0x180000100)
+		if err != nil || img.UUID != "a-foundation" {
+			t.Errorf("GetDSCImage(%s) = %v, %v", uuid, img, err)
+		}
+	}
+	if _, err := d.GetDSC("b-dsc"); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -46,8 +46,14 @@ func (s *Sqlite) Connect() (err error) {
 		&model.Device{},
 		&model.Kernelcache{},
 		&model.DyldSharedCache{},
+		&model.SubCache{},
 		&model.Macho{},
+		&model.Path{},
 		&model.Symbol{},
+		&model.Name{},
+		&model.String{},
+		&model.Entitlement{},
+		&model.IOKitClass{},
 	)
 }
 
@@ -98,7 +104,7 @@ func (s *Sqlite) GetIPSW(version, build, device string) (*model.Ipsw, error) {
 
 func (s *Sqlite) GetDSC(uuid string) (*model.DyldSharedCache, error) {
 	var dsc model.DyldSharedCache
-	if err := s.db.Where("uuid = ?", uuid).First(&dsc).Error; err != nil {
+	if err := s.db.Preload("SubCaches").Where("uuid = ?", mainDSCUUID(s.db, uuid)).First(&dsc).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, model.ErrNotFound
 		}
@@ -111,7 +117,7 @@ func (s *Sqlite) GetDSCImage(uuid string, address uint64) (*model.Macho, error)
 	var macho model.Macho
 	if err := s.db.Joins("JOIN dsc_images ON dsc_images.macho_uuid = machos.uuid").
 		Joins("JOIN dyld_shared_caches ON dyld_shared_caches.uuid = dsc_images.dyld_shared_cache_uuid").
-		Where("dyld_shared_caches.uuid = ? AND machos.text_start <= ? AND ? < machos.text_end", uuid, address, address).
+		Where("dyld_shared_caches.uuid = ? AND machos.text_start <= ? AND ? < machos.text_end", mainDSCUUID(s.db, uuid), address, address).
 		First(&macho).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, model.ErrNotFound
@@ -150,8 +156,9 @@ func (s *Sqlite) GetSymbols(uuid string) ([]*model.Symbol, error) {
 	var syms []*model.Symbol
 	if err := s.db.Joins("JOIN macho_syms ON macho_syms.symbol_id = symbols.id").
 		Joins("JOIN machos ON machos.uuid = macho_syms.macho_uuid").
+		Joins("Name").
 		Where("machos.uuid = ?", uuid).
-		Find(syms).Error; err != nil {
+		Find(&syms).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, model.ErrNotFound
 		}
@@ -160,9 +167,28 @@ func (s *Sqlite) GetSymbols(uuid string) ([]*model.Symbol, error) {
 	return syms, nil
 }
 
+// Search returns every build that contains the symbol, string, entitlement, IOKit class or MachO UUID.
+func (s *Sqlite) Search(kind model.SearchKind, value string) ([]*model.SearchResult, error) {
+	return search(s.db, kind, value)
+}
+
 // Set sets the value for the given key.
 // It overwrites any previous value for that key.
 func (s *Sqlite) Save(value any) error {
+	if ipsw, ok := value.(*model.Ipsw); ok {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if err := processPaths(tx, s.BatchSize, ipsw); err != nil {
+				return err
+			}
+			if err := processNames(tx, s.BatchSize, ipsw); err != nil {
+				return err
+			}
+			if err := processIndexes(tx, s.BatchSize, ipsw); err != nil {
+				return err
+			}
+			return tx.Save(ipsw).Error
+		})
+	}
 	if result := s.db.Save(value); result.Error != nil {
 		return result.Error
 	}
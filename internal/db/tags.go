@@ -0,0 +1,152 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tags are the user-defined annotations on the scanned IPSWs, MachOs and symbols.
+type Tags interface {
+	// SetTag creates the tag or updates the value and note of the artifact's existing tag with the same key.
+	// It returns ErrNotFound if the tagged IPSW or MachO does not exist.
+	SetTag(tag *model.Tag) error
+
+	// DeleteTag removes the artifact's tag.
+	// It returns ErrNotFound if the tag does not exist.
+	DeleteTag(kind model.TagKind, target, key string) error
+
+	// GetTags returns the artifact's tags.
+	GetTags(kind model.TagKind, target string) ([]*model.Tag, error)
+
+	// FindTags returns every tag with the key (and value if not empty).
+	FindTags(key, value string) ([]*model.Tag, error)
+
+	// Annotate adds the IPSW's, MachO's (and for symbol searches the symbol's) tags to the search results.
+	Annotate(kind model.SearchKind, value string, results []*model.SearchResult) error
+}
+
+// NewTags returns the tag store of a sqlite or postgres database.
+func NewTags(d Database) (Tags, error) {
+	var gdb *gorm.DB
+	switch d := d.(type) {
+	case *Sqlite:
+		gdb = d.db
+	case *Postgres:
+		gdb = d.db
+	default:
+		return nil, fmt.Errorf("tags require a sqlite or postgres database (not %T)", d)
+	}
+	if gdb == nil {
+		return nil, fmt.Errorf("tags: database is not connected")
+	}
+	if err := gdb.AutoMigrate(&model.Tag{}); err != nil {
+		return nil, fmt.Errorf("tags: failed to migrate database: %w", err)
+	}
+	return &tags{db: gdb}, nil
+}
+
+type tags struct {
+	db *gorm.DB
+}
+
+func (t *tags) SetTag(tag *model.Tag) error {
+	if !slices.Contains(model.TagKinds, tag.Kind) {
+		return fmt.Errorf("invalid tag kind '%s' (must be %s, %s or %s)", tag.Kind, model.TagIPSW, model.TagMachO, model.TagSymbol)
+	}
+	if tag.Target == "" || tag.Key == "" {
+		return fmt.Errorf("tag target and key cannot be empty")
+	}
+	var count int64
+	switch tag.Kind {
+	case model.TagIPSW:
+		if err := t.db.Model(&model.Ipsw{}).Where("id = ?", tag.Target).Count(&count).Error; err != nil {
+			return err
+		}
+	case model.TagMachO:
+		if err := t.db.Model(&model.Macho{}).Where("uuid = ?", tag.Target).Count(&count).Error; err != nil {
+			return err
+		}
+	case model.TagSymbol:
+		count = 1 // symbols are tagged by name so they can be tagged before (or after) they are scanned
+	}
+	if count == 0 {
+		return fmt.Errorf("%s %s: %w", tag.Kind, tag.Target, model.ErrNotFound)
+	}
+	tag.ID = 0
+	if err := t.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "target"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "note", "updated_at"}),
+	}).Create(tag).Error; err != nil {
+		return err
+	}
+	return t.db.Where("kind = ? AND target = ? AND key = ?", tag.Kind, tag.Target, tag.Key).First(tag).Error
+}
+
+func (t *tags) DeleteTag(kind model.TagKind, target, key string) error {
+	res := t.db.Where("kind = ? AND target = ? AND key = ?", kind, target, key).Delete(&model.Tag{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (t *tags) GetTags(kind model.TagKind, target string) ([]*model.Tag, error) {
+	var out []*model.Tag
+	if err := t.db.Where("kind = ? AND target = ?", kind, target).Order("key").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (t *tags) FindTags(key, value string) ([]*model.Tag, error) {
+	if key == "" {
+		return nil, fmt.Errorf("tag key cannot be empty")
+	}
+	var out []*model.Tag
+	q := t.db.Where("key = ?", key)
+	if value != "" {
+		q = q.Where("value = ?", value)
+	}
+	if err := q.Order("kind, target").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (t *tags) Annotate(kind model.SearchKind, value string, results []*model.SearchResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	var ipsws, uuids []string
+	for _, r := range results {
+		ipsws = append(ipsws, r.IpswID)
+		uuids = append(uuids, r.UUID)
+	}
+	var found []*model.Tag
+	q := t.db.Where("(kind = ? AND target IN ?) OR (kind = ? AND target IN ?)", model.TagIPSW, ipsws, model.TagMachO, uuids)
+	if kind == model.SearchSymbol && !strings.Contains(value, "*") {
+		q = q.Or("kind = ? AND target = ?", model.TagSymbol, value)
+	}
+	if err := q.Order("kind, key").Find(&found).Error; err != nil {
+		return fmt.Errorf("failed to get search result tags: %w", err)
+	}
+	for _, r := range results {
+		r.Tags = nil
+		for _, tag := range found {
+			if (tag.Kind == model.TagIPSW && tag.Target == r.IpswID) ||
+				(tag.Kind == model.TagMachO && tag.Target == r.UUID) ||
+				tag.Kind == model.TagSymbol {
+				r.Tags = append(r.Tags, tag)
+			}
+		}
+	}
+	return nil
+}
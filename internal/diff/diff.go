@@ -17,12 +17,16 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
 	dcmd "github.com/blacktop/ipsw/internal/commands/dsc"
 	"github.com/blacktop/ipsw/internal/commands/dwarf"
 	"github.com/blacktop/ipsw/internal/commands/ent"
 	"github.com/blacktop/ipsw/internal/commands/extract"
+	"github.com/blacktop/ipsw/internal/commands/jetsam"
 	kcmd "github.com/blacktop/ipsw/internal/commands/kernel"
+	"github.com/blacktop/ipsw/internal/commands/localize"
 	mcmd "github.com/blacktop/ipsw/internal/commands/macho"
+	"github.com/blacktop/ipsw/internal/commands/xprotect"
 	"github.com/blacktop/ipsw/internal/search"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/aea"
@@ -59,10 +63,17 @@ type Config struct {
 	Firmware  bool
 	Features  bool
 	CStrings  bool
+	Localized bool
+	XProtect  bool
+	Jetsam    bool
 	AllowList []string
 	BlockList []string
 	PemDB     string
 	Output    string
+	// disassemble (up to) this many changed functions per updated kext/dylib
+	Functions int
+	// symbol server URL that the HTML report links to
+	Server string
 }
 
 // Context is the context for the diff
@@ -101,6 +112,11 @@ type Diff struct {
 	Firmwares *mcmd.MachoDiff `json:"firmwares,omitempty"`
 	Launchd   string          `json:"launchd,omitempty"`
 	Features  *PlistDiff      `json:"features,omitempty"`
+	Strings   *localize.Diff  `json:"strings,omitempty"`
+	XProtect  *xprotect.Diff  `json:"xprotect,omitempty"`
+	Jetsam    *jetsam.Diff    `json:"jetsam,omitempty"`
+	// changed functions of the updated kexts and dylibs
+	Functions map[string][]*FuncDiff `json:"functions,omitempty"`
 
 	tmpDir string `json:"-"`
 	conf   *Config
@@ -283,6 +299,27 @@ func (d *Diff) Diff() (err error) {
 		}
 	}
 
+	if d.conf.Localized {
+		log.Info("Diffing Localized Strings")
+		if err := d.parseLocalizedStrings(); err != nil {
+			return err
+		}
+	}
+
+	if d.conf.XProtect {
+		log.Info("Diffing XProtect")
+		if err := d.parseXProtect(); err != nil {
+			return err
+		}
+	}
+
+	if d.conf.Jetsam {
+		log.Info("Diffing Jetsam")
+		if err := d.parseJetsam(); err != nil {
+			return err
+		}
+	}
+
 	log.Info("Diffing ENTITLEMENTS")
 	d.Ents, err = d.parseEntitlements()
 	if err != nil {
@@ -449,6 +486,21 @@ func (d *Diff) parseKernelcache() error {
 		return err
 	}
 
+	if d.conf.Functions > 0 && m1.FileTOC.FileHeader.Type == types.MH_FILESET && m2.FileTOC.FileHeader.Type == types.MH_FILESET {
+		utils.Indent(log.Info, 2)("Diffing updated kext functions")
+		for kext := range d.Kexts.Updated {
+			k1, err := m1.GetFileSetFileByName(kext)
+			if err != nil {
+				return fmt.Errorf("failed to parse kext %s in 'Old' kernelcache: %v", kext, err)
+			}
+			k2, err := m2.GetFileSetFileByName(kext)
+			if err != nil {
+				return fmt.Errorf("failed to parse kext %s in 'New' kernelcache: %v", kext, err)
+			}
+			d.addFunctions(kext, diffFunctions(k1, k2, d.conf.Functions))
+		}
+	}
+
 	// // diff kexts
 	// d.Old.Kernel.Kexts, err = kernelcache.KextList(d.Old.Kernel.Path, true)
 	// if err != nil {
@@ -573,9 +625,42 @@ func (d *Diff) parseDSC() error {
 		return err
 	}
 
+	if d.conf.Functions > 0 {
+		utils.Indent(log.Info, 2)("Diffing updated dylib functions")
+		for dylib := range d.Dylibs.Updated {
+			img1, err := dscOLD.Image(dylib)
+			if err != nil {
+				return fmt.Errorf("failed to find dylib %s in 'Old' DSC: %v", dylib, err)
+			}
+			img2, err := dscNEW.Image(dylib)
+			if err != nil {
+				return fmt.Errorf("failed to find dylib %s in 'New' DSC: %v", dylib, err)
+			}
+			m1, err := img1.GetMacho()
+			if err != nil {
+				return fmt.Errorf("failed to create MachO for 'Old' dylib %s: %v", dylib, err)
+			}
+			m2, err := img2.GetMacho()
+			if err != nil {
+				return fmt.Errorf("failed to create MachO for 'New' dylib %s: %v", dylib, err)
+			}
+			d.addFunctions(dylib, diffFunctions(m1, m2, d.conf.Functions))
+		}
+	}
+
 	return nil
 }
 
+func (d *Diff) addFunctions(image string, funcs []*FuncDiff) {
+	if len(funcs) == 0 {
+		return
+	}
+	if d.Functions == nil {
+		d.Functions = make(map[string][]*FuncDiff)
+	}
+	d.Functions[image] = funcs
+}
+
 func (d *Diff) parseEntitlements() (string, error) {
 	oldDB, err := ent.GetDatabase(&ent.Config{IPSW: d.Old.IPSWPath})
 	if err != nil {
@@ -641,6 +726,45 @@ func (d *Diff) parseFirmwares() (err error) {
 	return
 }
 
+func (d *Diff) parseLocalizedStrings() error {
+	prev := localize.NewCatalog("en")
+	if err := prev.AddIPSW(d.Old.IPSWPath, d.conf.PemDB); err != nil {
+		return fmt.Errorf("diff: parseLocalizedStrings: failed to get 'Old' strings: %v", err)
+	}
+	next := localize.NewCatalog("en")
+	if err := next.AddIPSW(d.New.IPSWPath, d.conf.PemDB); err != nil {
+		return fmt.Errorf("diff: parseLocalizedStrings: failed to get 'New' strings: %v", err)
+	}
+	d.Strings = localize.Compare(prev, next)
+	return nil
+}
+
+func (d *Diff) parseXProtect() error {
+	prev := xprotect.New()
+	if err := prev.AddIPSW(d.Old.IPSWPath, d.conf.PemDB); err != nil {
+		return fmt.Errorf("diff: parseXProtect: failed to get 'Old' XProtect content: %v", err)
+	}
+	next := xprotect.New()
+	if err := next.AddIPSW(d.New.IPSWPath, d.conf.PemDB); err != nil {
+		return fmt.Errorf("diff: parseXProtect: failed to get 'New' XProtect content: %v", err)
+	}
+	d.XProtect = xprotect.Compare(prev, next)
+	return nil
+}
+
+func (d *Diff) parseJetsam() error {
+	prev := jetsam.New()
+	if err := prev.AddIPSW(d.Old.IPSWPath, d.conf.PemDB); err != nil {
+		return fmt.Errorf("diff: parseJetsam: failed to get 'Old' jetsam config: %v", err)
+	}
+	next := jetsam.New()
+	if err := next.AddIPSW(d.New.IPSWPath, d.conf.PemDB); err != nil {
+		return fmt.Errorf("diff: parseJetsam: failed to get 'New' jetsam config: %v", err)
+	}
+	d.Jetsam = jetsam.Compare(prev, next)
+	return nil
+}
+
 func (d *Diff) parseFeatureFlags() (err error) {
 	d.Features = &PlistDiff{
 		New:     make(map[string]string),
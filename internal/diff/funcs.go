@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+	"github.com/blacktop/arm64-cgo/disassemble"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// FuncDiff is a function whose code changed between the two builds
+type FuncDiff struct {
+	Name    string `json:"name"`
+	OldAddr uint64 `json:"old_addr"`
+	OldSize uint64 `json:"old_size"`
+	NewAddr uint64 `json:"new_addr"`
+	NewSize uint64 `json:"new_size"`
+	// unified diff of the function's disassembly (with the build specific addresses normalized)
+	Diff string `json:"diff"`
+}
+
+var hexRE = regexp.MustCompile(`0x[0-9a-f]+`)
+
+type funcSym struct {
+	name string
+	fn   types.Function
+}
+
+// symbolicatedFuncs returns the MachO's functions that have a symbol (keyed by symbol name) and an address to symbol map
+func symbolicatedFuncs(m *macho.File) (map[string]types.Function, map[uint64]string) {
+	starts := make(map[uint64]types.Function)
+	for _, fn := range m.GetFunctions() {
+		starts[fn.StartAddr] = fn
+	}
+	funcs := make(map[string]types.Function)
+	a2s := make(map[uint64]string)
+	if m.Symtab == nil {
+		return funcs, a2s
+	}
+	for _, sym := range m.Symtab.Syms {
+		if sym.Name == "" || sym.Sect == 0 {
+			continue
+		}
+		a2s[sym.Value] = sym.Name
+		if fn, ok := starts[sym.Value]; ok {
+			funcs[sym.Name] = fn
+		}
+	}
+	return funcs, a2s
+}
+
+// disassembleFunc returns the function's disassembly with the addresses made relative to the function
+// (or replaced by their symbol) so that the same code in two different builds disassembles the same
+func disassembleFunc(m *macho.File, fn types.Function, a2s map[uint64]string) (string, error) {
+	data, err := m.GetFunctionData(fn)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	var instrValue uint32
+	var results [1024]byte
+	r := bytes.NewReader(data)
+	for addr := fn.StartAddr; binary.Read(r, binary.LittleEndian, &instrValue) == nil; addr += 4 {
+		inst, err := disassemble.Decompose(addr, instrValue, &results)
+		if err != nil {
+			fmt.Fprintf(&out, "+%#04x: .long %#08x\n", addr-fn.StartAddr, instrValue)
+			continue
+		}
+		asm := hexRE.ReplaceAllStringFunc(inst.String(), func(hex string) string {
+			val, err := strconv.ParseUint(hex[2:], 16, 64)
+			if err != nil {
+				return hex
+			}
+			switch {
+			case val >= fn.StartAddr && val < fn.EndAddr:
+				return fmt.Sprintf("loc_%x", val-fn.StartAddr)
+			case a2s[val] != "":
+				return a2s[val]
+			case m.FindSegmentForVMAddr(val) != nil:
+				return "<addr>"
+			default:
+				return hex
+			}
+		})
+		fmt.Fprintf(&out, "+%#04x: %s\n", addr-fn.StartAddr, asm)
+	}
+	return out.String(), nil
+}
+
+// diffFunctions returns (up to limit of) the functions present in both MachOs whose code changed
+func diffFunctions(m1, m2 *macho.File, limit int) []*FuncDiff {
+	prev, prevSyms := symbolicatedFuncs(m1)
+	next, nextSyms := symbolicatedFuncs(m2)
+
+	var common []funcSym
+	for name, fn := range next {
+		if _, ok := prev[name]; ok {
+			common = append(common, funcSym{name: name, fn: fn})
+		}
+	}
+	slices.SortFunc(common, func(a, b funcSym) int { return strings.Compare(a.name, b.name) })
+
+	var diffs []*FuncDiff
+	for _, f := range common {
+		if len(diffs) >= limit {
+			break
+		}
+		fn1 := prev[f.name]
+		fn2 := f.fn
+		if fn1.EndAddr-fn1.StartAddr == fn2.EndAddr-fn2.StartAddr {
+			dat1, err1 := m1.GetFunctionData(fn1)
+			dat2, err2 := m2.GetFunctionData(fn2)
+			if err1 == nil && err2 == nil && bytes.Equal(dat1, dat2) {
+				continue
+			}
+		}
+		asm1, err := disassembleFunc(m1, fn1, prevSyms)
+		if err != nil {
+			continue
+		}
+		asm2, err := disassembleFunc(m2, fn2, nextSyms)
+		if err != nil {
+			continue
+		}
+		if asm1 == asm2 {
+			continue
+		}
+		diffs = append(diffs, &FuncDiff{
+			Name:    f.name,
+			OldAddr: fn1.StartAddr,
+			OldSize: fn1.EndAddr - fn1.StartAddr,
+			NewAddr: fn2.StartAddr,
+			NewSize: fn2.EndAddr - fn2.StartAddr,
+			Diff:    udiff.Unified(f.name, f.name, asm1, asm2),
+		})
+	}
+	return diffs
+}
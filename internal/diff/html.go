@@ -1,5 +1,279 @@
 package diff
 
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+)
+
+const diffHTMLTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{ .Title }}</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0 auto; max-width: 1100px; padding: 1em 2em; color: #1f2328; }
+  h1 { text-align: center; }
+  table { border-collapse: collapse; margin: 1em 0; }
+  th, td { border: 1px solid #d0d7de; padding: 4px 12px; text-align: left; }
+  details { margin: 0.3em 0 0.3em 1em; }
+  details > summary { cursor: pointer; }
+  details.section { margin-left: 0; border: 1px solid #d0d7de; border-radius: 6px; padding: 0.5em 1em; margin-bottom: 1em; }
+  details.section > summary { font-size: 1.4em; font-weight: 600; }
+  summary .count { color: #656d76; font-weight: normal; font-size: 0.8em; }
+  pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; font-size: 0.85em; }
+  code { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+  .add { color: #116329; background: #dafbe1; display: block; }
+  .del { color: #82071e; background: #ffebe9; display: block; }
+  .hunk { color: #8250df; display: block; }
+  .new { color: #116329; }
+  .removed { color: #82071e; }
+  .toolbar { text-align: right; }
+  .muted { color: #656d76; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<div class="toolbar"><button onclick="toggle(true)">Expand all</button> <button onclick="toggle(false)">Collapse all</button></div>
+
+<table>
+  <tr><th>IPSW</th><th>Version</th><th>Build</th>{{ if .Old.Kernel.Version }}<th>Darwin</th><th>XNU</th>{{ end }}{{ if .Old.Webkit }}<th>WebKit</th>{{ end }}</tr>
+  {{- range $ctx := (list .Old .New) }}
+  <tr><td><code>{{ base $ctx.IPSWPath }}</code></td><td>{{ $ctx.Version }}</td><td>{{ $ctx.Build }}</td>
+    {{- if $ctx.Kernel.Version }}<td>{{ $ctx.Kernel.Version.KernelVersion.Darwin }}</td><td>{{ $ctx.Kernel.Version.KernelVersion.XNU }}</td>{{ end }}
+    {{- if $ctx.Webkit }}<td>{{ $ctx.Webkit }}</td>{{ end }}</tr>
+  {{- end }}
+</table>
+
+{{ define "machos" }}
+{{- $funcs := .Funcs -}}
+{{- with .Diff }}
+{{- if .New }}
+<details open><summary class="new">🆕 NEW <span class="count">({{ len .New }})</span></summary>
+<ul>{{ range sorted .New }}<li><code>{{ . }}</code></li>{{ end }}</ul>
+</details>
+{{- end }}
+{{- if .Removed }}
+<details open><summary class="removed">❌ Removed <span class="count">({{ len .Removed }})</span></summary>
+<ul>{{ range sorted .Removed }}<li><code>{{ . }}</code></li>{{ end }}</ul>
+</details>
+{{- end }}
+{{- if .Updated }}
+<details><summary>⬆️ Updated <span class="count">({{ len .Updated }})</span></summary>
+{{- range $name, $diff := .Updated }}
+<details><summary><code>{{ base $name }}</code>{{ with index $funcs $name }} <span class="count">({{ len . }} changed functions)</span>{{ end }}</summary>
+<p class="muted"><code>{{ $name }}</code></p>
+{{ diff $diff }}
+{{- with index $funcs $name }}
+<details><summary>Changed functions <span class="count">({{ len . }})</span></summary>
+{{- range . }}
+<details><summary><code>{{ .Name }}</code> <span class="count">{{ hex .OldSize }} → {{ hex .NewSize }}</span>{{ with symURL .Name }} <a href="{{ . }}">symbols</a>{{ end }}</summary>
+{{ diff .Diff }}
+</details>
+{{- end }}
+</details>
+{{- end }}
+</details>
+{{- end }}
+</details>
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{- if or .Old.Kernel.Version .Kexts }}
+<details class="section" open><summary>Kernel{{ with .Kexts }} <span class="count">({{ len .New }} new, {{ len .Removed }} removed, {{ len .Updated }} updated kexts)</span>{{ end }}</summary>
+{{ template "machos" (section .Kexts .Functions) }}
+</details>
+{{- end }}
+
+{{- if .KDKs }}
+<details class="section"><summary>KDKs</summary>
+<ul><li><code>{{ .Old.KDK }}</code></li><li><code>{{ .New.KDK }}</code></li></ul>
+{{ md .KDKs }}
+</details>
+{{- end }}
+
+{{- if .Machos }}
+<details class="section" open><summary>MachOs <span class="count">({{ len .Machos.New }} new, {{ len .Machos.Removed }} removed, {{ len .Machos.Updated }} updated)</span></summary>
+{{ template "machos" (section .Machos .Functions) }}
+</details>
+{{- end }}
+
+{{- if .Ents }}
+<details class="section"><summary>🔑 Entitlements</summary>
+{{ md .Ents }}
+</details>
+{{- end }}
+
+{{- if .Launchd }}
+<details class="section"><summary>launchd Config</summary>
+{{ diff .Launchd }}
+</details>
+{{- end }}
+
+{{- if .Firmwares }}
+<details class="section"><summary>Firmwares <span class="count">({{ len .Firmwares.New }} new, {{ len .Firmwares.Removed }} removed, {{ len .Firmwares.Updated }} updated)</span></summary>
+{{ template "machos" (section .Firmwares .Functions) }}
+</details>
+{{- end }}
+
+{{- if .Features }}
+<details class="section"><summary>Feature Flags <span class="count">({{ len .Features.New }} new, {{ len .Features.Removed }} removed, {{ len .Features.Updated }} updated)</span></summary>
+{{- if .Features.New }}
+<details><summary class="new">🆕 NEW <span class="count">({{ len .Features.New }})</span></summary>
+{{- range $name, $plist := .Features.New }}
+<details><summary><code>{{ $name }}</code></summary><pre><code>{{ $plist }}</code></pre></details>
+{{- end }}
+</details>
+{{- end }}
+{{- if .Features.Removed }}
+<details><summary class="removed">❌ Removed <span class="count">({{ len .Features.Removed }})</span></summary>
+<ul>{{ range sorted .Features.Removed }}<li><code>{{ . }}</code></li>{{ end }}</ul>
+</details>
+{{- end }}
+{{- if .Features.Updated }}
+<details><summary>⬆️ Updated <span class="count">({{ len .Features.Updated }})</span></summary>
+{{- range $name, $diff := .Features.Updated }}
+<details><summary><code>{{ $name }}</code></summary>{{ diff $diff }}</details>
+{{- end }}
+</details>
+{{- end }}
+</details>
+{{- end }}
+
+{{- if .Strings }}
+<details class="section"><summary>Localized Strings <span class="count">({{ len .Strings.New }} new, {{ len .Strings.Removed }} removed, {{ len .Strings.Changed }} updated)</span></summary>
+{{ md .Strings.Markdown }}
+</details>
+{{- end }}
+
+{{- if .XProtect }}
+<details class="section"><summary>XProtect <span class="count">({{ len .XProtect.Rules.New }} new, {{ len .XProtect.Rules.Removed }} removed, {{ len .XProtect.Rules.Updated }} updated rules)</span></summary>
+{{ md .XProtect.Markdown }}
+</details>
+{{- end }}
+
+{{- if .Jetsam }}
+<details class="section"><summary>Jetsam <span class="count">({{ len .Jetsam.NewProcesses }} new, {{ len .Jetsam.RemovedProcesses }} removed processes, {{ len .Jetsam.Changed }} changed limits)</span></summary>
+{{ md .Jetsam.Markdown }}
+</details>
+{{- end }}
+
+{{- if .Dylibs }}
+<details class="section" open><summary>DSC <span class="count">({{ len .Dylibs.New }} new, {{ len .Dylibs.Removed }} removed, {{ len .Dylibs.Updated }} updated dylibs)</span></summary>
+{{ template "machos" (section .Dylibs .Functions) }}
+</details>
+{{- end }}
+
+<script>
+function toggle(open) { document.querySelectorAll("details").forEach(function (d) { d.open = open; }); }
+</script>
+</body>
+</html>
+`
+
+type htmlSection struct {
+	Diff  any
+	Funcs map[string][]*FuncDiff
+}
+
+// HTML saves the diff as a single self-contained HTML report
+// with collapsible sections and the disassembly of the changed functions
 func (d *Diff) HTML() error {
-	panic("not implemented")
+	var buf bytes.Buffer
+
+	tmpl, err := template.New("diff").Funcs(template.FuncMap{
+		"base": filepath.Base,
+		"hex":  func(v uint64) string { return fmt.Sprintf("%#x", v) },
+		"list": func(ctxs ...Context) []Context { return ctxs },
+		"sorted": func(s []string) []string {
+			out := append([]string(nil), s...)
+			slices.Sort(out)
+			return out
+		},
+		"section": func(diff any, funcs map[string][]*FuncDiff) htmlSection {
+			return htmlSection{Diff: diff, Funcs: funcs}
+		},
+		"diff":   diffToHTML,
+		"md":     markdownToHTML,
+		"symURL": d.symbolURL,
+	}).Parse(diffHTMLTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML diff template: %v", err)
+	}
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return fmt.Errorf("failed to execute HTML diff template: %v", err)
+	}
+
+	if err := os.MkdirAll(d.conf.Output, 0o750); err != nil {
+		return err
+	}
+	fname := filepath.Join(d.conf.Output, d.TitleToFilename()+".html")
+	log.Infof("Creating HTML diff report: %s", fname)
+	return os.WriteFile(fname, buf.Bytes(), 0o644)
+}
+
+// symbolURL returns the symbol server search URL for the symbol (if a server was configured)
+func (d *Diff) symbolURL(name string) string {
+	if d.conf == nil || d.conf.Server == "" {
+		return ""
+	}
+	return strings.TrimSuffix(d.conf.Server, "/") + "/v1/syms/search?" + url.Values{"symbol": {name}}.Encode()
+}
+
+// diffToHTML renders a (possibly fenced) unified diff with its added/removed lines highlighted
+func diffToHTML(diff string) template.HTML {
+	diff = strings.TrimSpace(diff)
+	diff = strings.TrimPrefix(diff, "```diff")
+	diff = strings.TrimSuffix(diff, "```")
+	var out strings.Builder
+	out.WriteString("<pre><code>")
+	for _, line := range strings.Split(strings.Trim(diff, "\n"), "\n") {
+		if line == "```" || line == "```diff" {
+			continue
+		}
+		escaped := html.EscapeString(line)
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			out.WriteString(`<span class="muted">` + escaped + "</span>\n")
+		case strings.HasPrefix(line, "+"):
+			out.WriteString(`<span class="add">` + escaped + "</span>")
+		case strings.HasPrefix(line, "-"):
+			out.WriteString(`<span class="del">` + escaped + "</span>")
+		case strings.HasPrefix(line, "@@"):
+			out.WriteString(`<span class="hunk">` + escaped + "</span>")
+		default:
+			out.WriteString(escaped + "\n")
+		}
+	}
+	out.WriteString("</code></pre>")
+	return template.HTML(out.String())
+}
+
+// markdownToHTML renders the Markdown parts of the diff (i.e. the entitlements and KDK diffs) as HTML
+func markdownToHTML(md string) template.HTML {
+	renderer := mdhtml.NewRenderer(mdhtml.RendererOptions{
+		Flags: mdhtml.CommonFlags,
+		RenderNodeHook: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			if cb, ok := node.(*ast.CodeBlock); ok && string(cb.Info) == "diff" {
+				io.WriteString(w, string(diffToHTML(string(cb.Literal))))
+				return ast.GoToNext, true
+			}
+			return ast.GoToNext, false
+		},
+	})
+	return template.HTML(markdown.ToHTML([]byte(md), nil, renderer))
 }
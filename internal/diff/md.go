@@ -460,6 +460,21 @@ func (d *Diff) Markdown() error {
 		}
 	}
 
+	// SECTION: Localized Strings
+	if d.Strings != nil && !d.Strings.Empty() {
+		out.WriteString("### Localized Strings\n\n" + d.Strings.Markdown())
+	}
+
+	// SECTION: XProtect
+	if d.XProtect != nil && !d.XProtect.Empty() {
+		out.WriteString("### XProtect\n\n" + d.XProtect.Markdown())
+	}
+
+	// SECTION: Jetsam
+	if d.Jetsam != nil && !d.Jetsam.Empty() {
+		out.WriteString("### Jetsam\n\n" + d.Jetsam.Markdown())
+	}
+
 	out.WriteString("## EOF\n")
 
 	// Write README.md
@@ -338,6 +338,11 @@ func getLocalOsfiles(q *ADBQuery) (OsFiles, error) {
 	return osfiles, nil
 }
 
+// LocalAppleDBOsFiles returns the local (git cloned) AppleDB's osFiles that match the query's OSes, version and build
+func LocalAppleDBOsFiles(q *ADBQuery) (OsFiles, error) {
+	return getLocalOsfiles(q)
+}
+
 func LocalAppleDBLatest(q *ADBQuery) (*AppleDbOsFile, error) {
 	osfiles, err := getLocalOsfiles(q)
 	if err != nil {
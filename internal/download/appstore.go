@@ -183,9 +183,10 @@ type purchaseResponse struct {
 }
 
 type downloadRequest struct {
-	CreditDisplay string `plist:"creditDisplay,omitempty"`
-	GuID          string `plist:"guid,omitempty"`
-	SalableAdamID int    `plist:"salableAdamId,omitempty"`
+	CreditDisplay     string `plist:"creditDisplay,omitempty"`
+	GuID              string `plist:"guid,omitempty"`
+	SalableAdamID     int    `plist:"salableAdamId,omitempty"`
+	ExternalVersionID string `plist:"externalVersionId,omitempty"`
 }
 
 type downloadResponse struct {
@@ -701,31 +702,128 @@ func (as *AppStore) Purchase(bundleID string) error {
 	return nil
 }
 
+// AppVersionHistory is the version history of an app the account has a license for
+type AppVersionHistory struct {
+	BundleID string `json:"bundle_id"`
+	Version  string `json:"version"`
+	// external version ID of the current version
+	Current int `json:"current"`
+	// external version IDs of all the versions (oldest first)
+	IDs []int `json:"ids"`
+}
+
+// Versions returns the version history of the app (purchasing the app first if it is free and not in the account's purchase history)
+func (as *AppStore) Versions(bundleID string) (*AppVersionHistory, error) {
+	app, err := as.Lookup(bundleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup app for bundle ID %s: %v", bundleID, err)
+	}
+
+	info, err := as.downloadInfo(app, "")
+	if err != nil {
+		return nil, err
+	}
+
+	hist := &AppVersionHistory{
+		BundleID: app.BundleID,
+		Version:  app.Version,
+	}
+	if v, ok := info.Metadata["bundleShortVersionString"].(string); ok {
+		hist.Version = v
+	}
+	if id, ok := metadataInt(info.Metadata["softwareVersionExternalIdentifier"]); ok {
+		hist.Current = id
+	}
+	if ids, ok := info.Metadata["softwareVersionExternalIdentifiers"].([]any); ok {
+		for _, v := range ids {
+			if id, ok := metadataInt(v); ok {
+				hist.IDs = append(hist.IDs, id)
+			}
+		}
+	}
+
+	return hist, nil
+}
+
+func metadataInt(v any) (int, bool) {
+	switch i := v.(type) {
+	case uint64:
+		return int(i), true
+	case int64:
+		return int(i), true
+	case int:
+		return i, true
+	case float64:
+		return int(i), true
+	case string:
+		n, err := strconv.Atoi(i)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Download downloads the latest version of the app to the output folder
 func (as *AppStore) Download(bundleID, output string) error {
+	_, err := as.DownloadVersion(bundleID, "", output)
+	return err
+}
+
+// DownloadVersion downloads the app's version (external version ID, empty for the latest) to the output folder and returns the .ipa path
+func (as *AppStore) DownloadVersion(bundleID, versionID, output string) (string, error) {
 
 	app, err := as.Lookup(bundleID)
 	if err != nil {
-		return fmt.Errorf("failed to lookup app for bundle ID %s: %v", bundleID, err)
+		return "", fmt.Errorf("failed to lookup app for bundle ID %s: %v", bundleID, err)
+	}
+
+	info, err := as.downloadInfo(app, versionID)
+	if err != nil {
+		return "", err
+	}
+
+	src, err := as.download(info.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download app: %v", err)
+	}
+	defer os.Remove(src)
+
+	version := app.Version
+	if v, ok := info.Metadata["bundleShortVersionString"].(string); ok && v != "" {
+		version = v
 	}
 
+	dst := filepath.Join(output, fmt.Sprintf("%s_%d.v%s.ipa", app.BundleID, app.ID, version))
+
+	if err := as.applyPatches(src, dst, info); err != nil {
+		return "", fmt.Errorf("failed to apply app patches: %v", err)
+	}
+
+	log.Infof("Created %s", dst)
+
+	return dst, nil
+}
+
+// downloadInfo requests the download info (URL, sinfs and metadata) for the app's version
+func (as *AppStore) downloadInfo(app *App, versionID string) (*downloadAppResult, error) {
 	buf := new(bytes.Buffer)
 
 	mac, err := getMacAddress()
 	if err != nil {
-		return fmt.Errorf("failed to get mac address: %v", err)
+		return nil, fmt.Errorf("failed to get mac address: %v", err)
 	}
 
 	guid := strings.ReplaceAll(strings.ToUpper(mac), ":", "")
 
 	plist.NewEncoderForFormat(buf, plist.XMLFormat).Encode(&downloadRequest{
-		CreditDisplay: "",
-		GuID:          guid,
-		SalableAdamID: app.ID,
+		CreditDisplay:     "",
+		GuID:              guid,
+		SalableAdamID:     app.ID,
+		ExternalVersionID: versionID,
 	})
 
 	req, err := http.NewRequest("POST", appStoreDownloadURL, buf)
 	if err != nil {
-		return fmt.Errorf("failed to create http POST request: %v", err)
+		return nil, fmt.Errorf("failed to create http POST request: %v", err)
 	}
 
 	q := url.Values{}
@@ -739,13 +837,13 @@ func (as *AppStore) Download(bundleID, output string) error {
 
 	response, err := as.Client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer response.Body.Close()
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Debugf("POST Download: (%d):\n%s\n", response.StatusCode, string(body))
@@ -754,35 +852,24 @@ func (as *AppStore) Download(bundleID, output string) error {
 
 	var dl downloadResponse
 	if err := plist.NewDecoder(bytes.NewReader(body)).Decode(&dl); err != nil {
-		return fmt.Errorf("failed to decode download response: %v", err)
+		return nil, fmt.Errorf("failed to decode download response: %v", err)
 	}
 
 	if dl.FailureType == FailureTypeLicenseNotFound {
-		if err := as.Purchase(bundleID); err != nil {
-			return fmt.Errorf("failed to purchase app: %v", err)
+		if err := as.Purchase(app.BundleID); err != nil {
+			return nil, fmt.Errorf("failed to purchase app: %v", err)
 		}
-		return as.Download(bundleID, output)
+		return as.downloadInfo(app, versionID)
 	}
 
 	if len(dl.Apps) == 0 {
-		return fmt.Errorf("no items found in download response")
-	}
-
-	src, err := as.download(dl.Apps[0].URL)
-	if err != nil {
-		return fmt.Errorf("failed to download app: %v", err)
-	}
-	defer os.Remove(src)
-
-	dst := filepath.Join(output, fmt.Sprintf("%s_%d.v%s.ipa", app.BundleID, app.ID, app.Version))
-
-	if err := as.applyPatches(src, dst, &dl.Apps[0]); err != nil {
-		return fmt.Errorf("failed to apply app patches: %v", err)
+		if dl.CustomerMessage != "" {
+			return nil, fmt.Errorf("no items found in download response: %s", dl.CustomerMessage)
+		}
+		return nil, fmt.Errorf("no items found in download response")
 	}
 
-	log.Infof("Created %s", dst)
-
-	return nil
+	return &dl.Apps[0], nil
 }
 
 func (as *AppStore) download(url string) (string, error) {
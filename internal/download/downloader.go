@@ -19,6 +19,8 @@ import (
 	// "github.com/gofrs/flock"
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/offline"
+	"github.com/blacktop/ipsw/internal/telemetry"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/pkg/errors"
 	"github.com/vbauerster/mpb/v8"
@@ -32,6 +34,14 @@ type Download struct {
 	Sha1     string
 	DestName string
 	Headers  map[string]string
+	// Digests are extra published digests (i.e. an OTA's _Measurement) to verify the download against
+	Digests []Digest
+	// ChunklistURL is the URL of the download's chunklist (i.e. a macOS installer package's IntegrityDataURL)
+	ChunklistURL string
+	// Verify checks the download against its digests and chunklist (and the CRCs of its zip entries)
+	Verify bool
+	// Strict fails the download on a verification mismatch (instead of warning)
+	Strict bool
 
 	size         int64
 	bytesResumed int64
@@ -86,7 +96,14 @@ func NewDownload(proxy string, insecure, skipAll, resumeAll, restartAll, ignoreS
 }
 
 // GetProxy takes either an input string or read the enviornment and returns a proxy function
+//
+// NOTE: in offline mode the returned proxy function fails every request with offline.ErrOffline
 func GetProxy(proxy string) func(*http.Request) (*url.URL, error) {
+	if offline.Enabled() {
+		return func(req *http.Request) (*url.URL, error) {
+			return nil, offline.Check(req.Method + " " + req.URL.Scheme + "://" + req.URL.Host + req.URL.Path)
+		}
+	}
 	if len(proxy) > 0 {
 		proxyURL, err := url.Parse(proxy)
 		if err != nil {
@@ -140,6 +157,7 @@ func (d *Download) getHEAD() error {
 // write as it downloads and not load the whole file into memory. We pass an io.TeeReader
 // into Copy() to report progress on the download.
 func (d *Download) Do() error {
+	defer telemetry.Phase("download")()
 
 	d.getHEAD()
 
@@ -340,7 +358,9 @@ func (d *Download) Do() error {
 	defer reader.Close()
 
 	if d.resume {
-		if _, err := io.Copy(dest, reader); err != nil {
+		n, err := io.Copy(dest, reader)
+		telemetry.AddBytes("download", n)
+		if err != nil {
 			return fmt.Errorf("failed to copy body reader data: %v", err)
 		}
 
@@ -367,7 +387,9 @@ func (d *Download) Do() error {
 		tee := io.TeeReader(reader, dest)
 
 		h := sha1.New()
-		if _, err := io.Copy(h, tee); err != nil {
+		n, err := io.Copy(h, tee)
+		telemetry.AddBytes("download", n)
+		if err != nil {
 			return err
 		}
 
@@ -389,13 +411,20 @@ func (d *Download) Do() error {
 					"actual":   fmt.Sprintf("%x", h.Sum(nil)),
 				}).Error, 3)("❌ BAD CHECKSUM")
 				// fileLock.Unlock()
-				if err := os.Remove(d.DestName); err != nil {
+				if err := os.Remove(d.DestName + ".download"); err != nil {
 					return fmt.Errorf("cannot remove downloaded file with checksum mismatch: %v", err)
 				}
+				return fmt.Errorf("bad download: ipsw %s sha1 hash is incorrect", d.DestName+".download")
 			}
 		}
 	}
 
+	if d.Verify || d.Strict {
+		if err := d.verify(d.DestName + ".download"); err != nil {
+			return err
+		}
+	}
+
 	if err := os.Rename(d.DestName+".download", d.DestName); err != nil {
 		return fmt.Errorf("failed to rename %s to %s: %v", d.DestName+".download", d.DestName, err)
 	}
@@ -477,3 +506,57 @@ func (d *Download) Do() error {
 // 		b.IncrBy(incrBy, time.Since(start))
 // 	}
 // }
+
+func (d *Download) chunklist() ([]Chunk, error) {
+	req, err := http.NewRequest("GET", d.ChunklistURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create http request: %v", err)
+	}
+	req.Header.Add("User-Agent", utils.RandomAgent())
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download chunklist: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download chunklist: server return status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunklist: %v", err)
+	}
+	return ParseChunklist(data)
+}
+
+// verify verifies the downloaded file and only returns an error on a mismatch if d.Strict is set
+func (d *Download) verify(path string) error {
+	utils.Indent(log.Info, 2)("verifying download...")
+
+	var chunks []Chunk
+	if len(d.ChunklistURL) > 0 {
+		var err error
+		if chunks, err = d.chunklist(); err != nil {
+			if d.Strict {
+				return err
+			}
+			utils.Indent(log.WithError(err).Warn, 3)("skipping chunklist verification")
+		}
+	}
+
+	report, err := VerifyFile(path, d.Digests, chunks)
+	if err != nil {
+		return fmt.Errorf("failed to verify download: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		if d.Strict {
+			if rerr := os.Remove(path); rerr != nil {
+				return fmt.Errorf("cannot remove downloaded file that failed verification: %v", rerr)
+			}
+			return fmt.Errorf("bad download: %v", err)
+		}
+		utils.Indent(log.Warn, 3)(fmt.Sprintf("❌ %v", err))
+		return nil
+	}
+	utils.Indent(log.Info, 3)("✅ verified")
+	return nil
+}
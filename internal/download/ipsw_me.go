@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/blacktop/ipsw/internal/offline"
 )
 
 const ipswMeAPI = "https://api.ipsw.me/v4/"
@@ -39,6 +41,17 @@ type IPSW struct {
 func GetAllDevices() ([]Device, error) {
 	devices := []Device{}
 
+	if offline.Enabled() {
+		dat, err := offline.ReadFile(offline.IpswMeDevices)
+		if err != nil {
+			return devices, err
+		}
+		if err := json.Unmarshal(dat, &devices); err != nil {
+			return devices, fmt.Errorf("failed to parse offline %s: %v", offline.IpswMeDevices, err)
+		}
+		return devices, nil
+	}
+
 	res, err := http.Get(ipswMeAPI + "devices")
 	if err != nil {
 		return devices, err
@@ -3,6 +3,7 @@ package download
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/offline"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/dustin/go-humanize"
 	"github.com/olekukonko/tablewriter"
@@ -218,6 +220,17 @@ func GetProductInfo() (ProductInfos, error) {
 	var catData []byte
 	var prods ProductInfos
 
+	if offline.Enabled() {
+		dat, err := offline.ReadFile(offline.MacOSCatalog)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(dat, &prods); err != nil {
+			return nil, fmt.Errorf("failed to parse offline %s: %v", offline.MacOSCatalog, err)
+		}
+		return prods, nil
+	}
+
 	if runtime.GOOS == "darwin" {
 		data, err := os.ReadFile(seedCatalogsPlist)
 		if err != nil {
@@ -369,9 +382,11 @@ func GetProductInfo() (ProductInfos, error) {
 	return prods, nil
 }
 
-func (i *ProductInfo) DownloadInstaller(workDir, proxy string, insecure, skipAll, resumeAll, restartAll, ignoreSha1, assistantOnly bool) error {
+func (i *ProductInfo) DownloadInstaller(workDir, proxy string, insecure, skipAll, resumeAll, restartAll, ignoreSha1, verify, strict, assistantOnly bool) error {
 
 	downloader := NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, ignoreSha1, true)
+	downloader.Verify = verify
+	downloader.Strict = strict
 
 	folder := filepath.Join(workDir, fmt.Sprintf("%s_%s_%s", strings.ReplaceAll(i.Title, " ", "_"), i.Version, i.Build))
 
@@ -392,6 +407,7 @@ func (i *ProductInfo) DownloadInstaller(workDir, proxy string, insecure, skipAll
 				// download file
 				downloader.URL = pkg.URL
 				downloader.Sha1 = pkg.Digest
+				downloader.ChunklistURL = pkg.IntegrityDataURL
 				downloader.DestName = filepath.Join(folder, destName)
 				err = downloader.Do()
 				if err != nil {
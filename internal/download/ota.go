@@ -20,13 +20,13 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/compress"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/blacktop/ipsw/pkg/ota/types"
 	ilist "github.com/blacktop/ipsw/pkg/plist"
 	"github.com/hashicorp/go-version"
 	semver "github.com/hashicorp/go-version"
-	"github.com/ulikunitz/xz"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -637,11 +637,12 @@ func (o *Ota) GetPallasOTAs() ([]types.Asset, error) {
 	for idx, asset := range oassets { // TODO: what other BuildManifest fields should I capture?
 		if asset.PreflightBuildManifest != nil {
 			xzBuf := new(bytes.Buffer)
-			xr, err := xz.NewReader(bytes.NewReader(asset.PreflightBuildManifest))
+			xr, _, err := compress.NewReader(bytes.NewReader(asset.PreflightBuildManifest))
 			if err != nil {
 				return nil, err
 			}
 			io.Copy(xzBuf, xr)
+			xr.Close()
 			bm, err := ilist.ParseBuildManifest(xzBuf.Bytes())
 			if err != nil {
 				return nil, err
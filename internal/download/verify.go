@@ -0,0 +1,249 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/telemetry"
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// Digest is a digest that Apple (or a mirror like ipsw.me/appledb) publishes for a downloadable file
+type Digest struct {
+	Algorithm string // i.e. SHA-1, sha256 or sha2-256
+	Sum       []byte
+}
+
+// NewDigest returns the digest of a hex encoded sum
+func NewDigest(algorithm, sum string) (Digest, error) {
+	dat, err := hex.DecodeString(strings.TrimSpace(sum))
+	if err != nil {
+		return Digest{}, fmt.Errorf("invalid %s digest %q: %v", algorithm, sum, err)
+	}
+	return Digest{Algorithm: algorithm, Sum: dat}, nil
+}
+
+func (d Digest) hash() (hash.Hash, error) {
+	switch strings.ReplaceAll(strings.ToLower(d.Algorithm), "-", "") {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256", "sha2256":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q", d.Algorithm)
+	}
+}
+
+// DigestResult is the result of checking a file against a published digest
+type DigestResult struct {
+	Algorithm string `json:"algorithm"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+}
+
+// Match returns true if the file matched the digest
+func (r DigestResult) Match() bool {
+	return strings.EqualFold(r.Expected, r.Actual)
+}
+
+// VerifyReport is the result of verifying a downloaded file
+type VerifyReport struct {
+	Path       string         `json:"path"`
+	Digests    []DigestResult `json:"digests,omitempty"`
+	Chunks     int            `json:"chunks,omitempty"`
+	BadChunks  []int          `json:"bad_chunks,omitempty"` // indexes of the chunklist chunks that didn't match
+	ZipEntries int            `json:"zip_entries,omitempty"`
+	BadEntries []string       `json:"bad_entries,omitempty"` // zip entries with a CRC mismatch (or that failed to decompress)
+}
+
+// Err returns an error describing every mismatch (or nil if the file verified)
+func (r *VerifyReport) Err() error {
+	var errs []string
+	for _, d := range r.Digests {
+		if !d.Match() {
+			errs = append(errs, fmt.Sprintf("%s digest mismatch (expected %s, got %s)", d.Algorithm, d.Expected, d.Actual))
+		}
+	}
+	if len(r.BadChunks) > 0 {
+		errs = append(errs, fmt.Sprintf("%d of %d chunklist chunks do not match", len(r.BadChunks), r.Chunks))
+	}
+	if len(r.BadEntries) > 0 {
+		errs = append(errs, fmt.Sprintf("%d of %d zip entries failed their CRC check: %s", len(r.BadEntries), r.ZipEntries, strings.Join(r.BadEntries, ", ")))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s failed verification: %s", r.Path, strings.Join(errs, "; "))
+}
+
+const (
+	chunklistMagic      = 0x4C4B4E43 // 'CNKL'
+	chunklistHeaderSize = 0x24
+	chunklistSHA256     = 1
+)
+
+type chunklistHeader struct {
+	Magic           uint32
+	HeaderSize      uint32
+	FileVersion     uint8
+	ChunkMethod     uint8
+	SignatureMethod uint8
+	_               uint8
+	ChunkCount      uint64
+	ChunkOffset     uint64
+	SignatureOffset uint64
+}
+
+// Chunk is a chunk of a file listed in a chunklist (the IntegrityData of a macOS installer package)
+type Chunk struct {
+	Size   uint32
+	SHA256 [sha256.Size]byte
+}
+
+// ParseChunklist parses an Apple chunklist
+//
+// NOTE: the chunklist's RSA signature is NOT verified
+func ParseChunklist(data []byte) ([]Chunk, error) {
+	var hdr chunklistHeader
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("failed to read chunklist header: %v", err)
+	}
+	if hdr.Magic != chunklistMagic {
+		return nil, fmt.Errorf("invalid chunklist magic %#x", hdr.Magic)
+	}
+	if hdr.HeaderSize != chunklistHeaderSize || hdr.ChunkMethod != chunklistSHA256 {
+		return nil, fmt.Errorf("unsupported chunklist (header size %#x, chunk method %d)", hdr.HeaderSize, hdr.ChunkMethod)
+	}
+	chunkSize := uint64(binary.Size(Chunk{}))
+	if hdr.ChunkOffset > uint64(len(data)) || hdr.ChunkCount > (uint64(len(data))-hdr.ChunkOffset)/chunkSize {
+		return nil, fmt.Errorf("chunklist chunks (%d at %#x) are out of bounds", hdr.ChunkCount, hdr.ChunkOffset)
+	}
+	chunks := make([]Chunk, hdr.ChunkCount)
+	if err := binary.Read(bytes.NewReader(data[hdr.ChunkOffset:]), binary.LittleEndian, chunks); err != nil {
+		return nil, fmt.Errorf("failed to read chunklist chunks: %v", err)
+	}
+	return chunks, nil
+}
+
+func verifyChunks(f *os.File, chunks []Chunk, report *VerifyReport) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	report.Chunks = len(chunks)
+	h := sha256.New()
+	for i, c := range chunks {
+		h.Reset()
+		if _, err := io.CopyN(h, f, int64(c.Size)); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read chunk %d: %v", i, err)
+		}
+		if !bytes.Equal(h.Sum(nil), c.SHA256[:]) {
+			report.BadChunks = append(report.BadChunks, i)
+		}
+	}
+	// the chunks must cover the whole file
+	if n, _ := f.Read(make([]byte, 1)); n > 0 {
+		report.BadChunks = append(report.BadChunks, len(chunks))
+	}
+	return nil
+}
+
+// verifyZip decompresses every entry of the zip which checks their CRC32s
+func verifyZip(f *os.File, size int64, report *VerifyReport) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip: %v", err)
+	}
+	report.ZipEntries = len(zr.File)
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			report.BadEntries = append(report.BadEntries, zf.Name)
+			continue
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			utils.Indent(log.WithError(err).Debug, 3)(zf.Name)
+			report.BadEntries = append(report.BadEntries, zf.Name)
+		}
+	}
+	return nil
+}
+
+func isZip(f *os.File) bool {
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, []byte("PK\x03\x04"))
+}
+
+// VerifyFile verifies a downloaded file against its published digests and chunklist (either can be empty) and,
+// if it is a zip (IPSW/OTA), checks the CRC32 of every entry
+func VerifyFile(path string, digests []Digest, chunklist []Chunk) (*VerifyReport, error) {
+	defer telemetry.Phase("download.verify")()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+	telemetry.AddBytes("download.verify", fi.Size())
+
+	report := &VerifyReport{Path: path}
+
+	if len(digests) > 0 {
+		hashes := make([]hash.Hash, 0, len(digests))
+		writers := make([]io.Writer, 0, len(digests))
+		for _, d := range digests {
+			h, err := d.hash()
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, h)
+			writers = append(writers, h)
+		}
+		if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %v", path, err)
+		}
+		for i, d := range digests {
+			report.Digests = append(report.Digests, DigestResult{
+				Algorithm: d.Algorithm,
+				Expected:  hex.EncodeToString(d.Sum),
+				Actual:    hex.EncodeToString(hashes[i].Sum(nil)),
+			})
+		}
+	}
+
+	if len(chunklist) > 0 {
+		if err := verifyChunks(f, chunklist, report); err != nil {
+			return nil, fmt.Errorf("failed to verify %s against its chunklist: %v", path, err)
+		}
+	}
+
+	if isZip(f) {
+		if err := verifyZip(f, fi.Size(), report); err != nil {
+			report.BadEntries = append(report.BadEntries, err.Error())
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,87 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, corrupt bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "kernelcache.release.iphone15", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("not really a kernelcache"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dat := buf.Bytes()
+	if corrupt { // flip a byte of the stored entry's data
+		dat[bytes.Index(dat, []byte("really"))] ^= 0xff
+	}
+	if err := os.WriteFile(path, dat, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dat
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "good.ipsw")
+	dat := writeZip(t, good, false)
+	sum := sha256.Sum256(dat)
+	report, err := VerifyFile(good, []Digest{{Algorithm: "sha2-256", Sum: sum[:]}}, []Chunk{{Size: uint32(len(dat)), SHA256: sum}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("VerifyFile(good) = %v", err)
+	}
+	if report.ZipEntries != 1 || report.Chunks != 1 {
+		t.Errorf("VerifyFile(good) checked %d entries and %d chunks; want 1 and 1", report.ZipEntries, report.Chunks)
+	}
+
+	bad := filepath.Join(dir, "bad.ipsw")
+	writeZip(t, bad, true)
+	report, err = VerifyFile(bad, []Digest{{Algorithm: "sha2-256", Sum: sum[:]}}, []Chunk{{Size: uint32(len(dat)), SHA256: sum}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.BadEntries) != 1 || len(report.BadChunks) != 1 || report.Digests[0].Match() {
+		t.Errorf("VerifyFile(bad) = %+v; want a CRC, chunk and digest mismatch", report)
+	}
+	if report.Err() == nil {
+		t.Error("VerifyFile(bad).Err() = nil")
+	}
+}
+
+func TestParseChunklist(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, chunklistHeader{
+		Magic:       chunklistMagic,
+		HeaderSize:  chunklistHeaderSize,
+		FileVersion: 1,
+		ChunkMethod: chunklistSHA256,
+		ChunkCount:  2,
+		ChunkOffset: chunklistHeaderSize,
+	})
+	binary.Write(&buf, binary.LittleEndian, []Chunk{{Size: 0x1000}, {Size: 0x20}})
+	chunks, err := ParseChunklist(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || chunks[1].Size != 0x20 {
+		t.Errorf("ParseChunklist() = %+v", chunks)
+	}
+	if _, err := ParseChunklist(buf.Bytes()[:chunklistHeaderSize+10]); err == nil {
+		t.Error("ParseChunklist(truncated) = nil error")
+	}
+}
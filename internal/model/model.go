@@ -4,6 +4,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,6 +19,7 @@ var (
 type Ipsw struct {
 	ID         string             `gorm:"primaryKey" json:"id"`
 	Name       string             `json:"name,omitempty"`
+	Path       string             `json:"path,omitempty"` // where the IPSW was scanned from (on the ipswd host)
 	Version    string             `json:"version,omitempty"`
 	BuildID    string             `json:"buildid,omitempty"`
 	Devices    []*Device          `gorm:"many2many:ipsw_devices;" json:"devices,omitempty"`
@@ -52,8 +54,16 @@ type DyldSharedCache struct {
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 
-	SharedRegionStart uint64   `json:"shared_region_start,omitempty"`
-	Images            []*Macho `gorm:"many2many:dsc_images;" json:"images,omitempty"`
+	SharedRegionStart uint64      `json:"shared_region_start,omitempty"`
+	SubCaches         []*SubCache `gorm:"foreignKey:DyldSharedCacheUUID" json:"sub_caches,omitempty"`
+	Images            []*Macho    `gorm:"many2many:dsc_images;" json:"images,omitempty"`
+}
+
+// SubCache is the model for a dyld4 subcache (or .symbols file) of a dyld_shared_cache.
+type SubCache struct {
+	UUID                string `gorm:"primaryKey" json:"uuid"`
+	DyldSharedCacheUUID string `gorm:"index" json:"-"`
+	Suffix              string `json:"suffix"`
 }
 
 type Path struct {
@@ -70,6 +80,12 @@ type Macho struct {
 	TextStart uint64    `gorm:"type:bigint" json:"text_start,omitempty"`
 	TextEnd   uint64    `gorm:"type:bigint" json:"text_end,omitempty"`
 	Symbols   []*Symbol `gorm:"many2many:macho_syms;"`
+	// swagger:ignore
+	Strings []*String `gorm:"many2many:macho_strs;" json:"-"`
+	// swagger:ignore
+	Entitlements []*Entitlement `gorm:"many2many:macho_ents;" json:"-"`
+	// swagger:ignore
+	IOKitClasses []*IOKitClass `gorm:"many2many:macho_iokit_classes;" json:"-"`
 }
 
 func (m Macho) GetPath() string {
@@ -91,6 +107,8 @@ type Symbol struct {
 	Name   Name   `gorm:"foreignKey:NameID"`
 	Start  uint64 `gorm:"type:bigint" json:"start"`
 	End    uint64 `gorm:"type:bigint" json:"end"`
+	// the demangled Swift/C++ name (only set when requested)
+	Demangled string `gorm:"-" json:"demangled,omitempty"`
 }
 
 func (s Symbol) GetName() string {
@@ -100,3 +118,172 @@ func (s Symbol) GetName() string {
 func (s Symbol) String() string {
 	return fmt.Sprintf("%#x: %s", s.Start, s.Name.Name)
 }
+
+// MaxStringLen is the longest string literal that gets indexed
+const MaxStringLen = 256
+
+// String is an indexed string literal (shared by every MachO that contains it).
+type String struct {
+	// swagger:ignore
+	ID    uint   `gorm:"primaryKey"`
+	Value string `gorm:"uniqueIndex" json:"value,omitempty"`
+}
+
+// Entitlement is an indexed entitlement key (shared by every MachO that claims it).
+type Entitlement struct {
+	// swagger:ignore
+	ID  uint   `gorm:"primaryKey"`
+	Key string `gorm:"uniqueIndex" json:"key,omitempty"`
+}
+
+// IOKitClass is an indexed IOKit class name (from the IOKit personalities of every DriverKit extension that implements or matches on it).
+type IOKitClass struct {
+	// swagger:ignore
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"uniqueIndex" json:"name,omitempty"`
+}
+
+// SearchKind is what a cross-build search looks for.
+type SearchKind string
+
+const (
+	SearchSymbol      SearchKind = "symbol"
+	SearchString      SearchKind = "string"
+	SearchEntitlement SearchKind = "entitlement"
+	SearchIOKit       SearchKind = "iokit"
+	SearchUUID        SearchKind = "uuid" // the MachO itself
+)
+
+// Source is where in a build a MachO was found.
+type Source string
+
+const (
+	SourceKernel     Source = "kernel"
+	SourceDSC        Source = "dsc"
+	SourceFileSystem Source = "fs"
+	SourceDriverKit  Source = "dext" // DriverKit and system extensions (in the file system)
+)
+
+// FileSystemSource returns the source of a file system MachO (DriverKit and system extension bundles are their own source).
+func FileSystemSource(path string) Source {
+	if strings.Contains(path, ".dext/") || strings.Contains(path, ".systemextension/") {
+		return SourceDriverKit
+	}
+	return SourceFileSystem
+}
+
+// swagger:model
+type SearchResult struct {
+	IpswID   string `json:"ipsw_id"`
+	IpswPath string `json:"ipsw_path,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Version  string `json:"version,omitempty"`
+	BuildID  string `json:"buildid,omitempty"`
+	Source   Source `json:"source"`
+	Path     string `json:"path"`
+	UUID     string `json:"uuid"`
+	Tags     []*Tag `gorm:"-" json:"tags,omitempty"` // the IPSW's, MachO's and symbol's tags
+}
+
+// HasTag returns true if the result has the tag key (and value if not empty).
+func (r SearchResult) HasTag(key, value string) bool {
+	for _, t := range r.Tags {
+		if t.Key == key && (value == "" || t.Value == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// JobKind is the work a cluster job does.
+type JobKind string
+
+const (
+	JobScan    JobKind = "scan"    // scan an IPSW's symbols into the DB
+	JobRescan  JobKind = "rescan"  // rescan an IPSW's symbols into the DB
+	JobExtract JobKind = "extract" // extract files from an IPSW
+)
+
+// ExtractTypes are what an extract job can extract.
+var ExtractTypes = []string{"kernel", "dsc", "dmg", "pattern", "sptm"}
+
+// JobStatus is the state of a cluster job.
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobLeased  JobStatus = "leased"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// Job is a unit of work that is leased by the ipswd workers sharing a DB.
+// swagger:model
+type Job struct {
+	ID   uint    `gorm:"primaryKey" json:"id"`
+	Kind JobKind `gorm:"index" json:"kind"`
+	// path to the IPSW (scan/rescan jobs)
+	Path    string `json:"path,omitempty"`
+	PemDB   string `json:"pem_db,omitempty"`
+	SigsDir string `json:"sig_dir,omitempty"`
+	// what to extract (kernel, dsc, dmg, pattern or sptm) and the JSON extract config (extract jobs)
+	Extract string `json:"extract,omitempty"`
+	Config  string `json:"config,omitempty"`
+
+	Status       JobStatus `gorm:"index" json:"status"`
+	Worker       string    `json:"worker,omitempty"`
+	LeaseExpires time.Time `json:"lease_expires,omitempty"`
+	// swagger:ignore
+	Lease       uint   `json:"-"` // incremented on every lease (optimistic locking between workers)
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts,omitempty"`
+	Result      string `json:"result,omitempty"` // JSON artifacts of extract jobs
+	Error       string `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Worker is an ipswd instance that leases jobs.
+// swagger:model
+type Worker struct {
+	ID       string    `gorm:"primaryKey" json:"id"`
+	Host     string    `json:"host,omitempty"`
+	Kinds    string    `json:"kinds,omitempty"` // comma separated job kinds (empty is all)
+	LastSeen time.Time `json:"last_seen"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TagKind is the kind of scanned artifact a tag annotates.
+type TagKind string
+
+const (
+	TagIPSW   TagKind = "ipsw"   // tags an IPSW (by ID)
+	TagMachO  TagKind = "macho"  // tags a MachO (by UUID)
+	TagSymbol TagKind = "symbol" // tags a symbol (by name) in every build
+)
+
+// TagKinds are the kinds of artifacts that can be tagged.
+var TagKinds = []TagKind{TagIPSW, TagMachO, TagSymbol}
+
+// Tag is a user-defined key/value annotation (and note) on a scanned artifact, i.e. triaged or vuln-fixed-here.
+// swagger:model
+type Tag struct {
+	ID     uint    `gorm:"primaryKey" json:"id"`
+	Kind   TagKind `gorm:"uniqueIndex:idx_tag_target" json:"kind"`
+	Target string  `gorm:"uniqueIndex:idx_tag_target" json:"target"` // IPSW ID, MachO UUID or symbol name
+	Key    string  `gorm:"uniqueIndex:idx_tag_target;index" json:"key"`
+	Value  string  `json:"value,omitempty"`
+	Note   string  `json:"note,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (t Tag) String() string {
+	if t.Value != "" {
+		return t.Key + "=" + t.Value
+	}
+	return t.Key
+}
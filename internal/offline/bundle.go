@@ -0,0 +1,265 @@
+package offline
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+const (
+	// FormatVersion is the version of the bundle layout (bundles with a newer format are rejected)
+	FormatVersion = 1
+	// ManifestName is the name of the manifest (the first entry of a bundle and a file in the import directory)
+	ManifestName = "manifest.json"
+)
+
+// Entry is a file in a data bundle
+type Entry struct {
+	Name   string `json:"name"` // slash separated path relative to the bundle root
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a data bundle
+type Manifest struct {
+	Format  int       `json:"format"`
+	Version string    `json:"version"` // the version of the data (defaults to the creation date)
+	Tool    string    `json:"tool,omitempty"`
+	Created time.Time `json:"created"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Has reports whether the bundle contains the file or folder name
+func (m *Manifest) Has(name string) bool {
+	for _, e := range m.Entries {
+		if e.Name == name || strings.HasPrefix(e.Name, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Pack writes every file in dir to w as a gzipped tar data bundle (with its manifest as the first entry)
+func Pack(dir string, w io.Writer, version, tool string) (*Manifest, error) {
+	m := &Manifest{
+		Format:  FormatVersion,
+		Version: version,
+		Tool:    tool,
+		Created: time.Now().UTC(),
+	}
+	if m.Version == "" {
+		m.Version = m.Created.Format("20060102")
+	}
+	if err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == ManifestName {
+			return nil
+		}
+		sum, size, err := hashFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %v", p, err)
+		}
+		m.Entries = append(m.Entries, Entry{Name: filepath.ToSlash(rel), Size: size, SHA256: sum})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %v", dir, err)
+	}
+	if len(m.Entries) == 0 {
+		return nil, fmt.Errorf("no data to bundle in %s", dir)
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Name < m.Entries[j].Name })
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0o644, Size: int64(len(manifest)), ModTime: m.Created}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return nil, err
+	}
+	for _, e := range m.Entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.Name, Mode: 0o644, Size: e.Size, ModTime: m.Created}); err != nil {
+			return nil, err
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(e.Name)))
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", e.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Unpack extracts a data bundle into dir verifying every file against the manifest
+func Unpack(r io.Reader, dir string) (*Manifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errcode.Errorf(errcode.InvalidFormat, "failed to read data bundle: %v", err)
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != ManifestName {
+		return nil, errcode.Errorf(errcode.InvalidFormat, "data bundle does not start with a %s", ManifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, errcode.Errorf(errcode.InvalidFormat, "failed to parse data bundle manifest: %v", err)
+	}
+	if m.Format > FormatVersion {
+		return nil, errcode.Errorf(errcode.Unsupported, "data bundle format %d is newer than this version of ipsw supports (%d)", m.Format, FormatVersion)
+	}
+	entries := make(map[string]Entry, len(m.Entries))
+	for _, e := range m.Entries {
+		entries[e.Name] = e
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errcode.Errorf(errcode.InvalidFormat, "failed to read data bundle: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		e, ok := entries[hdr.Name]
+		if !ok {
+			return nil, errcode.Errorf(errcode.InvalidFormat, "data bundle file %s is not in the manifest", hdr.Name)
+		}
+		name := path.Clean(hdr.Name)
+		if name != hdr.Name || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, errcode.Errorf(errcode.InvalidFormat, "invalid data bundle file name %q", hdr.Name)
+		}
+		out := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+			return nil, err
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), tr)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %v", name, err)
+		}
+		if n != e.Size || hex.EncodeToString(h.Sum(nil)) != e.SHA256 {
+			return nil, errcode.Errorf(errcode.InvalidFormat, "data bundle file %s does not match its manifest checksum", name)
+		}
+		delete(entries, hdr.Name)
+	}
+	for name := range entries {
+		return nil, errcode.Errorf(errcode.InvalidFormat, "data bundle is missing %s", name)
+	}
+	return &m, nil
+}
+
+// Import verifies and extracts the data bundle at path into dir, replacing any previously imported bundle
+func Import(bundle, dir string) (*Manifest, error) {
+	f, err := os.Open(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data bundle: %w", err)
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0o750); err != nil {
+		return nil, err
+	}
+	// extract next to dir first so a bad bundle never clobbers the current one
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".import-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	m, err := Unpack(f, tmp)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, ManifestName), manifest, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to remove previously imported data bundle: %v", err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, fmt.Errorf("failed to install data bundle: %v", err)
+	}
+	return m, nil
+}
+
+// Installed returns the manifest of the data bundle imported into dir
+func Installed(dir string) (*Manifest, error) {
+	dat, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, errcode.Errorf(errcode.NotFound, "no data bundle has been imported into %s", dir)
+		}
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(dat, &m); err != nil {
+		return nil, errcode.Errorf(errcode.InvalidFormat, "failed to parse data bundle manifest: %v", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,142 @@
+// Package offline implements ipsw's air-gapped mode.
+//
+// Everything ipsw normally fetches from the network (the device DB, firmware and AEA keys, symbolicator signatures
+// and the macOS installer catalog) can be packaged on a connected machine into a versioned data bundle (see Pack)
+// and imported on an analysis machine (see Import). With offline mode enabled the data sources read the imported
+// bundle instead and every other HTTP request fails with ErrOffline.
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// The data files a bundle can contain (relative to the bundle root)
+const (
+	DeviceDB      = "ipsw_db.json"         // the device database (`ipsw updatedb` output)
+	IpswMeDevices = "ipsw.me/devices.json" // the ipsw.me API device list
+	FirmwareKeys  = "firmware_keys.json"   // the firmware keys database (`ipsw key-list-gen` output)
+	FcsKeys       = "fcs-keys.json"        // the AEA fcs-keys pem DB
+	Signatures    = "signatures"           // the symbolicator signatures folder
+	MacOSCatalog  = "macos_installers.json"
+)
+
+// ErrOffline is returned by anything that needs network access while offline mode is enabled
+var ErrOffline = errcode.New(errcode.Unsupported, "network access is disabled in offline mode")
+
+var (
+	mu      sync.Mutex
+	enabled bool
+	dataDir string
+	guard   sync.Once
+)
+
+// SetEnabled turns offline mode on or off (turning it on blocks every request made through http.DefaultTransport)
+func SetEnabled(on bool) {
+	mu.Lock()
+	enabled = on
+	mu.Unlock()
+	if on {
+		guard.Do(func() {
+			http.DefaultTransport = &transport{rt: http.DefaultTransport}
+		})
+	}
+}
+
+// Enabled reports whether offline mode is enabled
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// SetDir sets the directory of the imported data bundle (empty resets it to DefaultDir)
+func SetDir(dir string) {
+	mu.Lock()
+	dataDir = dir
+	mu.Unlock()
+}
+
+// DefaultDir returns the default imported data bundle directory (~/.config/ipsw/data)
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+	return filepath.Join(home, ".config", "ipsw", "data"), nil
+}
+
+// Dir returns the directory of the imported data bundle
+func Dir() (string, error) {
+	mu.Lock()
+	dir := dataDir
+	mu.Unlock()
+	if dir != "" {
+		return dir, nil
+	}
+	return DefaultDir()
+}
+
+// Path returns the path of a file or folder of the imported data bundle
+func Path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", errcode.Errorf(errcode.NotFound, "offline data bundle in %s has no %s (import a bundle with `ipsw bundle-data import`)", dir, name)
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// PathOr returns path unless it is empty and offline mode is enabled, in which case it returns the path of name in the
+// imported data bundle (if the bundle has it)
+func PathOr(path, name string) string {
+	if path != "" || !Enabled() {
+		return path
+	}
+	if p, err := Path(name); err == nil {
+		return p
+	}
+	return path
+}
+
+// ReadFile returns the contents of a file of the imported data bundle
+func ReadFile(name string) ([]byte, error) {
+	path, err := Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// Check returns ErrOffline (naming what needed the network) if offline mode is enabled
+func Check(what string) error {
+	if Enabled() {
+		return fmt.Errorf("%s: %w", what, ErrOffline)
+	}
+	return nil
+}
+
+// transport fails every request while offline mode is enabled
+type transport struct {
+	rt http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := Check(req.Method + " " + req.URL.Scheme + "://" + req.URL.Host + req.URL.Path); err != nil {
+		return nil, err
+	}
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,74 @@
+package offline
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+func TestBundle(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, Signatures, "kernel"), 0o750)
+	os.WriteFile(filepath.Join(src, DeviceDB), []byte(`{"iPhone15,2":{"name":"iPhone 14 Pro"}}`), 0o644)
+	os.WriteFile(filepath.Join(src, Signatures, "kernel", "xnu.json"), []byte(`{"target":"com.apple.kernel"}`), 0o644)
+
+	var buf bytes.Buffer
+	m, err := Pack(src, &buf, "", "ipsw test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 2 || m.Version == "" || !m.Has(Signatures) || m.Has(FcsKeys) {
+		t.Fatalf("Pack() manifest = %+v", m)
+	}
+	bundle := filepath.Join(t.TempDir(), "data.tar.gz")
+	if err := os.WriteFile(bundle, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "data")
+	if _, err := Import(bundle, dir); err != nil {
+		t.Fatal(err)
+	}
+	if im, err := Installed(dir); err != nil || im.Version != m.Version || len(im.Entries) != 2 {
+		t.Fatalf("Installed() = %+v, %v", im, err)
+	}
+
+	SetDir(dir)
+	defer SetDir("")
+	if got := PathOr("", Signatures); got != "" {
+		t.Errorf("PathOr() = %q outside of offline mode", got)
+	}
+	SetEnabled(true)
+	defer SetEnabled(false)
+	if got := PathOr("", Signatures); got != filepath.Join(dir, Signatures) {
+		t.Errorf("PathOr() = %q", got)
+	}
+	if got := PathOr("", FcsKeys); got != "" {
+		t.Errorf("PathOr() = %q for data missing from the bundle", got)
+	}
+	if dat, err := ReadFile(DeviceDB); err != nil || !bytes.Contains(dat, []byte("iPhone 14 Pro")) {
+		t.Errorf("ReadFile() = %s, %v", dat, err)
+	}
+	if _, err := ReadFile(MacOSCatalog); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("ReadFile() of missing data = %v", err)
+	}
+	if _, err := http.Get("http://127.0.0.1:1/"); !errors.Is(err, ErrOffline) {
+		t.Errorf("http.Get() in offline mode = %v", err)
+	}
+
+	// a corrupted bundle is rejected and leaves the imported one alone
+	bad := bytes.Clone(buf.Bytes())
+	bad[len(bad)-12] ^= 0xff
+	os.WriteFile(bundle, bad, 0o644)
+	if _, err := Import(bundle, dir); err == nil {
+		t.Error("Import() accepted a corrupted bundle")
+	}
+	if _, err := Installed(dir); err != nil {
+		t.Errorf("failed import removed the previous bundle: %v", err)
+	}
+}
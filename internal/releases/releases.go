@@ -0,0 +1,271 @@
+// Package releases tracks which builds exist for which device models/boards (across beta seeds) using archived catalog snapshots
+package releases
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+const (
+	snapshotPrefix = "releases-"
+	snapshotExt    = ".json.gz"
+	snapshotTime   = "20060102T150405Z"
+)
+
+// Build is a released (or seeded) OS build
+type Build struct {
+	OS       string    `json:"os"`
+	Version  string    `json:"version"`
+	Build    string    `json:"build"`
+	Released time.Time `json:"released,omitempty"`
+	Beta     bool      `json:"beta,omitempty"`
+	RC       bool      `json:"rc,omitempty"`
+	// device model -> firmware types (ipsw, ota, etc.) available for it
+	Devices map[string][]string `json:"devices"`
+}
+
+// String returns the build's label (i.e. '18.0 beta 2 (22A5297f)')
+func (b Build) String() string {
+	return fmt.Sprintf("%s (%s)", b.Version, b.Build)
+}
+
+// Snapshot is an archived catalog of all the known builds
+type Snapshot struct {
+	Created time.Time `json:"created"`
+	Source  string    `json:"source"`
+	Builds  []Build   `json:"builds"`
+}
+
+// FromAppleDB creates a snapshot from AppleDB osFiles
+func FromAppleDB(files download.OsFiles) *Snapshot {
+	s := &Snapshot{
+		Created: time.Now().UTC(),
+		Source:  download.AppleDBRepoURL,
+	}
+	for _, f := range files {
+		if f.Internal || f.Build == "" {
+			continue
+		}
+		b := Build{
+			OS:       f.OS,
+			Version:  f.Version,
+			Build:    f.Build,
+			Released: time.Time(f.Released),
+			Beta:     f.Beta,
+			RC:       f.RC,
+			Devices:  make(map[string][]string),
+		}
+		for _, dev := range f.DeviceMap {
+			b.Devices[dev] = []string{}
+		}
+		for _, src := range f.Sources {
+			for _, dev := range src.DeviceMap {
+				if !slices.Contains(b.Devices[dev], src.Type) {
+					b.Devices[dev] = append(b.Devices[dev], src.Type)
+				}
+			}
+		}
+		for dev := range b.Devices {
+			slices.Sort(b.Devices[dev])
+		}
+		s.Builds = append(s.Builds, b)
+	}
+	s.sort()
+	return s
+}
+
+func (s *Snapshot) sort() {
+	slices.SortStableFunc(s.Builds, func(a, b Build) int {
+		if c := a.Released.Compare(b.Released); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Build, b.Build)
+	})
+}
+
+// Save archives the snapshot in the folder (returning the snapshot's path)
+func (s *Snapshot) Save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("failed to create snapshot folder: %v", err)
+	}
+	fname := filepath.Join(dir, snapshotPrefix+s.Created.UTC().Format(snapshotTime)+snapshotExt)
+	f, err := os.Create(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	if err := json.NewEncoder(zw).Encode(s); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return fname, nil
+}
+
+// Load reads an archived snapshot
+func Load(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %v", path, err)
+	}
+	defer zr.Close()
+	var s Snapshot
+	if err := json.NewDecoder(zr).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// Snapshots returns the archived snapshots in the folder (oldest first)
+func Snapshots(dir string) ([]string, error) {
+	snaps, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotExt))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(snaps) // the timestamps sort lexically
+	return snaps, nil
+}
+
+// Query filters the snapshot's builds
+type Query struct {
+	OS      string // i.e. iOS
+	Version string // version prefix (i.e. 18.0)
+	Beta    bool   // only beta/RC seeds
+	Device  string // device model (i.e. iPhone15,2) or board (i.e. D73AP)
+}
+
+func (q *Query) matchDevice(device string, devs *info.Devices) bool {
+	if q.Device == "" || strings.EqualFold(q.Device, device) {
+		return true
+	}
+	if devs != nil {
+		for board := range (*devs)[device].Boards {
+			if strings.EqualFold(q.Device, board) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Query returns the snapshot's builds (and devices) that match the query
+func (s *Snapshot) Query(q *Query, devs *info.Devices) []Build {
+	var builds []Build
+	for _, b := range s.Builds {
+		if q.OS != "" && !strings.EqualFold(b.OS, q.OS) {
+			continue
+		}
+		if q.Version != "" && !strings.HasPrefix(b.Version, q.Version) {
+			continue
+		}
+		if q.Beta && !b.Beta && !b.RC {
+			continue
+		}
+		if q.Device != "" {
+			matched := make(map[string][]string)
+			for dev, types := range b.Devices {
+				if q.matchDevice(dev, devs) {
+					matched[dev] = types
+				}
+			}
+			if len(matched) == 0 {
+				continue
+			}
+			b.Devices = matched
+		}
+		builds = append(builds, b)
+	}
+	return builds
+}
+
+// MatrixRow is a device model's builds
+type MatrixRow struct {
+	Device string   `json:"device"`
+	Name   string   `json:"name,omitempty"`
+	Boards []string `json:"boards,omitempty"`
+	// build -> firmware types available for the device
+	Builds map[string][]string `json:"builds"`
+}
+
+// Matrix is a device model by build availability matrix
+type Matrix struct {
+	Builds []Build      `json:"builds"`
+	Rows   []*MatrixRow `json:"devices"`
+}
+
+// NewMatrix creates the device model by build matrix of the builds
+// (device names and boards are looked up in the device database if supplied)
+func NewMatrix(builds []Build, devs *info.Devices) *Matrix {
+	m := &Matrix{}
+	rows := make(map[string]*MatrixRow)
+	for _, b := range builds {
+		m.Builds = append(m.Builds, Build{OS: b.OS, Version: b.Version, Build: b.Build, Released: b.Released, Beta: b.Beta, RC: b.RC})
+		for dev, types := range b.Devices {
+			row, ok := rows[dev]
+			if !ok {
+				row = &MatrixRow{Device: dev, Builds: make(map[string][]string)}
+				if devs != nil {
+					if d, ok := (*devs)[dev]; ok {
+						row.Name = d.Description
+						for board := range d.Boards {
+							row.Boards = append(row.Boards, board)
+						}
+						slices.Sort(row.Boards)
+					}
+				}
+				rows[dev] = row
+				m.Rows = append(m.Rows, row)
+			}
+			row.Builds[b.Build] = types
+		}
+	}
+	slices.SortFunc(m.Rows, func(a, b *MatrixRow) int { return strings.Compare(a.Device, b.Device) })
+	return m
+}
+
+// Change is a build (or the devices added to a build) that appeared between two snapshots
+type Change struct {
+	Build   Build    `json:"build"`
+	New     bool     `json:"new"`
+	Devices []string `json:"devices"`
+}
+
+// Diff returns the builds and devices in the next snapshot that weren't in the previous one
+func Diff(prev, next *Snapshot) []Change {
+	known := make(map[string]Build)
+	for _, b := range prev.Builds {
+		known[b.OS+"/"+b.Build] = b
+	}
+	var changes []Change
+	for _, b := range next.Builds {
+		old, ok := known[b.OS+"/"+b.Build]
+		var devices []string
+		for dev := range b.Devices {
+			if _, found := old.Devices[dev]; !found {
+				devices = append(devices, dev)
+			}
+		}
+		if ok && len(devices) == 0 {
+			continue
+		}
+		slices.Sort(devices)
+		changes = append(changes, Change{Build: b, New: !ok, Devices: devices})
+	}
+	return changes
+}
@@ -0,0 +1,76 @@
+package releases
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+const testOsFiles = `[
+  {"osStr": "iOS", "version": "18.0 beta", "build": "22A5282m", "released": "2024-06-10", "beta": true,
+   "deviceMap": ["iPhone15,2", "iPhone16,1"],
+   "sources": [
+     {"type": "ipsw", "deviceMap": ["iPhone15,2"]},
+     {"type": "ota", "deviceMap": ["iPhone15,2", "iPhone16,1"]}
+   ]},
+  {"osStr": "iOS", "version": "17.5.1", "build": "21F90", "released": "2024-05-20",
+   "deviceMap": ["iPhone15,2"], "sources": [{"type": "ipsw", "deviceMap": ["iPhone15,2"]}]},
+  {"osStr": "iOS", "version": "18.0 beta 2", "build": "22A5297f", "released": "2024-06-24", "beta": true,
+   "deviceMap": ["iPhone16,1"], "sources": [{"type": "ota", "deviceMap": ["iPhone16,1"]}]}
+]`
+
+func TestMatrix(t *testing.T) {
+	var files download.OsFiles
+	if err := json.Unmarshal([]byte(testOsFiles), &files); err != nil {
+		t.Fatal(err)
+	}
+	snap := FromAppleDB(files)
+	if len(snap.Builds) != 3 || snap.Builds[0].Build != "21F90" {
+		t.Fatalf("builds should be sorted by release date: %v", snap.Builds)
+	}
+
+	devs := &info.Devices{
+		"iPhone15,2": {Description: "iPhone 14 Pro", Boards: map[string]info.Board{"D73AP": {}}},
+	}
+	builds := snap.Query(&Query{Version: "18.0", Beta: true, Device: "d73ap"}, devs)
+	if len(builds) != 1 || builds[0].Build != "22A5282m" || len(builds[0].Devices) != 1 {
+		t.Fatalf("board query = %v", builds)
+	}
+
+	m := NewMatrix(snap.Query(&Query{OS: "iOS", Beta: true}, devs), devs)
+	if len(m.Builds) != 2 || len(m.Rows) != 2 {
+		t.Fatalf("matrix = %d builds x %d devices", len(m.Builds), len(m.Rows))
+	}
+	if row := m.Rows[0]; row.Device != "iPhone15,2" || row.Name != "iPhone 14 Pro" || len(row.Boards) != 1 {
+		t.Errorf("row = %+v", row)
+	} else if types := row.Builds["22A5282m"]; len(types) != 2 || types[0] != "ipsw" || types[1] != "ota" {
+		t.Errorf("iPhone15,2 22A5282m = %v", types)
+	} else if _, ok := row.Builds["22A5297f"]; ok {
+		t.Errorf("iPhone15,2 should not have 22A5297f")
+	}
+
+	dir := t.TempDir()
+	prev := FromAppleDB(files[:2])
+	prev.Created = time.Now().Add(-time.Hour)
+	if _, err := prev.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snap.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := Snapshots(dir)
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("snapshots = %v (%v)", snaps, err)
+	}
+	oldest, err := Load(snaps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := Diff(oldest, snap)
+	if len(changes) != 1 || !changes[0].New || changes[0].Build.Build != "22A5297f" {
+		t.Errorf("changes = %+v", changes)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/blacktop/ipsw/internal/magic"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/aea"
+	"github.com/blacktop/ipsw/pkg/img4"
 	"github.com/blacktop/ipsw/pkg/info"
 )
 
@@ -271,6 +272,10 @@ func ForEachIm4pInIPSW(ipswPath string, handler func(string, *macho.File) error)
 
 	for _, im4p := range im4ps {
 		if err := icmd.ExtractPayload(im4p, im4p, false); err != nil {
+			if errors.Is(err, img4.ErrEncrypted) {
+				log.Debugf("skipping encrypted %s", filepath.Base(im4p))
+				continue
+			}
 			return fmt.Errorf("failed to extract im4p payload: %v", err)
 		}
 		if regexp.MustCompile(`armfw_.*.im4p$`).MatchString(im4p) {
@@ -382,3 +387,47 @@ func ForEachPlistInIPSW(ipswPath, directory, pemDB string, handler func(string,
 
 	return nil
 }
+
+// ForEachFileInIPSW walks the IPSW's filesystem DMGs and calls the handler with the path (relative to the DMG's root) and data of each matching file
+func ForEachFileInIPSW(ipswPath, pemDB string, match func(string) bool, handler func(string, []byte) error) error {
+	i, err := info.Parse(ipswPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse IPSW: %v", err)
+	}
+
+	scanFile := func(mountPoint, filePath string) error {
+		if !match(filePath) {
+			return nil
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", filePath, err)
+		}
+		if _, rest, ok := strings.Cut(filePath, mountPoint); ok {
+			filePath = rest
+		}
+		if err := handler(filePath, data); err != nil {
+			return fmt.Errorf("failed to handle %s: %v", filePath, err)
+		}
+		return nil
+	}
+
+	for _, dmg := range []struct {
+		name string
+		get  func() (string, error)
+	}{
+		{"filesystem", i.GetFileSystemOsDmg},
+		{"SystemOS", i.GetSystemOsDmg},
+		{"AppOS", i.GetAppOsDmg},
+		{"ExclaveOS", i.GetExclaveOSDmg},
+	} {
+		if dmgPath, err := dmg.get(); err == nil {
+			log.Infof("Scanning %s", dmg.name)
+			if err := scanDmg(ipswPath, dmgPath, dmg.name, pemDB, scanFile); err != nil {
+				return fmt.Errorf("failed to scan files in %s %s: %w", dmg.name, dmgPath, err)
+			}
+		}
+	}
+
+	return nil
+}
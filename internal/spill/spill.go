@@ -0,0 +1,359 @@
+// Package spill provides address-keyed maps that live in memory until a global memory budget is exceeded and then
+// move to a temporary on-disk store so that huge analyses still complete on memory-constrained machines (like CI
+// runners).
+//
+// NOTE: the xref map of `ipsw dsc xref` and the dyld_shared_cache ObjC class, selector and protocol indexes are backed
+// by a Map (`ipsw kernel kexts` also streams the kernelcache when a budget is set); the other analyses (i.e. the
+// symbol indexes) still keep everything in memory and only the Go runtime soft memory limit applies to them.
+package spill
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/apex/log"
+	"github.com/dustin/go-humanize"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// entryOverhead is the approximate cost of a map entry beyond its key and value
+	entryOverhead = 48
+	// batchSize is the number of writes buffered before they are flushed to disk in one transaction
+	batchSize = 10000
+)
+
+var (
+	budget atomic.Int64 // 0 means unlimited
+	used   atomic.Int64 // approximate bytes held by in-memory maps
+	dir    string
+
+	bucket = []byte("spill")
+)
+
+// SetBudget sets the global memory budget in bytes (0 disables spilling) and the Go runtime soft memory limit
+func SetBudget(bytes int64) {
+	budget.Store(bytes)
+	if bytes > 0 {
+		debug.SetMemoryLimit(bytes)
+	} else {
+		debug.SetMemoryLimit(math.MaxInt64)
+	}
+}
+
+// SetBudgetString sets the global memory budget from a human readable size (e.g. "2GB", "512MiB")
+func SetBudgetString(size string) error {
+	if len(size) == 0 {
+		SetBudget(0)
+		return nil
+	}
+	bytes, err := humanize.ParseBytes(size)
+	if err != nil {
+		return fmt.Errorf("invalid memory budget %q: %v", size, err)
+	}
+	SetBudget(int64(bytes))
+	return nil
+}
+
+// Budget returns the global memory budget in bytes (0 means unlimited)
+func Budget() int64 {
+	return budget.Load()
+}
+
+// SetDir sets the directory spill files are created in (default is os.TempDir)
+func SetDir(path string) {
+	dir = path
+}
+
+// Map is a uint64 keyed map (typically keyed by address) that spills to disk when the memory budget is exceeded
+//
+// NOTE: a Map is safe for concurrent use, however once spilled every Set/Get goes through the on-disk store
+type Map[V any] struct {
+	mu    sync.Mutex
+	mem   map[uint64]V
+	size  int64
+	count int
+
+	db      *bolt.DB
+	path    string
+	pending map[uint64]V
+}
+
+// NewMap returns an empty in-memory Map
+func NewMap[V any]() *Map[V] {
+	return &Map[V]{mem: make(map[uint64]V)}
+}
+
+// Set adds or replaces the value for key
+func (m *Map[V]) Set(key uint64, val V) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db != nil {
+		if _, ok := m.pending[key]; !ok {
+			if found, err := m.has(key); err != nil {
+				return err
+			} else if !found {
+				m.count++
+			}
+		}
+		m.pending[key] = val
+		if len(m.pending) >= batchSize {
+			return m.flush()
+		}
+		return nil
+	}
+
+	sz := sizeOf(val)
+	if old, ok := m.mem[key]; ok {
+		sz -= sizeOf(old)
+	} else {
+		m.count++
+	}
+	m.mem[key] = val
+	m.size += sz
+	if limit := budget.Load(); limit > 0 && used.Add(sz) > limit {
+		return m.spill()
+	}
+	return nil
+}
+
+// Get returns the value for key
+func (m *Map[V]) Get(key uint64) (V, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		val, ok := m.mem[key]
+		return val, ok, nil
+	}
+	if val, ok := m.pending[key]; ok {
+		return val, true, nil
+	}
+	var val V
+	var found bool
+	err := m.db.View(func(tx *bolt.Tx) error {
+		dat := tx.Bucket(bucket).Get(encodeKey(key))
+		if dat == nil {
+			return nil
+		}
+		found = true
+		return decode(dat, &val)
+	})
+	return val, found, err
+}
+
+// Len returns the number of entries
+func (m *Map[V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.count
+}
+
+// Spilled reports whether the Map has moved to disk
+func (m *Map[V]) Spilled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.db != nil
+}
+
+// Range calls fn for every entry (in ascending key order once spilled) until fn returns an error
+func (m *Map[V]) Range(fn func(key uint64, val V) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		for k, v := range m.mem {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := m.flush(); err != nil {
+		return err
+	}
+	return m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, dat []byte) error {
+			var val V
+			if err := decode(dat, &val); err != nil {
+				return err
+			}
+			return fn(binary.BigEndian.Uint64(k), val)
+		})
+	})
+}
+
+// Keys returns every key in ascending order
+func (m *Map[V]) Keys() ([]uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return slices.Sorted(maps.Keys(m.mem)), nil
+	}
+	if err := m.flush(); err != nil {
+		return nil, err
+	}
+	keys := make([]uint64, 0, m.count)
+	err := m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+			keys = append(keys, binary.BigEndian.Uint64(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// Close releases the Map's memory and removes its spill file
+func (m *Map[V]) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used.Add(-m.size)
+	m.mem = nil
+	m.size = 0
+	m.count = 0
+	m.pending = nil
+	if m.db == nil {
+		return nil
+	}
+	err := m.db.Close()
+	m.db = nil
+	if rerr := os.Remove(m.path); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// spill moves the in-memory entries to a new temporary on-disk store
+func (m *Map[V]) spill() error {
+	f, err := os.CreateTemp(dir, "ipsw-spill-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create spill file: %v", err)
+	}
+	m.path = f.Name()
+	f.Close()
+
+	log.WithFields(log.Fields{
+		"entries": m.count,
+		"size":    humanize.Bytes(uint64(m.size)),
+		"budget":  humanize.Bytes(uint64(budget.Load())),
+		"path":    m.path,
+	}).Debug("Memory budget exceeded, spilling to disk")
+
+	m.db, err = bolt.Open(m.path, 0o600, &bolt.Options{NoSync: true, NoFreelistSync: true})
+	if err != nil {
+		os.Remove(m.path)
+		return fmt.Errorf("failed to open spill file: %v", err)
+	}
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		m.db.Close()
+		m.db = nil
+		os.Remove(m.path)
+		return fmt.Errorf("failed to create spill bucket: %v", err)
+	}
+
+	m.pending = m.mem
+	m.mem = nil
+	if err := m.flush(); err != nil {
+		return err
+	}
+	used.Add(-m.size)
+	m.size = 0
+	return nil
+}
+
+// flush writes the pending entries to disk
+func (m *Map[V]) flush() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for k, v := range m.pending {
+			dat, err := encode(v)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(encodeKey(k), dat); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to write to spill file: %v", err)
+	}
+	m.pending = make(map[uint64]V, batchSize)
+	return nil
+}
+
+func (m *Map[V]) has(key uint64) (found bool, err error) {
+	err = m.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(bucket).Get(encodeKey(key)) != nil
+		return nil
+	})
+	return
+}
+
+// encodeKey big-endian encodes keys so the on-disk store iterates in address order
+func encodeKey(key uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, key)
+}
+
+func encode(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case string:
+		return []byte(v), nil
+	case uint64:
+		return binary.BigEndian.AppendUint64(nil, v), nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+		return nil, fmt.Errorf("failed to encode spill value: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decode[V any](dat []byte, val *V) error {
+	switch v := any(val).(type) {
+	case *string:
+		*v = string(dat)
+		return nil
+	case *uint64:
+		*v = binary.BigEndian.Uint64(dat)
+		return nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(dat)).Decode(val); err != nil {
+		return fmt.Errorf("failed to decode spill value: %v", err)
+	}
+	return nil
+}
+
+func sizeOf[V any](val V) int64 {
+	sz := int64(unsafe.Sizeof(val)) + 8 + entryOverhead
+	switch v := any(val).(type) {
+	case string:
+		sz += int64(len(v))
+	case []byte:
+		sz += int64(len(v))
+	case []string:
+		for _, s := range v {
+			sz += int64(len(s)) + 16
+		}
+	}
+	return sz
+}
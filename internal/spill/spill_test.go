@@ -0,0 +1,73 @@
+package spill
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMapSpill(t *testing.T) {
+	SetDir(t.TempDir())
+	SetBudget(16 << 10)
+	defer SetBudget(0)
+
+	m := NewMap[string]()
+	defer m.Close()
+
+	const n = 2000
+	for i := uint64(0); i < n; i++ {
+		if err := m.Set(0x180000000+i*4, fmt.Sprintf("func_%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !m.Spilled() {
+		t.Fatal("expected map to spill to disk")
+	}
+	if err := m.Set(0x180000000, "func_0_renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != n {
+		t.Errorf("Len() = %d, want %d", m.Len(), n)
+	}
+	if v, ok, err := m.Get(0x180000000 + 4*1234); err != nil || !ok || v != "func_1234" {
+		t.Errorf("Get() = %q, %t, %v", v, ok, err)
+	}
+
+	var prev uint64
+	count := 0
+	if err := m.Range(func(k uint64, v string) error {
+		if count > 0 && k <= prev {
+			return fmt.Errorf("keys out of order: %#x after %#x", k, prev)
+		}
+		if k == 0x180000000 && v != "func_0_renamed" {
+			return fmt.Errorf("stale value %q", v)
+		}
+		prev = k
+		count++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Errorf("Range() visited %d entries, want %d", count, n)
+	}
+	if keys, err := m.Keys(); err != nil || len(keys) != n || keys[0] != 0x180000000 || keys[n-1] != 0x180000000+(n-1)*4 {
+		t.Errorf("Keys() = %d keys, %v", len(keys), err)
+	}
+}
+
+func TestMapInMemory(t *testing.T) {
+	SetBudget(0)
+
+	m := NewMap[[]string]()
+	defer m.Close()
+
+	if err := m.Set(1, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Spilled() {
+		t.Error("map spilled without a budget")
+	}
+	if v, ok, _ := m.Get(1); !ok || len(v) != 2 {
+		t.Errorf("Get() = %v, %t", v, ok)
+	}
+}
@@ -0,0 +1,112 @@
+package stable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// ErrGoldenMismatch is returned when output differs from the golden file
+var ErrGoldenMismatch = errors.New("output does not match golden file")
+
+var ansiRE = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// Recorder captures everything written to os.Stdout so it can be compared against (or saved as) a golden file
+type Recorder struct {
+	Path   string
+	Update bool
+	Diff   *utils.GitDiffConfig
+
+	stdout *os.File
+	w      *os.File
+	buf    bytes.Buffer
+	done   chan error
+}
+
+// Record starts capturing os.Stdout
+func Record(path string, update bool, diff *utils.GitDiffConfig) (*Recorder, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
+	}
+	rec := &Recorder{
+		Path:   path,
+		Update: update,
+		Diff:   diff,
+		stdout: os.Stdout,
+		w:      w,
+		done:   make(chan error, 1),
+	}
+	go func() {
+		_, err := io.Copy(&rec.buf, r)
+		r.Close()
+		rec.done <- err
+	}()
+	os.Stdout = w
+	return rec, nil
+}
+
+// Stop restores os.Stdout and returns the captured (normalized) output
+func (r *Recorder) Stop() (string, error) {
+	if r.w == nil {
+		return Normalize(r.buf.String()), nil
+	}
+	os.Stdout = r.stdout
+	r.w.Close()
+	r.w = nil
+	if err := <-r.done; err != nil {
+		return "", fmt.Errorf("failed to capture stdout: %v", err)
+	}
+	return Normalize(r.buf.String()), nil
+}
+
+// Finish stops capturing and then writes (in update mode) or compares the output to the golden file
+func (r *Recorder) Finish() error {
+	out, err := r.Stop()
+	if err != nil {
+		return err
+	}
+	if r.Update {
+		if err := os.MkdirAll(filepath.Dir(r.Path), 0o750); err != nil {
+			return fmt.Errorf("failed to create golden file directory: %v", err)
+		}
+		if err := os.WriteFile(r.Path, []byte(out), 0o644); err != nil {
+			return fmt.Errorf("failed to write golden file: %v", err)
+		}
+		return nil
+	}
+	want, err := os.ReadFile(r.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read golden file (use --update-golden to create it): %v", err)
+	}
+	if Normalize(string(want)) == out {
+		return nil
+	}
+	conf := r.Diff
+	if conf == nil {
+		conf = &utils.GitDiffConfig{Tool: "go"}
+	}
+	diff, err := utils.GitDiff(Normalize(string(want)), out, conf)
+	if err != nil {
+		return fmt.Errorf("%w: %s (failed to diff: %v)", ErrGoldenMismatch, r.Path, err)
+	}
+	fmt.Fprintln(r.stdout, diff)
+	return fmt.Errorf("%w: %s", ErrGoldenMismatch, r.Path)
+}
+
+// Normalize strips ANSI color codes, carriage returns and trailing whitespace so output compares the same on every terminal
+func Normalize(out string) string {
+	out = ansiRE.ReplaceAllString(out, "")
+	lines := strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+}
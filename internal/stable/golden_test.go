@@ -0,0 +1,33 @@
+package stable
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "out.golden")
+
+	emit := func(update bool, lines ...string) error {
+		rec, err := Record(path, update, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return rec.Finish()
+	}
+
+	if err := emit(true, "\x1b[32mcom.apple.kernel\x1b[0m  ", "com.apple.iokit.IOSurface"); err != nil {
+		t.Fatal(err)
+	}
+	if err := emit(false, "com.apple.kernel", "com.apple.iokit.IOSurface\r"); err != nil {
+		t.Errorf("expected match: %v", err)
+	}
+	if err := emit(false, "com.apple.kernel"); !errors.Is(err, ErrGoldenMismatch) {
+		t.Errorf("expected ErrGoldenMismatch, got %v", err)
+	}
+}
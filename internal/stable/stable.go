@@ -0,0 +1,20 @@
+// Package stable provides deterministic ordering and golden-file comparison for command output
+package stable
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// Keys returns the keys of a map in sorted order
+func Keys[M ~map[K]V, K cmp.Ordered, V any](m M) []K {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// SortBy sorts s (stably) by the key returned for each element
+func SortBy[S ~[]E, E any, K cmp.Ordered](s S, key func(E) K) {
+	slices.SortStableFunc(s, func(a, b E) int {
+		return cmp.Compare(key(a), key(b))
+	})
+}
@@ -99,7 +99,10 @@ func Demangle(input string) (string, error) {
 		switch ret {
 		case BADARGS:
 			return "", fmt.Errorf("error parsing mangled symbol: %v", errors.New("bad arguments (one or more arguments are NULL)"))
-		case NODYLIB:
+		case NODYLIB: // fallback to the built-in demangler
+			if out, err := DemangleNative(input); err == nil {
+				return out, nil
+			}
 			return "", fmt.Errorf("error parsing mangled symbol: %v", errors.New("libswiftDemangle.dylib not found"))
 		case NOOP:
 			return input, nil
@@ -136,7 +139,10 @@ func DemangleSimple(input string) (string, error) {
 		switch ret {
 		case BADARGS:
 			return "", fmt.Errorf("error parsing mangled symbol: %v", errors.New("bad arguments (one or more arguments are NULL)"))
-		case NODYLIB:
+		case NODYLIB: // fallback to the built-in demangler
+			if out, err := DemangleSimpleNative(input); err == nil {
+				return out, nil
+			}
 			return "", fmt.Errorf("error parsing mangled symbol: %v", errors.New("libswiftDemangle.dylib not found"))
 		case NOOP:
 			return input, nil
@@ -2,15 +2,24 @@
 
 package swift
 
+// Demangle demangles a Swift symbol with the built-in demangler (returning the input if it can't be demangled)
 func Demangle(input string) (string, error) {
-	return input, nil // this is a no-op on non-darwin platforms
+	out, err := DemangleNative(input)
+	if err != nil {
+		return input, nil
+	}
+	return out, nil
 }
 func DemangleBlob(blob string) string {
-	return blob // this is a no-op on non-darwin platforms
+	return demangleNativeBlob(blob, false)
 }
 func DemangleSimple(input string) (string, error) {
-	return input, nil // this is a no-op on non-darwin platforms
+	out, err := DemangleSimpleNative(input)
+	if err != nil {
+		return input, nil
+	}
+	return out, nil
 }
 func DemangleSimpleBlob(blob string) string {
-	return blob // this is a no-op on non-darwin platforms
+	return demangleNativeBlob(blob, true)
 }
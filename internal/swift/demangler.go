@@ -0,0 +1,1560 @@
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotMangledName is returned by the built-in demangler when the input is not a (supported) Swift mangled name
+var ErrNotMangledName = errors.New("not a Swift mangled name")
+
+// The built-in demangler is a port of the subset of swift/lib/Demangling/Demangler.cpp and NodePrinter.cpp needed
+// to demangle the symbols and type references found in Swift binaries (stdlib substitutions, nominal, bound generic,
+// function and tuple types, entities, accessors, generic signatures, metadata and witness table symbols)
+//
+// NOTE: specializations, reabstraction thunks, symbolic references and punycoded identifiers are NOT supported
+
+type nodeKind uint8
+
+const (
+	kGlobal nodeKind = iota
+	kSuffix
+	kIdentifier
+	kModule
+	kType
+	kTypeMangling
+	kEmptyList
+	kFirstElementMarker
+	kVariadicMarker
+	kLabelList
+	kNumber
+	kTypeList
+	kStructure
+	kClass
+	kEnum
+	kProtocol
+	kTypeAlias
+	kBoundGenericStructure
+	kBoundGenericClass
+	kBoundGenericEnum
+	kBoundGenericProtocol
+	kBoundGenericTypeAlias
+	kBuiltinTypeName
+	kTuple
+	kTupleElement
+	kTupleElementName
+	kFunctionType
+	kNoEscapeFunctionType
+	kAutoClosureType
+	kEscapingAutoClosureType
+	kThinFunctionType
+	kObjCBlock
+	kEscapingObjCBlock
+	kCFunctionPointer
+	kUncurriedFunctionType
+	kArgumentTuple
+	kReturnType
+	kThrowsAnnotation
+	kTypedThrowsAnnotation
+	kAsyncAnnotation
+	kConcurrentFunctionType
+	kGlobalActorFunctionType
+	kIsolatedAnyFunctionType
+	kSendingResultFunctionType
+	kTypeModifier // inout, __shared, __owned, weak, unowned, etc. (the modifier is the node's text)
+	kDynamicSelf
+	kMetatype
+	kExistentialMetatype
+	kMetatypeRepresentation
+	kProtocolList
+	kProtocolListWithClass
+	kProtocolListWithAnyObject
+	kDependentGenericParamType
+	kDependentGenericParamCount
+	kDependentGenericSignature
+	kDependentGenericType
+	kDependentMemberType
+	kDependentAssociatedTypeRef
+	kDependentGenericConformanceRequirement
+	kDependentGenericSameTypeRequirement
+	kDependentGenericLayoutRequirement
+	kOpaqueReturnType
+	kExtension
+	kLocalDeclName
+	kPrivateDeclName
+	kInfixOperator
+	kPrefixOperator
+	kPostfixOperator
+	kFunction
+	kVariable
+	kSubscript
+	kAllocator
+	kConstructor
+	kDestructor
+	kDeallocator
+	kIVarInitializer
+	kIVarDestroyer
+	kInitializer
+	kDefaultArgumentInitializer
+	kExplicitClosure
+	kImplicitClosure
+	kStatic
+	kAccessor // getter, setter, modify, etc. (the accessor is the node's text)
+	kProtocolConformance
+	kFieldOffset
+	kProtocolWitness
+	kVTableThunk
+	kLazyProtocolWitnessTable // the lazy accessor/cache variable (the description is the node's text)
+	kWitnessTableAccessor     // associated type metadata and base witness table accessors (the description is the node's text)
+	kDescription              // metadata, descriptor and witness table symbols (the description is the node's text)
+	kPartialApplyForwarder
+	kMergedFunction
+	kFunctionAttribute // @objc, @nonobjc, dynamic, etc. (the attribute is the node's text)
+)
+
+type node struct {
+	kind     nodeKind
+	text     string
+	index    int
+	children []*node
+}
+
+func newNode(kind nodeKind, children ...*node) *node {
+	for _, child := range children {
+		if child == nil {
+			return nil
+		}
+	}
+	return &node{kind: kind, children: children}
+}
+
+func textNode(kind nodeKind, text string, children ...*node) *node {
+	n := newNode(kind, children...)
+	if n != nil {
+		n.text = text
+	}
+	return n
+}
+
+func typeNode(child *node) *node {
+	return newNode(kType, child)
+}
+
+func (n *node) add(child *node) *node {
+	if n == nil || child == nil {
+		return nil
+	}
+	n.children = append(n.children, child)
+	return n
+}
+
+func (n *node) child(kind nodeKind) *node {
+	for _, c := range n.children {
+		if c.kind == kind {
+			return c
+		}
+	}
+	return nil
+}
+
+func isDeclName(k nodeKind) bool {
+	switch k {
+	case kIdentifier, kLocalDeclName, kPrivateDeclName, kInfixOperator, kPrefixOperator, kPostfixOperator:
+		return true
+	}
+	return false
+}
+
+func isContext(k nodeKind) bool {
+	switch k {
+	case kStructure, kClass, kEnum, kProtocol, kTypeAlias, kModule, kExtension,
+		kFunction, kVariable, kSubscript, kAllocator, kConstructor, kDestructor, kDeallocator,
+		kIVarInitializer, kIVarDestroyer, kInitializer, kDefaultArgumentInitializer,
+		kExplicitClosure, kImplicitClosure, kStatic, kAccessor:
+		return true
+	}
+	return false
+}
+
+func isEntity(k nodeKind) bool {
+	return k == kType || isContext(k)
+}
+
+func isAnyGeneric(k nodeKind) bool {
+	switch k {
+	case kStructure, kClass, kEnum, kProtocol, kTypeAlias, kBuiltinTypeName:
+		return true
+	}
+	return false
+}
+
+func isRequirement(k nodeKind) bool {
+	switch k {
+	case kDependentGenericConformanceRequirement, kDependentGenericSameTypeRequirement, kDependentGenericLayoutRequirement:
+		return true
+	}
+	return false
+}
+
+func isFunctionAttr(k nodeKind) bool {
+	return k == kFunctionAttribute || k == kPartialApplyForwarder || k == kMergedFunction
+}
+
+const (
+	maxRepeatCount = 2048
+	maxNumWords    = 26
+)
+
+type demangler struct {
+	text   string
+	pos    int
+	stack  []*node
+	substs []*node
+	words  []string
+}
+
+func (d *demangler) peek() byte {
+	if d.pos >= len(d.text) {
+		return 0
+	}
+	return d.text[d.pos]
+}
+
+func (d *demangler) next() byte {
+	if d.pos >= len(d.text) {
+		return 0
+	}
+	d.pos++
+	return d.text[d.pos-1]
+}
+
+func (d *demangler) nextIf(c byte) bool {
+	if d.peek() != c || d.pos >= len(d.text) {
+		return false
+	}
+	d.pos++
+	return true
+}
+
+func (d *demangler) pushBack() { d.pos-- }
+
+func (d *demangler) push(n *node) { d.stack = append(d.stack, n) }
+
+// pop pops the top of the node stack
+func (d *demangler) pop() *node {
+	if len(d.stack) == 0 {
+		return nil
+	}
+	n := d.stack[len(d.stack)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	return n
+}
+
+// popKind pops the top of the node stack if it is of the given kind
+func (d *demangler) popKind(kind nodeKind) *node {
+	return d.popIf(func(k nodeKind) bool { return k == kind })
+}
+
+func (d *demangler) popIf(pred func(nodeKind) bool) *node {
+	if len(d.stack) == 0 || !pred(d.stack[len(d.stack)-1].kind) {
+		return nil
+	}
+	return d.pop()
+}
+
+func (d *demangler) addSubst(n *node) {
+	if n != nil {
+		d.substs = append(d.substs, n)
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+
+func (d *demangler) natural() int {
+	if !isDigit(d.peek()) {
+		return -1
+	}
+	n := 0
+	for isDigit(d.peek()) {
+		n = n*10 + int(d.next()-'0')
+		if n > 1<<24 {
+			return -1
+		}
+	}
+	return n
+}
+
+// index demangles '_' (0) or NATURAL '_' (NATURAL+1)
+func (d *demangler) index() int {
+	if d.nextIf('_') {
+		return 0
+	}
+	if n := d.natural(); n >= 0 && d.nextIf('_') {
+		return n + 1
+	}
+	return -1
+}
+
+func (d *demangler) indexNode() *node {
+	if idx := d.index(); idx >= 0 {
+		return &node{kind: kNumber, index: idx}
+	}
+	return nil
+}
+
+// demangleSymbol demangles a mangled Swift symbol (or type (reference) if isType is set) into its node tree
+func demangleSymbol(mangled string, isType bool) (*node, error) {
+	text := mangled
+	if !isType {
+		var ok bool
+		for _, prefix := range mangledPrefixes {
+			if text, ok = strings.CutPrefix(mangled, prefix); ok {
+				break
+			}
+		}
+		if !ok {
+			return nil, ErrNotMangledName
+		}
+	}
+	d := &demangler{text: text}
+	for d.pos < len(d.text) {
+		n := d.operator()
+		if n == nil {
+			return nil, fmt.Errorf("failed to demangle %s at offset %d: %w", mangled, d.pos, ErrNotMangledName)
+		}
+		d.push(n)
+	}
+	if isType {
+		if len(d.stack) != 1 || d.stack[0].kind != kType {
+			return nil, fmt.Errorf("failed to demangle type %s: %w", mangled, ErrNotMangledName)
+		}
+		return d.stack[0], nil
+	}
+	global := &node{kind: kGlobal}
+	parent := global
+	for {
+		attr := d.popIf(isFunctionAttr)
+		if attr == nil {
+			break
+		}
+		parent.add(attr)
+		if attr.kind == kPartialApplyForwarder {
+			parent = attr
+		}
+	}
+	for _, n := range d.stack {
+		if n.kind == kType {
+			n = n.children[0]
+		}
+		parent.add(n)
+	}
+	if len(global.children) == 0 {
+		return nil, fmt.Errorf("failed to demangle %s: %w", mangled, ErrNotMangledName)
+	}
+	return global, nil
+}
+
+func (d *demangler) operator() *node {
+	switch c := d.next(); c {
+	case 'A':
+		return d.multiSubstitutions()
+	case 'B':
+		return d.builtinType()
+	case 'C':
+		return d.anyGenericType(kClass)
+	case 'D':
+		typ := d.popKind(kType)
+		labels := d.popFunctionParamLabels(typ)
+		mangling := &node{kind: kTypeMangling}
+		mangling.add(labels)
+		return mangling.add(typ)
+	case 'E':
+		return d.extensionContext()
+	case 'F':
+		return d.plainFunction()
+	case 'G':
+		return d.boundGenericType()
+	case 'K':
+		return &node{kind: kThrowsAnnotation}
+	case 'L':
+		return d.localIdentifier()
+	case 'M':
+		return d.metatype()
+	case 'N':
+		return textNode(kDescription, "type metadata for ", d.popKind(kType))
+	case 'O':
+		return d.anyGenericType(kEnum)
+	case 'P':
+		return d.anyGenericType(kProtocol)
+	case 'Q':
+		return d.archetype()
+	case 'R':
+		return d.genericRequirement()
+	case 'S':
+		return d.standardSubstitution()
+	case 'T':
+		return d.thunk()
+	case 'V':
+		return d.anyGenericType(kStructure)
+	case 'W':
+		return d.witness()
+	case 'X':
+		return d.specialType()
+	case 'Y':
+		return d.typeAnnotation()
+	case 'Z':
+		return newNode(kStatic, d.popIf(isEntity))
+	case 'a':
+		return d.anyGenericType(kTypeAlias)
+	case 'c':
+		return d.popFunctionType(kFunctionType)
+	case 'd':
+		return &node{kind: kVariadicMarker}
+	case 'f':
+		return d.functionEntity()
+	case 'h':
+		return typeNode(textNode(kTypeModifier, "__shared ", d.popTypeAndGetChild()))
+	case 'i':
+		return d.subscript()
+	case 'l':
+		return d.genericSignature(false)
+	case 'm':
+		return typeNode(newNode(kMetatype, d.popKind(kType)))
+	case 'n':
+		return typeNode(textNode(kTypeModifier, "__owned ", d.popTypeAndGetChild()))
+	case 'o':
+		return d.operatorIdentifier()
+	case 'p':
+		return typeNode(d.protocolList())
+	case 'q':
+		return typeNode(d.genericParamIndex())
+	case 'r':
+		return d.genericSignature(true)
+	case 's':
+		return &node{kind: kModule, text: "Swift"}
+	case 't':
+		return d.popTuple()
+	case 'u':
+		sig := d.popKind(kDependentGenericSignature)
+		return typeNode(newNode(kDependentGenericType, sig, d.popKind(kType)))
+	case 'v':
+		return d.accessor(d.entity(kVariable))
+	case 'x':
+		return typeNode(genericParam(0, 0))
+	case 'y':
+		return &node{kind: kEmptyList}
+	case 'z':
+		return typeNode(textNode(kTypeModifier, "inout ", d.popTypeAndGetChild()))
+	case '_':
+		return &node{kind: kFirstElementMarker}
+	case '.':
+		d.pushBack()
+		suffix := &node{kind: kSuffix, text: d.text[d.pos:]}
+		d.pos = len(d.text)
+		return suffix
+	default:
+		if c < 0x20 { // symbolic references
+			return nil
+		}
+		d.pushBack()
+		return d.identifier()
+	}
+}
+
+func (d *demangler) identifier() *node {
+	var hasWordSubsts bool
+	switch c := d.peek(); {
+	case !isDigit(c):
+		return nil
+	case c == '0':
+		d.next()
+		if d.peek() == '0' {
+			return nil // punycode
+		}
+		hasWordSubsts = true
+	}
+	var ident strings.Builder
+	for {
+		for hasWordSubsts && (isLower(d.peek()) || isUpper(d.peek())) {
+			c := d.next()
+			var idx int
+			if isLower(c) {
+				idx = int(c - 'a')
+			} else {
+				idx = int(c - 'A')
+				hasWordSubsts = false
+			}
+			if idx >= len(d.words) {
+				return nil
+			}
+			ident.WriteString(d.words[idx])
+		}
+		if d.nextIf('0') {
+			break
+		}
+		n := d.natural()
+		if n <= 0 || d.pos+n > len(d.text) {
+			return nil
+		}
+		slice := d.text[d.pos : d.pos+n]
+		ident.WriteString(slice)
+		wordStart := -1
+		for i := 0; i <= len(slice); i++ {
+			var c byte
+			if i < len(slice) {
+				c = slice[i]
+			}
+			if wordStart >= 0 && (c == '_' || c == 0 || (!isUpper(slice[i-1]) && isUpper(c))) {
+				if i-wordStart >= 2 && len(d.words) < maxNumWords {
+					d.words = append(d.words, slice[wordStart:i])
+				}
+				wordStart = -1
+			}
+			if wordStart < 0 && !isDigit(c) && c != '_' && c != 0 {
+				wordStart = i
+			}
+		}
+		d.pos += n
+		if !hasWordSubsts {
+			break
+		}
+	}
+	if ident.Len() == 0 {
+		return nil
+	}
+	n := &node{kind: kIdentifier, text: ident.String()}
+	d.addSubst(n)
+	return n
+}
+
+func (d *demangler) multiSubstitutions() *node {
+	repeat := -1
+	for {
+		c := d.next()
+		switch {
+		case c == 0:
+			return nil
+		case isLower(c):
+			n := d.pushMultiSubstitutions(repeat, int(c-'a'))
+			if n == nil {
+				return nil
+			}
+			d.push(n)
+			repeat = -1
+		case isUpper(c):
+			return d.pushMultiSubstitutions(repeat, int(c-'A'))
+		case c == '_':
+			if idx := repeat + 27; idx < len(d.substs) {
+				return d.substs[idx]
+			}
+			return nil
+		default:
+			d.pushBack()
+			if repeat = d.natural(); repeat < 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (d *demangler) pushMultiSubstitutions(repeat, idx int) *node {
+	if idx >= len(d.substs) || repeat > maxRepeatCount {
+		return nil
+	}
+	n := d.substs[idx]
+	for ; repeat > 1; repeat-- {
+		d.push(n)
+	}
+	return n
+}
+
+type stdType struct {
+	kind nodeKind
+	name string
+}
+
+var stdTypes = map[byte]stdType{
+	'A': {kStructure, "AutoreleasingUnsafeMutablePointer"},
+	'a': {kStructure, "Array"},
+	'b': {kStructure, "Bool"},
+	'D': {kStructure, "Dictionary"},
+	'd': {kStructure, "Double"},
+	'f': {kStructure, "Float"},
+	'h': {kStructure, "Set"},
+	'I': {kStructure, "DefaultIndices"},
+	'i': {kStructure, "Int"},
+	'J': {kStructure, "Character"},
+	'N': {kStructure, "ClosedRange"},
+	'n': {kStructure, "Range"},
+	'O': {kStructure, "ObjectIdentifier"},
+	'P': {kStructure, "UnsafePointer"},
+	'p': {kStructure, "UnsafeMutablePointer"},
+	'R': {kStructure, "UnsafeBufferPointer"},
+	'r': {kStructure, "UnsafeMutableBufferPointer"},
+	'S': {kStructure, "String"},
+	's': {kStructure, "Substring"},
+	'u': {kStructure, "UInt"},
+	'V': {kStructure, "UnsafeRawPointer"},
+	'v': {kStructure, "UnsafeMutableRawPointer"},
+	'W': {kStructure, "UnsafeRawBufferPointer"},
+	'w': {kStructure, "UnsafeMutableRawBufferPointer"},
+	'q': {kEnum, "Optional"},
+	'B': {kProtocol, "BinaryFloatingPoint"},
+	'E': {kProtocol, "Encodable"},
+	'e': {kProtocol, "Decodable"},
+	'F': {kProtocol, "FloatingPoint"},
+	'G': {kProtocol, "RandomNumberGenerator"},
+	'H': {kProtocol, "Hashable"},
+	'j': {kProtocol, "Numeric"},
+	'K': {kProtocol, "BidirectionalCollection"},
+	'k': {kProtocol, "RandomAccessCollection"},
+	'L': {kProtocol, "Comparable"},
+	'l': {kProtocol, "Collection"},
+	'M': {kProtocol, "MutableCollection"},
+	'm': {kProtocol, "RangeReplaceableCollection"},
+	'Q': {kProtocol, "Equatable"},
+	'T': {kProtocol, "Sequence"},
+	't': {kProtocol, "IteratorProtocol"},
+	'U': {kProtocol, "UnsignedInteger"},
+	'X': {kProtocol, "RangeExpression"},
+	'x': {kProtocol, "Strideable"},
+	'Y': {kProtocol, "RawRepresentable"},
+	'y': {kProtocol, "StringProtocol"},
+	'Z': {kProtocol, "SignedInteger"},
+	'z': {kProtocol, "BinaryInteger"},
+}
+
+// stdConcurrencyTypes are the second level ('Sc') standard substitutions
+var stdConcurrencyTypes = map[byte]stdType{
+	'A': {kProtocol, "Actor"},
+	'C': {kStructure, "CheckedContinuation"},
+	'c': {kStructure, "UnsafeContinuation"},
+	'E': {kStructure, "CancellationError"},
+	'e': {kStructure, "UnownedSerialExecutor"},
+	'F': {kProtocol, "Executor"},
+	'f': {kProtocol, "SerialExecutor"},
+	'G': {kStructure, "TaskGroup"},
+	'g': {kStructure, "ThrowingTaskGroup"},
+	'I': {kProtocol, "AsyncIteratorProtocol"},
+	'i': {kProtocol, "AsyncSequence"},
+	'J': {kStructure, "UnownedJob"},
+	'M': {kClass, "MainActor"},
+	'P': {kStructure, "TaskPriority"},
+	'S': {kStructure, "AsyncStream"},
+	's': {kStructure, "AsyncThrowingStream"},
+	'T': {kStructure, "Task"},
+	't': {kStructure, "UnsafeCurrentTask"},
+}
+
+func swiftType(kind nodeKind, name string) *node {
+	return typeNode(newNode(kind, &node{kind: kModule, text: "Swift"}, &node{kind: kIdentifier, text: name}))
+}
+
+func (d *demangler) standardSubstitution() *node {
+	switch c := d.next(); c {
+	case 'o':
+		return &node{kind: kModule, text: "__C"}
+	case 'C':
+		return &node{kind: kModule, text: "__C_Synthesized"}
+	case 'g':
+		opt := typeNode(newNode(kBoundGenericEnum, swiftType(kEnum, "Optional"), newNode(kTypeList, d.popKind(kType))))
+		d.addSubst(opt)
+		return opt
+	default:
+		d.pushBack()
+		repeat := d.natural()
+		if repeat > maxRepeatCount {
+			return nil
+		}
+		table := stdTypes
+		if d.nextIf('c') {
+			table = stdConcurrencyTypes
+		}
+		std, ok := table[d.next()]
+		if !ok {
+			return nil
+		}
+		n := swiftType(std.kind, std.name)
+		for ; repeat > 1; repeat-- {
+			d.push(n)
+		}
+		return n
+	}
+}
+
+func (d *demangler) builtinType() *node {
+	var name string
+	switch d.next() {
+	case 'b':
+		name = "Builtin.BridgeObject"
+	case 'B':
+		name = "Builtin.UnsafeValueBuffer"
+	case 'e':
+		name = "Builtin.Executor"
+	case 'f':
+		size := d.index() - 1
+		if size <= 0 || size > 4096 {
+			return nil
+		}
+		name = "Builtin.FPIEEE" + strconv.Itoa(size)
+	case 'i':
+		size := d.index() - 1
+		if size <= 0 || size > 4096 {
+			return nil
+		}
+		name = "Builtin.Int" + strconv.Itoa(size)
+	case 'I':
+		name = "Builtin.IntLiteral"
+	case 'O':
+		name = "Builtin.UnknownObject"
+	case 'o':
+		name = "Builtin.NativeObject"
+	case 'p':
+		name = "Builtin.RawPointer"
+	case 't':
+		name = "Builtin.SILToken"
+	case 'w':
+		name = "Builtin.Word"
+	case 'c':
+		name = "Builtin.RawUnsafeContinuation"
+	case 'D':
+		name = "Builtin.DefaultActorStorage"
+	case 'd':
+		name = "Builtin.NonDefaultDistributedActorStorage"
+	case 'j':
+		name = "Builtin.Job"
+	default:
+		return nil
+	}
+	return typeNode(&node{kind: kBuiltinTypeName, text: name})
+}
+
+// popModule pops a module (or an identifier, which is a module in a context position)
+func (d *demangler) popModule() *node {
+	if ident := d.popKind(kIdentifier); ident != nil {
+		return &node{kind: kModule, text: ident.text}
+	}
+	return d.popKind(kModule)
+}
+
+func (d *demangler) popContext() *node {
+	if mod := d.popModule(); mod != nil {
+		return mod
+	}
+	if ty := d.popKind(kType); ty != nil {
+		if len(ty.children) != 1 || !isContext(ty.children[0].kind) {
+			return nil
+		}
+		return ty.children[0]
+	}
+	return d.popIf(isContext)
+}
+
+func (d *demangler) popTypeAndGetChild() *node {
+	ty := d.popKind(kType)
+	if ty == nil || len(ty.children) != 1 {
+		return nil
+	}
+	return ty.children[0]
+}
+
+func (d *demangler) anyGenericType(kind nodeKind) *node {
+	name := d.popIf(isDeclName)
+	ctx := d.popContext()
+	ty := typeNode(newNode(kind, ctx, name))
+	d.addSubst(ty)
+	return ty
+}
+
+func (d *demangler) extensionContext() *node {
+	sig := d.popKind(kDependentGenericSignature)
+	mod := d.popModule()
+	ty := d.popTypeAndGetChild()
+	if ty == nil || !isAnyGeneric(ty.kind) {
+		return nil
+	}
+	ext := newNode(kExtension, mod, ty)
+	if sig != nil {
+		ext = ext.add(sig)
+	}
+	return ext
+}
+
+func (d *demangler) popFunctionType(kind nodeKind) *node {
+	fn := &node{kind: kind}
+	for _, k := range []nodeKind{kGlobalActorFunctionType, kIsolatedAnyFunctionType, kSendingResultFunctionType} {
+		if n := d.popKind(k); n != nil {
+			fn.add(n)
+		}
+	}
+	if n := d.popIf(func(k nodeKind) bool { return k == kThrowsAnnotation || k == kTypedThrowsAnnotation }); n != nil {
+		fn.add(n)
+	}
+	for _, k := range []nodeKind{kConcurrentFunctionType, kAsyncAnnotation} {
+		if n := d.popKind(k); n != nil {
+			fn.add(n)
+		}
+	}
+	fn = fn.add(d.popFunctionParams(kArgumentTuple))
+	fn = fn.add(d.popFunctionParams(kReturnType))
+	return typeNode(fn)
+}
+
+func (d *demangler) popFunctionParams(kind nodeKind) *node {
+	var params *node
+	if d.popKind(kEmptyList) != nil {
+		params = typeNode(&node{kind: kTuple})
+	} else {
+		params = d.popKind(kType)
+	}
+	return newNode(kind, params)
+}
+
+func (d *demangler) popFunctionParamLabels(typ *node) *node {
+	if d.popKind(kEmptyList) != nil {
+		return &node{kind: kLabelList}
+	}
+	if typ == nil || typ.kind != kType {
+		return nil
+	}
+	fn := typ.children[0]
+	if fn.kind == kDependentGenericType {
+		fn = fn.children[1].children[0]
+	}
+	if fn.kind != kFunctionType && fn.kind != kNoEscapeFunctionType {
+		return nil
+	}
+	args := fn.child(kArgumentTuple)
+	if args == nil {
+		return nil
+	}
+	params := args.children[0].children[0]
+	numParams := 1
+	if params.kind == kTuple {
+		numParams = len(params.children)
+	}
+	if numParams == 0 {
+		return nil
+	}
+	labels := &node{kind: kLabelList}
+	hasLabels := false
+	for range numParams {
+		label := d.pop()
+		if label == nil || (label.kind != kIdentifier && label.kind != kFirstElementMarker) {
+			return nil
+		}
+		labels.add(label)
+		hasLabels = hasLabels || label.kind == kIdentifier
+	}
+	if !hasLabels {
+		return &node{kind: kLabelList}
+	}
+	reverse(labels.children)
+	return labels
+}
+
+func reverse(nodes []*node) {
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+}
+
+func (d *demangler) popTuple() *node {
+	tuple := &node{kind: kTuple}
+	if d.popKind(kEmptyList) == nil {
+		for first := false; !first; {
+			first = d.popKind(kFirstElementMarker) != nil
+			elem := &node{kind: kTupleElement}
+			if v := d.popKind(kVariadicMarker); v != nil {
+				elem.add(v)
+			}
+			if ident := d.popKind(kIdentifier); ident != nil {
+				elem.add(&node{kind: kTupleElementName, text: ident.text})
+			}
+			ty := d.popKind(kType)
+			if ty == nil {
+				return nil
+			}
+			tuple.add(elem.add(ty))
+		}
+		reverse(tuple.children)
+	}
+	return typeNode(tuple)
+}
+
+func (d *demangler) plainFunction() *node {
+	sig := d.popKind(kDependentGenericSignature)
+	typ := d.popFunctionType(kFunctionType)
+	labels := d.popFunctionParamLabels(typ)
+	if sig != nil {
+		typ = typeNode(newNode(kDependentGenericType, sig, typ))
+	}
+	name := d.popIf(isDeclName)
+	ctx := d.popContext()
+	if labels != nil {
+		return newNode(kFunction, ctx, name, labels, typ)
+	}
+	return newNode(kFunction, ctx, name, typ)
+}
+
+func (d *demangler) entity(kind nodeKind) *node {
+	typ := d.popKind(kType)
+	labels := d.popFunctionParamLabels(typ)
+	name := d.popIf(isDeclName)
+	ctx := d.popContext()
+	if labels != nil {
+		return newNode(kind, ctx, name, labels, typ)
+	}
+	return newNode(kind, ctx, name, typ)
+}
+
+var accessors = map[byte]string{
+	'm': "materializeForSet",
+	's': "setter",
+	'g': "getter",
+	'G': "globalGetter",
+	'w': "willset",
+	'W': "didset",
+	'r': "read",
+	'M': "modify",
+	'i': "init",
+}
+
+func (d *demangler) accessor(storage *node) *node {
+	c := d.next()
+	if c == 'p' { // the variable/subscript itself
+		return storage
+	}
+	name, ok := accessors[c]
+	if !ok {
+		return nil
+	}
+	return textNode(kAccessor, name, storage)
+}
+
+func (d *demangler) subscript() *node {
+	private := d.popKind(kPrivateDeclName)
+	typ := d.popKind(kType)
+	labels := d.popFunctionParamLabels(typ)
+	sub := newNode(kSubscript, d.popContext())
+	sub.add(labels)
+	sub = sub.add(typ)
+	sub.add(private)
+	if sub == nil {
+		return nil
+	}
+	return d.accessor(sub)
+}
+
+func (d *demangler) functionEntity() *node {
+	const (
+		none = iota
+		typeAndMaybePrivateName
+		typeAndIndex
+		index
+	)
+	var args int
+	var kind nodeKind
+	switch d.next() {
+	case 'D':
+		kind = kDeallocator
+	case 'd':
+		kind = kDestructor
+	case 'E':
+		kind = kIVarDestroyer
+	case 'e':
+		kind = kIVarInitializer
+	case 'i':
+		kind = kInitializer
+	case 'C':
+		args, kind = typeAndMaybePrivateName, kAllocator
+	case 'c':
+		args, kind = typeAndMaybePrivateName, kConstructor
+	case 'U':
+		args, kind = typeAndIndex, kExplicitClosure
+	case 'u':
+		args, kind = typeAndIndex, kImplicitClosure
+	case 'A':
+		args, kind = index, kDefaultArgumentInitializer
+	default:
+		return nil
+	}
+	var nameOrIndex, paramType, labels *node
+	switch args {
+	case typeAndMaybePrivateName:
+		nameOrIndex = d.popKind(kPrivateDeclName)
+		paramType = d.popKind(kType)
+		labels = d.popFunctionParamLabels(paramType)
+	case typeAndIndex:
+		nameOrIndex = d.indexNode()
+		paramType = d.popKind(kType)
+	case index:
+		nameOrIndex = d.indexNode()
+	}
+	ent := newNode(kind, d.popContext())
+	switch args {
+	case index:
+		ent = ent.add(nameOrIndex)
+	case typeAndMaybePrivateName:
+		ent.add(labels)
+		ent = ent.add(paramType)
+		ent.add(nameOrIndex)
+	case typeAndIndex:
+		ent = ent.add(nameOrIndex)
+		ent = ent.add(paramType)
+	}
+	return ent
+}
+
+func (d *demangler) localIdentifier() *node {
+	if d.nextIf('L') {
+		discriminator := d.popKind(kIdentifier)
+		return newNode(kPrivateDeclName, discriminator, d.popIf(isDeclName))
+	}
+	if d.nextIf('l') {
+		return newNode(kPrivateDeclName, d.popKind(kIdentifier))
+	}
+	discriminator := d.indexNode()
+	return newNode(kLocalDeclName, discriminator, d.popIf(isDeclName))
+}
+
+// operator characters of the lowercase letters of an operator identifier
+const opChars = "& @/= >    <*!|+?%-~   ^ ."
+
+func (d *demangler) operatorIdentifier() *node {
+	ident := d.popKind(kIdentifier)
+	if ident == nil {
+		return nil
+	}
+	var op strings.Builder
+	for i := 0; i < len(ident.text); i++ {
+		c := ident.text[i]
+		if c >= 0x80 {
+			op.WriteByte(c)
+			continue
+		}
+		if !isLower(c) || opChars[c-'a'] == ' ' {
+			return nil
+		}
+		op.WriteByte(opChars[c-'a'])
+	}
+	switch d.next() {
+	case 'i':
+		return &node{kind: kInfixOperator, text: op.String()}
+	case 'p':
+		return &node{kind: kPrefixOperator, text: op.String()}
+	case 'P':
+		return &node{kind: kPostfixOperator, text: op.String()}
+	}
+	return nil
+}
+
+func (d *demangler) boundGenericType() *node {
+	var typeLists []*node
+	for {
+		list := &node{kind: kTypeList}
+		typeLists = append(typeLists, list)
+		for ty := d.popKind(kType); ty != nil; ty = d.popKind(kType) {
+			list.add(ty)
+		}
+		reverse(list.children)
+		if d.popKind(kEmptyList) != nil {
+			break
+		}
+		if d.popKind(kFirstElementMarker) == nil {
+			return nil
+		}
+	}
+	nominal := d.popTypeAndGetChild()
+	if nominal == nil || !isAnyGeneric(nominal.kind) {
+		return nil
+	}
+	ty := typeNode(boundGenericArgs(nominal, typeLists, 0))
+	d.addSubst(ty)
+	return ty
+}
+
+func consumesGenericArgs(n *node) bool {
+	switch n.kind {
+	case kVariable, kSubscript, kImplicitClosure, kExplicitClosure, kDefaultArgumentInitializer, kInitializer, kStatic:
+		return false
+	}
+	return true
+}
+
+func boundGenericArgs(nominal *node, typeLists []*node, idx int) *node {
+	if nominal == nil || idx >= len(typeLists) || len(nominal.children) == 0 {
+		return nil
+	}
+	ctx := nominal.children[0]
+	consumes := consumesGenericArgs(nominal)
+	args := typeLists[idx]
+	if consumes {
+		idx++
+	}
+	if idx < len(typeLists) {
+		var parent *node
+		if ctx.kind == kExtension {
+			parent = newNode(kExtension, ctx.children[0], boundGenericArgs(ctx.children[1], typeLists, idx))
+			if len(ctx.children) == 3 {
+				parent = parent.add(ctx.children[2])
+			}
+		} else {
+			parent = boundGenericArgs(ctx, typeLists, idx)
+		}
+		rebuilt := newNode(nominal.kind, parent)
+		if rebuilt == nil {
+			return nil
+		}
+		rebuilt.text = nominal.text
+		rebuilt.children = append(rebuilt.children, nominal.children[1:]...)
+		nominal = rebuilt
+	}
+	if !consumes || len(args.children) == 0 {
+		return nominal
+	}
+	var kind nodeKind
+	switch nominal.kind {
+	case kClass:
+		kind = kBoundGenericClass
+	case kStructure:
+		kind = kBoundGenericStructure
+	case kEnum:
+		kind = kBoundGenericEnum
+	case kProtocol:
+		kind = kBoundGenericProtocol
+	case kTypeAlias:
+		kind = kBoundGenericTypeAlias
+	default:
+		return nil
+	}
+	return newNode(kind, typeNode(nominal), args)
+}
+
+func (d *demangler) popProtocol() *node {
+	if ty := d.popKind(kType); ty != nil {
+		if len(ty.children) < 1 || ty.children[0].kind != kProtocol {
+			return nil
+		}
+		return ty
+	}
+	name := d.popIf(isDeclName)
+	ctx := d.popContext()
+	return typeNode(newNode(kProtocol, ctx, name))
+}
+
+func (d *demangler) protocolList() *node {
+	types := &node{kind: kTypeList}
+	list := newNode(kProtocolList, types)
+	if d.popKind(kEmptyList) == nil {
+		for first := false; !first; {
+			first = d.popKind(kFirstElementMarker) != nil
+			proto := d.popProtocol()
+			if proto == nil {
+				return nil
+			}
+			types.add(proto)
+		}
+		reverse(types.children)
+	}
+	return list
+}
+
+func (d *demangler) popProtocolConformance() *node {
+	sig := d.popKind(kDependentGenericSignature)
+	mod := d.popModule()
+	proto := d.popProtocol()
+	typ := d.popKind(kType)
+	var ident *node
+	if typ == nil {
+		ident = d.popKind(kIdentifier)
+		typ = d.popKind(kType)
+	}
+	if sig != nil {
+		typ = typeNode(newNode(kDependentGenericType, sig, typ))
+	}
+	conf := newNode(kProtocolConformance, typ, proto, mod)
+	if ident != nil {
+		conf = conf.add(ident)
+	}
+	return conf
+}
+
+func genericParam(depth, index int) *node {
+	var name []byte
+	for {
+		name = append(name, byte('A'+index%26))
+		if index /= 26; index == 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		name = strconv.AppendInt(name, int64(depth), 10)
+	}
+	return &node{kind: kDependentGenericParamType, text: string(name)}
+}
+
+func (d *demangler) genericParamIndex() *node {
+	if d.nextIf('d') {
+		depth := d.index() + 1
+		index := d.index()
+		if depth <= 0 || index < 0 {
+			return nil
+		}
+		return genericParam(depth, index)
+	}
+	if d.nextIf('z') {
+		return genericParam(0, 0)
+	}
+	index := d.index()
+	if index < 0 {
+		return nil
+	}
+	return genericParam(0, index+1)
+}
+
+func (d *demangler) genericSignature(hasParamCounts bool) *node {
+	sig := &node{kind: kDependentGenericSignature}
+	if hasParamCounts {
+		for !d.nextIf('l') {
+			count := 0
+			if !d.nextIf('z') {
+				if count = d.index() + 1; count <= 0 {
+					return nil
+				}
+			}
+			sig.add(&node{kind: kDependentGenericParamCount, index: count})
+		}
+	} else {
+		sig.add(&node{kind: kDependentGenericParamCount, index: 1})
+	}
+	numCounts := len(sig.children)
+	for req := d.popIf(isRequirement); req != nil; req = d.popIf(isRequirement) {
+		sig.add(req)
+	}
+	reverse(sig.children[numCounts:])
+	return sig
+}
+
+func (d *demangler) popAssocTypeName() *node {
+	proto := d.popKind(kType)
+	if proto != nil && proto.children[0].kind != kProtocol {
+		return nil
+	}
+	ident := d.popKind(kIdentifier)
+	if ident == nil {
+		return nil
+	}
+	return &node{kind: kDependentAssociatedTypeRef, text: ident.text}
+}
+
+func (d *demangler) associatedTypeSimple(param *node) *node {
+	name := d.popAssocTypeName()
+	var base *node
+	if param != nil {
+		base = typeNode(param)
+	} else {
+		base = d.popKind(kType)
+	}
+	return typeNode(newNode(kDependentMemberType, base, name))
+}
+
+func (d *demangler) archetype() *node {
+	switch d.next() {
+	case 'y':
+		ty := d.associatedTypeSimple(d.genericParamIndex())
+		d.addSubst(ty)
+		return ty
+	case 'z':
+		ty := d.associatedTypeSimple(genericParam(0, 0))
+		d.addSubst(ty)
+		return ty
+	case 'r':
+		return typeNode(&node{kind: kOpaqueReturnType})
+	}
+	return nil
+}
+
+var layouts = map[byte]string{
+	'U': "_UnknownLayout",
+	'R': "_RefCountedObject",
+	'N': "_NativeRefCountedObject",
+	'C': "AnyObject",
+	'D': "_NativeClass",
+	'T': "_Trivial",
+}
+
+func (d *demangler) genericRequirement() *node {
+	const (
+		generic = iota
+		assoc
+		substitution
+	)
+	const (
+		protocol = iota
+		baseClass
+		sameType
+		layout
+	)
+	var typeKind, constraint int
+	switch d.next() {
+	case 'c':
+		constraint, typeKind = baseClass, assoc
+	case 'b':
+		constraint, typeKind = baseClass, generic
+	case 'B':
+		constraint, typeKind = baseClass, substitution
+	case 't':
+		constraint, typeKind = sameType, assoc
+	case 's':
+		constraint, typeKind = sameType, generic
+	case 'S':
+		constraint, typeKind = sameType, substitution
+	case 'm':
+		constraint, typeKind = layout, assoc
+	case 'l':
+		constraint, typeKind = layout, generic
+	case 'L':
+		constraint, typeKind = layout, substitution
+	case 'p':
+		constraint, typeKind = protocol, assoc
+	case 'Q':
+		constraint, typeKind = protocol, substitution
+	case 'v', 'V', 'h', 'C', 'T', 'M', 'P', 'I': // packs, values, inverses and compound associated types
+		return nil
+	default:
+		constraint, typeKind = protocol, generic
+		d.pushBack()
+	}
+	var ty *node
+	switch typeKind {
+	case generic:
+		ty = typeNode(d.genericParamIndex())
+	case assoc:
+		ty = d.associatedTypeSimple(d.genericParamIndex())
+		d.addSubst(ty)
+	case substitution:
+		ty = d.popKind(kType)
+	}
+	switch constraint {
+	case protocol:
+		return newNode(kDependentGenericConformanceRequirement, ty, d.popProtocol())
+	case baseClass:
+		return newNode(kDependentGenericConformanceRequirement, ty, d.popKind(kType))
+	case sameType:
+		return newNode(kDependentGenericSameTypeRequirement, ty, d.popKind(kType))
+	default:
+		name, ok := layouts[d.next()]
+		if !ok {
+			return nil
+		}
+		return newNode(kDependentGenericLayoutRequirement, ty, &node{kind: kIdentifier, text: name})
+	}
+}
+
+func (d *demangler) metatype() *node {
+	popType := func(desc string) *node {
+		return textNode(kDescription, desc, d.popKind(kType))
+	}
+	switch d.next() {
+	case 'a':
+		return popType("type metadata accessor for ")
+	case 'B':
+		return popType("reflection metadata builtin descriptor ")
+	case 'c':
+		return textNode(kDescription, "protocol conformance descriptor for ", d.popProtocolConformance())
+	case 'D':
+		return popType("demangling cache variable for type metadata for ")
+	case 'F':
+		return popType("reflection metadata field descriptor ")
+	case 'f':
+		return popType("full type metadata for ")
+	case 'i':
+		return popType("type metadata instantiation function for ")
+	case 'I':
+		return popType("type metadata instantiation cache for ")
+	case 'L':
+		return popType("lazy cache variable for type metadata for ")
+	case 'l':
+		return popType("type metadata singleton initialization cache for ")
+	case 'm':
+		return popType("metaclass for ")
+	case 'n':
+		return popType("nominal type descriptor for ")
+	case 'o':
+		return popType("class metadata base offset for ")
+	case 'p':
+		return textNode(kDescription, "protocol descriptor for ", d.popProtocol())
+	case 'r':
+		return popType("type metadata completion function for ")
+	case 'S':
+		return textNode(kDescription, "protocol self-conformance descriptor for ", d.popProtocol())
+	case 'U':
+		return popType("ObjC metadata update function for ")
+	case 'u':
+		return popType("method lookup function for ")
+	case 'V':
+		return textNode(kDescription, "property descriptor for ", d.popIf(isEntity))
+	}
+	return nil
+}
+
+func (d *demangler) witness() *node {
+	switch d.next() {
+	case 'V':
+		return textNode(kDescription, "value witness table for ", d.popKind(kType))
+	case 'v':
+		directness := "indirect "
+		if d.next() == 'd' {
+			directness = "direct "
+		}
+		return textNode(kFieldOffset, directness, d.popIf(isEntity))
+	case 'S':
+		return textNode(kDescription, "protocol self-conformance witness table for ", d.popProtocol())
+	case 'P':
+		return textNode(kDescription, "protocol witness table for ", d.popProtocolConformance())
+	case 'p':
+		return textNode(kDescription, "protocol witness table pattern for ", d.popProtocolConformance())
+	case 'G':
+		return textNode(kDescription, "generic protocol witness table for ", d.popProtocolConformance())
+	case 'I':
+		return textNode(kDescription, "instantiation function for generic protocol witness table for ", d.popProtocolConformance())
+	case 'r':
+		return textNode(kDescription, "resilient protocol witness table for ", d.popProtocolConformance())
+	case 'a':
+		return textNode(kDescription, "protocol witness table accessor for ", d.popProtocolConformance())
+	case 'l':
+		conf := d.popProtocolConformance()
+		return textNode(kLazyProtocolWitnessTable, "lazy protocol witness table accessor for type ", d.popKind(kType), conf)
+	case 'L':
+		conf := d.popProtocolConformance()
+		return textNode(kLazyProtocolWitnessTable, "lazy protocol witness table cache variable for type ", d.popKind(kType), conf)
+	case 't':
+		name := d.popIf(isDeclName)
+		return textNode(kWitnessTableAccessor, "associated type metadata accessor for ", d.popProtocolConformance(), name)
+	case 'b':
+		proto := d.popKind(kType)
+		return textNode(kWitnessTableAccessor, "base witness table accessor for ", d.popProtocolConformance(), proto)
+	}
+	return nil
+}
+
+func (d *demangler) thunk() *node {
+	switch d.next() {
+	case 'A':
+		return &node{kind: kPartialApplyForwarder}
+	case 'a':
+		return &node{kind: kPartialApplyForwarder, text: "@objc "}
+	case 'O':
+		return &node{kind: kFunctionAttribute, text: "@nonobjc "}
+	case 'o':
+		return &node{kind: kFunctionAttribute, text: "@objc "}
+	case 'D':
+		return &node{kind: kFunctionAttribute, text: "dynamic "}
+	case 'd':
+		return &node{kind: kFunctionAttribute, text: "super "}
+	case 'E':
+		return &node{kind: kFunctionAttribute, text: "distributed thunk "}
+	case 'u':
+		return &node{kind: kFunctionAttribute, text: "async function pointer to "}
+	case 'm':
+		return &node{kind: kMergedFunction}
+	case 'V':
+		base := d.popIf(isEntity)
+		return newNode(kVTableThunk, d.popIf(isEntity), base)
+	case 'W':
+		ent := d.popIf(isEntity)
+		return newNode(kProtocolWitness, d.popProtocolConformance(), ent)
+	case 'S':
+		return textNode(kDescription, "protocol self-conformance witness for ", d.popIf(isEntity))
+	case 'j':
+		return textNode(kDescription, "dispatch thunk of ", d.popIf(isEntity))
+	case 'q':
+		return textNode(kDescription, "method descriptor for ", d.popIf(isEntity))
+	case 'c':
+		return textNode(kDescription, "curry thunk of ", d.popIf(isEntity))
+	}
+	return nil
+}
+
+func (d *demangler) specialType() *node {
+	switch d.next() {
+	case 'E':
+		return d.popFunctionType(kNoEscapeFunctionType)
+	case 'A':
+		return d.popFunctionType(kEscapingAutoClosureType)
+	case 'f':
+		return d.popFunctionType(kThinFunctionType)
+	case 'K':
+		return d.popFunctionType(kAutoClosureType)
+	case 'U':
+		return d.popFunctionType(kUncurriedFunctionType)
+	case 'L':
+		return d.popFunctionType(kEscapingObjCBlock)
+	case 'B':
+		return d.popFunctionType(kObjCBlock)
+	case 'C':
+		return d.popFunctionType(kCFunctionPointer)
+	case 'o':
+		return typeNode(textNode(kTypeModifier, "unowned ", d.popKind(kType)))
+	case 'u':
+		return typeNode(textNode(kTypeModifier, "unowned(unsafe) ", d.popKind(kType)))
+	case 'w':
+		return typeNode(textNode(kTypeModifier, "weak ", d.popKind(kType)))
+	case 'D':
+		return typeNode(newNode(kDynamicSelf, d.popKind(kType)))
+	case 'M', 'm':
+		kind := kMetatype
+		if d.text[d.pos-1] == 'm' {
+			kind = kExistentialMetatype
+		}
+		var repr string
+		switch d.next() {
+		case 't':
+			repr = "@thin"
+		case 'T':
+			repr = "@thick"
+		case 'o':
+			repr = "@objc_metatype"
+		default:
+			return nil
+		}
+		return typeNode(newNode(kind, &node{kind: kMetatypeRepresentation, text: repr}, d.popKind(kType)))
+	case 'p':
+		return typeNode(newNode(kExistentialMetatype, d.popKind(kType)))
+	case 'c':
+		super := d.popKind(kType)
+		return typeNode(newNode(kProtocolListWithClass, d.protocolList(), super))
+	case 'l':
+		return typeNode(newNode(kProtocolListWithAnyObject, d.protocolList()))
+	}
+	return nil
+}
+
+func (d *demangler) typeAnnotation() *node {
+	switch d.next() {
+	case 'a':
+		return &node{kind: kAsyncAnnotation}
+	case 'A':
+		return &node{kind: kIsolatedAnyFunctionType}
+	case 'b':
+		return &node{kind: kConcurrentFunctionType}
+	case 'c':
+		return newNode(kGlobalActorFunctionType, d.popTypeAndGetChild())
+	case 'i':
+		return typeNode(textNode(kTypeModifier, "isolated ", d.popTypeAndGetChild()))
+	case 'K':
+		return newNode(kTypedThrowsAnnotation, d.popTypeAndGetChild())
+	case 't':
+		return typeNode(textNode(kTypeModifier, "_const ", d.popTypeAndGetChild()))
+	case 'T':
+		return &node{kind: kSendingResultFunctionType}
+	case 'u':
+		return typeNode(textNode(kTypeModifier, "sending ", d.popTypeAndGetChild()))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package swift
+
+import (
+	"testing"
+)
+
+func TestDemangleNative(t *testing.T) {
+	tests := []struct {
+		input      string
+		want       string
+		wantSimple string
+	}{
+		{"$s4main3fooyyF", "main.foo() -> ()", "foo()"},
+		{"$s4main3addyS2i_SitF", "main.add(Swift.Int, Swift.Int) -> Swift.Int", "add(_:_:)"},
+		{"$s4main3foo1xySi_tF", "main.foo(x: Swift.Int) -> ()", "foo(x:)"},
+		{"$s4main3barSiyYaKF", "main.bar() async throws -> Swift.Int", "bar()"},
+		{"$s4main3FooV1x1yACSi_SStcfC", "main.Foo.__allocating_init(x: Swift.Int, y: Swift.String) -> main.Foo", "Foo.__allocating_init(x:y:)"},
+		{"$s4main3FooV3barSivg", "main.Foo.bar.getter : Swift.Int", "Foo.bar.getter"},
+		{"$s4main3FooVySiSicig", "main.Foo.subscript.getter : (Swift.Int) -> Swift.Int", "Foo.subscript.getter"},
+		{"$s4main3FooC3baryySSSgFTo", "@objc main.Foo.bar(Swift.Optional<Swift.String>) -> ()", "@objc Foo.bar(_:)"},
+		{"$s4main3FooC3baryyFyycfU_", "closure #1 () -> () in main.Foo.bar() -> ()", "closure #1 in Foo.bar()"},
+		{"$s4main3fooyyxAA1PRzlF", "main.foo<A where A: main.P>(A) -> ()", "foo(_:)"},
+		{"$s4main3FooV2eeoiySbAC_ACtFZ", "static main.Foo.== infix(main.Foo, main.Foo) -> Swift.Bool", "static Foo.== infix(_:_:)"},
+		{"$s4main3FooV5value33_ABCDEF0123456789ABCDEF0123456789LLSivg", "main.Foo.(value in _ABCDEF0123456789ABCDEF0123456789).getter : Swift.Int", "Foo.value.getter"},
+		{"$s4main6TillerC10bananaBowlSDySSSayAA6BananaVGGvg", "main.Tiller.bananaBowl.getter : Swift.Dictionary<Swift.String, Swift.Array<main.Banana>>", "Tiller.bananaBowl.getter"},
+		{"$s4main3FooVAA1PAAMc", "protocol conformance descriptor for main.Foo : main.P in main", "protocol conformance descriptor for Foo"},
+		{"$s4main3FooVAA1PA2aDP3baryyFTW", "protocol witness for main.P.bar() -> () in conformance main.Foo : main.P in main", "protocol witness for P.bar() in conformance Foo"},
+		{"$s4main3FooC1xSivgTj", "dispatch thunk of main.Foo.x.getter : Swift.Int", "dispatch thunk of Foo.x.getter"},
+		{"$sSo8NSObjectCML", "lazy cache variable for type metadata for __C.NSObject", "lazy cache variable for type metadata for NSObject"},
+		{"$sSiSQsWP", "protocol witness table for Swift.Int : Swift.Equatable in Swift", "protocol witness table for Int"},
+		{"$sSaySSGD", "Swift.Array<Swift.String>", "[String]"},
+		{"_TtC9BlastDoor12EncoderUtils", "BlastDoor.EncoderUtils", "EncoderUtils"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := DemangleNative(tt.input)
+			if err != nil {
+				t.Fatalf("DemangleNative() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DemangleNative() = %q, want %q", got, tt.want)
+			}
+			if got, _ := DemangleSimpleNative(tt.input); got != tt.wantSimple {
+				t.Errorf("DemangleSimpleNative() = %q, want %q", got, tt.wantSimple)
+			}
+		})
+	}
+	for _, input := range []string{"_main", "$s4main3FooVN4", "$s4main9"} {
+		if got, err := DemangleNative(input); err == nil {
+			t.Errorf("DemangleNative(%q) = %q, want error", input, got)
+		}
+	}
+}
+
+func TestDemangleType(t *testing.T) {
+	tests := map[string]string{
+		"Si":           "Swift.Int",
+		"SiSg":         "Swift.Optional<Swift.Int>",
+		"SDySSypG":     "Swift.Dictionary<Swift.String, Any>",
+		"So8NSObjectC": "__C.NSObject",
+		"yXl":          "Swift.AnyObject",
+	}
+	for input, want := range tests {
+		if got, err := DemangleType(input); err != nil || got != want {
+			t.Errorf("DemangleType(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
+
+func TestDemangleNativeBlob(t *testing.T) {
+	got := demangleNativeBlob("0x1000: _$s4main3fooyyF (stub)", false)
+	if want := "0x1000: main.foo() -> () (stub)"; got != want {
+		t.Errorf("demangleNativeBlob() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package swift
+
+import (
+	"regexp"
+	"strings"
+)
+
+var mangledPrefixes = []string{"_$s", "$s", "_$S", "$S"}
+
+// mangledWords matches the Swift mangled symbols in a blob of text
+var mangledWords = regexp.MustCompile(`_?\$[sS]\w+|_Tt\w+`)
+
+// IsMangled returns true if the name looks like a Swift mangled symbol
+func IsMangled(name string) bool {
+	for _, prefix := range mangledPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "_Tt")
+}
+
+// DemangleNative demangles a Swift symbol with the built-in demangler
+func DemangleNative(name string) (string, error) {
+	return demangleNative(name, false)
+}
+
+// DemangleSimpleNative demangles a Swift symbol with the built-in demangler into its simplified form
+func DemangleSimpleNative(name string) (string, error) {
+	return demangleNative(name, true)
+}
+
+// DemangleType demangles a Swift mangled type name (e.g. a field record's type) with the built-in demangler
+func DemangleType(mangled string) (string, error) {
+	root, err := demangleSymbol(strings.TrimPrefix(mangled, "$s"), true)
+	if err != nil {
+		return "", err
+	}
+	p := &printer{}
+	p.print(root, false)
+	return p.String(), nil
+}
+
+func demangleNative(name string, simple bool) (string, error) {
+	if strings.HasPrefix(name, "_Tt") {
+		return demangleOldTypeName(name, simple)
+	}
+	root, err := demangleSymbol(name, false)
+	if err != nil {
+		return "", err
+	}
+	p := &printer{simple: simple}
+	p.print(root, false)
+	return p.String(), nil
+}
+
+// demangleOldTypeName demangles the (Swift 3 style) `_Tt` runtime names of Swift classes and protocols (e.g. _TtC9BlastDoor12EncoderUtils)
+func demangleOldTypeName(name string, simple bool) (string, error) {
+	d := &demangler{text: strings.TrimPrefix(name, "_Tt")}
+	var kinds []byte
+	for strings.IndexByte("CVOP", d.peek()) >= 0 && d.pos < len(d.text) {
+		kinds = append(kinds, d.next())
+	}
+	if len(kinds) == 0 || (kinds[len(kinds)-1] == 'P' && !strings.HasSuffix(d.text, "_")) {
+		return "", ErrNotMangledName
+	}
+	var parts []string
+	if d.nextIf('s') {
+		parts = append(parts, "Swift")
+	}
+	for len(parts) < len(kinds)+1 {
+		n := d.natural()
+		if n <= 0 || d.pos+n > len(d.text) {
+			return "", ErrNotMangledName
+		}
+		parts = append(parts, d.text[d.pos:d.pos+n])
+		d.pos += n
+	}
+	if d.pos != len(d.text) && d.text[d.pos:] != "_" {
+		return "", ErrNotMangledName
+	}
+	if simple {
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "."), nil
+}
+
+func demangleNativeBlob(blob string, simple bool) string {
+	return mangledWords.ReplaceAllStringFunc(blob, func(s string) string {
+		out, err := demangleNative(s, simple)
+		if err != nil {
+			return s
+		}
+		return out
+	})
+}
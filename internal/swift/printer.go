@@ -0,0 +1,625 @@
+package swift
+
+import (
+	"strconv"
+	"strings"
+)
+
+type typePrinting int
+
+const (
+	noType typePrinting = iota
+	withColon
+	functionStyle
+)
+
+// printer prints a demangled node tree the way swift-demangle does (or like `swift-demangle --simplified` if simple is set)
+type printer struct {
+	strings.Builder
+	simple bool
+}
+
+func (p *printer) printChildren(n *node, sep string) {
+	for i, c := range n.children {
+		if i > 0 {
+			p.WriteString(sep)
+		}
+		p.print(c, false)
+	}
+}
+
+func (p *printer) printContext(ctx *node) bool {
+	if ctx.kind == kModule && ctx.text == "__C_Synthesized" {
+		return false
+	}
+	return true
+}
+
+func isSimpleType(n *node) bool {
+	switch n.kind {
+	case kType:
+		return isSimpleType(n.children[0])
+	case kStructure, kClass, kEnum, kProtocol, kTypeAlias, kModule,
+		kBoundGenericStructure, kBoundGenericClass, kBoundGenericEnum, kBoundGenericProtocol, kBoundGenericTypeAlias,
+		kBuiltinTypeName, kTuple, kTupleElementName, kTypeList, kLabelList, kDynamicSelf, kMetatype, kExistentialMetatype,
+		kMetatypeRepresentation, kDependentGenericType, kDependentMemberType, kDependentGenericParamType, kReturnType:
+		return true
+	case kProtocolList:
+		return len(n.children[0].children) <= 1
+	case kProtocolListWithAnyObject:
+		return len(n.children[0].children[0].children) == 0
+	}
+	return false
+}
+
+func isExistentialType(n *node) bool {
+	switch n.kind {
+	case kExistentialMetatype, kProtocolList, kProtocolListWithClass, kProtocolListWithAnyObject:
+		return true
+	}
+	return false
+}
+
+func needSpaceBeforeType(n *node) bool {
+	switch n.kind {
+	case kType:
+		return needSpaceBeforeType(n.children[0])
+	case kFunctionType, kNoEscapeFunctionType, kUncurriedFunctionType, kDependentGenericType:
+		return false
+	}
+	return true
+}
+
+func (p *printer) printWithParens(n *node) {
+	if isSimpleType(n) {
+		p.print(n, false)
+		return
+	}
+	p.WriteByte('(')
+	p.print(n, false)
+	p.WriteByte(')')
+}
+
+// print prints the node and returns the context of an entity that could not be printed as a prefix context
+func (p *printer) print(n *node, asPrefixContext bool) *node {
+	switch n.kind {
+	case kGlobal, kTypeMangling, kType, kTypeList:
+		p.printChildren(n, "")
+	case kSuffix:
+		if !p.simple {
+			p.WriteString(" with unmangled suffix " + strconv.Quote(n.text))
+		}
+	case kModule:
+		if !p.simple {
+			p.WriteString(n.text)
+		}
+	case kIdentifier, kBuiltinTypeName, kDependentGenericParamType, kDependentAssociatedTypeRef, kMetatypeRepresentation:
+		p.WriteString(n.text)
+	case kInfixOperator:
+		p.WriteString(n.text + " infix")
+	case kPrefixOperator:
+		p.WriteString(n.text + " prefix")
+	case kPostfixOperator:
+		p.WriteString(n.text + " postfix")
+	case kLocalDeclName:
+		p.print(n.children[1], false)
+		p.WriteString(" #" + strconv.Itoa(n.children[0].index+1))
+	case kPrivateDeclName:
+		if len(n.children) == 1 {
+			if !p.simple {
+				p.WriteString("(in " + n.children[0].text + ")")
+			}
+			break
+		}
+		if !p.simple {
+			p.WriteByte('(')
+		}
+		p.print(n.children[1], false)
+		if !p.simple {
+			p.WriteString(" in " + n.children[0].text + ")")
+		}
+	case kStructure, kClass, kEnum, kProtocol, kTypeAlias:
+		return p.printEntity(n, asPrefixContext, noType, true, "", -1, "")
+	case kFunction:
+		return p.printEntity(n, asPrefixContext, functionStyle, true, "", -1, "")
+	case kVariable:
+		return p.printEntity(n, asPrefixContext, withColon, true, "", -1, "")
+	case kSubscript:
+		return p.printEntity(n, asPrefixContext, functionStyle, false, "", -1, "subscript")
+	case kAllocator:
+		return p.printEntity(n, asPrefixContext, functionStyle, false, "__allocating_init", -1, "")
+	case kConstructor:
+		return p.printEntity(n, asPrefixContext, functionStyle, false, "init", -1, "")
+	case kDestructor:
+		return p.printEntity(n, asPrefixContext, noType, false, "deinit", -1, "")
+	case kDeallocator:
+		return p.printEntity(n, asPrefixContext, noType, false, "__deallocating_deinit", -1, "")
+	case kIVarInitializer:
+		return p.printEntity(n, asPrefixContext, noType, false, "__ivar_initializer", -1, "")
+	case kIVarDestroyer:
+		return p.printEntity(n, asPrefixContext, noType, false, "__ivar_destroyer", -1, "")
+	case kInitializer:
+		return p.printEntity(n, asPrefixContext, noType, false, "variable initialization expression", -1, "")
+	case kDefaultArgumentInitializer:
+		return p.printEntity(n, asPrefixContext, noType, false, "default argument ", n.children[1].index, "")
+	case kExplicitClosure, kImplicitClosure:
+		typePr := functionStyle
+		if p.simple {
+			typePr = noType
+		}
+		name := "closure #"
+		if n.kind == kImplicitClosure {
+			name = "implicit closure #"
+		}
+		return p.printEntity(n, asPrefixContext, typePr, false, name, n.children[1].index+1, "")
+	case kStatic:
+		p.WriteString("static ")
+		p.print(n.children[0], asPrefixContext)
+	case kAccessor:
+		storage := n.children[0]
+		switch storage.kind {
+		case kVariable:
+			return p.printEntity(storage, asPrefixContext, withColon, true, n.text, -1, "")
+		case kSubscript:
+			return p.printEntity(storage, asPrefixContext, withColon, false, n.text, -1, "subscript")
+		default:
+			p.print(storage, false)
+			p.WriteString("." + n.text)
+		}
+	case kExtension:
+		if !p.simple {
+			p.WriteString("(extension in ")
+			p.print(n.children[0], true)
+			p.WriteString("):")
+		}
+		p.print(n.children[1], false)
+		if len(n.children) == 3 {
+			p.print(n.children[2], false)
+		}
+	case kBoundGenericStructure, kBoundGenericClass, kBoundGenericEnum, kBoundGenericProtocol, kBoundGenericTypeAlias:
+		p.printBoundGeneric(n)
+	case kTuple:
+		p.WriteByte('(')
+		p.printChildren(n, ", ")
+		p.WriteByte(')')
+	case kTupleElement:
+		if name := n.child(kTupleElementName); name != nil {
+			p.WriteString(name.text + ": ")
+		}
+		if ty := n.child(kType); ty != nil {
+			p.print(ty, false)
+		}
+		if n.child(kVariadicMarker) != nil {
+			p.WriteString("...")
+		}
+	case kFunctionType, kNoEscapeFunctionType, kAutoClosureType, kEscapingAutoClosureType, kThinFunctionType,
+		kObjCBlock, kEscapingObjCBlock, kCFunctionPointer, kUncurriedFunctionType:
+		p.printFunctionType(nil, n)
+	case kArgumentTuple:
+		p.printFunctionParameters(nil, n, true)
+	case kReturnType:
+		p.WriteString(" -> ")
+		p.printChildren(n, "")
+	case kThrowsAnnotation:
+		p.WriteString(" throws")
+	case kTypedThrowsAnnotation:
+		p.WriteString(" throws(")
+		p.print(n.children[0], false)
+		p.WriteByte(')')
+	case kGlobalActorFunctionType:
+		p.WriteByte('@')
+		p.print(n.children[0], false)
+		p.WriteByte(' ')
+	case kIsolatedAnyFunctionType:
+		p.WriteString("@isolated(any) ")
+	case kTypeModifier:
+		p.WriteString(n.text)
+		p.print(n.children[0], false)
+	case kDynamicSelf:
+		p.WriteString("Self")
+	case kMetatype, kExistentialMetatype:
+		idx := 0
+		if len(n.children) == 2 {
+			p.print(n.children[0], false)
+			p.WriteByte(' ')
+			idx++
+		}
+		ty := n.children[idx].children[0]
+		p.printWithParens(ty)
+		if n.kind == kMetatype && isExistentialType(ty) {
+			p.WriteString(".Protocol")
+		} else {
+			p.WriteString(".Type")
+		}
+	case kProtocolList:
+		if types := n.children[0]; len(types.children) == 0 {
+			p.WriteString("Any")
+		} else {
+			p.printChildren(types, " & ")
+		}
+	case kProtocolListWithClass:
+		p.print(n.children[1], false)
+		p.WriteString(" & ")
+		p.print(n.children[0], false)
+	case kProtocolListWithAnyObject:
+		if types := n.children[0].children[0]; len(types.children) > 0 {
+			p.print(n.children[0], false)
+			p.WriteString(" & ")
+		}
+		if !p.simple {
+			p.WriteString("Swift.")
+		}
+		p.WriteString("AnyObject")
+	case kDependentGenericSignature:
+		p.printGenericSignature(n)
+	case kDependentGenericType:
+		p.print(n.children[0], false)
+		if needSpaceBeforeType(n.children[1]) {
+			p.WriteByte(' ')
+		}
+		p.print(n.children[1], false)
+	case kDependentMemberType:
+		p.print(n.children[0], false)
+		p.WriteByte('.')
+		p.print(n.children[1], false)
+	case kDependentGenericConformanceRequirement, kDependentGenericLayoutRequirement:
+		p.print(n.children[0], false)
+		p.WriteString(": ")
+		p.print(n.children[1], false)
+	case kDependentGenericSameTypeRequirement:
+		p.print(n.children[0], false)
+		p.WriteString(" == ")
+		p.print(n.children[1], false)
+	case kOpaqueReturnType:
+		p.WriteString("some")
+	case kProtocolConformance:
+		p.print(n.children[0], false)
+		if !p.simple {
+			p.WriteString(" : ")
+			p.print(n.children[1], false)
+			p.WriteString(" in ")
+			p.print(n.children[2], false)
+		}
+	case kDescription:
+		p.WriteString(n.text)
+		p.print(n.children[0], false)
+	case kFieldOffset:
+		p.WriteString(n.text + "field offset for ")
+		p.print(n.children[0], false)
+	case kProtocolWitness:
+		p.WriteString("protocol witness for ")
+		p.print(n.children[1], false)
+		p.WriteString(" in conformance ")
+		p.print(n.children[0], false)
+	case kVTableThunk:
+		p.WriteString("vtable thunk for ")
+		p.print(n.children[1], false)
+		p.WriteString(" dispatching to ")
+		p.print(n.children[0], false)
+	case kLazyProtocolWitnessTable:
+		p.WriteString(n.text)
+		p.print(n.children[0], false)
+		p.WriteString(" and conformance ")
+		p.print(n.children[1], false)
+	case kWitnessTableAccessor:
+		p.WriteString(n.text)
+		p.print(n.children[1], false)
+		p.WriteString(" in ")
+		p.print(n.children[0], false)
+	case kPartialApplyForwarder:
+		p.WriteString(n.text)
+		if p.simple {
+			p.WriteString("partial apply")
+		} else {
+			p.WriteString("partial apply forwarder")
+		}
+		if len(n.children) > 0 {
+			p.WriteString(" for ")
+			p.printChildren(n, "")
+		}
+	case kMergedFunction:
+		if !p.simple {
+			p.WriteString("merged ")
+		}
+	case kFunctionAttribute:
+		p.WriteString(n.text)
+	}
+	return nil
+}
+
+func (p *printer) printEntity(ent *node, asPrefixContext bool, typePr typePrinting, hasName bool, extraName string, extraIndex int, overwriteName string) *node {
+	multiWordName := strings.Contains(extraName, " ")
+	localName := hasName && len(ent.children) > 1 && ent.children[1].kind == kLocalDeclName
+	if localName {
+		multiWordName = true
+	}
+	if asPrefixContext && (typePr != noType || multiWordName) {
+		// the context has a type to be printed, so it can't be printed as a prefix
+		return ent
+	}
+
+	var postfixContext *node
+	ctx := ent.children[0]
+	if p.printContext(ctx) {
+		if multiWordName {
+			postfixContext = ctx
+		} else {
+			pos := p.Len()
+			postfixContext = p.print(ctx, true)
+			if p.Len() != pos {
+				p.WriteByte('.')
+			}
+		}
+	}
+
+	if hasName || overwriteName != "" {
+		if extraName != "" && multiWordName {
+			p.WriteString(extraName)
+			if extraIndex >= 0 {
+				p.WriteString(strconv.Itoa(extraIndex))
+			}
+			p.WriteString(" of ")
+			extraName, extraIndex = "", -1
+		}
+		pos := p.Len()
+		if overwriteName != "" {
+			p.WriteString(overwriteName)
+		} else {
+			if name := ent.children[1]; name.kind != kPrivateDeclName {
+				p.print(name, false)
+			}
+			if private := ent.child(kPrivateDeclName); private != nil {
+				p.print(private, false)
+			}
+		}
+		if p.Len() != pos && extraName != "" {
+			p.WriteByte('.')
+		}
+	}
+	if extraName != "" {
+		p.WriteString(extraName)
+		if extraIndex >= 0 {
+			p.WriteString(strconv.Itoa(extraIndex))
+		}
+	}
+
+	if typePr != noType {
+		typ := ent.child(kType)
+		if typ == nil {
+			return nil
+		}
+		typ = typ.children[0]
+		if typePr == functionStyle {
+			t := typ
+			for t.kind == kDependentGenericType {
+				t = t.children[1].children[0]
+			}
+			switch t.kind {
+			case kFunctionType, kNoEscapeFunctionType, kUncurriedFunctionType, kCFunctionPointer, kThinFunctionType:
+			default:
+				typePr = withColon
+			}
+		}
+		if typePr == withColon {
+			if !p.simple {
+				p.WriteString(" : ")
+				p.printEntityType(ent, typ)
+			}
+		} else {
+			if multiWordName || needSpaceBeforeType(typ) {
+				p.WriteByte(' ')
+			}
+			p.printEntityType(ent, typ)
+		}
+	}
+
+	if !asPrefixContext && postfixContext != nil {
+		if ent.kind == kDefaultArgumentInitializer || ent.kind == kInitializer {
+			p.WriteString(" of ")
+		} else {
+			p.WriteString(" in ")
+		}
+		p.print(postfixContext, false)
+		postfixContext = nil
+	}
+	return postfixContext
+}
+
+func (p *printer) printEntityType(ent, typ *node) {
+	labels := ent.child(kLabelList)
+	if labels == nil {
+		p.print(typ, false)
+		return
+	}
+	if typ.kind == kDependentGenericType {
+		if !p.simple {
+			p.print(typ.children[0], false)
+		}
+		dep := typ.children[1]
+		if needSpaceBeforeType(dep) {
+			p.WriteByte(' ')
+		}
+		typ = dep.children[0]
+	}
+	p.printFunctionType(labels, typ)
+}
+
+func (p *printer) printFunctionType(labels, fn *node) {
+	switch fn.kind {
+	case kAutoClosureType, kEscapingAutoClosureType:
+		p.WriteString("@autoclosure ")
+	case kThinFunctionType:
+		p.WriteString("@convention(thin) ")
+	case kCFunctionPointer:
+		p.WriteString("@convention(c) ")
+	case kEscapingObjCBlock:
+		p.WriteString("@escaping @convention(block) ")
+	case kObjCBlock:
+		p.WriteString("@convention(block) ")
+	}
+	var thrown *node
+	var isSendable, isAsync bool
+	for _, c := range fn.children {
+		switch c.kind {
+		case kIsolatedAnyFunctionType, kGlobalActorFunctionType:
+			p.print(c, false)
+		case kThrowsAnnotation, kTypedThrowsAnnotation:
+			thrown = c
+		case kConcurrentFunctionType:
+			isSendable = true
+		case kAsyncAnnotation:
+			isAsync = true
+		}
+	}
+	if isSendable {
+		p.WriteString("@Sendable ")
+	}
+	args := fn.child(kArgumentTuple)
+	p.printFunctionParameters(labels, args, !p.simple)
+	if p.simple {
+		return
+	}
+	if isAsync {
+		p.WriteString(" async")
+	}
+	if thrown != nil {
+		p.print(thrown, false)
+	}
+	if ret := fn.child(kReturnType); ret != nil {
+		p.print(ret, false)
+	}
+}
+
+func (p *printer) printFunctionParameters(labels, args *node, showTypes bool) {
+	params := args.children[0].children[0]
+	if params.kind != kTuple {
+		// only a single not-named parameter
+		if showTypes {
+			p.WriteByte('(')
+			p.print(params, false)
+			p.WriteByte(')')
+		} else {
+			p.WriteString("(_:)")
+		}
+		return
+	}
+	hasLabels := labels != nil && len(labels.children) > 0
+	p.WriteByte('(')
+	for i, param := range params.children {
+		if i > 0 && showTypes {
+			p.WriteString(", ")
+		}
+		if hasLabels {
+			if i < len(labels.children) && labels.children[i].kind == kIdentifier {
+				p.WriteString(labels.children[i].text + ":")
+			} else {
+				p.WriteString("_:")
+			}
+		} else if !showTypes {
+			if name := param.child(kTupleElementName); name != nil {
+				p.WriteString(name.text + ":")
+			} else {
+				p.WriteString("_:")
+			}
+		}
+		if hasLabels && showTypes {
+			p.WriteByte(' ')
+		}
+		if showTypes {
+			p.print(param, false)
+		}
+	}
+	p.WriteByte(')')
+}
+
+func (p *printer) printGenericSignature(sig *node) {
+	depth := 0
+	for ; depth < len(sig.children) && sig.children[depth].kind == kDependentGenericParamCount; depth++ {
+		if depth == 0 {
+			p.WriteByte('<')
+		} else {
+			p.WriteString("><")
+		}
+		for idx := range sig.children[depth].index {
+			if idx > 0 {
+				p.WriteString(", ")
+			}
+			if idx >= 128 {
+				p.WriteString("...")
+				break
+			}
+			p.WriteString(genericParam(depth, idx).text)
+		}
+	}
+	if depth != len(sig.children) && !p.simple {
+		p.WriteString(" where ")
+		for i, req := range sig.children[depth:] {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.print(req, false)
+		}
+	}
+	p.WriteByte('>')
+}
+
+func (p *printer) printBoundGeneric(n *node) {
+	if len(n.children) < 2 {
+		return
+	}
+	if !p.simple || n.kind == kBoundGenericClass || len(n.children) != 2 {
+		p.printBoundGenericNoSugar(n)
+		return
+	}
+	if n.kind == kBoundGenericProtocol {
+		p.printChildren(n.children[1], "")
+		p.WriteString(" as ")
+		p.print(n.children[0], false)
+		return
+	}
+	args := n.children[1].children
+	switch sugar(n) {
+	case "Optional":
+		ty := args[0]
+		p.printWithParens(ty)
+		p.WriteByte('?')
+	case "Array":
+		p.WriteByte('[')
+		p.print(args[0], false)
+		p.WriteByte(']')
+	case "Dictionary":
+		p.WriteByte('[')
+		p.print(args[0], false)
+		p.WriteString(" : ")
+		p.print(args[1], false)
+		p.WriteByte(']')
+	default:
+		p.printBoundGenericNoSugar(n)
+	}
+}
+
+func (p *printer) printBoundGenericNoSugar(n *node) {
+	p.print(n.children[0], false)
+	p.WriteByte('<')
+	p.printChildren(n.children[1], ", ")
+	p.WriteByte('>')
+}
+
+// sugar returns the name of the stdlib type a bound generic can be printed with sugar for (if any)
+func sugar(n *node) string {
+	nominal := n.children[0].children[0]
+	if len(nominal.children) != 2 || nominal.children[0].kind != kModule || nominal.children[0].text != "Swift" {
+		return ""
+	}
+	name := nominal.children[1].text
+	numArgs := len(n.children[1].children)
+	switch {
+	case nominal.kind == kEnum && name == "Optional" && numArgs == 1:
+		return name
+	case nominal.kind == kStructure && name == "Array" && numArgs == 1:
+		return name
+	case nominal.kind == kStructure && name == "Dictionary" && numArgs == 2:
+		return name
+	}
+	return ""
+}
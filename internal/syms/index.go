@@ -0,0 +1,73 @@
+package syms
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/codesign/entitlements"
+	"github.com/blacktop/ipsw/internal/commands/dext"
+	"github.com/blacktop/ipsw/internal/model"
+)
+
+// indexStrings returns the C string literals of a MachO for the cross-build string index
+func indexStrings(m *macho.File) []*model.String {
+	cstrs, err := m.GetCStrings()
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	var strs []*model.String
+	for _, sec := range cstrs {
+		for s := range sec {
+			if len(s) == 0 || len(s) > model.MaxStringLen {
+				continue
+			}
+			if _, ok := seen[s]; !ok {
+				seen[s] = struct{}{}
+				strs = append(strs, &model.String{Value: s})
+			}
+		}
+	}
+	slices.SortFunc(strs, func(a, b *model.String) int { return cmp.Compare(a.Value, b.Value) })
+	return strs
+}
+
+// indexEntitlements returns the entitlement keys of a MachO for the cross-build entitlement index
+func indexEntitlements(m *macho.File) []*model.Entitlement {
+	ents, err := entitlements.Parse(m.CodeSignature())
+	if err != nil || len(ents) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ents))
+	for k := range ents {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	out := make([]*model.Entitlement, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, &model.Entitlement{Key: k})
+	}
+	return out
+}
+
+// indexIOKitClasses adds the IOKit classes of the IPSW's DriverKit and system extension personalities
+// to their executables for the cross-build IOKit index
+func indexIOKitClasses(ipswPath, pemDB string, fs []*model.Macho) error {
+	exts, err := dext.ScanIPSW(ipswPath, pemDB)
+	if err != nil {
+		return err
+	}
+	classes := make(map[string][]string)
+	for _, ext := range exts {
+		if ext.Executable != "" {
+			classes[ext.Executable] = ext.Classes()
+		}
+	}
+	for _, m := range fs {
+		for _, class := range classes[m.GetPath()] {
+			m.IOKitClasses = append(m.IOKitClasses, &model.IOKitClass{Name: class})
+		}
+	}
+	return nil
+}
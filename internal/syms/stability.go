@@ -0,0 +1,293 @@
+package syms
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/hashicorp/go-version"
+)
+
+// Stability issue kinds
+const (
+	IssueRemoved  = "removed"  // the symbol's image is in the build but the symbol isn't
+	IssueRenamed  = "renamed"  // the symbol was removed and an unknown symbol of the same size showed up in its image
+	IssueReturned = "returned" // the symbol is back after being removed
+	IssueResized  = "resized"  // the symbol's size changed (any byte pattern/offset into it probably broke)
+	IssueMoved    = "moved"    // the symbol's offset from the start of its image's __TEXT changed
+)
+
+// StabilityConfig is the config for a symbol stability report
+type StabilityConfig struct {
+	MinVersion string // only include builds with a version >= MinVersion
+	MaxVersion string // only include builds with a version <= MaxVersion
+}
+
+// BuildRef is a scanned build
+type BuildRef struct {
+	IpswID  string `json:"ipsw_id"`
+	Version string `json:"version,omitempty"`
+	BuildID string `json:"buildid,omitempty"`
+}
+
+func (b BuildRef) String() string {
+	return fmt.Sprintf("%s (%s)", b.Version, b.BuildID)
+}
+
+// SymbolOccurrence is a symbol in a build
+type SymbolOccurrence struct {
+	BuildRef
+	Source model.Source `json:"source"`
+	Path   string       `json:"path"`
+	UUID   string       `json:"uuid"`
+	Offset uint64       `json:"offset"` // from the start of the image's __TEXT
+	Size   uint64       `json:"size"`
+}
+
+// StabilityIssue is a change to a symbol between two builds
+type StabilityIssue struct {
+	Build  BuildRef `json:"build"`
+	Kind   string   `json:"kind"`
+	Detail string   `json:"detail,omitempty"`
+}
+
+// SymbolStability is how a symbol changed across the scanned builds
+type SymbolStability struct {
+	Symbol      string             `json:"symbol"`
+	Stable      bool               `json:"stable"` // never removed, renamed or resized (moving is expected)
+	Occurrences []SymbolOccurrence `json:"occurrences,omitempty"`
+	Issues      []StabilityIssue   `json:"issues,omitempty"`
+}
+
+// StabilityReport is the cross-build stability of a list of (hooked) symbols
+type StabilityReport struct {
+	Builds  []BuildRef         `json:"builds"`
+	Symbols []*SymbolStability `json:"symbols"`
+}
+
+// stabilitySymbol returns the symbol name of a hooked symbol or class
+func stabilitySymbol(name string) string {
+	if class, ok := strings.CutPrefix(name, "class:"); ok {
+		return "_OBJC_CLASS_$_" + class
+	}
+	return name
+}
+
+// versions returns the parsed version range (either can be nil)
+func (conf *StabilityConfig) versions() (minVer, maxVer *version.Version, err error) {
+	if len(conf.MinVersion) > 0 {
+		if minVer, err = version.NewVersion(conf.MinVersion); err != nil {
+			return nil, nil, errcode.Errorf(errcode.InvalidArgument, "invalid min version %q: %v", conf.MinVersion, err)
+		}
+	}
+	if len(conf.MaxVersion) > 0 {
+		if maxVer, err = version.NewVersion(conf.MaxVersion); err != nil {
+			return nil, nil, errcode.Errorf(errcode.InvalidArgument, "invalid max version %q: %v", conf.MaxVersion, err)
+		}
+	}
+	return minVer, maxVer, nil
+}
+
+func inRange(v string, minVer, maxVer *version.Version) bool {
+	if minVer == nil && maxVer == nil {
+		return true
+	}
+	ver, err := version.NewVersion(v)
+	if err != nil {
+		return false // builds with unparsable versions are outside every range
+	}
+	return (minVer == nil || !ver.LessThan(minVer)) && (maxVer == nil || !ver.GreaterThan(maxVer))
+}
+
+func compareBuilds(a, b BuildRef) int {
+	va, erra := version.NewVersion(a.Version)
+	vb, errb := version.NewVersion(b.Version)
+	if erra == nil && errb == nil {
+		if c := va.Compare(vb); c != 0 {
+			return c
+		}
+	} else if c := strings.Compare(a.Version, b.Version); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.BuildID, b.BuildID)
+}
+
+// imageSymbols caches the symbols (by name) and __TEXT start of the scanned MachOs
+type imageSymbols struct {
+	db   db.Database
+	syms map[string]map[string]*model.Symbol
+	text map[string]uint64
+}
+
+func (is *imageSymbols) get(uuid string) (map[string]*model.Symbol, uint64, error) {
+	if syms, ok := is.syms[uuid]; ok {
+		return syms, is.text[uuid], nil
+	}
+	m, err := is.db.GetMachO(uuid)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get MachO %s: %w", uuid, err)
+	}
+	ss, err := is.db.GetSymbols(uuid)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, 0, fmt.Errorf("failed to get symbols of MachO %s: %w", uuid, err)
+	}
+	syms := make(map[string]*model.Symbol, len(ss))
+	for _, s := range ss {
+		syms[s.GetName()] = s
+	}
+	is.syms[uuid], is.text[uuid] = syms, m.TextStart
+	return syms, m.TextStart, nil
+}
+
+// renamedTo returns the symbol in the new image that the symbol was probably renamed to (same size, not in the old image, most similar name)
+func renamedTo(sym *model.Symbol, oldSyms, newSyms map[string]*model.Symbol) string {
+	var best string
+	var bestScore int
+	for name, s := range newSyms {
+		if _, ok := oldSyms[name]; ok || s.End-s.Start != sym.End-sym.Start {
+			continue
+		}
+		if score := commonAffix(sym.GetName(), name); score > bestScore || (score == bestScore && len(best) > 0 && name < best) {
+			best, bestScore = name, score
+		}
+	}
+	if bestScore < 3 { // '_' and a letter or two isn't a rename
+		return ""
+	}
+	return best
+}
+
+// commonAffix returns the length of the common prefix plus the common suffix of two names
+func commonAffix(a, b string) int {
+	var n int
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	var m int
+	for m < len(a)-n && m < len(b)-n && a[len(a)-1-m] == b[len(b)-1-m] {
+		m++
+	}
+	return n + m
+}
+
+// Stability returns the report of how the (hooked) symbols changed across every scanned build in the version range
+//
+// Symbols can be prefixed with 'class:' for ObjC classes (i.e. class:NSXPCConnection). A symbol is only flagged as
+// removed from builds where its image was also found by another symbol of the report.
+func Stability(symbols []string, conf *StabilityConfig, d db.Database) (*StabilityReport, error) {
+	if len(symbols) == 0 {
+		return nil, errcode.New(errcode.InvalidArgument, "no symbols to check")
+	}
+	if conf == nil {
+		conf = &StabilityConfig{}
+	}
+	minVer, maxVer, err := conf.versions()
+	if err != nil {
+		return nil, err
+	}
+
+	builds := make(map[string]BuildRef)
+	images := make(map[string]map[string]string) // build -> image path -> MachO UUID
+	found := make(map[string][]*model.SearchResult)
+	for _, sym := range symbols {
+		results, err := d.Search(model.SearchSymbol, stabilitySymbol(sym))
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			return nil, err
+		}
+		for _, r := range results {
+			if !inRange(r.Version, minVer, maxVer) {
+				continue
+			}
+			builds[r.IpswID] = BuildRef{IpswID: r.IpswID, Version: r.Version, BuildID: r.BuildID}
+			if images[r.IpswID] == nil {
+				images[r.IpswID] = make(map[string]string)
+			}
+			images[r.IpswID][r.Path] = r.UUID
+			found[sym] = append(found[sym], r)
+		}
+	}
+
+	report := &StabilityReport{}
+	for _, b := range builds {
+		report.Builds = append(report.Builds, b)
+	}
+	slices.SortFunc(report.Builds, compareBuilds)
+
+	is := &imageSymbols{db: d, syms: make(map[string]map[string]*model.Symbol), text: make(map[string]uint64)}
+	for _, sym := range symbols {
+		name := stabilitySymbol(sym)
+		ss := &SymbolStability{Symbol: sym}
+		report.Symbols = append(report.Symbols, ss)
+
+		inBuild := make(map[string]*model.SearchResult)
+		for _, r := range found[sym] {
+			if _, ok := inBuild[r.IpswID]; !ok { // the first (kernel, dsc then fs) image that has it
+				inBuild[r.IpswID] = r
+			}
+		}
+
+		var prev *SymbolOccurrence
+		var prevSym *model.Symbol
+		var removed bool
+		for _, b := range report.Builds {
+			r, ok := inBuild[b.IpswID]
+			if !ok {
+				if prev == nil || removed {
+					continue // not added yet (or already flagged)
+				}
+				uuid, ok := images[b.IpswID][prev.Path]
+				if !ok {
+					continue // the image wasn't found in this build (so we can't tell)
+				}
+				removed = true
+				issue := StabilityIssue{Build: b, Kind: IssueRemoved, Detail: fmt.Sprintf("not in %s", prev.Path)}
+				if oldSyms, _, err := is.get(prev.UUID); err == nil {
+					if newSyms, _, err := is.get(uuid); err == nil {
+						if to := renamedTo(prevSym, oldSyms, newSyms); len(to) > 0 {
+							issue.Kind, issue.Detail = IssueRenamed, fmt.Sprintf("probably renamed to %s (same size)", to)
+						}
+					}
+				}
+				ss.Issues = append(ss.Issues, issue)
+				continue
+			}
+
+			occ := SymbolOccurrence{BuildRef: b, Source: r.Source, Path: r.Path, UUID: r.UUID}
+			syms, text, err := is.get(r.UUID)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := syms[name]
+			if !ok { // a glob
+				s = &model.Symbol{Name: model.Name{Name: name}}
+			}
+			if s.Start >= text {
+				occ.Offset = s.Start - text
+			}
+			occ.Size = s.End - s.Start
+
+			if prev != nil {
+				switch {
+				case removed:
+					ss.Issues = append(ss.Issues, StabilityIssue{Build: b, Kind: IssueReturned})
+				case occ.Size != prev.Size:
+					ss.Issues = append(ss.Issues, StabilityIssue{Build: b, Kind: IssueResized, Detail: fmt.Sprintf("%#x → %#x", prev.Size, occ.Size)})
+				case occ.Offset != prev.Offset:
+					ss.Issues = append(ss.Issues, StabilityIssue{Build: b, Kind: IssueMoved, Detail: fmt.Sprintf("%s+%#x → %s+%#x", prev.Path, prev.Offset, occ.Path, occ.Offset)})
+				}
+			}
+			removed = false
+			ss.Occurrences = append(ss.Occurrences, occ)
+			prev, prevSym = &occ, s
+		}
+
+		ss.Stable = len(ss.Occurrences) > 0 && !slices.ContainsFunc(ss.Issues, func(i StabilityIssue) bool { return i.Kind != IssueMoved })
+	}
+
+	return report, nil
+}
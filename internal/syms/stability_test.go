@@ -0,0 +1,72 @@
+package syms
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/db"
+	"github.com/blacktop/ipsw/internal/model"
+)
+
+func stabilityIPSW(id, version, build string, syms map[string][2]uint64) *model.Ipsw {
+	kext := &model.Macho{UUID: id + "-kext", Path: model.Path{Path: "com.apple.driver.AppleMobileFileIntegrity"}, TextStart: 0x1000}
+	for name, r := range syms {
+		kext.Symbols = append(kext.Symbols, &model.Symbol{Name: model.Name{Name: name}, Start: r[0], End: r[1]})
+	}
+	return &model.Ipsw{
+		ID:      id,
+		Version: version,
+		BuildID: build,
+		Kernels: []*model.Kernelcache{{UUID: id + "-kernel", Kexts: []*model.Macho{kext}}},
+	}
+}
+
+func TestStability(t *testing.T) {
+	d, err := db.NewSqlite(filepath.Join(t.TempDir(), "syms.db"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, ipsw := range []*model.Ipsw{
+		stabilityIPSW("a", "17.0", "21A329", map[string][2]uint64{"_amfi_hook": {0x1100, 0x1180}, "_amfi_policy": {0x1200, 0x1240}}),
+		stabilityIPSW("b", "17.1", "21B74", map[string][2]uint64{"_amfi_hook": {0x1100, 0x1180}, "_amfi_policy_v2": {0x1300, 0x1340}}),
+		stabilityIPSW("c", "17.2", "21C62", map[string][2]uint64{"_amfi_hook": {0x1140, 0x11c0}, "_amfi_policy_v2": {0x1300, 0x1340}}),
+		stabilityIPSW("d", "18.0", "22A3354", map[string][2]uint64{"_amfi_hook": {0x1140, 0x1200}}),
+	} {
+		if err := d.Create(&model.Ipsw{ID: ipsw.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Save(ipsw); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Stability([]string{"_amfi_hook", "_amfi_policy"}, &StabilityConfig{MaxVersion: "17.9"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Builds) != 3 {
+		t.Fatalf("Builds = %+v, want 17.0-17.2", report.Builds)
+	}
+
+	hook := report.Symbols[0]
+	if !hook.Stable || len(hook.Occurrences) != 3 || len(hook.Issues) != 1 || hook.Issues[0].Kind != IssueMoved || hook.Occurrences[2].Offset != 0x140 {
+		t.Errorf("_amfi_hook = %+v", hook)
+	}
+	policy := report.Symbols[1]
+	if policy.Stable || len(policy.Issues) != 1 || policy.Issues[0].Kind != IssueRenamed || policy.Issues[0].Build.BuildID != "21B74" {
+		t.Errorf("_amfi_policy = %+v", policy)
+	}
+
+	report, err = Stability([]string{"_amfi_hook"}, &StabilityConfig{MinVersion: "17.2"}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook := report.Symbols[0]; hook.Stable || len(hook.Issues) != 1 || hook.Issues[0].Kind != IssueResized {
+		t.Errorf("_amfi_hook (17.2+) = %+v", hook)
+	}
+}
@@ -1,9 +1,13 @@
 package syms
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
@@ -14,6 +18,9 @@ import (
 	"github.com/blacktop/ipsw/internal/model"
 	"github.com/blacktop/ipsw/internal/search"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/internal/webhook"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/blacktop/ipsw/pkg/signature"
@@ -24,22 +31,27 @@ const (
 	isKernelMask   uint64 = 1 << 62
 )
 
-func scanKernels(ipswPath, sigDir string) ([]*model.Kernelcache, error) {
+func scanKernels(ctx context.Context, ipswPath, sigDir string) ([]*model.Kernelcache, error) {
 	var kcs []*model.Kernelcache
 
+	// extract into a folder of our own so concurrent scans (of the same IPSW) don't remove each other's kernelcaches
+	tmpDIR, err := os.MkdirTemp("", "ipsw_scan_kernel")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDIR)
+
 	out, err := extract.Kernelcache(&extract.Config{
 		IPSW:   ipswPath,
-		Output: os.TempDir(),
+		Output: tmpDIR,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract kernelcache: %w", err)
 	}
-	defer func() {
-		for k := range out {
-			os.Remove(k)
-		}
-	}()
 	for k := range out {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		smap := signature.NewSymbolMap()
 		if sigDir != "" {
 			// parse signatures
@@ -48,7 +60,7 @@ func scanKernels(ipswPath, sigDir string) ([]*model.Kernelcache, error) {
 				return nil, fmt.Errorf("failed to parse signatures: %v", err)
 			}
 			// symbolicate kernelcache
-			if err := smap.Symbolicate(k, sigs, true); err != nil {
+			if err := smap.SymbolicateContext(ctx, k, sigs, true); err != nil {
 				return nil, fmt.Errorf("failed to symbolicate kernelcache: %v", err)
 			}
 		}
@@ -62,12 +74,24 @@ func scanKernels(ipswPath, sigDir string) ([]*model.Kernelcache, error) {
 		if err != nil {
 			return nil, err
 		}
+		// use the symbols of the matching KDK (if it is installed)
+		if ks, err := kernelcache.ApplyKDKContext(ctx, m, nil); err == nil {
+			log.WithField("kdk", ks.KDK).Debugf("Applying %d KDK symbols", len(ks.Symbols))
+			for addr, sym := range ks.Map() {
+				smap[addr] = sym
+			}
+		} else {
+			log.WithError(err).Debug("No KDK symbols")
+		}
 		kc := &model.Kernelcache{
 			UUID:    m.UUID().String(),
 			Version: kv.String(),
 		}
 		if m.FileTOC.FileHeader.Type == types.MH_FILESET {
 			for idx, fe := range m.FileSets() {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 				log.WithFields(log.Fields{
 					"index": idx,
 					"name":  fe.EntryID,
@@ -84,6 +108,7 @@ func scanKernels(ipswPath, sigDir string) ([]*model.Kernelcache, error) {
 					kext.TextStart = text.Addr & highestBitMask
 					kext.TextEnd = (text.Addr + text.Filesz) & highestBitMask
 				}
+				kext.Strings = indexStrings(mfe)
 				for _, fn := range mfe.GetFunctions() {
 					var msym model.Symbol
 					if syms, err := mfe.FindAddressSymbols(fn.StartAddr); err == nil {
@@ -123,6 +148,7 @@ func scanKernels(ipswPath, sigDir string) ([]*model.Kernelcache, error) {
 				kext.TextStart = text.Addr & highestBitMask
 				kext.TextEnd = (text.Addr + text.Filesz) & highestBitMask
 			}
+			kext.Strings = indexStrings(m)
 			for _, fn := range m.GetFunctions() {
 				var msym model.Symbol
 				if syms, err := m.FindAddressSymbols(fn.StartAddr); err == nil {
@@ -162,8 +188,8 @@ func scanKernels(ipswPath, sigDir string) ([]*model.Kernelcache, error) {
 	return kcs, nil
 }
 
-func scanDSCs(ipswPath, pemDB string) ([]*model.DyldSharedCache, error) {
-	ctx, fs, err := dsc.OpenFromIPSW(ipswPath, pemDB, false, true)
+func scanDSCs(ctx context.Context, ipswPath, pemDB string) ([]*model.DyldSharedCache, error) {
+	mctx, fs, err := dsc.OpenFromIPSW(ipswPath, pemDB, false, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open DSC from IPSW: %w", err)
 	}
@@ -171,7 +197,7 @@ func scanDSCs(ipswPath, pemDB string) ([]*model.DyldSharedCache, error) {
 		for _, f := range fs {
 			f.Close()
 		}
-		ctx.Unmount()
+		mctx.Unmount()
 	}()
 
 	var dscs []*model.DyldSharedCache
@@ -181,17 +207,38 @@ func scanDSCs(ipswPath, pemDB string) ([]*model.DyldSharedCache, error) {
 			UUID:              f.UUID.String(),
 			SharedRegionStart: f.Headers[f.UUID].SharedRegionStart,
 		}
+		for idx, sc := range f.SubCacheInfo {
+			suffix := sc.Extention
+			if len(suffix) == 0 {
+				suffix = fmt.Sprintf(".%d", idx+1)
+			}
+			dsc.SubCaches = append(dsc.SubCaches, &model.SubCache{UUID: sc.UUID.String(), Suffix: suffix})
+		}
+		if symUUID := f.Headers[f.UUID].SymbolFileUUID; !symUUID.IsNull() {
+			dsc.SubCaches = append(dsc.SubCaches, &model.SubCache{UUID: symUUID.String(), Suffix: ".symbols"})
+		}
 
-		for idx, img := range f.Images {
+		// symbol parsing fills the shared AddressToSymbol map so it runs one image at a time
+		if err := f.ForEachImage(ctx, 1, func(ctx context.Context, idx int, img *dyld.CacheImage) error {
 			log.WithFields(log.Fields{
 				"index": idx,
 				"name":  img.Name,
 			}).Debug("Parsing DSC Image")
 			img.ParsePublicSymbols(false)
 			img.ParseLocalSymbols(false)
+			return nil
+		}); err != nil {
+			if !errors.As(err, new(dyld.ImageErrors)) {
+				return nil, err
+			}
+			log.WithError(err).Warn("failed to parse symbols for some dyld_shared_cache images")
+		}
+
+		images := make([]*model.Macho, len(f.Images))
+		if err := f.ForEachImage(ctx, 0, func(ctx context.Context, idx int, img *dyld.CacheImage) error {
 			m, err := img.GetMacho()
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse dyld_shared_cache image: %w", err)
+				return fmt.Errorf("failed to parse dyld_shared_cache image: %w", err)
 			}
 			defer m.Close()
 			dylib := &model.Macho{
@@ -219,7 +266,22 @@ func scanDSCs(ipswPath, pemDB string) ([]*model.DyldSharedCache, error) {
 				}
 				dylib.Symbols = append(dylib.Symbols, msym)
 			}
-			dsc.Images = append(dsc.Images, dylib)
+			images[idx] = dylib
+			return nil
+		}); err != nil {
+			var imgErrs dyld.ImageErrors
+			if !errors.As(err, &imgErrs) {
+				return nil, err
+			}
+			// don't throw away a multi-hour scan because of a few malformed dylibs
+			for _, ie := range imgErrs {
+				log.WithField("image", ie.Image).Errorf("failed to scan dyld_shared_cache image: %v", ie.Err)
+			}
+		}
+		for _, dylib := range images {
+			if dylib != nil {
+				dsc.Images = append(dsc.Images, dylib)
+			}
 		}
 
 		dscs = append(dscs, dsc)
@@ -229,6 +291,13 @@ func scanDSCs(ipswPath, pemDB string) ([]*model.DyldSharedCache, error) {
 
 // Scan scans the IPSW file and extracts information about the kernels, DSCs, and file system.
 func Scan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
+	return ScanContext(context.Background(), ipswPath, pemDB, sigsDir, db)
+}
+
+// ScanContext is like Scan but stops (returning ctx.Err()) once the context is done
+func ScanContext(ctx context.Context, ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
+	var ipsw *model.Ipsw
+	defer notifyScan(ipswPath, &ipsw, time.Now(), &err)
 	/* IPSW */
 	sha1, err := utils.Sha1(ipswPath)
 	if err != nil {
@@ -238,9 +307,14 @@ func Scan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to parse IPSW info: %w", err)
 	}
-	ipsw := &model.Ipsw{
+	absPath, err := filepath.Abs(ipswPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of IPSW: %w", err)
+	}
+	ipsw = &model.Ipsw{
 		ID:      sha1,
 		Name:    filepath.Base(ipswPath),
+		Path:    absPath,
 		BuildID: inf.Plists.BuildManifest.ProductBuildVersion,
 		Version: inf.Plists.BuildManifest.ProductVersion,
 	}
@@ -257,15 +331,18 @@ func Scan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 	}
 
 	/* KERNEL */
-	if ipsw.Kernels, err = scanKernels(ipswPath, sigsDir); err != nil {
+	if ipsw.Kernels, err = scanKernels(ctx, ipswPath, sigsDir); err != nil {
 		return fmt.Errorf("failed to scan kernels: %w", err)
 	}
 	/* DSC */
-	if ipsw.DSCs, err = scanDSCs(ipswPath, pemDB); err != nil {
+	if ipsw.DSCs, err = scanDSCs(ctx, ipswPath, pemDB); err != nil {
 		return fmt.Errorf("failed to scan DSCs: %w", err)
 	}
 	/* FileSystem */
 	if err := search.ForEachMachoInIPSW(ipswPath, pemDB, func(path string, m *macho.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if m.UUID() != nil {
 			mm := &model.Macho{
 				UUID: m.UUID().String(),
@@ -275,6 +352,7 @@ func Scan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 				mm.TextStart = text.Addr
 				mm.TextEnd = text.Addr + text.Filesz
 			}
+			mm.Entitlements = indexEntitlements(m)
 			for _, fn := range m.GetFunctions() {
 				var msym *model.Symbol
 				if syms, err := m.FindAddressSymbols(fn.StartAddr); err == nil {
@@ -301,6 +379,10 @@ func Scan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 	}); err != nil {
 		return fmt.Errorf("failed to search for machos in IPSW: %w", err)
 	}
+	/* DriverKit */
+	if err := indexIOKitClasses(ipswPath, pemDB, ipsw.FileSystem); err != nil {
+		return fmt.Errorf("failed to scan DriverKit extensions: %w", err)
+	}
 
 	log.Debug("Saving IPSW with FileSystem")
 	return db.Save(ipsw)
@@ -308,25 +390,38 @@ func Scan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 
 // Rescan re-scans the IPSW file and extracts information about the kernels, DSCs, and file system.
 func Rescan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
+	return RescanContext(context.Background(), ipswPath, pemDB, sigsDir, db)
+}
+
+// RescanContext is like Rescan but stops (returning ctx.Err()) once the context is done
+func RescanContext(ctx context.Context, ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
+	var ipsw *model.Ipsw
+	defer notifyScan(ipswPath, &ipsw, time.Now(), &err)
 	/* IPSW */
 	sha1, err := utils.Sha1(ipswPath)
 	if err != nil {
 		return fmt.Errorf("failed to calculate sha1: %w", err)
 	}
-	ipsw, err := db.Get(sha1)
+	ipsw, err = db.Get(sha1)
 	if err != nil {
 		return fmt.Errorf("failed to get IPSW from database: %w", err)
 	}
+	if ipsw.Path, err = filepath.Abs(ipswPath); err != nil { // the IPSW may have moved since it was scanned
+		return fmt.Errorf("failed to get absolute path of IPSW: %w", err)
+	}
 	/* KERNEL */
-	if ipsw.Kernels, err = scanKernels(ipswPath, sigsDir); err != nil {
+	if ipsw.Kernels, err = scanKernels(ctx, ipswPath, sigsDir); err != nil {
 		return fmt.Errorf("failed to scan kernels: %w", err)
 	}
 	/* DSC */
-	if ipsw.DSCs, err = scanDSCs(ipswPath, pemDB); err != nil {
+	if ipsw.DSCs, err = scanDSCs(ctx, ipswPath, pemDB); err != nil {
 		return fmt.Errorf("failed to scan DSCs: %w", err)
 	}
 	/* FileSystem */
 	if err := search.ForEachMachoInIPSW(ipswPath, pemDB, func(path string, m *macho.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if m.UUID() != nil {
 			mm := &model.Macho{
 				UUID: m.UUID().String(),
@@ -336,6 +431,7 @@ func Rescan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 				mm.TextStart = text.Addr
 				mm.TextEnd = text.Addr + text.Filesz
 			}
+			mm.Entitlements = indexEntitlements(m)
 			for _, fn := range m.GetFunctions() {
 				var msym *model.Symbol
 				if syms, err := m.FindAddressSymbols(fn.StartAddr); err == nil {
@@ -362,11 +458,34 @@ func Rescan(ipswPath, pemDB, sigsDir string, db db.Database) (err error) {
 	}); err != nil {
 		return fmt.Errorf("failed to search for machos in IPSW: %w", err)
 	}
+	/* DriverKit */
+	if err := indexIOKitClasses(ipswPath, pemDB, ipsw.FileSystem); err != nil {
+		return fmt.Errorf("failed to scan DriverKit extensions: %w", err)
+	}
 
 	log.Debug("Saving IPSW with FileSystem")
 	return db.Save(ipsw)
 }
 
+// notifyScan fires the scan.complete (or scan.failed) webhooks
+func notifyScan(ipswPath string, ipsw **model.Ipsw, start time.Time, err *error) {
+	data := map[string]string{
+		"path":     ipswPath,
+		"duration": time.Since(start).Round(time.Second).String(),
+	}
+	if *ipsw != nil {
+		data["id"] = (*ipsw).ID
+		data["version"] = (*ipsw).Version
+		data["build"] = (*ipsw).BuildID
+	}
+	if *err != nil {
+		data["error"] = (*err).Error()
+		webhook.Fire(webhook.EventScanFailed, "Failed to scan "+filepath.Base(ipswPath), data)
+		return
+	}
+	webhook.Fire(webhook.EventScanComplete, "Scanned "+filepath.Base(ipswPath), data)
+}
+
 func GetIPSW(version, build, device string, db db.Database) (*model.Ipsw, error) {
 	return db.GetIPSW(version, build, device)
 }
@@ -376,6 +495,31 @@ func GetMachO(uuid string, db db.Database) (*model.Macho, error) {
 	return db.GetMachO(uuid)
 }
 
+// Locate returns the scanned build (and the path of the IPSW it was scanned from) that contains the MachO with the given UUID in one of the sources.
+// It returns ErrNotFound if no build does.
+func Locate(uuid string, db db.Database, sources ...model.Source) (*model.SearchResult, error) {
+	results, err := db.Search(model.SearchUUID, uuid)
+	if err != nil {
+		return nil, err
+	}
+	var unlocated *model.SearchResult
+	for _, r := range results {
+		if !slices.Contains(sources, r.Source) {
+			continue
+		}
+		if r.IpswPath != "" { // IPSWs scanned before their path was recorded have none
+			if _, err := os.Stat(r.IpswPath); err == nil {
+				return r, nil
+			}
+		}
+		unlocated = r
+	}
+	if unlocated != nil {
+		return nil, errcode.Errorf(errcode.NotFound, "the IPSW %s (with %s) is no longer where it was scanned from; rescan it to record its path", unlocated.Name, uuid)
+	}
+	return nil, model.ErrNotFound
+}
+
 // GetDSC retrieves the Dyld Shared Cache (DSC) with the given UUID from the database.
 func GetDSC(uuid string, db db.Database) (*model.DyldSharedCache, error) {
 	return db.GetDSC(uuid)
@@ -397,3 +541,8 @@ func Get(uuid string, db db.Database) ([]*model.Symbol, error) {
 func GetForAddr(uuid string, addr uint64, db db.Database) (*model.Symbol, error) {
 	return db.GetSymbol(uuid, addr)
 }
+
+// Search returns every build in the database whose kernelcache, DSC or file system contains the symbol, string, entitlement, IOKit class or MachO UUID.
+func Search(kind model.SearchKind, value string, db db.Database) ([]*model.SearchResult, error) {
+	return db.Search(kind, value)
+}
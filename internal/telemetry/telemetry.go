@@ -0,0 +1,204 @@
+// Package telemetry records an opt-in, machine-readable summary of a single ipsw invocation (the time spent in
+// each phase, the bytes it processed and the analysis cache hit rates) so that pipelines running ipsw at scale
+// can find their bottlenecks without external profiling.
+//
+// Recording is a no-op until Enable is called.
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PhaseStats are the accumulated stats of a phase (i.e. kernelcache.decompress)
+type PhaseStats struct {
+	Name     string        `json:"name"`
+	Count    int           `json:"count"`
+	Duration time.Duration `json:"duration_ns"`
+	Bytes    int64         `json:"bytes,omitempty"`
+}
+
+// CacheStats are the hits and misses of a cache kind (i.e. function_starts)
+type CacheStats struct {
+	Hits    int     `json:"hits"`
+	Misses  int     `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// Summary is the telemetry of an invocation
+type Summary struct {
+	Command    string                `json:"command"`
+	Args       []string              `json:"args,omitempty"`
+	Start      time.Time             `json:"start"`
+	Duration   time.Duration         `json:"duration_ns"`
+	Error      string                `json:"error,omitempty"`
+	Phases     []PhaseStats          `json:"phases,omitempty"`
+	Caches     map[string]CacheStats `json:"caches,omitempty"`
+	TotalAlloc uint64                `json:"total_alloc_bytes"`
+	HeapSys    uint64                `json:"heap_sys_bytes"`
+	NumGC      uint32                `json:"num_gc"`
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	start  time.Time
+	phases map[string]*PhaseStats
+	caches map[string]*CacheStats
+}
+
+var (
+	mu  sync.Mutex
+	rec *recorder
+)
+
+func current() *recorder {
+	mu.Lock()
+	defer mu.Unlock()
+	return rec
+}
+
+// Enable starts recording (and resets anything recorded so far)
+func Enable() {
+	mu.Lock()
+	rec = &recorder{
+		start:  time.Now(),
+		phases: make(map[string]*PhaseStats),
+		caches: make(map[string]*CacheStats),
+	}
+	mu.Unlock()
+}
+
+// Enabled returns true if telemetry is being recorded
+func Enabled() bool {
+	return current() != nil
+}
+
+func (r *recorder) phase(name string) *PhaseStats {
+	p, ok := r.phases[name]
+	if !ok {
+		p = &PhaseStats{Name: name}
+		r.phases[name] = p
+	}
+	return p
+}
+
+// Phase starts timing a phase and returns the func that stops it
+//
+//	defer telemetry.Phase("dyld.open")()
+func Phase(name string) func() {
+	r := current()
+	if r == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		r.mu.Lock()
+		p := r.phase(name)
+		p.Count++
+		p.Duration += time.Since(start)
+		r.mu.Unlock()
+	}
+}
+
+// AddBytes adds to the number of bytes a phase processed
+func AddBytes(name string, n int64) {
+	r := current()
+	if r == nil || n <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.phase(name).Bytes += n
+	r.mu.Unlock()
+}
+
+// CacheLookup records a hit (or miss) of a cache kind
+func CacheLookup(kind string, hit bool) {
+	r := current()
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	c, ok := r.caches[kind]
+	if !ok {
+		c = &CacheStats{}
+		r.caches[kind] = c
+	}
+	if hit {
+		c.Hits++
+	} else {
+		c.Misses++
+	}
+	r.mu.Unlock()
+}
+
+// Finish returns the summary of everything recorded since Enable (or nil if telemetry isn't enabled)
+func Finish(command string, args []string, err error) *Summary {
+	r := current()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &Summary{
+		Command:  command,
+		Args:     args,
+		Start:    r.start,
+		Duration: time.Since(r.start),
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	for _, p := range r.phases {
+		s.Phases = append(s.Phases, *p)
+	}
+	// slowest phases first
+	sort.Slice(s.Phases, func(i, j int) bool {
+		if s.Phases[i].Duration != s.Phases[j].Duration {
+			return s.Phases[i].Duration > s.Phases[j].Duration
+		}
+		return s.Phases[i].Name < s.Phases[j].Name
+	})
+	if len(r.caches) > 0 {
+		s.Caches = make(map[string]CacheStats, len(r.caches))
+		for kind, c := range r.caches {
+			cs := *c
+			if total := cs.Hits + cs.Misses; total > 0 {
+				cs.HitRate = float64(cs.Hits) / float64(total)
+			}
+			s.Caches[kind] = cs
+		}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s.TotalAlloc = ms.TotalAlloc
+	s.HeapSys = ms.HeapSys
+	s.NumGC = ms.NumGC
+
+	return s
+}
+
+// Write writes the summary as JSON to path (or stderr if path is empty or "-")
+func (s *Summary) Write(path string) error {
+	var w io.Writer = os.Stderr
+	if len(path) > 0 && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create telemetry file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("failed to write telemetry summary: %v", err)
+	}
+	return nil
+}
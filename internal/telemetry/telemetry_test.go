@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	Phase("disabled")() // no-op
+	if Finish("ipsw", nil, nil) != nil {
+		t.Fatal("Finish() should return nil when telemetry is disabled")
+	}
+
+	Enable()
+	defer func() { mu.Lock(); rec = nil; mu.Unlock() }()
+
+	for range 2 {
+		stop := Phase("dyld.open")
+		AddBytes("dyld.open", 0x1000)
+		stop()
+	}
+	CacheLookup("function_starts", true)
+	CacheLookup("function_starts", true)
+	CacheLookup("function_starts", false)
+
+	s := Finish("ipsw dyld info", []string{"dsc"}, nil)
+	if len(s.Phases) != 1 || s.Phases[0].Count != 2 || s.Phases[0].Bytes != 0x2000 {
+		t.Errorf("Phases = %+v", s.Phases)
+	}
+	if c := s.Caches["function_starts"]; c.Hits != 2 || c.Misses != 1 || c.HitRate < 0.66 || c.HitRate > 0.67 {
+		t.Errorf("Caches = %+v", s.Caches)
+	}
+
+	path := filepath.Join(t.TempDir(), "telemetry.json")
+	if err := s.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Summary
+	if err := json.Unmarshal(dat, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != "ipsw dyld info" || len(got.Phases) != 1 {
+		t.Errorf("Write() = %s", dat)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/blacktop/go-plist"
 	"github.com/blacktop/ipsw/internal/utils/lsof"
 	"github.com/blacktop/ipsw/pkg/aea"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	semver "github.com/hashicorp/go-version"
 )
 
@@ -82,11 +83,22 @@ func CopyWithMode(src, dst string, mode os.FileMode) error {
 }
 
 func copySymlink(src, dst string) error {
-	src, err := os.Readlink(src)
+	target, err := os.Readlink(src)
 	if err != nil {
 		return err
 	}
-	return os.Symlink(src, dst)
+	if err := os.Symlink(target, dst); err != nil {
+		if runtime.GOOS != "windows" {
+			return err
+		}
+		// creating symlinks requires Developer Mode (or admin) on Windows so copy what the link points to instead
+		fi, serr := os.Stat(src)
+		if serr != nil || fi.IsDir() {
+			return err
+		}
+		return copyFile(src, dst, fi.Mode())
+	}
+	return nil
 }
 
 func copyFile(src, dst string, mode os.FileMode) error {
@@ -463,6 +475,9 @@ func GetKernelCollectionPath() (string, error) {
 
 var ErrMountResourceBusy = errors.New("hdiutil: mount failed - Resource busy")
 
+// ErrMountUnsupported is returned when DMGs can't be mounted on the host OS (there is no APFS driver on Windows)
+var ErrMountUnsupported = errcode.New(errcode.Unsupported, "mounting APFS DMGs is not supported on "+runtime.GOOS)
+
 // Mount mounts a DMG with hdiutil
 func Mount(image, mountPoint string) error {
 	if runtime.GOOS == "darwin" {
@@ -473,6 +488,8 @@ func Mount(image, mountPoint string) error {
 			}
 			return fmt.Errorf("%v: %s", err, out)
 		}
+	} else if runtime.GOOS == "windows" {
+		return ErrMountUnsupported
 	} else {
 		out, err := exec.Command("apfs-fuse", image, mountPoint).CombinedOutput()
 		if err != nil {
@@ -508,6 +525,10 @@ func IsAlreadyMounted(image, mountPoint string) (string, bool, error) {
 }
 
 func MountDMG(image string) (string, bool, error) {
+	if runtime.GOOS == "windows" {
+		return "", false, ErrMountUnsupported
+	}
+
 	mountPoint := fmt.Sprintf("/tmp/%s.mount", filepath.Base(image))
 
 	if runtime.GOOS == "darwin" {
@@ -623,6 +644,9 @@ func MountInfo() (*HdiUtilInfo, error) {
 }
 
 func ExtractFromDMG(ipswPath, dmgPath, destPath, pemDB string, pattern *regexp.Regexp) ([]string, error) {
+	if runtime.GOOS == "windows" { // fail before extracting (and decrypting) the DMG
+		return nil, ErrMountUnsupported
+	}
 	// check if filesystem DMG already exists (due to previous mount command)
 	if _, err := os.Stat(dmgPath); os.IsNotExist(err) {
 		dmgs, err := Unzip(ipswPath, "", func(f *zip.File) bool {
@@ -678,9 +702,10 @@ func ExtractFromDMG(ipswPath, dmgPath, destPath, pemDB string, pattern *regexp.R
 		if info.IsDir() {
 			return nil
 		}
-		if pattern.MatchString(strings.TrimPrefix(path, mountPoint)) {
-			fname := strings.TrimPrefix(path, mountPoint)
-			fname = filepath.Join(destPath, fname)
+		// match on the slash separated path inside the DMG so patterns work on every OS
+		rel := filepath.ToSlash(strings.TrimPrefix(path, mountPoint))
+		if pattern.MatchString(rel) {
+			fname := filepath.Join(destPath, filepath.FromSlash(rel))
 			if err := os.MkdirAll(filepath.Dir(fname), 0750); err != nil {
 				return fmt.Errorf("failed to create directory %s: %v", filepath.Join(destPath, filepath.Dir(fname)), err)
 			}
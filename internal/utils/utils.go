@@ -3,7 +3,6 @@ package utils
 import (
 	"archive/tar"
 	"archive/zip"
-	"compress/gzip"
 	"crypto/sha1"
 	"fmt"
 	"io"
@@ -14,10 +13,12 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
+	"github.com/blacktop/ipsw/internal/compress"
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
 )
@@ -52,9 +53,14 @@ func RandomAgent() string {
 	return userAgents[rand.Int()%len(userAgents)]
 }
 
-// Indent indents apex log line to supplied level
+// paddingMu serializes the indented log lines as the padding is the global cli handler's
+var paddingMu sync.Mutex
+
+// Indent indents apex log line to supplied level (it is safe to call from multiple goroutines)
 func Indent(f func(s string), level int) func(string) {
 	return func(s string) {
+		paddingMu.Lock()
+		defer paddingMu.Unlock()
 		cli.Default.Padding = normalPadding * level
 		f(s)
 		cli.Default.Padding = normalPadding
@@ -420,16 +426,19 @@ func Unzip(src, dest string, filter func(f *zip.File) bool) ([]string, error) {
 }
 
 // UnTarGz - https://stackoverflow.com/a/57640231
+// NOTE: also handles zstd, xz, bzip2 and lzma compressed tarballs
 func UnTarGz(tarfile, destPath string) error {
 
 	r, err := os.Open(tarfile)
 	if err != nil {
 		return err
 	}
-	uncompressedStream, err := gzip.NewReader(r)
+	defer r.Close()
+	uncompressedStream, _, err := compress.NewReader(r)
 	if err != nil {
 		return err
 	}
+	defer uncompressedStream.Close()
 
 	tarReader := tar.NewReader(uncompressedStream)
 
@@ -0,0 +1,245 @@
+// Package vm provisions disposable macOS VMs (via Virtualization.framework) for dynamic analysis
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	configFile     = "config.json"
+	diskFile       = "Disk.img"
+	auxFile        = "AuxiliaryStorage"
+	hwModelFile    = "HardwareModel"
+	machineIDFile  = "MachineIdentifier"
+	bundleExt      = ".vm"
+	DefaultCPUs    = 4
+	DefaultMemory  = 8 << 30  // 8GB
+	DefaultDisk    = 64 << 30 // 64GB
+	minMemory      = 4 << 30
+	automountShare = "/Volumes/My Shared Files"
+)
+
+// Config is a VM bundle's config
+type Config struct {
+	Name        string    `json:"name"`
+	CPUs        uint      `json:"cpus"`
+	Memory      uint64    `json:"memory"`
+	DiskSize    uint64    `json:"disk_size"`
+	RestoreImg  string    `json:"restore_image"`
+	DisableSIP  bool      `json:"disable_sip"`
+	DisableAMFI bool      `json:"disable_amfi"`
+	BootArgs    []string  `json:"boot_args,omitempty"`
+	Installed   bool      `json:"installed"`
+	Created     time.Time `json:"created"`
+
+	path string
+}
+
+// RunOptions are the options for booting a VM
+type RunOptions struct {
+	// Recovery boots into recoveryOS (i.e. to run `csrutil disable`)
+	Recovery bool
+	// SharedDir is a host folder shared with the guest (automounted at '/Volumes/My Shared Files')
+	SharedDir string
+	// ReadOnly shares SharedDir read-only
+	ReadOnly bool
+	// Ephemeral boots an APFS clone of the VM that is deleted on shutdown
+	Ephemeral bool
+}
+
+// Root returns the folder the VM bundles are stored in
+func Root() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+	return filepath.Join(home, ".config", "ipsw", "vms"), nil
+}
+
+// Path returns the VM bundle folder
+func (c *Config) Path() string {
+	return c.path
+}
+
+func (c *Config) file(name string) string {
+	return filepath.Join(c.path, name)
+}
+
+// Validate checks the config is sane and fills in defaults
+func (c *Config) Validate() error {
+	if len(c.Name) == 0 || strings.ContainsAny(c.Name, `/\`) {
+		return fmt.Errorf("invalid VM name '%s'", c.Name)
+	}
+	if c.CPUs == 0 {
+		c.CPUs = DefaultCPUs
+	}
+	if c.Memory == 0 {
+		c.Memory = DefaultMemory
+	} else if c.Memory < minMemory {
+		return fmt.Errorf("VM memory must be at least %dGB", minMemory>>30)
+	}
+	if c.DiskSize == 0 {
+		c.DiskSize = DefaultDisk
+	}
+	return nil
+}
+
+// New creates a NEW VM bundle (the OS still needs to be installed with Install)
+func New(cfg *Config) (*Config, error) {
+	if runtime.GOOS != "darwin" || runtime.GOARCH != "arm64" {
+		return nil, fmt.Errorf("macOS VMs are only supported on Apple Silicon macOS hosts")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	root, err := Root()
+	if err != nil {
+		return nil, err
+	}
+	cfg.path = filepath.Join(root, cfg.Name+bundleExt)
+	if _, err := os.Stat(cfg.path); err == nil {
+		return nil, fmt.Errorf("VM '%s' already exists (remove it with `ipsw vm rm %s`)", cfg.Name, cfg.Name)
+	}
+	if err := os.MkdirAll(cfg.path, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create VM bundle %s: %v", cfg.path, err)
+	}
+	// sparse disk image
+	f, err := os.Create(cfg.file(diskFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VM disk: %v", err)
+	}
+	if err := f.Truncate(int64(cfg.DiskSize)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to size VM disk: %v", err)
+	}
+	f.Close()
+	cfg.Created = time.Now()
+	return cfg, cfg.Save()
+}
+
+// Load loads the VM bundle for name
+func Load(name string) (*Config, error) {
+	root, err := Root()
+	if err != nil {
+		return nil, err
+	}
+	return LoadBundle(filepath.Join(root, strings.TrimSuffix(name, bundleExt)+bundleExt))
+}
+
+// LoadBundle loads a VM bundle folder
+func LoadBundle(path string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Join(path, configFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VM config: %v", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse VM config: %v", err)
+	}
+	cfg.path = path
+	return &cfg, nil
+}
+
+// Save writes the VM config to the bundle
+func (c *Config) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.file(configFile), data, 0640)
+}
+
+// List returns all the VM bundles
+func List() ([]*Config, error) {
+	root, err := Root()
+	if err != nil {
+		return nil, err
+	}
+	bundles, err := filepath.Glob(filepath.Join(root, "*"+bundleExt))
+	if err != nil {
+		return nil, err
+	}
+	var vms []*Config
+	for _, b := range bundles {
+		cfg, err := LoadBundle(b)
+		if err != nil {
+			continue
+		}
+		vms = append(vms, cfg)
+	}
+	sort.Slice(vms, func(i, j int) bool { return vms[i].Name < vms[j].Name })
+	return vms, nil
+}
+
+// Remove deletes the VM bundle
+func (c *Config) Remove() error {
+	return os.RemoveAll(c.path)
+}
+
+// Clone creates an APFS clone (copy-on-write) of the VM bundle
+func (c *Config) Clone(name string) (*Config, error) {
+	if runtime.GOOS != "darwin" {
+		return nil, fmt.Errorf("only supported on macOS")
+	}
+	dst := filepath.Join(filepath.Dir(c.path), name+bundleExt)
+	if out, err := exec.Command("/bin/cp", "-c", "-R", c.path, dst).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to clone VM bundle: %v: %s", err, out)
+	}
+	clone, err := LoadBundle(dst)
+	if err != nil {
+		return nil, err
+	}
+	clone.Name = name
+	return clone, clone.Save()
+}
+
+// GuestSetup returns the commands to run in the guest's recoveryOS Terminal to apply the SIP/AMFI options
+func (c *Config) GuestSetup() []string {
+	var cmds []string
+	if c.DisableSIP {
+		cmds = append(cmds, "csrutil disable")
+	}
+	bootArgs := c.BootArgs
+	if c.DisableAMFI {
+		bootArgs = append(bootArgs, "amfi_get_out_of_my_way=1")
+	}
+	if len(bootArgs) > 0 {
+		cmds = append(cmds, fmt.Sprintf("nvram boot-args=%q", strings.Join(bootArgs, " ")))
+	}
+	if len(cmds) > 0 {
+		cmds = append(cmds, "reboot")
+	}
+	return cmds
+}
+
+// SharedFolder returns where a shared host folder shows up in the guest
+func SharedFolder() string {
+	return automountShare
+}
+
+func (c *Config) String() string {
+	state := "not installed"
+	if c.Installed {
+		state = "installed"
+	}
+	var opts []string
+	if c.DisableSIP {
+		opts = append(opts, "SIP disabled")
+	}
+	if c.DisableAMFI {
+		opts = append(opts, "AMFI disabled")
+	}
+	s := fmt.Sprintf("%s (%s) cpus=%d memory=%dGB disk=%dGB", c.Name, state, c.CPUs, c.Memory>>30, c.DiskSize>>30)
+	if len(opts) > 0 {
+		s += " [" + strings.Join(opts, ", ") + "]"
+	}
+	return s
+}
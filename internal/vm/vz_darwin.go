@@ -0,0 +1,130 @@
+//go:build darwin && arm64 && cgo && vz
+
+package vm
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc -mmacosx-version-min=12.0
+#cgo LDFLAGS: -framework Foundation -framework Virtualization
+#include <stdlib.h>
+#include "vz_darwin.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+var installProgress func(float64)
+
+//export goVZInstallProgress
+func goVZInstallProgress(fraction C.double) {
+	if installProgress != nil {
+		installProgress(float64(fraction))
+	}
+}
+
+type cConfig struct {
+	c     C.vz_config_t
+	frees []unsafe.Pointer
+}
+
+func (c *Config) toC(opts *RunOptions) *cConfig {
+	cc := &cConfig{}
+	str := func(s string) *C.char {
+		p := C.CString(s)
+		cc.frees = append(cc.frees, unsafe.Pointer(p))
+		return p
+	}
+	cc.c.disk = str(c.file(diskFile))
+	cc.c.aux = str(c.file(auxFile))
+	cc.c.hw_model = str(c.file(hwModelFile))
+	cc.c.machine_id = str(c.file(machineIDFile))
+	cc.c.cpus = C.uint(c.CPUs)
+	cc.c.memory = C.ulonglong(c.Memory)
+	if opts != nil {
+		if len(opts.SharedDir) > 0 {
+			cc.c.shared_dir = str(opts.SharedDir)
+			if opts.ReadOnly {
+				cc.c.shared_ro = 1
+			}
+		}
+		if opts.Recovery {
+			cc.c.recovery = 1
+		}
+	}
+	return cc
+}
+
+func (cc *cConfig) free() {
+	for _, p := range cc.frees {
+		C.free(p)
+	}
+}
+
+func goError(cerr *C.char) error {
+	if cerr == nil {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(cerr))
+	return fmt.Errorf("%s", C.GoString(cerr))
+}
+
+// Install installs macOS into the VM from the restore image (.ipsw)
+func (c *Config) Install(restoreImage string, progress func(float64)) error {
+	cc := c.toC(nil)
+	defer cc.free()
+
+	cimg := C.CString(restoreImage)
+	defer C.free(unsafe.Pointer(cimg))
+
+	installProgress = progress
+	defer func() { installProgress = nil }()
+
+	if err := goError(C.vz_install(&cc.c, cimg)); err != nil {
+		return err
+	}
+
+	c.CPUs = uint(cc.c.cpus)
+	c.Memory = uint64(cc.c.memory)
+	c.RestoreImg = restoreImage
+	c.Installed = true
+	return c.Save()
+}
+
+// Run boots the VM and blocks until it shuts down (Ctrl+C requests a guest shutdown)
+func (c *Config) Run(opts *RunOptions) error {
+	if !c.Installed {
+		return fmt.Errorf("VM '%s' has not been installed", c.Name)
+	}
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+
+	vm := c
+	if opts.Ephemeral {
+		clone, err := c.Clone(fmt.Sprintf("%s-ephemeral-%d", c.Name, os.Getpid()))
+		if err != nil {
+			return err
+		}
+		defer clone.Remove()
+		vm = clone
+	}
+
+	cc := vm.toC(opts)
+	defer cc.free()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		for range sigs {
+			C.vz_stop()
+		}
+	}()
+
+	return goError(C.vz_run(&cc.c))
+}
@@ -0,0 +1,23 @@
+#ifndef IPSW_VZ_H
+#define IPSW_VZ_H
+
+typedef struct {
+    const char *disk;
+    const char *aux;
+    const char *hw_model;
+    const char *machine_id;
+    unsigned int cpus;
+    unsigned long long memory;
+    const char *shared_dir;
+    int shared_ro;
+    int recovery;
+} vz_config_t;
+
+// vz_install creates the platform files and installs macOS from the restore image (returns error string or NULL)
+char *vz_install(vz_config_t *cfg, const char *restore_image);
+// vz_run boots the VM and blocks until it stops (returns error string or NULL)
+char *vz_run(vz_config_t *cfg);
+// vz_stop requests the running VM to stop
+void vz_stop(void);
+
+#endif
@@ -0,0 +1,221 @@
+//go:build darwin && cgo && vz
+
+#import <Foundation/Foundation.h>
+#import <Virtualization/Virtualization.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+#include "vz_darwin.h"
+#include "_cgo_export.h"
+
+static dispatch_queue_t vmQueue;
+static VZVirtualMachine *runningVM;
+
+static char *vz_error(NSString *prefix, NSError *err) {
+    NSString *msg = err ? [NSString stringWithFormat:@"%@: %@", prefix, err.localizedDescription] : prefix;
+    return strdup(msg.UTF8String);
+}
+
+static NSURL *fileURL(const char *path) {
+    return [NSURL fileURLWithPath:[NSString stringWithUTF8String:path]];
+}
+
+static VZVirtualMachineConfiguration *vz_configuration(vz_config_t *cfg, VZMacHardwareModel *hw, VZMacMachineIdentifier *mid, VZMacAuxiliaryStorage *aux, NSError **err) {
+    VZMacPlatformConfiguration *platform = [[VZMacPlatformConfiguration alloc] init];
+    platform.hardwareModel = hw;
+    platform.machineIdentifier = mid;
+    platform.auxiliaryStorage = aux;
+
+    VZVirtualMachineConfiguration *conf = [[VZVirtualMachineConfiguration alloc] init];
+    conf.platform = platform;
+    conf.bootLoader = [[VZMacOSBootLoader alloc] init];
+    conf.CPUCount = MAX(cfg->cpus, VZVirtualMachineConfiguration.minimumAllowedCPUCount);
+    conf.memorySize = MAX(cfg->memory, VZVirtualMachineConfiguration.minimumAllowedMemorySize);
+
+    VZMacGraphicsDeviceConfiguration *graphics = [[VZMacGraphicsDeviceConfiguration alloc] init];
+    graphics.displays = @[ [[VZMacGraphicsDisplayConfiguration alloc] initWithWidthInPixels:1920 heightInPixels:1200 pixelsPerInch:80] ];
+    conf.graphicsDevices = @[ graphics ];
+
+    VZDiskImageStorageDeviceAttachment *disk = [[VZDiskImageStorageDeviceAttachment alloc] initWithURL:fileURL(cfg->disk) readOnly:NO error:err];
+    if (!disk) {
+        return nil;
+    }
+    conf.storageDevices = @[ [[VZVirtioBlockDeviceConfiguration alloc] initWithAttachment:disk] ];
+
+    VZVirtioNetworkDeviceConfiguration *net = [[VZVirtioNetworkDeviceConfiguration alloc] init];
+    net.attachment = [[VZNATNetworkDeviceAttachment alloc] init];
+    conf.networkDevices = @[ net ];
+
+    conf.pointingDevices = @[ [[VZUSBScreenCoordinatePointingDeviceConfiguration alloc] init] ];
+    conf.keyboards = @[ [[VZUSBKeyboardConfiguration alloc] init] ];
+    conf.entropyDevices = @[ [[VZVirtioEntropyDeviceConfiguration alloc] init] ];
+
+    // guest console on the host's stdio
+    VZVirtioConsoleDeviceSerialPortConfiguration *console = [[VZVirtioConsoleDeviceSerialPortConfiguration alloc] init];
+    console.attachment = [[VZFileHandleSerialPortAttachment alloc]
+        initWithFileHandleForReading:[NSFileHandle fileHandleWithStandardInput]
+                fileHandleForWriting:[NSFileHandle fileHandleWithStandardOutput]];
+    conf.serialPorts = @[ console ];
+
+    if (cfg->shared_dir) {
+        if (@available(macOS 13.0, *)) {
+            VZSharedDirectory *dir = [[VZSharedDirectory alloc] initWithURL:fileURL(cfg->shared_dir) readOnly:cfg->shared_ro];
+            VZVirtioFileSystemDeviceConfiguration *fs = [[VZVirtioFileSystemDeviceConfiguration alloc]
+                initWithTag:VZVirtioFileSystemDeviceConfiguration.macOSGuestAutomountTag];
+            fs.share = [[VZSingleDirectoryShare alloc] initWithDirectory:dir];
+            conf.directorySharingDevices = @[ fs ];
+        }
+    }
+
+    if (![conf validateWithError:err]) {
+        return nil;
+    }
+    return conf;
+}
+
+char *vz_install(vz_config_t *cfg, const char *restore_image) {
+    @autoreleasepool {
+        __block VZMacOSRestoreImage *image = nil;
+        __block NSError *loadErr = nil;
+        dispatch_semaphore_t loaded = dispatch_semaphore_create(0);
+        [VZMacOSRestoreImage loadFileURL:fileURL(restore_image) completionHandler:^(VZMacOSRestoreImage *img, NSError *err) {
+            image = img;
+            loadErr = err;
+            dispatch_semaphore_signal(loaded);
+        }];
+        dispatch_semaphore_wait(loaded, DISPATCH_TIME_FOREVER);
+        if (!image) {
+            return vz_error(@"failed to load restore image", loadErr);
+        }
+
+        VZMacOSConfigurationRequirements *req = image.mostFeaturefulSupportedConfiguration;
+        if (!req || !req.hardwareModel.supported) {
+            return vz_error(@"restore image is not supported on this host", nil);
+        }
+
+        NSError *err = nil;
+        VZMacHardwareModel *hw = req.hardwareModel;
+        if (![hw.dataRepresentation writeToURL:fileURL(cfg->hw_model) options:NSDataWritingAtomic error:&err]) {
+            return vz_error(@"failed to save hardware model", err);
+        }
+        VZMacMachineIdentifier *mid = [[VZMacMachineIdentifier alloc] init];
+        if (![mid.dataRepresentation writeToURL:fileURL(cfg->machine_id) options:NSDataWritingAtomic error:&err]) {
+            return vz_error(@"failed to save machine identifier", err);
+        }
+        VZMacAuxiliaryStorage *aux = [[VZMacAuxiliaryStorage alloc] initCreatingStorageAtURL:fileURL(cfg->aux)
+                                                                              hardwareModel:hw
+                                                                                    options:VZMacAuxiliaryStorageInitializationOptionAllowOverwrite
+                                                                                      error:&err];
+        if (!aux) {
+            return vz_error(@"failed to create auxiliary storage", err);
+        }
+
+        cfg->cpus = MAX(cfg->cpus, (unsigned int)req.minimumSupportedCPUCount);
+        cfg->memory = MAX(cfg->memory, req.minimumSupportedMemorySize);
+        VZVirtualMachineConfiguration *conf = vz_configuration(cfg, hw, mid, aux, &err);
+        if (!conf) {
+            return vz_error(@"invalid VM configuration", err);
+        }
+
+        vmQueue = dispatch_queue_create("io.blacktop.ipsw.vm", DISPATCH_QUEUE_SERIAL);
+        __block VZMacOSInstaller *installer = nil;
+        __block NSError *installErr = nil;
+        dispatch_semaphore_t done = dispatch_semaphore_create(0);
+        dispatch_sync(vmQueue, ^{
+            VZVirtualMachine *vm = [[VZVirtualMachine alloc] initWithConfiguration:conf queue:vmQueue];
+            installer = [[VZMacOSInstaller alloc] initWithVirtualMachine:vm restoreImageURL:fileURL(restore_image)];
+            [installer installWithCompletionHandler:^(NSError *err) {
+                installErr = err;
+                dispatch_semaphore_signal(done);
+            }];
+        });
+        while (dispatch_semaphore_wait(done, dispatch_time(DISPATCH_TIME_NOW, NSEC_PER_SEC)) != 0) {
+            __block double fraction = 0;
+            dispatch_sync(vmQueue, ^{
+                fraction = installer.progress.fractionCompleted;
+            });
+            goVZInstallProgress(fraction);
+        }
+        if (installErr) {
+            return vz_error(@"failed to install macOS", installErr);
+        }
+        goVZInstallProgress(1.0);
+    }
+    return NULL;
+}
+
+char *vz_run(vz_config_t *cfg) {
+    @autoreleasepool {
+        NSError *err = nil;
+        NSData *hwData = [NSData dataWithContentsOfURL:fileURL(cfg->hw_model)];
+        NSData *midData = [NSData dataWithContentsOfURL:fileURL(cfg->machine_id)];
+        if (!hwData || !midData) {
+            return vz_error(@"VM is missing its platform files (was it installed?)", nil);
+        }
+        VZMacHardwareModel *hw = [[VZMacHardwareModel alloc] initWithDataRepresentation:hwData];
+        VZMacMachineIdentifier *mid = [[VZMacMachineIdentifier alloc] initWithDataRepresentation:midData];
+        VZMacAuxiliaryStorage *aux = [[VZMacAuxiliaryStorage alloc] initWithURL:fileURL(cfg->aux)];
+        if (!hw || !mid || !hw.supported) {
+            return vz_error(@"VM hardware model is not supported on this host", nil);
+        }
+
+        VZVirtualMachineConfiguration *conf = vz_configuration(cfg, hw, mid, aux, &err);
+        if (!conf) {
+            return vz_error(@"invalid VM configuration", err);
+        }
+
+        vmQueue = dispatch_queue_create("io.blacktop.ipsw.vm", DISPATCH_QUEUE_SERIAL);
+        __block NSError *startErr = nil;
+        dispatch_semaphore_t started = dispatch_semaphore_create(0);
+        dispatch_sync(vmQueue, ^{
+            runningVM = [[VZVirtualMachine alloc] initWithConfiguration:conf queue:vmQueue];
+            void (^handler)(NSError *) = ^(NSError *err) {
+                startErr = err;
+                dispatch_semaphore_signal(started);
+            };
+            if (@available(macOS 13.0, *)) {
+                VZMacOSVirtualMachineStartOptions *opts = [[VZMacOSVirtualMachineStartOptions alloc] init];
+                opts.startUpFromMacOSRecovery = cfg->recovery;
+                [runningVM startWithOptions:opts completionHandler:handler];
+            } else {
+                [runningVM startWithCompletionHandler:handler];
+            }
+        });
+        dispatch_semaphore_wait(started, DISPATCH_TIME_FOREVER);
+        if (startErr) {
+            runningVM = nil;
+            return vz_error(@"failed to start VM", startErr);
+        }
+
+        for (;;) {
+            __block VZVirtualMachineState state;
+            dispatch_sync(vmQueue, ^{
+                state = runningVM.state;
+            });
+            if (state == VZVirtualMachineStateStopped || state == VZVirtualMachineStateError) {
+                break;
+            }
+            sleep(1);
+        }
+        runningVM = nil;
+    }
+    return NULL;
+}
+
+void vz_stop(void) {
+    if (!vmQueue) {
+        return;
+    }
+    dispatch_async(vmQueue, ^{
+        if (!runningVM) {
+            return;
+        }
+        NSError *err = nil;
+        if (runningVM.canRequestStop && [runningVM requestStopWithError:&err]) {
+            return;
+        }
+        if (@available(macOS 12.0, *)) {
+            [runningVM stopWithCompletionHandler:^(NSError *err) {}];
+        }
+    });
+}
@@ -0,0 +1,17 @@
+//go:build !(darwin && arm64 && cgo && vz)
+
+package vm
+
+import "fmt"
+
+var errNoVZ = fmt.Errorf("macOS VMs require the Apple Silicon macOS build of ipsw compiled with `-tags vz` (and signed with the com.apple.security.virtualization entitlement)")
+
+// Install installs macOS into the VM from the restore image (.ipsw)
+func (c *Config) Install(restoreImage string, progress func(float64)) error {
+	return errNoVZ
+}
+
+// Run boots the VM and blocks until it shuts down (Ctrl+C requests a guest shutdown)
+func (c *Config) Run(opts *RunOptions) error {
+	return errNoVZ
+}
@@ -0,0 +1,245 @@
+// Package webhook notifies HTTP endpoints (Slack, Teams or generic JSON consumers) of ipswd events
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// Events
+const (
+	EventScanComplete = "scan.complete"  // a symbol server scan (or rescan) finished
+	EventScanFailed   = "scan.failed"    // a symbol server scan (or rescan) failed
+	EventDiffReady    = "diff.ready"     // an IPSW diff report was written
+	EventDiffFailed   = "diff.failed"    // an IPSW diff failed
+	EventNewBuild     = "feed.new_build" // a watched feed has a new build
+)
+
+// Formats
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+	FormatTeams   = "teams"
+)
+
+const (
+	attempts = 3
+	timeout  = 10 * time.Second
+)
+
+var templates = map[string]string{
+	FormatSlack: `{"text": {{ json .Text }}}`,
+	FormatTeams: `{"@type": "MessageCard", "@context": "https://schema.org/extensions", "summary": {{ json .Title }}, "title": {{ json .Title }},` +
+		` "sections": [{"facts": [{{ range $i, $k := .Keys }}{{ if $i }}, {{ end }}{"name": {{ json $k }}, "value": {{ json (index $.Data $k) }}}{{ end }}]}]}`,
+}
+
+// Hook is a webhook endpoint
+type Hook struct {
+	URL string `json:"url" mapstructure:"url"`
+	// events to send (i.e. scan.complete or scan.*); empty is every event
+	Events []string `json:"events,omitempty" mapstructure:"events"`
+	// slack, teams or generic (the JSON event)
+	Format string `json:"format,omitempty" mapstructure:"format"`
+	// text/template for the request body (overrides the format's payload)
+	Template string            `json:"template,omitempty" mapstructure:"template"`
+	Headers  map[string]string `json:"headers,omitempty" mapstructure:"headers"`
+	// signs the body with HMAC-SHA256 in the X-Ipsw-Signature header
+	Secret string `json:"secret,omitempty" mapstructure:"secret"`
+
+	tmpl *template.Template
+}
+
+func (h *Hook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(h.Events, func(pattern string) bool {
+		match, _ := path.Match(pattern, event)
+		return match
+	})
+}
+
+// Event is sent to the webhooks (and is the template data)
+type Event struct {
+	Event string            `json:"event"`
+	Time  time.Time         `json:"time"`
+	Title string            `json:"title"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Keys returns the event's sorted data keys
+func (e Event) Keys() []string {
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Text returns the event as a (Slack mrkdwn) chat message
+func (e Event) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%s*", e.Title)
+	for _, k := range e.Keys() {
+		fmt.Fprintf(&sb, "\n• %s: %s", k, e.Data[k])
+	}
+	return sb.String()
+}
+
+// Dispatcher sends events to the webhooks
+type Dispatcher struct {
+	hooks  []*Hook
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher validates the webhooks (and parses their templates)
+func NewDispatcher(hooks []*Hook) (*Dispatcher, error) {
+	for _, h := range hooks {
+		if h.URL == "" {
+			return nil, fmt.Errorf("webhook: url cannot be empty")
+		}
+		if h.Format == "" {
+			h.Format = FormatGeneric
+		}
+		text := h.Template
+		if text == "" {
+			switch h.Format {
+			case FormatGeneric:
+			case FormatSlack, FormatTeams:
+				text = templates[h.Format]
+			default:
+				return nil, fmt.Errorf("webhook %s: invalid format '%s' (must be %s, %s or %s)", h.URL, h.Format, FormatGeneric, FormatSlack, FormatTeams)
+			}
+		}
+		if text != "" {
+			tmpl, err := template.New(h.URL).Funcs(template.FuncMap{
+				"json": func(v any) (string, error) {
+					data, err := json.Marshal(v)
+					return string(data), err
+				},
+			}).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: invalid template: %v", h.URL, err)
+			}
+			h.tmpl = tmpl
+		}
+	}
+	return &Dispatcher{
+		hooks:  hooks,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Fire sends the event to every webhook that wants it (in the background)
+func (d *Dispatcher) Fire(event, title string, data map[string]string) {
+	if d == nil {
+		return
+	}
+	e := Event{Event: event, Time: time.Now().UTC(), Title: title, Data: data}
+	for _, h := range d.hooks {
+		if !h.wants(event) {
+			continue
+		}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			if err := d.send(context.Background(), h, e); err != nil {
+				log.WithFields(log.Fields{"webhook": h.URL, "event": event}).Errorf("failed to send webhook: %v", err)
+			}
+		}()
+	}
+}
+
+// Wait waits for the in-flight webhooks to be sent
+func (d *Dispatcher) Wait() {
+	if d != nil {
+		d.wg.Wait()
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, h *Hook, e Event) error {
+	var body bytes.Buffer
+	if h.tmpl != nil {
+		if err := h.tmpl.Execute(&body, e); err != nil {
+			return fmt.Errorf("failed to render template: %v", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(e); err != nil {
+		return err
+	}
+	var err error
+	for attempt := range attempts {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<attempt) * time.Second)
+		}
+		if err = d.post(ctx, h, body.Bytes()); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (d *Dispatcher) post(ctx context.Context, h *Hook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ipswd")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Ipsw-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status: %s", resp.Status)
+	}
+	return nil
+}
+
+var (
+	mu  sync.Mutex
+	def *Dispatcher
+)
+
+// SetDefault configures the dispatcher used by Fire (nil disables webhooks)
+func SetDefault(d *Dispatcher) {
+	mu.Lock()
+	def = d
+	mu.Unlock()
+}
+
+// Default returns the process wide dispatcher (which is nil, a no-op, if there are no webhooks)
+func Default() *Dispatcher {
+	mu.Lock()
+	defer mu.Unlock()
+	return def
+}
+
+// Fire sends the event to the default dispatcher's webhooks
+func Fire(event, title string, data map[string]string) {
+	Default().Fire(event, title, data)
+}
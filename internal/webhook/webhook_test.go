@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFire(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = string(data)
+		if r.URL.Path == "/generic" && !strings.HasPrefix(r.Header.Get("X-Ipsw-Signature"), "sha256=") {
+			t.Error("missing signature header")
+		}
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	d, err := NewDispatcher([]*Hook{
+		{URL: srv.URL + "/generic", Secret: "s3cr3t"},
+		{URL: srv.URL + "/slack", Format: FormatSlack, Events: []string{"scan.*"}},
+		{URL: srv.URL + "/teams", Format: FormatTeams},
+		{URL: srv.URL + "/custom", Template: `{{ .Event }} {{ index .Data "build" }}`},
+		{URL: srv.URL + "/other", Events: []string{EventDiffReady}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Fire(EventScanComplete, "Scanned iPhone15,2_17.4_21E219_Restore.ipsw", map[string]string{"build": "21E219", "version": "17.4"})
+	d.Wait()
+
+	if len(bodies) != 4 {
+		t.Fatalf("expected 4 webhooks to fire, got %v", bodies)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(bodies["/generic"]), &e); err != nil || e.Event != EventScanComplete || e.Data["build"] != "21E219" {
+		t.Errorf("generic payload = %s (%v)", bodies["/generic"], err)
+	}
+	var slack struct{ Text string }
+	if err := json.Unmarshal([]byte(bodies["/slack"]), &slack); err != nil || !strings.Contains(slack.Text, "• version: 17.4") {
+		t.Errorf("slack payload = %s (%v)", bodies["/slack"], err)
+	}
+	var teams map[string]any
+	if err := json.Unmarshal([]byte(bodies["/teams"]), &teams); err != nil {
+		t.Errorf("teams payload is invalid JSON: %s (%v)", bodies["/teams"], err)
+	}
+	if bodies["/custom"] != "scan.complete 21E219" {
+		t.Errorf("custom payload = %s", bodies["/custom"])
+	}
+
+	if _, err := NewDispatcher([]*Hook{{URL: srv.URL, Format: "irc"}}); err == nil {
+		t.Error("expected an invalid format error")
+	}
+}
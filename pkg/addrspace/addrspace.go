@@ -0,0 +1,253 @@
+// Package addrspace composes the kernelcache, dyld_shared_cache and MachO mappings of a firmware build into
+// a single address space so that an address can be resolved to the artifact, image and symbol it belongs to.
+package addrspace
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// Kind is the kind of artifact an address belongs to
+type Kind string
+
+const (
+	Kernelcache Kind = "kernelcache"
+	SharedCache Kind = "dyld_shared_cache"
+	MachO       Kind = "macho"
+)
+
+// Location is what an address resolves to
+type Location struct {
+	Address  uint64 `json:"address"`
+	Unslid   uint64 `json:"unslid"` // address with the artifact's slide removed
+	Kind     Kind   `json:"kind"`
+	Artifact string `json:"artifact"`        // path to the kernelcache, dyld_shared_cache or MachO
+	Image    string `json:"image,omitempty"` // kext bundle ID or dylib install name
+	Segment  string `json:"segment,omitempty"`
+	Section  string `json:"section,omitempty"`
+	Symbol   string `json:"symbol,omitempty"`
+	Offset   uint64 `json:"offset,omitempty"` // from the start of the symbol
+}
+
+func (l Location) String() string {
+	out := fmt.Sprintf("%#x", l.Address)
+	if len(l.Symbol) > 0 {
+		out = l.Symbol
+		if l.Offset > 0 {
+			out += fmt.Sprintf(" + %d", l.Offset)
+		}
+	}
+	image := l.Image
+	if len(image) == 0 {
+		image = filepath.Base(l.Artifact)
+	}
+	if len(l.Section) > 0 {
+		return fmt.Sprintf("%s (%s %s.%s)", out, image, l.Segment, l.Section)
+	} else if len(l.Segment) > 0 {
+		return fmt.Sprintf("%s (%s %s)", out, image, l.Segment)
+	}
+	return fmt.Sprintf("%s (%s)", out, image)
+}
+
+// region is an (unslid) address range of an artifact
+type region struct {
+	start    uint64
+	end      uint64
+	slide    uint64
+	kind     Kind
+	artifact string
+	image    string
+	resolve  func(addr uint64, loc *Location) error // fills in the image, segment, section and symbol of addr
+}
+
+// FirmwareAddressSpace is the combined address space of a firmware's kernelcache, dyld_shared_caches and MachOs
+//
+// NOTE: regions are added with the slide they were loaded at (i.e. from a crashlog) and Resolve takes slid addresses
+type FirmwareAddressSpace struct {
+	mu       sync.Mutex
+	regions  []region
+	analyzed map[*dyld.CacheImage]bool
+}
+
+// New returns an empty firmware address space
+func New() *FirmwareAddressSpace {
+	return &FirmwareAddressSpace{analyzed: make(map[*dyld.CacheImage]bool)}
+}
+
+func (as *FirmwareAddressSpace) add(r region) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	idx := sort.Search(len(as.regions), func(i int) bool { return as.regions[i].start+as.regions[i].slide > r.start+r.slide })
+	as.regions = append(as.regions, region{})
+	copy(as.regions[idx+1:], as.regions[idx:])
+	as.regions[idx] = r
+}
+
+// addSegments adds a MachO's segments (that are mapped into memory) as regions
+func (as *FirmwareAddressSpace) addSegments(m *macho.File, kind Kind, artifact, image string, slide uint64) int {
+	resolve := func(addr uint64, loc *Location) error {
+		resolveMachO(m, addr, loc)
+		return nil
+	}
+	var count int
+	for _, seg := range m.Segments() {
+		if seg.Memsz == 0 || seg.Name == "__PAGEZERO" || (kind == Kernelcache && seg.Name == "__LINKEDIT") {
+			continue // a fileset's __LINKEDIT is shared by all of its entries
+		}
+		as.add(region{
+			start:    seg.Addr,
+			end:      seg.Addr + seg.Memsz,
+			slide:    slide,
+			kind:     kind,
+			artifact: artifact,
+			image:    image,
+			resolve:  resolve,
+		})
+		count++
+	}
+	return count
+}
+
+// AddKernelcache adds the kernelcache's kexts (or segments for non MH_FILESET kernelcaches) to the address space
+func (as *FirmwareAddressSpace) AddKernelcache(path string, m *macho.File, slide uint64) error {
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		if as.addSegments(m, Kernelcache, path, "", slide) == 0 {
+			return fmt.Errorf("kernelcache %s has no segments", path)
+		}
+		return nil
+	}
+	for _, fe := range m.FileSets() {
+		mfe, err := m.GetFileSetFileByName(fe.EntryID)
+		if err != nil {
+			return fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+		}
+		as.addSegments(mfe, Kernelcache, path, fe.EntryID, slide)
+	}
+	return nil
+}
+
+// AddMachO adds a MachO's segments to the address space
+func (as *FirmwareAddressSpace) AddMachO(path string, m *macho.File, slide uint64) error {
+	image := path
+	if id := m.DylibID(); id != nil {
+		image = id.Name
+	}
+	if as.addSegments(m, MachO, path, image, slide) == 0 {
+		return fmt.Errorf("MachO %s has no segments", path)
+	}
+	return nil
+}
+
+// AddSharedCache adds the dyld_shared_cache's shared region to the address space
+func (as *FirmwareAddressSpace) AddSharedCache(path string, f *dyld.File, slide uint64) error {
+	hdr, ok := f.Headers[f.UUID]
+	if !ok || hdr.SharedRegionSize == 0 {
+		return fmt.Errorf("dyld_shared_cache %s has no shared region", path)
+	}
+	as.add(region{
+		start:    hdr.SharedRegionStart,
+		end:      hdr.SharedRegionStart + hdr.SharedRegionSize,
+		slide:    slide,
+		kind:     SharedCache,
+		artifact: path,
+		resolve: func(addr uint64, loc *Location) error {
+			return as.resolveSharedCache(f, addr, loc)
+		},
+	})
+	return nil
+}
+
+// Resolve returns the artifact, image and symbol that a (slid) address belongs to
+func (as *FirmwareAddressSpace) Resolve(addr uint64) (*Location, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	// regions are sorted by their slid start address (and the smallest containing region wins for overlaps)
+	idx := sort.Search(len(as.regions), func(i int) bool { return as.regions[i].start+as.regions[i].slide > addr })
+	var match *region
+	for i := idx - 1; i >= 0; i-- {
+		r := &as.regions[i]
+		if addr < r.end+r.slide && (match == nil || r.end-r.start < match.end-match.start) {
+			match = r
+		}
+	}
+	if match == nil {
+		return nil, errcode.Errorf(errcode.NotFound, "address %#x is not in the firmware address space", addr)
+	}
+	loc := &Location{
+		Address:  addr,
+		Unslid:   addr - match.slide,
+		Kind:     match.kind,
+		Artifact: match.artifact,
+		Image:    match.image,
+	}
+	if err := match.resolve(loc.Unslid, loc); err != nil {
+		return nil, fmt.Errorf("failed to resolve %#x in %s: %w", addr, match.artifact, err)
+	}
+	return loc, nil
+}
+
+// resolveMachO fills in the segment, section and symbol of addr in a MachO
+func resolveMachO(m *macho.File, addr uint64, loc *Location) {
+	if seg := m.FindSegmentForVMAddr(addr); seg != nil {
+		loc.Segment = seg.Name
+	}
+	if sec := m.FindSectionForVMAddr(addr); sec != nil {
+		loc.Section = sec.Name
+	}
+	if syms, err := m.FindAddressSymbols(addr); err == nil && len(syms) > 0 {
+		loc.Symbol = syms[0].Name
+		return
+	}
+	if fn, err := m.GetFunctionForVMAddr(addr); err == nil {
+		loc.Symbol = fmt.Sprintf("func_%x", fn.StartAddr)
+		if syms, err := m.FindAddressSymbols(fn.StartAddr); err == nil && len(syms) > 0 {
+			loc.Symbol = syms[0].Name
+		}
+		loc.Offset = addr - fn.StartAddr
+	}
+}
+
+// resolveSharedCache fills in the dylib, segment, section and symbol of addr in a dyld_shared_cache
+func (as *FirmwareAddressSpace) resolveSharedCache(f *dyld.File, addr uint64, loc *Location) error {
+	image, err := f.GetImageContainingVMAddr(addr)
+	if err != nil { // in the shared region, but not in an image (i.e. stub islands)
+		loc.Symbol = f.AddressToSymbol[addr]
+		return nil
+	}
+	loc.Image = image.Name
+	m, err := image.GetMacho()
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", image.Name, err)
+	}
+	if seg := m.FindSegmentForVMAddr(addr); seg != nil {
+		loc.Segment = seg.Name
+	}
+	if sec := m.FindSectionForVMAddr(addr); sec != nil {
+		loc.Section = sec.Name
+	}
+	if !as.analyzed[image] {
+		if err := image.Analyze(); err != nil {
+			return fmt.Errorf("failed to parse %s symbols: %v", image.Name, err)
+		}
+		as.analyzed[image] = true
+	}
+	if sym, ok := f.AddressToSymbol[addr]; ok {
+		loc.Symbol = sym
+		return nil
+	}
+	if fn, err := m.GetFunctionForVMAddr(addr); err == nil {
+		loc.Symbol = fmt.Sprintf("func_%x", fn.StartAddr)
+		if sym, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+			loc.Symbol = sym
+		}
+		loc.Offset = addr - fn.StartAddr
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package addrspace_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/addrspace"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/fixture"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+
+	kc := fixture.NewKernelcache()
+	kc.AddKext("com.apple.driver.FakeDriver", "1.0.0", "_fake_start")
+	kcPath := filepath.Join(dir, "kernelcache")
+	if err := kc.WriteFile(kcPath); err != nil {
+		t.Fatal(err)
+	}
+	k, err := macho.Open(kcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort")
+	dscPath := filepath.Join(dir, "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(dscPath); err != nil {
+		t.Fatal(err)
+	}
+	f, err := dyld.Open(dscPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	dylib := fixture.NewMachO(types.MH_DYLIB)
+	dylib.InstallName = "/usr/lib/libfixture.dylib"
+	dylib.Segments[0].AddSection("__text", []byte{0x1f, 0x20, 0x03, 0xd5, 0xc0, 0x03, 0x5f, 0xd6})
+	dylib.AddSymbol("_fixture", "__TEXT", "__text", 0)
+	dylibPath := filepath.Join(dir, "libfixture.dylib")
+	if err := dylib.WriteFile(dylibPath, 0x200000000); err != nil {
+		t.Fatal(err)
+	}
+	m, err := macho.Open(dylibPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	const kslide, slide = 0x4000, 0x10000
+	as := addrspace.New()
+	if err := as.AddKernelcache(kcPath, k, kslide); err != nil {
+		t.Fatal(err)
+	}
+	if err := as.AddSharedCache(dscPath, f, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := as.AddMachO(dylibPath, m, slide); err != nil {
+		t.Fatal(err)
+	}
+
+	kext, err := k.GetFileSetFileByName("com.apple.driver.FakeDriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, err := kext.FindSymbolAddress("_fake_start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := as.Resolve(start + kslide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Kind != addrspace.Kernelcache || loc.Image != "com.apple.driver.FakeDriver" || loc.Symbol != "_fake_start" || loc.Unslid != start {
+		t.Errorf("Resolve(_fake_start) = %+v", loc)
+	}
+
+	img, err := f.Image("libSystem.B.dylib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := img.GetMacho()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abort, err := im.FindSymbolAddress("_abort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc, err := as.Resolve(abort); err != nil || loc.Kind != addrspace.SharedCache || loc.Image != img.Name || loc.Symbol != "_abort" {
+		t.Errorf("Resolve(_abort) = %+v, %v", loc, err)
+	}
+
+	text := m.Section("__TEXT", "__text")
+	loc, err = as.Resolve(text.Addr + 4 + slide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Kind != addrspace.MachO || loc.Image != dylib.InstallName || loc.Section != "__text" {
+		t.Errorf("Resolve(_fixture+4) = %+v", loc)
+	}
+
+	if _, err := as.Resolve(0x10); !errors.Is(err, errcode.New(errcode.NotFound, "")) {
+		t.Errorf("Resolve(0x10) = %v, want not found", err)
+	}
+}
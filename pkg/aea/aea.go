@@ -18,6 +18,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/blacktop/ipsw/internal/offline"
 	"github.com/cloudflare/circl/hpke"
 )
 
@@ -96,7 +97,7 @@ func (md Metadata) GetPrivateKey(data []byte, pemDB string, skipEmbedded bool) (
 		}
 	}
 
-	if pemDB != "" {
+	if pemDB = offline.PathOr(pemDB, offline.FcsKeys); pemDB != "" {
 		pemData, err := os.ReadFile(pemDB)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read pem DB JSON '%s': %w", pemDB, err)
@@ -0,0 +1,362 @@
+// Package callgraph builds and queries function call graphs of arm64 MachOs, kexts and dyld_shared_cache images
+package callgraph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// EdgeKind is how the caller reaches the callee
+type EdgeKind string
+
+const (
+	Call     EdgeKind = "call"     // direct `bl`
+	TailCall EdgeKind = "tailcall" // `b` outside of the caller
+	Stub     EdgeKind = "stub"     // call through a resolved symbol stub
+	ObjC     EdgeKind = "objc"     // objc_msgSend hint (selector implementations)
+	Indirect EdgeKind = "indirect" // `blr` through a function pointer loaded from constant data (GOT, vtables, etc)
+)
+
+// Node is a function in the call graph
+type Node struct {
+	Addr     uint64 `json:"addr"`
+	Name     string `json:"name"`
+	Image    string `json:"image,omitempty"`
+	External bool   `json:"external,omitempty"` // an import whose implementation wasn't scanned
+}
+
+// Edge is a call from one function to another
+type Edge struct {
+	From uint64   `json:"from"`
+	To   uint64   `json:"to"`
+	Site uint64   `json:"site"` // address of the call instruction
+	Kind EdgeKind `json:"kind"`
+}
+
+// StringRef is a C string referenced by a function
+type StringRef struct {
+	Func  uint64 `json:"func"`
+	Site  uint64 `json:"site"` // address of the instruction that computes the string's address
+	Addr  uint64 `json:"addr"`
+	Value string `json:"value"`
+}
+
+type edgeKey struct {
+	from, to uint64
+	kind     EdgeKind
+}
+
+// Graph is a call graph
+type Graph struct {
+	Nodes   map[uint64]*Node
+	Edges   []Edge
+	Strings []StringRef // only recorded when the scanner is given Config.IsCString
+
+	seen map[edgeKey]bool
+	out  map[uint64][]int
+	in   map[uint64][]int
+}
+
+// New returns an empty call graph
+func New() *Graph {
+	return &Graph{
+		Nodes: make(map[uint64]*Node),
+		seen:  make(map[edgeKey]bool),
+		out:   make(map[uint64][]int),
+		in:    make(map[uint64][]int),
+	}
+}
+
+// AddNode adds the function at addr (or fills in what is missing from an existing node)
+func (g *Graph) AddNode(addr uint64, name, image string, external bool) *Node {
+	if n, ok := g.Nodes[addr]; ok {
+		if n.External && !external { // we found the implementation
+			n.Name, n.Image, n.External = name, image, false
+		} else if len(n.Name) == 0 || strings.HasPrefix(n.Name, "sub_") {
+			n.Name = name
+		}
+		if len(image) > 0 && !external {
+			n.Image = image // only the scanner knows which image a function is in
+		}
+		return n
+	}
+	if len(name) == 0 {
+		name = fmt.Sprintf("sub_%x", addr)
+	}
+	n := &Node{Addr: addr, Name: name, Image: image, External: external}
+	g.Nodes[addr] = n
+	return n
+}
+
+// AddEdge adds a call (duplicate caller/callee/kind edges are dropped)
+func (g *Graph) AddEdge(e Edge) {
+	k := edgeKey{e.From, e.To, e.Kind}
+	if g.seen[k] {
+		return
+	}
+	g.seen[k] = true
+	g.Edges = append(g.Edges, e)
+	g.out[e.From] = append(g.out[e.From], len(g.Edges)-1)
+	g.in[e.To] = append(g.in[e.To], len(g.Edges)-1)
+}
+
+// Callees returns the calls made by the function at addr
+func (g *Graph) Callees(addr uint64) []Edge {
+	var edges []Edge
+	for _, idx := range g.out[addr] {
+		edges = append(edges, g.Edges[idx])
+	}
+	return edges
+}
+
+// Callers returns the calls made to the function at addr
+func (g *Graph) Callers(addr uint64) []Edge {
+	var edges []Edge
+	for _, idx := range g.in[addr] {
+		edges = append(edges, g.Edges[idx])
+	}
+	return edges
+}
+
+// Find returns the nodes matching query which is either a symbol (with or without the leading underscore),
+// an address or an image/kext (i.e. 'AppleH13CamIn' matches every function in com.apple.driver.AppleH13CamIn)
+func (g *Graph) Find(query string) []*Node {
+	var nodes []*Node
+	for _, n := range g.Nodes {
+		if n.Name == query || n.Name == "_"+query || fmt.Sprintf("%#x", n.Addr) == strings.ToLower(query) {
+			nodes = append(nodes, n)
+		} else if len(n.Image) > 0 && !n.External &&
+			(n.Image == query || filepath.Base(n.Image) == query || strings.HasSuffix(n.Image, "."+query)) {
+			nodes = append(nodes, n)
+		}
+	}
+	slices.SortFunc(nodes, func(a, b *Node) int { return cmpAddr(a.Addr, b.Addr) })
+	return nodes
+}
+
+func cmpAddr(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Path returns the shortest call chain from any of the from nodes to any of the to nodes (nil if unreachable)
+func (g *Graph) Path(from, to []*Node) []Edge {
+	targets := make(map[uint64]bool)
+	for _, n := range to {
+		targets[n.Addr] = true
+	}
+	prev := make(map[uint64]int) // node -> edge used to reach it
+	var queue []uint64
+	visited := make(map[uint64]bool)
+	for _, n := range from {
+		if targets[n.Addr] {
+			return []Edge{}
+		}
+		visited[n.Addr] = true
+		queue = append(queue, n.Addr)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, idx := range g.out[cur] {
+			next := g.Edges[idx].To
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			prev[next] = idx
+			if targets[next] {
+				var path []Edge
+				for addr := next; ; {
+					idx, ok := prev[addr]
+					if !ok {
+						break
+					}
+					path = append([]Edge{g.Edges[idx]}, path...)
+					addr = g.Edges[idx].From
+				}
+				return path
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// Subgraph returns the part of the graph (and its string references) reachable from roots in at most depth calls (0 is unlimited)
+func (g *Graph) Subgraph(roots []*Node, depth int) *Graph {
+	sub := New()
+	level := make(map[uint64]int)
+	var queue []uint64
+	for _, n := range roots {
+		sub.Nodes[n.Addr] = n
+		level[n.Addr] = 0
+		queue = append(queue, n.Addr)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if depth > 0 && level[cur] >= depth {
+			continue
+		}
+		for _, idx := range g.out[cur] {
+			e := g.Edges[idx]
+			sub.AddEdge(e)
+			if _, ok := sub.Nodes[e.To]; !ok {
+				sub.Nodes[e.To] = g.Nodes[e.To]
+				level[e.To] = level[cur] + 1
+				queue = append(queue, e.To)
+			}
+		}
+	}
+	for _, s := range g.Strings {
+		if _, ok := sub.Nodes[s.Func]; ok {
+			sub.Strings = append(sub.Strings, s)
+		}
+	}
+	return sub
+}
+
+func (g *Graph) sortedNodes() []*Node {
+	nodes := make([]*Node, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n)
+	}
+	slices.SortFunc(nodes, func(a, b *Node) int { return cmpAddr(a.Addr, b.Addr) })
+	return nodes
+}
+
+// WriteDOT writes the graph in Graphviz DOT format
+func (g *Graph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph callgraph {\n\tnode [shape=box fontname=\"Menlo\"];"); err != nil {
+		return err
+	}
+	for _, n := range g.sortedNodes() {
+		attrs := fmt.Sprintf("label=%q", n.Name)
+		if n.External {
+			attrs += " style=dashed"
+		}
+		if len(n.Image) > 0 {
+			attrs += fmt.Sprintf(" tooltip=%q", fmt.Sprintf("%s %#x", n.Image, n.Addr))
+		}
+		if _, err := fmt.Fprintf(w, "\t\"%#x\" [%s];\n", n.Addr, attrs); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		switch e.Kind {
+		case TailCall:
+			attrs = " [style=bold]"
+		case Stub:
+			attrs = " [color=gray40]"
+		case ObjC, Indirect:
+			attrs = fmt.Sprintf(" [style=dashed label=%q]", e.Kind)
+		}
+		if _, err := fmt.Fprintf(w, "\t\"%#x\" -> \"%#x\"%s;\n", e.From, e.To, attrs); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string         `xml:"id,attr"`
+		EdgeDefault string         `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode  `xml:"node"`
+		Edges       []graphMLEdges `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdges struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// WriteGraphML writes the graph in GraphML format (for Gephi, yEd, Cytoscape, etc)
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	var doc graphML
+	doc.XMLNS = "http://graphml.graphdrawing.org/xmlns"
+	doc.Keys = []graphMLKey{
+		{ID: "name", For: "node", Name: "name", Type: "string"},
+		{ID: "image", For: "node", Name: "image", Type: "string"},
+		{ID: "external", For: "node", Name: "external", Type: "boolean"},
+		{ID: "kind", For: "edge", Name: "kind", Type: "string"},
+		{ID: "site", For: "edge", Name: "site", Type: "string"},
+	}
+	doc.Graph.ID = "callgraph"
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range g.sortedNodes() {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: fmt.Sprintf("%#x", n.Addr),
+			Data: []graphMLData{
+				{Key: "name", Value: n.Name},
+				{Key: "image", Value: n.Image},
+				{Key: "external", Value: fmt.Sprintf("%t", n.External)},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdges{
+			Source: fmt.Sprintf("%#x", e.From),
+			Target: fmt.Sprintf("%#x", e.To),
+			Data: []graphMLData{
+				{Key: "kind", Value: string(e.Kind)},
+				{Key: "site", Value: fmt.Sprintf("%#x", e.Site)},
+			},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteJSON writes the graph's nodes and edges as JSON
+func (g *Graph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(struct {
+		Nodes []*Node `json:"nodes"`
+		Edges []Edge  `json:"edges"`
+	}{
+		Nodes: g.sortedNodes(),
+		Edges: g.Edges,
+	})
+}
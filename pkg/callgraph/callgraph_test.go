@@ -0,0 +1,124 @@
+package callgraph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	funcs := map[uint64]string{0x1000: "_foo", 0x1010: "_bar", 0x1020: "_baz", 0x2000: "j__copyin"}
+	conf := &Config{
+		Image: "com.apple.driver.AppleFoo",
+		Symbol: func(addr uint64) (string, bool) {
+			name, ok := funcs[addr]
+			return name, ok
+		},
+		Stubs:      map[uint64]uint64{0x2000: 0x9000},
+		IsFunction: func(addr uint64) bool { return addr == 0x1000 || addr == 0x1010 || addr == 0x1020 },
+	}
+
+	g := New()
+	g.Scan(0x1000, 0x1010, []byte{
+		0x04, 0x00, 0x00, 0x94, // 0x1000: bl  _bar
+		0x07, 0x00, 0x00, 0x14, // 0x1004: b   _baz
+	}, conf)
+	g.Scan(0x1010, 0x1020, []byte{
+		0xfc, 0x03, 0x00, 0x94, // 0x1010: bl  j__copyin
+		0xc0, 0x03, 0x5f, 0xd6, // 0x1014: ret
+	}, conf)
+
+	if got := len(g.Callees(0x1000)); got != 2 {
+		t.Fatalf("Callees(_foo) = %d, want 2", got)
+	}
+	if e := g.Callees(0x1000)[1]; e.To != 0x1020 || e.Kind != TailCall {
+		t.Errorf("Callees(_foo)[1] = %+v, want tail call to _baz", e)
+	}
+	if n := g.Nodes[0x2000]; n == nil || n.Name != "_copyin" || !n.External {
+		t.Errorf("stub node = %+v, want external _copyin", n)
+	}
+
+	path := g.Path(g.Find("AppleFoo"), g.Find("copyin"))
+	if len(path) != 1 || path[0].From != 0x1010 || path[0].Kind != Stub {
+		t.Errorf("Path(AppleFoo, copyin) = %+v", path)
+	}
+	if path := g.Path(g.Find("_baz"), g.Find("copyin")); path != nil {
+		t.Errorf("Path(_baz, copyin) = %+v, want unreachable", path)
+	}
+
+	var buf bytes.Buffer
+	if err := g.Subgraph(g.Find("_foo"), 1).WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if dot := buf.String(); !strings.Contains(dot, `"0x1000" -> "0x1010";`) || strings.Contains(dot, "0x2000") {
+		t.Errorf("WriteDOT() =\n%s", dot)
+	}
+}
+
+func TestTaint(t *testing.T) {
+	code := []byte{
+		0x22, 0x08, 0x40, 0xb9, // 0x1000: ldr  w2, [x1, #8]
+		0x23, 0x00, 0x40, 0xf9, // 0x1004: ldr  x3, [x1]
+		0x84, 0x7a, 0x63, 0xf8, // 0x1008: ldr  x4, [x20, x3, lsl #3]
+		0xe0, 0x03, 0x13, 0xaa, // 0x100c: mov  x0, x19
+		0xfc, 0x03, 0x00, 0x94, // 0x1010: bl   j__memcpy
+		0xc0, 0x03, 0x5f, 0xd6, // 0x1014: ret
+	}
+	findings := Taint([]Entry{{Addr: 0x1000, Name: "_handler", Origin: "syscall", Args: []string{"x1"}}}, &TaintConfig{
+		Function: func(addr uint64) ([]byte, uint64, bool) {
+			return code, 0x1018, addr == 0x1000
+		},
+		Symbol: func(addr uint64) (string, bool) {
+			if addr == 0x2000 {
+				return "j__memcpy", true
+			}
+			return "", false
+		},
+	})
+	if len(findings) != 2 {
+		t.Fatalf("Taint() = %v, want 2 findings", findings)
+	}
+	if f := findings[0]; f.Addr != 0x1008 || f.Kind != TaintedIndex || f.Register != "x3" {
+		t.Errorf("Taint()[0] = %s, want tainted index x3", f)
+	}
+	if f := findings[1]; f.Addr != 0x1010 || f.Kind != TaintedLength || f.Sink != "_memcpy" || f.Checked {
+		t.Errorf("Taint()[1] = %s, want unchecked length to _memcpy", f)
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	strs := map[uint64]string{0x1100: "zone bound checks: %p", 0x1120: "copyin failed"}
+	conf := &Config{
+		Image: "com.apple.kernel",
+		Symbol: func(addr uint64) (string, bool) {
+			name, ok := map[uint64]string{0x1000: "_foo", 0x1010: "_bar"}[addr]
+			return name, ok
+		},
+		IsFunction: func(addr uint64) bool { return addr == 0x1000 || addr == 0x1010 },
+		IsCString:  func(addr uint64) bool { _, ok := strs[addr]; return ok },
+		CString:    func(addr uint64) (string, error) { return strs[addr], nil },
+	}
+
+	g := New()
+	g.Scan(0x1000, 0x1010, []byte{
+		0x00, 0x08, 0x00, 0x10, // 0x1000: adr x0, 0x1100
+		0xc0, 0x03, 0x5f, 0xd6, // 0x1004: ret
+	}, conf)
+	g.Scan(0x1010, 0x1020, []byte{
+		0x00, 0x00, 0x00, 0x90, // 0x1010: adrp x0, 0x1000
+		0x00, 0x00, 0x04, 0x91, // 0x1014: add  x0, x0, #0x100
+		0x01, 0x00, 0x00, 0x90, // 0x1018: adrp x1, 0x1000
+		0x21, 0x80, 0x04, 0x91, // 0x101c: add  x1, x1, #0x120
+	}, conf)
+
+	idx := g.StringIndex("")
+	if len(idx) != 2 {
+		t.Fatalf("StringIndex() = %+v, want 2 strings", idx)
+	}
+	if s := idx[0]; s.Value != strs[0x1100] || len(s.Xrefs) != 2 || s.Xrefs[0].Name != "_foo" || s.Xrefs[1].Name != "_bar" || s.Xrefs[1].Site != 0x1014 {
+		t.Errorf("StringIndex()[0] = %+v", s)
+	}
+	if idx := g.StringIndex("copyin"); len(idx) != 1 || idx[0].Addr != 0x1120 || idx[0].Image != "com.apple.kernel" {
+		t.Errorf("StringIndex(copyin) = %+v", idx)
+	}
+}
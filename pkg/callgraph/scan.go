@@ -0,0 +1,213 @@
+package callgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// DefaultMaxIndirectTargets caps the number of ObjC implementations a single objc_msgSend hint can fan out to
+const DefaultMaxIndirectTargets = 16
+
+// Config is what the scanner needs to know about the binary being scanned
+type Config struct {
+	Image    string
+	Indirect bool // add ObjC and function pointer hint edges
+
+	// Symbol returns the name of the symbol at addr
+	Symbol func(addr uint64) (string, bool)
+	// Stubs maps symbol stubs to the (resolved) address they branch to
+	Stubs map[uint64]uint64
+	// IsFunction returns true if addr is the start of a function that was (or will be) scanned
+	IsFunction func(addr uint64) bool
+	// ReadPointer returns the (unslid) pointer at addr
+	ReadPointer func(addr uint64) (uint64, error)
+	// CString returns the C string at addr
+	CString func(addr uint64) (string, error)
+	// IsCString returns true if addr is in a C string section (references to them are recorded in Graph.Strings)
+	IsCString func(addr uint64) bool
+	// Selectors maps ObjC selectors to their method implementations
+	Selectors          map[string][]uint64
+	MaxIndirectTargets int
+}
+
+func (c *Config) symbol(addr uint64) string {
+	if c.Symbol != nil {
+		if name, ok := c.Symbol(addr); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func regNum(r disassemble.Register) string {
+	name := r.String()
+	if len(name) > 1 && (name[0] == 'w' || name[0] == 'x') {
+		return name[1:]
+	}
+	return name
+}
+
+// Scan adds the calls made by the function [start, end) whose instructions are data to the graph
+func (g *Graph) Scan(start, end uint64, data []byte, conf *Config) {
+	var instrValue uint32
+	var results [1024]byte
+
+	g.AddNode(start, conf.symbol(start), conf.Image, false)
+
+	addrs := make(map[string]uint64)  // registers holding a known address
+	loaded := make(map[string]uint64) // registers holding a value loaded from a known address
+
+	r := bytes.NewReader(data)
+	addr := start
+
+	for {
+		if err := binary.Read(r, binary.LittleEndian, &instrValue); err == io.EOF {
+			break
+		}
+
+		instruction, err := disassemble.Decompose(addr, instrValue, &results)
+		if err != nil || len(instruction.Operands) == 0 {
+			addr += 4
+			continue
+		}
+
+		ops := instruction.Operands
+		var dst string
+		if ops[0].Class == disassemble.REG && len(ops[0].Registers) > 0 {
+			dst = regNum(ops[0].Registers[0])
+		}
+
+		switch instruction.Operation {
+		case disassemble.ARM64_ADR, disassemble.ARM64_ADRP:
+			delete(loaded, dst)
+			addrs[dst] = ops[1].Immediate
+			if instruction.Operation == disassemble.ARM64_ADR {
+				g.stringRef(start, instruction.Address, addrs[dst], conf)
+			}
+		case disassemble.ARM64_ADD:
+			delete(loaded, dst)
+			if len(ops) > 2 && len(ops[1].Registers) > 0 && (ops[2].Class == disassemble.IMM32 || ops[2].Class == disassemble.IMM64) {
+				if base, ok := addrs[regNum(ops[1].Registers[0])]; ok {
+					addrs[dst] = base + ops[2].GetImmediate()
+					g.stringRef(start, instruction.Address, addrs[dst], conf)
+					break
+				}
+			}
+			delete(addrs, dst)
+		case disassemble.ARM64_LDR, disassemble.ARM64_LDRAA, disassemble.ARM64_LDRAB:
+			delete(addrs, dst)
+			delete(loaded, dst)
+			if len(ops) > 1 && ops[1].Class == disassemble.MEM_OFFSET && len(ops[1].Registers) > 0 {
+				if base, ok := addrs[regNum(ops[1].Registers[0])]; ok {
+					loaded[dst] = base + ops[1].Immediate
+				}
+			} else if len(ops) > 1 && ops[1].Class == disassemble.LABEL { // ldr literal
+				loaded[dst] = ops[1].Immediate
+			}
+		case disassemble.ARM64_BL, disassemble.ARM64_B:
+			if len(ops) == 0 || ops[0].Class != disassemble.LABEL {
+				break
+			}
+			target := ops[0].Immediate
+			if instruction.Operation == disassemble.ARM64_B && start <= target && target < end {
+				break // local branch
+			}
+			kind := Call
+			if instruction.Operation == disassemble.ARM64_B {
+				kind = TailCall
+			}
+			g.call(start, target, instruction.Address, kind, conf)
+			if conf.Indirect && instruction.Operation == disassemble.ARM64_BL {
+				g.objcHint(start, target, instruction.Address, loaded, conf)
+			}
+			// the callee clobbers the argument/temporary registers
+			for reg := range addrs {
+				delete(addrs, reg)
+			}
+			for reg := range loaded {
+				delete(loaded, reg)
+			}
+		case disassemble.ARM64_BLR, disassemble.ARM64_BLRAA, disassemble.ARM64_BLRAAZ, disassemble.ARM64_BLRAB, disassemble.ARM64_BLRABZ,
+			disassemble.ARM64_BR, disassemble.ARM64_BRAA, disassemble.ARM64_BRAAZ, disassemble.ARM64_BRAB, disassemble.ARM64_BRABZ:
+			if !conf.Indirect || conf.ReadPointer == nil {
+				break
+			}
+			if from, ok := loaded[dst]; ok {
+				if ptr, err := conf.ReadPointer(from); err == nil && ptr != 0 {
+					if conf.IsFunction == nil || conf.IsFunction(ptr) {
+						g.AddNode(ptr, conf.symbol(ptr), "", false)
+						g.AddEdge(Edge{From: start, To: ptr, Site: instruction.Address, Kind: Indirect})
+					}
+				}
+			}
+		default:
+			if len(dst) > 0 {
+				delete(addrs, dst)
+				delete(loaded, dst)
+			}
+		}
+
+		addr += 4
+	}
+}
+
+// stringRef records a reference to a C string
+func (g *Graph) stringRef(fn, site, addr uint64, conf *Config) {
+	if conf.IsCString == nil || conf.CString == nil || !conf.IsCString(addr) {
+		return
+	}
+	if str, err := conf.CString(addr); err == nil {
+		g.Strings = append(g.Strings, StringRef{Func: fn, Site: site, Addr: addr, Value: str})
+	}
+}
+
+// call adds a direct call edge following symbol stubs through to their implementation
+func (g *Graph) call(from, target, site uint64, kind EdgeKind, conf *Config) {
+	name := conf.symbol(target)
+	if impl, ok := conf.Stubs[target]; ok {
+		name = strings.TrimPrefix(name, "j_")
+		if conf.IsFunction != nil && conf.IsFunction(impl) {
+			g.AddNode(impl, conf.symbol(impl), "", false)
+			g.AddEdge(Edge{From: from, To: impl, Site: site, Kind: Stub})
+			return
+		}
+		g.AddNode(target, name, "", true)
+		g.AddEdge(Edge{From: from, To: target, Site: site, Kind: Stub})
+		return
+	}
+	external := conf.IsFunction != nil && !conf.IsFunction(target)
+	g.AddNode(target, name, "", external)
+	g.AddEdge(Edge{From: from, To: target, Site: site, Kind: kind})
+}
+
+// objcHint adds edges from an objc_msgSend call to the implementations of its selector
+func (g *Graph) objcHint(from, target, site uint64, loaded map[string]uint64, conf *Config) {
+	name := strings.TrimPrefix(conf.symbol(target), "j_")
+	if !strings.Contains(name, "objc_msgSend") || len(conf.Selectors) == 0 {
+		return
+	}
+	var sel string
+	if _, after, ok := strings.Cut(name, "$"); ok { // selector stubs (_objc_msgSend$sel)
+		sel = after
+	} else if selRef, ok := loaded["1"]; ok && conf.ReadPointer != nil && conf.CString != nil {
+		if ptr, err := conf.ReadPointer(selRef); err == nil {
+			sel, _ = conf.CString(ptr)
+		}
+	}
+	impls := conf.Selectors[sel]
+	limit := conf.MaxIndirectTargets
+	if limit <= 0 {
+		limit = DefaultMaxIndirectTargets
+	}
+	if len(sel) == 0 || len(impls) == 0 || len(impls) > limit {
+		return
+	}
+	for _, impl := range impls {
+		g.AddNode(impl, conf.symbol(impl), "", false)
+		g.AddEdge(Edge{From: from, To: impl, Site: site, Kind: ObjC})
+	}
+}
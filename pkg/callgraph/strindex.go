@@ -0,0 +1,61 @@
+package callgraph
+
+import (
+	"slices"
+	"strings"
+)
+
+// StringXref is a function that references an indexed string
+type StringXref struct {
+	Func uint64 `json:"func"`
+	Name string `json:"name"`
+	Site uint64 `json:"site"` // address of the instruction that computes the string's address
+}
+
+// IndexedString is a C string and every function that references it
+type IndexedString struct {
+	Image string       `json:"image,omitempty"`
+	Addr  uint64       `json:"addr"`
+	Value string       `json:"value"`
+	Xrefs []StringXref `json:"xrefs"`
+}
+
+// StringIndex returns the C strings referenced by the graph's functions (grouped per image and string address)
+// that contain query (every string if query is empty) sorted by image and address
+//
+// NOTE: strings are only recorded when the graph was scanned with Config.IsCString
+func (g *Graph) StringIndex(query string) []IndexedString {
+	type key struct {
+		image string
+		addr  uint64
+	}
+	index := make(map[key]int)
+	var strs []IndexedString
+	for _, s := range g.Strings {
+		if !strings.Contains(s.Value, query) {
+			continue
+		}
+		var image, name string
+		if n, ok := g.Nodes[s.Func]; ok {
+			image, name = n.Image, n.Name
+		}
+		k := key{image, s.Addr}
+		i, ok := index[k]
+		if !ok {
+			i = len(strs)
+			index[k] = i
+			strs = append(strs, IndexedString{Image: image, Addr: s.Addr, Value: s.Value})
+		}
+		strs[i].Xrefs = append(strs[i].Xrefs, StringXref{Func: s.Func, Name: name, Site: s.Site})
+	}
+	for i := range strs {
+		slices.SortFunc(strs[i].Xrefs, func(a, b StringXref) int { return cmpAddr(a.Site, b.Site) })
+	}
+	slices.SortFunc(strs, func(a, b IndexedString) int {
+		if c := strings.Compare(a.Image, b.Image); c != 0 {
+			return c
+		}
+		return cmpAddr(a.Addr, b.Addr)
+	})
+	return strs
+}
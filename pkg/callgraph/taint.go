@@ -0,0 +1,364 @@
+package callgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// DefaultTaintDepth is how many calls deep tainted arguments are followed
+const DefaultTaintDepth = 2
+
+// FindingKind is why a spot was flagged
+type FindingKind string
+
+const (
+	TaintedLength      FindingKind = "length"      // user controlled size/length passed to a memory or allocation sink
+	TaintedDestination FindingKind = "destination" // user controlled pointer passed as a memory sink's destination
+	TaintedIndex       FindingKind = "index"       // user controlled index used to address kernel memory
+)
+
+// Sink is a function whose arguments are interesting when they are user controlled
+type Sink struct {
+	Length int // argument register holding the size/length (-1 if none)
+	Dest   int // argument register holding the destination pointer (-1 if none)
+}
+
+// DefaultSinks are the memory/length sinks checked for tainted arguments (keyed by symbol without leading underscores)
+var DefaultSinks = map[string]Sink{
+	"memcpy":                     {Length: 2, Dest: 0},
+	"memmove":                    {Length: 2, Dest: 0},
+	"memset":                     {Length: 2, Dest: 0},
+	"bcopy":                      {Length: 2, Dest: 1},
+	"bzero":                      {Length: 1, Dest: 0},
+	"copyin":                     {Length: 2, Dest: 1},
+	"copyout":                    {Length: 2, Dest: -1},
+	"copyinstr":                  {Length: 2, Dest: 1},
+	"copyoutstr":                 {Length: 2, Dest: -1},
+	"strlcpy":                    {Length: 2, Dest: 0},
+	"strncpy":                    {Length: 2, Dest: 0},
+	"kalloc_ext":                 {Length: 1, Dest: -1},
+	"kalloc_data":                {Length: 0, Dest: -1},
+	"kalloc_data_external":       {Length: 0, Dest: -1},
+	"IOMalloc":                   {Length: 0, Dest: -1},
+	"IOMallocData":               {Length: 0, Dest: -1},
+	"IOMallocZero":               {Length: 0, Dest: -1},
+	"IOMalloc_external":          {Length: 0, Dest: -1},
+	"IOMallocData_external":      {Length: 0, Dest: -1},
+	"ZN6OSData9withBytesEPKvj":   {Length: 1, Dest: -1},
+	"ZN6OSData9appendBytesEPKvj": {Length: 1, Dest: -1},
+}
+
+// Entry is a function whose argument registers are user controlled
+type Entry struct {
+	Addr   uint64
+	Name   string
+	Origin string   // what kind of entry point this is (i.e. syscall, mig, external method)
+	Args   []string // user controlled (or pointing to user controlled data) registers (i.e. x1)
+}
+
+// Finding is a candidate spot for review
+type Finding struct {
+	Entry    string      `json:"entry"`
+	Origin   string      `json:"origin,omitempty"`
+	Function string      `json:"function"`
+	Addr     uint64      `json:"addr"`
+	Kind     FindingKind `json:"kind"`
+	Sink     string      `json:"sink,omitempty"`
+	Register string      `json:"register"`
+	Checked  bool        `json:"checked"` // the register was compared (bounds checked?) before its use
+	Chain    []uint64    `json:"chain,omitempty"`
+}
+
+func (f Finding) String() string {
+	checked := "unchecked"
+	if f.Checked {
+		checked = "compared"
+	}
+	if len(f.Sink) > 0 {
+		return fmt.Sprintf("%#x: %s %s %s to %s (%s)", f.Addr, f.Function, checked, f.Kind, f.Sink, f.Register)
+	}
+	return fmt.Sprintf("%#x: %s %s %s (%s)", f.Addr, f.Function, checked, f.Kind, f.Register)
+}
+
+// TaintConfig is what the taint pass needs to know about the binary
+type TaintConfig struct {
+	// Function returns the instructions and end address of the function starting at addr
+	Function func(addr uint64) ([]byte, uint64, bool)
+	Symbol   func(addr uint64) (string, bool)
+	Stubs    map[uint64]uint64
+	Sinks    map[string]Sink // defaults to DefaultSinks
+	MaxDepth int             // defaults to DefaultTaintDepth
+}
+
+type taintState struct {
+	regs    map[string]bool
+	stack   map[string]bool // spilled stack slots
+	checked map[string]bool
+}
+
+type tainter struct {
+	conf     *TaintConfig
+	findings []Finding
+	seen     map[string]bool // function+args already analyzed
+	reported map[string]bool
+}
+
+// Taint runs a lightweight data-flow pass from each entry point's user controlled arguments into memory/length
+// sinks following tainted arguments into the functions they are passed to (up to MaxDepth calls deep)
+//
+// NOTE: this is intentionally a triage aid; it walks instructions linearly (no path sensitivity) and only
+// tracks registers and sp/fp spill slots so findings are candidates for manual review, not bugs.
+func Taint(entries []Entry, conf *TaintConfig) []Finding {
+	if conf.Sinks == nil {
+		conf.Sinks = DefaultSinks
+	}
+	if conf.MaxDepth <= 0 {
+		conf.MaxDepth = DefaultTaintDepth
+	}
+	t := &tainter{conf: conf, seen: make(map[string]bool), reported: make(map[string]bool)}
+	for _, e := range entries {
+		var args []string
+		for _, arg := range e.Args {
+			args = append(args, regName(arg))
+		}
+		t.function(e, e.Addr, args, []uint64{e.Addr}, 0)
+	}
+	return t.findings
+}
+
+// regName normalizes w/x register names so 32 and 64-bit views of a register match
+func regName(reg string) string {
+	reg = strings.ToLower(strings.TrimSpace(reg))
+	if len(reg) > 1 && (reg[0] == 'w' || reg[0] == 'x') {
+		return reg[1:]
+	}
+	if reg == "fp" {
+		return "29"
+	}
+	return reg
+}
+
+func (t *tainter) symbol(addr uint64) string {
+	if t.conf.Symbol != nil {
+		if sym, ok := t.conf.Symbol(addr); ok {
+			return sym
+		}
+	}
+	return fmt.Sprintf("sub_%x", addr)
+}
+
+// sink returns the sink called at target (following stubs)
+func (t *tainter) sink(target uint64) (string, Sink, bool) {
+	for _, addr := range []uint64{target, t.conf.Stubs[target]} {
+		if addr == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(t.symbol(addr), "j_")
+		if s, ok := t.conf.Sinks[strings.TrimLeft(name, "_")]; ok {
+			return name, s, true
+		}
+	}
+	return "", Sink{}, false
+}
+
+func (t *tainter) report(e Entry, fn uint64, f Finding, chain []uint64) {
+	key := fmt.Sprintf("%x:%s:%s", f.Addr, f.Kind, f.Register)
+	if t.reported[key] {
+		return
+	}
+	t.reported[key] = true
+	f.Entry, f.Origin, f.Function = e.Name, e.Origin, t.symbol(fn)
+	f.Chain = append([]uint64{}, chain...)
+	t.findings = append(t.findings, f)
+}
+
+func (t *tainter) function(e Entry, start uint64, args []string, chain []uint64, depth int) {
+	key := fmt.Sprintf("%x:%s", start, strings.Join(args, ","))
+	if t.seen[key] || t.conf.Function == nil {
+		return
+	}
+	t.seen[key] = true
+
+	data, end, ok := t.conf.Function(start)
+	if !ok {
+		return
+	}
+
+	st := &taintState{
+		regs:    make(map[string]bool),
+		stack:   make(map[string]bool),
+		checked: make(map[string]bool),
+	}
+	for _, arg := range args {
+		st.regs[arg] = true
+	}
+
+	var instrValue uint32
+	var results [1024]byte
+
+	r := bytes.NewReader(data)
+	addr := start
+
+	for {
+		if err := binary.Read(r, binary.LittleEndian, &instrValue); err == io.EOF {
+			break
+		}
+		instruction, err := disassemble.Decompose(addr, instrValue, &results)
+		if err != nil {
+			addr += 4
+			continue
+		}
+		t.step(e, start, end, instruction, st, chain, depth)
+		addr += 4
+	}
+}
+
+func memOperand(ops []disassemble.Operand) (int, bool) {
+	for idx, op := range ops {
+		switch op.Class {
+		case disassemble.MEM_REG, disassemble.MEM_PRE_IDX, disassemble.MEM_POST_IDX, disassemble.MEM_OFFSET, disassemble.MEM_EXTENDED:
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+func slotKey(op disassemble.Operand, extra uint64) (string, bool) {
+	if len(op.Registers) == 0 {
+		return "", false
+	}
+	base := regName(op.Registers[0].String())
+	if base != "sp" && base != "29" {
+		return "", false
+	}
+	return fmt.Sprintf("%s+%#x", base, op.Immediate+extra), true
+}
+
+func (t *tainter) step(e Entry, start, end uint64, instruction *disassemble.Instruction, st *taintState, chain []uint64, depth int) {
+	ops := instruction.Operands
+	mnemonic := instruction.Operation.String()
+
+	tainted := func(op disassemble.Operand) bool {
+		for _, reg := range op.Registers {
+			if st.regs[regName(reg.String())] {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case mnemonic == "cmp" || mnemonic == "cmn" || mnemonic == "ccmp" || mnemonic == "ccmn" || mnemonic == "tst":
+		for _, op := range ops {
+			if op.Class == disassemble.REG && len(op.Registers) > 0 {
+				st.checked[regName(op.Registers[0].String())] = true
+			}
+		}
+	case mnemonic == "bl" || (mnemonic == "b" && len(ops) > 0 && ops[0].Class == disassemble.LABEL && (ops[0].Immediate < start || ops[0].Immediate >= end)):
+		if len(ops) == 0 || ops[0].Class != disassemble.LABEL {
+			break
+		}
+		target := ops[0].Immediate
+		if name, s, ok := t.sink(target); ok {
+			if s.Length >= 0 {
+				if reg := fmt.Sprint(s.Length); st.regs[reg] {
+					t.report(e, start, Finding{Addr: instruction.Address, Kind: TaintedLength, Sink: name, Register: "x" + reg, Checked: st.checked[reg]}, chain)
+				}
+			}
+			if s.Dest >= 0 {
+				if reg := fmt.Sprint(s.Dest); st.regs[reg] {
+					t.report(e, start, Finding{Addr: instruction.Address, Kind: TaintedDestination, Sink: name, Register: "x" + reg, Checked: st.checked[reg]}, chain)
+				}
+			}
+		} else if depth < t.conf.MaxDepth {
+			var args []string
+			for i := range 8 {
+				if st.regs[fmt.Sprint(i)] {
+					args = append(args, fmt.Sprint(i))
+				}
+			}
+			if len(args) > 0 {
+				if impl, ok := t.conf.Stubs[target]; ok {
+					target = impl
+				}
+				t.function(e, target, args, append(chain, target), depth+1)
+			}
+		}
+		// the callee clobbers the argument/temporary registers (and returns an untainted x0)
+		for i := range 19 {
+			delete(st.regs, fmt.Sprint(i))
+			delete(st.checked, fmt.Sprint(i))
+		}
+	case strings.HasPrefix(mnemonic, "ld"):
+		midx, ok := memOperand(ops)
+		if !ok {
+			break
+		}
+		mem := ops[midx]
+		src := tainted(mem)
+		if mem.Class == disassemble.MEM_EXTENDED && len(mem.Registers) > 1 {
+			base, index := regName(mem.Registers[0].String()), regName(mem.Registers[1].String())
+			if st.regs[index] && !st.regs[base] {
+				t.report(e, start, Finding{Addr: instruction.Address, Kind: TaintedIndex, Register: mem.Registers[1].String(), Checked: st.checked[index]}, chain)
+			}
+		}
+		for i, op := range ops[:midx] { // ldp loads two registers
+			if op.Class != disassemble.REG || len(op.Registers) == 0 {
+				continue
+			}
+			dst := regName(op.Registers[0].String())
+			val := src
+			if key, ok := slotKey(mem, uint64(i*8)); ok {
+				val = st.stack[key]
+			}
+			st.regs[dst] = val
+			delete(st.checked, dst)
+		}
+	case strings.HasPrefix(mnemonic, "st"):
+		midx, ok := memOperand(ops)
+		if !ok {
+			break
+		}
+		mem := ops[midx]
+		if mem.Class == disassemble.MEM_EXTENDED && len(mem.Registers) > 1 {
+			base, index := regName(mem.Registers[0].String()), regName(mem.Registers[1].String())
+			if st.regs[index] && !st.regs[base] {
+				t.report(e, start, Finding{Addr: instruction.Address, Kind: TaintedIndex, Register: mem.Registers[1].String(), Checked: st.checked[index]}, chain)
+			}
+		}
+		for i, op := range ops[:midx] { // stp stores two registers
+			if op.Class != disassemble.REG || len(op.Registers) == 0 {
+				continue
+			}
+			if key, ok := slotKey(mem, uint64(i*8)); ok {
+				st.stack[key] = st.regs[regName(op.Registers[0].String())]
+			}
+		}
+	case mnemonic == "b" || strings.HasPrefix(mnemonic, "b.") || strings.HasPrefix(mnemonic, "br") || strings.HasPrefix(mnemonic, "blr") ||
+		strings.HasPrefix(mnemonic, "cb") || strings.HasPrefix(mnemonic, "tb") || strings.HasPrefix(mnemonic, "ret") ||
+		mnemonic == "nop" || strings.HasPrefix(mnemonic, "pac") || strings.HasPrefix(mnemonic, "aut"):
+		// control flow/pointer auth doesn't change taint
+	default:
+		if len(ops) == 0 || ops[0].Class != disassemble.REG || len(ops[0].Registers) == 0 {
+			break
+		}
+		dst := regName(ops[0].Registers[0].String())
+		val := false
+		for _, op := range ops[1:] {
+			if op.Class == disassemble.REG && tainted(op) {
+				val = true
+			}
+		}
+		st.regs[dst] = val
+		if mnemonic != "mov" {
+			delete(st.checked, dst)
+		} else if len(ops) > 1 && len(ops[1].Registers) > 0 {
+			st.checked[dst] = st.checked[regName(ops[1].Registers[0].String())]
+		}
+	}
+}
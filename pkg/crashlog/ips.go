@@ -27,6 +27,7 @@ import (
 	"github.com/blacktop/ipsw/internal/search"
 	"github.com/blacktop/ipsw/internal/swift"
 	"github.com/blacktop/ipsw/internal/syms/server"
+	"github.com/blacktop/ipsw/pkg/addrspace"
 	"github.com/blacktop/ipsw/pkg/disass"
 	"github.com/blacktop/ipsw/pkg/signature"
 	"github.com/fatih/color"
@@ -765,6 +766,7 @@ func (i *Ips) Symbolicate210(ipswPath string) (err error) {
 
 	/* SYMBOLICATE KERNELCACHE */
 	var kc *macho.File
+	kas := addrspace.New()
 	{
 		out, err := extract.Kernelcache(&extract.Config{
 			IPSW:         ipswPath,
@@ -799,6 +801,9 @@ func (i *Ips) Symbolicate210(ipswPath string) (err error) {
 				return fmt.Errorf("failed to open kernelcache: %v", err)
 			}
 			defer kc.Close()
+			if err := kas.AddKernelcache(k, kc, 0); err != nil {
+				return fmt.Errorf("failed to map kernelcache: %v", err)
+			}
 
 			if kc.FileTOC.FileHeader.Type == types.MH_FILESET {
 				for _, fe := range kc.FileSets() {
@@ -1041,10 +1046,15 @@ func (i *Ips) Symbolicate210(ipswPath string) (err error) {
 						// if i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].ImageName == "??" {
 						// 	i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].ImageName += " (??? maybe kext?)"
 						// }
-						if seg := kc.FindSegmentForVMAddr(i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].ImageOffset); seg != nil {
-							i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].Symbol = seg.Name
-							if sec := kc.FindSectionForVMAddr(i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].ImageOffset); sec != nil {
-								i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].Symbol += "." + sec.Name
+						if loc, err := kas.Resolve(i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].ImageOffset); err == nil {
+							if len(loc.Symbol) > 0 {
+								i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].Symbol = demangleSym(i.Config.Demangle, loc.Symbol)
+								i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].SymbolLocation = loc.Offset
+							} else {
+								i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].Symbol = loc.Image + "." + loc.Segment
+								if len(loc.Section) > 0 {
+									i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].Symbol += "." + loc.Section
+								}
 							}
 						} else {
 							i.Payload.ProcessByPid[pid].ThreadByID[tid].KernelFrames[idx].Symbol = "???"
@@ -0,0 +1,468 @@
+// Package devicedb is a structured database of Apple devices that maps device identifiers (i.e. iPhone15,2) to their
+// boards/models (i.e. D73AP), chips, marketing names, display traits and supported OS ranges.
+//
+// It merges the embedded ipsw device DB (see info.GetIpswDB, which honors offline data bundles) with Xcode's device
+// traits and can be enriched with OS ranges from a releases snapshot (see AddRelease). The download/extract commands
+// use it to validate and autocomplete their --device/--model flags.
+package devicedb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/blacktop/ipsw/pkg/xcode"
+	"github.com/hashicorp/go-version"
+)
+
+var identifierRE = regexp.MustCompile(`^[a-zA-Z]+[0-9]+,[0-9]+$`)
+
+// Board is a hardware board (model) of a device
+type Board struct {
+	Model           string `json:"model"`              // i.e. D73AP
+	Chip            string `json:"chip,omitempty"`     // i.e. A16 Bionic
+	Platform        string `json:"platform,omitempty"` // i.e. t8120
+	PlatformName    string `json:"platform_name,omitempty"`
+	ChipID          string `json:"cpid,omitempty"`
+	BoardID         string `json:"bdid,omitempty"`
+	Arch            string `json:"arch,omitempty"`
+	KernelCacheType string `json:"kc_type,omitempty"`
+}
+
+// Display are the display traits of a device (from Xcode)
+type Display struct {
+	ScaleFactor int    `json:"scale_factor,omitempty"`
+	Gamut       string `json:"gamut,omitempty"`
+	DynamicMode string `json:"dynamic_mode,omitempty"`
+}
+
+// OSRange is the range of OS versions released for a device
+type OSRange struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+
+	min, max *version.Version
+}
+
+func (r *OSRange) add(v *version.Version) {
+	if r.min == nil || v.LessThan(r.min) {
+		r.min = v
+		r.Min = v.Original()
+	}
+	if r.max == nil || v.GreaterThan(r.max) {
+		r.max = v
+		r.Max = v.Original()
+	}
+}
+
+// Contains reports whether the version is in the range
+func (r *OSRange) Contains(v *version.Version) bool {
+	return r.min != nil && !v.LessThan(r.min) && !v.GreaterThan(r.max)
+}
+
+// String returns the range as 'min-max'
+func (r *OSRange) String() string {
+	if r.Min == r.Max {
+		return r.Min
+	}
+	return r.Min + "-" + r.Max
+}
+
+// Device is a device of the database
+type Device struct {
+	Identifier string              `json:"identifier"` // i.e. iPhone15,2
+	Name       string              `json:"name,omitempty"`
+	Type       string              `json:"type,omitempty"` // i.e. ios, macos, watchos
+	SDK        string              `json:"sdk,omitempty"`
+	MemClass   uint64              `json:"mem_class,omitempty"`
+	Boards     []Board             `json:"boards,omitempty"`
+	Display    *Display            `json:"display,omitempty"`
+	OS         map[string]*OSRange `json:"os,omitempty"` // OS name (i.e. iOS) -> versions released for the device
+}
+
+// Known reports whether the device is a product (and not a prototype, simulator or unidentified accessory)
+func (d *Device) Known() bool {
+	name := strings.ToLower(d.Name)
+	if d.Type == "" || d.Type == "unknown" || name == "ifpga" {
+		return false
+	}
+	for _, suffix := range []string{"sim", "xxx", "ref"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// Chips returns the device's unique chip names
+func (d *Device) Chips() []string {
+	var chips []string
+	for _, b := range d.Boards {
+		if b.Chip != "" && !utils.StrSliceHas(chips, b.Chip) {
+			chips = append(chips, b.Chip)
+		}
+	}
+	return chips
+}
+
+// Models returns the device's board models
+func (d *Device) Models() []string {
+	models := make([]string, 0, len(d.Boards))
+	for _, b := range d.Boards {
+		models = append(models, b.Model)
+	}
+	return models
+}
+
+// DB is the device database
+type DB struct {
+	devices map[string]*Device // lowercased identifier -> device
+	models  map[string]*Device // lowercased board model -> device
+}
+
+// Load loads the device database
+func Load() (*DB, error) {
+	ipswDB, err := info.GetIpswDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ipsw device DB: %w", err)
+	}
+	traits, err := xcode.GetDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Xcode device traits: %w", err)
+	}
+	return New(*ipswDB, traits), nil
+}
+
+// New creates a device database from an ipsw device DB and Xcode device traits
+func New(ipswDB info.Devices, traits []xcode.Device) *DB {
+	db := &DB{
+		devices: make(map[string]*Device),
+		models:  make(map[string]*Device),
+	}
+	for id, d := range ipswDB {
+		dev := &Device{
+			Identifier: id,
+			Name:       d.Name,
+			Type:       d.Type,
+			SDK:        d.SDKPlatform,
+			MemClass:   d.MemClass,
+		}
+		for model, b := range d.Boards {
+			dev.Boards = append(dev.Boards, Board{
+				Model:           model,
+				Chip:            b.CPU,
+				Platform:        b.Platform,
+				PlatformName:    b.PlatformName,
+				ChipID:          b.ChipID,
+				BoardID:         b.BoardID,
+				Arch:            b.Arch,
+				KernelCacheType: b.KernelCacheType,
+			})
+		}
+		db.add(dev)
+	}
+	for _, t := range traits {
+		if strings.Contains(t.ProductType, "-") {
+			continue // regional variants (i.e. iPad14,3-A) of a device
+		}
+		dev, ok := db.devices[strings.ToLower(t.ProductType)]
+		if !ok {
+			dev = &Device{Identifier: t.ProductType, Name: t.ProductDescription}
+			db.add(dev)
+		}
+		if dev.Name == "" {
+			dev.Name = t.ProductDescription
+		}
+		if dev.Type == "" || dev.Type == "unknown" {
+			dev.Type = typeOf(dev.Identifier)
+		}
+		if dev.MemClass == 0 {
+			dev.MemClass = uint64(t.DeviceTrait.DevicePerformanceMemoryClass)
+		}
+		if dev.Display == nil && t.DeviceTrait.ArtworkScaleFactor > 0 {
+			dev.Display = &Display{
+				ScaleFactor: t.DeviceTrait.ArtworkScaleFactor,
+				Gamut:       t.DeviceTrait.ArtworkDisplayGamut,
+				DynamicMode: t.DeviceTrait.ArtworkDynamicDisplayMode,
+			}
+		}
+		if _, ok := db.models[strings.ToLower(t.Target)]; !ok && t.Target != "" {
+			dev.Boards = append(dev.Boards, Board{
+				Model:    strings.ToUpper(t.Target),
+				Platform: t.Platform,
+				Arch:     t.DeviceTrait.PreferredArchitecture,
+			})
+			db.models[strings.ToLower(t.Target)] = dev
+		}
+	}
+	for _, dev := range db.devices {
+		sort.Slice(dev.Boards, func(i, j int) bool { return dev.Boards[i].Model < dev.Boards[j].Model })
+	}
+	return db
+}
+
+// typeOf returns the type of a device from its identifier's family
+func typeOf(identifier string) string {
+	switch family := utils.DeconstructDevice(identifier).Family; family {
+	case "iPhone", "iPad", "iPod":
+		return "ios"
+	case "Watch":
+		return "watchos"
+	case "AppleTV":
+		return "tvos"
+	case "AudioAccessory":
+		return "audioos"
+	case "RealityDevice":
+		return "visionos"
+	default:
+		if strings.Contains(family, "Mac") {
+			return "macos"
+		}
+		return "unknown"
+	}
+}
+
+func (db *DB) add(dev *Device) {
+	db.devices[strings.ToLower(dev.Identifier)] = dev
+	for _, b := range dev.Boards {
+		db.models[strings.ToLower(b.Model)] = dev
+	}
+}
+
+// AddRelease records that the OS version was released for the devices (extending their OS ranges)
+func (db *DB) AddRelease(os, ver string, identifiers ...string) {
+	v, err := version.NewVersion(ver)
+	if err != nil {
+		return
+	}
+	for _, id := range identifiers {
+		dev, ok := db.devices[strings.ToLower(id)]
+		if !ok {
+			continue
+		}
+		if dev.OS == nil {
+			dev.OS = make(map[string]*OSRange)
+		}
+		r, ok := dev.OS[os]
+		if !ok {
+			r = &OSRange{}
+			dev.OS[os] = r
+		}
+		r.add(v)
+	}
+}
+
+func less(a, b string) bool {
+	x, y := utils.DeconstructDevice(a), utils.DeconstructDevice(b)
+	if x.Family == "" || y.Family == "" {
+		return strings.ToLower(a) < strings.ToLower(b)
+	}
+	return fmt.Sprintf("%s%03d%03d", x.Family, x.Major, x.Minor) < fmt.Sprintf("%s%03d%03d", y.Family, y.Major, y.Minor)
+}
+
+// Devices returns all the devices sorted by identifier
+func (db *DB) Devices() []*Device {
+	devs := make([]*Device, 0, len(db.devices))
+	for _, dev := range db.devices {
+		devs = append(devs, dev)
+	}
+	sort.Slice(devs, func(i, j int) bool { return less(devs[i].Identifier, devs[j].Identifier) })
+	return devs
+}
+
+// Lookup returns the device with the identifier (case-insensitive)
+func (db *DB) Lookup(identifier string) (*Device, bool) {
+	dev, ok := db.devices[strings.ToLower(identifier)]
+	return dev, ok
+}
+
+// LookupModel returns the device with the board model (i.e. D73AP, case-insensitive)
+func (db *DB) LookupModel(model string) (*Device, bool) {
+	dev, ok := db.models[strings.ToLower(model)]
+	return dev, ok
+}
+
+// Query filters the devices (empty fields match everything)
+type Query struct {
+	Identifier string // identifier prefix (i.e. iPhone15)
+	Name       string // marketing name substring (i.e. iPhone 14)
+	Model      string // board model (i.e. D73AP)
+	Chip       string // chip name or platform (i.e. A16 Bionic or t8120)
+	Type       string // device type (i.e. ios)
+	OS         string // OS version the device must support, optionally prefixed with the OS name (i.e. 17.0 or iOS 17.0)
+	All        bool   // include prototypes, simulators and unidentified devices
+}
+
+func (q *Query) match(dev *Device) bool {
+	if !q.All && !dev.Known() {
+		return false
+	}
+	if q.Identifier != "" && !strings.HasPrefix(strings.ToLower(dev.Identifier), strings.ToLower(q.Identifier)) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(dev.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.Type != "" && !strings.EqualFold(dev.Type, q.Type) {
+		return false
+	}
+	if q.Model != "" && !dev.hasBoard(func(b Board) bool { return strings.EqualFold(b.Model, q.Model) }) {
+		return false
+	}
+	if q.Chip != "" && !dev.hasBoard(func(b Board) bool {
+		return strings.EqualFold(b.Chip, q.Chip) || strings.EqualFold(b.Platform, q.Chip)
+	}) {
+		return false
+	}
+	if q.OS != "" {
+		osName, ver, ok := strings.Cut(q.OS, " ")
+		if !ok {
+			osName, ver = "", q.OS
+		}
+		v, err := version.NewVersion(ver)
+		if err != nil {
+			return false
+		}
+		supported := false
+		for name, r := range dev.OS {
+			if (osName == "" || strings.EqualFold(name, osName)) && r.Contains(v) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Device) hasBoard(match func(Board) bool) bool {
+	for _, b := range d.Boards {
+		if match(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns the devices that match the query sorted by identifier
+func (db *DB) Query(q *Query) []*Device {
+	var devs []*Device
+	for _, dev := range db.Devices() {
+		if q.match(dev) {
+			devs = append(devs, dev)
+		}
+	}
+	return devs
+}
+
+// suggest returns up to 3 keys of m closest to s
+func suggest[T any](m map[string]T, s string, name func(string) string) []string {
+	s = strings.ToLower(s)
+	type candidate struct {
+		key  string
+		dist int
+	}
+	var cands []candidate
+	for key := range m {
+		if d := distance(s, key); d <= 2 || (len(s) > 2 && strings.HasPrefix(key, s)) {
+			cands = append(cands, candidate{key, d})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].dist != cands[j].dist {
+			return cands[i].dist < cands[j].dist
+		}
+		return cands[i].key < cands[j].key
+	})
+	var out []string
+	for i := 0; i < len(cands) && i < 3; i++ {
+		out = append(out, name(cands[i].key))
+	}
+	return out
+}
+
+// distance is the Levenshtein distance between a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return " (did you mean: " + strings.Join(suggestions, ", ") + "?)"
+}
+
+// Validate checks a device identifier
+//
+// It returns an errcode.InvalidArgument error for malformed identifiers and an errcode.NotFound error for well formed
+// identifiers the database doesn't know about (which callers should only warn about as they may be newer than it)
+func (db *DB) Validate(identifier string) error {
+	if _, ok := db.Lookup(identifier); ok {
+		return nil
+	}
+	hint := didYouMean(suggest(db.devices, identifier, func(k string) string { return db.devices[k].Identifier }))
+	if !identifierRE.MatchString(identifier) {
+		if dev, ok := db.LookupModel(identifier); ok {
+			hint = fmt.Sprintf(" (%s is the board model of %s)", identifier, dev.Identifier)
+		}
+		return errcode.Errorf(errcode.InvalidArgument, "invalid device identifier '%s'%s", identifier, hint)
+	}
+	return errcode.Errorf(errcode.NotFound, "unknown device '%s'%s", identifier, hint)
+}
+
+// ValidateModel checks a board model (it returns an errcode.NotFound error for unknown models)
+func (db *DB) ValidateModel(model string) error {
+	if _, ok := db.LookupModel(model); ok {
+		return nil
+	}
+	if dev, ok := db.Lookup(model); ok {
+		return errcode.Errorf(errcode.InvalidArgument, "'%s' is a device identifier (its models are: %s)", model, strings.Join(dev.Models(), ", "))
+	}
+	hint := didYouMean(suggest(db.models, model, func(k string) string { return strings.ToUpper(k) }))
+	return errcode.Errorf(errcode.NotFound, "unknown device model '%s'%s", model, hint)
+}
+
+// Complete returns the shell completions ('identifier\tname') of the known devices starting with prefix
+func (db *DB) Complete(prefix string) []string {
+	var comps []string
+	for _, dev := range db.Query(&Query{Identifier: prefix}) {
+		comps = append(comps, dev.Identifier+"\t"+dev.Name)
+	}
+	return comps
+}
+
+// CompleteModel returns the shell completions ('model\tname') of the known device models starting with prefix
+func (db *DB) CompleteModel(prefix string) []string {
+	var comps []string
+	for _, dev := range db.Query(&Query{}) {
+		for _, b := range dev.Boards {
+			if strings.HasPrefix(strings.ToLower(b.Model), strings.ToLower(prefix)) {
+				comps = append(comps, b.Model+"\t"+dev.Name)
+			}
+		}
+	}
+	return comps
+}
@@ -0,0 +1,71 @@
+package devicedb
+
+import (
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/blacktop/ipsw/pkg/xcode"
+)
+
+func TestDB(t *testing.T) {
+	db := New(info.Devices{
+		"iPhone15,2": {Name: "iPhone 14 Pro", Type: "ios", Boards: map[string]info.Board{
+			"D73AP": {CPU: "A16 Bionic", Platform: "t8120", Arch: "arm64e"},
+		}},
+		"iPhone14,7": {Name: "iPhone 14", Type: "ios", Boards: map[string]info.Board{
+			"D27AP": {CPU: "A15 Bionic", Platform: "t8110"},
+		}},
+		"iPhone99,1": {Name: "iPhoneSim", Type: "ios"},
+	}, []xcode.Device{
+		{Target: "d73ap", ProductType: "iPhone15,2", DeviceTrait: xcode.DeviceTrait{ArtworkScaleFactor: 3, ArtworkDisplayGamut: "P3"}},
+		{Target: "j617ap", Platform: "t8112", ProductType: "iPad14,8", ProductDescription: "iPad Air 11-inch (M2)"},
+		{Target: "j617ap", ProductType: "iPad14,8-A"},
+	})
+
+	dev, ok := db.Lookup("iphone15,2")
+	if !ok || dev.Display == nil || dev.Display.Gamut != "P3" || len(dev.Boards) != 1 {
+		t.Fatalf("Lookup() = %+v, %t", dev, ok)
+	}
+	if dev, ok := db.LookupModel("j617ap"); !ok || dev.Identifier != "iPad14,8" || dev.Type != "ios" {
+		t.Errorf("LookupModel() = %+v, %t", dev, ok)
+	}
+	if _, ok := db.Lookup("iPad14,8-A"); ok {
+		t.Error("Lookup() found a regional variant")
+	}
+
+	if devs := db.Query(&Query{Chip: "T8120"}); len(devs) != 1 || devs[0].Identifier != "iPhone15,2" {
+		t.Errorf("Query(chip) = %v", devs)
+	}
+	if devs := db.Query(&Query{Identifier: "iPhone"}); len(devs) != 2 || devs[0].Identifier != "iPhone14,7" {
+		t.Errorf("Query(identifier) = %v", devs)
+	}
+	if devs := db.Query(&Query{Identifier: "iPhone", All: true}); len(devs) != 3 {
+		t.Errorf("Query(all) = %v", devs)
+	}
+
+	db.AddRelease("iOS", "16.0", "iPhone15,2", "iPhone14,7")
+	db.AddRelease("iOS", "17.1", "iPhone15,2")
+	if r := dev.OS["iOS"]; r == nil || r.String() != "16.0-17.1" {
+		t.Errorf("OS range = %v", r)
+	}
+	if devs := db.Query(&Query{OS: "iOS 17.0"}); len(devs) != 1 || devs[0].Identifier != "iPhone15,2" {
+		t.Errorf("Query(os) = %v", devs)
+	}
+
+	if err := db.Validate("iPhone15,2"); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := db.Validate("iPhone16,1"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("Validate(unknown) = %v", err)
+	}
+	if err := db.Validate("D73AP"); errcode.Of(err) != errcode.InvalidArgument {
+		t.Errorf("Validate(model) = %v", err)
+	}
+	if err := db.ValidateModel("D73"); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("ValidateModel(unknown) = %v", err)
+	}
+	if comps := db.Complete("iphone15"); len(comps) != 1 || comps[0] != "iPhone15,2\tiPhone 14 Pro" {
+		t.Errorf("Complete() = %v", comps)
+	}
+}
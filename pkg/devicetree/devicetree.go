@@ -300,6 +300,57 @@ func (dtree *DeviceTree) GetModel() (string, error) {
 	return "", fmt.Errorf("failed to get model")
 }
 
+// Find returns the properties of the node at the '/' separated path below the root node (i.e. "chosen/lock-regs")
+func (dtree *DeviceTree) Find(path string) (Properties, error) {
+	node, ok := (*dtree)["device-tree"]
+	if !ok {
+		return nil, fmt.Errorf("failed to find device-tree root node")
+	}
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		children, _ := node["children"].([]DeviceTree)
+		var found bool
+		for _, child := range children {
+			if props, ok := child[name]; ok {
+				node, found = props, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("failed to find node %s (in %s)", name, path)
+		}
+	}
+	return node, nil
+}
+
+// GetLockRegs returns the KTRR/CTRR lock register nodes below /chosen/lock-regs (keyed by their path)
+func (dtree *DeviceTree) GetLockRegs() (map[string]Properties, error) {
+	lockRegs, err := dtree.Find("chosen/lock-regs")
+	if err != nil {
+		return nil, err
+	}
+	regs := make(map[string]Properties)
+	var walk func(path string, node Properties)
+	walk = func(path string, node Properties) {
+		props := make(Properties)
+		for k, v := range node {
+			if k != "children" {
+				props[k] = v
+			}
+		}
+		if len(props) > 0 {
+			regs[path] = props
+		}
+		children, _ := node["children"].([]DeviceTree)
+		for _, child := range children {
+			for name, p := range child {
+				walk(path+"/"+name, p)
+			}
+		}
+	}
+	walk("lock-regs", lockRegs)
+	return regs, nil
+}
+
 func isZero(bytes []byte) bool {
 	b := byte(0)
 	for _, s := range bytes {
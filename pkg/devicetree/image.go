@@ -4,18 +4,18 @@ import (
 	"bytes"
 	"encoding/asn1"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 
 	// lzfse "github.com/blacktop/go-lzfse"
 
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/img3"
 	"github.com/blacktop/ipsw/pkg/lzfse"
 )
 
-var ErrEncryptedDeviceTree = errors.New("encrypted device tree")
+var ErrEncryptedDeviceTree = errcode.New(errcode.Encrypted, "encrypted device tree")
 
 // ParseImg3Data parses a img4 data containing a DeviceTree
 func ParseImg3Data(data []byte) (*DeviceTree, error) {
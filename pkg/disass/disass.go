@@ -21,6 +21,7 @@ type Disass interface {
 	IsLocation(uint64) bool
 	IsBranchLocation(uint64) (bool, uint64)
 	IsData(uint64) (bool, *AddrDetails)
+	IsJumpTable(uint64) (bool, *JumpTable)
 	IsPointer(uint64) (bool, *AddrDetails)
 	FindSymbol(uint64) (string, bool)
 	GetCString(uint64) (string, error)
@@ -140,11 +141,55 @@ func (d AddrDetails) String() string {
 	return fmt.Sprintf("%s.%s", d.Segment, d.Section)
 }
 
+// Instruction is a machine-readable disassembled instruction (the --json output)
+type Instruction struct {
+	Address     uint64                `json:"address"`
+	Bytes       string                `json:"bytes"`
+	Mnemonic    string                `json:"mnemonic"`
+	Operands    []disassemble.Operand `json:"operands,omitempty"`
+	Disassembly string                `json:"disassembly"`
+	Target      *Target               `json:"target,omitempty"`
+	Comment     string                `json:"comment,omitempty"`
+}
+
+// Target is the resolved address an instruction branches to or references
+type Target struct {
+	Address       uint64 `json:"address"`
+	Symbol        string `json:"symbol,omitempty"`
+	Section       string `json:"section,omitempty"`
+	Pointer       uint64 `json:"pointer,omitempty"`
+	PointerSymbol string `json:"pointer_symbol,omitempty"`
+	CString       string `json:"cstring,omitempty"`
+}
+
+func jsonComment(comment string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), ";"))
+}
+
 type Triage struct {
 	Details   map[uint64]AddrDetails
 	Function  *types.Function
 	Addresses map[uint64]uint64
 	Locations map[uint64][]uint64
+	// JumpTables are the switch statement jump tables keyed by their dispatching `br` address
+	JumpTables map[uint64]*JumpTable
+}
+
+// jumpTableData returns the directive and entries for a jump table word (so they aren't disassembled as code)
+func jumpTableData(jt *JumpTable, word uint32) (string, string) {
+	var entries []string
+	switch jt.EntrySize {
+	case 1:
+		for i := range 4 {
+			entries = append(entries, fmt.Sprintf("%#x", uint8(word>>(8*i))))
+		}
+		return ".byte", strings.Join(entries, ", ")
+	case 2:
+		entries = append(entries, fmt.Sprintf("%#x", uint16(word)), fmt.Sprintf("%#x", uint16(word>>16)))
+		return ".short", strings.Join(entries, ", ")
+	default:
+		return ".long", fmt.Sprintf("%#x", word)
+	}
 }
 
 func Disassemble(d Disass) {
@@ -152,7 +197,7 @@ func Disassemble(d Disass) {
 	var instrValue uint32
 	var results [1024]byte
 	var prevInstr *disassemble.Instruction
-	var instructions []disassemble.Instruction
+	var instructions []Instruction
 
 	r := bytes.NewReader(d.Data())
 
@@ -165,8 +210,34 @@ func Disassemble(d Disass) {
 			break
 		}
 
-		if !d.AsJSON() {
+		{ // scoped so the gotos below don't jump over declarations
 			var comment string
+			var target *Target
+			if ok, jt := d.IsJumpTable(startAddr); ok && jt.Contains(startAddr) {
+				op, oprs := jumpTableData(jt, instrValue)
+				comment = fmt.Sprintf(" ; jump table for %#x", jt.Branch)
+				if d.AsJSON() {
+					instructions = append(instructions, Instruction{
+						Address:     startAddr,
+						Bytes:       disassemble.GetOpCodeByteString(instrValue),
+						Mnemonic:    op,
+						Disassembly: op + " " + oprs,
+						Comment:     jsonComment(comment),
+					})
+				} else if d.Color() {
+					fmt.Printf("%s:  %s   %s %s%s\n",
+						colorAddr("%#08x", uint64(startAddr)),
+						colorOpCodes(disassemble.GetOpCodeByteString(instrValue)),
+						colorOp("%-7s", op),
+						ColorOperands(" "+oprs),
+						colorComment(comment),
+					)
+				} else {
+					fmt.Printf("%#08x:  %s   %s\t%s%s\n", uint64(startAddr), disassemble.GetOpCodeByteString(instrValue), op, oprs, comment)
+				}
+				prevInstr = nil
+				goto INCR_ADDR
+			}
 			instruction, err := disassemble.Decompose(startAddr, instrValue, &results)
 			if err != nil {
 				var op string
@@ -221,7 +292,15 @@ func Disassemble(d Disass) {
 					comment = fmt.Sprintf(" ; (%s)", err.Error())
 				}
 
-				if d.Color() {
+				if d.AsJSON() {
+					instructions = append(instructions, Instruction{
+						Address:     startAddr,
+						Bytes:       disassemble.GetOpCodeByteString(instrValue),
+						Mnemonic:    op,
+						Disassembly: strings.TrimSpace(op + "\t" + oprs),
+						Comment:     jsonComment(comment),
+					})
+				} else if d.Color() {
 					fmt.Printf("%s:  %s   %s %s%s\n",
 						colorAddr("%#08x", uint64(startAddr)),
 						colorOpCodes(disassemble.GetOpCodeByteString(instrValue)),
@@ -240,7 +319,9 @@ func Disassemble(d Disass) {
 
 			if !d.Quite() {
 				// check for start of a new function
-				if ok, fname := d.IsFunctionStart(instruction.Address); ok {
+				if d.AsJSON() {
+					// functions are grouped below
+				} else if ok, fname := d.IsFunctionStart(instruction.Address); ok {
 					if d.Color() {
 						fmt.Print(colorOp("\n%s:\n", fname))
 					} else {
@@ -256,7 +337,7 @@ func Disassemble(d Disass) {
 					}
 				}
 
-				if d.IsLocation(instruction.Address) {
+				if d.IsLocation(instruction.Address) && !d.AsJSON() {
 					if d.Color() {
 						fmt.Printf("%s\n", colorLocation("loc_%x", instruction.Address))
 					} else {
@@ -291,12 +372,17 @@ func Disassemble(d Disass) {
 							instrStr = fmt.Sprintf("%s\t%s", instruction.Operation, strings.Join(ops, ", "))
 						}
 					}
+				} else if ok, jt := d.IsJumpTable(instruction.Address); ok && jt.Branch == instruction.Address {
+					target = &Target{Address: jt.Table}
+					comment = fmt.Sprintf(" ; switch (%d cases) jump table %#x", len(jt.Targets), jt.Table)
 				} else if ok, loc := d.IsBranchLocation(instruction.Address); ok {
+					target = &Target{Address: loc}
 					opStr := strings.TrimPrefix(instrStr, fmt.Sprintf("%s\t", instruction.Operation))
 					for _, operand := range instruction.Operands {
 						if operand.Class == disassemble.LABEL {
 							if name, ok := d.FindSymbol(uint64(operand.Immediate)); ok {
 								opStr = name
+								target.Symbol = name
 							} else {
 								direction := ""
 								delta := int(loc) - int(instruction.Address)
@@ -313,24 +399,33 @@ func Disassemble(d Disass) {
 					}
 					instrStr = fmt.Sprintf("%s\t%s", instruction.Operation, opStr)
 				} else if instruction.Encoding == disassemble.ENC_BL_ONLY_BRANCH_IMM || instruction.Encoding == disassemble.ENC_B_ONLY_BRANCH_IMM {
+					target = &Target{Address: instruction.Operands[0].Immediate}
 					if name, ok := d.FindSymbol(uint64(instruction.Operands[0].Immediate)); ok {
 						instrStr = fmt.Sprintf("%s\t%s", instruction.Operation, name)
+						target.Symbol = name
 					}
 				} else if strings.Contains(instruction.Encoding.String(), "loadlit") {
+					target = &Target{Address: instruction.Operands[1].Immediate}
 					if name, ok := d.FindSymbol(uint64(instruction.Operands[1].Immediate)); ok {
 						comment = fmt.Sprintf(" ; %s", name)
+						target.Symbol = name
 					}
 				} else if instruction.Encoding == disassemble.ENC_CBZ_64_COMPBRANCH {
+					target = &Target{Address: instruction.Operands[1].Immediate}
 					if name, ok := d.FindSymbol(uint64(instruction.Operands[1].Immediate)); ok {
 						comment = fmt.Sprintf(" ; %s", name)
+						target.Symbol = name
 					}
 				} else if instruction.Operation == disassemble.ARM64_ADR {
 					opStr := strings.TrimPrefix(instrStr, fmt.Sprintf("%s\t", instruction.Operation))
 					for _, operand := range instruction.Operands {
 						if operand.Class == disassemble.LABEL {
+							target = &Target{Address: operand.Immediate}
 							if name, ok := d.FindSymbol(uint64(operand.Immediate)); ok {
 								opStr = strings.Replace(opStr, fmt.Sprintf("%#x", operand.Immediate), name, 1)
+								target.Symbol = name
 							} else if cstr, err := d.GetCString(uint64(operand.Immediate)); err == nil {
+								target.CString = cstr
 								if utils.IsASCII(cstr) {
 									if len(cstr) > 200 {
 										comment = fmt.Sprintf(" ; %#v...", cstr[:200])
@@ -358,29 +453,38 @@ func Disassemble(d Disass) {
 					} else if instruction.Operation == disassemble.ARM64_LDRSW && adrpRegister == instruction.Operands[1].Registers[0] {
 						adrpImm += instruction.Operands[1].Immediate
 					}
+					target = &Target{Address: adrpImm}
 					if name, ok := d.FindSymbol(uint64(adrpImm)); ok {
+						target.Symbol = name
 						if ok, detail := d.IsData(adrpImm); ok {
-							_ = detail
-							if ok, detail := d.IsPointer(adrpImm); ok {
+							target.Section = detail.String()
+							if ok, detail := d.IsPointer(adrpImm); ok && !d.AsJSON() {
 								fmt.Printf("ptr_%x: .quad %s ; %s\n", adrpImm, detail, name)
 							}
 							if ptr, err := d.ReadAddr(adrpImm); err == nil {
 								if ptrname, ok := d.FindSymbol(ptr); ok {
 									comment = fmt.Sprintf(" ; %s _ptr.%s", name, ptrname)
+									target.Pointer = ptr
+									target.PointerSymbol = ptrname
 								}
 							}
 						} else {
 							comment = fmt.Sprintf(" ; %s", name)
 						}
 					} else if ok, detail := d.IsPointer(adrpImm); ok {
+						target.Section = detail.String()
+						target.Pointer = detail.Pointer
 						if name, ok := d.FindSymbol(uint64(detail.Pointer)); ok {
 							comment = fmt.Sprintf(" ; _ptr.%s", name)
+							target.PointerSymbol = name
 						} else {
 							comment = fmt.Sprintf(" ; _ptr.%x (%s)", detail.Pointer, detail)
 						}
 					} else if ok, detail := d.IsData(adrpImm); ok {
+						target.Section = detail.String()
 						instrStr += fmt.Sprintf(" ; dat_%x (%s)", adrpImm, detail)
 					} else if cstr, err := d.GetCString(adrpImm); err == nil && len(cstr) > 0 {
+						target.CString = cstr
 						if utils.IsASCII(cstr) {
 							if len(cstr) > 200 {
 								comment = fmt.Sprintf(" ; %#v...", cstr[:200])
@@ -391,18 +495,31 @@ func Disassemble(d Disass) {
 							if ptr, err := d.ReadAddr(adrpImm); err == nil {
 								if name, ok := d.FindSymbol(ptr); ok {
 									comment = fmt.Sprintf(" ; _ptr.%s", name)
+									target.CString = ""
+									target.Pointer = ptr
+									target.PointerSymbol = name
 								}
 							}
 						}
 					}
 				}
 
-				if instruction.Encoding == disassemble.ENC_LDR_B_LDST_IMMPRE {
+				if instruction.Encoding == disassemble.ENC_LDR_B_LDST_IMMPRE && !d.AsJSON() {
 					fmt.Println(instrStr)
 				}
 			}
 
-			if d.Middle() != 0 && d.Middle() == startAddr {
+			if d.AsJSON() {
+				instructions = append(instructions, Instruction{
+					Address:     startAddr,
+					Bytes:       disassemble.GetOpCodeByteString(instrValue),
+					Mnemonic:    instruction.Operation.String(),
+					Operands:    instruction.Operands,
+					Disassembly: strings.Replace(instrStr, "\t", " ", 1),
+					Target:      target,
+					Comment:     jsonComment(comment),
+				})
+			} else if d.Middle() != 0 && d.Middle() == startAddr {
 				if d.Color() {
 					opStr := strings.TrimSpace(strings.TrimPrefix(instrStr, instruction.Operation.String()))
 					printCurLine("=>%08x:  %s   %-7s %s%s\n", uint64(startAddr), disassemble.GetOpCodeByteString(instrValue), instruction.Operation, opStr, comment)
@@ -425,21 +542,6 @@ func Disassemble(d Disass) {
 			}
 
 			prevInstr = instruction
-		} else { // output as JSON
-			instruction, err := disassemble.Decompose(startAddr, instrValue, &results) // TODO: it would probably be valuable to add a "comment" field and capture the analysis above for JSON peeps
-			if err != nil {
-				instructions = append(instructions, disassemble.Instruction{
-					Address:     startAddr,
-					Raw:         instrValue,
-					Encoding:    0,
-					Operation:   0,
-					Operands:    nil,
-					SetFlags:    0,
-					Disassembly: fmt.Sprintf(".long\t%#x ; (%s)\n", instrValue, err.Error()), // TODO: same with error enhancements above
-				})
-				goto INCR_ADDR
-			}
-			instructions = append(instructions, *instruction)
 		}
 	INCR_ADDR:
 		startAddr += uint64(binary.Size(uint32(0)))
@@ -447,7 +549,7 @@ func Disassemble(d Disass) {
 
 	if d.AsJSON() {
 		var curFunc string
-		funcsJSON := make(map[string][]disassemble.Instruction)
+		funcsJSON := make(map[string][]Instruction)
 		for _, inst := range instructions {
 			if ok, fname := d.IsFunctionStart(inst.Address); ok {
 				curFunc = fname
@@ -0,0 +1,115 @@
+package disass
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/stable"
+)
+
+// testDisass is a Disass over a code buffer with a symbol table (and nothing else)
+type testDisass struct {
+	data  []byte
+	start uint64
+	syms  map[uint64]string
+}
+
+func (d testDisass) Triage() error { return nil }
+func (d testDisass) IsFunctionStart(addr uint64) (bool, string) {
+	name, ok := d.syms[addr]
+	return ok, name
+}
+func (d testDisass) IsLocation(uint64) bool                 { return false }
+func (d testDisass) IsBranchLocation(uint64) (bool, uint64) { return false, 0 }
+func (d testDisass) IsData(uint64) (bool, *AddrDetails)     { return false, nil }
+func (d testDisass) IsJumpTable(uint64) (bool, *JumpTable)  { return false, nil }
+func (d testDisass) IsPointer(uint64) (bool, *AddrDetails)  { return false, nil }
+func (d testDisass) FindSymbol(addr uint64) (string, bool) {
+	name, ok := d.syms[addr]
+	return name, ok
+}
+func (d testDisass) GetCString(addr uint64) (string, error) {
+	return "", fmt.Errorf("no cstring at %#x", addr)
+}
+func (d testDisass) Demangle() bool    { return false }
+func (d testDisass) Quite() bool       { return false }
+func (d testDisass) Color() bool       { return false }
+func (d testDisass) AsJSON() bool      { return true }
+func (d testDisass) Data() []byte      { return d.data }
+func (d testDisass) StartAddr() uint64 { return d.start }
+func (d testDisass) Middle() uint64    { return 0 }
+func (d testDisass) ReadAddr(addr uint64) (uint64, error) {
+	return 0, fmt.Errorf("no pointer at %#x", addr)
+}
+
+func TestDisassembleJSON(t *testing.T) {
+	d := testDisass{
+		data: []byte{
+			0x03, 0x00, 0x00, 0x94, // 0x1000: bl     _callee
+			0x20, 0x00, 0x80, 0x52, // 0x1004: mov    w0, #1
+			0xc0, 0x03, 0x5f, 0xd6, // 0x1008: ret
+			0xc0, 0x03, 0x5f, 0xd6, // 0x100c: ret
+		},
+		start: 0x1000,
+		syms:  map[uint64]string{0x1000: "_main", 0x100c: "_callee"},
+	}
+	rec, err := stable.Record(filepath.Join("testdata", "disassemble.json.golden"), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Disassemble(d)
+	if err := rec.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := rec.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schema --json consumers decode (unknown fields fail the test so they have to be added here on purpose)
+	type target struct {
+		Address uint64 `json:"address"`
+		Symbol  string `json:"symbol"`
+	}
+	type operand struct {
+		Class string   `json:"class"`
+		Regs  []string `json:"regs"`
+		Imm   uint64   `json:"imm"`
+	}
+	type instruction struct {
+		Address     uint64    `json:"address"`
+		Bytes       string    `json:"bytes"`
+		Mnemonic    string    `json:"mnemonic"`
+		Operands    []operand `json:"operands"`
+		Disassembly string    `json:"disassembly"`
+		Target      *target   `json:"target"`
+		Comment     string    `json:"comment"`
+	}
+	var funcs map[string][]instruction
+	dec := json.NewDecoder(strings.NewReader(out))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&funcs); err != nil {
+		t.Fatalf("failed to decode --json output: %v", err)
+	}
+	if len(funcs["_main"]) != 3 || len(funcs["_callee"]) != 1 {
+		t.Fatalf("Disassemble() functions = %+v", funcs)
+	}
+	bl := funcs["_main"][0]
+	if bl.Address != 0x1000 || bl.Mnemonic != "bl" || bl.Disassembly != "bl _callee" {
+		t.Errorf("Disassemble() bl = %+v", bl)
+	}
+	if len(bl.Operands) != 1 || bl.Operands[0].Class != "LABEL" || bl.Operands[0].Imm != 0x100c {
+		t.Errorf("Disassemble() bl operands = %+v", bl.Operands)
+	}
+	if bl.Target == nil || *bl.Target != (target{Address: 0x100c, Symbol: "_callee"}) {
+		t.Errorf("Disassemble() bl target = %+v, want _callee (0x100c)", bl.Target)
+	}
+	mov := funcs["_main"][1]
+	if mov.Mnemonic != "mov" || mov.Target != nil || len(mov.Operands) != 2 || !slices.Equal(mov.Operands[0].Regs, []string{"w0"}) || mov.Operands[1].Imm != 1 {
+		t.Errorf("Disassemble() mov = %+v", mov)
+	}
+}
@@ -0,0 +1,283 @@
+package disass
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// maxJumpTableCases caps the size of a jump table whose bounds check could not be found
+const maxJumpTableCases = 1024
+
+// JumpTable is a compiler generated switch statement dispatch table
+type JumpTable struct {
+	Branch    uint64   `json:"branch"`     // address of the `br` that dispatches on the table
+	Table     uint64   `json:"table"`      // address of the table entries
+	Base      uint64   `json:"base"`       // address the (scaled) entries are relative to
+	EntrySize int      `json:"entry_size"` // size of each entry in bytes (1, 2 or 4)
+	Targets   []uint64 `json:"targets"`    // case targets indexed by the switch value
+}
+
+// Contains returns true if addr is inside the table's entries
+func (jt *JumpTable) Contains(addr uint64) bool {
+	return jt.Table <= addr && addr < jt.Table+uint64(jt.EntrySize*len(jt.Targets))
+}
+
+// Cases returns the switch values that branch to target
+func (jt *JumpTable) Cases(target uint64) []int {
+	var cases []int
+	for idx, t := range jt.Targets {
+		if t == target {
+			cases = append(cases, idx)
+		}
+	}
+	return cases
+}
+
+type jtLoad struct {
+	table  uint64
+	size   int
+	signed bool
+	index  string // register holding the switch value
+}
+
+type jtEntry struct {
+	jtLoad
+	base  uint64
+	shift uint32
+}
+
+// regNum normalizes w/x register names so 32 and 64-bit views of a register match
+func regNum(r disassemble.Register) string {
+	name := r.String()
+	if len(name) > 1 && (name[0] == 'w' || name[0] == 'x') {
+		return name[1:]
+	}
+	return name
+}
+
+// FindJumpTables recovers the jump tables dispatched in a function's instructions
+//
+// It matches the table address (ADR or ADRP+ADD), entry load (LDRB/LDRH/LDRSW [table, index]), optional
+// rebasing (ADD base, entry, LSL #n) and BR dispatch sequence the compilers emit for switch statements
+// and sizes the table from the CMP/B.HI bounds check on the index register. Tables outside of data are
+// read with readAt (which may be nil).
+func FindJumpTables(data []byte, startAddr uint64, readAt func(buf []byte, addr uint64) error) []*JumpTable {
+	var instrValue uint32
+	var results [1024]byte
+	var prevInstr *disassemble.Instruction
+	var jts []*JumpTable
+
+	endAddr := startAddr + uint64(len(data))
+	addrs := make(map[string]uint64) // registers holding a known address
+	loads := make(map[string]jtLoad) // registers holding a loaded table entry
+	entries := make(map[string]jtEntry)
+	bounds := make(map[string]int) // number of cases allowed by the bounds check on a register
+
+	r := bytes.NewReader(data)
+	addr := startAddr
+
+	for {
+		if err := binary.Read(r, binary.LittleEndian, &instrValue); err == io.EOF {
+			break
+		}
+
+		instruction, err := disassemble.Decompose(addr, instrValue, &results)
+		if err != nil || len(instruction.Operands) == 0 {
+			prevInstr = nil
+			addr += uint64(binary.Size(uint32(0)))
+			continue
+		}
+
+		ops := instruction.Operands
+		var dst string
+		if ops[0].Class == disassemble.REG && len(ops[0].Registers) > 0 {
+			dst = regNum(ops[0].Registers[0])
+		}
+
+		switch instruction.Operation {
+		case disassemble.ARM64_ADR, disassemble.ARM64_ADRP:
+			delete(loads, dst)
+			delete(entries, dst)
+			addrs[dst] = ops[1].Immediate
+		case disassemble.ARM64_ADD:
+			delete(loads, dst)
+			delete(entries, dst)
+			if len(ops) < 3 || len(ops[1].Registers) == 0 {
+				delete(addrs, dst)
+				break
+			}
+			src := regNum(ops[1].Registers[0])
+			if ops[2].Class == disassemble.IMM32 || ops[2].Class == disassemble.IMM64 {
+				if base, ok := addrs[src]; ok {
+					addrs[dst] = base + ops[2].GetImmediate()
+				} else {
+					delete(addrs, dst)
+				}
+			} else if ops[2].Class == disassemble.REG && len(ops[2].Registers) > 0 {
+				base, okBase := addrs[src]
+				ld, okLoad := loads[regNum(ops[2].Registers[0])]
+				if okBase && okLoad {
+					e := jtEntry{jtLoad: ld, base: base}
+					if ops[2].ShiftValueUsed && ops[2].ShiftType == disassemble.SHIFT_TYPE_LSL {
+						e.shift = ops[2].ShiftValue
+					}
+					entries[dst] = e
+				}
+				delete(addrs, dst)
+			}
+		case disassemble.ARM64_LDRB, disassemble.ARM64_LDRH, disassemble.ARM64_LDRSB,
+			disassemble.ARM64_LDRSH, disassemble.ARM64_LDRSW, disassemble.ARM64_LDR:
+			delete(addrs, dst)
+			delete(entries, dst)
+			delete(loads, dst)
+			if len(ops) < 2 || ops[1].Class != disassemble.MEM_EXTENDED || len(ops[1].Registers) < 2 {
+				break
+			}
+			table, ok := addrs[regNum(ops[1].Registers[0])]
+			if !ok {
+				break
+			}
+			ld := jtLoad{table: table, index: regNum(ops[1].Registers[1])}
+			switch instruction.Operation {
+			case disassemble.ARM64_LDRB:
+				ld.size = 1
+			case disassemble.ARM64_LDRSB:
+				ld.size, ld.signed = 1, true
+			case disassemble.ARM64_LDRH:
+				ld.size = 2
+			case disassemble.ARM64_LDRSH:
+				ld.size, ld.signed = 2, true
+			case disassemble.ARM64_LDRSW:
+				ld.size, ld.signed = 4, true
+			case disassemble.ARM64_LDR:
+				if !strings.HasPrefix(ops[0].Registers[0].String(), "w") {
+					break // 64-bit entries are pointers not offsets
+				}
+				ld.size = 4
+			}
+			if ld.size > 0 {
+				loads[dst] = ld
+			}
+		case disassemble.ARM64_MOV:
+			if len(ops) > 1 && ops[1].Class == disassemble.REG && len(ops[1].Registers) > 0 {
+				src := regNum(ops[1].Registers[0])
+				if n, ok := bounds[src]; ok {
+					bounds[dst] = n
+				}
+			}
+		case disassemble.ARM64_B_HI, disassemble.ARM64_B_CS: // b.hs is b.cs
+			// cmp wN, #imm ; b.hi default
+			if prevInstr != nil && prevInstr.Operation == disassemble.ARM64_CMP &&
+				len(prevInstr.Operands) > 1 && len(prevInstr.Operands[0].Registers) > 0 &&
+				(prevInstr.Operands[1].Class == disassemble.IMM32 || prevInstr.Operands[1].Class == disassemble.IMM64) {
+				n := int(prevInstr.Operands[1].GetImmediate())
+				if instruction.Operation == disassemble.ARM64_B_HI {
+					n++
+				}
+				bounds[regNum(prevInstr.Operands[0].Registers[0])] = n
+			}
+		case disassemble.ARM64_BR:
+			if e, ok := entries[dst]; ok {
+				if jt := readJumpTable(e, instruction.Address, bounds, data, startAddr, endAddr, readAt); jt != nil {
+					jts = append(jts, jt)
+				}
+			}
+		}
+
+		prevInstr = instruction
+		addr += uint64(binary.Size(uint32(0)))
+	}
+
+	return jts
+}
+
+func readJumpTable(e jtEntry, branch uint64, bounds map[string]int, data []byte, startAddr, endAddr uint64, readAt func([]byte, uint64) error) *JumpTable {
+	count, known := bounds[e.index]
+	if !known || count <= 0 || count > maxJumpTableCases {
+		count = maxJumpTableCases
+		known = false
+	}
+
+	read := func(idx int) (uint64, bool) {
+		buf := make([]byte, e.size)
+		at := e.table + uint64(idx*e.size)
+		if startAddr <= at && at+uint64(e.size) <= endAddr {
+			copy(buf, data[at-startAddr:])
+		} else if readAt == nil || readAt(buf, at) != nil {
+			return 0, false
+		}
+		var val int64
+		switch e.size {
+		case 1:
+			if val = int64(buf[0]); e.signed {
+				val = int64(int8(buf[0]))
+			}
+		case 2:
+			if val = int64(binary.LittleEndian.Uint16(buf)); e.signed {
+				val = int64(int16(binary.LittleEndian.Uint16(buf)))
+			}
+		case 4:
+			if val = int64(binary.LittleEndian.Uint32(buf)); e.signed {
+				val = int64(int32(binary.LittleEndian.Uint32(buf)))
+			}
+		}
+		return uint64(int64(e.base) + val<<e.shift), true
+	}
+
+	jt := &JumpTable{
+		Branch:    branch,
+		Table:     e.table,
+		Base:      e.base,
+		EntrySize: e.size,
+	}
+	for idx := range count {
+		target, ok := read(idx)
+		if !ok || target%4 != 0 || target < startAddr || target >= endAddr {
+			if known {
+				return nil // the bounds check said this entry must exist
+			}
+			break
+		}
+		if !known && idx > 0 && jt.Contains(target) {
+			break // ran into the table itself
+		}
+		jt.Targets = append(jt.Targets, target)
+	}
+	if len(jt.Targets) == 0 {
+		return nil
+	}
+	return jt
+}
+
+// AddJumpTables records the function's jump tables and their case targets as branch locations
+func (tr *Triage) AddJumpTables(jts []*JumpTable) {
+	if tr.JumpTables == nil {
+		tr.JumpTables = make(map[uint64]*JumpTable)
+	}
+	for _, jt := range jts {
+		tr.JumpTables[jt.Branch] = jt
+		for _, target := range jt.Targets {
+			if !slices.Contains(tr.Locations[target], jt.Branch) {
+				tr.Locations[target] = append(tr.Locations[target], jt.Branch)
+			}
+		}
+	}
+}
+
+// IsJumpTable returns the jump table that is dispatched by the `br` at addr or whose entries contain addr
+func (tr *Triage) IsJumpTable(addr uint64) (bool, *JumpTable) {
+	if jt, ok := tr.JumpTables[addr]; ok {
+		return true, jt
+	}
+	for _, jt := range tr.JumpTables {
+		if jt.Contains(addr) {
+			return true, jt
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,43 @@
+package disass
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindJumpTables(t *testing.T) {
+	code := []byte{
+		0x1f, 0x0c, 0x00, 0x71, // 0x1000: cmp    w0, #3
+		0x68, 0x01, 0x00, 0x54, // 0x1004: b.hi   0x1030
+		0x09, 0x00, 0x00, 0x90, // 0x1008: adrp   x9, 0x1000
+		0x29, 0xd1, 0x00, 0x91, // 0x100c: add    x9, x9, #0x34
+		0x8a, 0x00, 0x00, 0x10, // 0x1010: adr    x10, 0x1020
+		0x2b, 0x69, 0x60, 0x38, // 0x1014: ldrb   w11, [x9, x0]
+		0x4a, 0x09, 0x0b, 0x8b, // 0x1018: add    x10, x10, x11, lsl #2
+		0x40, 0x01, 0x1f, 0xd6, // 0x101c: br     x10
+		0x20, 0x00, 0x80, 0x52, // 0x1020: mov    w0, #1
+		0xc0, 0x03, 0x5f, 0xd6, // 0x1024: ret
+		0x40, 0x00, 0x80, 0x52, // 0x1028: mov    w0, #2
+		0xc0, 0x03, 0x5f, 0xd6, // 0x102c: ret
+		0xc0, 0x03, 0x5f, 0xd6, // 0x1030: ret
+		0x00, 0x02, 0x02, 0x04, // 0x1034: jump table
+	}
+
+	jts := FindJumpTables(code, 0x1000, nil)
+	if len(jts) != 1 {
+		t.Fatalf("FindJumpTables() found %d jump tables, want 1", len(jts))
+	}
+	jt := jts[0]
+	if jt.Branch != 0x101c || jt.Table != 0x1034 || jt.Base != 0x1020 || jt.EntrySize != 1 {
+		t.Errorf("FindJumpTables() = %#v", jt)
+	}
+	if want := []uint64{0x1020, 0x1028, 0x1028, 0x1030}; !slices.Equal(jt.Targets, want) {
+		t.Errorf("FindJumpTables() targets = %#x, want %#x", jt.Targets, want)
+	}
+	if cases := jt.Cases(0x1028); !slices.Equal(cases, []int{1, 2}) {
+		t.Errorf("Cases(0x1028) = %v, want [1 2]", cases)
+	}
+	if !jt.Contains(0x1034) || jt.Contains(0x1038) {
+		t.Errorf("Contains() is wrong for table at %#x", jt.Table)
+	}
+}
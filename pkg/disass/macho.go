@@ -120,6 +120,15 @@ func (d *MachoDisass) Triage() error {
 		startAddr += uint64(binary.Size(uint32(0)))
 	}
 
+	d.tr.AddJumpTables(FindJumpTables(d.Data(), d.StartAddr(), func(buf []byte, addr uint64) error {
+		off, err := d.f.GetOffset(addr)
+		if err != nil {
+			return err
+		}
+		_, err = d.f.ReadAt(buf, int64(off))
+		return err
+	}))
+
 	if !d.Quite() {
 		d.tr.Details = make(map[uint64]AddrDetails)
 
@@ -312,6 +321,11 @@ func (d MachoDisass) IsPointer(imm uint64) (bool, *AddrDetails) {
 	return false, nil
 }
 
+// IsJumpTable returns if given address is a switch statement's dispatch `br` or inside its jump table
+func (d MachoDisass) IsJumpTable(addr uint64) (bool, *JumpTable) {
+	return d.tr.IsJumpTable(addr)
+}
+
 // FindSymbol returns symbol from the addr2symbol map for a given virtual address
 func (d MachoDisass) FindSymbol(addr uint64) (string, bool) {
 	if symName, ok := d.a2s[addr]; ok {
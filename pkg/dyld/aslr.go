@@ -0,0 +1,163 @@
+package dyld
+
+import (
+	"cmp"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+const (
+	slideGranularityArm64 = 0x4000 // 16K pages
+	slideGranularity      = 0x1000 // 4K pages
+)
+
+// ASLR is the shared region's address space layout randomization parameters
+type ASLR struct {
+	SharedRegionStart uint64 `json:"shared_region_start"`
+	SharedRegionSize  uint64 `json:"shared_region_size"`
+	MaxSlide          uint64 `json:"max_slide"`
+	// the slide is always a multiple of the (VM) page size
+	Granularity uint64 `json:"granularity"`
+	SlideValues uint64 `json:"slide_values"`
+	EntropyBits int    `json:"entropy_bits"`
+}
+
+func (a *ASLR) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Shared Region: %#x-%#x (%#x)\n", a.SharedRegionStart, a.SharedRegionStart+a.SharedRegionSize, a.SharedRegionSize)
+	fmt.Fprintf(&sb, "Max Slide:     %#x\n", a.MaxSlide)
+	fmt.Fprintf(&sb, "Granularity:   %#x (slides are page aligned so the low %d bits of every address are never randomized)\n", a.Granularity, bits.TrailingZeros64(a.Granularity))
+	fmt.Fprintf(&sb, "Slide Values:  %d (%d bits of entropy)\n", a.SlideValues, a.EntropyBits)
+	return sb.String()
+}
+
+// SlideGranularity returns the page size the cache's slide is a multiple of
+func (f *File) SlideGranularity() uint64 {
+	if f.IsArm64() {
+		return slideGranularityArm64
+	}
+	return slideGranularity
+}
+
+// ASLR returns the shared region's address randomization parameters
+func (f *File) ASLR() *ASLR {
+	hdr := f.Headers[f.UUID]
+	a := &ASLR{
+		SharedRegionStart: hdr.SharedRegionStart,
+		SharedRegionSize:  hdr.SharedRegionSize,
+		MaxSlide:          uint64(hdr.MaxSlide),
+		Granularity:       f.SlideGranularity(),
+	}
+	a.SlideValues = a.MaxSlide/a.Granularity + 1
+	a.EntropyBits = bits.Len64(a.SlideValues - 1)
+	return a
+}
+
+type slideInterval struct {
+	lo, hi uint64 // inclusive
+}
+
+func intersectIntervals(a, b []slideInterval) []slideInterval {
+	var out []slideInterval
+	for _, x := range a {
+		for _, y := range b {
+			lo, hi := max(x.lo, y.lo), min(x.hi, y.hi)
+			if lo <= hi {
+				out = append(out, slideInterval{lo, hi})
+			}
+		}
+	}
+	return out
+}
+
+// Slides are the slide values that are consistent with a set of slid addresses
+type Slides struct {
+	Granularity uint64   `json:"granularity"`
+	Count       uint64   `json:"count"`
+	Min         uint64   `json:"min"`
+	Max         uint64   `json:"max"`
+	Values      []uint64 `json:"values,omitempty"` // only when there are few candidates
+}
+
+// Unique returns true if only one slide is consistent with the addresses
+func (s *Slides) Unique() bool {
+	return s.Count == 1
+}
+
+const maxSlideValues = 16
+
+// SlideCandidates returns the page aligned slides (up to the cache's max slide) that map ALL
+// of the slid addresses back into the cache's mappings
+func (f *File) SlideCandidates(addrs []uint64) (*Slides, error) {
+	a := f.ASLR()
+	candidates := []slideInterval{{0, a.MaxSlide}}
+	for _, addr := range addrs {
+		var allowed []slideInterval
+		for _, maps := range f.MappingsWithSlideInfo {
+			for _, m := range maps {
+				if m.Size == 0 || addr < m.Address {
+					continue
+				}
+				// addr - slide must be in [m.Address, m.Address+m.Size)
+				lo := uint64(0)
+				if addr >= m.Address+m.Size {
+					lo = addr - (m.Address + m.Size - 1)
+				}
+				allowed = append(allowed, slideInterval{lo, addr - m.Address})
+			}
+		}
+		candidates = intersectIntervals(candidates, allowed)
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no slide maps %#x (and the other addresses) into the cache", addr)
+		}
+	}
+
+	// merge the overlapping intervals
+	slices.SortFunc(candidates, func(x, y slideInterval) int { return cmp.Compare(x.lo, y.lo) })
+	merged := candidates[:1]
+	for _, c := range candidates[1:] {
+		if last := &merged[len(merged)-1]; c.lo <= last.hi+1 {
+			last.hi = max(last.hi, c.hi)
+		} else {
+			merged = append(merged, c)
+		}
+	}
+
+	s := &Slides{Granularity: a.Granularity}
+	for _, c := range merged {
+		lo := (c.lo + a.Granularity - 1) / a.Granularity * a.Granularity
+		hi := c.hi / a.Granularity * a.Granularity
+		if lo > hi {
+			continue
+		}
+		if s.Count == 0 {
+			s.Min = lo
+		}
+		s.Max = hi
+		for slide := lo; slide <= hi && len(s.Values) <= maxSlideValues; slide += a.Granularity {
+			s.Values = append(s.Values, slide)
+		}
+		s.Count += (hi-lo)/a.Granularity + 1
+	}
+	if s.Count == 0 {
+		return nil, fmt.Errorf("no page aligned slide maps the addresses into the cache")
+	}
+	if s.Count > maxSlideValues {
+		s.Values = nil
+	}
+	return s, nil
+}
+
+// CheckSlide returns an error if the slide is not a valid slide for the cache
+func (f *File) CheckSlide(slide uint64) error {
+	a := f.ASLR()
+	if slide%a.Granularity != 0 {
+		return fmt.Errorf("slide %#x is not a multiple of the %#x page size", slide, a.Granularity)
+	}
+	if slide > a.MaxSlide {
+		return fmt.Errorf("slide %#x is larger than the cache's max slide %#x", slide, a.MaxSlide)
+	}
+	return nil
+}
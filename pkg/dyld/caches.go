@@ -0,0 +1,210 @@
+package dyld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	mtypes "github.com/blacktop/go-macho/types"
+)
+
+// CacheKind is the kind of dyld_shared_cache a build ships
+type CacheKind string
+
+const (
+	CacheKindSystem     CacheKind = "system"     // the OS's native cache (i.e. arm64e)
+	CacheKindRosetta    CacheKind = "rosetta"    // an x86_64 cache run under Rosetta on Apple silicon
+	CacheKindDriverKit  CacheKind = "driverkit"  // the cache of the DriverKit runtime
+	CacheKindExclaveKit CacheKind = "exclavekit" // the cache of the ExclaveKit runtime
+)
+
+var mainCacheRE = regexp.MustCompile(`^dyld_shared_cache_([a-z0-9_]+)$`)
+
+// Cache is a main dyld_shared_cache (its subcaches are opened through it) of a multi-cache build
+type Cache struct {
+	Path string    `json:"path"`
+	Arch string    `json:"arch"`
+	Kind CacheKind `json:"kind"`
+}
+
+// Label returns the cache's name in multi-cache output (i.e. arm64e, rosetta/x86_64 or driverkit/arm64e)
+func (c *Cache) Label() string {
+	if c.Kind == CacheKindSystem || c.Kind == "" {
+		return c.Arch
+	}
+	return string(c.Kind) + "/" + c.Arch
+}
+
+// FindCaches returns the main dyld_shared_caches in the given paths (caches or folders/mounted filesystems to
+// search) sorted by kind and then arch
+//
+// NOTE: a cache's kind is guessed from its path and arch (x86_64 caches that ship next to an arm64 one run under
+// Rosetta) here and then corrected from its header by ForEachCache
+func FindCaches(paths ...string) ([]*Cache, error) {
+	var caches []*Cache
+	add := func(path string) {
+		m := mainCacheRE.FindStringSubmatch(filepath.Base(path))
+		if m == nil {
+			return // subcaches, .symbols, .map and .atlas files
+		}
+		if slices.ContainsFunc(caches, func(c *Cache) bool { return c.Path == path }) {
+			return
+		}
+		c := &Cache{Path: path, Arch: m[1], Kind: CacheKindSystem}
+		switch {
+		case strings.Contains(filepath.ToSlash(path), "/DriverKit/"):
+			c.Kind = CacheKindDriverKit
+		case strings.Contains(filepath.ToSlash(path), "/ExclaveKit/"):
+			c.Kind = CacheKindExclaveKit
+		}
+		caches = append(caches, c)
+	}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %v", path, err)
+		}
+		if !fi.IsDir() {
+			add(path)
+			continue
+		}
+		if err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Debugf("failed to walk %s: %v", path, err)
+				return nil
+			}
+			if !d.IsDir() {
+				add(path)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %v", path, err)
+		}
+	}
+	for _, c := range caches {
+		if c.Kind == CacheKindSystem && strings.HasPrefix(c.Arch, "x86_64") && slices.ContainsFunc(caches, func(o *Cache) bool {
+			return o.Kind == CacheKindSystem && strings.HasPrefix(o.Arch, "arm64") && filepath.Dir(o.Path) == filepath.Dir(c.Path)
+		}) {
+			c.Kind = CacheKindRosetta
+		}
+	}
+	slices.SortStableFunc(caches, func(a, b *Cache) int {
+		if a.Kind != b.Kind {
+			return cacheKindOrder(a.Kind) - cacheKindOrder(b.Kind)
+		}
+		return strings.Compare(a.Arch, b.Arch)
+	})
+	return caches, nil
+}
+
+func cacheKindOrder(k CacheKind) int {
+	return slices.Index([]CacheKind{CacheKindSystem, CacheKindRosetta, CacheKindDriverKit, CacheKindExclaveKit}, k)
+}
+
+// CacheError is a failure (or recovered panic) while processing a single cache of a multi-cache run
+type CacheError struct {
+	Cache *Cache
+	Err   error
+	Stack []byte // set if the handler panicked
+}
+
+func (e *CacheError) Error() string {
+	if e.Stack != nil {
+		return fmt.Sprintf("%s: panic: %v", e.Cache.Label(), e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Cache.Label(), e.Err)
+}
+
+func (e *CacheError) Unwrap() error { return e.Err }
+
+// CacheErrors are the per-cache failures of a multi-cache run (in the order the caches were processed)
+type CacheErrors []*CacheError
+
+func (e CacheErrors) Error() string {
+	if len(e) == 1 {
+		return "failed to process 1 cache: " + e[0].Error()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "failed to process %d caches:", len(e))
+	for _, ce := range e {
+		sb.WriteString("\n\t" + ce.Error())
+	}
+	return sb.String()
+}
+
+func (e CacheErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, ce := range e {
+		errs = append(errs, ce)
+	}
+	return errs
+}
+
+// ForEachCache opens each cache in turn, corrects its kind from its header and calls handler with it
+//
+// A cache that fails to open or whose handler returns an error or panics only fails itself; the remaining caches
+// are still processed and all the failures are returned together as CacheErrors. The returned error is ctx.Err()
+// if the context is done.
+//
+// NOTE: caches are processed one at a time (and closed once their handler returns) since a single cache can
+// already map several GBs, use File.ForEachImage inside the handler to parallelize the work on a cache.
+func ForEachCache(ctx context.Context, caches []*Cache, handler func(ctx context.Context, c *Cache, f *File) error) error {
+	var errs CacheErrors
+	for _, c := range caches {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := runCache(ctx, c, handler); err != nil {
+			log.WithField("cache", c.Path).Debugf("failed to process cache: %v", err.Err)
+			errs = append(errs, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func runCache(ctx context.Context, c *Cache, handler func(context.Context, *Cache, *File) error) (cerr *CacheError) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+			cerr = &CacheError{Cache: c, Err: err, Stack: debug.Stack()}
+		}
+	}()
+	f, err := Open(c.Path)
+	if err != nil {
+		return &CacheError{Cache: c, Err: fmt.Errorf("failed to open cache: %w", err)}
+	}
+	defer f.Close()
+	hdr := f.Headers[f.UUID]
+	switch {
+	case hdr.Platform == mtypes.Platform_Driverkit:
+		c.Kind = CacheKindDriverKit
+	case strings.HasSuffix(hdr.Platform.String(), "ExclaveKit"):
+		c.Kind = CacheKindExclaveKit
+	case hdr.RosettaReadOnlySize > 0:
+		c.Kind = CacheKindRosetta
+	}
+	if err := handler(ctx, c, f); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil // reported once by ForEachCache
+		}
+		return &CacheError{Cache: c, Err: err}
+	}
+	return nil
+}
@@ -116,6 +116,11 @@ func (d DyldDisass) IsData(addr uint64) (bool, *disass.AddrDetails) {
 	return false, nil
 }
 
+// IsJumpTable returns if given address is a switch statement's dispatch `br` or inside its jump table
+func (d DyldDisass) IsJumpTable(addr uint64) (bool, *disass.JumpTable) {
+	return d.tr.IsJumpTable(addr)
+}
+
 // IsPointer returns if given address is a pointer to another address
 func (d DyldDisass) IsPointer(imm uint64) (bool, *disass.AddrDetails) {
 	if deet, ok := d.tr.Details[imm]; ok {
@@ -231,6 +236,19 @@ func (d *DyldDisass) Triage() error {
 		startAddr += uint64(binary.Size(uint32(0)))
 	}
 
+	d.tr.AddJumpTables(disass.FindJumpTables(d.Data(), d.StartAddr(), func(buf []byte, addr uint64) error {
+		uuid, off, err := d.f.GetOffset(addr)
+		if err != nil {
+			return err
+		}
+		dat, err := d.f.ReadBytesForUUID(uuid, int64(off), uint64(len(buf)))
+		if err != nil {
+			return err
+		}
+		copy(buf, dat)
+		return nil
+	}))
+
 	if !d.Quite() {
 		d.tr.Details = make(map[uint64]disass.AddrDetails)
 
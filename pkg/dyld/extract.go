@@ -157,7 +157,7 @@ func ExtractFromDMG(i *info.Info, dmgPath, destPath string, arches []string, dri
 func Extract(ipsw, destPath, pemDB string, arches []string, driverkit, all bool) ([]string, error) {
 
 	if runtime.GOOS == "windows" {
-		return nil, fmt.Errorf("dyld extraction is not supported on Windows (see github.com/blacktop/go-apfs)")
+		return nil, fmt.Errorf("dyld extraction requires mounting the filesystem DMG (see github.com/blacktop/go-apfs): %w", utils.ErrMountUnsupported)
 	}
 
 	i, err := info.Parse(ipsw)
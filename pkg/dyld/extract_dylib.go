@@ -0,0 +1,341 @@
+package dyld
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	indirectSymbolLocal = 0x80000000
+	indirectSymbolAbs   = 0x40000000
+)
+
+// ExtractConfig is the configuration for extracting dylibs from the dyld_shared_cache
+type ExtractConfig struct {
+	// Slide rewrites the cache's rebase pointers (that are encoded with the cache's slide info) to their targets
+	Slide bool
+	// Stubs rewrites the cache builder's optimized stubs (that branch straight to their targets in other dylibs)
+	// back into stubs that load their target from the dylib's GOT/lazy pointers
+	Stubs bool
+	// ObjC adds the ObjC classes, protocols, categories and methods to the symtab
+	ObjC bool
+	// StubIslands adds the cache's stub islands to the symtab (see File.GetStubIslands)
+	StubIslands bool
+	// FullPath writes the dylib to its install path under the output folder (instead of using its base name)
+	FullPath bool
+	// Force overwrites previously extracted dylibs
+	Force bool
+}
+
+// ExtractDylib extracts the image (by name) from the dyld_shared_cache at dscPath to outDir with the cache's slide
+// info applied and its stubs rewritten so it can be loaded standalone; it returns the path of the extracted dylib
+//
+// NOTE: Extract is the IPSW dyld_shared_cache extractor
+func ExtractDylib(dscPath, image, outDir string) (string, error) {
+	f, err := Open(dscPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	img, err := f.Image(image)
+	if err != nil {
+		return "", err
+	}
+	return f.ExtractDylib(img, outDir, &ExtractConfig{Slide: true, Stubs: true, Force: true})
+}
+
+// ExtractDylib extracts the image to outDir and returns the path of the extracted dylib (a previously extracted
+// dylib is only overwritten if conf.Force is set, otherwise an error wrapping fs.ErrExist is returned)
+func (f *File) ExtractDylib(img *CacheImage, outDir string, conf *ExtractConfig) (string, error) {
+	if conf == nil {
+		conf = &ExtractConfig{}
+	}
+
+	fname := filepath.Join(outDir, filepath.Base(img.Name))
+	if conf.FullPath {
+		fname = filepath.Join(outDir, img.Name)
+	}
+	if _, err := os.Stat(fname); err == nil && !conf.Force {
+		return fname, fmt.Errorf("dylib %s already extracted: %w", fname, fs.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(fname), 0o750); err != nil {
+		return "", fmt.Errorf("failed to create output folder %s: %v", filepath.Dir(fname), err)
+	}
+
+	m, err := img.GetMacho()
+	if err != nil {
+		return "", err
+	}
+	defer m.Close()
+	if m.Dysymtab == nil {
+		return "", fmt.Errorf("failed to extract dylib %s: missing LC_DYSYMTAB", img.Name)
+	}
+
+	var dcf *fixupchains.DyldChainedFixups
+	if m.HasFixups() {
+		dcf, err = m.DyldChainedFixups()
+		if err != nil {
+			log.Errorf("failed to parse fixups from in memory MachO for %s: %v", filepath.Base(img.Name), err)
+		}
+	}
+
+	img.ParseLocalSymbols(false)
+	syms := img.GetLocalSymbolsAsMachoSymbols()
+	if conf.ObjC && m.HasObjC() {
+		syms = append(syms, objcSymbols(m)...)
+	}
+	if conf.StubIslands {
+		stubIslands, err := f.GetStubIslands()
+		if err != nil {
+			return "", err
+		}
+		for addr, sym := range stubIslands {
+			syms = append(syms, macho.Symbol{
+				Name:  sym,
+				Value: addr,
+				Desc:  0xa00,
+			})
+		}
+	}
+
+	if err := m.Export(fname, dcf, m.GetBaseAddress(), syms); err != nil {
+		return "", fmt.Errorf("failed to extract dylib %s: %w", img.Name, err)
+	}
+	if conf.Slide {
+		if err := f.applySlideInfo(fname); err != nil {
+			return "", fmt.Errorf("failed to rebase dylib via cache slide info: %v", err)
+		}
+	}
+	if conf.Stubs {
+		n, err := rewriteStubs(fname)
+		if err != nil {
+			return "", fmt.Errorf("failed to rewrite dylib stubs: %v", err)
+		}
+		log.Debugf("Rewrote %d %s stubs", n, filepath.Base(img.Name))
+	}
+
+	return fname, nil
+}
+
+func objcSymbols(m *macho.File) []macho.Symbol {
+	var syms []macho.Symbol
+	if protos, err := m.GetObjCProtocols(); err == nil {
+		for _, proto := range protos {
+			syms = append(syms, macho.Symbol{
+				Name:  proto.Name,
+				Value: proto.Ptr,
+				Desc:  0xa00,
+			})
+		}
+	} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		log.Error(err.Error())
+	}
+	if classes, err := m.GetObjCClasses(); err == nil {
+		for _, class := range classes {
+			syms = append(syms, macho.Symbol{
+				Name:  class.Name,
+				Value: class.ClassPtr,
+				Desc:  0xa00,
+			})
+			for _, cmeth := range class.ClassMethods {
+				syms = append(syms, macho.Symbol{
+					Name:  fmt.Sprintf("+[%s %s]", class.Name, cmeth.Name),
+					Value: cmeth.ImpVMAddr,
+					Desc:  0xa00,
+				})
+			}
+			for _, imeth := range class.InstanceMethods {
+				syms = append(syms, macho.Symbol{
+					Name:  fmt.Sprintf("-[%s %s]", class.Name, imeth.Name),
+					Value: imeth.ImpVMAddr,
+					Desc:  0xa00,
+				})
+			}
+		}
+	} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		log.Error(err.Error())
+	}
+	if cats, err := m.GetObjCCategories(); err == nil {
+		for _, cat := range cats {
+			syms = append(syms, macho.Symbol{
+				Name:  cat.Name,
+				Value: cat.VMAddr,
+				Desc:  0xa00,
+			})
+			for _, imeth := range cat.InstanceMethods {
+				syms = append(syms, macho.Symbol{
+					Name:  fmt.Sprintf("-[%s %s]", cat.Name, imeth.Name),
+					Value: imeth.ImpVMAddr,
+					Desc:  0xa00,
+				})
+			}
+		}
+	} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		log.Error(err.Error())
+	}
+	return syms
+}
+
+// applySlideInfo rewrites the rebase pointers of the extracted dylib to their (unslid) targets
+func (f *File) applySlideInfo(machoPath string) error {
+	of, err := os.OpenFile(machoPath, os.O_RDWR, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to open exported MachO %s: %v", machoPath, err)
+	}
+	defer of.Close()
+
+	mm, err := macho.NewFile(of)
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range mm.Segments() {
+		uuid, mapping, err := f.GetMappingForVMAddress(seg.Addr)
+		if err != nil {
+			return err
+		}
+
+		if mapping.SlideInfoOffset == 0 {
+			continue
+		}
+
+		startAddr := seg.Addr - mapping.Address
+		endAddr := ((seg.Addr + seg.Memsz) - mapping.Address) + uint64(f.SlideInfo.GetPageSize())
+
+		start := startAddr / uint64(f.SlideInfo.GetPageSize())
+		end := endAddr / uint64(f.SlideInfo.GetPageSize())
+
+		rebases, err := f.GetRebaseInfoForPages(uuid, mapping, start, end)
+		if err != nil {
+			return err
+		}
+
+		for _, rebase := range rebases {
+			off, err := mm.GetOffset(rebase.CacheVMAddress)
+			if err != nil {
+				continue
+			}
+			if _, err := of.Seek(int64(off), io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek in exported file to offset %#x from the start: %v", off, err)
+			}
+			if err := binary.Write(of, f.ByteOrder, rebase.Target); err != nil {
+				return fmt.Errorf("failed to write rebase address %#x: %v", rebase.Target, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// rewriteStubs rewrites the arm64 stubs of the extracted dylib to load their targets from the GOT/lazy pointer of
+// the same (indirect) symbol and returns the number of rewritten stubs
+func rewriteStubs(machoPath string) (int, error) {
+	of, err := os.OpenFile(machoPath, os.O_RDWR, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open exported MachO %s: %v", machoPath, err)
+	}
+	defer of.Close()
+
+	m, err := macho.NewFile(of)
+	if err != nil {
+		return 0, err
+	}
+	if m.CPU != types.CPUArm64 || m.Dysymtab == nil {
+		return 0, nil
+	}
+	indirect := m.Dysymtab.IndirectSyms
+
+	// the first pointer slot of each indirect symbol
+	slots := make(map[uint32]uint64)
+	for _, sec := range m.Sections {
+		if !sec.Flags.IsNonLazySymbolPointers() && !sec.Flags.IsLazySymbolPointers() {
+			continue
+		}
+		for i := uint64(0); i < sec.Size/8 && int(sec.Reserved1)+int(i) < len(indirect); i++ {
+			sym := indirect[sec.Reserved1+uint32(i)]
+			if sym&(indirectSymbolLocal|indirectSymbolAbs) != 0 {
+				continue
+			}
+			if _, ok := slots[sym]; !ok {
+				slots[sym] = sec.Addr + i*8
+			}
+		}
+	}
+
+	var count int
+	for _, sec := range m.Sections {
+		if !sec.Flags.IsSymbolStubs() || sec.Reserved2 == 0 {
+			continue
+		}
+		size := uint64(sec.Reserved2)
+		for i := uint64(0); i < sec.Size/size && int(sec.Reserved1)+int(i) < len(indirect); i++ {
+			slot, ok := slots[indirect[sec.Reserved1+uint32(i)]]
+			if !ok {
+				continue
+			}
+			insns, err := stubInstructions(sec.Addr+i*size, slot, sec.Reserved2)
+			if err != nil {
+				return count, fmt.Errorf("failed to assemble stub at %#x: %v", sec.Addr+i*size, err)
+			}
+			if _, err := of.Seek(int64(uint64(sec.Offset)+i*size), io.SeekStart); err != nil {
+				return count, fmt.Errorf("failed to seek to stub at %#x: %v", sec.Addr+i*size, err)
+			}
+			if err := binary.Write(of, binary.LittleEndian, insns); err != nil {
+				return count, fmt.Errorf("failed to write stub at %#x: %v", sec.Addr+i*size, err)
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// stubInstructions assembles a stub at addr that branches to the pointer in slot
+//
+//	arm64  (12 bytes): adrp x16, slot@PAGE; ldr x16, [x16, slot@PAGEOFF]; br x16
+//	arm64e (16 bytes): adrp x17, slot@PAGE; add x17, x17, slot@PAGEOFF; ldr x16, [x17]; braa x16, x17
+func stubInstructions(addr, slot uint64, size uint32) ([]uint32, error) {
+	const (
+		x16 = 16
+		x17 = 17
+	)
+	if slot&7 != 0 {
+		return nil, fmt.Errorf("unaligned pointer slot %#x", slot)
+	}
+	pages := int64(slot&^0xfff-addr&^0xfff) >> 12
+	if pages < -(1<<20) || pages >= 1<<20 {
+		return nil, fmt.Errorf("pointer slot %#x is out of ADRP range", slot)
+	}
+	adrp := func(rd uint32) uint32 {
+		return 0x90000000 | uint32(pages&3)<<29 | uint32(pages>>2&0x7ffff)<<5 | rd
+	}
+	pageOff := uint32(slot & 0xfff)
+	switch size {
+	case 12:
+		return []uint32{
+			adrp(x16),
+			0xf9400000 | (pageOff/8)<<10 | x16<<5 | x16, // ldr x16, [x16, #pageoff]
+			0xd61f0000 | x16<<5,                         // br x16
+		}, nil
+	case 16:
+		return []uint32{
+			adrp(x17),
+			0x91000000 | pageOff<<10 | x17<<5 | x17, // add x17, x17, #pageoff
+			0xf9400000 | x17<<5 | x16,               // ldr x16, [x17]
+			0xd71f0800 | x16<<5 | x17,               // braa x16, x17
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported stub size %d", size)
+	}
+}
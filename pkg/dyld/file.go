@@ -1,22 +1,31 @@
+// Package dyld parses dyld_shared_caches (and their subcaches)
+//
+// Every File owns its readers and lazily parsed state so multiple caches can be opened and processed concurrently.
+// A single File is NOT safe for concurrent use except through ForEachImage (which initializes the shared state
+// before its workers start) or by opening a File per goroutine.
 package dyld
 
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"math/bits"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho/pkg/codesign"
 	"github.com/blacktop/go-macho/pkg/trie"
 	mtypes "github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/telemetry"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/disass"
+	"github.com/blacktop/ipsw/pkg/errcode"
 )
 
 // Known good magic
@@ -56,6 +65,9 @@ func (m cacheMappingsWithSlideInfo) Less(i, j int) bool {
 }
 
 // A File represents an open dyld file.
+//
+// Methods that parse lazily (symbols, ObjC optimizations, closures etc.) cache their results in the File so
+// a File must not be used from multiple goroutines outside of ForEachImage.
 type File struct {
 	UUID    mtypes.UUID
 	Headers map[mtypes.UUID]CacheHeader
@@ -87,6 +99,8 @@ type File struct {
 	dyldImageAddr   uint64
 	dyldStartFnAddr uint64
 	objcOptRoAddr   uint64
+	objcHashes      map[strHashType]*StringHash
+	objcHashUUIDs   [protocolopt + 1]mtypes.UUID
 	islandStubs     map[uint64]uint64
 	size            int64
 
@@ -102,6 +116,12 @@ type FormatError struct {
 	val any
 }
 
+// ErrNotDyldCache is returned when the input is not a dyld_shared_cache
+var ErrNotDyldCache = errcode.New(errcode.NotDyldCache, "not a dyld_shared_cache")
+
+// Unwrap allows errors.Is(err, ErrNotDyldCache) to match a FormatError
+func (e *FormatError) Unwrap() error { return ErrNotDyldCache }
+
 func (e *FormatError) Error() string {
 	msg := e.msg
 	if e.val != nil {
@@ -128,8 +148,30 @@ func getUUID(r io.ReaderAt) (mtypes.UUID, error) {
 	return uuid, nil
 }
 
+// reSubCacheSuffix matches the file suffix of a dyld4 subcache (e.g. .01, .01.dylddata or .symbols)
+var reSubCacheSuffix = regexp.MustCompile(`(?:\.\d+(?:\.dylddata)?|\.dylddata|\.symbols)$`)
+
+// MainCachePath returns the path of the main cache of the given (sub)cache path
+func MainCachePath(name string) string {
+	return reSubCacheSuffix.ReplaceAllString(name, "")
+}
+
+// IsSubCache returns true if the given path is a dyld4 subcache (or .symbols file) of a main cache
+func IsSubCache(name string) bool {
+	return MainCachePath(name) != name
+}
+
 // Open opens the named file using os.Open and prepares it for use as a dyld binary.
+//
+// NOTE: the path of a dyld4 subcache (e.g. .01 or .symbols) opens its main cache (and all of its subcaches).
 func Open(name string) (*File, error) {
+	defer telemetry.Phase("dyld.open")()
+
+	if IsSubCache(name) {
+		if _, err := os.Stat(MainCachePath(name)); err == nil {
+			return openFromSubCache(name)
+		}
+	}
 
 	log.WithFields(log.Fields{
 		"cache": name,
@@ -144,83 +186,121 @@ func Open(name string) (*File, error) {
 		f.Close()
 		return nil, err
 	}
+	ff.closers[ff.UUID] = f
 
 	fi, err := f.Stat()
 	if err != nil {
+		ff.Close()
 		return nil, err
 	}
 
 	ff.size = fi.Size()
 
 	if ff.IsDyld4 {
+		if err := ff.openSubCaches(name); err != nil {
+			ff.Close()
+			return nil, err
+		}
+	}
 
-		for i := 1; i <= int(ff.Headers[ff.UUID].SubCacheArrayCount); i++ {
-			subCacheName := fmt.Sprintf("%s.%d", name, i)
-			if len(ff.SubCacheInfo[i-1].Extention) > 0 {
-				subCacheName = fmt.Sprintf("%s%s", name, ff.SubCacheInfo[i-1].Extention)
-			}
-			/* NOTE: removing because it feels too noisy */
-			// log.WithFields(log.Fields{
-			// 	"cache": subCacheName,
-			// }).Debug("Parsing SubCache")
+	return ff, nil
+}
 
-			fsub, err := os.Open(subCacheName)
-			if err != nil {
-				return nil, err
-			}
+func openFromSubCache(name string) (*File, error) {
+	uuid, err := func() (mtypes.UUID, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return mtypes.UUID{}, err
+		}
+		defer f.Close()
+		return getUUID(f)
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subcache %s UUID: %v", name, err)
+	}
+	ff, err := Open(MainCachePath(name))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ff.Headers[uuid]; !ok {
+		ff.Close()
+		return nil, fmt.Errorf("%s (UUID %s) is not a subcache of %s", name, uuid, MainCachePath(name))
+	}
+	return ff, nil
+}
 
-			fi, err := fsub.Stat()
-			if err != nil {
-				return nil, err
-			}
+// openSubCaches opens and verifies the subcaches (and .symbols file) listed in the main cache's header
+func (f *File) openSubCaches(name string) error {
+	for i, info := range f.SubCacheInfo {
+		subCacheName := fmt.Sprintf("%s.%d", name, i+1)
+		if len(info.Extention) > 0 {
+			subCacheName = name + info.Extention
+		}
+		/* NOTE: removing because it feels too noisy */
+		// log.WithFields(log.Fields{
+		// 	"cache": subCacheName,
+		// }).Debug("Parsing SubCache")
+
+		fsub, err := os.Open(subCacheName)
+		if err != nil {
+			return err
+		}
 
-			ff.size += fi.Size()
+		uuid, err := getUUID(fsub)
+		if err != nil {
+			fsub.Close()
+			return fmt.Errorf("failed to read sub cache %s UUID: %v", subCacheName, err)
+		}
 
-			uuid, err := getUUID(fsub)
-			if err != nil {
-				return nil, err
-			}
+		if uuid != info.UUID {
+			fsub.Close()
+			return fmt.Errorf("sub cache %s did not match expected UUID: %s, got: %s", subCacheName, info.UUID, uuid)
+		}
 
-			ff.parseCache(fsub, uuid)
+		f.closers[uuid] = fsub
 
-			ff.closers[uuid] = fsub
+		fi, err := fsub.Stat()
+		if err != nil {
+			return err
+		}
 
-			if ff.Headers[uuid].UUID != ff.SubCacheInfo[i-1].UUID {
-				return nil, fmt.Errorf("sub cache %s did not match expected UUID: %#x, got: %#x", subCacheName,
-					ff.SubCacheInfo[i-1].UUID.String(),
-					ff.Headers[uuid].UUID.String())
-			}
+		f.size += fi.Size()
+
+		if err := f.parseCache(fsub, uuid); err != nil {
+			return fmt.Errorf("failed to parse sub cache %s: %v", subCacheName, err)
 		}
+	}
 
-		if !ff.Headers[ff.UUID].SymbolFileUUID.IsNull() {
-			// log.WithFields(log.Fields{
-			// 	"cache": name + ".symbols",
-			// }).Debug("Parsing SubCache")
-			fsym, err := os.Open(name + ".symbols")
-			if err != nil {
-				return nil, err
-			}
+	if symUUID := f.Headers[f.UUID].SymbolFileUUID; !symUUID.IsNull() {
+		// log.WithFields(log.Fields{
+		// 	"cache": name + ".symbols",
+		// }).Debug("Parsing SubCache")
+		fsym, err := os.Open(name + ".symbols")
+		if err != nil {
+			return err
+		}
 
-			uuid, err := getUUID(fsym)
-			if err != nil {
-				return nil, err
-			}
+		uuid, err := getUUID(fsym)
+		if err != nil {
+			fsym.Close()
+			return fmt.Errorf("failed to read %s.symbols UUID: %v", name, err)
+		}
 
-			if uuid != ff.Headers[ff.UUID].SymbolFileUUID {
-				return nil, fmt.Errorf("%s.symbols UUID %s did NOT match expected UUID %s", name, uuid.String(), ff.Headers[ff.UUID].SymbolFileUUID.String())
-			}
+		if uuid != symUUID {
+			fsym.Close()
+			return fmt.Errorf("%s.symbols UUID %s did NOT match expected UUID %s", name, uuid, symUUID)
+		}
 
-			ff.symUUID = uuid
+		f.closers[uuid] = fsym
 
-			ff.parseCache(fsym, uuid)
+		f.symUUID = uuid
 
-			ff.closers[uuid] = fsym
+		if err := f.parseCache(fsym, uuid); err != nil {
+			return fmt.Errorf("failed to parse %s.symbols: %v", name, err)
 		}
 	}
 
-	ff.closers[ff.UUID] = f
-
-	return ff, nil
+	return nil
 }
 
 // Close closes the File.
@@ -660,8 +740,8 @@ func (f *File) parseCache(r io.ReaderAt, uuid mtypes.UUID) error {
 		}
 	}
 
-	if f.Headers[uuid].MappingOffset >= 0x208 {
-		// read TPRO mapping info
+	if uuid == f.UUID && f.Headers[uuid].MappingOffset >= 0x208 {
+		// read TPRO mapping info (NOTE: only the main cache has them, so don't let the subcaches clobber them)
 		sr.Seek(int64(f.Headers[uuid].TPROMappingsOffset), io.SeekStart)
 		f.TPROMappings = make([]TPROMapping, f.Headers[uuid].TPROMappingsCount)
 		if err := binary.Read(sr, f.ByteOrder, f.TPROMappings); err != nil {
@@ -1768,7 +1848,13 @@ func (f *File) Image(name string) (*CacheImage, error) {
 	return nil, fmt.Errorf("image %s not found in cache", name)
 }
 
+// Search returns the offsets (per cache file) of the NULL terminated strings containing search
 func (f *File) Search(search []byte) (map[mtypes.UUID][]uint64, error) {
+	return f.SearchContext(context.Background(), search)
+}
+
+// SearchContext is like Search but stops (returning the matches so far and ctx.Err()) once the context is done
+func (f *File) SearchContext(ctx context.Context, search []byte) (map[mtypes.UUID][]uint64, error) {
 	chunkSize := uint64(4096)
 	tailLen := uint64(len(search) - 1)
 	chunk := make([]byte, chunkSize+tailLen)
@@ -1797,6 +1883,11 @@ func (f *File) Search(search []byte) (map[mtypes.UUID][]uint64, error) {
 			} else if err != nil {
 				return matches, err
 			}
+			if offset%(chunkSize<<10) == 0 { // check every 4MB
+				if err := ctx.Err(); err != nil {
+					return matches, err
+				}
+			}
 			copy(chunk, chunk[chunkSize:])
 			offset += chunkSize
 			n, err = sr.Read(chunk[tailLen:])
@@ -709,8 +709,10 @@ func (i *CacheImage) ParseObjC() error {
 			return fmt.Errorf("failed to parse objc methods for image %s: %v", filepath.Base(i.Name), err)
 		}
 		if strings.Contains(i.Name, "libobjc.A.dylib") {
-			if _, err := i.cache.GetAllObjCSelectors(false); err != nil {
+			if sels, err := i.cache.GetAllObjCSelectors(false); err != nil {
 				return fmt.Errorf("failed to parse objc all selectors: %v", err)
+			} else {
+				sels.Close()
 			}
 		} else {
 			if err := i.cache.SelectorsForImage(i.Name); err != nil {
@@ -0,0 +1,153 @@
+package dyld
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/blacktop/go-macho/types"
+)
+
+// RegionMapping is a mapping of a (sub)cache file into the shared region
+type RegionMapping struct {
+	Name            string `json:"name"`
+	File            string `json:"file"` // the (sub)cache file name
+	UUID            string `json:"uuid"`
+	Address         uint64 `json:"address"`
+	Size            uint64 `json:"size"`
+	FileOffset      uint64 `json:"file_offset"`
+	MaxProt         string `json:"max_prot"`
+	InitProt        string `json:"init_prot"`
+	Prot            uint32 `json:"prot"` // init_prot as VM_PROT_* bits (the same values as unicorn's UC_PROT_*)
+	Flags           string `json:"flags,omitempty"`
+	SlideInfoOffset uint64 `json:"slide_info_offset,omitempty"` // file offset of the slide info that rebases the mapping
+	SlideInfoSize   uint64 `json:"slide_info_size,omitempty"`
+	SlideVersion    uint32 `json:"slide_version,omitempty"`
+}
+
+// SharedRegionMap is how dyld maps a dyld_shared_cache (and its subcaches) into the shared region
+type SharedRegionMap struct {
+	Magic    string          `json:"magic"`
+	UUID     string          `json:"uuid"`
+	Base     uint64          `json:"base"` // the unslid base address of the shared region
+	Size     uint64          `json:"size"`
+	MaxSlide uint64          `json:"max_slide"`
+	Mappings []RegionMapping `json:"mappings"`
+}
+
+// cacheFileName returns the name of the (sub)cache file with the UUID
+func (f *File) cacheFileName(uuid types.UUID) string {
+	var name string
+	if fd, ok := f.closers[f.UUID].(*os.File); ok {
+		name = filepath.Base(fd.Name())
+	}
+	if uuid == f.UUID {
+		return name
+	}
+	for idx, sc := range f.SubCacheInfo {
+		if sc.UUID == uuid {
+			if len(sc.Extention) > 0 {
+				return name + sc.Extention
+			}
+			return fmt.Sprintf("%s.%d", name, idx+1)
+		}
+	}
+	return ""
+}
+
+// GetSharedRegionMap returns every mapping of the cache (and its subcaches) with its file offset and
+// protections so that emulators can map the cache exactly as dyld would
+//
+// NOTE: the mappings are at their unslid addresses and the pointers in the writable mappings are still in their
+// on-disk (slide info) format; apply the slide info at slide_info_offset to rebase them
+func (f *File) GetSharedRegionMap() (*SharedRegionMap, error) {
+	hdr, ok := f.Headers[f.UUID]
+	if !ok {
+		return nil, fmt.Errorf("failed to find header for cache UUID %s", f.UUID)
+	}
+
+	srm := &SharedRegionMap{
+		Magic:    hdr.Magic.String(),
+		UUID:     f.UUID.String(),
+		Base:     hdr.SharedRegionStart,
+		Size:     hdr.SharedRegionSize,
+		MaxSlide: uint64(hdr.MaxSlide),
+	}
+
+	for uuid, mappings := range f.MappingsWithSlideInfo {
+		if uuid == f.symUUID { // the .symbols file is never mapped
+			continue
+		}
+		file := f.cacheFileName(uuid)
+		for _, m := range mappings {
+			if m.Size == 0 {
+				continue
+			}
+			rm := RegionMapping{
+				Name:            m.Name,
+				File:            file,
+				UUID:            uuid.String(),
+				Address:         m.Address,
+				Size:            m.Size,
+				FileOffset:      m.FileOffset,
+				MaxProt:         m.MaxProt.String(),
+				InitProt:        m.InitProt.String(),
+				Prot:            uint32(m.InitProt),
+				Flags:           m.Flags.String(),
+				SlideInfoOffset: m.SlideInfoOffset,
+				SlideInfoSize:   m.SlideInfoSize,
+			}
+			if m.SlideInfo != nil {
+				rm.SlideVersion = m.SlideInfo.GetVersion()
+			}
+			srm.Mappings = append(srm.Mappings, rm)
+		}
+	}
+
+	if len(srm.Mappings) == 0 {
+		return nil, fmt.Errorf("cache has no mappings")
+	}
+
+	sort.Slice(srm.Mappings, func(i, j int) bool {
+		return srm.Mappings[i].Address < srm.Mappings[j].Address
+	})
+
+	return srm, nil
+}
+
+// WriteUnicorn writes a python module with a map_cache(uc, cache_dir) function that maps the cache into a unicorn emulator
+func (srm *SharedRegionMap) WriteUnicorn(w io.Writer) error {
+	const pageSize = 0x1000 // unicorn requires 4K aligned mappings
+	if _, err := fmt.Fprintf(w, `# %s shared region map (UUID %s)
+#
+# NOTE: the pointers in the writable mappings still need to be rebased with the cache's slide info
+import os
+
+# (address, size, file, file_offset, size_in_file, prot, name)
+MAPPINGS = [
+`, srm.Magic, srm.UUID); err != nil {
+		return err
+	}
+	for _, m := range srm.Mappings {
+		size := (m.Size + pageSize - 1) &^ (pageSize - 1)
+		if _, err := fmt.Fprintf(w, "    (%#x, %#x, %q, %#x, %#x, %d, %q),\n", m.Address, size, m.File, m.FileOffset, m.Size, m.Prot, m.Name); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, `]
+
+SHARED_REGION_BASE = %#x
+SHARED_REGION_SIZE = %#x
+
+
+def map_cache(uc, cache_dir):
+    for address, size, name, offset, file_size, prot, _ in MAPPINGS:
+        uc.mem_map(address, size, prot)
+        with open(os.path.join(cache_dir, name), "rb") as f:
+            f.seek(offset)
+            uc.mem_write(address, f.read(file_size))
+`, srm.Base, srm.Size)
+	return err
+}
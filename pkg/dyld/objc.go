@@ -14,8 +14,10 @@ import (
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/go-macho/types/objc"
+	"github.com/blacktop/ipsw/internal/spill"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/disass"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/pkg/errors"
 )
 
@@ -199,6 +201,7 @@ func (f *File) getOptimizationsOld() (Optimization, error) {
 	}
 
 	if s := libObjC.Section("__TEXT", "__objc_opt_ro"); s != nil {
+		f.objcOptRoAddr = s.Addr // the base of the objc_opt_t offsets
 		uuid, off, err := f.GetOffset(s.Addr)
 		if err != nil {
 			return nil, err
@@ -295,11 +298,12 @@ func (f *File) getHeaderInfoRO() (*objc_headeropt_ro_t, error) {
 	return &hdr, nil
 }
 
-func (f *File) getSelectorStringHash() (*StringHash, *types.UUID, error) {
-
-	var off uint64
-	var u types.UUID
-	var shash StringHash
+// getStringHash returns the cache's precomputed objc selector, class or protocol perfect hash table (parsed once
+// and then shared by every lookup)
+func (f *File) getStringHash(typ strHashType) (*StringHash, *types.UUID, error) {
+	if shash, ok := f.objcHashes[typ]; ok {
+		return shash, &f.objcHashUUIDs[typ], nil
+	}
 
 	opt, err := f.GetOptimizations()
 	if err != nil {
@@ -311,96 +315,54 @@ func (f *File) getSelectorStringHash() (*StringHash, *types.UUID, error) {
 		return nil, nil, err
 	}
 
-	switch o := opt.(type) {
-	case *ObjCOptimizationHeader:
-		u, off, err = f.GetOffset(f.Headers[f.UUID].SharedRegionStart + o.SelectorHashTableOffset(0))
-		if err != nil {
-			return nil, nil, err
-		}
-		shash = StringHash{Type: selopt, FileOffset: int64(off), hdrRO: hdr, opt: opt}
-		if err = shash.Read(io.NewSectionReader(f.r[u], int64(off), 1<<63-1)); err != nil {
-			return nil, nil, err
-		}
-	case *ObjcOptT:
-		shash = StringHash{Type: selopt, FileOffset: int64(opt.SelectorHashTableOffset(0)), hdrRO: hdr, opt: opt}
-		if err = shash.Read(io.NewSectionReader(f.r[u], int64(opt.SelectorHashTableOffset(0)), 1<<63-1)); err != nil {
-			return nil, nil, err
-		}
+	var base, rel uint64
+	switch opt.(type) {
+	case *ObjCOptimizationHeader: // offsets from the start of the shared region
+		base = f.Headers[f.UUID].SharedRegionStart
+	case *ObjcOptT: // offsets from the start of libobjc's __TEXT.__objc_opt_ro
+		base = f.objcOptRoAddr
 	}
-
-	return &shash, &u, nil
-}
-
-func (f *File) getClassStringHash() (*StringHash, *types.UUID, error) {
-
-	var off uint64
-	var u types.UUID
-	var shash StringHash
-
-	opt, err := f.GetOptimizations()
-	if err != nil {
-		return nil, nil, err
+	switch typ {
+	case selopt:
+		rel = opt.SelectorHashTableOffset(0)
+	case clsopt:
+		rel = opt.ClassHashTableOffset(0)
+	case protocolopt:
+		rel = opt.ProtocolHashTableOffset(0)
 	}
+	if rel == 0 {
+		return nil, nil, errcode.Errorf(errcode.NotFound, "objc optimization has no %s hash table", typ)
+	}
+	addr := base + rel
 
-	hdr, err := f.getHeaderInfoRO()
+	u, off, err := f.GetOffset(addr)
 	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get offset of objc string hash at %#x: %v", addr, err)
+	}
+	shash := &StringHash{Type: typ, FileOffset: int64(off), hdrRO: hdr, opt: opt, r: f.r[u]}
+	if err = shash.Read(io.NewSectionReader(f.r[u], int64(off), 1<<63-1)); err != nil {
 		return nil, nil, err
 	}
 
-	switch o := opt.(type) {
-	case *ObjCOptimizationHeader:
-		u, off, err = f.GetOffset(f.Headers[f.UUID].SharedRegionStart + o.ClassHashTableOffset(0))
-		if err != nil {
-			return nil, nil, err
-		}
-		shash = StringHash{Type: clsopt, FileOffset: int64(off), hdrRO: hdr, opt: opt}
-		if err = shash.Read(io.NewSectionReader(f.r[u], int64(off), 1<<63-1)); err != nil {
-			return nil, nil, err
-		}
-	case *ObjcOptT:
-		shash = StringHash{Type: clsopt, FileOffset: int64(opt.ClassHashTableOffset(0)), hdrRO: hdr, opt: opt}
-		if err = shash.Read(io.NewSectionReader(f.r[u], int64(opt.ClassHashTableOffset(0)), 1<<63-1)); err != nil {
-			return nil, nil, err
-		}
+	if f.objcHashes == nil {
+		f.objcHashes = make(map[strHashType]*StringHash)
 	}
+	f.objcHashes[typ] = shash
+	f.objcHashUUIDs[typ] = u
 
-	return &shash, &u, nil
+	return shash, &f.objcHashUUIDs[typ], nil
 }
 
-func (f *File) getProtocolStringHash() (*StringHash, *types.UUID, error) {
-
-	var off uint64
-	var u types.UUID
-	var shash StringHash
-
-	opt, err := f.GetOptimizations()
-	if err != nil {
-		return nil, nil, err
-	}
-
-	hdr, err := f.getHeaderInfoRO()
-	if err != nil {
-		return nil, nil, err
-	}
+func (f *File) getSelectorStringHash() (*StringHash, *types.UUID, error) {
+	return f.getStringHash(selopt)
+}
 
-	switch o := opt.(type) {
-	case *ObjCOptimizationHeader:
-		u, off, err = f.GetOffset(f.Headers[f.UUID].SharedRegionStart + o.ProtocolHashTableOffset(0))
-		if err != nil {
-			return nil, nil, err
-		}
-		shash = StringHash{Type: clsopt, FileOffset: int64(off), hdrRO: hdr, opt: opt}
-		if err = shash.Read(io.NewSectionReader(f.r[u], int64(off), 1<<63-1)); err != nil {
-			return nil, nil, err
-		}
-	case *ObjcOptT:
-		shash = StringHash{Type: clsopt, FileOffset: int64(opt.ProtocolHashTableOffset(0)), hdrRO: hdr, opt: opt}
-		if err = shash.Read(io.NewSectionReader(f.r[u], int64(opt.ProtocolHashTableOffset(0)), 1<<63-1)); err != nil {
-			return nil, nil, err
-		}
-	}
+func (f *File) getClassStringHash() (*StringHash, *types.UUID, error) {
+	return f.getStringHash(clsopt)
+}
 
-	return &shash, &u, nil
+func (f *File) getProtocolStringHash() (*StringHash, *types.UUID, error) {
+	return f.getStringHash(protocolopt)
 }
 
 func (f *File) getObjcDylibMap(shash *StringHash) {
@@ -583,14 +545,23 @@ func (rw header_info_rw) Next() uint64 {
 // 	}
 // }
 
-type objHashMap struct {
+// ObjCHashObject is a class, selector or protocol (and the dylib that defines it) from the cache's objc hash tables
+type ObjCHashObject struct {
 	Dylib string
 	Name  string
 }
 
-func (f *File) offsetsToMap(shash *StringHash, uuid types.UUID) map[uint64]objHashMap {
+// offsetsToMap indexes the objects of an objc hash table by address (spilling to disk when the memory budget is exceeded)
+func (f *File) offsetsToMap(shash *StringHash, uuid types.UUID) (*spill.Map[ObjCHashObject], error) {
 
-	objcMap := make(map[uint64]objHashMap)
+	objcMap := spill.NewMap[ObjCHashObject]()
+	set := func(addr uint64, obj ObjCHashObject) error {
+		if err := objcMap.Set(addr, obj); err != nil {
+			objcMap.Close()
+			return fmt.Errorf("failed to index objc object at %#x: %w", addr, err)
+		}
+		return nil
+	}
 	sr := io.NewSectionReader(f.r[uuid], 0, 1<<63-1)
 
 	for idx, ptr := range shash.Offsets {
@@ -612,13 +583,12 @@ func (f *File) offsetsToMap(shash *StringHash, uuid types.UUID) map[uint64]objHa
 					if err != nil {
 						log.Errorf("failed to get cache vmaddr for object at cache vmoffset %#x: %v", shash.ObjectOffsets[idx].ObjectCacheOffset(), err)
 					} else {
+						obj := ObjCHashObject{Name: s}
 						if len(shash.dylibMap) > 0 {
-							objcMap[addr] = objHashMap{
-								Dylib: filepath.Base(shash.dylibMap[shash.ObjectOffsets[idx].DylibObjCIndex()]),
-								Name:  s,
-							}
-						} else {
-							objcMap[addr] = objHashMap{Name: s}
+							obj.Dylib = filepath.Base(shash.dylibMap[shash.ObjectOffsets[idx].DylibObjCIndex()])
+						}
+						if err := set(addr, obj); err != nil {
+							return nil, err
 						}
 						f.AddressToSymbol[addr] = s
 					}
@@ -628,31 +598,32 @@ func (f *File) offsetsToMap(shash *StringHash, uuid types.UUID) map[uint64]objHa
 						if err != nil {
 							log.Errorf("failed to get cache vmaddr for object at cache vmoffset %#x: %v", shash.ObjectOffsets[idx].ObjectCacheOffset(), err)
 						} else {
+							obj := ObjCHashObject{Name: s}
 							if len(shash.dylibMap) > 0 {
-								objcMap[addr] = objHashMap{
-									Dylib: filepath.Base(shash.dylibMap[shash.DuplicateOffsets[shash.ObjectOffsets[idx].DuplicateIndex()+uint64(i)].DylibObjCIndex()]),
-									Name:  s,
-								}
-							} else {
-								objcMap[addr] = objHashMap{Name: s}
+								obj.Dylib = filepath.Base(shash.dylibMap[shash.DuplicateOffsets[shash.ObjectOffsets[idx].DuplicateIndex()+uint64(i)].DylibObjCIndex()])
+							}
+							if err := set(addr, obj); err != nil {
+								return nil, err
 							}
 							f.AddressToSymbol[addr] = s
 						}
 					}
 				}
 			} else {
-				objcMap[addr] = objHashMap{Name: s}
+				if err := set(addr, ObjCHashObject{Name: s}); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
 
-	return objcMap
+	return objcMap, nil
 }
 
 // GetAllSelectors is a dumb brute force way to get all the ObjC selector/class etc address
 // by just dumping all the strings in the __OBJC_RO segment
-// returns: map[sym]addr
-func (f *File) GetAllObjCSelectors(print bool) (map[uint64]objHashMap, error) {
+// returns: map[addr]sym (the caller must Close it; it spills to disk when the memory budget is exceeded)
+func (f *File) GetAllObjCSelectors(print bool) (*spill.Map[ObjCHashObject], error) {
 	shash, uuid, err := f.getSelectorStringHash()
 	if err != nil {
 		return nil, fmt.Errorf("failed read selector objc_stringhash_t: %v", err)
@@ -664,7 +635,7 @@ func (f *File) GetAllObjCSelectors(print bool) (map[uint64]objHashMap, error) {
 		f.dumpOffsets(shash, *uuid)
 	}
 
-	return f.offsetsToMap(shash, *uuid), nil
+	return f.offsetsToMap(shash, *uuid)
 }
 
 func (f *File) getStringHashAddresses(shash *StringHash, index uint32, uuid *types.UUID) ([]uint64, error) {
@@ -713,8 +684,8 @@ func (f *File) GetSelectorAddresses(selector string) ([]uint64, error) {
 	return f.getStringHashAddresses(shash, idx, uuid)
 }
 
-// GetAllClasses dumps the classes from the optimized string hash
-func (f *File) GetAllObjCClasses(print bool) (map[uint64]objHashMap, error) {
+// GetAllClasses dumps the classes from the optimized string hash (the caller must Close the returned index)
+func (f *File) GetAllObjCClasses(print bool) (*spill.Map[ObjCHashObject], error) {
 	shash, uuid, err := f.getClassStringHash()
 	if err != nil {
 		return nil, fmt.Errorf("failed read class objc_stringhash_t: %v", err)
@@ -726,7 +697,7 @@ func (f *File) GetAllObjCClasses(print bool) (map[uint64]objHashMap, error) {
 		f.dumpOffsets(shash, *uuid)
 	}
 
-	return f.offsetsToMap(shash, *uuid), nil
+	return f.offsetsToMap(shash, *uuid)
 }
 
 // GetClassAddress returns a class addresses
@@ -744,8 +715,8 @@ func (f *File) GetClassAddresses(class string) ([]uint64, error) {
 	return f.getStringHashAddresses(shash, idx, uuid)
 }
 
-// GetAllProtocols dumps the protols from the optimized string hash
-func (f *File) GetAllObjCProtocols(print bool) (map[uint64]objHashMap, error) {
+// GetAllProtocols dumps the protols from the optimized string hash (the caller must Close the returned index)
+func (f *File) GetAllObjCProtocols(print bool) (*spill.Map[ObjCHashObject], error) {
 	shash, uuid, err := f.getProtocolStringHash()
 	if err != nil {
 		return nil, fmt.Errorf("failed read protocol objc_stringhash_t: %v", err)
@@ -757,7 +728,7 @@ func (f *File) GetAllObjCProtocols(print bool) (map[uint64]objHashMap, error) {
 		f.dumpOffsets(shash, *uuid)
 	}
 
-	return f.offsetsToMap(shash, *uuid), nil
+	return f.offsetsToMap(shash, *uuid)
 }
 
 // GetProtocolAddress returns a protocol addresses
@@ -775,6 +746,73 @@ func (f *File) GetProtocolAddresses(protocol string) ([]uint64, error) {
 	return f.getStringHashAddresses(shash, idx, uuid)
 }
 
+// ObjCHashEntry is an object of the cache's precomputed objc hash tables
+type ObjCHashEntry struct {
+	Name  string `json:"name"`
+	Addr  uint64 `json:"addr"`
+	Image string `json:"image,omitempty"` // the dylib that defines the class/protocol (not set for selectors)
+}
+
+// lookupStringHash returns the objects named name in one of the cache's objc hash tables (without parsing any image)
+func (f *File) lookupStringHash(typ strHashType, name string) ([]ObjCHashEntry, error) {
+	shash, uuid, err := f.getStringHash(typ)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s objc_stringhash_t: %w", typ, err)
+	}
+
+	idx, err := shash.getIndex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(shash.ObjectOffsets) == 0 { // selectors are the string itself
+		addr, err := f.GetVMAddressForUUID(*uuid, uint64(shash.FileOffset+int64(shash.Offsets[idx])))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get address of %s %s: %v", typ, name, err)
+		}
+		return []ObjCHashEntry{{Name: name, Addr: addr}}, nil
+	}
+
+	f.getObjcDylibMap(shash)
+
+	objs := []ObjectData{shash.ObjectOffsets[idx]}
+	if objs[0].IsDuplicate() {
+		start := objs[0].DuplicateIndex()
+		end := start + uint64(objs[0].DuplicateCount())
+		if end > uint64(len(shash.DuplicateOffsets)) {
+			return nil, fmt.Errorf("%s %s duplicates %d-%d are out of bounds (%d)", typ, name, start, end, len(shash.DuplicateOffsets))
+		}
+		objs = shash.DuplicateOffsets[start:end]
+	}
+	entries := make([]ObjCHashEntry, 0, len(objs))
+	for _, obj := range objs {
+		_, addr, err := f.GetCacheVMAddress(obj.ObjectCacheOffset())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get address of %s %s at cache offset %#x: %v", typ, name, obj.ObjectCacheOffset(), err)
+		}
+		entries = append(entries, ObjCHashEntry{Name: name, Addr: addr, Image: shash.dylibMap[obj.DylibObjCIndex()]})
+	}
+
+	return entries, nil
+}
+
+// LookupObjCSelector returns the unique selector string via the cache's precomputed selector hash table
+func (f *File) LookupObjCSelector(selector string) ([]ObjCHashEntry, error) {
+	return f.lookupStringHash(selopt, selector)
+}
+
+// LookupObjCClass returns the classes named class (and the dylibs that implement them) via the cache's precomputed
+// class hash table instead of parsing every image's ObjC metadata
+func (f *File) LookupObjCClass(class string) ([]ObjCHashEntry, error) {
+	return f.lookupStringHash(clsopt, class)
+}
+
+// LookupObjCProtocol returns the protocols named protocol (and the dylibs that define them) via the cache's
+// precomputed protocol hash table
+func (f *File) LookupObjCProtocol(protocol string) ([]ObjCHashEntry, error) {
+	return f.lookupStringHash(protocolopt, protocol)
+}
+
 // ClassesForImage returns all of the Objective-C classes for a given image
 func (f *File) ClassesForImage(imageNames ...string) error {
 	var images []*CacheImage
@@ -1456,17 +1494,23 @@ func (f *File) GetObjCStubsForImage(imageNames ...string) error {
 
 // ParseAllObjc parses all the ObjC data in the cache and loads it into the symbol table
 func (f *File) ParseAllObjc() error {
-	if _, err := f.GetAllObjCClasses(false); err != nil {
+	if classes, err := f.GetAllObjCClasses(false); err != nil {
 		return fmt.Errorf("failed to parse objc classes: %v", err)
+	} else {
+		classes.Close()
 	}
 	if err := f.GetAllObjcMethods(); err != nil { // TODO: should I put this back in? The same info is in the symbols
 		return fmt.Errorf("failed to parse objc methods: %v", err)
 	}
-	if _, err := f.GetAllObjCSelectors(false); err != nil {
+	if sels, err := f.GetAllObjCSelectors(false); err != nil {
 		return fmt.Errorf("failed to parse objc selectors: %v", err)
+	} else {
+		sels.Close()
 	}
-	if _, err := f.GetAllObjCProtocols(false); err != nil {
+	if protos, err := f.GetAllObjCProtocols(false); err != nil {
 		return fmt.Errorf("failed to parse objc protocols: %v", err)
+	} else {
+		protos.Close()
 	}
 	if err := f.GetAllObjCStubs(); err != nil {
 		return fmt.Errorf("failed to parse objc stubs: %v", err)
@@ -1501,8 +1545,10 @@ func (f *File) ParseObjcForImage(imageNames ...string) error {
 			}
 		}
 		if strings.Contains(image.Name, "libobjc.A.dylib") {
-			if _, err := f.GetAllObjCSelectors(false); err != nil {
+			if sels, err := f.GetAllObjCSelectors(false); err != nil {
 				return fmt.Errorf("failed to parse objc all selectors: %v", err)
+			} else {
+				sels.Close()
 			}
 		} else {
 			if err := f.SelectorsForImage(image.Name); err != nil {
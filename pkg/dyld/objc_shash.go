@@ -1,11 +1,13 @@
 package dyld
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
 
 	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
 )
 
 /*
@@ -19,8 +21,21 @@ type strHashType uint8
 const (
 	selopt strHashType = iota
 	clsopt
+	protocolopt
 )
 
+func (t strHashType) String() string {
+	switch t {
+	case selopt:
+		return "selector"
+	case clsopt:
+		return "class"
+	case protocolopt:
+		return "protocol"
+	}
+	return fmt.Sprintf("strHashType(%d)", t)
+}
+
 type stringHash struct {
 	Capacity uint32
 	Occupied uint32
@@ -59,6 +74,7 @@ type StringHash struct {
 	hdrRW    *objc_headeropt_rw_t
 	opt      Optimization
 	dylibMap map[uint16]string
+	r        io.ReaderAt // the (sub)cache the table and its strings are in
 }
 
 // Capacity returns the Capacity
@@ -157,7 +173,7 @@ func (s *StringHash) Read(r io.ReadSeeker) error {
 		return err
 	}
 
-	if s.Type == clsopt {
+	if s.Type != selopt { // objc_clsopt_t and objc_protocolopt_t also have the objects' offsets
 		s.ObjectOffsets = make([]ObjectData, s.Capacity())
 		if err := binary.Read(r, binary.LittleEndian, &s.ObjectOffsets); err != nil {
 			if err == io.ErrUnexpectedEOF { // FIXME: gross hack (selectors don't use these fields)
@@ -410,26 +426,35 @@ func (s StringHash) hash(key []byte) uint32 {
 
 func (s StringHash) getIndex(keyStr string) (uint32, error) {
 	key := []byte(keyStr)
+	if len(key) == 0 || s.Capacity() == 0 {
+		return 0, errcode.Errorf(errcode.NotFound, "%q not found in objc string hash", keyStr)
+	}
 
 	h := s.hash(key)
+	if h >= uint32(len(s.CheckBytes)) || h >= uint32(len(s.Offsets)) {
+		return 0, errcode.Errorf(errcode.NotFound, "%q not found in objc string hash", keyStr)
+	}
 
 	// Use check byte to reject without paging in the table's cstrings
-	hCheck := s.CheckBytes[h]
-	keyCheck := checkbyte(key)
-	if hCheck != keyCheck {
-		return 0, fmt.Errorf("INDEX_NOT_FOUND")
+	if s.CheckBytes[h] != checkbyte(key) {
+		return 0, errcode.Errorf(errcode.NotFound, "%q not found in objc string hash", keyStr)
 	}
 
 	offset := s.Offsets[h]
 	if offset == 0 {
-		return 0, fmt.Errorf("INDEX_NOT_FOUND")
+		return 0, errcode.Errorf(errcode.NotFound, "%q not found in objc string hash", keyStr)
+	}
+
+	// result = (const char *)this + offset (the perfect hash maps every string to *some* slot so it must match)
+	if s.r != nil {
+		str := make([]byte, len(key)+1)
+		if _, err := s.r.ReadAt(str, s.FileOffset+int64(offset)); err != nil {
+			return 0, fmt.Errorf("failed to read objc string hash string at %#x: %v", s.FileOffset+int64(offset), err)
+		}
+		if !bytes.Equal(str, append(key, 0)) {
+			return 0, errcode.Errorf(errcode.NotFound, "%q not found in objc string hash", keyStr)
+		}
 	}
-	// result = (const char *)this + offset
-	// TODO: fix me
-	// result := "FIX ME"
-	// if result != string(key) {
-	// 	return 0, fmt.Errorf("INDEX_NOT_FOUND")
-	// }
 
 	return h, nil
 }
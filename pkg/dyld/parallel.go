@@ -0,0 +1,135 @@
+package dyld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+// ImageError is a failure (or recovered panic) while processing a single image
+type ImageError struct {
+	Index int
+	Image string
+	Err   error
+	Stack []byte // set if the handler panicked
+}
+
+func (e *ImageError) Error() string {
+	if e.Stack != nil {
+		return fmt.Sprintf("%s: panic: %v", e.Image, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Image, e.Err)
+}
+
+func (e *ImageError) Unwrap() error { return e.Err }
+
+// ImageErrors are the per-image failures of a whole-cache operation (sorted by image index)
+type ImageErrors []*ImageError
+
+func (e ImageErrors) Error() string {
+	if len(e) == 1 {
+		return "failed to process 1 image: " + e[0].Error()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "failed to process %d images:", len(e))
+	for _, ie := range e {
+		sb.WriteString("\n\t" + ie.Error())
+	}
+	return sb.String()
+}
+
+func (e ImageErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, ie := range e {
+		errs = append(errs, ie)
+	}
+	return errs
+}
+
+// ForEachImage calls handler for every image (and its index in f.Images) in the cache using a pool of workers (NumCPU if workers <= 0)
+//
+// A handler that returns an error or panics only fails its own image; the remaining images are still processed and
+// all the failures are returned together as ImageErrors. The returned error is ctx.Err() if the context is done.
+//
+// NOTE: handlers run concurrently so they must only touch per-image state (i.e. the image's MachO), shared
+// File state like AddressToSymbol is only safe to read while no handler writes to it.
+func (f *File) ForEachImage(ctx context.Context, workers int, handler func(ctx context.Context, idx int, img *CacheImage) error) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(f.Images) {
+		workers = len(f.Images)
+	}
+
+	// initialize lazily parsed shared state before the workers race to do it
+	if _, err := f.Image("/usr/lib/libobjc.A.dylib"); err == nil {
+		f.GetOptimizations()
+	}
+
+	var (
+		mu   sync.Mutex
+		errs ImageErrors
+		wg   sync.WaitGroup
+	)
+	indexes := make(chan int)
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				if err := f.runImage(ctx, idx, handler); err != nil {
+					log.WithField("image", f.Images[idx].Name).Debugf("failed to process image: %v", err.Err)
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for idx := range f.Images {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Index < errs[j].Index })
+		return errs
+	}
+	return nil
+}
+
+func (f *File) runImage(ctx context.Context, idx int, handler func(context.Context, int, *CacheImage) error) (ierr *ImageError) {
+	img := f.Images[idx]
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+			ierr = &ImageError{Index: idx, Image: img.Name, Err: err, Stack: debug.Stack()}
+		}
+	}()
+	if err := handler(ctx, idx, img); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil // reported once by ForEachImage
+		}
+		return &ImageError{Index: idx, Image: img.Name, Err: err}
+	}
+	return nil
+}
@@ -435,7 +435,7 @@ func (f *File) parsePrebuiltLoader(sr *io.SectionReader) (*PrebuiltLoader, error
 		if err := binary.Read(sr, binary.LittleEndian, &pbl.UUID); err != nil {
 			return nil, fmt.Errorf("failed to read prebuilt loader uuid: %v", err)
 		}
-		if err := binary.Read(sr, binary.LittleEndian, &pbl.Unknown); err != nil {
+		if err := binary.Read(sr, binary.LittleEndian, &pbl.CpuSubtype); err != nil {
 			return nil, fmt.Errorf("failed to read prebuilt loader unknown: %v", err)
 		}
 	}
@@ -0,0 +1,306 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	dumpPageSize  = 0x1000
+	dumpChunkSize = 0x100000
+	// userspace VAs (strips PAC/TBI bits from signed pointers)
+	dumpPointerMask = 0x0000_7fff_ffff_ffff
+)
+
+var cacheMagicPrefix = []byte("dyld_v1")
+
+// ErrNoCacheInDump is returned when a process dump does not contain a dyld_shared_cache header
+var ErrNoCacheInDump = errors.New("no dyld_shared_cache header found in dump")
+
+// DumpRegion is a region of a userspace process memory dump
+type DumpRegion struct {
+	Name    string `json:"name,omitempty"`
+	Address uint64 `json:"address"`
+	Size    uint64 `json:"size"`
+
+	r io.ReaderAt
+}
+
+// ReadAt reads from the region at the offset from its start address
+func (r *DumpRegion) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
+
+// Contains returns if the (slid) address is within the region
+func (r *DumpRegion) Contains(addr uint64) bool {
+	return r.Address <= addr && addr < r.Address+r.Size
+}
+
+// ProcessDump is a userspace process memory dump
+type ProcessDump struct {
+	Regions []*DumpRegion
+
+	closers []io.Closer
+}
+
+// OpenProcessDump opens a process memory dump
+//
+// The dump can be a Mach-O core file (e.g. from `gcore` or lldb's `process save-core`) OR
+// a raw memory region (e.g. from lldb's `memory read --binary`) that was dumped starting at base.
+func OpenProcessDump(path string, base uint64) (*ProcessDump, error) {
+	if m, err := macho.Open(path); err == nil {
+		if m.FileTOC.FileHeader.Type != types.MH_CORE {
+			m.Close()
+			return nil, fmt.Errorf("%s is a %s MachO (expected a MH_CORE process dump)", path, m.FileTOC.FileHeader.Type)
+		}
+		pd := &ProcessDump{closers: []io.Closer{m}}
+		for _, seg := range m.Segments() {
+			if seg.Filesz == 0 {
+				continue
+			}
+			pd.Regions = append(pd.Regions, &DumpRegion{
+				Name:    seg.Name,
+				Address: seg.Addr,
+				Size:    seg.Filesz,
+				r:       seg.ReaderAt,
+			})
+		}
+		pd.sort()
+		return pd, nil
+	}
+
+	if base == 0 {
+		return nil, fmt.Errorf("%s is a raw memory dump: you must supply the address it was dumped from", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ProcessDump{
+		Regions: []*DumpRegion{{Name: fi.Name(), Address: base, Size: uint64(fi.Size()), r: f}},
+		closers: []io.Closer{f},
+	}, nil
+}
+
+// AddRegion adds a region dumped at address to the process dump
+func (pd *ProcessDump) AddRegion(name string, address uint64, r io.ReaderAt, size uint64) {
+	pd.Regions = append(pd.Regions, &DumpRegion{Name: name, Address: address, Size: size, r: r})
+	pd.sort()
+}
+
+func (pd *ProcessDump) sort() {
+	sort.Slice(pd.Regions, func(i, j int) bool { return pd.Regions[i].Address < pd.Regions[j].Address })
+}
+
+// Close closes the process dump
+func (pd *ProcessDump) Close() error {
+	var errs []error
+	for _, c := range pd.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DumpCacheHeader is a dyld_shared_cache header found in a process dump
+type DumpCacheHeader struct {
+	Address uint64      `json:"address"`
+	UUID    types.UUID  `json:"uuid"`
+	Region  *DumpRegion `json:"-"`
+}
+
+// FindCacheHeaders scans the page aligned addresses of the dump for dyld_shared_cache headers
+func (pd *ProcessDump) FindCacheHeaders() []DumpCacheHeader {
+	var hdrs []DumpCacheHeader
+	buf := make([]byte, 0x70)
+	for _, r := range pd.Regions {
+		off := (dumpPageSize - r.Address%dumpPageSize) % dumpPageSize
+		for ; off+uint64(len(buf)) <= r.Size; off += dumpPageSize {
+			if _, err := r.ReadAt(buf, int64(off)); err != nil {
+				break
+			}
+			if !bytes.HasPrefix(buf, cacheMagicPrefix) {
+				continue
+			}
+			var uuid types.UUID
+			copy(uuid[:], buf[0x58:0x68]) // dyld_cache_header.uuid
+			hdrs = append(hdrs, DumpCacheHeader{Address: r.Address + off, UUID: uuid, Region: r})
+		}
+	}
+	return hdrs
+}
+
+// DumpImage is a dylib from the dyld_shared_cache that is present in a process dump
+type DumpImage struct {
+	Name    string `json:"name"`
+	Address uint64 `json:"address"` // slid __TEXT address
+	Size    uint64 `json:"size"`
+	Region  string `json:"region,omitempty"`
+}
+
+// DumpPointer is a pointer found in a process dump that points into the dyld_shared_cache
+type DumpPointer struct {
+	Address uint64 `json:"address"` // slid address of the pointer
+	Value   uint64 `json:"value"`   // slid (PAC stripped) pointer value
+	Image   string `json:"image"`
+	Symbol  string `json:"symbol,omitempty"`
+}
+
+// DumpAnalysis is the result of matching a process dump to a dyld_shared_cache
+type DumpAnalysis struct {
+	UUID    types.UUID               `json:"uuid"`
+	Slide   uint64                   `json:"slide"`
+	Headers []DumpCacheHeader        `json:"headers,omitempty"`
+	Images  []DumpImage              `json:"images,omitempty"`
+	Regions map[string][]*DumpRegion `json:"regions,omitempty"` // cache mapping name -> dumped regions
+
+	f *File
+}
+
+// MatchProcessDump matches the process dump against the dyld_shared_cache
+//
+// If slide is 0, the slide is calculated from the cache header(s) found in the dump.
+func (f *File) MatchProcessDump(pd *ProcessDump, slide uint64) (*DumpAnalysis, error) {
+	da := &DumpAnalysis{
+		UUID:    f.UUID,
+		Slide:   slide,
+		Regions: make(map[string][]*DumpRegion),
+		f:       f,
+	}
+
+	da.Headers = pd.FindCacheHeaders()
+
+	if slide == 0 {
+		if len(da.Headers) == 0 {
+			return nil, ErrNoCacheInDump
+		}
+		var found bool
+		for _, hdr := range da.Headers {
+			maps, ok := f.Mappings[hdr.UUID]
+			if !ok || len(maps) == 0 {
+				continue
+			}
+			da.Slide = hdr.Address - maps[0].Address
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("dump's dyld_shared_cache UUID %s does NOT match cache %s", da.Headers[0].UUID, f.UUID)
+		}
+	}
+
+	for _, r := range pd.Regions {
+		if r.Address < da.Slide {
+			continue
+		}
+		for _, maps := range f.Mappings {
+			for _, m := range maps {
+				start := m.Address + da.Slide
+				if r.Address < start+m.Size && start < r.Address+r.Size {
+					da.Regions[m.Name] = append(da.Regions[m.Name], r)
+				}
+			}
+		}
+	}
+
+	for _, img := range f.Images {
+		start := img.CacheImageTextInfo.LoadAddress + da.Slide
+		for _, r := range pd.Regions {
+			if r.Contains(start) {
+				da.Images = append(da.Images, DumpImage{
+					Name:    img.Name,
+					Address: start,
+					Size:    uint64(img.TextSegmentSize),
+					Region:  r.Name,
+				})
+				break
+			}
+		}
+	}
+
+	return da, nil
+}
+
+// Unslide returns the cache's unslid address for a (slid) address in the dump
+func (da *DumpAnalysis) Unslide(addr uint64) uint64 {
+	return addr - da.Slide
+}
+
+// Symbolicate returns the symbol for the (slid) address in the dump
+func (da *DumpAnalysis) Symbolicate(addr uint64) (*CacheImage, string, error) {
+	unslid := da.Unslide(addr)
+	img, err := da.f.GetImageContainingTextAddr(unslid)
+	if err != nil {
+		return nil, "", err
+	}
+	if sym, ok := da.f.AddressToSymbol[unslid]; ok {
+		return img, sym, nil
+	}
+	if err := img.ParsePublicSymbols(false); err != nil {
+		return img, "", fmt.Errorf("failed to parse exported symbols for %s: %w", img.Name, err)
+	}
+	if err := img.ParseLocalSymbols(false); err != nil && !errors.Is(err, ErrNoLocals) {
+		return img, "", fmt.Errorf("failed to parse local symbols for %s: %w", img.Name, err)
+	}
+	if sym, ok := da.f.AddressToSymbol[unslid]; ok {
+		return img, sym, nil
+	}
+	m, err := img.GetMacho()
+	if err != nil {
+		return img, "", err
+	}
+	if fn, err := m.GetFunctionForVMAddr(unslid); err == nil {
+		if sym, ok := da.f.AddressToSymbol[fn.StartAddr]; ok {
+			return img, fmt.Sprintf("%s + %d", sym, unslid-fn.StartAddr), nil
+		}
+		return img, fmt.Sprintf("func_%x + %d", fn.StartAddr, unslid-fn.StartAddr), nil
+	}
+	return img, "", nil
+}
+
+// Pointers scans the dumped region for pointers into the dyld_shared_cache dylibs' __TEXT and symbolicates them
+func (da *DumpAnalysis) Pointers(r *DumpRegion) ([]DumpPointer, error) {
+	var ptrs []DumpPointer
+	buf := make([]byte, dumpChunkSize)
+	for off := uint64(0); off < r.Size; off += dumpChunkSize {
+		n, err := r.ReadAt(buf, int64(off))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read region %s at %#x: %v", r.Name, r.Address+off, err)
+		}
+		for i := 0; i+8 <= n; i += 8 {
+			val := binary.LittleEndian.Uint64(buf[i:]) & dumpPointerMask
+			if val < da.Slide {
+				continue
+			}
+			if _, err := da.f.GetImageContainingTextAddr(da.Unslide(val)); err != nil {
+				continue
+			}
+			img, sym, err := da.Symbolicate(val)
+			if err != nil && img == nil {
+				continue
+			}
+			ptrs = append(ptrs, DumpPointer{
+				Address: r.Address + off + uint64(i),
+				Value:   val,
+				Image:   img.Name,
+				Symbol:  sym,
+			})
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return ptrs, nil
+}
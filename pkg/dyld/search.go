@@ -0,0 +1,89 @@
+package dyld
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// SymbolMatch is an exported symbol, local symbol or ObjC selector that matched a SearchSymbols pattern
+type SymbolMatch struct {
+	Name    string `json:"name"`
+	Image   string `json:"image,omitempty"` // not set for selectors the cache's ObjC optimizations don't map to an image
+	Address uint64 `json:"address"`
+	Kind    string `json:"kind"` // export, local or selector
+}
+
+// SearchSymbols returns the symbols in the export tries, local symbols (the .symbols subcache) and
+// ObjC selectors of every image in the cache whose name matches the pattern
+//
+// NOTE: images are searched in parallel; images that fail are skipped and returned as ImageErrors along with the other matches
+func SearchSymbols(f *File, pattern *regexp.Regexp) ([]SymbolMatch, error) {
+	return SearchSymbolsContext(context.Background(), f, pattern, 0)
+}
+
+// SearchSymbolsContext is like SearchSymbols but uses the given number of workers and stops once the context is done
+func SearchSymbolsContext(ctx context.Context, f *File, pattern *regexp.Regexp, workers int) ([]SymbolMatch, error) {
+	if pattern == nil {
+		return nil, fmt.Errorf("'pattern' cannot be empty")
+	}
+
+	// the local symbols and selectors populate the shared AddressToSymbol map so they are parsed before the workers start
+	if err := f.ParseLocalSymsContext(ctx, false); err != nil {
+		if !errors.Is(err, ErrNoLocals) {
+			return nil, fmt.Errorf("failed to parse local symbols: %w", err)
+		}
+		log.Debug(err.Error())
+	}
+	var selectors []SymbolMatch
+	if sels, err := f.GetAllObjCSelectors(false); err != nil {
+		log.Debugf("failed to get objc selectors: %v", err)
+	} else {
+		err := sels.Range(func(addr uint64, sel ObjCHashObject) error {
+			if pattern.MatchString(sel.Name) {
+				selectors = append(selectors, SymbolMatch{Name: sel.Name, Image: sel.Dylib, Address: addr, Kind: SELECTOR.String()})
+			}
+			return nil
+		})
+		sels.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to search objc selectors: %w", err)
+		}
+		sort.Slice(selectors, func(i, j int) bool { return selectors[i].Address < selectors[j].Address })
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([][]SymbolMatch, len(f.Images)) // keep the matches in image order
+	err := f.ForEachImage(ctx, workers, func(ctx context.Context, idx int, img *CacheImage) error {
+		var matches []SymbolMatch
+		exports, err := f.GetExportTrieSymbols(img)
+		if err != nil && !errors.Is(err, ErrNoExportTrieInMachO) {
+			return err
+		}
+		for _, exp := range exports {
+			if pattern.MatchString(exp.Name) {
+				matches = append(matches, SymbolMatch{Name: exp.Name, Image: img.Name, Address: exp.Address, Kind: EXPORT.String()})
+			}
+		}
+		for _, lsym := range img.LocalSymbols {
+			if pattern.MatchString(lsym.Name) {
+				matches = append(matches, SymbolMatch{Name: lsym.Name, Image: img.Name, Address: lsym.Value, Kind: LOCAL.String()})
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].Address < matches[j].Address })
+		results[idx] = matches
+		return nil
+	})
+
+	var matches []SymbolMatch
+	for _, r := range results {
+		matches = append(matches, r...)
+	}
+	return append(matches, selectors...), err
+}
@@ -42,6 +42,7 @@ const (
 	EXPORT
 	SYMTAB
 	BIND
+	SELECTOR
 )
 
 func (k symKind) String() string {
@@ -56,6 +57,8 @@ func (k symKind) String() string {
 		return "symtab"
 	case BIND:
 		return "bind"
+	case SELECTOR:
+		return "selector"
 	default:
 		return "unknown"
 	}
@@ -96,7 +99,15 @@ func (s Symbol) String(color bool) string {
 
 // ParseLocalSyms parses dyld's private symbols
 func (f *File) ParseLocalSyms(dump bool) error {
+	return f.ParseLocalSymsContext(context.Background(), dump)
+}
+
+// ParseLocalSymsContext is like ParseLocalSyms but stops (returning ctx.Err()) once the context is done
+func (f *File) ParseLocalSymsContext(ctx context.Context, dump bool) error {
 	for _, image := range f.Images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := image.ParseLocalSymbols(dump); err != nil {
 			return err
 		}
@@ -177,7 +188,15 @@ func (f *File) GetExportTrieSymbols(i *CacheImage) ([]trie.TrieExport, error) {
 
 // ParsePublicSymbols prints out all the exported symbols
 func (f *File) ParsePublicSymbols(dump bool) error {
+	return f.ParsePublicSymbolsContext(context.Background(), dump)
+}
+
+// ParsePublicSymbolsContext is like ParsePublicSymbols but stops (returning ctx.Err()) once the context is done
+func (f *File) ParsePublicSymbolsContext(ctx context.Context, dump bool) error {
 	for _, image := range f.Images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := image.ParsePublicSymbols(dump); err != nil {
 			return err
 		}
@@ -286,7 +305,11 @@ func (f *File) GetExportedSymbols(ctx context.Context, symbolName string) (<-cha
 
 	if f.SupportsDylibPrebuiltLoader() {
 		errs.Go(func() error {
+			defer close(syms)
 			for _, image := range f.Images {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				pbl, err := f.GetDylibPrebuiltLoader(image.Name)
 				if err != nil {
 					return fmt.Errorf("failed to get prebuilt loader for %s: %s", image.Name, err)
@@ -313,7 +336,6 @@ func (f *File) GetExportedSymbols(ctx context.Context, symbolName string) (<-cha
 					}
 				}
 			}
-			close(syms)
 			return nil
 		})
 		return syms, errs.Wait()
@@ -355,13 +377,21 @@ func (f *File) GetStubIslands() (map[uint64]string, error) {
 
 // OpenOrCreateA2SCache returns an address to symbol map if the cache file exists otherwise it will create a NEW one
 func (f *File) OpenOrCreateA2SCache(cacheFile string) error {
+	return f.OpenOrCreateA2SCacheContext(context.Background(), cacheFile)
+}
+
+// OpenOrCreateA2SCacheContext is like OpenOrCreateA2SCache but stops (returning ctx.Err()) once the context is done
+func (f *File) OpenOrCreateA2SCacheContext(ctx context.Context, cacheFile string) error {
 	if _, err := os.Stat(cacheFile); os.IsNotExist(err) {
 		log.Info("parsing public symbols...")
-		if err := f.ParsePublicSymbols(false); err != nil {
+		if err := f.ParsePublicSymbolsContext(ctx, false); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
 			utils.Indent(log.Warn, 2)(fmt.Sprintf("failed to parse all exported symbols: %v", err))
 		}
 		log.Info("parsing private symbols...")
-		if err = f.ParseLocalSyms(false); err != nil {
+		if err = f.ParseLocalSymsContext(ctx, false); err != nil {
 			if errors.Is(err, ErrNoLocals) {
 				utils.Indent(log.Warn, 2)("cache does NOT contain local symbols")
 			} else {
@@ -383,6 +413,9 @@ func (f *File) OpenOrCreateA2SCache(cacheFile string) error {
 				}
 			}
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		log.Info("parsing objc info...")
 		if err := f.ParseAllObjc(); err != nil {
 			utils.Indent(log.Error, 2)(fmt.Sprintf("failed to parse objc info: %v: Continuing on without it...", err))
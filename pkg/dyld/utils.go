@@ -3,6 +3,7 @@ package dyld
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/blacktop/go-macho/types"
@@ -169,6 +170,21 @@ func (f *File) ReadBytesForUUID(uuid types.UUID, offset int64, size uint64) ([]b
 	return data, nil
 }
 
+// NewSectionReaderAtAddress returns a reader of the size bytes at a given virtual address (which must all be in the same mapping)
+func (f *File) NewSectionReaderAtAddress(address, size uint64) (*io.SectionReader, error) {
+	for uuid, cacheMaps := range f.Mappings {
+		for _, mapping := range cacheMaps {
+			if mapping.Address <= address && address < mapping.Address+mapping.Size {
+				if address+size > mapping.Address+mapping.Size {
+					return nil, fmt.Errorf("range %#x-%#x crosses the end of its mapping at %#x", address, address+size, mapping.Address+mapping.Size)
+				}
+				return io.NewSectionReader(f.r[uuid], int64(address-mapping.Address+mapping.FileOffset), int64(size)), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("address %#x not within any mappings address range", address)
+}
+
 // ReadPointerForUUID returns pointer at a given offset for a given cache UUID
 func (f *File) ReadPointerForUUID(uuid types.UUID, offset uint64) (uint64, error) {
 	u64 := make([]byte, 8)
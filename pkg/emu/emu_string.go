@@ -1,5 +1,7 @@
 // Code generated by "stringer -type=interrupt,branchType,pstateMode -tags=unicorn -output emu_string.go"; DO NOT EDIT.
 
+//go:build unicorn
+
 package emu
 
 import "strconv"
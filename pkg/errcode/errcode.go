@@ -0,0 +1,152 @@
+// Package errcode defines the error taxonomy shared by pkg/, the CLI and the API so that automation can branch on the
+// cause of a failure (via errors.Is, the process exit code or the JSON error object) instead of parsing messages.
+package errcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/blacktop/go-macho"
+)
+
+// Code is a machine-readable error category
+type Code string
+
+const (
+	Unknown         Code = "unknown"
+	InvalidArgument Code = "invalid_argument"
+	NotFound        Code = "not_found"
+	InvalidFormat   Code = "invalid_format"
+	NotKernelcache  Code = "not_kernelcache"
+	NotDyldCache    Code = "not_dyld_shared_cache"
+	MissingSection  Code = "missing_section"
+	Encrypted       Code = "encrypted"
+	Unsupported     Code = "unsupported"
+	Canceled        Code = "canceled"
+)
+
+// exitCodes are the process exit codes for each error category (1 is reserved for Unknown, 2 for usage errors)
+var exitCodes = map[Code]int{
+	Unknown:         1,
+	InvalidArgument: 2,
+	NotFound:        3,
+	InvalidFormat:   4,
+	NotKernelcache:  10,
+	NotDyldCache:    11,
+	MissingSection:  12,
+	Encrypted:       13,
+	Unsupported:     14,
+	Canceled:        130, // same as SIGINT
+}
+
+// ExitCode returns the process exit code for the category
+func (c Code) ExitCode() int {
+	if code, ok := exitCodes[c]; ok {
+		return code
+	}
+	return exitCodes[Unknown]
+}
+
+// httpStatuses are the API response statuses for each error category
+var httpStatuses = map[Code]int{
+	Unknown:         http.StatusInternalServerError,
+	InvalidArgument: http.StatusBadRequest,
+	NotFound:        http.StatusNotFound,
+	InvalidFormat:   http.StatusUnprocessableEntity,
+	NotKernelcache:  http.StatusUnprocessableEntity,
+	NotDyldCache:    http.StatusUnprocessableEntity,
+	MissingSection:  http.StatusUnprocessableEntity,
+	Encrypted:       http.StatusUnprocessableEntity,
+	Unsupported:     http.StatusNotImplemented,
+	Canceled:        http.StatusRequestTimeout,
+}
+
+// HTTPStatus returns the API response status for the category
+func (c Code) HTTPStatus() int {
+	if status, ok := httpStatuses[c]; ok {
+		return status
+	}
+	return httpStatuses[Unknown]
+}
+
+// Error is an error with a category
+type Error struct {
+	Code Code
+	Err  error
+}
+
+// New returns a sentinel error for a category; errors.Is reports any *Error with the same Code as matching it
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Err: errors.New(msg)}
+}
+
+// Errorf formats an error (supporting %w) and tags it with a category
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is an *Error of the same category
+func (e *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return t.Code == e.Code
+	}
+	return false
+}
+
+// Of returns the category of an error (the outermost *Error in its chain) or Unknown
+func Of(err error) Code {
+	var e *Error
+	var fe *macho.FormatError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &e):
+		return e.Code
+	case errors.As(err, &fe):
+		return InvalidFormat
+	case errors.Is(err, fs.ErrNotExist):
+		return NotFound
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	default:
+		return Unknown
+	}
+}
+
+// ExitCode returns the process exit code for an error (0 for nil)
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return Of(err).ExitCode()
+}
+
+// HTTPStatus returns the API response status for an error (200 for nil)
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return Of(err).HTTPStatus()
+}
+
+// JSON is the machine-readable representation of an error
+type JSON struct {
+	Error    string `json:"error"`
+	Code     Code   `json:"code"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// ToJSON returns the machine-readable representation of an error
+func ToJSON(err error) JSON {
+	return JSON{
+		Error:    err.Error(),
+		Code:     Of(err),
+		ExitCode: ExitCode(err),
+	}
+}
@@ -0,0 +1,56 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+)
+
+var errEncrypted = New(Encrypted, "payload is encrypted")
+
+func TestErrorCategories(t *testing.T) {
+	err := fmt.Errorf("failed to decompress kernelcache: %w", Errorf(Encrypted, "unsupported compression (possibly encrypted)"))
+	if !errors.Is(err, errEncrypted) {
+		t.Error("errors.Is should match an error of the same category")
+	}
+	if errors.Is(err, New(MissingSection, "missing section")) {
+		t.Error("errors.Is should not match an error of a different category")
+	}
+	if got := ExitCode(err); got != 13 {
+		t.Errorf("ExitCode() = %d, want 13", got)
+	}
+	if j := ToJSON(err); j.Code != Encrypted || j.Error != err.Error() {
+		t.Errorf("ToJSON() = %+v", j)
+	}
+
+	_, err = os.Open("/does/not/exist")
+	if got := Of(err); got != NotFound {
+		t.Errorf("Of(ENOENT) = %s, want %s", got, NotFound)
+	}
+	if got := ExitCode(errors.New("boom")); got != 1 {
+		t.Errorf("ExitCode(unknown) = %d, want 1", got)
+	}
+	if got := ExitCode(nil); got != 0 {
+		t.Errorf("ExitCode(nil) = %d, want 0", got)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{nil, http.StatusOK},
+		{errors.New("boom"), http.StatusInternalServerError},
+		{fmt.Errorf("bad filter: %w", Errorf(InvalidArgument, "invalid regex")), http.StatusBadRequest},
+		{fmt.Errorf("failed to open: %w", os.ErrNotExist), http.StatusNotFound},
+		{New(NotKernelcache, "not a kernelcache"), http.StatusUnprocessableEntity},
+		{New(Unsupported, "unsupported compression format"), http.StatusNotImplemented},
+	} {
+		if got := HTTPStatus(tt.err); got != tt.want {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
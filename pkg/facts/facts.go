@@ -0,0 +1,232 @@
+// Package facts exports recovered binary facts (functions, calls, string references and imports) as a relational
+// fact database so users can write their own (CodeQL/Datalog style) queries over entire firmware images.
+//
+// Schema (the same relations are written to SQLite tables and Soufflé .facts files):
+//
+//	images(image, uuid, kind)                  every analyzed MachO/kext/dylib (kind is macho, kext or dylib)
+//	functions(image, addr, name, size)         every function (imports that weren't scanned have size 0)
+//	calls(image, caller, callee, site, kind)   every call (kind is call, tailcall, stub, objc or indirect)
+//	string_refs(image, func, site, addr, value) every C string referenced by a function
+//	imports(image, symbol, library)            every imported symbol (library is empty when it's flat/dynamic lookup)
+//
+// The SQLite database also has a string_xrefs(image, value, addr, func, name, site) view that joins every string
+// reference with the name of its function, i.e. SELECT name FROM string_xrefs WHERE value LIKE '%panic%'
+//
+// The image columns are the image of the function (or caller) as separate MachOs can share addresses.
+// Addresses are stored as SQLite INTEGERs (kernel addresses wrap to negative two's complement values, use
+// printf('%x', addr) to print them) and as hex symbols (i.e. "0xfffffff007004000") in the Soufflé facts.
+package facts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Image is an analyzed MachO
+type Image struct {
+	Image string
+	UUID  string
+	Kind  string
+}
+
+// Function is a function
+type Function struct {
+	Image string
+	Addr  uint64
+	Name  string
+	Size  uint64
+}
+
+// Call is a call from one function to another
+type Call struct {
+	Image  string
+	Caller uint64
+	Callee uint64
+	Site   uint64
+	Kind   string
+}
+
+// StringRef is a C string referenced by a function
+type StringRef struct {
+	Image string
+	Func  uint64
+	Site  uint64
+	Addr  uint64
+	Value string
+}
+
+// Import is an imported symbol
+type Import struct {
+	Image   string
+	Symbol  string
+	Library string
+}
+
+// DB is a fact database
+type DB struct {
+	Images     []Image
+	Functions  []Function
+	Calls      []Call
+	StringRefs []StringRef
+	Imports    []Import
+}
+
+// Schema is the SQLite schema of the fact database
+const Schema = `
+CREATE TABLE images (image TEXT NOT NULL, uuid TEXT, kind TEXT);
+CREATE TABLE functions (image TEXT, addr INTEGER NOT NULL, name TEXT, size INTEGER);
+CREATE TABLE calls (image TEXT, caller INTEGER NOT NULL, callee INTEGER NOT NULL, site INTEGER NOT NULL, kind TEXT);
+CREATE TABLE string_refs (image TEXT, func INTEGER NOT NULL, site INTEGER NOT NULL, addr INTEGER NOT NULL, value TEXT);
+CREATE TABLE imports (image TEXT NOT NULL, symbol TEXT NOT NULL, library TEXT);
+CREATE INDEX functions_addr ON functions(addr);
+CREATE INDEX functions_name ON functions(name);
+CREATE INDEX calls_caller ON calls(caller);
+CREATE INDEX calls_callee ON calls(callee);
+CREATE INDEX string_refs_func ON string_refs(func);
+CREATE INDEX string_refs_value ON string_refs(value);
+CREATE INDEX imports_symbol ON imports(symbol);
+CREATE VIEW string_xrefs AS SELECT s.image, s.value, s.addr, s.func, f.name, s.site FROM string_refs s LEFT JOIN functions f ON f.image = s.image AND f.addr = s.func;
+`
+
+// SouffleSchema is the Soufflé declarations of the fact database
+const SouffleSchema = `// ipsw fact database (see https://souffle-lang.github.io)
+.type Addr <: symbol
+
+.decl images(image: symbol, uuid: symbol, kind: symbol)
+.decl functions(image: symbol, addr: Addr, name: symbol, size: unsigned)
+.decl calls(image: symbol, caller: Addr, callee: Addr, site: Addr, kind: symbol)
+.decl string_refs(image: symbol, func: Addr, site: Addr, addr: Addr, value: symbol)
+.decl imports(image: symbol, symbol: symbol, library: symbol)
+
+.input images
+.input functions
+.input calls
+.input string_refs
+.input imports
+
+// example: every function that can (transitively) reach copyin
+// .decl reaches(caller: Addr, callee: Addr)
+// reaches(a, b) :- calls(_, a, b, _, _).
+// reaches(a, c) :- reaches(a, b), calls(_, b, c, _, _).
+// .decl reaches_copyin(name: symbol)
+// reaches_copyin(n) :- functions(_, a, n, _), functions(_, c, "_copyin", _), reaches(a, c).
+// .output reaches_copyin
+`
+
+const batchSize = 1000
+
+// WriteSQLite writes the fact database to a new SQLite database at path
+func (db *DB) WriteSQLite(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove existing database %s: %v", path, err)
+	}
+	gdb, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger:                 logger.Default.LogMode(logger.Silent),
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create database %s: %v", path, err)
+	}
+	if sdb, err := gdb.DB(); err == nil {
+		defer sdb.Close()
+	}
+	return gdb.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range strings.Split(strings.TrimSpace(Schema), ";") {
+			if stmt = strings.TrimSpace(stmt); len(stmt) > 0 {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("failed to create schema: %v", err)
+				}
+			}
+		}
+		if err := insert(tx, "images", db.Images, func(i Image) map[string]any {
+			return map[string]any{"image": i.Image, "uuid": i.UUID, "kind": i.Kind}
+		}); err != nil {
+			return err
+		}
+		if err := insert(tx, "functions", db.Functions, func(f Function) map[string]any {
+			return map[string]any{"image": f.Image, "addr": int64(f.Addr), "name": f.Name, "size": int64(f.Size)}
+		}); err != nil {
+			return err
+		}
+		if err := insert(tx, "calls", db.Calls, func(c Call) map[string]any {
+			return map[string]any{"image": c.Image, "caller": int64(c.Caller), "callee": int64(c.Callee), "site": int64(c.Site), "kind": c.Kind}
+		}); err != nil {
+			return err
+		}
+		if err := insert(tx, "string_refs", db.StringRefs, func(s StringRef) map[string]any {
+			return map[string]any{"image": s.Image, "func": int64(s.Func), "site": int64(s.Site), "addr": int64(s.Addr), "value": s.Value}
+		}); err != nil {
+			return err
+		}
+		return insert(tx, "imports", db.Imports, func(i Import) map[string]any {
+			return map[string]any{"image": i.Image, "symbol": i.Symbol, "library": i.Library}
+		})
+	})
+}
+
+func insert[T any](tx *gorm.DB, table string, rows []T, toRow func(T) map[string]any) error {
+	for i := 0; i < len(rows); i += batchSize {
+		batch := make([]map[string]any, 0, batchSize)
+		for _, row := range rows[i:min(i+batchSize, len(rows))] {
+			batch = append(batch, toRow(row))
+		}
+		if err := tx.Table(table).Create(batch).Error; err != nil {
+			return fmt.Errorf("failed to insert %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// souffleSymbol escapes a value for a tab separated Soufflé .facts file
+func souffleSymbol(s string) string {
+	return strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func hex(addr uint64) string {
+	return fmt.Sprintf("%#x", addr)
+}
+
+// WriteSouffle writes the fact database as Soufflé .facts files (and a schema.dl) to dir
+func (db *DB) WriteSouffle(dir string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schema.dl"), []byte(SouffleSchema), 0o644); err != nil {
+		return fmt.Errorf("failed to write schema: %v", err)
+	}
+	relations := map[string][][]string{}
+	for _, i := range db.Images {
+		relations["images"] = append(relations["images"], []string{i.Image, i.UUID, i.Kind})
+	}
+	for _, f := range db.Functions {
+		relations["functions"] = append(relations["functions"], []string{f.Image, hex(f.Addr), f.Name, fmt.Sprint(f.Size)})
+	}
+	for _, c := range db.Calls {
+		relations["calls"] = append(relations["calls"], []string{c.Image, hex(c.Caller), hex(c.Callee), hex(c.Site), c.Kind})
+	}
+	for _, s := range db.StringRefs {
+		relations["string_refs"] = append(relations["string_refs"], []string{s.Image, hex(s.Func), hex(s.Site), hex(s.Addr), s.Value})
+	}
+	for _, i := range db.Imports {
+		relations["imports"] = append(relations["imports"], []string{i.Image, i.Symbol, i.Library})
+	}
+	for _, name := range []string{"images", "functions", "calls", "string_refs", "imports"} {
+		var sb strings.Builder
+		for _, row := range relations[name] {
+			for i, col := range row {
+				row[i] = souffleSymbol(col)
+			}
+			sb.WriteString(strings.Join(row, "\t") + "\n")
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".facts"), []byte(sb.String()), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s facts: %v", name, err)
+		}
+	}
+	return nil
+}
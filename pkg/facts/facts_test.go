@@ -0,0 +1,136 @@
+package facts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const kernelBase = 0xfffffff007004000
+
+func testDB() *DB {
+	return &DB{
+		Images: []Image{
+			{Image: "com.apple.kernel", UUID: "8F19A2C1-0C2B-4D1E-9A55-6B1F2C3D4E5F", Kind: "macho"},
+			{Image: "com.apple.driver.AppleFoo", Kind: "kext"},
+		},
+		Functions: []Function{
+			{Image: "com.apple.kernel", Addr: kernelBase, Name: "_panic", Size: 0x10},
+			{Image: "com.apple.driver.AppleFoo", Addr: kernelBase + 0x100, Name: "_foo_start", Size: 0x20},
+			{Addr: kernelBase + 0x200, Name: "_copyin"},
+		},
+		Calls: []Call{
+			{Image: "com.apple.driver.AppleFoo", Caller: kernelBase + 0x100, Callee: kernelBase, Site: kernelBase + 0x104, Kind: "call"},
+			{Image: "com.apple.driver.AppleFoo", Caller: kernelBase + 0x100, Callee: kernelBase + 0x200, Site: kernelBase + 0x11c, Kind: "tailcall"},
+		},
+		StringRefs: []StringRef{
+			{Image: "com.apple.kernel", Func: kernelBase, Site: kernelBase + 0x4, Addr: kernelBase + 0x1000, Value: "panic: %s\n"},
+			{Image: "com.apple.driver.AppleFoo", Func: kernelBase + 0x100, Site: kernelBase + 0x108, Addr: kernelBase + 0x1010, Value: "foo\tbar"},
+		},
+		Imports: []Import{
+			{Image: "com.apple.driver.AppleFoo", Symbol: "_copyin"},
+			{Image: "libfoo.dylib", Symbol: "_malloc", Library: "/usr/lib/libSystem.B.dylib"},
+		},
+	}
+}
+
+func TestWriteSouffle(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "facts")
+	if err := testDB().WriteSouffle(dir); err != nil {
+		t.Fatal(err)
+	}
+	if dat, err := os.ReadFile(filepath.Join(dir, "schema.dl")); err != nil || string(dat) != SouffleSchema {
+		t.Errorf("schema.dl = %q, %v", dat, err)
+	}
+
+	for _, tt := range []struct {
+		relation string
+		want     string
+	}{
+		{"images", "com.apple.kernel\t8F19A2C1-0C2B-4D1E-9A55-6B1F2C3D4E5F\tmacho\ncom.apple.driver.AppleFoo\t\tkext\n"},
+		{"functions", "com.apple.kernel\t0xfffffff007004000\t_panic\t16\n" +
+			"com.apple.driver.AppleFoo\t0xfffffff007004100\t_foo_start\t32\n" +
+			"\t0xfffffff007004200\t_copyin\t0\n"},
+		{"calls", "com.apple.driver.AppleFoo\t0xfffffff007004100\t0xfffffff007004000\t0xfffffff007004104\tcall\n" +
+			"com.apple.driver.AppleFoo\t0xfffffff007004100\t0xfffffff007004200\t0xfffffff00700411c\ttailcall\n"},
+		{"string_refs", "com.apple.kernel\t0xfffffff007004000\t0xfffffff007004004\t0xfffffff007005000\tpanic: %s\\n\n" +
+			"com.apple.driver.AppleFoo\t0xfffffff007004100\t0xfffffff007004108\t0xfffffff007005010\tfoo\\tbar\n"},
+		{"imports", "com.apple.driver.AppleFoo\t_copyin\t\nlibfoo.dylib\t_malloc\t/usr/lib/libSystem.B.dylib\n"},
+	} {
+		t.Run(tt.relation, func(t *testing.T) {
+			dat, err := os.ReadFile(filepath.Join(dir, tt.relation+".facts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dat) != tt.want {
+				t.Errorf("%s.facts = %q, want %q", tt.relation, dat, tt.want)
+			}
+		})
+	}
+
+	// every relation gets a (possibly empty) facts file so Soufflé's .input doesn't fail
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := (&DB{}).WriteSouffle(empty); err != nil {
+		t.Fatal(err)
+	}
+	for _, relation := range []string{"images", "functions", "calls", "string_refs", "imports"} {
+		if fi, err := os.Stat(filepath.Join(empty, relation+".facts")); err != nil || fi.Size() != 0 {
+			t.Errorf("empty %s.facts = %v, %v", relation, fi, err)
+		}
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	db := testDB()
+	for i := range batchSize + 1 { // more than one insert batch
+		db.Functions = append(db.Functions, Function{Image: "com.apple.driver.AppleBig", Addr: kernelBase + 0x10000 + uint64(i)*4, Name: fmt.Sprintf("sub_%x", i)})
+	}
+	path := filepath.Join(t.TempDir(), "facts.db")
+	if err := db.WriteSQLite(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteSQLite(path); err != nil { // replaces the existing database
+		t.Fatal(err)
+	}
+
+	gdb, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdb, err := gdb.DB(); err == nil {
+		defer sdb.Close()
+	}
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"images", "SELECT count(*) FROM images", "2"},
+		{"image uuid", "SELECT uuid FROM images WHERE kind = 'macho'", "8F19A2C1-0C2B-4D1E-9A55-6B1F2C3D4E5F"},
+		{"batched functions", "SELECT count(*) FROM functions WHERE image = 'com.apple.driver.AppleBig'", fmt.Sprint(batchSize + 1)},
+		{"kernel address", "SELECT printf('%x', addr) FROM functions WHERE name = '_panic'", "fffffff007004000"},
+		{"function size", "SELECT size FROM functions WHERE name = '_foo_start'", "32"},
+		{"tail calls", "SELECT printf('%x', callee) FROM calls WHERE kind = 'tailcall'", "fffffff007004200"},
+		{"callers", "SELECT f.name FROM calls c JOIN functions f ON f.addr = c.caller WHERE printf('%x', c.callee) = 'fffffff007004000'", "_foo_start"},
+		{"string value", "SELECT value FROM string_refs WHERE printf('%x', site) = 'fffffff007004108'", "foo\tbar"},
+		{"string xrefs", "SELECT name FROM string_xrefs WHERE value LIKE '%panic%'", "_panic"},
+		{"flat import", "SELECT library FROM imports WHERE symbol = '_copyin'", ""},
+		{"import library", "SELECT library FROM imports WHERE symbol = '_malloc'", "/usr/lib/libSystem.B.dylib"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if err := gdb.Raw(tt.query).Row().Scan(&got); err != nil {
+				t.Fatalf("%s: %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
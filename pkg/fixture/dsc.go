@@ -0,0 +1,277 @@
+package fixture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/dyld"
+)
+
+const (
+	// DefaultSharedRegionStart is the (unslid) base address of a synthetic dyld_shared_cache
+	DefaultSharedRegionStart = 0x180000000
+
+	dscMagic = "dyld_v1  arm64e"
+)
+
+// Dylib is a dylib in a synthetic dyld_shared_cache
+type Dylib struct {
+	Path    string
+	Symbols []string // exported functions (each gets a RET in __TEXT.__text)
+	Strings []string // C strings placed in __TEXT.__cstring
+	// SubCache is the index of the subcache (1 for .01, 2 for .02, etc.) containing the dylib (0 is the main cache)
+	SubCache int
+}
+
+// SharedCache is a synthetic single-file dyld4 style dyld_shared_cache builder
+//
+// NOTE: each cache file has a single r-x mapping containing its dylibs, no slide info and no local symbols.
+// Since this package imports pkg/dyld, tests in pkg/dyld that use it must be external (package dyld_test).
+type SharedCache struct {
+	UUID     types.UUID
+	Base     uint64
+	Platform types.Platform
+	OSVer    types.Version
+	Dylibs   []Dylib
+}
+
+// NewSharedCache returns a dyld_shared_cache builder
+func NewSharedCache() *SharedCache {
+	return &SharedCache{
+		UUID:     uuidFor(dscMagic),
+		Base:     DefaultSharedRegionStart,
+		Platform: types.Platform_iOS,
+		OSVer:    Version(17, 0, 0),
+	}
+}
+
+// AddDylib adds a dylib to the cache
+func (c *SharedCache) AddDylib(path string, symbols ...string) *Dylib {
+	c.Dylibs = append(c.Dylibs, Dylib{Path: path, Symbols: symbols})
+	return &c.Dylibs[len(c.Dylibs)-1]
+}
+
+func (d *Dylib) macho(platform types.Platform, osVer types.Version) *MachO {
+	m := NewMachO(types.MH_DYLIB)
+	m.Flags |= types.DylibInCache
+	m.UUID = uuidFor(d.Path)
+	m.InstallName = d.Path
+	m.Platform = platform
+	m.MinOS = osVer
+	m.SDK = osVer
+	if len(d.Symbols) > 0 {
+		sec := m.Segments[0].AddSection("__text", bytes.Repeat(ret(), len(d.Symbols)))
+		sec.Flags = types.SectionFlag(0x80000400)
+		for i, sym := range d.Symbols {
+			m.AddSymbol(sym, "__TEXT", "__text", uint64(i*4))
+		}
+	}
+	if len(d.Strings) > 0 {
+		var cstrs bytes.Buffer
+		for _, s := range d.Strings {
+			cstrs.WriteString(s + "\x00")
+		}
+		sec := m.Segments[0].AddSection("__cstring", cstrs.Bytes())
+		sec.Align = 0
+		sec.Flags = types.SectionFlag(0x2)
+	}
+	return m
+}
+
+// SubCacheSuffix returns the file suffix of the N-th subcache
+func SubCacheSuffix(n int) string {
+	return fmt.Sprintf(".%02d", n)
+}
+
+// SubCacheUUID returns the UUID of the N-th subcache
+func (c *SharedCache) SubCacheUUID(n int) types.UUID {
+	if n == 0 {
+		return c.UUID
+	}
+	return uuidFor(c.UUID.String() + SubCacheSuffix(n))
+}
+
+func (c *SharedCache) subCacheCount() int {
+	var count int
+	for _, d := range c.Dylibs {
+		count = max(count, d.SubCache)
+	}
+	return count
+}
+
+// Bytes returns the dyld_shared_cache (the cache must not have any subcaches)
+func (c *SharedCache) Bytes() ([]byte, error) {
+	if c.subCacheCount() > 0 {
+		return nil, fmt.Errorf("cache has subcaches (use Files)")
+	}
+	files, err := c.Files()
+	if err != nil {
+		return nil, err
+	}
+	return files[""], nil
+}
+
+// Files returns the dyld_shared_cache files keyed by their suffix ("" for the main cache)
+func (c *SharedCache) Files() (map[string][]byte, error) {
+	var hdr dyld.CacheHeader
+
+	const (
+		mappingSize   = 32 // sizeof(dyld_cache_mapping_info)
+		slideMapSize  = 56 // sizeof(dyld_cache_mapping_and_slide_info)
+		imageInfoSize = 32 // sizeof(dyld_cache_image_info)
+		textInfoSize  = 32 // sizeof(dyld_cache_image_text_info)
+		subCacheSize  = 56 // sizeof(dyld_subcache_entry)
+	)
+
+	numSubCaches := c.subCacheCount()
+
+	hdrSize := uint64(binary.Size(hdr))
+	mapOff := hdrSize
+	slideOff := mapOff + mappingSize
+	imagesOff := slideOff + slideMapSize
+	textOff := imagesOff + imageInfoSize*uint64(len(c.Dylibs))
+	subCachesOff := textOff + textInfoSize*uint64(len(c.Dylibs))
+	pathsOff := subCachesOff + subCacheSize*uint64(numSubCaches)
+
+	var paths bytes.Buffer
+	pathOffs := make([]uint64, len(c.Dylibs))
+	for i, d := range c.Dylibs {
+		pathOffs[i] = pathsOff + uint64(paths.Len())
+		paths.WriteString(d.Path + "\x00")
+	}
+
+	// empty code signature SuperBlob
+	csig := make([]byte, 12)
+	binary.BigEndian.PutUint32(csig[0:], 0xfade0cc0)
+	binary.BigEndian.PutUint32(csig[4:], 12)
+
+	// place the dylibs (each cache file's mapping follows the previous one in the shared region)
+	images := make([]dyld.CacheImageInfo, len(c.Dylibs))
+	texts := make([]dyld.CacheImageTextInfo, len(c.Dylibs))
+	datas := make([][]byte, numSubCaches+1)
+	vmOffs := make([]uint64, numSubCaches+1)
+	var vmOff uint64
+	for n := 0; n <= numSubCaches; n++ {
+		start := align(hdrSize+mappingSize+slideMapSize, PageSize)
+		if n == 0 {
+			start = align(pathsOff+uint64(paths.Len()), PageSize)
+		}
+		off := start
+		var dylibs [][]byte
+		for i, d := range c.Dylibs {
+			if d.SubCache != n {
+				continue
+			}
+			m := d.macho(c.Platform, c.OSVer)
+			dat, err := m.build(off, c.Base+vmOff+off)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build dylib %s: %v", d.Path, err)
+			}
+			images[i] = dyld.CacheImageInfo{
+				Address:        c.Base + vmOff + off,
+				PathFileOffset: uint32(pathOffs[i]),
+			}
+			texts[i] = dyld.CacheImageTextInfo{
+				UUID:            m.UUID,
+				LoadAddress:     c.Base + vmOff + off,
+				TextSegmentSize: uint32(m.Segments[0].size),
+				PathOffset:      uint32(pathOffs[i]),
+			}
+			dylibs = append(dylibs, dat)
+			off = align(off+uint64(len(dat)), PageSize)
+		}
+		out := make([]byte, off+uint64(len(csig)))
+		off = start
+		for _, dat := range dylibs {
+			copy(out[off:], dat)
+			off = align(off+uint64(len(dat)), PageSize)
+		}
+		copy(out[off:], csig)
+		datas[n] = out
+		vmOffs[n] = vmOff
+		vmOff += off
+	}
+
+	files := make(map[string][]byte, numSubCaches+1)
+	for n, out := range datas {
+		mappingSz := uint64(len(out) - len(csig))
+
+		hdr = dyld.CacheHeader{}
+		copy(hdr.Magic[:], dscMagic)
+		hdr.MappingOffset = uint32(mapOff)
+		hdr.MappingCount = 1
+		hdr.MappingWithSlideOffset = uint32(slideOff)
+		hdr.MappingWithSlideCount = 1
+		hdr.CodeSignatureOffset = mappingSz
+		hdr.CodeSignatureSize = uint64(len(csig))
+		hdr.UUID = c.SubCacheUUID(n)
+		hdr.Platform = c.Platform
+		hdr.OsVersion = c.OSVer
+		hdr.SharedRegionStart = c.Base
+		hdr.SharedRegionSize = align(vmOff, 0x1000000)
+		if n == 0 {
+			hdr.ImagesOffset = uint32(imagesOff)
+			hdr.ImagesCount = uint32(len(c.Dylibs))
+			hdr.ImagesTextOffset = textOff
+			hdr.ImagesTextCount = uint64(len(c.Dylibs))
+			if numSubCaches > 0 {
+				hdr.SubCacheArrayOffset = uint32(subCachesOff)
+				hdr.SubCacheArrayCount = uint32(numSubCaches)
+			}
+		}
+
+		var buf bytes.Buffer
+		w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+		w(hdr)
+		w(dyld.CacheMappingInfo{
+			Address:  c.Base + vmOffs[n],
+			Size:     mappingSz,
+			MaxProt:  types.VmProtection(5),
+			InitProt: types.VmProtection(5),
+		})
+		w(dyld.CacheMappingAndSlideInfo{
+			Address:  c.Base + vmOffs[n],
+			Size:     mappingSz,
+			MaxProt:  types.VmProtection(5),
+			InitProt: types.VmProtection(5),
+		})
+		if n == 0 {
+			w(images)
+			w(texts)
+			for i := 1; i <= numSubCaches; i++ {
+				var suffix [32]byte
+				copy(suffix[:], SubCacheSuffix(i))
+				w(c.SubCacheUUID(i))
+				w(vmOffs[i])
+				w(suffix)
+			}
+			buf.Write(paths.Bytes())
+		}
+		copy(out, buf.Bytes())
+
+		suffix := ""
+		if n > 0 {
+			suffix = SubCacheSuffix(n)
+		}
+		files[suffix] = out
+	}
+
+	return files, nil
+}
+
+// WriteFile writes the dyld_shared_cache (and its subcaches) to path
+func (c *SharedCache) WriteFile(path string) error {
+	files, err := c.Files()
+	if err != nil {
+		return err
+	}
+	for suffix, dat := range files {
+		if err := os.WriteFile(path+suffix, dat, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+package fixture_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/fixture"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+)
+
+func TestMachO(t *testing.T) {
+	m := fixture.NewMachO(types.MH_DYLIB)
+	m.InstallName = "/usr/lib/libfixture.dylib"
+	m.Segments[0].AddSection("__text", []byte{0xc0, 0x03, 0x5f, 0xd6})
+	m.AddSegment("__DATA", types.VmProtection(3)).AddSection("__data", []byte("hello"))
+	m.AddSymbol("_fixture", "__TEXT", "__text", 0)
+
+	path := filepath.Join(t.TempDir(), "libfixture.dylib")
+	if err := m.WriteFile(path, 0x100000000); err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.DylibID() == nil || f.DylibID().Name != m.InstallName {
+		t.Errorf("LC_ID_DYLIB = %v", f.DylibID())
+	}
+	if sec := f.Section("__DATA", "__data"); sec == nil {
+		t.Error("missing __DATA.__data")
+	} else if dat, _ := sec.Data(); !bytes.Equal(dat, []byte("hello")) {
+		t.Errorf("__DATA.__data = %q", dat)
+	}
+	addr, err := f.FindSymbolAddress("_fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := f.Section("__TEXT", "__text"); addr != text.Addr {
+		t.Errorf("_fixture = %#x, want %#x", addr, text.Addr)
+	}
+}
+
+func TestSharedCache(t *testing.T) {
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort", "_exit")
+	dsc.AddDylib("/System/Library/Frameworks/Foundation.framework/Foundation", "_NSLog").Strings = []string{"fixture string"}
+
+	path := filepath.Join(t.TempDir(), "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := dyld.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.UUID != dsc.UUID || len(f.Images) != 2 {
+		t.Fatalf("UUID = %s, images = %d", f.UUID, len(f.Images))
+	}
+
+	img, err := f.Image("Foundation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.GetMacho()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DylibID() == nil || m.DylibID().Name != img.Name {
+		t.Errorf("LC_ID_DYLIB = %v", m.DylibID())
+	}
+	addr, err := m.FindSymbolAddress("_NSLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := m.Section("__TEXT", "__text"); addr != text.Addr {
+		t.Errorf("_NSLog = %#x, want %#x", addr, text.Addr)
+	}
+	cstrs, err := m.GetCStrings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cstrs["__TEXT.__cstring"]["fixture string"]; !ok {
+		t.Errorf("GetCStrings() = %v", cstrs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := f.ParsePublicSymbolsContext(ctx, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParsePublicSymbolsContext() = %v, want context.Canceled", err)
+	}
+}
+
+func TestSharedCacheForEachImage(t *testing.T) {
+	dsc := fixture.NewSharedCache()
+	for _, name := range []string{"libA", "libB", "libC", "libD"} {
+		dsc.AddDylib("/usr/lib/"+name+".dylib", "_"+name)
+	}
+	path := filepath.Join(t.TempDir(), "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := dyld.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	names := make([]string, len(f.Images))
+	err = f.ForEachImage(context.Background(), 2, func(ctx context.Context, idx int, img *dyld.CacheImage) error {
+		switch filepath.Base(img.Name) {
+		case "libB.dylib":
+			panic("malformed dylib")
+		case "libD.dylib":
+			return errors.New("bad dylib")
+		}
+		m, err := img.GetMacho()
+		if err != nil {
+			return err
+		}
+		names[idx] = m.DylibID().Name
+		return nil
+	})
+	var imgErrs dyld.ImageErrors
+	if !errors.As(err, &imgErrs) || len(imgErrs) != 2 {
+		t.Fatalf("ForEachImage() = %v, want 2 ImageErrors", err)
+	}
+	if imgErrs[0].Image != "/usr/lib/libB.dylib" || imgErrs[0].Stack == nil || imgErrs[1].Image != "/usr/lib/libD.dylib" {
+		t.Errorf("ImageErrors = %v", imgErrs)
+	}
+	if names[0] != "/usr/lib/libA.dylib" || names[2] != "/usr/lib/libC.dylib" {
+		t.Errorf("processed images = %v", names)
+	}
+}
+
+func TestForEachCache(t *testing.T) {
+	root := t.TempDir()
+	sys := filepath.Join(root, "System", "Library", "dyld")
+	dk := filepath.Join(root, "System", "DriverKit", "System", "Library", "dyld")
+	for dir, platform := range map[string]types.Platform{sys: types.Platform_macOS, dk: types.Platform_Driverkit} {
+		dsc := fixture.NewSharedCache()
+		dsc.Platform = platform
+		dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort")
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := dsc.WriteFile(filepath.Join(dir, "dyld_shared_cache_arm64e")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"dyld_shared_cache_x86_64", "dyld_shared_cache_arm64e.map"} {
+		if err := os.WriteFile(filepath.Join(sys, name), []byte("bad cache"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	caches, err := dyld.FindCaches(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, c := range caches {
+		labels = append(labels, c.Label())
+	}
+	if want := []string{"arm64e", "rosetta/x86_64", "driverkit/arm64e"}; !slices.Equal(labels, want) {
+		t.Fatalf("FindCaches() = %v, want %v", labels, want)
+	}
+
+	var platforms []string
+	err = dyld.ForEachCache(context.Background(), caches, func(ctx context.Context, c *dyld.Cache, f *dyld.File) error {
+		platforms = append(platforms, c.Label()+":"+f.Headers[f.UUID].Platform.String())
+		return nil
+	})
+	var cacheErrs dyld.CacheErrors
+	if !errors.As(err, &cacheErrs) || len(cacheErrs) != 1 || cacheErrs[0].Cache.Arch != "x86_64" {
+		t.Fatalf("ForEachCache() = %v, want 1 x86_64 CacheError", err)
+	}
+	if want := []string{"arm64e:macOS", "driverkit/arm64e:Driverkit"}; !slices.Equal(platforms, want) {
+		t.Errorf("processed caches = %v, want %v", platforms, want)
+	}
+}
+
+func TestSharedCacheSubCaches(t *testing.T) {
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort", "_exit")
+	dsc.AddDylib("/System/Library/Frameworks/Foundation.framework/Foundation", "_NSLog").SubCache = 1
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{path, path + ".01"} {
+		f, err := dyld.Open(name)
+		if err != nil {
+			t.Fatalf("Open(%s) = %v", filepath.Base(name), err)
+		}
+		if f.UUID != dsc.UUID || len(f.Images) != 2 || len(f.SubCacheInfo) != 1 {
+			f.Close()
+			t.Fatalf("Open(%s): UUID = %s, images = %d, subcaches = %d", filepath.Base(name), f.UUID, len(f.Images), len(f.SubCacheInfo))
+		}
+		img, err := f.Image("Foundation")
+		if err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+		uuid, _, err := f.GetOffset(img.LoadAddress)
+		if err != nil || uuid != dsc.SubCacheUUID(1) {
+			t.Errorf("GetOffset(Foundation) = %s, %v", uuid, err)
+		}
+		m, err := img.GetMacho()
+		if err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+		if addr, err := m.FindSymbolAddress("_NSLog"); err != nil || addr != m.Section("__TEXT", "__text").Addr {
+			t.Errorf("_NSLog = %#x, %v", addr, err)
+		}
+		m.Close()
+		f.Close()
+	}
+
+	if fname, err := dyld.ExtractDylib(path+".01", "Foundation", filepath.Join(dir, "out")); err != nil {
+		t.Errorf("ExtractDylib() = %v", err)
+	} else if m, err := macho.Open(fname); err != nil {
+		t.Errorf("extracted dylib: %v", err)
+	} else {
+		m.Close()
+	}
+
+	// swap in another cache's subcache
+	other := fixture.NewSharedCache()
+	other.UUID = types.UUID{1}
+	other.AddDylib("/usr/lib/libobjc.A.dylib", "_objc_msgSend").SubCache = 1
+	otherPath := filepath.Join(t.TempDir(), "dyld_shared_cache_arm64e")
+	if err := other.WriteFile(otherPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(otherPath+".01", path+".02"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dyld.Open(path + ".02"); err == nil || !strings.Contains(err.Error(), "is not a subcache of") {
+		t.Errorf("Open(.02) = %v, want not a subcache error", err)
+	}
+	if err := os.Rename(path+".02", path+".01"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dyld.Open(path); err == nil || !strings.Contains(err.Error(), "did not match expected UUID") {
+		t.Errorf("Open() = %v, want UUID mismatch error", err)
+	}
+
+	for name, want := range map[string]string{
+		"dyld_shared_cache_arm64e":               "dyld_shared_cache_arm64e",
+		"dyld_shared_cache_arm64e.01":            "dyld_shared_cache_arm64e",
+		"dyld_shared_cache_arm64e.10.dylddata":   "dyld_shared_cache_arm64e",
+		"dyld_shared_cache_arm64e.symbols":       "dyld_shared_cache_arm64e",
+		"dyld_shared_cache_arm64e.map":           "dyld_shared_cache_arm64e.map",
+		"/System/Library/dyld/dyld_shared_cache": "/System/Library/dyld/dyld_shared_cache",
+	} {
+		if got := dyld.MainCachePath(name); got != want {
+			t.Errorf("MainCachePath(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestExtractDylib(t *testing.T) {
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort", "_exit")
+	dsc.AddDylib("/System/Library/Frameworks/Foundation.framework/Foundation", "_NSLog")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	fname, err := dyld.ExtractDylib(path, "Foundation", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fname != filepath.Join(out, "Foundation") {
+		t.Errorf("ExtractDylib() = %s", fname)
+	}
+	m, err := macho.Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.DylibID() == nil || m.DylibID().Name != "/System/Library/Frameworks/Foundation.framework/Foundation" {
+		t.Errorf("LC_ID_DYLIB = %v", m.DylibID())
+	}
+	addr, err := m.FindSymbolAddress("_NSLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := m.Section("__TEXT", "__text"); text == nil || addr != text.Addr {
+		t.Errorf("_NSLog = %#x", addr)
+	}
+
+	f, err := dyld.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := f.Image("Foundation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ExtractDylib(img, out, &dyld.ExtractConfig{}); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("ExtractDylib() re-extract = %v, want fs.ErrExist", err)
+	}
+	if fname, err := f.ExtractDylib(img, out, &dyld.ExtractConfig{FullPath: true}); err != nil || fname != filepath.Join(out, img.Name) {
+		t.Errorf("ExtractDylib() full path = %s, %v", fname, err)
+	}
+}
+
+func TestSearchSymbols(t *testing.T) {
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libSystem.B.dylib", "_abort", "_exit", "_exit_group")
+	dsc.AddDylib("/System/Library/Frameworks/Foundation.framework/Foundation", "_NSLog", "_NSExit")
+	path := filepath.Join(t.TempDir(), "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	f, err := dyld.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	matches, err := dyld.SearchSymbols(f, regexp.MustCompile(`(?i)exit`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range matches {
+		if m.Kind != "export" || m.Address == 0 {
+			t.Errorf("unexpected match %+v", m)
+		}
+		got = append(got, filepath.Base(m.Image)+":"+m.Name)
+	}
+	if want := []string{"libSystem.B.dylib:_exit", "libSystem.B.dylib:_exit_group", "Foundation:_NSExit"}; !slices.Equal(got, want) {
+		t.Errorf("SearchSymbols() = %v, want %v", got, want)
+	}
+	img, err := f.Image("libSystem.B.dylib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.GetMacho()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, err := m.FindSymbolAddress("_exit"); err != nil || addr != matches[0].Address {
+		t.Errorf("_exit = %#x, want %#x (%v)", matches[0].Address, addr, err)
+	}
+}
+
+func TestConcurrentAnalysis(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	fkc := fixture.NewKernelcache()
+	fkc.AddKext("com.apple.driver.FakeDriver", "1.0.0", "_fake_start")
+	kc, err := fkc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im4p := filepath.Join(t.TempDir(), "kernelcache.release.iphone15")
+	if err := (&fixture.IM4P{Type: "krnl", Data: kc}).WriteFile(im4p); err != nil {
+		t.Fatal(err)
+	}
+	dsc := fixture.NewSharedCache()
+	dsc.AddDylib("/usr/lib/libA.dylib", "_a")
+	dsc.AddDylib("/usr/lib/libB.dylib", "_b")
+	dscPath := filepath.Join(t.TempDir(), "dyld_shared_cache_arm64e")
+	if err := dsc.WriteFile(dscPath); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() { // every goroutine decompresses the same kernelcache and analyzes its own copy
+			defer wg.Done()
+			path, err := kernelcache.DecompressedPath(im4p)
+			if err != nil {
+				errs <- err
+				return
+			}
+			m, err := macho.Open(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer m.Close()
+			if _, err := kernelcache.GetVersion(m); err != nil {
+				errs <- err
+			}
+			if kexts, err := kernelcache.GetKexts(m); err != nil || len(kexts) != 1 {
+				errs <- fmt.Errorf("GetKexts() = %v, %v", kexts, err)
+			}
+		}()
+	}
+	for i := 0; i < 2; i++ { // a File preallocates its AddressToSymbol map so keep the shared cache handles to a minimum
+		wg.Add(1)
+		go func() { // every goroutine opens its own handle on the same shared cache
+			defer wg.Done()
+			f, err := dyld.Open(dscPath)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer f.Close()
+			if err := f.ForEachImage(context.Background(), 2, func(ctx context.Context, idx int, img *dyld.CacheImage) error {
+				_, err := img.GetMacho()
+				return err
+			}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
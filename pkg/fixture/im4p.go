@@ -0,0 +1,105 @@
+package fixture
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"os"
+)
+
+// IM4P payload compressions
+const (
+	CompressLZSS  = "lzss"  // a complzss header followed by literal only LZSS
+	CompressLZFSE = "lzfse" // a raw (bvx-) LZFSE block
+)
+
+// IM4P is a synthetic IM4P payload builder
+type IM4P struct {
+	Type        string // 4-char tag (e.g. krnl, sepi, ibot)
+	Description string
+	Data        []byte
+	Compression string // "" (uncompressed), CompressLZSS or CompressLZFSE
+	Kbags       []KBAG // marks the payload as encrypted (the data is NOT encrypted)
+}
+
+// KBAG is an IM4P keybag (type 1 is production, 2 is development)
+type KBAG struct {
+	Type int
+	IV   []byte
+	Key  []byte
+}
+
+type im4p struct {
+	Name        string `asn1:"ia5"`
+	Type        string `asn1:"ia5"`
+	Description string
+	Data        []byte
+	KbagData    []byte `asn1:"optional"`
+}
+
+// Compress returns data compressed the way a kernelcache payload is (the encodings are valid but don't shrink the data)
+func Compress(data []byte, compression string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch compression {
+	case "":
+		return data, nil
+	case CompressLZSS:
+		var body []byte
+		for off := 0; off < len(data); off += 8 {
+			body = append(body, 0xff) // 8 literals follow
+			body = append(body, data[off:min(off+8, len(data))]...)
+		}
+		buf.WriteString("complzss")
+		binary.Write(&buf, binary.BigEndian, []uint32{adler32.Checksum(data), uint32(len(data)), uint32(len(body))})
+		buf.Write(make([]byte, 0x16c))
+		buf.Write(body)
+	case CompressLZFSE:
+		buf.WriteString("bvx-")
+		binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+		buf.WriteString("bvx$")
+	default:
+		return nil, fmt.Errorf("unsupported compression '%s'", compression)
+	}
+	return buf.Bytes(), nil
+}
+
+// Bytes returns the DER encoded IM4P
+func (i *IM4P) Bytes() ([]byte, error) {
+	if len(i.Type) != 4 {
+		return nil, fmt.Errorf("invalid im4p type '%s': must be 4 characters", i.Type)
+	}
+	data, err := Compress(i.Data, i.Compression)
+	if err != nil {
+		return nil, err
+	}
+	var kbags []byte
+	if len(i.Kbags) > 0 {
+		var err error
+		if kbags, err = asn1.Marshal(i.Kbags); err != nil {
+			return nil, fmt.Errorf("failed to ASN.1 marshal im4p KBAG: %v", err)
+		}
+	}
+	dat, err := asn1.Marshal(im4p{
+		Name:        "IM4P",
+		Type:        i.Type,
+		Description: i.Description,
+		Data:        data,
+		KbagData:    kbags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to ASN.1 marshal im4p: %v", err)
+	}
+	return dat, nil
+}
+
+// WriteFile writes the IM4P to path
+func (i *IM4P) WriteFile(path string) error {
+	dat, err := i.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, dat, 0o644)
+}
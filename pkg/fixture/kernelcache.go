@@ -0,0 +1,382 @@
+package fixture
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/go-plist"
+)
+
+const (
+	// DefaultKernelBase is the (unslid) address of a synthetic kernelcache's fileset header
+	DefaultKernelBase = 0xfffffff007004000
+	// DefaultKernelVersion is the version banner placed in a synthetic kernel's __TEXT.__const
+	DefaultKernelVersion = "Darwin Kernel Version 23.0.0: Fri Sep 15 14:43:05 PDT 2023; root:xnu-10002.1.13~1/RELEASE_ARM64_T8103"
+
+	filesetEntryCmdSize = 32 // sizeof(fileset_entry_command)
+	chainsHeaderSize    = 28 // sizeof(dyld_chained_fixups_header)
+	chainsSegmentSize   = 22 // sizeof(dyld_chained_starts_in_segment) without page_start
+)
+
+// Kext is a kernel extension in a synthetic kernelcache
+type Kext struct {
+	ID      string   // CFBundleIdentifier
+	Version string   // CFBundleVersion
+	Symbols []string // exported functions (each gets a RET in __TEXT_EXEC.__text)
+	// Functions are exported functions with their own code (placed after the Symbols)
+	Functions map[string][]byte
+	// Pointers are Symbols/Functions with a rebased pointer in __DATA_CONST.__const (via the fileset's chained fixups)
+	Pointers []string
+
+	CompatibleVersion string            // OSBundleCompatibleVersion
+	Libraries         map[string]string // OSBundleLibraries (bundle ID → required version)
+}
+
+// SymbolSet is a KPI symbol set in a synthetic kernel's __LINKINFO.__symbolsets
+type SymbolSet struct {
+	ID      string   // CFBundleIdentifier (i.e. com.apple.kpi.bsd)
+	Version string   // CFBundleVersion
+	Symbols []string // exported symbol names
+}
+
+// Kernelcache is a synthetic MH_FILESET kernelcache builder
+type Kernelcache struct {
+	Base    uint64
+	Version string
+	Kexts   []Kext
+	// Symbols are exported kernel functions (each gets a RET in __TEXT_EXEC.__text)
+	Symbols []string
+	// SymbolSets are the KPI symbol sets of a macOS kernel collection (omitted if empty)
+	SymbolSets []SymbolSet
+	// NoKernel omits com.apple.kernel (i.e. a macOS system or aux kernel collection)
+	NoKernel bool
+	// BootKCID and PageableKCID are the UUIDs of the collections a system/aux kernel collection links against
+	BootKCID, PageableKCID []byte
+	// AuthPointers signs the kexts' Pointers (key IA with address diversity) which changes their
+	// chained fixup encoding but not their targets
+	AuthPointers bool
+}
+
+// NewKernelcache returns a kernelcache builder containing just com.apple.kernel
+func NewKernelcache() *Kernelcache {
+	return &Kernelcache{
+		Base:    DefaultKernelBase,
+		Version: DefaultKernelVersion,
+	}
+}
+
+// AddKext adds a kext to the kernelcache
+func (k *Kernelcache) AddKext(id, version string, symbols ...string) {
+	k.Kexts = append(k.Kexts, Kext{ID: id, Version: version, Symbols: symbols})
+}
+
+type filesetEntry struct {
+	id       string
+	m        *MachO
+	off      uint64
+	data     []byte
+	pointers []string
+}
+
+func ret() []byte { return []byte{0xc0, 0x03, 0x5f, 0xd6} } // RET
+
+func textExec(m *MachO, symbols []string, funcs map[string][]byte) {
+	if len(symbols) == 0 && len(funcs) == 0 {
+		return
+	}
+	code := bytes.Repeat(ret(), len(symbols))
+	offs := make(map[string]uint64, len(funcs))
+	for _, name := range slices.Sorted(maps.Keys(funcs)) {
+		offs[name] = uint64(len(code))
+		code = append(code, funcs[name]...)
+	}
+	m.AddSegment("__TEXT_EXEC", types.VmProtection(5)).AddSection("__text", code).Flags = types.SectionFlag(0x80000400)
+	for i, sym := range symbols {
+		m.AddSymbol(sym, "__TEXT_EXEC", "__text", uint64(i*4))
+	}
+	for _, name := range slices.Sorted(maps.Keys(funcs)) {
+		m.AddSymbol(name, "__TEXT_EXEC", "__text", offs[name])
+	}
+}
+
+// kmodInfo returns the kext's kmod_info_t (without a _kmod_info symbol like a stripped kernelcache)
+func kmodInfo(kext Kext) []byte {
+	var name, version [64]byte
+	copy(name[:], kext.ID)
+	copy(version[:], kext.Version)
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, struct {
+		Next        uint64
+		InfoVersion int32
+		ID          uint32
+		Name        [64]byte
+		Version     [64]byte
+		RefCount    int32
+		Rest        [6]uint64 // reference_list, address, size, hdr_size, start, stop
+	}{InfoVersion: 1, Name: name, Version: version})
+	return buf.Bytes()
+}
+
+func (k *Kernelcache) entries(symbolSets []byte) []*filesetEntry {
+	kernel := NewMachO(types.MH_EXECUTE)
+	kernel.Flags = types.NoUndefs | types.PIE
+	kernel.UUID = uuidFor("com.apple.kernel")
+	kernel.Segments[0].AddSection("__const", []byte(k.Version+"\x00"))
+	textExec(kernel, k.Symbols, nil)
+	kernel.AddSegment("__LAST", types.VmProtection(5)).AddSection("__pinst", ret())
+	if len(symbolSets) > 0 {
+		kernel.AddSegment("__LINKINFO", types.VmProtection(1)).AddSection("__symbolsets", symbolSets)
+	}
+	var ents []*filesetEntry
+	if !k.NoKernel {
+		ents = append(ents, &filesetEntry{id: "com.apple.kernel", m: kernel})
+	}
+	for _, kext := range k.Kexts {
+		m := NewMachO(types.MH_KEXT_BUNDLE)
+		m.Flags = types.NoUndefs | types.PIE
+		m.UUID = uuidFor(kext.ID)
+		m.Segments[0].AddSection("__cstring", []byte(kext.ID+"\x00"))
+		textExec(m, kext.Symbols, kext.Functions)
+		if len(kext.Pointers) > 0 {
+			m.AddSegment("__DATA_CONST", types.VmProtection(3)).AddSection("__const", make([]byte, 8*len(kext.Pointers))).Align = 3
+		}
+		m.AddSegment("__DATA", types.VmProtection(3)).AddSection("__data", kmodInfo(kext))
+		ents = append(ents, &filesetEntry{id: kext.ID, m: m, pointers: kext.Pointers})
+	}
+	return ents
+}
+
+func (k *Kernelcache) prelinkInfo() ([]byte, error) {
+	type bundle struct {
+		ID          string `plist:"CFBundleIdentifier,omitempty"`
+		Name        string `plist:"CFBundleName,omitempty"`
+		Version     string `plist:"CFBundleVersion,omitempty"`
+		PackageType string `plist:"CFBundlePackageType,omitempty"`
+
+		CompatibleVersion string            `plist:"OSBundleCompatibleVersion,omitempty"`
+		Libraries         map[string]string `plist:"OSBundleLibraries,omitempty"`
+	}
+	var info struct {
+		PrelinkInfoDictionary []bundle `plist:"_PrelinkInfoDictionary,omitempty"`
+		BootKCID              []byte   `plist:"_BootKCID,omitempty"`
+		PageableKCID          []byte   `plist:"_PageableKCID,omitempty"`
+	}
+	info.BootKCID, info.PageableKCID = k.BootKCID, k.PageableKCID
+	for _, kext := range k.Kexts {
+		info.PrelinkInfoDictionary = append(info.PrelinkInfoDictionary, bundle{
+			ID:          kext.ID,
+			Name:        kext.ID,
+			Version:     kext.Version,
+			PackageType: "KEXT",
+
+			CompatibleVersion: kext.CompatibleVersion,
+			Libraries:         kext.Libraries,
+		})
+	}
+	dat, err := plist.Marshal(info, plist.XMLFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal __PRELINK_INFO: %v", err)
+	}
+	return append(dat, 0), nil
+}
+
+func (k *Kernelcache) symbolSets() ([]byte, error) {
+	if len(k.SymbolSets) == 0 {
+		return nil, nil
+	}
+	type symbol struct {
+		Name string `plist:"SymbolName,omitempty"`
+	}
+	type bundle struct {
+		ID      string   `plist:"CFBundleIdentifier,omitempty"`
+		Version string   `plist:"CFBundleVersion,omitempty"`
+		Symbols []symbol `plist:"Symbols,omitempty"`
+	}
+	var sets struct {
+		SymbolsSets []bundle `plist:"SymbolsSets,omitempty"`
+	}
+	for _, set := range k.SymbolSets {
+		b := bundle{ID: set.ID, Version: set.Version}
+		for _, sym := range set.Symbols {
+			b.Symbols = append(b.Symbols, symbol{Name: sym})
+		}
+		sets.SymbolsSets = append(sets.SymbolsSets, b)
+	}
+	dat, err := plist.Marshal(sets, plist.BinaryFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal __symbolsets: %v", err)
+	}
+	return dat, nil
+}
+
+// Bytes returns the kernelcache MH_FILESET
+func (k *Kernelcache) Bytes() ([]byte, error) {
+	symsets, err := k.symbolSets()
+	if err != nil {
+		return nil, err
+	}
+	ents := k.entries(symsets)
+
+	info, err := k.prelinkInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	fs := NewMachO(types.MH_FILESET)
+	fs.Flags = 0
+	fs.UUID = uuidFor(k.Version)
+	fs.AddSegment("__PRELINK_INFO", types.VmProtection(3)).AddSection("__info", info)
+	prelink := fs.AddSegment("__PRELINK_TEXT", types.VmProtection(5)).AddSection("__text", nil)
+	prelink.Align = 14
+	for _, ent := range ents {
+		fs.extraSize += uint32(align(filesetEntryCmdSize+uint64(len(ent.id))+1, 8))
+	}
+
+	// size the entries (which don't depend on where they are placed) to find where they go
+	var total uint64
+	for _, ent := range ents {
+		dat, err := ent.m.build(0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build fileset entry %s: %v", ent.id, err)
+		}
+		total += align(uint64(len(dat)), PageSize)
+	}
+	prelink.Data = make([]byte, total)
+	fsSegIdx := len(fs.Segments) - 1 // __PRELINK_TEXT
+	if slices.ContainsFunc(ents, func(ent *filesetEntry) bool { return len(ent.pointers) > 0 }) {
+		fs.chainedFixups = chainedFixups(prelink.Data, 0, fsSegIdx, len(fs.Segments)+1, nil, false) // + __LINKEDIT
+	}
+	if _, err := fs.layout(0, k.Base); err != nil {
+		return nil, err
+	}
+
+	off := prelink.offset
+	var fixups []pointerFixup
+	for _, ent := range ents {
+		ent.off = off
+		ent.data, err = ent.m.build(off, k.Base+off)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build fileset entry %s: %v", ent.id, err)
+		}
+		copy(prelink.Data[off-prelink.offset:], ent.data)
+		for i, name := range ent.pointers {
+			idx := slices.IndexFunc(ent.m.Symbols, func(sym Symbol) bool { return sym.Name == name })
+			if idx < 0 {
+				return nil, fmt.Errorf("fileset entry %s has no symbol %s to point to", ent.id, name)
+			}
+			sym := ent.m.Symbols[idx]
+			fixups = append(fixups, pointerFixup{
+				off:    off - prelink.offset + ent.m.Segment("__DATA_CONST").section("__const").offset + uint64(8*i),
+				target: off + ent.m.Segment(sym.Segment).section(sym.Section).offset + sym.Offset,
+			})
+		}
+		off += align(uint64(len(ent.data)), PageSize)
+	}
+	if fs.chainedFixups != nil {
+		fs.chainedFixups = chainedFixups(prelink.Data, prelink.offset, fsSegIdx, len(fs.Segments)+1, fixups, k.AuthPointers)
+	}
+
+	fs.extraCmds = func(_, vmAddr uint64) [][]byte {
+		var cmds [][]byte
+		for _, ent := range ents {
+			sz := uint32(align(filesetEntryCmdSize+uint64(len(ent.id))+1, 8))
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, types.FilesetEntryCmd{
+				LoadCmd:       types.LC_FILESET_ENTRY,
+				Len:           sz,
+				Addr:          vmAddr + ent.off,
+				FileOffset:    ent.off,
+				EntryIdOffset: filesetEntryCmdSize,
+			})
+			name := make([]byte, sz-filesetEntryCmdSize)
+			copy(name, ent.id)
+			buf.Write(name)
+			cmds = append(cmds, buf.Bytes())
+		}
+		return cmds
+	}
+
+	return fs.build(0, k.Base)
+}
+
+// WriteFile writes the kernelcache to path
+func (k *Kernelcache) WriteFile(path string) error {
+	dat, err := k.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, dat, 0o644)
+}
+
+// pointerFixup is a rebased pointer at off (into its fileset segment) to target (an offset from the kernelcache base)
+type pointerFixup struct {
+	off, target uint64
+}
+
+// chainedFixups encodes the pointers into data (the fileset segment segIdx at segOff) as DYLD_CHAINED_PTR_64_KERNEL_CACHE
+// chains and returns the LC_DYLD_CHAINED_FIXUPS payload (whose size only depends on the segment's size)
+func chainedFixups(data []byte, segOff uint64, segIdx, nsegs int, fixups []pointerFixup, auth bool) []byte {
+	slices.SortFunc(fixups, func(a, b pointerFixup) int { return cmp.Compare(a.off, b.off) })
+	pageCount := len(data) / PageSize
+	pageStarts := make([]uint16, pageCount)
+	for i := range pageStarts {
+		pageStarts[i] = 0xffff // DYLD_CHAINED_PTR_START_NONE
+	}
+	for i, f := range fixups {
+		page := f.off / PageSize
+		ptr := f.target // cacheLevel 0
+		if i+1 < len(fixups) && fixups[i+1].off/PageSize == page {
+			ptr |= (fixups[i+1].off - f.off) / 4 << 51 // next (4-byte stride)
+		}
+		if auth {
+			ptr |= (f.target&0xffff)<<32 | 1<<48 | 1<<63 // diversity, addrDiv, key IA, isAuth
+		}
+		binary.LittleEndian.PutUint64(data[f.off:], ptr)
+		if pageStarts[page] == 0xffff {
+			pageStarts[page] = uint16(f.off % PageSize)
+		}
+	}
+
+	startsOff := align(chainsHeaderSize, 8)
+	segInfoOff := align(4+4*uint64(nsegs), 8) // dyld_chained_starts_in_image
+	segInfoSize := chainsSegmentSize + 2*uint64(pageCount)
+	end := uint32(align(startsOff+segInfoOff+segInfoSize, 8))
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint32{0, uint32(startsOff), end, end, 0, 1, 0}) // 0 DYLD_CHAINED_IMPORT imports
+	buf.Write(make([]byte, startsOff-chainsHeaderSize))
+	segInfoOffsets := make([]uint32, nsegs)
+	segInfoOffsets[segIdx] = uint32(segInfoOff)
+	binary.Write(buf, binary.LittleEndian, uint32(nsegs))
+	binary.Write(buf, binary.LittleEndian, segInfoOffsets)
+	buf.Write(make([]byte, startsOff+segInfoOff-uint64(buf.Len())))
+	binary.Write(buf, binary.LittleEndian, uint32(segInfoSize))
+	binary.Write(buf, binary.LittleEndian, uint16(PageSize))
+	binary.Write(buf, binary.LittleEndian, uint16(8)) // DYLD_CHAINED_PTR_64_KERNEL_CACHE
+	binary.Write(buf, binary.LittleEndian, segOff)
+	binary.Write(buf, binary.LittleEndian, uint32(0)) // max_valid_pointer
+	binary.Write(buf, binary.LittleEndian, uint16(pageCount))
+	binary.Write(buf, binary.LittleEndian, pageStarts)
+	buf.Write(make([]byte, uint64(end)-uint64(buf.Len())))
+	return buf.Bytes()
+}
+
+// uuidFor returns a stable fake UUID for a name so rebuilt fixtures are byte-for-byte identical
+func uuidFor(name string) (u types.UUID) {
+	h := uint64(14695981039346656037) // FNV-1a
+	for i := 0; i < len(name); i++ {
+		h ^= uint64(name[i])
+		h *= 1099511628211
+	}
+	binary.BigEndian.PutUint64(u[:8], h)
+	binary.BigEndian.PutUint64(u[8:], h*1099511628211)
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return
+}
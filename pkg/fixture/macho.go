@@ -0,0 +1,469 @@
+// Package fixture synthesizes minimal, valid firmware artifacts (MachOs, kernelcaches, dyld_shared_caches and IM4Ps)
+// so that analysis code can be exercised end-to-end without shipping Apple binaries.
+package fixture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	// PageSize is the segment alignment used by all fixtures
+	PageSize = 0x4000
+
+	headerSize   = 32 // sizeof(mach_header_64)
+	segmentSize  = 72 // sizeof(segment_command_64)
+	sectionSize  = 80 // sizeof(section_64)
+	uuidCmdSize  = 24
+	buildCmdSize = 24
+	symtabSize   = 24
+	dysymtabSize = 80
+	nlistSize    = 16
+	trieCmdSize  = 16 // sizeof(linkedit_data_command)
+)
+
+// Section is a section in a synthetic segment
+type Section struct {
+	Name  string
+	Data  []byte
+	Align uint32 // power of 2
+	Flags types.SectionFlag
+
+	addr   uint64
+	offset uint64
+}
+
+// Addr returns the section's address (only valid after the MachO has been built)
+func (s *Section) Addr() uint64 { return s.addr }
+
+// Segment is a segment in a synthetic MachO
+type Segment struct {
+	Name     string
+	Prot     types.VmProtection
+	Sections []*Section
+
+	addr   uint64
+	offset uint64
+	size   uint64
+}
+
+// AddSection appends a section to the segment
+func (s *Segment) AddSection(name string, data []byte) *Section {
+	sec := &Section{Name: name, Data: data, Align: 4}
+	s.Sections = append(s.Sections, sec)
+	return sec
+}
+
+// Symbol is an exported symbol in a synthetic MachO
+type Symbol struct {
+	Name    string
+	Segment string
+	Section string
+	Offset  uint64 // offset into the section
+}
+
+// MachO is a synthetic arm64e MachO builder
+type MachO struct {
+	Type        types.HeaderFileType
+	CPU         types.CPU
+	SubCPU      types.CPUSubtype
+	Flags       types.HeaderFlag
+	UUID        types.UUID
+	InstallName string // LC_ID_DYLIB (only for MH_DYLIB)
+	Platform    types.Platform
+	MinOS       types.Version
+	SDK         types.Version
+	Segments    []*Segment
+	Symbols     []Symbol
+	Signed      bool // append an (empty) embedded signature to __LINKEDIT with an LC_CODE_SIGNATURE
+
+	// extra load commands emitted after the standard ones (e.g. LC_FILESET_ENTRY)
+	extraCmds func(fileOff, vmAddr uint64) [][]byte
+	extraSize uint32
+	// LC_DYLD_CHAINED_FIXUPS payload placed in __LINKEDIT (non-nil before layout so the load command is sized)
+	chainedFixups []byte
+}
+
+// NewMachO returns a new arm64e MachO builder with a __TEXT segment
+func NewMachO(typ types.HeaderFileType) *MachO {
+	m := &MachO{
+		Type:     typ,
+		CPU:      types.CPUArm64,
+		SubCPU:   types.CPUSubtypeArm64E,
+		Platform: types.Platform_iOS,
+		MinOS:    Version(17, 0, 0),
+		SDK:      Version(17, 0, 0),
+	}
+	if typ == types.MH_DYLIB || typ == types.MH_EXECUTE {
+		m.Flags = types.DyldLink | types.TwoLevel | types.PIE
+	}
+	m.AddSegment("__TEXT", types.VmProtection(5))
+	return m
+}
+
+// Version encodes a MachO X.Y.Z version
+func Version(major, minor, patch uint32) types.Version {
+	return types.Version(major<<16 | (minor&0xff)<<8 | patch&0xff)
+}
+
+// AddSegment appends a segment (or returns the existing one with the same name)
+func (m *MachO) AddSegment(name string, prot types.VmProtection) *Segment {
+	if seg := m.Segment(name); seg != nil {
+		return seg
+	}
+	seg := &Segment{Name: name, Prot: prot}
+	m.Segments = append(m.Segments, seg)
+	return seg
+}
+
+// Segment returns the segment with the given name or nil
+func (m *MachO) Segment(name string) *Segment {
+	for _, seg := range m.Segments {
+		if seg.Name == name {
+			return seg
+		}
+	}
+	return nil
+}
+
+// AddSymbol adds an exported symbol at offset into the segment/section (which must exist when the MachO is built)
+func (m *MachO) AddSymbol(name, segment, section string, offset uint64) {
+	m.Symbols = append(m.Symbols, Symbol{Name: name, Segment: segment, Section: section, Offset: offset})
+}
+
+func (m *MachO) loadCmdsSize() uint32 {
+	sz := uint32(uuidCmdSize + buildCmdSize + symtabSize + segmentSize) // + __LINKEDIT
+	for _, seg := range m.Segments {
+		sz += segmentSize + sectionSize*uint32(len(seg.Sections))
+	}
+	if m.Type == types.MH_DYLIB {
+		sz += dysymtabSize
+	}
+	if m.Type == types.MH_DYLIB && len(m.Symbols) > 0 {
+		sz += trieCmdSize // LC_DYLD_EXPORTS_TRIE
+	}
+	if m.Type == types.MH_DYLIB && len(m.InstallName) > 0 {
+		sz += dylibCmdSize(m.InstallName)
+	}
+	if m.Signed {
+		sz += trieCmdSize // LC_CODE_SIGNATURE
+	}
+	if m.chainedFixups != nil {
+		sz += trieCmdSize // LC_DYLD_CHAINED_FIXUPS
+	}
+	return sz + m.extraSize
+}
+
+func dylibCmdSize(name string) uint32 {
+	return uint32(align(24+uint64(len(name))+1, 8))
+}
+
+func align(v, a uint64) uint64 {
+	if a == 0 {
+		return v
+	}
+	return (v + a - 1) &^ (a - 1)
+}
+
+// uleb128 encodes v padded to n bytes (so trie node offsets can be written before the nodes are laid out)
+func uleb128(v uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(v & 0x7f)
+		v >>= 7
+		if i < n-1 {
+			b[i] |= 0x80
+		}
+	}
+	return b
+}
+
+// exportsTrie returns a flat export trie (a root node with one terminal child per symbol)
+func exportsTrie(names []string, offsets []uint64) []byte {
+	var root bytes.Buffer
+	root.WriteByte(0) // no terminal info
+	root.WriteByte(byte(len(names)))
+	size := uint64(root.Len())
+	for _, name := range names {
+		size += uint64(len(name)+1) + 5
+	}
+	var children bytes.Buffer
+	for i, name := range names {
+		root.WriteString(name + "\x00")
+		root.Write(uleb128(size+uint64(children.Len()), 5))
+		info := append(uleb128(0, 1), uleb128(offsets[i], 5)...) // EXPORT_SYMBOL_FLAGS_KIND_REGULAR
+		children.Write(uleb128(uint64(len(info)), 1))
+		children.Write(info)
+		children.WriteByte(0) // no children
+	}
+	root.Write(children.Bytes())
+	for root.Len()%8 != 0 {
+		root.WriteByte(0)
+	}
+	return root.Bytes()
+}
+
+func name16(s string) (n [16]byte) {
+	copy(n[:], s)
+	return
+}
+
+// Bytes returns the MachO as a standalone file loaded at vmAddr
+func (m *MachO) Bytes(vmAddr uint64) ([]byte, error) {
+	return m.build(0, vmAddr)
+}
+
+// WriteFile writes the MachO (loaded at vmAddr) to path
+func (m *MachO) WriteFile(path string, vmAddr uint64) error {
+	dat, err := m.Bytes(vmAddr)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, dat, 0o644)
+}
+
+// layout assigns file offsets and addresses to all segments and sections
+//
+// fileOff is where the MachO will live in its container file (load command offsets are absolute, as in a fileset or
+// dyld_shared_cache) and vmAddr is the address of its mach header.
+func (m *MachO) layout(fileOff, vmAddr uint64) (uint64, error) {
+	if len(m.Segments) == 0 || m.Segments[0].Name != "__TEXT" {
+		return 0, fmt.Errorf("first segment must be __TEXT")
+	}
+	off := uint64(headerSize + m.loadCmdsSize())
+	for _, seg := range m.Segments {
+		if seg.Name == "__LINKEDIT" {
+			return 0, fmt.Errorf("__LINKEDIT is generated and must not be added")
+		}
+		seg.offset = align(off, PageSize)
+		if seg == m.Segments[0] {
+			seg.offset = 0
+		}
+		off = seg.offset
+		if seg == m.Segments[0] {
+			off = uint64(headerSize + m.loadCmdsSize())
+		}
+		for _, sec := range seg.Sections {
+			off = align(off, 1<<sec.Align)
+			sec.offset = off
+			sec.addr = vmAddr + off
+			off += uint64(len(sec.Data))
+		}
+		seg.addr = vmAddr + seg.offset
+		seg.size = align(off-seg.offset, PageSize)
+		if seg.size == 0 {
+			seg.size = PageSize
+		}
+		off = seg.offset + seg.size
+	}
+	return off, nil
+}
+
+func (m *MachO) build(fileOff, vmAddr uint64) ([]byte, error) {
+	linkeditOff, err := m.layout(fileOff, vmAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// symbol table
+	type secRef struct{ seg, sect string }
+	secIndex := make(map[secRef]uint8)
+	var sectNum uint8
+	for _, seg := range m.Segments {
+		for _, sec := range seg.Sections {
+			sectNum++
+			secIndex[secRef{seg.Name, sec.Name}] = sectNum
+		}
+	}
+	var syms, strtab bytes.Buffer
+	strtab.WriteString(" \x00")
+	for _, sym := range m.Symbols {
+		idx, ok := secIndex[secRef{sym.Segment, sym.Section}]
+		if !ok {
+			return nil, fmt.Errorf("symbol %s references missing section %s.%s", sym.Name, sym.Segment, sym.Section)
+		}
+		sec := m.Segment(sym.Segment).section(sym.Section)
+		nl := types.Nlist64{
+			Nlist: types.Nlist{Name: uint32(strtab.Len()), Type: types.N_SECT | types.N_EXT, Sect: idx},
+			Value: sec.addr + sym.Offset,
+		}
+		var b [nlistSize]byte
+		nl.Put64(b[:], binary.LittleEndian)
+		syms.Write(b[:])
+		strtab.WriteString(sym.Name + "\x00")
+	}
+	for strtab.Len()%8 != 0 {
+		strtab.WriteByte(0)
+	}
+	var exports []byte
+	if m.Type == types.MH_DYLIB && len(m.Symbols) > 0 {
+		var names []string
+		var offsets []uint64
+		for _, sym := range m.Symbols {
+			names = append(names, sym.Name)
+			offsets = append(offsets, m.Segment(sym.Segment).section(sym.Section).addr+sym.Offset-vmAddr)
+		}
+		exports = exportsTrie(names, offsets)
+	}
+	linkeditSize := uint64(syms.Len() + strtab.Len() + len(exports))
+	fixupsOff := align(linkeditSize, 8)
+	if m.chainedFixups != nil {
+		linkeditSize = fixupsOff + uint64(len(m.chainedFixups))
+	}
+	var sig []byte
+	sigOff := align(linkeditSize, 16)
+	if m.Signed { // CSMAGIC_EMBEDDED_SIGNATURE SuperBlob with no blobs
+		sig = binary.BigEndian.AppendUint32(nil, 0xfade0cc0)
+		sig = binary.BigEndian.AppendUint32(sig, 12)
+		sig = binary.BigEndian.AppendUint32(sig, 0)
+		linkeditSize = sigOff + uint64(len(sig))
+	}
+
+	var cmds bytes.Buffer
+	w := func(v any) { binary.Write(&cmds, binary.LittleEndian, v) }
+	ncmds := uint32(0)
+
+	for _, seg := range m.Segments {
+		ncmds++
+		w(types.Segment64{
+			LoadCmd: types.LC_SEGMENT_64,
+			Len:     segmentSize + sectionSize*uint32(len(seg.Sections)),
+			Name:    name16(seg.Name),
+			Addr:    seg.addr,
+			Memsz:   seg.size,
+			Offset:  fileOff + seg.offset,
+			Filesz:  seg.size,
+			Maxprot: seg.Prot,
+			Prot:    seg.Prot,
+			Nsect:   uint32(len(seg.Sections)),
+		})
+		for _, sec := range seg.Sections {
+			w(types.Section64{
+				Name:   name16(sec.Name),
+				Seg:    name16(seg.Name),
+				Addr:   sec.addr,
+				Size:   uint64(len(sec.Data)),
+				Offset: uint32(fileOff + sec.offset),
+				Align:  sec.Align,
+				Flags:  sec.Flags,
+			})
+		}
+	}
+	ncmds++
+	w(types.Segment64{
+		LoadCmd: types.LC_SEGMENT_64,
+		Len:     segmentSize,
+		Name:    name16("__LINKEDIT"),
+		Addr:    vmAddr + linkeditOff,
+		Memsz:   align(linkeditSize, PageSize),
+		Offset:  fileOff + linkeditOff,
+		Filesz:  linkeditSize,
+		Maxprot: types.VmProtection(1),
+		Prot:    types.VmProtection(1),
+	})
+	ncmds++
+	w(types.UUIDCmd{LoadCmd: types.LC_UUID, Len: uuidCmdSize, UUID: m.UUID})
+	ncmds++
+	w(types.BuildVersionCmd{LoadCmd: types.LC_BUILD_VERSION, Len: buildCmdSize, Platform: m.Platform, Minos: m.MinOS, Sdk: m.SDK})
+	ncmds++
+	w(types.SymtabCmd{
+		LoadCmd: types.LC_SYMTAB,
+		Len:     symtabSize,
+		Symoff:  uint32(fileOff + linkeditOff),
+		Nsyms:   uint32(len(m.Symbols)),
+		Stroff:  uint32(fileOff + linkeditOff + uint64(syms.Len())),
+		Strsize: uint32(strtab.Len()),
+	})
+	if m.Type == types.MH_DYLIB {
+		ncmds++
+		w(types.DysymtabCmd{
+			LoadCmd:    types.LC_DYSYMTAB,
+			Len:        dysymtabSize,
+			Nextdefsym: uint32(len(m.Symbols)), // all symbols are exported
+		})
+	}
+	if len(exports) > 0 {
+		ncmds++
+		w(types.LinkEditDataCmd{
+			LoadCmd: types.LC_DYLD_EXPORTS_TRIE,
+			Len:     trieCmdSize,
+			Offset:  uint32(fileOff + linkeditOff + uint64(syms.Len()+strtab.Len())),
+			Size:    uint32(len(exports)),
+		})
+	}
+	if m.Type == types.MH_DYLIB && len(m.InstallName) > 0 {
+		ncmds++
+		sz := dylibCmdSize(m.InstallName)
+		w(types.DylibCmd{LoadCmd: types.LC_ID_DYLIB, Len: sz, NameOffset: 24, CurrentVersion: Version(1, 0, 0), CompatVersion: Version(1, 0, 0)})
+		name := make([]byte, sz-24)
+		copy(name, m.InstallName)
+		cmds.Write(name)
+	}
+	if m.chainedFixups != nil {
+		ncmds++
+		w(types.LinkEditDataCmd{
+			LoadCmd: types.LC_DYLD_CHAINED_FIXUPS,
+			Len:     trieCmdSize,
+			Offset:  uint32(fileOff + linkeditOff + fixupsOff),
+			Size:    uint32(len(m.chainedFixups)),
+		})
+	}
+	if m.Signed {
+		ncmds++
+		w(types.LinkEditDataCmd{
+			LoadCmd: types.LC_CODE_SIGNATURE,
+			Len:     trieCmdSize,
+			Offset:  uint32(fileOff + linkeditOff + sigOff),
+			Size:    uint32(len(sig)),
+		})
+	}
+	if m.extraCmds != nil {
+		for _, cmd := range m.extraCmds(fileOff, vmAddr) {
+			ncmds++
+			cmds.Write(cmd)
+		}
+	}
+	if uint32(cmds.Len()) != m.loadCmdsSize() {
+		return nil, fmt.Errorf("load commands size mismatch: wrote %#x, expected %#x", cmds.Len(), m.loadCmdsSize())
+	}
+
+	out := make([]byte, linkeditOff+linkeditSize)
+	hdr := types.FileHeader{
+		Magic:        types.Magic64,
+		CPU:          m.CPU,
+		SubCPU:       m.SubCPU,
+		Type:         m.Type,
+		NCommands:    ncmds,
+		SizeCommands: uint32(cmds.Len()),
+		Flags:        m.Flags,
+	}
+	hdr.Put(out, binary.LittleEndian)
+	copy(out[headerSize:], cmds.Bytes())
+	for _, seg := range m.Segments {
+		for _, sec := range seg.Sections {
+			copy(out[sec.offset:], sec.Data)
+		}
+	}
+	copy(out[linkeditOff:], syms.Bytes())
+	copy(out[linkeditOff+uint64(syms.Len()):], strtab.Bytes())
+	copy(out[linkeditOff+uint64(syms.Len()+strtab.Len()):], exports)
+	copy(out[linkeditOff+fixupsOff:], m.chainedFixups)
+	if m.Signed {
+		copy(out[linkeditOff+sigOff:], sig)
+	}
+
+	return out, nil
+}
+
+func (s *Segment) section(name string) *Section {
+	for _, sec := range s.Sections {
+		if sec.Name == name {
+			return sec
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package fuzzyhash
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func testData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestSSDeep(t *testing.T) {
+	data := testData(1, 64*1024)
+	h1, err := SSDeep(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score, err := SSDeepCompare(h1, h1); err != nil || score != 100 {
+		t.Errorf("SSDeepCompare(h, h) = %d, %v, want 100", score, err)
+	}
+
+	modified := append([]byte(nil), data...)
+	copy(modified[30000:], []byte("a small patch in the middle of the data"))
+	h2, err := SSDeep(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score, err := SSDeepCompare(h1, h2); err != nil || score < 80 || score == 100 {
+		t.Errorf("SSDeepCompare(%s, %s) = %d, %v, want a high score", h1, h2, score, err)
+	}
+
+	h3, err := SSDeep(testData(2, 64*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score, err := SSDeepCompare(h1, h3); err != nil || score != 0 {
+		t.Errorf("SSDeepCompare(%s, %s) = %d, %v, want 0", h1, h3, score, err)
+	}
+
+	if _, err := SSDeepCompare(h1, "not a hash"); err == nil {
+		t.Error("SSDeepCompare() with an invalid hash should fail")
+	}
+}
+
+func TestEliminateSequences(t *testing.T) {
+	if got := eliminateSequences("AAAAAABCCCCD"); got != "AAABCCCD" {
+		t.Errorf("eliminateSequences() = %q, want %q", got, "AAABCCCD")
+	}
+}
+
+func TestTLSH(t *testing.T) {
+	data := testData(1, 16*1024)
+	h1, err := TLSH(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h1) != tlshHashLength || h1[:2] != tlshVersion {
+		t.Fatalf("TLSH() = %q", h1)
+	}
+	if diff, err := TLSHDiff(h1, h1); err != nil || diff != 0 {
+		t.Errorf("TLSHDiff(h, h) = %d, %v, want 0", diff, err)
+	}
+
+	modified := append([]byte(nil), data...)
+	copy(modified[8000:], []byte("a small patch in the middle of the data"))
+	h2, err := TLSH(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near, err := TLSHDiff(h1, h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := TLSH(testData(2, 4*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	far, err := TLSHDiff(h1, h3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if near >= far || near > 50 {
+		t.Errorf("TLSHDiff() near = %d, far = %d", near, far)
+	}
+
+	if _, err := TLSH(make([]byte, 1024)); err == nil {
+		t.Error("TLSH() of zeros should fail")
+	}
+}
@@ -0,0 +1,181 @@
+// Package fuzzyhash implements the ssdeep (context triggered piecewise hashing) and TLSH (locality sensitive hashing)
+// fuzzy hashes used to score how similar two blobs are
+package fuzzyhash
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ssdeepRollingWindow = 7
+	ssdeepMinBlockSize  = 3
+	ssdeepHashPrime     = 0x01000193
+	ssdeepHashInit      = 0x28021967
+	ssdeepSpamSumLength = 64
+	ssdeepB64           = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type rollingHash struct {
+	window     [ssdeepRollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *rollingHash) roll(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += ssdeepRollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepRollingWindow])
+	r.window[r.n%ssdeepRollingWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+	return r.h1 + r.h2 + r.h3
+}
+
+func sumHash(c byte, h uint32) uint32 {
+	return (h * ssdeepHashPrime) ^ uint32(c)
+}
+
+// SSDeep returns the ssdeep hash (blocksize:hash:hash2) of data
+func SSDeep(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("cannot fuzzy hash empty data")
+	}
+
+	bs := uint32(ssdeepMinBlockSize)
+	for uint64(bs)*ssdeepSpamSumLength < uint64(len(data)) {
+		bs *= 2
+	}
+
+	for {
+		var r rollingHash
+		var p1, p2 []byte
+		h1, h2 := uint32(ssdeepHashInit), uint32(ssdeepHashInit)
+		var h uint32
+		for _, c := range data {
+			h = r.roll(c)
+			h1 = sumHash(c, h1)
+			h2 = sumHash(c, h2)
+			if h%bs == bs-1 && len(p1) < ssdeepSpamSumLength-1 {
+				p1 = append(p1, ssdeepB64[h1%64])
+				h1 = ssdeepHashInit
+			}
+			if h%(bs*2) == bs*2-1 && len(p2) < ssdeepSpamSumLength/2-1 {
+				p2 = append(p2, ssdeepB64[h2%64])
+				h2 = ssdeepHashInit
+			}
+		}
+		if h != 0 {
+			p1 = append(p1, ssdeepB64[h1%64])
+			p2 = append(p2, ssdeepB64[h2%64])
+		}
+		if bs > ssdeepMinBlockSize && len(p1) < ssdeepSpamSumLength/2 {
+			bs /= 2 // too few trigger points (try again with a smaller block size)
+			continue
+		}
+		return fmt.Sprintf("%d:%s:%s", bs, p1, p2), nil
+	}
+}
+
+func parseSSDeep(hash string) (uint64, string, string, error) {
+	parts := strings.Split(hash, ":")
+	if len(parts) != 3 {
+		return 0, "", "", fmt.Errorf("invalid ssdeep hash %q", hash)
+	}
+	bs, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || bs < ssdeepMinBlockSize {
+		return 0, "", "", fmt.Errorf("invalid ssdeep hash %q block size", hash)
+	}
+	return bs, eliminateSequences(parts[1]), eliminateSequences(parts[2]), nil
+}
+
+// eliminateSequences drops the characters that repeat more than 3 times in a row (they carry little information)
+func eliminateSequences(s string) string {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// hasCommonSubstring reports if the hashes share a run of at least ROLLING_WINDOW characters
+func hasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepRollingWindow || len(s2) < ssdeepRollingWindow {
+		return false
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(s1); i++ {
+		if strings.Contains(s2, s1[i:i+ssdeepRollingWindow]) {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance with substitutions costing 2 (a delete and an insert)
+func editDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	curr := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := 2
+			if s1[i-1] == s2[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(s2)]
+}
+
+func scoreStrings(s1, s2 string, bs uint64) int {
+	if len(s1) > ssdeepSpamSumLength || len(s2) > ssdeepSpamSumLength || !hasCommonSubstring(s1, s2) {
+		return 0
+	}
+	score := editDistance(s1, s2) * ssdeepSpamSumLength / (len(s1) + len(s2))
+	score = 100 * score / ssdeepSpamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+	// small block sizes can't match well enough to deserve a high score
+	if bs < (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		score = min(score, int(bs)/ssdeepMinBlockSize*min(len(s1), len(s2)))
+	}
+	return score
+}
+
+// SSDeepCompare returns the 0-100 match score of two ssdeep hashes (0 is no match and 100 is a perfect match)
+func SSDeepCompare(hash1, hash2 string) (int, error) {
+	bs1, s1a, s1b, err := parseSSDeep(hash1)
+	if err != nil {
+		return 0, err
+	}
+	bs2, s2a, s2b, err := parseSSDeep(hash2)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case bs1 == bs2:
+		if s1a == s2a && s1b == s2b {
+			return 100, nil
+		}
+		return max(scoreStrings(s1a, s2a, bs1), scoreStrings(s1b, s2b, bs1*2)), nil
+	case bs1 == bs2*2:
+		return scoreStrings(s1a, s2b, bs1), nil
+	case bs2 == bs1*2:
+		return scoreStrings(s1b, s2a, bs2), nil
+	default:
+		return 0, nil // the block sizes are too far apart to compare
+	}
+}
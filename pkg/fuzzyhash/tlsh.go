@@ -0,0 +1,196 @@
+package fuzzyhash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	tlshWindow        = 5
+	tlshBuckets       = 128 // the effective buckets of the 128 bucket/1 byte checksum variant
+	tlshCodeSize      = tlshBuckets / 4
+	tlshMinDataLength = 50
+	tlshVersion       = "T1"
+	tlshHashLength    = len(tlshVersion) + 2*(3+tlshCodeSize)
+)
+
+// pearson is the Pearson hashing permutation TLSH maps its triplets with
+var pearson = [256]byte{
+	1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+	14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+	110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+	25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+	97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+	174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+	132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+	119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+	138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+	170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+	125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+	118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+	27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+	233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+	140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+	51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+func bMapping(salt, i, j, k byte) byte {
+	h := pearson[salt]
+	h = pearson[h^i]
+	h = pearson[h^j]
+	return pearson[h^k]
+}
+
+// lCapturing returns the log of the data length as TLSH's length byte
+func lCapturing(n int) byte {
+	l := float64(n)
+	switch {
+	case n <= 656:
+		return byte(int(math.Log(l) / math.Log(1.5)))
+	case n <= 3199:
+		return byte(int(math.Log(l)/math.Log(1.3) - 8.72777))
+	default:
+		return byte(int(math.Log(l)/math.Log(1.1) - 62.5472))
+	}
+}
+
+func swapNibbles(b byte) byte {
+	return b<<4 | b>>4
+}
+
+// TLSH returns the TLSH hash (T1 followed by 70 hex characters) of data
+func TLSH(data []byte) (string, error) {
+	if len(data) < tlshMinDataLength {
+		return "", fmt.Errorf("data is too small to TLSH (%d bytes < %d)", len(data), tlshMinDataLength)
+	}
+
+	var buckets [256]uint32
+	var checksum byte
+	for i := tlshWindow - 1; i < len(data); i++ {
+		a, b, c, d, e := data[i], data[i-1], data[i-2], data[i-3], data[i-4]
+		checksum = bMapping(0, a, b, checksum)
+		buckets[bMapping(2, a, b, c)]++
+		buckets[bMapping(3, a, b, d)]++
+		buckets[bMapping(5, a, c, d)]++
+		buckets[bMapping(7, a, c, e)]++
+		buckets[bMapping(11, a, b, e)]++
+		buckets[bMapping(13, a, d, e)]++
+	}
+
+	sorted := slices.Clone(buckets[:tlshBuckets])
+	slices.Sort(sorted)
+	q1, q2, q3 := sorted[tlshBuckets/4-1], sorted[tlshBuckets/2-1], sorted[tlshBuckets-tlshBuckets/4-1]
+	if q3 == 0 {
+		return "", fmt.Errorf("data doesn't have enough variation to TLSH")
+	}
+	nonZero := 0
+	for _, c := range buckets[:tlshBuckets] {
+		if c > 0 {
+			nonZero++
+		}
+	}
+	if nonZero <= 4*tlshCodeSize/2 {
+		return "", fmt.Errorf("data doesn't have enough variation to TLSH")
+	}
+
+	var code [tlshCodeSize]byte
+	for i := range code {
+		for j := 0; j < 4; j++ {
+			switch k := buckets[4*i+j]; {
+			case q3 < k:
+				code[i] += 3 << (j * 2)
+			case q2 < k:
+				code[i] += 2 << (j * 2)
+			case q1 < k:
+				code[i] += 1 << (j * 2)
+			}
+		}
+	}
+
+	q1ratio := byte(uint32(float32(q1*100)/float32(q3)) % 16)
+	q2ratio := byte(uint32(float32(q2*100)/float32(q3)) % 16)
+
+	hash := []byte{swapNibbles(checksum), swapNibbles(lCapturing(len(data))), q1ratio<<4 | q2ratio}
+	for i := len(code) - 1; i >= 0; i-- {
+		hash = append(hash, code[i])
+	}
+	return tlshVersion + strings.ToUpper(hex.EncodeToString(hash)), nil
+}
+
+type tlsh struct {
+	checksum byte
+	lvalue   byte
+	q1ratio  byte
+	q2ratio  byte
+	code     []byte
+}
+
+func parseTLSH(hash string) (*tlsh, error) {
+	if len(hash) != tlshHashLength || !strings.HasPrefix(hash, tlshVersion) {
+		return nil, fmt.Errorf("invalid TLSH hash %q", hash)
+	}
+	dat, err := hex.DecodeString(hash[len(tlshVersion):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLSH hash %q: %v", hash, err)
+	}
+	return &tlsh{
+		checksum: swapNibbles(dat[0]),
+		lvalue:   swapNibbles(dat[1]),
+		q1ratio:  dat[2] >> 4,
+		q2ratio:  dat[2] & 0xf,
+		code:     dat[3:],
+	}, nil
+}
+
+func modDiff(x, y, r int) int {
+	dl, dr := x-y, y+r-x
+	if y > x {
+		dl, dr = y-x, x+r-y
+	}
+	return min(dl, dr)
+}
+
+// TLSHDiff returns the distance between two TLSH hashes (0 is identical and anything under ~50 is very similar)
+func TLSHDiff(hash1, hash2 string) (int, error) {
+	t1, err := parseTLSH(hash1)
+	if err != nil {
+		return 0, err
+	}
+	t2, err := parseTLSH(hash2)
+	if err != nil {
+		return 0, err
+	}
+
+	var diff int
+	if ldiff := modDiff(int(t1.lvalue), int(t2.lvalue), 256); ldiff <= 1 {
+		diff += ldiff
+	} else {
+		diff += ldiff * 12
+	}
+	for _, qdiff := range []int{modDiff(int(t1.q1ratio), int(t2.q1ratio), 16), modDiff(int(t1.q2ratio), int(t2.q2ratio), 16)} {
+		if qdiff <= 1 {
+			diff += qdiff
+		} else {
+			diff += (qdiff - 1) * 12
+		}
+	}
+	if t1.checksum != t2.checksum {
+		diff++
+	}
+	for i := range t1.code {
+		for x, y := t1.code[i], t2.code[i]; x != 0 || y != 0; x, y = x>>2, y>>2 {
+			switch d := int(x&3) - int(y&3); d {
+			case 3, -3:
+				diff += 6
+			case 2, -2:
+				diff += 2
+			case 1, -1:
+				diff++
+			}
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,159 @@
+package img4
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// ErrEncrypted is matched (via errors.Is) by every *EncryptedError
+var ErrEncrypted = errcode.New(errcode.Encrypted, "im4p payload is encrypted")
+
+// EncryptedError is returned instead of a parse failure when an IM4P payload is encrypted
+//
+// NOTE: the KBAGs are wrapped with the GID key of the SoC the firmware was built for, so they are the
+// chip/board specific identifiers used to look up the payload's key (i.e. on theapplewiki.com)
+type EncryptedError struct {
+	Name        string // file name of the IM4P (if known)
+	Type        string // IM4P type (i.e. ibot, sepi)
+	Description string // IM4P description (i.e. iBoot-5540.102.4)
+	Chip        int    // CHIP of the IMG4 manifest (if personalized)
+	Board       int    // BORD of the IMG4 manifest (if personalized)
+	Kbags       []Keybag
+}
+
+func (e *EncryptedError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("encrypted im4p payload")
+	if len(e.Name) > 0 {
+		fmt.Fprintf(&sb, " %s", e.Name)
+	}
+	fmt.Fprintf(&sb, " (type: %s", e.Type)
+	if len(e.Description) > 0 {
+		fmt.Fprintf(&sb, ", description: %s", e.Description)
+	}
+	if e.Chip != 0 || e.Board != 0 {
+		fmt.Fprintf(&sb, ", chip: %#x, board: %#x", e.Chip, e.Board)
+	}
+	sb.WriteString(")")
+	for _, kb := range e.Kbags {
+		fmt.Fprintf(&sb, "\n  %s KBAG: %s", kb.Type.Short(), kb.KBAG())
+	}
+	sb.WriteString("\nlook up the KBAG's key with 'ipsw download keys --device <DEVICE> --build <BUILD> --output <DIR>' and decrypt with " +
+		"'ipsw img4 dec --key-db <DIR>/keys_<DEVICE>_<BUILD>.json' (or '--iv-key <IVKEY>')")
+	return sb.String()
+}
+
+func (e *EncryptedError) Unwrap() error { return ErrEncrypted }
+
+// KBAG returns the hex encoded iv+key of the keybag (as listed on theapplewiki.com)
+func (k Keybag) KBAG() string {
+	return hex.EncodeToString(append(append([]byte{}, k.IV...), k.Key...))
+}
+
+// Encrypted returns true if the IM4P has a KBAG for an (un-decrypted) payload
+func (i *Im4p) Encrypted() bool {
+	for _, kb := range i.Kbags {
+		if kb.Type != DECRYPTED {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckEncrypted returns an *EncryptedError if the IM4P payload is encrypted
+func (i *Im4p) CheckEncrypted(name string) error {
+	if !i.Encrypted() {
+		return nil
+	}
+	return &EncryptedError{
+		Name:        name,
+		Type:        i.Type,
+		Description: i.Description,
+		Kbags:       i.Kbags,
+	}
+}
+
+// KeyDB is a firmware key database (the JSON written by 'ipsw download keys --output')
+type KeyDB map[string]FirmwareKeys
+
+// FirmwareKeys are the keys of a firmware's files (as listed on theapplewiki.com)
+type FirmwareKeys struct {
+	Filename []string `json:"filename,omitempty"`
+	Device   []string `json:"device,omitempty"`
+	Key      []string `json:"key,omitempty"`
+	Devkbag  []string `json:"devkbag,omitempty"`
+	Iv       []string `json:"iv,omitempty"`
+	Kbag     []string `json:"kbag,omitempty"`
+}
+
+// OpenKeyDB reads a firmware key database JSON file
+func OpenKeyDB(path string) (KeyDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key database: %v", err)
+	}
+	var db KeyDB
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("failed to parse key database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+func index(s []string, i int) string {
+	if i < len(s) {
+		return strings.TrimSpace(s[i])
+	}
+	return ""
+}
+
+// ivKey returns the decoded iv and key of the i-th file
+func (fk FirmwareKeys) ivKey(i int) ([]byte, []byte, error) {
+	key, err := hex.DecodeString(index(fk.Key, i))
+	if err != nil || len(key) == 0 {
+		return nil, nil, fmt.Errorf("key for %s is unknown", index(fk.Filename, i))
+	}
+	if len(key) > 32 { // iv+key
+		return key[:aes.BlockSize], key[aes.BlockSize:], nil
+	}
+	iv, err := hex.DecodeString(index(fk.Iv, i))
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, nil, fmt.Errorf("iv for %s is unknown", index(fk.Filename, i))
+	}
+	return iv, key, nil
+}
+
+// Lookup returns the iv and key that decrypt an IM4P payload
+//
+// The files are matched by their KBAG (falling back to the IM4P's file name)
+func (db KeyDB) Lookup(i *Im4p, name string) ([]byte, []byte, error) {
+	for _, kb := range i.Kbags {
+		kbag := kb.KBAG()
+		for _, fk := range db {
+			for idx := range fk.Filename {
+				if strings.EqualFold(index(fk.Kbag, idx), kbag) {
+					return fk.ivKey(idx)
+				}
+			}
+		}
+	}
+	if base := filepath.Base(name); len(name) > 0 {
+		for _, fk := range db {
+			for idx, fn := range fk.Filename {
+				if strings.EqualFold(filepath.Base(strings.TrimSpace(fn)), base) {
+					return fk.ivKey(idx)
+				}
+			}
+		}
+	}
+	if err := i.CheckEncrypted(name); err != nil {
+		return nil, nil, fmt.Errorf("no key found in key database: %w", err)
+	}
+	return nil, nil, fmt.Errorf("no key found in key database for %s", name)
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/offline"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/ota/types"
 	"github.com/blacktop/ipsw/pkg/xcode"
@@ -92,6 +93,15 @@ type DeviceQuery struct {
 func GetIpswDB() (*Devices, error) {
 	var db Devices
 
+	if offline.Enabled() {
+		if dat, err := offline.ReadFile(offline.DeviceDB); err == nil {
+			if err := json.Unmarshal(dat, &db); err != nil {
+				return nil, fmt.Errorf("failed unmarshaling offline %s data: %w", offline.DeviceDB, err)
+			}
+			return &db, nil
+		}
+	}
+
 	zr, err := gzip.NewReader(bytes.NewReader(ipswDbData))
 	if err != nil {
 		return nil, err
@@ -15,6 +15,7 @@ import (
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/offline"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/devicetree"
 	"github.com/blacktop/ipsw/pkg/plist"
@@ -131,6 +132,15 @@ func getProcessor(cpuid string) (processors, error) {
 func getFirmwareKeys(device, build string) (map[string]string, error) {
 	var keys map[string]map[string]map[string]string
 
+	if offline.Enabled() {
+		if dat, err := offline.ReadFile(offline.FirmwareKeys); err == nil {
+			if err := json.Unmarshal(dat, &keys); err != nil {
+				return nil, fmt.Errorf("failed unmarshaling offline %s data: %w", offline.FirmwareKeys, err)
+			}
+			return keys[device][build], nil
+		}
+	}
+
 	zr, err := gzip.NewReader(bytes.NewReader(keysJSONData))
 	if err != nil {
 		return nil, err
@@ -0,0 +1,577 @@
+// Package kdp implements a client for the XNU Kernel Debugging Protocol (KDP) over UDP
+package kdp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the UDP port the kernel's KDP stub listens on
+const DefaultPort = 41139
+
+const (
+	hdrSize        = 8
+	maxPacketSize  = 1200
+	defaultTimeout = 2 * time.Second
+	defaultRetries = 3
+	isReplyBit     = 0x80
+)
+
+// Request is a KDP request type
+type Request uint8
+
+const (
+	CONNECT             Request = 0
+	DISCONNECT          Request = 1
+	HOSTINFO            Request = 2
+	VERSION             Request = 3
+	MAXBYTES            Request = 4
+	READMEM             Request = 5
+	WRITEMEM            Request = 6
+	READREGS            Request = 7
+	WRITEREGS           Request = 8
+	LOAD                Request = 9
+	IMAGEPATH           Request = 10
+	SUSPEND             Request = 11
+	RESUMECPUS          Request = 12
+	EXCEPTION           Request = 13
+	TERMINATION         Request = 14
+	BREAKPOINT_SET      Request = 15
+	BREAKPOINT_REMOVE   Request = 16
+	REGIONS             Request = 17
+	REATTACH            Request = 18
+	HOSTREBOOT          Request = 19
+	READMEM64           Request = 20
+	WRITEMEM64          Request = 21
+	BREAKPOINT64_SET    Request = 22
+	BREAKPOINT64_REMOVE Request = 23
+	KERNELVERSION       Request = 24
+	READPHYSMEM64       Request = 25
+	WRITEPHYSMEM64      Request = 26
+)
+
+var requestNames = []string{
+	"KDP_CONNECT",
+	"KDP_DISCONNECT",
+	"KDP_HOSTINFO",
+	"KDP_VERSION",
+	"KDP_MAXBYTES",
+	"KDP_READMEM",
+	"KDP_WRITEMEM",
+	"KDP_READREGS",
+	"KDP_WRITEREGS",
+	"KDP_LOAD",
+	"KDP_IMAGEPATH",
+	"KDP_SUSPEND",
+	"KDP_RESUMECPUS",
+	"KDP_EXCEPTION",
+	"KDP_TERMINATION",
+	"KDP_BREAKPOINT_SET",
+	"KDP_BREAKPOINT_REMOVE",
+	"KDP_REGIONS",
+	"KDP_REATTACH",
+	"KDP_HOSTREBOOT",
+	"KDP_READMEM64",
+	"KDP_WRITEMEM64",
+	"KDP_BREAKPOINT64_SET",
+	"KDP_BREAKPOINT64_REMOVE",
+	"KDP_KERNELVERSION",
+	"KDP_READPHYSMEM64",
+	"KDP_WRITEPHYSMEM64",
+}
+
+func (r Request) String() string {
+	if int(r) < len(requestNames) {
+		return requestNames[r]
+	}
+	return fmt.Sprintf("KDP_REQUEST(%d)", uint8(r))
+}
+
+// Error is a KDP kdp_return_t error code
+type Error uint32
+
+const (
+	SUCCESS                Error = 0
+	ALREADY_CONNECTED      Error = 1
+	BAD_NBYTES             Error = 2
+	BADFLAVOR              Error = 3
+	MAX_BREAKPOINTS        Error = 100
+	BREAKPOINT_NOT_FOUND   Error = 101
+	BREAKPOINT_ALREADY_SET Error = 102
+)
+
+func (e Error) Error() string {
+	switch e {
+	case SUCCESS:
+		return "success"
+	case ALREADY_CONNECTED:
+		return "already connected"
+	case BAD_NBYTES:
+		return "bad number of bytes"
+	case BADFLAVOR:
+		return "bad register flavor"
+	case MAX_BREAKPOINTS:
+		return "max breakpoints reached"
+	case BREAKPOINT_NOT_FOUND:
+		return "breakpoint not found"
+	case BREAKPOINT_ALREADY_SET:
+		return "breakpoint already set"
+	default:
+		return fmt.Sprintf("kdp error %d", uint32(e))
+	}
+}
+
+// ErrTimeout is returned when the target does not reply to a request
+var ErrTimeout = errors.New("kdp request timed out")
+
+type header struct {
+	Request uint8 // request:7 is_reply:1
+	Seq     uint8
+	Len     uint16
+	Key     uint32
+}
+
+// Exception is an exception notification sent by the target
+type Exception struct {
+	CPU       uint32
+	Exception uint32
+	Code      uint32
+	Subcode   uint32
+}
+
+func (e Exception) String() string {
+	return fmt.Sprintf("cpu=%d exception=%#x code=%#x subcode=%#x", e.CPU, e.Exception, e.Code, e.Subcode)
+}
+
+// HostInfo is the KDP_HOSTINFO reply
+type HostInfo struct {
+	CPUMask    uint32 `json:"cpu_mask"`
+	CPUType    uint32 `json:"cpu_type"`
+	CPUSubtype uint32 `json:"cpu_subtype"`
+}
+
+// VersionInfo is the KDP_VERSION reply
+type VersionInfo struct {
+	Version uint32 `json:"version"`
+	Feature uint32 `json:"feature"`
+}
+
+// KernelVersion is the parsed KDP_KERNELVERSION reply
+type KernelVersion struct {
+	Raw   string `json:"raw"`
+	UUID  string `json:"uuid,omitempty"`
+	Stext uint64 `json:"stext,omitempty"`
+}
+
+var (
+	uuidRe  = regexp.MustCompile(`UUID=([0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12})`)
+	stextRe = regexp.MustCompile(`stext=(0x[0-9A-Fa-f]+)`)
+)
+
+// ParseKernelVersion parses the kernel UUID and the (slid) kernel text base from a KDP kernel version string
+func ParseKernelVersion(s string) (*KernelVersion, error) {
+	kv := &KernelVersion{Raw: strings.TrimRight(s, "\x00")}
+	if m := uuidRe.FindStringSubmatch(kv.Raw); m != nil {
+		kv.UUID = strings.ToUpper(m[1])
+	}
+	if m := stextRe.FindStringSubmatch(kv.Raw); m != nil {
+		stext, err := strconv.ParseUint(m[1], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stext %s: %v", m[1], err)
+		}
+		kv.Stext = stext
+	}
+	return kv, nil
+}
+
+// Client is a KDP client
+type Client struct {
+	conn       *net.UDPConn
+	seq        uint8
+	key        uint32
+	maxBytes   uint32
+	connected  bool
+	exceptions chan Exception
+
+	// Timeout is how long to wait for each reply
+	Timeout time.Duration
+	// Retries is the number of times a request is resent before giving up
+	Retries int
+
+	mu sync.Mutex
+}
+
+// Dial creates a KDP client for the target at host (host or host:port)
+func Dial(host string) (*Client, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, strconv.Itoa(DefaultPort))
+	}
+	raddr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", host, err)
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %v", host, err)
+	}
+	return &Client{
+		conn:       conn,
+		exceptions: make(chan Exception, 16),
+		Timeout:    defaultTimeout,
+		Retries:    defaultRetries,
+	}, nil
+}
+
+// Exceptions returns the channel exception notifications from the target are delivered on
+func (c *Client) Exceptions() <-chan Exception {
+	return c.exceptions
+}
+
+func (c *Client) request(req Request, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pkt bytes.Buffer
+	binary.Write(&pkt, binary.LittleEndian, header{
+		Request: uint8(req),
+		Seq:     c.seq,
+		Len:     uint16(hdrSize + len(body)),
+		Key:     c.key,
+	})
+	pkt.Write(body)
+
+	buf := make([]byte, maxPacketSize)
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if _, err := c.conn.Write(pkt.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to send %s request: %v", req, err)
+		}
+		deadline := time.Now().Add(c.Timeout)
+		for {
+			c.conn.SetReadDeadline(deadline)
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					break // resend
+				}
+				return nil, fmt.Errorf("failed to read %s reply: %v", req, err)
+			}
+			if n < hdrSize {
+				continue
+			}
+			var hdr header
+			binary.Read(bytes.NewReader(buf[:hdrSize]), binary.LittleEndian, &hdr)
+			if hdr.Request&isReplyBit == 0 {
+				c.handleNotification(hdr, buf[hdrSize:n])
+				continue
+			}
+			if Request(hdr.Request&^isReplyBit) != req || hdr.Seq != c.seq {
+				continue // stale reply
+			}
+			if req == CONNECT {
+				c.key = hdr.Key
+			}
+			c.seq++
+			data := make([]byte, n-hdrSize)
+			copy(data, buf[hdrSize:n])
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %w", req, ErrTimeout)
+}
+
+// handleNotification acks (and queues) exception notifications sent by the target
+func (c *Client) handleNotification(hdr header, body []byte) {
+	if Request(hdr.Request) != EXCEPTION {
+		return
+	}
+	var ack bytes.Buffer
+	binary.Write(&ack, binary.LittleEndian, header{
+		Request: hdr.Request | isReplyBit,
+		Seq:     hdr.Seq,
+		Len:     hdrSize,
+		Key:     hdr.Key,
+	})
+	c.conn.Write(ack.Bytes())
+
+	if len(body) < 4 {
+		return
+	}
+	r := bytes.NewReader(body)
+	var count uint32
+	binary.Read(r, binary.LittleEndian, &count)
+	for i := uint32(0); i < count; i++ {
+		var exc Exception
+		if err := binary.Read(r, binary.LittleEndian, &exc); err != nil {
+			return
+		}
+		select {
+		case c.exceptions <- exc:
+		default: // drop if nobody is listening
+		}
+	}
+}
+
+func checkError(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("reply too short")
+	}
+	if e := Error(binary.LittleEndian.Uint32(data)); e != SUCCESS {
+		return e
+	}
+	return nil
+}
+
+// Connect starts a KDP session with the target
+func (c *Client) Connect(greeting string) error {
+	port := uint16(c.conn.LocalAddr().(*net.UDPAddr).Port)
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, port) // req_reply_port
+	binary.Write(&body, binary.LittleEndian, port) // exc_note_port
+	body.WriteString(greeting)
+	body.WriteByte(0)
+	data, err := c.request(CONNECT, body.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := checkError(data); err != nil {
+		return err
+	}
+	c.connected = true
+	return nil
+}
+
+// Disconnect ends the KDP session and resumes the target
+func (c *Client) Disconnect() error {
+	if _, err := c.request(DISCONNECT, nil); err != nil {
+		return err
+	}
+	c.connected = false
+	return nil
+}
+
+// Close disconnects the KDP session (if any) and closes the UDP socket
+func (c *Client) Close() error {
+	if c.connected {
+		c.Disconnect()
+	}
+	return c.conn.Close()
+}
+
+// Version returns the KDP protocol version and features of the target
+func (c *Client) Version() (*VersionInfo, error) {
+	data, err := c.request(VERSION, nil)
+	if err != nil {
+		return nil, err
+	}
+	var v VersionInfo
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse version reply: %v", err)
+	}
+	return &v, nil
+}
+
+// HostInfo returns the CPU info of the target
+func (c *Client) HostInfo() (*HostInfo, error) {
+	data, err := c.request(HOSTINFO, nil)
+	if err != nil {
+		return nil, err
+	}
+	var hi HostInfo
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hi); err != nil {
+		return nil, fmt.Errorf("failed to parse hostinfo reply: %v", err)
+	}
+	return &hi, nil
+}
+
+// KernelVersion returns the parsed kernel version string of the target
+func (c *Client) KernelVersion() (*KernelVersion, error) {
+	data, err := c.request(KERNELVERSION, nil)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return ParseKernelVersion(string(data))
+}
+
+// MaxBytes returns the max number of bytes the target will read/write in a single request
+func (c *Client) MaxBytes() (uint32, error) {
+	if c.maxBytes > 0 {
+		return c.maxBytes, nil
+	}
+	data, err := c.request(MAXBYTES, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 4 {
+		return 0, fmt.Errorf("maxbytes reply too short")
+	}
+	c.maxBytes = binary.LittleEndian.Uint32(data)
+	return c.maxBytes, nil
+}
+
+// ReadMem reads size bytes of kernel virtual memory at addr
+func (c *Client) ReadMem(addr uint64, size uint32) ([]byte, error) {
+	return c.readMem(READMEM64, addr, size)
+}
+
+// ReadPhysMem reads size bytes of physical memory at addr
+func (c *Client) ReadPhysMem(addr uint64, size uint32) ([]byte, error) {
+	return c.readMem(READPHYSMEM64, addr, size)
+}
+
+func (c *Client) readMem(req Request, addr uint64, size uint32) ([]byte, error) {
+	chunk, err := c.MaxBytes()
+	if err != nil {
+		return nil, err
+	}
+	if chunk == 0 || chunk > maxPacketSize-hdrSize-4 {
+		chunk = maxPacketSize - hdrSize - 4
+	}
+	out := make([]byte, 0, size)
+	for uint32(len(out)) < size {
+		n := min(chunk, size-uint32(len(out)))
+		var body bytes.Buffer
+		binary.Write(&body, binary.LittleEndian, addr+uint64(len(out)))
+		binary.Write(&body, binary.LittleEndian, n)
+		if req == READPHYSMEM64 {
+			binary.Write(&body, binary.LittleEndian, uint16(0)) // lcpu
+		}
+		data, err := c.request(req, body.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if err := checkError(data); err != nil {
+			return nil, fmt.Errorf("failed to read %d bytes at %#x: %w", n, addr+uint64(len(out)), err)
+		}
+		if len(data[4:]) == 0 {
+			break
+		}
+		out = append(out, data[4:]...)
+	}
+	return out, nil
+}
+
+// WriteMem writes data to kernel virtual memory at addr
+func (c *Client) WriteMem(addr uint64, data []byte) error {
+	chunk, err := c.MaxBytes()
+	if err != nil {
+		return err
+	}
+	if chunk == 0 || chunk > maxPacketSize-hdrSize-12 {
+		chunk = maxPacketSize - hdrSize - 12
+	}
+	for off := 0; off < len(data); off += int(chunk) {
+		end := min(off+int(chunk), len(data))
+		var body bytes.Buffer
+		binary.Write(&body, binary.LittleEndian, addr+uint64(off))
+		binary.Write(&body, binary.LittleEndian, uint32(end-off))
+		body.Write(data[off:end])
+		resp, err := c.request(WRITEMEM64, body.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := checkError(resp); err != nil {
+			return fmt.Errorf("failed to write %d bytes at %#x: %w", end-off, addr+uint64(off), err)
+		}
+	}
+	return nil
+}
+
+// ReadRegs returns the raw register state of flavor for cpu
+func (c *Client) ReadRegs(cpu, flavor uint32) ([]byte, error) {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, cpu)
+	binary.Write(&body, binary.LittleEndian, flavor)
+	data, err := c.request(READREGS, body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkError(data); err != nil {
+		return nil, err
+	}
+	return data[4:], nil
+}
+
+// SetBreakpoint sets a breakpoint at addr
+func (c *Client) SetBreakpoint(addr uint64) error {
+	return c.breakpoint(BREAKPOINT64_SET, addr)
+}
+
+// RemoveBreakpoint removes the breakpoint at addr
+func (c *Client) RemoveBreakpoint(addr uint64) error {
+	return c.breakpoint(BREAKPOINT64_REMOVE, addr)
+}
+
+func (c *Client) breakpoint(req Request, addr uint64) error {
+	body := binary.LittleEndian.AppendUint64(nil, addr)
+	data, err := c.request(req, body)
+	if err != nil {
+		return err
+	}
+	return checkError(data)
+}
+
+// Suspend stops the target
+func (c *Client) Suspend() error {
+	_, err := c.request(SUSPEND, nil)
+	return err
+}
+
+// Resume resumes the CPUs in cpuMask
+func (c *Client) Resume(cpuMask uint32) error {
+	_, err := c.request(RESUMECPUS, binary.LittleEndian.AppendUint32(nil, cpuMask))
+	return err
+}
+
+// Reboot reboots the target
+//
+// NOTE: the target usually reboots before it replies so a timeout is NOT treated as an error
+func (c *Client) Reboot() error {
+	retries := c.Retries
+	c.Retries = 0
+	defer func() { c.Retries = retries }()
+	if _, err := c.request(HOSTREBOOT, nil); err != nil && !errors.Is(err, ErrTimeout) {
+		return err
+	}
+	c.connected = false
+	return nil
+}
+
+// WaitForException blocks until the target reports an exception (i.e. hits a breakpoint or panics)
+func (c *Client) WaitForException(ctx context.Context) (*Exception, error) {
+	for {
+		select {
+		case exc := <-c.exceptions:
+			return &exc, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		// the exception is delivered on our socket so read (and ack) it here
+		c.mu.Lock()
+		buf := make([]byte, maxPacketSize)
+		c.conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, err := c.conn.Read(buf)
+		if err == nil && n >= hdrSize {
+			var hdr header
+			binary.Read(bytes.NewReader(buf[:hdrSize]), binary.LittleEndian, &hdr)
+			if hdr.Request&isReplyBit == 0 {
+				c.handleNotification(hdr, buf[hdrSize:n])
+			}
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,103 @@
+package kdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestParseKernelVersion(t *testing.T) {
+	kv, err := ParseKernelVersion("Darwin Kernel Version 23.0.0: Fri Sep 15 14:43:05 PDT 2023; root:xnu-10002.1.13~1/RELEASE_ARM64_T8103; UUID=0e1e5f6a-2b3c-4d5e-8f90-a1b2c3d4e5f6; stext=0xfffffe0017e04000\x00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.UUID != "0E1E5F6A-2B3C-4D5E-8F90-A1B2C3D4E5F6" {
+		t.Errorf("UUID = %s", kv.UUID)
+	}
+	if kv.Stext != 0xfffffe0017e04000 {
+		t.Errorf("Stext = %#x", kv.Stext)
+	}
+}
+
+// fakeTarget answers KDP requests like the kernel's KDP stub
+func fakeTarget(t *testing.T, mem []byte) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var hdr header
+			binary.Read(bytes.NewReader(buf[:hdrSize]), binary.LittleEndian, &hdr)
+			body := buf[hdrSize:n]
+
+			var reply bytes.Buffer
+			switch Request(hdr.Request) {
+			case CONNECT, DISCONNECT:
+				binary.Write(&reply, binary.LittleEndian, uint32(SUCCESS))
+			case VERSION:
+				binary.Write(&reply, binary.LittleEndian, VersionInfo{Version: 12, Feature: 1})
+				binary.Write(&reply, binary.LittleEndian, [2]uint32{})
+			case MAXBYTES:
+				binary.Write(&reply, binary.LittleEndian, uint32(4))
+			case READMEM64:
+				addr := binary.LittleEndian.Uint64(body[:8])
+				size := binary.LittleEndian.Uint32(body[8:12])
+				binary.Write(&reply, binary.LittleEndian, uint32(SUCCESS))
+				reply.Write(mem[addr : addr+uint64(size)])
+			}
+			var pkt bytes.Buffer
+			binary.Write(&pkt, binary.LittleEndian, header{
+				Request: hdr.Request | isReplyBit,
+				Seq:     hdr.Seq,
+				Len:     uint16(hdrSize + reply.Len()),
+				Key:     0x1337,
+			})
+			pkt.Write(reply.Bytes())
+			conn.WriteToUDP(pkt.Bytes(), addr)
+		}
+	}()
+	return conn
+}
+
+func TestClient(t *testing.T) {
+	mem := []byte("0123456789abcdef")
+	target := fakeTarget(t, mem)
+	defer target.Close()
+
+	cli, err := Dial(target.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	if err := cli.Connect("ipsw"); err != nil {
+		t.Fatal(err)
+	}
+	if cli.key != 0x1337 {
+		t.Errorf("session key = %#x", cli.key)
+	}
+
+	v, err := cli.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 12 {
+		t.Errorf("version = %d", v.Version)
+	}
+
+	// read spans multiple MAXBYTES sized requests
+	data, err := cli.ReadMem(2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, mem[2:12]) {
+		t.Errorf("ReadMem = %q", data)
+	}
+}
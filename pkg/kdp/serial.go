@@ -0,0 +1,75 @@
+package kdp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultBaudRate is the baud rate of the Apple debug UART (i.e. serial=3 boot-arg)
+const DefaultBaudRate = 115200
+
+// OpenSerial opens a serial console; path can be a tty device (i.e. /dev/cu.usbserial-XXX), a COM port on Windows
+// (i.e. COM3) or the unix socket of a VM's serial port
+func OpenSerial(path string, baud int) (io.ReadWriteCloser, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to serial socket %s: %v", path, err)
+		}
+		return conn, nil
+	}
+	if baud <= 0 {
+		baud = DefaultBaudRate
+	}
+	return openTTY(path, baud)
+}
+
+// ReadConsole calls fn for every line read from the serial console until ctx is canceled or r is closed
+func ReadConsole(ctx context.Context, r io.ReadCloser, fn func(line string)) error {
+	go func() {
+		<-ctx.Done()
+		r.Close()
+	}()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fn(strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// IsPanic returns true if the console line marks the start of a kernel panic (i.e. a good time to attach the debugger)
+func IsPanic(line string) bool {
+	return strings.Contains(line, "panic(cpu") || strings.Contains(line, "Debugger called: <") ||
+		strings.Contains(line, "Waiting for remote debugger connection")
+}
+
+var (
+	consoleUUIDRe     = regexp.MustCompile(`(?i)kernel uuid:\s*([0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12})`)
+	consoleTextBaseRe = regexp.MustCompile(`(?i)kernel text base:\s*(0x[0-9A-F]+)`)
+)
+
+// ParseConsoleLine fills in the kernel UUID and text base printed on the serial console (i.e. in a panic log)
+func ParseConsoleLine(line string, kv *KernelVersion) bool {
+	if m := consoleUUIDRe.FindStringSubmatch(line); m != nil {
+		kv.UUID = strings.ToUpper(m[1])
+		return true
+	}
+	if m := consoleTextBaseRe.FindStringSubmatch(line); m != nil {
+		if base, err := strconv.ParseUint(m[1], 0, 64); err == nil {
+			kv.Stext = base
+			return true
+		}
+	}
+	return false
+}
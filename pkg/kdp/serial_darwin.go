@@ -0,0 +1,14 @@
+package kdp
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlGetTermios = unix.TIOCGETA
+	ioctlSetTermios = unix.TIOCSETA
+)
+
+func setSpeed(t *unix.Termios, baud int) error {
+	t.Ispeed = uint64(baud)
+	t.Ospeed = uint64(baud)
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !linux && !windows
+
+package kdp
+
+import (
+	"fmt"
+	"io"
+)
+
+func openTTY(path string, baud int) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("serial devices are only supported on macOS, Linux and Windows")
+}
@@ -0,0 +1,45 @@
+//go:build darwin || linux
+
+package kdp
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openTTY(path string, baud int) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial device %s: %v", path, err)
+	}
+
+	t, err := unix.IoctlGetTermios(int(f.Fd()), ioctlGetTermios)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to get %s termios: %v", path, err)
+	}
+
+	// raw mode (8N1)
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB
+	t.Cflag |= unix.CS8 | unix.CLOCAL | unix.CREAD
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	if err := setSpeed(t, baud); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := unix.IoctlSetTermios(int(f.Fd()), ioctlSetTermios, t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to set %s termios: %v", path, err)
+	}
+
+	return f, nil
+}
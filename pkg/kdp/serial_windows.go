@@ -0,0 +1,62 @@
+//go:build windows
+
+package kdp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	dcbBinary  = 0x00000001 // fBinary
+	noParity   = 0
+	oneStopBit = 0
+)
+
+// comPath returns the device path of a COM port (i.e. COM3 -> \\.\COM3 which is required for COM10 and above)
+func comPath(path string) string {
+	if strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	return `\\.\` + path
+}
+
+func openTTY(path string, baud int) (io.ReadWriteCloser, error) {
+	name, err := windows.UTF16PtrFromString(comPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid serial device %s: %v", path, err)
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial device %s: %v", path, err)
+	}
+
+	// raw mode (8N1)
+	var dcb windows.DCB
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	if err := windows.GetCommState(h, &dcb); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to get %s comm state: %v", path, err)
+	}
+	dcb.BaudRate = uint32(baud)
+	dcb.Flags = dcbBinary
+	dcb.ByteSize = 8
+	dcb.Parity = noParity
+	dcb.StopBits = oneStopBit
+	if err := windows.SetCommState(h, &dcb); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to set %s comm state: %v", path, err)
+	}
+	// block until at least one byte is read (like VMIN=1, VTIME=0)
+	if err := windows.SetCommTimeouts(h, &windows.CommTimeouts{}); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to set %s timeouts: %v", path, err)
+	}
+
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,96 @@
+package kdp
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// KDKsPath is where the Kernel Debug Kits are installed
+const KDKsPath = "/Library/Developer/KDKs"
+
+// Symbols is the kernel binary (with symbols) matching a KDP target
+type Symbols struct {
+	Path  string `json:"path"`
+	UUID  string `json:"uuid"`
+	Base  uint64 `json:"base"`            // unslid __TEXT address
+	Slide uint64 `json:"slide,omitempty"` // KASLR slide of the running kernel
+}
+
+// KernelUUID returns the UUID of the kernel (or the kernel inside a fileset kernelcache) at path
+func KernelUUID(path string) (string, uint64, error) {
+	m, err := macho.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer m.Close()
+
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		kern, err := m.GetFileSetFileByName("com.apple.kernel")
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to find com.apple.kernel in fileset %s: %v", path, err)
+		}
+		m = kern
+	}
+
+	uuid := m.UUID()
+	if uuid == nil {
+		return "", 0, fmt.Errorf("%s has no LC_UUID", path)
+	}
+	var base uint64
+	if text := m.Segment("__TEXT"); text != nil {
+		base = text.Addr
+	}
+	return uuid.UUID.String(), base, nil
+}
+
+// FindSymbols returns the kernel matching the target's kernel version from the given paths or the installed KDKs
+func FindSymbols(kv *KernelVersion, paths ...string) (*Symbols, error) {
+	if kv == nil || len(kv.UUID) == 0 {
+		return nil, fmt.Errorf("target did not report its kernel UUID")
+	}
+
+	kdkKernels, err := filepath.Glob(filepath.Join(KDKsPath, "*.kdk", "System/Library/Kernels/kernel*"))
+	if err == nil {
+		for _, k := range kdkKernels {
+			if !strings.HasSuffix(k, ".dSYM") {
+				paths = append(paths, k)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		uuid, base, err := KernelUUID(path)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(uuid, kv.UUID) {
+			syms := &Symbols{Path: path, UUID: uuid, Base: base}
+			if kv.Stext > base && base > 0 {
+				syms.Slide = kv.Stext - base
+			}
+			return syms, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find kernel with UUID %s (install the matching KDK with `ipsw dl kdk`)", kv.UUID)
+}
+
+// LLDBCommands returns the ready-to-paste LLDB commands to attach to the KDP target with symbols loaded
+func (s *Symbols) LLDBCommands(host string) []string {
+	var cmds []string
+	if s != nil {
+		cmds = append(cmds, fmt.Sprintf("target create %q", s.Path))
+		if dsym := s.Path + ".dSYM"; strings.Contains(s.Path, KDKsPath) {
+			cmds = append(cmds, fmt.Sprintf("target symbols add %q", dsym))
+		}
+	}
+	cmds = append(cmds, fmt.Sprintf("kdp-remote %s", host))
+	if s != nil && s.Slide > 0 {
+		cmds = append(cmds, fmt.Sprintf("target modules load --file %q --slide %#x", filepath.Base(s.Path), s.Slide))
+	}
+	return cmds
+}
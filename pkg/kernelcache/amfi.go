@@ -0,0 +1,241 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+const amfiKextID = "com.apple.driver.AppleMobileFileIntegrity"
+
+// amfiKext returns the AppleMobileFileIntegrity.kext MachO (or the kernelcache itself if it isn't a MH_FILESET)
+func amfiKext(m *macho.File) (*macho.File, error) {
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		return m, nil
+	}
+	kext, err := m.GetFileSetFileByName(amfiKextID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fileset entry %s: %v", amfiKextID, err)
+	}
+	return kext, nil
+}
+
+const (
+	cdHashLen            = 20 // CS_CDHASH_LEN (larger hashes are truncated)
+	trustCacheHeaderSize = 24 // version, uuid and num_entries
+	maxTrustCacheEntries = 0x100000
+	minAllowlistLen      = 3 // the fewest hardcoded CDHashes that are reported as an allowlist
+)
+
+// AMFITrustCacheEntry is an entry of a trust cache embedded in AMFI
+type AMFITrustCacheEntry struct {
+	CDHash             string `json:"cdhash"`
+	HashType           uint8  `json:"hash_type"`       // 1 sha1, 2 sha256, 3 truncated sha256, 4 sha384 or 5 sha512
+	Flags              uint8  `json:"flags,omitempty"` // 1 amfid or 2 ANE model
+	ConstraintCategory uint8  `json:"constraint_category,omitempty"`
+}
+
+// AMFITrustCache is a (static) trust cache embedded in AMFI
+type AMFITrustCache struct {
+	Addr    uint64                `json:"addr"`
+	Section string                `json:"section"`
+	Version uint32                `json:"version"`
+	UUID    string                `json:"uuid"`
+	Entries []AMFITrustCacheEntry `json:"entries"`
+}
+
+// AMFI allowlist kinds
+const (
+	AllowlistEntitlements = "entitlements" // a table of pointers to entitlement keys
+	AllowlistCDHashes     = "cdhashes"     // a table of CDHashes
+)
+
+// AMFIAllowlist is a hardcoded allowlist in AMFI
+type AMFIAllowlist struct {
+	Addr    uint64   `json:"addr"`
+	Section string   `json:"section"`
+	Kind    string   `json:"kind"`
+	Entries []string `json:"entries"`
+}
+
+// AMFI is what's hardcoded in AppleMobileFileIntegrity
+type AMFI struct {
+	TrustCaches []AMFITrustCache `json:"trust_caches,omitempty"`
+	Allowlists  []AMFIAllowlist  `json:"allowlists,omitempty"`
+}
+
+var reEntitlementKey = regexp.MustCompile(`^[a-z0-9-]+(\.[A-Za-z0-9_-]+){2,}$`)
+
+// parseTrustCache parses the trust cache at the start of data (a version 1 or 2 trust cache
+// whose entries are valid and sorted by CDHash as the kernel binary searches them)
+func parseTrustCache(data []byte) (*AMFITrustCache, int, error) {
+	if len(data) < trustCacheHeaderSize {
+		return nil, 0, fmt.Errorf("too small")
+	}
+	tc := &AMFITrustCache{Version: binary.LittleEndian.Uint32(data)}
+	var entSize int
+	switch tc.Version {
+	case 1:
+		entSize = cdHashLen + 2
+	case 2:
+		entSize = cdHashLen + 4
+	default:
+		return nil, 0, fmt.Errorf("unsupported trust cache version %d", tc.Version)
+	}
+	uuid := types.UUID(data[4:20])
+	if uuid == (types.UUID{}) {
+		return nil, 0, fmt.Errorf("empty trust cache UUID")
+	}
+	tc.UUID = uuid.String()
+	count := int(binary.LittleEndian.Uint32(data[20:]))
+	if count == 0 || count > maxTrustCacheEntries || trustCacheHeaderSize+count*entSize > len(data) {
+		return nil, 0, fmt.Errorf("invalid trust cache entry count %d", count)
+	}
+	var prev []byte
+	for i := range count {
+		ent := data[trustCacheHeaderSize+i*entSize:][:entSize]
+		cdhash := ent[:cdHashLen]
+		if bytes.Equal(cdhash, make([]byte, cdHashLen)) || (prev != nil && bytes.Compare(prev, cdhash) >= 0) {
+			return nil, 0, fmt.Errorf("trust cache entry %d is empty or out of order", i)
+		}
+		e := AMFITrustCacheEntry{CDHash: hex.EncodeToString(cdhash), HashType: ent[cdHashLen], Flags: ent[cdHashLen+1]}
+		if e.HashType == 0 || e.HashType > 5 || e.Flags > 3 {
+			return nil, 0, fmt.Errorf("trust cache entry %d has an invalid hash type or flags", i)
+		}
+		if tc.Version == 2 {
+			e.ConstraintCategory = ent[cdHashLen+2]
+		}
+		tc.Entries = append(tc.Entries, e)
+		prev = cdhash
+	}
+	return tc, trustCacheHeaderSize + count*entSize, nil
+}
+
+// looksLikeCDHash returns true if the data looks like a hash (mostly distinct non-zero bytes)
+func looksLikeCDHash(data []byte) bool {
+	var seen [256]bool
+	var distinct, zeros int
+	for _, b := range data {
+		if b == 0 {
+			zeros++
+		}
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+	}
+	return zeros <= 2 && distinct >= 14
+}
+
+// entitlementList reads the pointers at off until they stop pointing to entitlement keys
+func entitlementList(kext *macho.File, data []byte, isCString func(uint64) bool) []string {
+	var ents []string
+	for off := 0; off+8 <= len(data); off += 8 {
+		ptr := kext.SlidePointer(binary.LittleEndian.Uint64(data[off:]))
+		if !isCString(ptr) {
+			break
+		}
+		s, err := kext.GetCString(ptr)
+		if err != nil || !reEntitlementKey.MatchString(s) {
+			break
+		}
+		ents = append(ents, s)
+	}
+	return ents
+}
+
+// GetAMFI returns the trust caches and hardcoded entitlement/CDHash allowlists embedded in AMFI's __TEXT/__DATA const sections
+//
+// NOTE: the CDHash allowlists are found heuristically (runs of at least 3 hash looking 20 byte values) so they
+// should be treated as candidates
+func GetAMFI(m *macho.File) (*AMFI, error) {
+	kext, err := amfiKext(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var cstrs []*types.Section
+	for _, sec := range kext.Sections {
+		if sec.Flags.IsCstringLiterals() || (sec.Seg == "__TEXT" && sec.Name == "__cstring") {
+			cstrs = append(cstrs, sec)
+		}
+	}
+	isCString := func(addr uint64) bool {
+		for _, sec := range cstrs {
+			if addr >= sec.Addr && addr < sec.Addr+sec.Size {
+				return true
+			}
+		}
+		return false
+	}
+
+	amfi := &AMFI{}
+	for _, sec := range kext.Sections {
+		if sec.Size == 0 || (sec.Name != "__const" && sec.Name != "__trustcache") ||
+			(sec.Seg != "__TEXT" && sec.Seg != "__DATA_CONST" && sec.Seg != "__DATA") {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+		}
+		name := sec.Seg + "." + sec.Name
+		for off := 0; off+8 <= len(data); {
+			if tc, n, err := parseTrustCache(data[off:]); err == nil {
+				tc.Addr, tc.Section = sec.Addr+uint64(off), name
+				log.WithField("entries", len(tc.Entries)).Debugf("Found AMFI trust cache at %#x", tc.Addr)
+				amfi.TrustCaches = append(amfi.TrustCaches, *tc)
+				off += (n + 3) &^ 3
+				continue
+			}
+			if off%8 == 0 {
+				if ents := entitlementList(kext, data[off:], isCString); len(ents) > 1 {
+					amfi.Allowlists = append(amfi.Allowlists, AMFIAllowlist{Addr: sec.Addr + uint64(off), Section: name, Kind: AllowlistEntitlements, Entries: ents})
+					off += len(ents) * 8
+					continue
+				}
+			}
+			var hashes []string
+			for end := off; end+cdHashLen <= len(data) && looksLikeCDHash(data[end:end+cdHashLen]); end += cdHashLen {
+				hashes = append(hashes, hex.EncodeToString(data[end:end+cdHashLen]))
+			}
+			if len(hashes) >= minAllowlistLen {
+				amfi.Allowlists = append(amfi.Allowlists, AMFIAllowlist{Addr: sec.Addr + uint64(off), Section: name, Kind: AllowlistCDHashes, Entries: hashes})
+				off += (len(hashes)*cdHashLen + 3) &^ 3
+				continue
+			}
+			off += 4
+		}
+	}
+
+	if len(amfi.TrustCaches) == 0 && len(amfi.Allowlists) == 0 {
+		return nil, fmt.Errorf("failed to find any trust caches or allowlists in %s", amfiKextID)
+	}
+
+	return amfi, nil
+}
+
+// Lines returns the AMFI trust cache entries and allowlists as sorted lines without addresses (for diffing)
+func (a *AMFI) Lines() []string {
+	var lines []string
+	for _, tc := range a.TrustCaches {
+		for _, e := range tc.Entries {
+			lines = append(lines, fmt.Sprintf("trustcache %s type=%d flags=%d category=%d", e.CDHash, e.HashType, e.Flags, e.ConstraintCategory))
+		}
+	}
+	for _, al := range a.Allowlists {
+		for _, e := range al.Entries {
+			lines = append(lines, fmt.Sprintf("%s %s", al.Kind, e))
+		}
+	}
+	sort.Strings(lines)
+	return slices.Compact(lines)
+}
@@ -0,0 +1,310 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/arm64-cgo/disassemble"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/disass"
+)
+
+// BootArg is a boot-arg (or iBoot environment variable) and the function that consumes it
+type BootArg struct {
+	Name       string `json:"name"`
+	Parser     string `json:"parser"`          // the parsing function that is called with the name (i.e. PE_parse_boot_argn)
+	Entry      string `json:"entry,omitempty"` // fileset entry of the consuming function
+	Caller     uint64 `json:"caller"`          // start of the consuming function
+	CallerName string `json:"caller_name,omitempty"`
+	Call       uint64 `json:"call"` // address of the call to the parser
+}
+
+// bootArgParsers are the XNU functions that take a boot-arg name as their first argument
+var bootArgParsers = []string{
+	"_PE_parse_boot_argn",
+	"_PE_parse_boot_arg_str",
+	"_PE_boot_arg_uint64_eq",
+	"_PE_i_can_has_debugger",
+	"_PE_get_default",
+}
+
+// knownBootArgs are well known boot-args (and iBoot environment variables) used to find the parsing
+// functions of stripped kernelcaches (and iBoot) by the calls that are made with them
+var knownBootArgs = []string{
+	"debug", "serial", "keepsyms", "kextlog", "cpus", "maxmem", "io", "msgbuf", "rd", "rootdev", "wdt",
+	"kdp_match_name", "amfi", "amfi_get_out_of_my_way", "cs_enforcement_disable", "vm_compressor", "jcpu",
+	"panic_on_exception_triage", "diag", "auto-boot", "boot-args", "boot-command", "debug-uarts", "idle-off",
+}
+
+var reBootArgName = regexp.MustCompile(`^-?[A-Za-z][A-Za-z0-9_\-.]{0,63}$`)
+
+// stringArgCall is a call (or tail call) made with a C string in one of the first argument registers
+type stringArgCall struct {
+	addr   uint64
+	target uint64
+	arg    string
+	reg    int // the argument register (x0-x3) of the string
+}
+
+// argRegs are the argument registers that are checked for C strings
+var argRegs = []disassemble.Register{disassemble.REG_X0, disassemble.REG_X1, disassemble.REG_X2, disassemble.REG_X3}
+
+// scanBootArgCalls returns the calls in the code that are made with a C string as their first argument
+func scanBootArgCalls(code []byte, addr uint64, stubs map[uint64]uint64, cstring func(uint64) (string, bool)) []stringArgCall {
+	return scanStringArgCalls(code, addr, stubs, cstring, func(reg int, str string) bool {
+		return reg == 0 && reBootArgName.MatchString(str)
+	})
+}
+
+// scanStringArgCalls returns the calls in the code that are made with a C string (that matches) as one of their
+// first four arguments
+func scanStringArgCalls(code []byte, addr uint64, stubs map[uint64]uint64, cstring func(uint64) (string, bool), match func(reg int, str string) bool) []stringArgCall {
+	var calls []stringArgCall
+	var instrValue uint32
+	var results [1024]byte
+
+	regs := make(map[disassemble.Register]uint64)
+	r := bytes.NewReader(code)
+	for ; ; addr += 4 {
+		if err := binary.Read(r, binary.LittleEndian, &instrValue); err == io.EOF {
+			break
+		}
+		instr, err := disassemble.Decompose(addr, instrValue, &results)
+		if err != nil || len(instr.Operands) == 0 {
+			continue
+		}
+		switch instr.Operation {
+		case disassemble.ARM64_ADRP, disassemble.ARM64_ADR:
+			if len(instr.Operands) > 1 && len(instr.Operands[0].Registers) > 0 {
+				regs[instr.Operands[0].Registers[0]] = instr.Operands[1].Immediate
+			}
+		case disassemble.ARM64_ADD:
+			if len(instr.Operands) > 2 && len(instr.Operands[1].Registers) > 0 && len(instr.Operands[2].Registers) == 0 {
+				if base, ok := regs[instr.Operands[1].Registers[0]]; ok {
+					regs[instr.Operands[0].Registers[0]] = base + instr.Operands[2].Immediate
+					continue
+				}
+			}
+			delete(regs, instr.Operands[0].Registers[0])
+		case disassemble.ARM64_MOV:
+			if len(instr.Operands) > 1 && len(instr.Operands[1].Registers) > 0 {
+				if val, ok := regs[instr.Operands[1].Registers[0]]; ok {
+					regs[instr.Operands[0].Registers[0]] = val
+					continue
+				}
+			}
+			if len(instr.Operands[0].Registers) > 0 {
+				delete(regs, instr.Operands[0].Registers[0])
+			}
+		case disassemble.ARM64_BL, disassemble.ARM64_B:
+			if instr.Operands[0].Class == disassemble.LABEL {
+				target := instr.Operands[0].Immediate
+				if stub, ok := stubs[target]; ok {
+					target = stub
+				}
+				for i, reg := range argRegs {
+					if val, ok := regs[reg]; ok {
+						if str, ok := cstring(val); ok && match(i, str) {
+							calls = append(calls, stringArgCall{addr: addr, target: target, arg: str, reg: i})
+						}
+					}
+				}
+			}
+			clear(regs) // the call clobbers the argument registers (and a B leaves the function)
+		case disassemble.ARM64_RET, disassemble.ARM64_RETAA, disassemble.ARM64_RETAB, disassemble.ARM64_BR:
+			clear(regs)
+		default:
+			if len(instr.Operands[0].Registers) > 0 {
+				delete(regs, instr.Operands[0].Registers[0])
+			}
+		}
+	}
+	return calls
+}
+
+// bootArgParserTargets returns the parsing functions (by address) that are called with the boot-args
+//
+// NOTE: if the parsers aren't in the symbol table the functions called with at least two of the known boot-args are used
+func bootArgParserTargets(calls []stringArgCall, symbols map[uint64]string) map[uint64]string {
+	parsers := make(map[uint64]string)
+	for addr, name := range symbols {
+		if slices.Contains(bootArgParsers, name) {
+			parsers[addr] = strings.TrimPrefix(name, "_")
+		}
+	}
+	if len(parsers) > 0 {
+		return parsers
+	}
+	known := make(map[uint64]map[string]bool)
+	for _, c := range calls {
+		if slices.Contains(knownBootArgs, strings.TrimPrefix(c.arg, "-")) {
+			if known[c.target] == nil {
+				known[c.target] = make(map[string]bool)
+			}
+			known[c.target][c.arg] = true
+		}
+	}
+	for target, args := range known {
+		if len(args) >= 2 {
+			parsers[target] = fmt.Sprintf("func_%x", target)
+		}
+	}
+	return parsers
+}
+
+func sortBootArgs(args []BootArg) {
+	sort.Slice(args, func(i, j int) bool {
+		if args[i].Name != args[j].Name {
+			return args[i].Name < args[j].Name
+		}
+		return args[i].Call < args[j].Call
+	})
+}
+
+type bootArgImage struct {
+	entry string
+	m     *macho.File
+	calls []stringArgCall
+}
+
+// GetBootArgs returns the boot-args that the kernelcache parses (with the function that consumes each)
+func GetBootArgs(m *macho.File) ([]BootArg, error) {
+	images := []*bootArgImage{{m: m}}
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		images = nil
+		for _, fe := range m.FileSets() {
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			images = append(images, &bootArgImage{entry: fe.EntryID, m: mfe})
+		}
+	}
+
+	symbols := make(map[uint64]string)
+	var all []stringArgCall
+	for _, img := range images {
+		text := img.m.Section("__TEXT_EXEC", "__text")
+		if text == nil {
+			continue
+		}
+		code, err := text.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s %s.%s data: %v", img.entry, text.Seg, text.Name, err)
+		}
+		stubs, err := disass.ParseStubsForMachO(img.m)
+		if err != nil {
+			log.Debugf("failed to parse %s stubs: %v", img.entry, err)
+		}
+		if img.m.Symtab != nil {
+			for _, sym := range img.m.Symtab.Syms {
+				if slices.Contains(bootArgParsers, sym.Name) {
+					symbols[sym.Value] = sym.Name
+				}
+			}
+		}
+		img.calls = scanBootArgCalls(code, text.Addr, stubs, func(addr uint64) (string, bool) {
+			if sec := img.m.FindSectionForVMAddr(addr); sec == nil || !sec.Flags.IsCstringLiterals() {
+				return "", false
+			}
+			str, err := img.m.GetCString(addr)
+			return str, err == nil && len(str) > 0
+		})
+		all = append(all, img.calls...)
+	}
+
+	parsers := bootArgParserTargets(all, symbols)
+	if len(parsers) == 0 {
+		return nil, fmt.Errorf("failed to find the boot-arg parsing functions")
+	}
+
+	var args []BootArg
+	for _, img := range images {
+		for _, c := range img.calls {
+			parser, ok := parsers[c.target]
+			if !ok {
+				continue
+			}
+			arg := BootArg{Name: c.arg, Parser: parser, Entry: img.entry, Call: c.addr}
+			if fn, err := img.m.GetFunctionForVMAddr(c.addr); err == nil {
+				arg.Caller = fn.StartAddr
+				if syms, err := img.m.FindAddressSymbols(fn.StartAddr); err == nil && len(syms) > 0 {
+					arg.CallerName = syms[0].Name
+				}
+			}
+			args = append(args, arg)
+		}
+	}
+	sortBootArgs(args)
+
+	return args, nil
+}
+
+// GetIBootBootArgs returns the environment variables and boot-args that a (decrypted and decompressed) iBoot parses
+//
+// NOTE: iBoot is a raw image, so addresses are offsets into the image and the consuming functions are unnamed
+func GetIBootBootArgs(data []byte) ([]BootArg, error) {
+	calls := scanBootArgCalls(data, 0, nil, func(addr uint64) (string, bool) {
+		if addr >= uint64(len(data)) {
+			return "", false
+		}
+		end := bytes.IndexByte(data[addr:], 0)
+		if end <= 0 || (addr > 0 && data[addr-1] != 0) { // must be the start of a C string
+			return "", false
+		}
+		return string(data[addr : addr+uint64(end)]), true
+	})
+	parsers := bootArgParserTargets(calls, nil)
+	if len(parsers) == 0 {
+		return nil, fmt.Errorf("failed to find the iBoot environment parsing functions")
+	}
+	var args []BootArg
+	for _, c := range calls {
+		if parser, ok := parsers[c.target]; ok {
+			args = append(args, BootArg{Name: c.arg, Parser: parser, Call: c.addr})
+		}
+	}
+	sortBootArgs(args)
+	return args, nil
+}
+
+// BootArgsDiff are the boot-arg names that were added or removed between two builds
+type BootArgsDiff struct {
+	New     []string `json:"new,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func bootArgNames(args []BootArg) []string {
+	var names []string
+	for _, a := range args {
+		names = append(names, a.Name)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// DiffBootArgs returns the boot-args that were added or removed between two builds
+func DiffBootArgs(prev, next []BootArg) *BootArgsDiff {
+	d := &BootArgsDiff{}
+	old := bootArgNames(prev)
+	cur := bootArgNames(next)
+	for _, name := range cur {
+		if _, found := slices.BinarySearch(old, name); !found {
+			d.New = append(d.New, name)
+		}
+	}
+	for _, name := range old {
+		if _, found := slices.BinarySearch(cur, name); !found {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	return d
+}
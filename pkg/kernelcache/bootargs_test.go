@@ -0,0 +1,69 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func adrX0(pc, target uint64) uint32 {
+	imm := uint32(target - pc)
+	return 0x10000000 | (imm&3)<<29 | (imm>>2&0x7ffff)<<5
+}
+
+func bl(pc, target uint64) uint32 {
+	return 0x94000000 | uint32((target-pc)>>2)&0x3ffffff
+}
+
+func TestGetIBootBootArgs(t *testing.T) {
+	const parser, other, strs = 0x40, 0x44, 0x48
+	names := []string{"debug", "serial", "custom-arg", "idle"}
+	var offs []uint64
+	off := uint64(strs + 1)
+	for _, name := range names {
+		offs = append(offs, off)
+		off += uint64(len(name)) + 1
+	}
+
+	var code []uint32
+	for i := range names {
+		pc := uint64(len(code) * 4)
+		target := uint64(parser)
+		if names[i] == "idle" {
+			target = other // only called with an unknown name, so not a parser
+		}
+		code = append(code, adrX0(pc, offs[i]), bl(pc+4, target))
+	}
+	for len(code)*4 < parser {
+		code = append(code, 0xd503201f) // NOP
+	}
+	code = append(code, 0xd65f03c0, 0xd65f03c0) // RET; RET
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, code)
+	buf.WriteByte(0)
+	for _, name := range names {
+		buf.WriteString(name + "\x00")
+	}
+
+	args, err := GetIBootBootArgs(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range args {
+		if a.Parser != "func_40" {
+			t.Errorf("%s parser = %s, want func_40", a.Name, a.Parser)
+		}
+		got = append(got, a.Name)
+	}
+	if want := []string{"custom-arg", "debug", "serial"}; !slices.Equal(got, want) {
+		t.Errorf("GetIBootBootArgs() = %v, want %v", got, want)
+	}
+
+	diff := DiffBootArgs(args[:2], args[1:])
+	if !slices.Equal(diff.New, []string{"serial"}) || !slices.Equal(diff.Removed, []string{"custom-arg"}) {
+		t.Errorf("DiffBootArgs() = %+v", diff)
+	}
+}
@@ -0,0 +1,343 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache/fixup"
+)
+
+// BootDataSection is a section of the kernel's __BOOTDATA segment
+type BootDataSection struct {
+	Name string `json:"name"`
+	Addr uint64 `json:"addr"`
+	Size uint64 `json:"size"`
+}
+
+// StartupEntry is a STARTUP() registration (struct startup_entry) the kernel runs during kernel_bootstrap()
+type StartupEntry struct {
+	Subsystem uint32 `json:"subsystem"` // startup_subsystem_id_t (the values change between XNU versions)
+	Rank      uint32 `json:"rank"`
+	Func      uint64 `json:"func"`
+	FuncName  string `json:"func_name,omitempty"`
+	Arg       uint64 `json:"arg,omitempty"`
+}
+
+// Tunable is a TUNABLE() boot-arg (or device tree property) and the compiled-in default of its variable
+type Tunable struct {
+	Name    string `json:"name"`              // the boot-arg name
+	DTPath  string `json:"dt_path,omitempty"` // the device tree property that overrides the default (TUNABLE_DT)
+	Addr    uint64 `json:"addr"`              // address of the variable
+	Size    int    `json:"size"`
+	Bool    bool   `json:"bool,omitempty"`
+	Default string `json:"default"`
+}
+
+func (t Tunable) String() string {
+	var dt string
+	if len(t.DTPath) > 0 {
+		dt = fmt.Sprintf(" (dt: %s)", t.DTPath)
+	}
+	return fmt.Sprintf("%s=%s%s", t.Name, t.Default, dt)
+}
+
+// BootData is the early-boot configuration of a kernelcache: its __BOOTDATA sections, the STARTUP() entries and
+// the TUNABLE() boot-args with their defaults
+type BootData struct {
+	Sections []BootDataSection `json:"sections"`
+	Startup  []StartupEntry    `json:"startup,omitempty"`
+	Tunables []Tunable         `json:"tunables,omitempty"`
+}
+
+const (
+	startupEntrySize = 24 // sizeof(struct startup_entry)
+	tunableSpecSize  = 64 // large enough for every startup_tunable_spec/startup_tunable_dt_spec
+)
+
+// kernelImage returns the kernel of a kernelcache (its com.apple.kernel fileset entry)
+func kernelImage(m *macho.File) (*macho.File, error) {
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		return m.GetFileSetFileByName("com.apple.kernel")
+	}
+	return m, nil
+}
+
+func readAtAddr(m *macho.File, buf []byte, addr uint64) (int, error) {
+	off, err := m.GetOffset(addr)
+	if err != nil {
+		return 0, err
+	}
+	return m.ReadAt(buf, int64(off))
+}
+
+// GetBootData returns the kernelcache's early-boot configuration
+func GetBootData(m *macho.File) (*BootData, error) {
+	kern, err := kernelImage(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the kernel: %v", err)
+	}
+	bd := &BootData{}
+	for _, sec := range kern.Sections {
+		if sec.Seg == "__BOOTDATA" {
+			bd.Sections = append(bd.Sections, BootDataSection{Name: sec.Name, Addr: sec.Addr, Size: sec.Size})
+		}
+	}
+	// STARTUP() hooks are in __BOOTDATA on arm64 (and __DATA on x86_64 and older kernels)
+	var entries *types.Section
+	for _, seg := range []string{"__BOOTDATA", "__DATA", "__DATA_CONST"} {
+		if entries = kern.Section(seg, "__init_entry_set"); entries != nil {
+			break
+		}
+	}
+	if len(bd.Sections) == 0 && entries == nil {
+		return nil, errcode.Errorf(errcode.MissingSection, "kernel has no __BOOTDATA segment or __init_entry_set section")
+	}
+	if entries == nil {
+		return bd, nil
+	}
+
+	// the raw pointers are relative to the whole kernel collection
+	ptrs := fixup.New(m)
+	data := make([]byte, entries.Size)
+	if _, err := readAtAddr(kern, data, entries.Addr); err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s: %v", entries.Seg, entries.Name, err)
+	}
+	for off := 0; off+startupEntrySize <= len(data); off += startupEntrySize {
+		e := StartupEntry{
+			Subsystem: binary.LittleEndian.Uint32(data[off:]),
+			Rank:      binary.LittleEndian.Uint32(data[off+4:]),
+			Func:      ptrs.SlidePointer(binary.LittleEndian.Uint64(data[off+8:])),
+			Arg:       ptrs.SlidePointer(binary.LittleEndian.Uint64(data[off+16:])),
+		}
+		if e.Func == 0 {
+			continue
+		}
+		if syms, err := kern.FindAddressSymbols(e.Func); err == nil && len(syms) > 0 {
+			e.FuncName = syms[0].Name
+		}
+		bd.Startup = append(bd.Startup, e)
+		if t, ok := readTunable(kern, ptrs, e.Arg); ok {
+			bd.Tunables = append(bd.Tunables, t)
+		}
+	}
+	sort.Slice(bd.Tunables, func(i, j int) bool { return bd.Tunables[i].Name < bd.Tunables[j].Name })
+	return bd, nil
+}
+
+// readTunable decodes the startup_tunable_spec (or startup_tunable_dt_spec) at addr
+func readTunable(m *macho.File, ptrs *fixup.Decoder, addr uint64) (Tunable, bool) {
+	var t Tunable
+	if addr == 0 {
+		return t, false
+	}
+	spec := make([]byte, tunableSpecSize)
+	if _, err := readAtAddr(m, spec, addr); err != nil {
+		return t, false
+	}
+	cstring := func(off int) (string, bool) {
+		ptr := ptrs.SlidePointer(binary.LittleEndian.Uint64(spec[off:]))
+		if ptr == 0 {
+			return "", false
+		}
+		s, err := m.GetCString(ptr)
+		return s, err == nil && len(s) > 0
+	}
+	name, ok := cstring(0)
+	if !ok {
+		return t, false
+	}
+	off := 8
+	if strings.HasPrefix(name, "/") { // TUNABLE_DT: { dt_base, dt_name, dt_chosen_override, boot_arg_name, var_addr, ... }
+		dtName, ok := cstring(8)
+		if !ok {
+			return t, false
+		}
+		t.DTPath = strings.TrimSuffix(name, "/") + "/" + dtName
+		name = ""
+		for off = 16; off <= 32; off += 8 {
+			if s, ok := cstring(off); ok && reBootArgName.MatchString(s) {
+				name = s
+				off += 8
+				break
+			}
+		}
+		if name == "" {
+			return t, false
+		}
+	}
+	if !reBootArgName.MatchString(name) {
+		return t, false
+	}
+	t.Name = name
+	t.Addr = ptrs.SlidePointer(binary.LittleEndian.Uint64(spec[off:]))
+	t.Size = int(int32(binary.LittleEndian.Uint32(spec[off+8:])))
+	t.Bool = spec[off+12] != 0
+	isStr := spec[off+13] == 1 // TUNABLE_STR (newer kernels)
+	if t.Addr == 0 || t.Size <= 0 || t.Size > 0x1000 {
+		return t, false
+	}
+	val := make([]byte, t.Size)
+	if _, err := readAtAddr(m, val, t.Addr); err != nil {
+		return t, false
+	}
+	t.Default = tunableValue(val, t.Bool, isStr)
+	return t, true
+}
+
+func tunableValue(val []byte, isBool, isStr bool) string {
+	if isStr || len(val) > 8 {
+		if i := bytes.IndexByte(val, 0); i >= 0 {
+			val = val[:i]
+		}
+		return fmt.Sprintf("%q", val)
+	}
+	var v uint64
+	switch len(val) {
+	case 1:
+		v = uint64(val[0])
+	case 2:
+		v = uint64(binary.LittleEndian.Uint16(val))
+	case 4:
+		v = uint64(binary.LittleEndian.Uint32(val))
+	case 8:
+		v = binary.LittleEndian.Uint64(val)
+	default:
+		return fmt.Sprintf("%x", val)
+	}
+	if isBool {
+		return fmt.Sprintf("%t", v != 0)
+	}
+	if v > 0xffff {
+		return fmt.Sprintf("%#x", v)
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// BootDataDiff are the TUNABLE() boot-args that were added, removed or whose defaults changed between two builds
+type BootDataDiff struct {
+	New     []Tunable    `json:"new,omitempty"`
+	Removed []Tunable    `json:"removed,omitempty"`
+	Changed [][2]Tunable `json:"changed,omitempty"` // the previous and new tunable
+}
+
+// DiffBootData returns the tunables that were added, removed or whose defaults changed between two builds
+func DiffBootData(prev, next *BootData) *BootDataDiff {
+	d := &BootDataDiff{}
+	key := func(t Tunable) string { return t.Name + "\x00" + t.DTPath }
+	old := make(map[string]Tunable, len(prev.Tunables))
+	for _, t := range prev.Tunables {
+		old[key(t)] = t
+	}
+	cur := make(map[string]Tunable, len(next.Tunables))
+	for _, t := range next.Tunables {
+		cur[key(t)] = t
+		if o, ok := old[key(t)]; !ok {
+			d.New = append(d.New, t)
+		} else if o.Default != t.Default || o.Size != t.Size {
+			d.Changed = append(d.Changed, [2]Tunable{o, t})
+		}
+	}
+	for _, t := range prev.Tunables {
+		if _, ok := cur[key(t)]; !ok {
+			d.Removed = append(d.Removed, t)
+		}
+	}
+	return d
+}
+
+// BootVideo is the boot console framebuffer the bootloader hands the kernel (Boot_Video in pexpert/arm64/boot.h)
+type BootVideo struct {
+	BaseAddr uint64 `json:"base_addr"` // v_baseAddr (the low bits encode the rotation)
+	Display  uint64 `json:"display"`   // v_display (0 = graphics, 1 = text)
+	RowBytes uint64 `json:"row_bytes"`
+	Width    uint64 `json:"width"`
+	Height   uint64 `json:"height"`
+	Depth    uint64 `json:"depth"` // the pixel depth (and the low bits of the scale/rotation)
+}
+
+// bootLineLengths are the sizes of the boot_args CommandLine on arm64 (BOOT_LINE_LENGTH differs between XNU versions)
+var bootLineLengths = []int{1024, 608, 256}
+
+// BootArgs is the structure the bootloader (iBoot) passes to the kernel (boot_args in pexpert/arm64/boot.h)
+//
+// NOTE: the kernelcache only contains the (zero-filled) copy the kernel makes, so it is parsed from memory dumps
+type BootArgs struct {
+	Revision         uint16    `json:"revision"`
+	Version          uint16    `json:"version"`
+	VirtBase         uint64    `json:"virt_base"`
+	PhysBase         uint64    `json:"phys_base"`
+	MemSize          uint64    `json:"mem_size"`
+	TopOfKernelData  uint64    `json:"top_of_kernel_data"`
+	Video            BootVideo `json:"video"`
+	MachineType      uint32    `json:"machine_type"`
+	DeviceTree       uint64    `json:"device_tree"`
+	DeviceTreeLength uint32    `json:"device_tree_length"`
+	CommandLine      string    `json:"command_line"`
+	BootFlags        uint64    `json:"boot_flags"`
+	MemSizeActual    uint64    `json:"mem_size_actual"`
+}
+
+// ParseBootArgs parses an arm64 boot_args structure (i.e. dumped from memory over KDP)
+func ParseBootArgs(r io.Reader) (*BootArgs, error) {
+	var hdr struct {
+		Revision        uint16
+		Version         uint16
+		_               uint32
+		VirtBase        uint64
+		PhysBase        uint64
+		MemSize         uint64
+		TopOfKernelData uint64
+		Video           BootVideo
+		MachineType     uint32
+		_               uint32
+		DeviceTree      uint64
+		DeviceTreeLen   uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("failed to read boot_args: %v", err)
+	}
+	if hdr.Revision == 0 || hdr.Revision > 3 {
+		return nil, errcode.Errorf(errcode.InvalidFormat, "invalid boot_args revision %d", hdr.Revision)
+	}
+	rest, err := io.ReadAll(io.LimitReader(r, int64(slices.Max(bootLineLengths))+4+16))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot_args command line: %v", err)
+	}
+	args := &BootArgs{
+		Revision:         hdr.Revision,
+		Version:          hdr.Version,
+		VirtBase:         hdr.VirtBase,
+		PhysBase:         hdr.PhysBase,
+		MemSize:          hdr.MemSize,
+		TopOfKernelData:  hdr.TopOfKernelData,
+		Video:            hdr.Video,
+		MachineType:      hdr.MachineType,
+		DeviceTree:       hdr.DeviceTree,
+		DeviceTreeLength: hdr.DeviceTreeLen,
+	}
+	if i := bytes.IndexByte(rest, 0); i >= 0 {
+		args.CommandLine = string(rest[:i])
+	}
+	// the command line is followed by the (8 byte aligned) bootFlags and memSizeActual
+	for _, n := range bootLineLengths {
+		off := n + 4 // CommandLine starts 4 bytes before an 8 byte boundary
+		if off+16 > len(rest) || n <= len(args.CommandLine) {
+			continue
+		}
+		flags := binary.LittleEndian.Uint64(rest[off:])
+		actual := binary.LittleEndian.Uint64(rest[off+8:])
+		if actual >= args.MemSize && actual < 1<<40 {
+			args.BootFlags, args.MemSizeActual = flags, actual
+			break
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,49 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseBootArgs(t *testing.T) {
+	buf := make([]byte, 108+608+4+16)
+	binary.LittleEndian.PutUint16(buf[0:], 2)                     // Revision
+	binary.LittleEndian.PutUint16(buf[2:], 2)                     // Version
+	binary.LittleEndian.PutUint64(buf[8:], 0xfffffe0007004000)    // virtBase
+	binary.LittleEndian.PutUint64(buf[24:], 0x1e0000000)          // memSize
+	binary.LittleEndian.PutUint64(buf[64:], 1179)                 // Video.v_width
+	binary.LittleEndian.PutUint64(buf[72:], 2556)                 // Video.v_height
+	binary.LittleEndian.PutUint32(buf[104:], 0x1c000)             // deviceTreeLength
+	copy(buf[108:], "debug=0x14e serial=3")                       // CommandLine
+	binary.LittleEndian.PutUint64(buf[108+608+4:], 1)             // bootFlags
+	binary.LittleEndian.PutUint64(buf[108+608+4+8:], 0x200000000) // memSizeActual
+
+	args, err := ParseBootArgs(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Revision != 2 || args.VirtBase != 0xfffffe0007004000 || args.Video.Width != 1179 || args.Video.Height != 2556 ||
+		args.DeviceTreeLength != 0x1c000 || args.CommandLine != "debug=0x14e serial=3" || args.BootFlags != 1 || args.MemSizeActual != 0x200000000 {
+		t.Errorf("ParseBootArgs() = %+v", args)
+	}
+	if _, err := ParseBootArgs(bytes.NewReader(make([]byte, 128))); err == nil {
+		t.Error("ParseBootArgs() of a zero-filled boot_args should fail")
+	}
+}
+
+func TestDiffBootData(t *testing.T) {
+	if got := tunableValue([]byte{1, 0, 0, 0}, true, false); got != "true" {
+		t.Errorf("tunableValue(bool) = %s", got)
+	}
+	if got := tunableValue([]byte("vm_compressor\x00\x00\x00"), false, true); got != `"vm_compressor"` {
+		t.Errorf("tunableValue(str) = %s", got)
+	}
+	prev := &BootData{Tunables: []Tunable{{Name: "wdt", Default: "0"}, {Name: "kextlog", Default: "0"}}}
+	next := &BootData{Tunables: []Tunable{{Name: "wdt", Default: "1"}, {Name: "zalloc_debug", Default: "0"}}}
+	d := DiffBootData(prev, next)
+	if len(d.New) != 1 || d.New[0].Name != "zalloc_debug" || len(d.Removed) != 1 || d.Removed[0].Name != "kextlog" ||
+		len(d.Changed) != 1 || d.Changed[0][1].Default != "1" {
+		t.Errorf("DiffBootData() = %+v", d)
+	}
+}
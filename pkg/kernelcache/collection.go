@@ -0,0 +1,115 @@
+package kernelcache
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/types"
+)
+
+// Kernel collection kinds
+const (
+	KCPrelinked = "prelinked" // a (pre MH_FILESET) prelinked kernelcache
+	KCBoot      = "boot"      // the kernel and its boot kexts (BootKernelExtensions.kc and every iOS kernelcache)
+	KCSystem    = "system"    // the pageable system kexts (SystemKernelExtensions.kc)
+	KCAux       = "aux"       // the third party kexts (AuxiliaryKernelExtensions.kc)
+)
+
+// KernelCollection is the kind of kernelcache/kernel collection and the collections it links against
+type KernelCollection struct {
+	Kind       string `json:"kind"`
+	UUID       string `json:"uuid,omitempty"`
+	BootUUID   string `json:"boot_uuid,omitempty"`   // the boot KC a system or aux KC was built against
+	SystemUUID string `json:"system_uuid,omitempty"` // the system (pageable) KC an aux KC was built against
+	Kexts      int    `json:"kexts"`
+}
+
+func kcUUID(id []byte) string {
+	if len(id) != 16 {
+		return ""
+	}
+	return types.UUID(id).String()
+}
+
+// GetKernelCollection returns the kind of kernel collection m is (from its fileset entries and __PRELINK_INFO)
+//
+// NOTE: kcgen records the UUIDs of the collections a KC links against in its __PRELINK_INFO (_BootKCID and _PageableKCID)
+// so a collection without a kernel that references a pageable KC is an aux KC and one that only references the boot KC is a system KC
+func GetKernelCollection(m *macho.File) (*KernelCollection, error) {
+	kc := &KernelCollection{Kind: KCPrelinked}
+	if uuid := m.UUID(); uuid != nil {
+		kc.UUID = uuid.String()
+	}
+	bundles := 0
+	if prelink, err := getPrelinkInfo(m); err == nil {
+		bundles = len(prelink.PrelinkInfoDictionary)
+		if id := kcUUID(prelink.KCID); id != "" {
+			kc.UUID = id
+		}
+		kc.BootUUID = kcUUID(prelink.BootKCID)
+		kc.SystemUUID = kcUUID(prelink.PageableKCID)
+	} else if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		return nil, err
+	}
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		kc.Kexts = bundles
+		return kc, nil
+	}
+
+	kc.Kind = KCSystem
+	for _, fe := range m.FileSets() {
+		if fe.EntryID == "com.apple.kernel" {
+			kc.Kind = KCBoot
+			continue
+		}
+		kc.Kexts++
+	}
+	if kc.Kind != KCBoot && len(kc.SystemUUID) > 0 {
+		kc.Kind = KCAux
+	}
+	return kc, nil
+}
+
+// kcCacheLevel returns the cache level (the index of the collection in the kernel's array of KC headers) of a
+// collection's own pointers i.e. the level that most of its DYLD_CHAINED_PTR_64_KERNEL_CACHE rebases target
+func kcCacheLevel(dcf *fixupchains.DyldChainedFixups) uint64 {
+	counts := make(map[uint64]int)
+	for _, start := range dcf.Starts {
+		for _, fixup := range start.Fixups {
+			if r, ok := fixup.(fixupchains.DyldChainedPtr64KernelCacheRebase); ok {
+				counts[r.CacheLevel()]++
+			}
+		}
+	}
+	var level uint64
+	for l, count := range counts {
+		if count > counts[level] {
+			level = l
+		}
+	}
+	return level
+}
+
+// kcLevelBases returns the base address of each cache level the fixups of m can target (m's own level and that
+// of each of the linked collections)
+func kcLevelBases(m *macho.File, linked []*macho.File) (map[uint64]uint64, error) {
+	bases := make(map[uint64]uint64)
+	for _, kc := range append([]*macho.File{m}, linked...) {
+		if !kc.HasDyldChainedFixups() {
+			continue
+		}
+		dcf, err := kc.DyldChainedFixups()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fixups: %v", err)
+		}
+		level := kcCacheLevel(dcf)
+		if _, ok := bases[level]; ok {
+			log.Warnf("kernel collections share cache level %d (ignoring the duplicate)", level)
+			continue
+		}
+		bases[level] = kc.GetBaseAddress()
+	}
+	return bases, nil
+}
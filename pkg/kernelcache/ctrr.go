@@ -0,0 +1,151 @@
+package kernelcache
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// ProtectedRange is a KTRR/CTRR protected address range of the kernelcache
+type ProtectedRange struct {
+	Name  string `json:"name"`
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Contains returns true if the range contains all of [start, end)
+func (r ProtectedRange) Contains(start, end uint64) bool {
+	return start >= r.Start && end <= r.End
+}
+
+// Overlaps returns true if the range contains any of [start, end)
+func (r ProtectedRange) Overlaps(start, end uint64) bool {
+	return start < r.End && end > r.Start
+}
+
+// SegmentProtection is where a kernelcache segment falls relative to the protected ranges
+type SegmentProtection struct {
+	Entry     string   `json:"entry,omitempty"` // fileset entry (empty for the top-level segments)
+	Name      string   `json:"name"`
+	Start     uint64   `json:"start"`
+	End       uint64   `json:"end"`
+	Prot      string   `json:"prot"`
+	Protected []string `json:"protected,omitempty"` // the ranges that contain the whole segment
+	Partial   []string `json:"partial,omitempty"`   // the ranges that only contain part of the segment
+}
+
+// Writable returns true if the segment is mapped writable (but any of it is inside a protected range)
+func (s SegmentProtection) Writable() bool {
+	return len(s.Prot) > 1 && s.Prot[1] == 'w' && (len(s.Protected) > 0 || len(s.Partial) > 0)
+}
+
+// ProtectedRegions are the KTRR/CTRR protected ranges of a kernelcache and its segments' protection
+type ProtectedRegions struct {
+	Ranges   []ProtectedRange    `json:"ranges"`
+	Segments []SegmentProtection `json:"segments"`
+}
+
+// Protected returns true if the address is inside a protected range
+func (p *ProtectedRegions) Protected(addr uint64) bool {
+	for _, r := range p.Ranges {
+		if r.Contains(addr, addr+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedSkip are the segments that are never part of the read-only region (they are freed or remapped at boot)
+var protectedSkip = []string{"__PAGEZERO", "__LINKEDIT", "__PRELINK_INFO", "__KLD", "__KLDDATA"}
+
+// GetProtectedRegions returns the KTRR/CTRR protected ranges of the kernelcache and which segments fall inside them
+//
+// NOTE: the hardware lock registers are programmed at boot (see XNU's rorgn_stash_range) so the ranges are computed the same way:
+// the read-only region spans the lowest read-only segment to the end of __LASTDATA_CONST (or __LAST) and the
+// executable ("text") region spans the lowest executable segment to the end of __LAST
+func GetProtectedRegions(m *macho.File) (*ProtectedRegions, error) {
+	kernel := m
+	var entries []string
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		for _, fe := range m.FileSets() {
+			entries = append(entries, fe.EntryID)
+		}
+		var err error
+		if kernel, err = m.GetFileSetFileByName("com.apple.kernel"); err != nil {
+			return nil, fmt.Errorf("failed to parse fileset entry com.apple.kernel: %v", err)
+		}
+	}
+
+	last := kernel.Segment("__LAST")
+	roLast := kernel.Segment("__LASTDATA_CONST")
+	if roLast == nil {
+		roLast = last
+	}
+	if roLast == nil {
+		return nil, errcode.Errorf(errcode.Unsupported, "failed to find __LAST segment (kernelcache predates KTRR)")
+	}
+
+	ro := ProtectedRange{Name: "ro", Start: ^uint64(0), End: roLast.Addr + roLast.Memsz}
+	text := ProtectedRange{Name: "text", Start: ^uint64(0)}
+	if last != nil {
+		text.End = last.Addr + last.Memsz
+	}
+	for _, seg := range m.Segments() {
+		if seg.Memsz == 0 || slices.Contains(protectedSkip, seg.Name) || seg.Addr >= ro.End {
+			continue
+		}
+		if !seg.Prot.Write() {
+			ro.Start = min(ro.Start, seg.Addr)
+		}
+		if seg.Prot.Execute() && seg.Addr < text.End {
+			text.Start = min(text.Start, seg.Addr)
+		}
+	}
+	if ro.Start == ^uint64(0) {
+		return nil, fmt.Errorf("failed to find a read-only segment below %#x", ro.End)
+	}
+
+	regions := &ProtectedRegions{Ranges: []ProtectedRange{ro}}
+	if text.Start < text.End {
+		regions.Ranges = append(regions.Ranges, text)
+	}
+
+	add := func(entry string, segs macho.Segments) {
+		for _, seg := range segs {
+			if seg.Memsz == 0 || seg.Name == "__PAGEZERO" {
+				continue
+			}
+			sp := SegmentProtection{
+				Entry: entry,
+				Name:  seg.Name,
+				Start: seg.Addr,
+				End:   seg.Addr + seg.Memsz,
+				Prot:  seg.Prot.String(),
+			}
+			for _, r := range regions.Ranges {
+				if slices.Contains(protectedSkip, seg.Name) {
+					break
+				}
+				if r.Contains(sp.Start, sp.End) {
+					sp.Protected = append(sp.Protected, r.Name)
+				} else if r.Overlaps(sp.Start, sp.End) {
+					sp.Partial = append(sp.Partial, r.Name)
+				}
+			}
+			regions.Segments = append(regions.Segments, sp)
+		}
+	}
+	add("", m.Segments())
+	for _, entry := range entries {
+		mfe, err := m.GetFileSetFileByName(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fileset entry %s: %v", entry, err)
+		}
+		add(entry, mfe.Segments())
+	}
+
+	return regions, nil
+}
@@ -0,0 +1,346 @@
+package kernelcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+)
+
+// KextNode is a kext (or kernel resource) in the dependency graph
+type KextNode struct {
+	ID                string `json:"id"`
+	Version           string `json:"version,omitempty"`
+	CompatibleVersion string `json:"compatible_version,omitempty"`
+	KernelResource    bool   `json:"kernel_resource,omitempty"`
+}
+
+// KextDependency is an OSBundleLibraries entry of a kext
+type KextDependency struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Required string `json:"required"` // the version the kext declares it needs
+	Missing  bool   `json:"missing,omitempty"`
+	// Mismatch is set when the provider can't satisfy the required version (outside [CompatibleVersion, Version])
+	Mismatch bool `json:"mismatch,omitempty"`
+}
+
+// KextGraph is the dependency graph of the kexts in a kernelcache
+type KextGraph struct {
+	Nodes  map[string]*KextNode `json:"nodes"`
+	Edges  []KextDependency     `json:"edges"`
+	Cycles [][]string           `json:"cycles,omitempty"`
+}
+
+// kextVersion is a parsed kext version (major.minor.revision[stage[stageLevel]]) like XNU's OSKextParseVersionString
+type kextVersion [5]int64
+
+// kext version stages (in release order)
+const (
+	stageDevelop    = 1
+	stageAlpha      = 3
+	stageBeta       = 5
+	stageCandidate  = 7
+	stageRelease    = 9
+	maxVersionParts = 3
+)
+
+func parseKextVersion(s string) (kextVersion, error) {
+	var v kextVersion
+	v[3] = stageRelease
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return v, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > maxVersionParts {
+		return v, fmt.Errorf("too many version components in %q", s)
+	}
+	for i, p := range parts {
+		end := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' })
+		if end < 0 {
+			end = len(p)
+		}
+		if end == 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		n, err := strconv.ParseInt(p[:end], 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q: %v", s, err)
+		}
+		v[i] = n
+		if suffix := p[end:]; len(suffix) > 0 {
+			if i != len(parts)-1 {
+				return v, fmt.Errorf("invalid version %q", s)
+			}
+			switch {
+			case strings.HasPrefix(suffix, "fc"):
+				v[3], suffix = stageCandidate, suffix[2:]
+			case suffix[0] == 'd':
+				v[3], suffix = stageDevelop, suffix[1:]
+			case suffix[0] == 'a':
+				v[3], suffix = stageAlpha, suffix[1:]
+			case suffix[0] == 'b':
+				v[3], suffix = stageBeta, suffix[1:]
+			default:
+				return v, fmt.Errorf("invalid version stage in %q", s)
+			}
+			if len(suffix) > 0 {
+				if v[4], err = strconv.ParseInt(suffix, 10, 64); err != nil {
+					return v, fmt.Errorf("invalid version stage level in %q", s)
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+func (v kextVersion) compare(o kextVersion) int {
+	return slices.Compare(v[:], o[:])
+}
+
+// satisfies returns true if a provider with the version and compatible version can be linked against by a kext requiring required
+func satisfies(required, version, compatible string) bool {
+	req, err := parseKextVersion(required)
+	if err != nil {
+		return false
+	}
+	cur, err := parseKextVersion(version)
+	if err != nil {
+		return false
+	}
+	compat, err := parseKextVersion(compatible)
+	if err != nil { // kexts without an OSBundleCompatibleVersion can't be linked against
+		return false
+	}
+	return compat.compare(req) <= 0 && req.compare(cur) <= 0
+}
+
+// NewKextDependencyGraph builds the dependency graph of the kext bundles (i.e. from GetPrelinkInfo)
+func NewKextDependencyGraph(bundles []CFBundle) *KextGraph {
+	g := &KextGraph{Nodes: make(map[string]*KextNode)}
+	for _, b := range bundles {
+		g.Nodes[b.ID] = &KextNode{
+			ID:                b.ID,
+			Version:           b.Version,
+			CompatibleVersion: b.CompatibleVersion,
+			KernelResource:    b.OSKernelResource,
+		}
+	}
+	for _, b := range bundles {
+		for _, dep := range slices.Sorted(maps.Keys(b.OSBundleLibraries)) {
+			e := KextDependency{From: b.ID, To: dep, Required: b.OSBundleLibraries[dep]}
+			if provider, ok := g.Nodes[dep]; !ok {
+				e.Missing = true
+			} else if !satisfies(e.Required, provider.Version, provider.CompatibleVersion) {
+				e.Mismatch = true
+			}
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool { return g.Edges[i].From < g.Edges[j].From })
+	g.Cycles = g.findCycles()
+	return g
+}
+
+// KextDependencyGraph returns the dependency graph of the kexts in the kernelcache (from their OSBundleLibraries)
+func KextDependencyGraph(m *macho.File) (*KextGraph, error) {
+	bundles, err := GetPrelinkInfo(m)
+	if err != nil {
+		return nil, err
+	}
+	return NewKextDependencyGraph(bundles), nil
+}
+
+// findCycles returns the strongly connected components with more than one kext (or a kext that depends on itself)
+func (g *KextGraph) findCycles() [][]string {
+	adj := make(map[string][]string)
+	self := make(map[string]bool)
+	for _, e := range g.Edges {
+		if e.Missing {
+			continue
+		}
+		adj[e.From] = append(adj[e.From], e.To)
+		if e.From == e.To {
+			self[e.From] = true
+		}
+	}
+
+	// Tarjan's strongly connected components
+	var (
+		index   int
+		stack   []string
+		cycles  [][]string
+		indices = make(map[string]int)
+		lowlink = make(map[string]int)
+		onStack = make(map[string]bool)
+	)
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		indices[v] = index
+		lowlink[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range adj[v] {
+			if _, visited := indices[w]; !visited {
+				strongConnect(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], indices[w])
+			}
+		}
+		if lowlink[v] == indices[v] {
+			var scc []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			if len(scc) > 1 || self[v] {
+				slices.Sort(scc)
+				cycles = append(cycles, scc)
+			}
+		}
+	}
+	for _, id := range g.sortedIDs() {
+		if _, visited := indices[id]; !visited {
+			strongConnect(id)
+		}
+	}
+	return cycles
+}
+
+func (g *KextGraph) sortedIDs() []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// missing returns the dependencies that aren't in the kernelcache
+func (g *KextGraph) missing() []string {
+	var ids []string
+	for _, e := range g.Edges {
+		if e.Missing {
+			ids = append(ids, e.To)
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// Mismatches returns the dependencies whose required version the provider doesn't satisfy
+func (g *KextGraph) Mismatches() []KextDependency {
+	var deps []KextDependency
+	for _, e := range g.Edges {
+		if e.Mismatch {
+			deps = append(deps, e)
+		}
+	}
+	return deps
+}
+
+// WriteDOT writes the graph in Graphviz DOT format
+func (g *KextGraph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph kexts {\n\trankdir=LR;\n\tnode [shape=box fontname=\"Menlo\"];"); err != nil {
+		return err
+	}
+	for _, id := range g.sortedIDs() {
+		n := g.Nodes[id]
+		attrs := fmt.Sprintf("label=%q", fmt.Sprintf("%s\n%s", n.ID, n.Version))
+		if n.KernelResource {
+			attrs += " style=filled fillcolor=gray90"
+		}
+		if _, err := fmt.Fprintf(w, "\t%q [%s];\n", id, attrs); err != nil {
+			return err
+		}
+	}
+	for _, id := range g.missing() {
+		if _, err := fmt.Fprintf(w, "\t%q [style=dashed color=red];\n", id); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		switch {
+		case e.Missing:
+			attrs = fmt.Sprintf(" [style=dashed color=red label=%q]", e.Required)
+		case e.Mismatch:
+			attrs = fmt.Sprintf(" [color=red label=%q]", e.Required)
+		}
+		if _, err := fmt.Fprintf(w, "\t%q -> %q%s;\n", e.From, e.To, attrs); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteMermaid writes the graph as a mermaid flowchart
+func (g *KextGraph) WriteMermaid(w io.Writer) error {
+	ids := g.sortedIDs()
+	ids = append(ids, g.missing()...)
+	nodeID := make(map[string]string, len(ids))
+	if _, err := fmt.Fprintln(w, "graph LR"); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		nodeID[id] = fmt.Sprintf("k%d", i)
+		label := id
+		if n, ok := g.Nodes[id]; ok {
+			label = fmt.Sprintf("%s %s", id, n.Version)
+		}
+		if _, err := fmt.Fprintf(w, "    %s[\"%s\"]\n", nodeID[id], label); err != nil {
+			return err
+		}
+	}
+	var bad []int
+	for i, e := range g.Edges {
+		arrow := "-->"
+		switch {
+		case e.Missing:
+			arrow = "-.->"
+			bad = append(bad, i)
+		case e.Mismatch:
+			arrow = fmt.Sprintf("-- %s -->", e.Required)
+			bad = append(bad, i)
+		}
+		if _, err := fmt.Fprintf(w, "    %s %s %s\n", nodeID[e.From], arrow, nodeID[e.To]); err != nil {
+			return err
+		}
+	}
+	for _, i := range bad {
+		if _, err := fmt.Fprintf(w, "    linkStyle %d stroke:red\n", i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the graph's nodes, edges and cycles as JSON
+func (g *KextGraph) WriteJSON(w io.Writer) error {
+	nodes := make([]*KextNode, 0, len(g.Nodes))
+	for _, id := range g.sortedIDs() {
+		nodes = append(nodes, g.Nodes[id])
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Nodes  []*KextNode      `json:"nodes"`
+		Edges  []KextDependency `json:"edges"`
+		Cycles [][]string       `json:"cycles,omitempty"`
+	}{nodes, g.Edges, g.Cycles})
+}
@@ -0,0 +1,293 @@
+package kernelcache
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/disass"
+)
+
+// EntitlementCheck is a place in the kernelcache that checks (or references) an entitlement
+type EntitlementCheck struct {
+	Entitlement string `json:"entitlement"`
+	Kext        string `json:"kext,omitempty"`
+	// Checker is the entitlement checking function that is called with the entitlement (i.e. IOTaskHasEntitlement);
+	// it is empty if the entitlement was only found in the kext's __TEXT.__cstring
+	Checker    string `json:"checker,omitempty"`
+	Caller     uint64 `json:"caller,omitempty"` // start of the checking function
+	CallerName string `json:"caller_name,omitempty"`
+	Call       uint64 `json:"call,omitempty"` // address of the call to the checker
+}
+
+func (c EntitlementCheck) String() string {
+	if len(c.Checker) == 0 {
+		return fmt.Sprintf("%s (__cstring)", c.Kext)
+	}
+	caller := c.CallerName
+	if len(caller) == 0 {
+		caller = fmt.Sprintf("func_%x", c.Caller)
+	}
+	return fmt.Sprintf("%s: %s → %s @ %#x", c.Kext, caller, c.Checker, c.Call)
+}
+
+// entitlementCheckers are the XNU/IOKit entitlement checking functions (and the argument register of the entitlement)
+var entitlementCheckers = map[string]int{
+	"_IOTaskHasEntitlement":                                      1,
+	"_IOCurrentTaskHasEntitlement":                               0,
+	"_IOTaskHasStringEntitlement":                                1,
+	"_IOCurrentTaskHasStringEntitlement":                         0,
+	"_IOVnodeHasEntitlement":                                     2,
+	"_IOTaskGetEntitlement":                                      1,
+	"_IOCurrentTaskGetEntitlement":                               0,
+	"_IOVnodeGetEntitlement":                                     2,
+	"__ZN12IOUserClient21copyClientEntitlementEP4taskPKc":        1,
+	"__ZN12IOUserClient26copyClientEntitlementVnodeEP5vnodexPKc": 2,
+}
+
+// reEntitlement matches the strings that are (almost) certainly entitlements; they are used to find the checking
+// functions of stripped kernelcaches and to report the entitlements that are only referenced in __cstring
+var reEntitlement = regexp.MustCompile(`^(com\.apple\.(private|developer|security|rootless|keystore)\.[A-Za-z0-9_.\-]+|com\.apple\.system-task-ports(\.[A-Za-z0-9_.\-]+)?|get-task-allow|task_for_pid-allow|dynamic-codesigning|run-unsigned-code|platform-application)$`)
+
+// reEntitlementArg matches the strings that checkers are called with (entitlements don't all look like reEntitlement)
+var reEntitlementArg = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.\-:]{2,127}$`)
+
+type entitlementImage struct {
+	entry string
+	m     *macho.File
+	calls []stringArgCall
+}
+
+// checker is an entitlement checking function
+type checker struct {
+	name  string
+	reg   int // the entitlement's argument register
+	count int // the number of distinct entitlements it is called with (for stripped kernelcaches)
+}
+
+// entitlementCheckerTargets returns the entitlement checking functions (by address) and their entitlement argument
+// register
+//
+// NOTE: if the checkers aren't in the symbol table the functions called with at least two distinct entitlements
+// (in the same argument register) are used
+func entitlementCheckerTargets(calls []stringArgCall, symbols map[uint64]string) map[uint64]checker {
+	checkers := make(map[uint64]checker)
+	for addr, name := range symbols {
+		if reg, ok := entitlementCheckers[name]; ok {
+			checkers[addr] = checker{name: strings.TrimPrefix(name, "_"), reg: reg}
+		}
+	}
+	if len(checkers) > 0 {
+		return checkers
+	}
+	type target struct {
+		addr uint64
+		reg  int
+	}
+	known := make(map[target]map[string]bool)
+	for _, c := range calls {
+		if reEntitlement.MatchString(c.arg) {
+			t := target{c.target, c.reg}
+			if known[t] == nil {
+				known[t] = make(map[string]bool)
+			}
+			known[t][c.arg] = true
+		}
+	}
+	for t, ents := range known {
+		if len(ents) >= 2 {
+			if cur, ok := checkers[t.addr]; ok && cur.count >= len(ents) {
+				continue // keep the register with the most entitlements
+			}
+			checkers[t.addr] = checker{name: fmt.Sprintf("func_%x", t.addr), reg: t.reg, count: len(ents)}
+		}
+	}
+	return checkers
+}
+
+// cstringEntitlements returns the entitlement-looking strings in the image's __TEXT.__cstring
+func cstringEntitlements(m *macho.File) ([]string, error) {
+	sec := m.Section("__TEXT", "__cstring")
+	if sec == nil {
+		return nil, nil
+	}
+	dat, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+	}
+	var ents []string
+	for _, s := range bytes.Split(dat, []byte{0}) {
+		if reEntitlement.Match(s) {
+			ents = append(ents, string(s))
+		}
+	}
+	slices.Sort(ents)
+	return slices.Compact(ents), nil
+}
+
+// EntitlementUsage maps entitlements to the kexts (and functions) that check them
+type EntitlementUsage map[string][]EntitlementCheck
+
+// Entitlements returns the sorted entitlement names
+func (u EntitlementUsage) Entitlements() []string {
+	ents := make([]string, 0, len(u))
+	for ent := range u {
+		ents = append(ents, ent)
+	}
+	sort.Strings(ents)
+	return ents
+}
+
+// Kexts returns the sorted (unique) kexts that check the entitlement
+func (u EntitlementUsage) Kexts(ent string) []string {
+	var kexts []string
+	for _, c := range u[ent] {
+		kexts = append(kexts, c.Kext)
+	}
+	slices.Sort(kexts)
+	return slices.Compact(kexts)
+}
+
+// GetEntitlementUsage returns the entitlements that the kernelcache's kexts check: the entitlements passed to the
+// entitlement checking functions (i.e. IOTaskHasEntitlement) and the ones only found in each kext's __TEXT.__cstring
+func GetEntitlementUsage(m *macho.File) (EntitlementUsage, error) {
+	images := []*entitlementImage{{m: m}}
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		images = nil
+		for _, fe := range m.FileSets() {
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			images = append(images, &entitlementImage{entry: fe.EntryID, m: mfe})
+		}
+	}
+
+	symbols := make(map[uint64]string)
+	var all []stringArgCall
+	for _, img := range images {
+		if img.m.Symtab != nil {
+			for _, sym := range img.m.Symtab.Syms {
+				if _, ok := entitlementCheckers[sym.Name]; ok {
+					symbols[sym.Value] = sym.Name
+				}
+			}
+		}
+		text := img.m.Section("__TEXT_EXEC", "__text")
+		if text == nil {
+			continue
+		}
+		code, err := text.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s %s.%s data: %v", img.entry, text.Seg, text.Name, err)
+		}
+		stubs, err := disass.ParseStubsForMachO(img.m)
+		if err != nil {
+			log.Debugf("failed to parse %s stubs: %v", img.entry, err)
+		}
+		img.calls = scanStringArgCalls(code, text.Addr, stubs, func(addr uint64) (string, bool) {
+			if sec := img.m.FindSectionForVMAddr(addr); sec == nil || !sec.Flags.IsCstringLiterals() {
+				return "", false
+			}
+			str, err := img.m.GetCString(addr)
+			return str, err == nil && len(str) > 0
+		}, func(reg int, str string) bool {
+			return reg < 3 && reEntitlementArg.MatchString(str)
+		})
+		all = append(all, img.calls...)
+	}
+
+	checkers := entitlementCheckerTargets(all, symbols)
+
+	usage := make(EntitlementUsage)
+	for _, img := range images {
+		checked := make(map[string]bool)
+		for _, c := range img.calls {
+			chk, ok := checkers[c.target]
+			if !ok || chk.reg != c.reg {
+				continue
+			}
+			ec := EntitlementCheck{Entitlement: c.arg, Kext: img.entry, Checker: chk.name, Call: c.addr}
+			if fn, err := img.m.GetFunctionForVMAddr(c.addr); err == nil {
+				ec.Caller = fn.StartAddr
+				if syms, err := img.m.FindAddressSymbols(fn.StartAddr); err == nil && len(syms) > 0 {
+					ec.CallerName = syms[0].Name
+				}
+			}
+			usage[c.arg] = append(usage[c.arg], ec)
+			checked[c.arg] = true
+		}
+		ents, err := cstringEntitlements(img.m)
+		if err != nil {
+			log.Debugf("failed to get %s entitlement strings: %v", img.entry, err)
+		}
+		for _, ent := range ents {
+			if !checked[ent] {
+				usage[ent] = append(usage[ent], EntitlementCheck{Entitlement: ent, Kext: img.entry})
+			}
+		}
+	}
+	for _, checks := range usage {
+		sort.SliceStable(checks, func(i, j int) bool {
+			if checks[i].Kext != checks[j].Kext {
+				return checks[i].Kext < checks[j].Kext
+			}
+			return checks[i].Call < checks[j].Call
+		})
+	}
+
+	return usage, nil
+}
+
+// EntitlementKextsDiff are the kexts that started or stopped checking an entitlement between two builds
+type EntitlementKextsDiff struct {
+	Entitlement string   `json:"entitlement"`
+	Added       []string `json:"added,omitempty"`
+	Removed     []string `json:"removed,omitempty"`
+}
+
+// EntitlementUsageDiff is the difference between two builds' entitlement usage
+type EntitlementUsageDiff struct {
+	New     []string               `json:"new,omitempty"`
+	Removed []string               `json:"removed,omitempty"`
+	Changed []EntitlementKextsDiff `json:"changed,omitempty"`
+}
+
+// DiffEntitlementUsage returns the entitlements that were added, removed or are checked by different kexts
+// between two builds
+func DiffEntitlementUsage(prev, next EntitlementUsage) *EntitlementUsageDiff {
+	d := &EntitlementUsageDiff{}
+	for _, ent := range next.Entitlements() {
+		if _, ok := prev[ent]; !ok {
+			d.New = append(d.New, ent)
+			continue
+		}
+		old, cur := prev.Kexts(ent), next.Kexts(ent)
+		kd := EntitlementKextsDiff{Entitlement: ent}
+		for _, kext := range cur {
+			if _, found := slices.BinarySearch(old, kext); !found {
+				kd.Added = append(kd.Added, kext)
+			}
+		}
+		for _, kext := range old {
+			if _, found := slices.BinarySearch(cur, kext); !found {
+				kd.Removed = append(kd.Removed, kext)
+			}
+		}
+		if len(kd.Added) > 0 || len(kd.Removed) > 0 {
+			d.Changed = append(d.Changed, kd)
+		}
+	}
+	for _, ent := range prev.Entitlements() {
+		if _, ok := next[ent]; !ok {
+			d.Removed = append(d.Removed, ent)
+		}
+	}
+	return d
+}
@@ -0,0 +1,46 @@
+package kernelcache
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEntitlementCheckerTargets(t *testing.T) {
+	calls := []stringArgCall{
+		{addr: 0x100, target: 0x9000, arg: "com.apple.private.security.storage.AppDataContainers", reg: 1},
+		{addr: 0x200, target: 0x9000, arg: "com.apple.private.kernel.jetsam", reg: 1},
+		{addr: 0x300, target: 0x9000, arg: "ProcessInfo", reg: 0}, // same target with a non entitlement in x0
+		{addr: 0x400, target: 0xa000, arg: "com.apple.driver.AppleSEPManager", reg: 0},
+		{addr: 0x500, target: 0xa000, arg: "com.apple.iokit.IOUSBFamily", reg: 0},
+	}
+	checkers := entitlementCheckerTargets(calls, nil)
+	if len(checkers) != 1 {
+		t.Fatalf("checkers = %v, want only func_9000", checkers)
+	}
+	if chk := checkers[0x9000]; chk.name != "func_9000" || chk.reg != 1 {
+		t.Errorf("checker = %+v, want func_9000 with the entitlement in x1", chk)
+	}
+
+	checkers = entitlementCheckerTargets(calls, map[uint64]string{0xb000: "_IOCurrentTaskHasEntitlement"})
+	if chk, ok := checkers[0xb000]; len(checkers) != 1 || !ok || chk.name != "IOCurrentTaskHasEntitlement" || chk.reg != 0 {
+		t.Errorf("checkers = %v, want only the IOCurrentTaskHasEntitlement symbol", checkers)
+	}
+}
+
+func TestDiffEntitlementUsage(t *testing.T) {
+	prev := EntitlementUsage{
+		"com.apple.private.kernel.jetsam":   {{Kext: "com.apple.kernel"}},
+		"com.apple.private.security.legacy": {{Kext: "com.apple.driver.AppleMobileFileIntegrity"}},
+	}
+	next := EntitlementUsage{
+		"com.apple.private.kernel.jetsam": {{Kext: "com.apple.kernel"}, {Kext: "com.apple.driver.AppleJetsam"}},
+		"com.apple.private.security.new":  {{Kext: "com.apple.security.sandbox"}},
+	}
+	d := DiffEntitlementUsage(prev, next)
+	if !slices.Equal(d.New, []string{"com.apple.private.security.new"}) || !slices.Equal(d.Removed, []string{"com.apple.private.security.legacy"}) {
+		t.Errorf("new/removed = %v/%v", d.New, d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Entitlement != "com.apple.private.kernel.jetsam" || !slices.Equal(d.Changed[0].Added, []string{"com.apple.driver.AppleJetsam"}) {
+		t.Errorf("changed = %+v", d.Changed)
+	}
+}
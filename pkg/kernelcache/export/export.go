@@ -0,0 +1,205 @@
+// Package export writes kernelcache annotations (function starts, recovered symbols and kext boundaries) as scripts
+// or import files for disassemblers so a kernelcache can be pre-annotated in one step.
+//
+// The addresses are the kernelcache's unslid VM addresses (which is where Ghidra, IDA and Binary Ninja load it).
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+)
+
+// Format is an export format
+type Format string
+
+const (
+	Ghidra      Format = "ghidra" // Ghidra python script
+	IDA         Format = "ida"    // IDA IDC script
+	BinaryNinja Format = "binja"  // JSON for Binary Ninja (see the docs for the import snippet)
+)
+
+// Formats are the supported export formats
+var Formats = []Format{Ghidra, IDA, BinaryNinja}
+
+// Ext returns the file extension of the format
+func (f Format) Ext() string {
+	switch f {
+	case Ghidra:
+		return ".ghidra.py"
+	case IDA:
+		return ".idc"
+	default:
+		return ".bndb.json"
+	}
+}
+
+// ParseFormat parses an export format name
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(name, string(f)) {
+			return f, nil
+		}
+	}
+	return "", errcode.Errorf(errcode.InvalidArgument, "unsupported export format '%s' (must be one of: ghidra, ida, binja)", name)
+}
+
+// Kext is the address range of a kext
+type Kext struct {
+	ID    string `json:"id"`
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Function is a function start (from LC_FUNCTION_STARTS)
+type Function struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end,omitempty"`
+	Name  string `json:"name,omitempty"` // empty if the function is unnamed
+	Kext  string `json:"kext,omitempty"`
+}
+
+// Symbol is a named address that isn't a function start
+type Symbol struct {
+	Addr uint64 `json:"addr"`
+	Name string `json:"name"`
+}
+
+// Annotations are the annotations of a kernelcache
+type Annotations struct {
+	Version   string     `json:"version,omitempty"`
+	Kexts     []Kext     `json:"kexts"`
+	Functions []Function `json:"functions"`
+	Symbols   []Symbol   `json:"symbols"`
+}
+
+func symbolNames(m *macho.File, names map[uint64]string) {
+	if m.Symtab == nil {
+		return
+	}
+	for _, sym := range m.Symtab.Syms {
+		if sym.Value == 0 || sym.Name == "" || sym.Type.IsDebugSym() {
+			continue
+		}
+		if _, ok := names[sym.Value]; !ok {
+			names[sym.Value] = sym.Name
+		}
+	}
+}
+
+func fileRange(m *macho.File) (uint64, uint64) {
+	var start, end uint64
+	for _, seg := range m.Segments() {
+		if seg.Name == "__LINKEDIT" || seg.Memsz == 0 {
+			continue
+		}
+		if start == 0 || seg.Addr < start {
+			start = seg.Addr
+		}
+		end = max(end, seg.Addr+seg.Memsz)
+	}
+	return start, end
+}
+
+// Collect gathers the annotations of a kernelcache
+//
+// The recovered symbols (i.e. the output of the symbolicator) take precedence over the kernelcache's own symbols
+func Collect(m *macho.File, symbols map[uint64]string) (*Annotations, error) {
+	a := &Annotations{}
+	if kv, err := kernelcache.GetVersion(m); err == nil {
+		a.Version, _, _ = strings.Cut(kv.String(), "\n")
+	}
+
+	names := make(map[uint64]string, len(symbols))
+	for addr, name := range symbols {
+		names[addr] = name
+	}
+	symbolNames(m, names)
+
+	addFuncs := func(fm *macho.File, kext string) {
+		for _, fn := range fm.GetFunctions() {
+			a.Functions = append(a.Functions, Function{Start: fn.StartAddr, End: fn.EndAddr, Kext: kext})
+		}
+	}
+
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		for _, fe := range m.FileSets() {
+			fm, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			start, end := fileRange(fm)
+			a.Kexts = append(a.Kexts, Kext{ID: fe.EntryID, Start: start, End: end})
+			symbolNames(fm, names)
+			addFuncs(fm, fe.EntryID)
+		}
+	} else {
+		kexts, err := kernelcache.GetKexts(m)
+		if err != nil {
+			log.WithError(err).Warn("failed to get kexts (kext boundaries will be missing)")
+		}
+		for _, k := range kexts {
+			if k.LoadAddr != 0 && k.Size != 0 {
+				a.Kexts = append(a.Kexts, Kext{ID: k.ID, Start: k.LoadAddr, End: k.LoadAddr + k.Size})
+			}
+		}
+		addFuncs(m, "")
+	}
+
+	sort.Slice(a.Kexts, func(i, j int) bool { return a.Kexts[i].Start < a.Kexts[j].Start })
+	sort.Slice(a.Functions, func(i, j int) bool { return a.Functions[i].Start < a.Functions[j].Start })
+
+	starts := make(map[uint64]bool, len(a.Functions))
+	for i, fn := range a.Functions {
+		starts[fn.Start] = true
+		a.Functions[i].Name = names[fn.Start]
+		if fn.Kext == "" {
+			a.Functions[i].Kext = a.kextOf(fn.Start)
+		}
+	}
+	for addr, name := range symbols { // only the recovered symbols (the kernelcache's own are already in the binary)
+		if !starts[addr] {
+			a.Symbols = append(a.Symbols, Symbol{Addr: addr, Name: name})
+		}
+	}
+	sort.Slice(a.Symbols, func(i, j int) bool { return a.Symbols[i].Addr < a.Symbols[j].Addr })
+
+	return a, nil
+}
+
+func (a *Annotations) kextOf(addr uint64) string {
+	i := sort.Search(len(a.Kexts), func(i int) bool { return a.Kexts[i].End > addr })
+	if i < len(a.Kexts) && a.Kexts[i].Start <= addr {
+		return a.Kexts[i].ID
+	}
+	return ""
+}
+
+// Write writes the annotations in the format
+func (a *Annotations) Write(w io.Writer, format Format) error {
+	switch format {
+	case Ghidra:
+		return a.writeGhidra(w)
+	case IDA:
+		return a.writeIDC(w)
+	case BinaryNinja:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(a)
+	default:
+		return errcode.Errorf(errcode.Unsupported, "unsupported export format '%s'", format)
+	}
+}
+
+// quote returns s as a string literal (valid in both python and IDC)
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
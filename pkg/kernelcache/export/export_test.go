@@ -0,0 +1,70 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	a := &Annotations{
+		Kexts: []Kext{
+			{ID: "com.apple.kernel", Start: 0xfffffff007004000, End: 0xfffffff008000000},
+			{ID: "com.apple.iokit.IOSurface", Start: 0xfffffff008000000, End: 0xfffffff008100000},
+		},
+		Functions: []Function{
+			{Start: 0xfffffff007008000, Name: "_panic"},
+			{Start: 0xfffffff008004000},
+		},
+		Symbols: []Symbol{{Addr: 0xfffffff007700000, Name: "_sysent"}},
+	}
+	if got := a.kextOf(0xfffffff008004000); got != "com.apple.iokit.IOSurface" {
+		t.Errorf("kextOf() = %q", got)
+	}
+	if got := a.kextOf(0xfffffff009000000); got != "" {
+		t.Errorf("kextOf(outside) = %q", got)
+	}
+
+	var buf bytes.Buffer
+	if err := a.Write(&buf, Ghidra); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`kext(0xfffffff008000000, 0xfffffff008100000, "com.apple.iokit.IOSurface")`,
+		`func(0xfffffff007008000, "_panic")`,
+		`func(0xfffffff008004000, None)`,
+		`label(0xfffffff007700000, "_sysent")`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("ghidra export is missing %s", want)
+		}
+	}
+
+	buf.Reset()
+	if err := a.Write(&buf, IDA); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`add_func(0xfffffff008004000, BADADDR);`,
+		`set_name(0xfffffff007008000, "_panic", SN_NOWARN|SN_NOCHECK|SN_FORCE);`,
+		"static main() {\n  auto_wait();\n  annotate_0();",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("IDC export is missing %s", want)
+		}
+	}
+
+	buf.Reset()
+	if err := a.Write(&buf, BinaryNinja); err != nil {
+		t.Fatal(err)
+	}
+	var b Annotations
+	if err := json.Unmarshal(buf.Bytes(), &b); err != nil || len(b.Functions) != 2 || b.Kexts[0].Start != 0xfffffff007004000 {
+		t.Errorf("binja export = %+v, %v", b, err)
+	}
+
+	if _, err := ParseFormat("r2"); err == nil {
+		t.Error("ParseFormat() accepted an unsupported format")
+	}
+}
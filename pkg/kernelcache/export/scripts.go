@@ -0,0 +1,110 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const ghidraHeader = `# Annotates a kernelcache with its function starts, symbols and kext boundaries
+# @category iOS.kernel
+# @runtime Jython
+from ghidra.program.model.listing import CodeUnit
+from ghidra.program.model.symbol import SourceType
+
+listing = currentProgram.getListing()
+functions = currentProgram.getFunctionManager()
+
+
+def kext(start, end, name):
+    listing.setComment(toAddr(start), CodeUnit.PLATE_COMMENT, "kext: %s (%#x-%#x)" % (name, start, end))
+
+
+def func(start, name):
+    addr = toAddr(start)
+    fn = functions.getFunctionAt(addr)
+    if fn is None:
+        disassemble(addr)
+        fn = createFunction(addr, name)
+    if fn is not None and name is not None:
+        try:
+            fn.setName(name, SourceType.IMPORTED)
+        except Exception:
+            pass
+
+
+def label(addr, name):
+    try:
+        createLabel(toAddr(addr), name, True, SourceType.IMPORTED)
+    except Exception:
+        pass
+
+`
+
+func (a *Annotations) writeGhidra(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if a.Version != "" {
+		fmt.Fprintf(bw, "# %s\n", a.Version)
+	}
+	bw.WriteString(ghidraHeader)
+	fmt.Fprintf(bw, "monitor.initialize(%d)\n", len(a.Kexts)+len(a.Functions)+len(a.Symbols))
+	for _, k := range a.Kexts {
+		fmt.Fprintf(bw, "kext(%#x, %#x, %s)\n", k.Start, k.End, quote(k.ID))
+	}
+	for i, fn := range a.Functions {
+		if i%1000 == 0 {
+			fmt.Fprintf(bw, "monitor.checkCanceled(); monitor.setProgress(%d)\n", len(a.Kexts)+i)
+		}
+		name := "None"
+		if fn.Name != "" {
+			name = quote(fn.Name)
+		}
+		fmt.Fprintf(bw, "func(%#x, %s)\n", fn.Start, name)
+	}
+	for _, sym := range a.Symbols {
+		fmt.Fprintf(bw, "label(%#x, %s)\n", sym.Addr, quote(sym.Name))
+	}
+	return bw.Flush()
+}
+
+// idcChunk is the number of statements per IDC function (IDA chokes on huge functions)
+const idcChunk = 5000
+
+func (a *Annotations) writeIDC(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("// Annotates a kernelcache with its function starts, symbols and kext boundaries\n")
+	if a.Version != "" {
+		fmt.Fprintf(bw, "// %s\n", a.Version)
+	}
+	bw.WriteString("#include <idc.idc>\n\n")
+
+	var lines []string
+	for _, k := range a.Kexts {
+		lines = append(lines, fmt.Sprintf("update_extra_cmt(%#x, E_PREV, %s);", k.Start, quote(fmt.Sprintf("kext: %s (%#x-%#x)", k.ID, k.Start, k.End))))
+	}
+	for _, fn := range a.Functions {
+		lines = append(lines, fmt.Sprintf("add_func(%#x, BADADDR);", fn.Start))
+		if fn.Name != "" {
+			lines = append(lines, fmt.Sprintf("set_name(%#x, %s, SN_NOWARN|SN_NOCHECK|SN_FORCE);", fn.Start, quote(fn.Name)))
+		}
+	}
+	for _, sym := range a.Symbols {
+		lines = append(lines, fmt.Sprintf("set_name(%#x, %s, SN_NOWARN|SN_NOCHECK|SN_FORCE);", sym.Addr, quote(sym.Name)))
+	}
+
+	var chunks int
+	for i := 0; i < len(lines); i += idcChunk {
+		fmt.Fprintf(bw, "static annotate_%d() {\n", chunks)
+		for _, line := range lines[i:min(i+idcChunk, len(lines))] {
+			fmt.Fprintf(bw, "  %s\n", line)
+		}
+		bw.WriteString("}\n\n")
+		chunks++
+	}
+	bw.WriteString("static main() {\n  auto_wait();\n")
+	for i := 0; i < chunks; i++ {
+		fmt.Fprintf(bw, "  annotate_%d();\n", i)
+	}
+	bw.WriteString("  auto_wait();\n}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,290 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// extractedSeg is a kext segment's location in the kernelcache (captured before the export rewrites it)
+type extractedSeg struct {
+	name   string
+	offset uint64
+	size   uint64
+}
+
+// matchKext returns true if the fileset entry is selected by the filter (empty filter selects all)
+func matchKext(entryID string, filter []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if entryID == f || strings.HasSuffix(entryID, "."+f) {
+			return true
+		}
+	}
+	return false
+}
+
+// kextPath returns the path of the extracted kext in outDir
+//
+// NOTE: the entry IDs come from the (untrusted) kernelcache so ones that aren't a plain file name are rejected
+func kextPath(outDir, entryID string) (string, error) {
+	if entryID == "" || entryID == "." || entryID == ".." || strings.ContainsAny(entryID, `/\`) || filepath.Base(entryID) != entryID {
+		return "", errcode.Errorf(errcode.InvalidFormat, "invalid fileset entry ID %q", entryID)
+	}
+	fname := filepath.Join(outDir, entryID+".kext")
+	if rel, err := filepath.Rel(outDir, fname); err != nil || rel != filepath.Base(fname) {
+		return "", errcode.Errorf(errcode.InvalidFormat, "fileset entry %q escapes %s", entryID, outDir)
+	}
+	return fname, nil
+}
+
+// kextFixups returns the (sorted) fixups of the kernelcache resolved to their slid (unpacked) pointer values
+//
+// The rebases of a kernel collection that target another collection (i.e. an aux KC's pointers into the boot KC)
+// are resolved with the base address of their cache level in bases (and left as is when it isn't known)
+func kextFixups(m *macho.File, bases map[uint64]uint64) ([]normFixup, error) {
+	if !m.HasDyldChainedFixups() {
+		return nil, nil
+	}
+	dcf, err := m.DyldChainedFixups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixups: %v", err)
+	}
+	base := m.GetBaseAddress()
+	var fixups []normFixup
+	var unresolved int
+	for _, start := range dcf.Starts {
+		for _, fixup := range start.Fixups {
+			switch f := fixup.(type) {
+			case fixupchains.DyldChainedPtr64KernelCacheRebase:
+				levelBase, ok := bases[f.CacheLevel()]
+				if !ok {
+					unresolved++
+					continue
+				}
+				fixups = append(fixups, normFixup{offset: f.Offset(), value: f.Target() + levelBase})
+			case fixupchains.Rebase:
+				fixups = append(fixups, normFixup{offset: f.Offset(), value: f.Target() + base})
+			case fixupchains.Bind:
+				addr, err := m.FindSymbolAddress(f.Name())
+				if err != nil {
+					log.Debugf("failed to resolve bind %s at %#x (leaving addend)", f.Name(), f.Offset())
+				}
+				fixups = append(fixups, normFixup{offset: f.Offset(), value: addr + f.Addend()})
+			}
+		}
+	}
+	if unresolved > 0 {
+		log.Warnf("%d pointers target other kernel collections (supply them to resolve the pointers)", unresolved)
+	}
+	sort.Slice(fixups, func(i, j int) bool { return fixups[i].offset < fixups[j].offset })
+	return fixups, nil
+}
+
+// linkedit data load commands (and the offsets of their file offset fields)
+var linkeditOffsets = map[types.LoadCmd][]int{
+	types.LC_SYMTAB:                   {8, 16},                  // symoff, stroff
+	types.LC_DYSYMTAB:                 {32, 40, 48, 56, 64, 72}, // tocoff, modtaboff, extrefsymoff, indirectsymoff, extreloff, locreloff
+	types.LC_CODE_SIGNATURE:           {8},                      // dataoff
+	types.LC_SEGMENT_SPLIT_INFO:       {8},
+	types.LC_FUNCTION_STARTS:          {8},
+	types.LC_DATA_IN_CODE:             {8},
+	types.LC_DYLIB_CODE_SIGN_DRS:      {8},
+	types.LC_LINKER_OPTIMIZATION_HINT: {8},
+	types.LC_DYLD_EXPORTS_TRIE:        {8},
+}
+
+// rebuildKext lays the kext's segments out at the (page aligned) offsets of the exported MachO's load commands,
+// remaps the linkedit offsets of its load commands and rewrites its chained fixup pointers with their slid addresses
+func rebuildKext(kc *macho.File, path string, segs []extractedSeg, fixups []normFixup) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 32 {
+		return 0, fmt.Errorf("exported kext is too small")
+	}
+	hdrSize := 32 + uint64(binary.LittleEndian.Uint32(data[20:])) // mach_header_64 + sizeofcmds
+	if hdrSize > uint64(len(data)) {
+		return 0, fmt.Errorf("exported kext load commands are truncated")
+	}
+	hdr := data[:hdrSize]
+
+	// get the new segment offsets (and the end of the file)
+	newOffsets := make(map[string]uint64)
+	var fileSize uint64
+	for off := uint64(32); off+8 <= hdrSize; {
+		cmd := types.LoadCmd(binary.LittleEndian.Uint32(hdr[off:]))
+		size := uint64(binary.LittleEndian.Uint32(hdr[off+4:]))
+		if size == 0 || off+size > hdrSize {
+			break
+		}
+		if cmd == types.LC_SEGMENT_64 {
+			name := strings.TrimRight(string(hdr[off+8:off+24]), "\x00")
+			newOffsets[name] = binary.LittleEndian.Uint64(hdr[off+40:])
+			fileSize = max(fileSize, newOffsets[name]+binary.LittleEndian.Uint64(hdr[off+48:]))
+		}
+		off += size
+	}
+	remap := func(old uint64) (uint64, bool) {
+		for _, seg := range segs {
+			if newOff, ok := newOffsets[seg.name]; ok && old >= seg.offset && old < seg.offset+seg.size {
+				return newOff + (old - seg.offset), true
+			}
+		}
+		return 0, false
+	}
+	for off := uint64(32); off+8 <= hdrSize; {
+		cmd := types.LoadCmd(binary.LittleEndian.Uint32(hdr[off:]))
+		size := uint64(binary.LittleEndian.Uint32(hdr[off+4:]))
+		if size == 0 || off+size > hdrSize {
+			break
+		}
+		for _, field := range linkeditOffsets[cmd] {
+			if uint64(field)+4 > size {
+				continue
+			}
+			if old := uint64(binary.LittleEndian.Uint32(hdr[off+uint64(field):])); old != 0 {
+				if newOff, ok := remap(old); ok {
+					binary.LittleEndian.PutUint32(hdr[off+uint64(field):], uint32(newOff))
+				}
+			}
+		}
+		off += size
+	}
+
+	out := make([]byte, max(fileSize, hdrSize))
+	for _, seg := range segs {
+		newOff, ok := newOffsets[seg.name]
+		if !ok || seg.size == 0 {
+			continue
+		}
+		dat := make([]byte, seg.size)
+		if _, err := kc.ReadAt(dat, int64(seg.offset)); err != nil {
+			return 0, fmt.Errorf("failed to read %s data: %v", seg.name, err)
+		}
+		copy(out[newOff:], dat)
+	}
+	copy(out, hdr)
+
+	var count int
+	for _, seg := range segs {
+		newOff, ok := newOffsets[seg.name]
+		if !ok || seg.size == 0 {
+			continue
+		}
+		first := sort.Search(len(fixups), func(i int) bool { return fixups[i].offset >= seg.offset })
+		for _, f := range fixups[first:] {
+			if f.offset+8 > seg.offset+seg.size {
+				break
+			}
+			if off := newOff + (f.offset - seg.offset); off >= hdrSize && off+8 <= uint64(len(out)) {
+				binary.LittleEndian.PutUint64(out[off:], f.value)
+				count++
+			}
+		}
+	}
+	return count, os.WriteFile(path, out, 0755)
+}
+
+// ExtractKexts carves the kexts out of an MH_FILESET kernelcache (or macOS boot, system or aux kernel collection)
+// into standalone MachOs
+//
+// Each kext is written to outDir/<bundle-id>.kext with its chained fixups rebound to their slid addresses,
+// filter selects kexts by bundle ID (or its last component) and an empty filter extracts all of them.
+// linked are the other kernel collections the collection's pointers target (i.e. the boot KC of a system or aux KC)
+func ExtractKexts(kernelPath, outDir string, filter []string, linked ...string) error {
+	kernelPath, err := DecompressedPath(kernelPath)
+	if err != nil {
+		return err
+	}
+	m, err := macho.Open(kernelPath)
+	if err != nil {
+		return fmt.Errorf("failed to open kernelcache: %v", err)
+	}
+	defer m.Close()
+
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		return fmt.Errorf("kernelcache type is not MH_FILESET (KEXT-xtraction not supported yet)")
+	}
+
+	if kc, err := GetKernelCollection(m); err == nil {
+		log.WithFields(log.Fields{"uuid": kc.UUID, "kexts": kc.Kexts}).Debugf("Extracting from %s kernel collection", kc.Kind)
+	}
+
+	var linkedKCs []*macho.File
+	for _, path := range linked {
+		path, err := DecompressedPath(path)
+		if err != nil {
+			return err
+		}
+		lkc, err := macho.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open kernel collection %s: %v", path, err)
+		}
+		defer lkc.Close()
+		linkedKCs = append(linkedKCs, lkc)
+	}
+	bases, err := kcLevelBases(m, linkedKCs)
+	if err != nil {
+		return err
+	}
+
+	var dcf *fixupchains.DyldChainedFixups
+	if m.HasDyldChainedFixups() {
+		dcf, err = m.DyldChainedFixups()
+		if err != nil {
+			return fmt.Errorf("failed to parse fixups: %v", err)
+		}
+	}
+	fixups, err := kextFixups(m, bases)
+	if err != nil {
+		return err
+	}
+	baseAddress := m.GetBaseAddress()
+
+	var found int
+	for _, fe := range m.FileSets() {
+		if !matchKext(fe.EntryID, filter) {
+			continue
+		}
+		found++
+		fname, err := kextPath(outDir, fe.EntryID)
+		if err != nil {
+			return err
+		}
+		mfe, err := m.GetFileSetFileByName(fe.EntryID)
+		if err != nil {
+			return fmt.Errorf("failed to parse kext %s: %v", fe.EntryID, err)
+		}
+		var segs []extractedSeg
+		for _, seg := range mfe.Segments() {
+			segs = append(segs, extractedSeg{name: seg.Name, offset: seg.Offset, size: seg.Filesz})
+		}
+		if err := mfe.Export(fname, dcf, baseAddress, nil); err != nil {
+			return fmt.Errorf("failed to export kext %s: %v", fe.EntryID, err)
+		}
+		count, err := rebuildKext(m, fname, segs, fixups)
+		if err != nil {
+			return fmt.Errorf("failed to rebind %s fixups: %v", fe.EntryID, err)
+		}
+		utils.Indent(log.Info, 2)(fmt.Sprintf("Created %s (rebound %d fixups)", fname, count))
+	}
+	if found == 0 && len(filter) > 0 {
+		return fmt.Errorf("no kexts found matching %s", strings.Join(filter, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package fixup decodes the raw (on disk) pointers of kernelcaches so that analyzers don't each re-implement the
+// bit-twiddling.
+//
+// It understands both arm64e chained fixup kernelcache rebase formats (DYLD_CHAINED_PTR_64_KERNEL_CACHE used by
+// MH_FILESET kernel collections and DYLD_CHAINED_PTR_ARM64E_KERNEL) as well as the tagged pointers (stored with
+// their top 16 bits stripped) of older prelinked kernelcaches.
+package fixup
+
+import (
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+)
+
+// TagMask is the top 16 bits of a kernel pointer that prelinked kernelcaches without chained fixups strip
+const TagMask = 0xffff000000000000
+
+// Tagged is the pointer format of kernelcaches without chained fixups
+const Tagged fixupchains.DCPtrKind = 0
+
+// Pointer is a decoded kernelcache pointer
+type Pointer struct {
+	Raw        uint64
+	Target     uint64 // the offset from the base of its cache level (the untagged address for Tagged pointers)
+	CacheLevel uint64 // the kernel collection the pointer targets (the index of its mach_header in the boot KC)
+	Auth       bool
+	Key        uint64
+	AddrDiv    bool
+	Diversity  uint64
+	Bind       bool // a DYLD_CHAINED_PTR_ARM64E_KERNEL bind (kernelcaches only bind when linking against another KC)
+}
+
+// Decode decodes a raw pointer of the given format
+func Decode(format fixupchains.DCPtrKind, raw uint64) Pointer {
+	p := Pointer{Raw: raw}
+	switch format {
+	case fixupchains.DYLD_CHAINED_PTR_64_KERNEL_CACHE, fixupchains.DYLD_CHAINED_PTR_X86_64_KERNEL_CACHE:
+		r := fixupchains.DyldChainedPtr64KernelCacheRebase{Pointer: raw}
+		p.Target = r.Target()
+		p.CacheLevel = r.CacheLevel()
+		if r.IsAuth() == 1 {
+			p.Auth = true
+			p.Key = r.Key()
+			p.AddrDiv = r.AddrDiv() == 1
+			p.Diversity = r.Diversity()
+		}
+	case fixupchains.DYLD_CHAINED_PTR_ARM64E_KERNEL:
+		switch {
+		case fixupchains.DcpArm64eIsBind(raw):
+			p.Bind = true
+			p.Auth = fixupchains.DcpArm64eIsAuth(raw)
+		case fixupchains.DcpArm64eIsAuth(raw):
+			r := fixupchains.DyldChainedPtrArm64eAuthRebase{Pointer: raw}
+			p.Target = r.Target()
+			p.Auth = true
+			p.Key = r.Key()
+			p.AddrDiv = r.AddrDiv() == 1
+			p.Diversity = r.Diversity()
+		default:
+			p.Target = fixupchains.DyldChainedPtrArm64eRebase{Pointer: raw}.UnpackTarget() // unauth targets are VM offsets
+		}
+	default:
+		p.Target = UnTag(raw)
+	}
+	return p
+}
+
+// UnTag restores the stripped top 16 bits of a Tagged pointer
+func UnTag(raw uint64) uint64 {
+	if raw == 0 {
+		return 0
+	}
+	return raw | TagMask
+}
+
+// IsAuthPointer reports whether the raw pointer is signed (a PAC pointer) when the kernel slides it
+func IsAuthPointer(format fixupchains.DCPtrKind, raw uint64) bool {
+	return Decode(format, raw).Auth
+}
+
+// TargetOf returns the target of a raw pointer: the offset from the base of its cache level for chained fixup
+// formats or the untagged address for Tagged pointers (it returns false for binds and NULL pointers)
+func TargetOf(format fixupchains.DCPtrKind, raw uint64) (uint64, bool) {
+	if raw == 0 {
+		return 0, false
+	}
+	p := Decode(format, raw)
+	if p.Bind {
+		return 0, false
+	}
+	return p.Target, true
+}
+
+// SlidePointer returns the VM address of a raw pointer of a kernelcache with the given base address
+//
+// NOTE: binds (and NULL pointers) are returned as is
+func SlidePointer(format fixupchains.DCPtrKind, raw, base uint64) uint64 {
+	target, ok := TargetOf(format, raw)
+	if !ok {
+		return raw
+	}
+	if format == Tagged {
+		return target
+	}
+	return base + target
+}
+
+// FormatOf returns the pointer format of a kernelcache (Tagged if it doesn't have chained fixups)
+func FormatOf(m *macho.File) fixupchains.DCPtrKind {
+	if !m.HasDyldChainedFixups() {
+		return Tagged
+	}
+	dcf, err := m.DyldChainedFixups()
+	if err != nil {
+		return Tagged
+	}
+	return dcf.PointerFormat
+}
+
+// Decoder slides the raw pointers of a kernelcache
+type Decoder struct {
+	Format fixupchains.DCPtrKind
+	Base   uint64
+	// the base addresses of the other kernel collections the pointers can target (by their cache level)
+	LevelBases map[uint64]uint64
+}
+
+// New returns the pointer decoder of a kernelcache
+//
+// NOTE: use the decoder of the whole kernelcache for its fileset entries (their pointers are relative to the
+// kernel collection's base and the entries don't have their own chained fixups)
+func New(m *macho.File) *Decoder {
+	return &Decoder{Format: FormatOf(m), Base: m.GetBaseAddress()}
+}
+
+// Decode decodes a raw pointer
+func (d *Decoder) Decode(raw uint64) Pointer {
+	return Decode(d.Format, raw)
+}
+
+// SlidePointer returns the VM address of a raw pointer (see SlidePointer)
+func (d *Decoder) SlidePointer(raw uint64) uint64 {
+	if d.Format == fixupchains.DYLD_CHAINED_PTR_64_KERNEL_CACHE || d.Format == fixupchains.DYLD_CHAINED_PTR_X86_64_KERNEL_CACHE {
+		if base, ok := d.LevelBases[Decode(d.Format, raw).CacheLevel]; ok {
+			return SlidePointer(d.Format, raw, base)
+		}
+	}
+	return SlidePointer(d.Format, raw, d.Base)
+}
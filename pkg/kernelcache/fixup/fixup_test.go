@@ -0,0 +1,46 @@
+package fixup
+
+import (
+	"testing"
+
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+)
+
+func TestDecode(t *testing.T) {
+	const base = 0xfffffff007004000
+
+	kc := uint64(1<<63 | 2<<49 | 1<<48 | 0x1234<<32 | 1<<30 | 0x123456)
+	if p := Decode(fixupchains.DYLD_CHAINED_PTR_64_KERNEL_CACHE, kc); p.Target != 0x123456 || p.CacheLevel != 1 ||
+		!p.Auth || p.Key != 2 || !p.AddrDiv || p.Diversity != 0x1234 {
+		t.Errorf("Decode(64_KERNEL_CACHE) = %+v", p)
+	}
+	if got := SlidePointer(fixupchains.DYLD_CHAINED_PTR_64_KERNEL_CACHE, kc, base); got != base+0x123456 {
+		t.Errorf("SlidePointer(64_KERNEL_CACHE) = %#x", got)
+	}
+	d := &Decoder{Format: fixupchains.DYLD_CHAINED_PTR_64_KERNEL_CACHE, Base: base, LevelBases: map[uint64]uint64{1: 0xfffffe0007004000}}
+	if got := d.SlidePointer(kc); got != 0xfffffe0007004000+0x123456 {
+		t.Errorf("Decoder.SlidePointer(cache level 1) = %#x", got)
+	}
+
+	rebase := uint64(1<<51 | 0x1000)
+	if got := SlidePointer(fixupchains.DYLD_CHAINED_PTR_ARM64E_KERNEL, rebase, base); got != base+0x1000 {
+		t.Errorf("SlidePointer(ARM64E_KERNEL rebase) = %#x", got)
+	}
+	if IsAuthPointer(fixupchains.DYLD_CHAINED_PTR_ARM64E_KERNEL, rebase) {
+		t.Error("IsAuthPointer(ARM64E_KERNEL rebase) = true")
+	}
+	auth := uint64(1<<63 | 1<<49 | 0xbeef<<32 | 0x2000)
+	if p := Decode(fixupchains.DYLD_CHAINED_PTR_ARM64E_KERNEL, auth); p.Target != 0x2000 || !p.Auth || p.Key != 1 || p.Diversity != 0xbeef {
+		t.Errorf("Decode(ARM64E_KERNEL auth rebase) = %+v", p)
+	}
+	if _, ok := TargetOf(fixupchains.DYLD_CHAINED_PTR_ARM64E_KERNEL, 1<<62|5); ok {
+		t.Error("TargetOf(ARM64E_KERNEL bind) returned a target")
+	}
+
+	if got := SlidePointer(Tagged, 0x0017fff007004000, base); got != base {
+		t.Errorf("SlidePointer(Tagged) = %#x", got)
+	}
+	if got := SlidePointer(Tagged, 0, base); got != 0 {
+		t.Errorf("SlidePointer(NULL) = %#x", got)
+	}
+}
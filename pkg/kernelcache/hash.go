@@ -0,0 +1,200 @@
+package kernelcache
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/types"
+)
+
+// SegmentHash is the stable hash of a segment's data (normalized over its pointer fixups)
+type SegmentHash struct {
+	Name   string `json:"name"`
+	Addr   uint64 `json:"addr"`
+	Size   uint64 `json:"size"`
+	Fixups int    `json:"fixups"`
+	SHA256 string `json:"sha256"`
+}
+
+// KextHash is the stable hash of a fileset entry (over all of its segments)
+type KextHash struct {
+	ID       string        `json:"id"`
+	SHA256   string        `json:"sha256"`
+	Segments []SegmentHash `json:"segments"`
+}
+
+// Hashes are the stable segment and kext hashes of a kernelcache
+type Hashes struct {
+	Segments []SegmentHash `json:"segments"`
+	Kexts    []KextHash    `json:"kexts,omitempty"`
+}
+
+// normalized pointer fixup (file offset -> value that doesn't depend on the chain encoding)
+type normFixup struct {
+	offset uint64
+	value  uint64
+}
+
+// normalizedFixups returns the (sorted) fixups of the kernelcache with each pointer replaced by
+// its target (rebases) or a hash of its symbol and addend (binds) so the chain's next/auth bits are ignored
+func normalizedFixups(m *macho.File) ([]normFixup, error) {
+	if !m.HasDyldChainedFixups() {
+		log.Warn("kernelcache has no chained fixups (hashing the raw pointers)")
+		return nil, nil
+	}
+	dcf, err := m.DyldChainedFixups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixups: %v", err)
+	}
+	var fixups []normFixup
+	for _, start := range dcf.Starts {
+		for _, fixup := range start.Fixups {
+			switch f := fixup.(type) {
+			case fixupchains.Rebase:
+				fixups = append(fixups, normFixup{offset: f.Offset(), value: f.Target()})
+			case fixupchains.Bind:
+				h := fnv.New64a()
+				h.Write([]byte(f.Name()))
+				fixups = append(fixups, normFixup{offset: f.Offset(), value: h.Sum64() + f.Addend()})
+			}
+		}
+	}
+	slices.SortFunc(fixups, func(a, b normFixup) int { return cmp.Compare(a.offset, b.offset) })
+	return fixups, nil
+}
+
+// hashSegment returns the hash of the segment's file data with the fixups normalized
+func hashSegment(m *macho.File, seg *macho.Segment, fixups []normFixup) (SegmentHash, error) {
+	sh := SegmentHash{Name: seg.Name, Addr: seg.Addr, Size: seg.Filesz}
+	data := make([]byte, seg.Filesz)
+	if _, err := m.ReadAt(data, int64(seg.Offset)); err != nil {
+		return sh, fmt.Errorf("failed to read %s data: %v", seg.Name, err)
+	}
+	first := sort.Search(len(fixups), func(i int) bool { return fixups[i].offset >= seg.Offset })
+	for _, f := range fixups[first:] {
+		if f.offset+8 > seg.Offset+seg.Filesz {
+			break
+		}
+		binary.LittleEndian.PutUint64(data[f.offset-seg.Offset:], f.value)
+		sh.Fixups++
+	}
+	sum := sha256.Sum256(data)
+	sh.SHA256 = hex.EncodeToString(sum[:])
+	return sh, nil
+}
+
+// hashedSegment returns true if the segment's data is part of the hash
+// (__LINKEDIT is skipped as it holds the fixup chains and symbol tables that are expected to differ)
+func hashedSegment(seg *macho.Segment) bool {
+	return seg.Filesz > 0 && seg.Name != "__LINKEDIT"
+}
+
+// GetHashes returns the stable per-segment (and per-kext for MH_FILESET kernelcaches) hashes of the kernelcache
+//
+// NOTE: the pointers in the segments are normalized over the chained fixups so two kernelcaches hash the
+// same if they are functionally identical (even if their fixup chain encodings differ)
+func GetHashes(m *macho.File) (*Hashes, error) {
+	fixups, err := normalizedFixups(m)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := &Hashes{}
+	for _, seg := range m.Segments() {
+		if !hashedSegment(seg) {
+			continue
+		}
+		sh, err := hashSegment(m, seg, fixups)
+		if err != nil {
+			return nil, err
+		}
+		hashes.Segments = append(hashes.Segments, sh)
+	}
+
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		return hashes, nil
+	}
+	for _, fe := range m.FileSets() {
+		mfe, err := m.GetFileSetFileByName(fe.EntryID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse entry %s: %v", fe.EntryID, err)
+		}
+		kh := KextHash{ID: fe.EntryID}
+		h := sha256.New()
+		for _, seg := range mfe.Segments() {
+			if !hashedSegment(seg) {
+				continue
+			}
+			sh, err := hashSegment(m, seg, fixups)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash %s: %v", fe.EntryID, err)
+			}
+			fmt.Fprintf(h, "%s:%s\n", sh.Name, sh.SHA256)
+			kh.Segments = append(kh.Segments, sh)
+		}
+		kh.SHA256 = hex.EncodeToString(h.Sum(nil))
+		hashes.Kexts = append(hashes.Kexts, kh)
+	}
+	sort.Slice(hashes.Kexts, func(i, j int) bool { return hashes.Kexts[i].ID < hashes.Kexts[j].ID })
+
+	return hashes, nil
+}
+
+// HashDiff are the segments and kexts whose hashes differ between two kernelcaches
+type HashDiff struct {
+	Segments []string `json:"segments,omitempty"`
+	Kexts    []string `json:"kexts,omitempty"`
+	New      []string `json:"new,omitempty"`     // kexts only in the second kernelcache
+	Removed  []string `json:"removed,omitempty"` // kexts only in the first kernelcache
+}
+
+// Identical returns true if the kernelcaches are functionally identical
+func (d *HashDiff) Identical() bool {
+	return len(d.Segments) == 0 && len(d.Kexts) == 0 && len(d.New) == 0 && len(d.Removed) == 0
+}
+
+// CompareHashes returns the segments and kexts whose hashes differ
+func CompareHashes(prev, next *Hashes) *HashDiff {
+	d := &HashDiff{}
+	segs := make(map[string]string)
+	for _, s := range prev.Segments {
+		segs[s.Name] = s.SHA256
+	}
+	for _, s := range next.Segments {
+		if old, ok := segs[s.Name]; !ok || old != s.SHA256 {
+			d.Segments = append(d.Segments, s.Name)
+		}
+		delete(segs, s.Name)
+	}
+	for name := range segs {
+		d.Segments = append(d.Segments, name)
+	}
+	slices.Sort(d.Segments)
+
+	kexts := make(map[string]string)
+	for _, k := range prev.Kexts {
+		kexts[k.ID] = k.SHA256
+	}
+	for _, k := range next.Kexts {
+		if old, ok := kexts[k.ID]; !ok {
+			d.New = append(d.New, k.ID)
+		} else if old != k.SHA256 {
+			d.Kexts = append(d.Kexts, k.ID)
+		}
+		delete(kexts, k.ID)
+	}
+	for id := range kexts {
+		d.Removed = append(d.Removed, id)
+	}
+	slices.Sort(d.Removed)
+	return d
+}
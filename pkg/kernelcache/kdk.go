@@ -0,0 +1,369 @@
+package kernelcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	dwf "github.com/blacktop/go-dwarf"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// KDKsPath is where the Kernel Debug Kits are installed
+const KDKsPath = "/Library/Developer/KDKs"
+
+// KDKSymbol is a symbol of a Kernel Debug Kit binary moved to its address in the kernelcache
+type KDKSymbol struct {
+	Entry string `json:"entry,omitempty"` // fileset entry
+	Name  string `json:"name"`
+	Addr  uint64 `json:"addr"`
+	Kind  string `json:"kind"`           // func or data
+	Type  string `json:"type,omitempty"` // the DWARF type (i.e. the function's prototype)
+}
+
+// KDKMatch is a kernelcache entry and the KDK binary with the same UUID
+type KDKMatch struct {
+	Entry   string `json:"entry,omitempty"`
+	UUID    string `json:"uuid"`
+	Path    string `json:"path"`
+	DSYM    string `json:"dsym,omitempty"`
+	Symbols int    `json:"symbols"`
+}
+
+// KDKSymbols are the symbols of a Kernel Debug Kit that match a kernelcache
+type KDKSymbols struct {
+	KDK       string      `json:"kdk"`
+	Matches   []KDKMatch  `json:"matches"`
+	Unmatched []string    `json:"unmatched,omitempty"` // entries without a binary in the KDK
+	Symbols   []KDKSymbol `json:"symbols"`
+}
+
+// Map returns the symbols as an address to name map
+func (k *KDKSymbols) Map() map[uint64]string {
+	smap := make(map[uint64]string, len(k.Symbols))
+	for _, sym := range k.Symbols {
+		smap[sym.Addr] = sym.Name
+	}
+	return smap
+}
+
+// KDKConfig is the config for ApplyKDK
+type KDKConfig struct {
+	KDKs  []string // the KDK folders to search (defaults to the KDKs installed in KDKsPath)
+	Types bool     // also transfer the DWARF types in the KDK's dSYMs (slow)
+}
+
+// openThinOrFat returns the MachO (or every slice of a universal MachO) at path
+func openThinOrFat(path string) ([]*macho.File, io.Closer, error) {
+	fat, err := macho.OpenFat(path)
+	if err == nil {
+		var ms []*macho.File
+		for _, arch := range fat.Arches {
+			ms = append(ms, arch.File)
+		}
+		return ms, fat, nil
+	}
+	if !errors.Is(err, macho.ErrNotFat) {
+		return nil, nil, err
+	}
+	m, err := macho.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []*macho.File{m}, m, nil
+}
+
+// machoUUIDs returns the UUIDs of the MachO (or of every slice of a universal MachO) at path
+func machoUUIDs(path string) ([]string, error) {
+	ms, closer, err := openThinOrFat(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var uuids []string
+	for _, m := range ms {
+		if uuid := m.UUID(); uuid != nil {
+			uuids = append(uuids, strings.ToUpper(uuid.UUID.String()))
+		}
+	}
+	return uuids, nil
+}
+
+func defaultKDKs() []string {
+	kdks, _ := filepath.Glob(filepath.Join(KDKsPath, "*.kdk"))
+	return kdks
+}
+
+// FindKDK returns the KDK folder whose kernel has the UUID
+func FindKDK(uuid string, kdks ...string) (string, error) {
+	if len(kdks) == 0 {
+		kdks = defaultKDKs()
+	}
+	uuid = strings.ToUpper(uuid)
+	for _, kdk := range kdks {
+		kernels, err := filepath.Glob(filepath.Join(kdk, "System/Library/Kernels/kernel*"))
+		if err != nil {
+			continue
+		}
+		for _, kernel := range kernels {
+			if strings.HasSuffix(kernel, ".dSYM") {
+				continue
+			}
+			uuids, err := machoUUIDs(kernel)
+			if err != nil {
+				log.WithError(err).Debugf("failed to read KDK kernel %s", kernel)
+				continue
+			}
+			for _, u := range uuids {
+				if u == uuid {
+					return kdk, nil
+				}
+			}
+		}
+	}
+	return "", errcode.Errorf(errcode.NotFound, "failed to find a KDK with a kernel with UUID %s (install the matching KDK with `ipsw dl kdk`)", uuid)
+}
+
+// kdkBinaries returns the kernels and kext executables of the KDK by UUID
+func kdkBinaries(kdk string) (map[string]string, error) {
+	bins := make(map[string]string)
+	for _, dir := range []string{"System/Library/Kernels", "System/Library/Extensions"} {
+		root := filepath.Join(kdk, dir)
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if strings.HasSuffix(d.Name(), ".dSYM") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || (dir == "System/Library/Extensions" && filepath.Base(filepath.Dir(path)) != "MacOS") {
+				return nil
+			}
+			uuids, err := machoUUIDs(path)
+			if err != nil {
+				return nil // not a MachO
+			}
+			for _, uuid := range uuids {
+				bins[uuid] = path
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %v", root, err)
+		}
+	}
+	return bins, nil
+}
+
+// kdkDSYM returns the DWARF file of the KDK binary's dSYM (or "" if it doesn't have one)
+func kdkDSYM(path string) string {
+	bundle := path // kernels: kernel.release.t6000.dSYM
+	if filepath.Base(filepath.Dir(path)) == "MacOS" {
+		bundle = filepath.Dir(filepath.Dir(filepath.Dir(path))) // kexts: Foo.kext.dSYM
+	}
+	dsym := filepath.Join(bundle+".dSYM", "Contents/Resources/DWARF", filepath.Base(path))
+	if _, err := os.Stat(dsym); err != nil {
+		return ""
+	}
+	return dsym
+}
+
+// kdkSlice returns the slice of the KDK binary with the UUID
+func kdkSlice(path, uuid string) (*macho.File, io.Closer, error) {
+	ms, closer, err := openThinOrFat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range ms {
+		if u := m.UUID(); u != nil && strings.EqualFold(u.UUID.String(), uuid) {
+			return m, closer, nil
+		}
+	}
+	closer.Close()
+	return nil, nil, fmt.Errorf("%s has no slice with UUID %s", path, uuid)
+}
+
+// dwarfTypes returns the types of the functions and global variables in the dSYM by (KDK) address
+func dwarfTypes(dsym, uuid string) (map[uint64]string, error) {
+	m, closer, err := kdkSlice(dsym, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	df, err := m.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s DWARF: %v", dsym, err)
+	}
+
+	typs := make(map[uint64]string)
+	r := df.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil || entry == nil {
+			break
+		}
+		var addr uint64
+		switch entry.Tag {
+		case dwf.TagSubprogram:
+			lowpc, ok := entry.Val(dwf.AttrLowpc).(uint64)
+			if !ok {
+				continue
+			}
+			addr = lowpc
+			if typ, err := df.Type(entry.Offset); err == nil {
+				typs[addr] = typ.String()
+			}
+		case dwf.TagVariable:
+			loc, ok := entry.Val(dwf.AttrLocation).([]byte)
+			if !ok || len(loc) != 9 || loc[0] != 0x03 { // DW_OP_addr
+				continue
+			}
+			addr = binary.LittleEndian.Uint64(loc[1:])
+			if off, ok := entry.Val(dwf.AttrType).(dwf.Offset); ok {
+				if typ, err := df.Type(off); err == nil {
+					typs[addr] = typ.String()
+				}
+			}
+		}
+	}
+	return typs, nil
+}
+
+// transferSymbols moves the symbols of the KDK binary to the segments of the kernelcache entry with the same names
+func transferSymbols(entry string, kdk, kc *macho.File, typs map[uint64]string) []KDKSymbol {
+	if kdk.Symtab == nil {
+		return nil
+	}
+	var syms []KDKSymbol
+	for _, sym := range kdk.Symtab.Syms {
+		if sym.Sect == 0 || int(sym.Sect) > len(kdk.Sections) || sym.Type.IsDebugSym() || sym.Type.IsUndefinedSym() || len(sym.Name) == 0 {
+			continue
+		}
+		sec := kdk.Sections[sym.Sect-1]
+		kdkSeg := kdk.Segment(sec.Seg)
+		kcSeg := kc.Segment(sec.Seg)
+		if kdkSeg == nil || kcSeg == nil || sym.Value < kdkSeg.Addr || sym.Value-kdkSeg.Addr >= kcSeg.Memsz {
+			continue
+		}
+		ks := KDKSymbol{
+			Entry: entry,
+			Name:  sym.Name,
+			Addr:  kcSeg.Addr + (sym.Value - kdkSeg.Addr),
+			Kind:  "data",
+			Type:  typs[sym.Value],
+		}
+		if sec.Flags.IsPureInstructions() {
+			ks.Kind = "func"
+		}
+		syms = append(syms, ks)
+	}
+	return syms
+}
+
+// ApplyKDK matches the kernel and kexts of a matching Kernel Debug Kit to the (stripped) kernelcache by UUID and
+// returns their symbols (and optionally DWARF types) at their kernelcache addresses
+func ApplyKDK(m *macho.File, conf *KDKConfig) (*KDKSymbols, error) {
+	return ApplyKDKContext(context.Background(), m, conf)
+}
+
+// ApplyKDKContext is like ApplyKDK but stops (returning ctx.Err()) once the context is done
+func ApplyKDKContext(ctx context.Context, m *macho.File, conf *KDKConfig) (*KDKSymbols, error) {
+	if conf == nil {
+		conf = &KDKConfig{}
+	}
+
+	type kcEntry struct {
+		id string
+		m  *macho.File
+	}
+	entries := []kcEntry{{m: m}}
+	kernel := m
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		entries = nil
+		for _, fe := range m.FileSets() {
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			if fe.EntryID == "com.apple.kernel" {
+				kernel = mfe
+			}
+			entries = append(entries, kcEntry{id: fe.EntryID, m: mfe})
+		}
+	}
+	kuuid := kernel.UUID()
+	if kuuid == nil {
+		return nil, fmt.Errorf("kernel has no LC_UUID")
+	}
+
+	kdk, err := FindKDK(kuuid.UUID.String(), conf.KDKs...)
+	if err != nil {
+		return nil, err
+	}
+	bins, err := kdkBinaries(kdk)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &KDKSymbols{KDK: kdk}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		uuid := e.m.UUID()
+		if uuid == nil {
+			ks.Unmatched = append(ks.Unmatched, e.id)
+			continue
+		}
+		path, ok := bins[strings.ToUpper(uuid.UUID.String())]
+		if !ok {
+			ks.Unmatched = append(ks.Unmatched, e.id)
+			continue
+		}
+		match := KDKMatch{Entry: e.id, UUID: uuid.UUID.String(), Path: path, DSYM: kdkDSYM(path)}
+
+		kdkm, closer, err := kdkSlice(path, match.UUID)
+		if err != nil {
+			return nil, err
+		}
+		src, srcCloser := kdkm, closer
+		if (src.Symtab == nil || len(src.Symtab.Syms) == 0) && len(match.DSYM) > 0 {
+			if dm, dcloser, err := kdkSlice(match.DSYM, match.UUID); err == nil {
+				closer.Close()
+				src, srcCloser = dm, dcloser
+			}
+		}
+		var typs map[uint64]string
+		if conf.Types && len(match.DSYM) > 0 {
+			if typs, err = dwarfTypes(match.DSYM, match.UUID); err != nil {
+				log.WithError(err).Warnf("failed to read DWARF types of %s", match.DSYM)
+			}
+		}
+		syms := transferSymbols(e.id, src, e.m, typs)
+		srcCloser.Close()
+
+		match.Symbols = len(syms)
+		ks.Matches = append(ks.Matches, match)
+		ks.Symbols = append(ks.Symbols, syms...)
+	}
+
+	sort.Slice(ks.Symbols, func(i, j int) bool { return ks.Symbols[i].Addr < ks.Symbols[j].Addr })
+
+	return ks, nil
+}
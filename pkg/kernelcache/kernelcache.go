@@ -1,10 +1,21 @@
+// Package kernelcache parses and analyzes (fileset and prelinked) XNU kernelcaches
+//
+// The package keeps no mutable package state so any number of kernelcaches can be analyzed concurrently (e.g. by
+// the daemon's workers). The analyses (GetVersion, GetKexts, GetSysctls etc.) only read the *macho.File they are
+// given and return new values, so they are safe to run in parallel on different files; DecompressedPath and
+// Extract write to unique temp files and are safe to call concurrently even on the same input. The long running
+// ones (Open, GetKexts, GetSysctls, GetSandboxOpts, FindMigSubsystems, ApplyKDK etc.) have
+// Context variants that stop (returning ctx.Err()) once their context is done.
 package kernelcache
 
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/asn1"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -18,14 +29,30 @@ import (
 	// lzfse "github.com/blacktop/go-lzfse"
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/telemetry"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/errcode"
 	"github.com/blacktop/ipsw/pkg/img4"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/blacktop/ipsw/pkg/lzfse"
+	lzfsecgo "github.com/blacktop/lzfse-cgo"
 	"github.com/blacktop/lzss"
 	"github.com/pkg/errors"
 )
 
+var (
+	// ErrNotKernelcache is returned when the input is not a (fileset) kernelcache or an IM4P containing one
+	ErrNotKernelcache = errcode.New(errcode.NotKernelcache, "not a kernelcache")
+	// ErrEncrypted is returned when the kernelcache payload is encrypted
+	ErrEncrypted = errcode.New(errcode.Encrypted, "kernelcache is encrypted")
+	// ErrMissingSection is returned when a section required by an analysis is not in the kernelcache
+	ErrMissingSection = errcode.New(errcode.MissingSection, "kernelcache section not found")
+
+	// the version strings GetVersion parses (compiled once as regexps are safe for concurrent use)
+	reKV   = regexp.MustCompile(`^Darwin Kernel Version (?P<darwin>.+): (?P<date>.+); root:(?P<build>xnu.*-(?P<xnu>.+)/(?P<type>.+)_(?P<arch>.+)_(?P<cpu>.+))$`)
+	reLLVM = regexp.MustCompile(`^Apple LLVM (?P<version>.+) \(clang-(?P<clang>.+)\) \[(?P<flags>.+)\]$`)
+)
+
 // Im4p Kernelcache object
 type Im4p struct {
 	IM4P    string
@@ -57,6 +84,21 @@ type KernelVersion struct {
 	Arch string `json:"arch,omitempty"`
 	// The kernel CPU
 	CPU string `json:"cpu,omitempty"`
+	// The build string (e.g. xnu-10002.1.13~1/RELEASE_ARM64_T8103)
+	Build string `json:"build,omitempty"`
+}
+
+// KernelFeatures represents what the kernel was built for.
+// swagger:model
+type KernelFeatures struct {
+	// The kernel CPU subtype (e.g. arm64e)
+	CPUSubtype string `json:"cpu_subtype,omitempty"`
+	// The kernel uses pointer authentication (arm64e)
+	PAC bool `json:"pac"`
+	// The kernel has a KTRR/CTRR protected read-only region (__LAST/__LASTDATA_CONST)
+	KTRR bool `json:"ktrr"`
+	// The kernelcache is a MH_FILESET
+	Fileset bool `json:"fileset"`
 }
 
 // LLVMVersion represents the LLVM version used to compile the kernel.
@@ -77,6 +119,7 @@ type Version struct {
 	KernelVersion `json:"kernel,omitempty"`
 	// swagger:allOf
 	LLVMVersion `json:"llvm,omitempty"`
+	Features    KernelFeatures `json:"features"`
 	rawKernel   string
 	rawLLVM     string
 }
@@ -98,7 +141,7 @@ func ParseImg4Data(data []byte) (*CompressedCache, error) {
 
 	var i Im4p
 	if _, err := asn1.Unmarshal(data, &i); err != nil {
-		return nil, errors.Wrap(err, "failed to ASN.1 parse kernelcache")
+		return nil, errcode.Errorf(errcode.NotKernelcache, "failed to ASN.1 parse kernelcache: %w", err)
 	}
 
 	cc := CompressedCache{
@@ -224,7 +267,7 @@ func DecompressKernelManagementData(kcache string) ([]byte, error) {
 func DecompressData(cc *CompressedCache) ([]byte, error) {
 	utils.Indent(log.Debug, 2)("Decompressing Kernelcache")
 
-	if bytes.Contains(cc.Magic, []byte("bvx2")) { // LZFSE
+	if bytes.HasPrefix(cc.Magic, []byte("bvx")) { // LZFSE (bvx2, bvx1, bvxn or bvx- blocks)
 		utils.Indent(log.Debug, 3)("Kernelcache is LZFSE compressed")
 
 		// dat := lzfse.DecodeBuffer(cc.Data)
@@ -237,7 +280,11 @@ func DecompressData(cc *CompressedCache) ([]byte, error) {
 
 		dat, err := lzfse.NewDecoder(cc.Data).DecodeBuffer()
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to lzfse decompress kernelcache")
+			// the native decoder only supports bvx1/bvx2 blocks so fall back to the reference decoder (LZVN and raw blocks)
+			utils.Indent(log.Debug, 3)(fmt.Sprintf("Falling back to the reference LZFSE decoder: %v", err))
+			if dat = lzfsecgo.DecodeBuffer(cc.Data); len(dat) == 0 {
+				return nil, errors.Wrap(err, "failed to lzfse decompress kernelcache")
+			}
 		}
 
 		// check if kernelcache is fat/universal
@@ -289,7 +336,136 @@ func DecompressData(cc *CompressedCache) ([]byte, error) {
 		return cc.Data, nil
 	}
 
-	return []byte{}, errors.New("unsupported compression (possibly encrypted)")
+	return []byte{}, errcode.Errorf(errcode.Encrypted, "unsupported compression (possibly encrypted)")
+}
+
+// isMachO returns true if the data starts with a (thin or fat) MachO magic
+func isMachO(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	switch types.Magic(binary.LittleEndian.Uint32(data)) {
+	case types.Magic32, types.Magic64:
+		return true
+	}
+	return types.Magic(binary.BigEndian.Uint32(data)) == types.MagicFat
+}
+
+// DecompressedPath returns the path of the raw kernelcache MachO for kcache
+//
+// IM4P/IMG4 wrapped and LZSS/LZFSE compressed kernelcaches are decompressed once into the user's cache folder
+// (keyed by the file's hash so later calls reuse it) and raw MachOs are returned as is
+func DecompressedPath(kcache string) (string, error) {
+	f, err := os.Open(kcache)
+	if err != nil {
+		return "", fmt.Errorf("failed to open kernelcache: %v", err)
+	}
+	hdr := make([]byte, 4)
+	_, err = io.ReadFull(f, hdr)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read kernelcache magic: %v", err)
+	}
+	if isMachO(hdr) {
+		return kcache, nil
+	}
+
+	data, err := os.ReadFile(kcache)
+	if err != nil {
+		return "", fmt.Errorf("failed to read kernelcache: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	decPath := filepath.Join(cacheDir, "ipsw", "kernelcache", hex.EncodeToString(sum[:8]), filepath.Base(kcache)+".decompressed")
+	if _, err := os.Stat(decPath); err == nil {
+		utils.Indent(log.Debug, 2)("Using cached decompressed kernelcache " + decPath)
+		telemetry.CacheLookup("kernelcache_decompressed", true)
+		return decPath, nil
+	}
+	telemetry.CacheLookup("kernelcache_decompressed", false)
+	defer telemetry.Phase("kernelcache.decompress")()
+	telemetry.AddBytes("kernelcache.decompress", int64(len(data)))
+
+	payload := data
+	if km, err := img4.ParseImg4(bytes.NewReader(data)); err == nil { // KernelManagement kernelcache
+		if im4p, err := img4.ParseIm4p(bytes.NewReader(km.IM4P.Raw)); err == nil {
+			if err := im4p.CheckEncrypted(filepath.Base(kcache)); err != nil {
+				return "", err
+			}
+		}
+		payload = km.IM4P.Data
+	} else if im4p, err := img4.ParseIm4p(bytes.NewReader(data)); err == nil {
+		if err := im4p.CheckEncrypted(filepath.Base(kcache)); err != nil {
+			return "", err
+		}
+		payload = im4p.Data
+	}
+	if len(payload) < 8 {
+		return "", ErrNotKernelcache
+	}
+	dec, err := DecompressData(&CompressedCache{
+		Magic: payload[:4],
+		Size:  len(payload),
+		Data:  payload,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress kernelcache %s: %w", kcache, err)
+	}
+	if !isMachO(dec) {
+		return "", ErrNotKernelcache
+	}
+
+	if err := os.MkdirAll(filepath.Dir(decPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create kernelcache cache folder: %v", err)
+	}
+	// write to a unique temp file so concurrent decompressions of the same kernelcache don't clobber each other
+	tmp, err := os.CreateTemp(filepath.Dir(decPath), filepath.Base(decPath)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create decompressed kernelcache: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(dec); err != nil || tmp.Chmod(0660) != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write decompressed kernelcache: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write decompressed kernelcache: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), decPath); err != nil {
+		return "", fmt.Errorf("failed to write decompressed kernelcache: %v", err)
+	}
+	utils.Indent(log.Debug, 2)("Decompressed kernelcache to " + decPath)
+	return decPath, nil
+}
+
+// Open opens a kernelcache as a MachO; the kernelcache.release.* files of an IPSW (IM4P/IMG4 wrapped and LZSS/LZFSE
+// compressed) are transparently unwrapped and decompressed (see DecompressedPath) and raw MachOs are opened as is
+func Open(path string) (*macho.File, error) {
+	return OpenContext(context.Background(), path)
+}
+
+// OpenContext is like Open but returns ctx.Err() if the context is done before the kernelcache is opened
+//
+// NOTE: a decompression that is already running is not interrupted (the context is checked before and after it)
+func OpenContext(ctx context.Context, path string) (*macho.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	machoPath, err := DecompressedPath(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m, err := macho.Open(machoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kernelcache %s: %w", path, err)
+	}
+	return m, nil
 }
 
 // Extract extracts and decompresses a kernelcache from ipsw
@@ -401,6 +577,7 @@ func RemoteParse(zr *zip.Reader, destPath, device string) (map[string][]string,
 	return artifacts, nil
 }
 
+// GetVersion returns the kernel's version (parsed from its version string) and build info (from its load commands)
 func GetVersion(m *macho.File) (*Version, error) {
 	var kv Version
 
@@ -410,7 +587,7 @@ func GetVersion(m *macho.File) (*Version, error) {
 		var err error
 		kc, err = m.GetFileSetFileByName("kernel")
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse fileset entry 'kernel': %v", err)
+			return nil, errcode.Errorf(errcode.NotKernelcache, "failed to parse fileset entry 'kernel': %v", err)
 		}
 	}
 
@@ -440,7 +617,6 @@ func GetVersion(m *macho.File) (*Version, error) {
 
 			if len(s) > 0 {
 				if utils.IsASCII(s) {
-					reKV := regexp.MustCompile(`^Darwin Kernel Version (?P<darwin>.+): (?P<date>.+); root:xnu.*-(?P<xnu>.+)/(?P<type>.+)_(?P<arch>.+)_(?P<cpu>.+)$`)
 					if reKV.MatchString(s) {
 						foundKV = true
 						kv.rawKernel = s
@@ -455,9 +631,9 @@ func GetVersion(m *macho.File) (*Version, error) {
 						kv.KernelVersion.Type = matches[reKV.SubexpIndex("type")]
 						kv.KernelVersion.Arch = matches[reKV.SubexpIndex("arch")]
 						kv.KernelVersion.CPU = matches[reKV.SubexpIndex("cpu")]
+						kv.KernelVersion.Build = matches[reKV.SubexpIndex("build")]
 					}
 
-					reLLVM := regexp.MustCompile(`^Apple LLVM (?P<version>.+) \(clang-(?P<clang>.+)\) \[(?P<flags>.+)\]$`)
 					if reLLVM.MatchString(s) {
 						foundLLVM = true
 						kv.rawLLVM = s
@@ -474,7 +650,14 @@ func GetVersion(m *macho.File) (*Version, error) {
 			}
 		}
 	} else {
-		return nil, fmt.Errorf("section __TEXT.__const not found in kernelcache (if this is a macOS kernel you might need to first extract the fileset entry)")
+		return nil, errcode.Errorf(errcode.MissingSection, "section __TEXT.__const not found in kernelcache (if this is a macOS kernel you might need to first extract the fileset entry)")
+	}
+
+	kv.Features = KernelFeatures{
+		CPUSubtype: kc.SubCPU.String(kc.CPU),
+		PAC:        kc.CPU == types.CPUArm64 && kc.SubCPU&types.CpuSubtypeMask == types.CPUSubtypeArm64E,
+		KTRR:       kc.Segment("__LAST") != nil || kc.Segment("__LASTDATA_CONST") != nil,
+		Fileset:    m.FileTOC.FileHeader.Type == types.MH_FILESET,
 	}
 
 	return &kv, nil
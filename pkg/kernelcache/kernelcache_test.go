@@ -0,0 +1,738 @@
+package kernelcache_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/fixture"
+	"github.com/blacktop/ipsw/pkg/img4"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+)
+
+func TestKernelcache(t *testing.T) {
+	kc := fixture.NewKernelcache()
+	kc.Symbols = []string{"_panic"}
+	kc.AddKext("com.apple.driver.FakeDriver", "1.0.0", "_fake_start")
+	kc.AddKext("com.apple.iokit.IOFakeFamily", "2.0.0")
+	kc.SymbolSets = []fixture.SymbolSet{{ID: "com.apple.kpi.bsd", Version: "23.0.0", Symbols: []string{"_proc_pid", "_proc_name"}}}
+
+	path := filepath.Join(t.TempDir(), "kernelcache")
+	if err := kc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	m, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	kv, err := kernelcache.GetVersion(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.KernelVersion.Darwin != "23.0.0" || kv.KernelVersion.XNU != "10002.1.13~1" || kv.KernelVersion.CPU != "T8103" {
+		t.Errorf("GetVersion() = %+v", kv.KernelVersion)
+	}
+	if kv.KernelVersion.Build != "xnu-10002.1.13~1/RELEASE_ARM64_T8103" || !kv.Features.PAC || !kv.Features.Fileset {
+		t.Errorf("GetVersion() build = %q, features = %+v", kv.KernelVersion.Build, kv.Features)
+	}
+
+	kexts, err := kernelcache.GetKexts(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kexts) != 2 || kexts[0].ID != "com.apple.driver.FakeDriver" || kexts[1].Version != "2.0.0" {
+		t.Errorf("GetKexts() = %+v", kexts)
+	}
+	if kexts[0].LoadAddr == 0 || kexts[0].Size == 0 {
+		t.Errorf("GetKexts() didn't get %s's load address and size: %+v", kexts[0].ID, kexts[0])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := kernelcache.GetKextsContext(ctx, m); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetKextsContext(canceled) = %v, want context.Canceled", err)
+	}
+	if _, err := kernelcache.OpenContext(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenContext(canceled) = %v, want context.Canceled", err)
+	}
+
+	kext, err := m.GetFileSetFileByName("com.apple.driver.FakeDriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kext.FindSymbolAddress("_fake_start"); err != nil {
+		t.Error(err)
+	}
+
+	deps := fixture.NewKernelcache()
+	deps.Kexts = []fixture.Kext{
+		{ID: "com.apple.iokit.IOFakeFamily", Version: "2.0.0", CompatibleVersion: "1.0.0"},
+		{ID: "com.apple.driver.FakeDriver", Version: "1.0.0", Libraries: map[string]string{
+			"com.apple.iokit.IOFakeFamily": "2.1", // newer than the provider
+			"com.apple.kpi.missing":        "1.0",
+		}},
+		{ID: "com.apple.driver.A", Version: "1.0.0", CompatibleVersion: "1.0.0", Libraries: map[string]string{"com.apple.driver.B": "1.0.0"}},
+		{ID: "com.apple.driver.B", Version: "1.0.0", CompatibleVersion: "1.0.0", Libraries: map[string]string{
+			"com.apple.driver.A":           "1.0.0",
+			"com.apple.iokit.IOFakeFamily": "1.5.0d3",
+		}},
+	}
+	depsPath := filepath.Join(t.TempDir(), "kernelcache.deps")
+	if err := deps.WriteFile(depsPath); err != nil {
+		t.Fatal(err)
+	}
+	dm, err := macho.Open(depsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	graph, err := kernelcache.KextDependencyGraph(dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Edges) != 5 || len(graph.Mismatches()) != 1 || graph.Mismatches()[0].From != "com.apple.driver.FakeDriver" {
+		t.Errorf("KextDependencyGraph() edges = %+v", graph.Edges)
+	}
+	if len(graph.Cycles) != 1 || !slices.Equal(graph.Cycles[0], []string{"com.apple.driver.A", "com.apple.driver.B"}) {
+		t.Errorf("KextDependencyGraph() cycles = %v", graph.Cycles)
+	}
+	var dot, mermaid bytes.Buffer
+	if err := graph.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot.String(), `"com.apple.driver.FakeDriver" -> "com.apple.kpi.missing" [style=dashed color=red label="1.0"];`) {
+		t.Errorf("WriteDOT() =\n%s", dot.String())
+	}
+	if err := graph.WriteMermaid(&mermaid); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mermaid.String(), "graph LR\n") || !strings.Contains(mermaid.String(), "linkStyle") {
+		t.Errorf("WriteMermaid() =\n%s", mermaid.String())
+	}
+
+	infos, err := kernelcache.GetKextInfos(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || !strings.HasPrefix(string(infos[1].Name[:]), "com.apple.iokit.IOFakeFamily\x00") || infos[1].Address == 0 || infos[1].Size == 0 {
+		t.Errorf("GetKextInfos() = %+v", infos)
+	}
+
+	sets, err := kernelcache.GetSymbolSets(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 1 || sets[0].ID != "com.apple.kpi.bsd" || !sets[0].Exports("_proc_pid") || sets[0].Exports("_panic") {
+		t.Errorf("GetSymbolSets() = %+v", sets)
+	}
+	next := []kernelcache.SymbolSet{{ID: "com.apple.kpi.bsd", Symbols: []string{"_proc_pid", "_proc_selfpid"}}}
+	if diffs := kernelcache.DiffSymbolSets(sets, next); len(diffs) != 1 ||
+		!slices.Equal(diffs[0].New, []string{"_proc_selfpid"}) || !slices.Equal(diffs[0].Removed, []string{"_proc_name"}) {
+		t.Errorf("DiffSymbolSets() = %+v", diffs)
+	}
+	linkages, err := kernelcache.GetKextLinkage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(linkages) != 2 || linkages[0].ID != "com.apple.driver.FakeDriver" || !slices.Contains(linkages[0].Exports, "_fake_start") {
+		t.Errorf("GetKextLinkage() = %+v", linkages)
+	}
+
+	regions, err := kernelcache.GetProtectedRegions(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions.Ranges) != 2 || regions.Ranges[0].Name != "ro" || regions.Ranges[1].Name != "text" {
+		t.Errorf("GetProtectedRegions() ranges = %+v", regions.Ranges)
+	}
+	for _, seg := range regions.Segments {
+		if seg.Entry == "com.apple.kernel" && seg.Name == "__LAST" && !slices.Contains(seg.Protected, "ro") {
+			t.Errorf("kernel __LAST isn't protected: %+v", seg)
+		}
+		if seg.Writable() {
+			t.Errorf("writable segment in a protected range: %+v", seg)
+		}
+	}
+
+	outDir := t.TempDir()
+	if err := kernelcache.ExtractKexts(path, outDir, []string{"FakeDriver"}); err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := macho.Open(filepath.Join(outDir, "com.apple.driver.FakeDriver.kext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer extracted.Close()
+	if _, err := extracted.FindSymbolAddress("_fake_start"); err != nil {
+		t.Errorf("extracted kext: %v", err)
+	}
+}
+
+func TestExtractKextsEntryID(t *testing.T) {
+	for _, id := range []string{"../../com.apple.driver.Escape", "com.apple/driver.Nested", ".."} {
+		t.Run(id, func(t *testing.T) {
+			kc := fixture.NewKernelcache()
+			kc.AddKext(id, "1.0.0", "_escape_start")
+			path := filepath.Join(t.TempDir(), "kernelcache")
+			if err := kc.WriteFile(path); err != nil {
+				t.Fatal(err)
+			}
+			outDir := filepath.Join(t.TempDir(), "a", "b")
+			if err := os.MkdirAll(outDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := kernelcache.ExtractKexts(path, outDir, []string{id}); errcode.Of(err) != errcode.InvalidFormat {
+				t.Errorf("ExtractKexts(%q) = %v, want an InvalidFormat error", id, err)
+			}
+			if _, err := os.Stat(filepath.Join(outDir, "..", "..", "com.apple.driver.Escape.kext")); err == nil {
+				t.Errorf("ExtractKexts(%q) wrote outside of the output directory", id)
+			}
+		})
+	}
+}
+
+func TestSandboxOpts(t *testing.T) {
+	const base = 0xfffffff007004000
+	strs := "junk\x00default\x00file-read*\x00mach-lookup\x00"
+	offs := []uint64{5, 13, 24} // default, file-read*, mach-lookup
+
+	build := func(symbol bool) *macho.File {
+		t.Helper()
+		m := fixture.NewMachO(types.MH_EXECUTE)
+		cstr := m.Segments[0].AddSection("__cstring", []byte(strs))
+		cnst := m.AddSegment("__DATA_CONST", types.VmProtection(1)).AddSection("__const", make([]byte, 7*8))
+		if symbol {
+			m.AddSymbol("_operation_names", "__DATA_CONST", "__const", 0)
+		}
+		if _, err := m.Bytes(base); err != nil { // lay out the sections so the pointers can be filled in
+			t.Fatal(err)
+		}
+		// a 2 operation table followed by the real 3 operation table
+		for i, off := range []uint64{offs[0], offs[1], 0, offs[0], offs[1], offs[2], 0} {
+			if off != 0 {
+				binary.LittleEndian.PutUint64(cnst.Data[i*8:], cstr.Addr()+off)
+			}
+		}
+		path := filepath.Join(t.TempDir(), "kernelcache")
+		if err := m.WriteFile(path, base); err != nil {
+			t.Fatal(err)
+		}
+		f, err := macho.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	ops, err := kernelcache.GetSandboxOpts(build(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []kernelcache.SandboxOperation{
+		{Index: 0, Name: "default", Category: "default"},
+		{Index: 1, Name: "file-read*", Category: "file"},
+		{Index: 2, Name: "mach-lookup", Category: "mach"},
+	}
+	if !slices.Equal(ops, want) {
+		t.Errorf("GetSandboxOpts() = %+v, want %+v", ops, want)
+	}
+
+	// the exported table wins over the longest table
+	if ops, err := kernelcache.GetSandboxOpts(build(true)); err != nil || len(ops) != 2 {
+		t.Errorf("GetSandboxOpts(_operation_names) = %+v, %v", ops, err)
+	}
+}
+
+func TestAMFI(t *testing.T) {
+	const base = 0xfffffff007004000
+	strs := "junk\x00com.apple.private.security.no-sandbox\x00com.apple.rootless.install\x00"
+	hash := func(seed byte) []byte {
+		h := make([]byte, 20)
+		for i := range h {
+			h[i] = seed + byte(i)*7 + 1
+		}
+		return h
+	}
+
+	// a version 2 trust cache with 2 entries followed by 3 hardcoded CDHashes
+	tc := binary.LittleEndian.AppendUint32(nil, 2)
+	tc = append(tc, bytes.Repeat([]byte{0xaa}, 16)...)
+	tc = binary.LittleEndian.AppendUint32(tc, 2)
+	tc = append(append(tc, hash(0x10)...), 2, 1, 3, 0)
+	tc = append(append(tc, hash(0x20)...), 2, 0, 0, 0)
+	tc = append(tc, make([]byte, 8)...)
+	for _, seed := range []byte{0x30, 0x40, 0x50} {
+		tc = append(tc, hash(seed)...)
+	}
+	tc = append(tc, make([]byte, 4)...)
+
+	m := fixture.NewMachO(types.MH_EXECUTE)
+	cstr := m.Segments[0].AddSection("__cstring", []byte(strs))
+	m.Segments[0].AddSection("__const", tc)
+	cnst := m.AddSegment("__DATA_CONST", types.VmProtection(1)).AddSection("__const", make([]byte, 3*8))
+	if _, err := m.Bytes(base); err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint64(cnst.Data[0:], cstr.Addr()+5)
+	binary.LittleEndian.PutUint64(cnst.Data[8:], cstr.Addr()+43)
+	path := filepath.Join(t.TempDir(), "kernelcache")
+	if err := m.WriteFile(path, base); err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	amfi, err := kernelcache.GetAMFI(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amfi.TrustCaches) != 1 {
+		t.Fatalf("GetAMFI() trust caches = %+v, want 1", amfi.TrustCaches)
+	}
+	want := []kernelcache.AMFITrustCacheEntry{
+		{CDHash: hex.EncodeToString(hash(0x10)), HashType: 2, Flags: 1, ConstraintCategory: 3},
+		{CDHash: hex.EncodeToString(hash(0x20)), HashType: 2},
+	}
+	if got := amfi.TrustCaches[0]; got.Version != 2 || !slices.Equal(got.Entries, want) {
+		t.Errorf("GetAMFI() trust cache = %+v, want %+v", got, want)
+	}
+	var ents, cdhashes []string
+	for _, al := range amfi.Allowlists {
+		switch al.Kind {
+		case kernelcache.AllowlistEntitlements:
+			ents = append(ents, al.Entries...)
+		case kernelcache.AllowlistCDHashes:
+			cdhashes = append(cdhashes, al.Entries...)
+		}
+	}
+	if want := []string{"com.apple.private.security.no-sandbox", "com.apple.rootless.install"}; !slices.Equal(ents, want) {
+		t.Errorf("GetAMFI() entitlements = %v, want %v", ents, want)
+	}
+	if len(cdhashes) != 3 || cdhashes[0] != hex.EncodeToString(hash(0x30)) {
+		t.Errorf("GetAMFI() cdhashes = %v", cdhashes)
+	}
+}
+
+func TestSysctls(t *testing.T) {
+	const base = 0xfffffff007004000
+	m := fixture.NewMachO(types.MH_EXECUTE)
+	cstr := m.Segments[0].AddSection("__cstring", []byte("kern\x00osversion\x00A\x00OS build\x00"))
+	data := m.AddSegment("__DATA", types.VmProtection(3))
+	oids := data.AddSection("__data", make([]byte, 2*80+2*16)) // 2 sysctl_oids and 2 sysctl_oid_lists
+	set := data.AddSection("__sysctl_set", make([]byte, 2*8))
+	if _, err := m.Bytes(base); err != nil {
+		t.Fatal(err)
+	}
+	root, kernChildren := oids.Addr()+160, oids.Addr()+176
+	oid := func(off int, parent uint64, kind uint32, arg1, name, format, descr uint64) {
+		d := oids.Data[off:]
+		binary.LittleEndian.PutUint64(d[0:], parent)
+		binary.LittleEndian.PutUint32(d[16:], 0xffffffff) // OID_AUTO
+		binary.LittleEndian.PutUint32(d[20:], kind)
+		binary.LittleEndian.PutUint64(d[24:], arg1)
+		binary.LittleEndian.PutUint64(d[40:], name)
+		binary.LittleEndian.PutUint64(d[48:], 0xfffffff007001234)
+		binary.LittleEndian.PutUint64(d[56:], format)
+		binary.LittleEndian.PutUint64(d[64:], descr)
+	}
+	// the child is declared before its parent node
+	oid(0, kernChildren, 0x80000000|0x00400000|0x00800000|3, 0, cstr.Addr()+5, cstr.Addr()+15, cstr.Addr()+17)
+	oid(80, root, 0x80000000|0x40000000|1, kernChildren, cstr.Addr(), cstr.Addr()+15, 0)
+	binary.LittleEndian.PutUint64(set.Data[0:], oids.Addr())
+	binary.LittleEndian.PutUint64(set.Data[8:], oids.Addr()+80)
+	path := filepath.Join(t.TempDir(), "kernelcache")
+	if err := m.WriteFile(path, base); err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sysctls, err := kernelcache.GetSysctls(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sysctls) != 1 || sysctls[0].Name != "kern" || sysctls[0].Type != "node" || sysctls[0].Perms != "rw" {
+		t.Fatalf("GetSysctls() roots = %+v, want the kern node", sysctls)
+	}
+	if len(sysctls[0].Children) != 1 {
+		t.Fatalf("GetSysctls() kern children = %+v, want 1", sysctls[0].Children)
+	}
+	got := sysctls[0].Children[0]
+	if got.Name != "kern.osversion" || got.Type != "string" || got.Perms != "r-" || got.Number != -1 ||
+		got.Description != "OS build" || got.Format != "A" || got.Handler != 0xfffffff007001234 || !slices.Equal(got.Flags, []string{"locked"}) {
+		t.Errorf("GetSysctls() kern.osversion = %+v", got)
+	}
+}
+
+func TestStructOffsets(t *testing.T) {
+	instrs := func(ins ...uint32) []byte {
+		var code []byte
+		for _, i := range ins {
+			code = binary.LittleEndian.AppendUint32(code, i)
+		}
+		return code
+	}
+	const (
+		pacibsp = 0xd503237f
+		retab   = 0xd65f0fff
+		ret     = 0xd65f03c0
+	)
+	kc := fixture.NewKernelcache()
+	kc.Kexts = append(kc.Kexts, fixture.Kext{
+		ID:      "com.apple.iokit.IOSurface",
+		Version: "1.0.0",
+		Functions: map[string][]byte{
+			"__ZNK9IOSurface12getAllocSizeEv": instrs(pacibsp, 0xf9402c00, retab), // ldr x0, [x0, #0x58]
+			"__ZNK9IOSurface8getWidthEv":      instrs(0xb9404000, ret),            // ldr w0, [x0, #0x40]
+			"__ZNK9IOSurface7getSeedEv":       instrs(0x94000000, ret),            // bl (not an accessor)
+			"_stripped":                       instrs(0x79400c00, ret),            // ldrh w0, [x0, #0x6]
+		},
+	})
+	path := filepath.Join(t.TempDir(), "kernelcache")
+	if err := kc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	m, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	mfe, err := m.GetFileSetFileByName("com.apple.iokit.IOSurface")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped, err := mfe.FindSymbolAddress("_stripped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offs, err := kernelcache.GetStructOffsets(m, &kernelcache.StructOffsetsConfig{
+		Kext:    "IOSurface",
+		Symbols: map[uint64]string{stripped: "__ZNK9IOSurface9getHeightEv"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offs.Version != kernelcache.StructOffsetsVersion || offs.Kernel != "23.0.0" {
+		t.Errorf("GetStructOffsets() version = %d, kernel = %q", offs.Version, offs.Kernel)
+	}
+	ios := offs.Structs["IOSurface"]
+	for field, want := range map[string]kernelcache.FieldOffset{
+		"allocSize": {Offset: 0x58, Size: 8, Access: "load", Source: "symtab"},
+		"width":     {Offset: 0x40, Size: 4, Access: "load", Source: "symtab"},
+		"height":    {Offset: 0x6, Size: 2, Access: "load", Source: "symbols"},
+	} {
+		got := ios[field]
+		if got.Offset != want.Offset || got.Size != want.Size || got.Access != want.Access || got.Source != want.Source || got.Kext != "com.apple.iokit.IOSurface" {
+			t.Errorf("IOSurface.%s = %+v, want %+v", field, got, want)
+		}
+	}
+	if len(offs.Structs) != 1 || len(ios) != 3 || !slices.Contains(offs.Missing, "IOSurface.seed") || slices.Contains(offs.Missing, "IOGPUResource.resourceID") {
+		t.Errorf("GetStructOffsets() structs = %v, missing = %v", offs.Structs, offs.Missing)
+	}
+}
+
+func TestKernelCollections(t *testing.T) {
+	bootID := bytes.Repeat([]byte{0xb0}, 16)
+	pageableID := bytes.Repeat([]byte{0x5c}, 16)
+	for _, tt := range []struct {
+		kind string
+		kc   *fixture.Kernelcache
+	}{
+		{kernelcache.KCBoot, fixture.NewKernelcache()},
+		{kernelcache.KCSystem, &fixture.Kernelcache{Base: fixture.DefaultKernelBase, NoKernel: true, BootKCID: bootID}},
+		{kernelcache.KCAux, &fixture.Kernelcache{Base: fixture.DefaultKernelBase, NoKernel: true, BootKCID: bootID, PageableKCID: pageableID}},
+	} {
+		tt.kc.AddKext("com.example.driver.Fake", "1.0.0", "_fake_start")
+		path := filepath.Join(t.TempDir(), tt.kind+".kc")
+		if err := tt.kc.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		m, err := macho.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+
+		kc, err := kernelcache.GetKernelCollection(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kc.Kind != tt.kind || kc.Kexts != 1 {
+			t.Errorf("GetKernelCollection() = %+v, want a %s KC with 1 kext", kc, tt.kind)
+		}
+		if tt.kind != kernelcache.KCBoot && kc.BootUUID != "B0B0B0B0-B0B0-B0B0-B0B0-B0B0B0B0B0B0" {
+			t.Errorf("GetKernelCollection() boot UUID = %q", kc.BootUUID)
+		}
+		kexts, err := kernelcache.GetKexts(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kexts) != 1 || kexts[0].LoadAddr == 0 {
+			t.Errorf("GetKexts() on %s KC = %+v", tt.kind, kexts)
+		}
+	}
+}
+
+func TestKDK(t *testing.T) {
+	kc := fixture.NewKernelcache()
+	kc.Symbols = []string{"_panic"}
+	kc.AddKext("com.apple.driver.FakeDriver", "1.0.0", "_fake_start", "_fake_stop")
+	path := filepath.Join(t.TempDir(), "kernelcache")
+	if err := kc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	m, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// a KDK with the unstripped kernel and kext (the kext linked at 0 like in a real KDK)
+	kdk := filepath.Join(t.TempDir(), "KDK_14.0_23A344.kdk")
+	binary := func(entry, path string, vmAddr uint64, typ types.HeaderFileType, symbols ...string) {
+		t.Helper()
+		mfe, err := m.GetFileSetFileByName(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := fixture.NewMachO(typ)
+		b.UUID = mfe.UUID().UUID
+		code := bytes.Repeat([]byte{0xc0, 0x03, 0x5f, 0xd6}, len(symbols))
+		b.AddSegment("__TEXT_EXEC", types.VmProtection(5)).AddSection("__text", code).Flags = types.SectionFlag(0x80000400)
+		for i, sym := range symbols {
+			b.AddSymbol(sym, "__TEXT_EXEC", "__text", uint64(i*4))
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.WriteFile(path, vmAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	binary("com.apple.kernel", filepath.Join(kdk, "System/Library/Kernels/kernel.release.t8103"), fixture.DefaultKernelBase, types.MH_EXECUTE, "_panic")
+	binary("com.apple.driver.FakeDriver", filepath.Join(kdk, "System/Library/Extensions/FakeDriver.kext/Contents/MacOS/FakeDriver"), 0, types.MH_KEXT_BUNDLE, "_FakeDriver_start", "_FakeDriver_stop")
+
+	ks, err := kernelcache.ApplyKDK(m, &kernelcache.KDKConfig{KDKs: []string{kdk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Matches) != 2 || len(ks.Unmatched) != 0 {
+		t.Errorf("ApplyKDK() matches = %+v, unmatched = %v", ks.Matches, ks.Unmatched)
+	}
+	kext, err := m.GetFileSetFileByName("com.apple.driver.FakeDriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop, err := kext.FindSymbolAddress("_fake_stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym := ks.Map()[stop]; sym != "_FakeDriver_stop" {
+		t.Errorf("ApplyKDK() symbol at %#x = %q; want _FakeDriver_stop", stop, sym)
+	}
+	for _, sym := range ks.Symbols {
+		if sym.Kind != "func" {
+			t.Errorf("ApplyKDK() symbol %s kind = %s; want func", sym.Name, sym.Kind)
+		}
+	}
+
+	if _, err := kernelcache.FindKDK("00000000-0000-0000-0000-000000000000", kdk); errcode.Of(err) != errcode.NotFound {
+		t.Errorf("FindKDK(bad UUID) = %v; want errcode.NotFound", err)
+	}
+}
+
+func TestIM4P(t *testing.T) {
+	kc, err := fixture.NewKernelcache().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := &fixture.IM4P{Type: "krnl", Description: "KernelCacheBuilder-fixture", Data: kc}
+	dat, err := im.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := img4.ParseIm4p(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Type != "krnl" || i.Description != im.Description {
+		t.Errorf("ParseIm4p() = %s/%s", i.Type, i.Description)
+	}
+
+	cc, err := kernelcache.ParseImg4Data(dat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := kernelcache.DecompressData(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, kc) {
+		t.Error("kernelcache payload mismatch")
+	}
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "kernelcache.release.iphone15")
+	if err := im.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	decPath, err := kernelcache.DecompressedPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dat, err := os.ReadFile(decPath); err != nil || !bytes.Equal(dat, kc) {
+		t.Errorf("DecompressedPath() = %s doesn't contain the kernelcache (%v)", decPath, err)
+	}
+	if again, _ := kernelcache.DecompressedPath(path); again != decPath {
+		t.Errorf("DecompressedPath() didn't reuse %s: %s", decPath, again)
+	}
+	if raw, _ := kernelcache.DecompressedPath(decPath); raw != decPath {
+		t.Errorf("DecompressedPath() of a raw kernelcache = %s", raw)
+	}
+
+	for _, compression := range []string{fixture.CompressLZSS, fixture.CompressLZFSE} {
+		path := filepath.Join(t.TempDir(), "kernelcache.release.iphone15")
+		if err := (&fixture.IM4P{Type: "krnl", Data: kc, Compression: compression}).WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		m, err := kernelcache.Open(path)
+		if err != nil {
+			t.Fatalf("Open() %s kernelcache: %v", compression, err)
+		}
+		if fe := m.FileSets(); len(fe) == 0 || fe[0].EntryID != "com.apple.kernel" {
+			t.Errorf("Open() %s kernelcache fileset entries = %v", compression, fe)
+		}
+		m.Close()
+	}
+
+	if _, err := (&fixture.IM4P{Type: "kernel"}).Bytes(); err == nil {
+		t.Error("expected error for invalid type")
+	}
+
+	iv, key := bytes.Repeat([]byte{0x11}, 16), bytes.Repeat([]byte{0x22}, 32)
+	enc := &fixture.IM4P{Type: "sepi", Description: "AppleSEPOS-fixture", Data: kc, Kbags: []fixture.KBAG{
+		{Type: 1, IV: iv, Key: key},
+		{Type: 2, IV: key[:16], Key: iv},
+	}}
+	encPath := filepath.Join(t.TempDir(), "sep-firmware.d83.RELEASE.im4p")
+	if err := enc.WriteFile(encPath); err != nil {
+		t.Fatal(err)
+	}
+	_, err = kernelcache.DecompressedPath(encPath)
+	var encErr *img4.EncryptedError
+	if !errors.As(err, &encErr) || !errors.Is(err, img4.ErrEncrypted) || errcode.Of(err) != errcode.Encrypted {
+		t.Fatalf("DecompressedPath() of an encrypted im4p = %v", err)
+	}
+	kbag := hex.EncodeToString(append(iv, key...))
+	if encErr.Type != "sepi" || len(encErr.Kbags) != 2 || encErr.Kbags[0].KBAG() != kbag || !strings.Contains(err.Error(), kbag) {
+		t.Errorf("EncryptedError = %+v", encErr)
+	}
+
+	i, err = img4.OpenIm4p(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := img4.KeyDB{"sep": {
+		Filename: []string{"iBoot.d83.RELEASE.im4p", "sep-firmware.d83.RELEASE.im4p"},
+		Key:      []string{"Unknown", hex.EncodeToString(key)},
+		Iv:       []string{"", hex.EncodeToString(iv)},
+		Kbag:     []string{"", strings.ToUpper(kbag)},
+	}}
+	if gotIV, gotKey, err := db.Lookup(i, encPath); err != nil || !bytes.Equal(gotIV, iv) || !bytes.Equal(gotKey, key) {
+		t.Errorf("KeyDB.Lookup() = %x, %x, %v", gotIV, gotKey, err)
+	}
+	delete(db, "sep")
+	if _, _, err := db.Lookup(i, encPath); !errors.Is(err, img4.ErrEncrypted) {
+		t.Errorf("KeyDB.Lookup() of a missing key = %v", err)
+	}
+}
+
+func TestHashes(t *testing.T) {
+	hashes := func(auth bool, check []byte) (*kernelcache.Hashes, []byte) {
+		t.Helper()
+		kc := fixture.NewKernelcache()
+		kc.Symbols = []string{"_panic"}
+		kc.Kexts = []fixture.Kext{
+			{ID: "com.apple.driver.FakeDriver", Version: "1.0.0", Symbols: []string{"_fake_start"}, Pointers: []string{"_fake_start"}},
+			{
+				ID: "com.apple.security.FakeSandbox", Version: "2.0.0", Symbols: []string{"_sb_start"},
+				Functions: map[string][]byte{"_sb_check": check},
+				Pointers:  []string{"_sb_start", "_sb_check"},
+			},
+		}
+		kc.AuthPointers = auth
+		dat, err := kc.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "kernelcache")
+		if err := os.WriteFile(path, dat, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := macho.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+		h, err := kernelcache.GetHashes(m)
+		if err != nil {
+			t.Fatalf("GetHashes() = %v", err)
+		}
+		return h, dat
+	}
+	ret0 := []byte{0x00, 0x00, 0x80, 0x52, 0xc0, 0x03, 0x5f, 0xd6} // mov w0, #0; ret
+	ret1 := []byte{0x20, 0x00, 0x80, 0x52, 0xc0, 0x03, 0x5f, 0xd6} // mov w0, #1; ret
+
+	prev, prevDat := hashes(false, ret0)
+	if len(prev.Kexts) != 3 || prev.Kexts[0].ID != "com.apple.driver.FakeDriver" {
+		t.Fatalf("GetHashes() kexts = %+v", prev.Kexts)
+	}
+	var fixups int
+	for _, seg := range prev.Segments {
+		fixups += seg.Fixups
+	}
+	if fixups != 3 {
+		t.Errorf("GetHashes() normalized %d fixups, want 3", fixups)
+	}
+
+	// only the chained fixup encoding of the pointers differs
+	next, nextDat := hashes(true, ret0)
+	if bytes.Equal(prevDat, nextDat) {
+		t.Fatal("signing the pointers didn't change the kernelcache")
+	}
+	if d := kernelcache.CompareHashes(prev, next); !d.Identical() {
+		t.Errorf("CompareHashes(auth pointers) = %+v, want identical", d)
+	}
+
+	// the code of a kext differs
+	next, _ = hashes(true, ret1)
+	d := kernelcache.CompareHashes(prev, next)
+	if d.Identical() || !slices.Equal(d.Kexts, []string{"com.apple.security.FakeSandbox"}) || !slices.Equal(d.Segments, []string{"__PRELINK_TEXT"}) {
+		t.Errorf("CompareHashes(code) = %+v, want com.apple.security.FakeSandbox's __PRELINK_TEXT", d)
+	}
+	if len(d.New) != 0 || len(d.Removed) != 0 {
+		t.Errorf("CompareHashes(code) new = %v, removed = %v", d.New, d.Removed)
+	}
+}
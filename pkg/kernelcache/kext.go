@@ -2,20 +2,24 @@ package kernelcache
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
-	"sort"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
-	"github.com/blacktop/go-macho/pkg/fixupchains"
+	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache/fixup"
 )
 
-const tagPtrMask = 0xffff000000000000
-
 type PrelinkInfo struct {
 	PrelinkInfoDictionary []CFBundle `plist:"_PrelinkInfoDictionary,omitempty" json:"prelink_info_dictionary,omitempty"`
+	// the UUIDs of a (macOS) kernel collection and of the collections it links against
+	KCID         []byte `plist:"_PrelinkKCID,omitempty" json:"kc_id,omitempty"`
+	BootKCID     []byte `plist:"_BootKCID,omitempty" json:"boot_kc_id,omitempty"`
+	PageableKCID []byte `plist:"_PageableKCID,omitempty" json:"pageable_kc_id,omitempty"`
 }
 
 type CFBundle struct {
@@ -54,6 +58,7 @@ type CFBundle struct {
 	GetInfoString         string `plist:"CFBundleGetInfoString,omitempty" json:"get_info_string,omitempty"`
 	AllowUserLoad         bool   `plist:"OSBundleAllowUserLoad,omitempty" json:"allow_user_load,omitempty"`
 	ExecutableLoadAddr    uint64 `plist:"_PrelinkExecutableLoadAddr,omitempty" json:"executable_load_addr,omitempty"`
+	ExecutableSize        uint64 `plist:"_PrelinkExecutableSize,omitempty" json:"executable_size,omitempty"`
 
 	ModuleIndex  uint64 `plist:"ModuleIndex,omitempty" json:"module_index,omitempty"`
 	Executable   string `plist:"CFBundleExecutable,omitempty" json:"executable,omitempty"`
@@ -105,10 +110,14 @@ func GetKextStartVMAddrs(m *macho.File) ([]uint64, error) {
 		}
 		return ptrs, nil
 	}
-	return nil, fmt.Errorf("section __PRELINK_INFO.__kmod_start not found")
+	return nil, errcode.Errorf(errcode.MissingSection, "section __PRELINK_INFO.__kmod_start not found")
 }
 
+// GetKextInfos returns the kmod_info of each kext in the kernelcache
 func GetKextInfos(m *macho.File) ([]KmodInfoT, error) {
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		return getFilesetKextInfos(m)
+	}
 	var infos []KmodInfoT
 	if kmodStart := m.Section("__PRELINK_INFO", "__kmod_info"); kmodStart != nil {
 		data, err := kmodStart.Data()
@@ -119,9 +128,9 @@ func GetKextInfos(m *macho.File) ([]KmodInfoT, error) {
 		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &ptrs); err != nil {
 			return nil, err
 		}
+		kptrs := fixup.New(m)
 		for _, ptr := range ptrs {
-			// fmt.Printf("ptr: %#x, untagged: %#x\n", ptr, unTag(ptr))
-			off, err := m.GetOffset(ptr | tagPtrMask)
+			off, err := m.GetOffset(kptrs.SlidePointer(ptr))
 			if err != nil {
 				return nil, err
 			}
@@ -137,70 +146,241 @@ func GetKextInfos(m *macho.File) ([]KmodInfoT, error) {
 			}
 
 			// fixups
-			info.StartAddr = fixupchains.DyldChainedPtr64KernelCacheRebase{Pointer: info.StartAddr}.Target() + m.GetBaseAddress()
-			info.StopAddr = fixupchains.DyldChainedPtr64KernelCacheRebase{Pointer: info.StopAddr}.Target() + m.GetBaseAddress()
+			info.StartAddr = kptrs.SlidePointer(info.StartAddr)
+			info.StopAddr = kptrs.SlidePointer(info.StopAddr)
 
 			infos = append(infos, info)
 		}
 		return infos, nil
 	}
-	return nil, fmt.Errorf("section __PRELINK_INFO.__kmod_start not found")
+	return nil, errcode.Errorf(errcode.MissingSection, "section __PRELINK_INFO.__kmod_start not found")
 }
 
-func GetKexts(kernel *macho.File) ([]CFBundle, error) {
-	if infoSec := kernel.Section("__PRELINK_INFO", "__info"); infoSec != nil {
+const kmodInfoVersion = 1 // KMOD_INFO_VERSION
 
-		data, err := infoSec.Data()
+// findKmodInfo returns the address of a fileset entry's kmod_info (via the _kmod_info symbol or by scanning
+// its __DATA sections for a kmod_info struct named after the entry for stripped kernelcaches)
+func findKmodInfo(m *macho.File, id string) (uint64, error) {
+	if addr, err := m.FindSymbolAddress("_kmod_info"); err == nil {
+		return addr, nil
+	}
+	const nameOff = 16 // offsetof(kmod_info_t, name)
+	name := make([]byte, 64)
+	copy(name, id)
+	var found uint64
+	for _, sec := range m.Sections {
+		if sec.Seg != "__DATA" || sec.Size < uint64(binary.Size(KmodInfoT{})) {
+			continue
+		}
+		// the __DATA sections are streamed in windows (instead of read whole) as the scan runs for every entry
+		if err := ForEachWindow(sec, DefaultWindowSize, nameOff+len(name), func(addr uint64, data []byte) bool {
+			for idx := 0; ; {
+				i := bytes.Index(data[idx:], name)
+				if i < 0 {
+					return true
+				}
+				idx += i
+				if off := idx - nameOff; off >= 0 && (addr-sec.Addr+uint64(off))%4 == 0 && binary.LittleEndian.Uint32(data[off+8:]) == kmodInfoVersion {
+					found = addr + uint64(off)
+					return false
+				}
+				idx++
+			}
+		}); err != nil {
+			return 0, err
+		}
+		if found != 0 {
+			return found, nil
+		}
+	}
+	return 0, errcode.Errorf(errcode.NotFound, "failed to find %s kmod_info", id)
+}
+
+// getFilesetKextInfos returns the kmod_info of each fileset entry (MH_FILESET kernelcaches have no __PRELINK_INFO.__kmod_info)
+func getFilesetKextInfos(m *macho.File) ([]KmodInfoT, error) {
+	var infos []KmodInfoT
+	ptrs := fixup.New(m) // the entries' pointers are relative to the kernel collection
+	for _, fe := range m.FileSets() {
+		if fe.EntryID == "com.apple.kernel" {
+			continue
+		}
+		mfe, err := m.GetFileSetFileByName(fe.EntryID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+		}
+		addr, err := findKmodInfo(mfe, fe.EntryID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read __PRELINK_INFO.__info section: %v", err)
+			log.Debugf("skipping %s: %v", fe.EntryID, err)
+			continue // i.e. codeless kexts
+		}
+		info := KmodInfoT{}
+		infoBytes := make([]byte, binary.Size(info))
+		off, err := m.GetOffset(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s kmod_info offset: %v", fe.EntryID, err)
+		}
+		if _, err := m.ReadAt(infoBytes, int64(off)); err != nil {
+			return nil, fmt.Errorf("failed to read %s KmodInfoT at %#x: %v", fe.EntryID, addr, err)
+		}
+		if err := binary.Read(bytes.NewReader(infoBytes), binary.LittleEndian, &info); err != nil {
+			return nil, fmt.Errorf("failed to read %s KmodInfoT at %#x: %v", fe.EntryID, addr, err)
+		}
+
+		// fixups
+		info.NextAddr = ptrs.SlidePointer(info.NextAddr)
+		info.ReferenceListAddr = ptrs.SlidePointer(info.ReferenceListAddr)
+		info.StartAddr = ptrs.SlidePointer(info.StartAddr)
+		info.StopAddr = ptrs.SlidePointer(info.StopAddr)
+		if info.Address == 0 { // filled in by the kext loader
+			if text := mfe.Segment("__TEXT"); text != nil {
+				info.Address = text.Addr
+			}
+			for _, seg := range mfe.Segments() {
+				if seg.Name != "__LINKEDIT" {
+					info.Size = max(info.Size, seg.Addr+seg.Memsz-info.Address)
+				}
+			}
 		}
 
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		return nil, errcode.Errorf(errcode.NotFound, "failed to find the kmod_info of any fileset entry")
+	}
+	return infos, nil
+}
+
+// ParsePrelinkInfo parses a __PRELINK_INFO plist (the embedded __info section or a standalone XML/binary plist
+// such as a kernel collection's receipt)
+func ParsePrelinkInfo(data []byte) (*PrelinkInfo, error) {
+	var prelink PrelinkInfo
+	if _, err := plist.Unmarshal(bytes.Trim(data, "\x00"), &prelink); err != nil {
+		return nil, err
+	}
+	return &prelink, nil
+}
+
+// getPrelinkInfo returns the kernelcache's parsed __PRELINK_INFO.__info section (or the whole __PRELINK_INFO
+// segment of kernel collections that don't have the section)
+func getPrelinkInfo(kernel *macho.File) (*PrelinkInfo, error) {
+	var data []byte
+	if infoSec := kernel.Section("__PRELINK_INFO", "__info"); infoSec != nil {
+		// the XML plist is decoded as it is streamed (it is tens of MB in macOS kernel collections)
 		var prelink PrelinkInfo
-		decoder := plist.NewDecoder(bytes.NewReader(bytes.Trim([]byte(data), "\x00")))
-		err = decoder.Decode(&prelink)
-		if err != nil {
+		if err := plist.NewDecoder(infoSec.Open()).Decode(&prelink); err != nil {
 			return nil, fmt.Errorf("failed to decode __PRELINK_INFO.__info section: %v", err)
 		}
-		return prelink.PrelinkInfoDictionary, nil
+		return &prelink, nil
+	} else if seg := kernel.Segment("__PRELINK_INFO"); seg != nil && seg.Filesz > 0 && seg.Nsect == 0 {
+		data = make([]byte, seg.Filesz)
+		if _, err := kernel.ReadAt(data, int64(seg.Offset)); err != nil {
+			return nil, fmt.Errorf("failed to read __PRELINK_INFO segment: %v", err)
+		}
+	} else {
+		return nil, errcode.Errorf(errcode.MissingSection, "section __PRELINK_INFO.__info not found")
+	}
+	prelink, err := ParsePrelinkInfo(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode __PRELINK_INFO.__info section: %v", err)
 	}
-	return nil, fmt.Errorf("section __PRELINK_INFO.__info not found")
+	return prelink, nil
 }
 
-// KextList lists all the kernel extensions in the kernelcache
-func KextList(kernelPath string, diffable bool) ([]string, error) {
-	var out []string
-
-	m, err := macho.Open(kernelPath)
+// GetPrelinkInfo returns the kernelcache's __PRELINK_INFO bundle dictionaries
+func GetPrelinkInfo(kernel *macho.File) ([]CFBundle, error) {
+	prelink, err := getPrelinkInfo(kernel)
 	if err != nil {
 		return nil, err
 	}
-	defer m.Close()
+	return prelink.PrelinkInfoDictionary, nil
+}
+
+// Kext is a kernel extension in the kernelcache
+type Kext struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	LoadAddr   uint64 `json:"load_addr,omitempty"`
+	Size       uint64 `json:"size,omitempty"`
+	BundlePath string `json:"bundle_path,omitempty"`
+	Executable string `json:"executable,omitempty"`
+}
 
-	bundles, err := GetKexts(m)
+func (k Kext) String() string {
+	return fmt.Sprintf("%#x: %s (%s)", k.LoadAddr, k.ID, k.Version)
+}
+
+// filesetRange returns the address and size of a fileset entry (excluding the shared __LINKEDIT)
+func filesetRange(m *macho.File, id string) (uint64, uint64, error) {
+	fe, err := m.GetFileSetFileByName(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	var start, end uint64
+	for _, seg := range fe.Segments() {
+		if seg.Name == "__LINKEDIT" || seg.Memsz == 0 {
+			continue
+		}
+		if start == 0 || seg.Addr < start {
+			start = seg.Addr
+		}
+		end = max(end, seg.Addr+seg.Memsz)
+	}
+	return start, end - start, nil
+}
+
+// GetKexts returns the kernel extensions in the kernelcache
+func GetKexts(m *macho.File) ([]Kext, error) {
+	return getKexts(context.Background(), m, nil)
+}
+
+// GetKextsContext is like GetKexts but stops (returning ctx.Err()) once the context is done
+func GetKextsContext(ctx context.Context, m *macho.File) ([]Kext, error) {
+	return getKexts(ctx, m, nil)
+}
+
+func getKexts(ctx context.Context, m *macho.File, filter *KextFilter) ([]Kext, error) {
+	bundles, err := GetPrelinkInfo(m)
 	if err != nil {
 		return nil, err
 	}
+	bundles = filter.FilterBundles(bundles)
 
 	kextStartAdddrs, err := GetKextStartVMAddrs(m)
 	if err != nil {
 		log.Debugf("failed to get kext start addresses: %v", err)
 	}
+	filesets := make(map[string]bool)
+	for _, fe := range m.FileSets() {
+		filesets[fe.EntryID] = true
+	}
+	kptrs := fixup.New(m)
 
-	if diffable {
-		for _, bundle := range bundles {
-			out = append(out, fmt.Sprintf("%s (%s)", bundle.ID, bundle.Version))
+	kexts := make([]Kext, 0, len(bundles))
+	for _, bundle := range bundles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-	} else {
-		for _, bundle := range bundles {
-			if !bundle.OSKernelResource && len(kextStartAdddrs) > 0 {
-				out = append(out, fmt.Sprintf("%#x: %s (%s)", kextStartAdddrs[bundle.ModuleIndex]|tagPtrMask, bundle.ID, bundle.Version))
+		kext := Kext{
+			ID:         bundle.ID,
+			Name:       bundle.Name,
+			Version:    bundle.Version,
+			LoadAddr:   bundle.ExecutableLoadAddr,
+			Size:       bundle.ExecutableSize,
+			BundlePath: bundle.BundlePath,
+			Executable: bundle.Executable,
+		}
+		if filesets[bundle.ID] {
+			if addr, size, err := filesetRange(m, bundle.ID); err == nil {
+				kext.LoadAddr, kext.Size = addr, size
 			} else {
-				out = append(out, fmt.Sprintf("%#x: %s (%s)", bundle.ExecutableLoadAddr, bundle.ID, bundle.Version))
+				log.Debugf("failed to parse fileset entry %s: %v", bundle.ID, err)
 			}
+		} else if !bundle.OSKernelResource && bundle.ModuleIndex < uint64(len(kextStartAdddrs)) {
+			kext.LoadAddr = kptrs.SlidePointer(kextStartAdddrs[bundle.ModuleIndex])
 		}
+		kexts = append(kexts, kext)
 	}
 
-	sort.Strings(out)
-
-	return out, nil
+	return kexts, nil
 }
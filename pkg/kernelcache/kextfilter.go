@@ -0,0 +1,180 @@
+package kernelcache
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// KextFilterHelp describes the kext filter expression syntax
+const KextFilterHelp = `space separated terms that must ALL match (prefix a term with ! to negate it):
+  com.apple.iokit.*          bundle ID glob (the same as id=com.apple.iokit.*)
+  id=GLOB / id!=GLOB         bundle ID glob
+  name=GLOB                  bundle name (CFBundleName) glob
+  version>=1.2 version<2     bundle version comparison (=, !=, <, <=, >, >=)
+  min-os>=14.0               MinimumOSVersion comparison (kexts without one never match)
+  has-personality            has IOKitPersonalities
+  security-extension         is an AppleSecurityExtension
+  kernel-resource            is an OSKernelResource`
+
+type kextTerm struct {
+	not   bool
+	key   string
+	op    string
+	value string
+}
+
+// KextFilter is a parsed kext filter expression (see KextFilterHelp)
+type KextFilter struct {
+	expr  string
+	terms []kextTerm
+}
+
+var kextFilterFlags = []string{"has-personality", "security-extension", "kernel-resource"}
+
+// ParseKextFilter parses a kext filter expression like 'com.apple.driver.* version>=100 !has-personality'
+func ParseKextFilter(expr string) (*KextFilter, error) {
+	f := &KextFilter{expr: expr}
+	for _, field := range strings.Fields(expr) {
+		var t kextTerm
+		if rest, ok := strings.CutPrefix(field, "!"); ok {
+			t.not, field = true, rest
+		}
+		if i := strings.IndexAny(field, "=<>!"); i > 0 {
+			t.key, field = strings.ToLower(field[:i]), field[i:]
+			for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} { // longest first
+				if rest, ok := strings.CutPrefix(field, op); ok {
+					t.op, t.value = op, rest
+					break
+				}
+			}
+			if len(t.op) == 0 || len(t.value) == 0 {
+				return nil, errcode.Errorf(errcode.InvalidArgument, "invalid kext filter term %q", field)
+			}
+			switch t.key {
+			case "id", "name":
+				if t.op != "=" && t.op != "!=" {
+					return nil, errcode.Errorf(errcode.InvalidArgument, "invalid kext filter: %s only supports = and != (got %s)", t.key, t.op)
+				}
+				if _, err := path.Match(t.value, ""); err != nil {
+					return nil, errcode.Errorf(errcode.InvalidArgument, "invalid kext filter glob %q: %v", t.value, err)
+				}
+			case "version", "min-os":
+				if _, err := parseKextVersion(t.value); err != nil {
+					return nil, errcode.Errorf(errcode.InvalidArgument, "invalid kext filter %s: %v", t.key, err)
+				}
+			default:
+				return nil, errcode.Errorf(errcode.InvalidArgument, "unknown kext filter key %q (must be id, name, version or min-os)", t.key)
+			}
+		} else if slices.Contains(kextFilterFlags, strings.ToLower(field)) {
+			t.key = strings.ToLower(field)
+		} else if len(field) > 0 {
+			if _, err := path.Match(field, ""); err != nil {
+				return nil, errcode.Errorf(errcode.InvalidArgument, "invalid kext filter glob %q: %v", field, err)
+			}
+			t.key, t.op, t.value = "id", "=", field
+		} else {
+			return nil, errcode.Errorf(errcode.InvalidArgument, "invalid kext filter: dangling '!' in %q", expr)
+		}
+		f.terms = append(f.terms, t)
+	}
+	return f, nil
+}
+
+func (f *KextFilter) String() string {
+	return f.expr
+}
+
+func compareVersions(have, op, want string) bool {
+	h, err := parseKextVersion(have)
+	if err != nil {
+		return false
+	}
+	w, err := parseKextVersion(want)
+	if err != nil {
+		return false
+	}
+	c := h.compare(w)
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func (t kextTerm) match(b *CFBundle) bool {
+	switch t.key {
+	case "id", "name":
+		s := b.ID
+		if t.key == "name" {
+			s = b.Name
+		}
+		ok, _ := path.Match(t.value, s)
+		return ok == (t.op == "=")
+	case "version":
+		return compareVersions(b.Version, t.op, t.value)
+	case "min-os":
+		return compareVersions(b.MinimumOSVersion, t.op, t.value)
+	case "has-personality":
+		return len(b.IOKitPersonalities) > 0
+	case "security-extension":
+		return b.AppleSecurityExtension
+	case "kernel-resource":
+		return b.OSKernelResource
+	}
+	return false
+}
+
+// Match returns true if the kext bundle matches every term of the filter (a nil filter matches everything)
+func (f *KextFilter) Match(b *CFBundle) bool {
+	if f == nil {
+		return true
+	}
+	for _, t := range f.terms {
+		if t.match(b) == t.not {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterBundles returns the kext bundles that match the filter
+func (f *KextFilter) FilterBundles(bundles []CFBundle) []CFBundle {
+	if f == nil {
+		return bundles
+	}
+	var out []CFBundle
+	for i := range bundles {
+		if f.Match(&bundles[i]) {
+			out = append(out, bundles[i])
+		}
+	}
+	return out
+}
+
+// GetKextsMatching returns the kernel extensions in the kernelcache that match a filter expression (see KextFilterHelp)
+func GetKextsMatching(m *macho.File, expr string) ([]Kext, error) {
+	return GetKextsMatchingContext(context.Background(), m, expr)
+}
+
+// GetKextsMatchingContext is like GetKextsMatching but stops (returning ctx.Err()) once the context is done
+func GetKextsMatchingContext(ctx context.Context, m *macho.File, expr string) ([]Kext, error) {
+	f, err := ParseKextFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	return getKexts(ctx, m, f)
+}
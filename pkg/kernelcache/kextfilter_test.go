@@ -0,0 +1,51 @@
+package kernelcache
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+func TestKextFilter(t *testing.T) {
+	bundles := []CFBundle{
+		{ID: "com.apple.kpi.bsd", Version: "24.0.0", OSKernelResource: true},
+		{ID: "com.apple.iokit.IOUSBHostFamily", Version: "1.2", MinimumOSVersion: "14.0", IOKitPersonalities: map[string]any{"IOUSBHostDevice": nil}},
+		{ID: "com.apple.driver.AppleMobileFileIntegrity", Version: "1.0.5", AppleSecurityExtension: true},
+		{ID: "com.apple.driver.AppleH13CamIn", Version: "615.3b2", MinimumOSVersion: "13.0"},
+	}
+	ids := func(expr string) []string {
+		t.Helper()
+		f, err := ParseKextFilter(expr)
+		if err != nil {
+			t.Fatalf("ParseKextFilter(%q) failed: %v", expr, err)
+		}
+		var out []string
+		for _, b := range f.FilterBundles(bundles) {
+			out = append(out, b.ID)
+		}
+		return out
+	}
+
+	for expr, want := range map[string][]string{
+		"":                   {"com.apple.kpi.bsd", "com.apple.iokit.IOUSBHostFamily", "com.apple.driver.AppleMobileFileIntegrity", "com.apple.driver.AppleH13CamIn"},
+		"com.apple.driver.*": {"com.apple.driver.AppleMobileFileIntegrity", "com.apple.driver.AppleH13CamIn"},
+		"id!=com.apple.driver.* !kernel-resource": {"com.apple.iokit.IOUSBHostFamily"},
+		"has-personality":                         {"com.apple.iokit.IOUSBHostFamily"},
+		"security-extension":                      {"com.apple.driver.AppleMobileFileIntegrity"},
+		"version>=1.0 version<2":                  {"com.apple.iokit.IOUSBHostFamily", "com.apple.driver.AppleMobileFileIntegrity"},
+		"version<615.3 version>100":               {"com.apple.driver.AppleH13CamIn"},
+		"min-os>=14":                              {"com.apple.iokit.IOUSBHostFamily"},
+		"!min-os>=14":                             {"com.apple.kpi.bsd", "com.apple.driver.AppleMobileFileIntegrity", "com.apple.driver.AppleH13CamIn"},
+	} {
+		if got := ids(expr); !slices.Equal(got, want) {
+			t.Errorf("filter %q = %v, want %v", expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{"version>=abc", "foo=bar", "id<com.apple.*", "!", "version>=", "com.apple.[*"} {
+		if _, err := ParseKextFilter(expr); errcode.Of(err) != errcode.InvalidArgument {
+			t.Errorf("ParseKextFilter(%q) error = %v, want InvalidArgument", expr, err)
+		}
+	}
+}
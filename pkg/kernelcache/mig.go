@@ -4,9 +4,11 @@ package kernelcache
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/apex/log"
@@ -453,3 +455,219 @@ func GetMigSubsystems(m *macho.File) ([]MigKernSubsystem, error) {
 
 	return migs, nil
 }
+
+// MigRoutine is a MIG routine (mach message handler) with its handlers resolved
+type MigRoutine struct {
+	ID              uint32 `json:"id"` // mach message ID
+	Name            string `json:"name,omitempty"`
+	Stub            uint64 `json:"stub"` // unmarshalling routine (the handler called by the subsystem's server)
+	StubName        string `json:"stub_name,omitempty"`
+	Impl            uint64 `json:"impl,omitempty"` // server work routine
+	ImplName        string `json:"impl_name,omitempty"`
+	ArgC            uint32 `json:"argc"`
+	DescrCount      uint32 `json:"descr_count"`
+	ReplyDescrCount uint32 `json:"reply_descr_count"`
+	MaxReplyMsg     uint32 `json:"max_reply_msg"`
+}
+
+// MigSubsystem is a MIG subsystem found in a kernelcache's __DATA_CONST
+type MigSubsystem struct {
+	Entry      string       `json:"entry,omitempty"` // fileset entry the subsystem is in
+	Name       string       `json:"name,omitempty"`
+	Addr       uint64       `json:"addr"`   // address of the mig_kern_subsystem struct
+	Server     uint64       `json:"server"` // kernel demux routine
+	ServerName string       `json:"server_name,omitempty"`
+	Start      uint32       `json:"start"` // base mach message ID
+	End        uint32       `json:"end"`
+	MaxSize    uint32       `json:"max_size"`
+	Routines   []MigRoutine `json:"routines"`
+}
+
+func (m MigSubsystem) String() string {
+	name := m.Name
+	if len(name) == 0 {
+		name = fmt.Sprintf("subsystem_%d", m.Start)
+	}
+	if len(m.Entry) > 0 {
+		name = m.Entry + " " + name
+	}
+	out := fmt.Sprintf("%s: %s\t%s=%d %s=%d %s=%d\n",
+		colorAddr("%#x", m.Addr),
+		colorSubSystem(name),
+		colorField("start"), m.Start,
+		colorField("end"), m.End,
+		colorField("max_sz"), m.MaxSize,
+	)
+	for _, r := range m.Routines {
+		name := r.Name
+		if len(name) == 0 {
+			name = r.StubName
+		}
+		if len(name) == 0 {
+			name = fmt.Sprintf("func_%x", r.Stub)
+		}
+		out += fmt.Sprintf("    %s: %s\t%s=%d %s=%#x %s=%02d %s=%d %s=%d %s=%d\n",
+			colorAddr("%#x", r.Stub),
+			colorBold(name),
+			colorName("num"), r.ID,
+			colorName("impl"), r.Impl,
+			colorName("argc"), r.ArgC,
+			colorName("descr"), r.DescrCount,
+			colorName("reply_descr"), r.ReplyDescrCount,
+			colorName("max_reply_msg"), r.MaxReplyMsg,
+		)
+	}
+	return out
+}
+
+const (
+	sizeOfMigKernSubsystemHdr = 32
+	sizeOfKernRoutine         = 32
+	maxMigRoutines            = 1024
+	maxMigMsgSize             = 0x100000
+)
+
+// scanMigSubsystems finds the mig_kern_subsystem structs in a __DATA_CONST section
+//
+// A struct is recognized by its kserver pointing to code, a sane [start, end) message ID range and max reply size,
+// zeroed reserved fields and every (non-empty) routine's stub (and impl) pointing to code.
+func scanMigSubsystems(data []byte, addr uint64, slide func(uint64) uint64, isCode func(uint64) bool) []MigSubsystem {
+	var migs []MigSubsystem
+
+	for off := 0; off+sizeOfMigKernSubsystemHdr+sizeOfKernRoutine <= len(data); off += 8 {
+		var hdr migKernSubsystemHdr
+		binary.Read(bytes.NewReader(data[off:off+sizeOfMigKernSubsystemHdr]), binary.LittleEndian, &hdr)
+		count := int(hdr.End) - int(hdr.Start)
+		if count <= 0 || count > maxMigRoutines || hdr.Maxsize == 0 || hdr.Maxsize > maxMigMsgSize || hdr.Reserved != 0 {
+			continue
+		}
+		if end := off + sizeOfMigKernSubsystemHdr + count*sizeOfKernRoutine; end > len(data) {
+			continue
+		}
+		if hdr.KServer = slide(hdr.KServer); !isCode(hdr.KServer) {
+			continue
+		}
+		routines := make([]KernRoutineDescriptor, count)
+		binary.Read(bytes.NewReader(data[off+sizeOfMigKernSubsystemHdr:]), binary.LittleEndian, &routines)
+
+		mig := MigSubsystem{
+			Addr:    addr + uint64(off),
+			Server:  hdr.KServer,
+			Start:   uint32(hdr.Start),
+			End:     hdr.End,
+			MaxSize: hdr.Maxsize,
+		}
+		valid := true
+		for idx, r := range routines {
+			if r.KStubRoutine == 0 && r.ImplRoutine == 0 {
+				continue // routine ID is unused
+			}
+			stub, impl := slide(r.KStubRoutine), slide(r.ImplRoutine)
+			if !isCode(stub) || (impl != 0 && !isCode(impl)) || r.MaxReplyMsg > maxMigMsgSize {
+				valid = false
+				break
+			}
+			mig.Routines = append(mig.Routines, MigRoutine{
+				ID:              uint32(hdr.Start) + uint32(idx),
+				Stub:            stub,
+				Impl:            impl,
+				ArgC:            r.ArgC,
+				DescrCount:      r.DescrCount,
+				ReplyDescrCount: r.ReplyDescrCount,
+				MaxReplyMsg:     r.MaxReplyMsg,
+			})
+		}
+		if !valid || len(mig.Routines) == 0 {
+			continue
+		}
+		migs = append(migs, mig)
+		off += sizeOfMigKernSubsystemHdr + count*sizeOfKernRoutine - 8
+	}
+
+	return migs
+}
+
+// FindMigSubsystems scans the __DATA_CONST of the kernel (and every kext for MH_FILESET kernelcaches)
+// for MIG subsystems and returns them with their handlers resolved
+//
+// NOTE: unlike GetMigSubsystems this doesn't rely on the kernel's mig_e table, so it also finds the subsystems of kexts
+func FindMigSubsystems(m *macho.File) ([]MigSubsystem, error) {
+	return FindMigSubsystemsContext(context.Background(), m)
+}
+
+// FindMigSubsystemsContext is like FindMigSubsystems but stops (returning ctx.Err()) once the context is done
+func FindMigSubsystemsContext(ctx context.Context, m *macho.File) ([]MigSubsystem, error) {
+	images := map[string]*macho.File{"": m}
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		images = make(map[string]*macho.File)
+		for _, fe := range m.FileSets() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			images[fe.EntryID] = mfe
+		}
+	}
+
+	isCode := func(addr uint64) bool {
+		if addr == 0 {
+			return false
+		}
+		seg := m.FindSegmentForVMAddr(addr)
+		return seg != nil && seg.Prot.Execute()
+	}
+	symbolName := func(m *macho.File, addr uint64) string {
+		if syms, err := m.FindAddressSymbols(addr); err == nil && len(syms) > 0 {
+			return syms[0].Name
+		}
+		return ""
+	}
+
+	var migs []MigSubsystem
+	for entry, img := range images {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, sec := range img.Sections {
+			if sec.Seg != "__DATA_CONST" || sec.Name != "__const" {
+				continue
+			}
+			data, err := sec.Data()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s %s.%s data: %v", entry, sec.Seg, sec.Name, err)
+			}
+			for _, mig := range scanMigSubsystems(data, sec.Addr, img.SlidePointer, isCode) {
+				mig.Entry = entry
+				kmig := MigKernSubsystem{migKernSubsystemHdr: migKernSubsystemHdr{Start: SubsystemStart(mig.Start)}}
+				if name := kmig.Start.String(); !strings.HasPrefix(name, "SubsystemStart(") {
+					mig.Name = name
+				}
+				mig.ServerName = symbolName(img, mig.Server)
+				for i, r := range mig.Routines {
+					if len(mig.Name) > 0 {
+						if name := kmig.LookupRoutineName(int(r.ID - mig.Start)); name != "<unknown>" {
+							mig.Routines[i].Name = name
+						}
+					}
+					mig.Routines[i].StubName = symbolName(img, r.Stub)
+					if r.Impl != 0 {
+						mig.Routines[i].ImplName = symbolName(img, r.Impl)
+					}
+				}
+				migs = append(migs, mig)
+			}
+		}
+	}
+
+	sort.Slice(migs, func(i, j int) bool {
+		if migs[i].Start != migs[j].Start {
+			return migs[i].Start < migs[j].Start
+		}
+		return migs[i].Addr < migs[j].Addr
+	})
+
+	return migs, nil
+}
@@ -0,0 +1,42 @@
+package kernelcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestScanMigSubsystems(t *testing.T) {
+	const base = 0xfffffff007800000
+	isCode := func(addr uint64) bool { return addr >= 0xfffffff008000000 && addr < 0xfffffff009000000 }
+	slide := func(ptr uint64) uint64 { return ptr }
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint64{0x4141414141414141, 0}) // junk before the struct
+	binary.Write(buf, binary.LittleEndian, migKernSubsystemHdr{
+		KServer: 0xfffffff008001000,
+		Start:   mach_vm_subsystem,
+		End:     uint32(mach_vm_subsystem) + 3,
+		Maxsize: 0x100,
+	})
+	binary.Write(buf, binary.LittleEndian, []KernRoutineDescriptor{
+		{KStubRoutine: 0xfffffff008002000, ArgC: 3, MaxReplyMsg: 0x2c},
+		{}, // unused routine ID
+		{KStubRoutine: 0xfffffff008003000, ImplRoutine: 0xfffffff008004000, ArgC: 5, DescrCount: 1},
+	})
+	// not a subsystem: the routine's stub doesn't point to code
+	binary.Write(buf, binary.LittleEndian, migKernSubsystemHdr{KServer: 0xfffffff008001000, Start: 100, End: 101, Maxsize: 0x40})
+	binary.Write(buf, binary.LittleEndian, KernRoutineDescriptor{KStubRoutine: 0x1234})
+
+	migs := scanMigSubsystems(buf.Bytes(), base, slide, isCode)
+	if len(migs) != 1 {
+		t.Fatalf("scanMigSubsystems() found %d subsystems, want 1: %+v", len(migs), migs)
+	}
+	mig := migs[0]
+	if mig.Addr != base+16 || mig.Start != uint32(mach_vm_subsystem) || mig.Server != 0xfffffff008001000 || len(mig.Routines) != 2 {
+		t.Fatalf("scanMigSubsystems() = %+v", mig)
+	}
+	if r := mig.Routines[1]; r.ID != uint32(mach_vm_subsystem)+2 || r.Stub != 0xfffffff008003000 || r.Impl != 0xfffffff008004000 || r.ArgC != 5 {
+		t.Errorf("routine = %+v", r)
+	}
+}
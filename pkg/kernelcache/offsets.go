@@ -0,0 +1,285 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/arm64-cgo/disassemble"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// StructOffsetsVersion is the version of the StructOffsets JSON (bumped when its layout changes)
+const StructOffsetsVersion = 1
+
+// FieldAccessor is a C++ method of a kext that reads (or writes) a single field of its object
+type FieldAccessor struct {
+	Kext   string `json:"kext"`   // the bundle ID (or its suffix i.e. IOSurface)
+	Struct string `json:"struct"` // i.e. IOSurface
+	Field  string `json:"field"`  // i.e. allocSize
+	Symbol string `json:"symbol"` // the mangled name of the accessor (i.e. __ZNK9IOSurface12getAllocSizeEv)
+	// Virtual accessors are found by their vtable PAC diversity when the kext is stripped
+	Virtual bool `json:"virtual,omitempty"`
+}
+
+// DefaultFieldAccessors are the accessors of the shared-memory objects of the kexts most often used by PoCs
+var DefaultFieldAccessors = []FieldAccessor{
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "allocSize", Symbol: "__ZNK9IOSurface12getAllocSizeEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "width", Symbol: "__ZNK9IOSurface8getWidthEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "height", Symbol: "__ZNK9IOSurface9getHeightEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "bytesPerRow", Symbol: "__ZNK9IOSurface14getBytesPerRowEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "pixelFormat", Symbol: "__ZNK9IOSurface14getPixelFormatEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "planeCount", Symbol: "__ZNK9IOSurface13getPlaneCountEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "seed", Symbol: "__ZNK9IOSurface7getSeedEv"},
+	{Kext: "com.apple.iokit.IOSurface", Struct: "IOSurface", Field: "memoryDescriptor", Symbol: "__ZNK9IOSurface19getMemoryDescriptorEv"},
+	{Kext: "com.apple.iokit.IOGPUFamily", Struct: "IOGPUResource", Field: "resourceID", Symbol: "__ZNK13IOGPUResource13getResourceIDEv"},
+	{Kext: "com.apple.iokit.IOGPUFamily", Struct: "IOGPUResource", Field: "resourceSize", Symbol: "__ZNK13IOGPUResource15getResourceSizeEv"},
+	{Kext: "com.apple.driver.AppleAVE2", Struct: "AppleAVE2UserClient", Field: "driver", Symbol: "__ZNK19AppleAVE2UserClient9getDriverEv"},
+}
+
+// FieldOffset is the offset of a field found by pattern-matching its accessor
+type FieldOffset struct {
+	Offset   uint64 `json:"offset"`
+	Size     int    `json:"size,omitempty"` // the width of the access (0 for the address of an embedded member)
+	Access   string `json:"access"`         // load, store or ref
+	Accessor string `json:"accessor"`
+	Addr     uint64 `json:"addr"`
+	Kext     string `json:"kext"`
+	Source   string `json:"source"` // how the accessor was found: symtab, symbols or vtable
+}
+
+// StructOffsets are the struct field offsets of a kernelcache's kexts
+type StructOffsets struct {
+	Version int                               `json:"version"`
+	Kernel  string                            `json:"kernel,omitempty"` // the darwin kernel version
+	XNU     string                            `json:"xnu,omitempty"`
+	Structs map[string]map[string]FieldOffset `json:"structs"`
+	Missing []string                          `json:"missing,omitempty"` // the Struct.field accessors that weren't found (or matched)
+}
+
+// StructOffsetsConfig is the config for GetStructOffsets
+type StructOffsetsConfig struct {
+	Accessors []FieldAccessor   // defaults to DefaultFieldAccessors
+	Symbols   map[uint64]string // addr to symbol map of a stripped kernelcache (i.e. the output of 'ipsw kernel symbolicate --json')
+	Kext      string            // only the accessors of a kext (bundle ID or its suffix)
+}
+
+// fieldAccess is a single field access by an accessor's code
+type fieldAccess struct {
+	offset uint64
+	size   int
+	access string
+}
+
+// maxAccessorInstrs is the max number of instructions of an accessor (the prologue, the access and the return)
+const maxAccessorInstrs = 4
+
+// matchAccessor returns the field access of a leaf accessor of the object in x0
+//
+// NOTE: it matches `ldr{,b,h,sw} x0/w0, [x0, #off]`, `add x0, x0, #off` and `str{,b,h} x1/w1, [x0, #off]` followed by a RET
+func matchAccessor(code []byte, addr uint64) (*fieldAccess, bool) {
+	var results [1024]byte
+	var fa *fieldAccess
+	for i := 0; i+4 <= len(code) && i < maxAccessorInstrs*4; i, addr = i+4, addr+4 {
+		instr, err := disassemble.Decompose(addr, binary.LittleEndian.Uint32(code[i:]), &results)
+		if err != nil {
+			return nil, false
+		}
+		switch instr.Operation {
+		case disassemble.ARM64_PACIBSP, disassemble.ARM64_BTI, disassemble.ARM64_NOP:
+			if fa != nil {
+				return nil, false
+			}
+		case disassemble.ARM64_RET, disassemble.ARM64_RETAA, disassemble.ARM64_RETAB:
+			return fa, fa != nil
+		case disassemble.ARM64_LDR, disassemble.ARM64_LDRB, disassemble.ARM64_LDRH, disassemble.ARM64_LDRSW,
+			disassemble.ARM64_STR, disassemble.ARM64_STRB, disassemble.ARM64_STRH:
+			if fa != nil || len(instr.Operands) != 2 || instr.Operands[1].Class != disassemble.MEM_OFFSET ||
+				len(instr.Operands[0].Registers) == 0 || len(instr.Operands[1].Registers) == 0 ||
+				instr.Operands[1].Registers[0] != disassemble.REG_X0 {
+				return nil, false
+			}
+			store := instr.Operation == disassemble.ARM64_STR || instr.Operation == disassemble.ARM64_STRB || instr.Operation == disassemble.ARM64_STRH
+			reg := instr.Operands[0].Registers[0]
+			fa = &fieldAccess{offset: instr.Operands[1].Immediate, access: "load"}
+			switch {
+			case !store && reg == disassemble.REG_X0, store && reg == disassemble.REG_X1:
+				fa.size = 8
+			case !store && reg == disassemble.REG_W0, store && reg == disassemble.REG_W1:
+				fa.size = 4
+			default:
+				return nil, false
+			}
+			switch instr.Operation {
+			case disassemble.ARM64_LDRB, disassemble.ARM64_STRB:
+				fa.size = 1
+			case disassemble.ARM64_LDRH, disassemble.ARM64_STRH:
+				fa.size = 2
+			}
+			if store {
+				fa.access = "store"
+			}
+		case disassemble.ARM64_ADD:
+			if fa != nil || len(instr.Operands) != 3 || len(instr.Operands[2].Registers) > 0 ||
+				len(instr.Operands[0].Registers) == 0 || instr.Operands[0].Registers[0] != disassemble.REG_X0 ||
+				len(instr.Operands[1].Registers) == 0 || instr.Operands[1].Registers[0] != disassemble.REG_X0 {
+				return nil, false
+			}
+			fa = &fieldAccess{offset: instr.Operands[2].Immediate, access: "ref"}
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+type offsetsImage struct {
+	kext    string
+	m       *macho.File
+	symbols map[string]uint64
+}
+
+// isKext returns true if the bundle ID is the kext (or ends with its suffix)
+func isKext(id, kext string) bool {
+	return id == kext || strings.HasSuffix(id, "."+kext)
+}
+
+// GetStructOffsets returns the struct field offsets of the kernelcache's kexts by pattern-matching their accessors
+//
+// The accessors are found by their symbol, in the given symbol map (for stripped kernelcaches) or, for virtual
+// accessors of arm64e kernelcaches, by the PAC diversity of the vtable methods they are signed with.
+func GetStructOffsets(m *macho.File, conf *StructOffsetsConfig) (*StructOffsets, error) {
+	if conf == nil {
+		conf = &StructOffsetsConfig{}
+	}
+	accessors := conf.Accessors
+	if len(accessors) == 0 {
+		accessors = DefaultFieldAccessors
+	}
+
+	offs := &StructOffsets{
+		Version: StructOffsetsVersion,
+		Structs: make(map[string]map[string]FieldOffset),
+	}
+	if kv, err := GetVersion(m); err == nil {
+		offs.Kernel = kv.KernelVersion.Darwin
+		offs.XNU = kv.KernelVersion.XNU
+	}
+
+	images := []*offsetsImage{{m: m}}
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		images = nil
+		for _, fe := range m.FileSets() {
+			if len(conf.Kext) > 0 && !isKext(fe.EntryID, conf.Kext) {
+				continue
+			}
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			images = append(images, &offsetsImage{kext: fe.EntryID, m: mfe})
+		}
+	}
+	for _, img := range images {
+		img.symbols = make(map[string]uint64)
+		if img.m.Symtab != nil {
+			for _, sym := range img.m.Symtab.Syms {
+				if sym.Value != 0 {
+					img.symbols[sym.Name] = sym.Value
+				}
+			}
+		}
+	}
+	symbols := make(map[string]uint64, len(conf.Symbols))
+	for addr, name := range conf.Symbols {
+		symbols[name] = addr
+	}
+
+	var aps []AuthPointer
+	var apsErr error
+	authPointers := func() []AuthPointer {
+		if aps == nil && apsErr == nil {
+			if aps, apsErr = GetAuthPointers(m); apsErr != nil {
+				log.WithError(apsErr).Debug("failed to get the PAC signed vtable methods")
+			}
+		}
+		return aps
+	}
+
+	match := func(img *offsetsImage, addr uint64) (*fieldAccess, bool) {
+		code := make([]byte, maxAccessorInstrs*4)
+		if _, err := readAtAddr(img.m, code, addr); err != nil {
+			return nil, false
+		}
+		return matchAccessor(code, addr)
+	}
+
+	for _, acc := range accessors {
+		if len(conf.Kext) > 0 && !isKext(acc.Kext, conf.Kext) && !isKext(conf.Kext, acc.Kext) {
+			continue
+		}
+		var found *FieldOffset
+		for _, img := range images {
+			if len(img.kext) > 0 && !isKext(img.kext, acc.Kext) {
+				continue
+			}
+			var addr uint64
+			source := "symtab"
+			if a, ok := img.symbols[acc.Symbol]; ok {
+				addr = a
+			} else if a, ok := symbols[acc.Symbol]; ok && img.m.FindSectionForVMAddr(a) != nil {
+				addr, source = a, "symbols"
+			} else if a, ok := symbols[strings.TrimPrefix(acc.Symbol, "_")]; ok && img.m.FindSectionForVMAddr(a) != nil {
+				addr, source = a, "symbols"
+			}
+			if addr != 0 {
+				if fa, ok := match(img, addr); ok {
+					found = &FieldOffset{Offset: fa.offset, Size: fa.size, Access: fa.access, Accessor: acc.Symbol, Addr: addr, Kext: img.kext, Source: source}
+				}
+				break
+			}
+			if !acc.Virtual {
+				continue
+			}
+			// the vtable methods are signed with the discriminator of the Itanium mangled name (without Mach-O's extra underscore)
+			div := PtrAuthStringDiscriminator(strings.TrimPrefix(acc.Symbol, "_"))
+			var candidates []FieldOffset
+			for _, ap := range authPointers() {
+				if ap.Key != "IA" || !ap.AddrDiv || ap.Diversity != div || len(ap.VTable) == 0 || (len(img.kext) > 0 && ap.Kext != img.kext) {
+					continue
+				}
+				if fa, ok := match(img, ap.Target); ok {
+					candidates = append(candidates, FieldOffset{Offset: fa.offset, Size: fa.size, Access: fa.access, Accessor: acc.Symbol, Addr: ap.Target, Kext: img.kext, Source: "vtable"})
+				}
+			}
+			if len(candidates) > 0 && !hasConflictingOffsets(candidates) {
+				sort.Slice(candidates, func(i, j int) bool { return candidates[i].Addr < candidates[j].Addr })
+				found = &candidates[0]
+				break
+			}
+		}
+		if found == nil {
+			offs.Missing = append(offs.Missing, acc.Struct+"."+acc.Field)
+			continue
+		}
+		if offs.Structs[acc.Struct] == nil {
+			offs.Structs[acc.Struct] = make(map[string]FieldOffset)
+		}
+		offs.Structs[acc.Struct][acc.Field] = *found
+	}
+
+	return offs, nil
+}
+
+// hasConflictingOffsets returns true if the accessors matched by a PAC diversity disagree (i.e. a hash collision)
+func hasConflictingOffsets(fos []FieldOffset) bool {
+	for _, fo := range fos[1:] {
+		if fo.Offset != fos[0].Offset || fo.Access != fos[0].Access {
+			return true
+		}
+	}
+	return false
+}
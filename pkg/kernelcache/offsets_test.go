@@ -0,0 +1,35 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestMatchAccessor(t *testing.T) {
+	code := func(instrs ...uint32) []byte {
+		var b []byte
+		for _, i := range instrs {
+			b = binary.LittleEndian.AppendUint32(b, i)
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		code []byte
+		want *fieldAccess
+	}{
+		{"ldr x0", code(0xf9402c00, 0xd65f03c0), &fieldAccess{offset: 0x58, size: 8, access: "load"}},
+		{"pacibsp ldrb w0 retab", code(0xd503237f, 0x39401400, 0xd65f0fff), &fieldAccess{offset: 0x5, size: 1, access: "load"}},
+		{"str w1", code(0xb9002001, 0xd65f03c0), &fieldAccess{offset: 0x20, size: 4, access: "store"}},
+		{"add x0", code(0x9100c000, 0xd65f03c0), &fieldAccess{offset: 0x30, access: "ref"}},
+		{"ldr from x1", code(0xf9402c20, 0xd65f03c0), nil},
+		{"two loads", code(0xf9402c00, 0xf9402c00, 0xd65f03c0), nil},
+		{"no ret", code(0xf9402c00, 0x94000000), nil},
+	}
+	for _, tt := range tests {
+		got, ok := matchAccessor(tt.code, 0x1000)
+		if (tt.want == nil) != !ok || (tt.want != nil && *got != *tt.want) {
+			t.Errorf("matchAccessor(%s) = %+v, %t; want %+v", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache/fixup"
+)
+
+// PACKeys are the names of the ptrauth keys (by their chained fixup key number)
+var PACKeys = []string{"IA", "IB", "DA", "DB"}
+
+// AuthPointer is an authenticated (PAC signed) pointer of a kernelcache's chained fixups
+type AuthPointer struct {
+	Addr      uint64 `json:"addr"`
+	Target    uint64 `json:"target"`
+	Kext      string `json:"kext,omitempty"`
+	Section   string `json:"section,omitempty"`
+	Key       string `json:"key"`
+	AddrDiv   bool   `json:"addr_div"`
+	Diversity uint16 `json:"diversity"`
+	VTable    string `json:"vtable,omitempty"` // the vtable the pointer is a method of (its symbol or vtable_<addr>)
+	Index     int    `json:"index,omitempty"`  // the method's index in the vtable
+}
+
+func (p AuthPointer) String() string {
+	s := fmt.Sprintf("%#x: %s key=%s addr_div=%t diversity=%#04x → %#x", p.Addr, p.Section, p.Key, p.AddrDiv, p.Diversity, p.Target)
+	if len(p.VTable) > 0 {
+		s += fmt.Sprintf(" (%s[%d])", p.VTable, p.Index)
+	}
+	return s
+}
+
+// vtableMinMethods is the minimum number of consecutive IA signed pointers of a stripped vtable
+const vtableMinMethods = 3
+
+type kextRange struct {
+	id         string
+	start, end uint64
+}
+
+// GetAuthPointers returns every authenticated pointer of the kernelcache's chained fixups (sorted by address)
+func GetAuthPointers(m *macho.File) ([]AuthPointer, error) {
+	if !m.HasDyldChainedFixups() {
+		return nil, errcode.Errorf(errcode.Unsupported, "kernelcache has no chained fixups (it isn't an arm64e kernelcache)")
+	}
+	dcf, err := m.DyldChainedFixups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixups: %v", err)
+	}
+	ptrs := fixup.New(m)
+
+	var kexts []kextRange
+	vtables := make(map[uint64]string) // the address of the first method of each vtable symbol
+	addVTables := func(mm *macho.File) {
+		if mm.Symtab == nil {
+			return
+		}
+		for _, sym := range mm.Symtab.Syms {
+			if strings.HasPrefix(sym.Name, "__ZTV") && sym.Value != 0 {
+				vtables[sym.Value+16] = sym.Name // skip the offset-to-top and RTTI
+			}
+		}
+	}
+	addVTables(m)
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		for _, fe := range m.FileSets() {
+			if start, size, err := filesetRange(m, fe.EntryID); err == nil {
+				kexts = append(kexts, kextRange{id: fe.EntryID, start: start, end: start + size})
+			}
+			if mfe, err := m.GetFileSetFileByName(fe.EntryID); err == nil {
+				addVTables(mfe)
+			}
+		}
+		sort.Slice(kexts, func(i, j int) bool { return kexts[i].start < kexts[j].start })
+	}
+	kextOf := func(addr uint64) string {
+		i := sort.Search(len(kexts), func(i int) bool { return kexts[i].end > addr })
+		if i < len(kexts) && kexts[i].start <= addr {
+			return kexts[i].id
+		}
+		return ""
+	}
+
+	var aps []AuthPointer
+	fixups := make(map[uint64]bool)
+	for _, start := range dcf.Starts {
+		for _, f := range start.Fixups {
+			addr, err := m.GetVMAddress(f.Offset())
+			if err != nil {
+				continue
+			}
+			fixups[addr] = true
+			p := fixup.Decode(dcf.PointerFormat, f.Raw())
+			if !p.Auth || p.Bind {
+				continue
+			}
+			ap := AuthPointer{
+				Addr:      addr,
+				Target:    ptrs.SlidePointer(f.Raw()),
+				Kext:      kextOf(addr),
+				AddrDiv:   p.AddrDiv,
+				Diversity: uint16(p.Diversity),
+			}
+			if int(p.Key) < len(PACKeys) {
+				ap.Key = PACKeys[p.Key]
+			}
+			if sec := m.FindSectionForVMAddr(addr); sec != nil {
+				ap.Section = sec.Seg + "." + sec.Name
+			}
+			aps = append(aps, ap)
+		}
+	}
+	sort.Slice(aps, func(i, j int) bool { return aps[i].Addr < aps[j].Addr })
+	assignVTables(aps, vtables, fixups)
+	return aps, nil
+}
+
+// assignVTables sets the vtable (and method index) of the IA signed pointers in vtables: the ones that follow a
+// vtable symbol or, for stripped kernelcaches, that are a run of methods that follows the two (non pointer)
+// offset-to-top and RTTI slots
+func assignVTables(aps []AuthPointer, vtables map[uint64]string, fixups map[uint64]bool) {
+	isMethod := func(i int) bool {
+		return aps[i].Key == "IA" && aps[i].AddrDiv
+	}
+	for i := 0; i < len(aps); {
+		if !isMethod(i) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(aps) && isMethod(j) && aps[j].Addr == aps[j-1].Addr+8 && len(vtables[aps[j].Addr]) == 0 {
+			j++
+		}
+		name := vtables[aps[i].Addr]
+		if len(name) == 0 && j-i >= vtableMinMethods && !fixups[aps[i].Addr-8] && !fixups[aps[i].Addr-16] {
+			name = fmt.Sprintf("vtable_%x", aps[i].Addr-16)
+		}
+		if len(name) > 0 {
+			for k := i; k < j; k++ {
+				aps[k].VTable, aps[k].Index = name, k-i
+			}
+		}
+		i = j
+	}
+}
+
+// AuthPointerQuery selects authenticated pointers (every set field must match)
+type AuthPointerQuery struct {
+	Kext      string // the bundle ID (or its suffix i.e. AppleMobileFileIntegrity)
+	Key       string // IA, IB, DA or DB
+	Diversity *uint16
+	VTable    string // a substring of the vtable name
+}
+
+// Match returns true if the pointer matches the query
+func (q *AuthPointerQuery) Match(p *AuthPointer) bool {
+	if len(q.Kext) > 0 && p.Kext != q.Kext && !strings.HasSuffix(p.Kext, "."+q.Kext) {
+		return false
+	}
+	if len(q.Key) > 0 && !strings.EqualFold(p.Key, q.Key) {
+		return false
+	}
+	if q.Diversity != nil && p.Diversity != *q.Diversity {
+		return false
+	}
+	if len(q.VTable) > 0 && !strings.Contains(p.VTable, q.VTable) {
+		return false
+	}
+	return true
+}
+
+// QueryAuthPointers returns the pointers that match the query
+func QueryAuthPointers(aps []AuthPointer, q *AuthPointerQuery) []AuthPointer {
+	var out []AuthPointer
+	for i := range aps {
+		if q.Match(&aps[i]) {
+			out = append(out, aps[i])
+		}
+	}
+	return out
+}
+
+// AuthPointerStats are the number of authenticated pointers of a kext by key and (unique) diversity
+type AuthPointerStats struct {
+	Kext        string         `json:"kext"`
+	Count       int            `json:"count"`
+	Keys        map[string]int `json:"keys"`
+	AddrDiv     int            `json:"addr_div"`
+	Diversities int            `json:"diversities"` // the number of unique diversity values
+	VTables     int            `json:"vtables"`
+}
+
+// AuthPointerSummary returns the authenticated pointer statistics of each kext (sorted by bundle ID)
+func AuthPointerSummary(aps []AuthPointer) []AuthPointerStats {
+	stats := make(map[string]*AuthPointerStats)
+	divs := make(map[string]map[uint16]bool)
+	vts := make(map[string]map[string]bool)
+	for _, p := range aps {
+		s, ok := stats[p.Kext]
+		if !ok {
+			s = &AuthPointerStats{Kext: p.Kext, Keys: make(map[string]int)}
+			stats[p.Kext] = s
+			divs[p.Kext] = make(map[uint16]bool)
+			vts[p.Kext] = make(map[string]bool)
+		}
+		s.Count++
+		s.Keys[p.Key]++
+		if p.AddrDiv {
+			s.AddrDiv++
+		}
+		divs[p.Kext][p.Diversity] = true
+		if len(p.VTable) > 0 {
+			vts[p.Kext][p.VTable] = true
+		}
+	}
+	var out []AuthPointerStats
+	for kext, s := range stats {
+		s.Diversities = len(divs[kext])
+		s.VTables = len(vts[kext])
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kext < out[j].Kext })
+	return out
+}
+
+// ptrauthSipHashKey is the key of clang's stable SipHash used for ptrauth_string_discriminator()
+var ptrauthSipHashKey = [16]byte{0xb5, 0xd4, 0xc9, 0xeb, 0x79, 0x10, 0x4a, 0x79, 0x6f, 0xec, 0x8b, 0x1b, 0x42, 0x87, 0x81, 0xd4}
+
+// PtrAuthStringDiscriminator returns ptrauth_string_discriminator(s) (i.e. "pc" is 0x7481)
+//
+// NOTE: the vtable methods of arm64e C++ are signed with the discriminator of the method's (Itanium) mangled name
+func PtrAuthStringDiscriminator(s string) uint16 {
+	return uint16(sipHash24(ptrauthSipHashKey, []byte(s))%0xffff + 1)
+}
+
+// sipHash24 returns the SipHash-2-4 of the message
+func sipHash24(key [16]byte, msg []byte) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:])
+	k1 := binary.LittleEndian.Uint64(key[8:])
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13) ^ v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16) ^ v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21) ^ v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17) ^ v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+	compress := func(m uint64) {
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+	n := len(msg)
+	for ; len(msg) >= 8; msg = msg[8:] {
+		compress(binary.LittleEndian.Uint64(msg))
+	}
+	var last [8]byte
+	copy(last[:], msg)
+	last[7] = byte(n)
+	compress(binary.LittleEndian.Uint64(last[:]))
+	v2 ^= 0xff
+	for range 4 {
+		round()
+	}
+	return v0 ^ v1 ^ v2 ^ v3
+}
@@ -0,0 +1,56 @@
+package kernelcache
+
+import "testing"
+
+func TestAssignVTables(t *testing.T) {
+	method := func(addr uint64) AuthPointer {
+		return AuthPointer{Addr: addr, Key: "IA", AddrDiv: true, Kext: "com.apple.driver.AppleMobileFileIntegrity"}
+	}
+	aps := []AuthPointer{
+		method(0x1010), method(0x1018), method(0x1020), // stripped vtable at 0x1000
+		{Addr: 0x1040, Key: "DA", AddrDiv: true, Diversity: 0xc26d},
+		method(0x2010), method(0x2018), // named vtable (too short to be found in a stripped kernelcache)
+		method(0x3008), method(0x3010), method(0x3018), // preceded by a pointer (not a vtable)
+	}
+	fixups := map[uint64]bool{0x3000: true}
+	for _, ap := range aps {
+		fixups[ap.Addr] = true
+	}
+	assignVTables(aps, map[uint64]string{0x2010: "__ZTV9AMFIClass"}, fixups)
+
+	for i, want := range []struct {
+		vtable string
+		index  int
+	}{{"vtable_1000", 0}, {"vtable_1000", 1}, {"vtable_1000", 2}, {"", 0}, {"__ZTV9AMFIClass", 0}, {"__ZTV9AMFIClass", 1}, {"", 0}, {"", 0}, {"", 0}} {
+		if aps[i].VTable != want.vtable || aps[i].Index != want.index {
+			t.Errorf("aps[%d] = %s[%d]; want %s[%d]", i, aps[i].VTable, aps[i].Index, want.vtable, want.index)
+		}
+	}
+
+	div := uint16(0xc26d)
+	if got := QueryAuthPointers(aps, &AuthPointerQuery{Key: "da", Diversity: &div}); len(got) != 1 || got[0].Addr != 0x1040 {
+		t.Errorf("QueryAuthPointers() = %v", got)
+	}
+	if got := QueryAuthPointers(aps, &AuthPointerQuery{Kext: "AppleMobileFileIntegrity", VTable: "AMFI"}); len(got) != 2 {
+		t.Errorf("QueryAuthPointers(kext, vtable) = %v", got)
+	}
+	if stats := AuthPointerSummary(aps); len(stats) != 2 || stats[1].Count != 8 || stats[1].VTables != 2 || stats[1].Keys["IA"] != 8 {
+		t.Errorf("AuthPointerSummary() = %+v", stats)
+	}
+}
+
+func TestPtrAuthStringDiscriminator(t *testing.T) {
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	if got := sipHash24(key, nil); got != 0x726fdb47dd0e0e31 {
+		t.Errorf("sipHash24() = %#x, want the reference 0x726fdb47dd0e0e31", got)
+	}
+	// the thread state discriminators of XNU
+	for s, want := range map[string]uint16{"pc": 0x7481, "lr": 0x77d3, "sp": 0xcbed, "fp": 0x4517} {
+		if got := PtrAuthStringDiscriminator(s); got != want {
+			t.Errorf("PtrAuthStringDiscriminator(%q) = %#x, want %#x", s, got, want)
+		}
+	}
+}
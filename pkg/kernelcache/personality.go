@@ -0,0 +1,164 @@
+package kernelcache
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// Personality is an IOKit matching personality of a kext (from its IOKitPersonalities)
+type Personality struct {
+	Kext            string `json:"kext"`
+	Name            string `json:"name"`
+	IOClass         string `json:"io_class,omitempty"`
+	IOProviderClass string `json:"io_provider_class,omitempty"`
+	IOUserClass     string `json:"io_user_class,omitempty"`
+	IOMatchCategory string `json:"io_match_category,omitempty"`
+	// Properties are the flattened personality properties (nested dictionaries' keys are joined with '.',
+	// i.e. IOPropertyMatch.compatible)
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+func (p Personality) String() string {
+	var props []string
+	for _, prop := range []struct{ key, val string }{
+		{"IOClass", p.IOClass},
+		{"IOProviderClass", p.IOProviderClass},
+		{"IOUserClass", p.IOUserClass},
+		{"IOMatchCategory", p.IOMatchCategory},
+	} {
+		if prop.val != "" {
+			props = append(props, fmt.Sprintf("%s=%s", prop.key, prop.val))
+		}
+	}
+	return fmt.Sprintf("%s: %s %s", p.Kext, p.Name, strings.Join(props, " "))
+}
+
+func flattenProps(prefix string, v any, out map[string]any) {
+	if dict, ok := v.(map[string]any); ok && len(dict) > 0 {
+		for k, v := range dict {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flattenProps(k, v, out)
+		}
+		return
+	}
+	out[prefix] = v
+}
+
+// Personalities returns the bundle's IOKit personalities (sorted by name)
+func (b *CFBundle) Personalities() []Personality {
+	var ps []Personality
+	for name, v := range b.IOKitPersonalities {
+		p := Personality{Kext: b.ID, Name: name, Properties: make(map[string]any)}
+		if dict, ok := v.(map[string]any); ok {
+			flattenProps("", dict, p.Properties)
+		}
+		p.IOClass, _ = p.Properties["IOClass"].(string)
+		p.IOProviderClass, _ = p.Properties["IOProviderClass"].(string)
+		p.IOUserClass, _ = p.Properties["IOUserClass"].(string)
+		p.IOMatchCategory, _ = p.Properties["IOMatchCategory"].(string)
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+	return ps
+}
+
+// GetPersonalities returns the IOKit personalities of every kext in the kernelcache
+func GetPersonalities(m *macho.File) ([]Personality, error) {
+	bundles, err := GetPrelinkInfo(m)
+	if err != nil {
+		return nil, err
+	}
+	var ps []Personality
+	for i := range bundles {
+		ps = append(ps, bundles[i].Personalities()...)
+	}
+	return ps, nil
+}
+
+// PersonalityQuery selects IOKit personalities (every set field must match; the values are globs)
+type PersonalityQuery struct {
+	IOClass         string
+	IOProviderClass string
+	// Match is a KEY=VALUE (or KEY) glob matched against the flattened properties; array values match if any
+	// element matches (i.e. IONameMatch=apple,spmi or IOPropertyMatch.*=*)
+	Match string
+}
+
+func (q *PersonalityQuery) validate() error {
+	for _, glob := range []string{q.IOClass, q.IOProviderClass, q.Match} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return errcode.Errorf(errcode.InvalidArgument, "invalid personality query glob %q: %v", glob, err)
+		}
+	}
+	if key, _, _ := strings.Cut(q.Match, "="); strings.Contains(q.Match, "=") && key == "" {
+		return errcode.Errorf(errcode.InvalidArgument, "invalid personality query %q (must be KEY or KEY=VALUE)", q.Match)
+	}
+	return nil
+}
+
+func globMatch(glob, s string) bool {
+	ok, _ := path.Match(glob, s)
+	return ok
+}
+
+func valueMatch(glob string, v any) bool {
+	switch v := v.(type) {
+	case []any:
+		for _, e := range v {
+			if valueMatch(glob, e) {
+				return true
+			}
+		}
+		return false
+	case []byte:
+		return globMatch(glob, strings.TrimRight(string(v), "\x00"))
+	case nil:
+		return false
+	default:
+		return globMatch(glob, fmt.Sprint(v))
+	}
+}
+
+// Matches returns true if the personality matches the query
+func (p *Personality) Matches(q *PersonalityQuery) bool {
+	if q.IOClass != "" && !globMatch(q.IOClass, p.IOClass) && !globMatch(q.IOClass, p.IOUserClass) {
+		return false
+	}
+	if q.IOProviderClass != "" && !globMatch(q.IOProviderClass, p.IOProviderClass) {
+		return false
+	}
+	if q.Match == "" {
+		return true
+	}
+	key, value, hasValue := strings.Cut(q.Match, "=")
+	for k, v := range p.Properties {
+		if globMatch(key, k) && (!hasValue || valueMatch(value, v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryPersonalities returns the personalities that match the query
+func QueryPersonalities(ps []Personality, q *PersonalityQuery) ([]Personality, error) {
+	if q == nil {
+		return ps, nil
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	var out []Personality
+	for i := range ps {
+		if ps[i].Matches(q) {
+			out = append(out, ps[i])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+package kernelcache
+
+import (
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+func TestPersonalities(t *testing.T) {
+	bundles := []CFBundle{
+		{ID: "com.apple.driver.AppleSPMI", IOKitPersonalities: map[string]any{
+			"AppleSPMI": map[string]any{
+				"IOClass":         "AppleSPMIController",
+				"IOProviderClass": "AppleARMIODevice",
+				"IONameMatch":     []any{"apple,spmi", "apple,spmi-v2"},
+			},
+		}},
+		{ID: "com.apple.iokit.IOUSBHostFamily", IOKitPersonalities: map[string]any{
+			"AppleUSBHostCompositeDevice": map[string]any{
+				"IOClass":         "AppleUSBHostCompositeDevice",
+				"IOProviderClass": "IOUSBHostDevice",
+				"IOPropertyMatch": map[string]any{"bDeviceClass": uint64(0)},
+			},
+		}},
+	}
+	var ps []Personality
+	for i := range bundles {
+		ps = append(ps, bundles[i].Personalities()...)
+	}
+	if ps[1].Properties["IOPropertyMatch.bDeviceClass"] != uint64(0) {
+		t.Errorf("Properties = %v (not flattened)", ps[1].Properties)
+	}
+
+	for q, want := range map[PersonalityQuery]string{
+		{IOProviderClass: "AppleARM*"}:                        "com.apple.driver.AppleSPMI",
+		{IOClass: "AppleUSBHost*"}:                            "com.apple.iokit.IOUSBHostFamily",
+		{Match: "IONameMatch=apple,spmi-v2"}:                  "com.apple.driver.AppleSPMI",
+		{Match: "IOPropertyMatch.bDeviceClass=0"}:             "com.apple.iokit.IOUSBHostFamily",
+		{Match: "IOPropertyMatch.*"}:                          "com.apple.iokit.IOUSBHostFamily",
+		{IOClass: "AppleSPMI*", Match: "IONameMatch=apple,*"}: "com.apple.driver.AppleSPMI",
+	} {
+		got, err := QueryPersonalities(ps, &q)
+		if err != nil || len(got) != 1 || got[0].Kext != want {
+			t.Errorf("QueryPersonalities(%+v) = %v, %v; want %s", q, got, err, want)
+		}
+	}
+	if got, _ := QueryPersonalities(ps, &PersonalityQuery{Match: "IONameMatch=apple,pmgr"}); len(got) != 0 {
+		t.Errorf("QueryPersonalities() = %v; want none", got)
+	}
+	if _, err := QueryPersonalities(ps, &PersonalityQuery{Match: "=foo"}); errcode.Of(err) != errcode.InvalidArgument {
+		t.Errorf("QueryPersonalities(=foo) err = %v; want InvalidArgument", err)
+	}
+}
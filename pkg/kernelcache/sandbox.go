@@ -0,0 +1,249 @@
+package kernelcache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache/fixup"
+)
+
+const sandboxKextID = "com.apple.security.sandbox"
+
+// sandboxKext returns the Sandbox.kext MachO (or the kernelcache itself if it isn't a MH_FILESET)
+func sandboxKext(m *macho.File) (*macho.File, error) {
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		return m, nil
+	}
+	kext, err := m.GetFileSetFileByName(sandboxKextID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fileset entry %s: %v", sandboxKextID, err)
+	}
+	return kext, nil
+}
+
+// SandboxOperation is an operation in the Sandbox.kext's operation table
+type SandboxOperation struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Category string `json:"category"` // i.e. file, mach, iokit, network or process
+}
+
+// sandboxOpCategory returns the category of an operation name (the part before the first '-' or '*')
+func sandboxOpCategory(name string) string {
+	if i := strings.IndexAny(name, "-*"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// sandboxOpTableSymbols are the symbols of the operation names table (exported by newer fileset Sandbox.kexts)
+var sandboxOpTableSymbols = []string{"_operation_names", "_sandbox_operation_names"}
+
+// kextSymbolAddress returns the address of a symbol in the kext's symtab or exports trie
+func kextSymbolAddress(kext *macho.File, name string) (uint64, bool) {
+	if kext.Symtab != nil {
+		for _, sym := range kext.Symtab.Syms {
+			if sym.Name == name && sym.Value != 0 {
+				return sym.Value, true
+			}
+		}
+	}
+	if exports, err := kext.GetExports(); err == nil {
+		for _, exp := range exports {
+			if exp.Name == name {
+				return exp.Address, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// readSandboxOpNames reads the operation name pointers at addr until they stop pointing to C strings
+func readSandboxOpNames(kext *macho.File, ptrs *fixup.Decoder, addr uint64, isCString func(uint64) bool) []string {
+	var ops []string
+	for ; ; addr += 8 {
+		ptr, err := kext.GetPointerAtAddress(addr)
+		if err != nil {
+			break
+		}
+		ptr = ptrs.SlidePointer(ptr)
+		if !isCString(ptr) {
+			break
+		}
+		name, err := kext.GetCString(ptr)
+		if err != nil || len(name) == 0 {
+			break
+		}
+		ops = append(ops, name)
+	}
+	return ops
+}
+
+// sandboxOpNames returns the sandbox operation names (in operation table order)
+//
+// NOTE: the table is found via the Sandbox.kext's _operation_names symbol/export or, for stripped kernelcaches, by
+// locating the pointers to the "default" operation name (always the first operation) in its __const sections and
+// reading the following pointers until they stop pointing to C strings (the longest table wins)
+func sandboxOpNames(ctx context.Context, kext *macho.File, ptrs *fixup.Decoder) ([]string, error) {
+	var cstrs []*types.Section
+	for _, sec := range kext.Sections {
+		if sec.Flags.IsCstringLiterals() || (sec.Seg == "__TEXT" && sec.Name == "__cstring") {
+			cstrs = append(cstrs, sec)
+		}
+	}
+	if len(cstrs) == 0 {
+		return nil, errcode.Errorf(errcode.MissingSection, "failed to find a C string section in %s", sandboxKextID)
+	}
+	isCString := func(addr uint64) bool {
+		for _, sec := range cstrs {
+			if addr >= sec.Addr && addr < sec.Addr+sec.Size {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, name := range sandboxOpTableSymbols {
+		if addr, ok := kextSymbolAddress(kext, name); ok {
+			if ops := readSandboxOpNames(kext, ptrs, addr, isCString); len(ops) > 0 && ops[0] == "default" {
+				log.WithField("count", len(ops)).Debugf("Found sandbox operation names at %s (%#x)", name, addr)
+				return ops, nil
+			}
+		}
+	}
+
+	defaults := make(map[uint64]bool)
+	for _, sec := range cstrs {
+		dat, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+		}
+		for off := 0; off < len(dat); {
+			end := off
+			for end < len(dat) && dat[end] != 0 {
+				end++
+			}
+			if string(dat[off:end]) == "default" {
+				defaults[sec.Addr+uint64(off)] = true
+			}
+			off = end + 1
+		}
+	}
+	if len(defaults) == 0 {
+		return nil, errcode.Errorf(errcode.NotFound, "failed to find 'default' sandbox operation name")
+	}
+
+	var ops []string
+	var start uint64
+	for _, sec := range kext.Sections {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if sec.Name != "__const" || sec.Size < 8 {
+			continue
+		}
+		dat, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		for off := 0; off+8 <= len(dat); off += 8 {
+			if !defaults[ptrs.SlidePointer(binary.LittleEndian.Uint64(dat[off:]))] {
+				continue
+			}
+			if names := readSandboxOpNames(kext, ptrs, sec.Addr+uint64(off), isCString); len(names) > len(ops) {
+				ops, start = names, sec.Addr+uint64(off)
+			}
+		}
+	}
+	if len(ops) == 0 {
+		return nil, errcode.Errorf(errcode.NotFound, "failed to find sandbox operation names table")
+	}
+	log.WithField("count", len(ops)).Debugf("Found sandbox operation names at %#x", start)
+	return ops, nil
+}
+
+// GetSandboxOpts returns the sandbox operations (in operation table order)
+func GetSandboxOpts(m *macho.File) ([]SandboxOperation, error) {
+	return GetSandboxOptsContext(context.Background(), m)
+}
+
+// GetSandboxOptsContext is like GetSandboxOpts but stops (returning ctx.Err()) once the context is done
+func GetSandboxOptsContext(ctx context.Context, m *macho.File) ([]SandboxOperation, error) {
+	kext, err := sandboxKext(m)
+	if err != nil {
+		return nil, err
+	}
+	names, err := sandboxOpNames(ctx, kext, fixup.New(m))
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]SandboxOperation, 0, len(names))
+	for i, name := range names {
+		ops = append(ops, SandboxOperation{Index: i, Name: name, Category: sandboxOpCategory(name)})
+	}
+	return ops, nil
+}
+
+// GetSandboxProfiles returns the decompiled builtin sandbox profile collection and platform profile of the kernelcache
+//
+// NOTE: the compiled profiles are found by scanning Sandbox.kext's __const sections for data that parses
+// as a profile collection (or bundled profile) with an operation table matching the kext's operation names
+func GetSandboxProfiles(m *macho.File) ([]Profile, error) {
+	return GetSandboxProfilesContext(context.Background(), m)
+}
+
+// GetSandboxProfilesContext is like GetSandboxProfiles but stops (returning ctx.Err()) once the context is done
+func GetSandboxProfilesContext(ctx context.Context, m *macho.File) ([]Profile, error) {
+	kext, err := sandboxKext(m)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := sandboxOpNames(ctx, kext, fixup.New(m))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sandbox operations: %w", err)
+	}
+
+	var profiles []Profile
+	var foundCollection, foundPlatform bool
+	for _, sec := range kext.Sections {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if sec.Name != "__const" || sec.Size < 8 {
+			continue
+		}
+		dat, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+		}
+		for off := 0; off+8 <= len(dat) && !(foundCollection && foundPlatform); off += 8 {
+			if !foundCollection {
+				if profs, err := parseSandboxCollection(dat[off:], ops); err == nil {
+					log.WithField("profiles", len(profs)).Debugf("Found builtin sandbox profile collection at %#x", sec.Addr+uint64(off))
+					profiles = append(profiles, profs...)
+					foundCollection = true
+					off += (10 + len(profs)*(4+2*len(ops))) &^ 7 // skip the profile records (so they aren't mistaken for a bundled profile)
+					continue
+				}
+			}
+			if !foundPlatform {
+				if prof, err := parseSandboxBundle("platform", dat[off:], ops); err == nil {
+					log.Debugf("Found platform sandbox profile at %#x", sec.Addr+uint64(off))
+					profiles = append(profiles, *prof)
+					foundPlatform = true
+				}
+			}
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("failed to find any compiled sandbox profiles in %s", sandboxKextID)
+	}
+
+	return profiles, nil
+}
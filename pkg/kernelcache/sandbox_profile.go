@@ -0,0 +1,495 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+ * Compiled sandbox profile format
+ *
+ * All offsets are u16s scaled by 8 (relative to the start of the blob).
+ *
+ * bundled profile (a single profile, i.e. the platform profile):
+ *     u16 regex_table_offset
+ *     u16 regex_count
+ *     u16 op_table[op_count]            (offsets of each operation's root node)
+ *
+ * profile collection (the builtin profiles):
+ *     u16 regex_table_offset
+ *     u16 regex_count
+ *     u16 var_table_offset              (global variables, skipped)
+ *     u16 var_count
+ *     u16 profile_count
+ *     profile_count * {
+ *         u16 name_offset
+ *         u16 version
+ *         u16 op_table[op_count]
+ *     }
+ *
+ * nodes are 8 bytes:
+ *     terminal:     u8 1, u8 pad, u16 action (bit 0 set is deny), u32 modifiers
+ *     non-terminal: u8 0, u8 filter, u16 filter_arg, u16 match, u16 unmatch
+ *
+ * strings (and the compiled AppleMatch regexes) are stored as a u32 length followed by the data
+ */
+
+const (
+	sbNodeSize        = 8
+	sbNodeNonTerminal = 0
+	sbNodeTerminal    = 1
+	sbActionDeny      = 1
+	sbRegexFilter     = 0x80 // string filters with this bit set take a regex table index
+
+	sbMaxDepth = 256  // max filter chain depth walked per operation
+	sbMaxRules = 4096 // max rules decompiled per operation
+)
+
+// SandboxAction is the result of a sandbox operation check
+type SandboxAction string
+
+const (
+	SandboxAllow SandboxAction = "allow"
+	SandboxDeny  SandboxAction = "deny"
+)
+
+// SandboxRule is a decompiled SBPL rule
+type SandboxRule struct {
+	Action    SandboxAction `json:"action"`
+	Operation string        `json:"operation"`
+	Filters   []string      `json:"filters,omitempty"` // SBPL filter expressions (all must match)
+}
+
+func (r SandboxRule) String() string {
+	switch len(r.Filters) {
+	case 0:
+		return fmt.Sprintf("(%s %s)", r.Action, r.Operation)
+	case 1:
+		return fmt.Sprintf("(%s %s %s)", r.Action, r.Operation, r.Filters[0])
+	default:
+		return fmt.Sprintf("(%s %s (require-all %s))", r.Action, r.Operation, strings.Join(r.Filters, " "))
+	}
+}
+
+// Profile is a decompiled sandbox profile
+type Profile struct {
+	Name    string        `json:"name"`
+	Version uint16        `json:"version,omitempty"`
+	Default SandboxAction `json:"default"`
+	Rules   []SandboxRule `json:"rules,omitempty"`
+}
+
+// String returns the SBPL-like source of the profile
+func (p Profile) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, ";; %s\n(version 1)\n(%s default)\n", p.Name, p.Default)
+	for _, r := range p.Rules {
+		sb.WriteString(r.String() + "\n")
+	}
+	return sb.String()
+}
+
+type sbFilterKind int
+
+const (
+	sbArgString sbFilterKind = iota
+	sbArgInt
+	sbArgBool
+)
+
+type sbFilter struct {
+	name string
+	kind sbFilterKind
+}
+
+var sbFilters = map[uint8]sbFilter{
+	0x01: {"literal", sbArgString},
+	0x02: {"mount-relative-path", sbArgString},
+	0x03: {"xattr", sbArgString},
+	0x04: {"file-mode", sbArgInt},
+	0x05: {"ipc-posix-name", sbArgString},
+	0x06: {"global-name", sbArgString},
+	0x07: {"local-name", sbArgString},
+	0x08: {"local", sbArgString},
+	0x09: {"remote", sbArgString},
+	0x0a: {"control-name", sbArgString},
+	0x0b: {"socket-domain", sbArgInt},
+	0x0c: {"socket-type", sbArgInt},
+	0x0d: {"socket-protocol", sbArgInt},
+	0x0e: {"target", sbArgInt},
+	0x0f: {"fsctl-command", sbArgInt},
+	0x10: {"ioctl-command", sbArgInt},
+	0x11: {"iokit-user-client-class", sbArgString},
+	0x12: {"iokit-property", sbArgString},
+	0x13: {"iokit-connection", sbArgString},
+	0x14: {"device-major", sbArgInt},
+	0x15: {"device-minor", sbArgInt},
+	0x16: {"device-conforms-to", sbArgString},
+	0x17: {"extension", sbArgString},
+	0x18: {"extension-class", sbArgString},
+	0x19: {"appleevent-destination", sbArgString},
+	0x1a: {"debug-mode", sbArgBool},
+	0x1b: {"right-name", sbArgString},
+	0x1c: {"preference-domain", sbArgString},
+	0x1d: {"vnode-type", sbArgInt},
+	0x1e: {"require-entitlement", sbArgString},
+	0x1f: {"entitlement-is-present", sbArgString},
+	0x20: {"kext-bundle-id", sbArgString},
+	0x21: {"info-type", sbArgString},
+	0x22: {"notification-name", sbArgString},
+	0x23: {"notification-payload", sbArgString},
+	0x24: {"semaphore-owner", sbArgInt},
+	0x25: {"sysctl-name", sbArgString},
+	0x26: {"process-name", sbArgString},
+	0x27: {"rootless-boot-device-filter", sbArgString},
+	0x28: {"rootless-file-filter", sbArgString},
+	0x29: {"rootless-disk-filter", sbArgString},
+	0x2a: {"rootless-proc-filter", sbArgString},
+	0x2b: {"privilege-id", sbArgInt},
+	0x2c: {"process-attribute", sbArgInt},
+	0x2d: {"uid", sbArgInt},
+	0x2e: {"nvram-variable", sbArgString},
+	0x2f: {"csr", sbArgInt},
+	0x30: {"host-special-port", sbArgInt},
+	0x31: {"filesystem-name", sbArgString},
+	0x32: {"boot-arg", sbArgString},
+	0x33: {"xpc-service-name", sbArgString},
+	0x34: {"signing-identifier", sbArgString},
+	0x35: {"signal-number", sbArgInt},
+	0x36: {"target-signing-identifier", sbArgString},
+	0x37: {"reference", sbArgString},
+}
+
+var vnodeTypes = map[uint16]string{
+	1:      "REGULAR-FILE",
+	2:      "DIRECTORY",
+	3:      "BLOCK-DEVICE",
+	4:      "CHARACTER-DEVICE",
+	5:      "SYMLINK",
+	6:      "SOCKET",
+	7:      "FIFO",
+	0xffff: "TTY",
+}
+
+type sbNode struct {
+	terminal bool
+	action   SandboxAction
+	filter   uint8
+	arg      uint16
+	match    uint16
+	unmatch  uint16
+}
+
+// sbCond is a filter on the path to a terminal node
+type sbCond struct {
+	node    uint16
+	expr    string
+	negated bool
+	match   uint16 // the node's match branch (negations only matter if it can reach another action)
+}
+
+type sbProfileParser struct {
+	data    []byte
+	ops     []string
+	regexes []uint16
+	reached map[uint16]uint8 // node -> bitmask of the actions its subtree can reach
+}
+
+func (p *sbProfileParser) u16(off int) (uint16, error) {
+	if off < 0 || off+2 > len(p.data) {
+		return 0, fmt.Errorf("offset %#x out of bounds", off)
+	}
+	return binary.LittleEndian.Uint16(p.data[off:]), nil
+}
+
+func (p *sbProfileParser) blob(scaled uint16) ([]byte, error) {
+	off := int(scaled) * 8
+	if off+4 > len(p.data) {
+		return nil, fmt.Errorf("blob offset %#x out of bounds", off)
+	}
+	size := int(binary.LittleEndian.Uint32(p.data[off:]))
+	if size > len(p.data)-off-4 {
+		return nil, fmt.Errorf("blob at %#x has invalid length %d", off, size)
+	}
+	return p.data[off+4 : off+4+size], nil
+}
+
+func (p *sbProfileParser) str(scaled uint16) (string, error) {
+	dat, err := p.blob(scaled)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(dat), "\x00"), nil
+}
+
+func (p *sbProfileParser) node(scaled uint16) (sbNode, error) {
+	off := int(scaled) * sbNodeSize
+	if off+sbNodeSize > len(p.data) {
+		return sbNode{}, fmt.Errorf("node offset %#x out of bounds", off)
+	}
+	dat := p.data[off : off+sbNodeSize]
+	switch dat[0] {
+	case sbNodeTerminal:
+		n := sbNode{terminal: true, action: SandboxAllow}
+		if binary.LittleEndian.Uint16(dat[2:])&sbActionDeny != 0 {
+			n.action = SandboxDeny
+		}
+		return n, nil
+	case sbNodeNonTerminal:
+		return sbNode{
+			filter:  dat[1],
+			arg:     binary.LittleEndian.Uint16(dat[2:]),
+			match:   binary.LittleEndian.Uint16(dat[4:]),
+			unmatch: binary.LittleEndian.Uint16(dat[6:]),
+		}, nil
+	default:
+		return sbNode{}, fmt.Errorf("invalid node type %#x at %#x", dat[0], off)
+	}
+}
+
+// validOpTable returns true if all the operations' root nodes are valid nodes
+func (p *sbProfileParser) validOpTable(off int) bool {
+	for i := range p.ops {
+		scaled, err := p.u16(off + i*2)
+		if err != nil || int(scaled)*sbNodeSize < off+len(p.ops)*2 {
+			return false
+		}
+		n, err := p.node(scaled)
+		if err != nil {
+			return false
+		}
+		if !n.terminal {
+			if _, err := p.node(n.match); err != nil {
+				return false
+			}
+			if _, err := p.node(n.unmatch); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *sbProfileParser) parseRegexTable() error {
+	reOff, err := p.u16(0)
+	if err != nil {
+		return err
+	}
+	reCount, err := p.u16(2)
+	if err != nil {
+		return err
+	}
+	p.regexes = nil
+	for i := 0; i < int(reCount); i++ {
+		scaled, err := p.u16(int(reOff)*8 + i*2)
+		if err != nil {
+			return fmt.Errorf("failed to read regex table: %v", err)
+		}
+		p.regexes = append(p.regexes, scaled)
+	}
+	return nil
+}
+
+func (p *sbProfileParser) filterExpr(n sbNode) string {
+	f, ok := sbFilters[n.filter&^sbRegexFilter]
+	if !ok {
+		return fmt.Sprintf("(filter-%#x %#x)", n.filter, n.arg)
+	}
+	if n.filter&sbRegexFilter != 0 {
+		name := f.name + "-regex"
+		if f.name == "literal" {
+			name = "regex"
+		}
+		// NOTE: the compiled AppleMatch NFAs aren't decompiled (yet) so regexes are referenced by their table index
+		return fmt.Sprintf("(%s #\"<regex %d>\")", name, n.arg)
+	}
+	switch f.kind {
+	case sbArgString:
+		s, err := p.str(n.arg)
+		if err != nil {
+			return fmt.Sprintf("(%s #%#x)", f.name, n.arg)
+		}
+		return fmt.Sprintf("(%s %q)", f.name, s)
+	case sbArgBool:
+		if n.arg != 0 {
+			return fmt.Sprintf("(%s #t)", f.name)
+		}
+		return fmt.Sprintf("(%s #f)", f.name)
+	default:
+		if f.name == "vnode-type" {
+			if vt, ok := vnodeTypes[n.arg]; ok {
+				return fmt.Sprintf("(%s %s)", f.name, vt)
+			}
+		}
+		return fmt.Sprintf("(%s %d)", f.name, n.arg)
+	}
+}
+
+func actionBit(a SandboxAction) uint8 {
+	if a == SandboxDeny {
+		return 2
+	}
+	return 1
+}
+
+// reachable returns the bitmask of the actions reachable from the node
+func (p *sbProfileParser) reachable(scaled uint16, depth int) uint8 {
+	if r, ok := p.reached[scaled]; ok {
+		return r
+	}
+	if depth > sbMaxDepth {
+		return 3
+	}
+	n, err := p.node(scaled)
+	if err != nil {
+		return 0
+	}
+	var r uint8
+	if n.terminal {
+		r = actionBit(n.action)
+	} else {
+		r = p.reachable(n.match, depth+1) | p.reachable(n.unmatch, depth+1)
+	}
+	p.reached[scaled] = r
+	return r
+}
+
+// walk collects the rules of the terminal nodes (with a different action than the default) reachable from the node
+func (p *sbProfileParser) walk(op string, scaled uint16, def SandboxAction, conds []sbCond, rules *[]SandboxRule) error {
+	if len(conds) > sbMaxDepth {
+		return fmt.Errorf("operation %s filter chain too deep", op)
+	}
+	if len(*rules) >= sbMaxRules {
+		return nil
+	}
+	n, err := p.node(scaled)
+	if err != nil {
+		return err
+	}
+	if n.terminal {
+		if n.action == def {
+			return nil
+		}
+		rule := SandboxRule{Action: n.action, Operation: op}
+		for _, c := range conds {
+			if !c.negated {
+				rule.Filters = append(rule.Filters, c.expr)
+			} else if p.reachable(c.match, 0)&^actionBit(n.action) != 0 {
+				// going down the unmatch branch only matters if the match branch leads somewhere else
+				rule.Filters = append(rule.Filters, fmt.Sprintf("(require-not %s)", c.expr))
+			}
+		}
+		*rules = append(*rules, rule)
+		return nil
+	}
+	for _, c := range conds {
+		if c.node == scaled { // guard against cycles
+			return fmt.Errorf("operation %s has a filter cycle at node %#x", op, scaled)
+		}
+	}
+	expr := p.filterExpr(n)
+	if err := p.walk(op, n.match, def, append(conds, sbCond{node: scaled, expr: expr, match: n.match}), rules); err != nil {
+		return err
+	}
+	return p.walk(op, n.unmatch, def, append(conds, sbCond{node: scaled, expr: expr, negated: true, match: n.match}), rules)
+}
+
+// decompile decompiles the profile with the operation table at off
+func (p *sbProfileParser) decompile(name string, version uint16, off int) (*Profile, error) {
+	prof := &Profile{Name: name, Version: version, Default: SandboxDeny}
+	if len(p.ops) == 0 {
+		return nil, fmt.Errorf("no sandbox operations")
+	}
+	roots := make([]uint16, len(p.ops))
+	for i := range p.ops {
+		scaled, err := p.u16(off + i*2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s operation table: %v", name, err)
+		}
+		roots[i] = scaled
+	}
+	// the first operation is 'default'
+	if n, err := p.node(roots[0]); err != nil {
+		return nil, fmt.Errorf("failed to read %s default operation: %v", name, err)
+	} else if n.terminal {
+		prof.Default = n.action
+	}
+	for i, root := range roots {
+		if i > 0 && root == roots[0] {
+			continue // inherits the default
+		}
+		if err := p.walk(p.ops[i], root, prof.Default, nil, &prof.Rules); err != nil {
+			return nil, fmt.Errorf("failed to decompile %s operation %s: %v", name, p.ops[i], err)
+		}
+	}
+	return prof, nil
+}
+
+var sbProfileNameRE = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+
+// parseSandboxCollection parses the profiles of a (builtin) profile collection
+func parseSandboxCollection(data []byte, ops []string) ([]Profile, error) {
+	p := &sbProfileParser{data: data, ops: ops, reached: make(map[uint16]uint8)}
+	count, err := p.u16(8)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count > 1024 {
+		return nil, fmt.Errorf("invalid profile count %d", count)
+	}
+	if err := p.parseRegexTable(); err != nil {
+		return nil, err
+	}
+	recSize := 4 + 2*len(ops)
+	var profiles []Profile
+	for i := 0; i < int(count); i++ {
+		off := 10 + i*recSize
+		nameOff, err := p.u16(off)
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.str(nameOff)
+		if err != nil || !sbProfileNameRE.MatchString(name) {
+			return nil, fmt.Errorf("invalid profile name at %#x", off)
+		}
+		version, err := p.u16(off + 2)
+		if err != nil {
+			return nil, err
+		}
+		if !p.validOpTable(off + 4) {
+			return nil, fmt.Errorf("invalid %s operation table", name)
+		}
+		prof, err := p.decompile(name, version, off+4)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *prof)
+	}
+	return profiles, nil
+}
+
+// parseSandboxBundle parses a single (bundled) profile
+func parseSandboxBundle(name string, data []byte, ops []string) (*Profile, error) {
+	p := &sbProfileParser{data: data, ops: ops, reached: make(map[uint16]uint8)}
+	if !p.validOpTable(4) {
+		return nil, fmt.Errorf("invalid operation table")
+	}
+	if err := p.parseRegexTable(); err != nil {
+		return nil, err
+	}
+	return p.decompile(name, 0, 4)
+}
+
+// ParseSandboxProfiles decompiles a compiled sandbox profile collection or bundled profile (named name)
+func ParseSandboxProfiles(name string, data []byte, ops []string) ([]Profile, error) {
+	if profiles, err := parseSandboxCollection(data, ops); err == nil {
+		return profiles, nil
+	}
+	prof, err := parseSandboxBundle(name, data, ops)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sandbox profile data: %v", err)
+	}
+	return []Profile{*prof}, nil
+}
@@ -0,0 +1,123 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// sbBlob is a compiled sandbox profile builder (everything is 8 byte aligned so offsets can be scaled)
+type sbBlob struct {
+	data []byte
+}
+
+func (b *sbBlob) align() {
+	for len(b.data)%8 != 0 {
+		b.data = append(b.data, 0)
+	}
+}
+
+func (b *sbBlob) put16(off int, v uint16) { binary.LittleEndian.PutUint16(b.data[off:], v) }
+
+func (b *sbBlob) str(s string) uint16 {
+	b.align()
+	off := len(b.data)
+	b.data = binary.LittleEndian.AppendUint32(b.data, uint32(len(s)+1))
+	b.data = append(append(b.data, s...), 0)
+	return uint16(off / 8)
+}
+
+func (b *sbBlob) terminal(deny bool) uint16 {
+	b.align()
+	off := len(b.data)
+	var action uint16
+	if deny {
+		action = sbActionDeny
+	}
+	b.data = append(b.data, sbNodeTerminal, 0)
+	b.data = binary.LittleEndian.AppendUint16(b.data, action)
+	b.data = append(b.data, 0, 0, 0, 0)
+	return uint16(off / 8)
+}
+
+func (b *sbBlob) filter(id uint8, arg, match, unmatch uint16) uint16 {
+	b.align()
+	off := len(b.data)
+	b.data = append(b.data, sbNodeNonTerminal, id)
+	for _, v := range []uint16{arg, match, unmatch} {
+		b.data = binary.LittleEndian.AppendUint16(b.data, v)
+	}
+	return uint16(off / 8)
+}
+
+var testOps = []string{"default", "file-read*", "mach-lookup"}
+
+// ops builds a profile where file-read* is allowed for /usr/lib and mach-lookup is
+// allowed for everything but com.apple.secret
+func (b *sbBlob) ops() []uint16 {
+	allow, deny := b.terminal(false), b.terminal(true)
+	read := b.filter(0x01, b.str("/usr/lib"), allow, deny)
+	lookup := b.filter(0x06, b.str("com.apple.secret"), deny, allow)
+	return []uint16{deny, read, lookup}
+}
+
+func checkProfile(t *testing.T, p Profile, name string) {
+	t.Helper()
+	if p.Name != name || p.Default != SandboxDeny {
+		t.Errorf("profile = %s (default %s)", p.Name, p.Default)
+	}
+	want := []string{
+		`(allow file-read* (literal "/usr/lib"))`,
+		`(allow mach-lookup (require-not (global-name "com.apple.secret")))`,
+	}
+	var got []string
+	for _, r := range p.Rules {
+		got = append(got, r.String())
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("%s rules = %q, want %q", name, got, want)
+	}
+}
+
+func TestParseSandboxCollection(t *testing.T) {
+	b := &sbBlob{data: make([]byte, 10+2*(4+2*len(testOps)))}
+	b.put16(8, 2)
+	for i, name := range []string{"container", "ProtectedTroubleshooting"} {
+		rec := 10 + i*(4+2*len(testOps))
+		b.put16(rec, b.str(name))
+		b.put16(rec+2, 1)
+		for j, op := range b.ops() {
+			b.put16(rec+4+j*2, op)
+		}
+	}
+	b.align()
+	b.put16(0, uint16(len(b.data)/8)) // empty regex table
+
+	profiles, err := ParseSandboxProfiles("platform", b.data, testOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("ParseSandboxProfiles() returned %d profiles, expected 2", len(profiles))
+	}
+	checkProfile(t, profiles[0], "container")
+	checkProfile(t, profiles[1], "ProtectedTroubleshooting")
+}
+
+func TestParseSandboxBundle(t *testing.T) {
+	b := &sbBlob{data: make([]byte, 4+2*len(testOps))}
+	for i, op := range b.ops() {
+		b.put16(4+i*2, op)
+	}
+	b.align()
+	b.put16(0, uint16(len(b.data)/8))
+
+	profiles, err := ParseSandboxProfiles("platform", b.data, testOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 {
+		t.Fatalf("ParseSandboxProfiles() returned %d profiles, expected 1", len(profiles))
+	}
+	checkProfile(t, profiles[0], "platform")
+}
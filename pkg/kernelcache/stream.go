@@ -0,0 +1,74 @@
+package kernelcache
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"golang.org/x/exp/mmap"
+)
+
+// DefaultWindowSize is the size of the windows that sections are streamed in
+const DefaultWindowSize = 1 << 20
+
+// StreamFile is a kernelcache MachO backed by a read-only memory mapping of its file
+type StreamFile struct {
+	*macho.File
+	ra *mmap.ReaderAt
+}
+
+// OpenStream opens a kernelcache (see Open) backed by a read-only memory mapping of the decompressed MachO so it
+// is paged in on demand (and can be evicted) instead of being read into the heap; combined with the windowed
+// section readers this keeps the memory of multi-GB macOS kernel collections flat
+func OpenStream(path string) (*StreamFile, error) {
+	machoPath, err := DecompressedPath(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	ra, err := mmap.Open(machoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mmap kernelcache %s: %w", path, err)
+	}
+	m, err := macho.NewFile(ra)
+	if err != nil {
+		ra.Close()
+		return nil, fmt.Errorf("failed to open kernelcache %s: %w", path, err)
+	}
+	return &StreamFile{File: m, ra: ra}, nil
+}
+
+// Close unmaps the kernelcache
+func (f *StreamFile) Close() error {
+	return f.ra.Close()
+}
+
+// ForEachWindow calls fn with consecutive windows (of size bytes) of the section's data until it returns false;
+// each window extends overlap bytes into the next one so patterns up to overlap bytes long that straddle two
+// windows are still seen whole. The window's data is only valid until fn returns
+func ForEachWindow(sec *types.Section, size, overlap int, fn func(addr uint64, data []byte) bool) error {
+	// NOTE: the section's embedded ReaderAt reads the whole file (not just the section)
+	r := io.NewSectionReader(sec.ReaderAt, int64(sec.Offset), int64(sec.Size))
+	if err := forEachWindow(r, sec.Addr, sec.Size, size, overlap, fn); err != nil {
+		return fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+	}
+	return nil
+}
+
+func forEachWindow(r io.ReaderAt, addr, length uint64, size, overlap int, fn func(addr uint64, data []byte) bool) error {
+	if size <= 0 {
+		size = DefaultWindowSize
+	}
+	buf := make([]byte, min(uint64(size+overlap), length))
+	for off := uint64(0); off < length; off += uint64(size) {
+		n := min(uint64(len(buf)), length-off)
+		if _, err := r.ReadAt(buf[:n], int64(off)); err != nil && err != io.EOF {
+			return err
+		}
+		if !fn(addr+off, buf[:n]) || off+n == length {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package kernelcache
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/fixture"
+)
+
+func TestForEachWindow(t *testing.T) {
+	data := make([]byte, 10000)
+	pattern := []byte("com.apple.driver.AppleMobileFileIntegrity")
+	copy(data[4090:], pattern) // straddles the first two windows
+
+	var found []uint64
+	var windows int
+	if err := forEachWindow(bytes.NewReader(data), 0x1000, uint64(len(data)), 4096, len(pattern), func(addr uint64, data []byte) bool {
+		windows++
+		if i := bytes.Index(data, pattern); i >= 0 {
+			found = append(found, addr+uint64(i))
+		}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if windows != 3 {
+		t.Errorf("windows = %d, want 3", windows)
+	}
+	if len(found) != 1 || found[0] != 0x1000+4090 {
+		t.Errorf("found = %#x, want [%#x]", found, 0x1000+4090)
+	}
+
+	windows = 0
+	if err := forEachWindow(bytes.NewReader(data), 0, uint64(len(data)), 4096, 0, func(uint64, []byte) bool {
+		windows++
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if windows != 1 {
+		t.Errorf("windows = %d after stopping, want 1", windows)
+	}
+}
+
+func TestForEachWindowSection(t *testing.T) {
+	kc := fixture.NewKernelcache()
+	kc.AddKext("com.apple.driver.FakeDriver", "1.0.0", "_fake_start")
+	path := filepath.Join(t.TempDir(), "kernelcache")
+	if err := kc.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	m, err := macho.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	kext, err := m.GetFileSetFileByName("com.apple.driver.FakeDriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := kext.Section("__DATA", "__data")
+	if sec == nil || sec.Offset == 0 {
+		t.Fatalf("fixture kext has no __DATA.__data (or it is at file offset 0): %v", sec)
+	}
+	want, err := sec.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	var start uint64
+	if err := ForEachWindow(sec, 16, 0, func(addr uint64, data []byte) bool {
+		if len(got) == 0 {
+			start = addr
+		}
+		got = append(got, data...)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if start != sec.Addr || !bytes.Equal(got, want) {
+		t.Errorf("ForEachWindow() streamed %d bytes from %#x, want the %d bytes of %s.%s at %#x", len(got), start, len(want), sec.Seg, sec.Name, sec.Addr)
+	}
+	if !bytes.Contains(got, []byte("com.apple.driver.FakeDriver")) {
+		t.Errorf("ForEachWindow() data doesn't contain the kext's kmod_info name")
+	}
+}
+
+// benchKernelcache writes a fixture kernelcache with as many kexts as a large kernel collection
+func benchKernelcache(b *testing.B) string {
+	b.Helper()
+	kc := fixture.NewKernelcache()
+	for i := 0; i < 500; i++ {
+		kc.AddKext(fmt.Sprintf("com.apple.driver.FakeDriver%d", i), "1.0.0", fmt.Sprintf("_fake%d_start", i))
+	}
+	path := filepath.Join(b.TempDir(), "kernelcache")
+	if err := kc.WriteFile(path); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkGetKexts(b *testing.B) {
+	path := benchKernelcache(b)
+	b.Run("Open", func(b *testing.B) { // the sections are read through the file (and into the heap by Data())
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m, err := Open(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := GetKexts(m); err != nil {
+				b.Fatal(err)
+			}
+			m.Close()
+		}
+	})
+	b.Run("OpenStream", func(b *testing.B) { // the sections are paged in from the memory mapping
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f, err := OpenStream(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := GetKexts(f.File); err != nil {
+				b.Fatal(err)
+			}
+			f.Close()
+		}
+	})
+}
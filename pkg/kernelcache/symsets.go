@@ -0,0 +1,243 @@
+package kernelcache
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+type symbolsSets struct {
+	SymbolsSetsDictionary []cFBundle `plist:"SymbolsSets,omitempty"`
+}
+
+type cFBundle struct {
+	ID                string      `plist:"CFBundleIdentifier,omitempty"`
+	CompatibleVersion string      `plist:"OSBundleCompatibleVersion,omitempty"`
+	Version           string      `plist:"CFBundleVersion,omitempty"`
+	Symbols           []setSymbol `plist:"Symbols,omitempty"`
+}
+
+type setSymbol struct {
+	Name   string `plist:"SymbolName,omitempty"`
+	Prefix string `plist:"SymbolPrefix,omitempty"`
+}
+
+// SymbolSet is a KPI symbol set (i.e. com.apple.kpi.bsd) that the kernel exports to kexts
+type SymbolSet struct {
+	ID                string   `json:"id"`
+	Version           string   `json:"version,omitempty"`
+	CompatibleVersion string   `json:"compatible_version,omitempty"`
+	Symbols           []string `json:"symbols,omitempty"`
+	Prefixes          []string `json:"prefixes,omitempty"` // every symbol starting with a prefix is exported
+}
+
+// Exports returns true if the symbol set exports the symbol
+func (s SymbolSet) Exports(sym string) bool {
+	if _, found := slices.BinarySearch(s.Symbols, sym); found {
+		return true
+	}
+	for _, prefix := range s.Prefixes {
+		if strings.HasPrefix(sym, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSymbolSets returns the KPI symbol sets in the kernel's __LINKINFO.__symbolsets (macOS kernel collections)
+func GetSymbolSets(m *macho.File) ([]SymbolSet, error) {
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		var err error
+		m, err = m.GetFileSetFileByName("com.apple.kernel")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse entry com.apple.kernel; %v", err)
+		}
+	}
+
+	sec := m.Section("__LINKINFO", "__symbolsets")
+	if sec == nil {
+		return nil, errcode.Errorf(errcode.MissingSection, "kernelcache does NOT contain __LINKINFO.__symbolsets")
+	}
+	dat, err := sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read __LINKINFO.__symbolsets data: %v", err)
+	}
+
+	var blist symbolsSets
+	if err := plist.NewDecoder(bytes.NewReader(dat)).Decode(&blist); err != nil {
+		return nil, fmt.Errorf("failed to parse __symbolsets bplist data: %v", err)
+	}
+
+	var sets []SymbolSet
+	for _, b := range blist.SymbolsSetsDictionary {
+		set := SymbolSet{
+			ID:                b.ID,
+			Version:           b.Version,
+			CompatibleVersion: b.CompatibleVersion,
+		}
+		for _, sym := range b.Symbols {
+			if len(sym.Prefix) > 0 {
+				set.Prefixes = append(set.Prefixes, sym.Prefix)
+			} else if len(sym.Name) > 0 {
+				set.Symbols = append(set.Symbols, sym.Name)
+			}
+		}
+		slices.Sort(set.Symbols)
+		set.Symbols = slices.Compact(set.Symbols)
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// KextLinkage is which KPI symbols a kext imports (and what it exports to other kexts)
+type KextLinkage struct {
+	ID      string              `json:"id"`
+	Exports []string            `json:"exports,omitempty"`
+	Imports []string            `json:"imports,omitempty"`
+	KPIs    map[string][]string `json:"kpis,omitempty"`  // symbol set ID → the imports it provides
+	Other   []string            `json:"other,omitempty"` // imports that aren't in a symbol set (i.e. exported by another kext)
+}
+
+// kextImports returns the undefined symbols (and chained fixup binds) of a kext
+func kextImports(m *macho.File) []string {
+	var imports []string
+	if syms, err := m.ImportedSymbols(); err == nil {
+		for _, sym := range syms {
+			imports = append(imports, sym.Name)
+		}
+	} else if m.Symtab != nil {
+		for _, sym := range m.Symtab.Syms {
+			if sym.Type.IsUndefinedSym() && sym.Type.IsExternalSym() {
+				imports = append(imports, sym.Name)
+			}
+		}
+	}
+	if m.HasFixups() {
+		if dcf, err := m.DyldChainedFixups(); err == nil {
+			for _, imp := range dcf.Imports {
+				imports = append(imports, imp.Name)
+			}
+		}
+	}
+	slices.Sort(imports)
+	return slices.Compact(imports)
+}
+
+// GetKextLinkage returns the KPI symbols each kext of a macOS kernel collection imports and the symbols it exports
+func GetKextLinkage(m *macho.File) ([]KextLinkage, error) {
+	if m.FileTOC.FileHeader.Type != types.MH_FILESET {
+		return nil, errcode.Errorf(errcode.Unsupported, "kext linkage requires an MH_FILESET kernel collection")
+	}
+
+	sets, err := GetSymbolSets(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var linkages []KextLinkage
+	for _, fe := range m.FileSets() {
+		if fe.EntryID == "com.apple.kernel" {
+			continue
+		}
+		mfe, err := m.GetFileSetFileByName(fe.EntryID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+		}
+		kl := KextLinkage{ID: fe.EntryID, Imports: kextImports(mfe), KPIs: make(map[string][]string)}
+		if mfe.Symtab != nil {
+			for _, sym := range mfe.Symtab.Syms {
+				if sym.Type.IsExternalSym() && !sym.Type.IsUndefinedSym() && !sym.Type.IsDebugSym() {
+					kl.Exports = append(kl.Exports, sym.Name)
+				}
+			}
+			slices.Sort(kl.Exports)
+			kl.Exports = slices.Compact(kl.Exports)
+		}
+		for _, imp := range kl.Imports {
+			found := false
+			for _, set := range sets {
+				if set.Exports(imp) {
+					kl.KPIs[set.ID] = append(kl.KPIs[set.ID], imp)
+					found = true
+				}
+			}
+			if !found {
+				kl.Other = append(kl.Other, imp)
+			}
+		}
+		linkages = append(linkages, kl)
+	}
+
+	sort.Slice(linkages, func(i, j int) bool { return linkages[i].ID < linkages[j].ID })
+
+	return linkages, nil
+}
+
+// SymbolSetDiff is the KPI surface change of a symbol set between two releases
+type SymbolSetDiff struct {
+	ID      string   `json:"id"`
+	New     []string `json:"new,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func setSymbols(s SymbolSet) []string {
+	syms := slices.Clone(s.Symbols)
+	for _, prefix := range s.Prefixes {
+		syms = append(syms, prefix+"*")
+	}
+	slices.Sort(syms)
+	return syms
+}
+
+// DiffSymbolSets returns the symbols that were added to or removed from each symbol set between two releases
+func DiffSymbolSets(prev, next []SymbolSet) []SymbolSetDiff {
+	old := make(map[string][]string)
+	for _, s := range prev {
+		old[s.ID] = append(old[s.ID], setSymbols(s)...)
+	}
+	cur := make(map[string][]string)
+	for _, s := range next {
+		cur[s.ID] = append(cur[s.ID], setSymbols(s)...)
+	}
+
+	var ids []string
+	for id := range old {
+		ids = append(ids, id)
+	}
+	for id := range cur {
+		if _, ok := old[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var diffs []SymbolSetDiff
+	for _, id := range ids {
+		slices.Sort(old[id])
+		slices.Sort(cur[id])
+		d := SymbolSetDiff{ID: id}
+		for _, sym := range cur[id] {
+			if _, found := slices.BinarySearch(old[id], sym); !found {
+				d.New = append(d.New, sym)
+			}
+		}
+		for _, sym := range old[id] {
+			if _, found := slices.BinarySearch(cur[id], sym); !found {
+				d.Removed = append(d.Removed, sym)
+			}
+		}
+		if len(d.New) > 0 || len(d.Removed) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+
+	return diffs
+}
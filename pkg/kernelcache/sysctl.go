@@ -0,0 +1,286 @@
+package kernelcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+const sysctlSetSection = "__sysctl_set" // the linker set of every statically declared sysctl_oid
+
+// sysctl_oid types (CTLTYPE)
+const (
+	ctlTypeMask   = 0xf
+	ctlTypeNode   = 1
+	ctlTypeInt    = 2
+	ctlTypeString = 3
+	ctlTypeQuad   = 4
+	ctlTypeOpaque = 5
+)
+
+// sysctl_oid flags (CTLFLAG)
+const (
+	ctlFlagRD         = 0x80000000
+	ctlFlagWR         = 0x40000000
+	ctlFlagOID2       = 0x00400000
+	maxSysctlDepth    = 16
+	maxSysctlNameSize = 256
+)
+
+var sysctlFlags = []struct {
+	flag uint32
+	name string
+}{
+	{0x20000000, "nolock"},
+	{0x10000000, "anybody"},
+	{0x08000000, "secure"},
+	{0x04000000, "masked"},
+	{0x02000000, "noauto"},
+	{0x01000000, "kern"},
+	{0x00800000, "locked"},
+	{0x00100000, "experiment"},
+}
+
+// sysctlOid is XNU's struct sysctl_oid
+type sysctlOid struct {
+	Parent  uint64 // struct sysctl_oid_list *oid_parent
+	Link    uint64 // SLIST_ENTRY(sysctl_oid) oid_link
+	Number  int32
+	Kind    uint32
+	Arg1    uint64
+	Arg2    int32
+	_       uint32
+	Name    uint64
+	Handler uint64
+	Format  uint64
+	Descr   uint64 // only present with CTLFLAG_OID2
+	Version int32
+	RefCnt  int32
+}
+
+// Sysctl is a statically declared sysctl node or leaf
+type Sysctl struct {
+	Addr        uint64    `json:"addr"`
+	Name        string    `json:"name"` // the full dotted name (e.g. kern.osversion)
+	Number      int32     `json:"number"`
+	Type        string    `json:"type"`
+	Perms       string    `json:"perms"`
+	Flags       []string  `json:"flags,omitempty"`
+	Format      string    `json:"format,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Handler     uint64    `json:"handler,omitempty"`
+	Kext        string    `json:"kext,omitempty"` // the fileset entry that declares it
+	Children    []*Sysctl `json:"children,omitempty"`
+
+	parent   uint64 // the sysctl_oid_list it is in
+	children uint64 // the sysctl_oid_list of a node (arg1)
+	name     string // the short name
+}
+
+func sysctlType(kind uint32) string {
+	switch kind & ctlTypeMask {
+	case ctlTypeNode:
+		return "node"
+	case ctlTypeInt:
+		return "int"
+	case ctlTypeString:
+		return "string"
+	case ctlTypeQuad:
+		return "quad"
+	case ctlTypeOpaque:
+		return "opaque"
+	default:
+		return fmt.Sprintf("unknown(%d)", kind&ctlTypeMask)
+	}
+}
+
+func sysctlPerms(kind uint32) string {
+	perms := []byte("--")
+	if kind&ctlFlagRD != 0 {
+		perms[0] = 'r'
+	}
+	if kind&ctlFlagWR != 0 {
+		perms[1] = 'w'
+	}
+	return string(perms)
+}
+
+// readSysctls reads the sysctl_oids in the __sysctl_set sections of mfe (reading the structs through m so that
+// oids of a fileset entry can reference the kernel's lists and strings)
+func readSysctls(m, mfe *macho.File, kext string) ([]*Sysctl, error) {
+	var sysctls []*Sysctl
+	for _, sec := range mfe.Sections {
+		if sec.Name != sysctlSetSection || sec.Size == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+		}
+		for off := 0; off+8 <= len(data); off += 8 {
+			addr := mfe.SlidePointer(binary.LittleEndian.Uint64(data[off:]))
+			if addr == 0 {
+				continue
+			}
+			var oid sysctlOid
+			buf := make([]byte, binary.Size(oid))
+			foff, err := m.GetOffset(addr)
+			if err != nil {
+				log.Debugf("skipping sysctl_oid at %#x: %v", addr, err)
+				continue
+			}
+			if _, err := m.ReadAt(buf, int64(foff)); err != nil {
+				return nil, fmt.Errorf("failed to read sysctl_oid at %#x: %v", addr, err)
+			}
+			if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &oid); err != nil {
+				return nil, fmt.Errorf("failed to parse sysctl_oid at %#x: %v", addr, err)
+			}
+			name, err := m.GetCString(mfe.SlidePointer(oid.Name))
+			if err != nil || len(name) == 0 || len(name) > maxSysctlNameSize {
+				log.Debugf("skipping sysctl_oid at %#x: failed to read name", addr)
+				continue
+			}
+			s := &Sysctl{
+				Addr:    addr,
+				Number:  oid.Number,
+				Type:    sysctlType(oid.Kind),
+				Perms:   sysctlPerms(oid.Kind),
+				Handler: mfe.SlidePointer(oid.Handler),
+				Kext:    kext,
+				parent:  mfe.SlidePointer(oid.Parent),
+				name:    name,
+			}
+			for _, f := range sysctlFlags {
+				if oid.Kind&f.flag != 0 {
+					s.Flags = append(s.Flags, f.name)
+				}
+			}
+			if oid.Kind&ctlTypeMask == ctlTypeNode {
+				s.children = mfe.SlidePointer(oid.Arg1)
+			}
+			if oid.Format != 0 {
+				s.Format, _ = m.GetCString(mfe.SlidePointer(oid.Format))
+			}
+			if oid.Kind&ctlFlagOID2 != 0 && oid.Descr != 0 {
+				s.Description, _ = m.GetCString(mfe.SlidePointer(oid.Descr))
+			}
+			sysctls = append(sysctls, s)
+		}
+	}
+	return sysctls, nil
+}
+
+// GetSysctls returns the tree of sysctls statically declared (SYSCTL_NODE, SYSCTL_INT, SYSCTL_PROC etc) by the
+// kernel and every fileset entry
+//
+// NOTE: the top level nodes (kern, vm, hw etc) are the roots of the returned tree and nodes whose parent
+// isn't declared in a __sysctl_set (i.e. registered at runtime) are returned as roots as well
+func GetSysctls(m *macho.File) ([]*Sysctl, error) {
+	return GetSysctlsContext(context.Background(), m)
+}
+
+// GetSysctlsContext is like GetSysctls but stops (returning ctx.Err()) once the context is done
+func GetSysctlsContext(ctx context.Context, m *macho.File) ([]*Sysctl, error) {
+	var sysctls []*Sysctl
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		for _, fe := range m.FileSets() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			ss, err := readSysctls(m, mfe, fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s sysctls: %v", fe.EntryID, err)
+			}
+			sysctls = append(sysctls, ss...)
+		}
+	} else {
+		ss, err := readSysctls(m, m, "")
+		if err != nil {
+			return nil, err
+		}
+		sysctls = ss
+	}
+
+	if len(sysctls) == 0 {
+		return nil, errcode.Errorf(errcode.NotFound, "failed to find any sysctls in the %s sections", sysctlSetSection)
+	}
+
+	nodes := make(map[uint64]*Sysctl) // children list address -> node
+	for _, s := range sysctls {
+		if s.children != 0 {
+			nodes[s.children] = s
+		}
+	}
+
+	var roots []*Sysctl
+	for _, s := range sysctls {
+		if parent, ok := nodes[s.parent]; ok && parent != s {
+			parent.Children = append(parent.Children, s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	var name func(s *Sysctl, prefix string, depth int)
+	name = func(s *Sysctl, prefix string, depth int) {
+		s.Name = prefix + s.name
+		if depth >= maxSysctlDepth {
+			return
+		}
+		sort.Slice(s.Children, func(i, j int) bool { return s.Children[i].name < s.Children[j].name })
+		for _, c := range s.Children {
+			name(c, s.Name+".", depth+1)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].name < roots[j].name })
+	for _, r := range roots {
+		name(r, "", 0)
+	}
+
+	return roots, nil
+}
+
+// WalkSysctls calls fn for every sysctl in the tree (parents before their children)
+func WalkSysctls(sysctls []*Sysctl, fn func(s *Sysctl, depth int)) {
+	var walk func(ss []*Sysctl, depth int)
+	walk = func(ss []*Sysctl, depth int) {
+		if depth > maxSysctlDepth {
+			return
+		}
+		for _, s := range ss {
+			fn(s, depth)
+			walk(s.Children, depth+1)
+		}
+	}
+	walk(sysctls, 0)
+}
+
+// String returns the sysctl as a line of `sysctl -a` style output
+func (s *Sysctl) String() string {
+	var details []string
+	if len(s.Format) > 0 {
+		details = append(details, "fmt="+s.Format)
+	}
+	if len(s.Flags) > 0 {
+		details = append(details, strings.Join(s.Flags, ","))
+	}
+	if s.Handler != 0 {
+		details = append(details, fmt.Sprintf("handler=%#x", s.Handler))
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("%-6s %s %s", s.Type, s.Perms, s.Name)
+	}
+	return fmt.Sprintf("%-6s %s %s (%s)", s.Type, s.Perms, s.Name, strings.Join(details, " "))
+}
@@ -0,0 +1,339 @@
+package kernelcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/errcode"
+	"github.com/blacktop/ipsw/pkg/kernelcache/fixup"
+)
+
+// KallocTypeFlags are the kalloc_type_flags_t of a kalloc_type view
+type KallocTypeFlags uint32
+
+const (
+	KTDefault    KallocTypeFlags = 0x0001
+	KTPrivAcct   KallocTypeFlags = 0x0002
+	KTSharedAcct KallocTypeFlags = 0x0004
+	KTDataOnly   KallocTypeFlags = 0x0008 // the type has no pointers (allocated from the data heap)
+	KTVM         KallocTypeFlags = 0x0010
+	KTChanged    KallocTypeFlags = 0x0020
+	KTChanged2   KallocTypeFlags = 0x0040
+	KTPtrArray   KallocTypeFlags = 0x0080
+	KTSlid       KallocTypeFlags = 0x4000
+	KTProcessed  KallocTypeFlags = 0x8000
+	KTHashMask   KallocTypeFlags = 0xffff0000
+	ktKnownFlags                 = KTDefault | KTPrivAcct | KTSharedAcct | KTDataOnly | KTVM | KTChanged | KTChanged2 | KTPtrArray | KTSlid | KTProcessed
+	ktHashShift                  = 16
+)
+
+// Hash returns the type hash stored in the top 16 bits
+func (f KallocTypeFlags) Hash() uint16 {
+	return uint16((f & KTHashMask) >> ktHashShift)
+}
+
+func (f KallocTypeFlags) String() string {
+	var flags []string
+	for _, flag := range []struct {
+		f    KallocTypeFlags
+		name string
+	}{
+		{KTDefault, "default"},
+		{KTPrivAcct, "priv_acct"},
+		{KTSharedAcct, "shared_acct"},
+		{KTDataOnly, "data_only"},
+		{KTVM, "vm"},
+		{KTChanged, "changed"},
+		{KTChanged2, "changed2"},
+		{KTPtrArray, "ptr_array"},
+		{KTSlid, "slid"},
+		{KTProcessed, "processed"},
+	} {
+		if f&flag.f != 0 {
+			flags = append(flags, flag.name)
+		}
+	}
+	if other := f &^ (ktKnownFlags | KTHashMask); other != 0 {
+		flags = append(flags, fmt.Sprintf("%#x", uint32(other)))
+	}
+	return strings.Join(flags, "|")
+}
+
+// KallocType is a kalloc_type view (a typed allocation site): its type signature decides which zone it uses
+type KallocType struct {
+	Name      string          `json:"name"` // i.e. site.struct ipc_port
+	Kext      string          `json:"kext,omitempty"`
+	Addr      uint64          `json:"addr"`
+	Size      uint32          `json:"size"`
+	Signature string          `json:"signature"` // the 8 byte granule types (i.e. 1 = data, 2 = pointer)
+	Flags     KallocTypeFlags `json:"flags"`
+	// variable sized (kalloc_type_var_view) allocations are a header followed by an array of the type
+	Var             bool   `json:"var,omitempty"`
+	HeaderSize      uint32 `json:"header_size,omitempty"`
+	HeaderSignature string `json:"header_signature,omitempty"`
+}
+
+func (k KallocType) String() string {
+	if k.Var {
+		return fmt.Sprintf("%s: hdr=%d[%s] type=%d[%s] %s", k.Name, k.HeaderSize, k.HeaderSignature, k.Size, k.Signature, k.Flags)
+	}
+	return fmt.Sprintf("%s: size=%d sig=%s %s", k.Name, k.Size, k.Signature, k.Flags)
+}
+
+// Zone is a zone created at boot with ZONE_DEFINE()/ZONE_INIT() (from the zone_create_startup_spec)
+type Zone struct {
+	Name  string `json:"name"`
+	Size  uint64 `json:"size"`  // the element size
+	Flags uint64 `json:"flags"` // zone_create_flags_t (the bits change between XNU versions)
+}
+
+func (z Zone) String() string {
+	return fmt.Sprintf("%s: size=%d flags=%#x", z.Name, z.Size, z.Flags)
+}
+
+// ZoneInfo is the zone allocator metadata of a kernelcache
+type ZoneInfo struct {
+	Zones       []Zone       `json:"zones,omitempty"`
+	KallocTypes []KallocType `json:"kalloc_types,omitempty"`
+}
+
+const (
+	kallocTypeViewSize = 64 // sizeof(struct kalloc_type_view)
+	zoneSpecSize       = 32 // the z_var, z_name, z_size and z_flags of struct zone_create_startup_spec
+	maxZoneElemSize    = 0x10000
+)
+
+var reZoneName = regexp.MustCompile(`^[A-Za-z][\x20-\x7e]{1,63}$`)
+
+// kallocTypeVarViewSizes are the sizes of struct kalloc_type_var_view (kt_zones grew with the number of kalloc zones)
+var kallocTypeVarViewSizes = []int{72, 80, 88, 96}
+
+type zoneImage struct {
+	kext string
+	m    *macho.File
+}
+
+// GetZoneInfo returns the zones defined at boot and the kalloc_type views of the kernel and every kext
+func GetZoneInfo(m *macho.File) (*ZoneInfo, error) {
+	images := []zoneImage{{m: m}}
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		images = nil
+		for _, fe := range m.FileSets() {
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse fileset entry %s: %v", fe.EntryID, err)
+			}
+			images = append(images, zoneImage{kext: fe.EntryID, m: mfe})
+		}
+	}
+	ptrs := fixup.New(m)
+	cstring := func(raw uint64) (string, bool) {
+		ptr := ptrs.SlidePointer(raw)
+		if ptr == 0 {
+			return "", false
+		}
+		s, err := m.GetCString(ptr)
+		return s, err == nil && len(s) > 0
+	}
+
+	zi := &ZoneInfo{}
+	var found bool
+	for _, img := range images {
+		if sec := img.m.Section("__DATA_CONST", "__kalloc_type"); sec != nil {
+			found = true
+			kts, err := readKallocTypes(img, sec, cstring)
+			if err != nil {
+				return nil, err
+			}
+			zi.KallocTypes = append(zi.KallocTypes, kts...)
+		}
+		if sec := img.m.Section("__DATA_CONST", "__kalloc_var"); sec != nil {
+			found = true
+			kts, err := readKallocTypeVars(img, sec, cstring)
+			if err != nil {
+				log.Debugf("failed to parse %s %s.%s: %v", img.kext, sec.Seg, sec.Name, err)
+			}
+			zi.KallocTypes = append(zi.KallocTypes, kts...)
+		}
+	}
+
+	if bd, err := GetBootData(m); err == nil {
+		kern, _ := kernelImage(m)
+		for _, e := range bd.Startup {
+			if z, ok := readZoneSpec(kern, e.Arg, cstring); ok {
+				zi.Zones = append(zi.Zones, z)
+			}
+		}
+	} else {
+		log.Debugf("failed to get the STARTUP() entries: %v", err)
+	}
+
+	if !found && len(zi.Zones) == 0 {
+		return nil, errcode.Errorf(errcode.MissingSection, "kernelcache has no __kalloc_type sections or ZONE_DEFINE() zones (kalloc_type was added in iOS 16)")
+	}
+	sort.SliceStable(zi.Zones, func(i, j int) bool { return zi.Zones[i].Name < zi.Zones[j].Name })
+	sort.SliceStable(zi.KallocTypes, func(i, j int) bool { return zi.KallocTypes[i].key() < zi.KallocTypes[j].key() })
+	return zi, nil
+}
+
+func (k KallocType) key() string {
+	return k.Kext + "\x00" + k.Name
+}
+
+func readKallocTypes(img zoneImage, sec *types.Section, cstring func(uint64) (string, bool)) ([]KallocType, error) {
+	data := make([]byte, sec.Size)
+	if _, err := readAtAddr(img.m, data, sec.Addr); err != nil {
+		return nil, fmt.Errorf("failed to read %s %s.%s: %v", img.kext, sec.Seg, sec.Name, err)
+	}
+	var kts []KallocType
+	for off := 0; off+kallocTypeViewSize <= len(data); off += kallocTypeViewSize {
+		// struct kalloc_type_view { struct zone_view kt_zv { zv_zone, zv_stats, zv_name, zv_next }; kt_signature; kt_flags; kt_size; ... }
+		name, ok := cstring(binary.LittleEndian.Uint64(data[off+16:]))
+		if !ok {
+			continue
+		}
+		sig, _ := cstring(binary.LittleEndian.Uint64(data[off+32:]))
+		kts = append(kts, KallocType{
+			Name:      name,
+			Kext:      img.kext,
+			Addr:      sec.Addr + uint64(off),
+			Signature: sig,
+			Flags:     KallocTypeFlags(binary.LittleEndian.Uint32(data[off+40:])),
+			Size:      binary.LittleEndian.Uint32(data[off+44:]),
+		})
+	}
+	return kts, nil
+}
+
+// readKallocTypeVars parses the kalloc_type_var_view structs (finding their size by the one that decodes them all)
+func readKallocTypeVars(img zoneImage, sec *types.Section, cstring func(uint64) (string, bool)) ([]KallocType, error) {
+	data := make([]byte, sec.Size)
+	if _, err := readAtAddr(img.m, data, sec.Addr); err != nil {
+		return nil, fmt.Errorf("failed to read %s %s.%s: %v", img.kext, sec.Seg, sec.Name, err)
+	}
+	for _, size := range kallocTypeVarViewSizes {
+		if len(data)%size != 0 {
+			continue
+		}
+		var kts []KallocType
+		for off := 0; off+size <= len(data); off += size {
+			// struct kalloc_type_var_view { kt_version; kt_size_hdr; kt_size_type; kt_stats; kt_name; kt_next; kt_heap_start; kt_zones[]; ...; kt_sig_hdr; kt_sig_type; kt_flags }
+			name, ok := cstring(binary.LittleEndian.Uint64(data[off+16:]))
+			if !ok || !reZoneName.MatchString(name) {
+				kts = nil
+				break
+			}
+			tail := data[off+size-24:] // the signatures and flags are the last fields
+			hdrSig, _ := cstring(binary.LittleEndian.Uint64(tail))
+			typeSig, _ := cstring(binary.LittleEndian.Uint64(tail[8:]))
+			kts = append(kts, KallocType{
+				Name:            name,
+				Kext:            img.kext,
+				Addr:            sec.Addr + uint64(off),
+				Var:             true,
+				HeaderSize:      uint32(binary.LittleEndian.Uint16(data[off+2:])),
+				Size:            binary.LittleEndian.Uint32(data[off+4:]),
+				HeaderSignature: hdrSig,
+				Signature:       typeSig,
+				Flags:           KallocTypeFlags(binary.LittleEndian.Uint32(tail[16:])),
+			})
+		}
+		if len(kts) > 0 {
+			return kts, nil
+		}
+	}
+	return nil, errcode.Errorf(errcode.InvalidFormat, "unknown kalloc_type_var_view layout (section size %#x)", sec.Size)
+}
+
+// readZoneSpec decodes the zone_create_startup_spec at addr (a ZONE_DEFINE() STARTUP() entry's argument)
+func readZoneSpec(m *macho.File, addr uint64, cstring func(uint64) (string, bool)) (Zone, bool) {
+	var z Zone
+	if addr == 0 {
+		return z, false
+	}
+	spec := make([]byte, zoneSpecSize)
+	if _, err := readAtAddr(m, spec, addr); err != nil {
+		return z, false
+	}
+	if binary.LittleEndian.Uint64(spec) == 0 { // z_var
+		return z, false
+	}
+	name, ok := cstring(binary.LittleEndian.Uint64(spec[8:]))
+	if !ok || !reZoneName.MatchString(name) {
+		return z, false
+	}
+	z.Name = name
+	z.Size = binary.LittleEndian.Uint64(spec[16:])
+	z.Flags = binary.LittleEndian.Uint64(spec[24:])
+	if z.Size == 0 || z.Size > maxZoneElemSize {
+		return z, false
+	}
+	return z, true
+}
+
+// ZoneInfoDiff are the zones and kalloc_type views that were added, removed or changed between two builds
+type ZoneInfoDiff struct {
+	NewZones           []Zone          `json:"new_zones,omitempty"`
+	RemovedZones       []Zone          `json:"removed_zones,omitempty"`
+	ChangedZones       [][2]Zone       `json:"changed_zones,omitempty"`
+	NewKallocTypes     []KallocType    `json:"new_kalloc_types,omitempty"`
+	RemovedKallocTypes []KallocType    `json:"removed_kalloc_types,omitempty"`
+	ChangedKallocTypes [][2]KallocType `json:"changed_kalloc_types,omitempty"` // the previous and new view
+}
+
+// DiffZoneInfo returns the zones and kalloc_type views (by kext and name) that changed between two builds
+func DiffZoneInfo(prev, next *ZoneInfo) *ZoneInfoDiff {
+	d := &ZoneInfoDiff{}
+
+	oldZones := make(map[string]Zone, len(prev.Zones))
+	for _, z := range prev.Zones {
+		oldZones[z.Name] = z
+	}
+	curZones := make(map[string]bool, len(next.Zones))
+	for _, z := range next.Zones {
+		curZones[z.Name] = true
+		if o, ok := oldZones[z.Name]; !ok {
+			d.NewZones = append(d.NewZones, z)
+		} else if o.Size != z.Size || o.Flags != z.Flags {
+			d.ChangedZones = append(d.ChangedZones, [2]Zone{o, z})
+		}
+	}
+	for _, z := range prev.Zones {
+		if !curZones[z.Name] {
+			d.RemovedZones = append(d.RemovedZones, z)
+		}
+	}
+
+	// the same site can be in the table more than once (i.e. inlined in several functions)
+	oldKTs := make(map[string]KallocType, len(prev.KallocTypes))
+	for _, k := range prev.KallocTypes {
+		oldKTs[k.key()] = k
+	}
+	curKTs := make(map[string]bool, len(next.KallocTypes))
+	for _, k := range next.KallocTypes {
+		if curKTs[k.key()] {
+			continue
+		}
+		curKTs[k.key()] = true
+		if o, ok := oldKTs[k.key()]; !ok {
+			d.NewKallocTypes = append(d.NewKallocTypes, k)
+		} else if o.Size != k.Size || o.Signature != k.Signature || o.HeaderSize != k.HeaderSize ||
+			o.HeaderSignature != k.HeaderSignature || o.Flags&^KTHashMask != k.Flags&^KTHashMask {
+			d.ChangedKallocTypes = append(d.ChangedKallocTypes, [2]KallocType{o, k})
+		}
+	}
+	removed := make(map[string]bool)
+	for _, k := range prev.KallocTypes {
+		if !curKTs[k.key()] && !removed[k.key()] {
+			removed[k.key()] = true
+			d.RemovedKallocTypes = append(d.RemovedKallocTypes, k)
+		}
+	}
+	return d
+}
@@ -0,0 +1,36 @@
+package kernelcache
+
+import "testing"
+
+func TestDiffZoneInfo(t *testing.T) {
+	if got := (KTDefault | KTDataOnly | 0x2a0000).String(); got != "default|data_only" {
+		t.Errorf("KallocTypeFlags.String() = %s", got)
+	}
+	if got := KallocTypeFlags(0x2a0009).Hash(); got != 0x2a {
+		t.Errorf("KallocTypeFlags.Hash() = %#x", got)
+	}
+
+	prev := &ZoneInfo{
+		Zones: []Zone{{Name: "ipc ports", Size: 168}, {Name: "knote", Size: 96}},
+		KallocTypes: []KallocType{
+			{Name: "site.struct proc", Size: 1120, Signature: "1222"},
+			{Name: "site.struct proc", Size: 1120, Signature: "1222"},
+			{Name: "site.struct socket", Size: 784, Signature: "2212", Flags: KTDefault | 0x10000},
+		},
+	}
+	next := &ZoneInfo{
+		Zones: []Zone{{Name: "ipc ports", Size: 176}, {Name: "vm objects", Size: 240}},
+		KallocTypes: []KallocType{
+			{Name: "site.struct proc", Size: 1136, Signature: "12222"},
+			{Name: "site.struct socket", Size: 784, Signature: "2212", Flags: KTDefault | 0x20000}, // only the hash changed
+			{Name: "site.struct kqworkloop", Size: 976, Signature: "22", Kext: "com.apple.kernel"},
+		},
+	}
+	d := DiffZoneInfo(prev, next)
+	if len(d.NewZones) != 1 || d.NewZones[0].Name != "vm objects" || len(d.RemovedZones) != 1 || len(d.ChangedZones) != 1 {
+		t.Errorf("DiffZoneInfo() zones = %+v %+v %+v", d.NewZones, d.RemovedZones, d.ChangedZones)
+	}
+	if len(d.NewKallocTypes) != 1 || len(d.RemovedKallocTypes) != 0 || len(d.ChangedKallocTypes) != 1 || d.ChangedKallocTypes[0][1].Size != 1136 {
+		t.Errorf("DiffZoneInfo() kalloc_types = %+v %+v %+v", d.NewKallocTypes, d.RemovedKallocTypes, d.ChangedKallocTypes)
+	}
+}
@@ -0,0 +1,190 @@
+// Package mobilegestalt decodes obfuscated MobileGestalt keys
+package mobilegestalt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/blacktop/go-macho"
+)
+
+//go:embed data/keys.gz
+var keysData []byte
+
+var obfuscatedKeyRe = regexp.MustCompile(`^[a-zA-Z0-9+/]{22}$`)
+
+// skip are 22 character CFStrings in libMobileGestalt that are NOT obfuscated keys
+var skip = []string{
+	"AMFDRCreateWithOptions",
+	"AMFDRDecodeCertificate",
+	"AMFDRDecodeTrustObject",
+	"AmountRestoreAvailable",
+	"AppleBiometricServices",
+	"BBUpdaterExtremeCreate",
+	"BluetoothLE2Capability",
+	"CoverglassSerialNumber",
+	"DeviceSupportsSWProRes",
+	"FloatingLiveAppOverlay",
+	"IOAccessoryManagerType",
+	"IOPlatformExpertDevice",
+	"IOPlatformSerialNumber",
+	"RegionalBehaviorNoVOIP",
+	"RegionalBehaviorNoWiFi",
+	"SpeakerCalibrationMiGa",
+	"SpeakerCalibrationSpGa",
+	"SpeakerCalibrationSpTS",
+}
+
+// Key is a MobileGestalt key DB entry
+type Key struct {
+	Key         string `json:"key"`
+	Description string `json:"desc"`
+}
+
+// DB is a lookup table of obfuscated MobileGestalt keys to their plaintext names
+type DB map[string]Key
+
+// Obfuscate returns the obfuscated form of a MobileGestalt key
+func Obfuscate(key string) string {
+	h := md5.Sum([]byte("MGCopyAnswer" + key))
+	return base64.StdEncoding.EncodeToString(h[:])[:22]
+}
+
+// IsObfuscated returns true if the key looks like an obfuscated MobileGestalt key
+func IsObfuscated(key string) bool {
+	return obfuscatedKeyRe.MatchString(key) && !slices.Contains(skip, key)
+}
+
+// GetDB returns the in-tree MobileGestalt key DB
+func GetDB() (DB, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(keysData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress MobileGestalt key DB: %v", err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MobileGestalt key DB: %v", err)
+	}
+
+	var db DB
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("failed to parse MobileGestalt key DB: %v", err)
+	}
+
+	return db, nil
+}
+
+// LoadDB loads a MobileGestalt key DB JSON file
+func LoadDB(path string) (DB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MobileGestalt key DB %s: %v", path, err)
+	}
+	var db DB
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("failed to parse MobileGestalt key DB %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// Save writes the DB as JSON to path
+func (db DB) Save(path string) error {
+	data, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Decode returns the plaintext name of an obfuscated key (or the key itself if it is unknown)
+func (db DB) Decode(obfuscated string) string {
+	if k, ok := db[obfuscated]; ok && len(k.Key) > 0 {
+		return k.Key
+	}
+	return obfuscated
+}
+
+// Encode returns the obfuscated form of a plaintext key
+//
+// NOTE: keys that are already obfuscated are returned as is
+func (db DB) Encode(key string) string {
+	if _, ok := db[key]; ok || IsObfuscated(key) {
+		return key
+	}
+	return Obfuscate(key)
+}
+
+// Unknown returns the sorted obfuscated keys whose plaintext names are not known
+func (db DB) Unknown() []string {
+	var unknown []string
+	for o, k := range db {
+		if len(k.Key) == 0 {
+			unknown = append(unknown, o)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Add adds a plaintext key to the DB and returns true if it was not already known
+func (db DB) Add(key, desc string) bool {
+	o := Obfuscate(key)
+	if k, ok := db[o]; ok && len(k.Key) > 0 {
+		return false
+	}
+	db[o] = Key{Key: key, Description: desc}
+	return true
+}
+
+// DecodeAnswers replaces the obfuscated keys of a MobileGestalt answer map with their plaintext names
+func (db DB) DecodeAnswers(answers map[string]any) map[string]any {
+	out := make(map[string]any, len(answers))
+	for k, v := range answers {
+		out[db.Decode(k)] = v
+	}
+	return out
+}
+
+// ExtractKeys returns the obfuscated MobileGestalt keys referenced by libMobileGestalt
+func ExtractKeys(m *macho.File) ([]string, error) {
+	cfstrs, err := m.GetCFStrings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CFStrings: %v", err)
+	}
+	var keys []string
+	for _, cfstr := range cfstrs {
+		if IsObfuscated(cfstr.Name) && !slices.Contains(keys, cfstr.Name) {
+			keys = append(keys, cfstr.Name)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Update adds any new obfuscated keys found in libMobileGestalt to the DB and returns them
+func (db DB) Update(m *macho.File) ([]string, error) {
+	keys, err := ExtractKeys(m)
+	if err != nil {
+		return nil, err
+	}
+	var added []string
+	for _, key := range keys {
+		if _, ok := db[key]; !ok {
+			db[key] = Key{} // empty entry for NEW obfuscated key
+			added = append(added, key)
+		}
+	}
+	return added, nil
+}
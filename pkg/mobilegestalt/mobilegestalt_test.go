@@ -0,0 +1,21 @@
+package mobilegestalt
+
+import "testing"
+
+func TestDB(t *testing.T) {
+	db, err := GetDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Obfuscate("ProductType"); got != "h9jDsbgj7xIVeIQ8S3/X3Q" {
+		t.Errorf("Obfuscate(ProductType) = %s, want h9jDsbgj7xIVeIQ8S3/X3Q", got)
+	}
+	for o, k := range db {
+		if len(k.Key) > 0 && Obfuscate(k.Key) != o {
+			t.Errorf("DB entry %s does not match key %s (%s)", o, k.Key, Obfuscate(k.Key))
+		}
+	}
+	if got := db.Decode(db.Encode("UniqueDeviceID")); got != "UniqueDeviceID" {
+		t.Errorf("Decode(Encode(UniqueDeviceID)) = %s", got)
+	}
+}
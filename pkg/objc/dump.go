@@ -0,0 +1,448 @@
+package objc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	mobjc "github.com/blacktop/go-macho/types/objc"
+)
+
+// ErrNoObjC is returned when a MachO has no Objective-C runtime data
+var ErrNoObjC = errors.New("no Objective-C runtime data found")
+
+// Image is the Objective-C runtime metadata of a MachO (or dyld_shared_cache dylib)
+type Image struct {
+	Name       string      `json:"name,omitempty"`
+	Protocols  []*Protocol `json:"protocols,omitempty"`
+	Classes    []*Class    `json:"classes,omitempty"`
+	Categories []*Category `json:"categories,omitempty"`
+}
+
+// Class is an Objective-C class declaration
+type Class struct {
+	Name            string     `json:"name"`
+	SuperClass      string     `json:"super_class,omitempty"`
+	Addr            uint64     `json:"addr"`
+	Swift           bool       `json:"swift,omitempty"`
+	SwiftName       string     `json:"swift_name,omitempty"` // the demangled name of a Swift class (i.e. Module.Name)
+	Protocols       []string   `json:"protocols,omitempty"`
+	Ivars           []Ivar     `json:"ivars,omitempty"`
+	Properties      []Property `json:"properties,omitempty"`
+	ClassMethods    []Method   `json:"class_methods,omitempty"`
+	InstanceMethods []Method   `json:"instance_methods,omitempty"`
+}
+
+// Protocol is an Objective-C protocol declaration
+type Protocol struct {
+	Name                    string     `json:"name"`
+	Addr                    uint64     `json:"addr"`
+	Protocols               []string   `json:"protocols,omitempty"`
+	Properties              []Property `json:"properties,omitempty"`
+	ClassMethods            []Method   `json:"class_methods,omitempty"`
+	InstanceMethods         []Method   `json:"instance_methods,omitempty"`
+	OptionalClassMethods    []Method   `json:"optional_class_methods,omitempty"`
+	OptionalInstanceMethods []Method   `json:"optional_instance_methods,omitempty"`
+}
+
+// Category is an Objective-C category declaration
+type Category struct {
+	Name            string     `json:"name"`
+	Class           string     `json:"class,omitempty"`
+	Addr            uint64     `json:"addr"`
+	Protocols       []string   `json:"protocols,omitempty"`
+	Properties      []Property `json:"properties,omitempty"`
+	ClassMethods    []Method   `json:"class_methods,omitempty"`
+	InstanceMethods []Method   `json:"instance_methods,omitempty"`
+}
+
+// Ivar is an instance variable
+type Ivar struct {
+	Name     string `json:"name"`
+	Encoding string `json:"encoding"`
+	Decl     string `json:"decl"`
+	Offset   uint32 `json:"offset"`
+	Size     uint32 `json:"size"`
+}
+
+// Method is a class or instance method
+type Method struct {
+	Name     string `json:"name"`
+	Encoding string `json:"encoding"`
+	Decl     string `json:"decl"`
+	Addr     uint64 `json:"addr,omitempty"` // the IMP (protocol methods have none)
+}
+
+// Property is a declared property
+type Property struct {
+	Name       string   `json:"name"`
+	Encoding   string   `json:"encoding"` // the encoded attributes (i.e. T@"NSString",C,N,V_name)
+	Attributes []string `json:"attributes,omitempty"`
+	Ivar       string   `json:"ivar,omitempty"`
+	Optional   bool     `json:"optional,omitempty"`
+	Dynamic    bool     `json:"dynamic,omitempty"`
+	Decl       string   `json:"decl"`
+}
+
+// ParseImage parses the Objective-C classes, protocols and categories of a MachO
+//
+// NOTE: a dyld_shared_cache dylib's MachO (see dyld.CacheImage.GetMacho) resolves its selectors and class
+// references through the cache so it can be parsed the same way as a standalone MachO
+func ParseImage(m *macho.File) (*Image, error) {
+	if !m.HasObjC() {
+		return nil, ErrNoObjC
+	}
+	img := new(Image)
+	protos, err := m.GetObjCProtocols()
+	if err != nil && !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		return nil, fmt.Errorf("failed to parse protocols: %w", err)
+	}
+	for _, p := range protos {
+		img.Protocols = append(img.Protocols, newProtocol(&p))
+	}
+	classes, err := getClasses(m)
+	if err != nil && !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		return nil, fmt.Errorf("failed to parse classes: %w", err)
+	}
+	for _, c := range classes {
+		c.Name = ClassName(m, &c)
+		img.Classes = append(img.Classes, newClass(&c))
+	}
+	cats, err := m.GetObjCCategories()
+	if err != nil && !errors.Is(err, macho.ErrObjcSectionNotFound) {
+		return nil, fmt.Errorf("failed to parse categories: %w", err)
+	}
+	for _, c := range cats {
+		cat := newCategory(&c)
+		if cat.Class == "" {
+			cat.Class = CategoryClass(m, &c)
+		}
+		img.Categories = append(img.Categories, cat)
+	}
+	return img, nil
+}
+
+func newClass(c *mobjc.Class) *Class {
+	class := &Class{
+		Name:            c.Name,
+		Addr:            c.ClassPtr,
+		Swift:           c.IsSwiftStable || c.IsSwiftLegacy,
+		SwiftName:       swiftName(c.Name),
+		Protocols:       protocolNames(c.Protocols),
+		Properties:      newProperties(c.Props),
+		ClassMethods:    newMethods("+", c.ClassMethods),
+		InstanceMethods: newMethods("-", c.InstanceMethods),
+	}
+	if !c.ReadOnlyData.Flags.IsRoot() {
+		class.SuperClass = c.SuperClass
+	}
+	for _, iv := range c.Ivars {
+		class.Ivars = append(class.Ivars, Ivar{
+			Name:     iv.Name,
+			Encoding: iv.Type,
+			Decl:     typeDecl(iv.Type, iv.Name),
+			Offset:   iv.Offset,
+			Size:     iv.Size,
+		})
+	}
+	return class
+}
+
+func newProtocol(p *mobjc.Protocol) *Protocol {
+	return &Protocol{
+		Name:                    p.Name,
+		Addr:                    p.Ptr,
+		Protocols:               protocolNames(p.Prots),
+		Properties:              newProperties(p.InstanceProperties),
+		ClassMethods:            newMethods("+", p.ClassMethods),
+		InstanceMethods:         newMethods("-", p.InstanceMethods),
+		OptionalClassMethods:    newMethods("+", p.OptionalClassMethods),
+		OptionalInstanceMethods: newMethods("-", p.OptionalInstanceMethods),
+	}
+}
+
+func newCategory(c *mobjc.Category) *Category {
+	cat := &Category{
+		Name:            c.Name,
+		Addr:            c.VMAddr,
+		Protocols:       protocolNames(c.Protocols),
+		Properties:      newProperties(c.Properties),
+		ClassMethods:    newMethods("+", c.ClassMethods),
+		InstanceMethods: newMethods("-", c.InstanceMethods),
+	}
+	if c.Class != nil {
+		cat.Class = c.Class.Name
+	}
+	return cat
+}
+
+func protocolNames(protos []mobjc.Protocol) []string {
+	var names []string
+	for _, p := range protos {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// typeDecl returns the declaration of a variable of the encoded type (falling back to id for bad encodings)
+func typeDecl(enc, name string) string {
+	if typ, err := ParseType(enc); err == nil {
+		return typ.Decl(name)
+	}
+	return declarator("id", name)
+}
+
+func newMethods(prefix string, methods []mobjc.Method) []Method {
+	var out []Method
+	for _, m := range methods {
+		out = append(out, Method{
+			Name:     m.Name,
+			Encoding: m.Types,
+			Decl:     methodDecl(prefix, m.Name, m.Types),
+			Addr:     m.ImpVMAddr,
+		})
+	}
+	return out
+}
+
+// methodDecl returns a method declaration with class-dump's argN argument names
+func methodDecl(prefix, name, enc string) string {
+	ret, args := "id", []string(nil)
+	if sig, err := ParseMethodTypes(enc); err == nil {
+		ret = sig.Return.Decl("")
+		for _, arg := range sig.Args[min(2, len(sig.Args)):] { // skip self and _cmd
+			args = append(args, arg.Decl(""))
+		}
+	}
+	parts := strings.Split(name, ":")
+	if len(parts) < 2 {
+		return fmt.Sprintf("%s (%s)%s;", prefix, ret, name)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s)", prefix, ret)
+	for i, part := range parts[:len(parts)-1] {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		typ := "id"
+		if i < len(args) {
+			typ = args[i]
+		}
+		fmt.Fprintf(&sb, "%s:(%s)arg%d", part, typ, i+1)
+	}
+	sb.WriteString(";")
+	return sb.String()
+}
+
+func newProperties(props []mobjc.Property) []Property {
+	var out []Property
+	for _, prop := range props {
+		p := Property{Name: prop.Name, Encoding: prop.EncodedAttributes}
+		typ := "id"
+		for _, attr := range strings.Split(prop.EncodedAttributes, ",") {
+			if len(attr) == 0 {
+				continue
+			}
+			switch attr[0] {
+			case 'T':
+				typ = attr[1:]
+			case 'R':
+				p.Attributes = append(p.Attributes, "readonly")
+			case 'C':
+				p.Attributes = append(p.Attributes, "copy")
+			case '&':
+				p.Attributes = append(p.Attributes, "retain")
+			case 'W':
+				p.Attributes = append(p.Attributes, "weak")
+			case 'N':
+				p.Attributes = append(p.Attributes, "nonatomic")
+			case 'G':
+				p.Attributes = append(p.Attributes, "getter="+attr[1:])
+			case 'S':
+				p.Attributes = append(p.Attributes, "setter="+attr[1:])
+			case 'D':
+				p.Dynamic = true
+			case 'V':
+				p.Ivar = attr[1:]
+			case '?':
+				p.Optional = true
+			}
+		}
+		var sb strings.Builder
+		sb.WriteString("@property ")
+		if len(p.Attributes) > 0 {
+			fmt.Fprintf(&sb, "(%s) ", strings.Join(p.Attributes, ", "))
+		}
+		sb.WriteString(typeDecl(typ, p.Name) + ";")
+		p.Decl = sb.String()
+		out = append(out, p)
+	}
+	return out
+}
+
+func protocolList(protos []string) string {
+	if len(protos) == 0 {
+		return ""
+	}
+	return " <" + strings.Join(protos, ", ") + ">"
+}
+
+func writeMethods(sb *strings.Builder, methods []Method) {
+	for _, m := range methods {
+		if m.Addr != 0 {
+			fmt.Fprintf(sb, "%s // %#x\n", m.Decl, m.Addr)
+		} else {
+			sb.WriteString(m.Decl + "\n")
+		}
+	}
+}
+
+func writeProperties(sb *strings.Builder, props []Property) {
+	for _, p := range props {
+		sb.WriteString(p.Decl + "\n")
+	}
+}
+
+// String returns the class's header declaration with its ivar offsets and method addresses
+func (c *Class) String() string {
+	var sb strings.Builder
+	if len(c.SwiftName) > 0 {
+		fmt.Fprintf(&sb, "// %s\n", c.SwiftName)
+	}
+	fmt.Fprintf(&sb, "@interface %s", c.Name)
+	if len(c.SuperClass) > 0 {
+		fmt.Fprintf(&sb, " : %s", c.SuperClass)
+	}
+	sb.WriteString(protocolList(c.Protocols))
+	if len(c.Ivars) > 0 {
+		sb.WriteString(" {\n")
+		for _, iv := range c.Ivars {
+			fmt.Fprintf(&sb, "    %s; // +%#x (%#x)\n", iv.Decl, iv.Offset, iv.Size)
+		}
+		sb.WriteString("}")
+	}
+	sb.WriteString("\n\n")
+	writeProperties(&sb, c.Properties)
+	writeMethods(&sb, c.ClassMethods)
+	writeMethods(&sb, c.InstanceMethods)
+	sb.WriteString("@end\n")
+	return sb.String()
+}
+
+// String returns the protocol's header declaration
+func (p *Protocol) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@protocol %s%s\n\n", p.Name, protocolList(p.Protocols))
+	var optional []Property
+	for _, prop := range p.Properties {
+		if prop.Optional {
+			optional = append(optional, prop)
+		} else {
+			writeProperties(&sb, []Property{prop})
+		}
+	}
+	writeMethods(&sb, p.ClassMethods)
+	writeMethods(&sb, p.InstanceMethods)
+	if len(optional) > 0 || len(p.OptionalClassMethods) > 0 || len(p.OptionalInstanceMethods) > 0 {
+		sb.WriteString("\n@optional\n")
+		writeProperties(&sb, optional)
+		writeMethods(&sb, p.OptionalClassMethods)
+		writeMethods(&sb, p.OptionalInstanceMethods)
+	}
+	sb.WriteString("@end\n")
+	return sb.String()
+}
+
+// String returns the category's header declaration with its method addresses
+func (c *Category) String() string {
+	var sb strings.Builder
+	class := c.Class
+	if class == "" {
+		class = "?"
+	}
+	fmt.Fprintf(&sb, "@interface %s (%s)%s\n\n", class, c.Name, protocolList(c.Protocols))
+	writeProperties(&sb, c.Properties)
+	writeMethods(&sb, c.ClassMethods)
+	writeMethods(&sb, c.InstanceMethods)
+	sb.WriteString("@end\n")
+	return sb.String()
+}
+
+// Header returns the header-style declarations of all the protocols, classes and categories in the image
+// followed by the definitions of the structs they reference
+func (img *Image) Header() string {
+	var blocks []string
+	var fwd []string
+	for _, p := range img.Protocols {
+		blocks = append(blocks, p.String())
+	}
+	for _, c := range img.Classes {
+		if len(c.SuperClass) > 0 && !slices.Contains(fwd, c.SuperClass) {
+			fwd = append(fwd, c.SuperClass)
+		}
+		blocks = append(blocks, c.String())
+	}
+	for _, c := range img.Categories {
+		blocks = append(blocks, c.String())
+	}
+	var sb strings.Builder
+	if len(img.Name) > 0 {
+		fmt.Fprintf(&sb, "// %s\n\n", img.Name)
+	}
+	if len(fwd) > 0 {
+		slices.Sort(fwd)
+		fmt.Fprintf(&sb, "@class %s;\n\n", strings.Join(fwd, ", "))
+	}
+	for _, def := range StructDefinitions(img.types()...) {
+		sb.WriteString(def.Definition() + "\n\n")
+	}
+	sb.WriteString(strings.Join(blocks, "\n"))
+	return sb.String()
+}
+
+// types returns the parsed types of all the ivars, properties and methods in the image
+func (img *Image) types() []*Type {
+	var types []*Type
+	add := func(enc string) {
+		if typ, err := ParseType(enc); err == nil {
+			types = append(types, typ)
+		}
+	}
+	addMethods := func(methods ...[]Method) {
+		for _, ms := range methods {
+			for _, m := range ms {
+				if sig, err := ParseMethodTypes(m.Encoding); err == nil {
+					types = append(types, sig.Return)
+					types = append(types, sig.Args...)
+				}
+			}
+		}
+	}
+	addProps := func(props []Property) {
+		for _, p := range props {
+			for _, attr := range strings.Split(p.Encoding, ",") {
+				if enc, ok := strings.CutPrefix(attr, "T"); ok {
+					add(enc)
+				}
+			}
+		}
+	}
+	for _, p := range img.Protocols {
+		addProps(p.Properties)
+		addMethods(p.ClassMethods, p.InstanceMethods, p.OptionalClassMethods, p.OptionalInstanceMethods)
+	}
+	for _, c := range img.Classes {
+		for _, iv := range c.Ivars {
+			add(iv.Encoding)
+		}
+		addProps(c.Properties)
+		addMethods(c.ClassMethods, c.InstanceMethods)
+	}
+	for _, c := range img.Categories {
+		addProps(c.Properties)
+		addMethods(c.ClassMethods, c.InstanceMethods)
+	}
+	return types
+}
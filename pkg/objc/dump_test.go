@@ -0,0 +1,85 @@
+package objc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mobjc "github.com/blacktop/go-macho/types/objc"
+)
+
+func TestImageHeader(t *testing.T) {
+	proto := mobjc.Protocol{
+		Name:                    "Drawable",
+		Ptr:                     0x2000,
+		InstanceMethods:         []mobjc.Method{{Name: "draw", Types: "v16@0:8"}},
+		OptionalInstanceMethods: []mobjc.Method{{Name: "bounds", Types: `{CGRect="origin"{CGPoint="x"d"y"d}"size"{CGSize="width"d"height"d}}16@0:8`}},
+	}
+	class := mobjc.Class{
+		Name:       "Shape",
+		SuperClass: "NSObject",
+		ClassPtr:   0x3000,
+		Protocols:  []mobjc.Protocol{proto},
+		Ivars: []mobjc.Ivar{
+			{Name: "_name", Type: `@"NSString"`, Offset: 8, IvarT: mobjc.IvarT{Size: 8}},
+			{Name: "_sides", Type: "q", Offset: 16, IvarT: mobjc.IvarT{Size: 8}},
+		},
+		Props:           []mobjc.Property{{Name: "name", EncodedAttributes: `T@"NSString",C,N,V_name`}},
+		ClassMethods:    []mobjc.Method{{Name: "shapeWithSides:", Types: "@24@0:8q16", ImpVMAddr: 0x1000}},
+		InstanceMethods: []mobjc.Method{{Name: "setName:", Types: "v24@0:8@16", ImpVMAddr: 0x1010}},
+	}
+	img := &Image{
+		Name:       "Shapes",
+		Protocols:  []*Protocol{newProtocol(&proto)},
+		Classes:    []*Class{newClass(&class)},
+		Categories: []*Category{newCategory(&mobjc.Category{Name: "Debug", Class: &class, VMAddr: 0x4000})},
+	}
+
+	hdr := img.Header()
+	for _, want := range []string{
+		"@class NSObject;",
+		"struct CGRect {",
+		"@protocol Drawable\n",
+		"- (void)draw;\n\n@optional\n- (struct CGRect)bounds;\n@end",
+		"@interface Shape : NSObject <Drawable> {",
+		"    NSString *_name; // +0x8 (0x8)",
+		"    long long _sides; // +0x10 (0x8)",
+		"@property (copy, nonatomic) NSString *name;",
+		"+ (id)shapeWithSides:(long long)arg1; // 0x1000",
+		"- (void)setName:(id)arg1; // 0x1010",
+		"@interface Shape (Debug)",
+	} {
+		if !strings.Contains(hdr, want) {
+			t.Errorf("Header() missing %q:\n%s", want, hdr)
+		}
+	}
+
+	data, err := json.Marshal(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Image
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if c := got.Classes[0]; c.Ivars[1].Offset != 16 || c.InstanceMethods[0].Addr != 0x1010 || c.Properties[0].Ivar != "_name" {
+		t.Errorf("JSON round trip = %+v", c)
+	}
+}
+
+func TestSwiftClassHeader(t *testing.T) {
+	class := newClass(&mobjc.Class{
+		Name:          "_TtC9BlastDoor12EncoderUtils",
+		SuperClass:    "NSObject",
+		IsSwiftStable: true,
+	})
+	if class.SwiftName != "BlastDoor.EncoderUtils" {
+		t.Errorf("SwiftName = %q, want %q", class.SwiftName, "BlastDoor.EncoderUtils")
+	}
+	if want := "// BlastDoor.EncoderUtils\n@interface _TtC9BlastDoor12EncoderUtils : NSObject\n"; !strings.HasPrefix(class.String(), want) {
+		t.Errorf("String() =\n%s\nwant prefix:\n%s", class.String(), want)
+	}
+	if name := newClass(&mobjc.Class{Name: "Shape"}).SwiftName; name != "" {
+		t.Errorf("SwiftName of an ObjC class = %q, want none", name)
+	}
+}
@@ -0,0 +1,584 @@
+// Package objc parses Objective-C type encodings (the @encode strings of method signatures, ivars and properties)
+// and the Objective-C runtime metadata (classes, protocols and categories) of MachOs and dyld_shared_cache dylibs
+package objc
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blacktop/ipsw/pkg/errcode"
+)
+
+// Kind is the kind of an encoded type
+type Kind int
+
+const (
+	Primitive       Kind = iota // a C scalar (i.e. int, double, _Bool, SEL or Class)
+	Object                      // id or a pointer to an ObjC class
+	Block                       // an ObjC block
+	Pointer                     // a C pointer
+	FunctionPointer             // a C function pointer (^?)
+	Array                       // a C array
+	Struct                      // a C struct
+	Union                       // a C union
+	Bitfield                    // a bitfield struct member
+	Unknown                     // an unknown type (?)
+)
+
+func (k Kind) String() string {
+	return [...]string{"primitive", "object", "block", "pointer", "function pointer", "array", "struct", "union", "bitfield", "unknown"}[k]
+}
+
+// MarshalText marshals the kind as its name
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Type is a parsed type encoding
+type Type struct {
+	Kind       Kind     `json:"kind"`
+	Encoding   string   `json:"encoding"`
+	Name       string   `json:"name,omitempty"`       // the C type, ObjC class or struct/union tag
+	Qualifiers []string `json:"qualifiers,omitempty"` // i.e. const, in, out or oneway
+	Protocols  []string `json:"protocols,omitempty"`  // the protocols an object conforms to
+	Elem       *Type    `json:"elem,omitempty"`       // the pointee or array element
+	Len        int      `json:"len,omitempty"`        // the array length or bitfield width
+	Fields     []Field  `json:"fields,omitempty"`     // struct/union members (laid out by Layout)
+	Size       int64    `json:"size,omitempty"`       // set by Layout
+	Align      int64    `json:"align,omitempty"`      // set by Layout
+}
+
+// Field is a struct or union member
+type Field struct {
+	Name   string `json:"name,omitempty"` // only present in ivar (and some method) encodings
+	Type   *Type  `json:"type"`
+	Offset int64  `json:"offset"`
+	Bit    int    `json:"bit,omitempty"` // the bit offset of a bitfield into its storage unit at Offset
+}
+
+// MethodSignature is a parsed method type encoding
+type MethodSignature struct {
+	Return    *Type   `json:"return"`
+	Args      []*Type `json:"args"` // including self and _cmd
+	FrameSize int     `json:"frame_size,omitempty"`
+}
+
+var primitives = map[byte]string{
+	'c': "char",
+	'i': "int",
+	's': "short",
+	'l': "long", // always 32 bit (LP64 longs are encoded as q)
+	'q': "long long",
+	'C': "unsigned char",
+	'I': "unsigned int",
+	'S': "unsigned short",
+	'L': "unsigned long",
+	'Q': "unsigned long long",
+	'f': "float",
+	'd': "double",
+	'D': "long double",
+	'B': "_Bool",
+	'v': "void",
+	'#': "Class",
+	':': "SEL",
+	't': "__int128",
+	'T': "unsigned __int128",
+}
+
+// LP64 sizes (arm64's long double is a double)
+var primitiveSizes = map[byte]int64{
+	'c': 1, 'C': 1, 'B': 1, 'v': 1,
+	's': 2, 'S': 2,
+	'i': 4, 'I': 4, 'l': 4, 'L': 4, 'f': 4,
+	'q': 8, 'Q': 8, 'd': 8, 'D': 8, '#': 8, ':': 8,
+	't': 16, 'T': 16,
+}
+
+var qualifiers = map[byte]string{
+	'r': "const",
+	'n': "in",
+	'N': "inout",
+	'o': "out",
+	'O': "bycopy",
+	'R': "byref",
+	'V': "oneway",
+	'A': "_Atomic",
+	'j': "_Complex",
+}
+
+type parser struct {
+	enc string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return errcode.Errorf(errcode.InvalidArgument, "invalid type encoding %q at %d: %s", p.enc, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.enc) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.enc[p.pos]
+}
+
+func (p *parser) number() (int, bool) {
+	start := p.pos
+	for !p.eof() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.enc[start:p.pos])
+	return n, err == nil
+}
+
+// until returns the text up to (and skips) the delimiter
+func (p *parser) until(delim byte) (string, error) {
+	end := strings.IndexByte(p.enc[p.pos:], delim)
+	if end < 0 {
+		return "", p.errorf("missing %q", delim)
+	}
+	s := p.enc[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// parseType parses the next type (inStruct is set when parsing the members of a struct with named members)
+func (p *parser) parseType(inStruct bool) (*Type, error) {
+	start := p.pos
+	var quals []string
+	for q, ok := qualifiers[p.peek()]; ok; q, ok = qualifiers[p.peek()] {
+		quals = append(quals, q)
+		p.pos++
+	}
+	if p.eof() {
+		return nil, p.errorf("unexpected end of encoding")
+	}
+	t := &Type{Qualifiers: quals}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case '@':
+		t.Kind, t.Name = Object, "id"
+		switch p.peek() {
+		case '?':
+			p.pos++
+			t.Kind, t.Name = Block, ""
+			if p.peek() == '<' { // the block's signature
+				for depth := 0; !p.eof(); p.pos++ {
+					if p.peek() == '<' {
+						depth++
+					} else if p.peek() == '>' {
+						if depth--; depth == 0 {
+							p.pos++
+							break
+						}
+					}
+				}
+			}
+		case '"':
+			// in structs with named members a quoted string after an @ could also be the next member's name
+			save := p.pos
+			p.pos++
+			name, err := p.until('"')
+			if err != nil {
+				return nil, err
+			}
+			if inStruct && !p.eof() && p.peek() != '"' && p.peek() != '}' && p.peek() != ')' {
+				p.pos = save
+				break
+			}
+			if i := strings.IndexByte(name, '<'); i >= 0 {
+				for _, proto := range strings.Split(strings.Trim(name[i:], "<>"), "><") {
+					t.Protocols = append(t.Protocols, proto)
+				}
+				name = name[:i]
+			}
+			if len(name) > 0 {
+				t.Name = name
+			}
+		}
+	case '*':
+		t.Kind, t.Elem = Pointer, &Type{Kind: Primitive, Encoding: "c", Name: "char"}
+	case '^':
+		if p.peek() == '?' {
+			p.pos++
+			t.Kind = FunctionPointer
+			break
+		}
+		elem, err := p.parseType(false)
+		if err != nil {
+			return nil, err
+		}
+		t.Kind, t.Elem = Pointer, elem
+	case '[':
+		n, ok := p.number()
+		if !ok {
+			return nil, p.errorf("missing array length")
+		}
+		elem, err := p.parseType(false)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ']' {
+			return nil, p.errorf("missing ']'")
+		}
+		p.pos++
+		t.Kind, t.Len, t.Elem = Array, n, elem
+	case '{', '(':
+		if err := p.parseStructOrUnion(t, c); err != nil {
+			return nil, err
+		}
+	case 'b':
+		n, ok := p.number()
+		if !ok {
+			return nil, p.errorf("missing bitfield width")
+		}
+		t.Kind, t.Len = Bitfield, n
+	case '?':
+		t.Kind = Unknown
+	default:
+		name, ok := primitives[c]
+		if !ok {
+			p.pos--
+			return nil, p.errorf("unknown type %q", c)
+		}
+		t.Kind, t.Name = Primitive, name
+	}
+	t.Encoding = p.enc[start:p.pos]
+	return t, nil
+}
+
+func (p *parser) parseStructOrUnion(t *Type, open byte) error {
+	t.Kind = Struct
+	end := byte('}')
+	if open == '(' {
+		t.Kind, end = Union, ')'
+	}
+	// the tag can be a C++ template (i.e. {vector<int, std::allocator<int>>=...})
+	start, depth := p.pos, 0
+	for ; !p.eof(); p.pos++ {
+		c := p.peek()
+		if c == '<' {
+			depth++
+		} else if c == '>' {
+			depth--
+		} else if depth == 0 && (c == '=' || c == end) {
+			break
+		}
+	}
+	if p.eof() {
+		return p.errorf("missing %q", end)
+	}
+	if t.Name = p.enc[start:p.pos]; t.Name == "?" {
+		t.Name = ""
+	}
+	if p.peek() == end { // a reference to (not a definition of) the struct
+		p.pos++
+		return nil
+	}
+	p.pos++ // =
+	named := p.peek() == '"'
+	for !p.eof() && p.peek() != end {
+		var f Field
+		if p.peek() == '"' {
+			p.pos++
+			name, err := p.until('"')
+			if err != nil {
+				return err
+			}
+			f.Name = name
+		}
+		typ, err := p.parseType(named)
+		if err != nil {
+			return err
+		}
+		f.Type = typ
+		t.Fields = append(t.Fields, f)
+	}
+	if p.eof() {
+		return p.errorf("missing %q", end)
+	}
+	p.pos++
+	return nil
+}
+
+// skipOffset skips the stack/register offset that follows each type in a method encoding
+func (p *parser) skipOffset() int {
+	if p.peek() == '+' || p.peek() == '-' {
+		p.pos++
+	}
+	n, _ := p.number()
+	return n
+}
+
+// ParseType parses an ivar, property or struct type encoding and lays it out
+func ParseType(enc string) (*Type, error) {
+	p := &parser{enc: enc}
+	t, err := p.parseType(false)
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("trailing data")
+	}
+	t.Layout()
+	return t, nil
+}
+
+// ParseMethodTypes parses a method's type encoding (i.e. "@24@0:8@16") and lays out its types
+func ParseMethodTypes(enc string) (*MethodSignature, error) {
+	p := &parser{enc: enc}
+	ret, err := p.parseType(false)
+	if err != nil {
+		return nil, err
+	}
+	ret.Layout()
+	sig := &MethodSignature{Return: ret, FrameSize: p.skipOffset()}
+	for !p.eof() {
+		arg, err := p.parseType(false)
+		if err != nil {
+			return nil, err
+		}
+		arg.Layout()
+		sig.Args = append(sig.Args, arg)
+		p.skipOffset()
+	}
+	return sig, nil
+}
+
+// bitfields are laid out in the (most common) unsigned int storage units as their declared type isn't encoded
+const bitfieldUnit = 32
+
+// Layout computes the size and alignment of the type and the offsets of its members for the LP64 ABI and
+// returns false if the layout is incomplete (i.e. it contains a struct that is only referenced by name)
+//
+// NOTE: bitfields are assumed to be declared as unsigned int (or unsigned long long if wider than 32 bits)
+func (t *Type) Layout() bool {
+	switch t.Kind {
+	case Primitive:
+		t.Size = primitiveSizes[t.Encoding[len(t.Encoding)-1]]
+		t.Align = max(t.Size, 1)
+		if t.Encoding[len(t.Encoding)-1] == 'v' {
+			t.Size = 0
+		}
+		if slices.Contains(t.Qualifiers, "_Complex") {
+			t.Size *= 2
+		}
+	case Object, Block, Pointer, FunctionPointer:
+		t.Size, t.Align = 8, 8
+		if t.Elem != nil {
+			t.Elem.Layout()
+		}
+	case Array:
+		ok := t.Elem.Layout()
+		t.Size, t.Align = int64(t.Len)*t.Elem.Size, t.Elem.Align
+		return ok
+	case Struct, Union:
+		if len(t.Fields) == 0 {
+			return false
+		}
+		ok := true
+		var (
+			off      int64 // the offset of the next member
+			unitOff  int64 // the offset of the current bitfield storage unit
+			unitBits int   // the size of the current bitfield storage unit (0 if not in one)
+			bits     int   // the bits used in the current bitfield storage unit
+		)
+		t.Align = 1
+		for i := range t.Fields {
+			f := &t.Fields[i]
+			if !f.Type.Layout() {
+				ok = false
+			}
+			if t.Kind == Union {
+				t.Size = max(t.Size, f.Type.Size)
+				t.Align = max(t.Align, f.Type.Align)
+				continue
+			}
+			if f.Type.Kind == Bitfield {
+				if unitBits == 0 || bits+f.Type.Len > unitBits {
+					off = (off + f.Type.Align - 1) &^ (f.Type.Align - 1)
+					unitOff, unitBits, bits = off, int(f.Type.Size*8), 0
+				}
+				f.Offset, f.Bit = unitOff, bits
+				bits += f.Type.Len
+				off = unitOff + int64(bits+7)/8 // the following members are packed into the unit's unused bytes
+				t.Size = max(t.Size, unitOff+f.Type.Size)
+			} else {
+				unitBits = 0
+				off = (off + f.Type.Align - 1) &^ (f.Type.Align - 1)
+				f.Offset = off
+				off += f.Type.Size
+				t.Size = max(t.Size, off)
+			}
+			t.Align = max(t.Align, f.Type.Align)
+		}
+		if !ok {
+			return false
+		}
+		t.Size = (t.Size + t.Align - 1) &^ (t.Align - 1)
+	case Bitfield:
+		t.Size, t.Align = 4, 4
+		if t.Len > bitfieldUnit {
+			t.Size, t.Align = 8, 8
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (t *Type) qualifiers() string {
+	var quals []string
+	for _, q := range t.Qualifiers {
+		if q != "_Complex" {
+			quals = append(quals, q)
+		}
+	}
+	if len(quals) == 0 {
+		return ""
+	}
+	return strings.Join(quals, " ") + " "
+}
+
+// declarator joins a type and a (possibly empty) declarator
+func declarator(typ, name string) string {
+	if len(name) == 0 {
+		return typ
+	}
+	if strings.HasSuffix(typ, "*") && !strings.HasPrefix(name, "[") {
+		return typ + name
+	}
+	return typ + " " + name
+}
+
+// Decl returns the C declaration of a variable (or a cast if name is empty) of the type
+//
+// NOTE: named structs are referenced by their tag (see StructDefinitions) while anonymous ones are expanded inline
+func (t *Type) Decl(name string) string {
+	switch t.Kind {
+	case Primitive:
+		typ := t.Name
+		if slices.Contains(t.Qualifiers, "_Complex") {
+			typ = "_Complex " + typ
+		}
+		return t.qualifiers() + declarator(typ, name)
+	case Object:
+		typ := t.Name
+		if len(t.Protocols) > 0 {
+			typ += " <" + strings.Join(t.Protocols, ", ") + ">"
+		}
+		if t.Name != "id" {
+			typ += " *"
+		}
+		return t.qualifiers() + declarator(typ, name)
+	case Block:
+		return t.qualifiers() + declarator("CDUnknownBlockType", name)
+	case FunctionPointer:
+		return t.qualifiers() + declarator("CDUnknownFunctionPointerType", name)
+	case Pointer:
+		if t.Elem.Kind == Array {
+			return t.Elem.Elem.Decl(fmt.Sprintf("(*%s)[%d]", name, t.Elem.Len))
+		}
+		return t.qualifiers() + t.Elem.Decl("*"+name)
+	case Array:
+		return t.Elem.Decl(fmt.Sprintf("%s[%d]", name, t.Len))
+	case Struct, Union:
+		kind := "struct"
+		if t.Kind == Union {
+			kind = "union"
+		}
+		if len(t.Name) > 0 {
+			return t.qualifiers() + declarator(kind+" "+t.Name, name)
+		}
+		var sb strings.Builder
+		sb.WriteString(kind + " {")
+		for i, f := range t.Fields {
+			sb.WriteString(" " + f.Type.Decl(fieldName(f, i)) + ";")
+		}
+		sb.WriteString(" }")
+		return t.qualifiers() + declarator(sb.String(), name)
+	case Bitfield:
+		typ := "unsigned int"
+		if t.Len > bitfieldUnit {
+			typ = "unsigned long long"
+		}
+		return fmt.Sprintf("%s:%d", declarator(typ, name), t.Len)
+	default:
+		return declarator("void", name) + " /* unknown type */"
+	}
+}
+
+func fieldName(f Field, i int) string {
+	if len(f.Name) > 0 {
+		return f.Name
+	}
+	return fmt.Sprintf("_field%d", i+1)
+}
+
+// Definition returns the C definition of a struct or union with the offset of each of its members
+func (t *Type) Definition() string {
+	var sb strings.Builder
+	kind := "struct"
+	if t.Kind == Union {
+		kind = "union"
+	}
+	fmt.Fprintf(&sb, "%s %s {\n", kind, t.Name)
+	laidOut := t.Size > 0
+	for i, f := range t.Fields {
+		fmt.Fprintf(&sb, "    %s;", f.Type.Decl(fieldName(f, i)))
+		if laidOut {
+			fmt.Fprintf(&sb, "\t// %d = %#x", f.Offset, f.Offset)
+			if f.Type.Kind == Bitfield {
+				fmt.Fprintf(&sb, " (bit %d)", f.Bit)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("};")
+	if laidOut {
+		fmt.Fprintf(&sb, "\t// size %d = %#x", t.Size, t.Size)
+	}
+	return sb.String()
+}
+
+// StructDefinitions returns the named structs and unions defined anywhere in the types (sorted by tag) preferring
+// the definitions with member names when a struct is encoded more than once
+func StructDefinitions(types ...*Type) []*Type {
+	defs := make(map[string]*Type)
+	var walk func(t *Type)
+	walk = func(t *Type) {
+		if t == nil {
+			return
+		}
+		walk(t.Elem)
+		if t.Kind != Struct && t.Kind != Union {
+			return
+		}
+		for _, f := range t.Fields {
+			walk(f.Type)
+		}
+		if len(t.Name) == 0 || len(t.Fields) == 0 {
+			return
+		}
+		key := t.Kind.String() + " " + t.Name
+		if prev, ok := defs[key]; !ok || (len(prev.Fields[0].Name) == 0 && len(t.Fields[0].Name) > 0) {
+			defs[key] = t
+		}
+	}
+	for _, t := range types {
+		walk(t)
+	}
+	out := make([]*Type, 0, len(defs))
+	for _, t := range defs {
+		out = append(out, t)
+	}
+	slices.SortFunc(out, func(a, b *Type) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return out
+}
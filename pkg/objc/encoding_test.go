@@ -0,0 +1,89 @@
+package objc
+
+import (
+	"testing"
+)
+
+func TestParseType(t *testing.T) {
+	tests := []struct {
+		enc  string
+		decl string
+		size int64
+	}{
+		{`@"NSString"`, "NSString *_name", 8},
+		{`@"<NSCopying><NSCoding>"`, "id <NSCopying, NSCoding> _name", 8},
+		{`@?`, "CDUnknownBlockType _name", 8},
+		{`^?`, "CDUnknownFunctionPointerType _name", 8},
+		{`r*`, "const char *_name", 8},
+		{`^^v`, "void **_name", 8},
+		{`[4i]`, "int _name[4]", 16},
+		{`^[4c]`, "char (*_name)[4]", 8},
+		{`{CGRect="origin"{CGPoint="x"d"y"d}"size"{CGSize="width"d"height"d}}`, "struct CGRect _name", 32},
+		{`{?="a"c"b"i}`, "struct { char a; int b; } _name", 8},
+		{`(?="u"Q"f"f)`, "union { unsigned long long u; float f; } _name", 8},
+		{`{Flags=b1b2c}`, "struct Flags _name", 4},
+	}
+	for _, tt := range tests {
+		typ, err := ParseType(tt.enc)
+		if err != nil {
+			t.Fatalf("ParseType(%q) error = %v", tt.enc, err)
+		}
+		if got := typ.Decl("_name"); got != tt.decl {
+			t.Errorf("ParseType(%q).Decl() = %q, want %q", tt.enc, got, tt.decl)
+		}
+		if typ.Size != tt.size {
+			t.Errorf("ParseType(%q).Size = %d, want %d", tt.enc, typ.Size, tt.size)
+		}
+	}
+
+	for _, enc := range []string{"", "{CGRect=dd", "[i]", "x", "ii"} {
+		if _, err := ParseType(enc); err == nil {
+			t.Errorf("ParseType(%q) succeeded, want error", enc)
+		}
+	}
+}
+
+func TestStructLayout(t *testing.T) {
+	// a struct whose object member's class name is followed by the next member's name
+	typ, err := ParseType(`{Foo="obj"@"NSObject""flag"b1"mode"b3"c"c"rect"{CGRect={CGPoint=dd}{CGSize=dd}}"ref"^{Opaque}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "struct Foo {\n" +
+		"    NSObject *obj;\t// 0 = 0x0\n" +
+		"    unsigned int flag:1;\t// 8 = 0x8 (bit 0)\n" +
+		"    unsigned int mode:3;\t// 8 = 0x8 (bit 1)\n" +
+		"    char c;\t// 9 = 0x9\n" +
+		"    struct CGRect rect;\t// 16 = 0x10\n" +
+		"    struct Opaque *ref;\t// 48 = 0x30\n" +
+		"};\t// size 56 = 0x38"
+	if got := typ.Definition(); got != want {
+		t.Errorf("Definition() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// the member named "b" is an id and not an instance of class b
+	if typ, err := ParseType(`{Bar="a"@"b"i}`); err != nil || len(typ.Fields) != 2 || typ.Fields[1].Name != "b" {
+		t.Errorf("ParseType(Bar) = %+v, %v", typ, err)
+	}
+}
+
+func TestParseMethodTypes(t *testing.T) {
+	sig, err := ParseMethodTypes("{CGRect={CGPoint=dd}{CGSize=dd}}40@0:8r^{CGPoint=dd}16Vv24@?<v@?>32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Return.Size != 32 || sig.FrameSize != 40 || len(sig.Args) != 5 {
+		t.Fatalf("ParseMethodTypes() = %+v", sig)
+	}
+	if got := sig.Args[2].Decl(""); got != "const struct CGPoint *" {
+		t.Errorf("ParseMethodTypes() arg 2 = %q", got)
+	}
+	if sig.Args[4].Kind != Block {
+		t.Errorf("ParseMethodTypes() arg 4 = %v, want block", sig.Args[4].Kind)
+	}
+
+	defs := StructDefinitions(sig.Return, sig.Args[2])
+	if len(defs) != 3 || defs[0].Name != "CGPoint" || defs[1].Name != "CGRect" || defs[2].Name != "CGSize" {
+		t.Errorf("StructDefinitions() = %+v", defs)
+	}
+}
@@ -0,0 +1,208 @@
+package objc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	mobjc "github.com/blacktop/go-macho/types/objc"
+	"github.com/blacktop/ipsw/internal/swift"
+)
+
+// class_t field offsets (isa, superclass, cache, vtable, data)
+const (
+	classIsaOffset        = 0
+	classSuperclassOffset = 8
+	classDataOffset       = 32
+)
+
+// getClasses parses the classes of every __objc_classlist in the MachO's __DATA* and __AUTH* segments
+//
+// NOTE: unlike macho.File.GetObjCClasses a class that fails to parse (i.e. its class_ro_t name pointer can't be
+// resolved) is recovered from its metaclass, symbols and binds instead of failing the whole image
+func getClasses(m *macho.File) ([]mobjc.Class, error) {
+	var classes []mobjc.Class
+	found := false
+	for _, seg := range m.Segments() {
+		if !strings.HasPrefix(seg.Name, "__DATA") && !strings.HasPrefix(seg.Name, "__AUTH") {
+			continue
+		}
+		sec := m.Section(seg.Name, "__objc_classlist")
+		if sec == nil {
+			continue
+		}
+		found = true
+		dat, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s data: %v", sec.Seg, sec.Name, err)
+		}
+		for i := 0; i+8 <= len(dat); i += 8 {
+			raw := binary.LittleEndian.Uint64(dat[i:])
+			addr := m.SlidePointer(raw)
+			if c, err := m.GetObjCClass2(addr); err == nil {
+				classes = append(classes, *c)
+				continue
+			}
+			if name, err := m.GetBindName(raw); err == nil { // an imported class
+				classes = append(classes, mobjc.Class{Name: strings.TrimPrefix(name, "_OBJC_CLASS_$_")})
+				continue
+			}
+			classes = append(classes, *recoverClass(m, addr))
+		}
+	}
+	if !found {
+		return nil, macho.ErrObjcSectionNotFound
+	}
+	return classes, nil
+}
+
+// recoverClass parses as much of the class_t at addr as can be read
+func recoverClass(m *macho.File, addr uint64) *mobjc.Class {
+	c := &mobjc.Class{ClassPtr: addr}
+	c.IsaVMAddr, _ = m.GetPointerAtAddress(addr + classIsaOffset)
+	c.SuperclassVMAddr, _ = m.GetPointerAtAddress(addr + classSuperclassOffset)
+	if data, err := m.GetPointerAtAddress(addr + classDataOffset); err == nil {
+		c.DataVMAddr = data & mobjc.FAST_DATA_MASK64
+		c.IsSwiftLegacy = data&mobjc.FAST_IS_SWIFT_LEGACY != 0
+		c.IsSwiftStable = data&mobjc.FAST_IS_SWIFT_STABLE != 0
+	}
+	if info := classInfo(m, addr); info != nil {
+		c.ReadOnlyData = *info
+		c.Name, _ = m.GetCString(info.NameVMAddr)
+		c.InstanceMethods = methodList(m, info.BaseMethodsVMAddr)
+		if info.IvarsVMAddr > 0 {
+			c.Ivars, _ = m.GetObjCIvars(info.IvarsVMAddr)
+		}
+		if info.BasePropertiesVMAddr > 0 && info.BasePropertiesVMAddr&1 == 0 {
+			c.Props, _ = m.GetObjCProperties(info.BasePropertiesVMAddr)
+		}
+	}
+	if c.IsaVMAddr > 0 {
+		if meta := classInfo(m, c.IsaVMAddr); meta != nil {
+			c.ClassMethods = methodList(m, meta.BaseMethodsVMAddr)
+		}
+	}
+	if !c.ReadOnlyData.Flags.IsRoot() {
+		if c.SuperclassVMAddr > 0 {
+			c.SuperClass = classNameAt(m, c.SuperclassVMAddr)
+		} else {
+			c.SuperClass = bindName(m, addr+classSuperclassOffset)
+		}
+	}
+	c.Name = ClassName(m, c)
+	return c
+}
+
+// classInfo returns the class_ro_t of the class_t at addr
+func classInfo(m *macho.File, addr uint64) *mobjc.ClassRO64 {
+	data, err := m.GetPointerAtAddress(addr + classDataOffset)
+	if err != nil || data&mobjc.FAST_DATA_MASK64 == 0 {
+		return nil
+	}
+	info, err := m.GetObjCClassInfo(data & mobjc.FAST_DATA_MASK64)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// methodList returns the methods of a method_list_t (skipping lists with preattached categories)
+func methodList(m *macho.File, addr uint64) []mobjc.Method {
+	if addr == 0 || addr&1 != 0 {
+		return nil
+	}
+	methods, _ := m.GetObjCMethods(addr)
+	return methods
+}
+
+// classNameAt returns the name of the class_t at addr from its symbol or class_ro_t
+func classNameAt(m *macho.File, addr uint64) string {
+	if syms, err := m.FindAddressSymbols(addr); err == nil {
+		for _, sym := range syms {
+			for _, prefix := range []string{"_OBJC_CLASS_$_", "_OBJC_METACLASS_$_"} {
+				if name, ok := strings.CutPrefix(sym.Name, prefix); ok {
+					return name
+				}
+			}
+		}
+	}
+	if info := classInfo(m, addr); info != nil {
+		if name, err := m.GetCString(info.NameVMAddr); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// bindName returns the name of the class imported by the pointer at addr
+func bindName(m *macho.File, addr uint64) string {
+	off, err := m.GetOffset(addr)
+	if err != nil {
+		return ""
+	}
+	var buf [8]byte
+	if _, err := m.ReadAt(buf[:], int64(off)); err != nil {
+		return ""
+	}
+	name, err := m.GetBindName(binary.LittleEndian.Uint64(buf[:]))
+	if err != nil {
+		if name, err = m.GetBindName(addr); err != nil { // LC_DYLD_INFO binds are keyed by address
+			return ""
+		}
+	}
+	name = strings.TrimPrefix(name, "_OBJC_CLASS_$_")
+	return strings.TrimPrefix(name, "_OBJC_METACLASS_$_")
+}
+
+// ClassName returns the class's name falling back to its metaclass's name, its symbol and finally the name in
+// its metaclass's class_ro_t for classes whose class_ro_t name could not be resolved
+func ClassName(m *macho.File, c *mobjc.Class) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Isa != "" && !strings.HasPrefix(c.Isa, "<") { // a metaclass shares its class's name
+		return c.Isa
+	}
+	if c.ClassPtr > 0 {
+		if name := classNameAt(m, c.ClassPtr); name != "" {
+			return name
+		}
+	}
+	if c.IsaVMAddr > 0 {
+		return classNameAt(m, c.IsaVMAddr)
+	}
+	return ""
+}
+
+// CategoryClass returns the name of the class a category extends resolving it from the category's class
+// pointer when it wasn't parsed
+func CategoryClass(m *macho.File, c *mobjc.Category) string {
+	if c.Class != nil {
+		if c.Class.Name != "" {
+			return c.Class.Name
+		}
+		if name := ClassName(m, c.Class); name != "" {
+			return name
+		}
+	}
+	addr := c.VMAddr + 8 // category_t.cls
+	if name := bindName(m, addr); name != "" {
+		return name
+	}
+	if ptr, err := m.GetPointerAtAddress(addr); err == nil && ptr > 0 {
+		return classNameAt(m, ptr)
+	}
+	return ""
+}
+
+// swiftName returns the demangled name of a Swift class's ObjC runtime name (i.e. _TtC9BlastDoor12EncoderUtils)
+func swiftName(name string) string {
+	if !strings.HasPrefix(name, "_Tt") {
+		return ""
+	}
+	if out, err := swift.Demangle(name); err == nil && out != name {
+		return out
+	}
+	return ""
+}
@@ -2,9 +2,11 @@ package ota
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -498,7 +500,7 @@ func (r *Reader) PayloadFiles(pattern string, json bool) error {
 func aaList(in io.Reader, pattern string, json bool) (string, error) {
 	aaPath, err := execabs.LookPath("aa")
 	if err != nil {
-		return "", err
+		return yaaList(in, pattern, json)
 	}
 
 	args := []string{"list", "-exclude-field", "all", "-include-field", "attr"}
@@ -526,7 +528,7 @@ func aaList(in io.Reader, pattern string, json bool) (string, error) {
 func aaExtractPattern(in io.Reader, pattern, output string) error {
 	aaPath, err := execabs.LookPath("aa")
 	if err != nil {
-		return err
+		return yaaExtractPattern(in, pattern, output)
 	}
 	cmd := exec.Command(aaPath, "extract", "-d", output, "-include-regex", pattern)
 	cmd.Stdin = in
@@ -539,6 +541,112 @@ func aaExtractPattern(in io.Reader, pattern, output string) error {
 	return nil
 }
 
+// openPayload parses a (pbzx compressed) Apple Archive payload without the macOS 'aa' binary
+func openPayload(in io.Reader) (*yaa.YAA, func(), error) {
+	tmp, err := os.CreateTemp("", "ota_payload")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	br := bufio.NewReader(in)
+	if hdr, err := br.Peek(4); err == nil && string(hdr) == "pbzx" {
+		if err := pbzx.Extract(context.Background(), br, tmp, runtime.NumCPU()); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to decompress pbzx payload: %v", err)
+		}
+	} else if _, err := io.Copy(tmp, br); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read payload: %v", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	aa, err := yaa.Parse(tmp)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to parse payload: %v", err)
+	}
+	return aa, cleanup, nil
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) == 0 {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile regex pattern '%s': %v", pattern, err)
+	}
+	return re, nil
+}
+
+func yaaList(in io.Reader, pattern string, asJSON bool) (string, error) {
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	aa, cleanup, err := openPayload(in)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	ents := aa.Match(re)
+
+	if asJSON {
+		type listEntry struct {
+			Path string      `json:"path"`
+			Type string      `json:"type"`
+			Mode fs.FileMode `json:"mode"`
+			Size uint32      `json:"size,omitempty"`
+			Link string      `json:"link,omitempty"`
+		}
+		list := make([]listEntry, 0, len(ents))
+		for _, ent := range ents {
+			list = append(list, listEntry{
+				Path: ent.Path,
+				Type: ent.Type.String(),
+				Mode: ent.Mod,
+				Size: ent.Size,
+				Link: ent.Link,
+			})
+		}
+		dat, err := json.Marshal(list)
+		if err != nil {
+			return "", err
+		}
+		return string(dat), nil
+	}
+
+	var out []string
+	for _, ent := range ents {
+		if re != nil {
+			out = append(out, ent.Path)
+		} else {
+			out = append(out, ent.String())
+		}
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+func yaaExtractPattern(in io.Reader, pattern, output string) error {
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return err
+	}
+	aa, cleanup, err := openPayload(in)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	_, err = aa.Extract(output, re)
+	return err
+}
+
 func (r *Reader) ExtractFromCryptexes(pattern, output string) ([]string, error) {
 	var out []string
 
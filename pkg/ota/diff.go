@@ -0,0 +1,121 @@
+package ota
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const patchesDir = "AssetData/payloadv2/patches/"
+
+var payloadRE = regexp.MustCompile(`^payload.\d+$`)
+
+// FileChange is a file whose size changed between two OTAs
+type FileChange struct {
+	Path    string `json:"path"`
+	OldSize int64  `json:"old_size"`
+	NewSize int64  `json:"new_size"`
+}
+
+// FileDiff is the difference between two OTAs' file lists
+type FileDiff struct {
+	New     []string     `json:"new,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Changed []FileChange `json:"changed,omitempty"`
+}
+
+// Empty returns true if there are no differences
+func (d *FileDiff) Empty() bool {
+	return len(d.New) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff is the difference between two OTAs
+type Diff struct {
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// OTA assets (firmwares, kernelcaches, cryptexes, plists, etc)
+	Components FileDiff `json:"components"`
+	// binaries patched by the (delta) OTAs (i.e. the files in AssetData/payloadv2/patches)
+	Patched FileDiff `json:"patched"`
+	// file system paths in the OTAs' post.bom (the files on the updated OS)
+	Files FileDiff `json:"files"`
+}
+
+func diffSizes(prev, next map[string]int64) FileDiff {
+	var diff FileDiff
+	for path, size := range next {
+		if oldSize, ok := prev[path]; !ok {
+			diff.New = append(diff.New, path)
+		} else if oldSize != size {
+			diff.Changed = append(diff.Changed, FileChange{Path: path, OldSize: oldSize, NewSize: size})
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			diff.Removed = append(diff.Removed, path)
+		}
+	}
+	slices.Sort(diff.New)
+	slices.Sort(diff.Removed)
+	slices.SortFunc(diff.Changed, func(a, b FileChange) int { return strings.Compare(a.Path, b.Path) })
+	return diff
+}
+
+// otaFiles returns the OTA's component and patch file sizes (keyed by path)
+func (r *Reader) otaFiles() (components, patches map[string]int64, err error) {
+	if err := r.initFileList(); err != nil {
+		return nil, nil, err
+	}
+	components = make(map[string]int64)
+	patches = make(map[string]int64)
+	for _, f := range r.fileList {
+		if f.isDir || f.isDup {
+			continue
+		}
+		if patched, ok := strings.CutPrefix(f.name, patchesDir); ok {
+			patches["/"+patched] = f.Size()
+		} else if !payloadRE.MatchString(f.Name()) {
+			components[f.name] = f.Size()
+		}
+	}
+	return components, patches, nil
+}
+
+func bomSizes(files []fs.FileInfo) map[string]int64 {
+	sizes := make(map[string]int64, len(files))
+	for _, f := range files {
+		if !f.IsDir() {
+			sizes[f.Name()] = f.Size()
+		}
+	}
+	return sizes
+}
+
+func (a *AA) version() string {
+	inf, err := a.Info()
+	if err != nil || inf.Plists == nil || inf.Plists.BuildManifest == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", inf.Plists.BuildManifest.ProductVersion, inf.Plists.BuildManifest.ProductBuildVersion)
+}
+
+// DiffOTAs diffs two OTAs' components, patched binaries and post.bom file lists without extracting their payloads
+func DiffOTAs(prev, next *AA) (*Diff, error) {
+	pcomps, ppatches, err := prev.otaFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list 'Old' OTA files: %v", err)
+	}
+	ncomps, npatches, err := next.otaFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list 'New' OTA files: %v", err)
+	}
+	return &Diff{
+		Old:        prev.version(),
+		New:        next.version(),
+		Components: diffSizes(pcomps, ncomps),
+		Patched:    diffSizes(ppatches, npatches),
+		Files:      diffSizes(bomSizes(prev.PostFiles()), bomSizes(next.PostFiles())),
+	}, nil
+}
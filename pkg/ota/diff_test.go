@@ -0,0 +1,74 @@
+package ota
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testOTA(t *testing.T, files map[string]string) *AA {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewOTA(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestDiffOTAs(t *testing.T) {
+	prev := testOTA(t, map[string]string{
+		"AssetData/boot/kernelcache.release.iphone15":                         "kernel",
+		"AssetData/boot/Firmware/all_flash/iBoot.d73.RELEASE.im4p":            "iboot",
+		"AssetData/payloadv2/payload.000":                                     "payload",
+		"AssetData/payloadv2/patches/usr/lib/dyld":                            "patch",
+		"AssetData/payloadv2/patches/System/Library/CoreServices/SpringBoard": "patch",
+	})
+	next := testOTA(t, map[string]string{
+		"AssetData/boot/kernelcache.release.iphone15":              "kernel-v2",
+		"AssetData/boot/Firmware/all_flash/iBoot.d73.RELEASE.im4p": "iboot",
+		"AssetData/boot/Firmware/all_flash/sep-firmware.im4p":      "sep",
+		"AssetData/payloadv2/payload.000":                          "payload-v2",
+		"AssetData/payloadv2/patches/usr/lib/dyld":                 "patch-v2",
+		"AssetData/payloadv2/patches/usr/libexec/amfid":            "patch",
+	})
+
+	diff, err := DiffOTAs(prev, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(diff.Components.New, ","); got != "AssetData/boot/Firmware/all_flash/sep-firmware.im4p" {
+		t.Errorf("new components = %s", got)
+	}
+	if len(diff.Components.Removed) != 0 {
+		t.Errorf("removed components = %v", diff.Components.Removed)
+	}
+	if len(diff.Components.Changed) != 1 || diff.Components.Changed[0].Path != "AssetData/boot/kernelcache.release.iphone15" {
+		t.Errorf("changed components = %v (payloads should be ignored)", diff.Components.Changed)
+	}
+	if got := strings.Join(diff.Patched.New, ","); got != "/usr/libexec/amfid" {
+		t.Errorf("new patched = %s", got)
+	}
+	if got := strings.Join(diff.Patched.Removed, ","); got != "/System/Library/CoreServices/SpringBoard" {
+		t.Errorf("removed patched = %s", got)
+	}
+	if len(diff.Patched.Changed) != 1 || diff.Patched.Changed[0] != (FileChange{Path: "/usr/lib/dyld", OldSize: 5, NewSize: 8}) {
+		t.Errorf("changed patched = %v", diff.Patched.Changed)
+	}
+	if !diff.Files.Empty() {
+		t.Errorf("files = %v (OTAs have no post.bom)", diff.Files)
+	}
+}
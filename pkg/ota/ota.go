@@ -12,12 +12,12 @@ import (
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/compress"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/bom"
 	"github.com/blacktop/ipsw/pkg/ota/yaa"
 	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
-	"github.com/ulikunitz/xz"
 	"golang.org/x/sys/execabs"
 	// "github.com/blacktop/xz"
 	// "github.com/therootcompany/xz"
@@ -63,14 +63,10 @@ func RemoteList(zr *zip.Reader) ([]os.FileInfo, error) {
 	return parseBOMFromZip(zr, `post.bom$`)
 }
 
-// NewXZReader uses the xz command to extract the Apple Archives (xz streams) or falls back to the pure Golang xz decompression lib
+// NewXZReader uses the xz command to extract the Apple Archives (xz streams) or falls back to the pure Golang xz reader from internal/compress
 func NewXZReader(r io.Reader) (io.ReadCloser, error) {
 	if _, err := execabs.LookPath("xz"); err != nil {
-		xr, err := xz.NewReader(r)
-		if err != nil {
-			return nil, err
-		}
-		return io.NopCloser(xr), nil
+		return compress.NewFormatReader(r, compress.Xz)
 	}
 
 	rpipe, wpipe := io.Pipe()
@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/xi2/xz"
+	"github.com/blacktop/ipsw/internal/compress"
 )
 
 func inflate(ctx context.Context, reader <-chan _Chunk, writeCh chan<- _Chunk) error {
@@ -21,13 +21,13 @@ func inflate(ctx context.Context, reader <-chan _Chunk, writeCh chan<- _Chunk) e
 		if !ok {
 			return nil
 		}
-		rd, err := xz.NewReader(bytes.NewBuffer(chunk.data), 0)
-		rd.Multistream(false)
+		rd, _, err := compress.NewReader(bytes.NewReader(chunk.data))
 		if err != nil {
 			return fmt.Errorf("inflate error: %w", err)
 		}
 		buf := make([]byte, chunk.meta+1)
 		n, err := io.ReadFull(rd, buf)
+		rd.Close()
 		if err != io.ErrUnexpectedEOF || n != chunk.meta {
 			return fmt.Errorf("inflate error: %w", err)
 		}
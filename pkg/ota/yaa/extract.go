@@ -0,0 +1,121 @@
+package yaa
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Open returns a reader for a regular file entry's data
+func (y *YAA) Open(e *Entry) (io.Reader, error) {
+	if e.Type != RegularFile {
+		return nil, fmt.Errorf("%s is not a regular file", e.Path)
+	}
+	return io.NewSectionReader(y, e.fileOffset, int64(e.Size)), nil
+}
+
+// Match returns the file system entries whose path matches the pattern (or all of them if pattern is nil)
+func (y *YAA) Match(pattern *regexp.Regexp) []*Entry {
+	var ents []*Entry
+	for _, ent := range y.Entries {
+		if ent.Type == Metadata || len(ent.Path) == 0 {
+			continue
+		}
+		if pattern == nil || pattern.MatchString(ent.Path) {
+			ents = append(ents, ent)
+		}
+	}
+	return ents
+}
+
+// Extract extracts the entries whose path matches the pattern (or all of them if pattern is nil) into the output folder
+//
+// NOTE: entries with absolute or escaping paths, symlinks with absolute or escaping targets and entries below an
+// extracted symlink are refused so a malicious archive can't write outside of output
+func (y *YAA) Extract(output string, pattern *regexp.Regexp) ([]string, error) {
+	var out []string
+	for _, ent := range y.Match(pattern) {
+		rel := filepath.FromSlash(ent.Path)
+		if !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("refusing to extract entry with unsafe path '%s'", ent.Path)
+		}
+		if err := checkNoSymlinks(output, filepath.Dir(rel)); err != nil {
+			return nil, err
+		}
+		fname := filepath.Join(output, rel)
+		mode := unixModeToFileMode(uint32(ent.Mod)).Perm()
+		switch ent.Type {
+		case Directory:
+			if err := os.MkdirAll(fname, 0o750); err != nil {
+				return nil, fmt.Errorf("failed to create dir %s: %v", fname, err)
+			}
+		case RegularFile:
+			if err := os.MkdirAll(filepath.Dir(fname), 0o750); err != nil {
+				return nil, fmt.Errorf("failed to create dir %s: %v", filepath.Dir(fname), err)
+			}
+			r, err := y.Open(ent)
+			if err != nil {
+				return nil, err
+			}
+			if mode == 0 {
+				mode = 0o644
+			}
+			if fi, err := os.Lstat(fname); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				os.Remove(fname) // don't write through a previously extracted symlink
+			}
+			f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create file %s: %v", fname, err)
+			}
+			if _, err := io.Copy(f, r); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to write file %s: %v", fname, err)
+			}
+			f.Close()
+			if !ent.Mtm.IsZero() {
+				os.Chtimes(fname, ent.Mtm, ent.Mtm)
+			}
+			out = append(out, fname)
+		case SymbolicLink:
+			target := filepath.FromSlash(ent.Link)
+			if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(rel), target)) {
+				return nil, fmt.Errorf("refusing to extract symlink '%s' with unsafe target '%s'", ent.Path, ent.Link)
+			}
+			if err := os.MkdirAll(filepath.Dir(fname), 0o750); err != nil {
+				return nil, fmt.Errorf("failed to create dir %s: %v", filepath.Dir(fname), err)
+			}
+			os.Remove(fname)
+			if err := os.Symlink(target, fname); err != nil {
+				return nil, fmt.Errorf("failed to create symlink %s: %v", fname, err)
+			}
+			out = append(out, fname)
+		}
+	}
+	return out, nil
+}
+
+// checkNoSymlinks returns an error if any of the folders of dir (relative to root) is a symlink
+func checkNoSymlinks(root, dir string) error {
+	path := root
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		if part == "." || part == "" {
+			continue
+		}
+		path = filepath.Join(path, part)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to extract entry below symlink '%s'", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package yaa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Writer writes an Apple Archive (AA01) or YAA1 stream
+type Writer struct {
+	w     io.Writer
+	magic uint32
+}
+
+// NewWriter returns a new Apple Archive (AA01) writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, magic: MagicAA01}
+}
+
+// NewYAAWriter returns a new YAA1 writer
+func NewYAAWriter(w io.Writer) *Writer {
+	return &Writer{w: w, magic: MagicYAA1}
+}
+
+func (e *Entry) encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	putField := func(name string, v any) {
+		buf.WriteString(name)
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	putString := func(name, s string) error {
+		if len(s) > math.MaxUint16 {
+			return fmt.Errorf("%s field too long: %d", name, len(s))
+		}
+		putField(name, uint16(len(s)))
+		buf.WriteString(s)
+		return nil
+	}
+
+	putField("TYP1", byte(e.Type))
+	if e.Type == Metadata {
+		putField("YOP1", byte(e.PatchType))
+	}
+	if err := putString("PATP", filepath.ToSlash(e.Path)); err != nil {
+		return nil, err
+	}
+	if e.Type == SymbolicLink {
+		if err := putString("LNKP", e.Link); err != nil {
+			return nil, err
+		}
+	}
+	if len(e.Label) > 0 {
+		if err := putString("LBLP", e.Label); err != nil {
+			return nil, err
+		}
+	}
+	if e.Uid > math.MaxUint8 {
+		putField("UID2", e.Uid)
+	} else {
+		putField("UID1", byte(e.Uid))
+	}
+	if e.Gid > math.MaxUint8 {
+		putField("GID2", e.Gid)
+	} else {
+		putField("GID1", byte(e.Gid))
+	}
+	putField("MOD2", uint16(e.Mod&0o7777))
+	if e.Flag > 0 {
+		putField("FLG4", e.Flag)
+	}
+	if !e.Mtm.IsZero() {
+		putField("MTMT", e.Mtm.Unix())
+		binary.Write(&buf, binary.LittleEndian, int32(e.Mtm.Nanosecond()))
+	}
+	if e.Type == RegularFile {
+		putField("DATB", e.Size)
+	}
+
+	if buf.Len()+6 > math.MaxUint16 {
+		return nil, fmt.Errorf("header for %s too large: %d", e.Path, buf.Len())
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteEntry writes an archive entry and (for regular files) the entry's data read from r
+func (w *Writer) WriteEntry(e *Entry, r io.Reader) error {
+	fields, err := e.encode()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, w.magic); err != nil {
+		return fmt.Errorf("failed to write magic: %w", err)
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, uint16(len(fields)+6)); err != nil {
+		return fmt.Errorf("failed to write header size: %w", err)
+	}
+	if _, err := w.w.Write(fields); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if e.Type == RegularFile && e.Size > 0 {
+		if r == nil {
+			return fmt.Errorf("missing data for file entry %s", e.Path)
+		}
+		if n, err := io.CopyN(w.w, r, int64(e.Size)); err != nil {
+			return fmt.Errorf("failed to write data for %s (wrote %d of %d bytes): %w", e.Path, n, e.Size, err)
+		}
+	}
+	return nil
+}
+
+// EntryFromFileInfo creates an archive entry for a file
+func EntryFromFileInfo(path string, fi fs.FileInfo, link string) (*Entry, error) {
+	e := &Entry{
+		Path: path,
+		Mod:  fs.FileMode(fileModeToUnixMode(fi.Mode()) & 0o7777),
+		Mtm:  fi.ModTime(),
+	}
+	switch {
+	case fi.Mode().IsRegular():
+		if fi.Size() > math.MaxUint32 {
+			return nil, fmt.Errorf("file %s too large: %d", path, fi.Size())
+		}
+		e.Type = RegularFile
+		e.Size = uint32(fi.Size())
+	case fi.IsDir():
+		e.Type = Directory
+	case fi.Mode()&fs.ModeSymlink != 0:
+		e.Type = SymbolicLink
+		e.Link = link
+	default:
+		return nil, fmt.Errorf("unsupported file type %s for %s", fi.Mode().Type(), path)
+	}
+	return e, nil
+}
+
+// AddDir adds the contents of the folder to the archive (using paths relative to it)
+func (w *Writer) AddDir(root string) error {
+	return filepath.Walk(root, func(path string, fi fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		e, err := EntryFromFileInfo(rel, fi, link)
+		if err != nil {
+			return err
+		}
+		if e.Type != RegularFile {
+			return w.WriteEntry(e, nil)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return w.WriteEntry(e, f)
+	})
+}
+
+func fileModeToUnixMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&fs.ModeDir != 0:
+		m |= s_IFDIR
+	case mode&fs.ModeSymlink != 0:
+		m |= s_IFLNK
+	case mode&fs.ModeNamedPipe != 0:
+		m |= s_IFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= s_IFSOCK
+	case mode&fs.ModeCharDevice != 0:
+		m |= s_IFCHR
+	case mode&fs.ModeDevice != 0:
+		m |= s_IFBLK
+	default:
+		m |= s_IFREG
+	}
+	if mode&fs.ModeSetuid != 0 {
+		m |= s_ISUID
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= s_ISGID
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= s_ISVTX
+	}
+	return m
+}
@@ -0,0 +1,143 @@
+package yaa
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteParse(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	mtm := time.Unix(1700000000, 42)
+	data := []byte("hello cryptex")
+	for _, ent := range []struct {
+		e    *Entry
+		data []byte
+	}{
+		{&Entry{Type: Directory, Path: "", Mod: 0o755}, nil},
+		{&Entry{Type: Directory, Path: "usr/lib", Mod: 0o755}, nil},
+		{&Entry{Type: RegularFile, Path: "usr/lib/libfoo.dylib", Mod: 0o644, Uid: 501, Mtm: mtm, Size: uint32(len(data))}, data},
+		{&Entry{Type: SymbolicLink, Path: "usr/lib/libbar.dylib", Link: "libfoo.dylib", Mod: 0o755}, nil},
+	} {
+		if err := w.WriteEntry(ent.e, bytes.NewReader(ent.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aa, err := Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aa.Entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(aa.Entries))
+	}
+
+	file := aa.Entries[2]
+	if file.Path != "usr/lib/libfoo.dylib" || file.Uid != 501 || file.Mod != 0o644 || !file.Mtm.Equal(mtm) {
+		t.Errorf("bad file entry: %s", file)
+	}
+	r, err := aa.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, data) {
+		t.Errorf("file data = %q, want %q", got, data)
+	}
+	if aa.Entries[3].Link != "libfoo.dylib" {
+		t.Errorf("link = %q", aa.Entries[3].Link)
+	}
+
+	dir := t.TempDir()
+	out, err := aa.Extract(dir, regexp.MustCompile(`libfoo`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("extracted %v", out)
+	}
+	if dat, err := os.ReadFile(filepath.Join(dir, "usr/lib/libfoo.dylib")); err != nil || !bytes.Equal(dat, data) {
+		t.Errorf("extracted data = %q (%v)", dat, err)
+	}
+}
+
+func TestExtractUnsafePaths(t *testing.T) {
+	archive := func(ents ...*Entry) *YAA {
+		t.Helper()
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		for _, e := range ents {
+			var data []byte
+			if e.Type == RegularFile {
+				data = []byte("data")
+				e.Size = uint32(len(data))
+			}
+			if err := w.WriteEntry(e, bytes.NewReader(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		aa, err := Parse(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aa
+	}
+
+	root := t.TempDir()
+	output := filepath.Join(root, "out")
+	if _, err := archive(
+		&Entry{Type: Directory, Path: "usr/lib", Mod: 0o755},
+		&Entry{Type: SymbolicLink, Path: "usr/lib/libbar.dylib", Link: "../lib/libfoo.dylib", Mod: 0o755},
+	).Extract(output, nil); err != nil {
+		t.Fatalf("Extract(local symlink) = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		ents []*Entry
+		want string
+	}{
+		{"path", []*Entry{{Type: RegularFile, Path: "../evil", Mod: 0o644}}, "unsafe path"},
+		{"absolute target", []*Entry{{Type: SymbolicLink, Path: "etc", Link: "/etc", Mod: 0o755}}, "unsafe target"},
+		{"escaping target", []*Entry{{Type: SymbolicLink, Path: "usr/up", Link: "../../..", Mod: 0o755}}, "unsafe target"},
+		{"below symlink", []*Entry{
+			{Type: SymbolicLink, Path: "lib", Link: "usr/lib", Mod: 0o755},
+			{Type: RegularFile, Path: "lib/evil", Mod: 0o644},
+		}, "below symlink"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := archive(tt.ents...).Extract(output, nil); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Extract() = %v, want %q error", err, tt.want)
+			}
+		})
+	}
+
+	// a file entry over an extracted symlink replaces the symlink instead of writing through it
+	if err := os.WriteFile(filepath.Join(root, "target"), []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "target"), filepath.Join(output, "usr/lib/libbaz.dylib")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive(&Entry{Type: RegularFile, Path: "usr/lib/libbaz.dylib", Mod: 0o644}).Extract(output, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dat, _ := os.ReadFile(filepath.Join(root, "target")); string(dat) != "keep" {
+		t.Errorf("Extract() wrote through a symlink: %q", dat)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Extract() wrote outside of the output folder: %v", entries)
+	}
+}
@@ -0,0 +1,314 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Formats
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// Formats are the supported SBOM document formats
+var Formats = []string{FormatSPDX, FormatCycloneDX}
+
+// Tool is the name and version of the tool that generated the SBOM
+type Tool struct {
+	Name    string
+	Version string
+}
+
+const noAssertion = "NOASSERTION"
+
+var spdxIDRE = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	Supplier         string            `json:"supplier"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func orNoAssertion(s string) string {
+	if len(s) == 0 {
+		return noAssertion
+	}
+	return s
+}
+
+// WriteSPDX writes the SBOM as an SPDX 2.3 JSON document
+func (s *SBOM) WriteSPDX(w io.Writer, tool Tool) error {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.Name,
+		DocumentNamespace: fmt.Sprintf("https://blacktop.github.io/ipsw/spdx/%s-%s", url.PathEscape(s.Name), uuid.New()),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{fmt.Sprintf("Tool: %s-%s", tool.Name, tool.Version)},
+		},
+	}
+	doc.Packages = append(doc.Packages, spdxPackage{
+		Name:             s.Name,
+		SPDXID:           "SPDXRef-Firmware",
+		VersionInfo:      s.Version,
+		Supplier:         "Organization: Apple Inc.",
+		DownloadLocation: noAssertion,
+		LicenseConcluded: noAssertion,
+		LicenseDeclared:  noAssertion,
+		CopyrightText:    noAssertion,
+	})
+	doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Firmware"})
+	for i, c := range s.Components {
+		pkg := spdxPackage{
+			Name:             c.Name,
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%d-%s", i, spdxIDRE.ReplaceAllString(c.Name, "-")),
+			VersionInfo:      c.Version,
+			Supplier:         noAssertion,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  orNoAssertion(c.License),
+			CopyrightText:    noAssertion,
+			Comment:          "Found in: " + strings.Join(c.Locations, ", "),
+		}
+		if len(c.Supplier) > 0 {
+			pkg.Supplier = "Organization: " + c.Supplier
+		}
+		if len(c.PURL) > 0 {
+			pkg.ExternalRefs = append(pkg.ExternalRefs, spdxExternalRef{"PACKAGE-MANAGER", "purl", c.PURL})
+		}
+		if len(c.CPE) > 0 {
+			pkg.ExternalRefs = append(pkg.ExternalRefs, spdxExternalRef{"SECURITY", "cpe23Type", c.CPE})
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-Firmware", "CONTAINS", pkg.SPDXID})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxSupplier struct {
+	Name string `json:"name"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxComponent struct {
+	Type     string       `json:"type"`
+	BOMRef   string       `json:"bom-ref,omitempty"`
+	Name     string       `json:"name"`
+	Version  string       `json:"version,omitempty"`
+	Supplier *cdxSupplier `json:"supplier,omitempty"`
+	Licenses []cdxLicense `json:"licenses,omitempty"`
+	PURL     string       `json:"purl,omitempty"`
+	CPE      string       `json:"cpe,omitempty"`
+	Evidence *cdxEvidence `json:"evidence,omitempty"`
+}
+
+type cdxEvidence struct {
+	Occurrences []cdxOccurrence `json:"occurrences"`
+}
+
+type cdxOccurrence struct {
+	Location string `json:"location"`
+}
+
+// WriteCycloneDX writes the SBOM as a CycloneDX 1.5 JSON document
+func (s *SBOM) WriteCycloneDX(w io.Writer, tool Tool) error {
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Components:   []cdxComponent{},
+	}
+	doc.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: tool.Name, Version: tool.Version}}
+	doc.Metadata.Component = cdxComponent{
+		Type:     "firmware",
+		BOMRef:   "firmware",
+		Name:     s.Name,
+		Version:  s.Version,
+		Supplier: &cdxSupplier{Name: "Apple Inc."},
+	}
+	for _, c := range s.Components {
+		comp := cdxComponent{
+			Type:     "library",
+			BOMRef:   c.ID(),
+			Name:     c.Name,
+			Version:  c.Version,
+			PURL:     c.PURL,
+			CPE:      c.CPE,
+			Evidence: &cdxEvidence{},
+		}
+		if len(c.Supplier) > 0 {
+			comp.Supplier = &cdxSupplier{Name: c.Supplier}
+		}
+		if len(c.License) > 0 {
+			comp.Licenses = []cdxLicense{{Expression: c.License}}
+		}
+		for _, loc := range c.Locations {
+			comp.Evidence.Occurrences = append(comp.Evidence.Occurrences, cdxOccurrence{Location: loc})
+		}
+		doc.Components = append(doc.Components, comp)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Read reads a previously written SPDX or CycloneDX JSON SBOM
+func Read(r io.Reader) (*SBOM, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		BOMFormat   string `json:"bomFormat"`
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM: %v", err)
+	}
+	s := &SBOM{}
+	switch {
+	case probe.BOMFormat == "CycloneDX":
+		var doc cdxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse CycloneDX SBOM: %v", err)
+		}
+		s.Name = doc.Metadata.Component.Name
+		s.Version = doc.Metadata.Component.Version
+		for _, comp := range doc.Components {
+			c := &Component{Name: comp.Name, Version: comp.Version, PURL: comp.PURL, CPE: comp.CPE}
+			if comp.Supplier != nil {
+				c.Supplier = comp.Supplier.Name
+			}
+			if len(comp.Licenses) > 0 {
+				c.License = comp.Licenses[0].Expression
+			}
+			if comp.Evidence != nil {
+				for _, occ := range comp.Evidence.Occurrences {
+					c.Locations = append(c.Locations, occ.Location)
+				}
+			}
+			s.Components = append(s.Components, c)
+		}
+	case strings.HasPrefix(probe.SPDXVersion, "SPDX-"):
+		var doc spdxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse SPDX SBOM: %v", err)
+		}
+		s.Name = doc.Name
+		for _, pkg := range doc.Packages {
+			if pkg.SPDXID == "SPDXRef-Firmware" {
+				s.Version = pkg.VersionInfo
+				continue
+			}
+			c := &Component{
+				Name:     pkg.Name,
+				Version:  pkg.VersionInfo,
+				Supplier: strings.TrimPrefix(pkg.Supplier, "Organization: "),
+				License:  pkg.LicenseDeclared,
+			}
+			if c.Supplier == noAssertion {
+				c.Supplier = ""
+			}
+			if c.License == noAssertion {
+				c.License = ""
+			}
+			for _, ref := range pkg.ExternalRefs {
+				switch ref.ReferenceType {
+				case "purl":
+					c.PURL = ref.ReferenceLocator
+				case "cpe23Type":
+					c.CPE = ref.ReferenceLocator
+				}
+			}
+			if locs, ok := strings.CutPrefix(pkg.Comment, "Found in: "); ok {
+				c.Locations = strings.Split(locs, ", ")
+			}
+			s.Components = append(s.Components, c)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format (must be SPDX or CycloneDX JSON)")
+	}
+	return s, nil
+}
+
+// Write writes the SBOM in the given format
+func (s *SBOM) Write(w io.Writer, format string, tool Tool) error {
+	switch format {
+	case FormatSPDX:
+		return s.WriteSPDX(w, tool)
+	case FormatCycloneDX:
+		return s.WriteCycloneDX(w, tool)
+	default:
+		return fmt.Errorf("invalid format '%s', must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+}
@@ -0,0 +1,313 @@
+// Package sbom identifies the open source components inside firmware MachOs (dylibs, kexts, daemons, etc.)
+// by symbol, string and version fingerprinting, and writes them as SPDX or CycloneDX software bills of materials.
+package sbom
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Rule is an open source component fingerprint
+type Rule struct {
+	Name     string
+	Supplier string
+	License  string // SPDX license expression
+	PURL     string // package URL (the version is appended)
+	CPE      string // CPE 2.3 vendor:product (for vulnerability matching)
+	// a binary contains the component if it defines one of the symbols or its path matches
+	Symbols []string
+	Path    *regexp.Regexp
+	// the version is the first C string matching Version (its groups are joined with '.')
+	// NOTE: when a rule has no Symbols or Path the Version match alone identifies the component
+	Version *regexp.Regexp
+}
+
+// Rules are the built-in open source component fingerprints
+var Rules = []*Rule{
+	{
+		Name: "zlib", Supplier: "Jean-loup Gailly and Mark Adler", License: "Zlib", PURL: "pkg:github/madler/zlib", CPE: "zlib:zlib",
+		Version: regexp.MustCompile(`(?:deflate|inflate) (\d+\.\d+(?:\.\d+)*) Copyright`),
+	},
+	{
+		Name: "SQLite", Supplier: "SQLite", License: "blessing", PURL: "pkg:generic/sqlite", CPE: "sqlite:sqlite",
+		Symbols: []string{"_sqlite3_initialize", "_sqlite3_open_v2"},
+		Version: regexp.MustCompile(`^(3\.\d{1,2}\.\d{1,2})$`),
+	},
+	{
+		Name: "libxml2", Supplier: "GNOME", License: "MIT", PURL: "pkg:generic/libxml2", CPE: "xmlsoft:libxml2",
+		Symbols: []string{"_xmlReadMemory", "_xmlParseMemory"},
+		Version: regexp.MustCompile(`^(2)(0\d|1\d)(\d\d)$`), // LIBXML_VERSION_STRING (i.e. 20913)
+	},
+	{
+		Name: "libxslt", Supplier: "GNOME", License: "MIT", PURL: "pkg:generic/libxslt", CPE: "xmlsoft:libxslt",
+		Symbols: []string{"_xsltApplyStylesheet"},
+		Version: regexp.MustCompile(`^(1)(0\d|1\d)(\d\d)$`), // LIBXSLT_VERSION_STRING (i.e. 10139)
+	},
+	{
+		Name: "curl", Supplier: "Daniel Stenberg", License: "curl", PURL: "pkg:github/curl/curl", CPE: "haxx:libcurl",
+		Symbols: []string{"_curl_easy_init"},
+		Version: regexp.MustCompile(`(?:libcurl|^curl)/(\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "libarchive", Supplier: "libarchive", License: "BSD-2-Clause", PURL: "pkg:github/libarchive/libarchive", CPE: "libarchive:libarchive",
+		Symbols: []string{"_archive_read_new"},
+		Version: regexp.MustCompile(`libarchive (\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "expat", Supplier: "libexpat", License: "MIT", PURL: "pkg:github/libexpat/libexpat", CPE: "libexpat_project:libexpat",
+		Symbols: []string{"_XML_ParserCreate"},
+		Version: regexp.MustCompile(`expat_(\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "bzip2", Supplier: "Julian Seward", License: "bzip2-1.0.6", PURL: "pkg:generic/bzip2", CPE: "bzip:bzip2",
+		Symbols: []string{"_BZ2_bzlibVersion"},
+		Version: regexp.MustCompile(`^(1\.0\.\d+), \d+-\w+-\d+$`),
+	},
+	{
+		Name: "xz", Supplier: "Tukaani", License: "0BSD", PURL: "pkg:github/tukaani-project/xz", CPE: "tukaani:xz",
+		Symbols: []string{"_lzma_version_string", "_lzma_code"},
+		Version: regexp.MustCompile(`^(5\.\d+\.\d+)$`),
+	},
+	{
+		Name: "zstd", Supplier: "Meta Platforms", License: "BSD-3-Clause OR GPL-2.0-only", PURL: "pkg:github/facebook/zstd", CPE: "facebook:zstandard",
+		Symbols: []string{"_ZSTD_decompress", "_ZSTD_versionString"},
+		Version: regexp.MustCompile(`^(1\.\d+\.\d+)$`),
+	},
+	{
+		Name: "lz4", Supplier: "Yann Collet", License: "BSD-2-Clause", PURL: "pkg:github/lz4/lz4", CPE: "lz4_project:lz4",
+		Symbols: []string{"_LZ4_decompress_safe"},
+		Version: regexp.MustCompile(`^(1\.\d+\.\d+)$`),
+	},
+	{
+		Name: "brotli", Supplier: "Google", License: "MIT", PURL: "pkg:github/google/brotli", CPE: "google:brotli",
+		Symbols: []string{"_BrotliDecoderDecompress"},
+	},
+	{
+		Name: "libpcap", Supplier: "The Tcpdump Group", License: "BSD-3-Clause", PURL: "pkg:github/the-tcpdump-group/libpcap", CPE: "tcpdump:libpcap",
+		Symbols: []string{"_pcap_open_live"},
+		Version: regexp.MustCompile(`libpcap version (\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "ncurses", Supplier: "GNU", License: "X11", PURL: "pkg:generic/ncurses", CPE: "gnu:ncurses",
+		Symbols: []string{"_curses_version"},
+		Version: regexp.MustCompile(`ncurses (\d+\.\d+)`),
+	},
+	{
+		Name: "ICU", Supplier: "Unicode", License: "ICU", PURL: "pkg:github/unicode-org/icu", CPE: "icu-project:international_components_for_unicode",
+		Symbols: []string{"_ubrk_open", "_u_getVersion"},
+		Version: regexp.MustCompile(`^icudt(\d+)l`),
+	},
+	{
+		Name: "Lua", Supplier: "PUC-Rio", License: "MIT", PURL: "pkg:generic/lua", CPE: "lua:lua",
+		Symbols: []string{"_lua_newstate"},
+		Version: regexp.MustCompile(`^Lua (\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "libpng", Supplier: "libpng", License: "Libpng", PURL: "pkg:github/pnggroup/libpng", CPE: "libpng:libpng",
+		Symbols: []string{"_png_create_read_struct"},
+		Version: regexp.MustCompile(`libpng version (\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "libjpeg-turbo", Supplier: "libjpeg-turbo", License: "IJG AND BSD-3-Clause", PURL: "pkg:github/libjpeg-turbo/libjpeg-turbo", CPE: "libjpeg-turbo:libjpeg-turbo",
+		Version: regexp.MustCompile(`libjpeg-turbo version (\d+\.\d+\.\d+)`),
+	},
+	{
+		Name: "libwebp", Supplier: "Google", License: "BSD-3-Clause", PURL: "pkg:github/webmproject/libwebp", CPE: "webmproject:libwebp",
+		Symbols: []string{"_WebPGetDecoderVersion"},
+	},
+	{
+		Name: "FreeType", Supplier: "The FreeType Project", License: "FTL OR GPL-2.0-or-later", PURL: "pkg:generic/freetype", CPE: "freetype:freetype",
+		Symbols: []string{"_FT_Init_FreeType"},
+	},
+	{
+		Name: "HarfBuzz", Supplier: "HarfBuzz", License: "MIT", PURL: "pkg:github/harfbuzz/harfbuzz", CPE: "harfbuzz_project:harfbuzz",
+		Symbols: []string{"_hb_buffer_create"},
+	},
+	{
+		Name: "libffi", Supplier: "libffi", License: "MIT", PURL: "pkg:github/libffi/libffi", CPE: "libffi_project:libffi",
+		Symbols: []string{"_ffi_call"},
+	},
+	{
+		Name: "PCRE", Supplier: "Philip Hazel", License: "BSD-3-Clause", PURL: "pkg:generic/pcre", CPE: "pcre:pcre",
+		Symbols: []string{"_pcre_compile"},
+		Version: regexp.MustCompile(`^(8\.\d+) \d{4}-\d\d-\d\d$`),
+	},
+	{
+		Name: "PCRE2", Supplier: "Philip Hazel", License: "BSD-3-Clause", PURL: "pkg:github/pcre2project/pcre2", CPE: "pcre:pcre2",
+		Symbols: []string{"_pcre2_compile_8"},
+		Version: regexp.MustCompile(`^(10\.\d+) \d{4}-\d\d-\d\d$`),
+	},
+	{
+		Name: "OpenSSH", Supplier: "OpenBSD", License: "SSH-OpenSSH", PURL: "pkg:generic/openssh", CPE: "openbsd:openssh",
+		Version: regexp.MustCompile(`^OpenSSH_(\d+\.\d+(?:p\d+)?)`),
+	},
+	{
+		Name: "LibreSSL", Supplier: "OpenBSD", License: "OpenSSL", PURL: "pkg:generic/libressl", CPE: "openbsd:libressl",
+		Version: regexp.MustCompile(`^LibreSSL (\d+\.\d+\.\d+)$`),
+	},
+	{
+		Name: "BoringSSL", Supplier: "Google", License: "OpenSSL AND ISC", PURL: "pkg:generic/boringssl", CPE: "google:boringssl",
+		Path: regexp.MustCompile(`/libboringssl\.dylib$`),
+	},
+	{
+		Name: "WebKit", Supplier: "Apple Inc.", License: "BSD-2-Clause AND LGPL-2.0-or-later", PURL: "pkg:github/webkit/webkit", CPE: "webkit:webkit",
+		Path:    regexp.MustCompile(`/(?:WebCore|WebKit|JavaScriptCore)\.framework/`),
+		Version: regexp.MustCompile(`PROJECT:(?:WebCore|WebKit|JavaScriptCore)-([\d.]+)`),
+	},
+	{
+		Name: "libc++", Supplier: "LLVM", License: "Apache-2.0 WITH LLVM-exception", PURL: "pkg:github/llvm/llvm-project",
+		Path: regexp.MustCompile(`/libc\+\+\.1\.dylib$`),
+	},
+	{
+		Name: "xnu", Supplier: "Apple Inc.", License: "APSL-2.0", PURL: "pkg:github/apple-oss-distributions/xnu",
+		Version: regexp.MustCompile(`root:xnu(?:_\w+)?-([\d.]+)~`),
+	},
+	{
+		Name: "dyld", Supplier: "Apple Inc.", License: "APSL-2.0", PURL: "pkg:github/apple-oss-distributions/dyld",
+		Version: regexp.MustCompile(`PROJECT:dyld-([\d.]+)`),
+	},
+	{
+		Name: "objc4", Supplier: "Apple Inc.", License: "APSL-2.0", PURL: "pkg:github/apple-oss-distributions/objc4",
+		Path:    regexp.MustCompile(`/libobjc\.A\.dylib$`),
+		Version: regexp.MustCompile(`PROJECT:objc4-([\d.]+)`),
+	},
+	{
+		Name: "libdispatch", Supplier: "Apple Inc.", License: "Apache-2.0", PURL: "pkg:github/apple-oss-distributions/libdispatch",
+		Path:    regexp.MustCompile(`/libdispatch\.dylib$`),
+		Version: regexp.MustCompile(`PROJECT:libdispatch-([\d.]+)`),
+	},
+}
+
+// Binary is a MachO to fingerprint
+type Binary struct {
+	Path    string          // file system path, dyld_shared_cache image or kext bundle ID
+	Symbols map[string]bool // defined/exported symbols
+	Strings []string        // C string literals
+}
+
+// version returns the rule's version found in the binary's strings
+func (r *Rule) version(b *Binary) (string, bool) {
+	if r.Version == nil {
+		return "", false
+	}
+	for _, s := range b.Strings {
+		if m := r.Version.FindStringSubmatch(s); m != nil {
+			parts := make([]string, 0, len(m)-1)
+			for _, p := range m[1:] {
+				if t := strings.TrimLeft(p, "0"); len(t) > 0 && len(m) > 2 {
+					p = t // 20913 -> 2.9.13
+				} else if len(m) > 2 {
+					p = "0"
+				}
+				parts = append(parts, p)
+			}
+			return strings.Join(parts, "."), true
+		}
+	}
+	return "", false
+}
+
+// Match returns the component's version if the binary contains it (the version is empty if unknown)
+func (r *Rule) Match(b *Binary) (string, bool) {
+	if len(r.Symbols) == 0 && r.Path == nil {
+		return r.version(b)
+	}
+	found := r.Path != nil && r.Path.MatchString(b.Path)
+	for _, sym := range r.Symbols {
+		if found {
+			break
+		}
+		found = b.Symbols[sym]
+	}
+	if !found {
+		return "", false
+	}
+	ver, _ := r.version(b)
+	return ver, true
+}
+
+// Component is an identified open source component
+type Component struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version,omitempty"`
+	Supplier  string   `json:"supplier,omitempty"`
+	License   string   `json:"license,omitempty"`
+	PURL      string   `json:"purl,omitempty"`
+	CPE       string   `json:"cpe,omitempty"`
+	Locations []string `json:"locations"` // the binaries it was found in
+}
+
+// ID is the component's unique name@version
+func (c *Component) ID() string {
+	if len(c.Version) == 0 {
+		return c.Name
+	}
+	return c.Name + "@" + c.Version
+}
+
+// SBOM is the software bill of materials of a firmware image
+type SBOM struct {
+	Name       string // i.e. iPhone15,2_17.4_21E219_Restore.ipsw
+	Version    string // i.e. 17.4 (21E219)
+	Components []*Component
+
+	rules []*Rule
+	index map[string]*Component
+}
+
+// New returns an empty SBOM that fingerprints binaries with rules (or the built-in Rules if nil)
+func New(name, version string, rules []*Rule) *SBOM {
+	if rules == nil {
+		rules = Rules
+	}
+	return &SBOM{Name: name, Version: version, rules: rules, index: make(map[string]*Component)}
+}
+
+// Add fingerprints the binary and adds the components it contains
+func (s *SBOM) Add(b *Binary) []*Component {
+	var found []*Component
+	for _, r := range s.rules {
+		ver, ok := r.Match(b)
+		if !ok {
+			continue
+		}
+		c := &Component{Name: r.Name, Version: ver, Supplier: r.Supplier, License: r.License}
+		if existing, ok := s.index[c.ID()]; ok {
+			c = existing
+		} else {
+			ref := ver
+			if len(ref) == 0 {
+				ref = "*"
+			}
+			if len(r.PURL) > 0 {
+				c.PURL = r.PURL
+				if len(ver) > 0 {
+					c.PURL += "@" + ver
+				}
+			}
+			if len(r.CPE) > 0 {
+				c.CPE = fmt.Sprintf("cpe:2.3:a:%s:%s:*:*:*:*:*:*:*", r.CPE, ref)
+			}
+			s.index[c.ID()] = c
+			s.Components = append(s.Components, c)
+		}
+		if !slices.Contains(c.Locations, b.Path) {
+			c.Locations = append(c.Locations, b.Path)
+		}
+		found = append(found, c)
+	}
+	return found
+}
+
+// Sort sorts the components by name and version (and their locations)
+func (s *SBOM) Sort() {
+	for _, c := range s.Components {
+		slices.Sort(c.Locations)
+	}
+	slices.SortFunc(s.Components, func(a, b *Component) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.Version, b.Version))
+	})
+}
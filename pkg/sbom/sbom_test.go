@@ -0,0 +1,90 @@
+package sbom
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	s := New("iPhone15,2_17.4_21E219_Restore.ipsw", "17.4 (21E219)", nil)
+	s.Add(&Binary{
+		Path:    "/usr/lib/libxml2.2.dylib",
+		Symbols: map[string]bool{"_xmlReadMemory": true},
+		Strings: []string{"xmlReadMemory", "20913"},
+	})
+	s.Add(&Binary{
+		Path:    "/usr/lib/libz.1.dylib",
+		Strings: []string{" inflate 1.2.12 Copyright 1995-2022 Mark Adler "},
+	})
+	s.Add(&Binary{
+		Path:    "com.apple.kec.corecrypto",
+		Strings: []string{" deflate 1.2.12 Copyright 1995-2022 Jean-loup Gailly and Mark Adler "},
+	})
+	s.Add(&Binary{Path: "/usr/lib/libsqlite3.dylib", Symbols: map[string]bool{"_sqlite3_open_v2": true}})
+	s.Add(&Binary{Path: "/usr/bin/true", Strings: []string{"3.43.2"}}) // no symbols so not SQLite
+	s.Sort()
+
+	want := map[string]int{"libxml2@2.9.13": 1, "zlib@1.2.12": 2, "SQLite": 1}
+	if len(s.Components) != len(want) {
+		t.Fatalf("got %d components, want %d", len(s.Components), len(want))
+	}
+	for _, c := range s.Components {
+		if n, ok := want[c.ID()]; !ok || n != len(c.Locations) {
+			t.Errorf("unexpected component %s found in %v", c.ID(), c.Locations)
+		}
+	}
+	if s.Components[2].CPE != "cpe:2.3:a:zlib:zlib:1.2.12:*:*:*:*:*:*:*" {
+		t.Errorf("zlib CPE = %s", s.Components[2].CPE)
+	}
+}
+
+func TestVulnMatch(t *testing.T) {
+	dir := t.TempDir()
+	nvd := `{"resultsPerPage":2,"format":"NVD_CVE","vulnerabilities":[
+		{"cve":{"id":"CVE-2022-40674","descriptions":[{"lang":"en","value":"use-after-free in doContent"}],
+		 "configurations":[{"nodes":[{"cpeMatch":[{"vulnerable":true,"criteria":"cpe:2.3:a:libexpat_project:libexpat:*:*:*:*:*:*:*:*","versionEndExcluding":"2.4.9"}]}]}]}},
+		{"cve":{"id":"CVE-2023-29469","configurations":[{"nodes":[{"cpeMatch":[{"vulnerable":true,"criteria":"cpe:2.3:a:xmlsoft:libxml2:*:*:*:*:*:*:*:*","versionEndExcluding":"2.10.4"}]}]}],
+		 "metrics":{"cvssMetricV31":[{"cvssData":{"baseScore":6.5,"baseSeverity":"MEDIUM"}}]}}}]}`
+	osv := `{"id":"OSV-2022-1","aliases":["CVE-2023-29469"],"affected":[{"package":{"name":"libxml2","ecosystem":"OSS-Fuzz"},
+		"ranges":[{"type":"SEMVER","events":[{"introduced":"0"},{"fixed":"2.10.4"}]}]}]}`
+	if err := os.WriteFile(filepath.Join(dir, "nvdcve-2.0-2023.json"), []byte(nvd), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "OSV-2022-1.json"), []byte(osv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := &SBOM{Components: []*Component{
+		{Name: "libxml2", Version: "2.9.13", CPE: "cpe:2.3:a:xmlsoft:libxml2:2.9.13:*:*:*:*:*:*:*"},
+		{Name: "expat", Version: "2.4.8", CPE: "cpe:2.3:a:libexpat_project:libexpat:2.4.8:*:*:*:*:*:*:*"},
+	}}
+	next := &SBOM{Components: []*Component{
+		{Name: "libxml2", Version: "2.9.13", CPE: "cpe:2.3:a:xmlsoft:libxml2:2.9.13:*:*:*:*:*:*:*"},
+		{Name: "expat", Version: "2.4.9", CPE: "cpe:2.3:a:libexpat_project:libexpat:2.4.9:*:*:*:*:*:*:*"},
+	}}
+	db := NewVulnDB(prev, next)
+	if err := db.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	findings := db.Match(prev)
+	if len(findings) != 2 { // the OSV entry is an alias of the NVD CVE
+		t.Fatalf("got %d findings, want 2: %v", len(findings), findings)
+	}
+	if findings[1].ID != "CVE-2023-29469" || findings[1].Severity != "MEDIUM (6.5)" || findings[1].Fixed != "2.10.4" {
+		t.Errorf("unexpected libxml2 finding %+v", findings[1])
+	}
+	added, fixed := DiffFindings(findings, db.Match(next))
+	if len(added) != 0 || len(fixed) != 1 || fixed[0].ID != "CVE-2022-40674" {
+		t.Errorf("unexpected diff: new=%v fixed=%v", added, fixed)
+	}
+
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{{"2.9.13", "2.9.2", 1}, {"9.0p1", "9.0", 1}, {"1.2.12", "1.2.12", 0}, {"7.87.0", "8.0", -1}, {"2.9", "2.9.0", 0}, {"2.9.0.1", "2.9", 1}, {"2.9", "2.9.1", -1}} {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package sbom
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Finding is a known vulnerability affecting an identified component version
+type Finding struct {
+	ID        string   `json:"id"` // CVE (or OSV) ID
+	Aliases   []string `json:"aliases,omitempty"`
+	Component string   `json:"component"`
+	Version   string   `json:"version"`
+	Severity  string   `json:"severity,omitempty"`
+	Fixed     string   `json:"fixed,omitempty"` // first fixed version (if known)
+	Summary   string   `json:"summary,omitempty"`
+	Source    string   `json:"source"` // nvd or osv
+}
+
+// Key is the finding's unique component/vulnerability key (used to diff builds)
+func (f Finding) Key() string {
+	return f.Component + "|" + f.ID
+}
+
+type nvdCPEMatch struct {
+	Vulnerable            bool   `json:"vulnerable"`
+	Criteria              string `json:"criteria"`
+	VersionStartIncluding string `json:"versionStartIncluding"`
+	VersionStartExcluding string `json:"versionStartExcluding"`
+	VersionEndIncluding   string `json:"versionEndIncluding"`
+	VersionEndExcluding   string `json:"versionEndExcluding"`
+}
+
+type nvdMetric struct {
+	CVSSData struct {
+		BaseScore    float64 `json:"baseScore"`
+		BaseSeverity string  `json:"baseSeverity"`
+	} `json:"cvssData"`
+	BaseSeverity string `json:"baseSeverity"` // CVSS v2
+}
+
+type nvdCVE struct {
+	ID           string `json:"id"`
+	Descriptions []struct {
+		Lang  string `json:"lang"`
+		Value string `json:"value"`
+	} `json:"descriptions"`
+	Metrics struct {
+		V31 []nvdMetric `json:"cvssMetricV31"`
+		V30 []nvdMetric `json:"cvssMetricV30"`
+		V2  []nvdMetric `json:"cvssMetricV2"`
+	} `json:"metrics"`
+	Configurations []struct {
+		Nodes []struct {
+			CPEMatch []nvdCPEMatch `json:"cpeMatch"`
+		} `json:"nodes"`
+	} `json:"configurations"`
+}
+
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+			PURL      string `json:"purl"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string              `json:"type"`
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+	} `json:"affected"`
+}
+
+// VulnDB is an offline vulnerability database (NVD JSON 2.0 feeds and/or OSV entries)
+type VulnDB struct {
+	products map[string]bool // CPE vendor:product and lowercase package names of interest
+	nvd      map[string][]nvdEntry
+	osv      map[string][]*osvEntry
+}
+
+type nvdEntry struct {
+	cve   *nvdCVE
+	match nvdCPEMatch
+}
+
+// NewVulnDB returns an empty vulnerability database that only keeps the entries affecting the SBOMs' components
+func NewVulnDB(sboms ...*SBOM) *VulnDB {
+	db := &VulnDB{
+		products: make(map[string]bool),
+		nvd:      make(map[string][]nvdEntry),
+		osv:      make(map[string][]*osvEntry),
+	}
+	for _, s := range sboms {
+		for _, c := range s.Components {
+			db.products[strings.ToLower(c.Name)] = true
+			if vp := cpeProduct(c.CPE); len(vp) > 0 {
+				db.products[vp] = true
+			}
+		}
+	}
+	return db
+}
+
+// cpeProduct returns the vendor:product of a CPE 2.3 string
+func cpeProduct(cpe string) string {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 6 || parts[0] != "cpe" {
+		return ""
+	}
+	return strings.ToLower(parts[3] + ":" + parts[4])
+}
+
+func cpeVersion(cpe string) string {
+	if parts := strings.Split(cpe, ":"); len(parts) >= 6 {
+		return parts[5]
+	}
+	return ""
+}
+
+// Load loads the NVD feed(s)/OSV entries in path (a .json, .json.gz or .zip file or a folder of them)
+func (db *VulnDB) Load(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if strings.HasSuffix(p, ".json") || strings.HasSuffix(p, ".json.gz") || strings.HasSuffix(p, ".zip") {
+				return db.Load(p)
+			}
+			return nil
+		})
+	}
+	if strings.HasSuffix(path, ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		defer zr.Close()
+		for _, zf := range zr.File {
+			if !strings.HasSuffix(zf.Name, ".json") {
+				continue
+			}
+			r, err := zf.Open()
+			if err != nil {
+				return fmt.Errorf("failed to open %s in %s: %v", zf.Name, path, err)
+			}
+			err = db.read(r)
+			r.Close()
+			if err != nil {
+				return fmt.Errorf("failed to parse %s in %s: %v", zf.Name, path, err)
+			}
+		}
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %v", path, err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	if err := db.read(r); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+func (db *VulnDB) read(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 1<<16)
+	head, _ := br.Peek(4096)
+	if bytes.Contains(head, []byte(`"vulnerabilities"`)) {
+		return db.readNVD(br)
+	}
+	// OSV entry (or an array of entries)
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return err
+	}
+	var entries []*osvEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+	} else {
+		var entry osvEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, &entry)
+	}
+	for _, e := range entries {
+		for _, a := range e.Affected {
+			name := strings.ToLower(a.Package.Name)
+			if db.products[name] {
+				db.osv[name] = append(db.osv[name], e)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// readNVD streams the (huge) NVD JSON 2.0 feed's vulnerabilities array
+func (db *VulnDB) readNVD(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil { // {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, ok := tok.(string); !ok || key != "vulnerabilities" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := dec.Token(); err != nil { // [
+			return err
+		}
+		for dec.More() {
+			var item struct {
+				CVE nvdCVE `json:"cve"`
+			}
+			if err := dec.Decode(&item); err != nil {
+				return err
+			}
+			cve := &item.CVE
+			for _, conf := range cve.Configurations {
+				for _, node := range conf.Nodes {
+					for _, m := range node.CPEMatch {
+						if vp := cpeProduct(m.Criteria); m.Vulnerable && db.products[vp] {
+							db.nvd[vp] = append(db.nvd[vp], nvdEntry{cve: cve, match: m})
+						}
+					}
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil { // ]
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *nvdCVE) summary() string {
+	for _, d := range c.Descriptions {
+		if d.Lang == "en" {
+			return d.Value
+		}
+	}
+	return ""
+}
+
+func (c *nvdCVE) severity() string {
+	for _, ms := range [][]nvdMetric{c.Metrics.V31, c.Metrics.V30} {
+		if len(ms) > 0 {
+			return fmt.Sprintf("%s (%.1f)", ms[0].CVSSData.BaseSeverity, ms[0].CVSSData.BaseScore)
+		}
+	}
+	if len(c.Metrics.V2) > 0 {
+		return fmt.Sprintf("%s (%.1f)", c.Metrics.V2[0].BaseSeverity, c.Metrics.V2[0].CVSSData.BaseScore)
+	}
+	return ""
+}
+
+// affects returns true if the CPE match range contains version
+func (m nvdCPEMatch) affects(version string) bool {
+	if v := cpeVersion(m.Criteria); v != "*" && v != "-" && v != "" {
+		return CompareVersions(version, v) == 0
+	}
+	if m.VersionStartIncluding != "" && CompareVersions(version, m.VersionStartIncluding) < 0 {
+		return false
+	}
+	if m.VersionStartExcluding != "" && CompareVersions(version, m.VersionStartExcluding) <= 0 {
+		return false
+	}
+	if m.VersionEndIncluding != "" && CompareVersions(version, m.VersionEndIncluding) > 0 {
+		return false
+	}
+	if m.VersionEndExcluding != "" && CompareVersions(version, m.VersionEndExcluding) >= 0 {
+		return false
+	}
+	return m.VersionStartIncluding != "" || m.VersionStartExcluding != "" || m.VersionEndIncluding != "" || m.VersionEndExcluding != ""
+}
+
+// affects returns true (and the fixed version) if one of the OSV entry's affected ranges contains version
+func (e *osvEntry) affects(name, version string) (string, bool) {
+	for _, a := range e.Affected {
+		if strings.ToLower(a.Package.Name) != name {
+			continue
+		}
+		if slices.Contains(a.Versions, version) {
+			return "", true
+		}
+		for _, r := range a.Ranges {
+			if r.Type == "GIT" {
+				continue // commit hashes can't be compared to a binary's version string
+			}
+			var affected bool
+			var fixed string
+			for _, ev := range r.Events {
+				if intro, ok := ev["introduced"]; ok && (intro == "0" || CompareVersions(version, intro) >= 0) {
+					affected, fixed = true, ""
+				}
+				if fix, ok := ev["fixed"]; ok && affected {
+					if CompareVersions(version, fix) >= 0 {
+						affected = false
+					} else if fixed == "" {
+						fixed = fix
+					}
+				}
+				if last, ok := ev["last_affected"]; ok && affected && CompareVersions(version, last) > 0 {
+					affected = false
+				}
+			}
+			if affected {
+				return fixed, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Match returns the known vulnerabilities affecting the SBOM's component versions
+func (db *VulnDB) Match(s *SBOM) []Finding {
+	var findings []Finding
+	for _, c := range s.Components {
+		if len(c.Version) == 0 {
+			continue // we can't match a component we couldn't find the version of
+		}
+		seen := make(map[string]bool)
+		if vp := cpeProduct(c.CPE); len(vp) > 0 {
+			for _, e := range db.nvd[vp] {
+				if seen[e.cve.ID] || !e.match.affects(c.Version) {
+					continue
+				}
+				seen[e.cve.ID] = true
+				findings = append(findings, Finding{
+					ID:        e.cve.ID,
+					Component: c.Name,
+					Version:   c.Version,
+					Severity:  e.cve.severity(),
+					Fixed:     e.match.VersionEndExcluding,
+					Summary:   e.cve.summary(),
+					Source:    "nvd",
+				})
+			}
+		}
+		name := strings.ToLower(c.Name)
+		for _, e := range db.osv[name] {
+			fixed, ok := e.affects(name, c.Version)
+			if !ok || seen[e.ID] || slices.ContainsFunc(e.Aliases, func(a string) bool { return seen[a] }) {
+				continue
+			}
+			seen[e.ID] = true
+			id := e.ID
+			for _, a := range e.Aliases {
+				if strings.HasPrefix(a, "CVE-") {
+					id = a // report the CVE (like NVD does)
+					break
+				}
+			}
+			var severity string
+			if len(e.Severity) > 0 {
+				severity = e.Severity[0].Score
+			}
+			summary := e.Summary
+			if len(summary) == 0 {
+				summary, _, _ = strings.Cut(e.Details, "\n")
+			}
+			findings = append(findings, Finding{
+				ID:        id,
+				Aliases:   slices.DeleteFunc(append([]string{e.ID}, e.Aliases...), func(a string) bool { return a == id }),
+				Component: c.Name,
+				Version:   c.Version,
+				Severity:  severity,
+				Fixed:     fixed,
+				Summary:   summary,
+				Source:    "osv",
+			})
+		}
+	}
+	slices.SortFunc(findings, func(a, b Finding) int {
+		return cmp.Or(cmp.Compare(a.Component, b.Component), cmp.Compare(a.ID, b.ID))
+	})
+	return findings
+}
+
+// DiffFindings returns the vulnerabilities that are new in (and fixed by) the new build
+func DiffFindings(prev, next []Finding) (added, fixed []Finding) {
+	prevKeys := make(map[string]bool)
+	for _, f := range prev {
+		prevKeys[f.Key()] = true
+	}
+	nextKeys := make(map[string]bool)
+	for _, f := range next {
+		nextKeys[f.Key()] = true
+		if !prevKeys[f.Key()] {
+			added = append(added, f)
+		}
+	}
+	for _, f := range prev {
+		if !nextKeys[f.Key()] {
+			fixed = append(fixed, f)
+		}
+	}
+	return added, fixed
+}
+
+// CompareVersions compares dotted versions numerically (i.e. 2.9.13 > 2.9.2, 9.0p1 > 9.0 and 2.9 == 2.9.0)
+func CompareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		partA, partB := "0", "0" // pad the shorter version with zeros (2.9 == 2.9.0)
+		if i < len(pa) {
+			partA = pa[i]
+		}
+		if i < len(pb) {
+			partB = pb[i]
+		}
+		if c := comparePart(partA, partB); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// comparePart compares a version part's leading number then its suffix (i.e. 0p1)
+func comparePart(a, b string) int {
+	na, sa := leadingNumber(a)
+	nb, sb := leadingNumber(b)
+	if c := cmp.Compare(na, nb); c != 0 {
+		return c
+	}
+	return cmp.Compare(sa, sb)
+}
+
+func leadingNumber(s string) (int, string) {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i == -1 {
+		i = len(s)
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
@@ -8,12 +8,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/img4"
 	"github.com/blacktop/lzfse-cgo"
 )
 
@@ -308,7 +310,14 @@ func Parse(in string) (*Sep, error) {
 		return nil, err
 	}
 
-	if string(s.data[8:16]) == "eGirBwRD" {
+	if im4p, err := img4.ParseIm4p(bytes.NewReader(s.data)); err == nil { // IM4P wrapped SEP firmware
+		if err := im4p.CheckEncrypted(filepath.Base(in)); err != nil {
+			return nil, err
+		}
+		s.data = im4p.Data
+	}
+
+	if len(s.data) > 16 && string(s.data[8:16]) == "eGirBwRD" {
 		out := make([]byte, len(s.data)*4)
 		if n := lzfse.DecodeLZVNBuffer(s.data[0x10000:], out); n == 0 {
 			return nil, fmt.Errorf("failed to decompress")
@@ -1,6 +1,7 @@
 package signature
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"maps"
@@ -266,6 +267,11 @@ func (sm SymbolMap) getMig(m *macho.File) error {
 }
 
 func (sm SymbolMap) Symbolicate(infile string, sigs []Symbolicator, quiet bool) error {
+	return sm.SymbolicateContext(context.Background(), infile, sigs, quiet)
+}
+
+// SymbolicateContext is like Symbolicate but stops (returning ctx.Err()) once the context is done
+func (sm SymbolMap) SymbolicateContext(ctx context.Context, infile string, sigs []Symbolicator, quiet bool) error {
 	kc, err := macho.Open(infile)
 	if err != nil {
 		return fmt.Errorf("failed to open kernelcache: %v", err)
@@ -290,6 +296,9 @@ func (sm SymbolMap) Symbolicate(infile string, sigs []Symbolicator, quiet bool)
 	goodsig := false
 
 	for _, sig := range sigs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if ok, err := checkVersion(kv, sig); !ok {
 			continue
 		} else if err != nil {
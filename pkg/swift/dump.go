@@ -0,0 +1,230 @@
+// Package swift provides a JSON friendly model of the Swift type metadata, protocols and conformances of a MachO
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	mswift "github.com/blacktop/go-macho/types/swift"
+	"github.com/blacktop/ipsw/internal/swift"
+)
+
+// ErrNoSwift is returned when a MachO has no Swift metadata
+var ErrNoSwift = errors.New("no Swift metadata found")
+
+// Image is the Swift metadata of a MachO (or dyld_shared_cache dylib)
+type Image struct {
+	Name         string         `json:"name,omitempty"`
+	Types        []*Type        `json:"types,omitempty"`
+	Protocols    []*Protocol    `json:"protocols,omitempty"`
+	Conformances []*Conformance `json:"conformances,omitempty"`
+}
+
+// Type is a Swift nominal type context descriptor (class, struct or enum)
+type Type struct {
+	Kind           string  `json:"kind"`
+	Name           string  `json:"name"` // the fully qualified name (i.e. Module.Parent.Name)
+	Addr           uint64  `json:"addr"`
+	AccessFunction uint64  `json:"access_function,omitempty"`
+	SuperClass     string  `json:"super_class,omitempty"`
+	Fields         []Field `json:"fields,omitempty"`
+}
+
+// Field is a stored property of a struct/class or a case of an enum
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"` // the demangled type (enum cases without a payload have none)
+	MangledType string `json:"mangled_type,omitempty"`
+	Var         bool   `json:"var,omitempty"`
+	Indirect    bool   `json:"indirect,omitempty"`
+}
+
+// Protocol is a Swift protocol descriptor
+type Protocol struct {
+	Name            string   `json:"name"`
+	Addr            uint64   `json:"addr"`
+	AssociatedTypes []string `json:"associated_types,omitempty"`
+}
+
+// Conformance is a Swift protocol conformance record
+type Conformance struct {
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+	Addr     uint64 `json:"addr"`
+}
+
+// ParseImage parses the Swift types, protocols and protocol conformances of a MachO
+//
+// NOTE: field and superclass types are demangled with the built-in demangler on non-darwin hosts
+func ParseImage(m *macho.File) (*Image, error) {
+	if !m.HasSwift() {
+		return nil, ErrNoSwift
+	}
+	if err := m.PreCache(); err != nil { // cache fields and types
+		return nil, fmt.Errorf("failed to precache swift fields/types: %w", err)
+	}
+	img := new(Image)
+	typs, err := m.GetSwiftTypes()
+	if err != nil && !errors.Is(err, macho.ErrSwiftSectionError) {
+		return nil, fmt.Errorf("failed to parse types: %w", err)
+	}
+	for _, t := range typs {
+		if typ := newType(&t); typ != nil {
+			img.Types = append(img.Types, typ)
+		}
+	}
+	protos, err := m.GetSwiftProtocols()
+	if err != nil && !errors.Is(err, macho.ErrSwiftSectionError) {
+		return nil, fmt.Errorf("failed to parse protocols: %w", err)
+	}
+	for _, p := range protos {
+		proto := &Protocol{
+			Name:            p.Name,
+			Addr:            p.Address,
+			AssociatedTypes: p.AssociatedTypes,
+		}
+		if p.Parent != nil && p.Parent.Name != "" {
+			proto.Name = p.Parent.Name + "." + p.Name
+		}
+		img.Protocols = append(img.Protocols, proto)
+	}
+	confs, err := m.GetSwiftProtocolConformances()
+	if err != nil && !errors.Is(err, macho.ErrSwiftSectionError) {
+		return nil, fmt.Errorf("failed to parse protocol conformances: %w", err)
+	}
+	for _, c := range confs {
+		conf := &Conformance{
+			Protocol: swift.DemangleBlob(c.Protocol),
+			Addr:     c.Address,
+		}
+		if c.TypeRef != nil {
+			conf.Type = qualifiedName(c.TypeRef)
+		}
+		img.Conformances = append(img.Conformances, conf)
+	}
+	return img, nil
+}
+
+func newType(t *mswift.Type) *Type {
+	switch t.Kind {
+	case mswift.CDKindClass, mswift.CDKindStruct, mswift.CDKindEnum:
+	default:
+		return nil // skip modules, extensions, anonymous contexts, etc.
+	}
+	typ := &Type{
+		Kind:           t.Kind.String(),
+		Name:           qualifiedName(t),
+		Addr:           t.Address,
+		AccessFunction: t.AccessFunction,
+	}
+	if class, ok := t.Type.(mswift.Class); ok && class.SuperClass != "" {
+		typ.SuperClass = demangle(class.SuperClass)
+	}
+	if t.Fields != nil {
+		for _, r := range t.Fields.Records {
+			typ.Fields = append(typ.Fields, Field{
+				Name:        strings.Replace(r.Name, "$__lazy_storage_$_", "lazy ", 1),
+				Type:        demangle(r.MangledType),
+				MangledType: r.MangledType,
+				Var:         r.Flags.IsVar(),
+				Indirect:    r.Flags.IsIndirectCase(),
+			})
+		}
+	}
+	return typ
+}
+
+// qualifiedName returns the type's name prefixed with the names of its parent contexts
+func qualifiedName(t *mswift.Type) string {
+	name := t.Name
+	if t.ImportInfo != "" { // C/ObjC imported types
+		name = t.ImportInfo
+	}
+	for p := t.Parent; p != nil; p = p.Parent {
+		if p.Name != "" && p.Kind != mswift.CDKindExtension && p.Kind != mswift.CDKindAnonymous {
+			name = p.Name + "." + name
+		}
+	}
+	return name
+}
+
+// demangle returns the demangled form of a (partially symbolic reference resolved) mangled type name
+func demangle(typ string) string {
+	if typ == "" {
+		return ""
+	}
+	if out, err := swift.DemangleType(typ); err == nil {
+		return out
+	}
+	return swift.DemangleBlob(typ)
+}
+
+func (t *Type) String() string {
+	var sb strings.Builder
+	sb.WriteString(t.Kind + " " + t.Name)
+	if t.SuperClass != "" {
+		sb.WriteString(": " + t.SuperClass)
+	}
+	if len(t.Fields) == 0 {
+		sb.WriteString(" {}")
+		return sb.String()
+	}
+	sb.WriteString(" {\n")
+	for _, f := range t.Fields {
+		switch {
+		case t.Kind == mswift.CDKindEnum.String():
+			if f.Indirect {
+				sb.WriteString("    indirect case " + f.Name)
+			} else {
+				sb.WriteString("    case " + f.Name)
+			}
+			if f.Type != "" {
+				sb.WriteString("(" + strings.TrimSuffix(strings.TrimPrefix(f.Type, "("), ")") + ")")
+			}
+		case f.Var:
+			sb.WriteString("    var " + f.Name + ": " + f.Type)
+		default:
+			sb.WriteString("    let " + f.Name + ": " + f.Type)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func (p *Protocol) String() string {
+	if len(p.AssociatedTypes) == 0 {
+		return fmt.Sprintf("protocol %s {}", p.Name)
+	}
+	var sb strings.Builder
+	sb.WriteString("protocol " + p.Name + " {\n")
+	for _, a := range p.AssociatedTypes {
+		sb.WriteString("    associatedtype " + a + "\n")
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func (c *Conformance) String() string {
+	return fmt.Sprintf("extension %s: %s {}", c.Type, c.Protocol)
+}
+
+// Interface returns the Swift interface-like declarations of the image's protocols, types and conformances
+func (img *Image) Interface() string {
+	var sb strings.Builder
+	if img.Name != "" {
+		sb.WriteString("// " + img.Name + "\n\n")
+	}
+	for _, p := range img.Protocols {
+		sb.WriteString(p.String() + "\n\n")
+	}
+	for _, t := range img.Types {
+		sb.WriteString(t.String() + "\n\n")
+	}
+	for _, c := range img.Conformances {
+		sb.WriteString(c.String() + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
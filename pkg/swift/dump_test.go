@@ -0,0 +1,43 @@
+package swift
+
+import (
+	"strings"
+	"testing"
+
+	mswift "github.com/blacktop/go-macho/types/swift"
+)
+
+func TestImageInterface(t *testing.T) {
+	mod := &mswift.Type{Name: "main", Kind: mswift.CDKindModule}
+	foo := &mswift.Type{
+		Name:    "Foo",
+		Kind:    mswift.CDKindStruct,
+		Parent:  mod,
+		Address: 0x1000,
+		Fields: &mswift.Field{Records: []mswift.FieldRecord{
+			{Name: "items", MangledType: "SaySSG", FieldRecordDescriptor: mswift.FieldRecordDescriptor{Flags: mswift.IsVar}},
+			{Name: "count", MangledType: "Si"},
+		}},
+	}
+	img := &Image{
+		Name:         "main",
+		Types:        []*Type{newType(foo), newType(mod)},
+		Protocols:    []*Protocol{{Name: "main.P", AssociatedTypes: []string{"Element"}}},
+		Conformances: []*Conformance{{Type: qualifiedName(foo), Protocol: "main.P"}},
+	}
+	if img.Types[1] != nil {
+		t.Errorf("newType(module) = %+v, want nil", img.Types[1])
+	}
+	img.Types = img.Types[:1]
+
+	out := img.Interface()
+	for _, want := range []string{
+		"protocol main.P {\n    associatedtype Element\n}",
+		"struct main.Foo {\n    var items: Swift.Array<Swift.String>\n    let count: Swift.Int\n}",
+		"extension main.Foo: main.P {}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Interface() missing %q:\n%s", want, out)
+		}
+	}
+}
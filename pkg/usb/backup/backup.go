@@ -1,34 +1,229 @@
 package backup
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blacktop/go-plist"
 	"github.com/blacktop/ipsw/pkg/usb"
 	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
 )
 
-const serviceName = "com.apple.mobilebackup2"
+const (
+	serviceName  = "com.apple.mobilebackup2"
+	backupDomain = "com.apple.mobile.backup"
+)
+
+var supportedProtocolVersions = []float64{2.0, 2.1}
 
 type Client struct {
-	c *usb.Client
+	c               *usb.Client
+	udid            string
+	protocolVersion float64
+}
+
+type helloRequest struct {
+	MessageName               string    `plist:"MessageName"`
+	SupportedProtocolVersions []float64 `plist:"SupportedProtocolVersions"`
+}
+
+type helloResponse struct {
+	MessageName      string  `plist:"MessageName"`
+	ErrorCode        int     `plist:"ErrorCode"`
+	ErrorDescription string  `plist:"ErrorDescription,omitempty"`
+	ProtocolVersion  float64 `plist:"ProtocolVersion"`
+}
+
+type backupRequest struct {
+	MessageName      string         `plist:"MessageName"`
+	TargetIdentifier string         `plist:"TargetIdentifier"`
+	SourceIdentifier string         `plist:"SourceIdentifier,omitempty"`
+	Options          map[string]any `plist:"Options,omitempty"`
+}
+
+type changePasswordRequest struct {
+	MessageName      string `plist:"MessageName"`
+	TargetIdentifier string `plist:"TargetIdentifier"`
+	OldPassword      string `plist:"OldPassword,omitempty"`
+	NewPassword      string `plist:"NewPassword,omitempty"`
+}
+
+// Options are the options for creating a backup
+type Options struct {
+	// FullBackup forces a full backup instead of an incremental one
+	FullBackup bool
+	// Password is used to enable backup encryption (if not already enabled) before the backup is created
+	Password string
+	// Progress is called with the overall backup progress percentage reported by the device
+	Progress func(percent float64)
 }
 
 func NewClient(udid string) (*Client, error) {
-	c, err := lockdownd.NewClientForService(serviceName, udid, false)
+	c, err := lockdownd.NewClientForService(serviceName, udid, true)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		c: c,
-	}, nil
+	if _, err := c.DeviceLinkHandshake(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to perform device link handshake: %w", err)
+	}
+	cli := &Client{
+		c:    c,
+		udid: udid,
+	}
+	if err := cli.hello(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return cli, nil
+}
+
+func (c *Client) hello() error {
+	if err := c.c.DeviceLinkSend(&helloRequest{
+		MessageName:               "Hello",
+		SupportedProtocolVersions: supportedProtocolVersions,
+	}); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+	msg, err := c.c.DeviceLinkRecv()
+	if err != nil {
+		return fmt.Errorf("failed to receive hello response: %w", err)
+	}
+	var resp helloResponse
+	if err := remarshal(msg, &resp); err != nil {
+		return fmt.Errorf("failed to parse hello response: %w", err)
+	}
+	if resp.ErrorCode != 0 {
+		return fmt.Errorf("hello failed (%d): %s", resp.ErrorCode, resp.ErrorDescription)
+	}
+	c.protocolVersion = resp.ProtocolVersion
+	return nil
+}
+
+// ProtocolVersion returns the negotiated mobilebackup2 protocol version
+func (c *Client) ProtocolVersion() float64 {
+	return c.protocolVersion
+}
+
+// WillEncrypt returns whether the device will encrypt its backups
+func WillEncrypt(udid string) (bool, error) {
+	cli, err := lockdownd.NewClient(udid)
+	if err != nil {
+		return false, err
+	}
+	defer cli.Close()
+	v, err := cli.GetValue(backupDomain, "WillEncrypt")
+	if err != nil {
+		return false, err
+	}
+	enc, ok := v.(bool)
+	if !ok {
+		return false, nil
+	}
+	return enc, nil
+}
+
+// ChangePassword sets, changes or (with an empty newPassword) removes the backup encryption password
+func (c *Client) ChangePassword(root, oldPassword, newPassword string) error {
+	if err := c.c.DeviceLinkSend(&changePasswordRequest{
+		MessageName:      "ChangePassword",
+		TargetIdentifier: c.udid,
+		OldPassword:      oldPassword,
+		NewPassword:      newPassword,
+	}); err != nil {
+		return fmt.Errorf("failed to send change password request: %w", err)
+	}
+	return c.process(root, nil)
+}
+
+// Backup creates a backup of the device in the folder root/<UDID>
+func (c *Client) Backup(root string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, c.udid), 0750); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	if len(opts.Password) > 0 {
+		enc, err := WillEncrypt(c.udid)
+		if err != nil {
+			return fmt.Errorf("failed to query backup encryption state: %w", err)
+		}
+		if !enc {
+			if err := c.ChangePassword(root, "", opts.Password); err != nil {
+				return fmt.Errorf("failed to enable backup encryption: %w", err)
+			}
+		}
+	}
+
+	if err := writeInfoPlist(root, c.udid); err != nil {
+		return err
+	}
+
+	req := &backupRequest{
+		MessageName:      "Backup",
+		TargetIdentifier: c.udid,
+		SourceIdentifier: c.udid,
+	}
+	if opts.FullBackup {
+		req.Options = map[string]any{"ForceFullBackup": true}
+	}
+	if err := c.c.DeviceLinkSend(req); err != nil {
+		return fmt.Errorf("failed to send backup request: %w", err)
+	}
+
+	return c.process(root, opts.Progress)
 }
 
 func (c *Client) Close() error {
+	c.c.Send([]any{"DLMessageDisconnect", "___EmptyParameterString___"})
 	return c.c.Close()
 }
 
-func (c *Client) GetMsg() (any, error) {
-	var resp any
-	if err := c.c.Recv(resp); err != nil {
-		return nil, err
+func writeInfoPlist(root, udid string) error {
+	cli, err := lockdownd.NewClient(udid)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	dev, err := cli.GetValues()
+	if err != nil {
+		return fmt.Errorf("failed to get device values: %w", err)
+	}
+
+	info := Info{
+		BuildVersion:     dev.BuildVersion,
+		DeviceName:       dev.DeviceName,
+		DisplayName:      dev.DeviceName,
+		GUID:             udid,
+		LastBackupDate:   time.Now(),
+		ProductName:      dev.ProductName,
+		ProductType:      dev.ProductType,
+		ProductVersion:   dev.ProductVersion,
+		SerialNumber:     dev.SerialNumber,
+		TargetIdentifier: udid,
+		TargetType:       "Device",
+		UniqueIdentifier: udid,
+	}
+
+	data, err := plist.MarshalIndent(&info, plist.XMLFormat, "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal Info.plist: %w", err)
+	}
+	return os.WriteFile(filepath.Join(root, udid, "Info.plist"), data, 0640)
+}
+
+// remarshal converts a generic plist value into the given struct
+func remarshal(in, out any) error {
+	data, err := plist.Marshal(in, plist.BinaryFormat)
+	if err != nil {
+		return err
 	}
-	return resp, nil
+	_, err = plist.Unmarshal(data, out)
+	return err
 }
@@ -1 +1,433 @@
 package backup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+const (
+	codeSuccess     = 0x00
+	codeErrorLocal  = 0x06
+	codeErrorRemote = 0x0b
+	codeFileData    = 0x0c
+
+	emptyParameterString = "___EmptyParameterString___"
+
+	fileTransferBlockSize = 0x100000
+)
+
+// dlFileError is the per file error entry sent back to the device in a multi-status response
+type dlFileError struct {
+	DLFileErrorString string
+	DLFileErrorCode   int
+}
+
+// process handles the DeviceLink messages sent by the device until it reports that the operation is complete
+func (c *Client) process(root string, progress func(float64)) error {
+	for {
+		var msg []any
+		if err := c.c.Recv(&msg); err != nil {
+			return fmt.Errorf("failed to receive device link message: %w", err)
+		}
+		if len(msg) == 0 {
+			return fmt.Errorf("received empty device link message")
+		}
+		name, ok := msg[0].(string)
+		if !ok {
+			return fmt.Errorf("received invalid device link message: %v", msg)
+		}
+
+		log.Debugf("mobilebackup2: %s", name)
+
+		switch name {
+		case "DLMessageDownloadFiles":
+			reportProgress(msg, 3, progress)
+			if err := c.handleDownloadFiles(root, msg); err != nil {
+				return err
+			}
+		case "DLMessageUploadFiles":
+			reportProgress(msg, 2, progress)
+			if err := c.handleUploadFiles(root); err != nil {
+				return err
+			}
+		case "DLMessageGetFreeDiskSpace":
+			free, err := freeDiskSpace(root)
+			if err != nil {
+				if err := c.sendStatus(-1, err.Error(), map[string]any{}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.sendStatus(0, "", free); err != nil {
+				return err
+			}
+		case "DLContentsOfDirectory":
+			if err := c.handleContentsOfDirectory(root, msg); err != nil {
+				return err
+			}
+		case "DLMessageCreateDirectory":
+			code, desc := 0, ""
+			if len(msg) > 1 {
+				if err := os.MkdirAll(resolvePath(root, msg[1]), 0750); err != nil {
+					code, desc = -1, err.Error()
+				}
+			}
+			if err := c.sendStatus(code, desc, map[string]any{}); err != nil {
+				return err
+			}
+		case "DLMessageMoveFiles", "DLMessageMoveItems":
+			reportProgress(msg, 3, progress)
+			if err := c.handleMoveItems(root, msg); err != nil {
+				return err
+			}
+		case "DLMessageRemoveFiles", "DLMessageRemoveItems":
+			reportProgress(msg, 3, progress)
+			if err := c.handleRemoveItems(root, msg); err != nil {
+				return err
+			}
+		case "DLMessageCopyItem":
+			code, desc := 0, ""
+			if len(msg) > 2 {
+				if err := copyItem(resolvePath(root, msg[1]), resolvePath(root, msg[2])); err != nil {
+					code, desc = -1, err.Error()
+				}
+			}
+			if err := c.sendStatus(code, desc, map[string]any{}); err != nil {
+				return err
+			}
+		case "DLMessagePurgeDiskSpace":
+			if err := c.sendStatus(-1, "Operation not supported", map[string]any{}); err != nil {
+				return err
+			}
+		case "DLMessageDisconnect":
+			return nil
+		case "DLMessageProcessMessage":
+			if len(msg) < 2 {
+				return fmt.Errorf("received invalid process message: %v", msg)
+			}
+			var resp helloResponse
+			if err := remarshal(msg[1], &resp); err != nil {
+				return fmt.Errorf("failed to parse process message: %w", err)
+			}
+			if resp.ErrorCode != 0 {
+				return fmt.Errorf("operation failed (%d): %s", resp.ErrorCode, resp.ErrorDescription)
+			}
+			return nil
+		default:
+			log.Warnf("mobilebackup2: unsupported device link message %s", name)
+			if err := c.sendStatus(-1, "Operation not supported", map[string]any{}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func reportProgress(msg []any, idx int, progress func(float64)) {
+	if progress == nil || len(msg) <= idx {
+		return
+	}
+	if p, ok := msg[idx].(float64); ok && p > 0 {
+		progress(p)
+	}
+}
+
+func (c *Client) sendStatus(code int, desc string, status any) error {
+	if len(desc) == 0 {
+		desc = emptyParameterString
+	}
+	return c.c.Send([]any{"DLMessageStatusResponse", code, desc, status})
+}
+
+// handleUploadFiles receives the files the device is uploading to the host
+func (c *Client) handleUploadFiles(root string) error {
+	conn := c.c.Conn()
+	for {
+		dname, err := readString(conn)
+		if err != nil {
+			return fmt.Errorf("failed to read upload device name: %w", err)
+		}
+		if len(dname) == 0 {
+			break
+		}
+		fname, err := readString(conn)
+		if err != nil {
+			return fmt.Errorf("failed to read upload file name: %w", err)
+		}
+
+		fpath := resolvePath(root, fname)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0750); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", fpath, err)
+		}
+		f, err := os.Create(fpath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", fpath, err)
+		}
+
+		for {
+			var size uint32
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to read upload block size: %w", err)
+			}
+			if size == 0 {
+				break
+			}
+			var code byte
+			if err := binary.Read(conn, binary.BigEndian, &code); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to read upload block code: %w", err)
+			}
+			size--
+			if code == codeFileData {
+				if _, err := io.CopyN(f, conn, int64(size)); err != nil {
+					f.Close()
+					return fmt.Errorf("failed to receive %s: %w", fname, err)
+				}
+				continue
+			}
+			if size > 0 {
+				msg := make([]byte, size)
+				if _, err := io.ReadFull(conn, msg); err != nil {
+					f.Close()
+					return fmt.Errorf("failed to read upload status: %w", err)
+				}
+				if code == codeErrorRemote {
+					log.Warnf("mobilebackup2: device failed to send %s: %s", fname, string(msg))
+				}
+			}
+			break
+		}
+		f.Close()
+	}
+
+	return c.sendStatus(0, "", map[string]any{})
+}
+
+// handleDownloadFiles sends the files requested by the device (e.g. from a previous backup) to the device
+func (c *Client) handleDownloadFiles(root string, msg []any) error {
+	if len(msg) < 2 {
+		return fmt.Errorf("received invalid download files message: %v", msg)
+	}
+	files, ok := msg[1].([]any)
+	if !ok {
+		return fmt.Errorf("received invalid download files list: %v", msg[1])
+	}
+
+	conn := c.c.Conn()
+	errs := make(map[string]any)
+	for _, file := range files {
+		fname, ok := file.(string)
+		if !ok {
+			continue
+		}
+		if err := writeString(conn, fname); err != nil {
+			return fmt.Errorf("failed to send download file name: %w", err)
+		}
+		if err := sendFile(conn, resolvePath(root, fname)); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Warnf("mobilebackup2: failed to send %s: %v", fname, err)
+			}
+			errMsg := err.Error()
+			if err := writeBlock(conn, codeErrorLocal, []byte(errMsg)); err != nil {
+				return fmt.Errorf("failed to send download error: %w", err)
+			}
+			errs[fname] = dlFileError{
+				DLFileErrorString: errMsg,
+				DLFileErrorCode:   -6,
+			}
+		}
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint32(0)); err != nil {
+		return fmt.Errorf("failed to send download terminator: %w", err)
+	}
+
+	if len(errs) > 0 {
+		return c.sendStatus(-13, "Multi status", errs)
+	}
+	return c.sendStatus(0, "", map[string]any{})
+}
+
+func sendFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, fileTransferBlockSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := writeBlock(w, codeFileData, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeBlock(w, codeSuccess, nil)
+}
+
+func (c *Client) handleContentsOfDirectory(root string, msg []any) error {
+	entries := make(map[string]any)
+	if len(msg) > 1 {
+		dir := resolvePath(root, msg[1])
+		files, err := os.ReadDir(dir)
+		if err == nil {
+			for _, file := range files {
+				info, err := file.Info()
+				if err != nil {
+					continue
+				}
+				ftype := "DLFileTypeUnknown"
+				if info.Mode().IsDir() {
+					ftype = "DLFileTypeDirectory"
+				} else if info.Mode().IsRegular() {
+					ftype = "DLFileTypeRegular"
+				}
+				entries[file.Name()] = map[string]any{
+					"DLFileType":             ftype,
+					"DLFileSize":             uint64(info.Size()),
+					"DLFileModificationDate": info.ModTime(),
+				}
+			}
+		}
+	}
+	return c.sendStatus(0, "", entries)
+}
+
+func (c *Client) handleMoveItems(root string, msg []any) error {
+	code, desc := 0, ""
+	if len(msg) > 1 {
+		items, ok := msg[1].(map[string]any)
+		if !ok {
+			return fmt.Errorf("received invalid move items: %v", msg[1])
+		}
+		for src, dst := range items {
+			dpath := resolvePath(root, dst)
+			os.RemoveAll(dpath)
+			if err := os.MkdirAll(filepath.Dir(dpath), 0750); err != nil {
+				code, desc = -1, err.Error()
+				break
+			}
+			if err := os.Rename(resolvePath(root, src), dpath); err != nil {
+				code, desc = -1, err.Error()
+				break
+			}
+		}
+	}
+	return c.sendStatus(code, desc, map[string]any{})
+}
+
+func (c *Client) handleRemoveItems(root string, msg []any) error {
+	code, desc := 0, ""
+	if len(msg) > 1 {
+		items, ok := msg[1].([]any)
+		if !ok {
+			return fmt.Errorf("received invalid remove items: %v", msg[1])
+		}
+		for _, item := range items {
+			if err := os.RemoveAll(resolvePath(root, item)); err != nil {
+				code, desc = -1, err.Error()
+				break
+			}
+		}
+	}
+	return c.sendStatus(code, desc, map[string]any{})
+}
+
+func copyItem(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return os.MkdirAll(filepath.Join(dst, rel), 0750)
+			}
+			return copyFile(path, filepath.Join(dst, rel))
+		})
+	}
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// resolvePath maps a device supplied (backup root relative) path to a host path inside root
+func resolvePath(root string, p any) string {
+	s, _ := p.(string)
+	return filepath.Join(root, filepath.Clean("/"+strings.TrimLeft(s, "/")))
+}
+
+func readString(r io.Reader) (string, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return "", err
+	}
+	if size == 0 {
+		return "", nil
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(s))); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(s))
+	return err
+}
+
+func writeBlock(w io.Writer, code byte, data []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data)+1)); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{code}); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		_, err := w.Write(data)
+		return err
+	}
+	return nil
+}
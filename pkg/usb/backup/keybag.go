@@ -0,0 +1,190 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	wrapPasscode = 2
+)
+
+// ErrBadPassword is returned when the backup password fails to unwrap the keybag class keys
+var ErrBadPassword = errors.New("invalid backup password")
+
+// ClassKey is a keybag protection class key
+type ClassKey struct {
+	UUID  []byte
+	Class uint32
+	Wrap  uint32
+	Type  uint32
+	WPKY  []byte
+	Key   []byte
+}
+
+// Keybag is a backup keybag
+type Keybag struct {
+	Version    uint32
+	Type       uint32
+	UUID       []byte
+	HMCK       []byte
+	Wrap       uint32
+	Salt       []byte
+	Iterations uint32
+	DPWT       uint32
+	DPIC       uint32
+	DPSL       []byte
+	ClassKeys  map[uint32]*ClassKey
+}
+
+// ParseKeybag parses the TLV encoded BackupKeyBag from Manifest.plist
+func ParseKeybag(data []byte) (*Keybag, error) {
+	kb := &Keybag{ClassKeys: make(map[uint32]*ClassKey)}
+
+	var current *ClassKey
+	for len(data) >= 8 {
+		tag := string(data[:4])
+		size := binary.BigEndian.Uint32(data[4:8])
+		if uint64(len(data)) < 8+uint64(size) {
+			return nil, fmt.Errorf("keybag tag %s is truncated", tag)
+		}
+		value := data[8 : 8+size]
+		data = data[8+size:]
+
+		var num uint32
+		if size == 4 {
+			num = binary.BigEndian.Uint32(value)
+		}
+
+		if tag == "UUID" {
+			if kb.UUID == nil {
+				kb.UUID = value
+				continue
+			}
+			if current != nil && current.Class != 0 {
+				kb.ClassKeys[current.Class] = current
+			}
+			current = &ClassKey{UUID: value}
+			continue
+		}
+
+		if current != nil {
+			switch tag {
+			case "CLAS":
+				current.Class = num
+			case "WRAP":
+				current.Wrap = num
+			case "KTYP":
+				current.Type = num
+			case "WPKY":
+				current.WPKY = value
+			}
+			continue
+		}
+
+		switch tag {
+		case "VERS":
+			kb.Version = num
+		case "TYPE":
+			kb.Type = num
+		case "HMCK":
+			kb.HMCK = value
+		case "WRAP":
+			kb.Wrap = num
+		case "SALT":
+			kb.Salt = value
+		case "ITER":
+			kb.Iterations = num
+		case "DPWT":
+			kb.DPWT = num
+		case "DPIC":
+			kb.DPIC = num
+		case "DPSL":
+			kb.DPSL = value
+		}
+	}
+	if current != nil && current.Class != 0 {
+		kb.ClassKeys[current.Class] = current
+	}
+
+	if len(kb.ClassKeys) == 0 {
+		return nil, fmt.Errorf("keybag contains no class keys")
+	}
+
+	return kb, nil
+}
+
+// Unlock derives the passcode key from the backup password and unwraps the class keys
+func (kb *Keybag) Unlock(password string) error {
+	pass := []byte(password)
+	if len(kb.DPSL) > 0 {
+		pass = pbkdf2.Key(pass, kb.DPSL, int(kb.DPIC), 32, sha256.New)
+	}
+	passcodeKey := pbkdf2.Key(pass, kb.Salt, int(kb.Iterations), 32, sha1.New)
+
+	for _, ck := range kb.ClassKeys {
+		if ck.Wrap&wrapPasscode == 0 || len(ck.WPKY) == 0 {
+			continue
+		}
+		key, err := aesUnwrap(passcodeKey, ck.WPKY)
+		if err != nil {
+			return ErrBadPassword
+		}
+		ck.Key = key
+	}
+
+	return nil
+}
+
+// UnwrapKeyForClass unwraps a file/manifest key with the unlocked protection class key
+func (kb *Keybag) UnwrapKeyForClass(class uint32, wrapped []byte) ([]byte, error) {
+	ck, ok := kb.ClassKeys[class]
+	if !ok || ck.Key == nil {
+		return nil, fmt.Errorf("no unlocked key for protection class %d", class)
+	}
+	return aesUnwrap(ck.Key, wrapped)
+}
+
+var aesWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesUnwrap implements the RFC 3394 AES key unwrap algorithm
+func aesUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, fmt.Errorf("invalid wrapped key length %d", len(wrapped))
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, n*8)
+	copy(r, wrapped[8:])
+
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[(i-1)*8:i*8], buf[8:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare(a, aesWrapIV) != 1 {
+		return nil, errors.New("key unwrap integrity check failed")
+	}
+
+	return r, nil
+}
@@ -0,0 +1,27 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestAESUnwrap(t *testing.T) {
+	// RFC 3394 section 4.1: wrap 128 bits of key data with a 128-bit KEK
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	wrapped, _ := hex.DecodeString("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+	want, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+
+	got, err := aesUnwrap(kek, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("aesUnwrap() = %x, want %x", got, want)
+	}
+
+	wrapped[0] ^= 0xff
+	if _, err := aesUnwrap(kek, wrapped); err == nil {
+		t.Error("aesUnwrap() expected integrity check failure")
+	}
+}
@@ -0,0 +1,470 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blacktop/go-plist"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Manifest.db file flags
+const (
+	FlagFile      = 1
+	FlagDirectory = 2
+	FlagSymlink   = 4
+)
+
+// ErrPasswordRequired is returned when opening an encrypted backup without a password
+var ErrPasswordRequired = errors.New("backup is encrypted: password required")
+
+// fileIDRE matches a Manifest.db file ID (the SHA-1 of its domain and relative path)
+var fileIDRE = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Info is the backup Info.plist
+type Info struct {
+	BuildVersion     string    `plist:"Build Version,omitempty" json:"build_version,omitempty"`
+	DeviceName       string    `plist:"Device Name,omitempty" json:"device_name,omitempty"`
+	DisplayName      string    `plist:"Display Name,omitempty" json:"display_name,omitempty"`
+	GUID             string    `plist:"GUID,omitempty" json:"guid,omitempty"`
+	ICCID            string    `plist:"ICCID,omitempty" json:"iccid,omitempty"`
+	IMEI             string    `plist:"IMEI,omitempty" json:"imei,omitempty"`
+	LastBackupDate   time.Time `plist:"Last Backup Date,omitempty" json:"last_backup_date"`
+	PhoneNumber      string    `plist:"Phone Number,omitempty" json:"phone_number,omitempty"`
+	ProductName      string    `plist:"Product Name,omitempty" json:"product_name,omitempty"`
+	ProductType      string    `plist:"Product Type,omitempty" json:"product_type,omitempty"`
+	ProductVersion   string    `plist:"Product Version,omitempty" json:"product_version,omitempty"`
+	SerialNumber     string    `plist:"Serial Number,omitempty" json:"serial_number,omitempty"`
+	TargetIdentifier string    `plist:"Target Identifier,omitempty" json:"target_identifier,omitempty"`
+	TargetType       string    `plist:"Target Type,omitempty" json:"target_type,omitempty"`
+	UniqueIdentifier string    `plist:"Unique Identifier,omitempty" json:"unique_identifier,omitempty"`
+	ITunesVersion    string    `plist:"iTunes Version,omitempty" json:"itunes_version,omitempty"`
+}
+
+// Manifest is the backup Manifest.plist
+type Manifest struct {
+	BackupKeyBag      []byte         `plist:"BackupKeyBag,omitempty" json:"-"`
+	Date              time.Time      `plist:"Date" json:"date"`
+	IsEncrypted       bool           `plist:"IsEncrypted" json:"is_encrypted"`
+	ManifestKey       []byte         `plist:"ManifestKey,omitempty" json:"-"`
+	SystemDomainsVers string         `plist:"SystemDomainsVersion,omitempty" json:"system_domains_version,omitempty"`
+	Version           string         `plist:"Version" json:"version"`
+	WasPasscodeSet    bool           `plist:"WasPasscodeSet" json:"was_passcode_set"`
+	Lockdown          map[string]any `plist:"Lockdown,omitempty" json:"lockdown,omitempty"`
+	Applications      map[string]any `plist:"Applications,omitempty" json:"-"`
+}
+
+// Status is the backup Status.plist
+type Status struct {
+	BackupState   string    `plist:"BackupState" json:"backup_state"`
+	Date          time.Time `plist:"Date" json:"date"`
+	IsFullBackup  bool      `plist:"IsFullBackup" json:"is_full_backup"`
+	SnapshotState string    `plist:"SnapshotState" json:"snapshot_state"`
+	UUID          string    `plist:"UUID" json:"uuid"`
+	Version       string    `plist:"Version" json:"version"`
+}
+
+// File is a file entry in the backup Manifest.db
+type File struct {
+	ID           string `gorm:"column:fileID;primaryKey" json:"id"`
+	Domain       string `gorm:"column:domain" json:"domain"`
+	RelativePath string `gorm:"column:relativePath" json:"relative_path"`
+	Flags        int    `gorm:"column:flags" json:"flags"`
+	Blob         []byte `gorm:"column:file" json:"-"`
+}
+
+func (File) TableName() string {
+	return "Files"
+}
+
+// Path returns the domain qualified path of the file
+func (f File) Path() string {
+	return f.Domain + "/" + f.RelativePath
+}
+
+func (f File) IsDir() bool {
+	return f.Flags == FlagDirectory
+}
+
+func (f File) IsSymlink() bool {
+	return f.Flags == FlagSymlink
+}
+
+// FileInfo is the MBFile metadata stored in the Manifest.db file blob
+type FileInfo struct {
+	Size            uint64    `json:"size"`
+	Mode            uint64    `json:"mode"`
+	UserID          uint64    `json:"uid"`
+	GroupID         uint64    `json:"gid"`
+	LastModified    time.Time `json:"last_modified"`
+	Birth           time.Time `json:"birth"`
+	ProtectionClass uint64    `json:"protection_class"`
+	Target          string    `json:"target,omitempty"`
+	EncryptionKey   []byte    `json:"-"`
+}
+
+// Backup is an on disk iTunes style backup
+type Backup struct {
+	Path     string
+	Info     *Info
+	Manifest *Manifest
+	Status   *Status
+
+	keybag *Keybag
+	dbPath string
+	db     *gorm.DB
+}
+
+// ReadMetadata reads the Info.plist, Manifest.plist and Status.plist of the backup in the folder dir without
+// opening its Manifest.db (so it doesn't need the password of an encrypted backup)
+func ReadMetadata(dir string) (*Backup, error) {
+	b := &Backup{Path: dir}
+
+	if err := readPlist(filepath.Join(dir, "Manifest.plist"), &b.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to read Manifest.plist: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Info.plist")); err == nil {
+		if err := readPlist(filepath.Join(dir, "Info.plist"), &b.Info); err != nil {
+			return nil, fmt.Errorf("failed to read Info.plist: %w", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Status.plist")); err == nil {
+		if err := readPlist(filepath.Join(dir, "Status.plist"), &b.Status); err != nil {
+			return nil, fmt.Errorf("failed to read Status.plist: %w", err)
+		}
+	}
+
+	return b, nil
+}
+
+// Open opens the backup in the folder dir (the folder containing Manifest.db)
+func Open(dir, password string) (*Backup, error) {
+	b, err := ReadMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	b.dbPath = filepath.Join(dir, "Manifest.db")
+
+	if b.Manifest.IsEncrypted {
+		if len(password) == 0 {
+			return nil, ErrPasswordRequired
+		}
+		kb, err := ParseKeybag(b.Manifest.BackupKeyBag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse backup keybag: %w", err)
+		}
+		if err := kb.Unlock(password); err != nil {
+			return nil, err
+		}
+		b.keybag = kb
+		if err := b.decryptManifestDB(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := gorm.Open(sqlite.Open(b.dbPath), &gorm.Config{})
+	if err != nil {
+		if b.keybag != nil {
+			os.Remove(b.dbPath) // the decrypted temporary Manifest.db
+		}
+		return nil, fmt.Errorf("failed to open Manifest.db: %w", err)
+	}
+	b.db = db
+
+	return b, nil
+}
+
+func (b *Backup) decryptManifestDB() error {
+	if len(b.Manifest.ManifestKey) < 4 {
+		return fmt.Errorf("invalid ManifestKey")
+	}
+	key, err := b.keybag.UnwrapKeyForClass(binary.LittleEndian.Uint32(b.Manifest.ManifestKey[:4]), b.Manifest.ManifestKey[4:])
+	if err != nil {
+		return fmt.Errorf("failed to unwrap Manifest.db key: %w", err)
+	}
+	data, err := os.ReadFile(b.dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to read Manifest.db: %w", err)
+	}
+	dec, err := decryptCBC(key, data)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt Manifest.db: %w", err)
+	}
+	tmp, err := os.CreateTemp("", "Manifest.*.db")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(dec); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	b.dbPath = tmp.Name()
+	return nil
+}
+
+// Close closes the backup (and removes any decrypted temporary Manifest.db)
+func (b *Backup) Close() error {
+	if b.db != nil {
+		if db, err := b.db.DB(); err == nil {
+			db.Close()
+		}
+	}
+	if b.keybag != nil {
+		return os.Remove(b.dbPath)
+	}
+	return nil
+}
+
+// Files returns all the files in the backup whose domain qualified path contains filter
+func (b *Backup) Files(filter string) ([]File, error) {
+	var files []File
+	tx := b.db.Order("domain, relativePath")
+	if len(filter) > 0 {
+		tx = tx.Where("(domain || '/' || relativePath) LIKE ?", "%"+filter+"%")
+	}
+	if err := tx.Find(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to query Manifest.db: %w", err)
+	}
+	return files, nil
+}
+
+// Domains returns the list of domains in the backup
+func (b *Backup) Domains() ([]string, error) {
+	var domains []string
+	if err := b.db.Model(&File{}).Distinct("domain").Order("domain").Pluck("domain", &domains).Error; err != nil {
+		return nil, fmt.Errorf("failed to query Manifest.db: %w", err)
+	}
+	return domains, nil
+}
+
+// FileInfo parses the NSKeyedArchiver MBFile blob of a file entry
+func (b *Backup) FileInfo(f File) (*FileInfo, error) {
+	var archive map[string]any // NOTE: go-plist ignores struct tags without options (i.e. `plist:"$objects"`)
+	if _, err := plist.Unmarshal(f.Blob, &archive); err != nil {
+		return nil, fmt.Errorf("failed to parse file blob: %w", err)
+	}
+	objects, _ := archive["$objects"].([]any)
+	if len(objects) < 2 {
+		return nil, fmt.Errorf("invalid file blob")
+	}
+	obj, ok := objects[1].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid file blob root object")
+	}
+	deref := func(v any) any {
+		if uid, ok := v.(plist.UID); ok && int(uid) < len(objects) {
+			return objects[uid]
+		}
+		return v
+	}
+	toUint := func(v any) uint64 {
+		switch n := v.(type) {
+		case uint64:
+			return n
+		case int64:
+			return uint64(n)
+		}
+		return 0
+	}
+
+	fi := &FileInfo{
+		Size:            toUint(obj["Size"]),
+		Mode:            toUint(obj["Mode"]),
+		UserID:          toUint(obj["UserID"]),
+		GroupID:         toUint(obj["GroupID"]),
+		LastModified:    time.Unix(int64(toUint(obj["LastModified"])), 0),
+		Birth:           time.Unix(int64(toUint(obj["Birth"])), 0),
+		ProtectionClass: toUint(obj["ProtectionClass"]),
+	}
+	if target, ok := deref(obj["Target"]).(string); ok {
+		fi.Target = target
+	}
+	if ekey, ok := deref(obj["EncryptionKey"]).(map[string]any); ok {
+		if data, ok := ekey["NS.data"].([]byte); ok {
+			fi.EncryptionKey = data
+		}
+	}
+
+	return fi, nil
+}
+
+// Open returns a reader for the contents of the backup file
+func (b *Backup) Open(f File) (io.ReadCloser, error) {
+	if f.Flags != FlagFile {
+		return nil, fmt.Errorf("%s is not a regular file", f.Path())
+	}
+	if !fileIDRE.MatchString(f.ID) {
+		return nil, fmt.Errorf("%s has an invalid file ID '%s'", f.Path(), f.ID)
+	}
+	fpath := filepath.Join(b.Path, f.ID[:2], f.ID)
+	if b.keybag == nil {
+		return os.Open(fpath)
+	}
+
+	fi, err := b.FileInfo(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(fi.EncryptionKey) < 4 {
+		return nil, fmt.Errorf("missing encryption key for %s", f.Path())
+	}
+	key, err := b.keybag.UnwrapKeyForClass(binary.LittleEndian.Uint32(fi.EncryptionKey[:4]), fi.EncryptionKey[4:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key for %s: %w", f.Path(), err)
+	}
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := decryptCBC(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", f.Path(), err)
+	}
+	if fi.Size < uint64(len(dec)) {
+		dec = dec[:fi.Size]
+	}
+	return io.NopCloser(bytes.NewReader(dec)), nil
+}
+
+// Extract extracts the backup file to the folder output (using its domain qualified path)
+//
+// NOTE: entries whose path escapes output, symlinks whose target is absolute or escapes output and entries below
+// an extracted symlink are refused so a malicious Manifest.db can't write outside of output
+func (b *Backup) Extract(f File, output string) (string, error) {
+	rel := filepath.Join(f.Domain, filepath.FromSlash(f.RelativePath))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("refusing to extract entry with unsafe path '%s'", f.Path())
+	}
+	if err := checkNoSymlinks(output, filepath.Dir(rel)); err != nil {
+		return "", err
+	}
+	fpath := filepath.Join(output, rel)
+	switch f.Flags {
+	case FlagDirectory:
+		return fpath, os.MkdirAll(fpath, 0750)
+	case FlagSymlink:
+		fi, err := b.FileInfo(f)
+		if err != nil {
+			return "", err
+		}
+		target := filepath.FromSlash(fi.Target)
+		if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(rel), target)) {
+			return "", fmt.Errorf("refusing to extract symlink '%s' with unsafe target '%s'", f.Path(), fi.Target)
+		}
+		if err := os.MkdirAll(filepath.Dir(fpath), 0750); err != nil {
+			return "", err
+		}
+		os.Remove(fpath)
+		return fpath, os.Symlink(target, fpath)
+	}
+
+	r, err := b.Open(f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(fpath), 0750); err != nil {
+		return "", err
+	}
+	if fi, err := os.Lstat(fpath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		os.Remove(fpath) // replace the link instead of writing through it
+	}
+	out, err := os.Create(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, r); err != nil {
+		return "", err
+	}
+	return fpath, nil
+}
+
+// checkNoSymlinks returns an error if any of the folders of dir (relative to root) is a symlink
+func checkNoSymlinks(root, dir string) error {
+	path := root
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		if part == "." || part == "" {
+			continue
+		}
+		path = filepath.Join(path, part)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to extract entry below symlink '%s'", path)
+		}
+	}
+	return nil
+}
+
+// List returns the folders of the backups found in the backup root folder
+func List(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, entry.Name(), "Manifest.plist")); err == nil {
+			backups = append(backups, filepath.Join(root, entry.Name()))
+		}
+	}
+	return backups, nil
+}
+
+func readPlist(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = plist.Unmarshal(data, v)
+	return err
+}
+
+func decryptCBC(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, data)
+	// strip PKCS#7 padding
+	if n := len(out); n > 0 {
+		if pad := int(out[n-1]); pad > 0 && pad <= aes.BlockSize && pad <= n {
+			if bytes.Equal(out[n-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+				out = out[:n-pad]
+			}
+		}
+	}
+	return out, nil
+}
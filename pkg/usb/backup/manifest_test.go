@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/go-plist"
+)
+
+func symlinkBlob(t *testing.T, target string) []byte {
+	t.Helper()
+	blob, err := plist.Marshal(map[string]any{
+		"$objects": []any{"$null", map[string]any{"Target": plist.UID(2)}, target},
+	}, plist.BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+// fileID is a valid (40 hex character) Manifest.db file ID
+const fileID = "3d0d7e5fb2ce288813306e4d4636395e047a3d28"
+
+func TestExtractUnsafePaths(t *testing.T) {
+	root := t.TempDir()
+	b := &Backup{Path: filepath.Join(root, "backup")}
+	output := filepath.Join(root, "out")
+
+	if err := os.MkdirAll(filepath.Join(b.Path, fileID[:2]), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(b.Path, fileID[:2], fileID), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Extract(File{ID: fileID, Domain: "HomeDomain", RelativePath: "Library/a.txt", Flags: FlagFile}, output); err != nil {
+		t.Fatalf("Extract() = %v", err)
+	}
+	if _, err := b.Extract(File{Domain: "HomeDomain", RelativePath: "Library/link", Flags: FlagSymlink, Blob: symlinkBlob(t, "a.txt")}, output); err != nil {
+		t.Fatalf("Extract(local symlink) = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		f    File
+		want string
+	}{
+		{"domain", File{Domain: "../../x", RelativePath: "y", Flags: FlagDirectory}, "unsafe path"},
+		{"path", File{Domain: "HomeDomain", RelativePath: "../../../y", Flags: FlagDirectory}, "unsafe path"},
+		{"absolute target", File{Domain: "HomeDomain", RelativePath: "etc", Flags: FlagSymlink, Blob: symlinkBlob(t, "/etc")}, "unsafe target"},
+		{"escaping target", File{Domain: "HomeDomain", RelativePath: "up", Flags: FlagSymlink, Blob: symlinkBlob(t, "../../..")}, "unsafe target"},
+		{"short id", File{ID: "a", Domain: "HomeDomain", RelativePath: "Library/b.txt", Flags: FlagFile}, "invalid file ID"},
+		{"escaping id", File{ID: "../../../../../../../../../../etc/passwd", Domain: "HomeDomain", RelativePath: "Library/b.txt", Flags: FlagFile}, "invalid file ID"},
+		{"below symlink", File{ID: fileID, Domain: "HomeDomain", RelativePath: "Library/link/b.txt", Flags: FlagFile}, "below symlink"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := b.Extract(tt.f, output); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Extract() = %v, want %q error", err, tt.want)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Extract() wrote outside of the output folder: %v", entries)
+	}
+}
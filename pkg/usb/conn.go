@@ -2,10 +2,7 @@
 
 package usb
 
-import (
-	"net"
+const (
+	usbmuxdNetwork = "unix"
+	usbmuxdAddress = "/var/run/usbmuxd"
 )
-
-func usbmuxdDial() (net.Conn, error) {
-	return net.Dial("unix", "/var/run/usbmuxd")
-}
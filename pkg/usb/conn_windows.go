@@ -2,10 +2,8 @@
 
 package usb
 
-import (
-	"net"
+// the Apple Mobile Device Service (installed with iTunes or the Apple Devices app) listens on localhost
+const (
+	usbmuxdNetwork = "tcp"
+	usbmuxdAddress = "localhost:27015"
 )
-
-func usbmuxdDial() (net.Conn, error) {
-	return net.Dial("tcp", "localhost:27015")
-}
@@ -0,0 +1,172 @@
+package debugserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+)
+
+const secureServiceName = "com.apple.debugserver.DVTSecureSocketProxy"
+
+// NewSecureClient connects to the SSL wrapped debugserver service (iOS14+) and falls back to the legacy plaintext service
+func NewSecureClient(udid string) (*Client, error) {
+	cli, err := lockdownd.NewClientForService(secureServiceName, udid, false)
+	if err != nil {
+		return NewClient(udid)
+	}
+	return &Client{
+		c:         cli,
+		gdbServer: NewGDBServer(cli.Conn()),
+	}, nil
+}
+
+// Bridge listens on 127.0.0.1:lport and proxies every accepted connection to a NEW debugserver session on the device
+//
+// NOTE: if lport is 0 a random free port is picked; the port actually used is returned. Temporary accept errors are
+// retried with a backoff, any other error is passed to callback and stops the bridge.
+func Bridge(ctx context.Context, udid string, lport int, callback func(string, error)) (int, error) {
+	listen, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", lport))
+	if err != nil {
+		return 0, fmt.Errorf("failed to listen on tcp port %d: %v", lport, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = listen.Close()
+	}()
+
+	go func() {
+		var delay time.Duration // how long to sleep on accept failure
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				if ne, ok := err.(net.Error); ok && ne.Temporary() { // i.e. EMFILE (the same check as net/http.Server)
+					if delay == 0 {
+						delay = 5 * time.Millisecond
+					} else {
+						delay = min(2*delay, time.Second)
+					}
+					if callback != nil {
+						callback("", fmt.Errorf("accepting new conn error: %v; retrying in %v", err, delay))
+					}
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(delay):
+					}
+					continue
+				}
+				_ = listen.Close()
+				if callback != nil {
+					callback("", fmt.Errorf("accepting new conn error: %v", err))
+				}
+				return
+			}
+			delay = 0
+			dc, err := NewSecureClient(udid)
+			if err != nil {
+				conn.Close()
+				if callback != nil {
+					callback("", fmt.Errorf("failed to start debugserver: %v", err))
+				}
+				continue
+			}
+			if callback != nil {
+				callback(fmt.Sprintf("debugger connected from %s", conn.RemoteAddr()), nil)
+			}
+			go func() {
+				<-ctx.Done()
+				_ = conn.Close()
+				_ = dc.Close()
+			}()
+			proxy(dc.Conn(), conn)
+		}
+	}()
+
+	return listen.Addr().(*net.TCPAddr).Port, nil
+}
+
+// proxy copies between the connections (in both directions) until either one is closed
+func proxy(conn1, conn2 io.ReadWriteCloser) {
+	go func() {
+		defer conn1.Close()
+		defer conn2.Close()
+		io.Copy(conn2, conn1)
+	}()
+	go func() {
+		defer conn1.Close()
+		defer conn2.Close()
+		io.Copy(conn1, conn2)
+	}()
+}
+
+// DeviceSupportSymbols returns the Xcode 'iOS DeviceSupport' Symbols folder for a device (i.e. where `ipsw dyld split` puts the DSC dylibs)
+//
+// NOTE: both the NEW '<ProductType> <Version> (<Build>)' and the OLD '<Version> (<Build>)' folder naming is checked
+func DeviceSupportSymbols(productType, version, build string) (string, bool) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	root := filepath.Join(home, "Library/Developer/Xcode/iOS DeviceSupport")
+	candidates := []string{
+		filepath.Join(root, fmt.Sprintf("%s %s (%s)", productType, version, build), "Symbols"),
+		filepath.Join(root, fmt.Sprintf("%s (%s) arm64e", version, build), "Symbols"),
+		filepath.Join(root, fmt.Sprintf("%s (%s)", version, build), "Symbols"),
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, true
+		}
+	}
+	return candidates[0], false
+}
+
+// LLDBConfig is the info needed to generate the LLDB commands for a debug session
+type LLDBConfig struct {
+	Port        int
+	AppPath     string // on-device path to the .app bundle
+	Executable  string // name of the main executable
+	LocalApp    string // (optional) local copy of the .app bundle
+	SymbolsPath string // local folder containing the split DSC dylibs
+	WaitFor     bool   // attach when the app is next launched
+	PID         int    // attach to an already running process
+}
+
+// Commands returns the ready-to-paste LLDB commands for the debug session
+func (c LLDBConfig) Commands() []string {
+	var cmds []string
+	if len(c.SymbolsPath) > 0 {
+		cmds = append(cmds, fmt.Sprintf("platform select remote-ios --sysroot %q", c.SymbolsPath))
+	} else {
+		cmds = append(cmds, "platform select remote-ios")
+	}
+	if len(c.LocalApp) > 0 {
+		cmds = append(cmds,
+			fmt.Sprintf("target create %q", c.LocalApp),
+			fmt.Sprintf("script lldb.target.module[0].SetPlatformFileSpec(lldb.SBFileSpec(%q))", c.AppPath),
+		)
+	}
+	cmds = append(cmds, fmt.Sprintf("process connect connect://127.0.0.1:%d", c.Port))
+	switch {
+	case c.PID > 0:
+		cmds = append(cmds, fmt.Sprintf("process attach --pid %d", c.PID))
+	case len(c.LocalApp) > 0 && !c.WaitFor:
+		cmds = append(cmds, "process launch --stop-at-entry")
+	default:
+		cmds = append(cmds, fmt.Sprintf("process attach --name %q --waitfor", strings.TrimSuffix(c.Executable, ".app")))
+	}
+	return cmds
+}
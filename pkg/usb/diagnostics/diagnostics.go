@@ -1,11 +1,10 @@
 package diagnostics
 
 import (
-	"crypto/md5"
-	"encoding/base64"
 	"fmt"
 	"strings"
 
+	"github.com/blacktop/ipsw/pkg/mobilegestalt"
 	"github.com/blacktop/ipsw/pkg/usb"
 	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
 	"github.com/fatih/color"
@@ -101,8 +100,7 @@ type Client struct {
 }
 
 func MobileGestaltEncrypt(key string) string {
-	h := md5.Sum([]byte("MGCopyAnswer" + key))
-	return base64.StdEncoding.EncodeToString(h[:])[:22]
+	return mobilegestalt.Obfuscate(key)
 }
 
 func NewClient(udid string) (*Client, error) {
@@ -3,6 +3,7 @@ package notification
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/pkg/usb"
@@ -73,33 +74,69 @@ func (c *Client) PostNotification(notification string) error {
 	return nil
 }
 
+// Listen logs all the observed notifications until the context is canceled
 func (c *Client) Listen(ctx context.Context) error {
-	stoped := false
-	event := &ObserveNotificationEvent{}
+	return c.ListenFunc(ctx, func(name string) bool {
+		log.Info(name)
+		return false
+	})
+}
+
+// ListenFunc calls fn for each observed notification until fn returns true, the proxy dies or the context is canceled
+func (c *Client) ListenFunc(ctx context.Context, fn func(name string) bool) error {
+	done := make(chan struct{})
+	defer close(done)
 
 	go func() {
-		<-ctx.Done()
-		stoped = true
+		select {
+		case <-ctx.Done():
+			c.c.Close() // unblock the pending Recv
+		case <-done:
+		}
 	}()
 
 	for {
+		event := &ObserveNotificationEvent{}
 		if err := c.c.Recv(event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return err
 		}
 		switch event.Command {
 		case "RelayNotification":
-			log.Info(event.Name)
+			if fn(event.Name) {
+				return nil
+			}
 		case "ProxyDeath":
 			return fmt.Errorf("notification %s proxy died", event.Name)
 		default:
 			log.Log.Debugf("unknown notification event: %#v", event)
 		}
-		if stoped {
-			break
-		}
 	}
+}
 
-	return nil
+// WaitFor observes the given notifications and blocks until one of them is posted (returning its name) or the context is canceled
+func (c *Client) WaitFor(ctx context.Context, notifications ...string) (string, error) {
+	if len(notifications) == 0 {
+		return "", fmt.Errorf("no notifications to wait for")
+	}
+	for _, notification := range notifications {
+		if err := c.ObserveNotification(notification); err != nil {
+			return "", fmt.Errorf("failed to observe notification %s: %w", notification, err)
+		}
+	}
+	var received string
+	if err := c.ListenFunc(ctx, func(name string) bool {
+		if slices.Contains(notifications, name) {
+			received = name
+			return true
+		}
+		return false
+	}); err != nil {
+		return "", err
+	}
+	return received, nil
 }
 
 func (c *Client) shutdown() error {
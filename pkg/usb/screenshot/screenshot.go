@@ -2,7 +2,17 @@ package screenshot
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/blacktop/ipsw/pkg/usb"
 	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
@@ -12,6 +22,34 @@ const (
 	serviceName = "com.apple.mobile.screenshotr"
 )
 
+// Format is a screenshot image format
+type Format string
+
+const (
+	PNG  Format = "png"
+	JPEG Format = "jpeg"
+	HEIC Format = "heic"
+)
+
+// ParseFormat parses a screenshot image format name
+func ParseFormat(format string) (Format, error) {
+	switch strings.ToLower(format) {
+	case "", "png":
+		return PNG, nil
+	case "jpg", "jpeg":
+		return JPEG, nil
+	case "heic", "heif":
+		return HEIC, nil
+	default:
+		return "", fmt.Errorf("unsupported screenshot format %s (supported: png, jpeg, heic)", format)
+	}
+}
+
+// Ext returns the file extension of the format
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
 type Client struct {
 	c *usb.Client
 }
@@ -51,8 +89,15 @@ func (c *Client) Screenshot() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	respMap := resp.(map[string]any)
-	return respMap["ScreenShotData"].([]byte), nil
+	respMap, ok := resp.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected screenshot response: %v", resp)
+	}
+	data, ok := respMap["ScreenShotData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("screenshot response is missing ScreenShotData")
+	}
+	return data, nil
 }
 
 func (c *Client) ScreenshotImage() (image.Image, error) {
@@ -64,6 +109,87 @@ func (c *Client) ScreenshotImage() (image.Image, error) {
 	return img, err
 }
 
+// ScreenshotAs returns a screenshot encoded in the given format
+func (c *Client) ScreenshotAs(format Format) ([]byte, error) {
+	data, err := c.Screenshot()
+	if err != nil {
+		return nil, err
+	}
+	return Convert(data, format)
+}
+
+// Record takes a screenshot every interval (as fast as the device allows if interval is 0)
+// and passes each frame to fn until the context is canceled or fn returns an error
+func (c *Client) Record(ctx context.Context, interval time.Duration, fn func(frame int, data []byte) error) error {
+	for frame := 0; ; frame++ {
+		start := time.Now()
+		data, err := c.Screenshot()
+		if err != nil {
+			return fmt.Errorf("failed to capture frame %d: %w", frame, err)
+		}
+		if err := fn(frame, data); err != nil {
+			return err
+		}
+		wait := interval - time.Since(start)
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
 func (c *Client) Close() error {
 	return c.c.Close()
 }
+
+// Convert converts screenshot data (as returned by the device) to the given format
+//
+// NOTE: HEIC encoding uses sips and is only supported on macOS
+func Convert(data []byte, format Format) ([]byte, error) {
+	switch format {
+	case PNG:
+		return data, nil
+	case JPEG:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+			return nil, fmt.Errorf("failed to encode screenshot as JPEG: %w", err)
+		}
+		return buf.Bytes(), nil
+	case HEIC:
+		return sipsConvert(data, format)
+	default:
+		return nil, fmt.Errorf("unsupported screenshot format %s", format)
+	}
+}
+
+func sipsConvert(data []byte, format Format) ([]byte, error) {
+	if runtime.GOOS != "darwin" {
+		return nil, fmt.Errorf("%s screenshots are only supported on macOS", format)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "screenshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	in := filepath.Join(tmpDir, "screenshot.png")
+	out := filepath.Join(tmpDir, "screenshot"+format.Ext())
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+
+	if output, err := exec.Command("/usr/bin/sips", "-s", "format", string(format), in, "--out", out).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, output)
+	}
+
+	return os.ReadFile(out)
+}
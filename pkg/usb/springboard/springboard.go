@@ -3,6 +3,11 @@ package springboard
 //go:generate stringer -type=Orientation -output springboard_string.go
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/blacktop/ipsw/pkg/usb"
 	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
 )
@@ -36,8 +41,9 @@ func NewClient(udid string) (*Client, error) {
 }
 
 type springboardRequest struct {
-	Command  string `plist:"command,omitempty"`
-	BundleID string `plist:"bundleId,omitempty"`
+	Command       string `plist:"command,omitempty"`
+	BundleID      string `plist:"bundleId,omitempty"`
+	FormatVersion string `plist:"formatVersion,omitempty"`
 }
 
 type getPngResponse struct {
@@ -82,6 +88,89 @@ func (c *Client) GetInterfaceOrientation() (Orientation, error) {
 	return resp.InterfaceOrientation, nil
 }
 
+// Icon is a SpringBoard home screen icon (an app, web clip or folder)
+type Icon struct {
+	DisplayIdentifier string    `plist:"displayIdentifier,omitempty" json:"display_identifier,omitempty"`
+	DisplayName       string    `plist:"displayName,omitempty" json:"display_name,omitempty"`
+	BundleIdentifier  string    `plist:"bundleIdentifier,omitempty" json:"bundle_identifier,omitempty"`
+	BundleVersion     string    `plist:"bundleVersion,omitempty" json:"bundle_version,omitempty"`
+	IconModDate       time.Time `plist:"iconModDate,omitempty" json:"icon_mod_date,omitempty"`
+	ListType          string    `plist:"listType,omitempty" json:"list_type,omitempty"`
+	IconLists         [][]Icon  `plist:"iconLists,omitempty" json:"icon_lists,omitempty"`
+}
+
+// IsFolder returns true if the icon is a folder of icons
+func (i Icon) IsFolder() bool {
+	return i.ListType == "folder" || len(i.IconLists) > 0
+}
+
+// GetIconState returns the home screen layout as pages of icons (the first page is the dock)
+func (c *Client) GetIconState() ([][]Icon, error) {
+	req := &springboardRequest{
+		Command:       "getIconState",
+		FormatVersion: "2",
+	}
+	var resp [][]Icon
+	if err := c.c.Request(req, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ListIcons returns all the app icons on the home screen (including the ones in folders)
+func (c *Client) ListIcons() ([]Icon, error) {
+	pages, err := c.GetIconState()
+	if err != nil {
+		return nil, err
+	}
+	var icons []Icon
+	var walk func([][]Icon)
+	walk = func(lists [][]Icon) {
+		for _, list := range lists {
+			for _, icon := range list {
+				if icon.IsFolder() {
+					walk(icon.IconLists)
+					continue
+				}
+				icons = append(icons, icon)
+			}
+		}
+	}
+	walk(pages)
+	return icons, nil
+}
+
+// HasIcon returns true if an icon with the given bundle ID is on the home screen
+func (c *Client) HasIcon(bundleID string) (bool, error) {
+	icons, err := c.ListIcons()
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(icons, func(i Icon) bool {
+		return i.BundleIdentifier == bundleID || i.DisplayIdentifier == bundleID
+	}), nil
+}
+
+// WaitForIcon polls the home screen every interval until an icon with the given bundle ID appears or the context is canceled
+func (c *Client) WaitForIcon(ctx context.Context, bundleID string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ok, err := c.HasIcon(bundleID)
+		if err != nil {
+			return fmt.Errorf("failed to get icon state: %w", err)
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 func (c *Client) Close() error {
 	return c.c.Close()
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"strings"
 	"sync/atomic"
 	"syscall"
 
@@ -36,6 +38,29 @@ type Conn struct {
 	tag uint32
 }
 
+// UsbmuxdSocketEnv overrides the usbmuxd address (i.e. UNIX:/var/run/usbmuxd or 127.0.0.1:27015 like libimobiledevice)
+const UsbmuxdSocketEnv = "USBMUXD_SOCKET_ADDRESS"
+
+// usbmuxdAddr returns the network and address of usbmuxd
+func usbmuxdAddr() (string, string) {
+	if addr, ok := os.LookupEnv(UsbmuxdSocketEnv); ok && addr != "" {
+		if path, ok := strings.CutPrefix(addr, "UNIX:"); ok {
+			return "unix", path
+		}
+		return "tcp", addr
+	}
+	return usbmuxdNetwork, usbmuxdAddress
+}
+
+func usbmuxdDial() (net.Conn, error) {
+	network, addr := usbmuxdAddr()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to usbmuxd at %s (set %s to override it): %w", addr, UsbmuxdSocketEnv, err)
+	}
+	return conn, nil
+}
+
 func NewConn() (*Conn, error) {
 	conn, err := usbmuxdDial()
 	if err != nil {
@@ -0,0 +1,265 @@
+package vdev
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+const (
+	corelliumDefaultHost = "https://app.corellium.com"
+	syslogPollInterval   = time.Second
+)
+
+// Corellium is a Corellium REST API backend
+type Corellium struct {
+	host    string
+	token   string
+	project string
+	client  *http.Client
+}
+
+type corelliumInstance struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Flavor  string `json:"flavor"`
+	OS      string `json:"os"`
+	OSBuild string `json:"osBuild"`
+	State   string `json:"state"`
+	Project string `json:"project"`
+}
+
+func (i corelliumInstance) instance() Instance {
+	return Instance{
+		ID:      i.ID,
+		Name:    i.Name,
+		Flavor:  i.Flavor,
+		OS:      i.OS,
+		Build:   i.OSBuild,
+		State:   i.State,
+		Project: i.Project,
+	}
+}
+
+type corelliumThreadList struct {
+	PID      int    `json:"pid"`
+	KernelID string `json:"kernelId"`
+	Name     string `json:"name"`
+	Threads  []struct {
+		TID int `json:"tid"`
+	} `json:"threads"`
+}
+
+type corelliumError struct {
+	Error string `json:"error"`
+}
+
+// NewCorellium creates a Corellium backend (the token is a Corellium API token)
+func NewCorellium(conf *Config) (*Corellium, error) {
+	if conf == nil || len(conf.Token) == 0 {
+		return nil, fmt.Errorf("corellium backend requires an API token")
+	}
+	host := conf.Host
+	if len(host) == 0 {
+		host = corelliumDefaultHost
+	}
+	if !strings.HasPrefix(host, "http") {
+		host = "https://" + host
+	}
+	return &Corellium{
+		host:    strings.TrimSuffix(host, "/") + "/api/v1",
+		token:   conf.Token,
+		project: conf.Project,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           download.GetProxy(conf.Proxy),
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: conf.Insecure},
+			},
+		},
+	}, nil
+}
+
+// Name returns the backend name
+func (c *Corellium) Name() string {
+	return "corellium"
+}
+
+func (c *Corellium) do(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http %s request: %v", method, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send http request: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var cerr corelliumError
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &cerr) == nil && len(cerr.Error) > 0 {
+			return nil, fmt.Errorf("%s %s failed (%s): %s", method, path, resp.Status, cerr.Error)
+		}
+		return nil, fmt.Errorf("%s %s failed: %s", method, path, resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *Corellium) getJSON(ctx context.Context, path string, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// List returns the Corellium instances
+func (c *Corellium) List(ctx context.Context) ([]Instance, error) {
+	path := "/instances"
+	if len(c.project) > 0 {
+		path += "?project=" + url.QueryEscape(c.project)
+	}
+	var cinsts []corelliumInstance
+	if err := c.getJSON(ctx, path, &cinsts); err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	insts := make([]Instance, 0, len(cinsts))
+	for _, ci := range cinsts {
+		insts = append(insts, ci.instance())
+	}
+	return insts, nil
+}
+
+// Device returns the Corellium instance with the given ID (or name)
+func (c *Corellium) Device(ctx context.Context, id string) (Device, error) {
+	var ci corelliumInstance
+	if err := c.getJSON(ctx, "/instances/"+url.PathEscape(id), &ci); err != nil {
+		insts, lerr := c.List(ctx)
+		if lerr != nil {
+			return nil, err
+		}
+		for _, inst := range insts {
+			if inst.Name == id {
+				return &corelliumDevice{c: c, inst: inst}, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to find instance '%s': %w", id, err)
+	}
+	return &corelliumDevice{c: c, inst: ci.instance()}, nil
+}
+
+type corelliumDevice struct {
+	c    *Corellium
+	inst Instance
+}
+
+func (d *corelliumDevice) path(p string) string {
+	return "/instances/" + url.PathEscape(d.inst.ID) + p
+}
+
+func (d *corelliumDevice) agentFile(p string) string {
+	return d.path("/agent/v1/file/device/" + url.PathEscape(p))
+}
+
+func (d *corelliumDevice) Info() *Instance {
+	return &d.inst
+}
+
+// Syslog streams the instance's console log (polling for NEW output when following)
+func (d *corelliumDevice) Syslog(ctx context.Context, follow bool, fn func(line string)) error {
+	var seen int
+	var partial string
+	for {
+		resp, err := d.c.do(ctx, http.MethodGet, d.path("/consoleLog"), nil, "")
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to get console log: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read console log: %w", err)
+		}
+		if len(data) < seen { // log was reset (i.e. reboot)
+			seen = 0
+			partial = ""
+		}
+		chunk := partial + string(data[seen:])
+		seen = len(data)
+		lines := strings.Split(chunk, "\n")
+		// the last line may be incomplete so hold on to it until it's terminated
+		partial = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			fn(strings.TrimRight(line, "\r"))
+		}
+		if !follow {
+			if len(partial) > 0 {
+				fn(strings.TrimRight(partial, "\r"))
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(syslogPollInterval):
+		}
+	}
+}
+
+// Processes returns the instance's processes (via the CoreTrace thread list)
+func (d *corelliumDevice) Processes(ctx context.Context) ([]Process, error) {
+	var tl []corelliumThreadList
+	if err := d.c.getJSON(ctx, d.path("/strace/thread-list"), &tl); err != nil {
+		return nil, fmt.Errorf("failed to get thread list: %w", err)
+	}
+	procs := make([]Process, 0, len(tl))
+	for _, t := range tl {
+		procs = append(procs, Process{PID: t.PID, Name: t.Name, Threads: len(t.Threads)})
+	}
+	return procs, nil
+}
+
+// Pull downloads a file via the Corellium agent
+func (d *corelliumDevice) Pull(ctx context.Context, path string, w io.Writer) error {
+	resp, err := d.c.do(ctx, http.MethodGet, d.agentFile(path), nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Push uploads a file via the Corellium agent
+func (d *corelliumDevice) Push(ctx context.Context, r io.Reader, path string) error {
+	resp, err := d.c.do(ctx, http.MethodPut, d.agentFile(path), r, "application/octet-stream")
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", path, err)
+	}
+	return resp.Body.Close()
+}
+
+// Remove deletes a file via the Corellium agent
+func (d *corelliumDevice) Remove(ctx context.Context, path string) error {
+	resp, err := d.c.do(ctx, http.MethodDelete, d.agentFile(path), nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", path, err)
+	}
+	return resp.Body.Close()
+}
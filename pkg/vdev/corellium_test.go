@@ -0,0 +1,79 @@
+package vdev
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCorellium(t *testing.T) {
+	var uploaded []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(corelliumError{Error: "bad token"})
+			return
+		}
+		switch {
+		case r.URL.Path == "/api/v1/instances":
+			json.NewEncoder(w).Encode([]corelliumInstance{{ID: "abc", Name: "test", Flavor: "iphone14p", OS: "17.0", State: "on"}})
+		case r.URL.Path == "/api/v1/instances/abc":
+			json.NewEncoder(w).Encode(corelliumInstance{ID: "abc", Name: "test", Flavor: "iphone14p", OS: "17.0", State: "on"})
+		case r.URL.Path == "/api/v1/instances/abc/consoleLog":
+			io.WriteString(w, "line one\r\nline two\n")
+		case r.URL.Path == "/api/v1/instances/abc/strace/thread-list":
+			io.WriteString(w, `[{"pid":1,"kernelId":"0x1","name":"launchd","threads":[{"tid":1},{"tid":2}]}]`)
+		case r.URL.Path == "/api/v1/instances/abc/agent/v1/file/device//tmp/test" && r.Method == http.MethodPut:
+			uploaded, _ = io.ReadAll(r.Body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	backend, err := NewBackend("corellium", &Config{Host: srv.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	insts, err := backend.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(insts) != 1 || insts[0].ID != "abc" {
+		t.Fatalf("List() = %v", insts)
+	}
+
+	dev, err := backend.Device(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	if err := dev.Syslog(ctx, false, func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != "line one" {
+		t.Errorf("Syslog() = %q", lines)
+	}
+
+	procs, err := dev.Processes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 1 || procs[0].Name != "launchd" || procs[0].Threads != 2 {
+		t.Errorf("Processes() = %v", procs)
+	}
+
+	if err := dev.Push(ctx, bytes.NewReader([]byte("data")), "/tmp/test"); err != nil {
+		t.Fatal(err)
+	}
+	if string(uploaded) != "data" {
+		t.Errorf("uploaded = %q", uploaded)
+	}
+}
@@ -0,0 +1,93 @@
+// Package vdev is an abstraction for remote virtual devices (i.e. Corellium virtual iPhones)
+package vdev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ErrNotSupported is returned when a backend does not support an operation
+var ErrNotSupported = errors.New("not supported by this virtual device backend")
+
+// Config is the backend connection config
+type Config struct {
+	Host     string
+	Token    string
+	Project  string
+	Proxy    string
+	Insecure bool
+}
+
+// Instance is a virtual device
+type Instance struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Flavor  string `json:"flavor"`
+	OS      string `json:"os"`
+	Build   string `json:"build,omitempty"`
+	State   string `json:"state"`
+	Project string `json:"project,omitempty"`
+}
+
+func (i Instance) String() string {
+	return fmt.Sprintf("%s %s (%s %s) [%s] %s", i.ID, i.Name, i.Flavor, i.OS, i.State, i.Build)
+}
+
+// Process is a process running on a virtual device
+type Process struct {
+	PID     int    `json:"pid"`
+	Name    string `json:"name"`
+	Threads int    `json:"threads,omitempty"`
+}
+
+// Device is a remote virtual device
+type Device interface {
+	// Info returns the instance info
+	Info() *Instance
+	// Syslog calls fn for every console/syslog line (if follow is true until ctx is canceled)
+	Syslog(ctx context.Context, follow bool, fn func(line string)) error
+	// Processes returns the running processes
+	Processes(ctx context.Context) ([]Process, error)
+	// Pull downloads the file at path on the device to w
+	Pull(ctx context.Context, path string, w io.Writer) error
+	// Push uploads r to path on the device
+	Push(ctx context.Context, r io.Reader, path string) error
+	// Remove deletes the file at path on the device
+	Remove(ctx context.Context, path string) error
+}
+
+// Backend is a provider of remote virtual devices
+type Backend interface {
+	// Name returns the backend name
+	Name() string
+	// List returns the available virtual devices
+	List(ctx context.Context) ([]Instance, error)
+	// Device returns the virtual device with the given ID (or name)
+	Device(ctx context.Context, id string) (Device, error)
+}
+
+var backends = map[string]func(*Config) (Backend, error){
+	"corellium": func(conf *Config) (Backend, error) { return NewCorellium(conf) },
+}
+
+// Backends returns the names of the supported backends
+func Backends() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend creates the named virtual device backend
+func NewBackend(name string, conf *Config) (Backend, error) {
+	newFn, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown virtual device backend '%s' (supported: %v)", name, Backends())
+	}
+	return newFn(conf)
+}
@@ -48,6 +48,9 @@ const sidebars = {
         "guides/ota",
         "guides/dump_dsc_syms",
         "guides/ent",
+        "guides/loc",
+        "guides/xprotect",
+        "guides/jetsam",
         "guides/img4",
         "guides/stub_islands",
         "guides/gadget_search",